@@ -0,0 +1,303 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/sa/gopherwiki/internal/cluster"
+	"github.com/sa/gopherwiki/internal/config"
+	"github.com/sa/gopherwiki/internal/db"
+	"github.com/sa/gopherwiki/internal/handlers"
+	"github.com/sa/gopherwiki/internal/storage"
+)
+
+// wikiFlags are the flags of every command that opens the wiki.
+type wikiFlags struct {
+	configFile *string
+	repoPath   *string
+	dbPath     *string
+	wiki       *string
+}
+
+func addWikiFlags(fs *flag.FlagSet) *wikiFlags {
+	return &wikiFlags{
+		configFile: fs.String("config", "", "Path to YAML or TOML configuration file"),
+		repoPath:   fs.String("repo", "", "Path to wiki git repository"),
+		dbPath:     fs.String("db", "", "Path to SQLite database file"),
+		wiki:       fs.String("wiki", "", "Wiki to work on, of those the config file lists under wikis"),
+	}
+}
+
+// file returns the config file given by -config or CONFIG_FILE.
+func (f *wikiFlags) file() string {
+	if *f.configFile != "" {
+		return *f.configFile
+	}
+	return os.Getenv("CONFIG_FILE")
+}
+
+// read reads the configuration and narrows it to the wiki -wiki names.
+func (f *wikiFlags) read() (*config.Config, error) {
+	cfg, err := loadConfig(f.file())
+	if err != nil {
+		return nil, err
+	}
+	if *f.wiki != "" {
+		w, ok := cfg.Wiki(*f.wiki)
+		if !ok {
+			return nil, fmt.Errorf("the config file lists no wiki %q", *f.wiki)
+		}
+		cfg = cfg.WikiConfig(w)
+	}
+	return cfg, nil
+}
+
+// load reads the configuration, applies -repo, and sets up logging.
+func (f *wikiFlags) load() (*config.Config, error) {
+	cfg, err := f.read()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load config file: %w", err)
+	}
+	if *f.repoPath != "" {
+		cfg.Repository = *f.repoPath
+	}
+	initLogger(cfg)
+	return cfg, nil
+}
+
+// wikiEnv is an open repository and database.
+type wikiEnv struct {
+	cfg   *config.Config
+	store storage.Storage
+	repo  *storage.GitStorage // The repository under store; nil in memory
+	db    *db.Database
+	users *db.Database  // db, or the database USERS_DATABASE_URI names
+	node  *cluster.Node // With CLUSTER_ENABLED; otherwise nil
+}
+
+// openWiki validates cfg and opens its repository and database, migrating
+// the database. With create set, a missing repository is created and
+// initialized; otherwise it must already be a git repository. dbPath, when
+// set, overrides DATABASE_URI. With STORAGE_BACKEND=memory the wiki starts
+// empty, in memory, and so does its database unless one is configured.
+func openWiki(cfg *config.Config, dbPath string, create bool) (*wikiEnv, error) {
+	if len(cfg.Wikis) > 0 {
+		return nil, fmt.Errorf("the config file lists several wikis; choose one with -wiki")
+	}
+	memory := cfg.StorageBackend == "memory"
+	if create && !memory && cfg.Repository != "" {
+		if _, err := os.Stat(cfg.Repository); os.IsNotExist(err) {
+			slog.Info("creating repository", "path", cfg.Repository)
+			if err := os.MkdirAll(cfg.Repository, 0o755); err != nil {
+				return nil, fmt.Errorf("failed to create repository directory: %w", err)
+			}
+		}
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("configuration error: %w", err)
+	}
+
+	var repo *storage.GitStorage
+	var store storage.Storage
+	var err error
+	if memory {
+		slog.Warn("keeping the wiki in memory; its pages and history are lost on exit")
+		store = storage.NewMemoryStorage()
+	} else {
+		// Check if repository is a git repo, if not, initialize it
+		gitDir := filepath.Join(cfg.Repository, ".git")
+		if _, statErr := os.Stat(gitDir); os.IsNotExist(statErr) {
+			if !create {
+				return nil, fmt.Errorf("%s is not a git repository; run gopherwiki init first", cfg.Repository)
+			}
+			slog.Info("initializing git repository", "path", cfg.Repository)
+			repo, err = storage.NewGitStorage(cfg.Repository, true)
+		} else {
+			repo, err = storage.NewGitStorage(cfg.Repository, false)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to initialize storage: %w", err)
+		}
+		if cfg.GitBinary != "" {
+			if err := repo.UseGitBinary(cfg.GitBinary); err != nil {
+				return nil, err
+			}
+		}
+		store = repo
+	}
+
+	// Encryption at rest (optional)
+	attachmentCipher, dbKey, err := setupEncryption(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to set up encryption: %w", err)
+	}
+	if attachmentCipher != nil {
+		slog.Info("encrypting attachments at rest")
+		store = storage.NewEncryptedStorage(store, attachmentCipher)
+	}
+	// Outermost, so timings cover everything between a handler and the disk.
+	timed := storage.NewTimedStorage(store, time.Duration(cfg.GitSlowOpMS)*time.Millisecond)
+	timed.SetTimeouts(time.Duration(cfg.GitReadTimeoutMS)*time.Millisecond, time.Duration(cfg.GitHistoryTimeoutMS)*time.Millisecond)
+	store = timed
+
+	dbURI := cfg.DatabaseURI
+	if dbPath != "" {
+		dbURI = "sqlite:///" + dbPath
+	}
+	if !memory && (dbURI == "" || dbURI == "sqlite:///:memory:") {
+		// Default to file in repository
+		dbURI = "sqlite:///" + filepath.Join(cfg.Repository, ".wiki.db")
+	}
+
+	database, err := openDatabase(dbURI, dbKey)
+	if err != nil {
+		return nil, err
+	}
+	env := &wikiEnv{cfg: cfg, store: store, repo: repo, db: database, users: database}
+	if cfg.UsersDatabaseURI != "" {
+		if env.users, err = openDatabase(cfg.UsersDatabaseURI, dbKey); err != nil {
+			database.Close()
+			return nil, fmt.Errorf("users database: %w", err)
+		}
+	}
+	if cfg.ClusterEnabled {
+		env.joinCluster(repo)
+	}
+	return env, nil
+}
+
+// joinCluster makes the wiki one of several processes sharing its
+// repository and database: commits take a lock held in the database, and a
+// reload marker reopens the repository in every process, not just the one
+// that finds it.
+func (e *wikiEnv) joinCluster(repo *storage.GitStorage) {
+	id := e.cfg.InstanceID
+	if id == "" {
+		id = cluster.DefaultID()
+	}
+	node := cluster.New(e.db, id)
+	repo.SetSharedLock(node.LockRepository)
+	repo.OnReload(func() {
+		node.Publish(context.Background(), cluster.TopicGitReload)
+	})
+	node.Watch(cluster.TopicGitReload, func() {
+		if err := repo.Reopen(); err != nil {
+			slog.Warn("failed to reopen repository", "error", err)
+		}
+	})
+	slog.Info("joined cluster", "instance", id)
+	e.node = node
+}
+
+// openDatabase opens and migrates the database at uri, encrypted with key
+// when it is set.
+func openDatabase(uri string, key []byte) (*db.Database, error) {
+	var database *db.Database
+	var err error
+	if key != nil {
+		slog.Info("opening encrypted database", "uri", uri)
+		database, err = db.OpenEncrypted(uri, key)
+	} else {
+		database, err = db.Open(uri)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+	if err := database.Migrate(context.Background()); err != nil {
+		database.Close()
+		return nil, fmt.Errorf("failed to run migrations: %w", err)
+	}
+	return database, nil
+}
+
+// server returns a server for the wiki, for commands that use its services
+// without serving HTTP.
+func (e *wikiEnv) server() (*handlers.Server, error) {
+	server, err := handlers.NewServerWithUsers(e.cfg, e.store, e.db, e.users, Version)
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range plugins {
+		if err := server.Plugins.Register(p); err != nil {
+			return nil, err
+		}
+	}
+	if e.node != nil {
+		server.JoinCluster(e.node)
+	}
+	if e.repo != nil {
+		server.Maintainer = e.repo
+	}
+	return server, nil
+}
+
+func (e *wikiEnv) Close() error {
+	if e.users != e.db {
+		e.users.Close()
+	}
+	return e.db.Close()
+}
+
+// createInitialPages adds a home page and the syntax guide to a repository
+// without pages.
+func createInitialPages(ctx context.Context, store storage.Storage, cfg *config.Config) {
+	files, _, err := store.List(ctx, "", nil, nil)
+	if err != nil {
+		slog.Warn("failed to list repository files", "error", err)
+	}
+	// Filter out hidden files like .wiki.db
+	for _, f := range files {
+		if !strings.HasPrefix(f, ".") && strings.HasSuffix(f, ".md") {
+			return
+		}
+	}
+
+	slog.Info("creating initial pages")
+	author := storage.Author{
+		Name:  "GopherWiki",
+		Email: "noreply@gopherwiki",
+	}
+	homeFilename := "home.md"
+	if cfg.RetainPageNameCase {
+		homeFilename = "Home.md"
+	}
+	if _, err := store.Store(ctx, homeFilename, homeContent, "Initial commit", author); err != nil {
+		slog.Warn("failed to create initial home page", "error", err)
+	}
+
+	guideFilename := "syntaxguide.md"
+	if cfg.RetainPageNameCase {
+		guideFilename = "SyntaxGuide.md"
+	}
+	if _, err := store.Store(ctx, guideFilename, syntaxGuideContent, "Add syntax guide", author); err != nil {
+		slog.Warn("failed to create syntax guide page", "error", err)
+	}
+}
+
+const homeContent = `# Welcome to GopherWiki
+
+This is your new wiki. Start editing this page or create new pages.
+
+## Getting Started
+
+- Click the edit button (pencil icon) to edit this page
+- Use [[WikiLinks]] to link to other pages
+- Markdown formatting is fully supported
+- See the [[SyntaxGuide]] for all supported features
+
+## Features
+
+- **Markdown**: Full markdown support with extensions
+- **Git Backend**: All changes are versioned with git
+- **WikiLinks**: [[Link to pages]] with double brackets
+- **Attachments**: Upload and embed images and files
+- **History**: View and compare page revisions
+
+Enjoy your wiki!
+`
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/sa/gopherwiki/internal/backup"
+)
+
+// runBackup implements "gopherwiki backup [flags]". It writes the archive
+// the admin backup downloads, which "gopherwiki restore" reads back.
+func runBackup(args []string) error {
+	fs := flag.NewFlagSet("backup", flag.ExitOnError)
+	flags := addWikiFlags(fs)
+	output := fs.String("o", "", "Archive to write; - for standard output (default: gopherwiki-backup-<time>.tar.gz)")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: gopherwiki backup [flags]")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	cfg, err := flags.load()
+	if err != nil {
+		return err
+	}
+	env, err := openWiki(cfg, *flags.dbPath, false)
+	if err != nil {
+		return err
+	}
+	defer env.Close()
+
+	src := backup.Source{Storage: env.store, DB: env.db, Config: cfg, Version: Version}
+	ctx := context.Background()
+	name := *output
+	if name == "" {
+		name = backup.Filename(time.Now())
+	}
+	if name == "-" {
+		_, err := backup.Write(ctx, os.Stdout, src)
+		return err
+	}
+	f, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := backup.Write(ctx, f, src); err != nil {
+		f.Close()
+		os.Remove(name)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "Wrote backup to %s\n", name)
+	return nil
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/sa/gopherwiki/internal/config"
+)
+
+// runConfig implements "gopherwiki config print": it writes the effective
+// configuration, after the config file and environment variables, as a
+// config file with the secrets masked. It fails if the configuration does
+// not validate, after printing it.
+func runConfig(args []string) error {
+	if len(args) == 0 || args[0] != "print" {
+		fmt.Fprintln(os.Stderr, "Usage: gopherwiki config print [flags]")
+		return fmt.Errorf("expected the print subcommand")
+	}
+	fs := flag.NewFlagSet("config print", flag.ExitOnError)
+	flags := addWikiFlags(fs)
+	format := fs.String("format", "", "Output format, yaml or toml (default: that of the config file, else yaml)")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: gopherwiki config print [flags]")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args[1:])
+
+	cfg, err := flags.load()
+	if err != nil {
+		return err
+	}
+	if *flags.dbPath != "" {
+		cfg.DatabaseURI = "sqlite:///" + *flags.dbPath
+	}
+	if *format == "" {
+		*format = "yaml"
+		if strings.HasSuffix(strings.ToLower(flags.file()), ".toml") {
+			*format = "toml"
+		}
+	}
+
+	fc := config.FromConfig(cfg)
+	fc.MaskSecrets()
+	if err := fc.Encode(os.Stdout, *format); err != nil {
+		return err
+	}
+	if err := cfg.Validate(); err != nil {
+		return fmt.Errorf("configuration error: %w", err)
+	}
+	return nil
+}
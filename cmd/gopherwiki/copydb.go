@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"text/tabwriter"
+
+	"github.com/sa/gopherwiki/internal/db"
+)
+
+// runCopyDB implements "gopherwiki copy-db -to URI": it copies the wiki's
+// database into another, empty one, which is how a wiki moves from SQLite to
+// PostgreSQL or back. The search index is not copied; the wiki rebuilds it
+// when it first starts on the new database.
+func runCopyDB(args []string) error {
+	fs := flag.NewFlagSet("copy-db", flag.ExitOnError)
+	flags := addWikiFlags(fs)
+	to := fs.String("to", "", "Database URI to copy into, e.g. postgres://user@host/wiki (required)")
+	from := fs.String("from", "", "Database URI to copy from (default: the wiki's database)")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: gopherwiki copy-db -to URI [flags]")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if *to == "" {
+		fs.Usage()
+		return fmt.Errorf("-to is required")
+	}
+
+	var src *db.Database
+	if *from != "" {
+		var err error
+		if src, err = openDatabase(*from, nil); err != nil {
+			return err
+		}
+		defer src.Close()
+	} else {
+		cfg, err := flags.load()
+		if err != nil {
+			return err
+		}
+		env, err := openWiki(cfg, *flags.dbPath, false)
+		if err != nil {
+			return err
+		}
+		defer env.Close()
+		src = env.db
+		if env.users != env.db {
+			fmt.Fprintln(os.Stderr, "Note: the users database is separate; copy it with -from $USERS_DATABASE_URI")
+		}
+	}
+
+	dst, err := openDatabase(*to, nil)
+	if err != nil {
+		return fmt.Errorf("destination: %w", err)
+	}
+	defer dst.Close()
+
+	counts, err := db.Copy(context.Background(), dst, src)
+	if err != nil {
+		return err
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	tables := make([]string, 0, len(counts))
+	total := 0
+	for table, n := range counts {
+		tables = append(tables, table)
+		total += n
+	}
+	sort.Strings(tables)
+	for _, table := range tables {
+		fmt.Fprintf(tw, "%s\t%d rows\n", table, counts[table])
+	}
+	tw.Flush()
+	fmt.Printf("Copied %d rows; the search index is rebuilt when the wiki starts\n", total)
+	return nil
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/sa/gopherwiki/internal/pandoc"
+	"github.com/sa/gopherwiki/internal/quarto"
+)
+
+// doctorReport prints the outcome of each check and counts the failures.
+type doctorReport struct {
+	failed int
+}
+
+func (r *doctorReport) ok(check, detail string) {
+	fmt.Printf("ok    %-14s %s\n", check, detail)
+}
+
+func (r *doctorReport) warn(check, detail string) {
+	fmt.Printf("warn  %-14s %s\n", check, detail)
+}
+
+func (r *doctorReport) fail(check string, err error) {
+	r.failed++
+	fmt.Printf("FAIL  %-14s %v\n", check, err)
+}
+
+// runDoctor implements "gopherwiki doctor": it checks the configuration,
+// repository, database, search index, and optional tools, and fails if any
+// check fails. Warnings point at problems that do not stop the wiki.
+func runDoctor(args []string) error {
+	fs := flag.NewFlagSet("doctor", flag.ExitOnError)
+	flags := addWikiFlags(fs)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: gopherwiki doctor [flags]")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	report := &doctorReport{}
+	cfg, err := flags.load()
+	if err != nil {
+		report.fail("config", err)
+		return fmt.Errorf("1 check failed")
+	}
+	if cfg.DevMode {
+		report.warn("config", "DEV_MODE is enabled, do not use it in production")
+	}
+
+	env, err := openWiki(cfg, *flags.dbPath, false)
+	if err != nil {
+		report.fail("wiki", err)
+		return fmt.Errorf("1 check failed")
+	}
+	defer env.Close()
+	report.ok("config", "valid")
+	server, err := env.server()
+	if err != nil {
+		report.fail("server", err)
+		return fmt.Errorf("1 check failed")
+	}
+	ctx := context.Background()
+
+	checks, _ := server.DeepHealth(ctx)
+	names := make([]string, 0, len(checks))
+	for name := range checks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if c := checks[name]; c.Status == "ok" {
+			report.ok(name, fmt.Sprintf("%d ms", c.DurationMS))
+		} else {
+			report.fail(name, fmt.Errorf("%s", c.Error))
+		}
+	}
+
+	if pages, err := server.Wiki.PageIndex(ctx); err != nil {
+		report.fail("pages", err)
+	} else if indexed, err := env.db.PageIndexCount(ctx); err != nil {
+		report.fail("pages", err)
+	} else if indexed != int64(len(pages)) {
+		report.warn("pages", fmt.Sprintf("%d pages, %d indexed; run gopherwiki reindex", len(pages), indexed))
+	} else {
+		report.ok("pages", fmt.Sprintf("%d pages indexed", indexed))
+	}
+
+	if users, err := server.Auth.ListUsers(ctx); err != nil {
+		report.fail("users", err)
+	} else {
+		admins := 0
+		for _, u := range users {
+			if u.Admin() {
+				admins++
+			}
+		}
+		if admins == 0 {
+			report.warn("users", "no admin; create one with gopherwiki user add -admin <email>")
+		} else {
+			report.ok("users", fmt.Sprintf("%d users, %d admins", len(users), admins))
+		}
+	}
+
+	if cfg.QuartoEnabled || cfg.ExportEnabled {
+		if caps := quarto.Detect(ctx, cfg.QuartoPath); caps.Available {
+			report.ok("quarto", caps.Version)
+		} else {
+			report.warn("quarto", fmt.Sprintf("enabled but %q was not found", cfg.QuartoPath))
+		}
+	}
+	if cfg.PandocEnabled {
+		if caps := pandoc.Detect(ctx, cfg.PandocPath); caps.Available {
+			report.ok("pandoc", caps.Version)
+		} else if caps.Version != "" {
+			report.warn("pandoc", fmt.Sprintf("enabled but %s is older than 2.19, which export needs", caps.Version))
+		} else {
+			report.warn("pandoc", fmt.Sprintf("enabled but %q was not found", cfg.PandocPath))
+		}
+	}
+	if cfg.GeminiPort > 0 && cfg.GeminiCertFile != "" {
+		if _, err := os.Stat(cfg.GeminiCertFile); os.IsNotExist(err) {
+			report.warn("gemini", "no certificate yet; one is created on start")
+		} else if _, err := tls.LoadX509KeyPair(cfg.GeminiCertFile, cfg.GeminiKeyFile); err != nil {
+			report.fail("gemini", err)
+		} else {
+			report.ok("gemini", "certificate loads")
+		}
+	}
+
+	if report.failed > 0 {
+		return fmt.Errorf("%d checks failed", report.failed)
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/sa/gopherwiki/internal/storage"
+)
+
+// runExport implements "gopherwiki export [flags]". It writes the ZIP archive
+// the web export serves: the page sources and attachments below -path, or of
+// the whole wiki.
+func runExport(args []string) error {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	flags := addWikiFlags(fs)
+	dir := fs.String("path", "", "Page whose subtree to export (default: the whole wiki)")
+	output := fs.String("o", "", "Archive to write; - for standard output (default: <page>.zip or wiki.zip)")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: gopherwiki export [flags]")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	cfg, err := flags.load()
+	if err != nil {
+		return err
+	}
+	env, err := openWiki(cfg, *flags.dbPath, false)
+	if err != nil {
+		return err
+	}
+	defer env.Close()
+	server, err := env.server()
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	files, err := server.Wiki.ExportFiles(ctx, *dir)
+	if errors.Is(err, storage.ErrNotFound) {
+		return fmt.Errorf("nothing to export at %q", *dir)
+	}
+	if err != nil {
+		return err
+	}
+
+	name := *output
+	if name == "" {
+		name = archiveName(*dir)
+	}
+	if name == "-" {
+		return server.Wiki.WriteExportArchive(ctx, os.Stdout, files)
+	}
+	f, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	if err := server.Wiki.WriteExportArchive(ctx, f, files); err != nil {
+		f.Close()
+		os.Remove(name)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "Exported %d files to %s\n", len(files), name)
+	return nil
+}
+
+// archiveName names the archive of the subtree at dir in the current
+// directory, like the web export names its download.
+func archiveName(dir string) string {
+	base := path.Base(strings.Trim(dir, "/"))
+	if base == "." || base == "/" || base == "" {
+		base = "wiki"
+	}
+	return base + ".zip"
+}
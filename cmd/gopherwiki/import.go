@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"net/mail"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/sa/gopherwiki/internal/storage"
+	"github.com/sa/gopherwiki/internal/wiki"
+)
+
+// runImport implements "gopherwiki import [flags] <archive>". The archive is
+// a ZIP of Markdown pages and attachments, as the bulk import takes, or with
+// -mediawiki (or a name ending in .xml, .xml.gz, or .xml.bz2) a MediaWiki XML
+// dump. The report lists every entry that is not unchanged.
+func runImport(args []string) error {
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	flags := addWikiFlags(fs)
+	prefix := fs.String("prefix", "", "Directory to import into (default: the root of the wiki)")
+	overwrite := fs.Bool("overwrite", false, "Replace existing files that differ instead of reporting conflicts")
+	dryRun := fs.Bool("dry-run", false, "Report what would be imported without committing anything")
+	perFile := fs.Bool("per-file", false, "Commit each file on its own (ZIP archives)")
+	message := fs.String("message", "", "Commit message (ZIP archives)")
+	mediaWiki := fs.Bool("mediawiki", false, "The archive is a MediaWiki XML dump")
+	latestOnly := fs.Bool("latest-only", false, "Import only the current revision of each page (MediaWiki dumps)")
+	authorFlag := fs.String("author", "GopherWiki <noreply@gopherwiki>", "Commit author, as \"Name <email>\"")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: gopherwiki import [flags] <archive>")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return fmt.Errorf("expected exactly one archive path")
+	}
+	author, err := parseAuthor(*authorFlag)
+	if err != nil {
+		return err
+	}
+
+	cfg, err := flags.load()
+	if err != nil {
+		return err
+	}
+	env, err := openWiki(cfg, *flags.dbPath, false)
+	if err != nil {
+		return err
+	}
+	defer env.Close()
+	server, err := env.server()
+	if err != nil {
+		return err
+	}
+
+	name := fs.Arg(0)
+	f, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	ctx := context.Background()
+	var report *wiki.ImportReport
+	lower := strings.ToLower(name)
+	if *mediaWiki || strings.HasSuffix(lower, ".xml") || strings.HasSuffix(lower, ".xml.gz") || strings.HasSuffix(lower, ".xml.bz2") {
+		report, err = server.Wiki.ImportMediaWiki(ctx, f, wiki.MediaWikiOptions{
+			Prefix:     *prefix,
+			Overwrite:  *overwrite,
+			LatestOnly: *latestOnly,
+			DryRun:     *dryRun,
+		}, author)
+	} else {
+		info, statErr := f.Stat()
+		if statErr != nil {
+			return statErr
+		}
+		if info.Size() > wiki.MaxImportSize {
+			return fmt.Errorf("archive is larger than %d MB", wiki.MaxImportSize>>20)
+		}
+		report, err = server.Wiki.Import(ctx, f, info.Size(), wiki.ImportOptions{
+			Prefix:         *prefix,
+			Overwrite:      *overwrite,
+			PerFileCommits: *perFile,
+			DryRun:         *dryRun,
+			Message:        *message,
+		}, author)
+	}
+	if err != nil {
+		return err
+	}
+	printImportReport(report)
+	return nil
+}
+
+// parseAuthor parses "Name <email>", or a bare name.
+func parseAuthor(s string) (storage.Author, error) {
+	if !strings.Contains(s, "<") {
+		return storage.Author{Name: strings.TrimSpace(s)}, nil
+	}
+	addr, err := mail.ParseAddress(s)
+	if err != nil {
+		return storage.Author{}, fmt.Errorf("invalid author %q: %w", s, err)
+	}
+	return storage.Author{Name: addr.Name, Email: addr.Address}, nil
+}
+
+func printImportReport(report *wiki.ImportReport) {
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	for _, e := range report.Entries {
+		if e.Action == wiki.ImportUnchanged {
+			continue
+		}
+		target := e.Path
+		if target == "" {
+			target = e.Name
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", e.Action, target, e.Reason)
+	}
+	tw.Flush()
+	verb := "Imported"
+	if report.DryRun {
+		verb = "Dry run:"
+	}
+	fmt.Printf("%s %d created, %d updated, %d unchanged, %d conflicts, %d skipped\n",
+		verb, report.Created, report.Updated, report.Unchanged, report.Conflicts, report.Skipped)
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+)
+
+// runInit implements "gopherwiki init [flags] [init-file]". It creates the
+// repository and the database, adds the initial pages to an empty
+// repository, and applies an initialization file when one is given. Running
+// it again is harmless.
+func runInit(args []string) error {
+	fs := flag.NewFlagSet("init", flag.ExitOnError)
+	flags := addWikiFlags(fs)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: gopherwiki init [flags] [init-file.json]")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() > 1 {
+		fs.Usage()
+		return fmt.Errorf("expected at most one init file")
+	}
+
+	cfg, err := flags.load()
+	if err != nil {
+		return err
+	}
+	env, err := openWiki(cfg, *flags.dbPath, true)
+	if err != nil {
+		return err
+	}
+	defer env.Close()
+
+	createInitialPages(context.Background(), env.store, cfg)
+	if fs.NArg() == 1 {
+		if err := processInitFile(fs.Arg(0), env.db, env.users, cfg); err != nil {
+			return fmt.Errorf("failed to process init file: %w", err)
+		}
+	}
+	fmt.Printf("Wiki ready in %s\n", cfg.Repository)
+	return nil
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/sa/gopherwiki/internal/cluster"
+	"github.com/sa/gopherwiki/internal/db"
+	"github.com/sa/gopherwiki/internal/handlers"
+	"github.com/sa/gopherwiki/internal/middleware"
+)
+
+// runJobs runs the wiki's periodic maintenance until ctx is done, each run
+// on the server stored in server then, which a configuration reload
+// replaces. The schedule is fixed at startup: reloads leave the settings it
+// depends on for the next restart. In a cluster only the leader runs it;
+// the other nodes just follow the changes published by the rest.
+func (e *wikiEnv) runJobs(ctx context.Context, server *atomic.Pointer[handlers.Server]) {
+	node := e.node
+	if node == nil {
+		node = cluster.Standalone()
+	}
+	jobs := []cluster.Job{
+		{Name: "prune-sessions", Every: time.Hour, Run: func(ctx context.Context) error {
+			return e.users.PruneUserSessions(ctx, time.Now().Add(-middleware.SessionMaxAge))
+		}},
+		{Name: "prune-password-resets", Every: time.Hour, Run: e.users.PrunePasswordResets},
+		{Name: "publish-scheduled-pages", Every: time.Minute, Run: func(ctx context.Context) error {
+			return server.Load().PublishScheduledPages(ctx)
+		}},
+		{Name: "remind-stale-pages", Every: 24 * time.Hour, Run: func(ctx context.Context) error {
+			return server.Load().RemindStalePages(ctx)
+		}},
+	}
+	if e.cfg.DraftTTLDays > 0 {
+		ttl := time.Duration(e.cfg.DraftTTLDays) * 24 * time.Hour
+		jobs = append(jobs, cluster.Job{Name: "prune-drafts", Every: time.Hour, Run: func(ctx context.Context) error {
+			return e.db.Queries.DeleteDraftsBefore(ctx, db.NullTime(time.Now().Add(-ttl)))
+		}})
+	}
+	if e.cfg.ExternalLinkCheckHours > 0 {
+		every := time.Duration(e.cfg.ExternalLinkCheckHours) * time.Hour
+		jobs = append(jobs, cluster.Job{Name: "check-external-links", Every: every, Run: func(ctx context.Context) error {
+			// OFFLINE may be switched on and off by reloads.
+			if s := server.Load(); !s.Config.Offline {
+				return s.CheckExternalLinks(ctx)
+			}
+			return nil
+		}})
+	}
+	if e.repo != nil && e.cfg.GitMaintenanceHours > 0 {
+		every := time.Duration(e.cfg.GitMaintenanceHours) * time.Hour
+		jobs = append(jobs, cluster.Job{Name: "maintain-repository", Every: every, Run: func(ctx context.Context) error {
+			// Jobs first run at startup; a restart need not repack again.
+			if runs, err := e.db.ListRepositoryMaintenance(ctx, 1); err != nil || (len(runs) > 0 && time.Since(runs[0].RanAt) < every) {
+				return err
+			}
+			_, err := server.Load().MaintainRepository(ctx)
+			return err
+		}})
+	}
+	node.Run(ctx, jobs)
+}
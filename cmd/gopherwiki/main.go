@@ -3,31 +3,27 @@ package main
 
 import (
 	"context"
-	"crypto/rand"
+	"crypto/tls"
 	"database/sql"
 	_ "embed"
-	"encoding/hex"
 	"encoding/json"
-	"flag"
 	"fmt"
-	"io/fs"
+	"io"
 	"log/slog"
-	"net/http"
+	"net/url"
 	"os"
-	"os/signal"
-	"path/filepath"
 	"strings"
-	"syscall"
 	"time"
 
 	"github.com/sa/gopherwiki/internal/auth"
 	"github.com/sa/gopherwiki/internal/config"
 	"github.com/sa/gopherwiki/internal/db"
+	"github.com/sa/gopherwiki/internal/encryption"
+	"github.com/sa/gopherwiki/internal/gemini"
 	"github.com/sa/gopherwiki/internal/handlers"
+	"github.com/sa/gopherwiki/internal/pandoc"
 	"github.com/sa/gopherwiki/internal/quarto"
 	"github.com/sa/gopherwiki/internal/rendercache"
-	"github.com/sa/gopherwiki/internal/storage"
-	"github.com/sa/gopherwiki/web"
 )
 
 // InitConfig represents the initialization configuration from JSON.
@@ -125,7 +121,9 @@ func setupRenderService(server *handlers.Server, cfg *config.Config) {
 	var cache *rendercache.Cache
 	if cfg.QuartoEnabled {
 		cachePath := cfg.RenderCachePath
-		if cachePath == "" {
+		// Beside a SQLite database; a PostgreSQL wiki keeps the cache in
+		// memory unless RENDER_CACHE_PATH places it.
+		if cachePath == "" && !db.IsPostgresURI(cfg.DatabaseURI) {
 			cachePath = rendercache.DefaultPath(sqlitePath(cfg.DatabaseURI))
 		}
 		c, err := rendercache.Open(cachePath)
@@ -141,6 +139,8 @@ func setupRenderService(server *handlers.Server, cfg *config.Config) {
 	opts := []quarto.Option{quarto.WithInterpreters(interp), quarto.WithExport(cfg.ExportEnabled)}
 	if cfg.OJSLibsDir != "" {
 		opts = append(opts, quarto.WithOJSLocalLibs("/ojs-libs"))
+	} else if cfg.Offline {
+		slog.Warn("OFFLINE is set without OJS_LIBS_DIR; Observable JS cells cannot load their libraries")
 	}
 	server.RenderService = quarto.NewService(caps, cache, timeout, cfg.RenderConcurrency, opts...)
 	slog.Info("quarto support enabled",
@@ -150,304 +150,177 @@ func setupRenderService(server *handlers.Server, cfg *config.Config) {
 		"ojs_local_libs", cfg.OJSLibsDir != "")
 }
 
-// sqlitePath extracts a filesystem path from a sqlite database URI. It mirrors
-// the parsing in db.Open so the render cache can be placed beside the primary
-// database.
-func sqlitePath(uri string) string {
-	path := uri
-	if strings.HasPrefix(uri, "sqlite:///") {
-		path = strings.TrimPrefix(uri, "sqlite:///")
-	} else if strings.HasPrefix(uri, "sqlite://") {
-		path = strings.TrimPrefix(uri, "sqlite://")
-	}
-	return path
-}
-
-// orDiscover renders an interpreter path for logging, showing "(discover)" when
-// none is pinned so the log makes the fallback behaviour explicit.
-func orDiscover(path string) string {
-	if path == "" {
-		return "(discover)"
+// setupConverter detects the Pandoc binary and wires the document converter
+// onto the server. Like Quarto support it is feature-detected and non-fatal:
+// without pandoc the Pandoc formats are simply not offered.
+func setupConverter(server *handlers.Server, cfg *config.Config) {
+	caps := pandoc.Detect(context.Background(), cfg.PandocPath)
+	if !caps.Available {
+		slog.Warn("pandoc export enabled but pandoc 2.19 or later was not found; Pandoc export is unavailable",
+			"pandoc_path", cfg.PandocPath, "pandoc_version", caps.Version)
+		return
 	}
-	return path
+	timeout := time.Duration(cfg.RenderTimeoutSecs) * time.Second
+	server.Converter = pandoc.NewConverter(caps, cfg.PandocPDFEngine, timeout)
+	slog.Info("pandoc export enabled",
+		"pandoc_version", caps.Version, "pdf_engine", cfg.PandocPDFEngine)
 }
 
-//go:embed syntax_guide.md
-var syntaxGuideContent string
-
-func main() {
-	// Parse command line flags
-	configFile := flag.String("config", "", "Path to YAML configuration file")
-	host := flag.String("host", "", "Host/IP to bind to (default: all interfaces)")
-	port := flag.Int("port", 0, "HTTP server port (default: 8080)")
-	repoPath := flag.String("repo", "", "Path to wiki git repository")
-	templatesPath := flag.String("templates", "", "Path to templates directory (overrides embedded)")
-	staticPath := flag.String("static", "", "Path to static files directory (overrides embedded)")
-	dbPath := flag.String("db", "", "Path to SQLite database file")
-	initFile := flag.String("init", "", "Path to initialization JSON file (run once to set up site)")
-	flag.Parse()
-
-	// Load configuration: defaults -> config file -> env vars -> CLI flags
-	cfgFile := *configFile
-	if cfgFile == "" {
-		cfgFile = os.Getenv("CONFIG_FILE")
-	}
-
-	var cfg *config.Config
-	if cfgFile != "" {
-		var err error
-		cfg, err = config.LoadWithFile(cfgFile)
-		if err != nil {
-			fatal("failed to load config file", "error", err)
+// startGemini starts the Gemini listener serving h. Without a configured
+// certificate a self-signed one is created, which clients see as a new
+// server identity after every restart.
+func startGemini(cfg *config.Config, h gemini.Handler) *gemini.Server {
+	hostname := cfg.GeminiHostname
+	if hostname == "" {
+		if u, err := url.Parse(cfg.SiteURL); err == nil && u.Hostname() != "" {
+			hostname = u.Hostname()
+		} else {
+			hostname = "localhost"
 		}
-	} else {
-		cfg = config.Load()
-	}
-
-	// Initialize structured logger
-	initLogger(cfg)
-
-	// Override config from command line flags (highest precedence)
-	if *host != "" {
-		cfg.Host = *host
 	}
-	if *port != 0 {
-		cfg.Port = *port
+	cert, err := gemini.LoadOrCreateCertificate(cfg.GeminiCertFile, cfg.GeminiKeyFile, hostname)
+	if err != nil {
+		fatal("failed to load gemini certificate", "error", err)
 	}
-	if *repoPath != "" {
-		cfg.Repository = *repoPath
+	if cfg.GeminiCertFile == "" {
+		slog.Warn("GEMINI_CERT_FILE is not set; the gemini certificate will change on restart")
 	}
 
-	// Create repository if it doesn't exist
-	if cfg.Repository != "" {
-		if _, err := os.Stat(cfg.Repository); os.IsNotExist(err) {
-			slog.Info("creating repository", "path", cfg.Repository)
-			if err := os.MkdirAll(cfg.Repository, 0o755); err != nil {
-				fatal("failed to create repository directory", "error", err)
-			}
-		}
+	srv := &gemini.Server{
+		Addr:      fmt.Sprintf("%s:%d", cfg.Host, cfg.GeminiPort),
+		TLSConfig: &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12},
+		Handler:   h,
 	}
-
-	// In dev mode, relax the SECRET_KEY requirement and prevent accidental
-	// network exposure.
-	if cfg.DevMode {
-		slog.Warn("DEV_MODE is enabled, do NOT use in production")
-		if cfg.SecretKey == "CHANGE ME" || len(cfg.SecretKey) < 16 {
-			// Generate an ephemeral per-process key rather than a shared,
-			// world-known constant: a leaked DEV_MODE in production must not
-			// let anyone forge a signed session cookie. Sessions reset on restart.
-			keyBytes := make([]byte, 32)
-			if _, err := rand.Read(keyBytes); err != nil {
-				fatal("failed to generate development secret key", "error", err)
-			}
-			cfg.SecretKey = hex.EncodeToString(keyBytes)
-			slog.Warn("using ephemeral random development secret key (sessions reset on restart)")
-		}
-		// Refuse to serve dev mode on a non-loopback interface.
-		if !isLoopbackHost(cfg.Host) {
-			slog.Warn("DEV_MODE forces binding to loopback", "requested_host", cfg.Host)
-			cfg.Host = "127.0.0.1"
+	go func() {
+		slog.Info("gemini server listening", "address", fmt.Sprintf("gemini://%s:%d", hostname, cfg.GeminiPort))
+		if err := srv.ListenAndServe(); err != nil && err != gemini.ErrServerClosed {
+			fatal("gemini server error", "error", err)
 		}
-	}
-
-	// Validate config (fatal in production)
-	if err := cfg.Validate(); err != nil {
-		fatal("configuration error", "error", err)
-	}
-
-	slog.Info("starting GopherWiki", "version", Version)
-
-	// Initialize storage
-	var store storage.Storage
-	var err error
+	}()
+	return srv
+}
 
-	// Check if repository is a git repo, if not, initialize it
-	gitDir := filepath.Join(cfg.Repository, ".git")
-	if _, err := os.Stat(gitDir); os.IsNotExist(err) {
-		slog.Info("initializing git repository", "path", cfg.Repository)
-		store, err = storage.NewGitStorage(cfg.Repository, true)
-	} else {
-		store, err = storage.NewGitStorage(cfg.Repository, false)
+// setupEncryption fetches the master key when encryption at rest is enabled
+// and derives the attachment cipher and database key from it. Either result
+// is nil when that kind of encryption is off.
+func setupEncryption(cfg *config.Config) (*encryption.Cipher, []byte, error) {
+	if !cfg.EncryptAttachments && !cfg.EncryptDatabase {
+		return nil, nil, nil
 	}
+	provider, err := encryption.NewKeyProvider(cfg.EncryptionKey, cfg.EncryptionKeyCommand)
 	if err != nil {
-		fatal("failed to initialize storage", "error", err)
-	}
-
-	// Initialize database
-	dbURI := cfg.DatabaseURI
-	if *dbPath != "" {
-		dbURI = "sqlite:///" + *dbPath
-	}
-	if dbURI == "" || dbURI == "sqlite:///:memory:" {
-		// Default to file in repository
-		dbURI = "sqlite:///" + filepath.Join(cfg.Repository, ".wiki.db")
-	}
-
-	database, err := db.Open(dbURI)
-	if err != nil {
-		fatal("failed to open database", "error", err)
-	}
-	defer database.Close()
-
-	// Run migrations
-	if err := database.Migrate(context.Background()); err != nil {
-		fatal("failed to run migrations", "error", err)
-	}
-
-	// Process init file if provided
-	if *initFile != "" {
-		if err := processInitFile(*initFile, database, cfg); err != nil {
-			fatal("failed to process init file", "error", err)
-		}
+		return nil, nil, err
 	}
-
-	// Create server
-	server, err := handlers.NewServer(cfg, store, database, Version)
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	master, err := provider.MasterKey(ctx)
 	if err != nil {
-		fatal("failed to create server", "error", err)
-	}
-
-	// Wire Quarto support only when the operator opts into a Quarto feature:
-	// COMPUTATIONAL_PAGES_ENABLED (gated .qmd execution) and/or EXPORT_ENABLED
-	// (Quarto page export). This avoids spawning quarto detection at startup, and
-	// exposing export endpoints, on hosts that merely happen to have quarto on
-	// PATH. Feature-detected and non-fatal; Markdown ZIP export works regardless.
-	if cfg.QuartoEnabled || cfg.ExportEnabled {
-		setupRenderService(server, cfg)
-	}
-
-	// Build search index on startup
-	if err := server.Wiki.EnsureSearchIndex(context.Background()); err != nil {
-		slog.Warn("failed to build search index", "error", err)
+		return nil, nil, err
 	}
 
-	// Load templates: use filesystem override if provided, otherwise embedded
-	var templatesFS fs.FS
-	if *templatesPath != "" {
-		slog.Info("loading templates from filesystem", "path", *templatesPath)
-		templatesFS = os.DirFS(*templatesPath)
-	} else {
-		slog.Info("loading templates from embedded FS")
-		templatesFS, err = fs.Sub(web.TemplatesFS, "templates")
+	var attachments *encryption.Cipher
+	if cfg.EncryptAttachments {
+		key, err := encryption.DeriveKey(master, encryption.PurposeAttachments)
 		if err != nil {
-			fatal("failed to access embedded templates", "error", err)
+			return nil, nil, err
 		}
-	}
-	if err := server.LoadTemplates(templatesFS); err != nil {
-		fatal("failed to load templates", "error", err)
-	}
-
-	// Set static FS: use filesystem override if provided, otherwise embedded
-	if *staticPath != "" {
-		slog.Info("serving static files from filesystem", "path", *staticPath)
-		server.StaticFS = os.DirFS(*staticPath)
-	} else {
-		slog.Info("serving static files from embedded FS")
-		server.StaticFS, err = fs.Sub(web.StaticFS, "static")
-		if err != nil {
-			fatal("failed to access embedded static files", "error", err)
+		if attachments, err = encryption.NewCipher(key); err != nil {
+			return nil, nil, err
 		}
 	}
-
-	// Create router
-	router := server.Routes()
-
-	// Check if repository is empty and create initial page
-	files, _, err := store.List("", nil, nil)
-	if err != nil {
-		slog.Warn("failed to list repository files", "error", err)
-	}
-	// Filter out hidden files like .wiki.db
-	var mdFiles []string
-	for _, f := range files {
-		if !strings.HasPrefix(f, ".") && strings.HasSuffix(f, ".md") {
-			mdFiles = append(mdFiles, f)
+	var dbKey []byte
+	if cfg.EncryptDatabase {
+		if dbKey, err = encryption.DeriveKey(master, encryption.PurposeDatabase); err != nil {
+			return nil, nil, err
 		}
 	}
-	if len(mdFiles) == 0 {
-		slog.Info("creating initial pages")
-		homeContent := `# Welcome to GopherWiki
-
-This is your new wiki. Start editing this page or create new pages.
+	return attachments, dbKey, nil
+}
 
-## Getting Started
+// sqlitePath extracts a filesystem path from a sqlite database URI. It mirrors
+// the parsing in db.Open so the render cache can be placed beside the primary
+// database.
+func sqlitePath(uri string) string {
+	path := uri
+	if strings.HasPrefix(uri, "sqlite:///") {
+		path = strings.TrimPrefix(uri, "sqlite:///")
+	} else if strings.HasPrefix(uri, "sqlite://") {
+		path = strings.TrimPrefix(uri, "sqlite://")
+	}
+	return path
+}
 
-- Click the edit button (pencil icon) to edit this page
-- Use [[WikiLinks]] to link to other pages
-- Markdown formatting is fully supported
-- See the [[SyntaxGuide]] for all supported features
+// orDiscover renders an interpreter path for logging, showing "(discover)" when
+// none is pinned so the log makes the fallback behaviour explicit.
+func orDiscover(path string) string {
+	if path == "" {
+		return "(discover)"
+	}
+	return path
+}
 
-## Features
+//go:embed syntax_guide.md
+var syntaxGuideContent string
 
-- **Markdown**: Full markdown support with extensions
-- **Git Backend**: All changes are versioned with git
-- **WikiLinks**: [[Link to pages]] with double brackets
-- **Attachments**: Upload and embed images and files
-- **History**: View and compare page revisions
+// command is a gopherwiki subcommand.
+type command struct {
+	name    string
+	summary string
+	run     func(args []string) error
+}
 
-Enjoy your wiki!
-`
-		author := storage.Author{
-			Name:  "GopherWiki",
-			Email: "noreply@gopherwiki",
-		}
-		homeFilename := "home.md"
-		if cfg.RetainPageNameCase {
-			homeFilename = "Home.md"
-		}
-		if _, err := store.Store(homeFilename, homeContent, "Initial commit", author); err != nil {
-			slog.Warn("failed to create initial home page", "error", err)
-		}
+var commands = []command{
+	{"serve", "Run the wiki server (the default)", runServe},
+	{"init", "Create the repository and database, optionally from an init file", runInit},
+	{"export", "Write the page sources and attachments to a ZIP archive", runExport},
+	{"import", "Import a ZIP archive of Markdown pages or a MediaWiki dump", runImport},
+	{"reindex", "Rebuild the search index", runReindex},
+	{"copy-db", "Copy the database into another, e.g. from SQLite to PostgreSQL", runCopyDB},
+	{"user", "Add, list, and change users", runUser},
+	{"backup", "Write a backup archive of the repository and database", runBackup},
+	{"restore", "Restore a backup archive into an empty repository", runRestore},
+	{"doctor", "Check the configuration, repository, and database", runDoctor},
+	{"config", "Print the effective configuration, with secrets masked", runConfig},
+}
 
-		guideFilename := "syntaxguide.md"
-		if cfg.RetainPageNameCase {
-			guideFilename = "SyntaxGuide.md"
-		}
-		if _, err := store.Store(guideFilename, syntaxGuideContent, "Add syntax guide", author); err != nil {
-			slog.Warn("failed to create syntax guide page", "error", err)
-		}
+func usage(w io.Writer) {
+	fmt.Fprintln(w, "Usage: gopherwiki <command> [flags]")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Commands:")
+	for _, c := range commands {
+		fmt.Fprintf(w, "  %-9s %s\n", c.name, c.summary)
 	}
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, `Without a command, or with flags only, gopherwiki serves the wiki. Run "gopherwiki <command> -h" for the flags of a command.`)
+}
 
-	// Start server with graceful shutdown
-	addr := fmt.Sprintf("%s:%d", cfg.Host, cfg.Port)
-	srv := &http.Server{
-		Addr:    addr,
-		Handler: router,
-		// ReadHeaderTimeout bounds slow-header (Slowloris) attacks. ReadTimeout
-		// is generous to allow large attachment uploads on slow links.
-		// WriteTimeout is intentionally left unset so large attachment downloads
-		// on slow connections are not truncated.
-		ReadHeaderTimeout: 10 * time.Second,
-		ReadTimeout:       5 * time.Minute,
-		IdleTimeout:       120 * time.Second,
+func main() {
+	name, args := "serve", os.Args[1:]
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		name, args = args[0], args[1:]
 	}
-
-	go func() {
-		displayHost := cfg.Host
-		if displayHost == "" {
-			displayHost = "localhost"
+	if name == "help" {
+		usage(os.Stdout)
+		return
+	}
+	for _, c := range commands {
+		if c.name != name {
+			continue
 		}
-		slog.Info("server listening", "address", fmt.Sprintf("http://%s:%d", displayHost, cfg.Port))
-		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			fatal("server error", "error", err)
+		if err := c.run(args); err != nil {
+			fmt.Fprintf(os.Stderr, "%s failed: %v\n", name, err)
+			os.Exit(1)
 		}
-	}()
-
-	quit := make(chan os.Signal, 1)
-	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
-	sig := <-quit
-	slog.Info("received signal, shutting down", "signal", sig)
-
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-	defer cancel()
-	if err := srv.Shutdown(ctx); err != nil {
-		slog.Error("server forced to shutdown", "error", err)
+		return
 	}
-	slog.Info("server stopped")
+	fmt.Fprintf(os.Stderr, "unknown command %q\n\n", name)
+	usage(os.Stderr)
+	os.Exit(2)
 }
 
 // processInitFile reads and applies initialization settings from a JSON file.
-func processInitFile(filePath string, database *db.Database, cfg *config.Config) error {
+// The admin is created in users, which holds the accounts.
+func processInitFile(filePath string, database, users *db.Database, cfg *config.Config) error {
 	data, err := os.ReadFile(filePath)
 	if err != nil {
 		return fmt.Errorf("failed to read init file: %w", err)
@@ -517,7 +390,7 @@ func processInitFile(filePath string, database *db.Database, cfg *config.Config)
 		}
 
 		// Check if user already exists
-		_, err := database.Queries.GetUserByEmail(ctx, initCfg.Admin.Email)
+		_, err := users.Queries.GetUserByEmail(ctx, initCfg.Admin.Email)
 		if err == sql.ErrNoRows {
 			// Create admin user
 			slog.Info("creating admin user", "name", initCfg.Admin.Name, "email", initCfg.Admin.Email)
@@ -542,7 +415,7 @@ func processInitFile(filePath string, database *db.Database, cfg *config.Config)
 				AllowUpload:    db.NullBool(true),
 			}
 
-			if _, err := database.Queries.CreateUser(ctx, params); err != nil {
+			if _, err := users.Queries.CreateUser(ctx, params); err != nil {
 				return fmt.Errorf("failed to create admin user: %w", err)
 			}
 			slog.Info("admin user created successfully")
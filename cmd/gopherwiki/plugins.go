@@ -0,0 +1,9 @@
+package main
+
+import "github.com/sa/gopherwiki/internal/plugin"
+
+// plugins extend every server the command starts. A fork adds its own from
+// an init function in a file of this package:
+//
+//	func init() { plugins = append(plugins, myPlugin{}) }
+var plugins []plugin.Plugin
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"time"
+)
+
+// runReindex implements "gopherwiki reindex": it rebuilds the search index
+// and backlinks from the repository, whatever state the index is in.
+func runReindex(args []string) error {
+	fs := flag.NewFlagSet("reindex", flag.ExitOnError)
+	flags := addWikiFlags(fs)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: gopherwiki reindex [flags]")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	cfg, err := flags.load()
+	if err != nil {
+		return err
+	}
+	env, err := openWiki(cfg, *flags.dbPath, false)
+	if err != nil {
+		return err
+	}
+	defer env.Close()
+	server, err := env.server()
+	if err != nil {
+		return err
+	}
+
+	start := time.Now()
+	n, err := server.Wiki.RebuildSearchIndex(context.Background())
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Indexed %d pages in %s\n", n, time.Since(start).Round(time.Millisecond))
+	return nil
+}
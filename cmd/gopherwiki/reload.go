@@ -0,0 +1,114 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"sync/atomic"
+
+	"github.com/sa/gopherwiki/internal/config"
+	"github.com/sa/gopherwiki/internal/gemini"
+	"github.com/sa/gopherwiki/internal/handlers"
+)
+
+// swappableHandler serves requests through whichever router was stored
+// last, so a configuration reload can replace the whole server without
+// touching the listener. Requests already in flight finish on the router
+// they started with.
+type swappableHandler struct {
+	current atomic.Value // http.Handler
+}
+
+func newSwappableHandler(h http.Handler) *swappableHandler {
+	s := &swappableHandler{}
+	s.current.Store(h)
+	return s
+}
+
+func (s *swappableHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.current.Load().(http.Handler).ServeHTTP(w, r)
+}
+
+// Swap replaces the handler serving new requests.
+func (s *swappableHandler) Swap(h http.Handler) {
+	s.current.Store(h)
+}
+
+// swappableGemini is swappableHandler for the Gemini listener.
+type swappableGemini struct {
+	current atomic.Value // gemini.Handler
+}
+
+func newSwappableGemini(h gemini.Handler) *swappableGemini {
+	s := &swappableGemini{}
+	s.current.Store(h)
+	return s
+}
+
+func (s *swappableGemini) ServeGemini(w gemini.ResponseWriter, r *gemini.Request) {
+	s.current.Load().(gemini.Handler).ServeGemini(w, r)
+}
+
+// Swap replaces the handler serving new requests.
+func (s *swappableGemini) Swap(h gemini.Handler) {
+	s.current.Store(h)
+}
+
+// loadConfig reads the configuration: defaults, then the config file when
+// one is given, then environment variables.
+func loadConfig(cfgFile string) (*config.Config, error) {
+	if cfgFile != "" {
+		return config.LoadWithFile(cfgFile)
+	}
+	return config.Load(), nil
+}
+
+// reloadServer re-reads the configuration with load and builds a server from
+// it that shares the running server's storage, databases, render service,
+// plugins, and static files. The running server is left untouched, so on error it keeps serving
+// with its old settings. Changed settings that need a restart are logged and
+// ignored; startup is the configuration as first loaded, see
+// config.PrepareReload.
+func reloadServer(current *handlers.Server, startup *config.Config, load func() (*config.Config, error), templatesFS fs.FS) (*handlers.Server, error) {
+	cfg, err := load()
+	if err != nil {
+		return nil, fmt.Errorf("load config: %w", err)
+	}
+	applied, needRestart := config.PrepareReload(startup, current.Config, cfg)
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid config: %w", err)
+	}
+
+	server, err := handlers.NewServerWithUsers(cfg, current.Storage, current.DB, current.Users, current.Version)
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range current.Plugins.Plugins() {
+		if err := server.Plugins.Register(p); err != nil {
+			return nil, err
+		}
+	}
+	server.RenderService = current.RenderService
+	server.Converter = current.Converter
+	server.Maintainer = current.Maintainer
+	server.LinkChecker = current.LinkChecker
+	server.StaticFS = current.StaticFS
+	if err := server.LoadTemplates(templatesFS); err != nil {
+		return nil, fmt.Errorf("load templates: %w", err)
+	}
+	if err := loadThemes(server, cfg); err != nil {
+		return nil, fmt.Errorf("load themes: %w", err)
+	}
+	if current.Cluster != nil {
+		current.LeaveCluster()
+		server.JoinCluster(current.Cluster)
+	}
+
+	initLogger(cfg)
+	if len(needRestart) > 0 {
+		slog.Warn("changed settings require a restart to take effect", "settings", needRestart)
+	}
+	slog.Info("configuration reloaded", "applied", applied)
+	return server, nil
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/sa/gopherwiki/internal/backup"
+	"github.com/sa/gopherwiki/internal/config"
+	"github.com/sa/gopherwiki/internal/db"
+)
+
+// runRestore implements "gopherwiki restore [flags] <archive>". The target
+// repository and database default to the configured ones; both must be
+// missing or empty so that a restore never overwrites a running wiki.
+func runRestore(args []string) error {
+	fs := flag.NewFlagSet("restore", flag.ExitOnError)
+	configFile := fs.String("config", "", "Path to YAML or TOML configuration file")
+	repoPath := fs.String("repo", "", "Directory to restore the wiki git repository into")
+	dbPath := fs.String("db", "", "Path to restore the SQLite database to")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: gopherwiki restore [flags] <archive>")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return fmt.Errorf("expected exactly one archive path")
+	}
+
+	cfgFile := *configFile
+	if cfgFile == "" {
+		cfgFile = os.Getenv("CONFIG_FILE")
+	}
+	var cfg *config.Config
+	if cfgFile != "" {
+		var err error
+		if cfg, err = config.LoadWithFile(cfgFile); err != nil {
+			return fmt.Errorf("failed to load config file: %w", err)
+		}
+	} else {
+		cfg = config.Load()
+	}
+
+	repo := cfg.Repository
+	if *repoPath != "" {
+		repo = *repoPath
+	}
+	if db.IsPostgresURI(cfg.DatabaseURI) && *dbPath == "" {
+		return fmt.Errorf("restore writes a SQLite database; restore a PostgreSQL database with pg_restore")
+	}
+	if cfg.StorageBackend == "memory" && *repoPath == "" {
+		return fmt.Errorf("restore writes a git repository, which STORAGE_BACKEND=memory does not read; set -repo")
+	}
+	database := sqlitePath(cfg.DatabaseURI)
+	if *dbPath != "" {
+		database = *dbPath
+	}
+	if repo == "" {
+		return fmt.Errorf("no repository path: set -repo or REPOSITORY")
+	}
+	if database == "" || database == ":memory:" {
+		return fmt.Errorf("no database path: set -db or DATABASE_URI")
+	}
+
+	f, err := os.Open(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	manifest, err := backup.Restore(f, repo, database)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Restored backup from %s (version %s)\n", manifest.CreatedAt.Format("2006-01-02 15:04:05 MST"), manifest.Version)
+	fmt.Printf("  repository: %s\n  database:   %s\n", repo, database)
+	return nil
+}
@@ -0,0 +1,344 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/sa/gopherwiki/internal/config"
+	"github.com/sa/gopherwiki/internal/gemini"
+	"github.com/sa/gopherwiki/internal/handlers"
+	"github.com/sa/gopherwiki/web"
+)
+
+// runServe implements "gopherwiki serve", the default command: it runs the
+// wiki until interrupted.
+func runServe(args []string) error {
+	flagSet := flag.NewFlagSet("serve", flag.ExitOnError)
+	flags := addWikiFlags(flagSet)
+	host := flagSet.String("host", "", "Host/IP to bind to (default: all interfaces)")
+	port := flagSet.Int("port", 0, "HTTP server port (default: 8080)")
+	templatesPath := flagSet.String("templates", "", "Path to templates directory (overrides embedded)")
+	staticPath := flagSet.String("static", "", "Path to static files directory (overrides embedded)")
+	initFile := flagSet.String("init", "", "Path to initialization JSON file (run once to set up site)")
+	flagSet.Usage = func() {
+		fmt.Fprintln(flagSet.Output(), "Usage: gopherwiki [serve] [flags]")
+		flagSet.PrintDefaults()
+	}
+	flagSet.Parse(args)
+
+	// Load configuration: defaults -> config file -> env vars -> CLI flags
+	cfg, err := flags.read()
+	if err != nil {
+		fatal("failed to load config file", "error", err)
+	}
+	// Kept for SIGHUP reloads, which must tell settings changed in the file
+	// or environment from the adjustments below.
+	startupCfg := *cfg
+
+	// Initialize structured logger
+	initLogger(cfg)
+
+	// Override config from command line flags (highest precedence)
+	if *host != "" {
+		cfg.Host = *host
+	}
+	if *port != 0 {
+		cfg.Port = *port
+	}
+	if *flags.repoPath != "" {
+		cfg.Repository = *flags.repoPath
+	}
+
+	// In dev mode, relax the SECRET_KEY requirement and prevent accidental
+	// network exposure.
+	if cfg.DevMode {
+		slog.Warn("DEV_MODE is enabled, do NOT use in production")
+		if cfg.SecretKey == "CHANGE ME" || len(cfg.SecretKey) < 16 {
+			// Generate an ephemeral per-process key rather than a shared,
+			// world-known constant: a leaked DEV_MODE in production must not
+			// let anyone forge a signed session cookie. Sessions reset on restart.
+			keyBytes := make([]byte, 32)
+			if _, err := rand.Read(keyBytes); err != nil {
+				fatal("failed to generate development secret key", "error", err)
+			}
+			cfg.SecretKey = hex.EncodeToString(keyBytes)
+			slog.Warn("using ephemeral random development secret key (sessions reset on restart)")
+		}
+		// Refuse to serve dev mode on a non-loopback interface.
+		if !isLoopbackHost(cfg.Host) {
+			slog.Warn("DEV_MODE forces binding to loopback", "requested_host", cfg.Host)
+			cfg.Host = "127.0.0.1"
+		}
+	}
+
+	slog.Info("starting GopherWiki", "version", Version)
+
+	// Set static FS: use filesystem override if provided, otherwise embedded.
+	var staticFS fs.FS
+	if *staticPath != "" {
+		slog.Info("serving static files from filesystem", "path", *staticPath)
+		staticFS = os.DirFS(*staticPath)
+	} else {
+		slog.Info("serving static files from embedded FS")
+		staticFS, err = fs.Sub(web.StaticFS, "static")
+		if err != nil {
+			fatal("failed to access embedded static files", "error", err)
+		}
+	}
+
+	// Load templates: use filesystem override if provided, otherwise embedded
+	var templatesFS fs.FS
+	if *templatesPath != "" {
+		slog.Info("loading templates from filesystem", "path", *templatesPath)
+		templatesFS = os.DirFS(*templatesPath)
+	} else {
+		slog.Info("loading templates from embedded FS")
+		templatesFS, err = fs.Sub(web.TemplatesFS, "templates")
+		if err != nil {
+			fatal("failed to access embedded templates", "error", err)
+		}
+	}
+
+	// With several wikis, each is served on its host names and reloads are
+	// not supported; otherwise a SIGHUP reload swaps in a router built from
+	// the new configuration behind the same listener.
+	var handler http.Handler
+	var server *handlers.Server
+	var router *swappableHandler
+	// The background jobs of a reloaded wiki run on its new server.
+	var live atomic.Pointer[handlers.Server]
+	background, stopBackground := context.WithCancel(context.Background())
+	var jobs sync.WaitGroup
+	if len(cfg.Wikis) > 0 {
+		if *flags.dbPath != "" || *initFile != "" {
+			fatal("-db and -init apply to one wiki; choose it with -wiki")
+		}
+		hosts := handlers.NewHostRouter()
+		for _, w := range cfg.Wikis {
+			env, server, err := startWiki(cfg.WikiConfig(w), "", "", staticFS, templatesFS)
+			if err != nil {
+				fatal("failed to start wiki", "wiki", w.Name, "error", err)
+			}
+			defer env.Close()
+			var wikiServer atomic.Pointer[handlers.Server]
+			wikiServer.Store(server)
+			jobs.Add(1)
+			go func() {
+				defer jobs.Done()
+				env.runJobs(background, &wikiServer)
+			}()
+			for _, h := range w.Hosts {
+				hosts.Handle(h, server.Routes())
+			}
+			slog.Info("hosting wiki", "wiki", w.Name, "hosts", w.Hosts)
+		}
+		handler = hosts
+		if cfg.GeminiPort > 0 {
+			slog.Warn("GEMINI_PORT is ignored when hosting several wikis")
+			cfg.GeminiPort = 0
+		}
+	} else {
+		var env *wikiEnv
+		env, server, err = startWiki(cfg, *flags.dbPath, *initFile, staticFS, templatesFS)
+		if err != nil {
+			fatal("failed to start wiki", "error", err)
+		}
+		defer env.Close()
+		live.Store(server)
+		jobs.Add(1)
+		go func() {
+			defer jobs.Done()
+			env.runJobs(background, &live)
+		}()
+		router = newSwappableHandler(server.Routes())
+		handler = router
+	}
+
+	// Start server with graceful shutdown
+	addr := fmt.Sprintf("%s:%d", cfg.Host, cfg.Port)
+	srv := &http.Server{
+		Addr:    addr,
+		Handler: handler,
+		// ReadHeaderTimeout bounds slow-header (Slowloris) attacks. ReadTimeout
+		// is generous to allow large attachment uploads on slow links.
+		// WriteTimeout is intentionally left unset so large attachment downloads
+		// on slow connections are not truncated.
+		ReadHeaderTimeout: 10 * time.Second,
+		ReadTimeout:       5 * time.Minute,
+		IdleTimeout:       120 * time.Second,
+	}
+
+	go func() {
+		displayHost := cfg.Host
+		if displayHost == "" {
+			displayHost = "localhost"
+		}
+		slog.Info("server listening", "address", fmt.Sprintf("http://%s:%d", displayHost, cfg.Port))
+		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			fatal("server error", "error", err)
+		}
+	}()
+
+	// The Gemini listener follows configuration reloads like the router.
+	var geminiHandler *swappableGemini
+	var geminiSrv *gemini.Server
+	if cfg.GeminiPort > 0 {
+		geminiHandler = newSwappableGemini(server)
+		geminiSrv = startGemini(cfg, geminiHandler)
+	}
+
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+
+	var sig os.Signal
+	for sig == nil {
+		select {
+		case sig = <-quit:
+		case <-hup:
+			if router == nil {
+				slog.Warn("received SIGHUP, but reloads are not supported when hosting several wikis; restart to apply changes")
+				continue
+			}
+			slog.Info("received SIGHUP, reloading configuration")
+			next, err := reloadServer(server, &startupCfg, flags.read, templatesFS)
+			if err != nil {
+				slog.Error("configuration reload failed, keeping current settings", "error", err)
+				continue
+			}
+			server = next
+			live.Store(server)
+			router.Swap(server.Routes())
+			if geminiHandler != nil {
+				geminiHandler.Swap(server)
+			}
+		}
+	}
+	slog.Info("received signal, shutting down", "signal", sig)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		slog.Error("server forced to shutdown", "error", err)
+	}
+	if geminiSrv != nil {
+		if err := geminiSrv.Shutdown(ctx); err != nil {
+			slog.Error("gemini server forced to shutdown", "error", err)
+		}
+	}
+	stopBackground()
+	jobs.Wait()
+	slog.Info("server stopped")
+	return nil
+}
+
+// startWiki opens a wiki, creating it if needed, and prepares its server:
+// the init file, optional render and export tools, the search index, static
+// files, and templates.
+func startWiki(cfg *config.Config, dbPath, initFile string, staticFS, templatesFS fs.FS) (*wikiEnv, *handlers.Server, error) {
+	env, err := openWiki(cfg, dbPath, true)
+	if err != nil {
+		return nil, nil, err
+	}
+	server, err := prepareServer(env, initFile, staticFS, templatesFS)
+	if err != nil {
+		env.Close()
+		return nil, nil, err
+	}
+	return env, server, nil
+}
+
+func prepareServer(env *wikiEnv, initFile string, staticFS, templatesFS fs.FS) (*handlers.Server, error) {
+	cfg := env.cfg
+
+	// Process init file if provided
+	if initFile != "" {
+		if err := processInitFile(initFile, env.db, env.users, cfg); err != nil {
+			return nil, fmt.Errorf("failed to process init file: %w", err)
+		}
+	}
+
+	// Create server
+	server, err := env.server()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create server: %w", err)
+	}
+
+	// Wire Quarto support only when the operator opts into a Quarto feature:
+	// COMPUTATIONAL_PAGES_ENABLED (gated .qmd execution) and/or EXPORT_ENABLED
+	// (Quarto page export). This avoids spawning quarto detection at startup, and
+	// exposing export endpoints, on hosts that merely happen to have quarto on
+	// PATH. Feature-detected and non-fatal; Markdown ZIP export works regardless.
+	if cfg.QuartoEnabled || cfg.ExportEnabled {
+		setupRenderService(server, cfg)
+	}
+
+	// Pandoc document export runs an external converter, so it is opt-in too.
+	if cfg.PandocEnabled {
+		setupConverter(server, cfg)
+	}
+
+	// Vault notes are named in mixed case, which page paths lose otherwise.
+	if cfg.ObsidianCompat && !cfg.RetainPageNameCase {
+		slog.Warn("OBSIDIAN_COMPAT is enabled without RETAIN_PAGE_NAME_CASE; pages with uppercase names will not be found")
+	}
+
+	// Build search index on startup. Processes of a cluster starting
+	// together take turns, so only the first rebuilds it.
+	if err := ensureSearchIndex(env, server); err != nil {
+		slog.Warn("failed to build search index", "error", err)
+	}
+
+	// The static FS must be set before LoadTemplates, which hashes the files
+	// for versioned URLs.
+	server.StaticFS = staticFS
+	if err := server.LoadTemplates(templatesFS); err != nil {
+		return nil, fmt.Errorf("failed to load templates: %w", err)
+	}
+	if err := loadThemes(server, cfg); err != nil {
+		return nil, fmt.Errorf("failed to load themes: %w", err)
+	}
+
+	// Check if repository is empty and create initial page
+	createInitialPages(context.Background(), env.store, cfg)
+	return server, nil
+}
+
+// loadThemes loads the embedded theme packs and those in THEMES_DIR, which
+// replace embedded ones of the same name.
+func loadThemes(server *handlers.Server, cfg *config.Config) error {
+	embedded, err := fs.Sub(web.ThemesFS, "themes")
+	if err != nil {
+		return err
+	}
+	sources := []fs.FS{embedded}
+	if cfg.ThemesDir != "" {
+		sources = append(sources, os.DirFS(cfg.ThemesDir))
+	}
+	return server.LoadThemes(sources...)
+}
+
+func ensureSearchIndex(env *wikiEnv, server *handlers.Server) error {
+	ctx := context.Background()
+	if env.node != nil {
+		release, err := env.node.Lock(ctx, "search-index")
+		if err != nil {
+			return err
+		}
+		defer release()
+	}
+	return server.Wiki.EnsureSearchIndex(ctx)
+}
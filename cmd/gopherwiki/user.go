@@ -0,0 +1,180 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/sa/gopherwiki/internal/auth"
+)
+
+const userUsage = `Usage: gopherwiki user <subcommand> [flags]
+
+Subcommands:
+  add [-admin] [-name NAME] <email>   Create an approved user
+  list                                List the users
+  passwd <email>                      Set a user's password
+  delete <email>                      Delete a user
+
+add and passwd read the password from the first line of standard input,
+prompting for it on a terminal.`
+
+// runUser implements "gopherwiki user", which manages accounts without the
+// web interface, for example to create the first admin.
+func runUser(args []string) error {
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		fmt.Fprintln(os.Stderr, userUsage)
+		return fmt.Errorf("expected a subcommand")
+	}
+	sub, args := args[0], args[1:]
+
+	fs := flag.NewFlagSet("user "+sub, flag.ExitOnError)
+	flags := addWikiFlags(fs)
+	var admin, noPassword *bool
+	var name *string
+	if sub == "add" {
+		admin = fs.Bool("admin", false, "Make the user an admin")
+		name = fs.String("name", "", "Display name (default: the part of the email before @)")
+		noPassword = fs.Bool("no-password", false, "Create the user without a password")
+	}
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), userUsage)
+		fmt.Fprintln(fs.Output())
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	wantArgs := 1
+	switch sub {
+	case "list":
+		wantArgs = 0
+	case "add", "passwd", "delete":
+	default:
+		fs.Usage()
+		return fmt.Errorf("unknown subcommand %q", sub)
+	}
+	if fs.NArg() != wantArgs {
+		fs.Usage()
+		return fmt.Errorf("user %s: wrong number of arguments", sub)
+	}
+
+	cfg, err := flags.load()
+	if err != nil {
+		return err
+	}
+	env, err := openWiki(cfg, *flags.dbPath, false)
+	if err != nil {
+		return err
+	}
+	defer env.Close()
+	server, err := env.server()
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+	a := server.Auth
+
+	switch sub {
+	case "list":
+		users, err := a.ListUsers(ctx)
+		if err != nil {
+			return err
+		}
+		tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "EMAIL\tNAME\tROLE")
+		for _, u := range users {
+			role := "user"
+			switch {
+			case u.Admin():
+				role = "admin"
+			case !u.Approved():
+				role = "unapproved"
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\n", u.Email, u.Name, role)
+		}
+		return tw.Flush()
+
+	case "add":
+		email := fs.Arg(0)
+		displayName := *name
+		if displayName == "" {
+			displayName, _, _ = strings.Cut(email, "@")
+		}
+		password := ""
+		if !*noPassword {
+			if password, err = readPassword(); err != nil {
+				return err
+			}
+		}
+		user, err := a.CreateUser(ctx, auth.NewUser{
+			Name:        displayName,
+			Email:       email,
+			Password:    password,
+			IsApproved:  true,
+			IsAdmin:     *admin,
+			AllowRead:   true,
+			AllowWrite:  true,
+			AllowUpload: true,
+		})
+		if err != nil {
+			return err
+		}
+		role := "user"
+		if *admin {
+			role = "admin"
+		}
+		fmt.Printf("Created %s %s\n", role, user.Email)
+
+	case "passwd":
+		user, err := a.GetUserByEmail(ctx, fs.Arg(0))
+		if err != nil {
+			return err
+		}
+		password, err := readPassword()
+		if err != nil {
+			return err
+		}
+		if err := auth.ValidatePassword(password); err != nil {
+			return err
+		}
+		if err := a.UpdatePassword(ctx, user.ID, password); err != nil {
+			return err
+		}
+		fmt.Printf("Changed the password of %s\n", user.Email)
+
+	case "delete":
+		user, err := a.GetUserByEmail(ctx, fs.Arg(0))
+		if err != nil {
+			return err
+		}
+		if err := a.DeleteUser(ctx, user.ID); err != nil {
+			return err
+		}
+		fmt.Printf("Deleted %s\n", user.Email)
+	}
+	return nil
+}
+
+// readPassword reads a password from the first line of standard input,
+// prompting for it when standard input is a terminal. The terminal echoes
+// what is typed, so piping the password in is preferable on shared screens.
+func readPassword() (string, error) {
+	if info, err := os.Stdin.Stat(); err == nil && info.Mode()&os.ModeCharDevice != 0 {
+		fmt.Fprint(os.Stderr, "Password: ")
+	}
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return "", err
+	}
+	password := strings.TrimRight(line, "\r\n")
+	if password == "" {
+		return "", fmt.Errorf("no password given")
+	}
+	return password, nil
+}
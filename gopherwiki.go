@@ -0,0 +1,334 @@
+// Package gopherwiki embeds a wiki in another Go program. New returns a
+// Wiki, an http.Handler serving the whole wiki, which the program mounts in
+// its own server:
+//
+//	cfg := gopherwiki.DefaultConfig()
+//	cfg.SecretKey = os.Getenv("WIKI_SECRET")
+//	w, err := gopherwiki.New(gopherwiki.Options{
+//		Config:  cfg,
+//		Storage: gopherwiki.NewMemoryStorage(),
+//		Authenticate: func(r *http.Request) (gopherwiki.Identity, bool) {
+//			u := currentUser(r)
+//			return gopherwiki.Identity{Name: u.Name, Email: u.Email}, u != nil
+//		},
+//	})
+//	if err != nil {
+//		log.Fatal(err)
+//	}
+//	defer w.Close()
+//	mux.Handle("/", w)
+//
+// The wiki serves its pages from the root of the URL space, so mount it at
+// "/" or on a host of its own. The types of this package are those the
+// gopherwiki command uses; the rest of its code is internal.
+package gopherwiki
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"github.com/sa/gopherwiki/internal/auth"
+	"github.com/sa/gopherwiki/internal/checks"
+	"github.com/sa/gopherwiki/internal/config"
+	"github.com/sa/gopherwiki/internal/db"
+	"github.com/sa/gopherwiki/internal/handlers"
+	"github.com/sa/gopherwiki/internal/plugin"
+	"github.com/sa/gopherwiki/internal/spam"
+	"github.com/sa/gopherwiki/internal/storage"
+	"github.com/sa/gopherwiki/internal/wiki"
+	"github.com/sa/gopherwiki/web"
+)
+
+// Config holds the settings of a wiki; see the README for each of them.
+type Config = config.Config
+
+// Storage keeps the pages and attachments of a wiki and their history.
+// Implement it to keep them somewhere other than a git repository or memory.
+type Storage = storage.Storage
+
+// Types of the Storage interface.
+type (
+	Author         = storage.Author
+	CommitMetadata = storage.CommitMetadata
+	LogQuery       = storage.LogQuery
+	BlameLine      = storage.BlameLine
+	GitStorage     = storage.GitStorage
+	MemoryStorage  = storage.MemoryStorage
+)
+
+// Errors a Storage returns, which the wiki tells apart.
+var (
+	ErrNotFound      = storage.ErrNotFound
+	ErrPathTraversal = storage.ErrPathTraversal
+)
+
+// Service is the wiki's page service: it reads, saves, renames, and
+// searches pages, keeping the search index and links up to date.
+type Service = wiki.WikiService
+
+// Types the Service returns.
+type (
+	Page           = wiki.Page
+	SavePageResult = wiki.SavePageResult
+	SearchResult   = wiki.SearchResult
+)
+
+// Identity is a user the embedding program authenticated.
+type Identity = auth.Identity
+
+// Plugin is an extension of the wiki, implementing any of the hook
+// interfaces: BeforeSaver, AfterSaver, RenderFilter, RouteProvider,
+// TemplateFuncProvider, AuthProvider, SpamChecker, and PageChecker.
+type Plugin = plugin.Plugin
+
+// Hook interfaces of a Plugin.
+type (
+	BeforeSaver          = plugin.BeforeSaver
+	AfterSaver           = plugin.AfterSaver
+	RenderFilter         = plugin.RenderFilter
+	RouteProvider        = plugin.RouteProvider
+	TemplateFuncProvider = plugin.TemplateFuncProvider
+	AuthProvider         = plugin.AuthProvider
+	SpamChecker          = plugin.SpamChecker
+	PageChecker          = plugin.PageChecker
+)
+
+// Types a SpamChecker sees and returns.
+type (
+	SpamSubmission = spam.Submission
+	SpamVerdict    = spam.Verdict
+)
+
+// Types a PageChecker sees and returns.
+type (
+	CheckedPage  = checks.Page
+	CheckFinding = checks.Finding
+)
+
+// SaveEvent describes a page save to the save hooks.
+type SaveEvent = wiki.SaveEvent
+
+// ErrSaveRejected wraps the error of a BeforeSaver that refused a save.
+var ErrSaveRejected = wiki.ErrSaveRejected
+
+// Authenticator names the user of a request, reporting false for a request
+// it does not authenticate. Such requests fall back to the wiki's own
+// login. On first sight of an email the wiki creates its account, approved
+// and allowed to read, write, and upload; its name and admin flag follow
+// the identity afterwards.
+type Authenticator func(r *http.Request) (Identity, bool)
+
+// Name makes the Authenticator a Plugin.
+func (Authenticator) Name() string { return "authenticate" }
+
+// Authenticate calls a.
+func (a Authenticator) Authenticate(r *http.Request) (Identity, bool) { return a(r) }
+
+// Options configure New.
+type Options struct {
+	// Config holds the wiki's settings. Nil means DefaultConfig, which
+	// needs a SecretKey set unless DevMode is.
+	Config *Config
+	// Storage keeps the pages. Nil opens the git repository at
+	// Config.Repository, creating it if needed, or a memory storage when
+	// Config.StorageBackend is "memory".
+	Storage Storage
+	// Authenticate, when set, authenticates requests before the wiki's
+	// session cookie and the plugins do.
+	Authenticate Authenticator
+	// Plugins extend the wiki, their hooks running in this order.
+	Plugins []Plugin
+	// Version is shown in the wiki's footer and API.
+	Version string
+}
+
+// Wiki is an embedded wiki. It serves HTTP, and gives the program its page
+// service and storage.
+type Wiki struct {
+	handler http.Handler
+	server  *handlers.Server
+	store   Storage
+	db      *db.Database
+	users   *db.Database
+}
+
+// DefaultConfig returns the settings of a wiki configured with nothing.
+func DefaultConfig() *Config {
+	return config.Default()
+}
+
+// NewMemoryStorage returns an empty storage that keeps everything in memory.
+func NewMemoryStorage() *MemoryStorage {
+	return storage.NewMemoryStorage()
+}
+
+// NewGitStorage opens the git repository at path, first initializing it
+// when init is set.
+func NewGitStorage(path string, init bool) (*GitStorage, error) {
+	return storage.NewGitStorage(path, init)
+}
+
+// New opens a wiki. Its database is DatabaseURI; unset, it is .wiki.db in
+// the git repository New opened, or in memory with a Storage supplied.
+// Hosting several wikis, clustering, and encryption at rest are features of
+// the gopherwiki command and are rejected here.
+func New(opts Options) (*Wiki, error) {
+	cfg := opts.Config
+	if cfg == nil {
+		cfg = DefaultConfig()
+	}
+	switch {
+	case len(cfg.Wikis) > 0:
+		return nil, fmt.Errorf("gopherwiki: Config.Wikis is not supported when embedding; call New for each wiki")
+	case cfg.ClusterEnabled:
+		return nil, fmt.Errorf("gopherwiki: clustering is not supported when embedding")
+	case cfg.EncryptAttachments || cfg.EncryptDatabase:
+		return nil, fmt.Errorf("gopherwiki: encryption at rest is not supported when embedding")
+	}
+	// A supplied storage needs no repository.
+	check := *cfg
+	if opts.Storage != nil {
+		check.StorageBackend = "memory"
+	}
+	if err := check.Validate(); err != nil {
+		return nil, fmt.Errorf("gopherwiki: %w", err)
+	}
+
+	store := opts.Storage
+	dbURI := cfg.DatabaseURI
+	if store == nil {
+		if cfg.StorageBackend == "memory" {
+			store = storage.NewMemoryStorage()
+		} else {
+			_, err := os.Stat(filepath.Join(cfg.Repository, ".git"))
+			repo, err := storage.NewGitStorage(cfg.Repository, os.IsNotExist(err))
+			if err != nil {
+				return nil, fmt.Errorf("gopherwiki: failed to open repository: %w", err)
+			}
+			if cfg.GitBinary != "" {
+				if err := repo.UseGitBinary(cfg.GitBinary); err != nil {
+					return nil, fmt.Errorf("gopherwiki: %w", err)
+				}
+			}
+			store = repo
+			if dbURI == "" || dbURI == "sqlite:///:memory:" {
+				dbURI = "sqlite:///" + filepath.Join(cfg.Repository, ".wiki.db")
+			}
+		}
+	}
+	if dbURI == "" {
+		dbURI = "sqlite:///:memory:"
+	}
+
+	w := &Wiki{store: store}
+	var err error
+	if w.db, err = openDatabase(dbURI); err != nil {
+		return nil, err
+	}
+	w.users = w.db
+	if cfg.UsersDatabaseURI != "" {
+		if w.users, err = openDatabase(cfg.UsersDatabaseURI); err != nil {
+			w.db.Close()
+			return nil, fmt.Errorf("gopherwiki: users database: %w", err)
+		}
+	}
+
+	if err := w.start(cfg, opts); err != nil {
+		w.Close()
+		return nil, err
+	}
+	return w, nil
+}
+
+// start prepares the server of a wiki whose storage and databases are open.
+func (w *Wiki) start(cfg *Config, opts Options) error {
+	server, err := handlers.NewServerWithUsers(cfg, w.store, w.db, w.users, opts.Version)
+	if err != nil {
+		return fmt.Errorf("gopherwiki: %w", err)
+	}
+	plugins := opts.Plugins
+	if opts.Authenticate != nil {
+		plugins = append([]Plugin{opts.Authenticate}, plugins...)
+	}
+	for _, p := range plugins {
+		if err := server.Plugins.Register(p); err != nil {
+			return fmt.Errorf("gopherwiki: %w", err)
+		}
+	}
+	// Plugin template functions are added as the templates load.
+	if server.StaticFS, err = fs.Sub(web.StaticFS, "static"); err != nil {
+		return fmt.Errorf("gopherwiki: %w", err)
+	}
+	templates, err := fs.Sub(web.TemplatesFS, "templates")
+	if err != nil {
+		return fmt.Errorf("gopherwiki: %w", err)
+	}
+	if err := server.LoadTemplates(templates); err != nil {
+		return fmt.Errorf("gopherwiki: failed to load templates: %w", err)
+	}
+	themes, err := fs.Sub(web.ThemesFS, "themes")
+	if err != nil {
+		return fmt.Errorf("gopherwiki: %w", err)
+	}
+	sources := []fs.FS{themes}
+	if cfg.ThemesDir != "" {
+		sources = append(sources, os.DirFS(cfg.ThemesDir))
+	}
+	if err := server.LoadThemes(sources...); err != nil {
+		return fmt.Errorf("gopherwiki: failed to load themes: %w", err)
+	}
+	if err := server.Wiki.EnsureSearchIndex(context.Background()); err != nil {
+		return fmt.Errorf("gopherwiki: failed to build search index: %w", err)
+	}
+
+	w.server = server
+	w.handler = server.Routes()
+	return nil
+}
+
+func openDatabase(uri string) (*db.Database, error) {
+	database, err := db.Open(uri)
+	if err != nil {
+		return nil, fmt.Errorf("gopherwiki: failed to open database: %w", err)
+	}
+	if err := database.Migrate(context.Background()); err != nil {
+		database.Close()
+		return nil, fmt.Errorf("gopherwiki: failed to run migrations: %w", err)
+	}
+	return database, nil
+}
+
+// ServeHTTP serves the wiki.
+func (w *Wiki) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
+	w.handler.ServeHTTP(rw, r)
+}
+
+// Service returns the wiki's page service. Saving through it updates the
+// search index and links as saving in the browser does.
+func (w *Wiki) Service() *Service {
+	return w.server.Wiki
+}
+
+// Storage returns the storage the wiki keeps its pages in.
+func (w *Wiki) Storage() Storage {
+	return w.store
+}
+
+// Page returns the page at pagepath as of revision, or as it is now if
+// revision is empty.
+func (w *Wiki) Page(ctx context.Context, pagepath, revision string) (*Page, error) {
+	return wiki.NewPage(ctx, w.store, w.server.Config, pagepath, revision)
+}
+
+// Close closes the wiki's databases. The storage is the caller's to close,
+// if it needs closing.
+func (w *Wiki) Close() error {
+	if w.users != w.db {
+		w.users.Close()
+	}
+	return w.db.Close()
+}
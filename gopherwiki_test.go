@@ -0,0 +1,76 @@
+package gopherwiki_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/sa/gopherwiki"
+)
+
+func newWiki(t *testing.T, authenticate gopherwiki.Authenticator) *gopherwiki.Wiki {
+	t.Helper()
+	cfg := gopherwiki.DefaultConfig()
+	cfg.SecretKey = "test-secret-key-for-embedding"
+	w, err := gopherwiki.New(gopherwiki.Options{
+		Config:       cfg,
+		Storage:      gopherwiki.NewMemoryStorage(),
+		Authenticate: authenticate,
+		Version:      "test",
+	})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	t.Cleanup(func() { w.Close() })
+	return w
+}
+
+func TestNew_ServesPagesSavedThroughService(t *testing.T) {
+	w := newWiki(t, nil)
+	author := gopherwiki.Author{Name: "Embedder", Email: "embedder@example.com"}
+	if _, err := w.Service().SavePage(context.Background(), "hello", "# Hello\n\nFrom the host program.\n", "Add hello", "", author); err != nil {
+		t.Fatalf("SavePage: %v", err)
+	}
+
+	rec := httptest.NewRecorder()
+	w.ServeHTTP(rec, httptest.NewRequest("GET", "/hello", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET /hello = %d, want 200", rec.Code)
+	}
+	if !strings.Contains(rec.Body.String(), "From the host program.") {
+		t.Error("page body missing from the response")
+	}
+
+	page, err := w.Page(context.Background(), "hello", "")
+	if err != nil {
+		t.Fatalf("Page: %v", err)
+	}
+	if !strings.Contains(page.Content, "From the host program.") {
+		t.Errorf("Page content = %q", page.Content)
+	}
+}
+
+func TestNew_Authenticate(t *testing.T) {
+	w := newWiki(t, func(r *http.Request) (gopherwiki.Identity, bool) {
+		if r.Header.Get("X-Host-User") == "" {
+			return gopherwiki.Identity{}, false
+		}
+		return gopherwiki.Identity{Name: "Host User", Email: r.Header.Get("X-Host-User")}, true
+	})
+
+	rec := httptest.NewRecorder()
+	w.ServeHTTP(rec, httptest.NewRequest("GET", "/-/settings", nil))
+	if rec.Code == http.StatusOK {
+		t.Error("settings served to an unauthenticated request")
+	}
+
+	r := httptest.NewRequest("GET", "/-/settings", nil)
+	r.Header.Set("X-Host-User", "host@example.com")
+	rec = httptest.NewRecorder()
+	w.ServeHTTP(rec, r)
+	if rec.Code != http.StatusOK {
+		t.Errorf("GET /-/settings as a host user = %d, want 200", rec.Code)
+	}
+}
@@ -4,8 +4,11 @@ package auth
 import (
 	"context"
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/base64"
+	"encoding/hex"
 	"errors"
+	"fmt"
 	"strings"
 	"time"
 
@@ -14,6 +17,7 @@ import (
 	"github.com/sa/gopherwiki/internal/config"
 	"github.com/sa/gopherwiki/internal/db"
 	"github.com/sa/gopherwiki/internal/models"
+	"github.com/sa/gopherwiki/internal/settings"
 )
 
 // Common errors.
@@ -24,19 +28,29 @@ var (
 	ErrInvalidPassword    = errors.New("invalid password")
 	ErrUserNotApproved    = errors.New("user not approved")
 	ErrEmailNotConfirmed  = errors.New("email not confirmed")
+	ErrPasswordTooShort   = fmt.Errorf("password must be at least %d characters", MinPasswordLength)
+	ErrInvalidEmail       = errors.New("invalid email address")
 )
 
+// MinPasswordLength is the shortest password accepted for any account.
+const MinPasswordLength = 8
+
+// PasswordResetTTL is how long a password reset link stays valid.
+const PasswordResetTTL = 24 * time.Hour
+
 // Auth provides authentication operations.
 type Auth struct {
-	config  *config.Config
-	queries *db.Queries
+	config   *config.Config
+	queries  *db.Queries
+	settings *settings.Service
 }
 
-// New creates a new Auth instance.
-func New(cfg *config.Config, queries *db.Queries) *Auth {
+// New creates a new Auth instance. Access levels for new users come from ss.
+func New(cfg *config.Config, queries *db.Queries, ss *settings.Service) *Auth {
 	return &Auth{
-		config:  cfg,
-		queries: queries,
+		config:   cfg,
+		queries:  queries,
+		settings: ss,
 	}
 }
 
@@ -69,6 +83,21 @@ func GenerateToken() (string, error) {
 	return base64.URLEncoding.EncodeToString(bytes), nil
 }
 
+// HashToken returns the form in which a password reset token is stored, so
+// that the database never holds a token that can be used as it is.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// ValidatePassword reports whether password is acceptable for an account.
+func ValidatePassword(password string) error {
+	if len(password) < MinPasswordLength {
+		return ErrPasswordTooShort
+	}
+	return nil
+}
+
 // Authenticate validates credentials and returns the user.
 func (a *Auth) Authenticate(ctx context.Context, email, password string) (*models.User, error) {
 	email = strings.ToLower(strings.TrimSpace(email))
@@ -145,9 +174,10 @@ func (a *Auth) Register(ctx context.Context, name, email, password string) (*mod
 	} else if isApproved {
 		// Apply default permissions for approved users
 		// Based on the access settings, if REGISTERED can do it, grant it
-		allowRead = a.config.ReadAccess == "ANONYMOUS" || a.config.ReadAccess == "REGISTERED"
-		allowWrite = a.config.WriteAccess == "ANONYMOUS" || a.config.WriteAccess == "REGISTERED"
-		allowUpload = a.config.AttachmentAccess == "ANONYMOUS" || a.config.AttachmentAccess == "REGISTERED"
+		access := a.settings.Get(ctx)
+		allowRead = access.ReadAccess == "ANONYMOUS" || access.ReadAccess == "REGISTERED"
+		allowWrite = access.WriteAccess == "ANONYMOUS" || access.WriteAccess == "REGISTERED"
+		allowUpload = access.AttachmentAccess == "ANONYMOUS" || access.AttachmentAccess == "REGISTERED"
 	}
 
 	// Create user
@@ -171,6 +201,118 @@ func (a *Auth) Register(ctx context.Context, name, email, password string) (*mod
 	return models.NewUser(&dbUser), nil
 }
 
+// NewUser describes an account created by an administrator.
+type NewUser struct {
+	Name        string
+	Email       string
+	Password    string // Optional; without one the user cannot log in until a password is set
+	IsApproved  bool
+	IsAdmin     bool
+	AllowRead   bool
+	AllowWrite  bool
+	AllowUpload bool
+}
+
+// CreateUser creates an account on an administrator's behalf. Unlike
+// Register, the permissions are taken as given and the email address counts
+// as confirmed.
+func (a *Auth) CreateUser(ctx context.Context, nu NewUser) (*models.User, error) {
+	email := strings.ToLower(strings.TrimSpace(nu.Email))
+	if email == "" || !strings.Contains(email, "@") {
+		return nil, ErrInvalidEmail
+	}
+	if _, err := a.queries.GetUserByEmail(ctx, email); err == nil {
+		return nil, ErrEmailExists
+	}
+
+	var hash string
+	if nu.Password != "" {
+		if err := ValidatePassword(nu.Password); err != nil {
+			return nil, err
+		}
+		var err error
+		if hash, err = HashPassword(nu.Password); err != nil {
+			return nil, err
+		}
+	}
+
+	params := models.CreateUserParams{
+		Name:           strings.TrimSpace(nu.Name),
+		Email:          email,
+		PasswordHash:   hash,
+		IsApproved:     nu.IsApproved,
+		IsAdmin:        nu.IsAdmin,
+		EmailConfirmed: true,
+		AllowRead:      nu.AllowRead,
+		AllowWrite:     nu.AllowWrite,
+		AllowUpload:    nu.AllowUpload,
+	}
+
+	dbUser, err := a.queries.CreateUser(ctx, params.ToDBParams())
+	if err != nil {
+		return nil, err
+	}
+
+	return models.NewUser(&dbUser), nil
+}
+
+// Identity is a user as a program embedding the wiki authenticated them.
+type Identity struct {
+	Name  string
+	Email string
+	Admin bool
+}
+
+// ProvisionUser returns the account of a user the embedding program
+// authenticated, creating it on first sight, approved and allowed to read,
+// write, and upload. The account's name and admin flag follow the identity.
+func (a *Auth) ProvisionUser(ctx context.Context, id Identity) (*models.User, error) {
+	user, err := a.GetUserByEmail(ctx, id.Email)
+	if errors.Is(err, ErrUserNotFound) {
+		user, err = a.CreateUser(ctx, NewUser{
+			Name:        id.Name,
+			Email:       id.Email,
+			IsApproved:  true,
+			IsAdmin:     id.Admin,
+			AllowRead:   true,
+			AllowWrite:  true,
+			AllowUpload: true,
+		})
+		if errors.Is(err, ErrEmailExists) {
+			// Created by a concurrent request.
+			return a.GetUserByEmail(ctx, id.Email)
+		}
+		return user, err
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	name := strings.TrimSpace(id.Name)
+	if name == "" {
+		name = user.Name
+	}
+	if name == user.Name && id.Admin == user.Admin() {
+		return user, nil
+	}
+	params := models.UpdateUserParams{
+		ID:             user.ID,
+		Name:           name,
+		Email:          user.Email,
+		PasswordHash:   user.GetPasswordHash(),
+		IsApproved:     user.Approved(),
+		IsAdmin:        id.Admin,
+		EmailConfirmed: user.EmailIsConfirmed(),
+		AllowRead:      user.CanRead(),
+		AllowWrite:     user.CanWrite(),
+		AllowUpload:    user.CanUpload(),
+	}
+	if err := a.queries.UpdateUser(ctx, params.ToDBParams()); err != nil {
+		return nil, err
+	}
+	return a.GetUserByID(ctx, user.ID)
+}
+
 // GetUserByID retrieves a user by ID.
 func (a *Auth) GetUserByID(ctx context.Context, id int64) (*models.User, error) {
 	dbUser, err := a.queries.GetUserByID(ctx, id)
@@ -0,0 +1,296 @@
+// Package backup writes and restores whole-wiki backup archives: a gzipped
+// tar holding a git bundle of the repository, a snapshot of the SQLite
+// database, a redacted configuration snapshot, and a manifest of SHA-256
+// checksums that Restore verifies before touching the target paths.
+package backup
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/sa/gopherwiki/internal/config"
+	"github.com/sa/gopherwiki/internal/db"
+	"github.com/sa/gopherwiki/internal/storage"
+)
+
+// FormatVersion is the archive layout version recorded in the manifest.
+const FormatVersion = 1
+
+// Archive member names.
+const (
+	BundleName   = "repository.bundle"
+	DatabaseName = "wiki.db"
+	ConfigName   = "config.json"
+	ManifestName = "manifest.json"
+)
+
+// ErrIntegrity is returned when an archive does not match its manifest.
+var ErrIntegrity = errors.New("backup: integrity check failed")
+
+// Manifest describes an archive's contents.
+type Manifest struct {
+	Format    int         `json:"format"`
+	Version   string      `json:"version"`
+	CreatedAt time.Time   `json:"created_at"`
+	Files     []FileEntry `json:"files"`
+}
+
+// FileEntry records the size and checksum of one archive member.
+type FileEntry struct {
+	Name   string `json:"name"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// Source is what a backup is taken from.
+type Source struct {
+	Storage storage.Storage
+	DB      *db.Database
+	Config  *config.Config
+	Version string
+}
+
+// Filename returns the conventional download name for a backup taken at t.
+func Filename(t time.Time) string {
+	return "gopherwiki-backup-" + t.UTC().Format("20060102-150405") + ".tar.gz"
+}
+
+// Write produces a backup archive of src. The repository bundle and database
+// snapshot are staged in a temporary directory so that each tar member's
+// size is known before it is written.
+func Write(ctx context.Context, w io.Writer, src Source) (*Manifest, error) {
+	tmp, err := os.MkdirTemp("", "gopherwiki-backup-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmp)
+
+	bundlePath := filepath.Join(tmp, BundleName)
+	f, err := os.Create(bundlePath)
+	if err != nil {
+		return nil, err
+	}
+	err = src.Storage.Bundle(ctx, f)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to bundle repository: %w", err)
+	}
+
+	dbPath := filepath.Join(tmp, DatabaseName)
+	if err := src.DB.Snapshot(ctx, dbPath); err != nil {
+		return nil, err
+	}
+
+	configPath := filepath.Join(tmp, ConfigName)
+	snapshot, err := ConfigSnapshot(src.Config)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(configPath, snapshot, 0o600); err != nil {
+		return nil, err
+	}
+
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	manifest := &Manifest{Format: FormatVersion, Version: src.Version, CreatedAt: time.Now().UTC()}
+	for _, name := range []string{BundleName, DatabaseName, ConfigName} {
+		entry, err := addFile(tw, name, filepath.Join(tmp, name))
+		if err != nil {
+			return nil, err
+		}
+		manifest.Files = append(manifest.Files, entry)
+	}
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := tw.WriteHeader(&tar.Header{Name: ManifestName, Mode: 0o600, Size: int64(len(data)), ModTime: manifest.CreatedAt}); err != nil {
+		return nil, err
+	}
+	if _, err := tw.Write(data); err != nil {
+		return nil, err
+	}
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+	if err := gz.Close(); err != nil {
+		return nil, err
+	}
+	return manifest, nil
+}
+
+// addFile copies the file at path into the archive as name, hashing it on
+// the way.
+func addFile(tw *tar.Writer, name, path string) (FileEntry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return FileEntry{}, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return FileEntry{}, err
+	}
+	if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0o600, Size: info.Size(), ModTime: info.ModTime()}); err != nil {
+		return FileEntry{}, err
+	}
+	h := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(tw, h), f); err != nil {
+		return FileEntry{}, err
+	}
+	return FileEntry{Name: name, Size: info.Size(), SHA256: hex.EncodeToString(h.Sum(nil))}, nil
+}
+
+// ConfigSnapshot renders the settings of cfg as JSON, masked as gopherwiki
+// config prints them, for reference when rebuilding a deployment. It is
+// never applied on restore. The settings only read from the environment,
+// as the encryption key, are left out.
+func ConfigSnapshot(cfg *config.Config) ([]byte, error) {
+	fc := config.FromConfig(cfg)
+	fc.MaskSecrets()
+	return json.MarshalIndent(fc, "", "  ")
+}
+
+// Extract unpacks an archive into dir and verifies every member against the
+// manifest. It fails with ErrIntegrity if a member is missing, unexpected,
+// or does not match its recorded size and checksum.
+func Extract(r io.Reader, dir string) (*Manifest, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("not a backup archive: %w", err)
+	}
+	defer gz.Close()
+
+	var manifest *Manifest
+	found := make(map[string]FileEntry)
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrIntegrity, err)
+		}
+
+		switch hdr.Name {
+		case ManifestName:
+			manifest = &Manifest{}
+			if err := json.NewDecoder(tr).Decode(manifest); err != nil {
+				return nil, fmt.Errorf("%w: unreadable manifest: %v", ErrIntegrity, err)
+			}
+		case BundleName, DatabaseName, ConfigName:
+			entry, err := extractFile(tr, hdr.Name, filepath.Join(dir, hdr.Name))
+			if err != nil {
+				return nil, err
+			}
+			found[hdr.Name] = entry
+		default:
+			return nil, fmt.Errorf("%w: unexpected member %q", ErrIntegrity, hdr.Name)
+		}
+	}
+
+	if manifest == nil {
+		return nil, fmt.Errorf("%w: no manifest", ErrIntegrity)
+	}
+	if manifest.Format != FormatVersion {
+		return nil, fmt.Errorf("backup: unsupported archive format %d", manifest.Format)
+	}
+	if len(manifest.Files) != len(found) {
+		return nil, fmt.Errorf("%w: manifest lists %d files, archive has %d", ErrIntegrity, len(manifest.Files), len(found))
+	}
+	for _, want := range manifest.Files {
+		if got, ok := found[want.Name]; !ok || got != want {
+			return nil, fmt.Errorf("%w: %s does not match the manifest", ErrIntegrity, want.Name)
+		}
+	}
+	return manifest, nil
+}
+
+func extractFile(r io.Reader, name, path string) (FileEntry, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+	if err != nil {
+		return FileEntry{}, err
+	}
+	defer f.Close()
+	h := sha256.New()
+	n, err := io.Copy(io.MultiWriter(f, h), r)
+	if err != nil {
+		return FileEntry{}, fmt.Errorf("%w: %s: %v", ErrIntegrity, name, err)
+	}
+	return FileEntry{Name: name, Size: n, SHA256: hex.EncodeToString(h.Sum(nil))}, nil
+}
+
+// Restore verifies an archive and recreates the repository at repoDir and
+// the database at dbPath. repoDir must be missing or empty and dbPath must
+// not exist, so a restore never overwrites a live wiki. Nothing is written
+// to either target unless the whole archive verifies.
+func Restore(r io.Reader, repoDir, dbPath string) (*Manifest, error) {
+	if entries, err := os.ReadDir(repoDir); err == nil && len(entries) > 0 {
+		return nil, fmt.Errorf("backup: repository directory %s is not empty", repoDir)
+	}
+	if _, err := os.Stat(dbPath); err == nil {
+		return nil, fmt.Errorf("backup: database %s already exists", dbPath)
+	}
+
+	tmp, err := os.MkdirTemp("", "gopherwiki-restore-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmp)
+
+	manifest, err := Extract(r, tmp)
+	if err != nil {
+		return nil, err
+	}
+
+	bundle, err := os.Open(filepath.Join(tmp, BundleName))
+	if err != nil {
+		return nil, err
+	}
+	defer bundle.Close()
+	if err := os.MkdirAll(repoDir, 0o755); err != nil {
+		return nil, err
+	}
+	if _, err := storage.RestoreBundle(bundle, repoDir); err != nil {
+		return nil, err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(dbPath), 0o755); err != nil {
+		return nil, err
+	}
+	if err := copyFile(filepath.Join(tmp, DatabaseName), dbPath); err != nil {
+		return nil, fmt.Errorf("failed to restore database: %w", err)
+	}
+	return manifest, nil
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,352 @@
+// Package checks validates the pages of a wiki as they are saved: links to
+// pages that do not exist, images without alt text, headings that skip a
+// level, and the misspellings a spellcheck command reports. A Checker
+// returns the findings of one check; Run collects those of several.
+// ExternalLinks finds the links to other sites, which are checked
+// periodically rather than on save.
+package checks
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"os/exec"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/extension"
+	"github.com/yuin/goldmark/text"
+
+	"github.com/sa/gopherwiki/internal/frontmatter"
+	"github.com/sa/gopherwiki/internal/renderer"
+	"github.com/sa/gopherwiki/internal/util"
+)
+
+// Page is a page to check.
+type Page struct {
+	Path    string
+	Content string // The stored source, including any frontmatter
+}
+
+// Finding is a problem a check found in a page. Line is the line of the
+// stored source it is on, 0 when it is not on one.
+type Finding struct {
+	Check   string
+	Line    int
+	Message string
+}
+
+// Checker is a check run on each saved page. Name names the check in its
+// findings.
+type Checker interface {
+	Name() string
+	Check(ctx context.Context, p Page) ([]Finding, error)
+}
+
+// Run runs the checkers over p, returning their findings by line. A
+// checker that fails is logged and passed over.
+func Run(ctx context.Context, p Page, checkers []Checker) []Finding {
+	var findings []Finding
+	for _, c := range checkers {
+		found, err := c.Check(ctx, p)
+		if err != nil {
+			slog.Warn("page check failed", "check", c.Name(), "path", p.Path, "error", err)
+			continue
+		}
+		for _, f := range found {
+			f.Check = c.Name()
+			findings = append(findings, f)
+		}
+	}
+	sort.SliceStable(findings, func(i, j int) bool { return findings[i].Line < findings[j].Line })
+	return findings
+}
+
+// document is the body of a page parsed as Markdown.
+type document struct {
+	source []byte
+	root   ast.Node
+	offset int // Lines of frontmatter before the body
+}
+
+var parser = goldmark.New(goldmark.WithExtensions(extension.GFM)).Parser()
+
+func parse(content string) document {
+	_, body := frontmatter.Parse(content)
+	offset := 0
+	if strings.HasSuffix(content, body) {
+		offset = strings.Count(content[:len(content)-len(body)], "\n")
+	}
+	source := []byte(body)
+	return document{source: source, root: parser.Parse(text.NewReader(source)), offset: offset}
+}
+
+// line returns the line of the stored source that n starts on: that of
+// its first text, or that of the block it is in.
+func (d document) line(n ast.Node) int {
+	start := -1
+	_ = ast.Walk(n, func(c ast.Node, entering bool) (ast.WalkStatus, error) {
+		if t, ok := c.(*ast.Text); ok && entering {
+			start = t.Segment.Start
+			return ast.WalkStop, nil
+		}
+		return ast.WalkContinue, nil
+	})
+	for b := n; start < 0 && b != nil; b = b.Parent() {
+		if b.Type() == ast.TypeBlock && b.Lines().Len() > 0 {
+			start = b.Lines().At(0).Start
+		}
+	}
+	if start < 0 {
+		return 0
+	}
+	return d.offset + bytes.Count(d.source[:start], []byte("\n")) + 1
+}
+
+// plainText returns the text of n and its descendants.
+func (d document) plainText(n ast.Node) string {
+	var b strings.Builder
+	_ = ast.Walk(n, func(c ast.Node, entering bool) (ast.WalkStatus, error) {
+		if entering {
+			switch t := c.(type) {
+			case *ast.Text:
+				b.Write(t.Segment.Value(d.source))
+				if t.SoftLineBreak() {
+					b.WriteByte(' ')
+				}
+			case *ast.String:
+				b.Write(t.Value)
+			}
+		}
+		return ast.WalkContinue, nil
+	})
+	return strings.TrimSpace(b.String())
+}
+
+// Links reports wiki links and Markdown links to pages that do not exist.
+// Links to the wiki's own views, under /-/, to other sites, and to files
+// with an extension other than .md, such as attachments, are not checked.
+type Links struct {
+	// Exists reports whether a link from the page at from to the page at
+	// pagepath leads to a page.
+	Exists     func(pagepath, from string) bool
+	RetainCase bool // Wiki links keep the case of their target
+}
+
+// Name implements Checker.
+func (Links) Name() string { return "links" }
+
+// Check implements Checker.
+func (c Links) Check(ctx context.Context, p Page) ([]Finding, error) {
+	var findings []Finding
+	broken := func(line int, target string) {
+		findings = append(findings, Finding{Line: line, Message: "Link to a missing page: " + target})
+	}
+
+	// Wiki links are found line by line, outside code blocks, as the
+	// page's links are indexed.
+	doc := parse(p.Content)
+	fence := ""
+	for i, line := range strings.Split(string(doc.source), "\n") {
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case fence != "":
+			if strings.HasPrefix(trimmed, fence) {
+				fence = ""
+			}
+			continue
+		case strings.HasPrefix(trimmed, "```"):
+			fence = "```"
+			continue
+		case strings.HasPrefix(trimmed, "~~~"):
+			fence = "~~~"
+			continue
+		}
+		for _, target := range renderer.ExtractWikiLinks(line, c.RetainCase) {
+			if !c.Exists(target, p.Path) {
+				broken(doc.offset+i+1, target)
+			}
+		}
+	}
+
+	err := ast.Walk(doc.root, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		link, ok := n.(*ast.Link)
+		if !entering || !ok {
+			return ast.WalkContinue, nil
+		}
+		if target, ok := linkedPage(string(link.Destination), p.Path); ok && !c.Exists(target, p.Path) {
+			broken(doc.line(link), string(link.Destination))
+		}
+		return ast.WalkContinue, nil
+	})
+	return findings, err
+}
+
+// linkedPage returns the path of the page a Markdown link from the page
+// at from leads to, reporting false for links that lead elsewhere.
+func linkedPage(dest, from string) (string, bool) {
+	u, err := url.Parse(dest)
+	if err != nil || u.Scheme != "" || u.Host != "" || u.Path == "" {
+		return "", false
+	}
+	target := u.Path
+	if !strings.HasPrefix(target, "/") {
+		target = path.Join(path.Dir("/"+from), target)
+	}
+	target = strings.Trim(path.Clean(target), "/")
+	if target == "" || target == "-" || strings.HasPrefix(target, "-/") {
+		return "", false
+	}
+	if ext := path.Ext(target); ext != "" && !util.IsMarkdownFile(target) {
+		return "", false
+	}
+	return util.StripMarkdownExtension(target), true
+}
+
+// ExternalLinks returns the http and https URLs a page links to, and
+// shows images from, in the order they first appear.
+func ExternalLinks(content string) []string {
+	doc := parse(content)
+	seen := make(map[string]bool)
+	var urls []string
+	_ = ast.Walk(doc.root, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+		var dest string
+		switch l := n.(type) {
+		case *ast.Link:
+			dest = string(l.Destination)
+		case *ast.Image:
+			dest = string(l.Destination)
+		case *ast.AutoLink:
+			if l.AutoLinkType == ast.AutoLinkURL {
+				dest = string(l.URL(doc.source))
+			}
+		}
+		u, err := url.Parse(dest)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return ast.WalkContinue, nil
+		}
+		u.Fragment = ""
+		if s := u.String(); !seen[s] {
+			seen[s] = true
+			urls = append(urls, s)
+		}
+		return ast.WalkContinue, nil
+	})
+	return urls
+}
+
+// AltText reports images without alt text.
+type AltText struct{}
+
+// Name implements Checker.
+func (AltText) Name() string { return "alt-text" }
+
+// Check implements Checker.
+func (AltText) Check(ctx context.Context, p Page) ([]Finding, error) {
+	doc := parse(p.Content)
+	var findings []Finding
+	err := ast.Walk(doc.root, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		img, ok := n.(*ast.Image)
+		if entering && ok && doc.plainText(img) == "" {
+			findings = append(findings, Finding{Line: doc.line(img), Message: "Image without alt text: " + string(img.Destination)})
+		}
+		return ast.WalkContinue, nil
+	})
+	return findings, err
+}
+
+// Headings reports a page with more than one top-level heading, and
+// headings more than one level below the heading before them.
+type Headings struct{}
+
+// Name implements Checker.
+func (Headings) Name() string { return "headings" }
+
+// Check implements Checker.
+func (Headings) Check(ctx context.Context, p Page) ([]Finding, error) {
+	doc := parse(p.Content)
+	var findings []Finding
+	previous, topLevel := 0, 0
+	for n := doc.root.FirstChild(); n != nil; n = n.NextSibling() {
+		h, ok := n.(*ast.Heading)
+		if !ok {
+			continue
+		}
+		title := doc.plainText(h)
+		if h.Level == 1 {
+			topLevel++
+			if topLevel == 2 {
+				findings = append(findings, Finding{Line: doc.line(h), Message: "More than one top-level heading: " + title})
+			}
+		}
+		if previous > 0 && h.Level > previous+1 {
+			findings = append(findings, Finding{
+				Line:    doc.line(h),
+				Message: fmt.Sprintf("Heading skips from level %d to %d: %s", previous, h.Level, title),
+			})
+		}
+		previous = h.Level
+	}
+	return findings, nil
+}
+
+// spellingTimeout is how long Spelling waits for its command.
+const spellingTimeout = 10 * time.Second
+
+// Spelling pipes the body of a page into a shell command, such as
+// "aspell list", and reports each line it prints as a possible
+// misspelling. A line starting with a line number of the body and a colon
+// is reported on that line.
+type Spelling struct {
+	Command string
+}
+
+// Name implements Checker.
+func (Spelling) Name() string { return "spelling" }
+
+// Check implements Checker.
+func (c Spelling) Check(ctx context.Context, p Page) ([]Finding, error) {
+	ctx, cancel := context.WithTimeout(ctx, spellingTimeout)
+	defer cancel()
+	doc := parse(p.Content)
+
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "sh", "-c", c.Command)
+	cmd.Stdin = bytes.NewReader(doc.source)
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("spellcheck command failed: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	var findings []Finding
+	seen := make(map[string]bool)
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		f := Finding{Message: strings.TrimSpace(scanner.Text())}
+		if before, after, ok := strings.Cut(f.Message, ":"); ok {
+			if n, err := strconv.Atoi(strings.TrimSpace(before)); err == nil && n > 0 {
+				f.Line, f.Message = doc.offset+n, strings.TrimSpace(after)
+			}
+		}
+		key := strconv.Itoa(f.Line) + ":" + f.Message
+		if f.Message == "" || seen[key] {
+			continue
+		}
+		seen[key] = true
+		f.Message = "Possible misspelling: " + f.Message
+		findings = append(findings, f)
+	}
+	return findings, scanner.Err()
+}
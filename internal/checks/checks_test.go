@@ -0,0 +1,58 @@
+package checks
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestRun(t *testing.T) {
+	exists := func(pagepath, from string) bool { return pagepath == "home" || pagepath == "docs/install" }
+	content := "---\ntitle: Guide\n---\n# Guide\n\nSee [[Home]], [[Missing Page]], and [install](install).\n\n" +
+		"### Too deep\n\n![](diagram.png) ![A chart](chart.png) [gone](/docs/gone) [file](/docs/-/files/a.pdf) [ext](https://example.com/x)\n\n" +
+		"```\n[[In Code]]\n```\n\n# Second\n"
+	p := Page{Path: "docs/guide", Content: content}
+	checkers := []Checker{Links{Exists: exists}, AltText{}, Headings{}}
+
+	got := Run(context.Background(), p, checkers)
+	want := []Finding{
+		{Check: "links", Line: 6, Message: "Link to a missing page: missing-page"},
+		{Check: "headings", Line: 8, Message: "Heading skips from level 1 to 3: Too deep"},
+		{Check: "links", Line: 10, Message: "Link to a missing page: /docs/gone"},
+		{Check: "alt-text", Line: 10, Message: "Image without alt text: diagram.png"},
+		{Check: "headings", Line: 16, Message: "More than one top-level heading: Second"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Run =\n%+v\nwant\n%+v", got, want)
+	}
+}
+
+func TestExternalLinks(t *testing.T) {
+	content := "See [the docs](https://example.com/docs#install), <https://example.org>, and www.example.net.\n\n" +
+		"![Logo](http://cdn.example.com/logo.png) [again](https://example.com/docs) [local](/home) [mail](mailto:a@example.com)\n\n" +
+		"    https://example.com/in-code\n"
+	got := ExternalLinks(content)
+	want := []string{"https://example.com/docs", "https://example.org", "http://www.example.net", "http://cdn.example.com/logo.png"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ExternalLinks = %q, want %q", got, want)
+	}
+}
+
+func TestSpelling(t *testing.T) {
+	p := Page{Path: "home", Content: "---\ntitle: Home\n---\nTeh start.\n"}
+	got, err := Spelling{Command: `cat >/dev/null; echo Teh; echo "1: Teh"; echo Teh`}.Check(context.Background(), p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Finding{
+		{Message: "Possible misspelling: Teh"},
+		{Line: 4, Message: "Possible misspelling: Teh"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Check = %+v, want %+v", got, want)
+	}
+
+	if _, err := (Spelling{Command: "exit 3"}).Check(context.Background(), p); err == nil {
+		t.Error("a failing command should be an error")
+	}
+}
@@ -0,0 +1,343 @@
+// Package cluster coordinates several GopherWiki processes that serve one
+// wiki from a shared repository and database. The processes never talk to
+// each other directly: they take leases and bump counters in the database.
+package cluster
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/sa/gopherwiki/internal/db"
+)
+
+// Topics published when shared state changes, so that the other nodes drop
+// what they cached of it.
+const (
+	// TopicRepository is published after every commit.
+	TopicRepository = "repository"
+	// TopicGitReload is published when a reload marker asks for the
+	// repository to be reopened.
+	TopicGitReload = "git-reload"
+	// TopicSettings is published when the runtime settings are saved.
+	TopicSettings = "settings"
+)
+
+const (
+	// PollInterval is how often a node looks for changes published by the
+	// others and renews its leadership.
+	PollInterval = 2 * time.Second
+	// lockTTL is how long a lock outlives a node that died holding it. Live
+	// holders renew their locks well before then.
+	lockTTL = 30 * time.Second
+	// lockRetry is how long Lock waits between attempts.
+	lockRetry = 50 * time.Millisecond
+	// repositoryLockWait is how long a commit waits for another node's.
+	repositoryLockWait = 30 * time.Second
+	// leaderName is the lease held by the node that runs the jobs.
+	leaderName = "leader"
+)
+
+// ErrLockTimeout is returned by LockRepository when another node holds the
+// repository lock for too long.
+var ErrLockTimeout = errors.New("timed out waiting for another instance to finish writing to the repository")
+
+// Job is a background task that only the leader runs.
+type Job struct {
+	Name  string
+	Every time.Duration
+	Run   func(ctx context.Context) error
+}
+
+// Node is this process's membership in a cluster. A nil database makes a
+// standalone node, which holds every lock and is always the leader.
+type Node struct {
+	db       *db.Database
+	id       string
+	interval time.Duration // PollInterval, shorter in tests
+
+	mu       sync.Mutex
+	watchers map[string]map[int]func()
+	nextID   int
+	seen     map[string]int64 // Generations as of the last poll; nil before it
+	locks    int              // Counter making the holder of each lock unique
+}
+
+// New returns the node called id of the cluster coordinating through
+// database.
+func New(database *db.Database, id string) *Node {
+	return &Node{db: database, id: id, interval: PollInterval, watchers: make(map[string]map[int]func())}
+}
+
+// Standalone returns a node for a process that shares nothing.
+func Standalone() *Node {
+	return New(nil, "standalone")
+}
+
+// DefaultID names a node after its host and process.
+func DefaultID() string {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "localhost"
+	}
+	b := make([]byte, 3)
+	rand.Read(b)
+	return fmt.Sprintf("%s-%d-%s", host, os.Getpid(), hex.EncodeToString(b))
+}
+
+// ID returns the name of the node.
+func (n *Node) ID() string {
+	return n.id
+}
+
+// Lock takes the lock called name, waiting while another node holds it,
+// until ctx is done. The lock is renewed in the background until release is
+// called.
+func (n *Node) Lock(ctx context.Context, name string) (release func(), err error) {
+	if n.db == nil {
+		return func() {}, nil
+	}
+	n.mu.Lock()
+	n.locks++
+	holder := fmt.Sprintf("%s#%d", n.id, n.locks)
+	n.mu.Unlock()
+
+	for {
+		ok, err := n.db.AcquireLease(ctx, name, holder, time.Now().Add(lockTTL))
+		if err != nil {
+			return nil, fmt.Errorf("failed to take lock %s: %w", name, err)
+		}
+		if ok {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(lockRetry):
+		}
+	}
+
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(lockTTL / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				if ok, err := n.db.AcquireLease(context.Background(), name, holder, time.Now().Add(lockTTL)); err != nil || !ok {
+					slog.Warn("failed to renew lock", "lock", name, "error", err)
+				}
+			}
+		}
+	}()
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			close(stop)
+			<-done
+			if err := n.db.ReleaseLease(context.Background(), name, holder); err != nil {
+				slog.Warn("failed to release lock", "lock", name, "error", err)
+			}
+		})
+	}, nil
+}
+
+// LockRepository takes the lock every commit to the shared repository holds.
+// Releasing it publishes TopicRepository. It gives up when ctx is done or
+// the lock has been waited for too long.
+func (n *Node) LockRepository(ctx context.Context) (release func(), err error) {
+	wait, cancel := context.WithTimeout(ctx, repositoryLockWait)
+	defer cancel()
+	unlock, err := n.Lock(wait, TopicRepository)
+	if errors.Is(err, context.DeadlineExceeded) && ctx.Err() == nil {
+		return nil, ErrLockTimeout
+	}
+	if err != nil {
+		return nil, err
+	}
+	return func() {
+		unlock()
+		n.Publish(context.Background(), TopicRepository)
+	}, nil
+}
+
+// Publish tells the other nodes that the state called topic changed.
+// Failures are logged: the others then serve what they cached until it
+// expires or the next change is published.
+func (n *Node) Publish(ctx context.Context, topic string) {
+	if n.db == nil {
+		return
+	}
+	value, err := n.db.BumpGeneration(ctx, topic)
+	if err != nil {
+		slog.Warn("failed to publish change", "topic", topic, "error", err)
+		return
+	}
+	// This node knows about its own change. Unless another node's change
+	// came in between, the next poll need not report it.
+	n.mu.Lock()
+	if n.seen != nil && n.seen[topic] == value-1 {
+		n.seen[topic] = value
+	}
+	n.mu.Unlock()
+}
+
+// Watch calls fn whenever another node publishes topic, until stop is
+// called.
+func (n *Node) Watch(topic string, fn func()) (stop func()) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	id := n.nextID
+	n.nextID++
+	if n.watchers[topic] == nil {
+		n.watchers[topic] = make(map[int]func())
+	}
+	n.watchers[topic][id] = fn
+	return func() {
+		n.mu.Lock()
+		delete(n.watchers[topic], id)
+		n.mu.Unlock()
+	}
+}
+
+// Run takes part in the cluster until ctx is done: it polls for published
+// changes, and competes for leadership, running jobs while it leads. The
+// jobs run beside the polling, which keeps renewing the leadership however
+// long they take; when it lapses, the running jobs are cancelled, as another
+// node may take over and start them.
+func (n *Node) Run(ctx context.Context, jobs []Job) {
+	next := make([]time.Time, len(jobs))
+	leading := false
+	var (
+		cancelJobs context.CancelFunc // Cancels the running jobs; nil when none run
+		jobsDone   chan struct{}
+	)
+	stopJobs := func() {
+		if cancelJobs != nil {
+			cancelJobs()
+			<-jobsDone
+			cancelJobs, jobsDone = nil, nil
+		}
+	}
+	ticker := time.NewTicker(n.interval)
+	defer ticker.Stop()
+	for {
+		n.poll(ctx)
+		if lead := n.lead(ctx); lead != leading {
+			leading = lead
+			if n.db != nil {
+				slog.Info("cluster leadership changed", "node", n.id, "leader", lead)
+			}
+			if !lead {
+				stopJobs()
+			}
+		}
+		if jobsDone != nil {
+			select {
+			case <-jobsDone:
+				stopJobs()
+			default:
+			}
+		}
+		if leading && cancelJobs == nil {
+			var due []Job
+			for i, job := range jobs {
+				if time.Now().Before(next[i]) {
+					continue
+				}
+				next[i] = time.Now().Add(job.Every)
+				due = append(due, job)
+			}
+			if len(due) > 0 {
+				cancelJobs, jobsDone = startJobs(ctx, due)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			stopJobs()
+			if leading && n.db != nil {
+				if err := n.db.ReleaseLease(context.Background(), leaderName, n.id); err != nil {
+					slog.Warn("failed to give up leadership", "error", err)
+				}
+			}
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// startJobs runs jobs one after another in the background, until they are
+// done or cancelled. The channel is closed when they have returned.
+func startJobs(ctx context.Context, jobs []Job) (context.CancelFunc, chan struct{}) {
+	ctx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for _, job := range jobs {
+			if ctx.Err() != nil {
+				return
+			}
+			if err := job.Run(ctx); err != nil && ctx.Err() == nil {
+				slog.Warn("background job failed", "job", job.Name, "error", err)
+			}
+		}
+	}()
+	return cancel, done
+}
+
+// lead takes or renews the leadership, and reports whether this node has it.
+func (n *Node) lead(ctx context.Context) bool {
+	if n.db == nil {
+		return true
+	}
+	ok, err := n.db.AcquireLease(ctx, leaderName, n.id, time.Now().Add(3*n.interval))
+	if err != nil {
+		if ctx.Err() == nil {
+			slog.Warn("failed to renew leadership", "error", err)
+		}
+		return false
+	}
+	return ok
+}
+
+// poll runs the watchers of the topics published since the last poll.
+func (n *Node) poll(ctx context.Context) {
+	if n.db == nil {
+		return
+	}
+	gens, err := n.db.Generations(ctx)
+	if err != nil {
+		if ctx.Err() == nil {
+			slog.Warn("failed to poll for changes", "error", err)
+		}
+		return
+	}
+
+	n.mu.Lock()
+	first := n.seen == nil
+	var changed []func()
+	for topic, value := range gens {
+		if !first && n.seen[topic] != value {
+			for _, fn := range n.watchers[topic] {
+				changed = append(changed, fn)
+			}
+		}
+	}
+	n.seen = gens
+	n.mu.Unlock()
+
+	for _, fn := range changed {
+		fn()
+	}
+}
@@ -0,0 +1,193 @@
+package cluster
+
+import (
+	"context"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/sa/gopherwiki/internal/db"
+)
+
+// openShared opens n handles on one database file, as n processes would.
+func openShared(t *testing.T, n int) []*db.Database {
+	t.Helper()
+	uri := "sqlite:///" + filepath.Join(t.TempDir(), "wiki.db")
+	var dbs []*db.Database
+	for i := 0; i < n; i++ {
+		database, err := db.Open(uri)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { database.Close() })
+		if err := database.Migrate(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		dbs = append(dbs, database)
+	}
+	return dbs
+}
+
+func TestLock(t *testing.T) {
+	dbs := openShared(t, 2)
+	a, b := New(dbs[0], "a"), New(dbs[1], "b")
+	ctx := context.Background()
+
+	release, err := a.Lock(ctx, "repository")
+	if err != nil {
+		t.Fatalf("Lock() failed: %v", err)
+	}
+	short, cancel := context.WithTimeout(ctx, 200*time.Millisecond)
+	defer cancel()
+	if _, err := b.Lock(short, "repository"); err == nil {
+		t.Fatal("second node took a held lock")
+	}
+	// Another lock of the same node is refused too.
+	short2, cancel2 := context.WithTimeout(ctx, 200*time.Millisecond)
+	defer cancel2()
+	if _, err := a.Lock(short2, "repository"); err == nil {
+		t.Fatal("the holder took its own lock twice")
+	}
+
+	release()
+	releaseB, err := b.Lock(ctx, "repository")
+	if err != nil {
+		t.Fatalf("Lock() after release failed: %v", err)
+	}
+	releaseB()
+}
+
+func TestPublishWatch(t *testing.T) {
+	dbs := openShared(t, 2)
+	a, b := New(dbs[0], "a"), New(dbs[1], "b")
+	ctx := context.Background()
+
+	var aCalls, bCalls atomic.Int32
+	a.Watch(TopicSettings, func() { aCalls.Add(1) })
+	stop := b.Watch(TopicSettings, func() { bCalls.Add(1) })
+	a.poll(ctx)
+	b.poll(ctx)
+
+	a.Publish(ctx, TopicSettings)
+	a.poll(ctx)
+	b.poll(ctx)
+	if aCalls.Load() != 0 {
+		t.Errorf("publisher's own watcher ran %d times, want 0", aCalls.Load())
+	}
+	if bCalls.Load() != 1 {
+		t.Errorf("other watcher ran %d times, want 1", bCalls.Load())
+	}
+
+	stop()
+	a.Publish(ctx, TopicSettings)
+	b.poll(ctx)
+	if bCalls.Load() != 1 {
+		t.Errorf("stopped watcher ran again")
+	}
+}
+
+func TestRunLeader(t *testing.T) {
+	dbs := openShared(t, 2)
+	a, b := New(dbs[0], "a"), New(dbs[1], "b")
+	ctx, cancel := context.WithCancel(context.Background())
+
+	var aRuns atomic.Int32
+	done := make(chan struct{})
+	go func() {
+		a.Run(ctx, []Job{{Name: "job", Every: time.Hour, Run: func(context.Context) error { aRuns.Add(1); return nil }}})
+		close(done)
+	}()
+	deadline := time.Now().Add(5 * time.Second)
+	for aRuns.Load() == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if aRuns.Load() != 1 {
+		t.Fatalf("leader ran its job %d times, want 1", aRuns.Load())
+	}
+	if b.lead(context.Background()) {
+		t.Error("a second node became leader while the first leads")
+	}
+
+	cancel()
+	<-done
+	if !b.lead(context.Background()) {
+		t.Error("leadership was not given up on shutdown")
+	}
+}
+
+func TestRunLongJob(t *testing.T) {
+	dbs := openShared(t, 2)
+	a, b := New(dbs[0], "a"), New(dbs[1], "b")
+	a.interval, b.interval = 20*time.Millisecond, 20*time.Millisecond
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// The job runs for several terms of the lease, which the leader keeps
+	// renewing meanwhile.
+	started, finished := make(chan struct{}), make(chan struct{})
+	long := Job{Name: "long", Every: time.Hour, Run: func(ctx context.Context) error {
+		close(started)
+		select {
+		case <-time.After(10 * 3 * a.interval):
+			close(finished)
+		case <-ctx.Done():
+		}
+		return nil
+	}}
+	done := make(chan struct{})
+	go func() {
+		a.Run(ctx, []Job{long})
+		close(done)
+	}()
+	<-started
+	for {
+		select {
+		case <-finished:
+			cancel()
+			<-done
+			return
+		case <-time.After(a.interval):
+			if b.lead(context.Background()) {
+				t.Fatal("another node took the leadership while a long job ran")
+			}
+		}
+	}
+}
+
+func TestRunLostLeadership(t *testing.T) {
+	dbs := openShared(t, 1)
+	a := New(dbs[0], "a")
+	a.interval = 20 * time.Millisecond
+
+	// A leader that fails to renew its lease cancels the job it runs.
+	started, cancelled := make(chan struct{}), make(chan struct{})
+	job := Job{Name: "long", Every: time.Hour, Run: func(ctx context.Context) error {
+		close(started)
+		<-ctx.Done()
+		close(cancelled)
+		return ctx.Err()
+	}}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go a.Run(ctx, []Job{job})
+	<-started
+	dbs[0].Close()
+	select {
+	case <-cancelled:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the job kept running after the leadership lapsed")
+	}
+}
+
+func TestStandalone(t *testing.T) {
+	n := Standalone()
+	release, err := n.Lock(context.Background(), "repository")
+	if err != nil {
+		t.Fatal(err)
+	}
+	release()
+	if !n.lead(context.Background()) {
+		t.Error("a standalone node must lead")
+	}
+}
@@ -3,6 +3,7 @@ package config
 
 import (
 	"fmt"
+	"net/netip"
 	"os"
 	"strconv"
 	"strings"
@@ -21,9 +22,16 @@ type Config struct {
 	LogLevel     string
 	LogFormat    string
 	Repository   string
+	StorageBackend string // "git", or "memory" to keep pages and history in memory only (lost on exit)
 	SecretKey    string
 	SecureCookie bool
 
+	// Session and CSRF cookie attributes
+	CookieSameSite   string // "lax", "strict" or "none"
+	CookieDomain     string // Empty for a host-only cookie
+	CookiePath       string
+	CookieHostPrefix bool // Name cookies "__Host-..." (needs Secure, path "/", no domain)
+
 	// Site settings
 	SiteName        string
 	SiteDescription string
@@ -32,7 +40,13 @@ type Config struct {
 	SiteIcon        string
 	SiteLang        string
 	HideLogo        bool
+	DisableFeeds    bool // Serve no RSS or Atom feeds; admins can change it at runtime
+	DisableSitemap  bool // Serve no sitemap.xml; admins can change it at runtime
+	RobotsDisallow  string // Comma-separated path prefixes robots.txt asks crawlers to stay out of
+	ViewCounts      bool   // Count views per page and day, storing no cookies or addresses
 	HomePage        string
+	Theme           string // Active theme, "default" for the built-in one; admins can change it at runtime
+	ThemesDir       string // Directory of theme packs, one subdirectory per theme; "" for the embedded ones only
 
 	// Auth settings
 	AuthMethod             string
@@ -47,9 +61,35 @@ type Config struct {
 	EmailNeedsConfirmation bool
 	NotifyAdminsOnRegister bool
 	NotifyUserOnApproval   bool
+	Gravatar               bool // Show the Gravatar image of users who uploaded no avatar
+
+	// Requests a client may make a minute; 0 disables the limit
+	RateLimitWrites int // Page saves, moves, deletions, and uploads
+	RateLimitIssues int // New issues and comments
+	RateLimitSearch int // Searches
+	// Reverse proxies whose X-Forwarded-For names the client: comma-separated
+	// addresses or CIDR ranges
+	TrustedProxies string
+
+	// Spam protection for anonymous contributions
+	SpamHoneypot      bool   // Refuse forms that fill in the hidden field only bots see
+	SpamBlocklistFile string // File of regular expressions, one a line; matching contributions wait for moderation
+	ReviewEdits       string // Page saves proposed for review instead of committed: "off", "anonymous", or "untrusted" (anonymous and unapproved users)
 
 	// Database
-	DatabaseURI string
+	DatabaseURI      string
+	UsersDatabaseURI string // Database holding the user accounts and sessions; "" = DatabaseURI. Wikis naming the same one share their users
+
+	// Several processes serving one wiki from a shared repository and database
+	ClusterEnabled bool   // Coordinate commits, caches, and background jobs with the other processes through the database
+	InstanceID     string // Name of this process in the cluster; "" = host name, process ID, and a random suffix
+
+	// Encryption at rest. The master key comes from EncryptionKey or from the
+	// output of EncryptionKeyCommand (a hook for KMS / secret-manager CLIs).
+	EncryptionKey        string // 32-byte master key, hex or base64
+	EncryptionKeyCommand string // Shell command printing the master key
+	EncryptAttachments   bool   // Encrypt attachment files in the repository
+	EncryptDatabase      bool   // Encrypt the SQLite database (needs a SQLCipher build)
 
 	// Mail settings
 	MailDefaultSender string
@@ -66,6 +106,14 @@ type Config struct {
 	MinifyHTML                    bool
 	CommitMessage                 string
 	WikilinkStyle                 string
+	SearchLocale                  string // Locale for search diacritic folding (e.g. "de" lets "ueber" find "über"); "" = SiteLang
+	EditConflictMode              string // "reject" saves based on a stale revision, or "overwrite" them (last write wins)
+	AnonymousAttribution          string // Author of anonymous edits: "shared", "ip", or "hashed" (a keyed hash of the IP)
+	TOCMaxDepth                   int    // Deepest heading level (1-6) listed in the table of contents and numbered
+	NumberedHeadings              bool   // Prefix headings below the page title with section numbers ("2.1")
+	EmojiShortcodes               bool   // Replace :shortcode: names such as :smile: with the emoji
+	Typographer                   bool   // Render straight quotes, "--", "---", and "..." as curly quotes, dashes, and ellipses
+	ObsidianCompat                bool   // Understand Obsidian vault conventions: ![[embeds]], attachments anywhere in the vault, frontmatter aliases
 
 	// Sidebar settings
 	SidebarMenutreeMode       string
@@ -74,15 +122,31 @@ type Config struct {
 	SidebarMenutreeFocus      string
 	SidebarCustomMenu         string
 	SidebarShortcuts          string
+	SidebarRecentPages        int // Pages viewed last listed in the sidebar; 0 for none
 
 	// Git settings
 	GitWebServer        bool
 	GitRemotePushEnabled bool
 	GitRemotePullEnabled bool
+	GitSlowOpMS          int // Log git operations slower than this as warnings; 0 disables
+	GitBinary            string // git executable run for log, blame, and diff; "" uses go-git only
+	GitMaintenanceHours  int    // Repack the repository and prune loose objects this often; 0 disables
+	GitReadTimeoutMS     int    // Give up reading a file or listing after this long; 0 disables
+	GitHistoryTimeoutMS  int    // Give up on history, blame, and diffs after this long; 0 disables
 
 	// Misc settings
 	RobotsTxt          string
 	MaxFormMemorySize  int64
+	AttachmentMemoryLimit int64 // Attachments larger than this many bytes are streamed from disk, not loaded
+	HealthMinFreeMB    int64 // Deep health check fails below this much free disk space
+	DraftTTLDays       int   // Delete editor drafts not saved for this many days; 0 keeps them
+	StalePageMonths    int   // Pages not updated for this many months are stale; 0 counts only review-by dates
+	SpellcheckCommand  string // Shell command the page checks pipe each saved page into, printing misspellings; "" skips the check
+	ExternalLinkCheckHours int // Check the links to other sites this often; 0 disables the background check
+	Offline            bool   // Air-gapped: make no requests to other sites and let pages load nothing from them
+	MetricsEnabled     bool   // Serve Prometheus metrics at /-/metrics
+	MetricsToken       string // Bearer token required by /-/metrics; empty means none
+	WebDAVEnabled      bool   // Serve the repository over WebDAV at /-/dav
 	HTMLExtraHead      string
 	HTMLExtraBody      string
 
@@ -101,6 +165,22 @@ type Config struct {
 	RenderPython      string // Pin the Python interpreter for renders (-> QUARTO_PYTHON); "" = discover
 	RenderR           string // Pin the R interpreter for renders (-> QUARTO_R); "" = discover
 	OJSLibsDir        string // Local mirror of the Observable JS libraries; when set, OJS pages load libs from the wiki (offline) instead of the CDNs
+
+	// Pandoc page export. Optional and feature-detected, like Quarto.
+	PandocEnabled   bool   // Enable Pandoc-produced page export (DOCX/ODT/EPUB, and PDF with PandocPDFEngine)
+	PandocPath      string // pandoc binary name or path
+	PandocPDFEngine string // PDF engine Pandoc runs (e.g. "typst", "weasyprint", "xelatex"); "" = no Pandoc PDF
+
+	// Read-only Gemini listener, serving pages as gemtext.
+	GeminiPort     int    // Port of the Gemini listener, on Host; 0 disables it
+	GeminiHostname string // Host name in the generated certificate; "" = the SITE_URL host
+	GeminiCertFile string // TLS certificate; a self-signed one is created here if missing
+	GeminiKeyFile  string // TLS private key, created with the certificate
+	GeminiAccess   string // INHERIT serves pages only if READ_ACCESS is ANONYMOUS; ANONYMOUS always serves them
+
+	// Wikis served by this process, each on its own host names. Only read
+	// from the config file; see WikiConfig.
+	Wikis []WikiEntry
 }
 
 // Default returns a Config with default values.
@@ -113,8 +193,13 @@ func Default() *Config {
 		LogLevel:               "INFO",
 		LogFormat:              "text",
 		Repository:             "",
+		StorageBackend:         "git",
 		SecretKey:              "CHANGE ME",
 		SecureCookie:           false,
+		CookieSameSite:         "lax",
+		CookieDomain:           "",
+		CookiePath:             "/",
+		CookieHostPrefix:       false,
 		SiteName:               "GopherWiki",
 		SiteDescription:        "",
 		SiteURL:                "http://localhost:8080",
@@ -122,7 +207,13 @@ func Default() *Config {
 		SiteIcon:               "",
 		SiteLang:               "en",
 		HideLogo:               false,
+		DisableFeeds:           false,
+		DisableSitemap:         false,
+		RobotsDisallow:         "",
+		ViewCounts:             false,
 		HomePage:               "",
+		Theme:                  "default",
+		ThemesDir:              "",
 		AuthMethod:             "",
 		AuthHeadersUsername:    "x-gopherwiki-name",
 		AuthHeadersEmail:       "x-gopherwiki-email",
@@ -135,7 +226,19 @@ func Default() *Config {
 		EmailNeedsConfirmation: true,
 		NotifyAdminsOnRegister: false,
 		NotifyUserOnApproval:   false,
+		Gravatar:               false,
+		RateLimitWrites:        30,
+		RateLimitIssues:        10,
+		RateLimitSearch:        60,
+		TrustedProxies:         "",
+		SpamHoneypot:           true,
+		SpamBlocklistFile:      "",
+		ReviewEdits:            "off",
 		DatabaseURI:            "sqlite:///:memory:",
+		EncryptionKey:          "",
+		EncryptionKeyCommand:   "",
+		EncryptAttachments:     false,
+		EncryptDatabase:        false,
 		MailDefaultSender:      "noreply@YOUR.ORGANIZATION.TLD",
 		MailServer:             "",
 		MailPort:               0,
@@ -148,17 +251,40 @@ func Default() *Config {
 		MinifyHTML:                    true,
 		CommitMessage:                 "REQUIRED",
 		WikilinkStyle:                 "",
+		SearchLocale:                  "",
+		EditConflictMode:              "reject",
+		AnonymousAttribution:          "shared",
+		TOCMaxDepth:                   6,
+		NumberedHeadings:              false,
+		EmojiShortcodes:               true,
+		Typographer:                   true,
+		ObsidianCompat:                false,
 		SidebarMenutreeMode:       "SORTED",
 		SidebarMenutreeIgnoreCase: false,
 		SidebarMenutreeMaxdepth:   "",
 		SidebarMenutreeFocus:      "SUBTREE",
 		SidebarCustomMenu:         "",
 		SidebarShortcuts:          "home pageindex createpage",
+		SidebarRecentPages:        10,
 		GitWebServer:        false,
 		GitRemotePushEnabled: false,
 		GitRemotePullEnabled: false,
+		GitSlowOpMS:          500,
+		GitMaintenanceHours:  24,
+		GitReadTimeoutMS:     10_000,
+		GitHistoryTimeoutMS:  30_000,
 		RobotsTxt:          "allow",
 		MaxFormMemorySize:  1_000_000,
+		AttachmentMemoryLimit: 1_000_000,
+		HealthMinFreeMB:    100,
+		DraftTTLDays:       30,
+		StalePageMonths:    12,
+		SpellcheckCommand:  "",
+		ExternalLinkCheckHours: 0,
+		Offline:            false,
+		MetricsEnabled:     false,
+		MetricsToken:       "",
+		WebDAVEnabled:      false,
 		HTMLExtraHead:      "",
 		HTMLExtraBody:      "",
 		IssueTags:       "bug,feature,improvement,question,documentation",
@@ -172,6 +298,14 @@ func Default() *Config {
 		RenderPython:      "",
 		RenderR:           "",
 		OJSLibsDir:        "",
+		PandocEnabled:     false,
+		PandocPath:        "pandoc",
+		PandocPDFEngine:   "",
+		GeminiPort:        0,
+		GeminiHostname:    "",
+		GeminiCertFile:    "",
+		GeminiKeyFile:     "",
+		GeminiAccess:      "INHERIT",
 	}
 }
 
@@ -229,6 +363,7 @@ func (c *Config) LoadFromEnv() {
 	c.LogLevel = getEnv("LOG_LEVEL", c.LogLevel)
 	c.LogFormat = getEnv("LOG_FORMAT", c.LogFormat)
 	c.Repository = getEnv("REPOSITORY", c.Repository)
+	c.StorageBackend = strings.ToLower(getEnv("STORAGE_BACKEND", c.StorageBackend))
 	c.SecretKey = getEnv("SECRET_KEY", c.SecretKey)
 
 	// Site settings
@@ -239,12 +374,25 @@ func (c *Config) LoadFromEnv() {
 	c.SiteIcon = getEnv("SITE_ICON", c.SiteIcon)
 	c.SiteLang = getEnv("SITE_LANG", c.SiteLang)
 	c.HideLogo = getEnvBool("HIDE_LOGO", c.HideLogo)
+	c.DisableFeeds = getEnvBool("DISABLE_FEEDS", c.DisableFeeds)
+	c.DisableSitemap = getEnvBool("DISABLE_SITEMAP", c.DisableSitemap)
+	c.RobotsDisallow = getEnv("ROBOTS_DISALLOW", c.RobotsDisallow)
+	c.ViewCounts = getEnvBool("VIEW_COUNTS", c.ViewCounts)
 	c.HomePage = getEnv("HOME_PAGE", c.HomePage)
+	c.Theme = strings.ToLower(getEnv("THEME", c.Theme))
+	c.ThemesDir = getEnv("THEMES_DIR", c.ThemesDir)
 
 	// Secure session cookie: default on when the public URL is https and we are
 	// not in dev mode; always overridable via COOKIE_SECURE.
 	autoSecure := strings.HasPrefix(strings.ToLower(c.SiteURL), "https://") && !c.DevMode
 	c.SecureCookie = getEnvBool("COOKIE_SECURE", autoSecure)
+	c.CookieSameSite = strings.ToLower(getEnv("COOKIE_SAMESITE", c.CookieSameSite))
+	c.CookieDomain = getEnv("COOKIE_DOMAIN", c.CookieDomain)
+	c.CookiePath = getEnv("COOKIE_PATH", c.CookiePath)
+	// The __Host- prefix pins cookies to this exact origin. It is the default
+	// wherever the browser will accept it: Secure, path "/" and no domain.
+	autoHostPrefix := c.SecureCookie && c.CookieDomain == "" && c.CookiePath == "/"
+	c.CookieHostPrefix = getEnvBool("COOKIE_HOST_PREFIX", autoHostPrefix)
 
 	// Auth settings
 	c.AuthMethod = getEnv("AUTH_METHOD", c.AuthMethod)
@@ -259,9 +407,28 @@ func (c *Config) LoadFromEnv() {
 	c.EmailNeedsConfirmation = getEnvBool("EMAIL_NEEDS_CONFIRMATION", c.EmailNeedsConfirmation)
 	c.NotifyAdminsOnRegister = getEnvBool("NOTIFY_ADMINS_ON_REGISTER", c.NotifyAdminsOnRegister)
 	c.NotifyUserOnApproval = getEnvBool("NOTIFY_USER_ON_APPROVAL", c.NotifyUserOnApproval)
+	c.Gravatar = getEnvBool("GRAVATAR", c.Gravatar)
+	c.RateLimitWrites = getEnvInt("RATE_LIMIT_WRITES", c.RateLimitWrites)
+	c.RateLimitIssues = getEnvInt("RATE_LIMIT_ISSUES", c.RateLimitIssues)
+	c.RateLimitSearch = getEnvInt("RATE_LIMIT_SEARCH", c.RateLimitSearch)
+	c.TrustedProxies = getEnv("TRUSTED_PROXIES", c.TrustedProxies)
+	c.SpamHoneypot = getEnvBool("SPAM_HONEYPOT", c.SpamHoneypot)
+	c.SpamBlocklistFile = getEnv("SPAM_BLOCKLIST_FILE", c.SpamBlocklistFile)
+	c.ReviewEdits = strings.ToLower(getEnv("REVIEW_EDITS", c.ReviewEdits))
 
 	// Database
 	c.DatabaseURI = getEnv("DATABASE_URI", c.DatabaseURI)
+	c.UsersDatabaseURI = getEnv("USERS_DATABASE_URI", c.UsersDatabaseURI)
+
+	// Cluster
+	c.ClusterEnabled = getEnvBool("CLUSTER_ENABLED", c.ClusterEnabled)
+	c.InstanceID = getEnv("INSTANCE_ID", c.InstanceID)
+
+	// Encryption at rest
+	c.EncryptionKey = getEnv("ENCRYPTION_KEY", c.EncryptionKey)
+	c.EncryptionKeyCommand = getEnv("ENCRYPTION_KEY_COMMAND", c.EncryptionKeyCommand)
+	c.EncryptAttachments = getEnvBool("ENCRYPT_ATTACHMENTS", c.EncryptAttachments)
+	c.EncryptDatabase = getEnvBool("ENCRYPT_DATABASE", c.EncryptDatabase)
 
 	// Mail settings
 	c.MailDefaultSender = getEnv("MAIL_DEFAULT_SENDER", c.MailDefaultSender)
@@ -278,6 +445,14 @@ func (c *Config) LoadFromEnv() {
 	c.MinifyHTML = getEnvBool("MINIFY_HTML", c.MinifyHTML)
 	c.CommitMessage = getEnv("COMMIT_MESSAGE", c.CommitMessage)
 	c.WikilinkStyle = getEnv("WIKILINK_STYLE", c.WikilinkStyle)
+	c.SearchLocale = getEnv("SEARCH_LOCALE", c.SearchLocale)
+	c.EditConflictMode = strings.ToLower(getEnv("EDIT_CONFLICT_MODE", c.EditConflictMode))
+	c.AnonymousAttribution = strings.ToLower(getEnv("ANONYMOUS_ATTRIBUTION", c.AnonymousAttribution))
+	c.TOCMaxDepth = getEnvInt("TOC_MAX_DEPTH", c.TOCMaxDepth)
+	c.NumberedHeadings = getEnvBool("NUMBERED_HEADINGS", c.NumberedHeadings)
+	c.EmojiShortcodes = getEnvBool("EMOJI_SHORTCODES", c.EmojiShortcodes)
+	c.Typographer = getEnvBool("TYPOGRAPHER", c.Typographer)
+	c.ObsidianCompat = getEnvBool("OBSIDIAN_COMPAT", c.ObsidianCompat)
 
 	// Sidebar settings
 	c.SidebarMenutreeMode = getEnv("SIDEBAR_MENUTREE_MODE", c.SidebarMenutreeMode)
@@ -286,15 +461,31 @@ func (c *Config) LoadFromEnv() {
 	c.SidebarMenutreeFocus = getEnv("SIDEBAR_MENUTREE_FOCUS", c.SidebarMenutreeFocus)
 	c.SidebarCustomMenu = getEnv("SIDEBAR_CUSTOM_MENU", c.SidebarCustomMenu)
 	c.SidebarShortcuts = getEnv("SIDEBAR_SHORTCUTS", c.SidebarShortcuts)
+	c.SidebarRecentPages = getEnvInt("SIDEBAR_RECENT_PAGES", c.SidebarRecentPages)
 
 	// Git settings
 	c.GitWebServer = getEnvBool("GIT_WEB_SERVER", c.GitWebServer)
 	c.GitRemotePushEnabled = getEnvBool("GIT_REMOTE_PUSH_ENABLED", c.GitRemotePushEnabled)
 	c.GitRemotePullEnabled = getEnvBool("GIT_REMOTE_PULL_ENABLED", c.GitRemotePullEnabled)
+	c.GitSlowOpMS = getEnvInt("GIT_SLOW_OP_MS", c.GitSlowOpMS)
+	c.GitBinary = getEnv("GIT_BINARY", c.GitBinary)
+	c.GitMaintenanceHours = getEnvInt("GIT_MAINTENANCE_HOURS", c.GitMaintenanceHours)
+	c.GitReadTimeoutMS = getEnvInt("GIT_READ_TIMEOUT_MS", c.GitReadTimeoutMS)
+	c.GitHistoryTimeoutMS = getEnvInt("GIT_HISTORY_TIMEOUT_MS", c.GitHistoryTimeoutMS)
 
 	// Misc settings
 	c.RobotsTxt = getEnv("ROBOTS_TXT", c.RobotsTxt)
 	c.MaxFormMemorySize = getEnvInt64("MAX_FORM_MEMORY_SIZE", c.MaxFormMemorySize)
+	c.AttachmentMemoryLimit = getEnvInt64("ATTACHMENT_MEMORY_LIMIT", c.AttachmentMemoryLimit)
+	c.HealthMinFreeMB = getEnvInt64("HEALTH_MIN_FREE_MB", c.HealthMinFreeMB)
+	c.DraftTTLDays = getEnvInt("DRAFT_TTL_DAYS", c.DraftTTLDays)
+	c.StalePageMonths = getEnvInt("STALE_PAGE_MONTHS", c.StalePageMonths)
+	c.SpellcheckCommand = getEnv("SPELLCHECK_COMMAND", c.SpellcheckCommand)
+	c.ExternalLinkCheckHours = getEnvInt("EXTERNAL_LINK_CHECK_HOURS", c.ExternalLinkCheckHours)
+	c.Offline = getEnvBool("OFFLINE", c.Offline)
+	c.MetricsEnabled = getEnvBool("METRICS_ENABLED", c.MetricsEnabled)
+	c.MetricsToken = getEnv("METRICS_TOKEN", c.MetricsToken)
+	c.WebDAVEnabled = getEnvBool("WEBDAV_ENABLED", c.WebDAVEnabled)
 	c.HTMLExtraHead = getEnv("HTML_EXTRA_HEAD", c.HTMLExtraHead)
 	c.HTMLExtraBody = getEnv("HTML_EXTRA_BODY", c.HTMLExtraBody)
 	// Issue tracker settings
@@ -310,18 +501,145 @@ func (c *Config) LoadFromEnv() {
 	c.RenderPython = getEnv("RENDER_PYTHON", c.RenderPython)
 	c.RenderR = getEnv("RENDER_R", c.RenderR)
 	c.OJSLibsDir = getEnv("OJS_LIBS_DIR", c.OJSLibsDir)
+	c.PandocEnabled = getEnvBool("PANDOC_ENABLED", c.PandocEnabled)
+	c.PandocPath = getEnv("PANDOC_PATH", c.PandocPath)
+	c.PandocPDFEngine = getEnv("PANDOC_PDF_ENGINE", c.PandocPDFEngine)
+	c.GeminiPort = getEnvInt("GEMINI_PORT", c.GeminiPort)
+	c.GeminiHostname = getEnv("GEMINI_HOSTNAME", c.GeminiHostname)
+	c.GeminiCertFile = getEnv("GEMINI_CERT_FILE", c.GeminiCertFile)
+	c.GeminiKeyFile = getEnv("GEMINI_KEY_FILE", c.GeminiKeyFile)
+	c.GeminiAccess = getEnv("GEMINI_ACCESS", c.GeminiAccess)
+}
+
+// ValidThemeName reports whether name can name a theme: lowercase letters,
+// digits, hyphens, and underscores, starting with a letter or digit.
+func ValidThemeName(name string) bool {
+	for i, r := range name {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9':
+		case (r == '-' || r == '_') && i > 0:
+		default:
+			return false
+		}
+	}
+	return name != ""
 }
 
 // Validate checks that required configuration is set.
 func (c *Config) Validate() error {
+	if len(c.Wikis) > 0 {
+		return c.validateWikis()
+	}
 	if !c.DevMode && (len(c.SecretKey) < 16 || c.SecretKey == "CHANGE ME") {
 		return fmt.Errorf("please configure a random SECRET_KEY with a length of at least 16 characters")
 	}
-	if c.Repository == "" {
-		return fmt.Errorf("please configure a REPOSITORY path")
+	switch c.StorageBackend {
+	case "git":
+		if c.Repository == "" {
+			return fmt.Errorf("please configure a REPOSITORY path")
+		}
+		if _, err := os.Stat(c.Repository); os.IsNotExist(err) {
+			return fmt.Errorf("repository path '%s' not found", c.Repository)
+		}
+	case "memory":
+		if c.ClusterEnabled {
+			return fmt.Errorf("CLUSTER_ENABLED needs STORAGE_BACKEND=git: instances cannot share a memory storage")
+		}
+	default:
+		return fmt.Errorf("STORAGE_BACKEND must be git or memory, got %q", c.StorageBackend)
+	}
+	if err := c.validateCookies(); err != nil {
+		return err
+	}
+	if !ValidThemeName(c.Theme) {
+		return fmt.Errorf("THEME must be a theme name (lowercase letters, digits, hyphens, and underscores), got %q", c.Theme)
+	}
+	if c.EditConflictMode != "reject" && c.EditConflictMode != "overwrite" {
+		return fmt.Errorf("EDIT_CONFLICT_MODE must be reject or overwrite, got %q", c.EditConflictMode)
+	}
+	switch c.AnonymousAttribution {
+	case "shared", "ip", "hashed":
+	default:
+		return fmt.Errorf("ANONYMOUS_ATTRIBUTION must be shared, ip or hashed, got %q", c.AnonymousAttribution)
+	}
+	switch c.ReviewEdits {
+	case "off", "anonymous", "untrusted":
+	default:
+		return fmt.Errorf("REVIEW_EDITS must be off, anonymous or untrusted, got %q", c.ReviewEdits)
+	}
+	for _, prefix := range c.RobotsDisallowPaths() {
+		if !strings.HasPrefix(prefix, "/") {
+			return fmt.Errorf("ROBOTS_DISALLOW paths must start with /, got %q", prefix)
+		}
+	}
+	if _, err := c.TrustedProxyPrefixes(); err != nil {
+		return err
+	}
+	if c.TOCMaxDepth < 1 || c.TOCMaxDepth > 6 {
+		return fmt.Errorf("TOC_MAX_DEPTH must be between 1 and 6, got %d", c.TOCMaxDepth)
+	}
+	if (c.EncryptAttachments || c.EncryptDatabase) && c.EncryptionKey == "" && c.EncryptionKeyCommand == "" {
+		return fmt.Errorf("encryption at rest needs ENCRYPTION_KEY or ENCRYPTION_KEY_COMMAND")
+	}
+	if c.GeminiAccess != "INHERIT" && c.GeminiAccess != "ANONYMOUS" {
+		return fmt.Errorf("GEMINI_ACCESS must be INHERIT or ANONYMOUS, got %q", c.GeminiAccess)
+	}
+	if (c.GeminiCertFile == "") != (c.GeminiKeyFile == "") {
+		return fmt.Errorf("GEMINI_CERT_FILE and GEMINI_KEY_FILE must be set together")
+	}
+	return nil
+}
+
+// RobotsDisallowPaths returns the path prefixes of ROBOTS_DISALLOW, without
+// empty entries.
+func (c *Config) RobotsDisallowPaths() []string {
+	var paths []string
+	for _, p := range strings.Split(c.RobotsDisallow, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			paths = append(paths, p)
+		}
+	}
+	return paths
+}
+
+// TrustedProxyPrefixes returns the address ranges of TRUSTED_PROXIES; an
+// address alone is a range of one.
+func (c *Config) TrustedProxyPrefixes() ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+	for _, p := range strings.Split(c.TrustedProxies, ",") {
+		if p = strings.TrimSpace(p); p == "" {
+			continue
+		}
+		if addr, err := netip.ParseAddr(p); err == nil {
+			prefixes = append(prefixes, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(p)
+		if err != nil {
+			return nil, fmt.Errorf("TRUSTED_PROXIES must list addresses or CIDR ranges, got %q", p)
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes, nil
+}
+
+// validateCookies rejects cookie attribute combinations that browsers would
+// silently refuse, which would otherwise surface as logins that never stick.
+func (c *Config) validateCookies() error {
+	switch c.CookieSameSite {
+	case "lax", "strict":
+	case "none":
+		if !c.SecureCookie {
+			return fmt.Errorf("COOKIE_SAMESITE=none requires COOKIE_SECURE")
+		}
+	default:
+		return fmt.Errorf("COOKIE_SAMESITE must be lax, strict or none, got %q", c.CookieSameSite)
+	}
+	if !strings.HasPrefix(c.CookiePath, "/") {
+		return fmt.Errorf("COOKIE_PATH must start with /, got %q", c.CookiePath)
 	}
-	if _, err := os.Stat(c.Repository); os.IsNotExist(err) {
-		return fmt.Errorf("repository path '%s' not found", c.Repository)
+	if c.CookieHostPrefix && (!c.SecureCookie || c.CookieDomain != "" || c.CookiePath != "/") {
+		return fmt.Errorf("COOKIE_HOST_PREFIX requires COOKIE_SECURE, COOKIE_PATH=/ and no COOKIE_DOMAIN")
 	}
 	return nil
 }
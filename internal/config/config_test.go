@@ -1,6 +1,8 @@
 package config
 
 import (
+	"reflect"
+	"sort"
 	"testing"
 )
 
@@ -44,6 +46,67 @@ func TestSecureCookieAutoDetect(t *testing.T) {
 	})
 }
 
+func TestCookieHostPrefixAutoDetect(t *testing.T) {
+	t.Run("https site enables host prefix", func(t *testing.T) {
+		t.Setenv("SITE_URL", "https://wiki.example.com")
+		c := Default()
+		c.LoadFromEnv()
+		if !c.CookieHostPrefix {
+			t.Error("CookieHostPrefix should be true for an https SITE_URL")
+		}
+	})
+
+	t.Run("cookie domain disables host prefix", func(t *testing.T) {
+		t.Setenv("SITE_URL", "https://wiki.example.com")
+		t.Setenv("COOKIE_DOMAIN", "example.com")
+		c := Default()
+		c.LoadFromEnv()
+		if c.CookieHostPrefix {
+			t.Error("CookieHostPrefix should be false when COOKIE_DOMAIN is set")
+		}
+	})
+
+	t.Run("dev mode disables host prefix", func(t *testing.T) {
+		t.Setenv("SITE_URL", "https://wiki.example.com")
+		t.Setenv("DEV_MODE", "1")
+		c := Default()
+		c.LoadFromEnv()
+		if c.CookieHostPrefix {
+			t.Error("CookieHostPrefix should be false in dev mode")
+		}
+	})
+}
+
+func TestValidate_Cookies(t *testing.T) {
+	tests := []struct {
+		name    string
+		modify  func(c *Config)
+		wantErr bool
+	}{
+		{"defaults", func(c *Config) {}, false},
+		{"strict", func(c *Config) { c.CookieSameSite = "strict" }, false},
+		{"unknown samesite", func(c *Config) { c.CookieSameSite = "sometimes" }, true},
+		{"none without secure", func(c *Config) { c.CookieSameSite = "none" }, true},
+		{"none with secure", func(c *Config) { c.CookieSameSite = "none"; c.SecureCookie = true }, false},
+		{"relative path", func(c *Config) { c.CookiePath = "wiki" }, true},
+		{"prefix without secure", func(c *Config) { c.CookieHostPrefix = true }, true},
+		{"prefix with domain", func(c *Config) { c.CookieHostPrefix = true; c.SecureCookie = true; c.CookieDomain = "example.com" }, true},
+		{"prefix with subpath", func(c *Config) { c.CookieHostPrefix = true; c.SecureCookie = true; c.CookiePath = "/wiki" }, true},
+		{"prefix", func(c *Config) { c.CookieHostPrefix = true; c.SecureCookie = true }, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := Default()
+			cfg.SecretKey = "a-long-secret-key-here"
+			cfg.Repository = t.TempDir()
+			tt.modify(cfg)
+			if err := cfg.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
 func TestDefault(t *testing.T) {
 	cfg := Default()
 
@@ -179,6 +242,22 @@ func TestValidate_Valid(t *testing.T) {
 	}
 }
 
+func TestValidate_EncryptionNeedsKey(t *testing.T) {
+	cfg := Default()
+	cfg.SecretKey = "a-long-secret-key-here"
+	cfg.Repository = t.TempDir()
+	cfg.EncryptAttachments = true
+
+	if err := cfg.Validate(); err == nil {
+		t.Error("Validate() should return error when encryption is enabled without a key")
+	}
+
+	cfg.EncryptionKeyCommand = "cat /run/secrets/wiki-key"
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("Validate() returned error with a key command: %v", err)
+	}
+}
+
 func TestValidate_ShortSecretKey(t *testing.T) {
 	cfg := Default()
 	cfg.SecretKey = "short"
@@ -271,3 +350,186 @@ func TestValidate_ProductionMode_RejectsWeakSecretKey(t *testing.T) {
 		t.Error("Validate() should reject weak SecretKey when DevMode=false")
 	}
 }
+
+func TestPrepareReload(t *testing.T) {
+	startup := Default()
+	running := Default()
+	running.Host = "127.0.0.1" // adjusted after loading, as dev mode does
+	running.SecretKey = "generated-at-startup"
+
+	next := Default()
+	next.SiteName = "Renamed"
+	next.ReadAccess = "REGISTERED"
+	next.Port = 9090
+	next.ExternalLinkCheckHours = 6 // the schedule of a background job
+
+	applied, needRestart := PrepareReload(startup, running, next)
+
+	if want := []string{"ReadAccess", "SiteName"}; !equalSorted(applied, want) {
+		t.Errorf("applied = %v, want %v", applied, want)
+	}
+	if want := []string{"ExternalLinkCheckHours", "Port"}; !equalSorted(needRestart, want) {
+		t.Errorf("needRestart = %v, want %v", needRestart, want)
+	}
+	if next.Port != running.Port || next.Host != running.Host || next.SecretKey != running.SecretKey {
+		t.Errorf("restart-only settings not kept: port=%d host=%q secret=%q", next.Port, next.Host, next.SecretKey)
+	}
+	if next.SiteName != "Renamed" || next.ReadAccess != "REGISTERED" {
+		t.Errorf("reloadable settings not applied: site=%q read=%q", next.SiteName, next.ReadAccess)
+	}
+}
+
+func TestPrepareReload_RestartFieldsExist(t *testing.T) {
+	fields := reflect.TypeOf(Config{})
+	for name := range restartRequired {
+		if _, ok := fields.FieldByName(name); !ok {
+			t.Errorf("restartRequired names unknown field %q", name)
+		}
+	}
+}
+
+func equalSorted(got, want []string) bool {
+	got = append([]string(nil), got...)
+	sort.Strings(got)
+	return reflect.DeepEqual(got, want)
+}
+
+func TestValidate_EditConflictMode(t *testing.T) {
+	t.Setenv("EDIT_CONFLICT_MODE", "Overwrite")
+	cfg := Default()
+	cfg.LoadFromEnv()
+	cfg.SecretKey = "0123456789abcdef0123"
+	cfg.Repository = t.TempDir()
+	if cfg.EditConflictMode != "overwrite" {
+		t.Errorf("EditConflictMode = %q, want lowercased %q", cfg.EditConflictMode, "overwrite")
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("Validate() error = %v", err)
+	}
+
+	cfg.EditConflictMode = "merge"
+	if err := cfg.Validate(); err == nil {
+		t.Error("Validate() should reject an unknown EDIT_CONFLICT_MODE")
+	}
+}
+
+func TestValidate_StorageBackend(t *testing.T) {
+	t.Setenv("STORAGE_BACKEND", "Memory")
+	cfg := Default()
+	cfg.LoadFromEnv()
+	cfg.SecretKey = "0123456789abcdef0123"
+	if cfg.StorageBackend != "memory" {
+		t.Errorf("StorageBackend = %q, want lowercased %q", cfg.StorageBackend, "memory")
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("Validate() without a repository error = %v", err)
+	}
+
+	cfg.ClusterEnabled = true
+	if err := cfg.Validate(); err == nil {
+		t.Error("Validate() should reject a cluster on memory storage")
+	}
+	cfg.ClusterEnabled = false
+	cfg.StorageBackend = "svn"
+	if err := cfg.Validate(); err == nil {
+		t.Error("Validate() should reject an unknown STORAGE_BACKEND")
+	}
+}
+
+func TestValidate_AnonymousAttribution(t *testing.T) {
+	t.Setenv("ANONYMOUS_ATTRIBUTION", "Hashed")
+	cfg := Default()
+	cfg.LoadFromEnv()
+	cfg.SecretKey = "0123456789abcdef0123"
+	cfg.Repository = t.TempDir()
+	if cfg.AnonymousAttribution != "hashed" {
+		t.Errorf("AnonymousAttribution = %q, want lowercased %q", cfg.AnonymousAttribution, "hashed")
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("Validate() error = %v", err)
+	}
+
+	cfg.AnonymousAttribution = "cookie"
+	if err := cfg.Validate(); err == nil {
+		t.Error("Validate() should reject an unknown ANONYMOUS_ATTRIBUTION")
+	}
+}
+
+func TestValidate_ReviewEdits(t *testing.T) {
+	t.Setenv("REVIEW_EDITS", "Untrusted")
+	cfg := Default()
+	cfg.LoadFromEnv()
+	cfg.SecretKey = "0123456789abcdef0123"
+	cfg.Repository = t.TempDir()
+	if cfg.ReviewEdits != "untrusted" {
+		t.Errorf("ReviewEdits = %q, want lowercased %q", cfg.ReviewEdits, "untrusted")
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("Validate() error = %v", err)
+	}
+
+	cfg.ReviewEdits = "everyone"
+	if err := cfg.Validate(); err == nil {
+		t.Error("Validate() should reject an unknown REVIEW_EDITS")
+	}
+}
+
+func TestValidate_RobotsDisallow(t *testing.T) {
+	t.Setenv("ROBOTS_DISALLOW", " /-/ ,, /private")
+	cfg := Default()
+	cfg.LoadFromEnv()
+	cfg.SecretKey = "0123456789abcdef0123"
+	cfg.Repository = t.TempDir()
+	if got := cfg.RobotsDisallowPaths(); len(got) != 2 || got[0] != "/-/" || got[1] != "/private" {
+		t.Errorf("RobotsDisallowPaths() = %q, want [/-/ /private]", got)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("Validate() error = %v", err)
+	}
+
+	cfg.RobotsDisallow = "private"
+	if err := cfg.Validate(); err == nil {
+		t.Error("Validate() should reject a ROBOTS_DISALLOW path without a leading /")
+	}
+}
+
+func TestValidate_TrustedProxies(t *testing.T) {
+	t.Setenv("TRUSTED_PROXIES", " 10.0.0.1, ,192.168.0.0/16 ,::1")
+	cfg := Default()
+	cfg.LoadFromEnv()
+	cfg.SecretKey = "0123456789abcdef0123"
+	cfg.Repository = t.TempDir()
+	got, err := cfg.TrustedProxyPrefixes()
+	if err != nil || len(got) != 3 || got[0].String() != "10.0.0.1/32" || got[1].String() != "192.168.0.0/16" || got[2].String() != "::1/128" {
+		t.Errorf("TrustedProxyPrefixes() = %v, %v; want [10.0.0.1/32 192.168.0.0/16 ::1/128]", got, err)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("Validate() error = %v", err)
+	}
+
+	cfg.TrustedProxies = "proxy.example.com"
+	if err := cfg.Validate(); err == nil {
+		t.Error("Validate() should reject a TRUSTED_PROXIES entry that is not an address")
+	}
+}
+
+func TestValidate_TOCMaxDepth(t *testing.T) {
+	t.Setenv("TOC_MAX_DEPTH", "3")
+	cfg := Default()
+	cfg.LoadFromEnv()
+	cfg.SecretKey = "0123456789abcdef0123"
+	cfg.Repository = t.TempDir()
+	if cfg.TOCMaxDepth != 3 {
+		t.Errorf("TOCMaxDepth = %d, want 3", cfg.TOCMaxDepth)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("Validate() error = %v", err)
+	}
+
+	for _, depth := range []int{0, 7} {
+		cfg.TOCMaxDepth = depth
+		if err := cfg.Validate(); err == nil {
+			t.Errorf("Validate() should reject TOC_MAX_DEPTH=%d", depth)
+		}
+	}
+}
@@ -1,47 +1,188 @@
 package config
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
+	"io"
+	"net/url"
 	"os"
+	"path/filepath"
+	"strings"
 
 	"gopkg.in/yaml.v3"
 )
 
-// FileConfig holds configuration values loaded from a YAML file.
+// FileConfig holds configuration values loaded from a YAML or TOML file; the
+// yaml tags are the keys of both.
 // All fields are pointers so we can distinguish "not set" from zero values.
 type FileConfig struct {
 	// Server
-	Port    *int    `yaml:"port"`
-	Host    *string `yaml:"host"`
-	SiteURL *string `yaml:"base_url"`
-	DevMode *bool   `yaml:"dev_mode"`
+	Port    *int    `yaml:"port,omitempty"`
+	Host    *string `yaml:"host,omitempty"`
+	SiteURL *string `yaml:"base_url,omitempty"`
+	DevMode *bool   `yaml:"dev_mode,omitempty"`
 
 	// Storage
-	Repository  *string `yaml:"repository_path"`
-	DatabaseURI *string `yaml:"database_path"`
+	Repository       *string `yaml:"repository_path,omitempty"`
+	StorageBackend   *string `yaml:"storage_backend,omitempty"`
+	DatabaseURI      *string `yaml:"database_path,omitempty"`
+	UsersDatabaseURI *string `yaml:"users_database_path,omitempty"`
+
+	// Cluster
+	ClusterEnabled *bool   `yaml:"cluster_enabled,omitempty"`
+	InstanceID     *string `yaml:"instance_id,omitempty"`
+
+	// Encryption at rest (the key itself is only read from the environment)
+	EncryptionKeyCommand *string `yaml:"encryption_key_command,omitempty"`
+	EncryptAttachments   *bool   `yaml:"encrypt_attachments,omitempty"`
+	EncryptDatabase      *bool   `yaml:"encrypt_database,omitempty"`
 
 	// Auth
-	AuthMethod          *string `yaml:"auth_method"`
-	DisableRegistration *bool   `yaml:"registration_enabled"`
-	SecretKey           *string `yaml:"session_secret"`
-	AutoApproval        *bool   `yaml:"auto_approval"`
+	AuthMethod             *string `yaml:"auth_method,omitempty"`
+	DisableRegistration    *bool   `yaml:"registration_enabled,omitempty"`
+	SecretKey              *string `yaml:"session_secret,omitempty"`
+	AutoApproval           *bool   `yaml:"auto_approval,omitempty"`
+	CookieSameSite         *string `yaml:"cookie_samesite,omitempty"`
+	CookieDomain           *string `yaml:"cookie_domain,omitempty"`
+	CookiePath             *string `yaml:"cookie_path,omitempty"`
+	CookieHostPrefix       *bool   `yaml:"cookie_host_prefix,omitempty"`
+	AuthHeadersUsername    *string `yaml:"auth_headers_username,omitempty"`
+	AuthHeadersEmail       *string `yaml:"auth_headers_email,omitempty"`
+	AuthHeadersPermissions *string `yaml:"auth_headers_permissions,omitempty"`
+	EmailNeedsConfirmation *bool   `yaml:"email_needs_confirmation,omitempty"`
+	NotifyAdminsOnRegister *bool   `yaml:"notify_admins_on_register,omitempty"`
+	NotifyUserOnApproval   *bool   `yaml:"notify_user_on_approval,omitempty"`
+	Gravatar               *bool   `yaml:"gravatar,omitempty"`
 
 	// Permissions
-	ReadAccess       *string `yaml:"read_access"`
-	WriteAccess      *string `yaml:"write_access"`
-	AttachmentAccess *string `yaml:"attachment_access"`
+	ReadAccess       *string `yaml:"read_access,omitempty"`
+	WriteAccess      *string `yaml:"write_access,omitempty"`
+	AttachmentAccess *string `yaml:"attachment_access,omitempty"`
+
+	// Rate limits
+	RateLimitWrites *int    `yaml:"rate_limit_writes,omitempty"`
+	RateLimitIssues *int    `yaml:"rate_limit_issues,omitempty"`
+	RateLimitSearch *int    `yaml:"rate_limit_search,omitempty"`
+	TrustedProxies  *string `yaml:"trusted_proxies,omitempty"`
+
+	// Spam protection
+	SpamHoneypot      *bool   `yaml:"spam_honeypot,omitempty"`
+	SpamBlocklistFile *string `yaml:"spam_blocklist_file,omitempty"`
+	ReviewEdits       *string `yaml:"review_edits,omitempty"`
 
 	// Wiki
-	SiteName *string `yaml:"site_name"`
-	HomePage *string `yaml:"landing_page"`
-	SiteLang *string `yaml:"site_lang"`
+	SiteName        *string `yaml:"site_name,omitempty"`
+	HomePage        *string `yaml:"landing_page,omitempty"`
+	SiteLang        *string `yaml:"site_lang,omitempty"`
+	SearchLocale    *string `yaml:"search_locale,omitempty"`
+	SiteDescription *string `yaml:"site_description,omitempty"`
+	SiteLogo        *string `yaml:"site_logo,omitempty"`
+	SiteIcon        *string `yaml:"site_icon,omitempty"`
+	HideLogo        *bool   `yaml:"hide_logo,omitempty"`
+	DisableFeeds    *bool   `yaml:"disable_feeds,omitempty"`
+	DisableSitemap  *bool   `yaml:"disable_sitemap,omitempty"`
+	RobotsDisallow  *string `yaml:"robots_disallow,omitempty"`
+	ViewCounts      *bool   `yaml:"view_counts,omitempty"`
+	Theme           *string `yaml:"theme,omitempty"`
+	ThemesDir       *string `yaml:"themes_dir,omitempty"`
+
+	// Editing
+	EditConflictMode                *string `yaml:"edit_conflict_mode,omitempty"`
+	AnonymousAttribution            *string `yaml:"anonymous_attribution,omitempty"`
+	RetainPageNameCase              *bool   `yaml:"retain_page_name_case,omitempty"`
+	TreatUnderscoreAsSpaceForTitles *bool   `yaml:"treat_underscore_as_space_for_titles,omitempty"`
+	CommitMessage                   *string `yaml:"commit_message,omitempty"`
+	WikilinkStyle                   *string `yaml:"wikilink_style,omitempty"`
+
+	// Rendering
+	TOCMaxDepth      *int    `yaml:"toc_max_depth,omitempty"`
+	NumberedHeadings *bool   `yaml:"numbered_headings,omitempty"`
+	EmojiShortcodes  *bool   `yaml:"emoji_shortcodes,omitempty"`
+	Typographer      *bool   `yaml:"typographer,omitempty"`
+	ObsidianCompat   *bool   `yaml:"obsidian_compat,omitempty"`
+	MinifyHTML       *bool   `yaml:"minify_html,omitempty"`
+	HTMLExtraHead    *string `yaml:"html_extra_head,omitempty"`
+	HTMLExtraBody    *string `yaml:"html_extra_body,omitempty"`
+
+	// Sidebar
+	SidebarMenutreeMode       *string `yaml:"sidebar_menutree_mode,omitempty"`
+	SidebarMenutreeIgnoreCase *bool   `yaml:"sidebar_menutree_ignore_case,omitempty"`
+	SidebarMenutreeMaxdepth   *string `yaml:"sidebar_menutree_maxdepth,omitempty"`
+	SidebarMenutreeFocus      *string `yaml:"sidebar_menutree_focus,omitempty"`
+	SidebarCustomMenu         *string `yaml:"sidebar_custom_menu,omitempty"`
+	SidebarShortcuts          *string `yaml:"sidebar_shortcuts,omitempty"`
+	SidebarRecentPages        *int    `yaml:"sidebar_recent_pages,omitempty"`
+
+	// Mail
+	MailDefaultSender *string `yaml:"mail_default_sender,omitempty"`
+	MailServer        *string `yaml:"mail_server,omitempty"`
+	MailPort          *int    `yaml:"mail_port,omitempty"`
+	MailUsername      *string `yaml:"mail_username,omitempty"`
+	MailPassword      *string `yaml:"mail_password,omitempty"`
+	MailUseTLS        *bool   `yaml:"mail_use_tls,omitempty"`
+	MailUseSSL        *bool   `yaml:"mail_use_ssl,omitempty"`
+
+	// Git
+	GitWebServer         *bool   `yaml:"git_web_server,omitempty"`
+	GitRemotePushEnabled *bool   `yaml:"git_remote_push_enabled,omitempty"`
+	GitRemotePullEnabled *bool   `yaml:"git_remote_pull_enabled,omitempty"`
+	GitSlowOpMS          *int    `yaml:"git_slow_op_ms,omitempty"`
+	GitBinary            *string `yaml:"git_binary,omitempty"`
+	GitMaintenanceHours  *int    `yaml:"git_maintenance_hours,omitempty"`
+	GitReadTimeoutMS     *int    `yaml:"git_read_timeout_ms,omitempty"`
+	GitHistoryTimeoutMS  *int    `yaml:"git_history_timeout_ms,omitempty"`
+
+	// Issues
+	IssueTags       *string `yaml:"issue_tags,omitempty"`
+	IssueCategories *string `yaml:"issue_categories,omitempty"`
+
+	// Operations
+	RobotsTxt              *string `yaml:"robots_txt,omitempty"`
+	MaxFormMemorySize      *int64  `yaml:"max_form_memory_size,omitempty"`
+	AttachmentMemoryLimit  *int64  `yaml:"attachment_memory_limit,omitempty"`
+	HealthMinFreeMB        *int64  `yaml:"health_min_free_mb,omitempty"`
+	DraftTTLDays           *int    `yaml:"draft_ttl_days,omitempty"`
+	StalePageMonths        *int    `yaml:"stale_page_months,omitempty"`
+	SpellcheckCommand      *string `yaml:"spellcheck_command,omitempty"`
+	ExternalLinkCheckHours *int    `yaml:"external_link_check_hours,omitempty"`
+	Offline                *bool   `yaml:"offline,omitempty"`
+	MetricsEnabled         *bool   `yaml:"metrics_enabled,omitempty"`
+	MetricsToken           *string `yaml:"metrics_token,omitempty"`
+	WebDAVEnabled          *bool   `yaml:"webdav_enabled,omitempty"`
+
+	// Computational pages and export
+	QuartoEnabled     *bool   `yaml:"computational_pages_enabled,omitempty"`
+	ExportEnabled     *bool   `yaml:"export_enabled,omitempty"`
+	QuartoPath        *string `yaml:"quarto_path,omitempty"`
+	RenderTimeoutSecs *int    `yaml:"render_timeout_seconds,omitempty"`
+	RenderConcurrency *int    `yaml:"render_concurrency,omitempty"`
+	RenderCachePath   *string `yaml:"render_cache_path,omitempty"`
+	RenderPython      *string `yaml:"render_python,omitempty"`
+	RenderR           *string `yaml:"render_r,omitempty"`
+	OJSLibsDir        *string `yaml:"ojs_libs_dir,omitempty"`
+	PandocEnabled     *bool   `yaml:"pandoc_enabled,omitempty"`
+	PandocPath        *string `yaml:"pandoc_path,omitempty"`
+	PandocPDFEngine   *string `yaml:"pandoc_pdf_engine,omitempty"`
+
+	// Gemini
+	GeminiPort     *int    `yaml:"gemini_port,omitempty"`
+	GeminiHostname *string `yaml:"gemini_hostname,omitempty"`
+	GeminiCertFile *string `yaml:"gemini_cert_file,omitempty"`
+	GeminiKeyFile  *string `yaml:"gemini_key_file,omitempty"`
+	GeminiAccess   *string `yaml:"gemini_access,omitempty"`
 
 	// Logging
-	LogLevel  *string `yaml:"log_level"`
-	LogFormat *string `yaml:"log_format"`
+	LogLevel  *string `yaml:"log_level,omitempty"`
+	LogFormat *string `yaml:"log_format,omitempty"`
+
+	// Wikis hosted by a multi-wiki server (YAML only)
+	Wikis []WikiEntry `yaml:"wikis,omitempty"`
 }
 
-// LoadFromFile reads and parses a YAML configuration file.
+// LoadFromFile reads and parses a configuration file: TOML if the name ends
+// in .toml, YAML otherwise. Unknown keys and values of the wrong type are
+// errors, so a typo cannot silently leave a setting at its default.
 func LoadFromFile(path string) (*FileConfig, error) {
 	data, err := os.ReadFile(path)
 	if err != nil {
@@ -49,13 +190,65 @@ func LoadFromFile(path string) (*FileConfig, error) {
 	}
 
 	var fc FileConfig
-	if err := yaml.Unmarshal(data, &fc); err != nil {
+	if strings.EqualFold(filepath.Ext(path), ".toml") {
+		err = decodeTOML(data, &fc)
+	} else {
+		dec := yaml.NewDecoder(bytes.NewReader(data))
+		dec.KnownFields(true)
+		if err = dec.Decode(&fc); errors.Is(err, io.EOF) {
+			err = nil
+		}
+	}
+	if err != nil {
 		return nil, fmt.Errorf("parsing config file: %w", err)
 	}
 
 	return &fc, nil
 }
 
+// MaskSecrets replaces the values of secret settings that are set with a
+// placeholder, for printing the configuration, including those of the wikis.
+func (fc *FileConfig) MaskSecrets() {
+	for _, p := range []**string{&fc.SecretKey, &fc.MailPassword, &fc.MetricsToken} {
+		if *p != nil && **p != "" {
+			*p = ptr("********")
+		}
+	}
+	// A PostgreSQL URI may carry a password.
+	for _, p := range []**string{&fc.DatabaseURI, &fc.UsersDatabaseURI} {
+		if *p == nil {
+			continue
+		}
+		if u, err := url.Parse(**p); err == nil && u.User != nil {
+			*p = ptr(u.Redacted())
+		}
+	}
+	if fc.Wikis != nil {
+		// The entries may be shared with a Config.
+		fc.Wikis = append([]WikiEntry(nil), fc.Wikis...)
+		for i := range fc.Wikis {
+			fc.Wikis[i].Settings.MaskSecrets()
+		}
+	}
+}
+
+// Encode writes fc as a YAML or TOML file, leaving out unset keys.
+func (fc *FileConfig) Encode(w io.Writer, format string) error {
+	switch format {
+	case "yaml":
+		enc := yaml.NewEncoder(w)
+		enc.SetIndent(2)
+		if err := enc.Encode(fc); err != nil {
+			return err
+		}
+		return enc.Close()
+	case "toml":
+		return encodeTOML(w, fc)
+	default:
+		return fmt.Errorf("unknown config format %q, want yaml or toml", format)
+	}
+}
+
 // applyTo applies non-nil file config values onto a Config.
 func (fc *FileConfig) applyTo(cfg *Config) {
 	if fc.Port != nil {
@@ -73,9 +266,30 @@ func (fc *FileConfig) applyTo(cfg *Config) {
 	if fc.Repository != nil {
 		cfg.Repository = *fc.Repository
 	}
+	if fc.StorageBackend != nil {
+		cfg.StorageBackend = *fc.StorageBackend
+	}
 	if fc.DatabaseURI != nil {
 		cfg.DatabaseURI = *fc.DatabaseURI
 	}
+	if fc.UsersDatabaseURI != nil {
+		cfg.UsersDatabaseURI = *fc.UsersDatabaseURI
+	}
+	if fc.ClusterEnabled != nil {
+		cfg.ClusterEnabled = *fc.ClusterEnabled
+	}
+	if fc.InstanceID != nil {
+		cfg.InstanceID = *fc.InstanceID
+	}
+	if fc.EncryptionKeyCommand != nil {
+		cfg.EncryptionKeyCommand = *fc.EncryptionKeyCommand
+	}
+	if fc.EncryptAttachments != nil {
+		cfg.EncryptAttachments = *fc.EncryptAttachments
+	}
+	if fc.EncryptDatabase != nil {
+		cfg.EncryptDatabase = *fc.EncryptDatabase
+	}
 	if fc.AuthMethod != nil {
 		cfg.AuthMethod = *fc.AuthMethod
 	}
@@ -89,6 +303,39 @@ func (fc *FileConfig) applyTo(cfg *Config) {
 	if fc.AutoApproval != nil {
 		cfg.AutoApproval = *fc.AutoApproval
 	}
+	if fc.CookieSameSite != nil {
+		cfg.CookieSameSite = *fc.CookieSameSite
+	}
+	if fc.CookieDomain != nil {
+		cfg.CookieDomain = *fc.CookieDomain
+	}
+	if fc.CookiePath != nil {
+		cfg.CookiePath = *fc.CookiePath
+	}
+	if fc.CookieHostPrefix != nil {
+		cfg.CookieHostPrefix = *fc.CookieHostPrefix
+	}
+	if fc.AuthHeadersUsername != nil {
+		cfg.AuthHeadersUsername = *fc.AuthHeadersUsername
+	}
+	if fc.AuthHeadersEmail != nil {
+		cfg.AuthHeadersEmail = *fc.AuthHeadersEmail
+	}
+	if fc.AuthHeadersPermissions != nil {
+		cfg.AuthHeadersPermissions = *fc.AuthHeadersPermissions
+	}
+	if fc.EmailNeedsConfirmation != nil {
+		cfg.EmailNeedsConfirmation = *fc.EmailNeedsConfirmation
+	}
+	if fc.NotifyAdminsOnRegister != nil {
+		cfg.NotifyAdminsOnRegister = *fc.NotifyAdminsOnRegister
+	}
+	if fc.NotifyUserOnApproval != nil {
+		cfg.NotifyUserOnApproval = *fc.NotifyUserOnApproval
+	}
+	if fc.Gravatar != nil {
+		cfg.Gravatar = *fc.Gravatar
+	}
 	if fc.ReadAccess != nil {
 		cfg.ReadAccess = *fc.ReadAccess
 	}
@@ -98,6 +345,27 @@ func (fc *FileConfig) applyTo(cfg *Config) {
 	if fc.AttachmentAccess != nil {
 		cfg.AttachmentAccess = *fc.AttachmentAccess
 	}
+	if fc.RateLimitWrites != nil {
+		cfg.RateLimitWrites = *fc.RateLimitWrites
+	}
+	if fc.RateLimitIssues != nil {
+		cfg.RateLimitIssues = *fc.RateLimitIssues
+	}
+	if fc.RateLimitSearch != nil {
+		cfg.RateLimitSearch = *fc.RateLimitSearch
+	}
+	if fc.TrustedProxies != nil {
+		cfg.TrustedProxies = *fc.TrustedProxies
+	}
+	if fc.SpamHoneypot != nil {
+		cfg.SpamHoneypot = *fc.SpamHoneypot
+	}
+	if fc.SpamBlocklistFile != nil {
+		cfg.SpamBlocklistFile = *fc.SpamBlocklistFile
+	}
+	if fc.ReviewEdits != nil {
+		cfg.ReviewEdits = *fc.ReviewEdits
+	}
 	if fc.SiteName != nil {
 		cfg.SiteName = *fc.SiteName
 	}
@@ -107,12 +375,383 @@ func (fc *FileConfig) applyTo(cfg *Config) {
 	if fc.SiteLang != nil {
 		cfg.SiteLang = *fc.SiteLang
 	}
+	if fc.SearchLocale != nil {
+		cfg.SearchLocale = *fc.SearchLocale
+	}
+	if fc.SiteDescription != nil {
+		cfg.SiteDescription = *fc.SiteDescription
+	}
+	if fc.SiteLogo != nil {
+		cfg.SiteLogo = *fc.SiteLogo
+	}
+	if fc.SiteIcon != nil {
+		cfg.SiteIcon = *fc.SiteIcon
+	}
+	if fc.HideLogo != nil {
+		cfg.HideLogo = *fc.HideLogo
+	}
+	if fc.DisableFeeds != nil {
+		cfg.DisableFeeds = *fc.DisableFeeds
+	}
+	if fc.DisableSitemap != nil {
+		cfg.DisableSitemap = *fc.DisableSitemap
+	}
+	if fc.RobotsDisallow != nil {
+		cfg.RobotsDisallow = *fc.RobotsDisallow
+	}
+	if fc.ViewCounts != nil {
+		cfg.ViewCounts = *fc.ViewCounts
+	}
+	if fc.Theme != nil {
+		cfg.Theme = *fc.Theme
+	}
+	if fc.ThemesDir != nil {
+		cfg.ThemesDir = *fc.ThemesDir
+	}
+	if fc.EditConflictMode != nil {
+		cfg.EditConflictMode = *fc.EditConflictMode
+	}
+	if fc.AnonymousAttribution != nil {
+		cfg.AnonymousAttribution = *fc.AnonymousAttribution
+	}
+	if fc.RetainPageNameCase != nil {
+		cfg.RetainPageNameCase = *fc.RetainPageNameCase
+	}
+	if fc.TreatUnderscoreAsSpaceForTitles != nil {
+		cfg.TreatUnderscoreAsSpaceForTitles = *fc.TreatUnderscoreAsSpaceForTitles
+	}
+	if fc.CommitMessage != nil {
+		cfg.CommitMessage = *fc.CommitMessage
+	}
+	if fc.WikilinkStyle != nil {
+		cfg.WikilinkStyle = *fc.WikilinkStyle
+	}
+	if fc.TOCMaxDepth != nil {
+		cfg.TOCMaxDepth = *fc.TOCMaxDepth
+	}
+	if fc.NumberedHeadings != nil {
+		cfg.NumberedHeadings = *fc.NumberedHeadings
+	}
+	if fc.EmojiShortcodes != nil {
+		cfg.EmojiShortcodes = *fc.EmojiShortcodes
+	}
+	if fc.Typographer != nil {
+		cfg.Typographer = *fc.Typographer
+	}
+	if fc.ObsidianCompat != nil {
+		cfg.ObsidianCompat = *fc.ObsidianCompat
+	}
+	if fc.MinifyHTML != nil {
+		cfg.MinifyHTML = *fc.MinifyHTML
+	}
+	if fc.HTMLExtraHead != nil {
+		cfg.HTMLExtraHead = *fc.HTMLExtraHead
+	}
+	if fc.HTMLExtraBody != nil {
+		cfg.HTMLExtraBody = *fc.HTMLExtraBody
+	}
+	if fc.SidebarMenutreeMode != nil {
+		cfg.SidebarMenutreeMode = *fc.SidebarMenutreeMode
+	}
+	if fc.SidebarMenutreeIgnoreCase != nil {
+		cfg.SidebarMenutreeIgnoreCase = *fc.SidebarMenutreeIgnoreCase
+	}
+	if fc.SidebarMenutreeMaxdepth != nil {
+		cfg.SidebarMenutreeMaxdepth = *fc.SidebarMenutreeMaxdepth
+	}
+	if fc.SidebarMenutreeFocus != nil {
+		cfg.SidebarMenutreeFocus = *fc.SidebarMenutreeFocus
+	}
+	if fc.SidebarCustomMenu != nil {
+		cfg.SidebarCustomMenu = *fc.SidebarCustomMenu
+	}
+	if fc.SidebarShortcuts != nil {
+		cfg.SidebarShortcuts = *fc.SidebarShortcuts
+	}
+	if fc.SidebarRecentPages != nil {
+		cfg.SidebarRecentPages = *fc.SidebarRecentPages
+	}
+	if fc.MailDefaultSender != nil {
+		cfg.MailDefaultSender = *fc.MailDefaultSender
+	}
+	if fc.MailServer != nil {
+		cfg.MailServer = *fc.MailServer
+	}
+	if fc.MailPort != nil {
+		cfg.MailPort = *fc.MailPort
+	}
+	if fc.MailUsername != nil {
+		cfg.MailUsername = *fc.MailUsername
+	}
+	if fc.MailPassword != nil {
+		cfg.MailPassword = *fc.MailPassword
+	}
+	if fc.MailUseTLS != nil {
+		cfg.MailUseTLS = *fc.MailUseTLS
+	}
+	if fc.MailUseSSL != nil {
+		cfg.MailUseSSL = *fc.MailUseSSL
+	}
+	if fc.GitWebServer != nil {
+		cfg.GitWebServer = *fc.GitWebServer
+	}
+	if fc.GitRemotePushEnabled != nil {
+		cfg.GitRemotePushEnabled = *fc.GitRemotePushEnabled
+	}
+	if fc.GitRemotePullEnabled != nil {
+		cfg.GitRemotePullEnabled = *fc.GitRemotePullEnabled
+	}
+	if fc.GitSlowOpMS != nil {
+		cfg.GitSlowOpMS = *fc.GitSlowOpMS
+	}
+	if fc.GitBinary != nil {
+		cfg.GitBinary = *fc.GitBinary
+	}
+	if fc.GitMaintenanceHours != nil {
+		cfg.GitMaintenanceHours = *fc.GitMaintenanceHours
+	}
+	if fc.GitReadTimeoutMS != nil {
+		cfg.GitReadTimeoutMS = *fc.GitReadTimeoutMS
+	}
+	if fc.GitHistoryTimeoutMS != nil {
+		cfg.GitHistoryTimeoutMS = *fc.GitHistoryTimeoutMS
+	}
+	if fc.IssueTags != nil {
+		cfg.IssueTags = *fc.IssueTags
+	}
+	if fc.IssueCategories != nil {
+		cfg.IssueCategories = *fc.IssueCategories
+	}
+	if fc.RobotsTxt != nil {
+		cfg.RobotsTxt = *fc.RobotsTxt
+	}
+	if fc.MaxFormMemorySize != nil {
+		cfg.MaxFormMemorySize = *fc.MaxFormMemorySize
+	}
+	if fc.AttachmentMemoryLimit != nil {
+		cfg.AttachmentMemoryLimit = *fc.AttachmentMemoryLimit
+	}
+	if fc.HealthMinFreeMB != nil {
+		cfg.HealthMinFreeMB = *fc.HealthMinFreeMB
+	}
+	if fc.DraftTTLDays != nil {
+		cfg.DraftTTLDays = *fc.DraftTTLDays
+	}
+	if fc.StalePageMonths != nil {
+		cfg.StalePageMonths = *fc.StalePageMonths
+	}
+	if fc.SpellcheckCommand != nil {
+		cfg.SpellcheckCommand = *fc.SpellcheckCommand
+	}
+	if fc.ExternalLinkCheckHours != nil {
+		cfg.ExternalLinkCheckHours = *fc.ExternalLinkCheckHours
+	}
+	if fc.Offline != nil {
+		cfg.Offline = *fc.Offline
+	}
+	if fc.MetricsEnabled != nil {
+		cfg.MetricsEnabled = *fc.MetricsEnabled
+	}
+	if fc.MetricsToken != nil {
+		cfg.MetricsToken = *fc.MetricsToken
+	}
+	if fc.WebDAVEnabled != nil {
+		cfg.WebDAVEnabled = *fc.WebDAVEnabled
+	}
+	if fc.QuartoEnabled != nil {
+		cfg.QuartoEnabled = *fc.QuartoEnabled
+	}
+	if fc.ExportEnabled != nil {
+		cfg.ExportEnabled = *fc.ExportEnabled
+	}
+	if fc.QuartoPath != nil {
+		cfg.QuartoPath = *fc.QuartoPath
+	}
+	if fc.RenderTimeoutSecs != nil {
+		cfg.RenderTimeoutSecs = *fc.RenderTimeoutSecs
+	}
+	if fc.RenderConcurrency != nil {
+		cfg.RenderConcurrency = *fc.RenderConcurrency
+	}
+	if fc.RenderCachePath != nil {
+		cfg.RenderCachePath = *fc.RenderCachePath
+	}
+	if fc.RenderPython != nil {
+		cfg.RenderPython = *fc.RenderPython
+	}
+	if fc.RenderR != nil {
+		cfg.RenderR = *fc.RenderR
+	}
+	if fc.OJSLibsDir != nil {
+		cfg.OJSLibsDir = *fc.OJSLibsDir
+	}
+	if fc.PandocEnabled != nil {
+		cfg.PandocEnabled = *fc.PandocEnabled
+	}
+	if fc.PandocPath != nil {
+		cfg.PandocPath = *fc.PandocPath
+	}
+	if fc.PandocPDFEngine != nil {
+		cfg.PandocPDFEngine = *fc.PandocPDFEngine
+	}
+	if fc.GeminiPort != nil {
+		cfg.GeminiPort = *fc.GeminiPort
+	}
+	if fc.GeminiHostname != nil {
+		cfg.GeminiHostname = *fc.GeminiHostname
+	}
+	if fc.GeminiCertFile != nil {
+		cfg.GeminiCertFile = *fc.GeminiCertFile
+	}
+	if fc.GeminiKeyFile != nil {
+		cfg.GeminiKeyFile = *fc.GeminiKeyFile
+	}
+	if fc.GeminiAccess != nil {
+		cfg.GeminiAccess = *fc.GeminiAccess
+	}
 	if fc.LogLevel != nil {
 		cfg.LogLevel = *fc.LogLevel
 	}
 	if fc.LogFormat != nil {
 		cfg.LogFormat = *fc.LogFormat
 	}
+	if fc.Wikis != nil {
+		cfg.Wikis = fc.Wikis
+	}
+}
+
+// FromConfig returns the file form of cfg, with every key set. It is the
+// inverse of loading a file: writing it out and loading it back yields the
+// same settings, except those only read from the environment.
+func FromConfig(cfg *Config) *FileConfig {
+	return &FileConfig{
+		Port:                            ptr(cfg.Port),
+		Host:                            ptr(cfg.Host),
+		SiteURL:                         ptr(cfg.SiteURL),
+		DevMode:                         ptr(cfg.DevMode),
+		Repository:                      ptr(cfg.Repository),
+		StorageBackend:                  ptr(cfg.StorageBackend),
+		DatabaseURI:                     ptr(cfg.DatabaseURI),
+		UsersDatabaseURI:                ptr(cfg.UsersDatabaseURI),
+		ClusterEnabled:                  ptr(cfg.ClusterEnabled),
+		InstanceID:                      ptr(cfg.InstanceID),
+		EncryptionKeyCommand:            ptr(cfg.EncryptionKeyCommand),
+		EncryptAttachments:              ptr(cfg.EncryptAttachments),
+		EncryptDatabase:                 ptr(cfg.EncryptDatabase),
+		AuthMethod:                      ptr(cfg.AuthMethod),
+		DisableRegistration:             ptr(!cfg.DisableRegistration),
+		SecretKey:                       ptr(cfg.SecretKey),
+		AutoApproval:                    ptr(cfg.AutoApproval),
+		CookieSameSite:                  ptr(cfg.CookieSameSite),
+		CookieDomain:                    ptr(cfg.CookieDomain),
+		CookiePath:                      ptr(cfg.CookiePath),
+		CookieHostPrefix:                ptr(cfg.CookieHostPrefix),
+		AuthHeadersUsername:             ptr(cfg.AuthHeadersUsername),
+		AuthHeadersEmail:                ptr(cfg.AuthHeadersEmail),
+		AuthHeadersPermissions:          ptr(cfg.AuthHeadersPermissions),
+		EmailNeedsConfirmation:          ptr(cfg.EmailNeedsConfirmation),
+		NotifyAdminsOnRegister:          ptr(cfg.NotifyAdminsOnRegister),
+		NotifyUserOnApproval:            ptr(cfg.NotifyUserOnApproval),
+		Gravatar:                        ptr(cfg.Gravatar),
+		ReadAccess:                      ptr(cfg.ReadAccess),
+		WriteAccess:                     ptr(cfg.WriteAccess),
+		AttachmentAccess:                ptr(cfg.AttachmentAccess),
+		RateLimitWrites:                 ptr(cfg.RateLimitWrites),
+		RateLimitIssues:                 ptr(cfg.RateLimitIssues),
+		RateLimitSearch:                 ptr(cfg.RateLimitSearch),
+		TrustedProxies:                  ptr(cfg.TrustedProxies),
+		SpamHoneypot:                    ptr(cfg.SpamHoneypot),
+		SpamBlocklistFile:               ptr(cfg.SpamBlocklistFile),
+		ReviewEdits:                     ptr(cfg.ReviewEdits),
+		SiteName:                        ptr(cfg.SiteName),
+		HomePage:                        ptr(cfg.HomePage),
+		SiteLang:                        ptr(cfg.SiteLang),
+		SearchLocale:                    ptr(cfg.SearchLocale),
+		SiteDescription:                 ptr(cfg.SiteDescription),
+		SiteLogo:                        ptr(cfg.SiteLogo),
+		SiteIcon:                        ptr(cfg.SiteIcon),
+		HideLogo:                        ptr(cfg.HideLogo),
+		DisableFeeds:                    ptr(cfg.DisableFeeds),
+		DisableSitemap:                  ptr(cfg.DisableSitemap),
+		RobotsDisallow:                  ptr(cfg.RobotsDisallow),
+		ViewCounts:                      ptr(cfg.ViewCounts),
+		Theme:                           ptr(cfg.Theme),
+		ThemesDir:                       ptr(cfg.ThemesDir),
+		EditConflictMode:                ptr(cfg.EditConflictMode),
+		AnonymousAttribution:            ptr(cfg.AnonymousAttribution),
+		RetainPageNameCase:              ptr(cfg.RetainPageNameCase),
+		TreatUnderscoreAsSpaceForTitles: ptr(cfg.TreatUnderscoreAsSpaceForTitles),
+		CommitMessage:                   ptr(cfg.CommitMessage),
+		WikilinkStyle:                   ptr(cfg.WikilinkStyle),
+		TOCMaxDepth:                     ptr(cfg.TOCMaxDepth),
+		NumberedHeadings:                ptr(cfg.NumberedHeadings),
+		EmojiShortcodes:                 ptr(cfg.EmojiShortcodes),
+		Typographer:                     ptr(cfg.Typographer),
+		ObsidianCompat:                  ptr(cfg.ObsidianCompat),
+		MinifyHTML:                      ptr(cfg.MinifyHTML),
+		HTMLExtraHead:                   ptr(cfg.HTMLExtraHead),
+		HTMLExtraBody:                   ptr(cfg.HTMLExtraBody),
+		SidebarMenutreeMode:             ptr(cfg.SidebarMenutreeMode),
+		SidebarMenutreeIgnoreCase:       ptr(cfg.SidebarMenutreeIgnoreCase),
+		SidebarMenutreeMaxdepth:         ptr(cfg.SidebarMenutreeMaxdepth),
+		SidebarMenutreeFocus:            ptr(cfg.SidebarMenutreeFocus),
+		SidebarCustomMenu:               ptr(cfg.SidebarCustomMenu),
+		SidebarShortcuts:                ptr(cfg.SidebarShortcuts),
+		SidebarRecentPages:              ptr(cfg.SidebarRecentPages),
+		MailDefaultSender:               ptr(cfg.MailDefaultSender),
+		MailServer:                      ptr(cfg.MailServer),
+		MailPort:                        ptr(cfg.MailPort),
+		MailUsername:                    ptr(cfg.MailUsername),
+		MailPassword:                    ptr(cfg.MailPassword),
+		MailUseTLS:                      ptr(cfg.MailUseTLS),
+		MailUseSSL:                      ptr(cfg.MailUseSSL),
+		GitWebServer:                    ptr(cfg.GitWebServer),
+		GitRemotePushEnabled:            ptr(cfg.GitRemotePushEnabled),
+		GitRemotePullEnabled:            ptr(cfg.GitRemotePullEnabled),
+		GitSlowOpMS:                     ptr(cfg.GitSlowOpMS),
+		GitBinary:                       ptr(cfg.GitBinary),
+		GitMaintenanceHours:             ptr(cfg.GitMaintenanceHours),
+		GitReadTimeoutMS:                ptr(cfg.GitReadTimeoutMS),
+		GitHistoryTimeoutMS:             ptr(cfg.GitHistoryTimeoutMS),
+		IssueTags:                       ptr(cfg.IssueTags),
+		IssueCategories:                 ptr(cfg.IssueCategories),
+		RobotsTxt:                       ptr(cfg.RobotsTxt),
+		MaxFormMemorySize:               ptr(cfg.MaxFormMemorySize),
+		AttachmentMemoryLimit:           ptr(cfg.AttachmentMemoryLimit),
+		HealthMinFreeMB:                 ptr(cfg.HealthMinFreeMB),
+		DraftTTLDays:                    ptr(cfg.DraftTTLDays),
+		StalePageMonths:                 ptr(cfg.StalePageMonths),
+		SpellcheckCommand:               ptr(cfg.SpellcheckCommand),
+		ExternalLinkCheckHours:          ptr(cfg.ExternalLinkCheckHours),
+		Offline:                         ptr(cfg.Offline),
+		MetricsEnabled:                  ptr(cfg.MetricsEnabled),
+		MetricsToken:                    ptr(cfg.MetricsToken),
+		WebDAVEnabled:                   ptr(cfg.WebDAVEnabled),
+		QuartoEnabled:                   ptr(cfg.QuartoEnabled),
+		ExportEnabled:                   ptr(cfg.ExportEnabled),
+		QuartoPath:                      ptr(cfg.QuartoPath),
+		RenderTimeoutSecs:               ptr(cfg.RenderTimeoutSecs),
+		RenderConcurrency:               ptr(cfg.RenderConcurrency),
+		RenderCachePath:                 ptr(cfg.RenderCachePath),
+		RenderPython:                    ptr(cfg.RenderPython),
+		RenderR:                         ptr(cfg.RenderR),
+		OJSLibsDir:                      ptr(cfg.OJSLibsDir),
+		PandocEnabled:                   ptr(cfg.PandocEnabled),
+		PandocPath:                      ptr(cfg.PandocPath),
+		PandocPDFEngine:                 ptr(cfg.PandocPDFEngine),
+		GeminiPort:                      ptr(cfg.GeminiPort),
+		GeminiHostname:                  ptr(cfg.GeminiHostname),
+		GeminiCertFile:                  ptr(cfg.GeminiCertFile),
+		GeminiKeyFile:                   ptr(cfg.GeminiKeyFile),
+		GeminiAccess:                    ptr(cfg.GeminiAccess),
+		LogLevel:                        ptr(cfg.LogLevel),
+		LogFormat:                       ptr(cfg.LogFormat),
+		Wikis:                           cfg.Wikis,
+	}
+}
+
+func ptr[T any](v T) *T {
+	return &v
 }
 
 // LoadWithFile creates a Config by applying defaults, then file config, then env vars.
@@ -127,5 +766,10 @@ func LoadWithFile(filePath string) (*Config, error) {
 	fc.applyTo(cfg)
 
 	cfg.LoadFromEnv()
+	// Without COOKIE_HOST_PREFIX, LoadFromEnv derives the prefix from the
+	// cookie settings; one set in the file takes precedence over that.
+	if fc.CookieHostPrefix != nil && os.Getenv("COOKIE_HOST_PREFIX") == "" {
+		cfg.CookieHostPrefix = *fc.CookieHostPrefix
+	}
 	return cfg, nil
 }
@@ -0,0 +1,75 @@
+package config
+
+import "reflect"
+
+// restartRequired lists the settings bound to resources the process creates
+// once at startup (the listener, repository, database, encryption keys, the
+// render toolchain, the schedule of the background jobs), which a reload
+// cannot change.
+var restartRequired = map[string]bool{
+	"Host":                   true,
+	"Port":                   true,
+	"Testing":                true,
+	"DevMode":                true,
+	"Repository":             true,
+	"StorageBackend":         true,
+	"SecretKey":              true,
+	"DatabaseURI":            true,
+	"UsersDatabaseURI":       true,
+	"ClusterEnabled":         true,
+	"InstanceID":             true,
+	"EncryptionKey":          true,
+	"EncryptionKeyCommand":   true,
+	"EncryptAttachments":     true,
+	"EncryptDatabase":        true,
+	"GitSlowOpMS":            true,
+	"GitBinary":              true,
+	"GitMaintenanceHours":    true,
+	"DraftTTLDays":           true,
+	"ExternalLinkCheckHours": true,
+	"GitReadTimeoutMS":       true,
+	"GitHistoryTimeoutMS":    true,
+	"QuartoEnabled":          true,
+	"ExportEnabled":          true,
+	"QuartoPath":             true,
+	"RenderTimeoutSecs":      true,
+	"RenderConcurrency":      true,
+	"RenderCachePath":        true,
+	"RenderPython":           true,
+	"RenderR":                true,
+	"OJSLibsDir":             true,
+	"PandocEnabled":          true,
+	"PandocPath":             true,
+	"PandocPDFEngine":        true,
+	"WebDAVEnabled":          true,
+	"GeminiPort":             true,
+	"GeminiHostname":         true,
+	"GeminiCertFile":         true,
+	"GeminiKeyFile":          true,
+	"Wikis":                  true,
+}
+
+// PrepareReload compares a freshly loaded configuration, next, with the
+// running one. Settings that can change at runtime are compared with
+// running; settings that need a restart are compared with startup, the
+// configuration as loaded before command-line flags and dev mode adjusted
+// it, and are reset in next to their running values so next describes what
+// the process can actually do. It returns the names of the changed settings
+// that take effect and of those that will not until a restart.
+func PrepareReload(startup, running, next *Config) (applied, needRestart []string) {
+	base := reflect.ValueOf(startup).Elem()
+	cur := reflect.ValueOf(running).Elem()
+	nxt := reflect.ValueOf(next).Elem()
+	for i := 0; i < cur.NumField(); i++ {
+		name := cur.Type().Field(i).Name
+		if restartRequired[name] {
+			if !reflect.DeepEqual(base.Field(i).Interface(), nxt.Field(i).Interface()) {
+				needRestart = append(needRestart, name)
+			}
+			nxt.Field(i).Set(cur.Field(i))
+		} else if !reflect.DeepEqual(cur.Field(i).Interface(), nxt.Field(i).Interface()) {
+			applied = append(applied, name)
+		}
+	}
+	return applied, needRestart
+}
@@ -0,0 +1,424 @@
+package config
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// The config file is a flat list of settings, so TOML support covers the
+// part of the language that such a file uses: top-level key = value pairs
+// whose values are strings (basic, literal, and multi-line), integers, or
+// booleans, and comments. Tables, arrays, floats, and dates are rejected, so
+// the wikis of a multi-wiki server need a YAML file.
+
+// fileKeys maps each file key to the index of its FileConfig field.
+func fileKeys() map[string]int {
+	t := reflect.TypeOf(FileConfig{})
+	keys := make(map[string]int, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		key, _, _ := strings.Cut(t.Field(i).Tag.Get("yaml"), ",")
+		keys[key] = i
+	}
+	return keys
+}
+
+// decodeTOML parses a TOML config file into fc.
+func decodeTOML(data []byte, fc *FileConfig) error {
+	if !utf8.Valid(data) {
+		return fmt.Errorf("TOML file is not valid UTF-8")
+	}
+	keys := fileKeys()
+	v := reflect.ValueOf(fc).Elem()
+	seen := make(map[string]bool)
+	p := &tomlParser{src: string(data), line: 1}
+	for {
+		p.skipSpace(true)
+		if p.eof() {
+			return nil
+		}
+		line := p.line
+		if p.peek() == '[' {
+			return fmt.Errorf("line %d: tables are not supported, settings are top-level keys", line)
+		}
+		key, err := p.key()
+		if err != nil {
+			return err
+		}
+		p.skipSpace(false)
+		if p.eof() || p.peek() != '=' {
+			return fmt.Errorf("line %d: expected = after %q", line, key)
+		}
+		p.pos++
+		p.skipSpace(false)
+		value, err := p.value()
+		if err != nil {
+			return err
+		}
+		if err := p.endOfLine(); err != nil {
+			return err
+		}
+
+		i, ok := keys[key]
+		if !ok {
+			return fmt.Errorf("line %d: unknown key %q", line, key)
+		}
+		if seen[key] {
+			return fmt.Errorf("line %d: %q is set twice", line, key)
+		}
+		seen[key] = true
+		if err := setField(v.Field(i), value); err != nil {
+			return fmt.Errorf("line %d: %s %w", line, key, err)
+		}
+	}
+}
+
+// setField stores a parsed value in a pointer field of FileConfig.
+func setField(f reflect.Value, value any) error {
+	elem := f.Type().Elem()
+	ptr := reflect.New(elem)
+	switch elem.Kind() {
+	case reflect.String:
+		s, ok := value.(string)
+		if !ok {
+			return fmt.Errorf("must be a string")
+		}
+		ptr.Elem().SetString(s)
+	case reflect.Bool:
+		b, ok := value.(bool)
+		if !ok {
+			return fmt.Errorf("must be true or false")
+		}
+		ptr.Elem().SetBool(b)
+	case reflect.Int, reflect.Int64:
+		n, ok := value.(int64)
+		if !ok {
+			return fmt.Errorf("must be an integer")
+		}
+		if ptr.Elem().OverflowInt(n) {
+			return fmt.Errorf("is out of range")
+		}
+		ptr.Elem().SetInt(n)
+	default:
+		return fmt.Errorf("can only be set in a YAML file")
+	}
+	f.Set(ptr)
+	return nil
+}
+
+type tomlParser struct {
+	src  string
+	pos  int
+	line int
+}
+
+func (p *tomlParser) eof() bool { return p.pos >= len(p.src) }
+
+func (p *tomlParser) peek() byte { return p.src[p.pos] }
+
+// skipSpace skips blanks, and with newlines also line breaks and comments.
+func (p *tomlParser) skipSpace(newlines bool) {
+	for !p.eof() {
+		switch c := p.peek(); {
+		case c == ' ' || c == '\t':
+			p.pos++
+		case newlines && c == '\n':
+			p.pos++
+			p.line++
+		case newlines && c == '\r' && strings.HasPrefix(p.src[p.pos:], "\r\n"):
+			p.pos++
+		case newlines && c == '#':
+			p.skipComment()
+		default:
+			return
+		}
+	}
+}
+
+func (p *tomlParser) skipComment() {
+	if i := strings.IndexByte(p.src[p.pos:], '\n'); i >= 0 {
+		p.pos += i
+	} else {
+		p.pos = len(p.src)
+	}
+}
+
+// endOfLine accepts blanks and a comment up to the end of the line.
+func (p *tomlParser) endOfLine() error {
+	p.skipSpace(false)
+	if !p.eof() && p.peek() == '#' {
+		p.skipComment()
+	}
+	switch {
+	case p.eof(), strings.HasPrefix(p.src[p.pos:], "\n"), strings.HasPrefix(p.src[p.pos:], "\r\n"):
+		return nil
+	}
+	return fmt.Errorf("line %d: unexpected text after the value", p.line)
+}
+
+func (p *tomlParser) key() (string, error) {
+	if p.peek() == '"' || p.peek() == '\'' {
+		return p.quotedKey()
+	}
+	start := p.pos
+	for !p.eof() {
+		c := p.peek()
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_' || c == '-') {
+			break
+		}
+		p.pos++
+	}
+	if p.pos == start {
+		return "", fmt.Errorf("line %d: expected a key", p.line)
+	}
+	if !p.eof() && p.peek() == '.' {
+		return "", fmt.Errorf("line %d: dotted keys are not supported", p.line)
+	}
+	return p.src[start:p.pos], nil
+}
+
+// quotedKey parses a key written as a basic or literal string.
+func (p *tomlParser) quotedKey() (string, error) {
+	v, err := p.value()
+	if err != nil {
+		return "", err
+	}
+	s, ok := v.(string)
+	if !ok {
+		return "", fmt.Errorf("line %d: expected a string", p.line)
+	}
+	return s, nil
+}
+
+// value parses a string, integer, or boolean.
+func (p *tomlParser) value() (any, error) {
+	if p.eof() {
+		return nil, fmt.Errorf("line %d: missing value", p.line)
+	}
+	rest := p.src[p.pos:]
+	switch {
+	case strings.HasPrefix(rest, `"""`):
+		return p.multiline(`"""`, true)
+	case strings.HasPrefix(rest, "'''"):
+		return p.multiline("'''", false)
+	case rest[0] == '"':
+		return p.basicString()
+	case rest[0] == '\'':
+		end := strings.IndexAny(rest[1:], "'\n")
+		if end < 0 || rest[1+end] != '\'' {
+			return nil, fmt.Errorf("line %d: unterminated string", p.line)
+		}
+		p.pos += end + 2
+		return rest[1 : 1+end], nil
+	}
+
+	end := strings.IndexAny(rest, " \t\r\n#")
+	if end < 0 {
+		end = len(rest)
+	}
+	word := rest[:end]
+	p.pos += end
+	switch word {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	}
+	if strings.Contains(word, "__") || strings.HasPrefix(word, "_") || strings.HasSuffix(word, "_") {
+		return nil, fmt.Errorf("line %d: invalid value %q", p.line, word)
+	}
+	n, err := strconv.ParseInt(strings.ReplaceAll(word, "_", ""), 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("line %d: unsupported value %q (want a string, integer, or boolean)", p.line, word)
+	}
+	return n, nil
+}
+
+// basicString parses a "..." string with escapes.
+func (p *tomlParser) basicString() (string, error) {
+	p.pos++
+	var b strings.Builder
+	for {
+		if p.eof() || p.peek() == '\n' {
+			return "", fmt.Errorf("line %d: unterminated string", p.line)
+		}
+		c := p.peek()
+		switch c {
+		case '"':
+			p.pos++
+			return b.String(), nil
+		case '\\':
+			if err := p.escape(&b); err != nil {
+				return "", err
+			}
+		default:
+			b.WriteByte(c)
+			p.pos++
+		}
+	}
+}
+
+// multiline parses a """...""" or ”'...”' string. A newline right after
+// the opening delimiter is dropped, and in basic strings a backslash at the
+// end of a line removes the line break and the blanks that follow it.
+func (p *tomlParser) multiline(delim string, basic bool) (string, error) {
+	p.pos += len(delim)
+	if strings.HasPrefix(p.src[p.pos:], "\r\n") {
+		p.pos += 2
+		p.line++
+	} else if strings.HasPrefix(p.src[p.pos:], "\n") {
+		p.pos++
+		p.line++
+	}
+	start := p.line
+	var b strings.Builder
+	for {
+		if p.eof() {
+			return "", fmt.Errorf("line %d: unterminated string", start)
+		}
+		rest := p.src[p.pos:]
+		if strings.HasPrefix(rest, delim) {
+			// Up to two quotes may end the content right before the delimiter.
+			n := len(delim)
+			for n < len(delim)+2 && n < len(rest) && rest[n] == delim[0] {
+				n++
+			}
+			b.WriteString(rest[:n-len(delim)])
+			p.pos += n
+			return b.String(), nil
+		}
+		c := rest[0]
+		switch {
+		case c == '\n':
+			b.WriteByte(c)
+			p.pos++
+			p.line++
+		case basic && c == '\\':
+			trimmed := strings.TrimLeft(rest[1:], " \t\r")
+			if strings.HasPrefix(trimmed, "\n") {
+				p.pos = len(p.src) - len(trimmed)
+				for !p.eof() && strings.ContainsRune(" \t\r\n", rune(p.peek())) {
+					if p.peek() == '\n' {
+						p.line++
+					}
+					p.pos++
+				}
+				continue
+			}
+			if err := p.escape(&b); err != nil {
+				return "", err
+			}
+		default:
+			b.WriteByte(c)
+			p.pos++
+		}
+	}
+}
+
+// escape decodes the backslash escape at the current position.
+func (p *tomlParser) escape(b *strings.Builder) error {
+	if p.pos+1 >= len(p.src) {
+		return fmt.Errorf("line %d: unterminated string", p.line)
+	}
+	c := p.src[p.pos+1]
+	p.pos += 2
+	switch c {
+	case 'b':
+		b.WriteByte('\b')
+	case 't':
+		b.WriteByte('\t')
+	case 'n':
+		b.WriteByte('\n')
+	case 'f':
+		b.WriteByte('\f')
+	case 'r':
+		b.WriteByte('\r')
+	case 'e':
+		b.WriteByte(0x1b)
+	case '"', '\\':
+		b.WriteByte(c)
+	case 'u', 'U':
+		n := 4
+		if c == 'U' {
+			n = 8
+		}
+		if p.pos+n > len(p.src) {
+			return fmt.Errorf("line %d: invalid escape", p.line)
+		}
+		r, err := strconv.ParseUint(p.src[p.pos:p.pos+n], 16, 32)
+		if err != nil || !utf8.ValidRune(rune(r)) {
+			return fmt.Errorf("line %d: invalid escape \\%c%s", p.line, c, p.src[p.pos:p.pos+n])
+		}
+		b.WriteRune(rune(r))
+		p.pos += n
+	default:
+		return fmt.Errorf("line %d: invalid escape \\%c", p.line, c)
+	}
+	return nil
+}
+
+// encodeTOML writes the set fields of fc as TOML, in field order.
+func encodeTOML(w io.Writer, fc *FileConfig) error {
+	v := reflect.ValueOf(fc).Elem()
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := v.Field(i)
+		key, _, _ := strings.Cut(t.Field(i).Tag.Get("yaml"), ",")
+		if f.Kind() == reflect.Slice {
+			if f.Len() > 0 {
+				return fmt.Errorf("%s can only be written as YAML", key)
+			}
+			continue
+		}
+		if f.IsNil() {
+			continue
+		}
+		var value string
+		switch e := f.Elem(); e.Kind() {
+		case reflect.String:
+			value = tomlQuote(e.String())
+		case reflect.Bool:
+			value = strconv.FormatBool(e.Bool())
+		default:
+			value = strconv.FormatInt(e.Int(), 10)
+		}
+		if _, err := fmt.Fprintf(w, "%s = %s\n", key, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// tomlQuote returns s as a TOML basic string.
+func tomlQuote(s string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for _, r := range s {
+		switch r {
+		case '"', '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case '\b':
+			b.WriteString(`\b`)
+		case '\t':
+			b.WriteString(`\t`)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\f':
+			b.WriteString(`\f`)
+		case '\r':
+			b.WriteString(`\r`)
+		default:
+			if r < 0x20 || r == 0x7f {
+				fmt.Fprintf(&b, `\u%04X`, r)
+			} else {
+				b.WriteRune(r)
+			}
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
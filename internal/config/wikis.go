@@ -0,0 +1,90 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// WikiEntry is one of the wikis a multi-wiki server hosts, as listed under
+// "wikis" in the config file. Settings override those of the rest of the
+// file and of the environment for this wiki; repository_path is required.
+type WikiEntry struct {
+	Name     string     `yaml:"name"`
+	Hosts    []string   `yaml:"hosts"`
+	Settings FileConfig `yaml:"settings,omitempty"`
+}
+
+var wikiNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+// Wiki returns the entry named name.
+func (c *Config) Wiki(name string) (WikiEntry, bool) {
+	for _, w := range c.Wikis {
+		if w.Name == name {
+			return w, true
+		}
+	}
+	return WikiEntry{}, false
+}
+
+// WikiConfig returns the configuration of one hosted wiki: c, with the
+// wiki's settings applied on top.
+func (c *Config) WikiConfig(w WikiEntry) *Config {
+	cfg := *c
+	cfg.Wikis = nil
+	w.Settings.applyTo(&cfg)
+	return &cfg
+}
+
+// validateWikis checks the wiki registry and the configuration of each wiki.
+func (c *Config) validateWikis() error {
+	hosts := make(map[string]string)
+	repos := make(map[string]string)
+	dbs := make(map[string]string)
+	names := make(map[string]bool)
+	for i, w := range c.Wikis {
+		if !wikiNamePattern.MatchString(w.Name) {
+			return fmt.Errorf("wikis[%d]: name must be lowercase letters, digits, - and _, got %q", i, w.Name)
+		}
+		if names[w.Name] {
+			return fmt.Errorf("wiki %s is listed twice", w.Name)
+		}
+		names[w.Name] = true
+		if len(w.Hosts) == 0 {
+			return fmt.Errorf("wiki %s: no hosts", w.Name)
+		}
+		for _, h := range w.Hosts {
+			h = strings.ToLower(h)
+			if h == "" || strings.ContainsAny(h, "/: ") {
+				return fmt.Errorf("wiki %s: invalid host %q, want a host name without port or path", w.Name, h)
+			}
+			if other, ok := hosts[h]; ok {
+				return fmt.Errorf("wiki %s: host %s is already used by wiki %s", w.Name, h, other)
+			}
+			hosts[h] = w.Name
+		}
+		if w.Settings.Wikis != nil {
+			return fmt.Errorf("wiki %s: wikis cannot be nested", w.Name)
+		}
+		if w.Settings.Repository == nil || *w.Settings.Repository == "" {
+			return fmt.Errorf("wiki %s: settings need a repository_path", w.Name)
+		}
+		repo := *w.Settings.Repository
+		if other, ok := repos[repo]; ok {
+			return fmt.Errorf("wiki %s: repository %s is already used by wiki %s", w.Name, repo, other)
+		}
+		repos[repo] = w.Name
+		cfg := c.WikiConfig(w)
+		// Without a database_path each wiki keeps its database in its repository.
+		if uri := cfg.DatabaseURI; uri != "" && uri != "sqlite:///:memory:" {
+			if other, ok := dbs[uri]; ok {
+				return fmt.Errorf("wiki %s: database %s is already used by wiki %s; set database_path per wiki", w.Name, uri, other)
+			}
+			dbs[uri] = w.Name
+		}
+		if err := cfg.Validate(); err != nil {
+			return fmt.Errorf("wiki %s: %w", w.Name, err)
+		}
+	}
+	return nil
+}
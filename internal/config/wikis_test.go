@@ -0,0 +1,114 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadWithFile_Wikis(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"docs", "team"} {
+		if err := os.Mkdir(filepath.Join(dir, name), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	path := filepath.Join(dir, "config.yml")
+	content := `
+site_name: "Hosted"
+session_secret: "0123456789abcdef0123"
+users_database_path: "sqlite:///users.db"
+wikis:
+  - name: docs
+    hosts: [docs.example.com]
+    settings:
+      repository_path: ` + filepath.Join(dir, "docs") + `
+  - name: team
+    hosts: [team.example.com, Team.Example.org]
+    settings:
+      repository_path: ` + filepath.Join(dir, "team") + `
+      site_name: "Team"
+      users_database_path: ""
+`
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := LoadWithFile(path)
+	if err != nil {
+		t.Fatalf("LoadWithFile() error: %v", err)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Validate() error: %v", err)
+	}
+	if len(cfg.Wikis) != 2 {
+		t.Fatalf("len(Wikis) = %d, want 2", len(cfg.Wikis))
+	}
+
+	docs, ok := cfg.Wiki("docs")
+	if !ok {
+		t.Fatal("Wiki(docs) not found")
+	}
+	dc := cfg.WikiConfig(docs)
+	if dc.SiteName != "Hosted" || dc.UsersDatabaseURI != "sqlite:///users.db" || dc.Wikis != nil {
+		t.Errorf("docs config = %q, %q, %d wikis; want the shared settings and no wikis", dc.SiteName, dc.UsersDatabaseURI, len(dc.Wikis))
+	}
+	team, _ := cfg.Wiki("team")
+	tc := cfg.WikiConfig(team)
+	if tc.SiteName != "Team" || tc.UsersDatabaseURI != "" {
+		t.Errorf("team config = %q, %q; want its own settings", tc.SiteName, tc.UsersDatabaseURI)
+	}
+	if cfg.SiteName != "Hosted" {
+		t.Errorf("WikiConfig changed the shared config: SiteName = %q", cfg.SiteName)
+	}
+}
+
+func TestValidate_Wikis(t *testing.T) {
+	dir := t.TempDir()
+	repo := func(name string) *string {
+		p := filepath.Join(dir, name)
+		os.MkdirAll(p, 0o755)
+		return &p
+	}
+	entry := func(name string, hosts ...string) WikiEntry {
+		return WikiEntry{Name: name, Hosts: hosts, Settings: FileConfig{Repository: repo(name)}}
+	}
+	shared := "sqlite:///shared.db"
+
+	tests := []struct {
+		name    string
+		wikis   []WikiEntry
+		dbURI   string
+		wantErr string
+	}{
+		{"valid", []WikiEntry{entry("a", "a.test"), entry("b", "b.test")}, "", ""},
+		{"bad name", []WikiEntry{entry("A b", "a.test")}, "", "name must be"},
+		{"duplicate name", []WikiEntry{entry("a", "a.test"), entry("a", "b.test")}, "", "listed twice"},
+		{"no hosts", []WikiEntry{entry("a")}, "", "no hosts"},
+		{"host with port", []WikiEntry{entry("a", "a.test:8080")}, "", "invalid host"},
+		{"duplicate host", []WikiEntry{entry("a", "a.test"), entry("b", "A.test")}, "", "already used by wiki a"},
+		{"no repository", []WikiEntry{{Name: "a", Hosts: []string{"a.test"}}}, "", "repository_path"},
+		{"shared database", []WikiEntry{entry("a", "a.test"), entry("b", "b.test")}, shared, "database"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := Default()
+			cfg.DevMode = true
+			cfg.Wikis = tt.wikis
+			if tt.dbURI != "" {
+				cfg.DatabaseURI = tt.dbURI
+			}
+			err := cfg.Validate()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("Validate() error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Validate() = %v, want an error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
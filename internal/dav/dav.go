@@ -0,0 +1,392 @@
+// Package dav exposes the wiki repository as a WebDAV file system, so the
+// wiki can be mounted as a drive and its pages edited in any editor.
+//
+// Every change goes through the storage layer: a write, delete, or move is a
+// git commit by the author carried in the request context, and the pages it
+// touches are reindexed for search. Hidden files, including the .git
+// directory, are neither listed nor writable.
+package dav
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"golang.org/x/net/webdav"
+
+	"github.com/sa/gopherwiki/internal/storage"
+	"github.com/sa/gopherwiki/internal/util"
+	"github.com/sa/gopherwiki/internal/wiki"
+)
+
+type contextKey struct{}
+
+// WithAuthor returns a context whose changes are committed as author.
+func WithAuthor(ctx context.Context, author storage.Author) context.Context {
+	return context.WithValue(ctx, contextKey{}, author)
+}
+
+func authorFrom(ctx context.Context) storage.Author {
+	if author, ok := ctx.Value(contextKey{}).(storage.Author); ok {
+		return author
+	}
+	return storage.Author{Name: "Anonymous", Email: ""}
+}
+
+// FileSystem implements webdav.FileSystem on top of the wiki's storage.
+type FileSystem struct {
+	store storage.Storage
+	wiki  *wiki.WikiService
+}
+
+// New returns a FileSystem serving store. Changed pages are reindexed
+// through ws.
+func New(store storage.Storage, ws *wiki.WikiService) *FileSystem {
+	return &FileSystem{store: store, wiki: ws}
+}
+
+var _ webdav.FileSystem = (*FileSystem)(nil)
+
+// repoPath turns a WebDAV name ("/docs/guide.md") into a repository path
+// ("docs/guide.md", or "" for the root). Hidden paths are reported as not
+// existing.
+func repoPath(name string) (string, error) {
+	p := strings.Trim(path.Clean("/"+name), "/")
+	if p == "" {
+		return "", nil
+	}
+	for _, part := range strings.Split(p, "/") {
+		if strings.HasPrefix(part, ".") {
+			return "", os.ErrNotExist
+		}
+	}
+	return p, nil
+}
+
+// Mkdir creates a directory. Git does not track directories, so it stays in
+// the working tree only until a file is written into it.
+func (fsys *FileSystem) Mkdir(ctx context.Context, name string, perm os.FileMode) error {
+	p, err := repoPath(name)
+	if err != nil {
+		return os.ErrPermission
+	}
+	if p == "" || fsys.store.Exists(ctx, p) {
+		return os.ErrExist
+	}
+	if dir := path.Dir(p); dir != "." && !fsys.store.IsDir(ctx, dir) {
+		return os.ErrNotExist
+	}
+	if fsys.store.Path() == "" {
+		return os.ErrPermission // A memory storage has no directories of its own
+	}
+	return os.Mkdir(filepath.Join(fsys.store.Path(), filepath.FromSlash(p)), 0o775)
+}
+
+// OpenFile opens a file for reading or, with a write flag, for writing. A
+// written file is committed when it is closed.
+func (fsys *FileSystem) OpenFile(ctx context.Context, name string, flag int, perm os.FileMode) (webdav.File, error) {
+	p, err := repoPath(name)
+	writing := flag&(os.O_WRONLY|os.O_RDWR|os.O_CREATE|os.O_TRUNC|os.O_APPEND) != 0
+	if err != nil {
+		if writing {
+			return nil, os.ErrPermission
+		}
+		return nil, err
+	}
+
+	if !writing {
+		info, err := fsys.stat(ctx, p)
+		if err != nil {
+			return nil, err
+		}
+		f := &file{ctx: ctx, fsys: fsys, path: p, info: info}
+		if !info.IsDir() {
+			data, err := fsys.store.LoadBytes(ctx, p, "")
+			if err != nil {
+				return nil, err
+			}
+			f.reader = bytes.NewReader(data)
+		}
+		return f, nil
+	}
+
+	if p == "" || fsys.store.IsDir(ctx, p) {
+		return nil, os.ErrInvalid
+	}
+	exists := fsys.store.Exists(ctx, p)
+	switch {
+	case !exists && flag&os.O_CREATE == 0:
+		return nil, os.ErrNotExist
+	case exists && flag&os.O_CREATE != 0 && flag&os.O_EXCL != 0:
+		return nil, os.ErrExist
+	}
+	if dir := path.Dir(p); dir != "." && !fsys.store.IsDir(ctx, dir) {
+		return nil, os.ErrNotExist
+	}
+	f := &file{ctx: ctx, fsys: fsys, path: p, writer: &bytes.Buffer{}, existed: exists}
+	if exists && flag&os.O_TRUNC == 0 {
+		data, err := fsys.store.LoadBytes(ctx, p, "")
+		if err != nil {
+			return nil, err
+		}
+		f.writer.Write(data)
+	}
+	f.info = fileInfo{name: path.Base(p), size: int64(f.writer.Len()), modTime: time.Now()}
+	return f, nil
+}
+
+// RemoveAll deletes a file, or a directory with everything in it, in one
+// commit.
+func (fsys *FileSystem) RemoveAll(ctx context.Context, name string) error {
+	p, err := repoPath(name)
+	if err != nil || p == "" {
+		return os.ErrPermission
+	}
+	if !fsys.store.Exists(ctx, p) {
+		return os.ErrNotExist
+	}
+	pages := fsys.pagesUnder(ctx, p)
+	if err := fsys.store.Delete(ctx, p, "Deleted "+p+" via WebDAV", authorFrom(ctx)); err != nil {
+		return err
+	}
+	for _, page := range pages {
+		if err := fsys.wiki.RemovePageFromIndex(ctx, util.StripMarkdownExtension(page)); err != nil {
+			slog.Warn("failed to remove page from index", "path", page, "error", err)
+		}
+	}
+	fsys.wiki.InvalidatePageTreeCache()
+	return nil
+}
+
+// Rename moves a file or directory in one commit and reindexes the pages it
+// moves.
+func (fsys *FileSystem) Rename(ctx context.Context, oldName, newName string) error {
+	oldPath, err := repoPath(oldName)
+	if err != nil || oldPath == "" {
+		return os.ErrPermission
+	}
+	newPath, err := repoPath(newName)
+	if err != nil || newPath == "" {
+		return os.ErrPermission
+	}
+	if !fsys.store.Exists(ctx, oldPath) {
+		return os.ErrNotExist
+	}
+	if fsys.store.Exists(ctx, newPath) {
+		return os.ErrExist
+	}
+	pages := fsys.pagesUnder(ctx, oldPath)
+	if err := fsys.store.Rename(ctx, oldPath, newPath, "Renamed "+oldPath+" to "+newPath+" via WebDAV", authorFrom(ctx)); err != nil {
+		return err
+	}
+	for _, page := range pages {
+		moved := newPath + strings.TrimPrefix(page, oldPath)
+		if err := fsys.wiki.RemovePageFromIndex(ctx, util.StripMarkdownExtension(page)); err != nil {
+			slog.Warn("failed to remove page from index", "path", page, "error", err)
+		}
+		fsys.index(ctx, moved)
+	}
+	fsys.wiki.InvalidatePageTreeCache()
+	return nil
+}
+
+// Stat describes a file or directory.
+func (fsys *FileSystem) Stat(ctx context.Context, name string) (os.FileInfo, error) {
+	p, err := repoPath(name)
+	if err != nil {
+		return nil, err
+	}
+	return fsys.stat(ctx, p)
+}
+
+func (fsys *FileSystem) stat(ctx context.Context, p string) (fileInfo, error) {
+	if p == "" {
+		return fileInfo{name: "/", dir: true}, nil
+	}
+	if !fsys.store.Exists(ctx, p) {
+		return fileInfo{}, os.ErrNotExist
+	}
+	info := fileInfo{name: path.Base(p), dir: fsys.store.IsDir(ctx, p)}
+	info.modTime, _ = fsys.store.Mtime(ctx, p)
+	if !info.dir {
+		info.size, _ = fsys.store.Size(ctx, p)
+	}
+	return info, nil
+}
+
+// pagesUnder lists the pages at or below p.
+func (fsys *FileSystem) pagesUnder(ctx context.Context, p string) []string {
+	if !fsys.store.IsDir(ctx, p) {
+		if util.IsMarkdownFile(p) {
+			return []string{p}
+		}
+		return nil
+	}
+	files, _, err := fsys.store.List(ctx, p, nil, nil)
+	if err != nil {
+		return nil
+	}
+	var pages []string
+	for _, f := range files {
+		if f = path.Join(p, filepath.ToSlash(f)); util.IsMarkdownFile(f) {
+			pages = append(pages, f)
+		}
+	}
+	return pages
+}
+
+// save commits the content written to a file.
+func (fsys *FileSystem) save(ctx context.Context, p string, content []byte, existed bool) error {
+	message := "Created " + p + " via WebDAV"
+	if existed {
+		message = "Updated " + p + " via WebDAV"
+	}
+	changed, err := fsys.store.StoreBytes(ctx, p, content, message, authorFrom(ctx))
+	if err != nil {
+		return err
+	}
+	if changed {
+		fsys.index(ctx, p)
+		fsys.wiki.InvalidatePageTreeCache()
+	}
+	return nil
+}
+
+// index updates the search index for the file at p if it is a page.
+func (fsys *FileSystem) index(ctx context.Context, p string) {
+	if !util.IsMarkdownFile(p) {
+		return
+	}
+	content, err := fsys.store.Load(ctx, p, "")
+	if err == nil {
+		err = fsys.wiki.IndexPage(ctx, util.StripMarkdownExtension(p), content)
+	}
+	if err != nil {
+		slog.Warn("failed to index page", "path", p, "error", err)
+	}
+}
+
+// file is an open file or directory. A file opened for writing buffers what
+// is written and commits it on Close.
+type file struct {
+	ctx     context.Context
+	fsys    *FileSystem
+	path    string
+	info    fileInfo
+	reader  *bytes.Reader
+	writer  *bytes.Buffer
+	existed bool
+	entries []os.FileInfo
+	listed  bool
+}
+
+var errNotReadable = errors.New("dav: file is open for writing")
+
+func (f *file) Close() error {
+	if f.writer == nil {
+		return nil
+	}
+	content := f.writer.Bytes()
+	f.writer = nil
+	return f.fsys.save(f.ctx, f.path, content, f.existed)
+}
+
+func (f *file) Read(p []byte) (int, error) {
+	if f.reader == nil {
+		return 0, errNotReadable
+	}
+	return f.reader.Read(p)
+}
+
+func (f *file) Seek(offset int64, whence int) (int64, error) {
+	if f.reader != nil {
+		return f.reader.Seek(offset, whence)
+	}
+	if f.writer != nil && offset == 0 && whence != io.SeekCurrent {
+		// Only the size is asked for, or a rewind before writing.
+		if whence == io.SeekEnd {
+			return int64(f.writer.Len()), nil
+		}
+		return 0, nil
+	}
+	return 0, os.ErrInvalid
+}
+
+func (f *file) Write(p []byte) (int, error) {
+	if f.writer == nil {
+		return 0, os.ErrPermission
+	}
+	n, err := f.writer.Write(p)
+	f.info.size = int64(f.writer.Len())
+	return n, err
+}
+
+// Readdir lists the visible entries of a directory, count at a time.
+func (f *file) Readdir(count int) ([]fs.FileInfo, error) {
+	if !f.info.dir {
+		return nil, os.ErrInvalid
+	}
+	if !f.listed {
+		f.listed = true
+		depth := 0
+		files, dirs, err := f.fsys.store.List(f.ctx, f.path, &depth, nil)
+		if err != nil {
+			return nil, err
+		}
+		for _, name := range append(dirs, files...) {
+			name = filepath.ToSlash(name)
+			if strings.HasPrefix(name, ".") {
+				continue
+			}
+			info, err := f.fsys.stat(f.ctx, path.Join(f.path, name))
+			if err == nil {
+				f.entries = append(f.entries, info)
+			}
+		}
+	}
+	if count <= 0 {
+		entries := f.entries
+		f.entries = nil
+		return entries, nil
+	}
+	if len(f.entries) == 0 {
+		return nil, io.EOF
+	}
+	n := min(count, len(f.entries))
+	entries := f.entries[:n]
+	f.entries = f.entries[n:]
+	return entries, nil
+}
+
+func (f *file) Stat() (fs.FileInfo, error) {
+	return f.info, nil
+}
+
+// fileInfo implements os.FileInfo for repository entries.
+type fileInfo struct {
+	name    string
+	size    int64
+	modTime time.Time
+	dir     bool
+}
+
+func (fi fileInfo) Name() string       { return fi.name }
+func (fi fileInfo) Size() int64        { return fi.size }
+func (fi fileInfo) ModTime() time.Time { return fi.modTime }
+func (fi fileInfo) IsDir() bool        { return fi.dir }
+func (fi fileInfo) Sys() any           { return nil }
+
+func (fi fileInfo) Mode() fs.FileMode {
+	if fi.dir {
+		return fs.ModeDir | 0o755
+	}
+	return 0o644
+}
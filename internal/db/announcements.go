@@ -0,0 +1,175 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// Announcement is a banner admins post for the whole site, shown between
+// StartsAt and EndsAt; a zero time leaves that end open.
+type Announcement struct {
+	ID          int64
+	Message     string // Markdown
+	Severity    string // info, success, warning or danger
+	StartsAt    time.Time
+	EndsAt      time.Time
+	Dismissible bool // Logged-in users may hide it
+	CreatedBy   string
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+}
+
+// Active reports whether a is shown at now.
+func (a Announcement) Active(now time.Time) bool {
+	return (a.StartsAt.IsZero() || !now.Before(a.StartsAt)) && (a.EndsAt.IsZero() || now.Before(a.EndsAt))
+}
+
+const announcementColumns = `id, message, severity, starts_at, ends_at, dismissible, created_by, created_at, updated_at`
+
+// CreateAnnouncement adds an announcement, returning its ID.
+func (d *Database) CreateAnnouncement(ctx context.Context, a Announcement) (int64, error) {
+	var id int64
+	err := d.conn.QueryRowContext(ctx, `INSERT INTO announcements
+		(message, severity, starts_at, ends_at, dismissible, created_by, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?) RETURNING id`,
+		a.Message, a.Severity, nullUnix(a.StartsAt), nullUnix(a.EndsAt), boolInt(a.Dismissible),
+		a.CreatedBy, a.CreatedAt.Unix(), a.CreatedAt.Unix()).Scan(&id)
+	return id, err
+}
+
+// UpdateAnnouncement saves the message, severity, times and dismissibility
+// of a.ID, leaving the dismissals of its users. Returns sql.ErrNoRows if no
+// such announcement exists.
+func (d *Database) UpdateAnnouncement(ctx context.Context, a Announcement) error {
+	res, err := d.conn.ExecContext(ctx, `UPDATE announcements SET message = ?, severity = ?, starts_at = ?,
+		ends_at = ?, dismissible = ?, updated_at = ? WHERE id = ?`,
+		a.Message, a.Severity, nullUnix(a.StartsAt), nullUnix(a.EndsAt), boolInt(a.Dismissible),
+		a.UpdatedAt.Unix(), a.ID)
+	if err != nil {
+		return err
+	}
+	return requireRow(res)
+}
+
+// DeleteAnnouncement removes an announcement and who dismissed it. Returns
+// sql.ErrNoRows if no such announcement exists.
+func (d *Database) DeleteAnnouncement(ctx context.Context, id int64) error {
+	tx, err := d.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM announcement_dismissals WHERE announcement_id = ?`, id); err != nil {
+		return err
+	}
+	res, err := tx.ExecContext(ctx, `DELETE FROM announcements WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+	if err := requireRow(res); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// GetAnnouncement returns the announcement with id, or sql.ErrNoRows.
+func (d *Database) GetAnnouncement(ctx context.Context, id int64) (Announcement, error) {
+	return scanAnnouncement(d.conn.QueryRowContext(ctx,
+		`SELECT `+announcementColumns+` FROM announcements WHERE id = ?`, id))
+}
+
+// ListAnnouncements returns every announcement, newest first.
+func (d *Database) ListAnnouncements(ctx context.Context) ([]Announcement, error) {
+	rows, err := d.conn.QueryContext(ctx, `SELECT `+announcementColumns+` FROM announcements
+		ORDER BY created_at DESC, id DESC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var list []Announcement
+	for rows.Next() {
+		a, err := scanAnnouncement(rows)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, a)
+	}
+	return list, rows.Err()
+}
+
+// DismissAnnouncement hides the announcement with id from the user with
+// userID.
+func (d *Database) DismissAnnouncement(ctx context.Context, userID, id int64, at time.Time) error {
+	_, err := d.conn.ExecContext(ctx, `INSERT INTO announcement_dismissals (user_id, announcement_id, dismissed_at)
+		VALUES (?, ?, ?) ON CONFLICT (user_id, announcement_id) DO NOTHING`, userID, id, at.Unix())
+	return err
+}
+
+// DismissedAnnouncements returns the IDs of the announcements the user with
+// userID dismissed.
+func (d *Database) DismissedAnnouncements(ctx context.Context, userID int64) (map[int64]bool, error) {
+	rows, err := d.conn.QueryContext(ctx, `SELECT announcement_id FROM announcement_dismissals WHERE user_id = ?`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	dismissed := make(map[int64]bool)
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		dismissed[id] = true
+	}
+	return dismissed, rows.Err()
+}
+
+func scanAnnouncement(row interface{ Scan(...any) error }) (Announcement, error) {
+	var a Announcement
+	var startsAt, endsAt sql.NullInt64
+	var dismissible int
+	var createdAt, updatedAt int64
+	err := row.Scan(&a.ID, &a.Message, &a.Severity, &startsAt, &endsAt, &dismissible,
+		&a.CreatedBy, &createdAt, &updatedAt)
+	if startsAt.Valid {
+		a.StartsAt = time.Unix(startsAt.Int64, 0)
+	}
+	if endsAt.Valid {
+		a.EndsAt = time.Unix(endsAt.Int64, 0)
+	}
+	a.Dismissible = dismissible != 0
+	a.CreatedAt = time.Unix(createdAt, 0)
+	a.UpdatedAt = time.Unix(updatedAt, 0)
+	return a, err
+}
+
+// nullUnix stores t as Unix seconds, or NULL for the zero time.
+func nullUnix(t time.Time) sql.NullInt64 {
+	if t.IsZero() {
+		return sql.NullInt64{}
+	}
+	return sql.NullInt64{Int64: t.Unix(), Valid: true}
+}
+
+func boolInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// requireRow returns sql.ErrNoRows when res changed no row.
+func requireRow(res sql.Result) error {
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
@@ -0,0 +1,61 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// AuditEntry is a row of audit_log: a change made to many records at once,
+// or to the review status of a page, kept so admins can tell who did it.
+type AuditEntry struct {
+	ID         int64
+	Action     string // e.g. "issues.close", "page.status"
+	Detail     string // What was changed, e.g. "#3, #5"
+	ActorName  string
+	ActorEmail string
+	CreatedAt  time.Time
+}
+
+const auditColumns = `id, action, detail, actor_name, actor_email, created_at`
+
+// AddAuditEntry records e, in tx when it is not nil so the entry is kept
+// only if the change it describes is.
+func (d *Database) AddAuditEntry(ctx context.Context, tx *sql.Tx, e AuditEntry) error {
+	var conn DBTX = d.conn
+	if tx != nil {
+		conn = tx
+	}
+	_, err := conn.ExecContext(ctx, `INSERT INTO audit_log (action, detail, actor_name, actor_email, created_at)
+		VALUES (?, ?, ?, ?, ?)`,
+		e.Action, e.Detail, e.ActorName, e.ActorEmail, e.CreatedAt.Unix())
+	return err
+}
+
+// ListAuditEntries returns up to limit entries, newest first.
+func (d *Database) ListAuditEntries(ctx context.Context, limit int) ([]AuditEntry, error) {
+	rows, err := d.conn.QueryContext(ctx, `SELECT `+auditColumns+` FROM audit_log
+		ORDER BY created_at DESC, id DESC LIMIT ?`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []AuditEntry
+	for rows.Next() {
+		e, err := scanAuditEntry(rows)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
+
+func scanAuditEntry(row interface{ Scan(...any) error }) (AuditEntry, error) {
+	var e AuditEntry
+	var createdAt int64
+	err := row.Scan(&e.ID, &e.Action, &e.Detail, &e.ActorName, &e.ActorEmail, &createdAt)
+	e.CreatedAt = time.Unix(createdAt, 0).UTC()
+	return e, err
+}
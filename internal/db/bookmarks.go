@@ -0,0 +1,77 @@
+package db
+
+import (
+	"context"
+	"time"
+)
+
+// Bookmark is a page a user pinned, and when they did.
+type Bookmark struct {
+	Pagepath  string
+	CreatedAt time.Time
+}
+
+// AddBookmark pins the page at pagepath for the user with userID, keeping
+// the time of a bookmark they already have.
+func (d *Database) AddBookmark(ctx context.Context, userID int64, pagepath string, at time.Time) error {
+	_, err := d.conn.ExecContext(ctx, `INSERT INTO bookmarks (user_id, pagepath, created_at) VALUES (?, ?, ?)
+		ON CONFLICT (user_id, pagepath) DO NOTHING`, userID, pagepath, at.Unix())
+	return err
+}
+
+// DeleteBookmark unpins the page at pagepath for the user with userID.
+func (d *Database) DeleteBookmark(ctx context.Context, userID int64, pagepath string) error {
+	_, err := d.conn.ExecContext(ctx, `DELETE FROM bookmarks WHERE user_id = ? AND pagepath = ?`, userID, pagepath)
+	return err
+}
+
+// IsBookmarked reports whether the user with userID pinned the page at
+// pagepath.
+func (d *Database) IsBookmarked(ctx context.Context, userID int64, pagepath string) (bool, error) {
+	var n int
+	err := d.conn.QueryRowContext(ctx, `SELECT COUNT(*) FROM bookmarks WHERE user_id = ? AND pagepath = ?`,
+		userID, pagepath).Scan(&n)
+	return n > 0, err
+}
+
+// ListBookmarks returns the pages the user with userID pinned, sorted by
+// path.
+func (d *Database) ListBookmarks(ctx context.Context, userID int64) ([]Bookmark, error) {
+	rows, err := d.conn.QueryContext(ctx, `SELECT pagepath, created_at FROM bookmarks
+		WHERE user_id = ? ORDER BY pagepath`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var bookmarks []Bookmark
+	for rows.Next() {
+		var b Bookmark
+		var createdAt int64
+		if err := rows.Scan(&b.Pagepath, &createdAt); err != nil {
+			return nil, err
+		}
+		b.CreatedAt = time.Unix(createdAt, 0).UTC()
+		bookmarks = append(bookmarks, b)
+	}
+	return bookmarks, rows.Err()
+}
+
+// MoveBookmarks moves the bookmarks of a renamed page to its new path;
+// users who had pinned both keep one.
+func (d *Database) MoveBookmarks(ctx context.Context, from, to string) error {
+	tx, err := d.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM bookmarks WHERE pagepath = ? AND user_id IN (
+		SELECT user_id FROM bookmarks WHERE pagepath = ?)`, from, to); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `UPDATE bookmarks SET pagepath = ? WHERE pagepath = ?`, to, from); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
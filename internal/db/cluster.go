@@ -0,0 +1,61 @@
+package db
+
+import (
+	"context"
+	"time"
+)
+
+// AcquireLease takes the lease called name for holder until expires, or
+// extends it if holder has it already, and reports whether holder now holds
+// it. A lease held by another holder is only taken once it has expired, so
+// a process that dies loses its leases after their time runs out.
+func (d *Database) AcquireLease(ctx context.Context, name, holder string, expires time.Time) (bool, error) {
+	res, err := d.conn.ExecContext(ctx,
+		`INSERT INTO cluster_leases (name, holder, expires_at) VALUES (?, ?, ?)
+		ON CONFLICT (name) DO UPDATE SET holder = excluded.holder, expires_at = excluded.expires_at
+		WHERE cluster_leases.holder = excluded.holder OR cluster_leases.expires_at <= ?`,
+		name, holder, expires.UnixMilli(), time.Now().UnixMilli())
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n == 1, err
+}
+
+// ReleaseLease gives up holder's lease called name, if it still has it.
+func (d *Database) ReleaseLease(ctx context.Context, name, holder string) error {
+	_, err := d.conn.ExecContext(ctx,
+		`DELETE FROM cluster_leases WHERE name = ? AND holder = ?`, name, holder)
+	return err
+}
+
+// BumpGeneration increments the counter called name, creating it at 1, and
+// returns its new value.
+func (d *Database) BumpGeneration(ctx context.Context, name string) (int64, error) {
+	var value int64
+	err := d.conn.QueryRowContext(ctx,
+		`INSERT INTO cluster_generations (name, value) VALUES (?, 1)
+		ON CONFLICT (name) DO UPDATE SET value = cluster_generations.value + 1
+		RETURNING value`, name).Scan(&value)
+	return value, err
+}
+
+// Generations returns every counter bumped with BumpGeneration by name.
+func (d *Database) Generations(ctx context.Context) (map[string]int64, error) {
+	rows, err := d.conn.QueryContext(ctx, `SELECT name, value FROM cluster_generations`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	gens := make(map[string]int64)
+	for rows.Next() {
+		var name string
+		var value int64
+		if err := rows.Scan(&name, &value); err != nil {
+			return nil, err
+		}
+		gens[name] = value
+	}
+	return gens, rows.Err()
+}
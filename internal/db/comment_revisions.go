@@ -0,0 +1,94 @@
+package db
+
+import (
+	"context"
+	"time"
+)
+
+// IssueCommentRevision is a row of issue_comment_revisions: the content an
+// issue comment had before an edit replaced it.
+type IssueCommentRevision struct {
+	ID            int64
+	CommentID     int64
+	Content       string
+	EditedByName  string // Who made the edit that replaced the content
+	EditedByEmail string
+	CreatedAt     time.Time // When the edit was made
+}
+
+const commentRevisionColumns = `id, comment_id, content, edited_by_name, edited_by_email, created_at`
+
+// EditIssueComment replaces the content of the comment with id, keeping
+// the content it had as a revision edited by editorName and editorEmail at
+// now. It returns the edited comment, or sql.ErrNoRows.
+func (d *Database) EditIssueComment(ctx context.Context, id int64, content, editorName, editorEmail string, now time.Time) (IssueComment, error) {
+	tx, err := d.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return IssueComment{}, err
+	}
+	defer tx.Rollback()
+	q := d.Queries.WithTx(tx)
+
+	comment, err := q.GetIssueComment(ctx, id)
+	if err != nil {
+		return IssueComment{}, err
+	}
+	if _, err := tx.ExecContext(ctx, `INSERT INTO issue_comment_revisions (comment_id, content, edited_by_name, edited_by_email, created_at)
+		VALUES (?, ?, ?, ?, ?)`, id, comment.Content, editorName, editorEmail, now.Unix()); err != nil {
+		return IssueComment{}, err
+	}
+	if _, err := tx.ExecContext(ctx, `UPDATE issue_comments SET content = ?, updated_at = ? WHERE id = ?`,
+		content, NullTime(now), id); err != nil {
+		return IssueComment{}, err
+	}
+	if comment, err = q.GetIssueComment(ctx, id); err != nil {
+		return IssueComment{}, err
+	}
+	return comment, tx.Commit()
+}
+
+// ListIssueCommentRevisions returns the earlier versions of a comment,
+// newest first.
+func (d *Database) ListIssueCommentRevisions(ctx context.Context, commentID int64) ([]IssueCommentRevision, error) {
+	rows, err := d.conn.QueryContext(ctx, `SELECT `+commentRevisionColumns+` FROM issue_comment_revisions
+		WHERE comment_id = ? ORDER BY created_at DESC, id DESC`, commentID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var revisions []IssueCommentRevision
+	for rows.Next() {
+		var rev IssueCommentRevision
+		var createdAt int64
+		if err := rows.Scan(&rev.ID, &rev.CommentID, &rev.Content, &rev.EditedByName, &rev.EditedByEmail, &createdAt); err != nil {
+			return nil, err
+		}
+		rev.CreatedAt = time.Unix(createdAt, 0).UTC()
+		revisions = append(revisions, rev)
+	}
+	return revisions, rows.Err()
+}
+
+// CountEditedIssueComments returns the number of revisions of each edited
+// comment on an issue, by comment ID.
+func (d *Database) CountEditedIssueComments(ctx context.Context, issueID int64) (map[int64]int, error) {
+	rows, err := d.conn.QueryContext(ctx, `SELECT r.comment_id, COUNT(*) FROM issue_comment_revisions r
+		JOIN issue_comments c ON c.id = r.comment_id
+		WHERE c.issue_id = ? GROUP BY r.comment_id`, issueID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := make(map[int64]int)
+	for rows.Next() {
+		var id int64
+		var n int
+		if err := rows.Scan(&id, &n); err != nil {
+			return nil, err
+		}
+		counts[id] = n
+	}
+	return counts, rows.Err()
+}
@@ -0,0 +1,131 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// copyTables lists the tables Copy moves, parents before the tables whose
+// foreign keys point at them. The search index is left out: it is rebuilt
+// from the repository.
+var copyTables = []string{
+	"preferences",
+	"user",
+	"user_fields",
+	"user_field_values",
+	"user_preferences",
+	"user_avatars",
+	"password_resets",
+	"user_sessions",
+	"drafts",
+	"scheduled_pages",
+	"cache",
+	"issues",
+	"issue_comments",
+	"page_links",
+	"page_metadata",
+	"page_status",
+	"page_reminders",
+	"page_visibility",
+	"page_views",
+	"page_checks",
+	"page_external_links",
+	"external_links",
+	"repository_maintenance",
+	"moderation_queue",
+	"notifications",
+	"issue_views",
+	"recent_pages",
+	"bookmarks",
+	"announcements",
+	"announcement_dismissals",
+	"audit_log",
+	"issue_comment_revisions",
+}
+
+// identityTables are the copied tables with an id column the database
+// numbers itself.
+var identityTables = []string{"user", "user_fields", "user_sessions", "drafts", "scheduled_pages", "issues", "issue_comments", "moderation_queue", "notifications", "issue_views", "audit_log", "issue_comment_revisions", "announcements"}
+
+// Copy copies every row of src into dst, which must be migrated and empty,
+// in one transaction. It moves a wiki between SQLite and PostgreSQL in
+// either direction; ids are kept, so sessions and links to issues survive.
+// It returns the number of rows copied per table.
+func Copy(ctx context.Context, dst, src *Database) (map[string]int, error) {
+	tx, err := dst.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	for _, table := range copyTables {
+		var n int
+		if err := tx.QueryRowContext(ctx, `SELECT COUNT(*) FROM `+quoteIdent(table)).Scan(&n); err != nil {
+			return nil, fmt.Errorf("%s: %w", table, err)
+		}
+		if n > 0 {
+			return nil, fmt.Errorf("destination table %s is not empty", table)
+		}
+	}
+
+	counts := make(map[string]int, len(copyTables))
+	for _, table := range copyTables {
+		rows, err := src.conn.QueryContext(ctx, `SELECT * FROM `+quoteIdent(table))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", table, err)
+		}
+		cols, err := rows.Columns()
+		if err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("%s: %w", table, err)
+		}
+		names := make([]string, len(cols))
+		for i, c := range cols {
+			names[i] = quoteIdent(c)
+		}
+		insert := fmt.Sprintf(`INSERT INTO %s (%s) VALUES (%s)`, quoteIdent(table),
+			strings.Join(names, ", "), strings.TrimSuffix(strings.Repeat("?, ", len(cols)), ", "))
+
+		values := make([]any, len(cols))
+		ptrs := make([]any, len(cols))
+		for i := range values {
+			ptrs[i] = &values[i]
+		}
+		for rows.Next() {
+			if err := rows.Scan(ptrs...); err != nil {
+				rows.Close()
+				return nil, fmt.Errorf("%s: %w", table, err)
+			}
+			if _, err := tx.ExecContext(ctx, insert, values...); err != nil {
+				rows.Close()
+				return nil, fmt.Errorf("%s: %w", table, err)
+			}
+			counts[table]++
+		}
+		err = rows.Err()
+		rows.Close()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", table, err)
+		}
+	}
+
+	// SQLite numbers new rows after the largest id; PostgreSQL's identity
+	// sequences have to be told where the copied ids end.
+	if dst.postgres {
+		for _, table := range identityTables {
+			if _, err := tx.ExecContext(ctx, fmt.Sprintf(
+				`SELECT setval(pg_get_serial_sequence('%s', 'id'), COALESCE(MAX(id), 0) + 1, false) FROM %s`,
+				quoteIdent(table), quoteIdent(table))); err != nil {
+				return nil, fmt.Errorf("%s: failed to reset id sequence: %w", table, err)
+			}
+		}
+	}
+	return counts, tx.Commit()
+}
+
+// quoteIdent quotes a table or column name, which "user" needs on
+// PostgreSQL.
+func quoteIdent(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
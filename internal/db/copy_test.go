@@ -0,0 +1,59 @@
+package db
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestCopy(t *testing.T) {
+	ctx := context.Background()
+	src := openTestDB(t)
+	user, err := src.Queries.CreateUser(ctx, CreateUserParams{
+		Name:       "Alice",
+		Email:      "alice@example.com",
+		FirstSeen:  NullTime(time.Now()),
+		IsApproved: NullBool(true),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	issue, err := src.Queries.CreateIssue(ctx, CreateIssueParams{Title: "Broken link", Status: "open"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := src.Queries.CreateIssueComment(ctx, CreateIssueCommentParams{IssueID: issue.ID, Content: "Fixed"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := src.UpsertPageLinks(ctx, "home", []string{"about"}); err != nil {
+		t.Fatal(err)
+	}
+
+	dst := openTestDB(t)
+	counts, err := Copy(ctx, dst, src)
+	if err != nil {
+		t.Fatalf("Copy() failed: %v", err)
+	}
+	if counts["user"] != 1 || counts["issues"] != 1 || counts["issue_comments"] != 1 || counts["page_links"] != 1 {
+		t.Errorf("Copy() counts = %v", counts)
+	}
+
+	got, err := dst.Queries.GetUserByEmail(ctx, "alice@example.com")
+	if err != nil {
+		t.Fatalf("GetUserByEmail() failed: %v", err)
+	}
+	if got.ID != user.ID || !got.IsApproved.Bool || !got.FirstSeen.Valid {
+		t.Errorf("copied user = %+v, want %+v", got, user)
+	}
+	next, err := dst.Queries.CreateIssue(ctx, CreateIssueParams{Title: "Next", Status: "open"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if next.ID <= issue.ID {
+		t.Errorf("new issue id = %d, want it after the copied %d", next.ID, issue.ID)
+	}
+
+	if _, err := Copy(ctx, dst, src); err == nil {
+		t.Error("Copy() into a non-empty database should fail")
+	}
+}
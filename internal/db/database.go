@@ -35,8 +35,9 @@ func NullTime(t time.Time) sql.NullTime {
 
 // Database wraps the SQL database connection and queries.
 type Database struct {
-	conn    *sql.DB
-	Queries *Queries
+	conn     *sql.DB
+	Queries  *Queries
+	postgres bool
 }
 
 // Schema is the SQL schema for creating tables.
@@ -99,10 +100,9 @@ CREATE INDEX IF NOT EXISTS idx_issues_status ON issues(status);
 CREATE INDEX IF NOT EXISTS idx_issues_created_at ON issues(created_at);
 `
 
-// Open opens a new database connection.
-func Open(uri string) (*Database, error) {
-	// Parse the URI to extract the database path
-	// SQLite URIs are typically: sqlite:///path/to/db.sqlite or sqlite:///:memory:
+// pathFromURI extracts the database path from a SQLite URI. SQLite URIs are
+// typically: sqlite:///path/to/db.sqlite or sqlite:///:memory:
+func pathFromURI(uri string) string {
 	dbPath := uri
 	if strings.HasPrefix(uri, "sqlite:///") {
 		dbPath = strings.TrimPrefix(uri, "sqlite:///")
@@ -114,6 +114,16 @@ func Open(uri string) (*Database, error) {
 	if dbPath == ":memory:" || dbPath == "" {
 		dbPath = ":memory:"
 	}
+	return dbPath
+}
+
+// Open opens a new database connection. A postgres:// or postgresql:// URI
+// opens a PostgreSQL database; anything else names a SQLite file.
+func Open(uri string) (*Database, error) {
+	if IsPostgresURI(uri) {
+		return openPostgres(uri)
+	}
+	dbPath := pathFromURI(uri)
 
 	// Create connection string with options
 	connStr := dbPath
@@ -129,6 +139,12 @@ func Open(uri string) (*Database, error) {
 		return nil, fmt.Errorf("failed to open database: %w", err)
 	}
 
+	if dbPath == ":memory:" {
+		// Every connection to :memory: opens a database of its own; keep
+		// to one so that all queries see the same.
+		conn.SetMaxOpenConns(1)
+	}
+
 	// Test the connection
 	if err := conn.Ping(); err != nil {
 		conn.Close()
@@ -145,6 +161,12 @@ func Open(uri string) (*Database, error) {
 
 // Migrate runs the schema migrations.
 func (d *Database) Migrate(ctx context.Context) error {
+	if d.postgres {
+		if err := d.migratePostgres(ctx); err != nil {
+			return fmt.Errorf("failed to run migrations: %w", err)
+		}
+		return nil
+	}
 	_, err := d.conn.ExecContext(ctx, Schema)
 	if err != nil {
 		return fmt.Errorf("failed to run migrations: %w", err)
@@ -240,6 +262,394 @@ var migrations = []migration{
 			`CREATE UNIQUE INDEX IF NOT EXISTS idx_drafts_page_author ON drafts(pagepath, author_email)`)
 		return err
 	}},
+	{7, "create user profile field tables", func(ctx context.Context, conn *sql.DB) error {
+		if _, err := conn.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS user_fields (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			name TEXT NOT NULL UNIQUE,
+			label TEXT NOT NULL,
+			position INTEGER NOT NULL DEFAULT 0
+		)`); err != nil {
+			return err
+		}
+		_, err := conn.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS user_field_values (
+			user_id INTEGER NOT NULL REFERENCES user(id) ON DELETE CASCADE,
+			field_id INTEGER NOT NULL REFERENCES user_fields(id) ON DELETE CASCADE,
+			value TEXT NOT NULL,
+			PRIMARY KEY (user_id, field_id)
+		)`)
+		return err
+	}},
+	{8, "recreate FTS5 table with diacritic folding", func(ctx context.Context, conn *sql.DB) error {
+		// The folded column holds a locale-specific transliteration of the
+		// page (see util.FoldSearchText); remove_diacritics 2 makes the
+		// tokenizer itself accent-insensitive. The index is rebuilt from git
+		// on startup once the table is empty.
+		if _, err := conn.ExecContext(ctx, `DROP TABLE IF EXISTS page_fts`); err != nil {
+			return err
+		}
+		_, err := conn.ExecContext(ctx,
+			`CREATE VIRTUAL TABLE page_fts USING fts5(pagepath, title, content, folded, tokenize = 'unicode61 remove_diacritics 2')`)
+		return err
+	}},
+	{9, "create password_resets table", func(ctx context.Context, conn *sql.DB) error {
+		// Only a hash of each token is stored, so a leaked database does not
+		// leak working reset links.
+		_, err := conn.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS password_resets (
+			token_hash TEXT PRIMARY KEY,
+			user_id INTEGER NOT NULL REFERENCES user(id) ON DELETE CASCADE,
+			expires_at INTEGER NOT NULL
+		)`)
+		return err
+	}},
+	{10, "create user_sessions table", func(ctx context.Context, conn *sql.DB) error {
+		_, err := conn.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS user_sessions (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			token_hash TEXT NOT NULL UNIQUE,
+			user_id INTEGER NOT NULL REFERENCES user(id) ON DELETE CASCADE,
+			user_agent TEXT NOT NULL DEFAULT '',
+			ip TEXT NOT NULL DEFAULT '',
+			created_at INTEGER NOT NULL,
+			last_seen INTEGER NOT NULL
+		)`)
+		if err != nil {
+			return err
+		}
+		_, err = conn.ExecContext(ctx,
+			`CREATE INDEX IF NOT EXISTS idx_user_sessions_user ON user_sessions(user_id)`)
+		return err
+	}},
+	{11, "create cluster tables", func(ctx context.Context, conn *sql.DB) error {
+		// Processes sharing the database coordinate through leases, which
+		// expire unless renewed, and counters they bump to tell the others
+		// to drop cached state.
+		if _, err := conn.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS cluster_leases (
+			name TEXT PRIMARY KEY,
+			holder TEXT NOT NULL,
+			expires_at INTEGER NOT NULL
+		)`); err != nil {
+			return err
+		}
+		_, err := conn.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS cluster_generations (
+			name TEXT PRIMARY KEY,
+			value INTEGER NOT NULL
+		)`)
+		return err
+	}},
+	{12, "create user_preferences table", func(ctx context.Context, conn *sql.DB) error {
+		_, err := conn.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS user_preferences (
+			user_id INTEGER NOT NULL REFERENCES user(id) ON DELETE CASCADE,
+			name TEXT NOT NULL,
+			value TEXT NOT NULL,
+			PRIMARY KEY (user_id, name)
+		)`)
+		return err
+	}},
+	{13, "create page_metadata table", func(ctx context.Context, conn *sql.DB) error {
+		// A cache of what listing pages needs from the repository, up to
+		// date with the commit the page_metadata_head preference names.
+		_, err := conn.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS page_metadata (
+			pagepath TEXT PRIMARY KEY,
+			filename TEXT NOT NULL,
+			title TEXT NOT NULL DEFAULT '',
+			revision TEXT NOT NULL DEFAULT '',
+			author_name TEXT NOT NULL DEFAULT '',
+			author_email TEXT NOT NULL DEFAULT '',
+			created_at INTEGER NOT NULL DEFAULT 0,
+			updated_at INTEGER NOT NULL DEFAULT 0,
+			size INTEGER NOT NULL DEFAULT 0
+		)`)
+		return err
+	}},
+	{14, "create repository_maintenance table", func(ctx context.Context, conn *sql.DB) error {
+		// One row per run of the repository maintenance, for the dashboard
+		// to show how the repository's size develops.
+		if _, err := conn.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS repository_maintenance (
+			ran_at INTEGER NOT NULL,
+			size_before INTEGER NOT NULL,
+			size_after INTEGER NOT NULL,
+			loose_objects INTEGER NOT NULL,
+			packs INTEGER NOT NULL,
+			duration_ms INTEGER NOT NULL
+		)`); err != nil {
+			return err
+		}
+		_, err := conn.ExecContext(ctx,
+			`CREATE INDEX IF NOT EXISTS idx_repository_maintenance_ran_at ON repository_maintenance(ran_at)`)
+		return err
+	}},
+	{15, "create moderation_queue table", func(ctx context.Context, conn *sql.DB) error {
+		// Anonymous contributions flagged as spam, held until a moderator
+		// approves or rejects them.
+		_, err := conn.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS moderation_queue (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			kind TEXT NOT NULL,
+			target TEXT NOT NULL DEFAULT '',
+			title TEXT NOT NULL DEFAULT '',
+			content TEXT NOT NULL DEFAULT '',
+			payload TEXT NOT NULL DEFAULT '',
+			author_name TEXT NOT NULL DEFAULT '',
+			author_email TEXT NOT NULL DEFAULT '',
+			client_ip TEXT NOT NULL DEFAULT '',
+			reason TEXT NOT NULL DEFAULT '',
+			created_at INTEGER NOT NULL
+		)`)
+		return err
+	}},
+	{16, "create notifications table", func(ctx context.Context, conn *sql.DB) error {
+		// Mentions of users in issues and comments. user_id names a user
+		// of the users database, which may be another, so it has no
+		// foreign key.
+		if _, err := conn.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS notifications (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			user_id INTEGER NOT NULL,
+			kind TEXT NOT NULL,
+			issue_id INTEGER NOT NULL DEFAULT 0,
+			comment_id INTEGER NOT NULL DEFAULT 0,
+			title TEXT NOT NULL DEFAULT '',
+			excerpt TEXT NOT NULL DEFAULT '',
+			actor_name TEXT NOT NULL DEFAULT '',
+			created_at INTEGER NOT NULL,
+			read_at INTEGER NOT NULL DEFAULT 0
+		)`); err != nil {
+			return err
+		}
+		_, err := conn.ExecContext(ctx,
+			`CREATE INDEX IF NOT EXISTS idx_notifications_user ON notifications(user_id, read_at)`)
+		return err
+	}},
+	{17, "create issue_views table", func(ctx context.Context, conn *sql.DB) error {
+		// Named issue list filters users saved, as the list's query string.
+		_, err := conn.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS issue_views (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			user_id INTEGER NOT NULL,
+			name TEXT NOT NULL,
+			query TEXT NOT NULL DEFAULT '',
+			created_at INTEGER NOT NULL,
+			UNIQUE (user_id, name)
+		)`)
+		return err
+	}},
+	{18, "create audit_log table", func(ctx context.Context, conn *sql.DB) error {
+		// Changes made to many records at once, such as bulk issue edits.
+		_, err := conn.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS audit_log (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			action TEXT NOT NULL,
+			detail TEXT NOT NULL DEFAULT '',
+			actor_name TEXT NOT NULL DEFAULT '',
+			actor_email TEXT NOT NULL DEFAULT '',
+			created_at INTEGER NOT NULL
+		)`)
+		return err
+	}},
+	{19, "create issue_comment_revisions table", func(ctx context.Context, conn *sql.DB) error {
+		// The earlier versions of edited issue comments.
+		if _, err := conn.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS issue_comment_revisions (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			comment_id INTEGER NOT NULL REFERENCES issue_comments(id) ON DELETE CASCADE,
+			content TEXT NOT NULL,
+			edited_by_name TEXT NOT NULL DEFAULT '',
+			edited_by_email TEXT NOT NULL DEFAULT '',
+			created_at INTEGER NOT NULL
+		)`); err != nil {
+			return err
+		}
+		_, err := conn.ExecContext(ctx,
+			`CREATE INDEX IF NOT EXISTS idx_issue_comment_revisions_comment ON issue_comment_revisions(comment_id)`)
+		return err
+	}},
+	{20, "create user_avatars table", func(ctx context.Context, conn *sql.DB) error {
+		_, err := conn.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS user_avatars (
+			user_id INTEGER PRIMARY KEY REFERENCES user(id) ON DELETE CASCADE,
+			data BLOB NOT NULL,
+			updated_at INTEGER NOT NULL
+		)`)
+		return err
+	}},
+	{21, "create scheduled_pages table", func(ctx context.Context, conn *sql.DB) error {
+		// Drafts scheduled to be saved as their page at publish_at. revision
+		// is the page's revision the draft was made on; error is set when
+		// publishing failed and left for the author to resolve.
+		if _, err := conn.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS scheduled_pages (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			pagepath TEXT NOT NULL,
+			revision TEXT NOT NULL DEFAULT '',
+			content TEXT NOT NULL,
+			message TEXT NOT NULL DEFAULT '',
+			author_name TEXT NOT NULL DEFAULT '',
+			author_email TEXT NOT NULL,
+			publish_at INTEGER NOT NULL,
+			created_at INTEGER NOT NULL,
+			error TEXT NOT NULL DEFAULT ''
+		)`); err != nil {
+			return err
+		}
+		_, err := conn.ExecContext(ctx, `CREATE INDEX IF NOT EXISTS idx_scheduled_pages_publish_at ON scheduled_pages(publish_at)`)
+		return err
+	}},
+	{22, "create page_status table", func(ctx context.Context, conn *sql.DB) error {
+		// The review status of the pages that have one, and who set it.
+		if _, err := conn.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS page_status (
+			pagepath TEXT PRIMARY KEY,
+			status TEXT NOT NULL,
+			changed_by_name TEXT NOT NULL DEFAULT '',
+			changed_by_email TEXT NOT NULL DEFAULT '',
+			changed_at INTEGER NOT NULL
+		)`); err != nil {
+			return err
+		}
+		_, err := conn.ExecContext(ctx, `CREATE INDEX IF NOT EXISTS idx_page_status_status ON page_status(status)`)
+		return err
+	}},
+	{23, "add page review dates and reminders", func(ctx context.Context, conn *sql.DB) error {
+		// review_by is the frontmatter review date of a page, 0 for none.
+		// Forgetting the cache's head rebuilds it, filling the column in.
+		// page_reminders records the revision of each page whose author was
+		// last told it is stale, so they are told once per revision.
+		for _, stmt := range []string{
+			`ALTER TABLE page_metadata ADD COLUMN review_by INTEGER NOT NULL DEFAULT 0`,
+			`DELETE FROM preferences WHERE name = 'page_metadata_head'`,
+			`ALTER TABLE notifications ADD COLUMN pagepath TEXT NOT NULL DEFAULT ''`,
+			`CREATE TABLE IF NOT EXISTS page_reminders (
+				pagepath TEXT PRIMARY KEY,
+				revision TEXT NOT NULL,
+				reminded_at INTEGER NOT NULL
+			)`,
+		} {
+			if _, err := conn.ExecContext(ctx, stmt); err != nil {
+				return err
+			}
+		}
+		return nil
+	}},
+	{24, "create page_visibility table", func(ctx context.Context, conn *sql.DB) error {
+		// The visibility of the pages that differ from the site's read
+		// access, and who set it.
+		_, err := conn.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS page_visibility (
+			pagepath TEXT PRIMARY KEY,
+			visibility TEXT NOT NULL,
+			changed_by_name TEXT NOT NULL DEFAULT '',
+			changed_by_email TEXT NOT NULL DEFAULT '',
+			changed_at INTEGER NOT NULL
+		)`)
+		return err
+	}},
+	{25, "add page noindex flags", func(ctx context.Context, conn *sql.DB) error {
+		// noindex is 1 for a page whose frontmatter keeps it out of search
+		// engines, the sitemap, and feeds. Forgetting the cache's head
+		// rebuilds it, filling the column in.
+		for _, stmt := range []string{
+			`ALTER TABLE page_metadata ADD COLUMN noindex INTEGER NOT NULL DEFAULT 0`,
+			`DELETE FROM preferences WHERE name = 'page_metadata_head'`,
+		} {
+			if _, err := conn.ExecContext(ctx, stmt); err != nil {
+				return err
+			}
+		}
+		return nil
+	}},
+	{26, "create page_views table", func(ctx context.Context, conn *sql.DB) error {
+		// The number of views of each page per day, UTC; nothing about
+		// who viewed it.
+		_, err := conn.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS page_views (
+			pagepath TEXT NOT NULL,
+			day TEXT NOT NULL,
+			views INTEGER NOT NULL DEFAULT 0,
+			PRIMARY KEY (pagepath, day)
+		)`)
+		return err
+	}},
+	{27, "create page_checks table", func(ctx context.Context, conn *sql.DB) error {
+		// The findings of the checks run on each revision of a page as it
+		// was saved; a revision without any passed them.
+		for _, stmt := range []string{
+			`CREATE TABLE IF NOT EXISTS page_checks (
+				pagepath TEXT NOT NULL,
+				revision TEXT NOT NULL,
+				check_name TEXT NOT NULL,
+				line INTEGER NOT NULL DEFAULT 0,
+				message TEXT NOT NULL,
+				checked_at INTEGER NOT NULL
+			)`,
+			`CREATE INDEX IF NOT EXISTS idx_page_checks_page ON page_checks(pagepath, revision)`,
+		} {
+			if _, err := conn.ExecContext(ctx, stmt); err != nil {
+				return err
+			}
+		}
+		return nil
+	}},
+	{28, "create external link tables", func(ctx context.Context, conn *sql.DB) error {
+		// The links of each page to other sites, and how each URL answered
+		// when it was last checked.
+		for _, stmt := range []string{
+			`CREATE TABLE IF NOT EXISTS page_external_links (
+				pagepath TEXT NOT NULL,
+				url TEXT NOT NULL,
+				PRIMARY KEY (pagepath, url)
+			)`,
+			`CREATE INDEX IF NOT EXISTS idx_page_external_links_url ON page_external_links(url)`,
+			`CREATE TABLE IF NOT EXISTS external_links (
+				url TEXT PRIMARY KEY,
+				status INTEGER NOT NULL DEFAULT 0,
+				error TEXT NOT NULL DEFAULT '',
+				blocked INTEGER NOT NULL DEFAULT 0,
+				checked_at INTEGER NOT NULL
+			)`,
+		} {
+			if _, err := conn.ExecContext(ctx, stmt); err != nil {
+				return err
+			}
+		}
+		return nil
+	}},
+	{29, "create recent_pages table", func(ctx context.Context, conn *sql.DB) error {
+		// The pages each user viewed last, for the quick switcher.
+		_, err := conn.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS recent_pages (
+			user_id INTEGER NOT NULL,
+			pagepath TEXT NOT NULL,
+			viewed_at INTEGER NOT NULL,
+			PRIMARY KEY (user_id, pagepath)
+		)`)
+		return err
+	}},
+	{30, "create bookmarks table", func(ctx context.Context, conn *sql.DB) error {
+		// The pages each user pinned.
+		_, err := conn.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS bookmarks (
+			user_id INTEGER NOT NULL,
+			pagepath TEXT NOT NULL,
+			created_at INTEGER NOT NULL,
+			PRIMARY KEY (user_id, pagepath)
+		)`)
+		return err
+	}},
+	{31, "create announcement tables", func(ctx context.Context, conn *sql.DB) error {
+		// The banners admins post for the whole site, and which of them each
+		// user dismissed.
+		for _, stmt := range []string{
+			`CREATE TABLE IF NOT EXISTS announcements (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				message TEXT NOT NULL,
+				severity TEXT NOT NULL,
+				starts_at INTEGER,
+				ends_at INTEGER,
+				dismissible INTEGER NOT NULL DEFAULT 1,
+				created_by TEXT NOT NULL DEFAULT '',
+				created_at INTEGER NOT NULL,
+				updated_at INTEGER NOT NULL
+			)`,
+			`CREATE TABLE IF NOT EXISTS announcement_dismissals (
+				user_id INTEGER NOT NULL,
+				announcement_id INTEGER NOT NULL,
+				dismissed_at INTEGER NOT NULL,
+				PRIMARY KEY (user_id, announcement_id)
+			)`,
+		} {
+			if _, err := conn.ExecContext(ctx, stmt); err != nil {
+				return err
+			}
+		}
+		return nil
+	}},
 }
 
 // runMigrations runs versioned schema migrations, tracking progress
@@ -315,11 +725,13 @@ type PageSearchResult struct {
 	Rank     float64
 }
 
-// PageIndexData holds data for indexing a page.
+// PageIndexData holds data for indexing a page. Folded is the
+// diacritic-folded text matched in addition to the other columns.
 type PageIndexData struct {
 	Pagepath string
 	Title    string
 	Content  string
+	Folded   string
 }
 
 // Sentinel control characters mark the boundaries of a search hit inside the
@@ -333,9 +745,15 @@ const (
 
 // SearchPages searches the FTS5 index and returns ranked results with snippets.
 func (d *Database) SearchPages(ctx context.Context, query string, limit int) ([]PageSearchResult, error) {
-	rows, err := d.conn.QueryContext(ctx,
-		`SELECT pagepath, title, snippet(page_fts, 2, char(2), char(3), '...', 40) as snippet, rank FROM page_fts WHERE page_fts MATCH ? ORDER BY rank LIMIT ?`,
-		query, limit)
+	var rows *sql.Rows
+	var err error
+	if d.postgres {
+		rows, err = d.searchPagesPostgres(ctx, query, limit)
+	} else {
+		rows, err = d.conn.QueryContext(ctx,
+			`SELECT pagepath, title, snippet(page_fts, 2, char(2), char(3), '...', 40) as snippet, rank FROM page_fts WHERE page_fts MATCH ? ORDER BY rank LIMIT ?`,
+			query, limit)
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -358,7 +776,7 @@ func (d *Database) SearchPages(ctx context.Context, query string, limit int) ([]
 }
 
 // UpsertPageIndex inserts or replaces a page in the FTS5 index.
-func (d *Database) UpsertPageIndex(ctx context.Context, pagepath, title, content string) error {
+func (d *Database) UpsertPageIndex(ctx context.Context, pagepath, title, content, folded string) error {
 	tx, err := d.conn.BeginTx(ctx, nil)
 	if err != nil {
 		return err
@@ -368,7 +786,7 @@ func (d *Database) UpsertPageIndex(ctx context.Context, pagepath, title, content
 	if _, err := tx.ExecContext(ctx, `DELETE FROM page_fts WHERE pagepath = ?`, pagepath); err != nil {
 		return err
 	}
-	if _, err := tx.ExecContext(ctx, `INSERT INTO page_fts(pagepath, title, content) VALUES(?, ?, ?)`, pagepath, title, content); err != nil {
+	if _, err := tx.ExecContext(ctx, `INSERT INTO page_fts(pagepath, title, content, folded) VALUES(?, ?, ?, ?)`, pagepath, title, content, folded); err != nil {
 		return err
 	}
 	return tx.Commit()
@@ -380,6 +798,29 @@ func (d *Database) DeletePageIndex(ctx context.Context, pagepath string) error {
 	return err
 }
 
+// PageTitles returns the title of every page in the FTS5 index, by page path.
+func (d *Database) PageTitles(ctx context.Context) (map[string]string, error) {
+	rows, err := d.conn.QueryContext(ctx, `SELECT pagepath, title FROM page_fts`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	titles := make(map[string]string)
+	for rows.Next() {
+		var pagepath, title string
+		if err := rows.Scan(&pagepath, &title); err != nil {
+			return nil, err
+		}
+		titles[pagepath] = title
+	}
+	return titles, rows.Err()
+}
+
+// pageIndexBatch is the number of pages RebuildPageIndex inserts per
+// statement, well within SQLite's limit on bound parameters.
+const pageIndexBatch = 100
+
 // RebuildPageIndex replaces the entire FTS5 index with the given pages.
 func (d *Database) RebuildPageIndex(ctx context.Context, pages []PageIndexData) error {
 	tx, err := d.conn.BeginTx(ctx, nil)
@@ -392,14 +833,15 @@ func (d *Database) RebuildPageIndex(ctx context.Context, pages []PageIndexData)
 		return err
 	}
 
-	stmt, err := tx.PrepareContext(ctx, `INSERT INTO page_fts(pagepath, title, content) VALUES(?, ?, ?)`)
-	if err != nil {
-		return err
-	}
-	defer stmt.Close()
-
-	for _, p := range pages {
-		if _, err := stmt.ExecContext(ctx, p.Pagepath, p.Title, p.Content); err != nil {
+	for start := 0; start < len(pages); start += pageIndexBatch {
+		batch := pages[start:min(start+pageIndexBatch, len(pages))]
+		query := `INSERT INTO page_fts(pagepath, title, content, folded) VALUES ` +
+			strings.TrimSuffix(strings.Repeat("(?, ?, ?, ?), ", len(batch)), ", ")
+		args := make([]any, 0, 4*len(batch))
+		for _, p := range batch {
+			args = append(args, p.Pagepath, p.Title, p.Content, p.Folded)
+		}
+		if _, err := tx.ExecContext(ctx, query, args...); err != nil {
 			return err
 		}
 	}
@@ -420,7 +862,7 @@ func (d *Database) UpsertPageLinks(ctx context.Context, source string, targets [
 	}
 
 	if len(targets) > 0 {
-		stmt, err := tx.PrepareContext(ctx, `INSERT OR IGNORE INTO page_links(source_pagepath, target_pagepath) VALUES(?, ?)`)
+		stmt, err := tx.PrepareContext(ctx, `INSERT INTO page_links(source_pagepath, target_pagepath) VALUES(?, ?) ON CONFLICT DO NOTHING`)
 		if err != nil {
 			return err
 		}
@@ -462,12 +904,56 @@ func (d *Database) GetBacklinks(ctx context.Context, target string) ([]string, e
 	return sources, rows.Err()
 }
 
+// GetLinks returns all target pages that the given source links to.
+func (d *Database) GetLinks(ctx context.Context, source string) ([]string, error) {
+	rows, err := d.conn.QueryContext(ctx,
+		`SELECT target_pagepath FROM page_links WHERE source_pagepath = ? ORDER BY target_pagepath`, source)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var targets []string
+	for rows.Next() {
+		var t string
+		if err := rows.Scan(&t); err != nil {
+			return nil, err
+		}
+		targets = append(targets, t)
+	}
+	return targets, rows.Err()
+}
+
 // PageLinkData holds data for rebuilding page links.
 type PageLinkData struct {
 	Source  string
 	Targets []string
 }
 
+// ListPageLinks returns the outgoing links of every page that has any,
+// ordered by source and target.
+func (d *Database) ListPageLinks(ctx context.Context) ([]PageLinkData, error) {
+	rows, err := d.conn.QueryContext(ctx,
+		`SELECT source_pagepath, target_pagepath FROM page_links ORDER BY source_pagepath, target_pagepath`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var links []PageLinkData
+	for rows.Next() {
+		var source, target string
+		if err := rows.Scan(&source, &target); err != nil {
+			return nil, err
+		}
+		if len(links) == 0 || links[len(links)-1].Source != source {
+			links = append(links, PageLinkData{Source: source})
+		}
+		links[len(links)-1].Targets = append(links[len(links)-1].Targets, target)
+	}
+	return links, rows.Err()
+}
+
 // RebuildPageLinks replaces the entire page_links table with the given data.
 func (d *Database) RebuildPageLinks(ctx context.Context, links []PageLinkData) error {
 	tx, err := d.conn.BeginTx(ctx, nil)
@@ -480,7 +966,7 @@ func (d *Database) RebuildPageLinks(ctx context.Context, links []PageLinkData) e
 		return err
 	}
 
-	stmt, err := tx.PrepareContext(ctx, `INSERT OR IGNORE INTO page_links(source_pagepath, target_pagepath) VALUES(?, ?)`)
+	stmt, err := tx.PrepareContext(ctx, `INSERT INTO page_links(source_pagepath, target_pagepath) VALUES(?, ?) ON CONFLICT DO NOTHING`)
 	if err != nil {
 		return err
 	}
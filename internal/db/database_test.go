@@ -3,6 +3,10 @@ package db
 import (
 	"context"
 	"database/sql"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"reflect"
 	"strings"
 	"testing"
 	"time"
@@ -60,9 +64,10 @@ func TestSchemaVersion(t *testing.T) {
 	if err != nil {
 		t.Fatalf("SchemaVersion failed: %v", err)
 	}
-	// Should be at the latest migration version (currently 6)
-	if version != 6 {
-		t.Errorf("SchemaVersion = %d, want 6", version)
+	// Should be at the latest migration version
+	latest := migrations[len(migrations)-1].version
+	if version != latest {
+		t.Errorf("SchemaVersion = %d, want %d", version, latest)
 	}
 }
 
@@ -79,8 +84,9 @@ func TestMigrateIdempotent(t *testing.T) {
 	if err != nil {
 		t.Fatalf("SchemaVersion failed: %v", err)
 	}
-	if version != 6 {
-		t.Errorf("SchemaVersion after re-migrate = %d, want 6", version)
+	latest := migrations[len(migrations)-1].version
+	if version != latest {
+		t.Errorf("SchemaVersion after re-migrate = %d, want %d", version, latest)
 	}
 }
 
@@ -89,7 +95,7 @@ func TestMigrateCreatesExpectedTables(t *testing.T) {
 	ctx := context.Background()
 
 	// Verify migration-created tables exist
-	migrationTables := []string{"page_fts", "page_links", "schema_version"}
+	migrationTables := []string{"page_fts", "page_links", "schema_version", "user_fields", "user_field_values", "password_resets", "user_sessions", "user_preferences"}
 	for _, table := range migrationTables {
 		var count int
 		err := database.Conn().QueryRowContext(ctx,
@@ -447,13 +453,50 @@ func TestUpsertDraftUpdatesInPlace(t *testing.T) {
 	}
 }
 
+func TestListAndPruneDrafts(t *testing.T) {
+	database := openTestDB(t)
+	ctx := context.Background()
+
+	now := time.Now()
+	save := func(pagepath, email string, at time.Time) {
+		t.Helper()
+		if err := database.Queries.UpsertDraft(ctx, UpsertDraftParams{
+			Pagepath:    NullString(pagepath),
+			AuthorEmail: NullString(email),
+			Content:     NullString("draft of " + pagepath),
+			Datetime:    NullTime(at),
+		}); err != nil {
+			t.Fatalf("UpsertDraft(%s) failed: %v", pagepath, err)
+		}
+	}
+	save("old", "alice@example.com", now.Add(-40*24*time.Hour))
+	save("new", "alice@example.com", now.Add(-time.Hour))
+	save("other", "bob@example.com", now)
+
+	drafts, err := database.Queries.ListDraftsByAuthor(ctx, NullString("alice@example.com"))
+	if err != nil {
+		t.Fatalf("ListDraftsByAuthor failed: %v", err)
+	}
+	if len(drafts) != 2 || drafts[0].Pagepath.String != "new" || drafts[1].Pagepath.String != "old" {
+		t.Fatalf("drafts = %+v, want alice's, newest first", drafts)
+	}
+
+	if err := database.Queries.DeleteDraftsBefore(ctx, NullTime(now.Add(-30*24*time.Hour))); err != nil {
+		t.Fatalf("DeleteDraftsBefore failed: %v", err)
+	}
+	drafts, _ = database.Queries.ListDraftsByAuthor(ctx, NullString("alice@example.com"))
+	if len(drafts) != 1 || drafts[0].Pagepath.String != "new" {
+		t.Errorf("drafts after pruning = %+v, want only the recent one", drafts)
+	}
+}
+
 func TestSearchPagesEscapesSnippet(t *testing.T) {
 	database := openTestDB(t)
 	ctx := context.Background()
 
 	// Page content carrying an XSS payload adjacent to a searchable term.
 	const payload = `alpha bravo <img src=x onerror=alert(1)> charlie`
-	if err := database.UpsertPageIndex(ctx, "evil", "Evil", payload); err != nil {
+	if err := database.UpsertPageIndex(ctx, "evil", "Evil", payload, ""); err != nil {
 		t.Fatalf("UpsertPageIndex failed: %v", err)
 	}
 
@@ -530,6 +573,12 @@ func TestPageLinksCRUD(t *testing.T) {
 			t.Errorf("expected [faq home], got %v", backlinks)
 		}
 
+		// Get links of "home" -- should be "about" and "guide"
+		links, err := database.GetLinks(ctx, "home")
+		if err != nil || len(links) != 2 || links[0] != "about" || links[1] != "guide" {
+			t.Errorf("GetLinks(home) = %v, %v; want [about guide]", links, err)
+		}
+
 		// Get backlinks for "guide" -- should be "home" only
 		backlinks, err = database.GetBacklinks(ctx, "guide")
 		if err != nil {
@@ -540,6 +589,14 @@ func TestPageLinksCRUD(t *testing.T) {
 		}
 	})
 
+	t.Run("list links", func(t *testing.T) {
+		links, err := database.ListPageLinks(ctx)
+		want := []PageLinkData{{Source: "faq", Targets: []string{"about"}}, {Source: "home", Targets: []string{"about", "guide"}}}
+		if err != nil || !reflect.DeepEqual(links, want) {
+			t.Errorf("ListPageLinks = %v, %v; want %v", links, err, want)
+		}
+	})
+
 	t.Run("upsert replaces old links", func(t *testing.T) {
 		// Update "home" to only link to "contact"
 		err := database.UpsertPageLinks(ctx, "home", []string{"contact"})
@@ -639,3 +696,875 @@ func TestDeleteIssue(t *testing.T) {
 		t.Error("GetIssue should fail after delete")
 	}
 }
+
+func TestUserFieldValues(t *testing.T) {
+	database := openTestDB(t)
+	ctx := context.Background()
+
+	user, _ := database.Queries.CreateUser(ctx, CreateUserParams{
+		Name:  "Field User",
+		Email: "fields@example.com",
+	})
+
+	dept, err := database.CreateUserField(ctx, "department", "Department")
+	if err != nil {
+		t.Fatalf("CreateUserField failed: %v", err)
+	}
+	if _, err := database.CreateUserField(ctx, "location", "Location"); err != nil {
+		t.Fatalf("CreateUserField failed: %v", err)
+	}
+	if _, err := database.CreateUserField(ctx, "department", "Dup"); err == nil {
+		t.Error("CreateUserField should reject a duplicate name")
+	}
+
+	fields, err := database.ListUserFields(ctx)
+	if err != nil {
+		t.Fatalf("ListUserFields failed: %v", err)
+	}
+	if len(fields) != 2 || fields[0].Name != "department" || fields[1].Name != "location" {
+		t.Fatalf("ListUserFields = %+v, want department then location", fields)
+	}
+
+	err = database.SetUserFieldValues(ctx, user.ID, map[string]string{
+		"department": "Engineering",
+		"location":   "Berlin",
+		"unknown":    "ignored",
+	})
+	if err != nil {
+		t.Fatalf("SetUserFieldValues failed: %v", err)
+	}
+
+	values, err := database.GetUserFieldValues(ctx, user.ID)
+	if err != nil {
+		t.Fatalf("GetUserFieldValues failed: %v", err)
+	}
+	if len(values) != 2 || values["department"] != "Engineering" || values["location"] != "Berlin" {
+		t.Errorf("GetUserFieldValues = %v", values)
+	}
+
+	// Empty value clears the field
+	if err := database.SetUserFieldValues(ctx, user.ID, map[string]string{"location": ""}); err != nil {
+		t.Fatalf("SetUserFieldValues failed: %v", err)
+	}
+	all, err := database.ListAllUserFieldValues(ctx)
+	if err != nil {
+		t.Fatalf("ListAllUserFieldValues failed: %v", err)
+	}
+	if _, ok := all[user.ID]["location"]; ok {
+		t.Error("empty value should clear the field")
+	}
+
+	// Deleting a definition removes its values
+	if err := database.DeleteUserField(ctx, dept.ID); err != nil {
+		t.Fatalf("DeleteUserField failed: %v", err)
+	}
+	values, _ = database.GetUserFieldValues(ctx, user.ID)
+	if len(values) != 0 {
+		t.Errorf("values after field delete = %v, want empty", values)
+	}
+	if err := database.DeleteUserField(ctx, dept.ID); err != sql.ErrNoRows {
+		t.Errorf("DeleteUserField on missing field = %v, want sql.ErrNoRows", err)
+	}
+}
+
+func TestPasswordResets(t *testing.T) {
+	database := openTestDB(t)
+	ctx := context.Background()
+
+	user, _ := database.Queries.CreateUser(ctx, CreateUserParams{
+		Name:  "Reset User",
+		Email: "reset@example.com",
+	})
+
+	if err := database.CreatePasswordReset(ctx, user.ID, "live", time.Now().Add(time.Hour)); err != nil {
+		t.Fatalf("CreatePasswordReset failed: %v", err)
+	}
+	if err := database.CreatePasswordReset(ctx, user.ID, "stale", time.Now().Add(-time.Hour)); err != nil {
+		t.Fatalf("CreatePasswordReset failed: %v", err)
+	}
+
+	if id, err := database.PasswordResetUser(ctx, "live"); err != nil || id != user.ID {
+		t.Errorf("PasswordResetUser(live) = %d, %v; want %d", id, err, user.ID)
+	}
+	if _, err := database.PasswordResetUser(ctx, "stale"); err != sql.ErrNoRows {
+		t.Errorf("PasswordResetUser(stale) = %v, want sql.ErrNoRows", err)
+	}
+	if _, err := database.ConsumePasswordReset(ctx, "stale"); err != sql.ErrNoRows {
+		t.Errorf("ConsumePasswordReset(stale) = %v, want sql.ErrNoRows", err)
+	}
+
+	// A token works once
+	if id, err := database.ConsumePasswordReset(ctx, "live"); err != nil || id != user.ID {
+		t.Errorf("ConsumePasswordReset(live) = %d, %v; want %d", id, err, user.ID)
+	}
+	if _, err := database.ConsumePasswordReset(ctx, "live"); err != sql.ErrNoRows {
+		t.Errorf("second ConsumePasswordReset = %v, want sql.ErrNoRows", err)
+	}
+
+	if err := database.CreatePasswordReset(ctx, user.ID, "again", time.Now().Add(time.Hour)); err != nil {
+		t.Fatalf("CreatePasswordReset failed: %v", err)
+	}
+	if err := database.DeletePasswordResets(ctx, user.ID); err != nil {
+		t.Fatalf("DeletePasswordResets failed: %v", err)
+	}
+	if _, err := database.PasswordResetUser(ctx, "again"); err != sql.ErrNoRows {
+		t.Errorf("PasswordResetUser after delete = %v, want sql.ErrNoRows", err)
+	}
+}
+
+func TestUserSessions(t *testing.T) {
+	database := openTestDB(t)
+	ctx := context.Background()
+
+	alice, _ := database.Queries.CreateUser(ctx, CreateUserParams{Name: "Alice", Email: "alice@example.com"})
+	bob, _ := database.Queries.CreateUser(ctx, CreateUserParams{Name: "Bob", Email: "bob@example.com"})
+
+	first, err := database.CreateUserSession(ctx, "a1", alice.ID, "Firefox", "10.0.0.1")
+	if err != nil {
+		t.Fatalf("CreateUserSession failed: %v", err)
+	}
+	if _, err := database.CreateUserSession(ctx, "a2", alice.ID, "Chrome", "10.0.0.2"); err != nil {
+		t.Fatalf("CreateUserSession failed: %v", err)
+	}
+	if _, err := database.CreateUserSession(ctx, "b1", bob.ID, "Safari", "10.0.0.3"); err != nil {
+		t.Fatalf("CreateUserSession failed: %v", err)
+	}
+
+	sess, err := database.GetUserSession(ctx, "a1")
+	if err != nil || sess.ID != first || sess.UserID != alice.ID || sess.UserAgent != "Firefox" {
+		t.Errorf("GetUserSession = %+v, %v", sess, err)
+	}
+	if err := database.TouchUserSession(ctx, "a1", "10.0.0.9"); err != nil {
+		t.Fatalf("TouchUserSession failed: %v", err)
+	}
+	if sess, _ := database.GetUserSession(ctx, "a1"); sess.IP != "10.0.0.9" {
+		t.Errorf("IP after touch = %q, want 10.0.0.9", sess.IP)
+	}
+
+	list, err := database.ListUserSessions(ctx, alice.ID)
+	if err != nil || len(list) != 2 {
+		t.Fatalf("ListUserSessions = %+v, %v; want 2 sessions", list, err)
+	}
+
+	// A user cannot revoke someone else's session
+	if err := database.DeleteUserSession(ctx, bob.ID, first); err != sql.ErrNoRows {
+		t.Errorf("DeleteUserSession of another user's session = %v, want sql.ErrNoRows", err)
+	}
+	if err := database.DeleteUserSession(ctx, alice.ID, first); err != nil {
+		t.Errorf("DeleteUserSession failed: %v", err)
+	}
+	if _, err := database.GetUserSession(ctx, "a1"); err != sql.ErrNoRows {
+		t.Errorf("GetUserSession after delete = %v, want sql.ErrNoRows", err)
+	}
+
+	second, _ := database.CreateUserSession(ctx, "a3", alice.ID, "Edge", "10.0.0.4")
+	if n, err := database.DeleteUserSessionsExcept(ctx, alice.ID, second); err != nil || n != 1 {
+		t.Errorf("DeleteUserSessionsExcept = %d, %v; want 1", n, err)
+	}
+	if _, err := database.GetUserSession(ctx, "a3"); err != nil {
+		t.Errorf("DeleteUserSessionsExcept revoked the session kept: %v", err)
+	}
+	if n, err := database.DeleteUserSessions(ctx, alice.ID); err != nil || n != 1 {
+		t.Errorf("DeleteUserSessions = %d, %v; want 1", n, err)
+	}
+	if err := database.PruneUserSessions(ctx, time.Now().Add(time.Hour)); err != nil {
+		t.Fatalf("PruneUserSessions failed: %v", err)
+	}
+	if _, err := database.GetUserSession(ctx, "b1"); err != sql.ErrNoRows {
+		t.Errorf("session should have been pruned, got %v", err)
+	}
+}
+
+func TestUserPreferences(t *testing.T) {
+	database := openTestDB(t)
+	ctx := context.Background()
+
+	alice, _ := database.Queries.CreateUser(ctx, CreateUserParams{Name: "Alice", Email: "alice@example.com"})
+	if v, err := database.GetUserPreference(ctx, alice.ID, UserPrefColorScheme); err != nil || v != "" {
+		t.Errorf("unset preference = %q, %v; want empty", v, err)
+	}
+	for _, want := range []string{"dark", "light"} {
+		if err := database.SetUserPreference(ctx, alice.ID, UserPrefColorScheme, want); err != nil {
+			t.Fatalf("SetUserPreference failed: %v", err)
+		}
+		if v, _ := database.GetUserPreference(ctx, alice.ID, UserPrefColorScheme); v != want {
+			t.Errorf("preference = %q, want %q", v, want)
+		}
+	}
+	if err := database.SetUserPreference(ctx, alice.ID, UserPrefColorScheme, ""); err != nil {
+		t.Fatalf("unsetting failed: %v", err)
+	}
+	if v, _ := database.GetUserPreference(ctx, alice.ID, UserPrefColorScheme); v != "" {
+		t.Errorf("preference after unsetting = %q", v)
+	}
+
+	database.SetUserPreference(ctx, alice.ID, UserPrefColorScheme, "dark")
+	database.SetUserPreference(ctx, alice.ID, UserPrefPageSize, "25")
+	if prefs, err := database.ListUserPreferences(ctx, alice.ID); err != nil || len(prefs) != 2 || prefs[UserPrefColorScheme] != "dark" || prefs[UserPrefPageSize] != "25" {
+		t.Errorf("ListUserPreferences = %v, %v", prefs, err)
+	}
+	if err := database.Queries.DeleteUser(ctx, alice.ID); err != nil {
+		t.Fatal(err)
+	}
+	var n int
+	database.Conn().QueryRowContext(ctx, "SELECT COUNT(*) FROM user_preferences").Scan(&n)
+	if n != 0 {
+		t.Errorf("%d preferences outlived their user", n)
+	}
+}
+
+func TestPageMetadata(t *testing.T) {
+	database := openTestDB(t)
+	ctx := context.Background()
+	when := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+
+	home := PageMetadata{Pagepath: "home", Filename: "home.md", Title: "Home", Revision: "abc123", AuthorName: "Alice", AuthorEmail: "alice@example.com", Created: when, Updated: when.Add(time.Hour), Size: 42}
+	if err := database.RebuildPageMetadata(ctx, []PageMetadata{home, {Pagepath: "about", Filename: "about.md"}}); err != nil {
+		t.Fatalf("RebuildPageMetadata failed: %v", err)
+	}
+	if got, err := database.GetPageMetadata(ctx, "home"); err != nil || got == nil || *got != home {
+		t.Errorf("GetPageMetadata = %+v, %v; want %+v", got, err, home)
+	}
+	if got, err := database.GetPageMetadata(ctx, "missing"); err != nil || got != nil {
+		t.Errorf("GetPageMetadata of a missing page = %+v, %v; want nil", got, err)
+	}
+
+	home.Title, home.Size = "Welcome", 7
+	if err := database.UpsertPageMetadata(ctx, home); err != nil {
+		t.Fatalf("UpsertPageMetadata failed: %v", err)
+	}
+	if err := database.DeletePageMetadata(ctx, "about"); err != nil {
+		t.Fatalf("DeletePageMetadata failed: %v", err)
+	}
+	pages, err := database.ListPageMetadata(ctx)
+	if err != nil || len(pages) != 1 || pages[0] != home {
+		t.Errorf("ListPageMetadata = %+v, %v; want the updated home page only", pages, err)
+	}
+}
+
+func TestRepositoryMaintenance(t *testing.T) {
+	database := openTestDB(t)
+	ctx := context.Background()
+	when := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+
+	for i := 0; i < 3; i++ {
+		run := RepositoryMaintenance{RanAt: when.Add(time.Duration(i) * 24 * time.Hour), SizeBefore: 2000, SizeAfter: int64(1000 + i), Packs: 1, Duration: 1500 * time.Millisecond}
+		if err := database.RecordRepositoryMaintenance(ctx, run); err != nil {
+			t.Fatalf("RecordRepositoryMaintenance failed: %v", err)
+		}
+	}
+	runs, err := database.ListRepositoryMaintenance(ctx, 2)
+	if err != nil || len(runs) != 2 {
+		t.Fatalf("ListRepositoryMaintenance = %+v, %v; want 2 runs", runs, err)
+	}
+	want := RepositoryMaintenance{RanAt: when.Add(48 * time.Hour), SizeBefore: 2000, SizeAfter: 1002, Packs: 1, Duration: 1500 * time.Millisecond}
+	if runs[0] != want || runs[1].SizeAfter != 1001 {
+		t.Errorf("ListRepositoryMaintenance = %+v; want the latest first, %+v", runs, want)
+	}
+}
+
+func TestModerationQueue(t *testing.T) {
+	database := openTestDB(t)
+	ctx := context.Background()
+	when := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+
+	item := ModerationItem{Kind: "page", Target: "home", Content: "cheap pills", Payload: `{"message":"Update"}`, AuthorName: "Anonymous", ClientIP: "192.0.2.1", Reason: "blocklist", CreatedAt: when}
+	id, err := database.QueueModeration(ctx, item)
+	if err != nil {
+		t.Fatalf("QueueModeration failed: %v", err)
+	}
+	if _, err := database.QueueModeration(ctx, ModerationItem{Kind: "issue", Title: "Casino", CreatedAt: when}); err != nil {
+		t.Fatalf("QueueModeration failed: %v", err)
+	}
+
+	item.ID = id
+	if got, err := database.GetModeration(ctx, id); err != nil || got != item {
+		t.Errorf("GetModeration = %+v, %v; want %+v", got, err, item)
+	}
+	items, err := database.ListModeration(ctx)
+	if err != nil || len(items) != 2 || items[0].ID != id || items[1].Title != "Casino" {
+		t.Errorf("ListModeration = %+v, %v; want both, oldest first", items, err)
+	}
+
+	if err := database.DeleteModeration(ctx, id); err != nil {
+		t.Fatalf("DeleteModeration failed: %v", err)
+	}
+	if _, err := database.GetModeration(ctx, id); err != sql.ErrNoRows {
+		t.Errorf("GetModeration after delete = %v, want sql.ErrNoRows", err)
+	}
+	if n, err := database.CountModeration(ctx); err != nil || n != 1 {
+		t.Errorf("CountModeration = %d, %v; want 1", n, err)
+	}
+}
+
+func TestNotifications(t *testing.T) {
+	database := openTestDB(t)
+	ctx := context.Background()
+	when := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+
+	first := Notification{UserID: 1, Kind: NotificationMention, IssueID: 3, Title: "Broken link", Excerpt: "@alice look", ActorName: "Bob", CreatedAt: when}
+	id, err := database.CreateNotification(ctx, first)
+	if err != nil {
+		t.Fatalf("CreateNotification failed: %v", err)
+	}
+	if _, err := database.CreateNotification(ctx, Notification{UserID: 1, Kind: NotificationMention, IssueID: 3, CommentID: 7, CreatedAt: when}); err != nil {
+		t.Fatalf("CreateNotification failed: %v", err)
+	}
+	if _, err := database.CreateNotification(ctx, Notification{UserID: 2, Kind: NotificationMention, CreatedAt: when}); err != nil {
+		t.Fatalf("CreateNotification failed: %v", err)
+	}
+
+	first.ID = id
+	if got, err := database.GetNotification(ctx, 1, id); err != nil || got != first || !got.Unread() {
+		t.Errorf("GetNotification = %+v, %v; want %+v", got, err, first)
+	}
+	if _, err := database.GetNotification(ctx, 2, id); err != sql.ErrNoRows {
+		t.Errorf("GetNotification of another user's notification = %v, want sql.ErrNoRows", err)
+	}
+	list, err := database.ListNotifications(ctx, 1, 10)
+	if err != nil || len(list) != 2 || list[0].CommentID != 7 {
+		t.Errorf("ListNotifications = %+v, %v; want both of user 1, newest first", list, err)
+	}
+
+	if err := database.MarkNotificationRead(ctx, 1, id); err != nil {
+		t.Fatalf("MarkNotificationRead failed: %v", err)
+	}
+	if n, err := database.CountUnreadNotifications(ctx, 1); err != nil || n != 1 {
+		t.Errorf("CountUnreadNotifications = %d, %v; want 1", n, err)
+	}
+	if err := database.MarkAllNotificationsRead(ctx, 1); err != nil {
+		t.Fatalf("MarkAllNotificationsRead failed: %v", err)
+	}
+	if n, _ := database.CountUnreadNotifications(ctx, 1); n != 0 {
+		t.Errorf("CountUnreadNotifications after marking all read = %d, want 0", n)
+	}
+	if n, _ := database.CountUnreadNotifications(ctx, 2); n != 1 {
+		t.Errorf("another user's unread count = %d, want 1", n)
+	}
+}
+
+func TestIssueViews(t *testing.T) {
+	database := openTestDB(t)
+	ctx := context.Background()
+	when := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+
+	for _, v := range []IssueView{
+		{UserID: 1, Name: "Open bugs", Query: "status=open", CreatedAt: when},
+		{UserID: 1, Name: "Mine", Query: "q=login", CreatedAt: when},
+		{UserID: 2, Name: "Open bugs", Query: "status=closed", CreatedAt: when},
+		{UserID: 1, Name: "Open bugs", Query: "status=open&tag=bug", CreatedAt: when},
+	} {
+		if err := database.SaveIssueView(ctx, v); err != nil {
+			t.Fatalf("SaveIssueView(%+v) failed: %v", v, err)
+		}
+	}
+
+	views, err := database.ListIssueViews(ctx, 1)
+	if err != nil || len(views) != 2 || views[0].Name != "Mine" || views[1].Query != "status=open&tag=bug" {
+		t.Fatalf("ListIssueViews = %+v, %v; want both of user 1 by name, the second replaced", views, err)
+	}
+	if v, err := database.GetIssueView(ctx, 2, "Open bugs"); err != nil || v.Query != "status=closed" {
+		t.Errorf("GetIssueView = %+v, %v", v, err)
+	}
+
+	if err := database.DeleteIssueView(ctx, 2, views[0].ID); err != nil {
+		t.Fatalf("DeleteIssueView failed: %v", err)
+	}
+	if _, err := database.GetIssueView(ctx, 1, "Mine"); err != nil {
+		t.Errorf("another user deleted the view: %v", err)
+	}
+	if err := database.DeleteIssueView(ctx, 1, views[0].ID); err != nil {
+		t.Fatalf("DeleteIssueView failed: %v", err)
+	}
+	if _, err := database.GetIssueView(ctx, 1, "Mine"); err != sql.ErrNoRows {
+		t.Errorf("GetIssueView after delete = %v, want sql.ErrNoRows", err)
+	}
+}
+
+func TestOpenEncrypted_RequiresSQLCipher(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "wiki.db")
+	key := make([]byte, 32)
+
+	database, err := OpenEncrypted("sqlite:///"+path, key)
+	if err == nil {
+		// Built against SQLCipher: the database must be unreadable without the key.
+		defer database.Close()
+		if err := database.Migrate(context.Background()); err != nil {
+			t.Fatalf("Migrate: %v", err)
+		}
+		plain, err := Open("sqlite:///" + path)
+		if err == nil {
+			defer plain.Close()
+			if _, err := plain.conn.Exec("SELECT count(*) FROM sqlite_master"); err == nil {
+				t.Error("encrypted database should not be readable without the key")
+			}
+		}
+		return
+	}
+	if !errors.Is(err, ErrSQLCipherUnavailable) {
+		t.Errorf("OpenEncrypted error = %v, want ErrSQLCipherUnavailable", err)
+	}
+
+	if _, err := OpenEncrypted("sqlite:///:memory:", key); err == nil {
+		t.Error("OpenEncrypted should reject an in-memory database")
+	}
+	if _, err := OpenEncrypted("sqlite:///"+path, key[:16]); err == nil {
+		t.Error("OpenEncrypted should reject a short key")
+	}
+}
+
+func TestAuditLog(t *testing.T) {
+	database := openTestDB(t)
+	ctx := context.Background()
+	when := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+
+	if err := database.AddAuditEntry(ctx, nil, AuditEntry{Action: "issues.close", Detail: "#1, #2", ActorName: "Alice", CreatedAt: when}); err != nil {
+		t.Fatalf("AddAuditEntry failed: %v", err)
+	}
+
+	// An entry written in a transaction that is rolled back is not kept.
+	tx, err := database.BeginTx(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := database.AddAuditEntry(ctx, tx, AuditEntry{Action: "issues.delete", CreatedAt: when.Add(time.Hour)}); err != nil {
+		t.Fatalf("AddAuditEntry in tx failed: %v", err)
+	}
+	tx.Rollback()
+
+	tx, err = database.BeginTx(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := database.AddAuditEntry(ctx, tx, AuditEntry{Action: "issues.reopen", Detail: "#2", CreatedAt: when.Add(time.Minute)}); err != nil {
+		t.Fatalf("AddAuditEntry in tx failed: %v", err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := database.ListAuditEntries(ctx, 10)
+	if err != nil || len(entries) != 2 || entries[0].Action != "issues.reopen" || entries[1].ActorName != "Alice" || !entries[1].CreatedAt.Equal(when) {
+		t.Errorf("ListAuditEntries = %+v, %v; want the two committed entries, newest first", entries, err)
+	}
+}
+
+func TestEditIssueComment(t *testing.T) {
+	database := openTestDB(t)
+	ctx := context.Background()
+	when := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+
+	issue, err := database.Queries.CreateIssue(ctx, CreateIssueParams{Title: "Issue", Status: "open"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	comment, err := database.Queries.CreateIssueComment(ctx, CreateIssueCommentParams{IssueID: issue.ID, Content: "First", CreatedAt: NullTime(when), UpdatedAt: NullTime(when)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, content := range []string{"Second", "Third"} {
+		edited, err := database.EditIssueComment(ctx, comment.ID, content, "Bob", "bob@example.com", when.Add(time.Duration(i+1)*time.Hour))
+		if err != nil || edited.Content != content || !edited.UpdatedAt.Time.Equal(when.Add(time.Duration(i+1)*time.Hour)) {
+			t.Fatalf("EditIssueComment = %+v, %v", edited, err)
+		}
+	}
+
+	revisions, err := database.ListIssueCommentRevisions(ctx, comment.ID)
+	if err != nil || len(revisions) != 2 || revisions[0].Content != "Second" || revisions[1].Content != "First" || revisions[1].EditedByName != "Bob" {
+		t.Fatalf("ListIssueCommentRevisions = %+v, %v; want the earlier versions, newest first", revisions, err)
+	}
+	if counts, err := database.CountEditedIssueComments(ctx, issue.ID); err != nil || counts[comment.ID] != 2 {
+		t.Errorf("CountEditedIssueComments = %v, %v", counts, err)
+	}
+	if _, err := database.EditIssueComment(ctx, 999, "X", "", "", when); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("editing a missing comment: %v, want sql.ErrNoRows", err)
+	}
+
+	// Deleting the comment deletes its history.
+	if err := database.Queries.DeleteIssueComment(ctx, comment.ID); err != nil {
+		t.Fatal(err)
+	}
+	if revisions, _ := database.ListIssueCommentRevisions(ctx, comment.ID); len(revisions) != 0 {
+		t.Errorf("revisions of a deleted comment = %+v", revisions)
+	}
+}
+
+func TestUserAvatars(t *testing.T) {
+	database := openTestDB(t)
+	ctx := context.Background()
+	user, err := database.Queries.CreateUser(ctx, CreateUserParams{Name: "Alice", Email: "alice@example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	hash := AvatarEmailHash(" Alice@Example.COM")
+	if _, err := database.FindUserAvatar(ctx, hash); !errors.Is(err, sql.ErrNoRows) {
+		t.Fatalf("FindUserAvatar before an upload: %v, want sql.ErrNoRows", err)
+	}
+
+	when := time.Unix(1700000000, 0)
+	for _, data := range []string{"first", "second"} {
+		if err := database.SetUserAvatar(ctx, user.ID, []byte(data), when); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if a, err := database.GetUserAvatar(ctx, user.ID); err != nil || string(a.Data) != "second" || !a.UpdatedAt.Equal(when) {
+		t.Errorf("GetUserAvatar = %+v, %v", a, err)
+	}
+	if a, err := database.FindUserAvatar(ctx, hash); err != nil || a.UserID != user.ID || a.Data != nil {
+		t.Errorf("FindUserAvatar = %+v, %v", a, err)
+	}
+
+	if err := database.DeleteUserAvatar(ctx, user.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := database.GetUserAvatar(ctx, user.ID); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("GetUserAvatar after deletion: %v, want sql.ErrNoRows", err)
+	}
+}
+
+func TestScheduledPages(t *testing.T) {
+	database := openTestDB(t)
+	ctx := context.Background()
+	now := time.Unix(1700000000, 0)
+
+	schedule := func(pagepath string, at time.Time) int64 {
+		t.Helper()
+		id, err := database.SchedulePage(ctx, ScheduledPage{
+			Pagepath: pagepath, Content: "# " + pagepath, Message: "Publish " + pagepath,
+			AuthorName: "Alice", AuthorEmail: "alice@example.com", PublishAt: at, CreatedAt: now,
+		})
+		if err != nil {
+			t.Fatalf("SchedulePage(%s) failed: %v", pagepath, err)
+		}
+		return id
+	}
+	later := schedule("later", now.Add(time.Hour))
+	due := schedule("due", now.Add(-time.Minute))
+	failed := schedule("failed", now.Add(-time.Hour))
+	if err := database.FailScheduledPage(ctx, failed, "The page changed"); err != nil {
+		t.Fatal(err)
+	}
+
+	pages, err := database.DueScheduledPages(ctx, now)
+	if err != nil || len(pages) != 1 || pages[0].ID != due || pages[0].Content != "# due" || !pages[0].PublishAt.Equal(now.Add(-time.Minute)) {
+		t.Fatalf("DueScheduledPages = %+v, %v; want only the pending due one", pages, err)
+	}
+	pages, err = database.ListScheduledPages(ctx, "alice@example.com")
+	if err != nil || len(pages) != 3 || pages[0].ID != failed || pages[0].Error != "The page changed" || pages[2].ID != later {
+		t.Errorf("ListScheduledPages = %+v, %v; want all three, soonest first", pages, err)
+	}
+
+	if err := database.DeleteScheduledPage(ctx, due); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := database.GetScheduledPage(ctx, due); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("GetScheduledPage after deletion: %v, want sql.ErrNoRows", err)
+	}
+}
+
+func TestPageStatus(t *testing.T) {
+	database := openTestDB(t)
+	ctx := context.Background()
+	now := time.Unix(1700000000, 0)
+
+	set := func(pagepath, status string) {
+		t.Helper()
+		err := database.SetPageStatus(ctx, nil, PageStatus{
+			Pagepath: pagepath, Status: status, ChangedByName: "Alice", ChangedByEmail: "alice@example.com", ChangedAt: now,
+		})
+		if err != nil {
+			t.Fatalf("SetPageStatus(%s, %s) failed: %v", pagepath, status, err)
+		}
+	}
+	set("guide", PageStatusDraft)
+	set("guide", PageStatusApproved)
+	set("old", PageStatusDeprecated)
+	if p, err := database.GetPageStatus(ctx, "guide"); err != nil || p.Status != PageStatusApproved || !p.ChangedAt.Equal(now) {
+		t.Errorf("GetPageStatus = %+v, %v; want the latest status", p, err)
+	}
+	if _, err := database.GetPageStatus(ctx, "other"); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("GetPageStatus of a page without one: %v, want sql.ErrNoRows", err)
+	}
+
+	if err := database.MovePageStatus(ctx, "guide", "docs/guide"); err != nil {
+		t.Fatal(err)
+	}
+	set("old", "")
+	statuses, err := database.ListPageStatuses(ctx)
+	if err != nil || len(statuses) != 1 || statuses["docs/guide"].Status != PageStatusApproved {
+		t.Errorf("ListPageStatuses = %+v, %v; want only the moved one", statuses, err)
+	}
+}
+
+func TestPageViews(t *testing.T) {
+	database := openTestDB(t)
+	ctx := context.Background()
+	day := time.Date(2026, 10, 14, 23, 30, 0, 0, time.UTC)
+
+	for _, v := range []struct {
+		pagepath string
+		at       time.Time
+	}{
+		{"guide", day.AddDate(0, 0, -10)},
+		{"guide", day.AddDate(0, 0, -1)},
+		{"guide", day},
+		{"home", day},
+		{"home", day},
+		{"home", day.Add(time.Hour)}, // The next day, UTC
+		{"notes", day},
+	} {
+		if err := database.CountPageView(ctx, v.pagepath, v.at); err != nil {
+			t.Fatalf("CountPageView(%s) failed: %v", v.pagepath, err)
+		}
+	}
+
+	popular, err := database.PopularPages(ctx, day.AddDate(0, 0, -1), 2)
+	want := []PageViews{{Pagepath: "home", Views: 3}, {Pagepath: "guide", Views: 2}}
+	if err != nil || !reflect.DeepEqual(popular, want) {
+		t.Errorf("PopularPages = %+v, %v; want %+v", popular, err, want)
+	}
+
+	days, err := database.ListPageViewDays(ctx, day)
+	want = []PageViews{
+		{Pagepath: "guide", Day: "2026-10-14", Views: 1},
+		{Pagepath: "home", Day: "2026-10-14", Views: 2},
+		{Pagepath: "notes", Day: "2026-10-14", Views: 1},
+		{Pagepath: "home", Day: "2026-10-15", Views: 1},
+	}
+	if err != nil || !reflect.DeepEqual(days, want) {
+		t.Errorf("ListPageViewDays = %+v, %v; want %+v", days, err, want)
+	}
+}
+
+func TestPageChecks(t *testing.T) {
+	database := openTestDB(t)
+	ctx := context.Background()
+	at := time.Date(2026, 10, 14, 12, 0, 0, 0, time.UTC)
+
+	set := func(pagepath, revision string, findings ...PageCheck) {
+		t.Helper()
+		for i := range findings {
+			findings[i].Pagepath, findings[i].Revision, findings[i].CheckedAt = pagepath, revision, at
+		}
+		if err := database.SetPageChecks(ctx, pagepath, revision, findings); err != nil {
+			t.Fatalf("SetPageChecks(%s, %s) failed: %v", pagepath, revision, err)
+		}
+	}
+	set("guide", "aaa", PageCheck{Check: "links", Line: 3, Message: "old"})
+	set("guide", "bbb", PageCheck{Check: "headings", Line: 9, Message: "skip"}, PageCheck{Check: "links", Line: 2, Message: "broken"})
+	set("guide", "bbb", PageCheck{Check: "links", Line: 2, Message: "broken"}) // Replaces the run before
+	set("home", "ccc")
+
+	got, err := database.ListPageChecks(ctx, "guide", "bbb")
+	want := []PageCheck{{Pagepath: "guide", Revision: "bbb", Check: "links", Line: 2, Message: "broken", CheckedAt: at}}
+	if err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("ListPageChecks = %+v, %v; want %+v", got, err, want)
+	}
+
+	// Only the findings of the current revisions are current.
+	for _, m := range []PageMetadata{{Pagepath: "guide", Filename: "guide.md", Revision: "bbb"}, {Pagepath: "home", Filename: "home.md", Revision: "ccc"}} {
+		if err := database.UpsertPageMetadata(ctx, m); err != nil {
+			t.Fatal(err)
+		}
+	}
+	got, err = database.ListCurrentPageChecks(ctx)
+	if err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("ListCurrentPageChecks = %+v, %v; want %+v", got, err, want)
+	}
+}
+
+func TestExternalLinks(t *testing.T) {
+	database := openTestDB(t)
+	ctx := context.Background()
+	at := time.Date(2026, 10, 14, 12, 0, 0, 0, time.UTC)
+
+	err := database.SetPageExternalLinks(ctx, map[string][]string{
+		"home":  {"https://b.example.com/", "https://a.example.com/"},
+		"guide": {"https://a.example.com/"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, l := range []ExternalLink{
+		{URL: "https://a.example.com/", Status: 404, CheckedAt: at},
+		{URL: "https://b.example.com/", Status: 200, CheckedAt: at},
+	} {
+		if err := database.SetExternalLinkResult(ctx, l); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := database.SetExternalLinkResult(ctx, ExternalLink{URL: "https://a.example.com/", Blocked: true, CheckedAt: at}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Dropping a link forgets its result; a new one is not checked yet.
+	err = database.SetPageExternalLinks(ctx, map[string][]string{
+		"home":  {"https://a.example.com/", "https://c.example.com/"},
+		"guide": {"https://a.example.com/"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := database.ListExternalLinks(ctx)
+	want := []ExternalLink{
+		{URL: "https://a.example.com/", Pages: []string{"guide", "home"}, Blocked: true, CheckedAt: at},
+		{URL: "https://c.example.com/", Pages: []string{"home"}},
+	}
+	if err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("ListExternalLinks = %+v, %v; want %+v", got, err, want)
+	}
+	if err := database.SetPageExternalLinks(ctx, map[string][]string{"home": {"https://b.example.com/"}}); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := database.ListExternalLinks(ctx); err != nil || len(got) != 1 || !got[0].CheckedAt.IsZero() {
+		t.Errorf("ListExternalLinks after re-adding a forgotten link = %+v, %v; want it unchecked", got, err)
+	}
+}
+
+func TestRecentPages(t *testing.T) {
+	database := openTestDB(t)
+	ctx := context.Background()
+	at := time.Date(2026, 10, 14, 12, 0, 0, 0, time.UTC)
+
+	for i, pagepath := range []string{"home", "guide", "home"} {
+		if err := database.RecordRecentPage(ctx, 1, pagepath, at.Add(time.Duration(i)*time.Minute)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := database.RecordRecentPage(ctx, 2, "other", at); err != nil {
+		t.Fatal(err)
+	}
+	got, err := database.ListRecentPages(ctx, 1)
+	want := []RecentPage{{"home", at.Add(2 * time.Minute)}, {"guide", at.Add(time.Minute)}}
+	if err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("ListRecentPages = %+v, %v; want %+v", got, err, want)
+	}
+
+	// Only the pages viewed last are kept.
+	for i := range RecentPagesKept {
+		if err := database.RecordRecentPage(ctx, 1, fmt.Sprintf("page%d", i), at.Add(time.Hour+time.Duration(i)*time.Minute)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	got, err = database.ListRecentPages(ctx, 1)
+	if err != nil || len(got) != RecentPagesKept || got[0].Pagepath != fmt.Sprintf("page%d", RecentPagesKept-1) {
+		t.Errorf("ListRecentPages after %d more views = %d pages, %v", RecentPagesKept, len(got), err)
+	}
+}
+
+func TestBookmarks(t *testing.T) {
+	database := openTestDB(t)
+	ctx := context.Background()
+	at := time.Date(2026, 10, 14, 12, 0, 0, 0, time.UTC)
+
+	for _, b := range []struct {
+		userID   int64
+		pagepath string
+	}{{1, "guide"}, {1, "home"}, {1, "guide"}, {2, "home"}, {2, "old"}, {2, "new"}} {
+		if err := database.AddBookmark(ctx, b.userID, b.pagepath, at); err != nil {
+			t.Fatal(err)
+		}
+	}
+	got, err := database.ListBookmarks(ctx, 1)
+	want := []Bookmark{{"guide", at}, {"home", at}}
+	if err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("ListBookmarks = %+v, %v; want %+v", got, err, want)
+	}
+	if ok, err := database.IsBookmarked(ctx, 1, "home"); err != nil || !ok {
+		t.Errorf("IsBookmarked(home) = %v, %v; want true", ok, err)
+	}
+
+	if err := database.DeleteBookmark(ctx, 1, "home"); err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := database.IsBookmarked(ctx, 1, "home"); err != nil || ok {
+		t.Errorf("IsBookmarked(home) after deleting = %v, %v; want false", ok, err)
+	}
+	if ok, _ := database.IsBookmarked(ctx, 2, "home"); !ok {
+		t.Error("deleting a bookmark deleted another user's")
+	}
+
+	// Renaming a page moves its bookmarks, without duplicating any.
+	if err := database.MoveBookmarks(ctx, "old", "new"); err != nil {
+		t.Fatal(err)
+	}
+	if err := database.MoveBookmarks(ctx, "guide", "manual"); err != nil {
+		t.Fatal(err)
+	}
+	got, _ = database.ListBookmarks(ctx, 2)
+	if want := []Bookmark{{"home", at}, {"new", at}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("ListBookmarks(2) after moving = %+v, want %+v", got, want)
+	}
+	if ok, _ := database.IsBookmarked(ctx, 1, "manual"); !ok {
+		t.Error("bookmark not moved to the new path")
+	}
+}
+
+func TestAnnouncements(t *testing.T) {
+	database := openTestDB(t)
+	ctx := context.Background()
+	now := time.Unix(time.Date(2026, 10, 14, 12, 0, 0, 0, time.UTC).Unix(), 0)
+
+	id, err := database.CreateAnnouncement(ctx, Announcement{
+		Message: "Maintenance tonight", Severity: "warning", EndsAt: now.Add(time.Hour),
+		Dismissible: true, CreatedBy: "Admin", CreatedAt: now,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	later, err := database.CreateAnnouncement(ctx, Announcement{
+		Message: "New release", Severity: "info", StartsAt: now.Add(time.Hour), CreatedAt: now.Add(time.Minute),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	list, err := database.ListAnnouncements(ctx)
+	if err != nil || len(list) != 2 || list[0].ID != later || list[1].ID != id {
+		t.Fatalf("ListAnnouncements = %+v, %v; want the newest first", list, err)
+	}
+	if a := list[1]; !a.Active(now) || a.Active(now.Add(time.Hour)) || !a.StartsAt.IsZero() || !a.Dismissible {
+		t.Errorf("announcement ending in an hour = %+v", a)
+	}
+	if a := list[0]; a.Active(now) || !a.Active(now.Add(2*time.Hour)) || a.Dismissible {
+		t.Errorf("announcement starting in an hour = %+v", a)
+	}
+
+	a := list[1]
+	a.Message, a.Severity, a.EndsAt, a.UpdatedAt = "Maintenance moved", "danger", time.Time{}, now.Add(time.Minute)
+	if err := database.UpdateAnnouncement(ctx, a); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := database.GetAnnouncement(ctx, id); err != nil || got.Message != "Maintenance moved" ||
+		got.Severity != "danger" || !got.EndsAt.IsZero() || !got.UpdatedAt.Equal(a.UpdatedAt) {
+		t.Errorf("GetAnnouncement after updating = %+v, %v", got, err)
+	}
+	if err := database.UpdateAnnouncement(ctx, Announcement{ID: 999}); err != sql.ErrNoRows {
+		t.Errorf("UpdateAnnouncement(999) = %v, want sql.ErrNoRows", err)
+	}
+
+	for range 2 {
+		if err := database.DismissAnnouncement(ctx, 1, id, now); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got, err := database.DismissedAnnouncements(ctx, 1); err != nil || !reflect.DeepEqual(got, map[int64]bool{id: true}) {
+		t.Errorf("DismissedAnnouncements(1) = %v, %v", got, err)
+	}
+	if got, _ := database.DismissedAnnouncements(ctx, 2); len(got) != 0 {
+		t.Errorf("DismissedAnnouncements(2) = %v, want none", got)
+	}
+
+	if err := database.DeleteAnnouncement(ctx, id); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := database.GetAnnouncement(ctx, id); err != sql.ErrNoRows {
+		t.Errorf("GetAnnouncement after deleting = %v, want sql.ErrNoRows", err)
+	}
+	if got, _ := database.DismissedAnnouncements(ctx, 1); len(got) != 0 {
+		t.Errorf("dismissals of a deleted announcement remain: %v", got)
+	}
+	if err := database.DeleteAnnouncement(ctx, id); err != sql.ErrNoRows {
+		t.Errorf("DeleteAnnouncement twice = %v, want sql.ErrNoRows", err)
+	}
+}
@@ -0,0 +1,112 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/hex"
+	"errors"
+	"fmt"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// ErrSQLCipherUnavailable is returned by OpenEncrypted when the binary is
+// linked against plain SQLite, which silently ignores the key.
+var ErrSQLCipherUnavailable = errors.New("database encryption requires a SQLCipher build " +
+	"(go build -tags \"fts5 libsqlite3\" linked against libsqlcipher)")
+
+// OpenEncrypted opens a SQLCipher-encrypted database, creating it if needed,
+// with a raw 256-bit key. The key is applied to every pooled connection
+// before anything touches the file, so journal and foreign-key settings are
+// issued afterwards rather than through the connection string.
+func OpenEncrypted(uri string, key []byte) (*Database, error) {
+	if IsPostgresURI(uri) {
+		return nil, fmt.Errorf("database encryption is not available for PostgreSQL")
+	}
+	dbPath := pathFromURI(uri)
+	if dbPath == ":memory:" {
+		return nil, fmt.Errorf("database encryption needs a file-based database")
+	}
+	if len(key) != 32 {
+		return nil, fmt.Errorf("database key must be 32 bytes, got %d", len(key))
+	}
+
+	keyPragma := fmt.Sprintf(`PRAGMA key = "x'%s'"`, hex.EncodeToString(key))
+	drv := &sqlite3.SQLiteDriver{
+		ConnectHook: func(c *sqlite3.SQLiteConn) error {
+			if err := execConn(c, keyPragma); err != nil {
+				return err
+			}
+			// Plain SQLite accepts PRAGMA key as a no-op; only SQLCipher
+			// knows cipher_version. Refuse before anything writes plaintext.
+			if !hasCipherVersion(c) {
+				return ErrSQLCipherUnavailable
+			}
+			for _, stmt := range []string{
+				"PRAGMA journal_mode = WAL",
+				"PRAGMA foreign_keys = ON",
+			} {
+				if err := execConn(c, stmt); err != nil {
+					return fmt.Errorf("failed to open encrypted database (wrong key?): %w", err)
+				}
+			}
+			return nil
+		},
+	}
+	conn := sql.OpenDB(&sqliteConnector{driver: drv, dsn: dbPath + "?_busy_timeout=5000"})
+	if err := conn.Ping(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return &Database{
+		conn:    conn,
+		Queries: New(conn),
+	}, nil
+}
+
+// execConn runs a statement on a raw driver connection. It goes through the
+// database/sql/driver interfaces rather than SQLiteConn's own methods, which
+// do not exist in go-sqlite3's stub for builds without cgo.
+func execConn(c *sqlite3.SQLiteConn, query string) error {
+	execer, ok := any(c).(driver.ExecerContext)
+	if !ok {
+		return ErrSQLCipherUnavailable
+	}
+	_, err := execer.ExecContext(context.Background(), query, nil)
+	return err
+}
+
+// hasCipherVersion reports whether the connection is backed by SQLCipher.
+func hasCipherVersion(c *sqlite3.SQLiteConn) bool {
+	queryer, ok := any(c).(driver.QueryerContext)
+	if !ok {
+		return false
+	}
+	rows, err := queryer.QueryContext(context.Background(), "PRAGMA cipher_version", nil)
+	if err != nil {
+		return false
+	}
+	defer rows.Close()
+	dest := make([]driver.Value, len(rows.Columns()))
+	if len(dest) == 0 || rows.Next(dest) != nil {
+		return false
+	}
+	return dest[0] != nil
+}
+
+// sqliteConnector opens connections through a driver value carrying a
+// per-database ConnectHook, so no global driver registration is needed.
+type sqliteConnector struct {
+	driver *sqlite3.SQLiteDriver
+	dsn    string
+}
+
+func (c *sqliteConnector) Connect(context.Context) (driver.Conn, error) {
+	return c.driver.Open(c.dsn)
+}
+
+func (c *sqliteConnector) Driver() driver.Driver {
+	return c.driver
+}
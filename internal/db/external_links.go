@@ -0,0 +1,96 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// ExternalLink is a URL of another site the pages link to, with how it
+// answered when it was last checked. CheckedAt is zero for a URL not
+// checked yet.
+type ExternalLink struct {
+	URL       string
+	Pages     []string // Paths of the pages linking to it, sorted
+	Status    int      // HTTP status; 0 when there was no response
+	Error     string   // Why there was no response
+	Blocked   bool     // The site's robots.txt disallows checking it
+	CheckedAt time.Time
+}
+
+// SetPageExternalLinks replaces the external links of every page with
+// links, the URLs each page links to by path, forgetting the results of
+// the URLs no page links to any more.
+func (d *Database) SetPageExternalLinks(ctx context.Context, links map[string][]string) error {
+	tx, err := d.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM page_external_links`); err != nil {
+		return err
+	}
+	for pagepath, urls := range links {
+		for _, u := range urls {
+			if _, err := tx.ExecContext(ctx, `INSERT INTO page_external_links (pagepath, url) VALUES (?, ?)
+				ON CONFLICT DO NOTHING`, pagepath, u); err != nil {
+				return err
+			}
+		}
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM external_links
+		WHERE url NOT IN (SELECT url FROM page_external_links)`); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// ListExternalLinks returns every URL the pages link to, sorted, with the
+// pages linking to it and its last result.
+func (d *Database) ListExternalLinks(ctx context.Context) ([]ExternalLink, error) {
+	rows, err := d.conn.QueryContext(ctx, `SELECT p.url, p.pagepath, COALESCE(e.status, 0), COALESCE(e.error, ''),
+			COALESCE(e.blocked, 0), e.checked_at
+		FROM page_external_links p LEFT JOIN external_links e ON e.url = p.url
+		ORDER BY p.url, p.pagepath`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var links []ExternalLink
+	for rows.Next() {
+		var l ExternalLink
+		var pagepath string
+		var blocked int
+		var checkedAt sql.NullInt64
+		if err := rows.Scan(&l.URL, &pagepath, &l.Status, &l.Error, &blocked, &checkedAt); err != nil {
+			return nil, err
+		}
+		if n := len(links); n > 0 && links[n-1].URL == l.URL {
+			links[n-1].Pages = append(links[n-1].Pages, pagepath)
+			continue
+		}
+		l.Pages = []string{pagepath}
+		l.Blocked = blocked != 0
+		if checkedAt.Valid {
+			l.CheckedAt = time.Unix(checkedAt.Int64, 0).UTC()
+		}
+		links = append(links, l)
+	}
+	return links, rows.Err()
+}
+
+// SetExternalLinkResult stores the result of checking l.URL.
+func (d *Database) SetExternalLinkResult(ctx context.Context, l ExternalLink) error {
+	blocked := 0
+	if l.Blocked {
+		blocked = 1
+	}
+	_, err := d.conn.ExecContext(ctx, `INSERT INTO external_links (url, status, error, blocked, checked_at)
+		VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT (url) DO UPDATE SET status = excluded.status, error = excluded.error,
+			blocked = excluded.blocked, checked_at = excluded.checked_at`,
+		l.URL, l.Status, l.Error, blocked, l.CheckedAt.Unix())
+	return err
+}
@@ -0,0 +1,68 @@
+package db
+
+import (
+	"context"
+	"time"
+)
+
+// IssueView is a row of issue_views: a named issue list filter a user
+// saved.
+type IssueView struct {
+	ID        int64
+	UserID    int64
+	Name      string
+	Query     string // The issue list's query string, e.g. "status=open&tag=bug"
+	CreatedAt time.Time
+}
+
+const issueViewColumns = `id, user_id, name, query, created_at`
+
+// SaveIssueView stores a user's view, replacing the query of the one with
+// the same name.
+func (d *Database) SaveIssueView(ctx context.Context, v IssueView) error {
+	_, err := d.conn.ExecContext(ctx, `INSERT INTO issue_views (user_id, name, query, created_at)
+		VALUES (?, ?, ?, ?)
+		ON CONFLICT (user_id, name) DO UPDATE SET query = excluded.query`,
+		v.UserID, v.Name, v.Query, v.CreatedAt.Unix())
+	return err
+}
+
+// ListIssueViews returns a user's views, sorted by name.
+func (d *Database) ListIssueViews(ctx context.Context, userID int64) ([]IssueView, error) {
+	rows, err := d.conn.QueryContext(ctx, `SELECT `+issueViewColumns+` FROM issue_views
+		WHERE user_id = ? ORDER BY name`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var views []IssueView
+	for rows.Next() {
+		v, err := scanIssueView(rows)
+		if err != nil {
+			return nil, err
+		}
+		views = append(views, v)
+	}
+	return views, rows.Err()
+}
+
+// GetIssueView returns the user's view named name, or sql.ErrNoRows.
+func (d *Database) GetIssueView(ctx context.Context, userID int64, name string) (IssueView, error) {
+	return scanIssueView(d.conn.QueryRowContext(ctx,
+		`SELECT `+issueViewColumns+` FROM issue_views WHERE user_id = ? AND name = ?`, userID, name))
+}
+
+// DeleteIssueView removes the user's view with id.
+func (d *Database) DeleteIssueView(ctx context.Context, userID, id int64) error {
+	_, err := d.conn.ExecContext(ctx, `DELETE FROM issue_views WHERE id = ? AND user_id = ?`, id, userID)
+	return err
+}
+
+func scanIssueView(row interface{ Scan(...any) error }) (IssueView, error) {
+	var v IssueView
+	var createdAt int64
+	err := row.Scan(&v.ID, &v.UserID, &v.Name, &v.Query, &createdAt)
+	v.CreatedAt = time.Unix(createdAt, 0).UTC()
+	return v, err
+}
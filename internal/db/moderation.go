@@ -0,0 +1,83 @@
+package db
+
+import (
+	"context"
+	"time"
+)
+
+// ModerationItem is a row of moderation_queue: a contribution flagged as
+// spam, held until a moderator approves or rejects it.
+type ModerationItem struct {
+	ID          int64
+	Kind        string // "page", "issue", or "comment"
+	Target      string // The page path, or the issue ID for a comment
+	Title       string
+	Content     string
+	Payload     string // JSON with the rest of the contribution, such as an issue's tags
+	AuthorName  string
+	AuthorEmail string
+	ClientIP    string
+	Reason      string // Why it was flagged
+	CreatedAt   time.Time
+}
+
+const moderationColumns = `id, kind, target, title, content, payload, author_name, author_email, client_ip, reason, created_at`
+
+// QueueModeration adds item to the moderation queue, returning its ID.
+func (d *Database) QueueModeration(ctx context.Context, item ModerationItem) (int64, error) {
+	var id int64
+	err := d.conn.QueryRowContext(ctx, `INSERT INTO moderation_queue
+		(kind, target, title, content, payload, author_name, author_email, client_ip, reason, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?) RETURNING id`,
+		item.Kind, item.Target, item.Title, item.Content, item.Payload,
+		item.AuthorName, item.AuthorEmail, item.ClientIP, item.Reason, item.CreatedAt.Unix()).Scan(&id)
+	return id, err
+}
+
+// ListModeration returns the queued contributions, oldest first.
+func (d *Database) ListModeration(ctx context.Context) ([]ModerationItem, error) {
+	rows, err := d.conn.QueryContext(ctx, `SELECT `+moderationColumns+` FROM moderation_queue ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var items []ModerationItem
+	for rows.Next() {
+		item, err := scanModerationItem(rows)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
+
+// CountModeration returns the number of queued contributions.
+func (d *Database) CountModeration(ctx context.Context) (int64, error) {
+	var n int64
+	err := d.conn.QueryRowContext(ctx, `SELECT COUNT(*) FROM moderation_queue`).Scan(&n)
+	return n, err
+}
+
+// GetModeration returns the queued contribution with id, or
+// sql.ErrNoRows.
+func (d *Database) GetModeration(ctx context.Context, id int64) (ModerationItem, error) {
+	return scanModerationItem(d.conn.QueryRowContext(ctx,
+		`SELECT `+moderationColumns+` FROM moderation_queue WHERE id = ?`, id))
+}
+
+// DeleteModeration removes a contribution from the queue.
+func (d *Database) DeleteModeration(ctx context.Context, id int64) error {
+	_, err := d.conn.ExecContext(ctx, `DELETE FROM moderation_queue WHERE id = ?`, id)
+	return err
+}
+
+func scanModerationItem(row interface{ Scan(...any) error }) (ModerationItem, error) {
+	var item ModerationItem
+	var createdAt int64
+	err := row.Scan(&item.ID, &item.Kind, &item.Target, &item.Title, &item.Content, &item.Payload,
+		&item.AuthorName, &item.AuthorEmail, &item.ClientIP, &item.Reason, &createdAt)
+	item.CreatedAt = time.Unix(createdAt, 0).UTC()
+	return item, err
+}
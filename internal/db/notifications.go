@@ -0,0 +1,114 @@
+package db
+
+import (
+	"context"
+	"time"
+)
+
+// Notification kinds.
+const (
+	// NotificationMention tells a user they were mentioned in an issue
+	// description or comment.
+	NotificationMention = "mention"
+	// NotificationStalePage tells the last author of a page that it is due
+	// for review.
+	NotificationStalePage = "stale-page"
+)
+
+// Notification is a row of notifications: something a user is told about
+// in the wiki, and by email when it can send mail.
+type Notification struct {
+	ID        int64
+	UserID    int64
+	Kind      string
+	IssueID   int64
+	CommentID int64  // 0 for the issue's description
+	Pagepath  string // The page a stale-page notification is about
+	Title     string // The issue's or page's title when the notification was made
+	Excerpt   string
+	ActorName string
+	CreatedAt time.Time
+	ReadAt    time.Time // Zero while unread
+}
+
+// Unread reports whether the user has not opened the notification.
+func (n Notification) Unread() bool {
+	return n.ReadAt.IsZero()
+}
+
+const notificationColumns = `id, user_id, kind, issue_id, comment_id, pagepath, title, excerpt, actor_name, created_at, read_at`
+
+// CreateNotification records n, returning its ID.
+func (d *Database) CreateNotification(ctx context.Context, n Notification) (int64, error) {
+	var id int64
+	err := d.conn.QueryRowContext(ctx, `INSERT INTO notifications
+		(user_id, kind, issue_id, comment_id, pagepath, title, excerpt, actor_name, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?) RETURNING id`,
+		n.UserID, n.Kind, n.IssueID, n.CommentID, n.Pagepath, n.Title, n.Excerpt, n.ActorName, n.CreatedAt.Unix()).Scan(&id)
+	return id, err
+}
+
+// ListNotifications returns a user's most recent notifications, newest
+// first.
+func (d *Database) ListNotifications(ctx context.Context, userID int64, limit int) ([]Notification, error) {
+	rows, err := d.conn.QueryContext(ctx, `SELECT `+notificationColumns+` FROM notifications
+		WHERE user_id = ? ORDER BY id DESC LIMIT ?`, userID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var list []Notification
+	for rows.Next() {
+		n, err := scanNotification(rows)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, n)
+	}
+	return list, rows.Err()
+}
+
+// CountUnreadNotifications returns the number of notifications the user
+// has not opened.
+func (d *Database) CountUnreadNotifications(ctx context.Context, userID int64) (int64, error) {
+	var n int64
+	err := d.conn.QueryRowContext(ctx,
+		`SELECT COUNT(*) FROM notifications WHERE user_id = ? AND read_at = 0`, userID).Scan(&n)
+	return n, err
+}
+
+// GetNotification returns the user's notification with id, or
+// sql.ErrNoRows.
+func (d *Database) GetNotification(ctx context.Context, userID, id int64) (Notification, error) {
+	return scanNotification(d.conn.QueryRowContext(ctx,
+		`SELECT `+notificationColumns+` FROM notifications WHERE id = ? AND user_id = ?`, id, userID))
+}
+
+// MarkNotificationRead marks the user's notification with id as read.
+func (d *Database) MarkNotificationRead(ctx context.Context, userID, id int64) error {
+	_, err := d.conn.ExecContext(ctx,
+		`UPDATE notifications SET read_at = ? WHERE id = ? AND user_id = ? AND read_at = 0`,
+		time.Now().Unix(), id, userID)
+	return err
+}
+
+// MarkAllNotificationsRead marks every notification of the user as read.
+func (d *Database) MarkAllNotificationsRead(ctx context.Context, userID int64) error {
+	_, err := d.conn.ExecContext(ctx,
+		`UPDATE notifications SET read_at = ? WHERE user_id = ? AND read_at = 0`,
+		time.Now().Unix(), userID)
+	return err
+}
+
+func scanNotification(row interface{ Scan(...any) error }) (Notification, error) {
+	var n Notification
+	var createdAt, readAt int64
+	err := row.Scan(&n.ID, &n.UserID, &n.Kind, &n.IssueID, &n.CommentID, &n.Pagepath, &n.Title, &n.Excerpt,
+		&n.ActorName, &createdAt, &readAt)
+	n.CreatedAt = time.Unix(createdAt, 0).UTC()
+	if readAt != 0 {
+		n.ReadAt = time.Unix(readAt, 0).UTC()
+	}
+	return n, err
+}
@@ -0,0 +1,77 @@
+package db
+
+import (
+	"context"
+	"time"
+)
+
+// PageCheck is a row of page_checks: a problem a check found in a revision
+// of a page when it was saved.
+type PageCheck struct {
+	Pagepath  string
+	Revision  string // Full hash of the commit that saved it
+	Check     string
+	Line      int // 0 when the problem is not on a line
+	Message   string
+	CheckedAt time.Time
+}
+
+const pageCheckColumns = `pagepath, revision, check_name, line, message, checked_at`
+
+// SetPageChecks stores the findings of the checks run on a revision of the
+// page at pagepath, replacing those stored before. No findings record that
+// the revision passed them.
+func (d *Database) SetPageChecks(ctx context.Context, pagepath, revision string, findings []PageCheck) error {
+	tx, err := d.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM page_checks WHERE pagepath = ? AND revision = ?`, pagepath, revision); err != nil {
+		return err
+	}
+	for _, f := range findings {
+		if _, err := tx.ExecContext(ctx, `INSERT INTO page_checks (`+pageCheckColumns+`) VALUES (?, ?, ?, ?, ?, ?)`,
+			pagepath, revision, f.Check, f.Line, f.Message, f.CheckedAt.Unix()); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// ListPageChecks returns the findings of the checks run on a revision of
+// the page at pagepath, by line.
+func (d *Database) ListPageChecks(ctx context.Context, pagepath, revision string) ([]PageCheck, error) {
+	return d.queryPageChecks(ctx, `SELECT `+pageCheckColumns+` FROM page_checks
+		WHERE pagepath = ? AND revision = ? ORDER BY line, check_name`, pagepath, revision)
+}
+
+// ListCurrentPageChecks returns the findings of the checks run on the
+// current revision of each page, as the page_metadata cache knows it, by
+// page and line.
+func (d *Database) ListCurrentPageChecks(ctx context.Context) ([]PageCheck, error) {
+	return d.queryPageChecks(ctx, `SELECT c.pagepath, c.revision, c.check_name, c.line, c.message, c.checked_at
+		FROM page_checks c JOIN page_metadata m ON m.pagepath = c.pagepath AND m.revision = c.revision
+		ORDER BY c.pagepath, c.line, c.check_name`)
+}
+
+func (d *Database) queryPageChecks(ctx context.Context, query string, args ...any) ([]PageCheck, error) {
+	rows, err := d.conn.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var findings []PageCheck
+	for rows.Next() {
+		var f PageCheck
+		var checkedAt int64
+		if err := rows.Scan(&f.Pagepath, &f.Revision, &f.Check, &f.Line, &f.Message, &checkedAt); err != nil {
+			return nil, err
+		}
+		f.CheckedAt = time.Unix(checkedAt, 0).UTC()
+		findings = append(findings, f)
+	}
+	return findings, rows.Err()
+}
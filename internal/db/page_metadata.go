@@ -0,0 +1,131 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// PageMetadata is a row of the page_metadata cache: what the page index,
+// sitemap, and feeds need to know of a page without reading the repository.
+type PageMetadata struct {
+	Pagepath    string
+	Filename    string
+	Title       string
+	Revision    string // Full hash of the last commit touching the file
+	AuthorName  string
+	AuthorEmail string
+	Created     time.Time // Time of the first commit touching the file
+	Updated     time.Time // Time of the last commit touching the file
+	Size        int64
+	ReviewBy    time.Time // Review date the page's frontmatter sets; zero for none
+	NoIndex     bool      // The page's frontmatter keeps it out of search engines
+}
+
+const pageMetadataColumns = `pagepath, filename, title, revision, author_name, author_email, created_at, updated_at, size, review_by, noindex`
+
+func scanPageMetadata(row interface{ Scan(...any) error }) (PageMetadata, error) {
+	var m PageMetadata
+	var created, updated, reviewBy int64
+	var noindex int
+	err := row.Scan(&m.Pagepath, &m.Filename, &m.Title, &m.Revision, &m.AuthorName, &m.AuthorEmail, &created, &updated, &m.Size, &reviewBy, &noindex)
+	m.NoIndex = noindex != 0
+	m.Created = time.Unix(created, 0).UTC()
+	m.Updated = time.Unix(updated, 0).UTC()
+	if reviewBy != 0 {
+		m.ReviewBy = time.Unix(reviewBy, 0).UTC()
+	}
+	return m, err
+}
+
+// ListPageMetadata returns the cached metadata of every page, sorted by
+// path.
+func (d *Database) ListPageMetadata(ctx context.Context) ([]PageMetadata, error) {
+	rows, err := d.conn.QueryContext(ctx, `SELECT `+pageMetadataColumns+` FROM page_metadata ORDER BY pagepath`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var pages []PageMetadata
+	for rows.Next() {
+		m, err := scanPageMetadata(rows)
+		if err != nil {
+			return nil, err
+		}
+		pages = append(pages, m)
+	}
+	return pages, rows.Err()
+}
+
+// GetPageMetadata returns the cached metadata of a page, or nil if there is
+// none.
+func (d *Database) GetPageMetadata(ctx context.Context, pagepath string) (*PageMetadata, error) {
+	m, err := scanPageMetadata(d.conn.QueryRowContext(ctx,
+		`SELECT `+pageMetadataColumns+` FROM page_metadata WHERE pagepath = ?`, pagepath))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+const upsertPageMetadata = `INSERT INTO page_metadata (` + pageMetadataColumns + `)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	ON CONFLICT (pagepath) DO UPDATE SET filename = excluded.filename, title = excluded.title,
+		revision = excluded.revision, author_name = excluded.author_name, author_email = excluded.author_email,
+		created_at = excluded.created_at, updated_at = excluded.updated_at, size = excluded.size,
+		review_by = excluded.review_by, noindex = excluded.noindex`
+
+func pageMetadataArgs(m PageMetadata) []any {
+	var reviewBy int64
+	if !m.ReviewBy.IsZero() {
+		reviewBy = m.ReviewBy.Unix()
+	}
+	var noindex int
+	if m.NoIndex {
+		noindex = 1
+	}
+	return []any{m.Pagepath, m.Filename, m.Title, m.Revision, m.AuthorName, m.AuthorEmail,
+		m.Created.Unix(), m.Updated.Unix(), m.Size, reviewBy, noindex}
+}
+
+// UpsertPageMetadata adds or replaces the cached metadata of a page.
+func (d *Database) UpsertPageMetadata(ctx context.Context, m PageMetadata) error {
+	_, err := d.conn.ExecContext(ctx, upsertPageMetadata, pageMetadataArgs(m)...)
+	return err
+}
+
+// DeletePageMetadata removes a page from the metadata cache.
+func (d *Database) DeletePageMetadata(ctx context.Context, pagepath string) error {
+	_, err := d.conn.ExecContext(ctx, `DELETE FROM page_metadata WHERE pagepath = ?`, pagepath)
+	return err
+}
+
+// RebuildPageMetadata replaces the whole metadata cache with pages.
+func (d *Database) RebuildPageMetadata(ctx context.Context, pages []PageMetadata) error {
+	tx, err := d.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM page_metadata`); err != nil {
+		return err
+	}
+	stmt, err := tx.PrepareContext(ctx, upsertPageMetadata)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for _, m := range pages {
+		if _, err := stmt.ExecContext(ctx, pageMetadataArgs(m)...); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
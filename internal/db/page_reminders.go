@@ -0,0 +1,30 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// PageReminderRevision returns the revision of the page at pagepath whose
+// last author was last reminded to review it, "" when none was.
+func (d *Database) PageReminderRevision(ctx context.Context, pagepath string) (string, error) {
+	var revision string
+	err := d.conn.QueryRowContext(ctx, `SELECT revision FROM page_reminders WHERE pagepath = ?`,
+		pagepath).Scan(&revision)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+	return revision, err
+}
+
+// SetPageReminder records that the last author of the page at pagepath was
+// reminded at at to review its revision.
+func (d *Database) SetPageReminder(ctx context.Context, pagepath, revision string, at time.Time) error {
+	_, err := d.conn.ExecContext(ctx, `INSERT INTO page_reminders (pagepath, revision, reminded_at)
+		VALUES (?, ?, ?)
+		ON CONFLICT (pagepath) DO UPDATE SET revision = excluded.revision, reminded_at = excluded.reminded_at`,
+		pagepath, revision, at.Unix())
+	return err
+}
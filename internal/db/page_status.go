@@ -0,0 +1,97 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// Review statuses of a page. A page without one has none and is shown as
+// it is.
+const (
+	PageStatusDraft      = "draft"
+	PageStatusInReview   = "in-review"
+	PageStatusApproved   = "approved"
+	PageStatusDeprecated = "deprecated"
+)
+
+// PageStatuses lists the review statuses, in the order a page moves
+// through them.
+var PageStatuses = []string{PageStatusDraft, PageStatusInReview, PageStatusApproved, PageStatusDeprecated}
+
+// PageStatus is a row of page_status: the review status of a page, and who
+// set it.
+type PageStatus struct {
+	Pagepath       string
+	Status         string
+	ChangedByName  string
+	ChangedByEmail string
+	ChangedAt      time.Time
+}
+
+const pageStatusColumns = `pagepath, status, changed_by_name, changed_by_email, changed_at`
+
+// GetPageStatus returns the review status of the page at pagepath, failing
+// with sql.ErrNoRows when it has none.
+func (d *Database) GetPageStatus(ctx context.Context, pagepath string) (PageStatus, error) {
+	return scanPageStatus(d.conn.QueryRowContext(ctx, `SELECT `+pageStatusColumns+` FROM page_status
+		WHERE pagepath = ?`, pagepath))
+}
+
+// ListPageStatuses returns the review status of every page that has one,
+// by path.
+func (d *Database) ListPageStatuses(ctx context.Context) (map[string]PageStatus, error) {
+	rows, err := d.conn.QueryContext(ctx, `SELECT `+pageStatusColumns+` FROM page_status`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	statuses := make(map[string]PageStatus)
+	for rows.Next() {
+		p, err := scanPageStatus(rows)
+		if err != nil {
+			return nil, err
+		}
+		statuses[p.Pagepath] = p
+	}
+	return statuses, rows.Err()
+}
+
+// SetPageStatus stores the review status of a page, in tx when it is not
+// nil; an empty Status removes it.
+func (d *Database) SetPageStatus(ctx context.Context, tx *sql.Tx, p PageStatus) error {
+	var conn DBTX = d.conn
+	if tx != nil {
+		conn = tx
+	}
+	if p.Status == "" {
+		_, err := conn.ExecContext(ctx, `DELETE FROM page_status WHERE pagepath = ?`, p.Pagepath)
+		return err
+	}
+	_, err := conn.ExecContext(ctx, `INSERT INTO page_status (`+pageStatusColumns+`)
+		VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT (pagepath) DO UPDATE SET status = excluded.status,
+			changed_by_name = excluded.changed_by_name, changed_by_email = excluded.changed_by_email,
+			changed_at = excluded.changed_at`,
+		p.Pagepath, p.Status, p.ChangedByName, p.ChangedByEmail, p.ChangedAt.Unix())
+	return err
+}
+
+// MovePageStatus moves the review status of a renamed page to its new
+// path, replacing any the new path had.
+func (d *Database) MovePageStatus(ctx context.Context, from, to string) error {
+	if _, err := d.conn.ExecContext(ctx, `DELETE FROM page_status WHERE pagepath = ?`, to); err != nil {
+		return err
+	}
+	_, err := d.conn.ExecContext(ctx, `UPDATE page_status SET pagepath = ? WHERE pagepath = ?`, to, from)
+	return err
+}
+
+func scanPageStatus(row interface{ Scan(...any) error }) (PageStatus, error) {
+	var p PageStatus
+	var changedAt int64
+	err := row.Scan(&p.Pagepath, &p.Status, &p.ChangedByName, &p.ChangedByEmail, &changedAt)
+	p.ChangedAt = time.Unix(changedAt, 0).UTC()
+	return p, err
+}
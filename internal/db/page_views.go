@@ -0,0 +1,69 @@
+package db
+
+import (
+	"context"
+	"time"
+)
+
+// PageViewDayFormat is the format of the days of page_views, which are
+// UTC.
+const PageViewDayFormat = "2006-01-02"
+
+// PageViews is the number of views of a page over some days, or on the day
+// Day.
+type PageViews struct {
+	Pagepath string
+	Day      string
+	Views    int
+}
+
+// CountPageView adds a view of the page at pagepath on the day of at.
+func (d *Database) CountPageView(ctx context.Context, pagepath string, at time.Time) error {
+	_, err := d.conn.ExecContext(ctx, `INSERT INTO page_views (pagepath, day, views) VALUES (?, ?, 1)
+		ON CONFLICT (pagepath, day) DO UPDATE SET views = page_views.views + 1`,
+		pagepath, at.UTC().Format(PageViewDayFormat))
+	return err
+}
+
+// PopularPages returns the limit pages viewed most since the day of since,
+// most viewed first, with their views.
+func (d *Database) PopularPages(ctx context.Context, since time.Time, limit int) ([]PageViews, error) {
+	rows, err := d.conn.QueryContext(ctx, `SELECT pagepath, SUM(views) AS total FROM page_views
+		WHERE day >= ? GROUP BY pagepath ORDER BY total DESC, pagepath LIMIT ?`,
+		since.UTC().Format(PageViewDayFormat), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var pages []PageViews
+	for rows.Next() {
+		var p PageViews
+		if err := rows.Scan(&p.Pagepath, &p.Views); err != nil {
+			return nil, err
+		}
+		pages = append(pages, p)
+	}
+	return pages, rows.Err()
+}
+
+// ListPageViewDays returns the views of every page on each day it was
+// viewed since the day of since, oldest first.
+func (d *Database) ListPageViewDays(ctx context.Context, since time.Time) ([]PageViews, error) {
+	rows, err := d.conn.QueryContext(ctx, `SELECT pagepath, day, views FROM page_views
+		WHERE day >= ? ORDER BY day, pagepath`, since.UTC().Format(PageViewDayFormat))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var days []PageViews
+	for rows.Next() {
+		var p PageViews
+		if err := rows.Scan(&p.Pagepath, &p.Day, &p.Views); err != nil {
+			return nil, err
+		}
+		days = append(days, p)
+	}
+	return days, rows.Err()
+}
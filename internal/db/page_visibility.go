@@ -0,0 +1,72 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// PageVisibilityPublic makes a page readable by anyone, whatever the read
+// access of the site. A page without a visibility follows the site's.
+const PageVisibilityPublic = "public"
+
+// PageVisibility is a row of page_visibility: the visibility of a page,
+// and who set it.
+type PageVisibility struct {
+	Pagepath       string
+	Visibility     string
+	ChangedByName  string
+	ChangedByEmail string
+	ChangedAt      time.Time
+}
+
+// ListPublicPages returns the paths of the public pages.
+func (d *Database) ListPublicPages(ctx context.Context) (map[string]bool, error) {
+	rows, err := d.conn.QueryContext(ctx, `SELECT pagepath FROM page_visibility WHERE visibility = ?`,
+		PageVisibilityPublic)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	public := make(map[string]bool)
+	for rows.Next() {
+		var pagepath string
+		if err := rows.Scan(&pagepath); err != nil {
+			return nil, err
+		}
+		public[pagepath] = true
+	}
+	return public, rows.Err()
+}
+
+// SetPageVisibility stores the visibility of a page, in tx when it is not
+// nil; an empty Visibility removes it.
+func (d *Database) SetPageVisibility(ctx context.Context, tx *sql.Tx, v PageVisibility) error {
+	var conn DBTX = d.conn
+	if tx != nil {
+		conn = tx
+	}
+	if v.Visibility == "" {
+		_, err := conn.ExecContext(ctx, `DELETE FROM page_visibility WHERE pagepath = ?`, v.Pagepath)
+		return err
+	}
+	_, err := conn.ExecContext(ctx, `INSERT INTO page_visibility
+		(pagepath, visibility, changed_by_name, changed_by_email, changed_at)
+		VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT (pagepath) DO UPDATE SET visibility = excluded.visibility,
+			changed_by_name = excluded.changed_by_name, changed_by_email = excluded.changed_by_email,
+			changed_at = excluded.changed_at`,
+		v.Pagepath, v.Visibility, v.ChangedByName, v.ChangedByEmail, v.ChangedAt.Unix())
+	return err
+}
+
+// MovePageVisibility moves the visibility of a renamed page to its new
+// path, replacing any the new path had.
+func (d *Database) MovePageVisibility(ctx context.Context, from, to string) error {
+	if _, err := d.conn.ExecContext(ctx, `DELETE FROM page_visibility WHERE pagepath = ?`, to); err != nil {
+		return err
+	}
+	_, err := d.conn.ExecContext(ctx, `UPDATE page_visibility SET pagepath = ? WHERE pagepath = ?`, to, from)
+	return err
+}
@@ -0,0 +1,60 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// CreatePasswordReset stores the hash of a password reset token for userID,
+// valid until expires. Expired resets of any user are pruned on the way.
+func (d *Database) CreatePasswordReset(ctx context.Context, userID int64, tokenHash string, expires time.Time) error {
+	if err := d.PrunePasswordResets(ctx); err != nil {
+		return err
+	}
+	_, err := d.conn.ExecContext(ctx,
+		`INSERT INTO password_resets (token_hash, user_id, expires_at) VALUES (?, ?, ?)`,
+		tokenHash, userID, expires.Unix())
+	return err
+}
+
+// PasswordResetUser returns the user a reset token hash belongs to, without
+// using it up. Returns sql.ErrNoRows if the token is unknown or expired.
+func (d *Database) PasswordResetUser(ctx context.Context, tokenHash string) (int64, error) {
+	var userID int64
+	err := d.conn.QueryRowContext(ctx,
+		`SELECT user_id FROM password_resets WHERE token_hash = ? AND expires_at > ?`,
+		tokenHash, time.Now().Unix()).Scan(&userID)
+	return userID, err
+}
+
+// ConsumePasswordReset deletes a reset token hash and returns its user, so
+// each reset link works once. Returns sql.ErrNoRows if the token is unknown
+// or expired.
+func (d *Database) ConsumePasswordReset(ctx context.Context, tokenHash string) (int64, error) {
+	var userID, expires int64
+	err := d.conn.QueryRowContext(ctx,
+		`DELETE FROM password_resets WHERE token_hash = ? RETURNING user_id, expires_at`,
+		tokenHash).Scan(&userID, &expires)
+	if err != nil {
+		return 0, err
+	}
+	if expires <= time.Now().Unix() {
+		return 0, sql.ErrNoRows
+	}
+	return userID, nil
+}
+
+// DeletePasswordResets removes every outstanding reset for userID, e.g. once
+// their password has been set another way.
+func (d *Database) DeletePasswordResets(ctx context.Context, userID int64) error {
+	_, err := d.conn.ExecContext(ctx, `DELETE FROM password_resets WHERE user_id = ?`, userID)
+	return err
+}
+
+// PrunePasswordResets removes the expired resets of every user.
+func (d *Database) PrunePasswordResets(ctx context.Context) error {
+	_, err := d.conn.ExecContext(ctx,
+		`DELETE FROM password_resets WHERE expires_at <= ?`, time.Now().Unix())
+	return err
+}
@@ -0,0 +1,627 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// postgresDriver is the database/sql driver name registered by pgx's stdlib
+// package, which builds with -tags postgres link in (see postgres_driver.go).
+const postgresDriver = "pgx"
+
+// ErrPostgresUnavailable is returned by Open for a PostgreSQL URI when the
+// binary was built without a PostgreSQL driver.
+var ErrPostgresUnavailable = errors.New("PostgreSQL support requires a build with -tags postgres " +
+	"(go get github.com/jackc/pgx/v5 && go build -tags \"fts5 postgres\")")
+
+// IsPostgresURI reports whether uri names a PostgreSQL database rather than
+// a SQLite file.
+func IsPostgresURI(uri string) bool {
+	return strings.HasPrefix(uri, "postgres://") || strings.HasPrefix(uri, "postgresql://")
+}
+
+// openPostgres opens a PostgreSQL database. The queries are written with
+// SQLite's ? placeholders, so every connection rewrites them to $n.
+func openPostgres(uri string) (*Database, error) {
+	if !slices.Contains(sql.Drivers(), postgresDriver) {
+		return nil, ErrPostgresUnavailable
+	}
+	probe, err := sql.Open(postgresDriver, uri)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+	drv := probe.Driver()
+	probe.Close()
+
+	conn := sql.OpenDB(rebindConnector{driver: drv, dsn: uri})
+	if err := conn.Ping(); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to ping database: %w", err)
+	}
+	return &Database{conn: conn, Queries: New(conn), postgres: true}, nil
+}
+
+// IsPostgres reports whether the database is PostgreSQL.
+func (d *Database) IsPostgres() bool {
+	return d.postgres
+}
+
+// postgresSchemaVersion is the migration version postgresSchema matches.
+const postgresSchemaVersion = 10
+
+// postgresSchema creates the schema the first ten SQLite migrations arrive
+// at. The
+// search index is a plain table whose tsvector column PostgreSQL keeps up to
+// date, weighting titles above the body; the 'simple' configuration does no
+// stemming, like the FTS5 tokenizer, and the folded column supplies the
+// diacritic-free spellings.
+var postgresSchema = []string{
+	`CREATE TABLE preferences (
+		name TEXT PRIMARY KEY,
+		value TEXT
+	)`,
+	`CREATE TABLE "user" (
+		id BIGINT GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+		name TEXT NOT NULL,
+		email TEXT NOT NULL UNIQUE,
+		password_hash TEXT,
+		first_seen TIMESTAMPTZ,
+		last_seen TIMESTAMPTZ,
+		is_approved BOOLEAN DEFAULT FALSE,
+		is_admin BOOLEAN DEFAULT FALSE,
+		email_confirmed BOOLEAN DEFAULT FALSE,
+		allow_read BOOLEAN DEFAULT FALSE,
+		allow_write BOOLEAN DEFAULT FALSE,
+		allow_upload BOOLEAN DEFAULT FALSE
+	)`,
+	`CREATE TABLE drafts (
+		id BIGINT GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+		pagepath TEXT,
+		revision TEXT,
+		author_email TEXT,
+		content TEXT,
+		cursor_line BIGINT,
+		cursor_ch BIGINT,
+		datetime TIMESTAMPTZ
+	)`,
+	`CREATE INDEX idx_drafts_pagepath ON drafts(pagepath)`,
+	`CREATE UNIQUE INDEX idx_drafts_page_author ON drafts(pagepath, author_email)`,
+	`CREATE TABLE cache (
+		key TEXT PRIMARY KEY,
+		value TEXT,
+		datetime TIMESTAMPTZ
+	)`,
+	`CREATE TABLE issues (
+		id BIGINT GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+		title TEXT NOT NULL,
+		description TEXT,
+		status TEXT NOT NULL DEFAULT 'open',
+		category TEXT,
+		tags TEXT,
+		created_by_name TEXT,
+		created_by_email TEXT,
+		created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+		updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+	)`,
+	`CREATE INDEX idx_issues_status ON issues(status)`,
+	`CREATE INDEX idx_issues_created_at ON issues(created_at)`,
+	`CREATE INDEX idx_issues_category ON issues(category)`,
+	`CREATE TABLE issue_comments (
+		id BIGINT GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+		issue_id BIGINT NOT NULL REFERENCES issues(id) ON DELETE CASCADE,
+		content TEXT NOT NULL,
+		author_name TEXT,
+		author_email TEXT,
+		created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+		updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+	)`,
+	`CREATE INDEX idx_issue_comments_issue_id ON issue_comments(issue_id)`,
+	`CREATE TABLE page_links (
+		source_pagepath TEXT NOT NULL,
+		target_pagepath TEXT NOT NULL,
+		PRIMARY KEY (source_pagepath, target_pagepath)
+	)`,
+	`CREATE INDEX idx_page_links_target ON page_links(target_pagepath)`,
+	`CREATE TABLE user_fields (
+		id BIGINT GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+		name TEXT NOT NULL UNIQUE,
+		label TEXT NOT NULL,
+		position BIGINT NOT NULL DEFAULT 0
+	)`,
+	`CREATE TABLE user_field_values (
+		user_id BIGINT NOT NULL REFERENCES "user"(id) ON DELETE CASCADE,
+		field_id BIGINT NOT NULL REFERENCES user_fields(id) ON DELETE CASCADE,
+		value TEXT NOT NULL,
+		PRIMARY KEY (user_id, field_id)
+	)`,
+	`CREATE TABLE password_resets (
+		token_hash TEXT PRIMARY KEY,
+		user_id BIGINT NOT NULL REFERENCES "user"(id) ON DELETE CASCADE,
+		expires_at BIGINT NOT NULL
+	)`,
+	`CREATE TABLE user_sessions (
+		id BIGINT GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+		token_hash TEXT NOT NULL UNIQUE,
+		user_id BIGINT NOT NULL REFERENCES "user"(id) ON DELETE CASCADE,
+		user_agent TEXT NOT NULL DEFAULT '',
+		ip TEXT NOT NULL DEFAULT '',
+		created_at BIGINT NOT NULL,
+		last_seen BIGINT NOT NULL
+	)`,
+	`CREATE INDEX idx_user_sessions_user ON user_sessions(user_id)`,
+	`CREATE TABLE page_fts (
+		pagepath TEXT PRIMARY KEY,
+		title TEXT NOT NULL DEFAULT '',
+		content TEXT NOT NULL DEFAULT '',
+		folded TEXT NOT NULL DEFAULT '',
+		document tsvector GENERATED ALWAYS AS (
+			setweight(to_tsvector('simple', title), 'A') ||
+			setweight(to_tsvector('simple', content || ' ' || folded), 'B')
+		) STORED
+	)`,
+	`CREATE INDEX idx_page_fts_document ON page_fts USING GIN (document)`,
+}
+
+// postgresMigrations are the PostgreSQL counterparts of the SQLite migrations
+// after postgresSchemaVersion. Every new SQLite migration needs one.
+var postgresMigrations = []struct {
+	version int
+	name    string
+	stmts   []string
+}{
+	{11, "create cluster tables", []string{
+		`CREATE TABLE IF NOT EXISTS cluster_leases (
+			name TEXT PRIMARY KEY,
+			holder TEXT NOT NULL,
+			expires_at BIGINT NOT NULL
+		)`,
+		`CREATE TABLE IF NOT EXISTS cluster_generations (
+			name TEXT PRIMARY KEY,
+			value BIGINT NOT NULL
+		)`,
+	}},
+	{12, "create user_preferences table", []string{
+		`CREATE TABLE IF NOT EXISTS user_preferences (
+			user_id BIGINT NOT NULL REFERENCES "user"(id) ON DELETE CASCADE,
+			name TEXT NOT NULL,
+			value TEXT NOT NULL,
+			PRIMARY KEY (user_id, name)
+		)`,
+	}},
+	{13, "create page_metadata table", []string{
+		`CREATE TABLE IF NOT EXISTS page_metadata (
+			pagepath TEXT PRIMARY KEY,
+			filename TEXT NOT NULL,
+			title TEXT NOT NULL DEFAULT '',
+			revision TEXT NOT NULL DEFAULT '',
+			author_name TEXT NOT NULL DEFAULT '',
+			author_email TEXT NOT NULL DEFAULT '',
+			created_at BIGINT NOT NULL DEFAULT 0,
+			updated_at BIGINT NOT NULL DEFAULT 0,
+			size BIGINT NOT NULL DEFAULT 0
+		)`,
+	}},
+	{14, "create repository_maintenance table", []string{
+		`CREATE TABLE IF NOT EXISTS repository_maintenance (
+			ran_at BIGINT NOT NULL,
+			size_before BIGINT NOT NULL,
+			size_after BIGINT NOT NULL,
+			loose_objects BIGINT NOT NULL,
+			packs BIGINT NOT NULL,
+			duration_ms BIGINT NOT NULL
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_repository_maintenance_ran_at ON repository_maintenance(ran_at)`,
+	}},
+	{15, "create moderation_queue table", []string{
+		`CREATE TABLE IF NOT EXISTS moderation_queue (
+			id BIGINT GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+			kind TEXT NOT NULL,
+			target TEXT NOT NULL DEFAULT '',
+			title TEXT NOT NULL DEFAULT '',
+			content TEXT NOT NULL DEFAULT '',
+			payload TEXT NOT NULL DEFAULT '',
+			author_name TEXT NOT NULL DEFAULT '',
+			author_email TEXT NOT NULL DEFAULT '',
+			client_ip TEXT NOT NULL DEFAULT '',
+			reason TEXT NOT NULL DEFAULT '',
+			created_at BIGINT NOT NULL
+		)`,
+	}},
+	{16, "create notifications table", []string{
+		`CREATE TABLE IF NOT EXISTS notifications (
+			id BIGINT GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+			user_id BIGINT NOT NULL,
+			kind TEXT NOT NULL,
+			issue_id BIGINT NOT NULL DEFAULT 0,
+			comment_id BIGINT NOT NULL DEFAULT 0,
+			title TEXT NOT NULL DEFAULT '',
+			excerpt TEXT NOT NULL DEFAULT '',
+			actor_name TEXT NOT NULL DEFAULT '',
+			created_at BIGINT NOT NULL,
+			read_at BIGINT NOT NULL DEFAULT 0
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_notifications_user ON notifications(user_id, read_at)`,
+	}},
+	{17, "create issue_views table", []string{
+		`CREATE TABLE IF NOT EXISTS issue_views (
+			id BIGINT GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+			user_id BIGINT NOT NULL,
+			name TEXT NOT NULL,
+			query TEXT NOT NULL DEFAULT '',
+			created_at BIGINT NOT NULL,
+			UNIQUE (user_id, name)
+		)`,
+	}},
+	{18, "create audit_log table", []string{
+		`CREATE TABLE IF NOT EXISTS audit_log (
+			id BIGINT GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+			action TEXT NOT NULL,
+			detail TEXT NOT NULL DEFAULT '',
+			actor_name TEXT NOT NULL DEFAULT '',
+			actor_email TEXT NOT NULL DEFAULT '',
+			created_at BIGINT NOT NULL
+		)`,
+	}},
+	{19, "create issue_comment_revisions table", []string{
+		`CREATE TABLE IF NOT EXISTS issue_comment_revisions (
+			id BIGINT GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+			comment_id BIGINT NOT NULL REFERENCES issue_comments(id) ON DELETE CASCADE,
+			content TEXT NOT NULL,
+			edited_by_name TEXT NOT NULL DEFAULT '',
+			edited_by_email TEXT NOT NULL DEFAULT '',
+			created_at BIGINT NOT NULL
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_issue_comment_revisions_comment ON issue_comment_revisions(comment_id)`,
+	}},
+	{20, "create user_avatars table", []string{
+		`CREATE TABLE IF NOT EXISTS user_avatars (
+			user_id BIGINT PRIMARY KEY REFERENCES "user"(id) ON DELETE CASCADE,
+			data BYTEA NOT NULL,
+			updated_at BIGINT NOT NULL
+		)`,
+	}},
+	{21, "create scheduled_pages table", []string{
+		`CREATE TABLE IF NOT EXISTS scheduled_pages (
+			id BIGINT GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+			pagepath TEXT NOT NULL,
+			revision TEXT NOT NULL DEFAULT '',
+			content TEXT NOT NULL,
+			message TEXT NOT NULL DEFAULT '',
+			author_name TEXT NOT NULL DEFAULT '',
+			author_email TEXT NOT NULL,
+			publish_at BIGINT NOT NULL,
+			created_at BIGINT NOT NULL,
+			error TEXT NOT NULL DEFAULT ''
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_scheduled_pages_publish_at ON scheduled_pages(publish_at)`,
+	}},
+	{22, "create page_status table", []string{
+		`CREATE TABLE IF NOT EXISTS page_status (
+			pagepath TEXT PRIMARY KEY,
+			status TEXT NOT NULL,
+			changed_by_name TEXT NOT NULL DEFAULT '',
+			changed_by_email TEXT NOT NULL DEFAULT '',
+			changed_at BIGINT NOT NULL
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_page_status_status ON page_status(status)`,
+	}},
+	{23, "add page review dates and reminders", []string{
+		`ALTER TABLE page_metadata ADD COLUMN IF NOT EXISTS review_by BIGINT NOT NULL DEFAULT 0`,
+		`DELETE FROM preferences WHERE name = 'page_metadata_head'`,
+		`ALTER TABLE notifications ADD COLUMN IF NOT EXISTS pagepath TEXT NOT NULL DEFAULT ''`,
+		`CREATE TABLE IF NOT EXISTS page_reminders (
+			pagepath TEXT PRIMARY KEY,
+			revision TEXT NOT NULL,
+			reminded_at BIGINT NOT NULL
+		)`,
+	}},
+	{24, "create page_visibility table", []string{
+		`CREATE TABLE IF NOT EXISTS page_visibility (
+			pagepath TEXT PRIMARY KEY,
+			visibility TEXT NOT NULL,
+			changed_by_name TEXT NOT NULL DEFAULT '',
+			changed_by_email TEXT NOT NULL DEFAULT '',
+			changed_at BIGINT NOT NULL
+		)`,
+	}},
+	{25, "add page noindex flags", []string{
+		`ALTER TABLE page_metadata ADD COLUMN IF NOT EXISTS noindex INTEGER NOT NULL DEFAULT 0`,
+		`DELETE FROM preferences WHERE name = 'page_metadata_head'`,
+	}},
+	{26, "create page_views table", []string{
+		`CREATE TABLE IF NOT EXISTS page_views (
+			pagepath TEXT NOT NULL,
+			day TEXT NOT NULL,
+			views INTEGER NOT NULL DEFAULT 0,
+			PRIMARY KEY (pagepath, day)
+		)`,
+	}},
+	{27, "create page_checks table", []string{
+		`CREATE TABLE IF NOT EXISTS page_checks (
+			pagepath TEXT NOT NULL,
+			revision TEXT NOT NULL,
+			check_name TEXT NOT NULL,
+			line INTEGER NOT NULL DEFAULT 0,
+			message TEXT NOT NULL,
+			checked_at BIGINT NOT NULL
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_page_checks_page ON page_checks(pagepath, revision)`,
+	}},
+	{28, "create external link tables", []string{
+		`CREATE TABLE IF NOT EXISTS page_external_links (
+			pagepath TEXT NOT NULL,
+			url TEXT NOT NULL,
+			PRIMARY KEY (pagepath, url)
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_page_external_links_url ON page_external_links(url)`,
+		`CREATE TABLE IF NOT EXISTS external_links (
+			url TEXT PRIMARY KEY,
+			status INTEGER NOT NULL DEFAULT 0,
+			error TEXT NOT NULL DEFAULT '',
+			blocked INTEGER NOT NULL DEFAULT 0,
+			checked_at BIGINT NOT NULL
+		)`,
+	}},
+	{29, "create recent_pages table", []string{
+		`CREATE TABLE IF NOT EXISTS recent_pages (
+			user_id BIGINT NOT NULL,
+			pagepath TEXT NOT NULL,
+			viewed_at BIGINT NOT NULL,
+			PRIMARY KEY (user_id, pagepath)
+		)`,
+	}},
+	{30, "create bookmarks table", []string{
+		`CREATE TABLE IF NOT EXISTS bookmarks (
+			user_id BIGINT NOT NULL,
+			pagepath TEXT NOT NULL,
+			created_at BIGINT NOT NULL,
+			PRIMARY KEY (user_id, pagepath)
+		)`,
+	}},
+	{31, "create announcement tables", []string{
+		`CREATE TABLE IF NOT EXISTS announcements (
+			id BIGINT GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+			message TEXT NOT NULL,
+			severity TEXT NOT NULL,
+			starts_at BIGINT,
+			ends_at BIGINT,
+			dismissible INTEGER NOT NULL DEFAULT 1,
+			created_by TEXT NOT NULL DEFAULT '',
+			created_at BIGINT NOT NULL,
+			updated_at BIGINT NOT NULL
+		)`,
+		`CREATE TABLE IF NOT EXISTS announcement_dismissals (
+			user_id BIGINT NOT NULL,
+			announcement_id BIGINT NOT NULL,
+			dismissed_at BIGINT NOT NULL,
+			PRIMARY KEY (user_id, announcement_id)
+		)`,
+	}},
+}
+
+// postgresMigrateLock is the advisory lock key that serializes migrations
+// when several instances start against the same database.
+const postgresMigrateLock = 0x676f7068 // "goph"
+
+// migratePostgres brings a PostgreSQL database up to date in one
+// transaction. An empty database gets postgresSchema at once instead of
+// replaying the early SQLite migrations; the later ones have their own
+// PostgreSQL statements.
+func (d *Database) migratePostgres(ctx context.Context) error {
+	tx, err := d.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock(?)`, postgresMigrateLock); err != nil {
+		return fmt.Errorf("failed to lock schema: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx,
+		`CREATE TABLE IF NOT EXISTS schema_version (version INTEGER NOT NULL DEFAULT 0)`); err != nil {
+		return fmt.Errorf("failed to create schema_version table: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx,
+		`INSERT INTO schema_version (version) SELECT 0 WHERE NOT EXISTS (SELECT 1 FROM schema_version)`); err != nil {
+		return fmt.Errorf("failed to seed schema_version: %w", err)
+	}
+	var current int
+	if err := tx.QueryRowContext(ctx, `SELECT version FROM schema_version`).Scan(&current); err != nil {
+		return fmt.Errorf("failed to get schema version: %w", err)
+	}
+
+	if current != 0 && current < postgresSchemaVersion {
+		return fmt.Errorf("schema version %d cannot be upgraded on PostgreSQL", current)
+	}
+	if current == 0 {
+		slog.Info("creating PostgreSQL schema", "version", postgresSchemaVersion)
+		for _, stmt := range postgresSchema {
+			if _, err := tx.ExecContext(ctx, stmt); err != nil {
+				return fmt.Errorf("failed to create schema: %w", err)
+			}
+		}
+		current = postgresSchemaVersion
+	}
+	for _, m := range postgresMigrations {
+		if m.version <= current {
+			continue
+		}
+		slog.Info("running migration", "version", m.version, "name", m.name)
+		for _, stmt := range m.stmts {
+			if _, err := tx.ExecContext(ctx, stmt); err != nil {
+				return fmt.Errorf("migration %d (%s) failed: %w", m.version, m.name, err)
+			}
+		}
+		current = m.version
+	}
+	if _, err := tx.ExecContext(ctx, `UPDATE schema_version SET version = ?`, current); err != nil {
+		return fmt.Errorf("failed to update schema version to %d: %w", current, err)
+	}
+	return tx.Commit()
+}
+
+// searchPagesPostgres is SearchPages for PostgreSQL. websearch_to_tsquery
+// takes the same quoted phrases, OR, and -exclusions users type into the
+// FTS5 search, and never fails to parse. The rank is negated so that, as
+// with FTS5, lower is better.
+func (d *Database) searchPagesPostgres(ctx context.Context, query string, limit int) (*sql.Rows, error) {
+	return d.conn.QueryContext(ctx,
+		`SELECT pagepath, title,
+			ts_headline('simple', content, q, 'StartSel=' || chr(2) || ', StopSel=' || chr(3) || ', MaxWords=40') AS snippet,
+			-ts_rank(document, q) AS rank
+		FROM page_fts, websearch_to_tsquery('simple', ?) AS q
+		WHERE document @@ q
+		ORDER BY rank LIMIT ?`,
+		query, limit)
+}
+
+// rebind rewrites ? placeholders to PostgreSQL's $1, $2, ..., leaving
+// question marks alone inside string literals, quoted identifiers, and
+// comments.
+func rebind(query string) string {
+	if !strings.Contains(query, "?") {
+		return query
+	}
+	var b strings.Builder
+	b.Grow(len(query) + 8)
+	n := 0
+	for i := 0; i < len(query); i++ {
+		c := query[i]
+		switch {
+		case c == '\'' || c == '"':
+			end := strings.IndexByte(query[i+1:], c)
+			if end < 0 {
+				b.WriteString(query[i:])
+				return b.String()
+			}
+			b.WriteString(query[i : i+end+2])
+			i += end + 1
+		case c == '-' && strings.HasPrefix(query[i:], "--"):
+			end := strings.IndexByte(query[i:], '\n')
+			if end < 0 {
+				b.WriteString(query[i:])
+				return b.String()
+			}
+			b.WriteString(query[i : i+end])
+			i += end - 1
+		case c == '/' && strings.HasPrefix(query[i:], "/*"):
+			end := strings.Index(query[i+2:], "*/")
+			if end < 0 {
+				b.WriteString(query[i:])
+				return b.String()
+			}
+			b.WriteString(query[i : i+end+4])
+			i += end + 3
+		case c == '?':
+			n++
+			b.WriteByte('$')
+			b.WriteString(strconv.Itoa(n))
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// rebindConnector opens connections of driver whose queries pass through
+// rebind.
+type rebindConnector struct {
+	driver driver.Driver
+	dsn    string
+}
+
+func (c rebindConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	var conn driver.Conn
+	var err error
+	if dc, ok := c.driver.(driver.DriverContext); ok {
+		var connector driver.Connector
+		if connector, err = dc.OpenConnector(c.dsn); err != nil {
+			return nil, err
+		}
+		conn, err = connector.Connect(ctx)
+	} else {
+		conn, err = c.driver.Open(c.dsn)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &rebindConn{conn}, nil
+}
+
+func (c rebindConnector) Driver() driver.Driver {
+	return c.driver
+}
+
+// rebindConn rewrites the placeholders of every statement and otherwise
+// hands each call to the wrapped connection, reporting driver.ErrSkip where
+// it lacks an optional interface so database/sql falls back as usual.
+type rebindConn struct {
+	driver.Conn
+}
+
+func (c *rebindConn) Prepare(query string) (driver.Stmt, error) {
+	return c.Conn.Prepare(rebind(query))
+}
+
+func (c *rebindConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	if p, ok := c.Conn.(driver.ConnPrepareContext); ok {
+		return p.PrepareContext(ctx, rebind(query))
+	}
+	return c.Conn.Prepare(rebind(query))
+}
+
+func (c *rebindConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	if e, ok := c.Conn.(driver.ExecerContext); ok {
+		return e.ExecContext(ctx, rebind(query), args)
+	}
+	return nil, driver.ErrSkip
+}
+
+func (c *rebindConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	if q, ok := c.Conn.(driver.QueryerContext); ok {
+		return q.QueryContext(ctx, rebind(query), args)
+	}
+	return nil, driver.ErrSkip
+}
+
+func (c *rebindConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	if b, ok := c.Conn.(driver.ConnBeginTx); ok {
+		return b.BeginTx(ctx, opts)
+	}
+	return c.Conn.Begin()
+}
+
+func (c *rebindConn) Ping(ctx context.Context) error {
+	if p, ok := c.Conn.(driver.Pinger); ok {
+		return p.Ping(ctx)
+	}
+	return nil
+}
+
+func (c *rebindConn) ResetSession(ctx context.Context) error {
+	if r, ok := c.Conn.(driver.SessionResetter); ok {
+		return r.ResetSession(ctx)
+	}
+	return nil
+}
+
+func (c *rebindConn) IsValid() bool {
+	if v, ok := c.Conn.(driver.Validator); ok {
+		return v.IsValid()
+	}
+	return true
+}
+
+func (c *rebindConn) CheckNamedValue(nv *driver.NamedValue) error {
+	if n, ok := c.Conn.(driver.NamedValueChecker); ok {
+		return n.CheckNamedValue(nv)
+	}
+	return driver.ErrSkip
+}
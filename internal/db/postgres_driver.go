@@ -0,0 +1,7 @@
+//go:build postgres
+
+package db
+
+// Building with -tags postgres links in the pgx driver, after
+// "go get github.com/jackc/pgx/v5" adds it to go.mod.
+import _ "github.com/jackc/pgx/v5/stdlib"
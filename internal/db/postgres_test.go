@@ -0,0 +1,90 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRebind(t *testing.T) {
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{"SELECT 1", "SELECT 1"},
+		{"SELECT * FROM t WHERE a = ? AND b = ?", "SELECT * FROM t WHERE a = $1 AND b = $2"},
+		{"SELECT '?' FROM t WHERE a = ?", "SELECT '?' FROM t WHERE a = $1"},
+		{"SELECT 'it''s ?' WHERE a = ?", "SELECT 'it''s ?' WHERE a = $1"},
+		{`SELECT "odd?name" FROM t WHERE a = ?`, `SELECT "odd?name" FROM t WHERE a = $1`},
+		{"-- why?\nSELECT ?", "-- why?\nSELECT $1"},
+		{"/* ? */ SELECT ?", "/* ? */ SELECT $1"},
+		{"SELECT ? -- trailing?", "SELECT $1 -- trailing?"},
+		{"SELECT 'unterminated ?", "SELECT 'unterminated ?"},
+	}
+	for _, tt := range tests {
+		if got := rebind(tt.query); got != tt.want {
+			t.Errorf("rebind(%q) = %q, want %q", tt.query, got, tt.want)
+		}
+	}
+}
+
+// TestRebindConn runs the SQLite schema and queries through the rebinding
+// connection wrapper; SQLite accepts $n placeholders too.
+func TestRebindConn(t *testing.T) {
+	probe, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	drv := probe.Driver()
+	probe.Close()
+
+	dsn := filepath.Join(t.TempDir(), "wiki.db") + "?_foreign_keys=1"
+	conn := sql.OpenDB(rebindConnector{driver: drv, dsn: dsn})
+	database := &Database{conn: conn, Queries: New(conn)}
+	t.Cleanup(func() { database.Close() })
+
+	ctx := context.Background()
+	if err := database.Migrate(ctx); err != nil {
+		t.Fatalf("Migrate() failed: %v", err)
+	}
+	user, err := database.Queries.CreateUser(ctx, CreateUserParams{
+		Name:      "Alice",
+		Email:     "alice@example.com",
+		FirstSeen: NullTime(time.Now()),
+		IsAdmin:   NullBool(true),
+	})
+	if err != nil {
+		t.Fatalf("CreateUser() failed: %v", err)
+	}
+	got, err := database.Queries.GetUserByEmail(ctx, "alice@example.com")
+	if err != nil || got.ID != user.ID {
+		t.Fatalf("GetUserByEmail() = %+v, %v; want id %d", got, err, user.ID)
+	}
+	if err := database.UpsertPageLinks(ctx, "a", []string{"b", "b", "c"}); err != nil {
+		t.Fatalf("UpsertPageLinks() failed: %v", err)
+	}
+	backlinks, err := database.GetBacklinks(ctx, "b")
+	if err != nil || len(backlinks) != 1 {
+		t.Errorf("GetBacklinks() = %v, %v; want [a]", backlinks, err)
+	}
+}
+
+func TestOpen_PostgresWithoutDriver(t *testing.T) {
+	if _, err := Open("postgres://localhost/wiki"); !errors.Is(err, ErrPostgresUnavailable) {
+		t.Errorf("Open() error = %v, want ErrPostgresUnavailable", err)
+	}
+}
+
+func TestPostgresMigrations(t *testing.T) {
+	latest := migrations[len(migrations)-1].version
+	pgLatest := postgresSchemaVersion
+	if n := len(postgresMigrations); n > 0 {
+		pgLatest = postgresMigrations[n-1].version
+	}
+	if pgLatest != latest {
+		t.Errorf("PostgreSQL migrations end at version %d, but the latest migration is %d", pgLatest, latest)
+	}
+}
@@ -14,23 +14,23 @@ DELETE FROM preferences WHERE name = ?;
 -- User queries
 
 -- name: GetUserByID :one
-SELECT * FROM user WHERE id = ? LIMIT 1;
+SELECT * FROM "user" WHERE id = ? LIMIT 1;
 
 -- name: GetUserByEmail :one
-SELECT * FROM user WHERE email = ? LIMIT 1;
+SELECT * FROM "user" WHERE email = ? LIMIT 1;
 
 -- name: ListUsers :many
-SELECT * FROM user ORDER BY name;
+SELECT * FROM "user" ORDER BY name;
 
 -- name: CreateUser :one
-INSERT INTO user (
+INSERT INTO "user" (
     name, email, password_hash, first_seen, last_seen,
     is_approved, is_admin, email_confirmed, allow_read, allow_write, allow_upload
 ) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 RETURNING *;
 
 -- name: UpdateUser :exec
-UPDATE user SET
+UPDATE "user" SET
     name = ?,
     email = ?,
     password_hash = ?,
@@ -44,16 +44,16 @@ UPDATE user SET
 WHERE id = ?;
 
 -- name: UpdateUserLastSeen :exec
-UPDATE user SET last_seen = ? WHERE id = ?;
+UPDATE "user" SET last_seen = ? WHERE id = ?;
 
 -- name: DeleteUser :exec
-DELETE FROM user WHERE id = ?;
+DELETE FROM "user" WHERE id = ?;
 
 -- name: CountUsers :one
-SELECT COUNT(*) FROM user;
+SELECT COUNT(*) FROM "user";
 
 -- name: CountAdmins :one
-SELECT COUNT(*) FROM user WHERE is_admin = TRUE;
+SELECT COUNT(*) FROM "user" WHERE is_admin = TRUE;
 
 -- Drafts queries
 
@@ -63,6 +63,9 @@ SELECT * FROM drafts WHERE pagepath = ? AND author_email = ? LIMIT 1;
 -- name: GetDraftByID :one
 SELECT * FROM drafts WHERE id = ? LIMIT 1;
 
+-- name: ListDraftsByAuthor :many
+SELECT * FROM drafts WHERE author_email = ? ORDER BY datetime DESC;
+
 -- name: ListDraftsByPagepath :many
 SELECT * FROM drafts WHERE pagepath = ? ORDER BY datetime DESC;
 
@@ -97,6 +100,9 @@ DELETE FROM drafts WHERE pagepath = ? AND author_email = ?;
 -- name: DeleteDraftByID :exec
 DELETE FROM drafts WHERE id = ?;
 
+-- name: DeleteDraftsBefore :exec
+DELETE FROM drafts WHERE datetime < ?;
+
 -- name: DeleteExpiredAnonymousDrafts :exec
 DELETE FROM drafts WHERE author_email LIKE 'anonymous_uid:%' AND datetime < ?;
 
@@ -132,6 +138,12 @@ SELECT * FROM issues WHERE category = ? ORDER BY created_at DESC;
 -- name: ListIssuesByCategoryAndStatus :many
 SELECT * FROM issues WHERE category = ? AND status = ? ORDER BY created_at DESC;
 
+-- name: ListIssuesByCreator :many
+SELECT * FROM issues WHERE created_by_email = ? ORDER BY created_at DESC LIMIT ?;
+
+-- name: ListRecentlyUpdatedIssues :many
+SELECT * FROM issues ORDER BY updated_at DESC, id DESC LIMIT ?;
+
 -- name: CreateIssue :one
 INSERT INTO issues (title, description, status, category, tags, created_by_name, created_by_email, created_at, updated_at)
 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?) RETURNING *;
@@ -157,6 +169,9 @@ VALUES (?, ?, ?, ?, ?, ?) RETURNING *;
 -- name: ListIssueComments :many
 SELECT * FROM issue_comments WHERE issue_id = ? ORDER BY created_at ASC;
 
+-- name: ListIssueCommentsByAuthor :many
+SELECT * FROM issue_comments WHERE author_email = ? ORDER BY created_at DESC LIMIT ?;
+
 -- name: GetIssueComment :one
 SELECT * FROM issue_comments WHERE id = ?;
 
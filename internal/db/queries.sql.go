@@ -20,7 +20,7 @@ func (q *Queries) ClearExpiredCache(ctx context.Context, datetime sql.NullTime)
 }
 
 const countAdmins = `-- name: CountAdmins :one
-SELECT COUNT(*) FROM user WHERE is_admin = TRUE
+SELECT COUNT(*) FROM "user" WHERE is_admin = TRUE
 `
 
 func (q *Queries) CountAdmins(ctx context.Context) (int64, error) {
@@ -53,7 +53,7 @@ func (q *Queries) CountIssuesByStatus(ctx context.Context, status string) (int64
 }
 
 const countUsers = `-- name: CountUsers :one
-SELECT COUNT(*) FROM user
+SELECT COUNT(*) FROM "user"
 `
 
 func (q *Queries) CountUsers(ctx context.Context) (int64, error) {
@@ -188,7 +188,7 @@ func (q *Queries) CreateIssueComment(ctx context.Context, arg CreateIssueComment
 }
 
 const createUser = `-- name: CreateUser :one
-INSERT INTO user (
+INSERT INTO "user" (
     name, email, password_hash, first_seen, last_seen,
     is_approved, is_admin, email_confirmed, allow_read, allow_write, allow_upload
 ) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
@@ -273,6 +273,15 @@ func (q *Queries) DeleteDraftByID(ctx context.Context, id int64) error {
 	return err
 }
 
+const deleteDraftsBefore = `-- name: DeleteDraftsBefore :exec
+DELETE FROM drafts WHERE datetime < ?
+`
+
+func (q *Queries) DeleteDraftsBefore(ctx context.Context, datetime sql.NullTime) error {
+	_, err := q.db.ExecContext(ctx, deleteDraftsBefore, datetime)
+	return err
+}
+
 const deleteExpiredAnonymousDrafts = `-- name: DeleteExpiredAnonymousDrafts :exec
 DELETE FROM drafts WHERE author_email LIKE 'anonymous_uid:%' AND datetime < ?
 `
@@ -319,7 +328,7 @@ func (q *Queries) DeletePreference(ctx context.Context, name string) error {
 }
 
 const deleteUser = `-- name: DeleteUser :exec
-DELETE FROM user WHERE id = ?
+DELETE FROM "user" WHERE id = ?
 `
 
 func (q *Queries) DeleteUser(ctx context.Context, id int64) error {
@@ -442,7 +451,7 @@ func (q *Queries) GetPreference(ctx context.Context, name string) (Preference, e
 }
 
 const getUserByEmail = `-- name: GetUserByEmail :one
-SELECT id, name, email, password_hash, first_seen, last_seen, is_approved, is_admin, email_confirmed, allow_read, allow_write, allow_upload FROM user WHERE email = ? LIMIT 1
+SELECT id, name, email, password_hash, first_seen, last_seen, is_approved, is_admin, email_confirmed, allow_read, allow_write, allow_upload FROM "user" WHERE email = ? LIMIT 1
 `
 
 func (q *Queries) GetUserByEmail(ctx context.Context, email string) (User, error) {
@@ -467,7 +476,7 @@ func (q *Queries) GetUserByEmail(ctx context.Context, email string) (User, error
 
 const getUserByID = `-- name: GetUserByID :one
 
-SELECT id, name, email, password_hash, first_seen, last_seen, is_approved, is_admin, email_confirmed, allow_read, allow_write, allow_upload FROM user WHERE id = ? LIMIT 1
+SELECT id, name, email, password_hash, first_seen, last_seen, is_approved, is_admin, email_confirmed, allow_read, allow_write, allow_upload FROM "user" WHERE id = ? LIMIT 1
 `
 
 // User queries
@@ -518,6 +527,42 @@ func (q *Queries) ListDistinctCategories(ctx context.Context) ([]sql.NullString,
 	return items, nil
 }
 
+const listDraftsByAuthor = `-- name: ListDraftsByAuthor :many
+SELECT id, pagepath, revision, author_email, content, cursor_line, cursor_ch, datetime FROM drafts WHERE author_email = ? ORDER BY datetime DESC
+`
+
+func (q *Queries) ListDraftsByAuthor(ctx context.Context, authorEmail sql.NullString) ([]Draft, error) {
+	rows, err := q.db.QueryContext(ctx, listDraftsByAuthor, authorEmail)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []Draft{}
+	for rows.Next() {
+		var i Draft
+		if err := rows.Scan(
+			&i.ID,
+			&i.Pagepath,
+			&i.Revision,
+			&i.AuthorEmail,
+			&i.Content,
+			&i.CursorLine,
+			&i.CursorCh,
+			&i.Datetime,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const listDraftsByPagepath = `-- name: ListDraftsByPagepath :many
 SELECT id, pagepath, revision, author_email, content, cursor_line, cursor_ch, datetime FROM drafts WHERE pagepath = ? ORDER BY datetime DESC
 `
@@ -589,6 +634,46 @@ func (q *Queries) ListIssueComments(ctx context.Context, issueID int64) ([]Issue
 	return items, nil
 }
 
+const listIssueCommentsByAuthor = `-- name: ListIssueCommentsByAuthor :many
+SELECT id, issue_id, content, author_name, author_email, created_at, updated_at FROM issue_comments WHERE author_email = ? ORDER BY created_at DESC LIMIT ?
+`
+
+type ListIssueCommentsByAuthorParams struct {
+	AuthorEmail sql.NullString `json:"author_email"`
+	Limit       int64          `json:"limit"`
+}
+
+func (q *Queries) ListIssueCommentsByAuthor(ctx context.Context, arg ListIssueCommentsByAuthorParams) ([]IssueComment, error) {
+	rows, err := q.db.QueryContext(ctx, listIssueCommentsByAuthor, arg.AuthorEmail, arg.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []IssueComment{}
+	for rows.Next() {
+		var i IssueComment
+		if err := rows.Scan(
+			&i.ID,
+			&i.IssueID,
+			&i.Content,
+			&i.AuthorName,
+			&i.AuthorEmail,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const listIssues = `-- name: ListIssues :many
 SELECT id, title, description, status, category, tags, created_by_name, created_by_email, created_at, updated_at FROM issues ORDER BY category, created_at DESC
 `
@@ -708,6 +793,49 @@ func (q *Queries) ListIssuesByCategoryAndStatus(ctx context.Context, arg ListIss
 	return items, nil
 }
 
+const listIssuesByCreator = `-- name: ListIssuesByCreator :many
+SELECT id, title, description, status, category, tags, created_by_name, created_by_email, created_at, updated_at FROM issues WHERE created_by_email = ? ORDER BY created_at DESC LIMIT ?
+`
+
+type ListIssuesByCreatorParams struct {
+	CreatedByEmail sql.NullString `json:"created_by_email"`
+	Limit          int64          `json:"limit"`
+}
+
+func (q *Queries) ListIssuesByCreator(ctx context.Context, arg ListIssuesByCreatorParams) ([]Issue, error) {
+	rows, err := q.db.QueryContext(ctx, listIssuesByCreator, arg.CreatedByEmail, arg.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []Issue{}
+	for rows.Next() {
+		var i Issue
+		if err := rows.Scan(
+			&i.ID,
+			&i.Title,
+			&i.Description,
+			&i.Status,
+			&i.Category,
+			&i.Tags,
+			&i.CreatedByName,
+			&i.CreatedByEmail,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const listIssuesByStatus = `-- name: ListIssuesByStatus :many
 SELECT id, title, description, status, category, tags, created_by_name, created_by_email, created_at, updated_at FROM issues WHERE status = ? ORDER BY category, created_at DESC
 `
@@ -773,8 +901,46 @@ func (q *Queries) ListPreferences(ctx context.Context) ([]Preference, error) {
 	return items, nil
 }
 
+const listRecentlyUpdatedIssues = `-- name: ListRecentlyUpdatedIssues :many
+SELECT id, title, description, status, category, tags, created_by_name, created_by_email, created_at, updated_at FROM issues ORDER BY updated_at DESC, id DESC LIMIT ?
+`
+
+func (q *Queries) ListRecentlyUpdatedIssues(ctx context.Context, limit int64) ([]Issue, error) {
+	rows, err := q.db.QueryContext(ctx, listRecentlyUpdatedIssues, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []Issue{}
+	for rows.Next() {
+		var i Issue
+		if err := rows.Scan(
+			&i.ID,
+			&i.Title,
+			&i.Description,
+			&i.Status,
+			&i.Category,
+			&i.Tags,
+			&i.CreatedByName,
+			&i.CreatedByEmail,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const listUsers = `-- name: ListUsers :many
-SELECT id, name, email, password_hash, first_seen, last_seen, is_approved, is_admin, email_confirmed, allow_read, allow_write, allow_upload FROM user ORDER BY name
+SELECT id, name, email, password_hash, first_seen, last_seen, is_approved, is_admin, email_confirmed, allow_read, allow_write, allow_upload FROM "user" ORDER BY name
 `
 
 func (q *Queries) ListUsers(ctx context.Context) ([]User, error) {
@@ -888,7 +1054,7 @@ func (q *Queries) UpdateIssue(ctx context.Context, arg UpdateIssueParams) error
 }
 
 const updateUser = `-- name: UpdateUser :exec
-UPDATE user SET
+UPDATE "user" SET
     name = ?,
     email = ?,
     password_hash = ?,
@@ -934,7 +1100,7 @@ func (q *Queries) UpdateUser(ctx context.Context, arg UpdateUserParams) error {
 }
 
 const updateUserLastSeen = `-- name: UpdateUserLastSeen :exec
-UPDATE user SET last_seen = ? WHERE id = ?
+UPDATE "user" SET last_seen = ? WHERE id = ?
 `
 
 type UpdateUserLastSeenParams struct {
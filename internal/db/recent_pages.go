@@ -0,0 +1,61 @@
+package db
+
+import (
+	"context"
+	"time"
+)
+
+// RecentPagesKept is the number of pages viewed last kept for each user.
+const RecentPagesKept = 50
+
+// RecentPage is a page a user viewed, and when they last did.
+type RecentPage struct {
+	Pagepath string
+	ViewedAt time.Time
+}
+
+// RecordRecentPage notes that the user with userID viewed the page at
+// pagepath at at, forgetting the pages they viewed before their last
+// RecentPagesKept.
+func (d *Database) RecordRecentPage(ctx context.Context, userID int64, pagepath string, at time.Time) error {
+	tx, err := d.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `INSERT INTO recent_pages (user_id, pagepath, viewed_at) VALUES (?, ?, ?)
+		ON CONFLICT (user_id, pagepath) DO UPDATE SET viewed_at = excluded.viewed_at`,
+		userID, pagepath, at.Unix()); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM recent_pages WHERE user_id = ? AND pagepath NOT IN (
+		SELECT pagepath FROM recent_pages WHERE user_id = ? ORDER BY viewed_at DESC, pagepath LIMIT ?)`,
+		userID, userID, RecentPagesKept); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// ListRecentPages returns the pages the user with userID viewed last, the
+// latest first.
+func (d *Database) ListRecentPages(ctx context.Context, userID int64) ([]RecentPage, error) {
+	rows, err := d.conn.QueryContext(ctx, `SELECT pagepath, viewed_at FROM recent_pages
+		WHERE user_id = ? ORDER BY viewed_at DESC, pagepath`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var pages []RecentPage
+	for rows.Next() {
+		var p RecentPage
+		var viewedAt int64
+		if err := rows.Scan(&p.Pagepath, &viewedAt); err != nil {
+			return nil, err
+		}
+		p.ViewedAt = time.Unix(viewedAt, 0).UTC()
+		pages = append(pages, p)
+	}
+	return pages, rows.Err()
+}
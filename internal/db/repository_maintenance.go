@@ -0,0 +1,49 @@
+package db
+
+import (
+	"context"
+	"time"
+)
+
+// RepositoryMaintenance is a row of repository_maintenance: the outcome of
+// one run of the repository maintenance.
+type RepositoryMaintenance struct {
+	RanAt        time.Time
+	SizeBefore   int64 // Bytes of the object store before the run
+	SizeAfter    int64 // Bytes of the object store after it
+	LooseObjects int   // Loose objects left after the run
+	Packs        int   // Packs left after the run
+	Duration     time.Duration
+}
+
+// RecordRepositoryMaintenance adds a run of the repository maintenance.
+func (d *Database) RecordRepositoryMaintenance(ctx context.Context, m RepositoryMaintenance) error {
+	_, err := d.conn.ExecContext(ctx, `INSERT INTO repository_maintenance
+		(ran_at, size_before, size_after, loose_objects, packs, duration_ms) VALUES (?, ?, ?, ?, ?, ?)`,
+		m.RanAt.Unix(), m.SizeBefore, m.SizeAfter, m.LooseObjects, m.Packs, m.Duration.Milliseconds())
+	return err
+}
+
+// ListRepositoryMaintenance returns up to limit of the latest runs of the
+// repository maintenance, newest first.
+func (d *Database) ListRepositoryMaintenance(ctx context.Context, limit int) ([]RepositoryMaintenance, error) {
+	rows, err := d.conn.QueryContext(ctx, `SELECT ran_at, size_before, size_after, loose_objects, packs, duration_ms
+		FROM repository_maintenance ORDER BY ran_at DESC LIMIT ?`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var runs []RepositoryMaintenance
+	for rows.Next() {
+		var m RepositoryMaintenance
+		var ranAt, durationMS int64
+		if err := rows.Scan(&ranAt, &m.SizeBefore, &m.SizeAfter, &m.LooseObjects, &m.Packs, &durationMS); err != nil {
+			return nil, err
+		}
+		m.RanAt = time.Unix(ranAt, 0).UTC()
+		m.Duration = time.Duration(durationMS) * time.Millisecond
+		runs = append(runs, m)
+	}
+	return runs, rows.Err()
+}
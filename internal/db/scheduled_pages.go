@@ -0,0 +1,96 @@
+package db
+
+import (
+	"context"
+	"time"
+)
+
+// ScheduledPage is a row of scheduled_pages: a draft its author scheduled
+// to be saved as their page at PublishAt.
+type ScheduledPage struct {
+	ID          int64
+	Pagepath    string
+	Revision    string // Revision of the page the draft was made on; "" for a new page
+	Content     string
+	Message     string // Commit message
+	AuthorName  string
+	AuthorEmail string
+	PublishAt   time.Time
+	CreatedAt   time.Time
+	Error       string // Why publishing failed; "" while it is pending
+}
+
+const scheduledPageColumns = `id, pagepath, revision, content, message, author_name, author_email, publish_at, created_at, error`
+
+// SchedulePage adds a scheduled publication, returning its ID.
+func (d *Database) SchedulePage(ctx context.Context, p ScheduledPage) (int64, error) {
+	var id int64
+	err := d.conn.QueryRowContext(ctx, `INSERT INTO scheduled_pages
+		(pagepath, revision, content, message, author_name, author_email, publish_at, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?) RETURNING id`,
+		p.Pagepath, p.Revision, p.Content, p.Message, p.AuthorName, p.AuthorEmail,
+		p.PublishAt.Unix(), p.CreatedAt.Unix()).Scan(&id)
+	return id, err
+}
+
+// ListScheduledPages returns the scheduled publications of the author with
+// email, soonest first.
+func (d *Database) ListScheduledPages(ctx context.Context, email string) ([]ScheduledPage, error) {
+	return d.queryScheduledPages(ctx, `SELECT `+scheduledPageColumns+` FROM scheduled_pages
+		WHERE author_email = ? ORDER BY publish_at, id`, email)
+}
+
+// DueScheduledPages returns the scheduled publications due at now that have
+// not failed, soonest first.
+func (d *Database) DueScheduledPages(ctx context.Context, now time.Time) ([]ScheduledPage, error) {
+	return d.queryScheduledPages(ctx, `SELECT `+scheduledPageColumns+` FROM scheduled_pages
+		WHERE publish_at <= ? AND error = '' ORDER BY publish_at, id`, now.Unix())
+}
+
+// GetScheduledPage returns the scheduled publication with id, or
+// sql.ErrNoRows.
+func (d *Database) GetScheduledPage(ctx context.Context, id int64) (ScheduledPage, error) {
+	return scanScheduledPage(d.conn.QueryRowContext(ctx,
+		`SELECT `+scheduledPageColumns+` FROM scheduled_pages WHERE id = ?`, id))
+}
+
+// FailScheduledPage records why a scheduled publication could not be
+// published, which keeps it from being tried again.
+func (d *Database) FailScheduledPage(ctx context.Context, id int64, reason string) error {
+	_, err := d.conn.ExecContext(ctx, `UPDATE scheduled_pages SET error = ? WHERE id = ?`, reason, id)
+	return err
+}
+
+// DeleteScheduledPage removes a scheduled publication.
+func (d *Database) DeleteScheduledPage(ctx context.Context, id int64) error {
+	_, err := d.conn.ExecContext(ctx, `DELETE FROM scheduled_pages WHERE id = ?`, id)
+	return err
+}
+
+func (d *Database) queryScheduledPages(ctx context.Context, query string, args ...any) ([]ScheduledPage, error) {
+	rows, err := d.conn.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var pages []ScheduledPage
+	for rows.Next() {
+		p, err := scanScheduledPage(rows)
+		if err != nil {
+			return nil, err
+		}
+		pages = append(pages, p)
+	}
+	return pages, rows.Err()
+}
+
+func scanScheduledPage(row interface{ Scan(...any) error }) (ScheduledPage, error) {
+	var p ScheduledPage
+	var publishAt, createdAt int64
+	err := row.Scan(&p.ID, &p.Pagepath, &p.Revision, &p.Content, &p.Message,
+		&p.AuthorName, &p.AuthorEmail, &publishAt, &createdAt, &p.Error)
+	p.PublishAt = time.Unix(publishAt, 0)
+	p.CreatedAt = time.Unix(createdAt, 0)
+	return p, err
+}
@@ -0,0 +1,20 @@
+package db
+
+import (
+	"context"
+	"fmt"
+)
+
+// Snapshot writes a consistent copy of the database to path, which must not
+// exist, using VACUUM INTO. Writers are not blocked while it runs. For a
+// SQLCipher database the copy is encrypted with the same key. PostgreSQL
+// databases are backed up with pg_dump instead.
+func (d *Database) Snapshot(ctx context.Context, path string) error {
+	if d.postgres {
+		return fmt.Errorf("cannot snapshot a PostgreSQL database; back it up with pg_dump")
+	}
+	if _, err := d.conn.ExecContext(ctx, "VACUUM INTO ?", path); err != nil {
+		return fmt.Errorf("failed to snapshot database: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,79 @@
+package db
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"strings"
+	"time"
+)
+
+// UserAvatar is a row of user_avatars: the image a user uploaded as their
+// avatar, as a PNG.
+type UserAvatar struct {
+	UserID    int64
+	Data      []byte
+	UpdatedAt time.Time
+}
+
+// AvatarEmailHash returns the hash naming the avatar of the user with
+// email: the hex SHA-256 of the trimmed, lowercased address, as Gravatar
+// names them, so that avatar URLs do not give addresses away.
+func AvatarEmailHash(email string) string {
+	sum := sha256.Sum256([]byte(strings.ToLower(strings.TrimSpace(email))))
+	return hex.EncodeToString(sum[:])
+}
+
+// SetUserAvatar stores the avatar of a user, replacing any earlier one.
+func (d *Database) SetUserAvatar(ctx context.Context, userID int64, data []byte, now time.Time) error {
+	_, err := d.conn.ExecContext(ctx,
+		`INSERT INTO user_avatars (user_id, data, updated_at) VALUES (?, ?, ?)
+		ON CONFLICT (user_id) DO UPDATE SET data = excluded.data, updated_at = excluded.updated_at`,
+		userID, data, now.Unix())
+	return err
+}
+
+// DeleteUserAvatar removes the avatar of a user, if they have one.
+func (d *Database) DeleteUserAvatar(ctx context.Context, userID int64) error {
+	_, err := d.conn.ExecContext(ctx, `DELETE FROM user_avatars WHERE user_id = ?`, userID)
+	return err
+}
+
+// GetUserAvatar returns the avatar of a user, or sql.ErrNoRows.
+func (d *Database) GetUserAvatar(ctx context.Context, userID int64) (UserAvatar, error) {
+	a := UserAvatar{UserID: userID}
+	var updated int64
+	err := d.conn.QueryRowContext(ctx,
+		`SELECT data, updated_at FROM user_avatars WHERE user_id = ?`, userID).Scan(&a.Data, &updated)
+	a.UpdatedAt = time.Unix(updated, 0)
+	return a, err
+}
+
+// FindUserAvatar returns the user whose email has the AvatarEmailHash hash
+// and uploaded an avatar, with the time they did, leaving the image out.
+// It returns sql.ErrNoRows if there is none.
+func (d *Database) FindUserAvatar(ctx context.Context, hash string) (UserAvatar, error) {
+	rows, err := d.conn.QueryContext(ctx,
+		`SELECT a.user_id, u.email, a.updated_at FROM user_avatars a JOIN "user" u ON u.id = a.user_id`)
+	if err != nil {
+		return UserAvatar{}, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var a UserAvatar
+		var email string
+		var updated int64
+		if err := rows.Scan(&a.UserID, &email, &updated); err != nil {
+			return UserAvatar{}, err
+		}
+		if AvatarEmailHash(email) == hash {
+			a.UpdatedAt = time.Unix(updated, 0)
+			return a, nil
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return UserAvatar{}, err
+	}
+	return UserAvatar{}, sql.ErrNoRows
+}
@@ -0,0 +1,150 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+)
+
+// UserField is an admin-defined custom profile field (e.g. department).
+type UserField struct {
+	ID       int64  `json:"id"`
+	Name     string `json:"name"`
+	Label    string `json:"label"`
+	Position int64  `json:"position"`
+}
+
+// ListUserFields returns all custom profile field definitions in display order.
+func (d *Database) ListUserFields(ctx context.Context) ([]UserField, error) {
+	rows, err := d.conn.QueryContext(ctx,
+		`SELECT id, name, label, position FROM user_fields ORDER BY position, id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	fields := []UserField{}
+	for rows.Next() {
+		var f UserField
+		if err := rows.Scan(&f.ID, &f.Name, &f.Label, &f.Position); err != nil {
+			return nil, err
+		}
+		fields = append(fields, f)
+	}
+	return fields, rows.Err()
+}
+
+// CreateUserField adds a custom profile field definition, appended after the
+// existing fields.
+func (d *Database) CreateUserField(ctx context.Context, name, label string) (UserField, error) {
+	var f UserField
+	err := d.conn.QueryRowContext(ctx,
+		`INSERT INTO user_fields (name, label, position)
+		VALUES (?, ?, (SELECT COALESCE(MAX(position), 0) + 1 FROM user_fields))
+		RETURNING id, name, label, position`,
+		name, label).Scan(&f.ID, &f.Name, &f.Label, &f.Position)
+	return f, err
+}
+
+// DeleteUserField removes a field definition and every value stored for it.
+// Returns sql.ErrNoRows if no such field exists.
+func (d *Database) DeleteUserField(ctx context.Context, id int64) error {
+	res, err := d.conn.ExecContext(ctx, `DELETE FROM user_fields WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// GetUserFieldValues returns a user's custom field values keyed by field name.
+// Fields the user has not filled in are omitted.
+func (d *Database) GetUserFieldValues(ctx context.Context, userID int64) (map[string]string, error) {
+	rows, err := d.conn.QueryContext(ctx,
+		`SELECT f.name, v.value FROM user_field_values v
+		JOIN user_fields f ON f.id = v.field_id
+		WHERE v.user_id = ?`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	values := make(map[string]string)
+	for rows.Next() {
+		var name, value string
+		if err := rows.Scan(&name, &value); err != nil {
+			return nil, err
+		}
+		values[name] = value
+	}
+	return values, rows.Err()
+}
+
+// ListAllUserFieldValues returns the custom field values of every user, keyed
+// by user ID and then field name.
+func (d *Database) ListAllUserFieldValues(ctx context.Context) (map[int64]map[string]string, error) {
+	rows, err := d.conn.QueryContext(ctx,
+		`SELECT v.user_id, f.name, v.value FROM user_field_values v
+		JOIN user_fields f ON f.id = v.field_id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	values := make(map[int64]map[string]string)
+	for rows.Next() {
+		var userID int64
+		var name, value string
+		if err := rows.Scan(&userID, &name, &value); err != nil {
+			return nil, err
+		}
+		if values[userID] == nil {
+			values[userID] = make(map[string]string)
+		}
+		values[userID][name] = value
+	}
+	return values, rows.Err()
+}
+
+// SetUserFieldValues stores the given values (keyed by field name) for a user.
+// Names that do not match a defined field are ignored; an empty value clears
+// the field. Fields not present in values are left untouched.
+func (d *Database) SetUserFieldValues(ctx context.Context, userID int64, values map[string]string) error {
+	tx, err := d.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for name, value := range values {
+		var fieldID int64
+		err := tx.QueryRowContext(ctx, `SELECT id FROM user_fields WHERE name = ?`, name).Scan(&fieldID)
+		if err == sql.ErrNoRows {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		if value == "" {
+			if _, err := tx.ExecContext(ctx,
+				`DELETE FROM user_field_values WHERE user_id = ? AND field_id = ?`, userID, fieldID); err != nil {
+				return err
+			}
+			continue
+		}
+		if _, err := tx.ExecContext(ctx,
+			`INSERT INTO user_field_values (user_id, field_id, value) VALUES (?, ?, ?)
+			ON CONFLICT(user_id, field_id) DO UPDATE SET value = excluded.value`,
+			userID, fieldID, value); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
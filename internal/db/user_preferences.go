@@ -0,0 +1,69 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+)
+
+// User preference names.
+const (
+	// UserPrefColorScheme is "light" or "dark"; unset follows the browser.
+	UserPrefColorScheme = "color_scheme"
+	// UserPrefEmailNotifications is "off" to send the user no notification
+	// emails; unset sends them.
+	UserPrefEmailNotifications = "email_notifications"
+	// UserPrefEditorFontSize is the editor's font size in pixels; unset
+	// keeps the default.
+	UserPrefEditorFontSize = "editor_font_size"
+	// UserPrefLandingPage is the page, or /-/ route, the wiki's root leads
+	// the user to; unset leads to the site's home page.
+	UserPrefLandingPage = "landing_page"
+	// UserPrefPageSize is the number of entries per page of the paginated
+	// lists; unset keeps each list's own.
+	UserPrefPageSize = "page_size"
+)
+
+// ListUserPreferences returns every preference a user set, by name.
+func (d *Database) ListUserPreferences(ctx context.Context, userID int64) (map[string]string, error) {
+	rows, err := d.conn.QueryContext(ctx,
+		`SELECT name, value FROM user_preferences WHERE user_id = ?`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	prefs := make(map[string]string)
+	for rows.Next() {
+		var name, value string
+		if err := rows.Scan(&name, &value); err != nil {
+			return nil, err
+		}
+		prefs[name] = value
+	}
+	return prefs, rows.Err()
+}
+
+// GetUserPreference returns a user's preference, or "" if it is not set.
+func (d *Database) GetUserPreference(ctx context.Context, userID int64, name string) (string, error) {
+	var value string
+	err := d.conn.QueryRowContext(ctx,
+		`SELECT value FROM user_preferences WHERE user_id = ? AND name = ?`, userID, name).Scan(&value)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+	return value, err
+}
+
+// SetUserPreference stores a user's preference. An empty value unsets it.
+func (d *Database) SetUserPreference(ctx context.Context, userID int64, name, value string) error {
+	if value == "" {
+		_, err := d.conn.ExecContext(ctx,
+			`DELETE FROM user_preferences WHERE user_id = ? AND name = ?`, userID, name)
+		return err
+	}
+	_, err := d.conn.ExecContext(ctx,
+		`INSERT INTO user_preferences (user_id, name, value) VALUES (?, ?, ?)
+		ON CONFLICT (user_id, name) DO UPDATE SET value = excluded.value`,
+		userID, name, value)
+	return err
+}
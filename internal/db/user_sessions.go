@@ -0,0 +1,127 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// UserSession is a logged-in browser session. The session cookie carries a
+// token whose hash identifies the row; ID is for referring to the session in
+// forms without exposing the token.
+type UserSession struct {
+	ID        int64
+	UserID    int64
+	UserAgent string
+	IP        string
+	CreatedAt time.Time
+	LastSeen  time.Time
+}
+
+// CreateUserSession records a new session for userID, identified by the hash
+// of its token, and returns its ID.
+func (d *Database) CreateUserSession(ctx context.Context, tokenHash string, userID int64, userAgent, ip string) (int64, error) {
+	now := time.Now().Unix()
+	var id int64
+	err := d.conn.QueryRowContext(ctx,
+		`INSERT INTO user_sessions (token_hash, user_id, user_agent, ip, created_at, last_seen)
+		VALUES (?, ?, ?, ?, ?, ?) RETURNING id`,
+		tokenHash, userID, userAgent, ip, now, now).Scan(&id)
+	return id, err
+}
+
+// GetUserSession returns the session with the given token hash. Returns
+// sql.ErrNoRows if it does not exist, e.g. because it was revoked.
+func (d *Database) GetUserSession(ctx context.Context, tokenHash string) (UserSession, error) {
+	var s UserSession
+	var created, seen int64
+	err := d.conn.QueryRowContext(ctx,
+		`SELECT id, user_id, user_agent, ip, created_at, last_seen
+		FROM user_sessions WHERE token_hash = ?`, tokenHash).
+		Scan(&s.ID, &s.UserID, &s.UserAgent, &s.IP, &created, &seen)
+	s.CreatedAt, s.LastSeen = time.Unix(created, 0), time.Unix(seen, 0)
+	return s, err
+}
+
+// TouchUserSession records activity on a session from ip.
+func (d *Database) TouchUserSession(ctx context.Context, tokenHash, ip string) error {
+	_, err := d.conn.ExecContext(ctx,
+		`UPDATE user_sessions SET last_seen = ?, ip = ? WHERE token_hash = ?`,
+		time.Now().Unix(), ip, tokenHash)
+	return err
+}
+
+// ListUserSessions returns a user's sessions, most recently active first.
+func (d *Database) ListUserSessions(ctx context.Context, userID int64) ([]UserSession, error) {
+	rows, err := d.conn.QueryContext(ctx,
+		`SELECT id, user_id, user_agent, ip, created_at, last_seen
+		FROM user_sessions WHERE user_id = ? ORDER BY last_seen DESC, id DESC`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := []UserSession{}
+	for rows.Next() {
+		var s UserSession
+		var created, seen int64
+		if err := rows.Scan(&s.ID, &s.UserID, &s.UserAgent, &s.IP, &created, &seen); err != nil {
+			return nil, err
+		}
+		s.CreatedAt, s.LastSeen = time.Unix(created, 0), time.Unix(seen, 0)
+		sessions = append(sessions, s)
+	}
+	return sessions, rows.Err()
+}
+
+// DeleteUserSession revokes one of userID's sessions. Returns sql.ErrNoRows
+// if the user has no session with that ID.
+func (d *Database) DeleteUserSession(ctx context.Context, userID, id int64) error {
+	res, err := d.conn.ExecContext(ctx,
+		`DELETE FROM user_sessions WHERE id = ? AND user_id = ?`, id, userID)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// DeleteUserSessionByToken removes the session with the given token hash,
+// e.g. on logout.
+func (d *Database) DeleteUserSessionByToken(ctx context.Context, tokenHash string) error {
+	_, err := d.conn.ExecContext(ctx, `DELETE FROM user_sessions WHERE token_hash = ?`, tokenHash)
+	return err
+}
+
+// DeleteUserSessions revokes every session of userID and returns how many
+// there were.
+func (d *Database) DeleteUserSessions(ctx context.Context, userID int64) (int64, error) {
+	res, err := d.conn.ExecContext(ctx, `DELETE FROM user_sessions WHERE user_id = ?`, userID)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// DeleteUserSessionsExcept revokes every session of userID but the one
+// with ID keep, and returns how many it revoked.
+func (d *Database) DeleteUserSessionsExcept(ctx context.Context, userID, keep int64) (int64, error) {
+	res, err := d.conn.ExecContext(ctx, `DELETE FROM user_sessions WHERE user_id = ? AND id <> ?`, userID, keep)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// PruneUserSessions removes sessions inactive since before, whose cookies
+// have expired.
+func (d *Database) PruneUserSessions(ctx context.Context, before time.Time) error {
+	_, err := d.conn.ExecContext(ctx, `DELETE FROM user_sessions WHERE last_seen < ?`, before.Unix())
+	return err
+}
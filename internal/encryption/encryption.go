@@ -0,0 +1,98 @@
+// Package encryption provides optional encryption at rest: an AES-256-GCM
+// envelope for attachment blobs, key derivation for the encrypted SQLite
+// database, and pluggable sources for the master key.
+package encryption
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+)
+
+// KeySize is the length in bytes of master and derived keys.
+const KeySize = 32
+
+// Purposes for DeriveKey. Each use gets its own key so that neither can be
+// used to recover the other.
+const (
+	PurposeDatabase    = "gopherwiki database"
+	PurposeAttachments = "gopherwiki attachments"
+)
+
+// magic prefixes every sealed blob, identifying the format version.
+var magic = []byte("GWENC1\x00")
+
+// ErrDecrypt is returned when a sealed blob fails authentication, i.e. it was
+// sealed with a different key or has been tampered with.
+var ErrDecrypt = errors.New("encryption: message authentication failed")
+
+// DeriveKey derives a purpose-specific key from the master key.
+func DeriveKey(master []byte, purpose string) ([]byte, error) {
+	if len(master) != KeySize {
+		return nil, fmt.Errorf("encryption: master key must be %d bytes, got %d", KeySize, len(master))
+	}
+	return hkdf.Key(sha256.New, master, nil, purpose, KeySize)
+}
+
+// Cipher seals and opens blobs with AES-256-GCM. A sealed blob is the magic
+// prefix, a random nonce, and the ciphertext with its authentication tag.
+type Cipher struct {
+	aead cipher.AEAD
+}
+
+// NewCipher creates a Cipher from a 32-byte key.
+func NewCipher(key []byte) (*Cipher, error) {
+	if len(key) != KeySize {
+		return nil, fmt.Errorf("encryption: key must be %d bytes, got %d", KeySize, len(key))
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &Cipher{aead: aead}, nil
+}
+
+// Seal encrypts plaintext.
+func (c *Cipher) Seal(plaintext []byte) ([]byte, error) {
+	nonceSize := c.aead.NonceSize()
+	out := make([]byte, len(magic)+nonceSize, len(magic)+nonceSize+len(plaintext)+c.aead.Overhead())
+	copy(out, magic)
+	nonce := out[len(magic):]
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return c.aead.Seal(out, nonce, plaintext, magic), nil
+}
+
+// Open decrypts a blob produced by Seal. Data without the magic prefix is
+// returned unchanged, so files stored before encryption was enabled stay
+// readable.
+func (c *Cipher) Open(data []byte) ([]byte, error) {
+	if !IsSealed(data) {
+		return data, nil
+	}
+	nonceSize := c.aead.NonceSize()
+	body := data[len(magic):]
+	if len(body) < nonceSize {
+		return nil, ErrDecrypt
+	}
+	plaintext, err := c.aead.Open(nil, body[:nonceSize], body[nonceSize:], magic)
+	if err != nil {
+		return nil, ErrDecrypt
+	}
+	return plaintext, nil
+}
+
+// IsSealed reports whether data carries the sealed-blob prefix.
+func IsSealed(data []byte) bool {
+	return bytes.HasPrefix(data, magic)
+}
@@ -0,0 +1,134 @@
+package encryption
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"testing"
+)
+
+func testKey(b byte) []byte {
+	return bytes.Repeat([]byte{b}, KeySize)
+}
+
+func TestSealOpenRoundTrip(t *testing.T) {
+	c, err := NewCipher(testKey(1))
+	if err != nil {
+		t.Fatalf("NewCipher: %v", err)
+	}
+
+	plaintext := []byte("attachment contents")
+	sealed, err := c.Seal(plaintext)
+	if err != nil {
+		t.Fatalf("Seal: %v", err)
+	}
+	if !IsSealed(sealed) || bytes.Contains(sealed, plaintext) {
+		t.Fatalf("sealed blob should be prefixed and not contain the plaintext: %q", sealed)
+	}
+
+	again, _ := c.Seal(plaintext)
+	if bytes.Equal(sealed, again) {
+		t.Error("sealing twice should use fresh nonces")
+	}
+
+	opened, err := c.Open(sealed)
+	if err != nil || !bytes.Equal(opened, plaintext) {
+		t.Errorf("Open = %q, %v; want %q", opened, err, plaintext)
+	}
+}
+
+func TestOpenPassesThroughPlaintext(t *testing.T) {
+	c, _ := NewCipher(testKey(1))
+
+	legacy := []byte("stored before encryption was enabled")
+	opened, err := c.Open(legacy)
+	if err != nil || !bytes.Equal(opened, legacy) {
+		t.Errorf("Open(plaintext) = %q, %v; want it unchanged", opened, err)
+	}
+}
+
+func TestOpenRejectsWrongKeyAndTampering(t *testing.T) {
+	c, _ := NewCipher(testKey(1))
+	sealed, _ := c.Seal([]byte("secret"))
+
+	other, _ := NewCipher(testKey(2))
+	if _, err := other.Open(sealed); !errors.Is(err, ErrDecrypt) {
+		t.Errorf("wrong key: err = %v, want ErrDecrypt", err)
+	}
+
+	sealed[len(sealed)-1] ^= 0xff
+	if _, err := c.Open(sealed); !errors.Is(err, ErrDecrypt) {
+		t.Errorf("tampered: err = %v, want ErrDecrypt", err)
+	}
+
+	if _, err := c.Open(magic); !errors.Is(err, ErrDecrypt) {
+		t.Errorf("truncated: err = %v, want ErrDecrypt", err)
+	}
+}
+
+func TestDeriveKey(t *testing.T) {
+	db, err := DeriveKey(testKey(1), PurposeDatabase)
+	if err != nil {
+		t.Fatalf("DeriveKey: %v", err)
+	}
+	att, _ := DeriveKey(testKey(1), PurposeAttachments)
+	if len(db) != KeySize || bytes.Equal(db, att) || bytes.Equal(db, testKey(1)) {
+		t.Error("derived keys should be distinct per purpose and differ from the master key")
+	}
+
+	if _, err := DeriveKey([]byte("short"), PurposeDatabase); err == nil {
+		t.Error("DeriveKey should reject a short master key")
+	}
+}
+
+func TestParseKey(t *testing.T) {
+	key := testKey(7)
+	for _, s := range []string{
+		hex.EncodeToString(key),
+		base64.StdEncoding.EncodeToString(key),
+		base64.RawURLEncoding.EncodeToString(key),
+		"  " + base64.StdEncoding.EncodeToString(key) + "\n",
+	} {
+		got, err := ParseKey(s)
+		if err != nil || !bytes.Equal(got, key) {
+			t.Errorf("ParseKey(%q) = %x, %v", s, got, err)
+		}
+	}
+
+	for _, s := range []string{"", "not a key", hex.EncodeToString(key[:16])} {
+		if _, err := ParseKey(s); err == nil {
+			t.Errorf("ParseKey(%q) should fail", s)
+		}
+	}
+}
+
+func TestNewKeyProvider(t *testing.T) {
+	encoded := hex.EncodeToString(testKey(3))
+
+	if p, err := NewKeyProvider("", ""); p != nil || err != nil {
+		t.Errorf("no key source: got %v, %v; want nil, nil", p, err)
+	}
+	if _, err := NewKeyProvider(encoded, "echo x"); err == nil {
+		t.Error("both key sources set should be an error")
+	}
+
+	p, err := NewKeyProvider(encoded, "")
+	if err != nil {
+		t.Fatalf("NewKeyProvider: %v", err)
+	}
+	if key, err := p.MasterKey(context.Background()); err != nil || !bytes.Equal(key, testKey(3)) {
+		t.Errorf("static key = %x, %v", key, err)
+	}
+
+	p, _ = NewKeyProvider("", "echo "+encoded)
+	if key, err := p.MasterKey(context.Background()); err != nil || !bytes.Equal(key, testKey(3)) {
+		t.Errorf("command key = %x, %v", key, err)
+	}
+
+	p, _ = NewKeyProvider("", "echo broken >&2; exit 3")
+	if _, err := p.MasterKey(context.Background()); err == nil {
+		t.Error("a failing key command should be an error")
+	}
+}
@@ -0,0 +1,73 @@
+package encryption
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// KeyProvider supplies the master key. The built-in providers read it from
+// configuration or from the output of a command; deployments that keep the
+// key in a KMS or secret manager can implement KeyProvider directly, or point
+// the command provider at their CLI (e.g. `vault kv get -field=key ...`,
+// `aws kms decrypt ...`).
+type KeyProvider interface {
+	MasterKey(ctx context.Context) ([]byte, error)
+}
+
+// StaticKey is a KeyProvider for a key given in configuration.
+type StaticKey string
+
+// MasterKey parses the configured key.
+func (k StaticKey) MasterKey(context.Context) ([]byte, error) {
+	return ParseKey(string(k))
+}
+
+// CommandKey is a KeyProvider that runs a shell command and reads the key
+// from its standard output.
+type CommandKey string
+
+// MasterKey runs the command and parses its output.
+func (k CommandKey) MasterKey(ctx context.Context) ([]byte, error) {
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "sh", "-c", string(k))
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("encryption: key command failed: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return ParseKey(string(out))
+}
+
+// NewKeyProvider returns the provider for the configured key source, or nil
+// when neither is set. Setting both is an error.
+func NewKeyProvider(key, command string) (KeyProvider, error) {
+	switch {
+	case key != "" && command != "":
+		return nil, fmt.Errorf("encryption: set either ENCRYPTION_KEY or ENCRYPTION_KEY_COMMAND, not both")
+	case key != "":
+		return StaticKey(key), nil
+	case command != "":
+		return CommandKey(command), nil
+	}
+	return nil, nil
+}
+
+// ParseKey decodes a 32-byte key written as hex or (standard or URL-safe)
+// base64. Surrounding whitespace is ignored.
+func ParseKey(s string) ([]byte, error) {
+	s = strings.TrimSpace(s)
+	if b, err := hex.DecodeString(s); err == nil && len(b) == KeySize {
+		return b, nil
+	}
+	for _, enc := range []*base64.Encoding{base64.StdEncoding, base64.URLEncoding, base64.RawStdEncoding, base64.RawURLEncoding} {
+		if b, err := enc.DecodeString(s); err == nil && len(b) == KeySize {
+			return b, nil
+		}
+	}
+	return nil, fmt.Errorf("encryption: key must be %d bytes encoded as hex or base64 (generate one with `openssl rand -base64 32`)", KeySize)
+}
@@ -0,0 +1,184 @@
+// Package feeds renders RSS 2.0 and Atom 1.0 documents from a
+// format-neutral feed description. All text is escaped by encoding/xml, so
+// titles, names, and HTML content may contain arbitrary characters.
+package feeds
+
+import (
+	"encoding/xml"
+	"io"
+	"time"
+)
+
+// Feed describes a channel of entries, newest first.
+type Feed struct {
+	Title       string
+	Link        string // URL of the HTML page the feed describes
+	Description string
+	Items       []Item
+}
+
+// Item is a single feed entry.
+type Item struct {
+	Title       string
+	Link        string // Also used as the entry's unique ID
+	AuthorName  string
+	AuthorEmail string
+	Updated     time.Time
+	Content     string // HTML; omitted when empty
+}
+
+// Updated returns the timestamp of the newest item, or the zero time for an
+// empty feed.
+func (f *Feed) Updated() time.Time {
+	if len(f.Items) == 0 {
+		return time.Time{}
+	}
+	return f.Items[0].Updated
+}
+
+type rssDocument struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title         string    `xml:"title"`
+	Link          string    `xml:"link"`
+	Description   string    `xml:"description"`
+	LastBuildDate string    `xml:"lastBuildDate,omitempty"`
+	Items         []rssItem `xml:"item"`
+}
+
+type rssItem struct {
+	Title       string  `xml:"title"`
+	Link        string  `xml:"link"`
+	GUID        rssGUID `xml:"guid"`
+	PubDate     string  `xml:"pubDate"`
+	Author      string  `xml:"author,omitempty"`
+	Description string  `xml:"description,omitempty"`
+}
+
+type rssGUID struct {
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+	Value       string `xml:",chardata"`
+}
+
+// WriteRSS renders f as an RSS 2.0 document.
+func WriteRSS(w io.Writer, f *Feed) error {
+	doc := rssDocument{
+		Version: "2.0",
+		Channel: rssChannel{
+			Title:       f.Title,
+			Link:        f.Link,
+			Description: f.Description,
+		},
+	}
+	if updated := f.Updated(); !updated.IsZero() {
+		doc.Channel.LastBuildDate = updated.Format(time.RFC1123Z)
+	}
+
+	for _, item := range f.Items {
+		doc.Channel.Items = append(doc.Channel.Items, rssItem{
+			Title:       item.Title,
+			Link:        item.Link,
+			GUID:        rssGUID{IsPermaLink: true, Value: item.Link},
+			PubDate:     item.Updated.Format(time.RFC1123Z),
+			Author:      rssAuthor(item),
+			Description: item.Content,
+		})
+	}
+	return writeXML(w, doc)
+}
+
+// rssAuthor formats an item author the way RSS 2.0 expects: an email
+// address, optionally followed by the name in parentheses.
+func rssAuthor(item Item) string {
+	if item.AuthorEmail == "" {
+		return ""
+	}
+	if item.AuthorName == "" {
+		return item.AuthorEmail
+	}
+	return item.AuthorEmail + " (" + item.AuthorName + ")"
+}
+
+type atomFeed struct {
+	XMLName xml.Name    `xml:"feed"`
+	Xmlns   string      `xml:"xmlns,attr"`
+	Title   string      `xml:"title"`
+	Link    atomLink    `xml:"link"`
+	ID      string      `xml:"id"`
+	Updated string      `xml:"updated"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+}
+
+type atomEntry struct {
+	Title   string       `xml:"title"`
+	Link    atomLink     `xml:"link"`
+	ID      string       `xml:"id"`
+	Updated string       `xml:"updated"`
+	Author  atomAuthor   `xml:"author"`
+	Content *atomContent `xml:"content,omitempty"`
+}
+
+type atomAuthor struct {
+	Name  string `xml:"name"`
+	Email string `xml:"email,omitempty"`
+}
+
+type atomContent struct {
+	Type string `xml:"type,attr"`
+	Body string `xml:",chardata"`
+}
+
+// WriteAtom renders f as an Atom 1.0 document.
+func WriteAtom(w io.Writer, f *Feed) error {
+	updated := f.Updated()
+	if updated.IsZero() {
+		// <updated> is mandatory even for a feed without entries.
+		updated = time.Now()
+	}
+	doc := atomFeed{
+		Xmlns:   "http://www.w3.org/2005/Atom",
+		Title:   f.Title,
+		Link:    atomLink{Href: f.Link},
+		ID:      f.Link,
+		Updated: updated.UTC().Format(time.RFC3339),
+	}
+
+	for _, item := range f.Items {
+		entry := atomEntry{
+			Title:   item.Title,
+			Link:    atomLink{Href: item.Link},
+			ID:      item.Link,
+			Updated: item.Updated.UTC().Format(time.RFC3339),
+			Author:  atomAuthor{Name: item.AuthorName, Email: item.AuthorEmail},
+		}
+		if entry.Author.Name == "" {
+			// Atom requires a non-empty author name.
+			entry.Author.Name = "unknown"
+		}
+		if item.Content != "" {
+			entry.Content = &atomContent{Type: "html", Body: item.Content}
+		}
+		doc.Entries = append(doc.Entries, entry)
+	}
+	return writeXML(w, doc)
+}
+
+func writeXML(w io.Writer, doc interface{}) error {
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(doc); err != nil {
+		return err
+	}
+	return enc.Close()
+}
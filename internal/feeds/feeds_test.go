@@ -0,0 +1,132 @@
+package feeds
+
+import (
+	"bytes"
+	"encoding/xml"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testTime = time.Date(2025, 3, 1, 12, 30, 0, 0, time.UTC)
+
+func testFeed() *Feed {
+	return &Feed{
+		Title:       `Tom & Jerry's <Wiki>`,
+		Link:        "https://wiki.example.com/?a=1&b=2",
+		Description: "Recent changes",
+		Items: []Item{{
+			Title:       `Fix "quotes" & <tags>` + "\x01",
+			Link:        "https://wiki.example.com/-/commit/abc?x=1&y=2",
+			AuthorName:  "Zoë <z>",
+			AuthorEmail: "zoe@example.com",
+			Updated:     testTime,
+			Content:     `<p>Hello <strong>world</strong> &amp; friends</p>`,
+		}},
+	}
+}
+
+func TestWriteRSSEscapes(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteRSS(&buf, testFeed()); err != nil {
+		t.Fatalf("WriteRSS: %v", err)
+	}
+	out := buf.String()
+
+	if !strings.HasPrefix(out, xml.Header) {
+		t.Error("output should start with the XML declaration")
+	}
+	if strings.Contains(out, "<Wiki>") || strings.Contains(out, "<strong>") {
+		t.Errorf("markup must be escaped, got:\n%s", out)
+	}
+
+	var doc rssDocument
+	if err := xml.Unmarshal(buf.Bytes(), &doc); err != nil {
+		t.Fatalf("output is not well-formed XML: %v\n%s", err, out)
+	}
+	if doc.Channel.Title != `Tom & Jerry's <Wiki>` {
+		t.Errorf("channel title = %q", doc.Channel.Title)
+	}
+	item := doc.Channel.Items[0]
+	if !strings.HasPrefix(item.Title, `Fix "quotes" & <tags>`) || strings.Contains(item.Title, "\x01") {
+		t.Errorf("item title = %q, want escaped title with the control character replaced", item.Title)
+	}
+	if item.Link != "https://wiki.example.com/-/commit/abc?x=1&y=2" {
+		t.Errorf("item link = %q", item.Link)
+	}
+	if item.Description != testFeed().Items[0].Content {
+		t.Errorf("description = %q, want the HTML content round-tripped", item.Description)
+	}
+	if item.Author != "zoe@example.com (Zoë <z>)" {
+		t.Errorf("author = %q", item.Author)
+	}
+	if item.PubDate != "Sat, 01 Mar 2025 12:30:00 +0000" {
+		t.Errorf("pubDate = %q", item.PubDate)
+	}
+}
+
+func TestWriteAtomEscapes(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteAtom(&buf, testFeed()); err != nil {
+		t.Fatalf("WriteAtom: %v", err)
+	}
+
+	var doc atomFeed
+	if err := xml.Unmarshal(buf.Bytes(), &doc); err != nil {
+		t.Fatalf("output is not well-formed XML: %v\n%s", err, buf.String())
+	}
+	if doc.Updated != "2025-03-01T12:30:00Z" {
+		t.Errorf("feed updated = %q, want the newest entry time", doc.Updated)
+	}
+	entry := doc.Entries[0]
+	if entry.Link.Href != "https://wiki.example.com/-/commit/abc?x=1&y=2" || entry.ID != entry.Link.Href {
+		t.Errorf("entry link/id = %q/%q", entry.Link.Href, entry.ID)
+	}
+	if entry.Author.Name != "Zoë <z>" || entry.Author.Email != "zoe@example.com" {
+		t.Errorf("author = %+v", entry.Author)
+	}
+	if entry.Content == nil || entry.Content.Type != "html" || entry.Content.Body != testFeed().Items[0].Content {
+		t.Errorf("content = %+v, want html content round-tripped", entry.Content)
+	}
+}
+
+func TestWriteAtomEmptyFeed(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteAtom(&buf, &Feed{Title: "Empty", Link: "https://wiki.example.com/"}); err != nil {
+		t.Fatalf("WriteAtom: %v", err)
+	}
+
+	var doc atomFeed
+	if err := xml.Unmarshal(buf.Bytes(), &doc); err != nil {
+		t.Fatalf("output is not well-formed XML: %v", err)
+	}
+	if doc.Updated == "" || len(doc.Entries) != 0 {
+		t.Errorf("empty feed should have an updated time and no entries, got %+v", doc)
+	}
+}
+
+func TestOptionalFieldsOmitted(t *testing.T) {
+	f := &Feed{Title: "T", Link: "https://wiki.example.com/", Items: []Item{{
+		Title:   "no author or content",
+		Link:    "https://wiki.example.com/-/commit/1",
+		Updated: testTime,
+	}}}
+
+	var rss, atom bytes.Buffer
+	if err := WriteRSS(&rss, f); err != nil {
+		t.Fatalf("WriteRSS: %v", err)
+	}
+	if err := WriteAtom(&atom, f); err != nil {
+		t.Fatalf("WriteAtom: %v", err)
+	}
+	rssItem := rss.String()[strings.Index(rss.String(), "<item>"):]
+	if strings.Contains(rssItem, "<author>") || strings.Contains(rssItem, "<description>") {
+		t.Errorf("RSS items should omit empty author and description:\n%s", rss.String())
+	}
+	if strings.Contains(atom.String(), "<content") {
+		t.Errorf("Atom should omit empty content:\n%s", atom.String())
+	}
+	if !strings.Contains(atom.String(), "<name>unknown</name>") {
+		t.Errorf("Atom entries need an author name:\n%s", atom.String())
+	}
+}
@@ -9,7 +9,9 @@
 package frontmatter
 
 import (
+	"strconv"
 	"strings"
+	"time"
 
 	"gopkg.in/yaml.v3"
 )
@@ -49,6 +51,14 @@ type Frontmatter struct {
 	Engine string `yaml:"engine"`
 	// Execute carries the render controls.
 	Execute ExecuteOptions `yaml:"execute"`
+	// Aliases are alternative names the page can be linked by, as used by
+	// Obsidian.
+	Aliases Aliases `yaml:"aliases"`
+	// ReviewBy is the date by which the page should be reviewed; the page
+	// is reported stale once it has passed.
+	ReviewBy Date `yaml:"review_by"`
+	// NoIndex keeps the page out of search engines, the sitemap, and feeds.
+	NoIndex Flag `yaml:"noindex"`
 	// Raw is the full decoded mapping, for fields not explicitly modeled.
 	Raw map[string]any `yaml:"-"`
 }
@@ -70,6 +80,68 @@ func (f *Freeze) UnmarshalYAML(value *yaml.Node) error {
 	return nil
 }
 
+// Aliases is the aliases list. Obsidian writes it either as a YAML sequence
+// or, for a single alias, as a plain string; both forms are accepted.
+type Aliases []string
+
+// UnmarshalYAML accepts a scalar or a sequence of scalars. Empty entries are
+// dropped.
+func (a *Aliases) UnmarshalYAML(value *yaml.Node) error {
+	var names []string
+	switch value.Kind {
+	case yaml.ScalarNode:
+		names = []string{value.Value}
+	case yaml.SequenceNode:
+		if err := value.Decode(&names); err != nil {
+			return err
+		}
+	default:
+		return nil
+	}
+	*a = nil
+	for _, name := range names {
+		if name = strings.TrimSpace(name); name != "" {
+			*a = append(*a, name)
+		}
+	}
+	return nil
+}
+
+// Flag is a boolean setting. A value that is not a boolean leaves it false
+// rather than invalidating the block.
+type Flag bool
+
+// UnmarshalYAML reads a boolean scalar, ignoring anything else.
+func (f *Flag) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind != yaml.ScalarNode {
+		return nil
+	}
+	b, err := strconv.ParseBool(strings.TrimSpace(value.Value))
+	*f = Flag(b && err == nil)
+	return nil
+}
+
+// Date is a calendar date, written as 2006-01-02 or as an RFC 3339
+// timestamp. A value that is neither leaves it zero rather than
+// invalidating the block.
+type Date struct {
+	time.Time
+}
+
+// UnmarshalYAML reads a date scalar, ignoring anything else.
+func (d *Date) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind != yaml.ScalarNode {
+		return nil
+	}
+	for _, layout := range []string{"2006-01-02", time.RFC3339} {
+		if t, err := time.Parse(layout, strings.TrimSpace(value.Value)); err == nil {
+			d.Time = t
+			return nil
+		}
+	}
+	return nil
+}
+
 // Parse splits an optional leading YAML frontmatter block from content. It
 // returns the parsed frontmatter (nil when there is no valid block) and the
 // remaining body with the block removed. Detection is conservative: a leading
@@ -1,6 +1,9 @@
 package frontmatter
 
-import "testing"
+import (
+	"testing"
+	"time"
+)
 
 func TestParseNoFrontmatter(t *testing.T) {
 	content := "# Just a heading\n\nSome text.\n"
@@ -62,6 +65,74 @@ func TestParseFreezeBoolean(t *testing.T) {
 	}
 }
 
+func TestParseAliases(t *testing.T) {
+	tests := []struct {
+		content string
+		want    []string
+	}{
+		{"---\naliases:\n  - Getting Started\n  - Intro\n---\nbody\n", []string{"Getting Started", "Intro"}},
+		{"---\naliases: [One, \" \"]\n---\nbody\n", []string{"One"}},
+		{"---\naliases: Setup\n---\nbody\n", []string{"Setup"}},
+		{"---\naliases:\n---\nbody\n", nil},
+	}
+	for _, tt := range tests {
+		fm, _ := Parse(tt.content)
+		if fm == nil {
+			t.Fatalf("expected frontmatter in %q", tt.content)
+		}
+		if len(fm.Aliases) != len(tt.want) {
+			t.Fatalf("Aliases = %q, want %q", fm.Aliases, tt.want)
+		}
+		for i := range tt.want {
+			if fm.Aliases[i] != tt.want[i] {
+				t.Errorf("Aliases = %q, want %q", fm.Aliases, tt.want)
+			}
+		}
+	}
+}
+
+func TestParseReviewBy(t *testing.T) {
+	tests := []struct {
+		content string
+		want    time.Time
+	}{
+		{"---\nreview_by: 2026-03-01\n---\nbody\n", time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)},
+		{"---\nreview_by: \"2026-03-01T12:00:00Z\"\n---\nbody\n", time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)},
+		{"---\nreview_by: soon\n---\nbody\n", time.Time{}},
+		{"---\nreview_by: [2026-03-01]\ntitle: Kept\n---\nbody\n", time.Time{}},
+	}
+	for _, tt := range tests {
+		fm, _ := Parse(tt.content)
+		if fm == nil {
+			t.Fatalf("expected frontmatter in %q", tt.content)
+		}
+		if !fm.ReviewBy.Equal(tt.want) {
+			t.Errorf("ReviewBy of %q = %v, want %v", tt.content, fm.ReviewBy.Time, tt.want)
+		}
+	}
+}
+
+func TestParseNoIndex(t *testing.T) {
+	tests := []struct {
+		content string
+		want    bool
+	}{
+		{"---\nnoindex: true\n---\nbody\n", true},
+		{"---\nnoindex: false\n---\nbody\n", false},
+		{"---\nnoindex: sometimes\ntitle: Kept\n---\nbody\n", false},
+		{"---\ntitle: Unset\n---\nbody\n", false},
+	}
+	for _, tt := range tests {
+		fm, _ := Parse(tt.content)
+		if fm == nil {
+			t.Fatalf("expected frontmatter in %q", tt.content)
+		}
+		if bool(fm.NoIndex) != tt.want {
+			t.Errorf("NoIndex of %q = %v, want %v", tt.content, fm.NoIndex, tt.want)
+		}
+	}
+}
+
 func TestParseUnclosedIsNotFrontmatter(t *testing.T) {
 	// Leading --- with no closing delimiter is a thematic break, not metadata.
 	content := "---\nsome text that never closes\nmore text\n"
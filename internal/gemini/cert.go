@@ -0,0 +1,92 @@
+package gemini
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"os"
+	"time"
+)
+
+// certificateLifetime is how long a generated certificate is valid. Gemini
+// clients trust a server's certificate on first use and warn when it
+// changes, so it should rarely change.
+const certificateLifetime = 10 * 365 * 24 * time.Hour
+
+// LoadOrCreateCertificate loads the certificate and key in certFile and
+// keyFile. If neither exists, it creates a self-signed certificate for
+// hostname and saves it there. With both names empty the certificate is only
+// kept in memory.
+func LoadOrCreateCertificate(certFile, keyFile, hostname string) (tls.Certificate, error) {
+	if certFile != "" || keyFile != "" {
+		_, certErr := os.Stat(certFile)
+		_, keyErr := os.Stat(keyFile)
+		if certErr == nil || keyErr == nil {
+			return tls.LoadX509KeyPair(certFile, keyFile)
+		}
+		if !errors.Is(certErr, os.ErrNotExist) || !errors.Is(keyErr, os.ErrNotExist) {
+			return tls.Certificate{}, errors.Join(certErr, keyErr)
+		}
+	}
+
+	certPEM, keyPEM, err := generateCertificate(hostname)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	if certFile != "" {
+		if err := os.WriteFile(keyFile, keyPEM, 0o600); err != nil {
+			return tls.Certificate{}, fmt.Errorf("save key: %w", err)
+		}
+		if err := os.WriteFile(certFile, certPEM, 0o644); err != nil {
+			return tls.Certificate{}, fmt.Errorf("save certificate: %w", err)
+		}
+	}
+	return tls.X509KeyPair(certPEM, keyPEM)
+}
+
+// generateCertificate returns a PEM-encoded self-signed certificate and key
+// for hostname.
+func generateCertificate(hostname string) (certPEM, keyPEM []byte, err error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, nil, err
+	}
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: hostname},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(certificateLifetime),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+	}
+	if ip := net.ParseIP(hostname); ip != nil {
+		template.IPAddresses = []net.IP{ip}
+	} else {
+		template.DNSNames = []string{hostname}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	certPEM = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM = pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	return certPEM, keyPEM, nil
+}
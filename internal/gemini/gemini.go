@@ -0,0 +1,212 @@
+// Package gemini implements a read-only server for the Gemini protocol
+// (gemini://), a lightweight alternative to the web that serves gemtext
+// documents over TLS. See https://geminiprotocol.net/docs/protocol-specification.gmi.
+package gemini
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Response status codes.
+const (
+	StatusInput             = 10
+	StatusSuccess           = 20
+	StatusRedirect          = 30
+	StatusTemporaryFailure  = 40
+	StatusPermanentFailure  = 50
+	StatusNotFound          = 51
+	StatusProxyRefused      = 53
+	StatusBadRequest        = 59
+	StatusCertificateNeeded = 60
+)
+
+// MediaType is the media type of gemtext documents.
+const MediaType = "text/gemini; charset=utf-8"
+
+// maxRequestLength is the longest request URL the protocol allows.
+const maxRequestLength = 1024
+
+// requestTimeout bounds how long a client may take to send its request and
+// receive the response.
+const requestTimeout = 30 * time.Second
+
+// Request is a Gemini request.
+type Request struct {
+	URL *url.URL
+	// RemoteAddr is the network address of the client.
+	RemoteAddr string
+}
+
+// ResponseWriter writes a response: a header line with the status and its
+// meta text (the media type on success), then the body on success.
+type ResponseWriter interface {
+	WriteHeader(status int, meta string)
+	Write(p []byte) (int, error)
+}
+
+// Handler serves Gemini requests.
+type Handler interface {
+	ServeGemini(w ResponseWriter, r *Request)
+}
+
+// HandlerFunc adapts a function to Handler.
+type HandlerFunc func(w ResponseWriter, r *Request)
+
+// ServeGemini calls f(w, r).
+func (f HandlerFunc) ServeGemini(w ResponseWriter, r *Request) { f(w, r) }
+
+// Server serves Gemini over TLS.
+type Server struct {
+	Addr      string
+	TLSConfig *tls.Config
+	Handler   Handler
+
+	mu       sync.Mutex
+	listener net.Listener
+	conns    sync.WaitGroup
+}
+
+// ErrServerClosed is returned by ListenAndServe after Shutdown.
+var ErrServerClosed = errors.New("gemini: server closed")
+
+// ListenAndServe listens on Addr and serves connections until Shutdown.
+func (s *Server) ListenAndServe() error {
+	ln, err := net.Listen("tcp", s.Addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(ln)
+}
+
+// Serve serves connections accepted from ln until Shutdown.
+func (s *Server) Serve(ln net.Listener) error {
+	ln = tls.NewListener(ln, s.TLSConfig)
+	s.mu.Lock()
+	s.listener = ln
+	s.mu.Unlock()
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return ErrServerClosed
+			}
+			return err
+		}
+		s.conns.Add(1)
+		go func() {
+			defer s.conns.Done()
+			s.serveConn(conn)
+		}()
+	}
+}
+
+// Shutdown stops accepting connections and waits for open ones to finish, or
+// for ctx to end.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.mu.Lock()
+	ln := s.listener
+	s.mu.Unlock()
+	if ln != nil {
+		ln.Close()
+	}
+	done := make(chan struct{})
+	go func() {
+		s.conns.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (s *Server) serveConn(conn net.Conn) {
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(requestTimeout))
+
+	w := &response{w: bufio.NewWriter(conn)}
+	defer w.w.Flush()
+
+	req, status, meta := readRequest(conn)
+	if req == nil {
+		w.WriteHeader(status, meta)
+		return
+	}
+	req.RemoteAddr = conn.RemoteAddr().String()
+
+	defer func() {
+		if err := recover(); err != nil {
+			slog.Error("gemini handler panic", "url", req.URL.String(), "error", err)
+			w.WriteHeader(StatusTemporaryFailure, "Internal error")
+		}
+	}()
+	s.Handler.ServeGemini(w, req)
+	if !w.wroteHeader {
+		w.WriteHeader(StatusTemporaryFailure, "No response")
+	}
+}
+
+// readRequest reads the request line: an absolute URL followed by CRLF. On
+// failure it returns a nil request with the status to answer with.
+func readRequest(r io.Reader) (*Request, int, string) {
+	line, err := bufio.NewReaderSize(io.LimitReader(r, maxRequestLength+2), maxRequestLength+2).ReadString('\n')
+	if err != nil {
+		return nil, StatusBadRequest, "Request line too long or incomplete"
+	}
+	line = strings.TrimSuffix(strings.TrimSuffix(line, "\n"), "\r")
+	u, err := url.Parse(line)
+	if err != nil || !u.IsAbs() || u.Host == "" || u.User != nil {
+		return nil, StatusBadRequest, "Invalid URL"
+	}
+	if u.Scheme != "gemini" {
+		return nil, StatusProxyRefused, "Only gemini URLs are served"
+	}
+	if u.Path == "" {
+		u.Path = "/"
+	}
+	return &Request{URL: u}, 0, ""
+}
+
+// response writes to a connection, refusing a body without a success header.
+type response struct {
+	w           *bufio.Writer
+	wroteHeader bool
+	success     bool
+}
+
+func (r *response) WriteHeader(status int, meta string) {
+	if r.wroteHeader {
+		return
+	}
+	r.wroteHeader = true
+	r.success = status/10 == 2
+	// The meta text is a single line of at most 1024 bytes.
+	meta = strings.NewReplacer("\r", " ", "\n", " ").Replace(meta)
+	if len(meta) > maxRequestLength {
+		meta = meta[:maxRequestLength]
+	}
+	fmt.Fprintf(r.w, "%d %s\r\n", status, meta)
+}
+
+func (r *response) Write(p []byte) (int, error) {
+	if !r.wroteHeader {
+		r.WriteHeader(StatusSuccess, MediaType)
+	}
+	if !r.success {
+		return 0, errors.New("gemini: response has no body")
+	}
+	return r.w.Write(p)
+}
@@ -0,0 +1,94 @@
+package gemini
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"io"
+	"net"
+	"path/filepath"
+	"testing"
+)
+
+func TestServer(t *testing.T) {
+	cert, err := LoadOrCreateCertificate("", "", "localhost")
+	if err != nil {
+		t.Fatalf("LoadOrCreateCertificate: %v", err)
+	}
+	srv := &Server{
+		TLSConfig: &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12},
+		Handler: HandlerFunc(func(w ResponseWriter, r *Request) {
+			if r.URL.Path == "/missing" {
+				w.WriteHeader(StatusNotFound, "Not found")
+				return
+			}
+			w.WriteHeader(StatusSuccess, MediaType)
+			io.WriteString(w, "# "+r.URL.Path+"\n")
+		}),
+	}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan error, 1)
+	go func() { done <- srv.Serve(ln) }()
+
+	request := func(line string) string {
+		t.Helper()
+		conn, err := tls.Dial("tcp", ln.Addr().String(), &tls.Config{InsecureSkipVerify: true})
+		if err != nil {
+			t.Fatalf("dial: %v", err)
+		}
+		defer conn.Close()
+		io.WriteString(conn, line)
+		resp, err := io.ReadAll(conn)
+		if err != nil {
+			t.Fatalf("read: %v", err)
+		}
+		return string(resp)
+	}
+
+	tests := []struct {
+		line string
+		want string
+	}{
+		{"gemini://localhost/page\r\n", "20 text/gemini; charset=utf-8\r\n# /page\n"},
+		{"gemini://localhost\r\n", "20 text/gemini; charset=utf-8\r\n# /\n"},
+		{"gemini://localhost/missing\r\n", "51 Not found\r\n"},
+		{"https://localhost/page\r\n", "53 Only gemini URLs are served\r\n"},
+		{"/relative\r\n", "59 Invalid URL\r\n"},
+		{"gemini://localhost/" + string(bytes.Repeat([]byte("a"), 1100)) + "\r\n", "59 Request line too long or incomplete\r\n"},
+	}
+	for _, tt := range tests {
+		if got := request(tt.line); got != tt.want {
+			t.Errorf("request %.40q = %q, want %q", tt.line, got, tt.want)
+		}
+	}
+
+	if err := srv.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown: %v", err)
+	}
+	if err := <-done; err != ErrServerClosed {
+		t.Errorf("Serve = %v, want ErrServerClosed", err)
+	}
+}
+
+func TestLoadOrCreateCertificate(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "gemini.crt"), filepath.Join(dir, "gemini.key")
+
+	created, err := LoadOrCreateCertificate(certFile, keyFile, "wiki.example.com")
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	loaded, err := LoadOrCreateCertificate(certFile, keyFile, "wiki.example.com")
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if !bytes.Equal(created.Certificate[0], loaded.Certificate[0]) {
+		t.Error("the saved certificate should be loaded again, not replaced")
+	}
+	if leaf := loaded.Leaf; leaf == nil || leaf.Subject.CommonName != "wiki.example.com" {
+		t.Errorf("certificate subject = %v", leaf)
+	}
+}
@@ -1,15 +1,27 @@
 package handlers
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log/slog"
 	"net/http"
+	"os"
+	"slices"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 
+	"github.com/sa/gopherwiki/internal/auth"
+	"github.com/sa/gopherwiki/internal/backup"
+	"github.com/sa/gopherwiki/internal/cluster"
 	"github.com/sa/gopherwiki/internal/db"
 	"github.com/sa/gopherwiki/internal/middleware"
+	"github.com/sa/gopherwiki/internal/settings"
+	"github.com/sa/gopherwiki/internal/wiki"
 )
 
 // requireAdmin is a helper that checks admin access and redirects if not authorized.
@@ -47,9 +59,104 @@ func (s *Server) handleAdmin(w http.ResponseWriter, r *http.Request) {
 	data["user_count"] = len(users)
 	data["page_count"] = pageCount
 	data["version"] = s.Version
+	if s.DB != nil {
+		indexed, err := s.DB.PageIndexCount(r.Context())
+		if err != nil {
+			slog.Error("failed to count indexed pages", "error", err)
+		}
+		data["indexed_count"] = int(indexed)
+		data["reindex"] = s.Wiki.ReindexStatus()
+		s.maintenanceData(r.Context(), data)
+		if held, err := s.DB.CountModeration(r.Context()); err != nil {
+			slog.Error("failed to count the moderation queue", "error", err)
+		} else {
+			data["moderation_count"] = held
+		}
+	}
 	s.renderTemplate(w, r, "admin.html", data)
 }
 
+// handleAdminReindex starts rebuilding the search index in the background;
+// the dashboard reports its progress.
+func (s *Server) handleAdminReindex(w http.ResponseWriter, r *http.Request) {
+	if !s.requireAdmin(w, r) {
+		return
+	}
+
+	if s.Wiki.StartSearchIndexRebuild() {
+		user := middleware.GetUser(r)
+		slog.Info("search index rebuild started", "user", user.GetEmail())
+		s.SessionManager.AddFlashMessage(w, r, "success", "Rebuilding the search index")
+	} else {
+		s.SessionManager.AddFlashMessage(w, r, "info", "The search index is already being rebuilt")
+	}
+	http.Redirect(w, r, "/-/admin", http.StatusFound)
+}
+
+// auditLogLimit is the number of entries the audit log page shows.
+const auditLogLimit = 200
+
+// handleAdminAudit lists the latest audit log entries.
+func (s *Server) handleAdminAudit(w http.ResponseWriter, r *http.Request) {
+	if !s.requireAdmin(w, r) {
+		return
+	}
+
+	entries, err := s.DB.ListAuditEntries(r.Context(), auditLogLimit)
+	if err != nil {
+		s.renderError(w, r, http.StatusInternalServerError, "Failed to load the audit log")
+		return
+	}
+
+	data := NewGenericData("Audit Log")
+	data["entries"] = entries
+	s.renderTemplate(w, r, "admin_audit.html", data)
+}
+
+// handleAdminBackup streams a backup archive of the repository, database and
+// configuration. The archive is assembled in a temporary file first so that a
+// failure part-way through produces an error page rather than a truncated
+// download.
+func (s *Server) handleAdminBackup(w http.ResponseWriter, r *http.Request) {
+	if !s.requireAdmin(w, r) {
+		return
+	}
+
+	tmp, err := os.CreateTemp("", "gopherwiki-backup-*.tar.gz")
+	if err != nil {
+		s.renderError(w, r, http.StatusInternalServerError, "Failed to create backup")
+		return
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	src := backup.Source{Storage: s.Storage, DB: s.DB, Config: s.Config, Version: s.Version}
+	if _, err := backup.Write(r.Context(), tmp, src); err != nil {
+		slog.Error("failed to create backup", "error", err)
+		s.renderError(w, r, http.StatusInternalServerError, "Failed to create backup")
+		return
+	}
+	size, err := tmp.Seek(0, io.SeekCurrent)
+	if err == nil {
+		_, err = tmp.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		s.renderError(w, r, http.StatusInternalServerError, "Failed to create backup")
+		return
+	}
+
+	user := middleware.GetUser(r)
+	slog.Info("backup downloaded", "user", user.GetEmail(), "size", size)
+
+	w.Header().Set("Content-Type", "application/gzip")
+	w.Header().Set("Content-Disposition", `attachment; filename="`+backup.Filename(time.Now())+`"`)
+	w.Header().Set("Content-Length", strconv.FormatInt(size, 10))
+	w.Header().Set("Cache-Control", "no-store")
+	if _, err := io.Copy(w, tmp); err != nil {
+		slog.Error("failed to send backup", "error", err)
+	}
+}
+
 // handleAdminUsers handles the user list page.
 func (s *Server) handleAdminUsers(w http.ResponseWriter, r *http.Request) {
 	if !s.requireAdmin(w, r) {
@@ -62,11 +169,179 @@ func (s *Server) handleAdminUsers(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	fields, err := s.Users.ListUserFields(r.Context())
+	if err != nil {
+		slog.Error("failed to list user fields", "error", err)
+	}
+	fieldValues, err := s.Users.ListAllUserFieldValues(r.Context())
+	if err != nil {
+		slog.Error("failed to list user field values", "error", err)
+	}
+
 	data := NewGenericData("User Management")
 	data["users"] = users
+	data["user_fields"] = fields
+	data["user_field_values"] = fieldValues
 	s.renderTemplate(w, r, "admin_users.html", data)
 }
 
+// handleAdminUserNew shows the form for creating a user.
+func (s *Server) handleAdminUserNew(w http.ResponseWriter, r *http.Request) {
+	if !s.requireAdmin(w, r) {
+		return
+	}
+
+	// New accounts start approved with read, write and upload permission;
+	// the admin unticks what the user should not have.
+	data := NewGenericData("New User")
+	data["is_approved"] = true
+	data["allow_read"] = true
+	data["allow_write"] = true
+	data["allow_upload"] = true
+	s.renderTemplate(w, r, "admin_user_new.html", data)
+}
+
+// handleAdminUserCreate handles creating a user. Without a password the
+// admin is given a reset link to pass on, through which the user chooses one.
+func (s *Server) handleAdminUserCreate(w http.ResponseWriter, r *http.Request) {
+	if !s.requireAdmin(w, r) {
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		s.renderError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	nu := auth.NewUser{
+		Name:        r.FormValue("name"),
+		Email:       r.FormValue("email"),
+		Password:    r.FormValue("password"),
+		IsApproved:  r.FormValue("is_approved") == "on",
+		IsAdmin:     r.FormValue("is_admin") == "on",
+		AllowRead:   r.FormValue("allow_read") == "on",
+		AllowWrite:  r.FormValue("allow_write") == "on",
+		AllowUpload: r.FormValue("allow_upload") == "on",
+	}
+
+	user, err := s.Auth.CreateUser(r.Context(), nu)
+	if err != nil {
+		errMsg := "Failed to create user"
+		switch err {
+		case auth.ErrEmailExists:
+			errMsg = "Email already registered"
+		case auth.ErrInvalidEmail, auth.ErrPasswordTooShort:
+			errMsg = capitalizeError(err)
+		}
+		data := NewGenericData("New User")
+		data["error"] = errMsg
+		data["name"] = nu.Name
+		data["email"] = nu.Email
+		data["is_approved"] = nu.IsApproved
+		data["is_admin"] = nu.IsAdmin
+		data["allow_read"] = nu.AllowRead
+		data["allow_write"] = nu.AllowWrite
+		data["allow_upload"] = nu.AllowUpload
+		s.renderTemplate(w, r, "admin_user_new.html", data)
+		return
+	}
+
+	admin := middleware.GetUser(r)
+	slog.Info("user created", "user", admin.GetEmail(), "new_user", user.Email)
+
+	if nu.Password != "" {
+		s.SessionManager.AddFlashMessage(w, r, "success", "User created successfully")
+	} else {
+		s.flashResetLink(w, r, user.ID, "User created. Send them this link to choose a password")
+	}
+	http.Redirect(w, r, fmt.Sprintf("/-/admin/users/%d", user.ID), http.StatusFound)
+}
+
+// handleAdminUserPassword sets a user's password. Any reset links the user
+// still holds stop working.
+func (s *Server) handleAdminUserPassword(w http.ResponseWriter, r *http.Request) {
+	if !s.requireAdmin(w, r) {
+		return
+	}
+
+	id, err := parseInt64(chi.URLParam(r, "id"))
+	if err != nil {
+		s.renderError(w, r, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		s.renderError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+	editURL := fmt.Sprintf("/-/admin/users/%d", id)
+
+	password := r.FormValue("password")
+	if password != r.FormValue("password2") {
+		s.SessionManager.AddFlashMessage(w, r, "danger", "Passwords do not match")
+		http.Redirect(w, r, editURL, http.StatusFound)
+		return
+	}
+	if err := auth.ValidatePassword(password); err != nil {
+		s.SessionManager.AddFlashMessage(w, r, "danger", capitalizeError(err))
+		http.Redirect(w, r, editURL, http.StatusFound)
+		return
+	}
+
+	if err := s.Auth.UpdatePassword(r.Context(), id, password); err != nil {
+		if err == auth.ErrUserNotFound {
+			s.renderError(w, r, http.StatusNotFound, "User not found")
+			return
+		}
+		s.SessionManager.AddFlashMessage(w, r, "danger", "Failed to set password")
+		http.Redirect(w, r, editURL, http.StatusFound)
+		return
+	}
+	if err := s.Users.DeletePasswordResets(r.Context(), id); err != nil {
+		slog.Warn("failed to delete outstanding password resets", "user_id", id, "error", err)
+	}
+	s.endSessionsOnPasswordChange(r, id)
+
+	admin := middleware.GetUser(r)
+	slog.Info("password set by admin", "user", admin.GetEmail(), "user_id", id)
+	s.SessionManager.AddFlashMessage(w, r, "success", "Password set successfully")
+	http.Redirect(w, r, editURL, http.StatusFound)
+}
+
+// handleAdminUserResetLink issues a password reset link for a user and shows
+// it to the admin.
+func (s *Server) handleAdminUserResetLink(w http.ResponseWriter, r *http.Request) {
+	if !s.requireAdmin(w, r) {
+		return
+	}
+
+	id, err := parseInt64(chi.URLParam(r, "id"))
+	if err != nil {
+		s.renderError(w, r, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+	if _, err := s.Auth.GetUserByID(r.Context(), id); err != nil {
+		s.renderError(w, r, http.StatusNotFound, "User not found")
+		return
+	}
+
+	s.flashResetLink(w, r, id, "Send the user this link to choose a new password")
+	http.Redirect(w, r, fmt.Sprintf("/-/admin/users/%d", id), http.StatusFound)
+}
+
+// flashResetLink issues a reset link for userID and flashes it after msg.
+func (s *Server) flashResetLink(w http.ResponseWriter, r *http.Request, userID int64, msg string) {
+	link, expires, err := s.createPasswordReset(r.Context(), userID)
+	if err != nil {
+		slog.Error("failed to create password reset", "user_id", userID, "error", err)
+		s.SessionManager.AddFlashMessage(w, r, "danger", "Failed to create password reset link")
+		return
+	}
+	admin := middleware.GetUser(r)
+	slog.Info("password reset link issued", "user", admin.GetEmail(), "user_id", userID)
+	s.SessionManager.AddFlashMessage(w, r, "info",
+		fmt.Sprintf("%s (valid until %s): %s", msg, expires.Format("2006-01-02 15:04 MST"), link))
+}
+
 // handleAdminUserEdit handles the user edit form.
 func (s *Server) handleAdminUserEdit(w http.ResponseWriter, r *http.Request) {
 	if !s.requireAdmin(w, r) {
@@ -86,8 +361,25 @@ func (s *Server) handleAdminUserEdit(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	fields, err := s.Users.ListUserFields(r.Context())
+	if err != nil {
+		slog.Error("failed to list user fields", "error", err)
+	}
+	fieldValues, err := s.Users.GetUserFieldValues(r.Context(), id)
+	if err != nil {
+		slog.Error("failed to get user field values", "error", err)
+	}
+
+	sessions, err := s.Users.ListUserSessions(r.Context(), id)
+	if err != nil {
+		slog.Error("failed to list sessions", "error", err)
+	}
+
 	data := NewGenericData("Edit User: " + user.GetName())
 	data["edit_user"] = user
+	data["session_count"] = len(sessions)
+	data["user_fields"] = fields
+	data["user_field_values"] = fieldValues
 	s.renderTemplate(w, r, "admin_user_edit.html", data)
 }
 
@@ -137,12 +429,27 @@ func (s *Server) handleAdminUserSave(w http.ResponseWriter, r *http.Request) {
 		AllowUpload:    db.NullBool(allowUpload),
 	}
 
-	if err := s.DB.Queries.UpdateUser(r.Context(), params); err != nil {
+	if err := s.Users.Queries.UpdateUser(r.Context(), params); err != nil {
 		s.SessionManager.AddFlashMessage(w, r, "danger", "Failed to update user")
 		http.Redirect(w, r, fmt.Sprintf("/-/admin/users/%d", id), http.StatusFound)
 		return
 	}
 
+	if err := s.saveUserFieldsFromForm(r, id); err != nil {
+		s.SessionManager.AddFlashMessage(w, r, "danger", "Failed to update profile fields")
+		http.Redirect(w, r, fmt.Sprintf("/-/admin/users/%d", id), http.StatusFound)
+		return
+	}
+
+	// Withdrawing approval disables the account, so its sessions end too.
+	if user.Approved() && !isApproved {
+		if n, err := s.Users.DeleteUserSessions(r.Context(), id); err != nil {
+			slog.Error("failed to revoke sessions", "user_id", id, "error", err)
+		} else if n > 0 {
+			slog.Info("user logged out everywhere", "user", middleware.GetUser(r).GetEmail(), "user_id", id, "sessions", n)
+		}
+	}
+
 	s.SessionManager.AddFlashMessage(w, r, "success", "User updated successfully")
 	http.Redirect(w, r, "/-/admin/users", http.StatusFound)
 }
@@ -177,6 +484,72 @@ func (s *Server) handleAdminUserDelete(w http.ResponseWriter, r *http.Request) {
 	http.Redirect(w, r, "/-/admin/users", http.StatusFound)
 }
 
+// handleAdminUserFields lists the custom profile field definitions.
+func (s *Server) handleAdminUserFields(w http.ResponseWriter, r *http.Request) {
+	if !s.requireAdmin(w, r) {
+		return
+	}
+
+	fields, err := s.Users.ListUserFields(r.Context())
+	if err != nil {
+		s.renderError(w, r, http.StatusInternalServerError, "Failed to list profile fields")
+		return
+	}
+
+	data := NewGenericData("Profile Fields")
+	data["user_fields"] = fields
+	s.renderTemplate(w, r, "admin_user_fields.html", data)
+}
+
+// handleAdminUserFieldCreate adds a custom profile field definition.
+func (s *Server) handleAdminUserFieldCreate(w http.ResponseWriter, r *http.Request) {
+	if !s.requireAdmin(w, r) {
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		s.renderError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	name := strings.TrimSpace(r.FormValue("name"))
+	label := strings.TrimSpace(r.FormValue("label"))
+	if err := validateUserField(name, label); err != nil {
+		s.SessionManager.AddFlashMessage(w, r, "danger", err.Error())
+		http.Redirect(w, r, "/-/admin/user-fields", http.StatusFound)
+		return
+	}
+
+	if _, err := s.Users.CreateUserField(r.Context(), name, label); err != nil {
+		s.SessionManager.AddFlashMessage(w, r, "danger", "Failed to create profile field (the name may already exist)")
+		http.Redirect(w, r, "/-/admin/user-fields", http.StatusFound)
+		return
+	}
+
+	s.SessionManager.AddFlashMessage(w, r, "success", "Profile field created")
+	http.Redirect(w, r, "/-/admin/user-fields", http.StatusFound)
+}
+
+// handleAdminUserFieldDelete removes a custom profile field and its values.
+func (s *Server) handleAdminUserFieldDelete(w http.ResponseWriter, r *http.Request) {
+	if !s.requireAdmin(w, r) {
+		return
+	}
+
+	id, err := parseInt64(chi.URLParam(r, "id"))
+	if err != nil {
+		s.renderError(w, r, http.StatusBadRequest, "Invalid field ID")
+		return
+	}
+
+	if err := s.Users.DeleteUserField(r.Context(), id); err != nil {
+		s.SessionManager.AddFlashMessage(w, r, "danger", "Failed to delete profile field")
+	} else {
+		s.SessionManager.AddFlashMessage(w, r, "success", "Profile field deleted")
+	}
+	http.Redirect(w, r, "/-/admin/user-fields", http.StatusFound)
+}
+
 // handleAdminSettings handles the admin settings page.
 func (s *Server) handleAdminSettings(w http.ResponseWriter, r *http.Request) {
 	if !s.requireAdmin(w, r) {
@@ -194,21 +567,86 @@ func (s *Server) handleAdminSettings(w http.ResponseWriter, r *http.Request) {
 
 	data := NewGenericData("Site Settings")
 	data["site_settings"] = s.Config
+	data["settings"] = s.Settings.Get(ctx)
+	data["configured"] = s.Settings.Configured()
+	data["access_levels"] = settings.AccessLevels
+	data["themes"] = s.ThemeNames()
 	data["current_site"] = siteSettings
+	navigation, _ := json.MarshalIndent(siteSettings.Navigation, "", "  ")
+	data["navigation"] = string(navigation)
 	data["issue_tags"] = strings.Join(issueTags, ", ")
 	data["issue_categories"] = strings.Join(issueCategories, ", ")
+	data["issue_templates"] = s.getIssueTemplates(ctx)
+	if id := r.URL.Query().Get("issue_template"); id != "" {
+		if t, ok := s.findIssueTemplate(ctx, id); ok {
+			data["edit_issue_template"] = t
+		}
+	}
 	s.renderTemplate(w, r, "admin_settings.html", data)
 }
 
-// handleAdminSettingsSave handles saving admin settings.
+// handleAdminSettingsSave handles saving the runtime-editable settings, or
+// resetting them to their configured values. Changes apply to the next
+// request.
 func (s *Server) handleAdminSettingsSave(w http.ResponseWriter, r *http.Request) {
 	if !s.requireAdmin(w, r) {
 		return
 	}
 
-	// Note: Runtime config changes are limited. Most settings require restart.
-	// This is a placeholder for future implementation.
-	s.SessionManager.AddFlashMessage(w, r, "info", "Settings changes require a restart to take effect")
+	if err := r.ParseForm(); err != nil {
+		s.renderError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	ctx := r.Context()
+	user := middleware.GetUser(r)
+
+	if r.FormValue("reset") != "" {
+		if err := s.Settings.Reset(ctx); err != nil {
+			slog.Error("failed to reset settings", "error", err)
+			s.SessionManager.AddFlashMessage(w, r, "danger", "Failed to reset settings")
+		} else {
+			slog.Info("settings reset to configured values", "user", user.GetEmail())
+			s.publish(ctx, cluster.TopicSettings)
+			s.SessionManager.AddFlashMessage(w, r, "success", "Settings reset to their configured values")
+		}
+		http.Redirect(w, r, "/-/admin/settings", http.StatusFound)
+		return
+	}
+
+	next := settings.Settings{
+		ReadAccess:          r.FormValue("read_access"),
+		WriteAccess:         r.FormValue("write_access"),
+		AttachmentAccess:    r.FormValue("attachment_access"),
+		DisableRegistration: r.FormValue("registration_enabled") != "on",
+		HomePage:            strings.TrimSpace(r.FormValue("home_page")),
+		SiteURL:             strings.TrimRight(strings.TrimSpace(r.FormValue("site_url")), "/"),
+		EditConflictMode:    r.FormValue("edit_conflict_mode"),
+		Theme:               r.FormValue("theme"),
+		DisableFeeds:        r.FormValue("feeds_enabled") != "on",
+		DisableSitemap:      r.FormValue("sitemap_enabled") != "on",
+	}
+	if next.Theme == "" {
+		next.Theme = s.Settings.Get(ctx).Theme
+	} else if !slices.Contains(s.ThemeNames(), next.Theme) {
+		s.SessionManager.AddFlashMessage(w, r, "danger", fmt.Sprintf("Failed to save settings: theme %q is not installed", next.Theme))
+		http.Redirect(w, r, "/-/admin/settings", http.StatusFound)
+		return
+	}
+	if err := s.Settings.Save(ctx, next); err != nil {
+		slog.Warn("failed to save settings", "error", err)
+		s.SessionManager.AddFlashMessage(w, r, "danger", "Failed to save settings: "+err.Error())
+		http.Redirect(w, r, "/-/admin/settings", http.StatusFound)
+		return
+	}
+
+	s.publish(ctx, cluster.TopicSettings)
+	slog.Info("settings updated", "user", user.GetEmail(),
+		"read_access", next.ReadAccess, "write_access", next.WriteAccess,
+		"attachment_access", next.AttachmentAccess, "registration_disabled", next.DisableRegistration,
+		"home_page", next.HomePage, "site_url", next.SiteURL, "edit_conflict_mode", next.EditConflictMode, "theme", next.Theme,
+		"feeds_disabled", next.DisableFeeds, "sitemap_disabled", next.DisableSitemap)
+	s.SessionManager.AddFlashMessage(w, r, "success", "Settings updated successfully")
 	http.Redirect(w, r, "/-/admin/settings", http.StatusFound)
 }
 
@@ -253,6 +691,7 @@ func (s *Server) handleAdminSiteSettingsSave(w http.ResponseWriter, r *http.Requ
 	}
 
 	s.InvalidateSiteSettingsCache()
+	s.publish(ctx, cluster.TopicSettings)
 	s.SessionManager.AddFlashMessage(w, r, "success", "Site settings updated successfully")
 	http.Redirect(w, r, "/-/admin/settings", http.StatusFound)
 }
@@ -315,3 +754,115 @@ func (s *Server) handleAdminIssueSettingsSave(w http.ResponseWriter, r *http.Req
 	s.SessionManager.AddFlashMessage(w, r, "success", "Issue settings updated successfully")
 	http.Redirect(w, r, "/-/admin/settings", http.StatusFound)
 }
+
+// handleAdminImport shows the bulk import form.
+func (s *Server) handleAdminImport(w http.ResponseWriter, r *http.Request) {
+	if !s.requireAdmin(w, r) {
+		return
+	}
+	s.renderTemplate(w, r, "admin_import.html", NewGenericData("Import Pages"))
+}
+
+// handleAdminImportPost imports an uploaded ZIP archive of pages and assets,
+// or with dry_run set only reports what importing it would do. The report is
+// rendered below the form either way.
+func (s *Server) handleAdminImportPost(w http.ResponseWriter, r *http.Request) {
+	if !s.requireAdmin(w, r) {
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, wiki.MaxImportSize)
+	if err := r.ParseMultipartForm(32 << 20); err != nil {
+		s.renderError(w, r, http.StatusBadRequest, "Failed to parse form: "+err.Error())
+		return
+	}
+	file, header, err := r.FormFile("archive")
+	if err != nil {
+		s.renderError(w, r, http.StatusBadRequest, "Failed to get file: "+err.Error())
+		return
+	}
+	defer file.Close()
+
+	opts := wiki.ImportOptions{
+		Prefix:         r.FormValue("prefix"),
+		Overwrite:      r.FormValue("overwrite") != "",
+		PerFileCommits: r.FormValue("commit_mode") == "per-file",
+		DryRun:         r.FormValue("dry_run") != "",
+		Message:        strings.TrimSpace(r.FormValue("message")),
+	}
+	data := NewGenericData("Import Pages")
+	data["prefix"] = opts.Prefix
+	data["message"] = opts.Message
+	data["overwrite"] = opts.Overwrite
+	data["per_file"] = opts.PerFileCommits
+
+	report, err := s.Wiki.Import(r.Context(), file, header.Size, opts, s.getAuthor(r))
+	if errors.Is(err, wiki.ErrInvalidArchive) {
+		data["import_error"] = err.Error()
+		s.renderTemplate(w, r, "admin_import.html", data)
+		return
+	}
+	if err != nil {
+		slog.Error("import failed", "error", err)
+		s.renderError(w, r, http.StatusInternalServerError, "Import failed")
+		return
+	}
+
+	if !opts.DryRun {
+		user := middleware.GetUser(r)
+		slog.Info("pages imported", "user", user.GetEmail(), "created", report.Created, "updated", report.Updated)
+	}
+	data["report"] = report
+	s.renderTemplate(w, r, "admin_import.html", data)
+}
+
+// handleAdminImportMediaWiki imports an uploaded MediaWiki XML dump, or with
+// dry_run set only reports what importing it would do. It shares the import
+// page and its report with the archive import.
+func (s *Server) handleAdminImportMediaWiki(w http.ResponseWriter, r *http.Request) {
+	if !s.requireAdmin(w, r) {
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, wiki.MaxImportSize)
+	if err := r.ParseMultipartForm(32 << 20); err != nil {
+		s.renderError(w, r, http.StatusBadRequest, "Failed to parse form: "+err.Error())
+		return
+	}
+	file, _, err := r.FormFile("dump")
+	if err != nil {
+		s.renderError(w, r, http.StatusBadRequest, "Failed to get file: "+err.Error())
+		return
+	}
+	defer file.Close()
+
+	opts := wiki.MediaWikiOptions{
+		Prefix:     r.FormValue("prefix"),
+		Overwrite:  r.FormValue("overwrite") != "",
+		LatestOnly: r.FormValue("latest_only") != "",
+		DryRun:     r.FormValue("dry_run") != "",
+	}
+	data := NewGenericData("Import Pages")
+	data["mw_prefix"] = opts.Prefix
+	data["mw_overwrite"] = opts.Overwrite
+	data["mw_latest_only"] = opts.LatestOnly
+
+	report, err := s.Wiki.ImportMediaWiki(r.Context(), file, opts, s.getAuthor(r))
+	if errors.Is(err, wiki.ErrInvalidArchive) {
+		data["import_error"] = err.Error()
+		s.renderTemplate(w, r, "admin_import.html", data)
+		return
+	}
+	if err != nil {
+		slog.Error("mediawiki import failed", "error", err)
+		s.renderError(w, r, http.StatusInternalServerError, "Import failed")
+		return
+	}
+
+	if !opts.DryRun {
+		user := middleware.GetUser(r)
+		slog.Info("mediawiki dump imported", "user", user.GetEmail(), "created", report.Created, "updated", report.Updated)
+	}
+	data["report"] = report
+	s.renderTemplate(w, r, "admin_import.html", data)
+}
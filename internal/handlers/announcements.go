@@ -0,0 +1,519 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"errors"
+	"fmt"
+	"html/template"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/sa/gopherwiki/internal/cluster"
+	"github.com/sa/gopherwiki/internal/db"
+	"github.com/sa/gopherwiki/internal/middleware"
+)
+
+// announcementSeverities are the severities of an announcement, which
+// style its banner as the alert of the same name.
+var announcementSeverities = []string{"info", "success", "warning", "danger"}
+
+// announcement is an announcement with its message rendered, as the
+// layout shows it.
+type announcement struct {
+	db.Announcement
+	HTML template.HTML
+}
+
+// APIAnnouncement is a site-wide announcement. StartsAt and EndsAt are ""
+// when that end is open.
+type APIAnnouncement struct {
+	ID          int64  `json:"id"`
+	Message     string `json:"message"`
+	HTML        string `json:"html"`
+	Severity    string `json:"severity"`
+	StartsAt    string `json:"starts_at"`
+	EndsAt      string `json:"ends_at"`
+	Dismissible bool   `json:"dismissible"`
+	Active      bool   `json:"active"`
+	CreatedBy   string `json:"created_by"`
+	CreatedAt   string `json:"created_at"`
+	UpdatedAt   string `json:"updated_at"`
+}
+
+// APIAnnouncementInput is the body of creating or updating an
+// announcement. Fields left out of an update keep their value; "" clears a
+// time. Dismissible defaults to true.
+type APIAnnouncementInput struct {
+	Message     *string `json:"message"`
+	Severity    *string `json:"severity"`
+	StartsAt    *string `json:"starts_at"`
+	EndsAt      *string `json:"ends_at"`
+	Dismissible *bool   `json:"dismissible"`
+}
+
+// noEmbeddedPages links the pages an announcement embeds instead of
+// rendering them: the rendered messages are shared by every viewer, among
+// them visitors who may not read the pages.
+func noEmbeddedPages(string) bool { return false }
+
+// renderAnnouncements renders the messages of the announcements that are
+// shown now or later, for the site settings to cache.
+func (s *Server) renderAnnouncements(list []db.Announcement) []announcement {
+	now := time.Now()
+	var shown []announcement
+	for _, a := range list {
+		if !a.EndsAt.IsZero() && !now.Before(a.EndsAt) {
+			continue
+		}
+		html, _, _ := s.Renderer.RenderFor(a.Message, "", noEmbeddedPages)
+		shown = append(shown, announcement{Announcement: a, HTML: template.HTML(html)})
+	}
+	return shown
+}
+
+// activeAnnouncements returns the announcements shown now, but those the
+// logged-in user dismissed.
+func (s *Server) activeAnnouncements(r *http.Request) []announcement {
+	now := time.Now()
+	var active []announcement
+	for _, a := range s.getSiteSettings(r.Context()).Announcements {
+		if a.Active(now) {
+			active = append(active, a)
+		}
+	}
+	user := middleware.GetUser(r)
+	if len(active) == 0 || !user.IsAuthenticated() {
+		return active
+	}
+	dismissed, err := s.DB.DismissedAnnouncements(r.Context(), user.ID)
+	if err != nil {
+		slog.Warn("failed to list dismissed announcements", "error", err)
+		return active
+	}
+	return slices.DeleteFunc(active, func(a announcement) bool {
+		return a.Dismissible && dismissed[a.ID]
+	})
+}
+
+// announcementsETagSuffix returns an ETag suffix for the announcements a
+// page shows, so it changes with them.
+func announcementsETagSuffix(list []announcement) string {
+	if len(list) == 0 {
+		return ""
+	}
+	h := sha256.New()
+	for _, a := range list {
+		fmt.Fprintf(h, "%d-%d\n", a.ID, a.UpdatedAt.Unix())
+	}
+	return fmt.Sprintf("-a%x", h.Sum(nil)[:6])
+}
+
+// validateAnnouncement checks the fields of an announcement an admin
+// posts.
+func validateAnnouncement(a db.Announcement) error {
+	switch {
+	case strings.TrimSpace(a.Message) == "":
+		return errors.New("the message is required")
+	case !slices.Contains(announcementSeverities, a.Severity):
+		return fmt.Errorf("the severity must be one of %s", strings.Join(announcementSeverities, ", "))
+	case !a.StartsAt.IsZero() && !a.EndsAt.IsZero() && !a.EndsAt.After(a.StartsAt):
+		return errors.New("the end must be after the start")
+	}
+	return nil
+}
+
+// announcementFromForm reads an announcement from the admin form, whose
+// times are those of datetime-local inputs, empty to leave an end open.
+func announcementFromForm(r *http.Request) (db.Announcement, error) {
+	a := db.Announcement{
+		Message:     strings.TrimSpace(r.PostForm.Get("message")),
+		Severity:    r.PostForm.Get("severity"),
+		Dismissible: r.PostForm.Get("dismissible") == "on",
+	}
+	for _, f := range []struct {
+		name string
+		dst  *time.Time
+	}{{"starts_at", &a.StartsAt}, {"ends_at", &a.EndsAt}} {
+		if v := r.PostForm.Get(f.name); v != "" {
+			t, err := time.ParseInLocation(scheduleTimeLayout, v, time.Local)
+			if err != nil {
+				return a, errors.New("invalid time: " + v)
+			}
+			*f.dst = t
+		}
+	}
+	return a, validateAnnouncement(a)
+}
+
+// announcementsChanged drops the cached announcements, here and on the
+// other instances.
+func (s *Server) announcementsChanged(r *http.Request) {
+	s.InvalidateSiteSettingsCache()
+	s.publish(r.Context(), cluster.TopicSettings)
+}
+
+// adminAnnouncement is an announcement as the admin list shows it.
+type adminAnnouncement struct {
+	db.Announcement
+	Status string // Scheduled, Active or Ended
+}
+
+// announcementForm holds the values of the announcement form.
+type announcementForm struct {
+	ID          int64
+	Message     string
+	Severity    string
+	StartsAt    string
+	EndsAt      string
+	Dismissible bool
+}
+
+// inputTime formats t for a datetime-local input, "" for the zero time.
+func inputTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.In(time.Local).Format(scheduleTimeLayout)
+}
+
+// handleAdminAnnouncements lists the announcements, with the form to post
+// one, or to edit the one with the id in the URL.
+func (s *Server) handleAdminAnnouncements(w http.ResponseWriter, r *http.Request) {
+	if !s.requireAdmin(w, r) {
+		return
+	}
+
+	form := announcementForm{Severity: "info", Dismissible: true}
+	if idParam := chi.URLParam(r, "id"); idParam != "" {
+		id, err := parseInt64(idParam)
+		if err != nil {
+			s.renderError(w, r, http.StatusBadRequest, "Invalid announcement ID")
+			return
+		}
+		a, err := s.DB.GetAnnouncement(r.Context(), id)
+		if errors.Is(err, sql.ErrNoRows) {
+			s.renderError(w, r, http.StatusNotFound, "Announcement not found")
+			return
+		} else if err != nil {
+			s.renderFailure(w, r, err)
+			return
+		}
+		form = announcementForm{ID: a.ID, Message: a.Message, Severity: a.Severity,
+			StartsAt: inputTime(a.StartsAt), EndsAt: inputTime(a.EndsAt), Dismissible: a.Dismissible}
+	}
+
+	list, err := s.DB.ListAnnouncements(r.Context())
+	if err != nil {
+		s.renderFailure(w, r, err)
+		return
+	}
+	now := time.Now()
+	rows := make([]adminAnnouncement, 0, len(list))
+	for _, a := range list {
+		status := "Active"
+		if !a.StartsAt.IsZero() && now.Before(a.StartsAt) {
+			status = "Scheduled"
+		} else if !a.Active(now) {
+			status = "Ended"
+		}
+		rows = append(rows, adminAnnouncement{Announcement: a, Status: status})
+	}
+
+	data := NewGenericData("Announcements")
+	data["announcement_list"] = rows
+	data["form"] = form
+	data["severities"] = announcementSeverities
+	data["time_zone"] = now.Format("MST")
+	s.renderTemplate(w, r, "admin_announcements.html", data)
+}
+
+// handleAdminAnnouncementSave posts an announcement, or saves the one with
+// the id in the URL.
+func (s *Server) handleAdminAnnouncementSave(w http.ResponseWriter, r *http.Request) {
+	if !s.requireAdmin(w, r) {
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		s.renderError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	back := "/-/admin/announcements"
+	var id int64
+	if idParam := chi.URLParam(r, "id"); idParam != "" {
+		var err error
+		if id, err = parseInt64(idParam); err != nil {
+			s.renderError(w, r, http.StatusBadRequest, "Invalid announcement ID")
+			return
+		}
+		back += "/" + idParam
+	}
+	a, err := announcementFromForm(r)
+	if err != nil {
+		s.SessionManager.AddFlashMessage(w, r, "danger", "Failed to save the announcement: "+err.Error())
+		http.Redirect(w, r, back, http.StatusFound)
+		return
+	}
+
+	if id == 0 {
+		a.CreatedBy = middleware.GetUser(r).GetName()
+		a.CreatedAt = time.Now()
+		_, err = s.DB.CreateAnnouncement(r.Context(), a)
+	} else {
+		a.ID, a.UpdatedAt = id, time.Now()
+		err = s.DB.UpdateAnnouncement(r.Context(), a)
+	}
+	if err != nil {
+		slog.Error("failed to save announcement", "error", err)
+		s.SessionManager.AddFlashMessage(w, r, "danger", "Failed to save the announcement")
+		http.Redirect(w, r, back, http.StatusFound)
+		return
+	}
+
+	s.announcementsChanged(r)
+	s.SessionManager.AddFlashMessage(w, r, "success", "Announcement saved")
+	http.Redirect(w, r, "/-/admin/announcements", http.StatusFound)
+}
+
+// handleAdminAnnouncementDelete removes an announcement.
+func (s *Server) handleAdminAnnouncementDelete(w http.ResponseWriter, r *http.Request) {
+	if !s.requireAdmin(w, r) {
+		return
+	}
+
+	id, err := parseInt64(chi.URLParam(r, "id"))
+	if err != nil {
+		s.renderError(w, r, http.StatusBadRequest, "Invalid announcement ID")
+		return
+	}
+
+	if err := s.DB.DeleteAnnouncement(r.Context(), id); err != nil {
+		s.SessionManager.AddFlashMessage(w, r, "danger", "Failed to delete the announcement")
+	} else {
+		s.announcementsChanged(r)
+		s.SessionManager.AddFlashMessage(w, r, "success", "Announcement deleted")
+	}
+	http.Redirect(w, r, "/-/admin/announcements", http.StatusFound)
+}
+
+// dismissAnnouncement hides the dismissible announcement with the id in
+// the URL from the logged-in user, returning the status of an error.
+func (s *Server) dismissAnnouncement(r *http.Request) (int, error) {
+	id, err := parseInt64(chi.URLParam(r, "id"))
+	if err != nil {
+		return http.StatusBadRequest, errors.New("invalid announcement ID")
+	}
+	a, err := s.DB.GetAnnouncement(r.Context(), id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return http.StatusNotFound, errors.New("announcement not found")
+	} else if err != nil {
+		return http.StatusInternalServerError, errors.New("failed to load announcement")
+	}
+	if !a.Dismissible {
+		return http.StatusBadRequest, errors.New("announcement cannot be dismissed")
+	}
+	if err := s.DB.DismissAnnouncement(r.Context(), middleware.GetUser(r).ID, id, time.Now()); err != nil {
+		return http.StatusInternalServerError, errors.New("failed to dismiss announcement")
+	}
+	return 0, nil
+}
+
+// handleAnnouncementDismiss hides an announcement from the logged-in user.
+// Its partial route answers with nothing, for htmx to remove the banner.
+func (s *Server) handleAnnouncementDismiss(w http.ResponseWriter, r *http.Request) {
+	if !middleware.GetUser(r).IsAuthenticated() {
+		http.Redirect(w, r, "/-/login", http.StatusFound)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		s.renderError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+	if status, err := s.dismissAnnouncement(r); err != nil {
+		s.renderError(w, r, status, err.Error())
+		return
+	}
+	if partialBlock(r) != "" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	http.Redirect(w, r, safeRedirectPath(r.PostForm.Get("next")), http.StatusFound)
+}
+
+func (s *Server) announcementToAPI(a db.Announcement, now time.Time) APIAnnouncement {
+	html, _, _ := s.Renderer.RenderFor(a.Message, "", noEmbeddedPages)
+	api := APIAnnouncement{
+		ID:          a.ID,
+		Message:     a.Message,
+		HTML:        html,
+		Severity:    a.Severity,
+		Dismissible: a.Dismissible,
+		Active:      a.Active(now),
+		CreatedBy:   a.CreatedBy,
+		CreatedAt:   a.CreatedAt.UTC().Format(time.RFC3339),
+		UpdatedAt:   a.UpdatedAt.UTC().Format(time.RFC3339),
+	}
+	if !a.StartsAt.IsZero() {
+		api.StartsAt = a.StartsAt.UTC().Format(time.RFC3339)
+	}
+	if !a.EndsAt.IsZero() {
+		api.EndsAt = a.EndsAt.UTC().Format(time.RFC3339)
+	}
+	return api
+}
+
+// handleAPIAnnouncements handles GET /api/v1/announcements -- the
+// announcements shown now, but those the logged-in user dismissed.
+func (s *Server) handleAPIAnnouncements(w http.ResponseWriter, r *http.Request) {
+	now := time.Now()
+	list := []APIAnnouncement{}
+	for _, a := range s.activeAnnouncements(r) {
+		list = append(list, s.announcementToAPI(a.Announcement, now))
+	}
+	writeJSON(w, http.StatusOK, list)
+}
+
+// handleAPIAnnouncementDismiss handles POST
+// /api/v1/announcements/{id}/dismiss -- hide an announcement from the
+// logged-in user.
+func (s *Server) handleAPIAnnouncementDismiss(w http.ResponseWriter, r *http.Request) {
+	if !middleware.GetUser(r).IsAuthenticated() {
+		writeJSONError(w, http.StatusUnauthorized, "not logged in")
+		return
+	}
+	if status, err := s.dismissAnnouncement(r); err != nil {
+		writeJSONError(w, status, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]bool{"dismissed": true})
+}
+
+// handleAPIAdminAnnouncements handles GET /api/v1/admin/announcements --
+// every announcement, newest first, including those scheduled or ended.
+func (s *Server) handleAPIAdminAnnouncements(w http.ResponseWriter, r *http.Request) {
+	list, err := s.DB.ListAnnouncements(r.Context())
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, "failed to list announcements")
+		return
+	}
+	now := time.Now()
+	out := make([]APIAnnouncement, 0, len(list))
+	for _, a := range list {
+		out = append(out, s.announcementToAPI(a, now))
+	}
+	writeJSON(w, http.StatusOK, out)
+}
+
+// applyAnnouncementInput sets the fields of a that input has.
+func applyAnnouncementInput(a *db.Announcement, input APIAnnouncementInput) error {
+	if input.Message != nil {
+		a.Message = strings.TrimSpace(*input.Message)
+	}
+	if input.Severity != nil {
+		a.Severity = *input.Severity
+	}
+	if input.Dismissible != nil {
+		a.Dismissible = *input.Dismissible
+	}
+	for _, f := range []struct {
+		name string
+		src  *string
+		dst  *time.Time
+	}{{"starts_at", input.StartsAt, &a.StartsAt}, {"ends_at", input.EndsAt, &a.EndsAt}} {
+		switch {
+		case f.src == nil:
+		case *f.src == "":
+			*f.dst = time.Time{}
+		default:
+			t, err := time.Parse(time.RFC3339, *f.src)
+			if err != nil {
+				return fmt.Errorf("%s must be an RFC 3339 time", f.name)
+			}
+			*f.dst = t
+		}
+	}
+	return validateAnnouncement(*a)
+}
+
+// handleAPIAdminAnnouncementCreate handles POST /api/v1/admin/announcements
+// -- post an announcement.
+func (s *Server) handleAPIAdminAnnouncementCreate(w http.ResponseWriter, r *http.Request) {
+	var input APIAnnouncementInput
+	if err := decodeJSON(r, &input); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "invalid JSON")
+		return
+	}
+	a := db.Announcement{
+		Severity:    "info",
+		Dismissible: true,
+		CreatedBy:   middleware.GetUser(r).GetName(),
+		CreatedAt:   time.Now(),
+	}
+	if err := applyAnnouncementInput(&a, input); err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	id, err := s.DB.CreateAnnouncement(r.Context(), a)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, "failed to create announcement")
+		return
+	}
+	a.ID, a.UpdatedAt = id, a.CreatedAt
+	s.announcementsChanged(r)
+	writeJSON(w, http.StatusCreated, s.announcementToAPI(a, time.Now()))
+}
+
+// handleAPIAdminAnnouncement handles PUT and DELETE
+// /api/v1/admin/announcements/{id} -- update or remove an announcement.
+func (s *Server) handleAPIAdminAnnouncement(w http.ResponseWriter, r *http.Request) {
+	id, err := parseInt64(chi.URLParam(r, "id"))
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, "invalid announcement ID")
+		return
+	}
+
+	if r.Method == http.MethodDelete {
+		if err := s.DB.DeleteAnnouncement(r.Context(), id); errors.Is(err, sql.ErrNoRows) {
+			writeJSONError(w, http.StatusNotFound, "announcement not found")
+			return
+		} else if err != nil {
+			writeJSONError(w, http.StatusInternalServerError, "failed to delete announcement")
+			return
+		}
+		s.announcementsChanged(r)
+		writeJSON(w, http.StatusOK, map[string]bool{"deleted": true})
+		return
+	}
+
+	var input APIAnnouncementInput
+	if err := decodeJSON(r, &input); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "invalid JSON")
+		return
+	}
+	a, err := s.DB.GetAnnouncement(r.Context(), id)
+	if errors.Is(err, sql.ErrNoRows) {
+		writeJSONError(w, http.StatusNotFound, "announcement not found")
+		return
+	} else if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, "failed to load announcement")
+		return
+	}
+	if err := applyAnnouncementInput(&a, input); err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	a.UpdatedAt = time.Now()
+	if err := s.DB.UpdateAnnouncement(r.Context(), a); err != nil {
+		writeJSONError(w, http.StatusInternalServerError, "failed to update announcement")
+		return
+	}
+	s.announcementsChanged(r)
+	writeJSON(w, http.StatusOK, s.announcementToAPI(a, time.Now()))
+}
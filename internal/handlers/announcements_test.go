@@ -0,0 +1,166 @@
+package handlers_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sa/gopherwiki/internal/handlers"
+	"github.com/sa/gopherwiki/internal/storage"
+	"github.com/sa/gopherwiki/internal/testutil"
+)
+
+func TestAnnouncements(t *testing.T) {
+	env := testutil.SetupTestEnv(t)
+	author := storage.Author{Name: "Alice", Email: "alice@example.com"}
+	if _, err := env.Store.Store(context.Background(), "guide.md", "# Guide\n", "Add guide", author); err != nil {
+		t.Fatal(err)
+	}
+	admin := loginAsAdmin(t, env)
+	user := loginAsUser(t, env, "bob@example.com")
+	create := func(body string) handlers.APIAnnouncement {
+		t.Helper()
+		w := apiRequest(t, env, "POST", "/-/api/v1/admin/announcements", body, admin)
+		if w.Code != http.StatusCreated {
+			t.Fatalf("create %s: status = %d: %s", body, w.Code, w.Body.String())
+		}
+		var resp struct {
+			Data handlers.APIAnnouncement `json:"data"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatal(err)
+		}
+		return resp.Data
+	}
+	active := func(cookies []*http.Cookie) []handlers.APIAnnouncement {
+		t.Helper()
+		w := apiGet(t, env, "/-/api/v1/announcements", cookies)
+		if w.Code != http.StatusOK {
+			t.Fatalf("announcements: status = %d: %s", w.Code, w.Body.String())
+		}
+		var resp struct {
+			Data []handlers.APIAnnouncement `json:"data"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatal(err)
+		}
+		return resp.Data
+	}
+
+	etag := apiGet(t, env, "/guide", user).Header().Get("ETag")
+	maintenance := create(`{"message": "**Maintenance** tonight", "severity": "warning"}`)
+	if !maintenance.Dismissible || !maintenance.Active || maintenance.HTML != "<p><strong>Maintenance</strong> tonight</p>\n" {
+		t.Errorf("created announcement = %+v", maintenance)
+	}
+	policy := create(`{"message": "Read the policy", "severity": "danger", "dismissible": false}`)
+	create(fmt.Sprintf(`{"message": "Coming soon", "starts_at": %q}`, time.Now().Add(time.Hour).Format(time.RFC3339)))
+	for _, body := range []string{
+		`{"message": " "}`,
+		`{"message": "Hi", "severity": "loud"}`,
+		`{"message": "Hi", "starts_at": "tomorrow"}`,
+		`{"message": "Hi", "starts_at": "2026-10-14T12:00:00Z", "ends_at": "2026-10-14T11:00:00Z"}`,
+	} {
+		if w := apiRequest(t, env, "POST", "/-/api/v1/admin/announcements", body, admin); w.Code != http.StatusBadRequest {
+			t.Errorf("create %s: status = %d, want %d", body, w.Code, http.StatusBadRequest)
+		}
+	}
+
+	// Every page shows the announcements that have started, with a button
+	// to dismiss only those that may be.
+	w := apiGet(t, env, "/guide", user)
+	body := w.Body.String()
+	if !strings.Contains(body, `class="alert alert-warning announcement"`) || !strings.Contains(body, "Read the policy") ||
+		strings.Contains(body, "Coming soon") {
+		t.Fatalf("page lacks the announcements:\n%s", body)
+	}
+	if strings.Count(body, `class="announcement-dismiss"`) != 1 ||
+		!strings.Contains(body, fmt.Sprintf(`hx-post="/-/announcements/%d/dismiss/partial"`, maintenance.ID)) {
+		t.Errorf("page lacks the button to dismiss the maintenance announcement:\n%s", body)
+	}
+	if w.Header().Get("ETag") == etag {
+		t.Error("ETag unchanged after posting announcements")
+	}
+	if got := active(user); len(got) != 2 {
+		t.Errorf("active announcements = %+v, want 2", got)
+	}
+
+	// Dismissing one hides it from that user only.
+	post := func(path string, cookies []*http.Cookie) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest("POST", path, strings.NewReader(url.Values{"next": {"/guide"}}.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		for _, c := range cookies {
+			req.AddCookie(c)
+		}
+		w := httptest.NewRecorder()
+		env.Router.ServeHTTP(w, req)
+		return w
+	}
+	if w := post(fmt.Sprintf("/-/announcements/%d/dismiss/partial", maintenance.ID), user); w.Code != http.StatusOK || w.Body.Len() != 0 {
+		t.Fatalf("dismiss partial: status = %d\n%s", w.Code, w.Body.String())
+	}
+	if w := post(fmt.Sprintf("/-/announcements/%d/dismiss", policy.ID), user); w.Code != http.StatusBadRequest {
+		t.Errorf("dismissing an announcement that may not be: status = %d, want %d", w.Code, http.StatusBadRequest)
+	}
+	if body := apiGet(t, env, "/guide", user).Body.String(); strings.Contains(body, "Maintenance") || !strings.Contains(body, "Read the policy") {
+		t.Errorf("page after dismissing:\n%s", body)
+	}
+	if got := active(user); len(got) != 1 || got[0].ID != policy.ID {
+		t.Errorf("active announcements after dismissing = %+v", got)
+	}
+	if body := apiGet(t, env, "/guide", admin).Body.String(); !strings.Contains(body, "Maintenance") {
+		t.Error("dismissing an announcement hid it from another user")
+	}
+	if w := apiRequest(t, env, "POST", fmt.Sprintf("/-/api/v1/announcements/%d/dismiss", maintenance.ID), "", nil); w.Code != http.StatusUnauthorized {
+		t.Errorf("anonymous dismiss: status = %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+
+	// Ending an announcement takes it down.
+	w = apiRequest(t, env, "PUT", fmt.Sprintf("/-/api/v1/admin/announcements/%d", policy.ID),
+		fmt.Sprintf(`{"ends_at": %q}`, time.Now().Add(-time.Minute).Format(time.RFC3339)), admin)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"active":false`) {
+		t.Fatalf("update: status = %d: %s", w.Code, w.Body.String())
+	}
+	if got := active(user); len(got) != 0 {
+		t.Errorf("active announcements after ending the last = %+v", got)
+	}
+
+	// The admin form posts one in the wiki's time zone.
+	req := httptest.NewRequest("POST", "/-/admin/announcements", strings.NewReader(url.Values{
+		"message": {"Welcome"}, "severity": {"success"}, "starts_at": {"2020-01-02T09:00"},
+	}.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	for _, c := range admin {
+		req.AddCookie(c)
+	}
+	w = httptest.NewRecorder()
+	env.Router.ServeHTTP(w, req)
+	if w.Code != http.StatusFound || w.Header().Get("Location") != "/-/admin/announcements" {
+		t.Fatalf("admin form: status = %d, location %q", w.Code, w.Header().Get("Location"))
+	}
+	if got := active(user); len(got) != 1 || got[0].Message != "Welcome" || got[0].Dismissible ||
+		got[0].StartsAt != time.Date(2020, 1, 2, 9, 0, 0, 0, time.Local).UTC().Format(time.RFC3339) {
+		t.Errorf("announcement posted with the admin form = %+v", got)
+	}
+
+	// The admin page lists them all; deleting one removes it.
+	if body := apiGet(t, env, "/-/admin/announcements", admin).Body.String(); !strings.Contains(body, "Coming soon") ||
+		!strings.Contains(body, "Scheduled") || !strings.Contains(body, "Ended") {
+		t.Errorf("admin page:\n%s", body)
+	}
+	if w := apiRequest(t, env, "DELETE", fmt.Sprintf("/-/api/v1/admin/announcements/%d", maintenance.ID), "", admin); w.Code != http.StatusOK {
+		t.Errorf("delete: status = %d: %s", w.Code, w.Body.String())
+	}
+	if w := apiRequest(t, env, "DELETE", fmt.Sprintf("/-/api/v1/admin/announcements/%d", maintenance.ID), "", admin); w.Code != http.StatusNotFound {
+		t.Errorf("delete twice: status = %d, want %d", w.Code, http.StatusNotFound)
+	}
+	if w := apiGet(t, env, "/-/api/v1/admin/announcements", user); w.Code == http.StatusOK {
+		t.Error("a user who is not an admin listed every announcement")
+	}
+}
@@ -3,12 +3,15 @@ package handlers
 import (
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"io"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/sa/gopherwiki/internal/db"
 	"github.com/sa/gopherwiki/internal/storage"
+	"github.com/sa/gopherwiki/internal/util"
 	"github.com/sa/gopherwiki/internal/wiki"
 )
 
@@ -39,6 +42,28 @@ func decodeJSON(r *http.Request, dst interface{}) error {
 	return json.Unmarshal(body, dst)
 }
 
+// parseAPIPagination reads the limit and offset query parameters. limit
+// defaults to def and is capped at max.
+func parseAPIPagination(r *http.Request, def, max int) (limit, offset int, err error) {
+	limit = def
+	if v := r.URL.Query().Get("limit"); v != "" {
+		limit, err = strconv.Atoi(v)
+		if err != nil || limit < 1 {
+			return 0, 0, errors.New("invalid limit")
+		}
+		if limit > max {
+			limit = max
+		}
+	}
+	if v := r.URL.Query().Get("offset"); v != "" {
+		offset, err = strconv.Atoi(v)
+		if err != nil || offset < 0 {
+			return 0, 0, errors.New("invalid offset")
+		}
+	}
+	return limit, offset, nil
+}
+
 // --- API data structs ---
 
 // APIPage is the JSON representation of a wiki page.
@@ -51,6 +76,36 @@ type APIPage struct {
 	Metadata *APICommit  `json:"metadata,omitempty"`
 }
 
+// APITOCEntry is the JSON representation of a table of contents entry.
+type APITOCEntry struct {
+	Level  int    `json:"level"`
+	Text   string `json:"text"`
+	Anchor string `json:"anchor"`
+	Number string `json:"number,omitempty"`
+}
+
+// APIRender is the JSON request body for rendering Markdown.
+type APIRender struct {
+	Content string `json:"content"`
+	// Path is the page the Markdown is rendered as, which relative links
+	// and embeds resolve against; empty for the top of the wiki.
+	Path string `json:"path,omitempty"`
+}
+
+// APIRendered is the JSON representation of rendered Markdown.
+type APIRendered struct {
+	HTML                string                 `json:"html"`
+	TOC                 []APITOCEntry          `json:"toc"`
+	LibraryRequirements APILibraryRequirements `json:"library_requirements"`
+}
+
+// APILibraryRequirements lists the scripts rendered Markdown needs to be
+// displayed: Mermaid for diagrams, MathJax for math.
+type APILibraryRequirements struct {
+	RequiresMermaid bool `json:"requires_mermaid"`
+	RequiresMathJax bool `json:"requires_mathjax"`
+}
+
 // APICommit is the JSON representation of a commit.
 type APICommit struct {
 	Revision     string   `json:"revision"`
@@ -72,8 +127,30 @@ type APISearchResult struct {
 
 // APIPageIndex is the JSON representation of a page index entry.
 type APIPageIndex struct {
-	Name string `json:"name"`
-	Path string `json:"path"`
+	Name       string `json:"name"`
+	Path       string `json:"path"`
+	Title      string `json:"title"`
+	Revision   string `json:"revision"`
+	Updated    string `json:"updated"`
+	AuthorName string `json:"author_name"`
+	Size       int64  `json:"size"`
+}
+
+// APIPageTreeNode is the JSON representation of a node of the page tree: a
+// page, a directory of subpages, or both.
+type APIPageTreeNode struct {
+	Name     string            `json:"name"`
+	Title    string            `json:"title"`
+	Path     string            `json:"path"`
+	IsPage   bool              `json:"is_page"`
+	Children []APIPageTreeNode `json:"children,omitempty"`
+}
+
+// APIPageCompletion is the JSON representation of a page offered while
+// typing a link.
+type APIPageCompletion struct {
+	Path  string `json:"path"`
+	Title string `json:"title"`
 }
 
 // APIIssue is the JSON representation of an issue.
@@ -96,6 +173,64 @@ type APIIssueInput struct {
 	Description string   `json:"description"`
 	Category    string   `json:"category"`
 	Tags        []string `json:"tags"`
+	// Template names an issue template filling in what the issue leaves
+	// out, on creation only.
+	Template string `json:"template,omitempty"`
+}
+
+// APIIssueView is the JSON representation of a saved issue list filter.
+type APIIssueView struct {
+	ID    int64  `json:"id"`
+	Name  string `json:"name"`
+	Query string `json:"query"`
+}
+
+// APIIssueTemplate is the JSON representation of an issue template.
+type APIIssueTemplate struct {
+	ID          string   `json:"id"`
+	Name        string   `json:"name"`
+	TitlePrefix string   `json:"title_prefix"`
+	Description string   `json:"description"`
+	Category    string   `json:"category"`
+	Tags        []string `json:"tags"`
+}
+
+// APIIssueExport is an issue with its comments, as exported by
+// /api/v1/issues/export and read back by /api/v1/issues/import.
+type APIIssueExport struct {
+	APIIssue
+	Comments []APIIssueComment `json:"comments"`
+}
+
+// APIIssueImportResult is the JSON response to an issue import.
+type APIIssueImportResult struct {
+	Issues   int `json:"issues"`
+	Comments int `json:"comments"`
+}
+
+// APIIssuePromoteInput is the JSON request body for promoting an issue to
+// a wiki page.
+type APIIssuePromoteInput struct {
+	Path string `json:"path"` // The new page; "" names it after the issue's title
+}
+
+// APIIssueBulkInput is the JSON request body for changing many issues at
+// once. Without Confirm nothing is changed, and the issues that would be
+// are returned.
+type APIIssueBulkInput struct {
+	Action     string   `json:"action"` // close, reopen, retag, recategorize or delete
+	IDs        []int64  `json:"ids"`
+	AddTags    []string `json:"add_tags,omitempty"`
+	RemoveTags []string `json:"remove_tags,omitempty"`
+	Category   string   `json:"category,omitempty"`
+	Confirm    bool     `json:"confirm"`
+}
+
+// APIIssueBulkResult is the JSON response to a bulk issue change.
+type APIIssueBulkResult struct {
+	Action    string     `json:"action"`
+	Confirmed bool       `json:"confirmed"`
+	Issues    []APIIssue `json:"issues"` // As they were before the change
 }
 
 // APIIssueComment is the JSON representation of an issue comment.
@@ -107,9 +242,21 @@ type APIIssueComment struct {
 	AuthorEmail string `json:"author_email"`
 	CreatedAt   string `json:"created_at"`
 	UpdatedAt   string `json:"updated_at"`
+	Edited      bool   `json:"edited"` // Whether earlier versions are kept
+}
+
+// APIIssueCommentRevision is the JSON representation of an earlier version
+// of an edited comment.
+type APIIssueCommentRevision struct {
+	ID            int64  `json:"id"`
+	Content       string `json:"content"`
+	EditedByName  string `json:"edited_by_name"` // Who replaced this version
+	EditedByEmail string `json:"edited_by_email"`
+	EditedAt      string `json:"edited_at"`
 }
 
-// APIIssueCommentInput is the JSON request body for creating a comment.
+// APIIssueCommentInput is the JSON request body for creating or editing a
+// comment.
 type APIIssueCommentInput struct {
 	Content string `json:"content"`
 }
@@ -119,6 +266,23 @@ type APISavePage struct {
 	Content  string `json:"content"`
 	Message  string `json:"message"`
 	Revision string `json:"revision"`
+	// Template is the path of a page template to create the page from, in
+	// place of Content. Only valid for a page that does not exist yet.
+	Template string `json:"template,omitempty"`
+}
+
+// APIModerationHeld is the JSON response to an anonymous contribution held
+// for moderation, answered 202.
+type APIModerationHeld struct {
+	Status string `json:"status"`
+	ID     int64  `json:"id"` // Position in the moderation queue
+}
+
+// APIRestorePage is the JSON request body for restoring a page to a
+// revision.
+type APIRestorePage struct {
+	Revision string `json:"revision"`
+	Message  string `json:"message"`
 }
 
 // --- Conversion helpers ---
@@ -166,11 +330,39 @@ func searchResultToAPI(r wiki.SearchResult) APISearchResult {
 	}
 }
 
-func pageIndexToAPI(e wiki.PageIndexEntry) APIPageIndex {
-	return APIPageIndex{
-		Name: e.Name,
-		Path: e.Path,
+func pageIndexToAPI(m db.PageMetadata) APIPageIndex {
+	e := APIPageIndex{
+		Name:       util.GetPagename(m.Pagepath, false),
+		Path:       m.Pagepath,
+		Title:      m.Title,
+		Revision:   m.Revision,
+		AuthorName: m.AuthorName,
+		Size:       m.Size,
 	}
+	if len(e.Revision) > 6 {
+		e.Revision = e.Revision[:6]
+	}
+	if !m.Updated.IsZero() {
+		e.Updated = m.Updated.Format(time.RFC3339)
+	}
+	return e
+}
+
+func pageTreeToAPI(nodes []*wiki.PageTreeNode) []APIPageTreeNode {
+	result := make([]APIPageTreeNode, 0, len(nodes))
+	for _, n := range nodes {
+		node := APIPageTreeNode{
+			Name:   n.Name,
+			Title:  n.Title,
+			Path:   n.Path,
+			IsPage: n.IsPage,
+		}
+		if len(n.Children) > 0 {
+			node.Children = pageTreeToAPI(n.Children)
+		}
+		result = append(result, node)
+	}
+	return result
 }
 
 func issueToAPI(issue db.Issue) APIIssue {
@@ -0,0 +1,92 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/sa/gopherwiki/internal/wiki"
+)
+
+// APIAttachment is the JSON representation of a page attachment.
+type APIAttachment struct {
+	Filename string `json:"filename"`
+	Pagepath string `json:"pagepath"`
+	URL      string `json:"url"`
+	Mimetype string `json:"mimetype"`
+	IsImage  bool   `json:"is_image"`
+}
+
+// APIAttachmentList is a page of attachment search results.
+type APIAttachmentList struct {
+	Attachments []APIAttachment `json:"attachments"`
+	Total       int             `json:"total"`
+	Offset      int             `json:"offset"`
+	Limit       int             `json:"limit"`
+}
+
+func attachmentsToAPI(attachments []wiki.Attachment) []APIAttachment {
+	result := make([]APIAttachment, 0, len(attachments))
+	for _, a := range attachments {
+		result = append(result, APIAttachment{
+			Filename: a.Filename,
+			Pagepath: a.Pagepath,
+			URL:      "/" + a.Fullpath,
+			Mimetype: a.Mimetype,
+			IsImage:  strings.HasPrefix(a.Mimetype, "image/"),
+		})
+	}
+	return result
+}
+
+// handleAPIPageAttachments handles GET /api/v1/pages/{path}/attachments?q=&limit=&offset=
+// -- search a page's attachments by filename.
+func (s *Server) handleAPIPageAttachments(w http.ResponseWriter, r *http.Request, pagePath string) {
+	limit, offset, err := parseAPIPagination(r, 20, 100)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	page, err := wiki.NewPage(r.Context(), s.Storage, s.Config, pagePath, "")
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, "failed to load page")
+		return
+	}
+
+	query := strings.TrimSpace(r.URL.Query().Get("q"))
+	attachments, total, err := page.SearchAttachments(r.Context(), query, offset, limit)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, "failed to list attachments")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, APIAttachmentList{
+		Attachments: attachmentsToAPI(attachments),
+		Total:       total,
+		Offset:      offset,
+		Limit:       limit,
+	})
+}
+
+// handleAPIRecentAttachments handles GET /api/v1/attachments/recent?q=&limit=
+// -- the most recently committed attachments across the wiki.
+func (s *Server) handleAPIRecentAttachments(w http.ResponseWriter, r *http.Request) {
+	limit, _, err := parseAPIPagination(r, 20, 100)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	query := strings.TrimSpace(r.URL.Query().Get("q"))
+	attachments, err := s.Wiki.RecentAttachments(r.Context(), query, limit)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, "failed to list recent attachments")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, APIAttachmentList{
+		Attachments: attachmentsToAPI(attachments),
+		Total:       len(attachments),
+		Limit:       limit,
+	})
+}
@@ -0,0 +1,275 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/sa/gopherwiki/internal/storage"
+	"github.com/sa/gopherwiki/internal/wiki"
+)
+
+// APIDiff is the JSON representation of the changes to a page between two
+// revisions. Files is empty when the revisions do not differ.
+type APIDiff struct {
+	RevA  string        `json:"rev_a"`
+	RevB  string        `json:"rev_b"`
+	Files []APIDiffFile `json:"files"`
+}
+
+// APICommitDiff is the JSON representation of a commit with its changes.
+type APICommitDiff struct {
+	Commit APICommit     `json:"commit"`
+	Files  []APIDiffFile `json:"files"`
+}
+
+// APIDiffFile is the JSON representation of the changes to one file: its
+// hunks, and the unified diff they were read from.
+type APIDiffFile struct {
+	File      string        `json:"file"`
+	Status    string        `json:"status"` // "added", "modified", "deleted"
+	Binary    bool          `json:"binary"` // Binary files have no hunks
+	Additions int           `json:"additions"`
+	Deletions int           `json:"deletions"`
+	Hunks     []APIDiffHunk `json:"hunks"`
+	Patch     string        `json:"patch"`
+}
+
+// APIDiffHunk is the JSON representation of a hunk of a unified diff.
+// Section is the text git puts after the hunk's line ranges, if any.
+type APIDiffHunk struct {
+	OldStart int           `json:"old_start"`
+	OldLines int           `json:"old_lines"`
+	NewStart int           `json:"new_start"`
+	NewLines int           `json:"new_lines"`
+	Section  string        `json:"section,omitempty"`
+	Lines    []APIDiffLine `json:"lines"`
+}
+
+// APIDiffLine is the JSON representation of a line of a hunk. OldLine and
+// NewLine are its line numbers, omitted on the side it is missing from.
+type APIDiffLine struct {
+	Type    string `json:"type"` // "context", "add", "remove"
+	Content string `json:"content"`
+	OldLine int    `json:"old_line,omitempty"`
+	NewLine int    `json:"new_line,omitempty"`
+}
+
+// handleAPIPageDiff handles GET /api/v1/pages/{path}/diff -- the changes
+// to a page between rev_a and rev_b, as the diff view shows them: rev_a
+// defaults to the revision before the last, rev_b to the current one.
+func (s *Server) handleAPIPageDiff(w http.ResponseWriter, r *http.Request, pagePath string) {
+	ctx := r.Context()
+	revA := r.URL.Query().Get("rev_a")
+	revB := r.URL.Query().Get("rev_b")
+
+	page, err := wiki.NewPage(ctx, s.Storage, s.Config, pagePath, "")
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, "failed to load page")
+		return
+	}
+	if !page.Exists {
+		writeJSONError(w, http.StatusNotFound, "page not found")
+		return
+	}
+	if revA == "" {
+		log, err := page.History(ctx, 2)
+		if err != nil {
+			writeJSONError(w, http.StatusInternalServerError, "failed to get history")
+			return
+		}
+		if len(log) > 1 {
+			revA = log[1].Revision
+		}
+	}
+	if revB == "" && page.Metadata != nil {
+		revB = page.Metadata.Revision
+	}
+
+	// A revision the page is missing from diffs as a missing file, so that
+	// its creation or deletion shows as every line added or removed.
+	var texts [2][]byte
+	found := false
+	for i, rev := range []string{revA, revB} {
+		if rev == "" {
+			continue
+		}
+		text, err := s.Storage.Load(ctx, page.Filename, rev)
+		switch {
+		case err == nil:
+			texts[i] = []byte(text)
+			found = true
+		case !errors.Is(err, storage.ErrNotFound):
+			writeJSONError(w, http.StatusInternalServerError, "failed to load revision")
+			return
+		}
+	}
+	if !found {
+		writeJSONError(w, http.StatusNotFound, "neither revision of this page was found")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, APIDiff{
+		RevA:  revA,
+		RevB:  revB,
+		Files: patchFiles(storage.FilePatch(page.Filename, texts[0], texts[1])),
+	})
+}
+
+// handleAPICommit handles GET /api/v1/commits/{revision} -- a commit and
+// the changes it made to each file.
+func (s *Server) handleAPICommit(w http.ResponseWriter, r *http.Request) {
+	meta, patch, err := s.Wiki.ShowCommit(r.Context(), chi.URLParam(r, "revision"))
+	if err != nil {
+		writeJSONError(w, http.StatusNotFound, "commit not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, APICommitDiff{
+		Commit: *commitToAPI(meta),
+		Files:  patchFiles(patch),
+	})
+}
+
+// hunkHeader matches the line that starts a hunk, "@@ -1,3 +1,4 @@ ...".
+var hunkHeader = regexp.MustCompile(`^@@ -(\d+)(?:,(\d+))? \+(\d+)(?:,(\d+))? @@ ?(.*)$`)
+
+// patchFiles splits a unified diff in git's format, as the storage
+// backends produce it, into its files and their hunks.
+func patchFiles(patch string) []APIDiffFile {
+	files := []APIDiffFile{}
+	var file *APIDiffFile
+	var hunk *APIDiffHunk
+	var patchLines []string
+	var oldNo, newNo, oldLeft, newLeft int
+
+	flush := func() {
+		if file == nil {
+			return
+		}
+		file.Patch = strings.Join(patchLines, "\n") + "\n"
+		files = append(files, *file)
+	}
+
+	for _, line := range strings.Split(strings.TrimSuffix(patch, "\n"), "\n") {
+		if strings.HasPrefix(line, "diff --git ") {
+			flush()
+			file = &APIDiffFile{File: diffGitPath(line), Status: "modified", Hunks: []APIDiffHunk{}}
+			hunk, patchLines, oldLeft, newLeft = nil, nil, 0, 0
+		}
+		if file == nil {
+			continue
+		}
+		patchLines = append(patchLines, line)
+
+		// Within a hunk its line counts tell content from headers, which
+		// a removed line may look like. An empty line is an empty context
+		// line whose space was stripped.
+		if hunk != nil && (oldLeft > 0 || newLeft > 0) && (line == "" || strings.ContainsRune(" +-", rune(line[0]))) {
+			if line == "" {
+				line = " "
+			}
+			dl := APIDiffLine{Content: line[1:]}
+			switch line[0] {
+			case '+':
+				dl.Type = "add"
+				newNo++
+				newLeft--
+				dl.NewLine = newNo
+				file.Additions++
+			case '-':
+				dl.Type = "remove"
+				oldNo++
+				oldLeft--
+				dl.OldLine = oldNo
+				file.Deletions++
+			default:
+				dl.Type = "context"
+				oldNo++
+				newNo++
+				oldLeft--
+				newLeft--
+				dl.OldLine, dl.NewLine = oldNo, newNo
+			}
+			hunk.Lines = append(hunk.Lines, dl)
+			continue
+		}
+
+		switch {
+		case strings.HasPrefix(line, "@@ "):
+			m := hunkHeader.FindStringSubmatch(line)
+			if m == nil {
+				continue
+			}
+			file.Hunks = append(file.Hunks, APIDiffHunk{
+				OldStart: atoiOr(m[1], 0),
+				OldLines: atoiOr(m[2], 1),
+				NewStart: atoiOr(m[3], 0),
+				NewLines: atoiOr(m[4], 1),
+				Section:  m[5],
+				Lines:    []APIDiffLine{},
+			})
+			hunk = &file.Hunks[len(file.Hunks)-1]
+			oldNo, newNo = hunk.OldStart-1, hunk.NewStart-1
+			oldLeft, newLeft = hunk.OldLines, hunk.NewLines
+		case strings.HasPrefix(line, "new file mode"):
+			file.Status = "added"
+		case strings.HasPrefix(line, "deleted file mode"):
+			file.Status = "deleted"
+		case strings.HasPrefix(line, "Binary files ") || line == "GIT binary patch":
+			file.Binary = true
+		case strings.HasPrefix(line, "+++ "):
+			if name := patchPath(line[4:], "b/"); name != "" {
+				file.File = name
+			}
+		case strings.HasPrefix(line, "--- "):
+			if name := patchPath(line[4:], "a/"); name != "" && file.Status == "deleted" {
+				file.File = name
+			}
+		}
+	}
+	flush()
+	return files
+}
+
+// diffGitPath returns the new name of the file in a "diff --git a/x b/x"
+// line, which the ---/+++ lines after it override when they are present.
+func diffGitPath(line string) string {
+	rest := strings.TrimPrefix(line, "diff --git ")
+	// The two names are the same unless the file was renamed.
+	if n := (len(rest) - 1) / 2; len(rest)%2 == 1 && rest[n] == ' ' && strings.HasPrefix(rest, "a/") && rest[n+1:n+3] == "b/" && rest[2:n] == rest[n+3:] {
+		return rest[n+3:]
+	}
+	if i := strings.LastIndex(rest, " b/"); i >= 0 {
+		return patchPath(rest[i+1:], "b/")
+	}
+	return patchPath(rest, "b/")
+}
+
+// patchPath returns the file name of a ---/+++ line or a name of a
+// "diff --git" line, without its a/ or b/ prefix; "" for /dev/null.
+func patchPath(name, prefix string) string {
+	name = strings.TrimSuffix(name, "\t")
+	if name == "/dev/null" {
+		return ""
+	}
+	if strings.HasPrefix(name, `"`) {
+		if unquoted, err := strconv.Unquote(name); err == nil {
+			name = unquoted
+		}
+	}
+	return strings.TrimPrefix(name, prefix)
+}
+
+// atoiOr parses s as an integer, returning def when it is empty or
+// invalid.
+func atoiOr(s string, def int) int {
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return def
+	}
+	return n
+}
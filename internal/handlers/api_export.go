@@ -0,0 +1,28 @@
+package handlers
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/sa/gopherwiki/internal/storage"
+)
+
+// handleAPIExport serves the same ZIP archive as /-/export: the page sources
+// and attachments of the subtree given by `path`, or of the whole wiki.
+func (s *Server) handleAPIExport(w http.ResponseWriter, r *http.Request) {
+	dir := r.URL.Query().Get("path")
+	files, err := s.Wiki.ExportFiles(r.Context(), dir)
+	if errors.Is(err, storage.ErrNotFound) {
+		writeJSONError(w, http.StatusNotFound, "nothing to export")
+		return
+	}
+	if err != nil {
+		slog.Error("wiki export failed", "path", dir, "error", err)
+		writeJSONError(w, http.StatusInternalServerError, "export failed")
+		return
+	}
+	if err := s.serveArchive(w, r, files, archiveFilename(dir)); err != nil {
+		writeJSONError(w, http.StatusInternalServerError, "export failed")
+	}
+}
@@ -0,0 +1,75 @@
+package handlers
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/sa/gopherwiki/internal/wiki"
+)
+
+// handleAPIImport imports the ZIP archive sent as the request body. The
+// query parameters mirror the admin import form: prefix, overwrite,
+// commit=per-file, message, and dry_run. It responds with the import report.
+func (s *Server) handleAPIImport(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, wiki.MaxImportSize))
+	if err != nil {
+		writeJSONError(w, http.StatusRequestEntityTooLarge, "archive too large")
+		return
+	}
+
+	q := r.URL.Query()
+	overwrite, _ := strconv.ParseBool(q.Get("overwrite"))
+	dryRun, _ := strconv.ParseBool(q.Get("dry_run"))
+	opts := wiki.ImportOptions{
+		Prefix:         q.Get("prefix"),
+		Overwrite:      overwrite,
+		PerFileCommits: q.Get("commit") == "per-file",
+		DryRun:         dryRun,
+		Message:        q.Get("message"),
+	}
+
+	report, err := s.Wiki.Import(r.Context(), bytes.NewReader(body), int64(len(body)), opts, s.getAuthor(r))
+	if errors.Is(err, wiki.ErrInvalidArchive) {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err != nil {
+		slog.Error("import failed", "error", err)
+		writeJSONError(w, http.StatusInternalServerError, "import failed")
+		return
+	}
+	writeJSON(w, http.StatusOK, report)
+}
+
+// handleAPIImportMediaWiki imports the MediaWiki XML dump sent as the request
+// body, which may be compressed with gzip or bzip2. The query parameters are
+// prefix, overwrite, latest_only, and dry_run. It responds with the import
+// report.
+func (s *Server) handleAPIImportMediaWiki(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	overwrite, _ := strconv.ParseBool(q.Get("overwrite"))
+	latestOnly, _ := strconv.ParseBool(q.Get("latest_only"))
+	dryRun, _ := strconv.ParseBool(q.Get("dry_run"))
+	opts := wiki.MediaWikiOptions{
+		Prefix:     q.Get("prefix"),
+		Overwrite:  overwrite,
+		LatestOnly: latestOnly,
+		DryRun:     dryRun,
+	}
+
+	report, err := s.Wiki.ImportMediaWiki(r.Context(), http.MaxBytesReader(w, r.Body, wiki.MaxImportSize), opts, s.getAuthor(r))
+	if errors.Is(err, wiki.ErrInvalidArchive) {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err != nil {
+		slog.Error("mediawiki import failed", "error", err)
+		writeJSONError(w, http.StatusInternalServerError, "import failed")
+		return
+	}
+	writeJSON(w, http.StatusOK, report)
+}
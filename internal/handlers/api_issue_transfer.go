@@ -0,0 +1,322 @@
+package handlers
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sa/gopherwiki/internal/db"
+	"github.com/sa/gopherwiki/internal/storage"
+)
+
+// maxIssueImportSize caps the body of an issue import.
+const maxIssueImportSize = 32 << 20
+
+// issueCSVHeader are the columns of the CSV issue format. Each row is an
+// issue or a comment, as its record column says; a comment's issue_id is
+// the id of its issue in the same file, and its body is the comment's
+// content where an issue's is the description.
+var issueCSVHeader = []string{"record", "id", "issue_id", "title", "status", "category", "tags", "author_name", "author_email", "created_at", "updated_at", "body"}
+
+// errInvalidIssueImport marks an import the wiki cannot read.
+var errInvalidIssueImport = errors.New("invalid issue import")
+
+// exportIssues returns every issue with its comments, oldest first.
+func (s *Server) exportIssues(ctx context.Context) ([]APIIssueExport, error) {
+	issues, err := s.DB.Queries.ListIssues(ctx)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(issues, func(i, j int) bool { return issues[i].ID < issues[j].ID })
+
+	result := make([]APIIssueExport, 0, len(issues))
+	for _, issue := range issues {
+		comments, err := s.DB.Queries.ListIssueComments(ctx, issue.ID)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, APIIssueExport{APIIssue: issueToAPI(issue), Comments: issueCommentsToAPI(comments)})
+	}
+	return result, nil
+}
+
+// writeIssuesCSV writes issues in the CSV issue format.
+func writeIssuesCSV(w io.Writer, issues []APIIssueExport) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(issueCSVHeader); err != nil {
+		return err
+	}
+	for _, issue := range issues {
+		id := strconv.FormatInt(issue.ID, 10)
+		if err := cw.Write([]string{"issue", id, "", issue.Title, issue.Status, issue.Category, strings.Join(issue.Tags, ","),
+			issue.CreatedByName, issue.CreatedByEmail, issue.CreatedAt, issue.UpdatedAt, issue.Description}); err != nil {
+			return err
+		}
+		for _, c := range issue.Comments {
+			if err := cw.Write([]string{"comment", strconv.FormatInt(c.ID, 10), id, "", "", "", "",
+				c.AuthorName, c.AuthorEmail, c.CreatedAt, c.UpdatedAt, c.Content}); err != nil {
+				return err
+			}
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// readIssuesCSV reads issues in the CSV issue format.
+func readIssuesCSV(r io.Reader) ([]APIIssueExport, error) {
+	cr := csv.NewReader(r)
+	header, err := cr.Read()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errInvalidIssueImport, err)
+	}
+	col := make(map[string]int, len(header))
+	for i, name := range header {
+		col[strings.TrimSpace(name)] = i
+	}
+	for _, name := range issueCSVHeader {
+		if _, ok := col[name]; !ok {
+			return nil, fmt.Errorf("%w: missing column %q", errInvalidIssueImport, name)
+		}
+	}
+
+	var issues []APIIssueExport
+	byID := make(map[int64]int)
+	for {
+		row, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", errInvalidIssueImport, err)
+		}
+		line, _ := cr.FieldPos(0)
+		field := func(name string) string { return row[col[name]] }
+		id, _ := strconv.ParseInt(field("id"), 10, 64)
+
+		switch field("record") {
+		case "issue":
+			byID[id] = len(issues)
+			issues = append(issues, APIIssueExport{APIIssue: APIIssue{
+				ID:             id,
+				Title:          field("title"),
+				Description:    field("body"),
+				Status:         field("status"),
+				Category:       field("category"),
+				Tags:           parseTags(field("tags")),
+				CreatedByName:  field("author_name"),
+				CreatedByEmail: field("author_email"),
+				CreatedAt:      field("created_at"),
+				UpdatedAt:      field("updated_at"),
+			}})
+		case "comment":
+			issueID, _ := strconv.ParseInt(field("issue_id"), 10, 64)
+			i, ok := byID[issueID]
+			if !ok {
+				return nil, fmt.Errorf("%w: line %d: comment on issue %q, which no earlier row has", errInvalidIssueImport, line, field("issue_id"))
+			}
+			issues[i].Comments = append(issues[i].Comments, APIIssueComment{
+				ID:          id,
+				IssueID:     issueID,
+				Content:     field("body"),
+				AuthorName:  field("author_name"),
+				AuthorEmail: field("author_email"),
+				CreatedAt:   field("created_at"),
+				UpdatedAt:   field("updated_at"),
+			})
+		default:
+			return nil, fmt.Errorf("%w: line %d: unknown record %q", errInvalidIssueImport, line, field("record"))
+		}
+	}
+	return issues, nil
+}
+
+// parseExportTime reads a time of the export format, RFC 3339, falling back
+// to now for an empty one.
+func parseExportTime(value string, now time.Time) (time.Time, error) {
+	if value == "" {
+		return now, nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+// importIssues adds issues and their comments in one transaction, keeping
+// their authors, statuses, and times. They are numbered anew. A
+// malformed issue fails the import with an error wrapping
+// errInvalidIssueImport.
+func (s *Server) importIssues(ctx context.Context, issues []APIIssueExport, actor storage.Author) (APIIssueImportResult, error) {
+	var result APIIssueImportResult
+	tx, err := s.DB.BeginTx(ctx)
+	if err != nil {
+		return result, err
+	}
+	defer tx.Rollback()
+	q := s.DB.WithTx(tx)
+
+	now := time.Now()
+	for i, in := range issues {
+		invalid := func(format string, args ...any) error {
+			return fmt.Errorf("%w: issue %d: %s", errInvalidIssueImport, i+1, fmt.Sprintf(format, args...))
+		}
+		title := strings.TrimSpace(in.Title)
+		if title == "" {
+			return result, invalid("title is required")
+		}
+		status := in.Status
+		if status == "" {
+			status = "open"
+		} else if status != "open" && status != "closed" {
+			return result, invalid("unknown status %q", status)
+		}
+		createdAt, err := parseExportTime(in.CreatedAt, now)
+		if err != nil {
+			return result, invalid("created_at: %v", err)
+		}
+		updatedAt, err := parseExportTime(in.UpdatedAt, createdAt)
+		if err != nil {
+			return result, invalid("updated_at: %v", err)
+		}
+
+		issue, err := q.CreateIssue(ctx, db.CreateIssueParams{
+			Title:          title,
+			Description:    db.NullString(in.Description),
+			Status:         status,
+			Category:       db.NullString(strings.TrimSpace(in.Category)),
+			Tags:           db.NullString(strings.Join(trimTags(in.Tags), ",")),
+			CreatedByName:  db.NullString(in.CreatedByName),
+			CreatedByEmail: db.NullString(in.CreatedByEmail),
+			CreatedAt:      db.NullTime(createdAt),
+			UpdatedAt:      db.NullTime(updatedAt),
+		})
+		if err != nil {
+			return result, err
+		}
+		result.Issues++
+
+		for j, c := range in.Comments {
+			if strings.TrimSpace(c.Content) == "" {
+				return result, invalid("comment %d is empty", j+1)
+			}
+			commentCreated, err := parseExportTime(c.CreatedAt, createdAt)
+			if err != nil {
+				return result, invalid("comment %d: created_at: %v", j+1, err)
+			}
+			commentUpdated, err := parseExportTime(c.UpdatedAt, commentCreated)
+			if err != nil {
+				return result, invalid("comment %d: updated_at: %v", j+1, err)
+			}
+			if _, err := q.CreateIssueComment(ctx, db.CreateIssueCommentParams{
+				IssueID:     issue.ID,
+				Content:     c.Content,
+				AuthorName:  db.NullString(c.AuthorName),
+				AuthorEmail: db.NullString(c.AuthorEmail),
+				CreatedAt:   db.NullTime(commentCreated),
+				UpdatedAt:   db.NullTime(commentUpdated),
+			}); err != nil {
+				return result, err
+			}
+			result.Comments++
+		}
+	}
+
+	entry := db.AuditEntry{
+		Action:     "issues.import",
+		Detail:     fmt.Sprintf("Import %d issues with %d comments", result.Issues, result.Comments),
+		ActorName:  actor.Name,
+		ActorEmail: actor.Email,
+		CreatedAt:  now,
+	}
+	if err := s.DB.AddAuditEntry(ctx, tx, entry); err != nil {
+		return result, err
+	}
+	return result, tx.Commit()
+}
+
+// issueTransferFormat returns the format, json or csv, that the format
+// query parameter or else the content type names.
+func issueTransferFormat(r *http.Request, contentType string) string {
+	if format := r.URL.Query().Get("format"); format != "" {
+		return format
+	}
+	if mediaType, _, _ := mime.ParseMediaType(contentType); mediaType == "text/csv" {
+		return "csv"
+	}
+	return "json"
+}
+
+// handleAPIIssueExport handles GET /api/v1/issues/export -- download every
+// issue with its comments, as JSON or, with format=csv, as CSV.
+func (s *Server) handleAPIIssueExport(w http.ResponseWriter, r *http.Request) {
+	format := issueTransferFormat(r, "")
+	if format != "json" && format != "csv" {
+		writeJSONError(w, http.StatusBadRequest, "format must be json or csv")
+		return
+	}
+	issues, err := s.exportIssues(r.Context())
+	if err != nil {
+		slog.Error("issue export failed", "error", err)
+		writeJSONError(w, http.StatusInternalServerError, "export failed")
+		return
+	}
+
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", "issues."+format))
+	if format == "csv" {
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		if err := writeIssuesCSV(w, issues); err != nil {
+			slog.Warn("failed to write issue export", "error", err)
+		}
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(issues); err != nil {
+		slog.Warn("failed to write issue export", "error", err)
+	}
+}
+
+// handleAPIIssueImport handles POST /api/v1/issues/import -- add the
+// issues of an export, sent as the request body in either format.
+func (s *Server) handleAPIIssueImport(w http.ResponseWriter, r *http.Request) {
+	body := http.MaxBytesReader(w, r.Body, maxIssueImportSize)
+	var issues []APIIssueExport
+	var err error
+	switch issueTransferFormat(r, r.Header.Get("Content-Type")) {
+	case "csv":
+		issues, err = readIssuesCSV(body)
+	case "json":
+		if err = json.NewDecoder(body).Decode(&issues); err != nil {
+			err = fmt.Errorf("%w: %w", errInvalidIssueImport, err)
+		}
+	default:
+		writeJSONError(w, http.StatusBadRequest, "format must be json or csv")
+		return
+	}
+
+	var result APIIssueImportResult
+	if err == nil {
+		result, err = s.importIssues(r.Context(), issues, s.getAuthor(r))
+	}
+	var tooLarge *http.MaxBytesError
+	switch {
+	case errors.As(err, &tooLarge):
+		writeJSONError(w, http.StatusRequestEntityTooLarge, "import too large")
+	case errors.Is(err, errInvalidIssueImport):
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+	case err != nil:
+		slog.Error("issue import failed", "error", err)
+		writeJSONError(w, http.StatusInternalServerError, "import failed")
+	default:
+		writeJSON(w, http.StatusOK, result)
+	}
+}
@@ -0,0 +1,92 @@
+package handlers_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sa/gopherwiki/internal/db"
+	"github.com/sa/gopherwiki/internal/handlers"
+	"github.com/sa/gopherwiki/internal/testutil"
+)
+
+func TestIssueExportImport(t *testing.T) {
+	src := testutil.SetupTestEnv(t)
+	ctx := context.Background()
+	when := time.Date(2023, 3, 14, 9, 26, 53, 0, time.UTC)
+	issue, err := src.DB.Queries.CreateIssue(ctx, db.CreateIssueParams{
+		Title:          "Broken, \"quoted\" link",
+		Description:    db.NullString("Line one\nLine two"),
+		Status:         "closed",
+		Category:       db.NullString("Bug"),
+		Tags:           db.NullString("bug,ui"),
+		CreatedByName:  db.NullString("Alice"),
+		CreatedByEmail: db.NullString("alice@example.com"),
+		CreatedAt:      db.NullTime(when),
+		UpdatedAt:      db.NullTime(when.Add(time.Hour)),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := src.DB.Queries.CreateIssueComment(ctx, db.CreateIssueCommentParams{
+		IssueID:     issue.ID,
+		Content:     "Fixed, see the commit.",
+		AuthorName:  db.NullString("Bob"),
+		AuthorEmail: db.NullString("bob@example.com"),
+		CreatedAt:   db.NullTime(when.Add(2 * time.Hour)),
+		UpdatedAt:   db.NullTime(when.Add(2 * time.Hour)),
+	}); err != nil {
+		t.Fatal(err)
+	}
+	createAPITestIssue(t, src, "Second", "", "open", "", nil)
+
+	for _, format := range []string{"json", "csv"} {
+		t.Run(format, func(t *testing.T) {
+			w := apiRequest(t, src, "GET", "/-/api/v1/issues/export?format="+format, "", nil)
+			if w.Code != http.StatusOK || !strings.Contains(w.Header().Get("Content-Disposition"), "issues."+format) {
+				t.Fatalf("export: status = %d, Content-Disposition = %q", w.Code, w.Header().Get("Content-Disposition"))
+			}
+			export := w.Body.String()
+
+			// Another wiki imports the export as it was.
+			dst := testutil.SetupTestEnv(t)
+			admin := loginAsAdmin(t, dst)
+			if w := apiRequest(t, dst, "POST", "/-/api/v1/issues/import?format="+format, export, nil); w.Code != http.StatusUnauthorized {
+				t.Errorf("anonymous import: status = %d, want %d", w.Code, http.StatusUnauthorized)
+			}
+			w = apiRequest(t, dst, "POST", "/-/api/v1/issues/import?format="+format, export, admin)
+			var resp struct {
+				Data handlers.APIIssueImportResult `json:"data"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || resp.Data.Issues != 2 || resp.Data.Comments != 1 {
+				t.Fatalf("import: status = %d, result = %+v, %v; body: %s", w.Code, resp.Data, err, w.Body.String())
+			}
+
+			got := apiRequest(t, dst, "GET", "/-/api/v1/issues/export?format="+format, "", nil).Body.String()
+			if got != export {
+				t.Errorf("re-export differs:\n%s\nwant:\n%s", got, export)
+			}
+			if entries, _ := dst.DB.ListAuditEntries(ctx, 10); len(entries) != 1 || entries[0].Action != "issues.import" {
+				t.Errorf("audit log = %+v", entries)
+			}
+		})
+	}
+
+	// A malformed import adds nothing.
+	dst := testutil.SetupTestEnv(t)
+	admin := loginAsAdmin(t, dst)
+	body := `[{"title": "Good"}, {"title": "Bad", "status": "pending"}]`
+	if w := apiRequest(t, dst, "POST", "/-/api/v1/issues/import", body, admin); w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "issue 2") {
+		t.Errorf("malformed import: status = %d, body = %s", w.Code, w.Body.String())
+	}
+	csv := "record,id,issue_id,title,status,category,tags,author_name,author_email,created_at,updated_at,body\ncomment,1,7,,,,,,,,,Orphan\n"
+	if w := apiRequest(t, dst, "POST", "/-/api/v1/issues/import?format=csv", csv, admin); w.Code != http.StatusBadRequest {
+		t.Errorf("orphan comment: status = %d, want %d", w.Code, http.StatusBadRequest)
+	}
+	if issues, _ := dst.DB.Queries.ListIssues(ctx); len(issues) != 0 {
+		t.Errorf("failed imports added %d issues", len(issues))
+	}
+}
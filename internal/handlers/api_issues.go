@@ -2,6 +2,7 @@ package handlers
 
 import (
 	"database/sql"
+	"errors"
 	"net/http"
 	"strings"
 	"time"
@@ -10,55 +11,50 @@ import (
 
 	"github.com/sa/gopherwiki/internal/db"
 	"github.com/sa/gopherwiki/internal/middleware"
+	"github.com/sa/gopherwiki/internal/spam"
+	"github.com/sa/gopherwiki/internal/storage"
 )
 
 // handleAPIIssueList handles GET /api/v1/issues -- list issues with optional filters.
 func (s *Server) handleAPIIssueList(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 
-	statusFilter := r.URL.Query().Get("status")
-	tagFilter := r.URL.Query().Get("tag")
-	categoryFilter := r.URL.Query().Get("category")
-
-	var issues []db.Issue
-	var err error
-
-	if statusFilter != "" && (statusFilter == "open" || statusFilter == "closed") {
-		issues, err = s.DB.Queries.ListIssuesByStatus(ctx, statusFilter)
-	} else {
-		issues, err = s.DB.Queries.ListIssues(ctx)
+	filter, _, err := s.requestIssueFilter(r)
+	if errors.Is(err, errIssueViewNotFound) {
+		writeJSONError(w, http.StatusNotFound, "saved view not found")
+		return
+	} else if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, "failed to load saved view")
+		return
 	}
 
+	issues, err := s.listIssues(ctx, filter)
 	if err != nil {
 		writeJSONError(w, http.StatusInternalServerError, "failed to list issues")
 		return
 	}
 
-	// Filter by category if specified
-	if categoryFilter != "" {
-		var filtered []db.Issue
-		for _, issue := range issues {
-			if issue.Category.Valid && issue.Category.String == categoryFilter {
-				filtered = append(filtered, issue)
-			}
-		}
-		issues = filtered
-	}
-
-	// Filter by tag if specified
-	if tagFilter != "" {
-		var filtered []db.Issue
-		for _, issue := range issues {
-			if issue.Tags.Valid && containsTag(issue.Tags.String, tagFilter) {
-				filtered = append(filtered, issue)
-			}
-		}
-		issues = filtered
-	}
-
 	writeJSON(w, http.StatusOK, issuesToAPI(issues))
 }
 
+// handleAPIIssueTemplates handles GET /api/v1/issues/templates -- list the
+// issue templates.
+func (s *Server) handleAPIIssueTemplates(w http.ResponseWriter, r *http.Request) {
+	templates := s.getIssueTemplates(r.Context())
+	result := make([]APIIssueTemplate, 0, len(templates))
+	for _, t := range templates {
+		result = append(result, APIIssueTemplate{
+			ID:          t.ID,
+			Name:        t.Name,
+			TitlePrefix: t.TitlePrefix,
+			Description: t.Description,
+			Category:    t.Category,
+			Tags:        t.Tags,
+		})
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
 // handleAPIIssueGet handles GET /api/v1/issues/{id} -- get a single issue.
 func (s *Server) handleAPIIssueGet(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
@@ -95,12 +91,29 @@ func (s *Server) handleAPIIssueCreate(w http.ResponseWriter, r *http.Request) {
 		writeJSONError(w, http.StatusBadRequest, "title is required")
 		return
 	}
+	if input.Template != "" {
+		t, ok := s.findIssueTemplate(r.Context(), input.Template)
+		if !ok {
+			writeJSONError(w, http.StatusBadRequest, "unknown issue template")
+			return
+		}
+		title, input.Description, input.Category, input.Tags = t.apply(title, input.Description, input.Category, input.Tags)
+	}
+
+	sub := spam.Submission{Kind: spam.KindIssue, Title: title, Content: input.Description}
+	if id, held, err := s.holdForModeration(r, sub, moderationPayload{Category: input.Category, Tags: input.Tags}); err != nil {
+		writeJSONError(w, http.StatusInternalServerError, "failed to create issue")
+		return
+	} else if held {
+		writeJSON(w, http.StatusAccepted, APIModerationHeld{Status: "awaiting moderation", ID: id})
+		return
+	}
 
 	user := middleware.GetUser(r)
 	createdByName := user.GetName()
 	createdByEmail := user.GetEmail()
 	if createdByName == "" {
-		createdByName = "Anonymous"
+		createdByName = s.getAuthor(r).Name
 	}
 
 	now := time.Now()
@@ -121,6 +134,7 @@ func (s *Server) handleAPIIssueCreate(w http.ResponseWriter, r *http.Request) {
 		writeJSONError(w, http.StatusInternalServerError, "failed to create issue")
 		return
 	}
+	s.notifyMentions(r.Context(), issue, 0, input.Description, storage.Author{Name: createdByName, Email: createdByEmail})
 
 	writeJSON(w, http.StatusCreated, issueToAPI(issue))
 }
@@ -260,8 +274,17 @@ func (s *Server) handleAPIIssueComments(w http.ResponseWriter, r *http.Request)
 		writeJSONError(w, http.StatusInternalServerError, "failed to list comments")
 		return
 	}
+	edited, err := s.DB.CountEditedIssueComments(ctx, id)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, "failed to list comments")
+		return
+	}
 
-	writeJSON(w, http.StatusOK, issueCommentsToAPI(comments))
+	result := issueCommentsToAPI(comments)
+	for i := range result {
+		result[i].Edited = edited[result[i].ID] > 0
+	}
+	writeJSON(w, http.StatusOK, result)
 }
 
 // handleAPIIssueCommentCreate handles POST /api/v1/issues/{id}/comments -- create a comment.
@@ -287,7 +310,8 @@ func (s *Server) handleAPIIssueCommentCreate(w http.ResponseWriter, r *http.Requ
 	}
 
 	// Verify issue exists
-	if _, err := s.DB.Queries.GetIssue(ctx, id); err != nil {
+	issue, err := s.DB.Queries.GetIssue(ctx, id)
+	if err != nil {
 		if err == sql.ErrNoRows {
 			writeJSONError(w, http.StatusNotFound, "issue not found")
 			return
@@ -296,11 +320,20 @@ func (s *Server) handleAPIIssueCommentCreate(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
+	sub := spam.Submission{Kind: spam.KindComment, Target: idStr, Content: content}
+	if id, held, err := s.holdForModeration(r, sub, moderationPayload{}); err != nil {
+		writeJSONError(w, http.StatusInternalServerError, "failed to create comment")
+		return
+	} else if held {
+		writeJSON(w, http.StatusAccepted, APIModerationHeld{Status: "awaiting moderation", ID: id})
+		return
+	}
+
 	user := middleware.GetUser(r)
 	authorName := user.GetName()
 	authorEmail := user.GetEmail()
 	if authorName == "" {
-		authorName = "Anonymous"
+		authorName = s.getAuthor(r).Name
 	}
 
 	now := time.Now()
@@ -316,6 +349,7 @@ func (s *Server) handleAPIIssueCommentCreate(w http.ResponseWriter, r *http.Requ
 		writeJSONError(w, http.StatusInternalServerError, "failed to create comment")
 		return
 	}
+	s.notifyMentions(ctx, issue, comment.ID, content, storage.Author{Name: authorName, Email: authorEmail})
 
 	writeJSON(w, http.StatusCreated, issueCommentToAPI(&comment))
 }
@@ -1,16 +1,21 @@
 package handlers
 
 import (
+	"errors"
 	"net/http"
 	"strings"
 
+	"github.com/sa/gopherwiki/internal/middleware"
+	"github.com/sa/gopherwiki/internal/renderer"
+	"github.com/sa/gopherwiki/internal/spam"
 	"github.com/sa/gopherwiki/internal/storage"
 	"github.com/sa/gopherwiki/internal/wiki"
 )
 
-// handleAPIPageList handles GET /api/v1/pages -- lists all pages.
+// handleAPIPageList handles GET /api/v1/pages -- lists all pages with the
+// metadata of their last commit.
 func (s *Server) handleAPIPageList(w http.ResponseWriter, r *http.Request) {
-	entries, err := s.Wiki.PageIndex(r.Context())
+	entries, err := s.Wiki.PageMetadata(r.Context())
 	if err != nil {
 		writeJSONError(w, http.StatusInternalServerError, "failed to list pages")
 		return
@@ -23,8 +28,45 @@ func (s *Server) handleAPIPageList(w http.ResponseWriter, r *http.Request) {
 	writeJSON(w, http.StatusOK, result)
 }
 
+// handleAPIPageTree handles GET /api/v1/tree -- the nested page hierarchy.
+func (s *Server) handleAPIPageTree(w http.ResponseWriter, r *http.Request) {
+	tree, err := s.Wiki.PageTree(r.Context())
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, "failed to build page tree")
+		return
+	}
+	writeJSON(w, http.StatusOK, pageTreeToAPI(tree))
+}
+
+// Number of pages the link completion API returns, by default and at most.
+const (
+	defaultPageCompletions = 10
+	maxPageCompletions     = 50
+)
+
+// handleAPIPageCompletions handles GET /api/v1/autocomplete/pages -- the
+// pages whose path or title matches q, best first, for completing a
+// [[wikilink]] as it is typed.
+func (s *Server) handleAPIPageCompletions(w http.ResponseWriter, r *http.Request) {
+	limit, _, err := parseAPIPagination(r, defaultPageCompletions, maxPageCompletions)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	completions, err := s.Wiki.CompletePages(r.Context(), r.URL.Query().Get("q"), limit)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, "failed to list pages")
+		return
+	}
+	result := make([]APIPageCompletion, 0, len(completions))
+	for _, c := range completions {
+		result = append(result, APIPageCompletion{Path: c.Path, Title: c.Title})
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
 // handleAPIPage is the wildcard handler for /api/v1/pages/*.
-// It dispatches to sub-resources (history, backlinks) based on suffix,
+// It dispatches to sub-resources (history, backlinks, links, attachments, toc) based on suffix,
 // or handles the page itself.
 func (s *Server) handleAPIPage(w http.ResponseWriter, r *http.Request) {
 	// Extract the path after /api/v1/pages/
@@ -50,6 +92,26 @@ func (s *Server) handleAPIPage(w http.ResponseWriter, r *http.Request) {
 		pagePath = strings.TrimSuffix(pagePath, "/backlinks")
 		s.handleAPIPageBacklinks(w, r, pagePath)
 		return
+	case strings.HasSuffix(pagePath, "/links"):
+		pagePath = strings.TrimSuffix(pagePath, "/links")
+		s.handleAPIPageLinks(w, r, pagePath)
+		return
+	case strings.HasSuffix(pagePath, "/attachments"):
+		pagePath = strings.TrimSuffix(pagePath, "/attachments")
+		s.handleAPIPageAttachments(w, r, pagePath)
+		return
+	case strings.HasSuffix(pagePath, "/diff"):
+		pagePath = strings.TrimSuffix(pagePath, "/diff")
+		s.handleAPIPageDiff(w, r, pagePath)
+		return
+	case strings.HasSuffix(pagePath, "/toc"):
+		pagePath = strings.TrimSuffix(pagePath, "/toc")
+		s.handleAPIPageTOC(w, r, pagePath)
+		return
+	case strings.HasSuffix(pagePath, "/restore"):
+		pagePath = strings.TrimSuffix(pagePath, "/restore")
+		s.handleAPIPageRestore(w, r, pagePath)
+		return
 	}
 
 	switch r.Method {
@@ -68,7 +130,7 @@ func (s *Server) handleAPIPage(w http.ResponseWriter, r *http.Request) {
 func (s *Server) handleAPIPageGet(w http.ResponseWriter, r *http.Request, pagePath string) {
 	revision := r.URL.Query().Get("revision")
 
-	page, err := wiki.NewPage(s.Storage, s.Config, pagePath, revision)
+	page, err := wiki.NewPage(r.Context(), s.Storage, s.Config, pagePath, revision)
 	if err != nil {
 		writeJSONError(w, http.StatusInternalServerError, "failed to load page")
 		return
@@ -80,12 +142,9 @@ func (s *Server) handleAPIPageGet(w http.ResponseWriter, r *http.Request, pagePa
 	}
 
 	// ETag support
-	if page.Metadata != nil && page.Metadata.RevisionFull != "" {
-		etag := `"` + page.Metadata.RevisionFull + `"`
-		w.Header().Set("ETag", etag)
+	if etag := apiPageETag(page); etag != "" {
 		w.Header().Set("Cache-Control", "no-cache")
-		if match := r.Header.Get("If-None-Match"); match == etag {
-			w.WriteHeader(http.StatusNotModified)
+		if notModified(w, r, etag, page.Metadata.Datetime) {
 			return
 		}
 	}
@@ -93,7 +152,41 @@ func (s *Server) handleAPIPageGet(w http.ResponseWriter, r *http.Request, pagePa
 	writeJSON(w, http.StatusOK, pageToAPI(page))
 }
 
-// handleAPIPageSave handles PUT /api/v1/pages/{path} -- create or update page.
+// apiPageETag returns the ETag of a page in the API, its full revision,
+// or "" when it does not exist. PUT and DELETE take it in If-Match.
+func apiPageETag(page *wiki.Page) string {
+	if !page.Exists || page.Metadata == nil || page.Metadata.RevisionFull == "" {
+		return ""
+	}
+	return `"` + page.Metadata.RevisionFull + `"`
+}
+
+// checkIfMatch loads the page a write is for when the request has an
+// If-Match header and writes 412 Precondition Failed when the header rules
+// the write out. It returns the page's current revision, for the write to
+// check again as it saves, and whether to go ahead.
+func (s *Server) checkIfMatch(w http.ResponseWriter, r *http.Request, pagePath string) (string, bool) {
+	if r.Header.Get("If-Match") == "" {
+		return "", true
+	}
+	page, err := wiki.NewPage(r.Context(), s.Storage, s.Config, pagePath, "")
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, "failed to load page")
+		return "", false
+	}
+	if preconditionFailed(r, apiPageETag(page)) {
+		writeJSONError(w, http.StatusPreconditionFailed, "precondition failed: page was modified or does not exist")
+		return "", false
+	}
+	if page.Metadata == nil {
+		return "", true
+	}
+	return page.Metadata.Revision, true
+}
+
+// handleAPIPageSave handles PUT /api/v1/pages/{path} -- create or update
+// page. An If-Match header with the page's ETag makes the save conditional,
+// like the revision field but whatever the edit conflict mode.
 func (s *Server) handleAPIPageSave(w http.ResponseWriter, r *http.Request, pagePath string) {
 	var input APISavePage
 	if err := decodeJSON(r, &input); err != nil {
@@ -101,21 +194,73 @@ func (s *Server) handleAPIPageSave(w http.ResponseWriter, r *http.Request, pageP
 		return
 	}
 
+	revision, base := input.Revision, s.conflictBase(r, input.Revision)
+	conditional := r.Header.Get("If-Match") != ""
+	if conditional {
+		current, ok := s.checkIfMatch(w, r, pagePath)
+		if !ok {
+			return
+		}
+		revision, base = current, current
+	}
+
 	author := s.getAuthor(r)
 
-	result, err := s.Wiki.SavePage(r.Context(), pagePath, input.Content, input.Message, input.Revision, author)
+	if input.Template != "" {
+		if input.Content != "" {
+			writeJSONError(w, http.StatusBadRequest, "content and template are mutually exclusive")
+			return
+		}
+		page, err := wiki.NewPage(r.Context(), s.Storage, s.Config, pagePath, "")
+		if err != nil {
+			writeJSONError(w, http.StatusInternalServerError, "failed to load page")
+			return
+		}
+		if page.Exists {
+			writeJSONError(w, http.StatusConflict, "page already exists; a template only applies to a new page")
+			return
+		}
+		input.Content, err = s.Wiki.ApplyTemplate(r.Context(), input.Template, s.templateVars(r, page))
+		if errors.Is(err, wiki.ErrTemplateNotFound) {
+			writeJSONError(w, http.StatusBadRequest, "page template not found")
+			return
+		}
+		if err != nil {
+			writeJSONError(w, http.StatusInternalServerError, "failed to apply page template")
+			return
+		}
+	}
+
+	sub := spam.Submission{Kind: spam.KindPage, Target: pagePath, Content: input.Content}
+	if id, held, err := s.holdForModeration(r, sub, moderationPayload{Message: input.Message, Revision: revision}); err != nil {
+		writeJSONError(w, http.StatusInternalServerError, "failed to save page")
+		return
+	} else if held {
+		writeJSON(w, http.StatusAccepted, APIModerationHeld{Status: "awaiting moderation", ID: id})
+		return
+	}
+
+	result, err := s.Wiki.SavePage(r.Context(), pagePath, input.Content, input.Message, base, author)
+	if errors.Is(err, wiki.ErrSaveRejected) {
+		writeJSONError(w, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
 	if err != nil {
 		writeJSONError(w, http.StatusInternalServerError, "failed to save page")
 		return
 	}
 
+	if result.Conflict && conditional {
+		writeJSONError(w, http.StatusPreconditionFailed, "precondition failed: page was modified or does not exist")
+		return
+	}
 	if result.Conflict {
 		writeJSONError(w, http.StatusConflict, "edit conflict: page was modified since your revision")
 		return
 	}
 
 	// Reload page to get updated metadata
-	updated, err := wiki.NewPage(s.Storage, s.Config, pagePath, "")
+	updated, err := wiki.NewPage(r.Context(), s.Storage, s.Config, pagePath, "")
 	if err != nil {
 		writeJSONError(w, http.StatusInternalServerError, "page saved but failed to reload")
 		return
@@ -125,11 +270,72 @@ func (s *Server) handleAPIPageSave(w http.ResponseWriter, r *http.Request, pageP
 	if result.IsNew {
 		status = http.StatusCreated
 	}
+	if etag := apiPageETag(updated); etag != "" {
+		w.Header().Set("ETag", etag)
+	}
 	writeJSON(w, status, pageToAPI(updated))
 }
 
-// handleAPIPageDelete handles DELETE /api/v1/pages/{path} -- delete page.
+// handleAPIPageRestore handles POST /api/v1/pages/{path}/restore -- save
+// the content of a past revision as the page's new version.
+func (s *Server) handleAPIPageRestore(w http.ResponseWriter, r *http.Request, pagePath string) {
+	if r.Method != http.MethodPost {
+		writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	var input APIRestorePage
+	if err := decodeJSON(r, &input); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "invalid JSON body")
+		return
+	}
+	if input.Revision == "" {
+		writeJSONError(w, http.StatusBadRequest, "revision required")
+		return
+	}
+
+	if id, held, err := s.holdRestore(r, pagePath, input.Revision, input.Message); errors.Is(err, storage.ErrNotFound) {
+		writeJSONError(w, http.StatusNotFound, "page not found at revision")
+		return
+	} else if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, "failed to restore page")
+		return
+	} else if held {
+		writeJSON(w, http.StatusAccepted, APIModerationHeld{Status: "awaiting moderation", ID: id})
+		return
+	}
+
+	result, err := s.Wiki.RestorePage(r.Context(), pagePath, input.Revision, input.Message, s.getAuthor(r))
+	if errors.Is(err, storage.ErrNotFound) {
+		writeJSONError(w, http.StatusNotFound, "page not found at revision")
+		return
+	}
+	if errors.Is(err, wiki.ErrSaveRejected) {
+		writeJSONError(w, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, "failed to restore page")
+		return
+	}
+
+	updated, err := wiki.NewPage(r.Context(), s.Storage, s.Config, result.Page.Pagepath, "")
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, "page restored but failed to reload")
+		return
+	}
+	writeJSON(w, http.StatusOK, pageToAPI(updated))
+}
+
+// handleAPIPageDelete handles DELETE /api/v1/pages/{path} -- delete page,
+// if it is still at the revision of an If-Match header.
 func (s *Server) handleAPIPageDelete(w http.ResponseWriter, r *http.Request, pagePath string) {
+	if s.needsReview(middleware.GetUser(r)) {
+		writeJSONError(w, http.StatusForbidden, unreviewableMessage)
+		return
+	}
+	if _, ok := s.checkIfMatch(w, r, pagePath); !ok {
+		return
+	}
 	author := s.getAuthor(r)
 
 	if err := s.Wiki.DeletePage(r.Context(), pagePath, "", author); err != nil {
@@ -144,9 +350,21 @@ func (s *Server) handleAPIPageDelete(w http.ResponseWriter, r *http.Request, pag
 	writeJSON(w, http.StatusOK, map[string]bool{"deleted": true})
 }
 
-// handleAPIPageHistory handles GET /api/v1/pages/{path}/history.
+// handleAPIPageHistory handles GET /api/v1/pages/{path}/history, filtered
+// and paginated as the changelog is.
 func (s *Server) handleAPIPageHistory(w http.ResponseWriter, r *http.Request, pagePath string) {
-	page, err := wiki.NewPage(s.Storage, s.Config, pagePath, "")
+	query, err := parseLogFilters(r)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	query.Limit, query.Offset, err = parseAPIPagination(r, 100, 500)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	page, err := wiki.NewPage(r.Context(), s.Storage, s.Config, pagePath, "")
 	if err != nil {
 		writeJSONError(w, http.StatusInternalServerError, "failed to load page")
 		return
@@ -157,7 +375,7 @@ func (s *Server) handleAPIPageHistory(w http.ResponseWriter, r *http.Request, pa
 		return
 	}
 
-	log, err := page.History(0)
+	log, err := page.QueryHistory(r.Context(), query)
 	if err != nil {
 		writeJSONError(w, http.StatusInternalServerError, "failed to get history")
 		return
@@ -180,6 +398,83 @@ func (s *Server) handleAPIPageBacklinks(w http.ResponseWriter, r *http.Request,
 	writeJSON(w, http.StatusOK, backlinks)
 }
 
+// handleAPIPageLinks handles GET /api/v1/pages/{path}/links -- the pages
+// the page links to, whether they exist or not.
+func (s *Server) handleAPIPageLinks(w http.ResponseWriter, r *http.Request, pagePath string) {
+	links, err := s.Wiki.Links(r.Context(), pagePath)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, "failed to get links")
+		return
+	}
+
+	if links == nil {
+		links = []string{}
+	}
+	writeJSON(w, http.StatusOK, links)
+}
+
+// handleAPIPageTOC handles GET /api/v1/pages/{path}/toc -- the page's table
+// of contents, as shown beside the page view.
+func (s *Server) handleAPIPageTOC(w http.ResponseWriter, r *http.Request, pagePath string) {
+	page, err := wiki.NewPage(r.Context(), s.Storage, s.Config, pagePath, r.URL.Query().Get("revision"))
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, "failed to load page")
+		return
+	}
+	if !page.Exists {
+		writeJSONError(w, http.StatusNotFound, "page not found")
+		return
+	}
+
+	_, toc, _ := page.Render(s.Renderer)
+	writeJSON(w, http.StatusOK, apiTOC(toc))
+}
+
+// apiTOC converts a table of contents to its JSON representation.
+func apiTOC(toc []renderer.TOCEntry) []APITOCEntry {
+	result := make([]APITOCEntry, 0, len(toc))
+	for _, entry := range toc {
+		result = append(result, APITOCEntry{
+			Level:  entry.Level,
+			Text:   entry.Text,
+			Anchor: entry.Anchor,
+			Number: entry.Number,
+		})
+	}
+	return result
+}
+
+// handleAPIRender handles POST /api/v1/render -- Markdown rendered as the
+// editor's preview renders it, with its table of contents and the scripts
+// it needs. Nothing is stored.
+func (s *Server) handleAPIRender(w http.ResponseWriter, r *http.Request) {
+	var input APIRender
+	if err := decodeJSON(r, &input); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "invalid JSON body")
+		return
+	}
+
+	pageURL := "/"
+	if input.Path != "" {
+		page, err := wiki.NewPage(r.Context(), s.Storage, s.Config, input.Path, "")
+		if err != nil {
+			writeJSONError(w, http.StatusBadRequest, "invalid page path")
+			return
+		}
+		pageURL = page.PageViewURL
+	}
+
+	htmlContent, toc, libRequirements := s.Renderer.RenderFor(input.Content, pageURL, s.PermissionChecker.PageFilter(r))
+	writeJSON(w, http.StatusOK, APIRendered{
+		HTML: htmlContent,
+		TOC:  apiTOC(toc),
+		LibraryRequirements: APILibraryRequirements{
+			RequiresMermaid: libRequirements.RequiresMermaid,
+			RequiresMathJax: libRequirements.RequiresMathJax,
+		},
+	})
+}
+
 // handleAPISearch handles GET /api/v1/search?q=...
 func (s *Server) handleAPISearch(w http.ResponseWriter, r *http.Request) {
 	query := r.URL.Query().Get("q")
@@ -202,8 +497,21 @@ func (s *Server) handleAPISearch(w http.ResponseWriter, r *http.Request) {
 }
 
 // handleAPIChangelog handles GET /api/v1/changelog.
+// Supports the author, path, since, and until filters plus limit/offset
+// pagination.
 func (s *Server) handleAPIChangelog(w http.ResponseWriter, r *http.Request) {
-	changelog, err := s.Wiki.Changelog(r.Context(), 100)
+	query, err := parseLogFilters(r)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	query.Limit, query.Offset, err = parseAPIPagination(r, 100, 500)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	changelog, err := s.Wiki.QueryChangelog(r.Context(), query)
 	if err != nil {
 		writeJSONError(w, http.StatusInternalServerError, "failed to get changelog")
 		return
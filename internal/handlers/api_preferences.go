@@ -0,0 +1,258 @@
+package handlers
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/sa/gopherwiki/internal/cluster"
+	"github.com/sa/gopherwiki/internal/db"
+	"github.com/sa/gopherwiki/internal/middleware"
+	"github.com/sa/gopherwiki/internal/settings"
+)
+
+// APIPreferences is the JSON representation of the settings an admin can
+// change at runtime, as on the admin settings page.
+type APIPreferences struct {
+	SiteName            string   `json:"site_name"`
+	SiteLogo            string   `json:"site_logo"`
+	IssueTags           []string `json:"issue_tags"`
+	IssueCategories     []string `json:"issue_categories"`
+	ReadAccess          string   `json:"read_access"`
+	WriteAccess         string   `json:"write_access"`
+	AttachmentAccess    string   `json:"attachment_access"`
+	DisableRegistration bool     `json:"disable_registration"`
+	HomePage            string   `json:"home_page"`
+	SiteURL             string   `json:"site_url"`
+	EditConflictMode    string   `json:"edit_conflict_mode"`
+	Theme               string   `json:"theme"`
+	DisableFeeds        bool     `json:"disable_feeds"`
+	DisableSitemap      bool     `json:"disable_sitemap"`
+}
+
+// APIPreferencesInput is the JSON request body for changing settings;
+// omitted fields are kept.
+type APIPreferencesInput struct {
+	SiteName            *string  `json:"site_name"`
+	SiteLogo            *string  `json:"site_logo"`
+	IssueTags           []string `json:"issue_tags"`
+	IssueCategories     []string `json:"issue_categories"`
+	ReadAccess          *string  `json:"read_access"`
+	WriteAccess         *string  `json:"write_access"`
+	AttachmentAccess    *string  `json:"attachment_access"`
+	DisableRegistration *bool    `json:"disable_registration"`
+	HomePage            *string  `json:"home_page"`
+	SiteURL             *string  `json:"site_url"`
+	EditConflictMode    *string  `json:"edit_conflict_mode"`
+	Theme               *string  `json:"theme"`
+	DisableFeeds        *bool    `json:"disable_feeds"`
+	DisableSitemap      *bool    `json:"disable_sitemap"`
+}
+
+// adminPreferences returns the current settings.
+func (s *Server) adminPreferences(r *http.Request) APIPreferences {
+	ctx := r.Context()
+	site := s.getSiteSettings(ctx)
+	current := s.Settings.Get(ctx)
+	tags := s.getAvailableTags(ctx)
+	categories := s.getAvailableCategories(ctx)
+	if tags == nil {
+		tags = []string{}
+	}
+	if categories == nil {
+		categories = []string{}
+	}
+	return APIPreferences{
+		SiteName:            site.Name,
+		SiteLogo:            site.Logo,
+		IssueTags:           tags,
+		IssueCategories:     categories,
+		ReadAccess:          current.ReadAccess,
+		WriteAccess:         current.WriteAccess,
+		AttachmentAccess:    current.AttachmentAccess,
+		DisableRegistration: current.DisableRegistration,
+		HomePage:            current.HomePage,
+		SiteURL:             current.SiteURL,
+		EditConflictMode:    current.EditConflictMode,
+		Theme:               current.Theme,
+		DisableFeeds:        current.DisableFeeds,
+		DisableSitemap:      current.DisableSitemap,
+	}
+}
+
+// handleAPIPreferencesAdmin handles GET /api/v1/admin/preferences.
+func (s *Server) handleAPIPreferencesAdmin(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.adminPreferences(r))
+}
+
+// handleAPIPreferencesAdminUpdate handles PUT /api/v1/admin/preferences --
+// change the settings of the admin settings page. Every field is validated
+// before any is saved, and the names of the changed settings are recorded
+// in the audit log.
+func (s *Server) handleAPIPreferencesAdminUpdate(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	var input APIPreferencesInput
+	if err := decodeJSON(r, &input); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "invalid JSON")
+		return
+	}
+
+	before := s.adminPreferences(r)
+	after := before
+	setString := func(dst *string, src *string) {
+		if src != nil {
+			*dst = strings.TrimSpace(*src)
+		}
+	}
+	setBool := func(dst *bool, src *bool) {
+		if src != nil {
+			*dst = *src
+		}
+	}
+	setString(&after.SiteName, input.SiteName)
+	setString(&after.SiteLogo, input.SiteLogo)
+	setString(&after.ReadAccess, input.ReadAccess)
+	setString(&after.WriteAccess, input.WriteAccess)
+	setString(&after.AttachmentAccess, input.AttachmentAccess)
+	setBool(&after.DisableRegistration, input.DisableRegistration)
+	setString(&after.HomePage, input.HomePage)
+	setString(&after.SiteURL, input.SiteURL)
+	after.SiteURL = strings.TrimRight(after.SiteURL, "/")
+	setString(&after.EditConflictMode, input.EditConflictMode)
+	setString(&after.Theme, input.Theme)
+	setBool(&after.DisableFeeds, input.DisableFeeds)
+	setBool(&after.DisableSitemap, input.DisableSitemap)
+
+	var err error
+	if input.IssueTags != nil {
+		if after.IssueTags, err = cleanPreferenceList("issue tag", input.IssueTags); err != nil {
+			writeJSONError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+	if input.IssueCategories != nil {
+		if after.IssueCategories, err = cleanPreferenceList("issue category", input.IssueCategories); err != nil {
+			writeJSONError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+
+	if after.SiteName == "" {
+		writeJSONError(w, http.StatusBadRequest, "site name must not be empty")
+		return
+	}
+	next := settings.Settings{
+		ReadAccess:          after.ReadAccess,
+		WriteAccess:         after.WriteAccess,
+		AttachmentAccess:    after.AttachmentAccess,
+		DisableRegistration: after.DisableRegistration,
+		HomePage:            after.HomePage,
+		SiteURL:             after.SiteURL,
+		EditConflictMode:    after.EditConflictMode,
+		Theme:               after.Theme,
+		DisableFeeds:        after.DisableFeeds,
+		DisableSitemap:      after.DisableSitemap,
+	}
+	if err := next.Validate(); err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if after.Theme != before.Theme && !slices.Contains(s.ThemeNames(), after.Theme) {
+		writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("theme %q is not installed", after.Theme))
+		return
+	}
+
+	changed := changedPreferences(before, after)
+	if len(changed) == 0 {
+		writeJSON(w, http.StatusOK, before)
+		return
+	}
+
+	if next != s.Settings.Get(ctx) {
+		if err := s.Settings.Save(ctx, next); err != nil {
+			slog.Error("failed to save settings", "error", err)
+			writeJSONError(w, http.StatusInternalServerError, "failed to save settings")
+			return
+		}
+	}
+	// Only changed preferences are stored, so that the others keep
+	// following the configuration.
+	prefs := map[string]string{
+		"site_name":                  after.SiteName,
+		"site_logo":                  after.SiteLogo,
+		issueTagsPreferenceKey:       strings.Join(after.IssueTags, ","),
+		issueCategoriesPreferenceKey: strings.Join(after.IssueCategories, ","),
+	}
+	for name, value := range prefs {
+		if !slices.Contains(changed, name) {
+			continue
+		}
+		pref := db.UpsertPreferenceParams{Name: name, Value: db.NullString(value)}
+		if err := s.DB.Queries.UpsertPreference(ctx, pref); err != nil {
+			slog.Error("failed to save preference", "name", pref.Name, "error", err)
+			writeJSONError(w, http.StatusInternalServerError, "failed to save settings")
+			return
+		}
+	}
+	s.InvalidateSiteSettingsCache()
+	s.publish(ctx, cluster.TopicSettings)
+
+	actor := s.getAuthor(r)
+	entry := db.AuditEntry{
+		Action:     "settings.update",
+		Detail:     strings.Join(changed, ", "),
+		ActorName:  actor.Name,
+		ActorEmail: actor.Email,
+		CreatedAt:  time.Now(),
+	}
+	if err := s.DB.AddAuditEntry(ctx, nil, entry); err != nil {
+		slog.Error("failed to record settings change", "error", err)
+	}
+	slog.Info("settings updated", "user", middleware.GetUser(r).GetEmail(), "changed", changed)
+	writeJSON(w, http.StatusOK, s.adminPreferences(r))
+}
+
+// cleanPreferenceList trims the entries of a list setting, dropping empty
+// ones. Lists are stored comma-separated, so entries cannot contain commas.
+func cleanPreferenceList(name string, entries []string) ([]string, error) {
+	result := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if strings.Contains(entry, ",") {
+			return nil, fmt.Errorf("%s %q must not contain a comma", name, entry)
+		}
+		if entry != "" {
+			result = append(result, entry)
+		}
+	}
+	return result, nil
+}
+
+// changedPreferences returns the JSON names of the settings that differ
+// between before and after.
+func changedPreferences(before, after APIPreferences) []string {
+	var changed []string
+	check := func(name string, differ bool) {
+		if differ {
+			changed = append(changed, name)
+		}
+	}
+	check("site_name", before.SiteName != after.SiteName)
+	check("site_logo", before.SiteLogo != after.SiteLogo)
+	check("issue_tags", !slices.Equal(before.IssueTags, after.IssueTags))
+	check("issue_categories", !slices.Equal(before.IssueCategories, after.IssueCategories))
+	check("read_access", before.ReadAccess != after.ReadAccess)
+	check("write_access", before.WriteAccess != after.WriteAccess)
+	check("attachment_access", before.AttachmentAccess != after.AttachmentAccess)
+	check("disable_registration", before.DisableRegistration != after.DisableRegistration)
+	check("home_page", before.HomePage != after.HomePage)
+	check("site_url", before.SiteURL != after.SiteURL)
+	check("edit_conflict_mode", before.EditConflictMode != after.EditConflictMode)
+	check("theme", before.Theme != after.Theme)
+	check("disable_feeds", before.DisableFeeds != after.DisableFeeds)
+	check("disable_sitemap", before.DisableSitemap != after.DisableSitemap)
+	return changed
+}
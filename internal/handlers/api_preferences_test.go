@@ -0,0 +1,98 @@
+package handlers_test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/sa/gopherwiki/internal/testutil"
+)
+
+func TestAPIAdminPreferences(t *testing.T) {
+	env := testutil.SetupTestEnv(t)
+	ctx := context.Background()
+	cookies := loginAsAdmin(t, env)
+
+	w := apiGet(t, env, "/-/api/v1/admin/preferences", cookies)
+	if w.Code != http.StatusOK {
+		t.Fatalf("get status = %d, want %d", w.Code, http.StatusOK)
+	}
+	data := parseAPIResponse(t, w)["data"].(map[string]interface{})
+	if data["site_name"] != env.Server.Config.SiteName || data["read_access"] != env.Server.Config.ReadAccess {
+		t.Errorf("preferences = %v, want the configured settings", data)
+	}
+
+	body := `{"site_name":" API Wiki ","issue_tags":["bug"," docs ",""],"write_access":"APPROVED","disable_feeds":true}`
+	w = apiRequest(t, env, "PUT", "/-/api/v1/admin/preferences", body, cookies)
+	if w.Code != http.StatusOK {
+		t.Fatalf("update status = %d, want %d\nbody: %s", w.Code, http.StatusOK, w.Body.String())
+	}
+	data = parseAPIResponse(t, w)["data"].(map[string]interface{})
+	if data["site_name"] != "API Wiki" || data["write_access"] != "APPROVED" || data["disable_feeds"] != true {
+		t.Errorf("updated preferences = %v", data)
+	}
+	if tags := data["issue_tags"].([]interface{}); len(tags) != 2 || tags[0] != "bug" || tags[1] != "docs" {
+		t.Errorf("issue_tags = %v, want [bug docs]", tags)
+	}
+	if got := env.Server.Settings.Get(ctx); got.WriteAccess != "APPROVED" || !got.DisableFeeds || got.ReadAccess != env.Server.Config.ReadAccess {
+		t.Errorf("settings = %+v", got)
+	}
+
+	// Unchanged settings keep following the configuration.
+	if _, err := env.DB.Queries.GetPreference(ctx, "issue_categories"); err == nil {
+		t.Error("unchanged issue_categories should not be stored")
+	}
+
+	entries, err := env.DB.ListAuditEntries(ctx, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Action != "settings.update" || entries[0].Detail != "site_name, issue_tags, write_access, disable_feeds" {
+		t.Errorf("audit entries = %+v", entries)
+	}
+
+	// Invalid values are rejected and nothing is saved.
+	for _, body := range []string{
+		`{"read_access":"EVERYONE"}`,
+		`{"site_url":"ftp://example.com"}`,
+		`{"theme":"missing"}`,
+		`{"site_name":""}`,
+		`{"issue_categories":["a,b"]}`,
+		`{"site_logo":"/logo.png","edit_conflict_mode":"merge"}`,
+		`not json`,
+	} {
+		if w := apiRequest(t, env, "PUT", "/-/api/v1/admin/preferences", body, cookies); w.Code != http.StatusBadRequest {
+			t.Errorf("PUT %s: status = %d, want %d", body, w.Code, http.StatusBadRequest)
+		}
+	}
+	data = parseAPIResponse(t, apiGet(t, env, "/-/api/v1/admin/preferences", cookies))["data"].(map[string]interface{})
+	if data["site_logo"] != env.Server.Config.SiteLogo {
+		t.Errorf("site_logo = %v after a rejected change", data["site_logo"])
+	}
+	if entries, _ := env.DB.ListAuditEntries(ctx, 10); len(entries) != 1 {
+		t.Errorf("rejected changes were audited: %+v", entries)
+	}
+
+	// A change to nothing is not audited.
+	if w := apiRequest(t, env, "PUT", "/-/api/v1/admin/preferences", `{"site_name":"API Wiki"}`, cookies); w.Code != http.StatusOK {
+		t.Errorf("no-op update status = %d, want %d", w.Code, http.StatusOK)
+	}
+	if entries, _ := env.DB.ListAuditEntries(ctx, 10); len(entries) != 1 {
+		t.Errorf("a no-op change was audited: %+v", entries)
+	}
+}
+
+func TestAPIAdminPreferences_Unauthorized(t *testing.T) {
+	env := testutil.SetupTestEnv(t)
+
+	if w := apiGet(t, env, "/-/api/v1/admin/preferences", nil); w.Code != http.StatusUnauthorized {
+		t.Errorf("anonymous: status = %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+	cookies := loginAsUser(t, env, "regular@example.com")
+	if w := apiRequest(t, env, "PUT", "/-/api/v1/admin/preferences", `{"site_name":"Mine"}`, cookies); w.Code != http.StatusForbidden {
+		t.Errorf("non-admin: status = %d, want %d", w.Code, http.StatusForbidden)
+	}
+	if _, err := env.DB.Queries.GetPreference(context.Background(), "site_name"); err == nil {
+		t.Error("site name saved for a non-admin")
+	}
+}
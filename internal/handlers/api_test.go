@@ -1,6 +1,7 @@
 package handlers_test
 
 import (
+	"bytes"
 	"context"
 	"database/sql"
 	"encoding/json"
@@ -12,6 +13,7 @@ import (
 	"time"
 
 	"github.com/sa/gopherwiki/internal/db"
+	"github.com/sa/gopherwiki/internal/handlers"
 	"github.com/sa/gopherwiki/internal/storage"
 	"github.com/sa/gopherwiki/internal/testutil"
 )
@@ -103,8 +105,8 @@ func createTestComment(t *testing.T, env *testutil.TestEnv, issueID int64, conte
 func TestAPIPageList(t *testing.T) {
 	env := testutil.SetupTestEnv(t)
 
-	env.Store.Store("alpha.md", "# Alpha", "init", storage.Author{Name: "test", Email: "test@test.com"})
-	env.Store.Store("beta.md", "# Beta", "init", storage.Author{Name: "test", Email: "test@test.com"})
+	env.Store.Store(context.Background(), "alpha.md", "# Alpha", "init", storage.Author{Name: "test", Email: "test@test.com"})
+	env.Store.Store(context.Background(), "beta.md", "# Beta", "init", storage.Author{Name: "test", Email: "test@test.com"})
 
 	w := apiGet(t, env, "/-/api/v1/pages", nil)
 
@@ -118,14 +120,87 @@ func TestAPIPageList(t *testing.T) {
 		t.Fatalf("data should be an array, got %T", resp["data"])
 	}
 	if len(data) != 2 {
-		t.Errorf("expected 2 pages, got %d", len(data))
+		t.Fatalf("expected 2 pages, got %d", len(data))
+	}
+	alpha := data[0].(map[string]interface{})
+	if alpha["path"] != "alpha" || alpha["title"] != "Alpha" || alpha["author_name"] != "test" ||
+		alpha["size"] != float64(len("# Alpha")) || len(alpha["revision"].(string)) != 6 || alpha["updated"] == "" {
+		t.Errorf("first page = %v; want alpha with its title, last commit, and size", alpha)
+	}
+}
+
+func TestAPIPageTree(t *testing.T) {
+	env := testutil.SetupTestEnv(t)
+	author := storage.Author{Name: "test", Email: "test@test.com"}
+	env.Store.Store(context.Background(), "home.md", "# Welcome Home", "init", author)
+	env.Store.Store(context.Background(), "guides/setup.md", "---\ntitle: Setting Up\n---\nSteps.", "init", author)
+	if _, err := env.Server.Wiki.RebuildSearchIndex(context.Background()); err != nil {
+		t.Fatalf("RebuildSearchIndex: %v", err)
+	}
+
+	w := apiGet(t, env, "/-/api/v1/tree", nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusOK)
+	}
+	var resp struct {
+		Data []handlers.APIPageTreeNode `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(resp.Data) != 2 {
+		t.Fatalf("top level = %+v, want guides and home", resp.Data)
+	}
+	guides, home := resp.Data[0], resp.Data[1]
+	if guides.Path != "guides" || guides.IsPage || len(guides.Children) != 1 {
+		t.Errorf("guides = %+v, want a directory holding one page", guides)
+	} else if child := guides.Children[0]; child.Path != "guides/setup" || child.Title != "Setting Up" || !child.IsPage {
+		t.Errorf("guides/setup = %+v, want the page titled by its frontmatter", child)
+	}
+	if home.Title != "Welcome Home" || !home.IsPage || home.Children != nil {
+		t.Errorf("home = %+v, want the page titled by its heading", home)
+	}
+}
+
+func TestAPIPageCompletions(t *testing.T) {
+	env := testutil.SetupTestEnv(t)
+	author := storage.Author{Name: "test", Email: "test@test.com"}
+	env.Store.Store(context.Background(), "setup.md", "# Setting Up", "init", author)
+	env.Store.Store(context.Background(), "guides/setup.md", "# Setup Guide", "init", author)
+	env.Store.Store(context.Background(), "backup.md", "# Backups", "init", author)
+
+	w := apiGet(t, env, "/-/api/v1/autocomplete/pages?q=SET", nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusOK)
+	}
+	data := parseAPIResponse(t, w)["data"].([]interface{})
+	if len(data) != 2 {
+		t.Fatalf("expected 2 completions, got %v", data)
+	}
+	first := data[0].(map[string]interface{})
+	if first["path"] != "setup" || first["title"] != "Setting Up" || data[1].(map[string]interface{})["path"] != "guides/setup" {
+		t.Errorf("completions = %v; want setup, then guides/setup", data)
+	}
+
+	data = parseAPIResponse(t, apiGet(t, env, "/-/api/v1/autocomplete/pages?limit=1", nil))["data"].([]interface{})
+	if len(data) != 1 {
+		t.Errorf("expected 1 completion with limit=1, got %v", data)
+	}
+	if w := apiGet(t, env, "/-/api/v1/autocomplete/pages?limit=x", nil); w.Code != http.StatusBadRequest {
+		t.Errorf("invalid limit: status = %d, want %d", w.Code, http.StatusBadRequest)
+	}
+
+	// The editor lists pages to link to, with the completion panel.
+	w = apiGet(t, env, "/backup/edit", nil)
+	if body := w.Body.String(); !strings.Contains(body, `<option value="guides/setup" label="Setup Guide">`) || !strings.Contains(body, `id="wikilink"`) {
+		t.Errorf("editor lacks the page list:\n%s", body)
 	}
 }
 
 func TestAPIPageGet(t *testing.T) {
 	env := testutil.SetupTestEnv(t)
 
-	env.Store.Store("hello.md", "# Hello World\n\nContent here.", "created hello", storage.Author{Name: "test", Email: "test@test.com"})
+	env.Store.Store(context.Background(), "hello.md", "# Hello World\n\nContent here.", "created hello", storage.Author{Name: "test", Email: "test@test.com"})
 
 	w := apiGet(t, env, "/-/api/v1/pages/hello", nil)
 
@@ -168,11 +243,11 @@ func TestAPIPageGet_NotFound(t *testing.T) {
 func TestAPIPageGet_WithRevision(t *testing.T) {
 	env := testutil.SetupTestEnv(t)
 
-	env.Store.Store("versioned.md", "# Version 1", "v1", storage.Author{Name: "test", Email: "test@test.com"})
-	meta, _ := env.Store.Metadata("versioned.md", "")
+	env.Store.Store(context.Background(), "versioned.md", "# Version 1", "v1", storage.Author{Name: "test", Email: "test@test.com"})
+	meta, _ := env.Store.Metadata(context.Background(), "versioned.md", "")
 	rev1 := meta.Revision
 
-	env.Store.Store("versioned.md", "# Version 2", "v2", storage.Author{Name: "test", Email: "test@test.com"})
+	env.Store.Store(context.Background(), "versioned.md", "# Version 2", "v2", storage.Author{Name: "test", Email: "test@test.com"})
 
 	// Get at specific revision
 	w := apiGet(t, env, "/-/api/v1/pages/versioned?revision="+rev1, nil)
@@ -192,7 +267,7 @@ func TestAPIPageGet_WithRevision(t *testing.T) {
 func TestAPIPageGet_ETag(t *testing.T) {
 	env := testutil.SetupTestEnv(t)
 
-	env.Store.Store("etagapi.md", "# ETag Test", "init", storage.Author{Name: "test", Email: "test@test.com"})
+	env.Store.Store(context.Background(), "etagapi.md", "# ETag Test", "init", storage.Author{Name: "test", Email: "test@test.com"})
 
 	// First request to get ETag
 	w1 := apiGet(t, env, "/-/api/v1/pages/etagapi", nil)
@@ -216,6 +291,35 @@ func TestAPIPageGet_ETag(t *testing.T) {
 	}
 }
 
+func TestAPIList_ETag(t *testing.T) {
+	env := testutil.SetupTestEnv(t)
+
+	env.Store.Store(context.Background(), "etaglist.md", "# ETag List", "init", storage.Author{Name: "test", Email: "test@test.com"})
+
+	w1 := apiGet(t, env, "/-/api/v1/pages", nil)
+	etag := w1.Header().Get("ETag")
+	if w1.Code != http.StatusOK || etag == "" {
+		t.Fatalf("status = %d, ETag = %q; want 200 with an ETag", w1.Code, etag)
+	}
+
+	req := httptest.NewRequest("GET", "/-/api/v1/pages", nil)
+	req.Header.Set("If-None-Match", etag)
+	w2 := httptest.NewRecorder()
+	env.Router.ServeHTTP(w2, req)
+	if w2.Code != http.StatusNotModified {
+		t.Errorf("unchanged list: status = %d, want %d", w2.Code, http.StatusNotModified)
+	}
+
+	env.Store.Store(context.Background(), "etaglist2.md", "# Another", "init", storage.Author{Name: "test", Email: "test@test.com"})
+	req = httptest.NewRequest("GET", "/-/api/v1/pages", nil)
+	req.Header.Set("If-None-Match", etag)
+	w3 := httptest.NewRecorder()
+	env.Router.ServeHTTP(w3, req)
+	if w3.Code != http.StatusOK {
+		t.Errorf("changed list: status = %d, want %d", w3.Code, http.StatusOK)
+	}
+}
+
 func TestAPIPageSave_Create(t *testing.T) {
 	env := testutil.SetupTestEnv(t)
 
@@ -233,7 +337,7 @@ func TestAPIPageSave_Create(t *testing.T) {
 	}
 
 	// Verify in storage
-	if !env.Store.Exists("apipage.md") {
+	if !env.Store.Exists(context.Background(), "apipage.md") {
 		t.Error("page should exist in storage")
 	}
 }
@@ -241,8 +345,8 @@ func TestAPIPageSave_Create(t *testing.T) {
 func TestAPIPageSave_Update(t *testing.T) {
 	env := testutil.SetupTestEnv(t)
 
-	env.Store.Store("updateme.md", "# Original", "init", storage.Author{Name: "test", Email: "test@test.com"})
-	meta, _ := env.Store.Metadata("updateme.md", "")
+	env.Store.Store(context.Background(), "updateme.md", "# Original", "init", storage.Author{Name: "test", Email: "test@test.com"})
+	meta, _ := env.Store.Metadata(context.Background(), "updateme.md", "")
 
 	body := fmt.Sprintf(`{"content":"# Updated via API","message":"API update","revision":"%s"}`, meta.Revision)
 	w := apiRequest(t, env, "PUT", "/-/api/v1/pages/updateme", body, nil)
@@ -251,21 +355,53 @@ func TestAPIPageSave_Update(t *testing.T) {
 		t.Fatalf("status = %d, want %d\nbody: %s", w.Code, http.StatusOK, w.Body.String())
 	}
 
-	content, _ := env.Store.Load("updateme.md", "")
+	content, _ := env.Store.Load(context.Background(), "updateme.md", "")
 	if !strings.Contains(content, "Updated via API") {
 		t.Errorf("content = %q, should contain 'Updated via API'", content)
 	}
 }
 
+func TestAPIPageRestore(t *testing.T) {
+	env := testutil.SetupTestEnv(t)
+
+	author := storage.Author{Name: "test", Email: "test@test.com"}
+	env.Store.Store(context.Background(), "restoreapi.md", "# Old", "first", author)
+	env.Store.Store(context.Background(), "restoreapi.md", "# New", "second", author)
+	logEntries, _ := env.Store.Log(context.Background(), "restoreapi.md", 0)
+
+	body := fmt.Sprintf(`{"revision":"%s","message":"Back to old"}`, logEntries[1].Revision)
+	w := apiRequest(t, env, "POST", "/-/api/v1/pages/restoreapi/restore", body, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d\nbody: %s", w.Code, http.StatusOK, w.Body.String())
+	}
+	data := parseAPIResponse(t, w)["data"].(map[string]interface{})
+	if data["content"] != "# Old" {
+		t.Errorf("content = %v, want the restored content", data["content"])
+	}
+	if logEntries, _ = env.Store.Log(context.Background(), "restoreapi.md", 0); logEntries[0].Message != "Back to old" {
+		t.Errorf("commit message = %q", logEntries[0].Message)
+	}
+
+	if w := apiRequest(t, env, "POST", "/-/api/v1/pages/restoreapi/restore", `{}`, nil); w.Code != http.StatusBadRequest {
+		t.Errorf("restore without a revision: status = %d, want 400", w.Code)
+	}
+	if w := apiRequest(t, env, "POST", "/-/api/v1/pages/restoreapi/restore", `{"revision":"nosuchrev"}`, nil); w.Code != http.StatusNotFound {
+		t.Errorf("restore of an unknown revision: status = %d, want 404", w.Code)
+	}
+	if w := apiRequest(t, env, "POST", "/-/api/v1/pages/restoreapi", `{}`, nil); w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("POST to a page: status = %d, want 405", w.Code)
+	}
+}
+
 func TestAPIPageSave_Conflict(t *testing.T) {
 	env := testutil.SetupTestEnv(t)
 
-	env.Store.Store("conflict.md", "# Original", "init", storage.Author{Name: "test", Email: "test@test.com"})
-	meta, _ := env.Store.Metadata("conflict.md", "")
+	env.Store.Store(context.Background(), "conflict.md", "# Original", "init", storage.Author{Name: "test", Email: "test@test.com"})
+	meta, _ := env.Store.Metadata(context.Background(), "conflict.md", "")
 	staleRevision := meta.Revision
 
 	// Another user saves
-	env.Store.Store("conflict.md", "# Modified by other", "other edit", storage.Author{Name: "other", Email: "other@test.com"})
+	env.Store.Store(context.Background(), "conflict.md", "# Modified by other", "other edit", storage.Author{Name: "other", Email: "other@test.com"})
 
 	body := fmt.Sprintf(`{"content":"# My conflicting edit","revision":"%s"}`, staleRevision)
 	w := apiRequest(t, env, "PUT", "/-/api/v1/pages/conflict", body, nil)
@@ -280,6 +416,65 @@ func TestAPIPageSave_Conflict(t *testing.T) {
 	}
 }
 
+func TestAPIPage_IfMatch(t *testing.T) {
+	env := testutil.SetupTestEnv(t)
+	ctx := context.Background()
+	env.Store.Store(ctx, "guarded.md", "# Original", "init", storage.Author{Name: "test", Email: "test@test.com"})
+
+	send := func(method, path, body, ifMatch string) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("If-Match", ifMatch)
+		w := httptest.NewRecorder()
+		env.Router.ServeHTTP(w, req)
+		return w
+	}
+
+	etag := apiGet(t, env, "/-/api/v1/pages/guarded", nil).Header().Get("ETag")
+	if etag == "" {
+		t.Fatal("GET should return an ETag")
+	}
+
+	// A matching ETag saves, and the response carries the new one.
+	w := send("PUT", "/-/api/v1/pages/guarded", `{"content":"# Second"}`, etag)
+	if w.Code != http.StatusOK {
+		t.Fatalf("matching If-Match: status = %d, want %d: %s", w.Code, http.StatusOK, w.Body.String())
+	}
+	newETag := w.Header().Get("ETag")
+	if newETag == "" || newETag == etag {
+		t.Errorf("ETag after save = %q, want a new one", newETag)
+	}
+
+	// The old ETag no longer matches, also weakly, whatever the conflict mode.
+	env.Server.Config.EditConflictMode = "overwrite"
+	for _, stale := range []string{etag, "W/" + newETag, `"nope", ` + etag} {
+		if w := send("PUT", "/-/api/v1/pages/guarded", `{"content":"# Lost"}`, stale); w.Code != http.StatusPreconditionFailed {
+			t.Errorf("If-Match %s: status = %d, want %d", stale, w.Code, http.StatusPreconditionFailed)
+		}
+	}
+	if content, _ := env.Store.Load(ctx, "guarded.md", ""); content != "# Second" {
+		t.Errorf("content = %q after failed preconditions", content)
+	}
+	if w := send("PUT", "/-/api/v1/pages/guarded", `{"content":"# Third"}`, `"other", `+newETag); w.Code != http.StatusOK {
+		t.Errorf("If-Match list with the current ETag: status = %d, want %d", w.Code, http.StatusOK)
+	}
+
+	// "*" needs the page to exist.
+	if w := send("PUT", "/-/api/v1/pages/newguarded", `{"content":"# New"}`, "*"); w.Code != http.StatusPreconditionFailed {
+		t.Errorf("If-Match * on a new page: status = %d, want %d", w.Code, http.StatusPreconditionFailed)
+	}
+
+	// DELETE checks it too.
+	if w := send("DELETE", "/-/api/v1/pages/guarded", "", etag); w.Code != http.StatusPreconditionFailed {
+		t.Errorf("stale DELETE: status = %d, want %d", w.Code, http.StatusPreconditionFailed)
+	}
+	current := apiGet(t, env, "/-/api/v1/pages/guarded", nil).Header().Get("ETag")
+	if w := send("DELETE", "/-/api/v1/pages/guarded", "", current); w.Code != http.StatusOK {
+		t.Errorf("DELETE with the current ETag: status = %d, want %d", w.Code, http.StatusOK)
+	}
+}
+
 func TestAPIPageSave_InvalidJSON(t *testing.T) {
 	env := testutil.SetupTestEnv(t)
 
@@ -290,10 +485,47 @@ func TestAPIPageSave_InvalidJSON(t *testing.T) {
 	}
 }
 
+func TestAPIPageSave_Template(t *testing.T) {
+	env := testutil.SetupTestEnv(t)
+	env.Store.Store(context.Background(), "templates/runbook.md", "# Runbook: {{title}}\n\nOwner: {{author}}\n", "init", storage.Author{Name: "test", Email: "test@test.com"})
+	env.Store.Store(context.Background(), "existing.md", "# Existing", "init", storage.Author{Name: "test", Email: "test@test.com"})
+
+	w := apiRequest(t, env, "PUT", "/-/api/v1/pages/deploy", `{"template":"templates/runbook"}`, nil)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("status = %d, want %d; body: %s", w.Code, http.StatusCreated, w.Body.String())
+	}
+	content, err := env.Store.Load(context.Background(), "deploy.md", "")
+	if err != nil {
+		t.Fatalf("page should exist: %v", err)
+	}
+	if want := "# Runbook: deploy\n\nOwner: Anonymous\n"; content != want {
+		t.Errorf("content = %q, want %q", content, want)
+	}
+
+	tests := []struct {
+		name, path, body string
+		want             int
+	}{
+		{"existing page", "existing", `{"template":"templates/runbook"}`, http.StatusConflict},
+		{"with content", "other", `{"template":"templates/runbook","content":"# Other"}`, http.StatusBadRequest},
+		{"missing template", "other", `{"template":"templates/missing"}`, http.StatusBadRequest},
+		{"outside namespace", "other", `{"template":"existing"}`, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		w := apiRequest(t, env, "PUT", "/-/api/v1/pages/"+tt.path, tt.body, nil)
+		if w.Code != tt.want {
+			t.Errorf("%s: status = %d, want %d", tt.name, w.Code, tt.want)
+		}
+	}
+	if env.Store.Exists(context.Background(), "other.md") {
+		t.Error("a rejected template save should not create the page")
+	}
+}
+
 func TestAPIPageDelete(t *testing.T) {
 	env := testutil.SetupTestEnv(t)
 
-	env.Store.Store("deletable.md", "# Delete Me", "init", storage.Author{Name: "test", Email: "test@test.com"})
+	env.Store.Store(context.Background(), "deletable.md", "# Delete Me", "init", storage.Author{Name: "test", Email: "test@test.com"})
 
 	w := apiRequest(t, env, "DELETE", "/-/api/v1/pages/deletable", "", nil)
 
@@ -301,7 +533,7 @@ func TestAPIPageDelete(t *testing.T) {
 		t.Fatalf("status = %d, want %d\nbody: %s", w.Code, http.StatusOK, w.Body.String())
 	}
 
-	if env.Store.Exists("deletable.md") {
+	if env.Store.Exists(context.Background(), "deletable.md") {
 		t.Error("page should not exist after delete")
 	}
 }
@@ -319,8 +551,8 @@ func TestAPIPageDelete_NotFound(t *testing.T) {
 func TestAPIPageHistory(t *testing.T) {
 	env := testutil.SetupTestEnv(t)
 
-	env.Store.Store("histapi.md", "# V1", "first commit", storage.Author{Name: "test", Email: "test@test.com"})
-	env.Store.Store("histapi.md", "# V2", "second commit", storage.Author{Name: "test", Email: "test@test.com"})
+	env.Store.Store(context.Background(), "histapi.md", "# V1", "first commit", storage.Author{Name: "test", Email: "test@test.com"})
+	env.Store.Store(context.Background(), "histapi.md", "# V2", "second commit", storage.Author{Name: "test", Email: "test@test.com"})
 
 	w := apiGet(t, env, "/-/api/v1/pages/histapi/history", nil)
 
@@ -338,6 +570,30 @@ func TestAPIPageHistory(t *testing.T) {
 	}
 }
 
+func TestAPIPageHistory_Paginated(t *testing.T) {
+	env := testutil.SetupTestEnv(t)
+
+	for i := 1; i <= 3; i++ {
+		env.Store.Store(context.Background(), "histpaged.md", fmt.Sprintf("# V%d", i), fmt.Sprintf("commit %d", i), storage.Author{Name: "test", Email: "test@test.com"})
+	}
+
+	w := apiGet(t, env, "/-/api/v1/pages/histpaged/history?limit=1&offset=1", nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusOK)
+	}
+	data := parseAPIResponse(t, w)["data"].([]interface{})
+	if len(data) != 1 || data[0].(map[string]interface{})["message"] != "commit 2" {
+		t.Errorf("history page = %v, want commit 2 alone", data)
+	}
+
+	if w := apiGet(t, env, "/-/api/v1/pages/histpaged/history?author=nobody", nil); len(parseAPIResponse(t, w)["data"].([]interface{})) != 0 {
+		t.Error("author filter should match no commits")
+	}
+	if w := apiGet(t, env, "/-/api/v1/pages/histpaged/history?limit=0", nil); w.Code != http.StatusBadRequest {
+		t.Errorf("invalid limit: status = %d, want 400", w.Code)
+	}
+}
+
 func TestAPIPageHistory_NotFound(t *testing.T) {
 	env := testutil.SetupTestEnv(t)
 
@@ -352,8 +608,8 @@ func TestAPIPageBacklinks(t *testing.T) {
 	env := testutil.SetupTestEnv(t)
 
 	// Create a page that links to another
-	env.Store.Store("source.md", "# Source\n\nLinks to [[target]]", "init", storage.Author{Name: "test", Email: "test@test.com"})
-	env.Store.Store("target.md", "# Target", "init", storage.Author{Name: "test", Email: "test@test.com"})
+	env.Store.Store(context.Background(), "source.md", "# Source\n\nLinks to [[target]]", "init", storage.Author{Name: "test", Email: "test@test.com"})
+	env.Store.Store(context.Background(), "target.md", "# Target", "init", storage.Author{Name: "test", Email: "test@test.com"})
 
 	// Index the source page so backlinks are recorded
 	env.Server.Wiki.IndexPage(context.Background(), "source", "# Source\n\nLinks to [[target]]")
@@ -374,10 +630,288 @@ func TestAPIPageBacklinks(t *testing.T) {
 	}
 }
 
+func TestAPIPageLinks(t *testing.T) {
+	env := testutil.SetupTestEnv(t)
+
+	env.Store.Store(context.Background(), "source.md", "# Source\n\nLinks to [[target]] and [[missing]]", "init", storage.Author{Name: "test", Email: "test@test.com"})
+	env.Server.Wiki.IndexPage(context.Background(), "source", "# Source\n\nLinks to [[target]] and [[missing]]")
+
+	w := apiGet(t, env, "/-/api/v1/pages/source/links", nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusOK)
+	}
+	data, ok := parseAPIResponse(t, w)["data"].([]interface{})
+	if !ok || len(data) != 2 || data[0] != "missing" || data[1] != "target" {
+		t.Errorf("links = %v, want [missing target]", data)
+	}
+
+	w = apiGet(t, env, "/-/api/v1/pages/target/links", nil)
+	if data, ok := parseAPIResponse(t, w)["data"].([]interface{}); !ok || len(data) != 0 {
+		t.Errorf("links of a page without any = %v, want an empty array", parseAPIResponse(t, w)["data"])
+	}
+}
+
+func TestAPIPageTOC(t *testing.T) {
+	env := testutil.SetupTestEnv(t)
+	env.Server.Config.NumberedHeadings = true
+
+	env.Store.Store(context.Background(), "guide.md", "# Guide\n\n## Install\n\n### From source\n", "init", storage.Author{Name: "test", Email: "test@test.com"})
+
+	w := apiGet(t, env, "/-/api/v1/pages/guide/toc", nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusOK)
+	}
+
+	var resp struct {
+		Data []struct {
+			Level  int    `json:"level"`
+			Text   string `json:"text"`
+			Anchor string `json:"anchor"`
+			Number string `json:"number"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to parse JSON response: %v", err)
+	}
+	if len(resp.Data) != 3 {
+		t.Fatalf("expected 3 TOC entries, got %+v", resp.Data)
+	}
+	last := resp.Data[2]
+	if last.Level != 3 || last.Text != "From source" || last.Anchor != "from-source" || last.Number != "1.1" {
+		t.Errorf("third entry = %+v", last)
+	}
+
+	if w := apiGet(t, env, "/-/api/v1/pages/missing/toc", nil); w.Code != http.StatusNotFound {
+		t.Errorf("missing page: status = %d, want %d", w.Code, http.StatusNotFound)
+	}
+}
+
+func TestAPIRender(t *testing.T) {
+	env := testutil.SetupTestEnv(t)
+
+	body := "{\"content\":\"# Title\\n\\nSee [[Other]].\\n\\n```mermaid\\ngraph TD\\n```\\n\",\"path\":\"docs/guide\"}"
+	w := apiRequest(t, env, "POST", "/-/api/v1/render", body, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d: %s", w.Code, http.StatusOK, w.Body.String())
+	}
+
+	var resp struct {
+		Data struct {
+			HTML string `json:"html"`
+			TOC  []struct {
+				Text   string `json:"text"`
+				Anchor string `json:"anchor"`
+			} `json:"toc"`
+			LibraryRequirements struct {
+				RequiresMermaid bool `json:"requires_mermaid"`
+				RequiresMathJax bool `json:"requires_mathjax"`
+			} `json:"library_requirements"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to parse JSON response: %v", err)
+	}
+	if !strings.Contains(resp.Data.HTML, "<h1") || !strings.Contains(resp.Data.HTML, `href="/Other"`) {
+		t.Errorf("html = %s", resp.Data.HTML)
+	}
+	if len(resp.Data.TOC) != 1 || resp.Data.TOC[0].Text != "Title" {
+		t.Errorf("toc = %+v", resp.Data.TOC)
+	}
+	if !resp.Data.LibraryRequirements.RequiresMermaid || resp.Data.LibraryRequirements.RequiresMathJax {
+		t.Errorf("library_requirements = %+v", resp.Data.LibraryRequirements)
+	}
+
+	// An empty document has an empty table of contents, not null.
+	if w := apiRequest(t, env, "POST", "/-/api/v1/render", `{"content":""}`, nil); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"toc":[]`) {
+		t.Errorf("empty content: status = %d, body = %s", w.Code, w.Body.String())
+	}
+	if w := apiRequest(t, env, "POST", "/-/api/v1/render", "not json", nil); w.Code != http.StatusBadRequest {
+		t.Errorf("invalid JSON: status = %d, want %d", w.Code, http.StatusBadRequest)
+	}
+}
+
+func TestAPIPageDiff(t *testing.T) {
+	env := testutil.SetupTestEnv(t)
+	ctx := context.Background()
+	author := storage.Author{Name: "test", Email: "test@test.com"}
+	env.Store.Store(ctx, "diffpage.md", "# Diff\n\nfirst\nsame\n", "init", author)
+	first, _ := env.Store.Metadata(ctx, "diffpage.md", "")
+	env.Store.Store(ctx, "diffpage.md", "# Diff\n\nsecond\nsame\nadded\n", "edit", author)
+	latest, _ := env.Store.Metadata(ctx, "diffpage.md", "")
+
+	type diffResponse struct {
+		Data struct {
+			RevA  string `json:"rev_a"`
+			RevB  string `json:"rev_b"`
+			Files []struct {
+				File      string `json:"file"`
+				Status    string `json:"status"`
+				Additions int    `json:"additions"`
+				Deletions int    `json:"deletions"`
+				Hunks     []struct {
+					Lines []struct {
+						Type    string `json:"type"`
+						Content string `json:"content"`
+						OldLine int    `json:"old_line"`
+						NewLine int    `json:"new_line"`
+					} `json:"lines"`
+				} `json:"hunks"`
+				Patch string `json:"patch"`
+			} `json:"files"`
+		} `json:"data"`
+	}
+	get := func(path string) diffResponse {
+		t.Helper()
+		w := apiGet(t, env, path, nil)
+		if w.Code != http.StatusOK {
+			t.Fatalf("GET %s: status = %d, want %d: %s", path, w.Code, http.StatusOK, w.Body.String())
+		}
+		var resp diffResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("failed to parse JSON response: %v", err)
+		}
+		return resp
+	}
+
+	// By default the last change is shown.
+	resp := get("/-/api/v1/pages/diffpage/diff")
+	if resp.Data.RevA != first.Revision || resp.Data.RevB != latest.Revision {
+		t.Errorf("revisions = %s..%s, want %s..%s", resp.Data.RevA, resp.Data.RevB, first.Revision, latest.Revision)
+	}
+	if len(resp.Data.Files) != 1 {
+		t.Fatalf("files = %+v", resp.Data.Files)
+	}
+	file := resp.Data.Files[0]
+	if file.File != "diffpage.md" || file.Status != "modified" || file.Additions != 2 || file.Deletions != 1 {
+		t.Errorf("file = %+v", file)
+	}
+	if !strings.Contains(file.Patch, "-first\n+second\n") {
+		t.Errorf("patch = %q", file.Patch)
+	}
+	var added bool
+	for _, line := range file.Hunks[0].Lines {
+		if line.Type == "add" && line.Content == "added" && line.NewLine == 5 {
+			added = true
+		}
+	}
+	if !added {
+		t.Errorf("hunk lacks the added line: %+v", file.Hunks)
+	}
+
+	// The same revision twice differs in nothing.
+	if resp := get("/-/api/v1/pages/diffpage/diff?rev_a=" + first.Revision + "&rev_b=" + first.Revision); len(resp.Data.Files) != 0 {
+		t.Errorf("unchanged files = %+v", resp.Data.Files)
+	}
+
+	if w := apiGet(t, env, "/-/api/v1/pages/missing/diff", nil); w.Code != http.StatusNotFound {
+		t.Errorf("missing page: status = %d, want %d", w.Code, http.StatusNotFound)
+	}
+	if w := apiGet(t, env, "/-/api/v1/pages/diffpage/diff?rev_a=0000000&rev_b=0000001", nil); w.Code != http.StatusNotFound {
+		t.Errorf("unknown revisions: status = %d, want %d", w.Code, http.StatusNotFound)
+	}
+}
+
+func TestAPICommit(t *testing.T) {
+	env := testutil.SetupTestEnv(t)
+	ctx := context.Background()
+	author := storage.Author{Name: "Alice", Email: "alice@example.com"}
+	env.Store.Store(ctx, "one.md", "one\n", "Add one", author)
+	env.Store.Store(ctx, "one.md", "one\nmore\n", "Extend one", author)
+	meta, _ := env.Store.Metadata(ctx, "one.md", "")
+
+	w := apiGet(t, env, "/-/api/v1/commits/"+meta.Revision, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d: %s", w.Code, http.StatusOK, w.Body.String())
+	}
+	var resp struct {
+		Data struct {
+			Commit struct {
+				RevisionFull string `json:"revision_full"`
+				Message      string `json:"message"`
+				AuthorName   string `json:"author_name"`
+			} `json:"commit"`
+			Files []struct {
+				File      string `json:"file"`
+				Additions int    `json:"additions"`
+				Deletions int    `json:"deletions"`
+			} `json:"files"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to parse JSON response: %v", err)
+	}
+	if resp.Data.Commit.RevisionFull != meta.RevisionFull || resp.Data.Commit.Message != "Extend one" || resp.Data.Commit.AuthorName != "Alice" {
+		t.Errorf("commit = %+v", resp.Data.Commit)
+	}
+	if len(resp.Data.Files) != 1 || resp.Data.Files[0].File != "one.md" || resp.Data.Files[0].Additions != 1 || resp.Data.Files[0].Deletions != 0 {
+		t.Errorf("files = %+v", resp.Data.Files)
+	}
+
+	if w := apiGet(t, env, "/-/api/v1/commits/0000000", nil); w.Code != http.StatusNotFound {
+		t.Errorf("unknown commit: status = %d, want %d", w.Code, http.StatusNotFound)
+	}
+}
+
+func TestAPIPageAttachments(t *testing.T) {
+	env := testutil.SetupTestEnv(t)
+
+	author := storage.Author{Name: "test", Email: "test@test.com"}
+	env.Store.Store(context.Background(), "gallery.md", "# Gallery", "init", author)
+	env.Store.Store(context.Background(), "gallery/sub.md", "# Sub", "init", author)
+	for _, name := range []string{"a.png", "b.png", "c.pdf"} {
+		env.Store.Store(context.Background(), "gallery/"+name, "x", "upload "+name, author)
+	}
+
+	w := apiGet(t, env, "/-/api/v1/pages/gallery/attachments?limit=1&offset=1", nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d\nbody: %s", w.Code, http.StatusOK, w.Body.String())
+	}
+	data := parseAPIResponse(t, w)["data"].(map[string]interface{})
+	if data["total"] != float64(3) {
+		t.Errorf("total = %v, want 3 (markdown files excluded)", data["total"])
+	}
+	items := data["attachments"].([]interface{})
+	if len(items) != 1 {
+		t.Fatalf("got %d attachments, want 1", len(items))
+	}
+	item := items[0].(map[string]interface{})
+	if item["filename"] != "b.png" || item["url"] != "/gallery/b.png" || item["is_image"] != true {
+		t.Errorf("attachment = %v, want b.png image at /gallery/b.png", item)
+	}
+
+	w = apiGet(t, env, "/-/api/v1/pages/gallery/attachments?q=PDF", nil)
+	data = parseAPIResponse(t, w)["data"].(map[string]interface{})
+	if data["total"] != float64(1) {
+		t.Errorf("search total = %v, want 1", data["total"])
+	}
+
+	w = apiGet(t, env, "/-/api/v1/attachments/recent?limit=2", nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("recent status = %d, want %d", w.Code, http.StatusOK)
+	}
+	data = parseAPIResponse(t, w)["data"].(map[string]interface{})
+	items = data["attachments"].([]interface{})
+	if len(items) != 2 {
+		t.Fatalf("got %d recent attachments, want 2", len(items))
+	}
+	if name := items[0].(map[string]interface{})["filename"]; name != "c.pdf" {
+		t.Errorf("most recent attachment = %v, want c.pdf", name)
+	}
+}
+
+func TestAPIPageAttachments_InvalidLimit(t *testing.T) {
+	env := testutil.SetupTestEnv(t)
+
+	w := apiGet(t, env, "/-/api/v1/pages/gallery/attachments?limit=0", nil)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusBadRequest)
+	}
+}
+
 func TestAPIPageNestedPath(t *testing.T) {
 	env := testutil.SetupTestEnv(t)
 
-	env.Store.Store("docs/getting-started.md", "# Getting Started", "init", storage.Author{Name: "test", Email: "test@test.com"})
+	env.Store.Store(context.Background(), "docs/getting-started.md", "# Getting Started", "init", storage.Author{Name: "test", Email: "test@test.com"})
 
 	w := apiGet(t, env, "/-/api/v1/pages/docs/getting-started", nil)
 
@@ -397,7 +931,7 @@ func TestAPIPageNestedPath(t *testing.T) {
 func TestAPISearch(t *testing.T) {
 	env := testutil.SetupTestEnv(t)
 
-	env.Store.Store("findme.md", "# Find Me\n\nThis contains the keyword apitarget.", "init", storage.Author{Name: "test", Email: "test@test.com"})
+	env.Store.Store(context.Background(), "findme.md", "# Find Me\n\nThis contains the keyword apitarget.", "init", storage.Author{Name: "test", Email: "test@test.com"})
 
 	w := apiGet(t, env, "/-/api/v1/search?q=apitarget", nil)
 
@@ -452,7 +986,7 @@ func TestAPISearch_NoResults(t *testing.T) {
 func TestAPIChangelog(t *testing.T) {
 	env := testutil.SetupTestEnv(t)
 
-	env.Store.Store("clpage.md", "# CL", "API changelog test", storage.Author{Name: "test", Email: "test@test.com"})
+	env.Store.Store(context.Background(), "clpage.md", "# CL", "API changelog test", storage.Author{Name: "test", Email: "test@test.com"})
 
 	w := apiGet(t, env, "/-/api/v1/changelog", nil)
 
@@ -974,7 +1508,7 @@ func TestAPIIssueDelete_CascadesComments(t *testing.T) {
 func TestAPIResponseFormat_Success(t *testing.T) {
 	env := testutil.SetupTestEnv(t)
 
-	env.Store.Store("fmtpage.md", "# Format Test", "init", storage.Author{Name: "test", Email: "test@test.com"})
+	env.Store.Store(context.Background(), "fmtpage.md", "# Format Test", "init", storage.Author{Name: "test", Email: "test@test.com"})
 
 	w := apiGet(t, env, "/-/api/v1/pages/fmtpage", nil)
 
@@ -1001,3 +1535,130 @@ func TestAPIResponseFormat_Error(t *testing.T) {
 		t.Error("error message should not be empty")
 	}
 }
+
+func TestAPIExport(t *testing.T) {
+	env := testutil.SetupTestEnv(t)
+	author := storage.Author{Name: "test", Email: "test@test.com"}
+	env.Store.Store(context.Background(), "docs/guide.md", "# Guide", "init", author)
+	env.Store.Store(context.Background(), "other.md", "# Other", "init", author)
+
+	w := apiGet(t, env, "/-/api/v1/export?path=docs", nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d\nbody: %s", w.Code, http.StatusOK, w.Body.String())
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "application/zip" {
+		t.Errorf("Content-Type = %q, want application/zip", ct)
+	}
+	if got := strings.Join(zipNames(t, w), ","); got != "docs/guide.md" {
+		t.Errorf("archive entries = %s, want docs/guide.md", got)
+	}
+
+	w = apiGet(t, env, "/-/api/v1/export?path=ghost", nil)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("missing subtree: status = %d, want %d", w.Code, http.StatusNotFound)
+	}
+	if parseAPIResponse(t, w)["error"] == nil {
+		t.Error("missing subtree should return a JSON error")
+	}
+}
+
+func TestAPIImport(t *testing.T) {
+	env := testutil.SetupTestEnv(t)
+	archive := importZip(t, "guide.md", "# Guide", "notes/a.txt", "text")
+
+	// Admin only.
+	req := httptest.NewRequest("POST", "/-/api/v1/import", bytes.NewReader(archive))
+	w := httptest.NewRecorder()
+	env.Router.ServeHTTP(w, req)
+	if w.Code != http.StatusUnauthorized && w.Code != http.StatusForbidden {
+		t.Errorf("anonymous import: status = %d, want 401 or 403", w.Code)
+	}
+
+	admin := loginAsAdmin(t, env)
+	req = httptest.NewRequest("POST", "/-/api/v1/import?dry_run=true", bytes.NewReader(archive))
+	req.Header.Set("Content-Type", "application/zip")
+	for _, c := range admin {
+		req.AddCookie(c)
+	}
+	w = httptest.NewRecorder()
+	env.Router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d\nbody: %s", w.Code, http.StatusOK, w.Body.String())
+	}
+	data := parseAPIResponse(t, w)["data"].(map[string]interface{})
+	if data["dry_run"] != true || data["created"] != float64(2) {
+		t.Errorf("report = %v, want a dry run creating 2 files", data)
+	}
+	if env.Store.Exists(context.Background(), "guide.md") {
+		t.Error("dry run should not import")
+	}
+
+	req = httptest.NewRequest("POST", "/-/api/v1/import", strings.NewReader("junk"))
+	for _, c := range admin {
+		req.AddCookie(c)
+	}
+	w = httptest.NewRecorder()
+	env.Router.ServeHTTP(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("invalid archive: status = %d, want %d", w.Code, http.StatusBadRequest)
+	}
+}
+
+func TestAPIImportMediaWiki(t *testing.T) {
+	env := testutil.SetupTestEnv(t)
+	admin := loginAsAdmin(t, env)
+
+	req := httptest.NewRequest("POST", "/-/api/v1/import/mediawiki?prefix=old&latest_only=true", strings.NewReader(testMediaWikiDump))
+	req.Header.Set("Content-Type", "application/xml")
+	for _, c := range admin {
+		req.AddCookie(c)
+	}
+	w := httptest.NewRecorder()
+	env.Router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d\nbody: %s", w.Code, http.StatusOK, w.Body.String())
+	}
+	data := parseAPIResponse(t, w)["data"].(map[string]interface{})
+	if data["created"] != float64(1) || data["skipped"] != float64(1) {
+		t.Errorf("report = %v, want 1 created and 1 skipped", data)
+	}
+	if !env.Store.Exists(context.Background(), "old/main-page.md") {
+		t.Error("old/main-page.md should be imported")
+	}
+
+	req = httptest.NewRequest("POST", "/-/api/v1/import/mediawiki", strings.NewReader("junk"))
+	for _, c := range admin {
+		req.AddCookie(c)
+	}
+	w = httptest.NewRecorder()
+	env.Router.ServeHTTP(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("invalid dump: status = %d, want %d", w.Code, http.StatusBadRequest)
+	}
+}
+
+func TestAPIPageGet_MemoryStorage(t *testing.T) {
+	env := testutil.SetupMemoryTestEnv(t)
+
+	env.Store.Store(context.Background(), "versioned.md", "# Version 1", "v1", storage.Author{Name: "test", Email: "test@test.com"})
+	meta, _ := env.Store.Metadata(context.Background(), "versioned.md", "")
+	rev1 := meta.Revision
+	env.Store.Store(context.Background(), "versioned.md", "# Version 2", "v2", storage.Author{Name: "test", Email: "test@test.com"})
+
+	w := apiGet(t, env, "/-/api/v1/pages/versioned?revision="+rev1, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusOK)
+	}
+	data := parseAPIResponse(t, w)["data"].(map[string]interface{})
+	if content := data["content"].(string); !strings.Contains(content, "Version 1") {
+		t.Errorf("content = %q, should contain 'Version 1'", content)
+	}
+
+	for _, path := range []string{"/versioned", "/versioned/history", "/-/changelog", "/-/health?deep=1"} {
+		w := httptest.NewRecorder()
+		env.Router.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		if w.Code != http.StatusOK {
+			t.Errorf("GET %s = %d, want %d; body %s", path, w.Code, http.StatusOK, w.Body.String())
+		}
+	}
+}
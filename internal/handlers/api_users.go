@@ -0,0 +1,482 @@
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/sa/gopherwiki/internal/auth"
+	"github.com/sa/gopherwiki/internal/db"
+	"github.com/sa/gopherwiki/internal/middleware"
+	"github.com/sa/gopherwiki/internal/models"
+)
+
+// APIUserFieldInput is the JSON request body for creating a profile field.
+type APIUserFieldInput struct {
+	Name  string `json:"name"`
+	Label string `json:"label"`
+}
+
+// APIUser is the JSON representation of a user account.
+type APIUser struct {
+	ID          int64  `json:"id"`
+	Name        string `json:"name"`
+	Email       string `json:"email"`
+	IsApproved  bool   `json:"is_approved"`
+	IsAdmin     bool   `json:"is_admin"`
+	AllowRead   bool   `json:"allow_read"`
+	AllowWrite  bool   `json:"allow_write"`
+	AllowUpload bool   `json:"allow_upload"`
+	HasPassword bool   `json:"has_password"`
+}
+
+// APIUserInput is the JSON request body for creating a user. The approval
+// and permission flags default to true and is_admin to false when omitted.
+type APIUserInput struct {
+	Name        string `json:"name"`
+	Email       string `json:"email"`
+	Password    string `json:"password"`
+	IsApproved  *bool  `json:"is_approved"`
+	IsAdmin     *bool  `json:"is_admin"`
+	AllowRead   *bool  `json:"allow_read"`
+	AllowWrite  *bool  `json:"allow_write"`
+	AllowUpload *bool  `json:"allow_upload"`
+}
+
+// APIUserUpdateInput is the JSON request body for changing a user's name,
+// approval and permissions; omitted fields are kept.
+type APIUserUpdateInput struct {
+	Name        *string `json:"name"`
+	IsApproved  *bool   `json:"is_approved"`
+	IsAdmin     *bool   `json:"is_admin"`
+	AllowRead   *bool   `json:"allow_read"`
+	AllowWrite  *bool   `json:"allow_write"`
+	AllowUpload *bool   `json:"allow_upload"`
+}
+
+// APIPasswordInput is the JSON request body for setting a password.
+type APIPasswordInput struct {
+	Password string `json:"password"`
+}
+
+// APIPasswordReset is the JSON response for an issued password reset link.
+type APIPasswordReset struct {
+	URL       string `json:"url"`
+	ExpiresAt string `json:"expires_at"`
+}
+
+func userToAPI(u *models.User) APIUser {
+	return APIUser{
+		ID:          u.ID,
+		Name:        u.GetName(),
+		Email:       u.GetEmail(),
+		IsApproved:  u.Approved(),
+		IsAdmin:     u.Admin(),
+		AllowRead:   u.CanRead(),
+		AllowWrite:  u.CanWrite(),
+		AllowUpload: u.CanUpload(),
+		HasPassword: u.HasPasswordHash(),
+	}
+}
+
+func boolOr(b *bool, def bool) bool {
+	if b == nil {
+		return def
+	}
+	return *b
+}
+
+// APIUserPreferences is the JSON representation of the interface
+// preferences of a user. Empty and zero values keep the defaults.
+type APIUserPreferences struct {
+	ColorScheme    string `json:"color_scheme"`     // "light" or "dark"; "" follows the browser
+	EditorFontSize int    `json:"editor_font_size"` // In pixels
+	LandingPage    string `json:"landing_page"`     // Page or /-/ route the wiki's root leads to
+	PageSize       int    `json:"page_size"`        // Entries per page of the changelog and histories
+}
+
+// APIUserPreferencesInput is the JSON request body for changing interface
+// preferences; omitted fields are kept.
+type APIUserPreferencesInput struct {
+	ColorScheme    *string `json:"color_scheme"`
+	EditorFontSize *int    `json:"editor_font_size"`
+	LandingPage    *string `json:"landing_page"`
+	PageSize       *int    `json:"page_size"`
+}
+
+// APIUserActivity is the JSON representation of a user's recent contributions.
+type APIUserActivity struct {
+	Email    string            `json:"email"`
+	Name     string            `json:"name"`
+	Commits  []APICommit       `json:"commits"`
+	Issues   []APIIssue        `json:"issues"`
+	Comments []APIIssueComment `json:"comments"`
+}
+
+// handleAPIUserActivity handles GET /api/v1/users/{email}/activity.
+func (s *Server) handleAPIUserActivity(w http.ResponseWriter, r *http.Request) {
+	activity, err := s.loadUserActivity(r.Context(), chi.URLParam(r, "email"))
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, "failed to load user activity")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, APIUserActivity{
+		Email:    activity.Email,
+		Name:     activity.Name,
+		Commits:  commitsToAPI(activity.Commits),
+		Issues:   issuesToAPI(activity.Issues),
+		Comments: issueCommentsToAPI(activity.Comments),
+	})
+}
+
+// handleAPIUserList handles GET /api/v1/admin/users -- list all users.
+func (s *Server) handleAPIUserList(w http.ResponseWriter, r *http.Request) {
+	users, err := s.Auth.ListUsers(r.Context())
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, "failed to list users")
+		return
+	}
+
+	result := make([]APIUser, 0, len(users))
+	for _, u := range users {
+		result = append(result, userToAPI(u))
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+// handleAPIUserGet handles GET /api/v1/admin/users/{id}.
+func (s *Server) handleAPIUserGet(w http.ResponseWriter, r *http.Request) {
+	id, err := parseInt64(chi.URLParam(r, "id"))
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, "invalid user ID")
+		return
+	}
+
+	user, err := s.Auth.GetUserByID(r.Context(), id)
+	if err != nil {
+		writeJSONError(w, http.StatusNotFound, "user not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, userToAPI(user))
+}
+
+// handleAPIUserUpdate handles PUT /api/v1/admin/users/{id} -- change a
+// user's name, approval and permissions, as the admin user form does.
+// Withdrawing approval ends the user's sessions.
+func (s *Server) handleAPIUserUpdate(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	id, err := parseInt64(chi.URLParam(r, "id"))
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, "invalid user ID")
+		return
+	}
+
+	var input APIUserUpdateInput
+	if err := decodeJSON(r, &input); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "invalid JSON")
+		return
+	}
+
+	user, err := s.Auth.GetUserByID(ctx, id)
+	if err != nil {
+		writeJSONError(w, http.StatusNotFound, "user not found")
+		return
+	}
+
+	name := user.GetName()
+	if input.Name != nil {
+		name = strings.TrimSpace(*input.Name)
+	}
+	isApproved := boolOr(input.IsApproved, user.Approved())
+	params := db.UpdateUserParams{
+		ID:             id,
+		Name:           name,
+		Email:          user.Email,
+		PasswordHash:   user.PasswordHash,
+		IsApproved:     db.NullBool(isApproved),
+		IsAdmin:        db.NullBool(boolOr(input.IsAdmin, user.Admin())),
+		EmailConfirmed: user.EmailConfirmed,
+		AllowRead:      db.NullBool(boolOr(input.AllowRead, user.CanRead())),
+		AllowWrite:     db.NullBool(boolOr(input.AllowWrite, user.CanWrite())),
+		AllowUpload:    db.NullBool(boolOr(input.AllowUpload, user.CanUpload())),
+	}
+	if err := s.Users.Queries.UpdateUser(ctx, params); err != nil {
+		writeJSONError(w, http.StatusInternalServerError, "failed to update user")
+		return
+	}
+
+	if user.Approved() && !isApproved {
+		if _, err := s.Users.DeleteUserSessions(ctx, id); err != nil {
+			slog.Error("failed to revoke sessions", "user_id", id, "error", err)
+		}
+	}
+
+	updated, err := s.Auth.GetUserByID(ctx, id)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, "failed to get user")
+		return
+	}
+	slog.Info("user updated", "user", middleware.GetUser(r).GetEmail(), "user_id", id)
+	writeJSON(w, http.StatusOK, userToAPI(updated))
+}
+
+// handleAPIUserDelete handles DELETE /api/v1/admin/users/{id}. Admins
+// cannot delete their own account.
+func (s *Server) handleAPIUserDelete(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	id, err := parseInt64(chi.URLParam(r, "id"))
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, "invalid user ID")
+		return
+	}
+	if middleware.GetUser(r).ID == id {
+		writeJSONError(w, http.StatusBadRequest, "cannot delete your own account")
+		return
+	}
+
+	if _, err := s.Auth.GetUserByID(ctx, id); err != nil {
+		writeJSONError(w, http.StatusNotFound, "user not found")
+		return
+	}
+	if err := s.Auth.DeleteUser(ctx, id); err != nil {
+		writeJSONError(w, http.StatusInternalServerError, "failed to delete user")
+		return
+	}
+
+	slog.Info("user deleted", "user", middleware.GetUser(r).GetEmail(), "user_id", id)
+	writeJSON(w, http.StatusOK, map[string]bool{"deleted": true})
+}
+
+// handleAPIUserCreate handles POST /api/v1/users -- create a user. A user
+// created without a password needs one set, or a reset link issued, before
+// they can log in.
+func (s *Server) handleAPIUserCreate(w http.ResponseWriter, r *http.Request) {
+	var input APIUserInput
+	if err := decodeJSON(r, &input); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "invalid JSON")
+		return
+	}
+
+	user, err := s.Auth.CreateUser(r.Context(), auth.NewUser{
+		Name:        input.Name,
+		Email:       input.Email,
+		Password:    input.Password,
+		IsApproved:  boolOr(input.IsApproved, true),
+		IsAdmin:     boolOr(input.IsAdmin, false),
+		AllowRead:   boolOr(input.AllowRead, true),
+		AllowWrite:  boolOr(input.AllowWrite, true),
+		AllowUpload: boolOr(input.AllowUpload, true),
+	})
+	switch err {
+	case nil:
+	case auth.ErrEmailExists:
+		writeJSONError(w, http.StatusConflict, err.Error())
+		return
+	case auth.ErrInvalidEmail, auth.ErrPasswordTooShort:
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	default:
+		writeJSONError(w, http.StatusInternalServerError, "failed to create user")
+		return
+	}
+
+	slog.Info("user created", "user", middleware.GetUser(r).GetEmail(), "new_user", user.Email)
+	writeJSON(w, http.StatusCreated, userToAPI(user))
+}
+
+// handleAPIUserPassword handles PUT /api/v1/users/{id}/password -- set a
+// user's password, invalidating their outstanding reset links.
+func (s *Server) handleAPIUserPassword(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	id, err := parseInt64(chi.URLParam(r, "id"))
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, "invalid user ID")
+		return
+	}
+
+	var input APIPasswordInput
+	if err := decodeJSON(r, &input); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "invalid JSON")
+		return
+	}
+	if err := auth.ValidatePassword(input.Password); err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := s.Auth.UpdatePassword(ctx, id, input.Password); err != nil {
+		if err == auth.ErrUserNotFound {
+			writeJSONError(w, http.StatusNotFound, "user not found")
+			return
+		}
+		writeJSONError(w, http.StatusInternalServerError, "failed to set password")
+		return
+	}
+	if err := s.Users.DeletePasswordResets(ctx, id); err != nil {
+		slog.Warn("failed to delete outstanding password resets", "user_id", id, "error", err)
+	}
+	s.endSessionsOnPasswordChange(r, id)
+
+	slog.Info("password set by admin", "user", middleware.GetUser(r).GetEmail(), "user_id", id)
+	writeJSON(w, http.StatusOK, map[string]bool{"updated": true})
+}
+
+// handleAPIUserPasswordReset handles POST /api/v1/users/{id}/password-reset --
+// issue a single-use reset link. The link is returned rather than emailed.
+func (s *Server) handleAPIUserPasswordReset(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	id, err := parseInt64(chi.URLParam(r, "id"))
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, "invalid user ID")
+		return
+	}
+
+	if _, err := s.Auth.GetUserByID(ctx, id); err != nil {
+		writeJSONError(w, http.StatusNotFound, "user not found")
+		return
+	}
+
+	link, expires, err := s.createPasswordReset(ctx, id)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, "failed to create password reset")
+		return
+	}
+
+	slog.Info("password reset link issued", "user", middleware.GetUser(r).GetEmail(), "user_id", id)
+	writeJSON(w, http.StatusCreated, APIPasswordReset{
+		URL:       link,
+		ExpiresAt: expires.UTC().Format(time.RFC3339),
+	})
+}
+
+// handleAPIUserFieldList handles GET /api/v1/user-fields -- list profile field definitions.
+func (s *Server) handleAPIUserFieldList(w http.ResponseWriter, r *http.Request) {
+	fields, err := s.Users.ListUserFields(r.Context())
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, "failed to list user fields")
+		return
+	}
+	writeJSON(w, http.StatusOK, fields)
+}
+
+// handleAPIUserFieldCreate handles POST /api/v1/user-fields -- define a profile field.
+func (s *Server) handleAPIUserFieldCreate(w http.ResponseWriter, r *http.Request) {
+	var input APIUserFieldInput
+	if err := decodeJSON(r, &input); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "invalid JSON")
+		return
+	}
+
+	name := strings.TrimSpace(input.Name)
+	label := strings.TrimSpace(input.Label)
+	if err := validateUserField(name, label); err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	field, err := s.Users.CreateUserField(r.Context(), name, label)
+	if err != nil {
+		writeJSONError(w, http.StatusConflict, "failed to create user field (name may already exist)")
+		return
+	}
+	writeJSON(w, http.StatusCreated, field)
+}
+
+// handleAPIUserFieldDelete handles DELETE /api/v1/user-fields/{id} -- remove a profile field.
+func (s *Server) handleAPIUserFieldDelete(w http.ResponseWriter, r *http.Request) {
+	id, err := parseInt64(chi.URLParam(r, "id"))
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, "invalid field ID")
+		return
+	}
+
+	if err := s.Users.DeleteUserField(r.Context(), id); err != nil {
+		if err == sql.ErrNoRows {
+			writeJSONError(w, http.StatusNotFound, "user field not found")
+			return
+		}
+		writeJSONError(w, http.StatusInternalServerError, "failed to delete user field")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]bool{"deleted": true})
+}
+
+// handleAPIUserFieldValues handles GET /api/v1/users/{id}/fields -- a user's profile field values.
+func (s *Server) handleAPIUserFieldValues(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	id, err := parseInt64(chi.URLParam(r, "id"))
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, "invalid user ID")
+		return
+	}
+
+	if _, err := s.Auth.GetUserByID(ctx, id); err != nil {
+		writeJSONError(w, http.StatusNotFound, "user not found")
+		return
+	}
+
+	values, err := s.Users.GetUserFieldValues(ctx, id)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, "failed to get user fields")
+		return
+	}
+	writeJSON(w, http.StatusOK, values)
+}
+
+// handleAPIUserFieldValuesUpdate handles PUT /api/v1/users/{id}/fields -- set profile
+// field values. Only the keys present in the body are changed; an empty string
+// clears a field. Unknown field names are rejected.
+func (s *Server) handleAPIUserFieldValuesUpdate(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	id, err := parseInt64(chi.URLParam(r, "id"))
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, "invalid user ID")
+		return
+	}
+
+	if _, err := s.Auth.GetUserByID(ctx, id); err != nil {
+		writeJSONError(w, http.StatusNotFound, "user not found")
+		return
+	}
+
+	var input map[string]string
+	if err := decodeJSON(r, &input); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "invalid JSON")
+		return
+	}
+
+	fields, err := s.Users.ListUserFields(ctx)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, "failed to list user fields")
+		return
+	}
+	known := make(map[string]bool, len(fields))
+	for _, f := range fields {
+		known[f.Name] = true
+	}
+	for name, value := range input {
+		if !known[name] {
+			writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("unknown user field: %s", name))
+			return
+		}
+		input[name] = strings.TrimSpace(value)
+	}
+
+	if err := s.Users.SetUserFieldValues(ctx, id, input); err != nil {
+		writeJSONError(w, http.StatusInternalServerError, "failed to update user fields")
+		return
+	}
+
+	values, err := s.Users.GetUserFieldValues(ctx, id)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, "failed to get user fields")
+		return
+	}
+	writeJSON(w, http.StatusOK, values)
+}
@@ -0,0 +1,50 @@
+package handlers
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strings"
+
+	"github.com/sa/gopherwiki/internal/middleware"
+	"github.com/sa/gopherwiki/internal/storage"
+)
+
+// anonymousIDLength is the number of hex digits of the keyed IP hash used as
+// a pseudonym in "hashed" attribution.
+const anonymousIDLength = 10
+
+// anonymousAuthor returns the author recorded for an anonymous visitor's
+// edits. "shared" attributes every anonymous edit to one identity; "ip" names
+// the client address, and "hashed" a pseudonym derived from it, so that edits
+// from one address can be told apart from others without publishing the
+// address itself.
+func (s *Server) anonymousAuthor(r *http.Request) storage.Author {
+	var id string
+	switch s.Config.AnonymousAttribution {
+	case "ip":
+		id = middleware.ClientIP(r)
+	case "hashed":
+		id = anonymousID(s.Config.SecretKey, middleware.ClientIP(r))
+	default:
+		return storage.Author{Name: "Anonymous", Email: "anonymous@example.com"}
+	}
+
+	// IPv6 colons do not belong in the local part of an email address; dots
+	// go too, so both address families look alike.
+	local := strings.NewReplacer(".", "-", ":", "-").Replace(id)
+	return storage.Author{
+		Name:  "Anonymous (" + id + ")",
+		Email: "anonymous+" + local + "@example.com",
+	}
+}
+
+// anonymousID derives a stable pseudonym for ip. The hash is keyed with the
+// secret key, so the pseudonym cannot be reversed by hashing every possible
+// address; changing the secret key changes every pseudonym.
+func anonymousID(secretKey, ip string) string {
+	mac := hmac.New(sha256.New, []byte(secretKey))
+	mac.Write([]byte(ip))
+	return hex.EncodeToString(mac.Sum(nil))[:anonymousIDLength]
+}
@@ -0,0 +1,61 @@
+package handlers_test
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/sa/gopherwiki/internal/testutil"
+)
+
+// anonymousSave saves a page as an anonymous visitor from ip and returns the
+// resulting commit's author name and email.
+func anonymousSave(t *testing.T, env *testutil.TestEnv, page, ip string) (string, string) {
+	t.Helper()
+	form := url.Values{"content": {"# " + page}, "commit": {"anonymous edit"}}
+	req := httptest.NewRequest("POST", "/"+page+"/save", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.RemoteAddr = net.JoinHostPort(ip, "4711")
+	w := httptest.NewRecorder()
+	env.Router.ServeHTTP(w, req)
+	if w.Code != http.StatusFound {
+		t.Fatalf("save status = %d, want %d", w.Code, http.StatusFound)
+	}
+
+	log, err := env.Store.Log(context.Background(), page+".md", 1)
+	if err != nil || len(log) != 1 {
+		t.Fatalf("Log(%s) = %v, %v", page, log, err)
+	}
+	return log[0].AuthorName, log[0].AuthorEmail
+}
+
+func TestAnonymousAttribution(t *testing.T) {
+	env := testutil.SetupTestEnv(t)
+
+	if name, email := anonymousSave(t, env, "shared", "203.0.113.5"); name != "Anonymous" || email != "anonymous@example.com" {
+		t.Errorf("shared: author = %q <%s>, want the shared anonymous identity", name, email)
+	}
+
+	env.Server.Config.AnonymousAttribution = "ip"
+	if name, email := anonymousSave(t, env, "byip", "203.0.113.5"); name != "Anonymous (203.0.113.5)" || email != "anonymous+203-0-113-5@example.com" {
+		t.Errorf("ip: author = %q <%s>", name, email)
+	}
+	if name, _ := anonymousSave(t, env, "byip6", "2001:db8::1"); name != "Anonymous (2001:db8::1)" {
+		t.Errorf("ip (IPv6): author = %q", name)
+	}
+
+	env.Server.Config.AnonymousAttribution = "hashed"
+	first, _ := anonymousSave(t, env, "hashed1", "203.0.113.5")
+	again, _ := anonymousSave(t, env, "hashed2", "203.0.113.5")
+	other, _ := anonymousSave(t, env, "hashed3", "198.51.100.7")
+	if strings.Contains(first, "203.0.113.5") || !strings.HasPrefix(first, "Anonymous (") {
+		t.Errorf("hashed: author = %q, want a pseudonym without the address", first)
+	}
+	if first != again || first == other {
+		t.Errorf("hashed: pseudonyms %q, %q, %q; want stable per address and distinct across addresses", first, again, other)
+	}
+}
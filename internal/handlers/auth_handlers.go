@@ -1,11 +1,18 @@
 package handlers
 
 import (
+	"cmp"
+	"context"
+	"database/sql"
+	"errors"
 	"log/slog"
 	"net/http"
+	"net/url"
 	"strings"
+	"time"
 
 	"github.com/sa/gopherwiki/internal/auth"
+	"github.com/sa/gopherwiki/internal/db"
 	"github.com/sa/gopherwiki/internal/middleware"
 )
 
@@ -83,7 +90,7 @@ func (s *Server) handleLogout(w http.ResponseWriter, r *http.Request) {
 // handleRegister handles the registration page.
 func (s *Server) handleRegister(w http.ResponseWriter, r *http.Request) {
 	// If registration is disabled, redirect to login
-	if s.Config.DisableRegistration {
+	if s.Settings.Get(r.Context()).DisableRegistration {
 		http.Redirect(w, r, "/-/login", http.StatusFound)
 		return
 	}
@@ -102,7 +109,7 @@ func (s *Server) handleRegister(w http.ResponseWriter, r *http.Request) {
 // handleRegisterPost handles registration form submission.
 func (s *Server) handleRegisterPost(w http.ResponseWriter, r *http.Request) {
 	// If registration is disabled, redirect to login
-	if s.Config.DisableRegistration {
+	if s.Settings.Get(r.Context()).DisableRegistration {
 		http.Redirect(w, r, "/-/login", http.StatusFound)
 		return
 	}
@@ -128,11 +135,11 @@ func (s *Server) handleRegisterPost(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Validate password length
-	if len(password) < 8 {
+	if err := auth.ValidatePassword(password); err != nil {
 		data := NewGenericData("Register")
 		data["name"] = name
 		data["email"] = email
-		data["error"] = "Password must be at least 8 characters"
+		data["error"] = capitalizeError(err)
 		s.renderTemplate(w, r, "register.html", data)
 		return
 	}
@@ -175,9 +182,38 @@ func (s *Server) handleSettings(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	fields, err := s.Users.ListUserFields(r.Context())
+	if err != nil {
+		slog.Error("failed to list user fields", "error", err)
+	}
+	fieldValues, err := s.Users.GetUserFieldValues(r.Context(), user.ID)
+	if err != nil {
+		slog.Error("failed to get user field values", "error", err)
+	}
+
 	data := NewGenericData("Settings")
 	data["user_name"] = user.GetName()
 	data["user_email"] = user.GetEmail()
+	data["user_fields"] = fields
+	data["user_field_values"] = fieldValues
+	data["gravatar"] = s.Config.Gravatar && !s.Config.Offline
+	data["page_sizes"] = listPageSizes
+	data["min_editor_font_size"] = minEditorFontSize
+	data["max_editor_font_size"] = maxEditorFontSize
+	data["home_page"] = cmp.Or(s.Settings.Get(r.Context()).HomePage, "Home")
+	if _, err := s.Users.GetUserAvatar(r.Context(), user.ID); err == nil {
+		data["has_avatar"] = true
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		slog.Error("failed to get avatar", "error", err)
+	}
+	if s.Mailer != nil {
+		pref, err := s.Users.GetUserPreference(r.Context(), user.ID, db.UserPrefEmailNotifications)
+		if err != nil {
+			slog.Error("failed to get notification preference", "error", err)
+		}
+		data["mail_enabled"] = true
+		data["email_notifications"] = pref != "off"
+	}
 	s.renderTemplate(w, r, "settings.html", data)
 }
 
@@ -207,6 +243,39 @@ func (s *Server) handleSettingsPost(w http.ResponseWriter, r *http.Request) {
 			}
 		}
 
+	case "update_fields":
+		if err := s.saveUserFieldsFromForm(r, user.ID); err != nil {
+			s.SessionManager.AddFlashMessage(w, r, "danger", "Failed to update profile fields")
+		} else {
+			s.SessionManager.AddFlashMessage(w, r, "success", "Profile fields updated successfully")
+		}
+
+	case "update_preferences":
+		err := s.setUserPreferences(r, map[string]string{
+			db.UserPrefColorScheme:    r.FormValue("color_scheme"),
+			db.UserPrefEditorFontSize: r.FormValue("editor_font_size"),
+			db.UserPrefLandingPage:    r.FormValue("landing_page"),
+			db.UserPrefPageSize:       r.FormValue("page_size"),
+		})
+		if errors.Is(err, errInvalidPreference) {
+			s.SessionManager.AddFlashMessage(w, r, "danger", capitalizeError(err))
+		} else if err != nil {
+			s.SessionManager.AddFlashMessage(w, r, "danger", "Failed to update preferences")
+		} else {
+			s.SessionManager.AddFlashMessage(w, r, "success", "Preferences updated successfully")
+		}
+
+	case "update_notifications":
+		value := "off"
+		if r.FormValue("email_notifications") != "" {
+			value = ""
+		}
+		if err := s.Users.SetUserPreference(r.Context(), user.ID, db.UserPrefEmailNotifications, value); err != nil {
+			s.SessionManager.AddFlashMessage(w, r, "danger", "Failed to update notifications")
+		} else {
+			s.SessionManager.AddFlashMessage(w, r, "success", "Notifications updated successfully")
+		}
+
 	case "change_password":
 		currentPassword := r.FormValue("current_password")
 		newPassword := r.FormValue("new_password")
@@ -227,8 +296,8 @@ func (s *Server) handleSettingsPost(w http.ResponseWriter, r *http.Request) {
 		}
 
 		// Check password length
-		if len(newPassword) < 8 {
-			s.SessionManager.AddFlashMessage(w, r, "danger", "Password must be at least 8 characters")
+		if err := auth.ValidatePassword(newPassword); err != nil {
+			s.SessionManager.AddFlashMessage(w, r, "danger", capitalizeError(err))
 			http.Redirect(w, r, "/-/settings", http.StatusFound)
 			return
 		}
@@ -237,9 +306,100 @@ func (s *Server) handleSettingsPost(w http.ResponseWriter, r *http.Request) {
 		if err := s.Auth.UpdatePassword(r.Context(), user.ID, newPassword); err != nil {
 			s.SessionManager.AddFlashMessage(w, r, "danger", "Failed to update password")
 		} else {
+			s.endSessionsOnPasswordChange(r, user.ID)
 			s.SessionManager.AddFlashMessage(w, r, "success", "Password updated successfully")
 		}
 	}
 
 	http.Redirect(w, r, "/-/settings", http.StatusFound)
 }
+
+// capitalizeError turns a validation error into a sentence for
+// display.
+func capitalizeError(err error) string {
+	msg := err.Error()
+	return strings.ToUpper(msg[:1]) + msg[1:]
+}
+
+// createPasswordReset issues a single-use password reset link for userID.
+// No email is sent: the link is returned for an administrator to pass on.
+func (s *Server) createPasswordReset(ctx context.Context, userID int64) (string, time.Time, error) {
+	token, err := auth.GenerateToken()
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	expires := time.Now().Add(auth.PasswordResetTTL)
+	if err := s.Users.CreatePasswordReset(ctx, userID, auth.HashToken(token), expires); err != nil {
+		return "", time.Time{}, err
+	}
+	link := s.Settings.Get(ctx).SiteURL + "/-/reset-password?token=" + url.QueryEscape(token)
+	return link, expires, nil
+}
+
+// handleResetPassword shows the form for choosing a new password from a
+// reset link.
+func (s *Server) handleResetPassword(w http.ResponseWriter, r *http.Request) {
+	token := r.URL.Query().Get("token")
+	if _, err := s.Users.PasswordResetUser(r.Context(), auth.HashToken(token)); err != nil {
+		s.renderError(w, r, http.StatusBadRequest, "This password reset link is invalid or has expired")
+		return
+	}
+
+	data := NewGenericData("Reset Password")
+	data["token"] = token
+	s.renderTemplate(w, r, "reset_password.html", data)
+}
+
+// handleResetPasswordPost sets a new password from a reset link, using the
+// link up.
+func (s *Server) handleResetPasswordPost(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		s.renderError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	token := r.FormValue("token")
+	password := r.FormValue("password")
+	password2 := r.FormValue("password2")
+	hash := auth.HashToken(token)
+
+	if _, err := s.Users.PasswordResetUser(r.Context(), hash); err != nil {
+		s.renderError(w, r, http.StatusBadRequest, "This password reset link is invalid or has expired")
+		return
+	}
+
+	// Check the new password before using the link up, so a typo does not
+	// cost the user their link.
+	errMsg := ""
+	if password != password2 {
+		errMsg = "Passwords do not match"
+	} else if err := auth.ValidatePassword(password); err != nil {
+		errMsg = capitalizeError(err)
+	}
+	if errMsg != "" {
+		data := NewGenericData("Reset Password")
+		data["token"] = token
+		data["error"] = errMsg
+		s.renderTemplate(w, r, "reset_password.html", data)
+		return
+	}
+
+	userID, err := s.Users.ConsumePasswordReset(r.Context(), hash)
+	if err != nil {
+		s.renderError(w, r, http.StatusBadRequest, "This password reset link is invalid or has expired")
+		return
+	}
+	if err := s.Auth.UpdatePassword(r.Context(), userID, password); err != nil {
+		slog.Error("failed to reset password", "user_id", userID, "error", err)
+		s.renderError(w, r, http.StatusInternalServerError, "Failed to reset password")
+		return
+	}
+	if err := s.Users.DeletePasswordResets(r.Context(), userID); err != nil {
+		slog.Warn("failed to delete outstanding password resets", "user_id", userID, "error", err)
+	}
+	s.endSessionsOnPasswordChange(r, userID)
+
+	slog.Info("password reset", "user_id", userID)
+	s.SessionManager.AddFlashMessage(w, r, "success", "Your password has been set. You can now log in.")
+	http.Redirect(w, r, "/-/login", http.StatusFound)
+}
@@ -0,0 +1,301 @@
+package handlers
+
+import (
+	"bytes"
+	"database/sql"
+	"errors"
+	"fmt"
+	"html/template"
+	"image"
+	"image/color"
+	_ "image/gif" // Avatars may be uploaded as GIF, JPEG, or PNG
+	_ "image/jpeg"
+	"image/png"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/sa/gopherwiki/internal/db"
+	"github.com/sa/gopherwiki/internal/middleware"
+)
+
+const (
+	// maxAvatarUpload caps the size of an uploaded avatar image.
+	maxAvatarUpload = 2 << 20
+	// maxAvatarDimension caps the width and height of an uploaded avatar
+	// image, so that a small file cannot decode to a huge one.
+	maxAvatarDimension = 4096
+	// avatarStoredSize is the side of the square an uploaded avatar is
+	// cropped and scaled to before it is stored.
+	avatarStoredSize = 256
+	// Sides of the avatar thumbnails served, in pixels.
+	minAvatarSize     = 16
+	maxAvatarSize     = avatarStoredSize
+	defaultAvatarSize = 64
+	// avatarCacheLimit caps the users whose thumbnails are kept in memory.
+	avatarCacheLimit = 256
+)
+
+// errInvalidAvatar marks an upload that is not a usable image.
+var errInvalidAvatar = errors.New("the avatar must be a PNG, JPEG, or GIF image")
+
+// avatarThumbs are the thumbnails of a user's avatar as uploaded at
+// updated, by side.
+type avatarThumbs struct {
+	updated time.Time
+	sizes   map[int][]byte
+}
+
+// avatarURL returns the URL of the avatar of the user with email, size
+// pixels square.
+func avatarURL(email string, size int) string {
+	return fmt.Sprintf("/-/avatar/%s?s=%d", db.AvatarEmailHash(email), size)
+}
+
+// avatarTag returns the img element showing the avatar of the user with
+// email, size pixels square, fetching it at twice that for dense screens.
+func avatarTag(email string, size int) template.HTML {
+	return template.HTML(fmt.Sprintf(`<img class="avatar" src="%s" width="%d" height="%d" alt="" loading="lazy">`,
+		template.HTMLEscapeString(avatarURL(email, min(2*size, maxAvatarSize))), size, size))
+}
+
+// scaleAvatar crops src to the square in its middle and scales it to size
+// pixels square, averaging the pixels each output pixel covers.
+func scaleAvatar(src image.Image, size int) *image.RGBA {
+	b := src.Bounds()
+	side := min(b.Dx(), b.Dy())
+	x0 := b.Min.X + (b.Dx()-side)/2
+	y0 := b.Min.Y + (b.Dy()-side)/2
+
+	dst := image.NewRGBA(image.Rect(0, 0, size, size))
+	for y := 0; y < size; y++ {
+		sy0, sy1 := y*side/size, max((y+1)*side/size, y*side/size+1)
+		for x := 0; x < size; x++ {
+			sx0, sx1 := x*side/size, max((x+1)*side/size, x*side/size+1)
+			var r, g, bl, a, n uint64
+			for sy := sy0; sy < sy1; sy++ {
+				for sx := sx0; sx < sx1; sx++ {
+					cr, cg, cb, ca := src.At(x0+sx, y0+sy).RGBA()
+					r, g, bl, a, n = r+uint64(cr), g+uint64(cg), bl+uint64(cb), a+uint64(ca), n+1
+				}
+			}
+			dst.SetRGBA64(x, y, color.RGBA64{R: uint16(r / n), G: uint16(g / n), B: uint16(bl / n), A: uint16(a / n)})
+		}
+	}
+	return dst
+}
+
+// readAvatar decodes an uploaded avatar image and returns it cropped to a
+// square, scaled down to avatarStoredSize, as a PNG. It fails with an error
+// wrapping errInvalidAvatar for anything but a GIF, JPEG, or PNG image of
+// at most maxAvatarDimension pixels a side.
+func readAvatar(r io.Reader) ([]byte, error) {
+	data, err := io.ReadAll(io.LimitReader(r, maxAvatarUpload+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxAvatarUpload {
+		return nil, fmt.Errorf("%w of at most %d MB", errInvalidAvatar, maxAvatarUpload>>20)
+	}
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, errInvalidAvatar
+	}
+	if cfg.Width > maxAvatarDimension || cfg.Height > maxAvatarDimension {
+		return nil, fmt.Errorf("%w of at most %d pixels a side", errInvalidAvatar, maxAvatarDimension)
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, errInvalidAvatar
+	}
+	side := min(img.Bounds().Dx(), img.Bounds().Dy(), avatarStoredSize)
+	if side == 0 {
+		return nil, errInvalidAvatar
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, scaleAvatar(img, side)); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// avatarThumbnail returns the avatar a, size pixels square, as a PNG,
+// scaling the stored image the first time it is asked for.
+func (s *Server) avatarThumbnail(r *http.Request, a db.UserAvatar, size int) ([]byte, error) {
+	s.avMu.Lock()
+	thumbs := s.avCache[a.UserID]
+	if thumbs != nil && thumbs.updated.Equal(a.UpdatedAt) {
+		if thumb, ok := thumbs.sizes[size]; ok {
+			s.avMu.Unlock()
+			return thumb, nil
+		}
+	}
+	s.avMu.Unlock()
+
+	stored, err := s.Users.GetUserAvatar(r.Context(), a.UserID)
+	if err != nil {
+		return nil, err
+	}
+	img, err := png.Decode(bytes.NewReader(stored.Data))
+	if err != nil {
+		return nil, err
+	}
+	thumb := stored.Data
+	if img.Bounds().Dx() != size {
+		var buf bytes.Buffer
+		if err := png.Encode(&buf, scaleAvatar(img, size)); err != nil {
+			return nil, err
+		}
+		thumb = buf.Bytes()
+	}
+
+	s.avMu.Lock()
+	defer s.avMu.Unlock()
+	if s.avCache == nil || len(s.avCache) >= avatarCacheLimit {
+		s.avCache = make(map[int64]*avatarThumbs)
+	}
+	thumbs = s.avCache[a.UserID]
+	if thumbs == nil || !thumbs.updated.Equal(stored.UpdatedAt) {
+		thumbs = &avatarThumbs{updated: stored.UpdatedAt, sizes: make(map[int][]byte)}
+		s.avCache[a.UserID] = thumbs
+	}
+	thumbs.sizes[size] = thumb
+	return thumb, nil
+}
+
+// forgetAvatar drops the cached thumbnails of a user's avatar.
+func (s *Server) forgetAvatar(userID int64) {
+	s.avMu.Lock()
+	delete(s.avCache, userID)
+	s.avMu.Unlock()
+}
+
+// placeholderAvatar returns the SVG shown for a user without an avatar: a
+// silhouette on a background whose hue comes from their email hash.
+func placeholderAvatar(hash string) []byte {
+	hue, _ := strconv.ParseUint(hash[:4], 16, 32)
+	return []byte(fmt.Sprintf(`<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 64 64">`+
+		`<rect width="64" height="64" fill="hsl(%d, 40%%, 55%%)"/>`+
+		`<g fill="#fff" fill-opacity="0.85"><circle cx="32" cy="25" r="12"/><path d="M10 64c0-13 10-21 22-21s22 8 22 21z"/></g>`+
+		`</svg>`, hue%360))
+}
+
+// isAvatarHash reports whether hash is a hex SHA-256, as AvatarEmailHash
+// returns.
+func isAvatarHash(hash string) bool {
+	if len(hash) != 64 {
+		return false
+	}
+	for _, c := range hash {
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+// handleAvatar serves the avatar of the user whose email has the hash,
+// s pixels square: the image they uploaded, else their Gravatar image if
+// GRAVATAR is on and the wiki is not OFFLINE, else a placeholder.
+func (s *Server) handleAvatar(w http.ResponseWriter, r *http.Request) {
+	hash := chi.URLParam(r, "hash")
+	if !isAvatarHash(hash) {
+		http.NotFound(w, r)
+		return
+	}
+	size := defaultAvatarSize
+	if v, err := strconv.Atoi(r.URL.Query().Get("s")); err == nil {
+		size = min(max(v, minAvatarSize), maxAvatarSize)
+	}
+
+	a, err := s.Users.FindUserAvatar(r.Context(), hash)
+	if errors.Is(err, sql.ErrNoRows) {
+		w.Header().Set("Cache-Control", "public, max-age=3600")
+		if s.Config.Gravatar && !s.Config.Offline {
+			http.Redirect(w, r, fmt.Sprintf("https://www.gravatar.com/avatar/%s?s=%d&d=identicon", hash, size), http.StatusFound)
+			return
+		}
+		if notModified(w, r, `"placeholder"`, time.Time{}) {
+			return
+		}
+		w.Header().Set("Content-Type", "image/svg+xml")
+		w.Write(placeholderAvatar(hash))
+		return
+	} else if err != nil {
+		slog.Error("failed to find avatar", "error", err)
+		http.Error(w, "Failed to load avatar", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	if notModified(w, r, fmt.Sprintf(`"%d-%d-%d"`, a.UserID, a.UpdatedAt.Unix(), size), a.UpdatedAt) {
+		return
+	}
+	thumb, err := s.avatarThumbnail(r, a, size)
+	if err != nil {
+		slog.Error("failed to scale avatar", "user", a.UserID, "error", err)
+		http.Error(w, "Failed to load avatar", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "image/png")
+	w.Write(thumb)
+}
+
+// handleAvatarUpload stores the avatar image the user of r uploaded.
+func (s *Server) handleAvatarUpload(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetUser(r)
+	if !user.IsAuthenticated() {
+		http.Redirect(w, r, "/-/login?next=/-/settings", http.StatusFound)
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, maxAvatarUpload+1<<20)
+	if err := r.ParseMultipartForm(maxAvatarUpload); err != nil {
+		s.SessionManager.AddFlashMessage(w, r, "danger", fmt.Sprintf("The avatar must be at most %d MB", maxAvatarUpload>>20))
+		http.Redirect(w, r, "/-/settings", http.StatusFound)
+		return
+	}
+	file, _, err := r.FormFile("avatar")
+	if err != nil {
+		s.SessionManager.AddFlashMessage(w, r, "danger", "Choose an image to upload")
+		http.Redirect(w, r, "/-/settings", http.StatusFound)
+		return
+	}
+	defer file.Close()
+
+	data, err := readAvatar(file)
+	switch {
+	case errors.Is(err, errInvalidAvatar):
+		s.SessionManager.AddFlashMessage(w, r, "danger", capitalizeError(err))
+	case err != nil:
+		slog.Error("failed to read avatar", "error", err)
+		s.SessionManager.AddFlashMessage(w, r, "danger", "Failed to read the avatar")
+	default:
+		if err := s.Users.SetUserAvatar(r.Context(), user.ID, data, time.Now()); err != nil {
+			s.SessionManager.AddFlashMessage(w, r, "danger", "Failed to save the avatar")
+		} else {
+			s.forgetAvatar(user.ID)
+			s.SessionManager.AddFlashMessage(w, r, "success", "Avatar updated successfully")
+		}
+	}
+	http.Redirect(w, r, "/-/settings", http.StatusFound)
+}
+
+// handleAvatarDelete removes the avatar the user of r uploaded.
+func (s *Server) handleAvatarDelete(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetUser(r)
+	if !user.IsAuthenticated() {
+		http.Redirect(w, r, "/-/login?next=/-/settings", http.StatusFound)
+		return
+	}
+	if err := s.Users.DeleteUserAvatar(r.Context(), user.ID); err != nil {
+		s.SessionManager.AddFlashMessage(w, r, "danger", "Failed to remove the avatar")
+	} else {
+		s.forgetAvatar(user.ID)
+		s.SessionManager.AddFlashMessage(w, r, "success", "Avatar removed")
+	}
+	http.Redirect(w, r, "/-/settings", http.StatusFound)
+}
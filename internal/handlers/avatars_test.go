@@ -0,0 +1,124 @@
+package handlers_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/sa/gopherwiki/internal/db"
+	"github.com/sa/gopherwiki/internal/testutil"
+)
+
+// uploadAvatar posts content as the avatar of the user with cookies.
+func uploadAvatar(t *testing.T, env *testutil.TestEnv, content []byte, cookies []*http.Cookie) *httptest.ResponseRecorder {
+	t.Helper()
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	fw, err := mw.CreateFormFile("avatar", "avatar.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fw.Write(content)
+	mw.Close()
+	req := requestWithCookies("POST", "/-/settings/avatar", strings.NewReader(body.String()), cookies)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	w := httptest.NewRecorder()
+	env.Router.ServeHTTP(w, req)
+	return w
+}
+
+func TestAvatars(t *testing.T) {
+	env := testutil.SetupTestEnv(t)
+	bob := loginAsUser(t, env, "bob@example.com")
+	hash := db.AvatarEmailHash("Bob@Example.com ")
+
+	get := func(path string, header http.Header) *httptest.ResponseRecorder {
+		req := requestWithCookies("GET", path, nil, nil)
+		for k, v := range header {
+			req.Header[k] = v
+		}
+		w := httptest.NewRecorder()
+		env.Router.ServeHTTP(w, req)
+		return w
+	}
+
+	// Without an upload, a placeholder is served, or the Gravatar image.
+	if w := get("/-/avatar/"+hash, nil); w.Code != http.StatusOK || w.Header().Get("Content-Type") != "image/svg+xml" {
+		t.Errorf("placeholder: status = %d, Content-Type = %q", w.Code, w.Header().Get("Content-Type"))
+	}
+	env.Server.Config.Gravatar = true
+	if w := get("/-/avatar/"+hash+"?s=40", nil); w.Code != http.StatusFound || w.Header().Get("Location") != "https://www.gravatar.com/avatar/"+hash+"?s=40&d=identicon" {
+		t.Errorf("Gravatar: status = %d, Location = %q", w.Code, w.Header().Get("Location"))
+	}
+	if w := get("/-/avatar/bob@example.com", nil); w.Code != http.StatusNotFound {
+		t.Errorf("avatar by address: status = %d, want %d", w.Code, http.StatusNotFound)
+	}
+
+	// Anything but an image is refused.
+	if w := uploadAvatar(t, env, []byte("not an image"), bob); w.Code != http.StatusFound {
+		t.Fatalf("upload: status = %d", w.Code)
+	}
+	if _, err := env.DB.FindUserAvatar(context.Background(), hash); err == nil {
+		t.Errorf("a text file was stored as an avatar")
+	}
+
+	img := image.NewRGBA(image.Rect(0, 0, 300, 200))
+	for y := 0; y < 200; y++ {
+		for x := 0; x < 300; x++ {
+			img.Set(x, y, color.RGBA{R: 200, A: 255})
+		}
+	}
+	var buf bytes.Buffer
+	png.Encode(&buf, img)
+	if w := uploadAvatar(t, env, buf.Bytes(), bob); w.Code != http.StatusFound {
+		t.Fatalf("upload: status = %d", w.Code)
+	}
+
+	w := get("/-/avatar/"+hash+"?s=32", nil)
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "image/png" {
+		t.Fatalf("avatar: status = %d, Content-Type = %q", w.Code, w.Header().Get("Content-Type"))
+	}
+	thumb, err := png.Decode(w.Body)
+	if err != nil || thumb.Bounds().Dx() != 32 || thumb.Bounds().Dy() != 32 {
+		t.Fatalf("thumbnail = %v, %v; want 32 pixels square", thumb.Bounds(), err)
+	}
+	if r, g, _, _ := thumb.At(16, 16).RGBA(); r>>8 != 200 || g != 0 {
+		t.Errorf("thumbnail color = %v", thumb.At(16, 16))
+	}
+	if w := get("/-/avatar/"+hash+"?s=32", http.Header{"If-None-Match": {w.Header().Get("ETag")}}); w.Code != http.StatusNotModified {
+		t.Errorf("revalidation: status = %d, want %d", w.Code, http.StatusNotModified)
+	}
+	if w := get("/-/avatar/"+hash+"?s=5000", nil); w.Code != http.StatusOK {
+		t.Errorf("oversized thumbnail: status = %d", w.Code)
+	} else if thumb, _ := png.Decode(w.Body); thumb == nil || thumb.Bounds().Dx() != 256 {
+		t.Errorf("oversized thumbnail is not capped at 256 pixels")
+	}
+
+	// Avatars are shown beside comments and in the admin user list.
+	id := createAPITestIssue(t, env, "Issue", "", "open", "", nil)
+	createTestComment(t, env, id, "Looks good.", "Bob", "bob@example.com")
+	src := fmt.Sprintf(`src="/-/avatar/%s?s=40"`, hash)
+	if body := get(fmt.Sprintf("/-/issues/%d", id), nil).Body.String(); !strings.Contains(body, src) {
+		t.Errorf("comment lacks the author's avatar")
+	}
+	w = httptest.NewRecorder()
+	env.Router.ServeHTTP(w, requestWithCookies("GET", "/-/admin/users", nil, loginAsAdmin(t, env)))
+	if !strings.Contains(w.Body.String(), fmt.Sprintf(`src="/-/avatar/%s?s=48"`, hash)) {
+		t.Errorf("admin user list lacks the avatar")
+	}
+
+	// Removing the avatar falls back again.
+	req := requestWithCookies("POST", "/-/settings/avatar/delete", nil, bob)
+	env.Router.ServeHTTP(httptest.NewRecorder(), req)
+	if w := get("/-/avatar/"+hash, nil); w.Code != http.StatusFound {
+		t.Errorf("after removal: status = %d, want the Gravatar redirect", w.Code)
+	}
+}
@@ -0,0 +1,201 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/sa/gopherwiki/internal/middleware"
+	"github.com/sa/gopherwiki/internal/util"
+)
+
+// APIBookmark is a page the user pinned. Exists is false for a page
+// deleted since.
+type APIBookmark struct {
+	Path      string `json:"path"`
+	Title     string `json:"title"`
+	URL       string `json:"url"`
+	Exists    bool   `json:"exists"`
+	CreatedAt string `json:"created_at"`
+}
+
+// bookmarkView is a page the user pinned, as the bookmarks page lists it.
+type bookmarkView struct {
+	Path      string
+	Title     string
+	URL       string
+	Exists    bool
+	CreatedAt time.Time
+}
+
+func (b bookmarkView) toAPI() APIBookmark {
+	return APIBookmark{Path: b.Path, Title: b.Title, URL: b.URL, Exists: b.Exists, CreatedAt: b.CreatedAt.Format(time.RFC3339)}
+}
+
+// bookmarks returns the pages the logged-in user pinned, sorted by path.
+func (s *Server) bookmarks(r *http.Request) ([]bookmarkView, error) {
+	pinned, err := s.DB.ListBookmarks(r.Context(), middleware.GetUser(r).ID)
+	if err != nil {
+		return nil, err
+	}
+	pages, err := s.Wiki.PageMetadata(r.Context())
+	if err != nil {
+		return nil, err
+	}
+	titles := make(map[string]string, len(pages))
+	for _, m := range pages {
+		titles[m.Pagepath] = m.Title
+	}
+
+	bookmarks := make([]bookmarkView, 0, len(pinned))
+	for _, b := range pinned {
+		title, exists := titles[b.Pagepath]
+		if title == "" {
+			title = util.GetPagename(b.Pagepath, false)
+		}
+		bookmarks = append(bookmarks, bookmarkView{
+			Path:      b.Pagepath,
+			Title:     title,
+			URL:       "/" + util.URLQuote(b.Pagepath),
+			Exists:    exists,
+			CreatedAt: b.CreatedAt,
+		})
+	}
+	return bookmarks, nil
+}
+
+// setBookmark pins the page at pagepath for the logged-in user, or unpins
+// it.
+func (s *Server) setBookmark(r *http.Request, pagepath string, bookmarked bool) error {
+	userID := middleware.GetUser(r).ID
+	if bookmarked {
+		return s.DB.AddBookmark(r.Context(), userID, pagepath, time.Now())
+	}
+	return s.DB.DeleteBookmark(r.Context(), userID, pagepath)
+}
+
+// isBookmarked reports whether the logged-in user pinned the page at
+// pagepath.
+func (s *Server) isBookmarked(r *http.Request, pagepath string) bool {
+	user := middleware.GetUser(r)
+	if !user.IsAuthenticated() {
+		return false
+	}
+	ok, _ := s.DB.IsBookmarked(r.Context(), user.ID, pagepath)
+	return ok
+}
+
+// bookmarkETagSuffix returns an ETag suffix for whether the page view's
+// star is lit.
+func bookmarkETagSuffix(bookmarked bool) string {
+	if !bookmarked {
+		return ""
+	}
+	return "-bookmarked"
+}
+
+// handleBookmarks lists the pages the logged-in user pinned.
+func (s *Server) handleBookmarks(w http.ResponseWriter, r *http.Request) {
+	if !middleware.GetUser(r).IsAuthenticated() {
+		http.Redirect(w, r, "/-/login?next=/-/bookmarks", http.StatusFound)
+		return
+	}
+	bookmarks, err := s.bookmarks(r)
+	if err != nil {
+		s.renderError(w, r, http.StatusInternalServerError, "Failed to list bookmarks")
+		return
+	}
+	data := NewGenericData("Bookmarks")
+	data["bookmarks"] = bookmarks
+	s.renderTemplate(w, r, "bookmarks.html", data)
+}
+
+// handleBookmark pins a page for the logged-in user when the bookmarked
+// field is true, or unpins it. Its partial route answers the star button
+// for htmx to swap in; otherwise it goes back to next, or the page.
+func (s *Server) handleBookmark(w http.ResponseWriter, r *http.Request) {
+	pagepath := chi.URLParam(r, "path")
+	if !middleware.GetUser(r).IsAuthenticated() {
+		http.Redirect(w, r, "/-/login?next=/"+util.URLQuote(pagepath), http.StatusFound)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		s.renderError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+	bookmarked := r.PostForm.Get("bookmarked") == "true"
+	if bookmarked {
+		if m, err := s.Wiki.PageMeta(r.Context(), pagepath); err != nil || m == nil {
+			s.renderError(w, r, http.StatusNotFound, "Page not found")
+			return
+		}
+	}
+	if err := s.setBookmark(r, pagepath, bookmarked); err != nil {
+		s.renderError(w, r, http.StatusInternalServerError, "Failed to save bookmark")
+		return
+	}
+
+	if partialBlock(r) != "" {
+		data := NewGenericData("")
+		data["pagepath"] = pagepath
+		data["bookmarked"] = bookmarked
+		s.renderTemplate(w, r, "page.html", data)
+		return
+	}
+	next := "/" + util.URLQuote(pagepath)
+	if n := r.PostForm.Get("next"); n != "" {
+		next = safeRedirectPath(n)
+	}
+	http.Redirect(w, r, next, http.StatusFound)
+}
+
+// handleAPIBookmarks handles GET /api/v1/bookmarks -- the pages the
+// logged-in user pinned, sorted by path.
+func (s *Server) handleAPIBookmarks(w http.ResponseWriter, r *http.Request) {
+	if !middleware.GetUser(r).IsAuthenticated() {
+		writeJSONError(w, http.StatusUnauthorized, "not logged in")
+		return
+	}
+	bookmarks, err := s.bookmarks(r)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, "failed to list bookmarks")
+		return
+	}
+	result := make([]APIBookmark, len(bookmarks))
+	for i, b := range bookmarks {
+		result[i] = b.toAPI()
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+// handleAPIBookmark handles PUT and DELETE /api/v1/bookmarks/{path} -- pin
+// a page for the logged-in user, or unpin it. Both answer the user's
+// bookmarks.
+func (s *Server) handleAPIBookmark(w http.ResponseWriter, r *http.Request) {
+	if !middleware.GetUser(r).IsAuthenticated() {
+		writeJSONError(w, http.StatusUnauthorized, "not logged in")
+		return
+	}
+	pagepath := strings.Trim(chi.URLParam(r, "*"), "/")
+	if pagepath == "" {
+		writeJSONError(w, http.StatusBadRequest, "page path required")
+		return
+	}
+	bookmarked := r.Method == http.MethodPut
+	if bookmarked {
+		if m, err := s.Wiki.PageMeta(r.Context(), pagepath); err != nil {
+			writeJSONError(w, http.StatusInternalServerError, "failed to load page")
+			return
+		} else if m == nil {
+			writeJSONError(w, http.StatusNotFound, "page not found")
+			return
+		}
+	}
+	if err := s.setBookmark(r, pagepath, bookmarked); err != nil {
+		writeJSONError(w, http.StatusInternalServerError, "failed to save bookmark")
+		return
+	}
+	s.handleAPIBookmarks(w, r)
+}
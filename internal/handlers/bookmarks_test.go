@@ -0,0 +1,102 @@
+package handlers_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/sa/gopherwiki/internal/handlers"
+	"github.com/sa/gopherwiki/internal/storage"
+	"github.com/sa/gopherwiki/internal/testutil"
+)
+
+func TestBookmarks(t *testing.T) {
+	env := testutil.SetupTestEnv(t)
+	author := storage.Author{Name: "Alice", Email: "alice@example.com"}
+	for name, content := range map[string]string{
+		"guide.md":    "# User Guide\n",
+		"meetings.md": "# Meetings\n",
+	} {
+		if _, err := env.Store.Store(context.Background(), name, content, "Add "+name, author); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cookies := loginAsUser(t, env, "bob@example.com")
+	post := func(path string, form url.Values) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest("POST", path, strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		for _, c := range cookies {
+			req.AddCookie(c)
+		}
+		w := httptest.NewRecorder()
+		env.Router.ServeHTTP(w, req)
+		return w
+	}
+	list := func() []handlers.APIBookmark {
+		t.Helper()
+		w := apiGet(t, env, "/-/api/v1/bookmarks", cookies)
+		if w.Code != http.StatusOK {
+			t.Fatalf("bookmarks: status = %d: %s", w.Code, w.Body.String())
+		}
+		var resp struct {
+			Data []handlers.APIBookmark `json:"data"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatal(err)
+		}
+		return resp.Data
+	}
+
+	// The star of a page not pinned offers to pin it.
+	etag := apiGet(t, env, "/guide", cookies).Header().Get("ETag")
+	if body := apiGet(t, env, "/guide", cookies).Body.String(); !strings.Contains(body, `title="Bookmark this page"`) {
+		t.Fatalf("page lacks the bookmark button:\n%s", body)
+	}
+
+	// Its partial route pins it and answers the lit star.
+	w := post("/guide/bookmark/partial", url.Values{"bookmarked": {"true"}})
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `title="Remove bookmark"`) ||
+		strings.Contains(w.Body.String(), "<html") {
+		t.Fatalf("bookmark partial: status = %d\n%s", w.Code, w.Body.String())
+	}
+	if again := apiGet(t, env, "/guide", cookies).Header().Get("ETag"); again == etag {
+		t.Error("ETag unchanged after bookmarking")
+	}
+
+	// Without htmx, the form goes back to the page.
+	w = post("/meetings/bookmark", url.Values{"bookmarked": {"true"}})
+	if w.Code != http.StatusFound || w.Header().Get("Location") != "/meetings" {
+		t.Errorf("bookmark: status = %d, Location = %q", w.Code, w.Header().Get("Location"))
+	}
+	if got := list(); len(got) != 2 || got[0].Path != "guide" || got[0].Title != "User Guide" || !got[0].Exists ||
+		got[1].Path != "meetings" {
+		t.Errorf("bookmarks = %+v", got)
+	}
+	if body := apiGet(t, env, "/-/bookmarks", cookies).Body.String(); !strings.Contains(body, `<a href="/meetings">Meetings</a>`) {
+		t.Errorf("bookmarks page lacks a bookmark:\n%s", body)
+	}
+
+	// The API pins and unpins pages too, but only those that exist.
+	if w := apiRequest(t, env, "DELETE", "/-/api/v1/bookmarks/guide", "", cookies); w.Code != http.StatusOK {
+		t.Errorf("DELETE bookmark: status = %d", w.Code)
+	}
+	if w := apiRequest(t, env, "PUT", "/-/api/v1/bookmarks/missing", "", cookies); w.Code != http.StatusNotFound {
+		t.Errorf("PUT bookmark of a missing page: status = %d, want %d", w.Code, http.StatusNotFound)
+	}
+	if got := list(); len(got) != 1 || got[0].Path != "meetings" {
+		t.Errorf("bookmarks after the API = %+v", got)
+	}
+
+	// Anonymous visitors have no bookmarks.
+	if w := apiGet(t, env, "/-/api/v1/bookmarks", nil); w.Code != http.StatusUnauthorized {
+		t.Errorf("anonymous bookmarks: status = %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+	if body := apiGet(t, env, "/guide", nil).Body.String(); strings.Contains(body, "bookmark-btn") {
+		t.Error("anonymous page view offers a bookmark")
+	}
+}
@@ -0,0 +1,36 @@
+package handlers
+
+import (
+	"context"
+
+	"github.com/sa/gopherwiki/internal/cluster"
+)
+
+// JoinCluster makes the server drop its caches of shared state when another
+// node of n changes it, and tell the others when it changes it itself. A
+// server replacing this one on a reload joins in its place after LeaveCluster.
+func (s *Server) JoinCluster(n *cluster.Node) {
+	s.Cluster = n
+	s.clusterStops = append(s.clusterStops,
+		n.Watch(cluster.TopicRepository, s.Wiki.InvalidatePageTreeCache),
+		n.Watch(cluster.TopicSettings, func() {
+			s.Settings.Invalidate()
+			s.InvalidateSiteSettingsCache()
+		}),
+	)
+}
+
+// LeaveCluster stops the watches JoinCluster started.
+func (s *Server) LeaveCluster() {
+	for _, stop := range s.clusterStops {
+		stop()
+	}
+	s.clusterStops = nil
+}
+
+// publish tells the other nodes that topic changed, if there are any.
+func (s *Server) publish(ctx context.Context, topic string) {
+	if s.Cluster != nil {
+		s.Cluster.Publish(ctx, topic)
+	}
+}
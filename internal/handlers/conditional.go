@@ -0,0 +1,151 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// notModified sets the ETag and Last-Modified validators (each only when
+// non-empty) and reports whether the request's conditional headers show the
+// client's cached copy is still current, in which case a 304 has been written
+// and the caller must not write a body.
+//
+// If-None-Match takes precedence over If-Modified-Since, as in RFC 9110
+// section 13.2.2: a client that sent an unmatched ETag gets a full response
+// even if the timestamp would have matched.
+func notModified(w http.ResponseWriter, r *http.Request, etag string, modified time.Time) bool {
+	if etag != "" {
+		w.Header().Set("ETag", etag)
+	}
+	if !modified.IsZero() {
+		w.Header().Set("Last-Modified", modified.UTC().Format(http.TimeFormat))
+	}
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return false
+	}
+
+	if match := r.Header.Get("If-None-Match"); match != "" {
+		if etag != "" && etagMatches(match, etag) {
+			w.WriteHeader(http.StatusNotModified)
+			return true
+		}
+		return false
+	}
+	if modified.IsZero() {
+		return false
+	}
+	if since, err := http.ParseTime(r.Header.Get("If-Modified-Since")); err == nil {
+		// HTTP dates have one-second resolution.
+		if !modified.Truncate(time.Second).After(since) {
+			w.WriteHeader(http.StatusNotModified)
+			return true
+		}
+	}
+	return false
+}
+
+// etagMatches reports whether an If-None-Match header value matches etag,
+// using the weak comparison the header calls for. The header may be "*" or a
+// comma-separated list of entity tags.
+func etagMatches(header, etag string) bool {
+	etag = strings.TrimPrefix(etag, "W/")
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// preconditionFailed reports whether the request's If-Match header rules
+// out a write to a resource whose current ETag is etag, "" when it does not
+// exist: the header names none of its tags, compared strongly as RFC 9110
+// section 13.1.1 requires, or is "*" and there is nothing to match. A
+// request without the header is unconditional.
+func preconditionFailed(r *http.Request, etag string) bool {
+	header := r.Header.Get("If-Match")
+	if header == "" {
+		return false
+	}
+	if etag == "" {
+		return true
+	}
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || candidate == etag {
+			return false
+		}
+	}
+	return true
+}
+
+// contentETag returns a strong ETag derived from a response body.
+func contentETag(body []byte) string {
+	sum := sha256.Sum256(body)
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// conditionalGET gives every successful GET response a validator. Handlers
+// that know their own version (a git revision, a cache key) set an ETag via
+// notModified before writing and are streamed through untouched; any other
+// 200 response is buffered, tagged with a hash of its body, and answered with
+// a 304 when the client already holds that body.
+func conditionalGET(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		bw := &bufferedResponse{ResponseWriter: w}
+		next.ServeHTTP(bw, r)
+		if bw.status == 0 || bw.passthrough {
+			return
+		}
+
+		modified, _ := http.ParseTime(w.Header().Get("Last-Modified"))
+		if notModified(w, r, contentETag(bw.buf.Bytes()), modified) {
+			return
+		}
+		w.WriteHeader(bw.status)
+		w.Write(bw.buf.Bytes())
+	})
+}
+
+// bufferedResponse holds back a 200 response without an ETag so that
+// conditionalGET can tag it. Every other response, and any marked no-store
+// (nothing to revalidate, and possibly too large to hold in memory), is
+// passed straight through.
+type bufferedResponse struct {
+	http.ResponseWriter
+	status      int
+	passthrough bool
+	buf         bytes.Buffer
+}
+
+func (b *bufferedResponse) WriteHeader(code int) {
+	if b.status != 0 {
+		return
+	}
+	b.status = code
+	if code != http.StatusOK || b.Header().Get("ETag") != "" ||
+		strings.Contains(b.Header().Get("Cache-Control"), "no-store") {
+		b.passthrough = true
+		b.ResponseWriter.WriteHeader(code)
+	}
+}
+
+func (b *bufferedResponse) Write(p []byte) (int, error) {
+	if b.status == 0 {
+		b.WriteHeader(http.StatusOK)
+	}
+	if b.passthrough {
+		return b.ResponseWriter.Write(p)
+	}
+	return b.buf.Write(p)
+}
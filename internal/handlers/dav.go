@@ -0,0 +1,175 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"golang.org/x/net/webdav"
+
+	"github.com/sa/gopherwiki/internal/dav"
+	"github.com/sa/gopherwiki/internal/middleware"
+	"github.com/sa/gopherwiki/internal/models"
+	"github.com/sa/gopherwiki/internal/spam"
+	"github.com/sa/gopherwiki/internal/util"
+	"github.com/sa/gopherwiki/internal/wiki"
+)
+
+// davPrefix is where the repository is mounted over WebDAV.
+const davPrefix = "/-/dav"
+
+func init() {
+	// chi only routes the methods it knows.
+	for _, method := range []string{"PROPFIND", "PROPPATCH", "MKCOL", "COPY", "MOVE", "LOCK", "UNLOCK"} {
+		chi.RegisterMethod(method)
+	}
+}
+
+// davMaxHeldPage is the largest page a WebDAV PUT may write when it is
+// screened for moderation, which reads it whole.
+const davMaxHeldPage = 1 << 20
+
+// davReadMethods are the WebDAV methods that only read.
+var davReadMethods = map[string]bool{
+	http.MethodGet:     true,
+	http.MethodHead:    true,
+	http.MethodOptions: true,
+	"PROPFIND":         true,
+}
+
+// davHandler returns the WebDAV handler for the repository. Locks are held
+// in memory, which is all that clients such as Finder and Office need to
+// save.
+func (s *Server) davHandler() http.Handler {
+	h := &webdav.Handler{
+		Prefix:     davPrefix,
+		FileSystem: dav.New(s.Storage, s.Wiki),
+		LockSystem: webdav.NewMemLS(),
+		Logger: func(r *http.Request, err error) {
+			if err != nil {
+				slog.Debug("webdav request failed", "method", r.Method, "path", r.URL.Path, "error", err)
+			}
+		},
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.handleDAV(w, r, h)
+	})
+}
+
+// handleDAV authenticates a WebDAV request and checks its permission before
+// passing it to h. WebDAV clients authenticate with HTTP Basic credentials,
+// the user's email and password; the session cookie is not used, so a page
+// in another site cannot make the browser change the wiki. Without
+// credentials the request is anonymous. Reading needs read access, any other
+// method write access, and writing a file that is not a page also upload
+// access. Commits are attributed like edits made in the browser.
+func (s *Server) handleDAV(w http.ResponseWriter, r *http.Request, h http.Handler) {
+	if r.Method == http.MethodPost {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	user := models.AnonymousUser()
+	if email, password, ok := r.BasicAuth(); ok {
+		authed, err := s.Auth.Authenticate(r.Context(), email, password)
+		if err != nil {
+			s.davUnauthorized(w, r)
+			return
+		}
+		user = authed
+	}
+	r = r.WithContext(context.WithValue(r.Context(), middleware.UserKey, user))
+
+	permissions := []string{middleware.PermissionRead}
+	if !davReadMethods[r.Method] {
+		permissions = []string{middleware.PermissionWrite}
+		if r.Method == http.MethodPut && !util.IsMarkdownFile(r.URL.Path) {
+			permissions = append(permissions, middleware.PermissionUpload)
+		}
+	}
+	for _, permission := range permissions {
+		if !s.PermissionChecker.HasPermission(r, permission) {
+			if user.IsAnonymous() {
+				s.davUnauthorized(w, r)
+			} else {
+				http.Error(w, "Forbidden", http.StatusForbidden)
+			}
+			return
+		}
+	}
+
+	if !davReadMethods[r.Method] && !s.davModerate(w, r, user) {
+		return
+	}
+
+	h.ServeHTTP(w, r.WithContext(dav.WithAuthor(r.Context(), s.getAuthor(r))))
+}
+
+// davModerate screens a WebDAV change as the moderation queue screens edits
+// made in the browser, reporting whether to go on with it. A page written
+// with PUT is held like a save when REVIEW_EDITS proposes the user's saves
+// for review or the spam checks flag an anonymous one, and answered with
+// 202 Accepted. Other changes, which cannot be proposed for review, are
+// refused with 403 for such users; locking is left to them, for clients to
+// save with.
+func (s *Server) davModerate(w http.ResponseWriter, r *http.Request, user *models.User) bool {
+	isPage := r.Method == http.MethodPut && util.IsMarkdownFile(r.URL.Path)
+	if !isPage {
+		if r.Method != "LOCK" && r.Method != "UNLOCK" && s.needsReview(user) {
+			http.Error(w, unreviewableMessage, http.StatusForbidden)
+			return false
+		}
+		return true
+	}
+	if !s.needsReview(user) && !user.IsAnonymous() {
+		return true
+	}
+
+	content, err := io.ReadAll(http.MaxBytesReader(w, r.Body, davMaxHeldPage))
+	if err != nil {
+		http.Error(w, "Request Entity Too Large", http.StatusRequestEntityTooLarge)
+		return false
+	}
+	r.Body = io.NopCloser(bytes.NewReader(content))
+
+	pagepath := util.StripMarkdownExtension(strings.Trim(strings.TrimPrefix(r.URL.Path, davPrefix), "/"))
+	current := ""
+	if page, err := wiki.NewPage(r.Context(), s.Storage, s.Config, pagepath, ""); err == nil && page.Exists && page.Metadata != nil {
+		current = page.Metadata.Revision
+	}
+	sub := spam.Submission{Kind: spam.KindPage, Target: pagepath, Content: string(content)}
+	if _, held, err := s.holdForModeration(r, sub, moderationPayload{Message: "Updated " + pagepath + " via WebDAV", Revision: current}); err != nil {
+		slog.Error("failed to screen a WebDAV write", "path", pagepath, "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return false
+	} else if held {
+		http.Error(w, "Awaiting moderation", http.StatusAccepted)
+		return false
+	}
+	return true
+}
+
+// davUnauthorized asks the client for credentials.
+func (s *Server) davUnauthorized(w http.ResponseWriter, r *http.Request) {
+	realm := strings.ReplaceAll(s.getSiteSettings(r.Context()).Name, `"`, "")
+	w.Header().Set("WWW-Authenticate", `Basic realm="`+realm+`", charset="UTF-8"`)
+	http.Error(w, "Unauthorized", http.StatusUnauthorized)
+}
+
+// exceptDAV applies mw to every request but those below the WebDAV mount.
+func exceptDAV(mw func(http.Handler) http.Handler) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		protected := mw(next)
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if p := r.URL.Path; p == davPrefix || strings.HasPrefix(p, davPrefix+"/") {
+				next.ServeHTTP(w, r)
+				return
+			}
+			protected.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,114 @@
+package handlers_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/sa/gopherwiki/internal/testutil"
+)
+
+func TestWebDAV(t *testing.T) {
+	env := testutil.SetupTestEnv(t)
+	env.Store.Store(context.Background(), "home.md", "# Home\n", "init", author)
+
+	w := httptest.NewRecorder()
+	env.Router.ServeHTTP(w, httptest.NewRequest("PROPFIND", "/-/dav/", nil))
+	if w.Code != http.StatusNotFound && w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("disabled: status = %d, want 404 or 405", w.Code)
+	}
+
+	env.Server.Config.WebDAVEnabled = true
+	env.Server.Config.WriteAccess = "REGISTERED"
+	router := env.Server.Routes()
+	user := testutil.CreateTestUser(t, env.DB, testutil.UserOpts{
+		Name: "Dav User", Email: "dav@example.com", Approved: true, AllowRead: true, AllowWrite: true, AllowUpload: true,
+	})
+	env.Server.Auth.UpdatePassword(context.Background(), user.ID, "davpassword123")
+
+	do := func(method, path, body string, headers map[string]string, authed bool) *httptest.ResponseRecorder {
+		t.Helper()
+		var r io.Reader
+		if body != "" {
+			r = strings.NewReader(body)
+		}
+		req := httptest.NewRequest(method, path, r)
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		if authed {
+			req.SetBasicAuth("dav@example.com", "davpassword123")
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	// Anonymous users can read, but writing needs an account.
+	w = do("PROPFIND", "/-/dav/", "", map[string]string{"Depth": "1"}, false)
+	if w.Code != http.StatusMultiStatus {
+		t.Fatalf("PROPFIND status = %d, want %d", w.Code, http.StatusMultiStatus)
+	}
+	if body := w.Body.String(); !strings.Contains(body, "/-/dav/home.md") || strings.Contains(body, ".git") {
+		t.Errorf("PROPFIND listing should show home.md and hide .git:\n%s", body)
+	}
+	if w := do("PUT", "/-/dav/new.md", "# New\n", nil, false); w.Code != http.StatusUnauthorized || w.Header().Get("WWW-Authenticate") == "" {
+		t.Errorf("anonymous PUT: status = %d, want a %d challenge", w.Code, http.StatusUnauthorized)
+	}
+	req := httptest.NewRequest("PUT", "/-/dav/new.md", strings.NewReader("x"))
+	req.SetBasicAuth("dav@example.com", "wrong")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("wrong password: status = %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+
+	// Writes are commits by the authenticated user, and pages are indexed.
+	if w := do("PUT", "/-/dav/notes.md", "# Notes\n\nWebDAV zebra.\n", nil, true); w.Code != http.StatusCreated {
+		t.Fatalf("PUT status = %d, want %d; body = %s", w.Code, http.StatusCreated, w.Body.String())
+	}
+	meta, err := env.Store.Metadata(context.Background(), "notes.md", "")
+	if err != nil {
+		t.Fatalf("notes.md not committed: %v", err)
+	}
+	if meta.AuthorName != "Dav User" || meta.Message != "Created notes.md via WebDAV" {
+		t.Errorf("commit = %q by %q", meta.Message, meta.AuthorName)
+	}
+	results, err := env.Server.Wiki.Search(context.Background(), "zebra")
+	if err != nil || len(results) == 0 {
+		t.Errorf("written page should be indexed: %v, %v", results, err)
+	}
+	if w := do("GET", "/-/dav/notes.md", "", nil, false); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "WebDAV zebra") {
+		t.Errorf("GET status = %d, body = %q", w.Code, w.Body.String())
+	}
+
+	if w := do("MKCOL", "/-/dav/docs", "", nil, true); w.Code != http.StatusCreated {
+		t.Errorf("MKCOL status = %d, want %d", w.Code, http.StatusCreated)
+	}
+	if w := do("MOVE", "/-/dav/notes.md", "", map[string]string{"Destination": "http://example.com/-/dav/docs/notes.md"}, true); w.Code != http.StatusCreated {
+		t.Fatalf("MOVE status = %d, want %d; body = %s", w.Code, http.StatusCreated, w.Body.String())
+	}
+	if env.Store.Exists(context.Background(), "notes.md") || !env.Store.Exists(context.Background(), "docs/notes.md") {
+		t.Error("MOVE should rename notes.md to docs/notes.md")
+	}
+	if w := do("DELETE", "/-/dav/docs/notes.md", "", nil, true); w.Code != http.StatusNoContent {
+		t.Errorf("DELETE status = %d, want %d", w.Code, http.StatusNoContent)
+	}
+	if env.Store.Exists(context.Background(), "docs/notes.md") {
+		t.Error("DELETE should remove docs/notes.md")
+	}
+
+	// The git directory can be neither read nor written.
+	if w := do("GET", "/-/dav/.git/config", "", nil, true); w.Code != http.StatusNotFound {
+		t.Errorf("GET .git/config status = %d, want %d", w.Code, http.StatusNotFound)
+	}
+	if w := do("PUT", "/-/dav/.git/config", "x", nil, true); w.Code < 400 {
+		t.Errorf("PUT .git/config status = %d, want an error", w.Code)
+	}
+	if cfg, _ := env.Store.Load(context.Background(), ".git/config", ""); cfg == "x" {
+		t.Error(".git/config was overwritten")
+	}
+}
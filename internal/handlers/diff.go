@@ -1,6 +1,14 @@
 package handlers
 
-import "strings"
+import (
+	"html/template"
+	"strings"
+	"unicode"
+
+	"github.com/go-git/go-git/v5/utils/diff"
+	"github.com/sergi/go-diff/diffmatchpatch"
+	"golang.org/x/net/html"
+)
 
 // DiffLine represents a single line in a diff.
 type DiffLine struct {
@@ -29,3 +37,480 @@ func parseDiff(diff string) []DiffLine {
 	}
 	return lines
 }
+
+// BlockRow is one row of a side-by-side rendered comparison. A row holds
+// the block from each revision that lines up at that position; Left is empty
+// for an added block and Right for a removed one.
+type BlockRow struct {
+	Status string // "same", "changed", "added", "removed"
+	Left   template.HTML
+	Right  template.HTML
+}
+
+// voidElements are HTML elements that have no end tag.
+var voidElements = map[string]bool{
+	"area": true, "base": true, "br": true, "col": true, "embed": true,
+	"hr": true, "img": true, "input": true, "link": true, "meta": true,
+	"source": true, "track": true, "wbr": true,
+}
+
+// splitBlocks splits rendered HTML into its top-level elements (paragraphs,
+// headings, lists, tables, ...), keeping each element's markup verbatim.
+// Whitespace between elements is dropped; stray text at the top level
+// becomes a block of its own.
+func splitBlocks(doc string) []string {
+	var blocks []string
+	var cur strings.Builder
+	depth := 0
+	flush := func() {
+		if strings.TrimSpace(cur.String()) != "" {
+			blocks = append(blocks, cur.String())
+		}
+		cur.Reset()
+	}
+
+	z := html.NewTokenizer(strings.NewReader(doc))
+	for {
+		tt := z.Next()
+		if tt == html.ErrorToken {
+			break
+		}
+		raw := z.Raw()
+		switch tt {
+		case html.StartTagToken:
+			name, _ := z.TagName()
+			if depth == 0 {
+				flush()
+			}
+			cur.Write(raw)
+			if !voidElements[string(name)] {
+				depth++
+			} else if depth == 0 {
+				flush()
+			}
+			continue
+		case html.SelfClosingTagToken:
+			if depth == 0 {
+				flush()
+				cur.Write(raw)
+				flush()
+				continue
+			}
+		case html.EndTagToken:
+			cur.Write(raw)
+			if depth > 0 {
+				depth--
+			}
+			if depth == 0 {
+				flush()
+			}
+			continue
+		case html.CommentToken:
+			if depth == 0 {
+				continue
+			}
+		}
+		cur.Write(raw)
+	}
+	flush()
+	return blocks
+}
+
+// blockKey normalizes a block for comparison so that re-wrapped text and
+// indentation changes do not count as edits.
+func blockKey(block string) string {
+	return strings.Join(strings.Fields(block), " ")
+}
+
+// maxCompareBlocks caps the top-level blocks, both sides together, that
+// compareBlocks aligns; longer revisions are refused rather than diffed.
+const maxCompareBlocks = 10000
+
+// compareBlocks aligns the top-level blocks of two rendered documents using
+// the same token diff as the word view, each block one token. Unmatched
+// blocks between two matches are paired up as changed, and any surplus on
+// one side is reported as removed (left only) or added (right only). It
+// reports false if the documents have more than maxCompareBlocks blocks.
+func compareBlocks(left, right string) ([]BlockRow, bool) {
+	a, b := splitBlocks(left), splitBlocks(right)
+	if len(a)+len(b) > maxCompareBlocks {
+		return nil, false
+	}
+	ka := make([]string, len(a))
+	for i, block := range a {
+		ka[i] = blockKey(block)
+	}
+	kb := make([]string, len(b))
+	for j, block := range b {
+		kb[j] = blockKey(block)
+	}
+
+	var rows []BlockRow
+	var removed, added []string
+	flush := func() {
+		for k := 0; k < len(removed) || k < len(added); k++ {
+			row := BlockRow{Status: "changed"}
+			if k < len(removed) {
+				row.Left = template.HTML(removed[k])
+			} else {
+				row.Status = "added"
+			}
+			if k < len(added) {
+				row.Right = template.HTML(added[k])
+			} else {
+				row.Status = "removed"
+			}
+			rows = append(rows, row)
+		}
+		removed, added = removed[:0], added[:0]
+	}
+
+	i, j := 0, 0
+	for _, run := range diffTokens(ka, kb) {
+		n := len(run.Tokens)
+		switch run.Type {
+		case diffmatchpatch.DiffEqual:
+			flush()
+			for k := 0; k < n; k++ {
+				rows = append(rows, BlockRow{Status: "same", Left: template.HTML(a[i+k]), Right: template.HTML(b[j+k])})
+			}
+			i += n
+			j += n
+		case diffmatchpatch.DiffDelete:
+			removed = append(removed, a[i:i+n]...)
+			i += n
+		case diffmatchpatch.DiffInsert:
+			added = append(added, b[j:j+n]...)
+			j += n
+		}
+	}
+	flush()
+	return rows, true
+}
+
+// diffContext is the number of unchanged lines shown around each change of
+// a line diff.
+const diffContext = 3
+
+// DiffRow is one row of a line diff of two revisions of a page: a line kept,
+// removed, or added, a line changed in place, or a run of unchanged lines
+// left out. Left and Right hold the line as HTML, the changed parts of a
+// changed line marked with del and ins; LeftNo and RightNo are its line
+// numbers, 0 on the side it is missing from.
+type DiffRow struct {
+	Type    string // "context", "remove", "add", "change", "skip"
+	LeftNo  int
+	RightNo int
+	Left    template.HTML
+	Right   template.HTML
+	Skipped int // Number of lines a skip row leaves out
+}
+
+// diffRows diffs two texts line by line. A run of removed lines followed
+// by added ones is paired up into changed lines, highlighted within the line
+// by word when words is set and by character otherwise. Unchanged lines
+// further than diffContext from a change are collapsed into skip rows.
+func diffRows(a, b string, words bool) []DiffRow {
+	var rows []DiffRow
+	var removed, added []string
+	left, right := 0, 0
+	flush := func() {
+		for k := 0; k < len(removed) || k < len(added); k++ {
+			var row DiffRow
+			switch {
+			case k < len(removed) && k < len(added):
+				left++
+				right++
+				row = DiffRow{Type: "change", LeftNo: left, RightNo: right}
+				row.Left, row.Right = inlineDiff(removed[k], added[k], words)
+			case k < len(removed):
+				left++
+				row = DiffRow{Type: "remove", LeftNo: left, Left: template.HTML(template.HTMLEscapeString(removed[k]))}
+			default:
+				right++
+				row = DiffRow{Type: "add", RightNo: right, Right: template.HTML(template.HTMLEscapeString(added[k]))}
+			}
+			rows = append(rows, row)
+		}
+		removed, added = removed[:0], added[:0]
+	}
+
+	for _, d := range diff.Do(a, b) {
+		lines := strings.SplitAfter(d.Text, "\n")
+		if lines[len(lines)-1] == "" {
+			lines = lines[:len(lines)-1]
+		}
+		for _, line := range lines {
+			line = strings.TrimSuffix(line, "\n")
+			switch d.Type {
+			case diffmatchpatch.DiffDelete:
+				removed = append(removed, line)
+			case diffmatchpatch.DiffInsert:
+				added = append(added, line)
+			default:
+				flush()
+				left++
+				right++
+				text := template.HTML(template.HTMLEscapeString(line))
+				rows = append(rows, DiffRow{Type: "context", LeftNo: left, RightNo: right, Left: text, Right: text})
+			}
+		}
+	}
+	flush()
+	return collapseContext(rows)
+}
+
+// collapseContext replaces the context rows further than diffContext from
+// any change with a skip row per run.
+func collapseContext(rows []DiffRow) []DiffRow {
+	// near[i] is set for the rows within diffContext of a change.
+	near := make([]bool, len(rows))
+	for i, row := range rows {
+		if row.Type == "context" {
+			continue
+		}
+		for k := max(0, i-diffContext); k < min(len(rows), i+diffContext+1); k++ {
+			near[k] = true
+		}
+	}
+
+	var out []DiffRow
+	for i, row := range rows {
+		if near[i] {
+			out = append(out, row)
+			continue
+		}
+		if n := len(out); n > 0 && out[n-1].Type == "skip" {
+			out[n-1].Skipped++
+		} else {
+			out = append(out, DiffRow{Type: "skip", LeftNo: row.LeftNo, RightNo: row.RightNo, Skipped: 1})
+		}
+	}
+	return out
+}
+
+// inlineDiff diffs the old and the new version of a line, returning each as HTML with the
+// text only it has marked: removed text in del on the left, added text in
+// ins on the right.
+func inlineDiff(before, after string, words bool) (left, right template.HTML) {
+	var l, r strings.Builder
+	for _, d := range tokenDiffs(before, after, words) {
+		text := template.HTMLEscapeString(d.Text)
+		switch d.Type {
+		case diffmatchpatch.DiffDelete:
+			l.WriteString("<del>" + text + "</del>")
+		case diffmatchpatch.DiffInsert:
+			r.WriteString("<ins>" + text + "</ins>")
+		default:
+			l.WriteString(text)
+			r.WriteString(text)
+		}
+	}
+	return template.HTML(l.String()), template.HTML(r.String())
+}
+
+// wordDiff diffs two texts word by word, returning the new text as HTML
+// with removed words in del and added words in ins. It suits prose, where
+// a line is a whole paragraph.
+func wordDiff(a, b string) template.HTML {
+	var sb strings.Builder
+	for _, d := range tokenDiffs(a, b, true) {
+		text := template.HTMLEscapeString(d.Text)
+		switch d.Type {
+		case diffmatchpatch.DiffDelete:
+			sb.WriteString("<del>" + text + "</del>")
+		case diffmatchpatch.DiffInsert:
+			sb.WriteString("<ins>" + text + "</ins>")
+		default:
+			sb.WriteString(text)
+		}
+	}
+	return template.HTML(sb.String())
+}
+
+// tokenDiffs diffs two texts by word when words is set, and otherwise by
+// character, cleaned up so that the changes fall on whole words where they
+// can.
+func tokenDiffs(a, b string, words bool) []diffmatchpatch.Diff {
+	dmp := diffmatchpatch.New()
+	if !words {
+		return dmp.DiffCleanupSemantic(dmp.DiffMain(a, b, false))
+	}
+
+	var diffs []diffmatchpatch.Diff
+	for _, run := range diffTokens(splitWords(a), splitWords(b)) {
+		diffs = append(diffs, diffmatchpatch.Diff{Type: run.Type, Text: strings.Join(run.Tokens, "")})
+	}
+	return diffs
+}
+
+// tokenRun is a run of tokens a token diff keeps, removes, or adds.
+type tokenRun struct {
+	Type   diffmatchpatch.Operation
+	Tokens []string
+}
+
+// diffTokens diffs two sequences of tokens, each token one symbol.
+func diffTokens(a, b []string) []tokenRun {
+	// Tokens are diffed as characters standing for them, as diffmatchpatch
+	// does for lines. The surrogate range is skipped, as those runes do not
+	// survive the diff's strings.
+	index := make(map[string]rune)
+	var tokens []string
+	encode := func(list []string) []rune {
+		runes := make([]rune, 0, len(list))
+		for _, tok := range list {
+			r, ok := index[tok]
+			if !ok {
+				r = rune(len(tokens))
+				if r >= 0xD800 {
+					r += 0x800
+				}
+				index[tok] = r
+				tokens = append(tokens, tok)
+			}
+			runes = append(runes, r)
+		}
+		return runes
+	}
+	ra, rb := encode(a), encode(b)
+
+	var runs []tokenRun
+	for _, d := range diffmatchpatch.New().DiffMainRunes(ra, rb, false) {
+		run := tokenRun{Type: d.Type}
+		for _, r := range d.Text {
+			if r >= 0xE000 {
+				r -= 0x800
+			}
+			run.Tokens = append(run.Tokens, tokens[r])
+		}
+		runs = append(runs, run)
+	}
+	return runs
+}
+
+// splitWords splits s into words, runs of white space, and single other
+// characters, which together make up s.
+func splitWords(s string) []string {
+	class := func(r rune) int {
+		switch {
+		case unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_':
+			return 1
+		case unicode.IsSpace(r):
+			return 2
+		}
+		return 0
+	}
+	var tokens []string
+	start, prev := 0, -1
+	for i, r := range s {
+		c := class(r)
+		if i > start && (c != prev || c == 0) {
+			tokens = append(tokens, s[start:i])
+			start = i
+		}
+		prev = c
+	}
+	if start < len(s) {
+		tokens = append(tokens, s[start:])
+	}
+	return tokens
+}
+
+// inlineCompare merges the rows of a rendered comparison into one
+// document: unchanged blocks as they are, removed blocks in del, added ones
+// in ins, and changed blocks word-diffed within their markup.
+func inlineCompare(rows []BlockRow) template.HTML {
+	var sb strings.Builder
+	for _, row := range rows {
+		switch row.Status {
+		case "same":
+			sb.WriteString(string(row.Right))
+		case "removed":
+			sb.WriteString(`<del class="compare-block">` + string(row.Left) + "</del>")
+		case "added":
+			sb.WriteString(`<ins class="compare-block">` + string(row.Right) + "</ins>")
+		default:
+			sb.WriteString(htmlWordDiff(string(row.Left), string(row.Right)))
+		}
+		sb.WriteString("\n")
+	}
+	return template.HTML(sb.String())
+}
+
+// htmlWordDiff diffs two fragments of rendered HTML word by word, returning
+// the new fragment with the removed text in del and the added text in ins.
+// The markup of the new fragment is kept and that of the old one dropped,
+// so a changed element shows in its new form.
+func htmlWordDiff(a, b string) string {
+	var sb strings.Builder
+	mark := func(tag string, tokens []string) {
+		open := false
+		for _, tok := range tokens {
+			markup, isMarkup := strings.CutPrefix(tok, "<")
+			switch {
+			case isMarkup && open:
+				sb.WriteString("</" + tag + ">")
+				open = false
+			case !isMarkup && !open:
+				sb.WriteString("<" + tag + ">")
+				open = true
+			}
+			switch {
+			case !isMarkup:
+				sb.WriteString(tok)
+			case tag == "ins":
+				sb.WriteString(markup)
+			}
+		}
+		if open {
+			sb.WriteString("</" + tag + ">")
+		}
+	}
+	for _, run := range diffTokens(htmlTokens(a), htmlTokens(b)) {
+		switch run.Type {
+		case diffmatchpatch.DiffDelete:
+			mark("del", run.Tokens)
+		case diffmatchpatch.DiffInsert:
+			mark("ins", run.Tokens)
+		default:
+			for _, tok := range run.Tokens {
+				sb.WriteString(strings.TrimPrefix(tok, "<"))
+			}
+		}
+	}
+	return sb.String()
+}
+
+// htmlTokens splits rendered HTML into its markup and the words of its
+// text, escaped. Markup is prefixed with "<", which escaped text never
+// starts with; the content of script and style elements is kept whole, as
+// markup.
+func htmlTokens(doc string) []string {
+	var tokens []string
+	raw := false
+	z := html.NewTokenizer(strings.NewReader(doc))
+	for {
+		tt := z.Next()
+		if tt == html.ErrorToken {
+			return tokens
+		}
+		switch tt {
+		case html.TextToken:
+			if raw {
+				tokens = append(tokens, "<"+string(z.Raw()))
+				continue
+			}
+			for _, w := range splitWords(string(z.Text())) {
+				tokens = append(tokens, template.HTMLEscapeString(w))
+			}
+		case html.StartTagToken:
+			name, _ := z.TagName()
+			raw = string(name) == "script" || string(name) == "style"
+			tokens = append(tokens, "<"+string(z.Raw()))
+		default:
+			raw = false
+			tokens = append(tokens, "<"+string(z.Raw()))
+		}
+	}
+}
@@ -1,6 +1,9 @@
 package handlers
 
 import (
+	"fmt"
+	"html/template"
+	"strings"
 	"testing"
 )
 
@@ -89,3 +92,225 @@ func TestParseDiff_Mixed(t *testing.T) {
 		}
 	}
 }
+
+func TestSplitBlocks(t *testing.T) {
+	doc := "<h1 id=\"t\">Title</h1>\n<p>One <em>two</em></p>\n<hr>\n<ul>\n<li><p>a</p></li>\n</ul>\n<!-- note -->\n<img src=\"x.png\"/>\n"
+	blocks := splitBlocks(doc)
+	want := []string{
+		`<h1 id="t">Title</h1>`,
+		`<p>One <em>two</em></p>`,
+		`<hr>`,
+		"<ul>\n<li><p>a</p></li>\n</ul>",
+		`<img src="x.png"/>`,
+	}
+	if len(blocks) != len(want) {
+		t.Fatalf("splitBlocks returned %d blocks %q, want %d", len(blocks), blocks, len(want))
+	}
+	for i := range want {
+		if blocks[i] != want[i] {
+			t.Errorf("block %d = %q, want %q", i, blocks[i], want[i])
+		}
+	}
+}
+
+func TestCompareBlocks(t *testing.T) {
+	left := "<h1>T</h1>\n<p>keep</p>\n<p>old</p>\n<p>gone</p>\n"
+	right := "<h1>T</h1>\n<p>keep</p>\n<p>new</p>\n<p>tail</p>\n<p>extra</p>\n"
+
+	rows, _ := compareBlocks(left, right)
+	var statuses []string
+	for _, row := range rows {
+		statuses = append(statuses, row.Status)
+	}
+	got := strings.Join(statuses, ",")
+	if got != "same,same,changed,changed,added" {
+		t.Fatalf("statuses = %s", got)
+	}
+	if rows[4].Left != "" || rows[4].Right != "<p>extra</p>" {
+		t.Errorf("added row = %+v", rows[4])
+	}
+
+	rows, _ = compareBlocks("<p>a</p><p>b</p>", "<p>a</p>")
+	if len(rows) != 2 || rows[1].Status != "removed" || rows[1].Right != "" {
+		t.Errorf("removed rows = %+v", rows)
+	}
+
+	// Whitespace-only differences are not changes.
+	rows, _ = compareBlocks("<p>one\ntwo</p>", "<p>one two</p>")
+	if len(rows) != 1 || rows[0].Status != "same" {
+		t.Errorf("rewrapped block rows = %+v", rows)
+	}
+
+	// Long documents align without a table of every pair of blocks, up to
+	// the cap.
+	var long, edited strings.Builder
+	for i := range maxCompareBlocks / 2 {
+		fmt.Fprintf(&long, "<p>block %d</p>\n", i)
+		if i == 1000 {
+			edited.WriteString("<p>inserted</p>\n")
+		}
+		if i != 3000 {
+			fmt.Fprintf(&edited, "<p>block %d</p>\n", i)
+		}
+	}
+	rows, ok := compareBlocks(long.String(), edited.String())
+	if !ok {
+		t.Fatal("compareBlocks refused documents within the cap")
+	}
+	statuses = statuses[:0]
+	for _, row := range rows {
+		if row.Status != "same" {
+			statuses = append(statuses, row.Status)
+		}
+	}
+	if got := strings.Join(statuses, ","); got != "added,removed" {
+		t.Errorf("changes in long documents = %s", got)
+	}
+	if _, ok := compareBlocks(long.String()+"<p>one more</p>", long.String()); ok {
+		t.Error("compareBlocks compared documents over the cap")
+	}
+}
+
+func TestDiffRows(t *testing.T) {
+	var a, b strings.Builder
+	for i := 1; i <= 20; i++ {
+		fmt.Fprintf(&a, "line %d\n", i)
+		switch i {
+		case 5:
+			b.WriteString("line five\n")
+		case 15:
+		default:
+			fmt.Fprintf(&b, "line %d\n", i)
+		}
+	}
+	b.WriteString("line 21\n")
+
+	rows := diffRows(a.String(), b.String(), false)
+	var types []string
+	for _, row := range rows {
+		types = append(types, row.Type)
+	}
+	want := "skip,context,context,context,change,context,context,context,skip,context,context,context,remove,context,context,context,context,context,add"
+	if got := strings.Join(types, ","); got != want {
+		t.Fatalf("row types = %s, want %s", got, want)
+	}
+	if rows[0].Skipped != 1 || rows[8].Skipped != 3 || rows[8].LeftNo != 9 {
+		t.Errorf("skip rows = %+v and %+v, want 1 line and 3 from line 9", rows[0], rows[8])
+	}
+	change := rows[4]
+	if change.LeftNo != 5 || change.RightNo != 5 || change.Left != "line <del>5</del>" || change.Right != "line <ins>five</ins>" {
+		t.Errorf("change row = %+v", change)
+	}
+	if rows[12].LeftNo != 15 || rows[12].RightNo != 0 || rows[18].RightNo != 20 {
+		t.Errorf("line numbers: removed %d/%d, added %d", rows[12].LeftNo, rows[12].RightNo, rows[18].RightNo)
+	}
+}
+
+func TestInlineDiff_Escapes(t *testing.T) {
+	left, right := inlineDiff("a <b> c", "a <i> c", true)
+	if left != "a &lt;<del>b</del>&gt; c" || right != "a &lt;<ins>i</ins>&gt; c" {
+		t.Errorf("inlineDiff = %q, %q", left, right)
+	}
+}
+
+func TestWordDiff(t *testing.T) {
+	got := wordDiff("The quick brown fox jumps.", "The slow brown fox leaps.")
+	want := "The <del>quick</del><ins>slow</ins> brown fox <del>jumps</del><ins>leaps</ins>."
+	if got != template.HTML(want) {
+		t.Errorf("wordDiff = %q, want %q", got, want)
+	}
+	if got := splitWords("héllo, wörld  42"); strings.Join(got, "|") != "héllo|,| |wörld|  |42" {
+		t.Errorf("splitWords = %q", got)
+	}
+}
+
+func TestHTMLWordDiff(t *testing.T) {
+	tests := []struct {
+		a, b, want string
+	}{
+		{"<p>The quick fox.</p>", "<p>The slow fox.</p>", "<p>The <del>quick</del><ins>slow</ins> fox.</p>"},
+		// The new markup is kept and the old dropped.
+		{"<p>a <em>b</em> c</p>", "<p>a b c</p>", "<p>a b c</p>"},
+		{"<p>a</p>", "<p>a <strong>new</strong></p>", "<p>a<ins> </ins><strong><ins>new</ins></strong></p>"},
+		// Text is escaped again, and entities are never split.
+		{"<p>x &amp; y</p>", "<p>x &lt; y</p>", "<p>x <del>&amp;</del><ins>&lt;</ins> y</p>"},
+	}
+	for _, tt := range tests {
+		if got := htmlWordDiff(tt.a, tt.b); got != tt.want {
+			t.Errorf("htmlWordDiff(%q, %q) = %q, want %q", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestInlineCompare(t *testing.T) {
+	rows, _ := compareBlocks("<h1>T</h1><p>old text</p><p>gone</p>", "<h1>T</h1><p>new text</p>")
+	got := inlineCompare(rows)
+	want := "<h1>T</h1>\n<p><del>old</del><ins>new</ins> text</p>\n<del class=\"compare-block\"><p>gone</p></del>\n"
+	if got != template.HTML(want) {
+		t.Errorf("inlineCompare = %q, want %q", got, want)
+	}
+}
+
+func TestPatchFiles(t *testing.T) {
+	patch := "diff --git a/notes.md b/notes.md\n" +
+		"index 1111111..2222222 100644\n" +
+		"--- a/notes.md\n" +
+		"+++ b/notes.md\n" +
+		"@@ -1,3 +1,3 @@ # Notes\n" +
+		" keep\n" +
+		"--- a rule\n" +
+		"+++ a sum\n" +
+		" end\n" +
+		"\\ No newline at end of file\n" +
+		"diff --git a/old.md b/old.md\n" +
+		"deleted file mode 100644\n" +
+		"--- a/old.md\n" +
+		"+++ /dev/null\n" +
+		"@@ -1 +0,0 @@\n" +
+		"-gone\n" +
+		"diff --git a/logo.png b/logo.png\n" +
+		"new file mode 100644\n" +
+		"Binary files /dev/null and b/logo.png differ\n"
+
+	files := patchFiles(patch)
+	if len(files) != 3 {
+		t.Fatalf("got %d files, want 3: %+v", len(files), files)
+	}
+
+	notes := files[0]
+	if notes.File != "notes.md" || notes.Status != "modified" || notes.Additions != 1 || notes.Deletions != 1 {
+		t.Errorf("notes.md = %+v", notes)
+	}
+	if len(notes.Hunks) != 1 {
+		t.Fatalf("notes.md hunks = %+v", notes.Hunks)
+	}
+	hunk := notes.Hunks[0]
+	if hunk.OldStart != 1 || hunk.OldLines != 3 || hunk.NewStart != 1 || hunk.NewLines != 3 || hunk.Section != "# Notes" {
+		t.Errorf("hunk = %+v", hunk)
+	}
+	want := []APIDiffLine{
+		{Type: "context", Content: "keep", OldLine: 1, NewLine: 1},
+		{Type: "remove", Content: "-- a rule", OldLine: 2},
+		{Type: "add", Content: "++ a sum", NewLine: 2},
+		{Type: "context", Content: "end", OldLine: 3, NewLine: 3},
+	}
+	if fmt.Sprint(hunk.Lines) != fmt.Sprint(want) {
+		t.Errorf("lines = %+v, want %+v", hunk.Lines, want)
+	}
+	if !strings.HasPrefix(notes.Patch, "diff --git a/notes.md") || !strings.HasSuffix(notes.Patch, "\\ No newline at end of file\n") {
+		t.Errorf("notes.md patch = %q", notes.Patch)
+	}
+
+	old := files[1]
+	if old.File != "old.md" || old.Status != "deleted" || old.Deletions != 1 || old.Hunks[0].NewLines != 0 || old.Hunks[0].OldLines != 1 {
+		t.Errorf("old.md = %+v", old)
+	}
+	logo := files[2]
+	if logo.File != "logo.png" || logo.Status != "added" || !logo.Binary || len(logo.Hunks) != 0 {
+		t.Errorf("logo.png = %+v", logo)
+	}
+
+	if files := patchFiles(""); len(files) != 0 {
+		t.Errorf("empty patch: %+v", files)
+	}
+}
@@ -0,0 +1,54 @@
+package handlers
+
+import (
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/sa/gopherwiki/internal/wiki"
+)
+
+// directoryIndexName is the page that replaces the generated listing of the
+// directory holding it.
+const directoryIndexName = "index"
+
+// renderDirectory serves the directory of subpages of page, which does not
+// exist: a redirect to its index page if it has one, or else a listing of
+// its pages and subdirectories. It reports false when there is no such
+// directory, or nothing in it to list.
+func (s *Server) renderDirectory(w http.ResponseWriter, r *http.Request, page *wiki.Page) bool {
+	dir := page.AttachmentDirectoryname
+	if !s.Storage.IsDir(r.Context(), dir) || s.Storage.IsEmptyDir(r.Context(), dir) {
+		return false
+	}
+	pagepath := strings.TrimSuffix(page.Pagepath, "/")
+	if s.Storage.Exists(r.Context(), path.Join(dir, directoryIndexName+".md")) {
+		http.Redirect(w, r, "/"+pagepath+"/"+directoryIndexName, http.StatusFound)
+		return true
+	}
+
+	entries, err := s.Wiki.Directory(r.Context(), dir)
+	if err != nil {
+		s.renderFailure(w, r, err)
+		return true
+	}
+	// Special pages decorate the directory rather than belong to it.
+	listed := entries[:0]
+	for _, e := range entries {
+		switch path.Base(e.Path) {
+		case sidebarPageName, footerPageName, notFoundPageName:
+			if !e.IsDirectory {
+				continue
+			}
+		}
+		listed = append(listed, e)
+	}
+	if len(listed) == 0 {
+		return false
+	}
+
+	data := NewPageViewData(page.PagenameFull, page)
+	data["entries"] = listed
+	s.renderTemplate(w, r, "directory.html", data)
+	return true
+}
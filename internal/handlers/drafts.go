@@ -0,0 +1,152 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/sa/gopherwiki/internal/db"
+	"github.com/sa/gopherwiki/internal/middleware"
+	"github.com/sa/gopherwiki/internal/wiki"
+)
+
+// draftView is a saved draft as shown on the drafts page.
+type draftView struct {
+	ID       int64
+	Pagepath string
+	Saved    time.Time
+	Revision string // Revision of the page the draft was started on
+	Exists   bool   // Whether the page exists
+	Stale    bool   // Whether the page changed since the draft was started
+}
+
+// draftToView describes a draft, comparing it with the current version of
+// its page.
+func (s *Server) draftToView(r *http.Request, d db.Draft) (draftView, *wiki.Page, error) {
+	page, err := wiki.NewPage(r.Context(), s.Storage, s.Config, d.Pagepath.String, "")
+	if err != nil {
+		return draftView{}, nil, err
+	}
+	current := ""
+	if page.Exists && page.Metadata != nil {
+		current = page.Metadata.Revision
+	}
+	return draftView{
+		ID:       d.ID,
+		Pagepath: page.Pagepath,
+		Saved:    d.Datetime.Time,
+		Revision: d.Revision.String,
+		Exists:   page.Exists,
+		Stale:    d.Revision.String != current,
+	}, page, nil
+}
+
+// userDraft loads the draft the id parameter of r names, rendering an error
+// page unless it is one of the user's.
+func (s *Server) userDraft(w http.ResponseWriter, r *http.Request) (db.Draft, bool) {
+	id, err := parseInt64(chi.URLParam(r, "id"))
+	if err != nil {
+		s.renderError(w, r, http.StatusBadRequest, "Invalid draft ID")
+		return db.Draft{}, false
+	}
+	d, err := s.DB.Queries.GetDraftByID(r.Context(), id)
+	if err == nil && d.AuthorEmail.String != middleware.GetUser(r).GetEmail() {
+		err = sql.ErrNoRows
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		s.renderError(w, r, http.StatusNotFound, "Draft not found")
+		return db.Draft{}, false
+	} else if err != nil {
+		s.renderError(w, r, http.StatusInternalServerError, "Failed to get draft")
+		return db.Draft{}, false
+	}
+	return d, true
+}
+
+// handleDrafts lists the drafts the current user saved while editing,
+// newest first, and the ones they scheduled to be published.
+func (s *Server) handleDrafts(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetUser(r)
+	if !user.IsAuthenticated() {
+		http.Redirect(w, r, "/-/login?next=/-/drafts", http.StatusFound)
+		return
+	}
+
+	drafts, err := s.DB.Queries.ListDraftsByAuthor(r.Context(), db.NullString(user.GetEmail()))
+	if err != nil {
+		s.renderError(w, r, http.StatusInternalServerError, "Failed to list drafts")
+		return
+	}
+	views := make([]draftView, 0, len(drafts))
+	for _, d := range drafts {
+		view, _, err := s.draftToView(r, d)
+		if err != nil {
+			slog.Warn("failed to load the page of a draft", "path", d.Pagepath.String, "error", err)
+			continue
+		}
+		views = append(views, view)
+	}
+
+	scheduled, err := s.DB.ListScheduledPages(r.Context(), user.GetEmail())
+	if err != nil {
+		s.renderError(w, r, http.StatusInternalServerError, "Failed to list scheduled publications")
+		return
+	}
+
+	data := NewGenericData("Drafts")
+	data["drafts"] = views
+	data["scheduled"] = scheduled
+	data["ttl_days"] = s.Config.DraftTTLDays
+	s.renderTemplate(w, r, "drafts.html", data)
+}
+
+// handleDraftView shows a draft of the current user against the current
+// version of its page, with a form to schedule it.
+func (s *Server) handleDraftView(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetUser(r)
+	if !user.IsAuthenticated() {
+		http.Redirect(w, r, "/-/login?next=/-/drafts", http.StatusFound)
+		return
+	}
+	d, ok := s.userDraft(w, r)
+	if !ok {
+		return
+	}
+	view, page, err := s.draftToView(r, d)
+	if err != nil {
+		s.renderFailure(w, r, err)
+		return
+	}
+
+	data := NewGenericData("Draft of " + view.Pagepath)
+	data["draft"] = view
+	data["unchanged"] = page.Content == d.Content.String
+	data["rows"] = diffRows(page.Content, d.Content.String, false)
+	data["can_schedule"] = !s.needsReview(user)
+	data["schedule_min"] = time.Now().Format(scheduleTimeLayout)
+	data["time_zone"] = time.Now().Format("MST")
+	s.renderTemplate(w, r, "drafts_view.html", data)
+}
+
+// handleDraftDiscard deletes a draft of the current user.
+func (s *Server) handleDraftDiscard(w http.ResponseWriter, r *http.Request) {
+	if !middleware.GetUser(r).IsAuthenticated() {
+		http.Redirect(w, r, "/-/login?next=/-/drafts", http.StatusFound)
+		return
+	}
+	d, ok := s.userDraft(w, r)
+	if !ok {
+		return
+	}
+	if err := s.DB.Queries.DeleteDraftByID(r.Context(), d.ID); err != nil {
+		s.SessionManager.AddFlashMessage(w, r, "danger", "Failed to discard the draft")
+	} else {
+		s.SessionManager.AddFlashMessage(w, r, "success", fmt.Sprintf("Draft of %s discarded", d.Pagepath.String))
+	}
+	http.Redirect(w, r, "/-/drafts", http.StatusFound)
+}
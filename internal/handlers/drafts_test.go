@@ -0,0 +1,90 @@
+package handlers_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/sa/gopherwiki/internal/db"
+	"github.com/sa/gopherwiki/internal/storage"
+	"github.com/sa/gopherwiki/internal/testutil"
+)
+
+func TestDrafts(t *testing.T) {
+	env := testutil.SetupTestEnv(t)
+	ctx := context.Background()
+	cookies := loginAsUser(t, env, "bob@example.com")
+	if _, err := env.Store.Store(ctx, "notes.md", "# Notes\n\nFirst line\n", "Add notes", storage.Author{Name: "Bob"}); err != nil {
+		t.Fatal(err)
+	}
+	do := func(method, path string, form url.Values, cookies []*http.Cookie) *httptest.ResponseRecorder {
+		var body *strings.Reader
+		if form != nil {
+			body = strings.NewReader(form.Encode())
+		}
+		req := requestWithCookies(method, path, body, cookies)
+		if form != nil {
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		}
+		w := httptest.NewRecorder()
+		env.Router.ServeHTTP(w, req)
+		return w
+	}
+
+	// The editor's autosave shows up on the drafts page.
+	do("POST", "/notes/draft", url.Values{"content": {"# Notes\n\nFirst line, edited\n"}}, cookies)
+	do("POST", "/ideas/draft", url.Values{"content": {"# Ideas\n"}}, cookies)
+	w := do("GET", "/-/drafts", nil, cookies)
+	body := w.Body.String()
+	if w.Code != http.StatusOK || !strings.Contains(body, `<a href="/notes">notes</a>`) || !strings.Contains(body, "New page") || !strings.Contains(body, " ago</span>") {
+		t.Fatalf("drafts page: status = %d; body:\n%s", w.Code, body)
+	}
+	if strings.Contains(body, "Page changed") {
+		t.Errorf("a draft of the current revision is not stale:\n%s", body)
+	}
+	drafts, err := env.DB.Queries.ListDraftsByAuthor(ctx, db.NullString("bob@example.com"))
+	if err != nil || len(drafts) != 2 {
+		t.Fatalf("drafts = %v, %v; want 2", drafts, err)
+	}
+	var notes db.Draft
+	for _, d := range drafts {
+		if d.Pagepath.String == "notes" {
+			notes = d
+		}
+	}
+
+	// A draft is shown against the current page, also once it changed.
+	if _, err := env.Store.Store(ctx, "notes.md", "# Notes\n\nFirst line\nSecond line\n", "Extend notes", storage.Author{Name: "Alice"}); err != nil {
+		t.Fatal(err)
+	}
+	w = do("GET", fmt.Sprintf("/-/drafts/%d", notes.ID), nil, cookies)
+	body = w.Body.String()
+	if w.Code != http.StatusOK || !strings.Contains(body, `<span class="diff-add">+First line<ins>, edited</ins></span>`) || !strings.Contains(body, "The page has changed since this draft was started") {
+		t.Errorf("draft view: status = %d; body:\n%s", w.Code, body)
+	}
+	if !strings.Contains(body, `href="/notes/edit?draft=resume"`) {
+		t.Errorf("draft view lacks the resume link")
+	}
+
+	// Only their author sees and discards drafts.
+	other := loginAsUser(t, env, "eve@example.com")
+	if w := do("GET", fmt.Sprintf("/-/drafts/%d", notes.ID), nil, other); w.Code != http.StatusNotFound {
+		t.Errorf("another user's draft: status = %d, want %d", w.Code, http.StatusNotFound)
+	}
+	if w := do("POST", fmt.Sprintf("/-/drafts/%d/delete", notes.ID), url.Values{}, other); w.Code != http.StatusNotFound {
+		t.Errorf("discard another user's draft: status = %d, want %d", w.Code, http.StatusNotFound)
+	}
+	if w := do("GET", "/-/drafts", nil, nil); w.Code != http.StatusFound {
+		t.Errorf("drafts page when anonymous: status = %d, want a redirect to the login", w.Code)
+	}
+	if w := do("POST", fmt.Sprintf("/-/drafts/%d/delete", notes.ID), url.Values{}, cookies); w.Code != http.StatusFound {
+		t.Errorf("discard: status = %d, want %d", w.Code, http.StatusFound)
+	}
+	if drafts, _ := env.DB.Queries.ListDraftsByAuthor(ctx, db.NullString("bob@example.com")); len(drafts) != 1 || drafts[0].Pagepath.String != "ideas" {
+		t.Errorf("drafts after discarding = %v, want the other one", drafts)
+	}
+}
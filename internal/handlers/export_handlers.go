@@ -3,16 +3,22 @@ package handlers
 import (
 	"archive/zip"
 	"bytes"
+	"errors"
+	"html/template"
+	"io"
 	"log/slog"
 	"net/http"
+	"os"
 	"path"
 	"strconv"
 	"strings"
 
 	"github.com/go-chi/chi/v5"
 
+	"github.com/sa/gopherwiki/internal/pandoc"
 	"github.com/sa/gopherwiki/internal/quarto"
 	"github.com/sa/gopherwiki/internal/renderer"
+	"github.com/sa/gopherwiki/internal/storage"
 	"github.com/sa/gopherwiki/internal/wiki"
 )
 
@@ -21,6 +27,11 @@ import (
 // render service.
 const markdownZipFormat = "md-zip"
 
+// printFormat is the identifier for the print view: the rendered page with the
+// print stylesheet applied, which opens the browser's print dialog so the page
+// can be printed or saved as PDF. Like Markdown ZIP it is always available.
+const printFormat = "print"
+
 // exportLink is a single entry in the page view's "Export as" menu.
 type exportLink struct {
 	Format string
@@ -28,16 +39,30 @@ type exportLink struct {
 }
 
 // exportFormatLinks returns the export options offered for a page view. The
-// pure-Go Markdown ZIP is always available; the Quarto-produced formats are
-// offered only when the render service (and thus the toolchain) is present.
+// print view and the pure-Go Markdown ZIP are always available; the
+// Quarto-produced formats are offered only when the render service (and thus
+// the toolchain) is present, and the Pandoc formats when the converter is.
+// Quarto wins for a format both can produce.
 func (s *Server) exportFormatLinks() []exportLink {
 	links := []exportLink{}
+	seen := make(map[string]bool)
 	if s.RenderService != nil && s.RenderService.ExportAvailable() {
 		for _, f := range s.RenderService.ExportFormats() {
 			links = append(links, exportLink{Format: f.Name, Label: f.Label})
+			seen[f.Name] = true
+		}
+	}
+	if s.Converter != nil {
+		for _, f := range s.Converter.Formats() {
+			if !seen[f.Name] {
+				links = append(links, exportLink{Format: f.Name, Label: f.Label})
+			}
 		}
 	}
-	links = append(links, exportLink{Format: markdownZipFormat, Label: "Markdown (ZIP)"})
+	links = append(links,
+		exportLink{Format: printFormat, Label: "Print / Save as PDF"},
+		exportLink{Format: markdownZipFormat, Label: "Markdown (ZIP)"},
+	)
 	return links
 }
 
@@ -51,15 +76,26 @@ func knownExportFormat(formats []quarto.ExportFormat, name string) bool {
 	return false
 }
 
+// knownConverterFormat reports whether name is one of the given Pandoc formats.
+func knownConverterFormat(formats []pandoc.Format, name string) bool {
+	for _, f := range formats {
+		if f.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
 // handleExport serves a downloadable export of a page in the format given by the
-// `format` query parameter. Markdown ZIP is produced in-process (pure Go);
-// every other format is produced by Quarto with execution disabled, so export
-// never runs page code. The route is read-protected.
+// `format` query parameter. Markdown ZIP and the print view are produced
+// in-process (pure Go). Other formats are produced by Quarto with execution
+// disabled, so export never runs page code, or failing that by Pandoc. The
+// route is read-protected.
 func (s *Server) handleExport(w http.ResponseWriter, r *http.Request) {
 	pagePath := chi.URLParam(r, "path")
-	page, err := wiki.NewPage(s.Storage, s.Config, pagePath, "")
+	page, err := wiki.NewPage(r.Context(), s.Storage, s.Config, pagePath, "")
 	if err != nil {
-		s.renderError(w, r, http.StatusInternalServerError, err.Error())
+		s.renderFailure(w, r, err)
 		return
 	}
 	if !page.Exists {
@@ -73,17 +109,26 @@ func (s *Server) handleExport(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if format == markdownZipFormat {
+	switch format {
+	case markdownZipFormat:
 		s.exportMarkdownZip(w, r, page)
 		return
+	case printFormat:
+		s.exportPrint(w, r, page)
+		return
 	}
 
-	if s.RenderService == nil || !s.RenderService.ExportAvailable() {
+	quartoExport := s.RenderService != nil && s.RenderService.ExportAvailable()
+	if !quartoExport && s.Converter == nil {
 		s.renderError(w, r, http.StatusNotImplemented, "Export is not enabled on this instance")
 		return
 	}
 
-	if !knownExportFormat(s.RenderService.ExportFormats(), format) {
+	if !quartoExport || !knownExportFormat(s.RenderService.ExportFormats(), format) {
+		if s.Converter != nil && knownConverterFormat(s.Converter.Formats(), format) {
+			s.exportDocument(w, r, page, format)
+			return
+		}
 		s.renderError(w, r, http.StatusBadRequest, "Unknown export format: "+format)
 		return
 	}
@@ -93,7 +138,7 @@ func (s *Server) handleExport(w http.ResponseWriter, r *http.Request) {
 	// instead of emitting raw wiki syntax. Mermaid diagrams are only rewritten for
 	// HTML (client-side rendering); other formats would need a headless browser,
 	// so their mermaid blocks stay as code listings rather than failing the export.
-	source := renderer.PrepareExportSource(page.Content, s.Config.SiteURL, format == "html")
+	source := renderer.PrepareExportSource(page.Content, s.siteURL(r), format == "html")
 	in := quarto.Input{
 		Pagepath:       page.Pagepath,
 		Source:         source,
@@ -110,6 +155,45 @@ func (s *Server) handleExport(w http.ResponseWriter, r *http.Request) {
 	serveDownload(w, data, f.MediaType, exportFilename(page, f.Ext))
 }
 
+// exportDocument converts a page with Pandoc. The page's attachments are handed
+// to the converter so its images are embedded in the document.
+func (s *Server) exportDocument(w http.ResponseWriter, r *http.Request, page *wiki.Page, format string) {
+	in := pandoc.Input{
+		AttachmentDir: page.AttachmentDirectoryname,
+		Source:        renderer.PrepareExportSource(page.Content, s.siteURL(r), false),
+		Resources:     make(map[string][]byte),
+	}
+	if attachments, err := page.Attachments(r.Context(), 0, ""); err == nil {
+		for _, a := range attachments {
+			content, err := a.Load(r.Context())
+			if err != nil {
+				slog.Debug("skipping unreadable attachment in export", "page", page.Pagepath, "file", a.Filename, "error", err)
+				continue
+			}
+			in.Resources[a.Filepath] = content
+		}
+	}
+
+	data, f, err := s.Converter.Convert(r.Context(), in, format)
+	if err != nil {
+		slog.Error("page export failed", "page", page.Pagepath, "format", format, "error", err)
+		s.renderError(w, r, http.StatusInternalServerError, "Export failed: "+err.Error())
+		return
+	}
+
+	serveDownload(w, data, f.MediaType, exportFilename(page, f.Ext))
+}
+
+// exportPrint renders the print view of a page: the page content without the
+// wiki's navigation, styled for paper, which opens the print dialog once it
+// has loaded.
+func (s *Server) exportPrint(w http.ResponseWriter, r *http.Request, page *wiki.Page) {
+	htmlContent, toc, libRequirements, _ := s.renderPageContent(r, page)
+	data := NewPageData(page, template.HTML(htmlContent), toc, libRequirements)
+	data["print_view"] = true
+	s.renderTemplate(w, r, "page.html", data)
+}
+
 // exportMarkdownZip bundles a page's raw source plus any attachments into a ZIP
 // archive. It is pure Go and requires no external toolchain, so it works on any
 // node regardless of whether Quarto is present.
@@ -127,9 +211,9 @@ func (s *Server) exportMarkdownZip(w http.ResponseWriter, r *http.Request, page
 		return
 	}
 
-	if attachments, err := page.Attachments(0, ""); err == nil {
+	if attachments, err := page.Attachments(r.Context(), 0, ""); err == nil {
 		for _, a := range attachments {
-			content, err := a.Load()
+			content, err := a.Load(r.Context())
 			if err != nil {
 				slog.Debug("skipping unreadable attachment in export", "page", page.Pagepath, "file", a.Filename, "error", err)
 				continue
@@ -150,6 +234,73 @@ func (s *Server) exportMarkdownZip(w http.ResponseWriter, r *http.Request, page
 	serveDownload(w, buf.Bytes(), "application/zip", exportFilename(page, "zip"))
 }
 
+// handleWikiExport serves a ZIP archive of the page sources and attachments of
+// the subtree given by the `path` query parameter, or of the whole wiki when it
+// is empty. The route is read-protected.
+func (s *Server) handleWikiExport(w http.ResponseWriter, r *http.Request) {
+	dir := r.URL.Query().Get("path")
+	files, err := s.Wiki.ExportFiles(r.Context(), dir)
+	if errors.Is(err, storage.ErrNotFound) {
+		s.renderError(w, r, http.StatusNotFound, "Nothing to export")
+		return
+	}
+	if err != nil {
+		slog.Error("wiki export failed", "path", dir, "error", err)
+		s.renderError(w, r, http.StatusInternalServerError, "Export failed")
+		return
+	}
+	if err := s.serveArchive(w, r, files, archiveFilename(dir)); err != nil {
+		s.renderError(w, r, http.StatusInternalServerError, "Export failed")
+	}
+}
+
+// serveArchive builds the ZIP archive of files in a temporary file and sends
+// it as a download. An error means nothing was sent yet, so the caller can
+// still respond with an error of its own. The archive of a large wiki may be
+// too big to buffer, so the response is marked no-store to stream it.
+func (s *Server) serveArchive(w http.ResponseWriter, r *http.Request, files []string, filename string) error {
+	tmp, err := os.CreateTemp("", "gopherwiki-export-*.zip")
+	if err != nil {
+		slog.Error("failed to create export archive", "error", err)
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	if err := s.Wiki.WriteExportArchive(r.Context(), tmp, files); err != nil {
+		slog.Error("failed to write export archive", "error", err)
+		return err
+	}
+	size, err := tmp.Seek(0, io.SeekCurrent)
+	if err == nil {
+		_, err = tmp.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		slog.Error("failed to read export archive", "error", err)
+		return err
+	}
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`"`)
+	w.Header().Set("Content-Length", strconv.FormatInt(size, 10))
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	if _, err := io.Copy(w, tmp); err != nil {
+		slog.Error("failed to send export archive", "error", err)
+	}
+	return nil
+}
+
+// archiveFilename names the archive of a subtree after its last segment, e.g.
+// "docs/guides" -> "guides.zip", and the archive of the whole wiki "wiki.zip".
+func archiveFilename(dir string) string {
+	base := path.Base(strings.Trim(dir, "/"))
+	if base == "." || base == "/" || base == "" {
+		base = "wiki"
+	}
+	return sanitizeFilename(base) + ".zip"
+}
+
 // serveDownload writes bytes as a file download with the given media type and
 // filename.
 func serveDownload(w http.ResponseWriter, data []byte, mediaType, filename string) {
@@ -167,12 +318,17 @@ func exportFilename(page *wiki.Page, ext string) string {
 	if base == "." || base == "/" || base == "" {
 		base = "page"
 	}
-	base = strings.Map(func(r rune) rune {
+	return sanitizeFilename(base) + "." + ext
+}
+
+// sanitizeFilename replaces the characters that would break out of a quoted
+// Content-Disposition filename.
+func sanitizeFilename(name string) string {
+	return strings.Map(func(r rune) rune {
 		switch r {
 		case '"', '\\', '/', '\n', '\r', 0:
 			return '_'
 		}
 		return r
-	}, base)
-	return base + "." + ext
+	}, name)
 }
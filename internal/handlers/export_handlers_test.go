@@ -3,18 +3,22 @@ package handlers_test
 import (
 	"archive/zip"
 	"bytes"
+	"context"
+	"errors"
 	"io"
+	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
 	"strings"
 	"testing"
 
+	"github.com/sa/gopherwiki/internal/pandoc"
 	"github.com/sa/gopherwiki/internal/testutil"
 )
 
 func TestExportMarkdownZipWorksWithoutRenderService(t *testing.T) {
 	env := testutil.SetupTestEnv(t)
-	env.Store.Store("notes.md", "# Notes\n\nbody\n", "init", author)
+	env.Store.Store(context.Background(), "notes.md", "# Notes\n\nbody\n", "init", author)
 	// No RenderService: md-zip is pure Go and must still work.
 
 	req := httptest.NewRequest("GET", "/notes/export?format=md-zip", nil)
@@ -54,7 +58,7 @@ func TestExportMarkdownZipWorksWithoutRenderService(t *testing.T) {
 
 func TestExportQuartoFormatServesDownload(t *testing.T) {
 	env := testutil.SetupTestEnv(t)
-	env.Store.Store("report.md", "# Report\n", "init", author)
+	env.Store.Store(context.Background(), "report.md", "# Report\n", "init", author)
 	env.Server.RenderService = &fakeRenderService{exportAvailable: true}
 
 	req := httptest.NewRequest("GET", "/report/export?format=pdf", nil)
@@ -74,7 +78,7 @@ func TestExportQuartoFormatServesDownload(t *testing.T) {
 
 func TestExportRewritesWikilinksInSource(t *testing.T) {
 	env := testutil.SetupTestEnv(t)
-	env.Store.Store("report.md", "# Report\nSee [[Other Page]] and [[#7]].\n", "init", author)
+	env.Store.Store(context.Background(), "report.md", "# Report\nSee [[Other Page]] and [[#7]].\n", "init", author)
 	fake := &fakeRenderService{exportAvailable: true}
 	env.Server.RenderService = fake
 
@@ -101,7 +105,7 @@ func TestExportRewritesWikilinksInSource(t *testing.T) {
 
 func TestExportWorksWhenExecutionDisabled(t *testing.T) {
 	env := testutil.SetupTestEnv(t)
-	env.Store.Store("report.md", "# Report\n", "init", author)
+	env.Store.Store(context.Background(), "report.md", "# Report\n", "init", author)
 	// Toolchain present for export, but gated execution is OFF (no cache):
 	// export must still succeed. This is the decoupling guarantee.
 	env.Server.RenderService = &fakeRenderService{available: false, exportAvailable: true}
@@ -120,7 +124,7 @@ func TestExportWorksWhenExecutionDisabled(t *testing.T) {
 
 func TestExportQuartoFormatDisabledWhenExportOff(t *testing.T) {
 	env := testutil.SetupTestEnv(t)
-	env.Store.Store("report.md", "# Report\n", "init", author)
+	env.Store.Store(context.Background(), "report.md", "# Report\n", "init", author)
 	// Toolchain present (execution may be on) but export not opted into.
 	env.Server.RenderService = &fakeRenderService{available: true, exportAvailable: false}
 
@@ -143,7 +147,7 @@ func TestExportQuartoFormatDisabledWhenExportOff(t *testing.T) {
 
 func TestExportQuartoFormatDisabledWithoutService(t *testing.T) {
 	env := testutil.SetupTestEnv(t)
-	env.Store.Store("report.md", "# Report\n", "init", author)
+	env.Store.Store(context.Background(), "report.md", "# Report\n", "init", author)
 	// No RenderService: a Quarto-only format is unavailable.
 
 	req := httptest.NewRequest("GET", "/report/export?format=pdf", nil)
@@ -157,7 +161,7 @@ func TestExportQuartoFormatDisabledWithoutService(t *testing.T) {
 
 func TestExportUnknownFormatIsBadRequest(t *testing.T) {
 	env := testutil.SetupTestEnv(t)
-	env.Store.Store("report.md", "# Report\n", "init", author)
+	env.Store.Store(context.Background(), "report.md", "# Report\n", "init", author)
 	env.Server.RenderService = &fakeRenderService{exportAvailable: true}
 
 	req := httptest.NewRequest("GET", "/report/export?format=bogus", nil)
@@ -171,7 +175,7 @@ func TestExportUnknownFormatIsBadRequest(t *testing.T) {
 
 func TestExportMissingFormatIsBadRequest(t *testing.T) {
 	env := testutil.SetupTestEnv(t)
-	env.Store.Store("report.md", "# Report\n", "init", author)
+	env.Store.Store(context.Background(), "report.md", "# Report\n", "init", author)
 
 	req := httptest.NewRequest("GET", "/report/export", nil)
 	w := httptest.NewRecorder()
@@ -193,3 +197,341 @@ func TestExportMissingPageIsNotFound(t *testing.T) {
 		t.Fatalf("status = %d, want %d", w.Code, http.StatusNotFound)
 	}
 }
+
+// fakeConverter implements DocumentConverter for handler tests without
+// invoking Pandoc.
+type fakeConverter struct {
+	lastInput pandoc.Input
+}
+
+func (f *fakeConverter) Formats() []pandoc.Format {
+	return []pandoc.Format{
+		{Name: "pdf", Label: "PDF", Ext: "pdf", MediaType: "application/pdf"},
+		{Name: "odt", Label: "OpenDocument (ODT)", Ext: "odt", MediaType: "application/vnd.oasis.opendocument.text"},
+	}
+}
+
+func (f *fakeConverter) Convert(ctx context.Context, in pandoc.Input, format string) ([]byte, pandoc.Format, error) {
+	f.lastInput = in
+	for _, fm := range f.Formats() {
+		if fm.Name == format {
+			return []byte("PANDOC:" + format), fm, nil
+		}
+	}
+	return nil, pandoc.Format{}, errors.New("unknown format")
+}
+
+func TestExportPandocFormatIncludesAttachments(t *testing.T) {
+	env := testutil.SetupTestEnv(t)
+	env.Store.Store(context.Background(), "report.md", "# Report\n\n![chart](/report/chart.png)\n![logo](https://example.com/logo.png)\n", "init", author)
+	env.Store.StoreBytes(context.Background(), "report/chart.png", []byte("PNG"), "add attachment", author)
+	fake := &fakeConverter{}
+	env.Server.Converter = fake
+
+	req := httptest.NewRequest("GET", "/report/export?format=odt", nil)
+	w := httptest.NewRecorder()
+	env.Router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200; body = %s", w.Code, w.Body.String())
+	}
+	if cd := w.Header().Get("Content-Disposition"); cd != `attachment; filename="report.odt"` {
+		t.Errorf("Content-Disposition = %q", cd)
+	}
+	if body := w.Body.String(); body != "PANDOC:odt" {
+		t.Errorf("body = %q, want PANDOC:odt", body)
+	}
+	if string(fake.lastInput.Resources["report/chart.png"]) != "PNG" {
+		t.Errorf("resources = %v, want the page's attachment", fake.lastInput.Resources)
+	}
+	if fake.lastInput.AttachmentDir != "report" {
+		t.Errorf("AttachmentDir = %q, want report", fake.lastInput.AttachmentDir)
+	}
+	// The converter resolves the images itself.
+	for _, want := range []string{"![chart](/report/chart.png)", "![logo](https://example.com/logo.png)"} {
+		if !strings.Contains(fake.lastInput.Source, want) {
+			t.Errorf("source = %q, want it to contain %q", fake.lastInput.Source, want)
+		}
+	}
+}
+
+func TestExportPrefersQuartoOverPandoc(t *testing.T) {
+	env := testutil.SetupTestEnv(t)
+	env.Store.Store(context.Background(), "report.md", "# Report\n", "init", author)
+	env.Server.RenderService = &fakeRenderService{exportAvailable: true}
+	env.Server.Converter = &fakeConverter{}
+
+	for format, want := range map[string]string{"pdf": "EXPORT:pdf", "odt": "PANDOC:odt"} {
+		req := httptest.NewRequest("GET", "/report/export?format="+format, nil)
+		w := httptest.NewRecorder()
+		env.Router.ServeHTTP(w, req)
+		if w.Code != http.StatusOK || w.Body.String() != want {
+			t.Errorf("format %s: status = %d, body = %q; want %q", format, w.Code, w.Body.String(), want)
+		}
+	}
+
+	// The menu lists each format once.
+	body := viewPage(t, env, "/report", "").Body.String()
+	if n := strings.Count(body, "export?format=pdf"); n != 1 {
+		t.Errorf("pdf offered %d times, want once", n)
+	}
+	for _, want := range []string{"export?format=odt", "export?format=print", "export?format=md-zip"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("export menu missing %q", want)
+		}
+	}
+}
+
+func TestExportPrintView(t *testing.T) {
+	env := testutil.SetupTestEnv(t)
+	env.Store.Store(context.Background(), "notes.md", "# Notes\n\nbody\n", "init", author)
+	// No converters: the print view is rendered in-process.
+
+	req := httptest.NewRequest("GET", "/notes/export?format=print", nil)
+	w := httptest.NewRecorder()
+	env.Router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200; body = %s", w.Code, w.Body.String())
+	}
+	body := w.Body.String()
+	for _, want := range []string{"js/print.", `media="all"`, "body"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("print view missing %q", want)
+		}
+	}
+
+	if body := viewPage(t, env, "/notes", "").Body.String(); strings.Contains(body, "js/print.") || !strings.Contains(body, `media="print"`) {
+		t.Error("regular page view should keep the print stylesheet for print media only")
+	}
+}
+
+// zipNames returns the names of the entries in a ZIP archive response.
+func zipNames(t *testing.T, w *httptest.ResponseRecorder) []string {
+	t.Helper()
+	zr, err := zip.NewReader(bytes.NewReader(w.Body.Bytes()), int64(w.Body.Len()))
+	if err != nil {
+		t.Fatalf("zip open: %v", err)
+	}
+	var names []string
+	for _, f := range zr.File {
+		names = append(names, f.Name)
+	}
+	return names
+}
+
+func TestWikiExportSubtree(t *testing.T) {
+	env := testutil.SetupTestEnv(t)
+	env.Store.Store(context.Background(), "home.md", "# Home\n", "init", author)
+	env.Store.Store(context.Background(), "docs.md", "# Docs\n", "init", author)
+	env.Store.Store(context.Background(), "docs/guide.md", "# Guide\n", "init", author)
+	env.Store.StoreBytes(context.Background(), "docs/guide/diagram.png", []byte("PNG"), "upload", author)
+	env.Store.Store(context.Background(), "docs/.drafts/wip.md", "# WIP\n", "init", author)
+	env.Store.Store(context.Background(), ".github/workflow.yml", "on: push\n", "init", author)
+
+	req := httptest.NewRequest("GET", "/-/export?path=docs/", nil)
+	w := httptest.NewRecorder()
+	env.Router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200; body = %s", w.Code, w.Body.String())
+	}
+	if cd := w.Header().Get("Content-Disposition"); cd != `attachment; filename="docs.zip"` {
+		t.Errorf("Content-Disposition = %q", cd)
+	}
+	got := strings.Join(zipNames(t, w), ",")
+	if want := "docs.md,docs/guide.md,docs/guide/diagram.png"; got != want {
+		t.Errorf("archive entries = %s, want %s", got, want)
+	}
+
+	// The whole wiki, without dot-directories.
+	req = httptest.NewRequest("GET", "/-/export", nil)
+	w = httptest.NewRecorder()
+	env.Router.ServeHTTP(w, req)
+	if cd := w.Header().Get("Content-Disposition"); cd != `attachment; filename="wiki.zip"` {
+		t.Errorf("Content-Disposition = %q", cd)
+	}
+	got = strings.Join(zipNames(t, w), ",")
+	for _, want := range []string{"home.md", "docs.md", "docs/guide/diagram.png"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("wiki archive %s missing %s", got, want)
+		}
+	}
+	if strings.Contains(got, ".github") || strings.Contains(got, ".drafts") || strings.Contains(got, ".git/") {
+		t.Errorf("wiki archive %s should exclude dot-directories", got)
+	}
+}
+
+func TestWikiExportMissingPathIsNotFound(t *testing.T) {
+	env := testutil.SetupTestEnv(t)
+	env.Store.Store(context.Background(), "home.md", "# Home\n", "init", author)
+
+	for _, path := range []string{"/-/export?path=ghost", "/-/export?path=.git"} {
+		req := httptest.NewRequest("GET", path, nil)
+		w := httptest.NewRecorder()
+		env.Router.ServeHTTP(w, req)
+		if w.Code != http.StatusNotFound {
+			t.Errorf("%s: status = %d, want %d", path, w.Code, http.StatusNotFound)
+		}
+	}
+}
+
+func TestWikiExportRequiresRead(t *testing.T) {
+	env := testutil.SetupTestEnv(t)
+	env.Server.Config.ReadAccess = "REGISTERED"
+	env.Store.Store(context.Background(), "home.md", "# Home\n", "init", author)
+
+	req := httptest.NewRequest("GET", "/-/export", nil)
+	w := httptest.NewRecorder()
+	env.Router.ServeHTTP(w, req)
+	if w.Code == http.StatusOK {
+		t.Errorf("anonymous export with REGISTERED read access: status = %d", w.Code)
+	}
+}
+
+// importZip returns a ZIP archive holding the given name/content pairs.
+func importZip(t *testing.T, files ...string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for i := 0; i+1 < len(files); i += 2 {
+		fw, _ := zw.Create(files[i])
+		fw.Write([]byte(files[i+1]))
+	}
+	zw.Close()
+	return buf.Bytes()
+}
+
+// postImport submits the admin import form with the archive and fields.
+func postImport(t *testing.T, env *testutil.TestEnv, archive []byte, fields map[string]string, cookies []*http.Cookie) *httptest.ResponseRecorder {
+	t.Helper()
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	fw, _ := mw.CreateFormFile("archive", "pages.zip")
+	fw.Write(archive)
+	for k, v := range fields {
+		mw.WriteField(k, v)
+	}
+	mw.Close()
+
+	req := httptest.NewRequest("POST", "/-/admin/import", &body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	for _, c := range cookies {
+		req.AddCookie(c)
+	}
+	w := httptest.NewRecorder()
+	env.Router.ServeHTTP(w, req)
+	return w
+}
+
+func TestAdminImport(t *testing.T) {
+	env := testutil.SetupTestEnv(t)
+	env.Store.Store(context.Background(), "home.md", "# Home\n", "init", author)
+	archive := importZip(t, "guide.md", "# Guide\n", "home.md", "# Replaced\n", ".hidden/x.md", "x")
+
+	if w := postImport(t, env, archive, nil, loginAsUser(t, env, "user@example.com")); w.Code != http.StatusForbidden {
+		t.Errorf("non-admin status = %d, want %d", w.Code, http.StatusForbidden)
+	}
+
+	admin := loginAsAdmin(t, env)
+	w := postImport(t, env, archive, map[string]string{"dry_run": "1"}, admin)
+	if w.Code != http.StatusOK {
+		t.Fatalf("dry run status = %d; body = %s", w.Code, w.Body.String())
+	}
+	body := w.Body.String()
+	for _, want := range []string{"Dry Run Report", "Conflicts: 1", "Skipped: 1", "Nothing was committed"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("dry run report missing %q", want)
+		}
+	}
+	if env.Store.Exists(context.Background(), "guide.md") {
+		t.Fatal("dry run should not import")
+	}
+
+	w = postImport(t, env, archive, map[string]string{"overwrite": "1"}, admin)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "Import Report") {
+		t.Fatalf("import status = %d; body = %s", w.Code, w.Body.String())
+	}
+	if !env.Store.Exists(context.Background(), "guide.md") {
+		t.Error("guide.md should be imported")
+	}
+	if home, _ := env.Store.Load(context.Background(), "home.md", ""); home != "# Replaced\n" {
+		t.Errorf("home.md = %q, want it overwritten", home)
+	}
+
+	w = postImport(t, env, []byte("not a zip"), nil, admin)
+	if !strings.Contains(w.Body.String(), "invalid import archive") {
+		t.Errorf("invalid archive should be reported, got status %d", w.Code)
+	}
+}
+
+const testMediaWikiDump = `<mediawiki>
+  <siteinfo>
+    <namespaces><namespace key="0" /><namespace key="1">Talk</namespace></namespaces>
+  </siteinfo>
+  <page>
+    <title>Main Page</title>
+    <ns>0</ns>
+    <revision>
+      <timestamp>2020-01-02T03:04:05Z</timestamp>
+      <contributor><username>Alice</username></contributor>
+      <text>Hello '''world'''.</text>
+    </revision>
+  </page>
+  <page>
+    <title>Talk:Main Page</title>
+    <ns>1</ns>
+    <revision><text>Discussion.</text></revision>
+  </page>
+</mediawiki>`
+
+func TestAdminImportMediaWiki(t *testing.T) {
+	env := testutil.SetupTestEnv(t)
+	admin := loginAsAdmin(t, env)
+
+	post := func(dump string, fields map[string]string) *httptest.ResponseRecorder {
+		var body bytes.Buffer
+		mw := multipart.NewWriter(&body)
+		fw, _ := mw.CreateFormFile("dump", "wiki.xml")
+		fw.Write([]byte(dump))
+		for k, v := range fields {
+			mw.WriteField(k, v)
+		}
+		mw.Close()
+		req := httptest.NewRequest("POST", "/-/admin/import/mediawiki", &body)
+		req.Header.Set("Content-Type", mw.FormDataContentType())
+		for _, c := range admin {
+			req.AddCookie(c)
+		}
+		w := httptest.NewRecorder()
+		env.Router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := post(testMediaWikiDump, map[string]string{"dry_run": "1"})
+	if w.Code != http.StatusOK {
+		t.Fatalf("dry run status = %d; body = %s", w.Code, w.Body.String())
+	}
+	body := w.Body.String()
+	for _, want := range []string{"Dry Run Report", "New: 1", "Skipped: 1", "talk page", "1 revision"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("dry run report missing %q", want)
+		}
+	}
+	if env.Store.Exists(context.Background(), "main-page.md") {
+		t.Fatal("dry run should not import")
+	}
+
+	w = post(testMediaWikiDump, nil)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "Import Report") {
+		t.Fatalf("import status = %d; body = %s", w.Code, w.Body.String())
+	}
+	if content, _ := env.Store.Load(context.Background(), "main-page.md", ""); content != "Hello **world**.\n" {
+		t.Errorf("main-page.md = %q", content)
+	}
+
+	w = post("not a dump", nil)
+	if !strings.Contains(w.Body.String(), "invalid dump") {
+		t.Errorf("invalid dump should be reported, got status %d", w.Code)
+	}
+}
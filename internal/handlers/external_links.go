@@ -0,0 +1,135 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/sa/gopherwiki/internal/checks"
+	"github.com/sa/gopherwiki/internal/db"
+	"github.com/sa/gopherwiki/internal/linkcheck"
+	"github.com/sa/gopherwiki/internal/wiki"
+)
+
+// CheckExternalLinks records the links of every page to other sites, and
+// checks those not checked in the last EXTERNAL_LINK_CHECK_HOURS, or all
+// of them when it is 0. A host that answers 429 is not asked again until
+// the next run, which checks its remaining links.
+func (s *Server) CheckExternalLinks(ctx context.Context) error {
+	infos, err := s.Wiki.PageInfos(ctx)
+	if err != nil {
+		return err
+	}
+	links := make(map[string][]string, len(infos))
+	for _, p := range infos {
+		page, err := wiki.NewPage(ctx, s.Storage, s.Config, p.Path, "")
+		if err != nil {
+			return err
+		}
+		if urls := checks.ExternalLinks(page.Content); len(urls) > 0 {
+			links[p.Path] = urls
+		}
+	}
+	if err := s.DB.SetPageExternalLinks(ctx, links); err != nil {
+		return err
+	}
+
+	list, err := s.DB.ListExternalLinks(ctx)
+	if err != nil {
+		return err
+	}
+	due := time.Now().Add(-time.Duration(s.Config.ExternalLinkCheckHours) * time.Hour)
+	checker := s.linkChecker(ctx)
+	checked, broken := 0, 0
+	for _, l := range list {
+		if !l.CheckedAt.IsZero() && l.CheckedAt.After(due) {
+			continue
+		}
+		res := checker.Check(ctx, l.URL)
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if res.Limited {
+			continue
+		}
+		l.Status, l.Error, l.Blocked, l.CheckedAt = res.Status, res.Error, res.Blocked, time.Now()
+		if err := s.DB.SetExternalLinkResult(ctx, l); err != nil {
+			return err
+		}
+		checked++
+		if res.Broken() {
+			broken++
+		}
+	}
+	slog.Info("checked external links", "links", len(list), "checked", checked, "broken", broken)
+	return nil
+}
+
+// linkChecker returns the checker of a run of CheckExternalLinks, which
+// names the wiki in its User-Agent.
+func (s *Server) linkChecker(ctx context.Context) *linkcheck.Checker {
+	if s.LinkChecker != nil {
+		return s.LinkChecker()
+	}
+	userAgent := "GopherWiki/" + s.Version + " (link checker)"
+	if siteURL := s.Settings.Get(ctx).SiteURL; siteURL != "" {
+		userAgent = "GopherWiki/" + s.Version + " (link checker; +" + siteURL + ")"
+	}
+	return linkcheck.New(userAgent)
+}
+
+// externalLinkProblem describes how a broken external link failed, as
+// "404 Not Found" or the reason there was no response.
+func externalLinkProblem(l db.ExternalLink) string {
+	if l.Error != "" {
+		return l.Error
+	}
+	return fmt.Sprintf("%d %s", l.Status, http.StatusText(l.Status))
+}
+
+// brokenExternalLink is a broken link of the external links report.
+type brokenExternalLink struct {
+	db.ExternalLink
+	Problem string
+}
+
+// handleExternalLinksReport lists the links to other sites that were
+// broken when they were last checked, with the pages linking to them.
+func (s *Server) handleExternalLinksReport(w http.ResponseWriter, r *http.Request) {
+	list, err := s.DB.ListExternalLinks(r.Context())
+	if err != nil {
+		s.renderFailure(w, r, err)
+		return
+	}
+	var broken []brokenExternalLink
+	unchecked, blocked := 0, 0
+	var lastChecked time.Time
+	for _, l := range list {
+		res := linkcheck.Result{Status: l.Status, Error: l.Error, Blocked: l.Blocked}
+		switch {
+		case l.CheckedAt.IsZero():
+			unchecked++
+			continue
+		case l.Blocked:
+			blocked++
+		case res.Broken():
+			broken = append(broken, brokenExternalLink{ExternalLink: l, Problem: externalLinkProblem(l)})
+		}
+		if l.CheckedAt.After(lastChecked) {
+			lastChecked = l.CheckedAt
+		}
+	}
+
+	data := NewGenericData("External Links")
+	data["broken"] = broken
+	data["total"] = len(list)
+	data["unchecked"] = unchecked
+	data["blocked"] = blocked
+	data["last_checked"] = lastChecked
+	if !s.Config.Offline {
+		data["check_hours"] = s.Config.ExternalLinkCheckHours
+	}
+	s.renderTemplate(w, r, "reports_external_links.html", data)
+}
@@ -0,0 +1,77 @@
+package handlers_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/sa/gopherwiki/internal/linkcheck"
+	"github.com/sa/gopherwiki/internal/storage"
+	"github.com/sa/gopherwiki/internal/testutil"
+)
+
+func TestExternalLinks(t *testing.T) {
+	env := testutil.SetupTestEnv(t)
+	ctx := context.Background()
+	var requests atomic.Int32
+	site := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		switch r.URL.Path {
+		case "/robots.txt":
+			w.Write([]byte("User-agent: *\nDisallow: /private\n"))
+		case "/ok":
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer site.Close()
+	env.Server.LinkChecker = func() *linkcheck.Checker {
+		return linkcheck.NewWithClient(site.Client(), "GopherWiki/test", 0)
+	}
+	env.Server.Config.ExternalLinkCheckHours = 24
+
+	author := storage.Author{Name: "Alice", Email: "alice@example.com"}
+	for name, content := range map[string]string{
+		"home.md":  "# Home\n\n[fine](" + site.URL + "/ok) and [gone](" + site.URL + "/gone)\n",
+		"guide.md": "# Guide\n\n[gone again](" + site.URL + "/gone) [hidden](" + site.URL + "/private/x)\n",
+	} {
+		if _, err := env.Store.Store(ctx, name, content, "Add "+name, author); err != nil {
+			t.Fatal(err)
+		}
+	}
+	get := func() string {
+		w := httptest.NewRecorder()
+		env.Router.ServeHTTP(w, httptest.NewRequest("GET", "/-/reports/external-links", nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("status = %d, want %d", w.Code, http.StatusOK)
+		}
+		return w.Body.String()
+	}
+
+	if body := get(); !strings.Contains(body, "No broken external links") {
+		t.Errorf("report before any check:\n%s", body)
+	}
+	if err := env.Server.CheckExternalLinks(ctx); err != nil {
+		t.Fatal(err)
+	}
+	body := get()
+	if !strings.Contains(body, site.URL+"/gone</a>") || !strings.Contains(body, "404 Not Found") ||
+		!strings.Contains(body, `<a href="/guide">guide</a>, <a href="/home">home</a>`) {
+		t.Errorf("report lacks the broken link and its pages:\n%s", body)
+	}
+	if strings.Contains(body, site.URL+"/ok</a>") || !strings.Contains(body, "3 links, 1 not checked as their site's robots.txt asks") {
+		t.Errorf("report of the working and disallowed links:\n%s", body)
+	}
+
+	// Links checked within the interval are not checked again.
+	before := requests.Load()
+	if err := env.Server.CheckExternalLinks(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if n := requests.Load() - before; n != 0 {
+		t.Errorf("second run made %d requests, want none", n)
+	}
+}
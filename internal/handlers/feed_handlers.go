@@ -1,115 +1,360 @@
 package handlers
 
 import (
+	"context"
 	"fmt"
-	"html"
 	"log/slog"
 	"net/http"
+	"path"
+	"slices"
+	"strings"
 	"time"
 
+	"github.com/go-chi/chi/v5"
+
+	"github.com/sa/gopherwiki/internal/db"
+	"github.com/sa/gopherwiki/internal/feeds"
+	"github.com/sa/gopherwiki/internal/middleware"
+	"github.com/sa/gopherwiki/internal/storage"
 	"github.com/sa/gopherwiki/internal/util"
+	"github.com/sa/gopherwiki/internal/wiki"
 )
 
-// handleFeed handles the RSS feed.
-func (s *Server) handleFeed(w http.ResponseWriter, r *http.Request) {
-	changelog, err := s.Wiki.Changelog(r.Context(), 20)
+// feedSize is the number of entries in each feed.
+const feedSize = 20
+
+// publicFeedWindow is how many times the feed size of the changelog the
+// feed of visitors who may read only the public pages is taken from.
+const publicFeedWindow = 10
+
+// feedSummaryBlocks is how many leading markdown blocks of a page are
+// rendered into a feed entry's content.
+const feedSummaryBlocks = 3
+
+// writeFeed renders f in the requested format, logging (rather than
+// reporting) failures since the response has already started.
+func writeFeed(w http.ResponseWriter, f *feeds.Feed, atom bool) {
+	var err error
+	if atom {
+		w.Header().Set("Content-Type", "application/atom+xml; charset=utf-8")
+		err = feeds.WriteAtom(w, f)
+	} else {
+		w.Header().Set("Content-Type", "application/rss+xml; charset=utf-8")
+		err = feeds.WriteRSS(w, f)
+	}
 	if err != nil {
-		slog.Warn("failed to get changelog for feed", "error", err)
+		slog.Warn("failed to write feed", "error", err)
+	}
+}
+
+// summarizeMarkdown returns the first n blank-line separated blocks of body.
+func summarizeMarkdown(body string, n int) string {
+	blocks := strings.Split(strings.TrimSpace(body), "\n\n")
+	if len(blocks) > n {
+		blocks = blocks[:n]
 	}
+	return strings.Join(blocks, "\n\n")
+}
 
-	w.Header().Set("Content-Type", "application/rss+xml; charset=utf-8")
-	fmt.Fprintf(w, `<?xml version="1.0" encoding="UTF-8"?>
-<rss version="2.0">
-<channel>
-<title>%s</title>
-<link>%s</link>
-<description>Recent changes</description>
-`, html.EscapeString(s.Config.SiteName), s.Config.SiteURL)
+// pageSummaryHTML renders the opening blocks of a page as of revision for a
+// reader of the pages canRead accepts, or returns "" if the page did not
+// exist at that revision.
+func (s *Server) pageSummaryHTML(ctx context.Context, pagepath, revision string, canRead func(string) bool) string {
+	page, err := wiki.NewPage(ctx, s.Storage, s.Config, pagepath, revision)
+	if err != nil || !page.Exists {
+		return ""
+	}
+	page.Body = summarizeMarkdown(page.Body, feedSummaryBlocks)
+	html, _, _ := page.RenderFor(s.Renderer, canRead)
+	return html
+}
 
-	for _, entry := range changelog {
-		fmt.Fprintf(w, `<item>
-<title>%s</title>
-<link>%s/-/commit/%s</link>
-<pubDate>%s</pubDate>
-<author>%s</author>
-</item>
-`, html.EscapeString(entry.Message), s.Config.SiteURL, entry.Revision, entry.Datetime.Format(time.RFC1123Z), html.EscapeString(entry.AuthorEmail))
+// feedNotModified sets validation and caching headers for a feed whose
+// newest entry has the given ETag and timestamp, and reports whether a 304
+// has been written. Where reading needs an account, what a feed lists
+// depends on who asks, so shared caches must not keep it.
+func (s *Server) feedNotModified(w http.ResponseWriter, r *http.Request, etag string, modified time.Time) bool {
+	if s.readRestricted(r) {
+		w.Header().Set("Cache-Control", "private, max-age=300")
+	} else {
+		w.Header().Set("Cache-Control", "public, max-age=300")
 	}
+	return notModified(w, r, etag, modified)
+}
 
-	fmt.Fprint(w, `</channel>
-</rss>`)
+// feedsDisabled reports whether an admin has turned the feeds off, having
+// answered 404 if so.
+func (s *Server) feedsDisabled(w http.ResponseWriter, r *http.Request) bool {
+	if !s.Settings.Get(r.Context()).DisableFeeds {
+		return false
+	}
+	s.renderError(w, r, http.StatusNotFound, "Feeds are disabled")
+	return true
+}
+
+// commitFeedItems converts commits to feed items linking to each commit. An
+// item's content summarizes pagepath as of that commit or, when pagepath is
+// empty, the first page the commit touched.
+func (s *Server) commitFeedItems(ctx context.Context, commits []storage.CommitMetadata, pagepath, siteURL string, canRead func(string) bool) []feeds.Item {
+	items := make([]feeds.Item, 0, len(commits))
+	for _, c := range commits {
+		item := feeds.Item{
+			Title:       c.Message,
+			Link:        siteURL + "/-/commit/" + c.Revision,
+			AuthorName:  c.AuthorName,
+			AuthorEmail: c.AuthorEmail,
+			Updated:     c.Datetime,
+		}
+		summarized := pagepath
+		for _, f := range c.Files {
+			if summarized == "" && util.IsMarkdownFile(f) {
+				summarized = util.StripMarkdownExtension(f)
+			}
+		}
+		if summarized != "" {
+			item.Content = s.pageSummaryHTML(ctx, summarized, c.RevisionFull, canRead)
+		}
+		items = append(items, item)
+	}
+	return items
+}
+
+// feedCommits returns the commits whose every file is of a page listed,
+// the page itself or its attachments, with the number the feed shows at
+// most.
+func feedCommits(commits []storage.CommitMetadata, listed func(pagepath string) bool) []storage.CommitMetadata {
+	commits = slices.DeleteFunc(commits, func(c storage.CommitMetadata) bool {
+		for _, f := range c.Files {
+			if !listed(filePage(f)) {
+				return true
+			}
+		}
+		return len(c.Files) == 0
+	})
+	return commits[:min(len(commits), feedSize)]
+}
+
+// noindexPages returns the paths of the pages whose frontmatter keeps them
+// out of the sitemap and feeds.
+func (s *Server) noindexPages(ctx context.Context) map[string]bool {
+	pages, err := s.Wiki.PageMetadata(ctx)
+	if err != nil {
+		slog.Warn("failed to get page metadata for noindex pages", "error", err)
+	}
+	noindex := make(map[string]bool)
+	for _, m := range pages {
+		if m.NoIndex {
+			noindex[m.Pagepath] = true
+		}
+	}
+	return noindex
+}
+
+// filePage returns the path of the page a file in the repository is, or
+// is an attachment of.
+func filePage(filename string) string {
+	if util.IsMarkdownFile(filename) {
+		return util.StripMarkdownExtension(filename)
+	}
+	return path.Dir(filename)
+}
+
+// serveChangelogFeed serves the wiki-wide feed, or a namespace feed when the
+// request carries ?path= (e.g. ?path=docs/), in the requested format.
+func (s *Server) serveChangelogFeed(w http.ResponseWriter, r *http.Request, atom bool) {
+	if s.feedsDisabled(w, r) {
+		return
+	}
+	ctx := r.Context()
+	prefix := strings.TrimPrefix(r.URL.Query().Get("path"), "/")
+	// Visitors who may read only the public pages get the changes to those
+	// among a longer stretch of the changelog, each linking to its page.
+	// Changes to noindex pages are left out for everyone.
+	everything := s.PermissionChecker.HasPermission(r, middleware.PermissionRead)
+	readable := s.PermissionChecker.PageFilter(r)
+	noindex := s.noindexPages(ctx)
+	limit := feedSize
+	if !everything || len(noindex) > 0 {
+		limit = feedSize * publicFeedWindow
+	}
+	commits, err := s.Wiki.QueryChangelog(ctx, storage.LogQuery{PathPrefix: prefix, Limit: limit})
+	if err != nil {
+		slog.Warn("failed to get changelog for feed", "error", err)
+	}
+	if !everything || len(noindex) > 0 {
+		commits = feedCommits(commits, func(pagepath string) bool { return readable(pagepath) && !noindex[pagepath] })
+	}
+	etagSuffix := ""
+	if !everything {
+		etagSuffix = "-" + db.PageVisibilityPublic
+	}
+	if len(commits) > 0 && s.feedNotModified(w, r, `"`+commits[0].RevisionFull+etagSuffix+`"`, commits[0].Datetime) {
+		return
+	}
+
+	f := &feeds.Feed{
+		Title:       s.Config.SiteName,
+		Link:        s.siteURL(r) + "/",
+		Description: "Recent changes",
+		Items:       s.commitFeedItems(ctx, commits, "", s.siteURL(r), readable),
+	}
+	if !everything {
+		for i, c := range commits {
+			f.Items[i].Link = s.siteURL(r) + "/" + filePage(c.Files[0])
+		}
+	}
+	if prefix != "" {
+		f.Title = s.Config.SiteName + ": " + prefix
+		f.Description = "Recent changes under " + prefix
+	}
+	writeFeed(w, f, atom)
+}
+
+// handleFeed handles the RSS feed.
+func (s *Server) handleFeed(w http.ResponseWriter, r *http.Request) {
+	s.serveChangelogFeed(w, r, false)
 }
 
 // handleAtomFeed handles the Atom feed.
 func (s *Server) handleAtomFeed(w http.ResponseWriter, r *http.Request) {
-	changelog, err := s.Wiki.Changelog(r.Context(), 20)
+	s.serveChangelogFeed(w, r, true)
+}
+
+// handlePageFeed handles the RSS feed of a single page's history.
+func (s *Server) handlePageFeed(w http.ResponseWriter, r *http.Request) {
+	if s.feedsDisabled(w, r) {
+		return
+	}
+	// A reader polling an unchanged page is answered from the metadata
+	// cache, without reading the page or its history.
+	if meta, err := s.Wiki.PageMeta(r.Context(), chi.URLParam(r, "path")); err == nil && meta != nil && meta.Revision != "" && !meta.NoIndex {
+		if s.feedNotModified(w, r, `"`+meta.Revision+`"`, meta.Updated) {
+			return
+		}
+	}
+
+	page, err := wiki.NewPage(r.Context(), s.Storage, s.Config, chi.URLParam(r, "path"), "")
 	if err != nil {
-		slog.Warn("failed to get changelog for feed", "error", err)
+		s.renderFailure(w, r, err)
+		return
+	}
+	if !page.Exists || (page.Frontmatter != nil && bool(page.Frontmatter.NoIndex)) {
+		s.renderError(w, r, http.StatusNotFound, "Page not found")
+		return
+	}
+
+	commits, err := page.History(r.Context(), feedSize)
+	if err != nil {
+		s.renderError(w, r, http.StatusInternalServerError, "Failed to get page history")
+		return
+	}
+	if len(commits) > 0 && s.feedNotModified(w, r, `"`+commits[0].RevisionFull+`"`, commits[0].Datetime) {
+		return
 	}
 
-	w.Header().Set("Content-Type", "application/atom+xml; charset=utf-8")
-	fmt.Fprintf(w, `<?xml version="1.0" encoding="UTF-8"?>
-<feed xmlns="http://www.w3.org/2005/Atom">
-<title>%s</title>
-<link href="%s"/>
-<id>%s/</id>
-`, html.EscapeString(s.Config.SiteName), s.Config.SiteURL, s.Config.SiteURL)
+	writeFeed(w, &feeds.Feed{
+		Title:       s.Config.SiteName + ": " + page.Pagename,
+		Link:        s.siteURL(r) + "/" + page.Pagepath,
+		Description: "Changes to " + page.Pagename,
+		Items:       s.commitFeedItems(r.Context(), commits, page.Pagepath, s.siteURL(r), s.PermissionChecker.PageFilter(r)),
+	}, false)
+}
 
-	if len(changelog) > 0 {
-		fmt.Fprintf(w, `<updated>%s</updated>
-`, changelog[0].Datetime.Format(time.RFC3339))
+// handleIssuesFeed handles the Atom feed of recently updated issues.
+func (s *Server) handleIssuesFeed(w http.ResponseWriter, r *http.Request) {
+	if s.feedsDisabled(w, r) {
+		return
+	}
+	issues, err := s.DB.Queries.ListRecentlyUpdatedIssues(r.Context(), feedSize)
+	if err != nil {
+		s.renderError(w, r, http.StatusInternalServerError, "Failed to list issues")
+		return
 	}
 
-	for _, entry := range changelog {
-		fmt.Fprintf(w, `<entry>
-<title>%s</title>
-<link href="%s/-/commit/%s"/>
-<id>%s/-/commit/%s</id>
-<updated>%s</updated>
-<author><name>%s</name></author>
-</entry>
-`, html.EscapeString(entry.Message), s.Config.SiteURL, entry.Revision, s.Config.SiteURL, entry.Revision, entry.Datetime.Format(time.RFC3339), html.EscapeString(entry.AuthorName))
+	if len(issues) > 0 {
+		newest := issues[0]
+		etag := fmt.Sprintf(`"issues-%d-%d-%d"`, newest.ID, newest.UpdatedAt.Time.UnixNano(), len(issues))
+		if s.feedNotModified(w, r, etag, newest.UpdatedAt.Time) {
+			return
+		}
+	}
+
+	items := make([]feeds.Item, 0, len(issues))
+	for _, issue := range issues {
+		item := feeds.Item{
+			Title:       fmt.Sprintf("[%s] %s", issue.Status, issue.Title),
+			Link:        fmt.Sprintf("%s/-/issues/%d", s.siteURL(r), issue.ID),
+			AuthorName:  issue.CreatedByName.String,
+			AuthorEmail: issue.CreatedByEmail.String,
+			Updated:     issue.UpdatedAt.Time,
+		}
+		if issue.Description.Valid && issue.Description.String != "" {
+			item.Content, _, _ = s.Renderer.Render(issue.Description.String, "")
+		}
+		items = append(items, item)
 	}
 
-	fmt.Fprint(w, `</feed>`)
+	writeFeed(w, &feeds.Feed{
+		Title: s.Config.SiteName + ": Issues",
+		Link:  s.siteURL(r) + "/-/issues",
+		Items: items,
+	}, true)
 }
 
-// handleRobotsTxt handles the robots.txt file.
+// handleRobotsTxt handles the robots.txt file, which keeps crawlers out of
+// the ROBOTS_DISALLOW paths and points to the sitemap unless it is
+// disabled.
 func (s *Server) handleRobotsTxt(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
-	fmt.Fprintf(w, `User-agent: *
-Allow: /
-Sitemap: %s/-/sitemap.xml
-`, s.Config.SiteURL)
+	fmt.Fprint(w, "User-agent: *\n")
+	for _, prefix := range s.Config.RobotsDisallowPaths() {
+		fmt.Fprintf(w, "Disallow: %s\n", prefix)
+	}
+	fmt.Fprint(w, "Allow: /\n")
+	if !s.Settings.Get(r.Context()).DisableSitemap {
+		fmt.Fprintf(w, "Sitemap: %s/-/sitemap.xml\n", s.siteURL(r))
+	}
 }
 
-// handleSitemap handles the sitemap.xml file.
+// handleSitemap handles the sitemap.xml file, listing the pages the user
+// may read, but not those marked noindex.
 func (s *Server) handleSitemap(w http.ResponseWriter, r *http.Request) {
-	pages, err := s.Wiki.PageIndex(r.Context())
+	if s.Settings.Get(r.Context()).DisableSitemap {
+		s.renderError(w, r, http.StatusNotFound, "The sitemap is disabled")
+		return
+	}
+	pages, err := s.Wiki.PageMetadata(r.Context())
 	if err != nil {
-		slog.Warn("failed to get page index for sitemap", "error", err)
+		slog.Warn("failed to get page metadata for sitemap", "error", err)
+	}
+	readable := s.PermissionChecker.PageFilter(r)
+	pages = slices.DeleteFunc(pages, func(m db.PageMetadata) bool { return m.NoIndex || !readable(m.Pagepath) })
+
+	// Each page is dated by its last commit; the newest dates the sitemap
+	// as a whole.
+	var newest time.Time
+	for _, page := range pages {
+		if page.Updated.After(newest) {
+			newest = page.Updated
+		}
 	}
 
+	// The ETag is added from the body by conditionalGET.
+	if notModified(w, r, "", newest) {
+		return
+	}
 	w.Header().Set("Content-Type", "application/xml; charset=utf-8")
 	fmt.Fprint(w, `<?xml version="1.0" encoding="UTF-8"?>
 <urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
 `)
 
+	siteURL := s.siteURL(r)
 	for _, page := range pages {
-		// A page may be stored as .md or .qmd; use the mtime of whichever
-		// source file exists.
-		var mtime time.Time
-		for _, candidate := range util.CandidateFilenames(page.Path) {
-			if m, err := s.Storage.Mtime(candidate); err == nil {
-				mtime = m
-				break
-			}
-		}
 		fmt.Fprintf(w, `<url>
 <loc>%s/%s</loc>
 <lastmod>%s</lastmod>
 </url>
-`, s.Config.SiteURL, page.Path, mtime.Format("2006-01-02"))
+`, siteURL, page.Pagepath, page.Updated.Format("2006-01-02"))
 	}
 
 	fmt.Fprint(w, `</urlset>`)
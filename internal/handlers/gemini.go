@@ -0,0 +1,170 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/sa/gopherwiki/internal/gemini"
+	"github.com/sa/gopherwiki/internal/util"
+	"github.com/sa/gopherwiki/internal/wiki"
+)
+
+// ServeGemini serves the wiki read-only over Gemini: pages as gemtext at
+// their usual paths, their attachments, the page index at /-/index, and
+// search at /-/search. Gemini visitors are anonymous, so with GEMINI_ACCESS
+// set to INHERIT nothing is served unless anonymous users may read the wiki.
+func (s *Server) ServeGemini(w gemini.ResponseWriter, r *gemini.Request) {
+	ctx := context.Background()
+	if s.Config.GeminiAccess != "ANONYMOUS" && s.Settings.Get(ctx).ReadAccess != "ANONYMOUS" {
+		w.WriteHeader(gemini.StatusPermanentFailure, "This wiki requires a login; visit it on the web")
+		return
+	}
+
+	path := strings.Trim(r.URL.Path, "/")
+	switch {
+	case path == "":
+		s.geminiHome(ctx, w)
+	case path == "-/index":
+		s.geminiIndex(ctx, w)
+	case path == "-/search":
+		s.geminiSearch(ctx, w, r)
+	case strings.HasPrefix(path, "-/") || isHiddenPath(path):
+		w.WriteHeader(gemini.StatusNotFound, "Not found")
+	default:
+		s.geminiView(ctx, w, path)
+	}
+}
+
+// geminiHome serves the home page followed by links to the index and search.
+func (s *Server) geminiHome(ctx context.Context, w gemini.ResponseWriter) {
+	homePage := s.Settings.Get(ctx).HomePage
+	if homePage == "" {
+		homePage = "Home"
+	}
+	var b strings.Builder
+	if page, err := wiki.NewPage(ctx, s.Storage, s.Config, homePage, ""); err == nil && page.Exists && !strings.HasPrefix(homePage, "/-/") {
+		b.WriteString(s.geminiPage(page))
+	} else {
+		fmt.Fprintf(&b, "# %s\n", s.getSiteSettings(ctx).Name)
+	}
+	b.WriteString("\n=> /-/index Page index\n=> /-/search Search\n")
+	w.WriteHeader(gemini.StatusSuccess, gemini.MediaType)
+	w.Write([]byte(b.String()))
+}
+
+// geminiIndex lists every page, sorted by path.
+func (s *Server) geminiIndex(ctx context.Context, w gemini.ResponseWriter) {
+	pages, err := s.Wiki.PageIndex(ctx)
+	if err != nil {
+		w.WriteHeader(gemini.StatusTemporaryFailure, "Could not list pages")
+		return
+	}
+	sort.Slice(pages, func(i, j int) bool { return pages[i].Path < pages[j].Path })
+
+	var b strings.Builder
+	b.WriteString("# Page index\n\n")
+	for _, p := range pages {
+		if isHiddenPath(p.Path) {
+			continue
+		}
+		fmt.Fprintf(&b, "=> %s %s\n", geminiPageURL(p.Path), p.Path)
+	}
+	w.WriteHeader(gemini.StatusSuccess, gemini.MediaType)
+	w.Write([]byte(b.String()))
+}
+
+// geminiSearch asks for a query, then lists the pages matching it.
+func (s *Server) geminiSearch(ctx context.Context, w gemini.ResponseWriter, r *gemini.Request) {
+	query, err := url.QueryUnescape(r.URL.RawQuery)
+	if err != nil || strings.TrimSpace(query) == "" {
+		w.WriteHeader(gemini.StatusInput, "Search the wiki")
+		return
+	}
+	results, err := s.Wiki.Search(ctx, query)
+	if err != nil {
+		w.WriteHeader(gemini.StatusTemporaryFailure, "Search failed")
+		return
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "# Search: %s\n\n", query)
+	if len(results) == 0 {
+		b.WriteString("No pages found.\n")
+	}
+	for _, res := range results {
+		if isHiddenPath(res.Pagepath) {
+			continue
+		}
+		fmt.Fprintf(&b, "=> %s %s\n", geminiPageURL(res.Pagepath), res.Pagename)
+	}
+	b.WriteString("\n=> /-/search Search again\n")
+	w.WriteHeader(gemini.StatusSuccess, gemini.MediaType)
+	w.Write([]byte(b.String()))
+}
+
+// geminiView serves a page as gemtext, or an attachment as it is stored.
+func (s *Server) geminiView(ctx context.Context, w gemini.ResponseWriter, path string) {
+	if idx := strings.LastIndex(path, "/"); idx > 0 {
+		parentFilename := util.GetFilename(path[:idx])
+		if !s.Config.RetainPageNameCase {
+			parentFilename = strings.ToLower(parentFilename)
+		}
+		attachmentPath := util.GetAttachmentDirectoryname(parentFilename) + "/" + path[idx+1:]
+		if s.Storage.Exists(ctx, attachmentPath) {
+			s.geminiAttachment(ctx, w, attachmentPath)
+			return
+		}
+	}
+	if s.Config.ObsidianCompat && !util.IsMarkdownFile(path) && s.Storage.Exists(ctx, path) && !s.Storage.IsDir(ctx, path) {
+		s.geminiAttachment(ctx, w, path)
+		return
+	}
+
+	page, err := wiki.NewPage(ctx, s.Storage, s.Config, path, "")
+	if err != nil {
+		w.WriteHeader(gemini.StatusTemporaryFailure, "Could not load the page")
+		return
+	}
+	if !page.Exists {
+		if target, ok := s.aliasRedirect(ctx, path, ""); ok {
+			w.WriteHeader(gemini.StatusRedirect, target)
+			return
+		}
+		w.WriteHeader(gemini.StatusNotFound, "Page not found")
+		return
+	}
+	w.WriteHeader(gemini.StatusSuccess, gemini.MediaType)
+	w.Write([]byte(s.geminiPage(page)))
+}
+
+// geminiPage renders a page as gemtext, under a title heading if the page
+// does not start with one, and ending with a link to the page on the web.
+func (s *Server) geminiPage(page *wiki.Page) string {
+	body := s.Renderer.Gemtext(page.Body, page.PageViewURL)
+	if !strings.HasPrefix(body, "# ") {
+		body = "# " + page.PagenameFull + "\n\n" + body
+	}
+	if siteURL := strings.TrimSuffix(s.Config.SiteURL, "/"); siteURL != "" {
+		body += "\n=> " + siteURL + geminiPageURL(page.Pagepath) + " View on the web\n"
+	}
+	return body
+}
+
+func (s *Server) geminiAttachment(ctx context.Context, w gemini.ResponseWriter, path string) {
+	content, err := s.Storage.LoadBytes(ctx, path, "")
+	if err != nil {
+		w.WriteHeader(gemini.StatusNotFound, "File not found")
+		return
+	}
+	w.WriteHeader(gemini.StatusSuccess, util.GuessMimetype(filepath.Base(path)))
+	w.Write(content)
+}
+
+// geminiPageURL returns the link to a page path.
+func geminiPageURL(pagepath string) string {
+	return (&url.URL{Path: "/" + pagepath}).String()
+}
@@ -0,0 +1,100 @@
+package handlers_test
+
+import (
+	"bytes"
+	"context"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/sa/gopherwiki/internal/gemini"
+	"github.com/sa/gopherwiki/internal/testutil"
+)
+
+// geminiRecorder records a Gemini response.
+type geminiRecorder struct {
+	status int
+	meta   string
+	body   bytes.Buffer
+}
+
+func (r *geminiRecorder) WriteHeader(status int, meta string) {
+	r.status, r.meta = status, meta
+}
+
+func (r *geminiRecorder) Write(p []byte) (int, error) {
+	return r.body.Write(p)
+}
+
+func serveGemini(t *testing.T, env *testutil.TestEnv, rawURL string) *geminiRecorder {
+	t.Helper()
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := &geminiRecorder{}
+	env.Server.ServeGemini(w, &gemini.Request{URL: u})
+	return w
+}
+
+func TestServeGemini(t *testing.T) {
+	env := testutil.SetupTestEnv(t)
+	env.Store.Store(context.Background(), "home.md", "# Welcome\n\nSee [[Guide]].\n", "init", author)
+	env.Store.Store(context.Background(), "guide.md", "Read **this** first.\n", "init", author)
+	env.Store.StoreBytes(context.Background(), "guide/diagram.png", []byte("PNG"), "attach", author)
+	env.Server.Wiki.EnsureSearchIndex(context.Background())
+
+	w := serveGemini(t, env, "gemini://wiki.example.com/")
+	if w.status != gemini.StatusSuccess || w.meta != gemini.MediaType {
+		t.Fatalf("home: %d %s", w.status, w.meta)
+	}
+	for _, want := range []string{"# Welcome\n", "=> /Guide Guide\n", "=> /-/index Page index\n"} {
+		if !strings.Contains(w.body.String(), want) {
+			t.Errorf("home should contain %q:\n%s", want, w.body.String())
+		}
+	}
+
+	w = serveGemini(t, env, "gemini://wiki.example.com/Guide")
+	if got := w.body.String(); w.status != gemini.StatusSuccess || !strings.HasPrefix(got, "# Guide\n\nRead this first.\n") || !strings.Contains(got, "View on the web") {
+		t.Errorf("page: %d %q", w.status, got)
+	}
+
+	w = serveGemini(t, env, "gemini://wiki.example.com/-/index")
+	if got := w.body.String(); !strings.Contains(got, "=> /guide guide\n") || !strings.Contains(got, "=> /home home\n") {
+		t.Errorf("index:\n%s", got)
+	}
+
+	if w := serveGemini(t, env, "gemini://wiki.example.com/-/search"); w.status != gemini.StatusInput {
+		t.Errorf("search without a query: status = %d, want %d", w.status, gemini.StatusInput)
+	}
+	w = serveGemini(t, env, "gemini://wiki.example.com/-/search?first")
+	if got := w.body.String(); !strings.Contains(got, "=> /guide") {
+		t.Errorf("search results:\n%s", got)
+	}
+
+	w = serveGemini(t, env, "gemini://wiki.example.com/guide/diagram.png")
+	if w.status != gemini.StatusSuccess || w.meta != "image/png" || w.body.String() != "PNG" {
+		t.Errorf("attachment: %d %s %q", w.status, w.meta, w.body.String())
+	}
+
+	for _, path := range []string{"/missing", "/.git/config", "/-/admin"} {
+		if w := serveGemini(t, env, "gemini://wiki.example.com"+path); w.status != gemini.StatusNotFound {
+			t.Errorf("%s: status = %d, want %d", path, w.status, gemini.StatusNotFound)
+		}
+	}
+}
+
+func TestServeGeminiAccess(t *testing.T) {
+	env := testutil.SetupTestEnv(t)
+	env.Store.Store(context.Background(), "home.md", "# Welcome\n", "init", author)
+	env.Server.Config.ReadAccess = "REGISTERED"
+
+	if w := serveGemini(t, env, "gemini://wiki.example.com/"); w.status != gemini.StatusPermanentFailure {
+		t.Errorf("private wiki: status = %d, want %d", w.status, gemini.StatusPermanentFailure)
+	}
+
+	env.Server.Config.GeminiAccess = "ANONYMOUS"
+	if w := serveGemini(t, env, "gemini://wiki.example.com/"); w.status != gemini.StatusSuccess {
+		t.Errorf("GEMINI_ACCESS=ANONYMOUS: status = %d, want %d", w.status, gemini.StatusSuccess)
+	}
+}
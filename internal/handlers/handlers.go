@@ -3,6 +3,9 @@ package handlers
 
 import (
 	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
 	"html/template"
 	"io/fs"
 	"log/slog"
@@ -12,12 +15,19 @@ import (
 	"time"
 
 	"github.com/sa/gopherwiki/internal/auth"
+	"github.com/sa/gopherwiki/internal/cluster"
 	"github.com/sa/gopherwiki/internal/config"
 	"github.com/sa/gopherwiki/internal/db"
+	"github.com/sa/gopherwiki/internal/linkcheck"
+	"github.com/sa/gopherwiki/internal/mail"
 	"github.com/sa/gopherwiki/internal/middleware"
+	"github.com/sa/gopherwiki/internal/pandoc"
+	"github.com/sa/gopherwiki/internal/plugin"
 	"github.com/sa/gopherwiki/internal/quarto"
 	"github.com/sa/gopherwiki/internal/rendercache"
 	"github.com/sa/gopherwiki/internal/renderer"
+	"github.com/sa/gopherwiki/internal/settings"
+	"github.com/sa/gopherwiki/internal/spam"
 	"github.com/sa/gopherwiki/internal/storage"
 	"github.com/sa/gopherwiki/internal/wiki"
 )
@@ -46,6 +56,34 @@ type RenderService interface {
 	ExportFormats() []quarto.ExportFormat
 }
 
+// DocumentConverter produces document exports of pages with an external
+// converter. *pandoc.Converter is the production implementation; it is
+// optional and nil unless Pandoc export is enabled and pandoc was found.
+type DocumentConverter interface {
+	// Formats lists the formats the converter produces.
+	Formats() []pandoc.Format
+	// Convert renders a page to the named format, returning the bytes and the
+	// resolved format descriptor.
+	Convert(ctx context.Context, in pandoc.Input, format string) ([]byte, pandoc.Format, error)
+}
+
+// RepositoryMaintainer compacts the repository's object store.
+// *storage.GitStorage is the production implementation; it is nil when the
+// wiki is kept in memory.
+type RepositoryMaintainer interface {
+	// Maintain repacks the repository and prunes its loose objects.
+	Maintain(ctx context.Context) (storage.MaintenanceResult, error)
+	// Stats measures the repository's object store.
+	Stats() (storage.RepositoryStats, error)
+}
+
+// Mailer sends email. *mail.Mailer is the production implementation; it is
+// nil unless MAIL_SERVER names a mail server.
+type Mailer interface {
+	// Send delivers a plain-text message to the address to.
+	Send(ctx context.Context, to, subject, body string) error
+}
+
 // siteSettingsCacheTTL is how long cached site settings remain valid.
 const siteSettingsCacheTTL = 60 * time.Second
 
@@ -55,6 +93,10 @@ type Server struct {
 	Storage           storage.Storage
 	Wiki              *wiki.WikiService
 	DB                *db.Database
+	// Users holds the user accounts, sessions, password resets and profile
+	// fields. It is DB unless USERS_DATABASE_URI names another database,
+	// which lets several wikis share their users.
+	Users             *db.Database
 	Renderer          *renderer.Renderer
 	Templates         *template.Template
 	TemplateMap       map[string]*template.Template
@@ -63,36 +105,116 @@ type Server struct {
 	Auth              *auth.Auth
 	SessionManager    *middleware.SessionManager
 	PermissionChecker *middleware.PermissionChecker
+	// Settings serves the runtime-editable settings (access levels,
+	// registration, home page, site URL, edit conflict mode). Read these
+	// through it rather than from Config, which holds only their defaults.
+	Settings *settings.Service
 	// RenderService is the optional computational-page renderer. Nil disables
 	// the render endpoint and makes computational pages show the render-pending
 	// placeholder.
 	RenderService RenderService
+	// Converter is the optional Pandoc document converter. Nil leaves export
+	// to Quarto (when present) and the built-in formats.
+	Converter DocumentConverter
+	// Maintainer runs the repository maintenance; nil disables it.
+	Maintainer RepositoryMaintainer
+	// Mailer sends notification emails; nil sends none.
+	Mailer Mailer
+	// LinkChecker returns the checker of external links for a run of
+	// CheckExternalLinks; nil makes one that refuses private addresses.
+	LinkChecker func() *linkcheck.Checker
+	// Cluster is the node through which this server coordinates with the
+	// other processes serving the wiki; nil if there are none. Set it with
+	// JoinCluster.
+	Cluster      *cluster.Node
+	clusterStops []func()
+	// Plugins extend the server; register them before LoadTemplates and
+	// Routes.
+	Plugins *plugin.Registry
+
+	// spamBlocklist flags anonymous contributions for moderation, from
+	// Config.SpamBlocklistFile.
+	spamBlocklist *spam.Blocklist
+
+	// staticManifest holds content-hashed static asset names, built from
+	// StaticFS by LoadTemplates.
+	staticManifest *staticManifest
+
+	// themes holds the default theme, loaded by LoadTemplates from
+	// templatesFS and StaticFS, and the theme packs loaded by LoadThemes.
+	themes      map[string]*theme
+	templatesFS fs.FS
 
 	// Site settings cache
 	ssMu       sync.RWMutex
 	ssCache    *SiteSettings
 	ssCachedAt time.Time
+
+	// Rendered _sidebar and _footer pages by filename
+	spMu    sync.RWMutex
+	spCache map[string]*specialPage
+
+	// Avatar thumbnails by user ID
+	avMu    sync.Mutex
+	avCache map[int64]*avatarThumbs
+
+	// Blame of a file by filename and commit
+	blMu    sync.Mutex
+	blCache map[blameKey][]storage.BlameLine
 }
 
 // NewServer creates a new Server with the given dependencies.
 func NewServer(cfg *config.Config, store storage.Storage, database *db.Database, version string) (*Server, error) {
+	return NewServerWithUsers(cfg, store, database, database, version)
+}
+
+// NewServerWithUsers creates a new Server whose user accounts and sessions
+// live in users rather than in database.
+func NewServerWithUsers(cfg *config.Config, store storage.Storage, database, users *db.Database, version string) (*Server, error) {
 	rend := renderer.New(cfg)
-	authService := auth.New(cfg, database.Queries)
-	sessionManager := middleware.NewSessionManager(cfg.SecretKey, cfg.SecureCookie, database.Queries)
-	permChecker := middleware.NewPermissionChecker(cfg, sessionManager)
+	runtimeSettings := settings.New(cfg, database.Queries)
+	authService := auth.New(cfg, users.Queries, runtimeSettings)
+	sessionManager := middleware.NewSessionManager(cfg.SecretKey, middleware.CookieOptions{
+		Secure:     cfg.SecureCookie,
+		SameSite:   middleware.ParseSameSite(cfg.CookieSameSite),
+		Domain:     cfg.CookieDomain,
+		Path:       cfg.CookiePath,
+		HostPrefix: cfg.CookieHostPrefix,
+	}, users)
+	permChecker := middleware.NewPermissionChecker(runtimeSettings, sessionManager)
+	permChecker.SetPublicPages(database.ListPublicPages)
 
 	wikiService := wiki.NewWikiService(store, cfg, database)
+	rend.SetResolver(wikiService)
+	plugins := &plugin.Registry{}
+	rend.SetFilter(plugins)
 
 	s := &Server{
 		Config:            cfg,
 		Storage:           store,
 		Wiki:              wikiService,
 		DB:                database,
+		Users:             users,
 		Renderer:          rend,
 		Version:           version,
 		Auth:              authService,
 		SessionManager:    sessionManager,
 		PermissionChecker: permChecker,
+		Settings:          runtimeSettings,
+		Plugins:           plugins,
+	}
+	sessionManager.SetExternalAuth(s.pluginUser)
+	wikiService.SetSaveHooks(checkingHooks{plugins, s})
+
+	if cfg.SpamBlocklistFile != "" {
+		blocklist, err := spam.LoadBlocklist(cfg.SpamBlocklistFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load spam blocklist: %w", err)
+		}
+		s.spamBlocklist = blocklist
+	}
+	if cfg.MailServer != "" {
+		s.Mailer = mail.New(cfg)
 	}
 
 	return s, nil
@@ -100,8 +222,10 @@ func NewServer(cfg *config.Config, store storage.Storage, database *db.Database,
 
 // SiteSettings holds customizable site settings that can be changed at runtime.
 type SiteSettings struct {
-	Name string
-	Logo string
+	Name          string
+	Logo          string
+	Navigation    []navItem      // Sidebar menu, before filtering by permission
+	Announcements []announcement // Banners shown now or later, rendered
 }
 
 // getSiteSettings returns site settings from preferences or config.
@@ -116,8 +240,9 @@ func (s *Server) getSiteSettings(ctx context.Context) SiteSettings {
 	s.ssMu.RUnlock()
 
 	settings := SiteSettings{
-		Name: s.Config.SiteName,
-		Logo: s.Config.SiteLogo,
+		Name:       s.Config.SiteName,
+		Logo:       s.Config.SiteLogo,
+		Navigation: defaultNavigation,
 	}
 
 	// Try to get site name from preferences
@@ -130,6 +255,22 @@ func (s *Server) getSiteSettings(ctx context.Context) SiteSettings {
 		settings.Logo = pref.Value.String
 	}
 
+	// Try to get the sidebar menu from preferences
+	if pref, err := s.DB.Queries.GetPreference(ctx, navigationPreferenceKey); err == nil && pref.Value.Valid && pref.Value.String != "" {
+		if items, err := parseNavigation(pref.Value.String); err != nil {
+			slog.Warn("ignoring invalid saved menu", "error", err)
+		} else {
+			settings.Navigation = items
+		}
+	}
+
+	// Load the announcements not over yet
+	if list, err := s.DB.ListAnnouncements(ctx); err != nil {
+		slog.Warn("failed to list announcements", "error", err)
+	} else {
+		settings.Announcements = s.renderAnnouncements(list)
+	}
+
 	s.ssMu.Lock()
 	s.ssCache = &settings
 	s.ssCachedAt = time.Now()
@@ -138,6 +279,11 @@ func (s *Server) getSiteSettings(ctx context.Context) SiteSettings {
 	return settings
 }
 
+// siteURL returns the public base URL of the wiki.
+func (s *Server) siteURL(r *http.Request) string {
+	return s.Settings.Get(r.Context()).SiteURL
+}
+
 // InvalidateSiteSettingsCache clears the cached site settings.
 func (s *Server) InvalidateSiteSettingsCache() {
 	s.ssMu.Lock()
@@ -157,7 +303,8 @@ func (s *Server) renderTemplate(w http.ResponseWriter, r *http.Request, name str
 	data["csrf_token"] = middleware.GetCSRFToken(r)
 
 	// Add site settings (from preferences or config)
-	data["site"] = s.getSiteSettings(r.Context())
+	site := s.getSiteSettings(r.Context())
+	data["site"] = site
 
 	// Add auth context from session
 	user := middleware.GetUser(r)
@@ -169,10 +316,18 @@ func (s *Server) renderTemplate(w http.ResponseWriter, r *http.Request, name str
 		"name":             user.GetName(),
 		"email":            user.GetEmail(),
 	}
+	var unread int64
+	if user.IsAuthenticated() {
+		unread = s.unreadNotifications(r)
+		data["unread_notifications"] = unread
+	}
+	data["navigation"] = s.visibleNavigation(r, site.Navigation, unread)
+	current := s.Settings.Get(r.Context())
 	data["auth_supported_features"] = map[string]bool{
 		"logout":   true,
-		"register": !s.Config.DisableRegistration,
+		"register": !current.DisableRegistration,
 	}
+	data["feeds_enabled"] = !current.DisableFeeds
 
 	// Add permission context for templates
 	data["permissions"] = map[string]bool{
@@ -182,28 +337,56 @@ func (s *Server) renderTemplate(w http.ResponseWriter, r *http.Request, name str
 		"admin":  s.PermissionChecker.HasPermission(r, middleware.PermissionAdmin),
 	}
 
-	// Add sidebar page tree when configured
-	if s.Config.SidebarMenutreeMode != "" {
+	// Add sidebar page tree when configured, for those who may read the
+	// pages in it
+	block := partialBlock(r)
+	if block == "" && s.Config.SidebarMenutreeMode != "" && s.PermissionChecker.HasPermission(r, middleware.PermissionRead) {
 		if tree, err := s.Wiki.PageTree(r.Context()); err == nil && len(tree) > 0 {
 			data["sidebar_tree"] = tree
+			data["sidebar_current"], _ = data["pagepath"].(string)
 		}
 	}
 
+	// Add the pages the user viewed last, but the one they are on
+	if block == "" && s.Config.SidebarRecentPages > 0 && user.IsAuthenticated() && s.PermissionChecker.HasPermission(r, middleware.PermissionRead) {
+		pagepath, _ := data["pagepath"].(string)
+		if recent, err := s.recentPages(r, s.Config.SidebarRecentPages, pagepath); err != nil {
+			slog.Warn("failed to list recent pages", "error", err)
+		} else {
+			data["recent_pages"] = recent
+		}
+	}
+
+	// Add the site-wide announcements the user has not dismissed
+	if block == "" {
+		data["announcements"] = s.activeAnnouncements(r)
+		data["request_uri"] = r.URL.RequestURI()
+	}
+
 	// Add flash messages
 	if flashes := middleware.GetFlashes(r); len(flashes) > 0 {
 		data["flashes"] = flashes
 	}
 
-	// Get the template for this page
-	tmpl, ok := s.TemplateMap[name]
+	// Get the template for this page from the active theme
+	active := s.theme(r)
+	data["theme"] = active.name
+	prefs := s.userPreferences(r)
+	data["color_scheme"] = prefs.ColorScheme
+	data["preferences"] = prefs
+	tmpl, ok := active.templates[name]
 	if !ok {
 		slog.Error("template not found", "name", name)
 		http.Error(w, "Template not found: "+name, http.StatusInternalServerError)
 		return
 	}
 
-	// Execute the base template
-	if err := tmpl.ExecuteTemplate(w, "base", data); err != nil {
+	// Execute the base template, or the block of a partial route. Templates
+	// without the block, as error pages, render whole.
+	if block == "" || tmpl.Lookup(block) == nil {
+		block = "base"
+	}
+	if err := tmpl.ExecuteTemplate(w, block, data); err != nil {
 		slog.Error("template execution error", "error", err)
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 	}
@@ -216,22 +399,69 @@ func (s *Server) renderPage(w http.ResponseWriter, r *http.Request, page *wiki.P
 	// without a new commit (a re-render, or a render-pipeline change), so fold the
 	// render state into the ETag; otherwise a browser 304s and reuses stale page
 	// chrome after a re-render.
+	// The sidebar and footer are part of the view too, unless it is opened
+	// by a share link, which shows nothing of the wiki but the page.
+	shared := !s.PermissionChecker.HasPermission(r, middleware.PermissionRead)
+	var decorations pageDecorations
+	if !shared {
+		decorations = s.pageDecorations(r.Context(), page)
+	}
+	// So are the review status banner and the public page notice.
+	status := s.pageStatus(r.Context(), page.Pagepath)
+	public := !shared && s.readRestricted(r) && s.pagePublic(r.Context(), page.Pagepath)
+	// And the star of a page the user pinned.
+	canBookmark := !shared && page.Revision == "" && middleware.GetUser(r).IsAuthenticated()
+	bookmarked := canBookmark && s.isBookmarked(r, page.Pagepath)
+	// The service worker keeps views of the current revision for offline
+	// reading, but not those of share links.
+	if !shared && page.Revision == "" && partialBlock(r) == "" {
+		w.Header().Set("X-Offline-Page", "1")
+	}
+	// As are the pages rendered in place by embeds, which are known once the
+	// page is rendered.
+	htmlContent, toc, libRequirements, embedded := s.renderPageContent(r, page)
 	if page.Metadata != nil && page.Metadata.RevisionFull != "" {
-		etag := `"` + page.Metadata.RevisionFull + s.renderETagSuffix(r.Context(), page) + `"`
-		w.Header().Set("ETag", etag)
+		embedsSuffix, modified := s.embedsValidators(r.Context(), embedded, page.Metadata.Datetime)
+		etag := `"` + page.Metadata.RevisionFull + s.renderETagSuffix(r.Context(), page) + embedsSuffix + decorations.etagSuffix() + pageStatusETagSuffix(status) + pageVisibilityETagSuffix(public) + bookmarkETagSuffix(bookmarked) + s.recentPagesETagSuffix(r, page.Pagepath) + announcementsETagSuffix(s.activeAnnouncements(r)) + `"`
 		w.Header().Set("Cache-Control", "no-cache")
-		if match := r.Header.Get("If-None-Match"); match == etag {
-			w.WriteHeader(http.StatusNotModified)
+		if notModified(w, r, etag, modified) {
 			return
 		}
 	}
 
-	htmlContent, toc, libRequirements := s.renderPageContent(r.Context(), page)
 	data := NewPageData(page, template.HTML(htmlContent), toc, libRequirements)
 	data["export_formats"] = s.exportFormatLinks()
+	data["decorations"] = decorations
+	if status != db.PageStatusApproved {
+		data["page_status"] = status
+	}
+	data["page_public"] = public
+	data["can_bookmark"] = canBookmark
+	data["bookmarked"] = bookmarked
+	if !shared {
+		data["page_checks"] = s.pageChecks(r.Context(), page)
+	}
+	data["noindex"] = page.Frontmatter != nil && bool(page.Frontmatter.NoIndex)
+	if page.Revision != "" && page.Metadata != nil {
+		data["revision_commit"] = page.Metadata
+		data["permalink"] = permalinkURL(page.Metadata.RevisionFull, page.Pagepath)
+	}
+	// Share links are offered to logged-in users of a wiki that needs an
+	// account to read; making one checks they created the page.
+	if !shared && page.Revision == "" && s.readRestricted(r) && middleware.GetUser(r).IsAuthenticated() {
+		data["can_share"] = true
+	}
+	// Task checkboxes can be toggled when viewing the current revision of a
+	// plain page the user may edit.
+	if page.Revision == "" && !page.IsComputational && page.Metadata != nil &&
+		s.PermissionChecker.HasPermission(r, middleware.PermissionWrite) {
+		data["task_revision"] = page.Metadata.Revision
+	}
 
 	// Fetch backlinks
-	if backlinks, err := s.Wiki.Backlinks(r.Context(), page.Pagepath); err == nil && len(backlinks) > 0 {
+	if shared {
+		// Other pages are not shared.
+	} else if backlinks, err := s.Wiki.Backlinks(r.Context(), page.Pagepath); err == nil && len(backlinks) > 0 {
 		data["backlinks"] = backlinks
 	}
 
@@ -254,24 +484,57 @@ func (s *Server) renderETagSuffix(ctx context.Context, page *wiki.Page) string {
 	return "-pending"
 }
 
+// embedsValidators folds the revisions of the pages embedded in a view into
+// its ETag suffix, and their commit times into its modification time
+// (modified, the page's own, or later), as editing one of them changes the
+// view.
+func (s *Server) embedsValidators(ctx context.Context, embedded []string, modified time.Time) (string, time.Time) {
+	if len(embedded) == 0 {
+		return "", modified
+	}
+	h := sha256.New()
+	for _, pagepath := range embedded {
+		revision := ""
+		if file, ok := s.Wiki.PageFile(pagepath); ok {
+			if meta, err := s.Storage.Metadata(ctx, file, ""); err == nil {
+				revision = meta.RevisionFull
+				if meta.Datetime.After(modified) {
+					modified = meta.Datetime
+				}
+			}
+		}
+		fmt.Fprintf(h, "%s %s\n", pagepath, revision)
+	}
+	return fmt.Sprintf("-e%x", h.Sum(nil)[:6]), modified
+}
+
 // renderPageContent produces the main HTML content for a page view. Plain pages
 // render in-process via goldmark. A computational page whose output is cached is
 // embedded via an iframe pointing at the rendered-output endpoint; if it is not
 // yet rendered (cache miss, or rendering unavailable) it falls back to the
-// render-pending placeholder. On-view execution never happens here.
-func (s *Server) renderPageContent(ctx context.Context, page *wiki.Page) (string, []renderer.TOCEntry, renderer.LibraryRequirements) {
+// render-pending placeholder. On-view execution never happens here. Embedded
+// pages the viewer may not read render as links; the paths of those rendered
+// in place are returned with the content.
+func (s *Server) renderPageContent(r *http.Request, page *wiki.Page) (string, []renderer.TOCEntry, renderer.LibraryRequirements, []string) {
 	if page.IsComputational && s.RenderService != nil && s.RenderService.Available() {
-		if _, ok, err := s.RenderService.Cached(ctx, page.Content, pageEngine(page)); err == nil && ok {
-			return computationalIframe(page.PageViewURL), nil, renderer.LibraryRequirements{}
+		if _, ok, err := s.RenderService.Cached(r.Context(), page.Content, pageEngine(page)); err == nil && ok {
+			return computationalIframe(page.PageViewURL), nil, renderer.LibraryRequirements{}, nil
 		}
 	}
-	return page.Render(s.Renderer)
+	return page.RenderEmbeds(s.Renderer, s.PermissionChecker.PageFilter(r))
 }
 
-// renderNotFound renders a 404 page for a missing wiki page.
+// renderNotFound renders a 404 page for a missing wiki page: the nearest
+// _404 page if there is one, and links to the pages nearest its name.
 func (s *Server) renderNotFound(w http.ResponseWriter, r *http.Request, page *wiki.Page) {
+	suggestions, err := s.Wiki.Suggest(r.Context(), page.Pagepath)
+	if err != nil {
+		slog.Warn("failed to suggest pages", "pagepath", page.Pagepath, "error", err)
+	}
 	w.WriteHeader(http.StatusNotFound)
 	data := NewNotFoundData(page)
+	data["suggestions"] = suggestions
+	data["custom_404"] = s.findSpecialPage(r.Context(), notFoundPageName, page.Filename)
 	s.renderTemplate(w, r, "page404.html", data)
 }
 
@@ -288,10 +551,24 @@ func (s *Server) renderError(w http.ResponseWriter, r *http.Request, code int, m
 	s.renderTemplate(w, r, "error.html", data)
 }
 
-// getAuthor extracts a storage.Author from the request's authenticated user,
-// falling back to "Anonymous" for unauthenticated users.
+// renderFailure renders the error page for an operation that failed with
+// err: a Gateway Timeout when storage gave up on it, otherwise an Internal
+// Server Error.
+func (s *Server) renderFailure(w http.ResponseWriter, r *http.Request, err error) {
+	code := http.StatusInternalServerError
+	if errors.Is(err, context.DeadlineExceeded) {
+		code = http.StatusGatewayTimeout
+	}
+	s.renderError(w, r, code, err.Error())
+}
+
+// getAuthor extracts a storage.Author from the request's authenticated user.
+// Anonymous visitors are attributed as ANONYMOUS_ATTRIBUTION says.
 func (s *Server) getAuthor(r *http.Request) storage.Author {
 	user := middleware.GetUser(r)
+	if user.IsAnonymous() {
+		return s.anonymousAuthor(r)
+	}
 	author := storage.Author{
 		Name:  user.GetName(),
 		Email: user.GetEmail(),
@@ -2,12 +2,18 @@ package handlers_test
 
 import (
 	"context"
+	"crypto/sha512"
 	"database/sql"
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
+	"html"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"path/filepath"
+	"regexp"
+	"strconv"
 	"strings"
 	"testing"
 	"time"
@@ -15,6 +21,7 @@ import (
 	"bytes"
 	"mime/multipart"
 
+	"github.com/sa/gopherwiki/internal/backup"
 	"github.com/sa/gopherwiki/internal/db"
 	"github.com/sa/gopherwiki/internal/middleware"
 	"github.com/sa/gopherwiki/internal/models"
@@ -24,6 +31,94 @@ import (
 
 // --- JSON endpoint tests ---
 
+func TestMetrics(t *testing.T) {
+	env := testutil.SetupTestEnv(t)
+
+	w := httptest.NewRecorder()
+	env.Router.ServeHTTP(w, httptest.NewRequest("GET", "/-/metrics", nil))
+	if w.Code == http.StatusOK && strings.Contains(w.Body.String(), "gopherwiki_build_info") {
+		t.Error("metrics should not be served unless METRICS_ENABLED is set")
+	}
+
+	env.Server.Config.MetricsEnabled = true
+	env.Server.Config.MetricsToken = "scrape-token"
+	env.Server.Storage = storage.NewTimedStorage(env.Store, 0)
+	router := env.Server.Routes()
+	env.Server.Storage.Store(context.Background(), "metrics.md", "# Metrics", "add", storage.Author{Name: "test", Email: "test@test.com"})
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/-/metrics", nil))
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("without token: status = %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+
+	req := httptest.NewRequest("GET", "/-/metrics", nil)
+	req.Header.Set("Authorization", "Bearer scrape-token")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusOK)
+	}
+	body := w.Body.String()
+	for _, want := range []string{
+		`gopherwiki_build_info{version="test"} 1`,
+		"# TYPE gopherwiki_git_operation_duration_seconds summary",
+		`gopherwiki_git_operation_duration_seconds_count{op="store"} 1`,
+		`gopherwiki_git_slow_operations_total{op="store"} 0`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("metrics missing %q", want)
+		}
+	}
+}
+
+func TestHealthCheck_Deep(t *testing.T) {
+	env := testutil.SetupTestEnv(t)
+
+	req := httptest.NewRequest("GET", "/-/health?deep=1", nil)
+	w := httptest.NewRecorder()
+	env.Router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d; body %s", w.Code, http.StatusOK, w.Body.String())
+	}
+	var resp struct {
+		Status string
+		Checks map[string]struct{ Status, Error string }
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to parse JSON: %v", err)
+	}
+	if resp.Status != "ok" {
+		t.Errorf("status = %q, want ok", resp.Status)
+	}
+	for _, name := range []string{"git", "database", "search_index", "disk"} {
+		if resp.Checks[name].Status != "ok" {
+			t.Errorf("check %s = %+v, want ok", name, resp.Checks[name])
+		}
+	}
+
+	// An impossible free-space floor degrades the instance.
+	env.Server.Config.HealthMinFreeMB = 1 << 40
+	w = httptest.NewRecorder()
+	env.Router.ServeHTTP(w, httptest.NewRequest("GET", "/-/health?deep=1", nil))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("degraded status = %d, want %d", w.Code, http.StatusServiceUnavailable)
+	}
+	if !strings.Contains(w.Body.String(), `"degraded"`) {
+		t.Errorf("body should report degraded, got %s", w.Body.String())
+	}
+
+	// A closed database fails its checks.
+	env.Server.Config.HealthMinFreeMB = 0
+	env.DB.Close()
+	w = httptest.NewRecorder()
+	env.Router.ServeHTTP(w, httptest.NewRequest("GET", "/-/health?deep=1", nil))
+	if w.Code != http.StatusServiceUnavailable || !strings.Contains(w.Body.String(), `"database":{"status":"error"`) {
+		t.Errorf("closed database: status = %d, body %s", w.Code, w.Body.String())
+	}
+}
+
 func TestHealthCheck(t *testing.T) {
 	env := testutil.SetupTestEnv(t)
 
@@ -56,7 +151,7 @@ func TestPreview(t *testing.T) {
 	env := testutil.SetupTestEnv(t)
 
 	// Create a page first so the path is valid
-	env.Store.Store("testpage.md", "# Existing", "init", storage.Author{Name: "test", Email: "test@test.com"})
+	env.Store.Store(context.Background(), "testpage.md", "# Existing", "init", storage.Author{Name: "test", Email: "test@test.com"})
 
 	form := url.Values{"content": {"# Hello World\n\nThis is **bold**."}}
 	req := httptest.NewRequest("POST", "/testpage/preview", strings.NewReader(form.Encode()))
@@ -86,7 +181,7 @@ func TestDraftCRUD(t *testing.T) {
 	env := testutil.SetupTestEnv(t)
 
 	// Create page in storage
-	env.Store.Store("draftpage.md", "# Draft Test", "init", storage.Author{Name: "test", Email: "test@test.com"})
+	env.Store.Store(context.Background(), "draftpage.md", "# Draft Test", "init", storage.Author{Name: "test", Email: "test@test.com"})
 
 	// Save draft
 	form := url.Values{
@@ -295,7 +390,7 @@ func TestViewPage_Exists(t *testing.T) {
 	env := testutil.SetupTestEnv(t)
 
 	// Create a page in storage
-	_, err := env.Store.Store("testpage.md", "# Test Page\n\nContent here.", "created testpage", storage.Author{Name: "test", Email: "test@test.com"})
+	_, err := env.Store.Store(context.Background(), "testpage.md", "# Test Page\n\nContent here.", "created testpage", storage.Author{Name: "test", Email: "test@test.com"})
 	if err != nil {
 		t.Fatalf("failed to store page: %v", err)
 	}
@@ -324,7 +419,7 @@ func TestViewPage_NotFound(t *testing.T) {
 func TestEditPage(t *testing.T) {
 	env := testutil.SetupTestEnv(t)
 
-	env.Store.Store("editme.md", "# Edit Me", "init", storage.Author{Name: "test", Email: "test@test.com"})
+	env.Store.Store(context.Background(), "editme.md", "# Edit Me", "init", storage.Author{Name: "test", Email: "test@test.com"})
 
 	req := httptest.NewRequest("GET", "/editme/edit", nil)
 	w := httptest.NewRecorder()
@@ -352,15 +447,111 @@ func TestSavePage(t *testing.T) {
 	}
 
 	// Verify page was created
-	if !env.Store.Exists("newpage.md") {
+	if !env.Store.Exists(context.Background(), "newpage.md") {
 		t.Error("page should exist after save")
 	}
 }
 
+func TestRateLimit(t *testing.T) {
+	env := testutil.SetupTestEnv(t)
+	env.Server.Config.RateLimitWrites = 2
+	env.Server.Config.RateLimitSearch = 1
+	router := env.Server.Routes()
+
+	save := func(page string, cookies []*http.Cookie) *httptest.ResponseRecorder {
+		form := url.Values{"content": {"# Limited"}, "commit": {"edit"}}
+		req := requestWithCookies("POST", "/"+page+"/save", strings.NewReader(form.Encode()), cookies)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+	for i := 0; i < 2; i++ {
+		if w := save(fmt.Sprintf("limited-%d", i), nil); w.Code != http.StatusFound {
+			t.Fatalf("save %d: status = %d, want %d", i, w.Code, http.StatusFound)
+		}
+	}
+	w := save("limited-2", nil)
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("third save: status = %d, want %d", w.Code, http.StatusTooManyRequests)
+	}
+	if retry, err := strconv.Atoi(w.Header().Get("Retry-After")); err != nil || retry < 1 || retry > 30 {
+		t.Errorf("Retry-After = %q, want up to 30 seconds", w.Header().Get("Retry-After"))
+	}
+
+	// Reading is not limited, and a logged-in user has an allowance of their own.
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/limited-0", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("view after the limit: status = %d, want %d", w.Code, http.StatusOK)
+	}
+	if w := save("limited-2", loginAsUser(t, env, "limited@example.com")); w.Code != http.StatusFound {
+		t.Errorf("logged-in save: status = %d, want %d", w.Code, http.StatusFound)
+	}
+
+	for i, want := range []int{http.StatusOK, http.StatusTooManyRequests} {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", "/-/api/v1/search?q=limited", nil))
+		if w.Code != want {
+			t.Errorf("API search %d: status = %d, want %d", i, w.Code, want)
+		}
+		if want == http.StatusTooManyRequests && !strings.Contains(w.Body.String(), `"error"`) {
+			t.Errorf("API rate limit response should be JSON, got %s", w.Body.String())
+		}
+		reset, err := strconv.ParseInt(w.Header().Get("X-RateLimit-Reset"), 10, 64)
+		if w.Header().Get("X-RateLimit-Limit") != "1" || w.Header().Get("X-RateLimit-Remaining") != "0" ||
+			err != nil || reset < time.Now().Unix() || reset > time.Now().Add(61*time.Second).Unix() {
+			t.Errorf("API search %d: X-RateLimit headers = %q, %q, %q", i,
+				w.Header().Get("X-RateLimit-Limit"), w.Header().Get("X-RateLimit-Remaining"), w.Header().Get("X-RateLimit-Reset"))
+		}
+	}
+}
+
+func TestCreatePage_Template(t *testing.T) {
+	env := testutil.SetupTestEnv(t)
+	env.Store.Store(context.Background(), "templates/meeting.md", "# {{title}}\n\nNotes by {{author}}\n", "init", storage.Author{Name: "test", Email: "test@test.com"})
+
+	// The create form offers the templates.
+	req := httptest.NewRequest("GET", "/-/create", nil)
+	w := httptest.NewRecorder()
+	env.Router.ServeHTTP(w, req)
+	if !strings.Contains(w.Body.String(), `<option value="templates/meeting">`) {
+		t.Error("create form should offer the meeting template")
+	}
+
+	// Creating from a template opens the editor on the substituted template.
+	form := url.Values{"pagepath": {"Standup"}, "template": {"templates/meeting"}}
+	req = httptest.NewRequest("POST", "/-/create", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w = httptest.NewRecorder()
+	env.Router.ServeHTTP(w, req)
+	location := w.Header().Get("Location")
+	if w.Code != http.StatusFound || location != "/Standup/edit?template=templates%2Fmeeting" {
+		t.Fatalf("create: status = %d, Location = %q", w.Code, location)
+	}
+
+	req = httptest.NewRequest("GET", location, nil)
+	w = httptest.NewRecorder()
+	env.Router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("edit: status = %d, want %d", w.Code, http.StatusOK)
+	}
+	if !strings.Contains(w.Body.String(), "# Standup\n\nNotes by Anonymous") {
+		t.Error("editor should contain the substituted template")
+	}
+
+	req = httptest.NewRequest("GET", "/Standup/edit?template=templates/missing", nil)
+	w = httptest.NewRecorder()
+	env.Router.ServeHTTP(w, req)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("missing template: status = %d, want %d", w.Code, http.StatusNotFound)
+	}
+}
+
 func TestDeletePage(t *testing.T) {
 	env := testutil.SetupTestEnv(t)
 
-	env.Store.Store("deleteme.md", "# Delete Me", "init", storage.Author{Name: "test", Email: "test@test.com"})
+	env.Store.Store(context.Background(), "deleteme.md", "# Delete Me", "init", storage.Author{Name: "test", Email: "test@test.com"})
 
 	form := url.Values{"message": {"Deleted page"}}
 	req := httptest.NewRequest("POST", "/deleteme/delete", strings.NewReader(form.Encode()))
@@ -372,15 +563,63 @@ func TestDeletePage(t *testing.T) {
 		t.Errorf("status = %d, want %d (redirect after delete)", w.Code, http.StatusFound)
 	}
 
-	if env.Store.Exists("deleteme.md") {
+	if env.Store.Exists(context.Background(), "deleteme.md") {
 		t.Error("page should not exist after delete")
 	}
 }
 
+func TestRestorePage(t *testing.T) {
+	env := testutil.SetupTestEnv(t)
+
+	author := storage.Author{Name: "test", Email: "test@test.com"}
+	env.Store.Store(context.Background(), "restoreme.md", "# First version", "first", author)
+	env.Store.Store(context.Background(), "restoreme.md", "# Second version", "second", author)
+	logEntries, _ := env.Store.Log(context.Background(), "restoreme.md", 0)
+	old := logEntries[1].Revision
+
+	// Old revisions offer to be restored.
+	body := viewPage(t, env, "/restoreme?revision="+old, "").Body.String()
+	if !strings.Contains(body, "/restoreme/restore?revision="+old) {
+		t.Error("old revision view should link to restoring it")
+	}
+
+	req := httptest.NewRequest("GET", "/restoreme/restore?revision="+old, nil)
+	w := httptest.NewRecorder()
+	env.Router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `name="revision" value="`+old+`"`) {
+		t.Fatalf("restore form: status = %d", w.Code)
+	}
+
+	form := url.Values{"revision": {old}}
+	req = httptest.NewRequest("POST", "/restoreme/restore", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w = httptest.NewRecorder()
+	env.Router.ServeHTTP(w, req)
+	if w.Code != http.StatusFound || w.Header().Get("Location") != "/restoreme" {
+		t.Fatalf("restore: status = %d, location %q", w.Code, w.Header().Get("Location"))
+	}
+	if content, _ := env.Store.Load(context.Background(), "restoreme.md", ""); content != "# First version" {
+		t.Errorf("content after restore = %q", content)
+	}
+	logEntries, _ = env.Store.Log(context.Background(), "restoreme.md", 0)
+	if len(logEntries) != 3 || !strings.HasSuffix(logEntries[0].Message, " to revision "+old) {
+		t.Errorf("history after restore = %d entries, last %q", len(logEntries), logEntries[0].Message)
+	}
+
+	form = url.Values{"revision": {"nosuchrev"}}
+	req = httptest.NewRequest("POST", "/restoreme/restore", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w = httptest.NewRecorder()
+	env.Router.ServeHTTP(w, req)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("restoring an unknown revision: status = %d, want 404", w.Code)
+	}
+}
+
 func TestHistoryPage(t *testing.T) {
 	env := testutil.SetupTestEnv(t)
 
-	env.Store.Store("histpage.md", "# History", "init", storage.Author{Name: "test", Email: "test@test.com"})
+	env.Store.Store(context.Background(), "histpage.md", "# History", "init", storage.Author{Name: "test", Email: "test@test.com"})
 
 	req := httptest.NewRequest("GET", "/histpage/history", nil)
 	w := httptest.NewRecorder()
@@ -391,10 +630,93 @@ func TestHistoryPage(t *testing.T) {
 	}
 }
 
+func TestHistoryPage_Paginated(t *testing.T) {
+	env := testutil.SetupTestEnv(t)
+
+	alice := storage.Author{Name: "Alice", Email: "alice@test.com"}
+	bob := storage.Author{Name: "Bob", Email: "bob@test.com"}
+	for i := 1; i <= 55; i++ {
+		author := alice
+		if i%5 == 0 {
+			author = bob
+		}
+		env.Store.Store(context.Background(), "busy.md", fmt.Sprintf("# Busy\n\nEdit %d\n", i), fmt.Sprintf("edit %d", i), author)
+	}
+	// A page whose name extends the first one's is not part of its history.
+	env.Store.Store(context.Background(), "busy.mdx", "other", "other file", alice)
+
+	get := func(query string) string {
+		t.Helper()
+		w := httptest.NewRecorder()
+		env.Router.ServeHTTP(w, httptest.NewRequest("GET", "/busy/history"+query, nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("GET /busy/history%s = %d", query, w.Code)
+		}
+		return w.Body.String()
+	}
+
+	body := get("")
+	if strings.Count(body, "<td>edit ") != 50 || !strings.Contains(body, "<td>edit 55</td>") {
+		t.Errorf("first page shows %d commits, want the newest 50", strings.Count(body, "<td>edit "))
+	}
+	if !strings.Contains(body, "page=2") || strings.Contains(body, "other file") {
+		t.Error("first page should link to the next and hold only the page's commits")
+	}
+
+	body = get("?page=2")
+	if strings.Count(body, "<td>edit ") != 5 || !strings.Contains(body, "<td>edit 1</td>") {
+		t.Errorf("second page shows %d commits, want the oldest 5", strings.Count(body, "<td>edit "))
+	}
+
+	body = get("?author=bob")
+	if strings.Count(body, "<td>edit ") != 11 || strings.Contains(body, "page=2") {
+		t.Errorf("author filter shows %d commits, want Bob's 11", strings.Count(body, "<td>edit "))
+	}
+
+	w := httptest.NewRecorder()
+	env.Router.ServeHTTP(w, httptest.NewRequest("GET", "/busy/history?since=yesterday", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("invalid since: status = %d, want 400", w.Code)
+	}
+}
+
+func TestHistoryExport(t *testing.T) {
+	env := testutil.SetupTestEnv(t)
+
+	author := storage.Author{Name: "test", Email: "test@test.com"}
+	env.Store.Store(context.Background(), "exphist.md", "# History\n", "init", author)
+	env.Store.Store(context.Background(), "exphist.md", "# History\n\nMore.\n", "expand", author)
+
+	req := httptest.NewRequest("GET", "/exphist/history/export", nil)
+	w := httptest.NewRecorder()
+	env.Router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusOK)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "application/mbox" {
+		t.Errorf("Content-Type = %q, want application/mbox", ct)
+	}
+	if cd := w.Header().Get("Content-Disposition"); !strings.Contains(cd, `filename="exphist.patch"`) {
+		t.Errorf("Content-Disposition = %q, should name exphist.patch", cd)
+	}
+	body := w.Body.String()
+	if !strings.Contains(body, "[PATCH 1/2] init") || !strings.Contains(body, "[PATCH 2/2] expand") {
+		t.Errorf("body should contain both patches, got %q", body)
+	}
+
+	req = httptest.NewRequest("GET", "/nohist/history/export", nil)
+	w = httptest.NewRecorder()
+	env.Router.ServeHTTP(w, req)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("missing page: status = %d, want %d", w.Code, http.StatusNotFound)
+	}
+}
+
 func TestSourcePage(t *testing.T) {
 	env := testutil.SetupTestEnv(t)
 
-	env.Store.Store("srcpage.md", "# Source Page", "init", storage.Author{Name: "test", Email: "test@test.com"})
+	env.Store.Store(context.Background(), "srcpage.md", "# Source Page", "init", storage.Author{Name: "test", Email: "test@test.com"})
 
 	req := httptest.NewRequest("GET", "/srcpage/source", nil)
 	w := httptest.NewRecorder()
@@ -419,7 +741,7 @@ func TestReadProtection(t *testing.T) {
 	env := testutil.SetupTestEnv(t)
 	env.Server.Config.ReadAccess = "REGISTERED"
 
-	env.Store.Store("protected.md", "# Protected", "init", storage.Author{Name: "test", Email: "test@test.com"})
+	env.Store.Store(context.Background(), "protected.md", "# Protected", "init", storage.Author{Name: "test", Email: "test@test.com"})
 
 	// Anonymous request (no session cookie)
 	req := httptest.NewRequest("GET", "/protected", nil)
@@ -520,7 +842,7 @@ func TestRSSFeed(t *testing.T) {
 	env := testutil.SetupTestEnv(t)
 
 	// Create a page to have some changelog data
-	env.Store.Store("feedpage.md", "# Feed Page", "init", storage.Author{Name: "test", Email: "test@test.com"})
+	env.Store.Store(context.Background(), "feedpage.md", "# Feed Page", "init", storage.Author{Name: "test", Email: "test@test.com"})
 
 	req := httptest.NewRequest("GET", "/-/feed.rss", nil)
 	w := httptest.NewRecorder()
@@ -538,7 +860,7 @@ func TestRSSFeed(t *testing.T) {
 func TestAtomFeed(t *testing.T) {
 	env := testutil.SetupTestEnv(t)
 
-	env.Store.Store("feedpage.md", "# Feed Page", "init", storage.Author{Name: "test", Email: "test@test.com"})
+	env.Store.Store(context.Background(), "feedpage.md", "# Feed Page", "init", storage.Author{Name: "test", Email: "test@test.com"})
 
 	req := httptest.NewRequest("GET", "/-/feed.atom", nil)
 	w := httptest.NewRecorder()
@@ -553,10 +875,108 @@ func TestAtomFeed(t *testing.T) {
 	}
 }
 
+func TestNamespaceFeed(t *testing.T) {
+	env := testutil.SetupTestEnv(t)
+
+	author := storage.Author{Name: "test", Email: "test@test.com"}
+	env.Store.Store(context.Background(), "docs/guide.md", "# Guide", "docs change", author)
+	env.Store.Store(context.Background(), "other.md", "# Other", "other change", author)
+
+	req := httptest.NewRequest("GET", "/-/feed.atom?path=docs/", nil)
+	w := httptest.NewRecorder()
+	env.Router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusOK)
+	}
+	body := w.Body.String()
+	if !strings.Contains(body, "docs change") || strings.Contains(body, "other change") {
+		t.Errorf("namespace feed should only include commits under docs/, got %q", body)
+	}
+}
+
+func TestPageFeed(t *testing.T) {
+	env := testutil.SetupTestEnv(t)
+
+	author := storage.Author{Name: "test", Email: "test@test.com"}
+	env.Store.Store(context.Background(), "guide.md", "# Guide\n\nIntro *text*.", "first <edit>", author)
+	env.Store.Store(context.Background(), "other.md", "# Other", "unrelated", author)
+
+	req := httptest.NewRequest("GET", "/guide/feed.rss", nil)
+	w := httptest.NewRecorder()
+	env.Router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusOK)
+	}
+	if ct := w.Header().Get("Content-Type"); !strings.Contains(ct, "rss+xml") {
+		t.Errorf("Content-Type = %q, should contain 'rss+xml'", ct)
+	}
+	body := w.Body.String()
+	if !strings.Contains(body, "first &lt;edit&gt;") || strings.Contains(body, "unrelated") {
+		t.Errorf("page feed should only include the page's commits, got %q", body)
+	}
+	if !strings.Contains(body, "&lt;em&gt;text&lt;/em&gt;") {
+		t.Errorf("page feed entry should carry the rendered page summary, got %q", body)
+	}
+
+	etag := w.Header().Get("ETag")
+	if etag == "" || w.Header().Get("Last-Modified") == "" {
+		t.Fatal("page feed should set ETag and Last-Modified")
+	}
+	req = httptest.NewRequest("GET", "/guide/feed.rss", nil)
+	req.Header.Set("If-None-Match", etag)
+	w = httptest.NewRecorder()
+	env.Router.ServeHTTP(w, req)
+	if w.Code != http.StatusNotModified {
+		t.Errorf("conditional status = %d, want %d", w.Code, http.StatusNotModified)
+	}
+}
+
+func TestPageFeed_NotFound(t *testing.T) {
+	env := testutil.SetupTestEnv(t)
+
+	req := httptest.NewRequest("GET", "/missing/feed.rss", nil)
+	w := httptest.NewRecorder()
+	env.Router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusNotFound {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusNotFound)
+	}
+}
+
+func TestIssuesFeed(t *testing.T) {
+	env := testutil.SetupTestEnv(t)
+
+	createTestIssue(t, env, "Broken & busted", "", "open")
+
+	req := httptest.NewRequest("GET", "/-/issues/feed.atom", nil)
+	w := httptest.NewRecorder()
+	env.Router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusOK)
+	}
+	if ct := w.Header().Get("Content-Type"); !strings.Contains(ct, "atom+xml") {
+		t.Errorf("Content-Type = %q, should contain 'atom+xml'", ct)
+	}
+	if !strings.Contains(w.Body.String(), "[open] Broken &amp; busted") {
+		t.Errorf("issues feed should list the issue, got %q", w.Body.String())
+	}
+
+	req = httptest.NewRequest("GET", "/-/issues/feed.atom", nil)
+	req.Header.Set("If-Modified-Since", w.Header().Get("Last-Modified"))
+	w = httptest.NewRecorder()
+	env.Router.ServeHTTP(w, req)
+	if w.Code != http.StatusNotModified {
+		t.Errorf("conditional status = %d, want %d", w.Code, http.StatusNotModified)
+	}
+}
+
 func TestSitemap(t *testing.T) {
 	env := testutil.SetupTestEnv(t)
 
-	env.Store.Store("mappage.md", "# Map Page", "init", storage.Author{Name: "test", Email: "test@test.com"})
+	env.Store.Store(context.Background(), "mappage.md", "# Map Page", "init", storage.Author{Name: "test", Email: "test@test.com"})
 
 	req := httptest.NewRequest("GET", "/-/sitemap.xml", nil)
 	w := httptest.NewRecorder()
@@ -587,6 +1007,102 @@ func TestRobotsTxt(t *testing.T) {
 	}
 }
 
+func TestNoIndexPages(t *testing.T) {
+	env := testutil.SetupTestEnv(t)
+
+	author := storage.Author{Name: "test", Email: "test@test.com"}
+	env.Store.Store(context.Background(), "hidden.md", "---\nnoindex: true\n---\n# Hidden", "hidden change", author)
+	env.Store.Store(context.Background(), "listed.md", "# Listed", "listed change", author)
+	get := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		env.Router.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		return w
+	}
+
+	if body := get("/hidden").Body.String(); !strings.Contains(body, `<meta name="robots" content="noindex"/>`) {
+		t.Errorf("noindex page lacks the robots meta tag:\n%s", body)
+	}
+	if body := get("/listed").Body.String(); strings.Contains(body, `name="robots"`) {
+		t.Errorf("page without noindex has a robots meta tag:\n%s", body)
+	}
+	if body := get("/-/sitemap.xml").Body.String(); strings.Contains(body, "/hidden<") || !strings.Contains(body, "/listed<") {
+		t.Errorf("sitemap should list only the indexed page:\n%s", body)
+	}
+	if body := get("/-/feed.atom").Body.String(); strings.Contains(body, "hidden change") || !strings.Contains(body, "listed change") {
+		t.Errorf("feed should list only changes to indexed pages:\n%s", body)
+	}
+	if w := get("/hidden/feed.rss"); w.Code != http.StatusNotFound {
+		t.Errorf("feed of a noindex page: status = %d, want %d", w.Code, http.StatusNotFound)
+	}
+}
+
+func TestRobotsTxt_Disallow(t *testing.T) {
+	env := testutil.SetupTestEnv(t)
+	env.Server.Config.RobotsDisallow = "/-/, /drafts"
+
+	w := httptest.NewRecorder()
+	env.Router.ServeHTTP(w, httptest.NewRequest("GET", "/-/robots.txt", nil))
+	body := w.Body.String()
+	if !strings.Contains(body, "Disallow: /-/\nDisallow: /drafts\nAllow: /\n") {
+		t.Errorf("robots.txt should disallow the configured paths, got %q", body)
+	}
+}
+
+func TestFeedsAndSitemapDisabled(t *testing.T) {
+	env := testutil.SetupTestEnv(t)
+
+	env.Store.Store(context.Background(), "guide.md", "# Guide", "init", storage.Author{Name: "test", Email: "test@test.com"})
+	createTestIssue(t, env, "Broken", "", "open")
+	get := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		env.Router.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		return w
+	}
+
+	env.Server.Config.DisableFeeds = true
+	for _, path := range []string{"/-/feed", "/-/feed.rss", "/-/feed.atom", "/guide/feed.rss", "/-/issues/feed.atom"} {
+		if w := get(path); w.Code != http.StatusNotFound {
+			t.Errorf("GET %s with feeds disabled: status = %d, want %d", path, w.Code, http.StatusNotFound)
+		}
+	}
+	if body := get("/guide/history").Body.String(); strings.Contains(body, "/guide/feed.rss") {
+		t.Errorf("history links to the disabled feed:\n%s", body)
+	}
+	if w := get("/-/sitemap.xml"); w.Code != http.StatusOK {
+		t.Errorf("sitemap with feeds disabled: status = %d, want %d", w.Code, http.StatusOK)
+	}
+
+	env.Server.Config.DisableSitemap = true
+	if w := get("/-/sitemap.xml"); w.Code != http.StatusNotFound {
+		t.Errorf("sitemap disabled: status = %d, want %d", w.Code, http.StatusNotFound)
+	}
+	if body := get("/-/robots.txt").Body.String(); strings.Contains(body, "Sitemap:") {
+		t.Errorf("robots.txt points to the disabled sitemap:\n%s", body)
+	}
+}
+
+func TestFeed_PrivateCacheWhenReadRestricted(t *testing.T) {
+	env := testutil.SetupTestEnv(t)
+
+	env.Store.Store(context.Background(), "feedpage.md", "# Feed Page", "init", storage.Author{Name: "test", Email: "test@test.com"})
+	w := httptest.NewRecorder()
+	env.Router.ServeHTTP(w, httptest.NewRequest("GET", "/-/feed.rss", nil))
+	if cc := w.Header().Get("Cache-Control"); !strings.HasPrefix(cc, "public") {
+		t.Errorf("Cache-Control of a public wiki's feed = %q, want public", cc)
+	}
+
+	env.Server.Config.ReadAccess = "REGISTERED"
+	cookies := loginAsUser(t, env, "reader@example.com")
+	w = httptest.NewRecorder()
+	env.Router.ServeHTTP(w, requestWithCookies("GET", "/-/feed.rss", nil, cookies))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusOK)
+	}
+	if cc := w.Header().Get("Cache-Control"); !strings.HasPrefix(cc, "private") {
+		t.Errorf("Cache-Control of a private wiki's feed = %q, want private", cc)
+	}
+}
+
 // --- Additional handler tests ---
 
 func TestAbout(t *testing.T) {
@@ -604,7 +1120,7 @@ func TestAbout(t *testing.T) {
 func TestSourcePage_Raw(t *testing.T) {
 	env := testutil.SetupTestEnv(t)
 
-	env.Store.Store("rawsrc.md", "# Raw Source", "init", storage.Author{Name: "test", Email: "test@test.com"})
+	env.Store.Store(context.Background(), "rawsrc.md", "# Raw Source", "init", storage.Author{Name: "test", Email: "test@test.com"})
 
 	req := httptest.NewRequest("GET", "/rawsrc/source?raw=1", nil)
 	w := httptest.NewRecorder()
@@ -972,7 +1488,7 @@ func TestIssueDelete_NonAdmin(t *testing.T) {
 func TestSearch_WithResults(t *testing.T) {
 	env := testutil.SetupTestEnv(t)
 
-	env.Store.Store("searchable.md", "# Searchable\n\nThis contains the keyword findme.", "init", storage.Author{Name: "test", Email: "test@test.com"})
+	env.Store.Store(context.Background(), "searchable.md", "# Searchable\n\nThis contains the keyword findme.", "init", storage.Author{Name: "test", Email: "test@test.com"})
 
 	req := httptest.NewRequest("GET", "/-/search?query=findme", nil)
 	w := httptest.NewRecorder()
@@ -1004,7 +1520,7 @@ func TestSearch_NoResults(t *testing.T) {
 func TestRenamePage(t *testing.T) {
 	env := testutil.SetupTestEnv(t)
 
-	env.Store.Store("oldname.md", "# Old Name\n\nContent.", "init", storage.Author{Name: "test", Email: "test@test.com"})
+	env.Store.Store(context.Background(), "oldname.md", "# Old Name\n\nContent.", "init", storage.Author{Name: "test", Email: "test@test.com"})
 
 	form := url.Values{
 		"new_pagename": {"newname"},
@@ -1024,10 +1540,10 @@ func TestRenamePage(t *testing.T) {
 	}
 
 	// Verify old page gone, new page exists
-	if env.Store.Exists("oldname.md") {
+	if env.Store.Exists(context.Background(), "oldname.md") {
 		t.Error("old page should not exist after rename")
 	}
-	if !env.Store.Exists("newname.md") {
+	if !env.Store.Exists(context.Background(), "newname.md") {
 		t.Error("new page should exist after rename")
 	}
 }
@@ -1038,17 +1554,17 @@ func TestRevert(t *testing.T) {
 	env := testutil.SetupTestEnv(t)
 
 	// Create a page, then edit it to create a second commit
-	_, err := env.Store.Store("revertme.md", "# Original Content", "initial commit", storage.Author{Name: "test", Email: "test@test.com"})
+	_, err := env.Store.Store(context.Background(), "revertme.md", "# Original Content", "initial commit", storage.Author{Name: "test", Email: "test@test.com"})
 	if err != nil {
 		t.Fatalf("failed to store page: %v", err)
 	}
-	_, err = env.Store.Store("revertme.md", "# Modified Content", "second commit", storage.Author{Name: "test", Email: "test@test.com"})
+	_, err = env.Store.Store(context.Background(), "revertme.md", "# Modified Content", "second commit", storage.Author{Name: "test", Email: "test@test.com"})
 	if err != nil {
 		t.Fatalf("failed to store second version: %v", err)
 	}
 
 	// Get the second commit's revision from the log
-	log, err := env.Store.Log("revertme.md", 2)
+	log, err := env.Store.Log(context.Background(), "revertme.md", 2)
 	if err != nil {
 		t.Fatalf("failed to get log: %v", err)
 	}
@@ -1059,7 +1575,7 @@ func TestRevert(t *testing.T) {
 	secondRev := log[0].Revision
 
 	// Verify current content is the modified version
-	content, _ := env.Store.Load("revertme.md", "")
+	content, _ := env.Store.Load(context.Background(), "revertme.md", "")
 	if !strings.Contains(content, "Modified") {
 		t.Fatalf("expected 'Modified' in content before revert, got %q", content)
 	}
@@ -1084,7 +1600,7 @@ func TestRevert(t *testing.T) {
 func TestChangelog(t *testing.T) {
 	env := testutil.SetupTestEnv(t)
 
-	env.Store.Store("clpage.md", "# Changelog Page", "a commit message", storage.Author{Name: "test", Email: "test@test.com"})
+	env.Store.Store(context.Background(), "clpage.md", "# Changelog Page", "a commit message", storage.Author{Name: "test", Email: "test@test.com"})
 
 	req := httptest.NewRequest("GET", "/-/changelog", nil)
 	w := httptest.NewRecorder()
@@ -1102,7 +1618,7 @@ func TestChangelog(t *testing.T) {
 func TestPageIndex(t *testing.T) {
 	env := testutil.SetupTestEnv(t)
 
-	env.Store.Store("indexed.md", "# Indexed Page", "init", storage.Author{Name: "test", Email: "test@test.com"})
+	env.Store.Store(context.Background(), "indexed.md", "# Indexed Page", "init", storage.Author{Name: "test", Email: "test@test.com"})
 
 	req := httptest.NewRequest("GET", "/-/pageindex", nil)
 	w := httptest.NewRecorder()
@@ -1120,12 +1636,12 @@ func TestPageIndex(t *testing.T) {
 func TestCommitView(t *testing.T) {
 	env := testutil.SetupTestEnv(t)
 
-	_, err := env.Store.Store("commitpage.md", "# Commit Page", "test commit for view", storage.Author{Name: "test", Email: "test@test.com"})
+	_, err := env.Store.Store(context.Background(), "commitpage.md", "# Commit Page", "test commit for view", storage.Author{Name: "test", Email: "test@test.com"})
 	if err != nil {
 		t.Fatalf("failed to store page: %v", err)
 	}
 
-	meta, err := env.Store.Metadata("commitpage.md", "")
+	meta, err := env.Store.Metadata(context.Background(), "commitpage.md", "")
 	if err != nil {
 		t.Fatalf("failed to get metadata: %v", err)
 	}
@@ -1146,7 +1662,7 @@ func TestCommitView(t *testing.T) {
 func TestBlamePage(t *testing.T) {
 	env := testutil.SetupTestEnv(t)
 
-	env.Store.Store("blamepage.md", "# Blame Page\n\nLine two.", "init", storage.Author{Name: "test", Email: "test@test.com"})
+	env.Store.Store(context.Background(), "blamepage.md", "# Blame Page\n\nLine two.", "init", storage.Author{Name: "test", Email: "test@test.com"})
 
 	req := httptest.NewRequest("GET", "/blamepage/blame", nil)
 	w := httptest.NewRecorder()
@@ -1155,22 +1671,35 @@ func TestBlamePage(t *testing.T) {
 	if w.Code != http.StatusOK {
 		t.Errorf("status = %d, want %d", w.Code, http.StatusOK)
 	}
-}
-
+	first, _ := env.Store.Metadata(context.Background(), "blamepage.md", "")
+	body := w.Body.String()
+	if !strings.Contains(body, `<a href="/-/commit/`+first.Revision+`" title="init">`) || !strings.Contains(body, `title="test@test.com"`) {
+		t.Errorf("blame should link each line to its commit, with its message and author email:\n%s", body)
+	}
+
+	// The blame of the new version is not the one cached for the old.
+	env.Store.Store(context.Background(), "blamepage.md", "# Blame Page\n\nLine two.\nLine three.", "add line", storage.Author{Name: "test", Email: "test@test.com"})
+	w = httptest.NewRecorder()
+	env.Router.ServeHTTP(w, httptest.NewRequest("GET", "/blamepage/blame", nil))
+	if body := w.Body.String(); !strings.Contains(body, "Line three.") || !strings.Contains(body, `title="add line"`) {
+		t.Errorf("blame after an edit should show it:\n%s", body)
+	}
+}
+
 func TestDiffPage(t *testing.T) {
 	env := testutil.SetupTestEnv(t)
 
-	_, err := env.Store.Store("diffpage.md", "# Version A", "version A", storage.Author{Name: "test", Email: "test@test.com"})
+	_, err := env.Store.Store(context.Background(), "diffpage.md", "# Version A", "version A", storage.Author{Name: "test", Email: "test@test.com"})
 	if err != nil {
 		t.Fatalf("failed to store version A: %v", err)
 	}
-	_, err = env.Store.Store("diffpage.md", "# Version B", "version B", storage.Author{Name: "test", Email: "test@test.com"})
+	_, err = env.Store.Store(context.Background(), "diffpage.md", "# Version B", "version B", storage.Author{Name: "test", Email: "test@test.com"})
 	if err != nil {
 		t.Fatalf("failed to store version B: %v", err)
 	}
 
 	// Get revisions from the log
-	logEntries, err := env.Store.Log("diffpage.md", 2)
+	logEntries, err := env.Store.Log(context.Background(), "diffpage.md", 2)
 	if err != nil {
 		t.Fatalf("failed to get log: %v", err)
 	}
@@ -1193,6 +1722,119 @@ func TestDiffPage(t *testing.T) {
 	}
 }
 
+func TestDiffPage_Views(t *testing.T) {
+	env := testutil.SetupTestEnv(t)
+
+	author := storage.Author{Name: "test", Email: "test@test.com"}
+	env.Store.Store(context.Background(), "views.md", "# Views\n\nThe quick fox.\n", "first", author)
+	env.Store.Store(context.Background(), "views.md", "# Views\n\nThe slow fox.\n", "second", author)
+	env.Store.Store(context.Background(), "views.md", "# Views\n\nThe slow fox.\n\nAdded line.\n", "third", author)
+	logEntries, _ := env.Store.Log(context.Background(), "views.md", 0)
+	if len(logEntries) != 3 {
+		t.Fatalf("expected 3 log entries, got %d", len(logEntries))
+	}
+
+	get := func(query string) (int, string) {
+		w := httptest.NewRecorder()
+		env.Router.ServeHTTP(w, httptest.NewRequest("GET", "/views/diff"+query, nil))
+		return w.Code, w.Body.String()
+	}
+
+	// Without revisions, the revision before the last is compared with
+	// the current version, and the pickers list the history.
+	code, body := get("")
+	if code != http.StatusOK {
+		t.Fatalf("status = %d", code)
+	}
+	if !strings.Contains(body, `<option value="`+logEntries[1].Revision+`" selected>`) {
+		t.Error("rev_a picker should default to the revision before the last")
+	}
+	if !strings.Contains(body, `<option value="" selected>Current version</option>`) {
+		t.Error("rev_b picker should default to the current version")
+	}
+	if !strings.Contains(body, `<span class="diff-add">+Added line.</span>`) {
+		t.Error("unified view lacks the added line")
+	}
+
+	code, body = get("?view=split&rev_a=" + logEntries[2].Revision + "&rev_b=" + logEntries[1].Revision)
+	if code != http.StatusOK {
+		t.Fatalf("split status = %d", code)
+	}
+	if !strings.Contains(body, "The <del>quick</del> fox.") || !strings.Contains(body, "The <ins>slow</ins> fox.") {
+		t.Error("split view lacks the intraline changes")
+	}
+	if strings.Contains(body, "Added line.") {
+		t.Error("split view shows a change made after rev_b")
+	}
+
+	code, body = get("?view=words&rev_a=" + logEntries[2].Revision)
+	if code != http.StatusOK || !strings.Contains(body, "Added line</ins>") {
+		t.Errorf("word view: status %d, missing the added words", code)
+	}
+
+	if code, _ := get("?rev_a=nosuchrev&rev_b=nosuchrev"); code != http.StatusNotFound {
+		t.Errorf("unknown revisions: status = %d, want 404", code)
+	}
+}
+
+func TestComparePage(t *testing.T) {
+	env := testutil.SetupTestEnv(t)
+
+	author := storage.Author{Name: "test", Email: "test@test.com"}
+	env.Store.Store(context.Background(), "cmppage.md", "# Title\n\nKept paragraph.\n\nOld wording.\n", "v1", author)
+	env.Store.Store(context.Background(), "cmppage.md", "# Title\n\nKept paragraph.\n\nNew wording.\n", "v2", author)
+
+	logEntries, err := env.Store.Log(context.Background(), "cmppage.md", 2)
+	if err != nil || len(logEntries) < 2 {
+		t.Fatalf("expected 2 log entries, got %d (%v)", len(logEntries), err)
+	}
+	revB := logEntries[0].Revision
+	revA := logEntries[1].Revision
+
+	req := httptest.NewRequest("GET", "/cmppage/compare?rev_a="+revA+"&rev_b="+revB, nil)
+	w := httptest.NewRecorder()
+	env.Router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusOK)
+	}
+	body := w.Body.String()
+	for _, want := range []string{"<p>Old wording.</p>", "<p>New wording.</p>", "compare-changed", "1 block differs"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("compare view missing %q", want)
+		}
+	}
+	if strings.Count(body, "compare-same") != 2 {
+		t.Errorf("heading and kept paragraph should be unchanged, got %d same rows", strings.Count(body, "compare-same"))
+	}
+
+	// The inline view merges both revisions into one rendered page.
+	req = httptest.NewRequest("GET", "/cmppage/compare?rev_a="+revA+"&rev_b="+revB+"&view=inline", nil)
+	w = httptest.NewRecorder()
+	env.Router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("inline status = %d, want %d", w.Code, http.StatusOK)
+	}
+	if body := w.Body.String(); !strings.Contains(body, "<p><del>Old</del><ins>New</ins> wording.</p>") || strings.Contains(body, `class="compare-row compare-changed"`) {
+		t.Error("inline compare view should mark the changed words in place")
+	}
+
+	// Without rev_b the older revision is compared with the current page.
+	req = httptest.NewRequest("GET", "/cmppage/compare?rev_a="+revA, nil)
+	w = httptest.NewRecorder()
+	env.Router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "the current version") {
+		t.Errorf("compare with current: status = %d", w.Code)
+	}
+
+	req = httptest.NewRequest("GET", "/cmppage/compare?rev_a=nosuchrev", nil)
+	w = httptest.NewRecorder()
+	env.Router.ServeHTTP(w, req)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("unknown revision: status = %d, want %d", w.Code, http.StatusNotFound)
+	}
+}
+
 // --- Admin dashboard test ---
 
 func TestAdminDashboard(t *testing.T) {
@@ -1213,6 +1855,78 @@ func TestAdminDashboard(t *testing.T) {
 	}
 }
 
+func TestAdminReindex(t *testing.T) {
+	env := testutil.SetupTestEnv(t)
+	cookies := loginAsAdmin(t, env)
+	author := storage.Author{Name: "Test", Email: "test@example.com"}
+	env.Store.Store(context.Background(), "one.md", "# One\n", "add", author)
+	env.Store.Store(context.Background(), "two.md", "# Two\n", "add", author)
+
+	req := requestWithCookies("POST", "/-/admin/reindex", strings.NewReader(""), cookies)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	env.Router.ServeHTTP(w, req)
+	if w.Code != http.StatusFound {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusFound)
+	}
+
+	deadline := time.Now().Add(10 * time.Second)
+	for env.Server.Wiki.ReindexStatus().Running {
+		if time.Now().After(deadline) {
+			t.Fatal("rebuild did not finish")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	req = requestWithCookies("GET", "/-/admin", nil, cookies)
+	w = httptest.NewRecorder()
+	env.Router.ServeHTTP(w, req)
+	body := w.Body.String()
+	if !strings.Contains(body, "2 pages indexed") || !strings.Contains(body, "Last rebuilt") {
+		t.Errorf("dashboard should report the rebuilt index, got:\n%s", body)
+	}
+}
+
+func TestAdminMaintenance(t *testing.T) {
+	env := testutil.SetupTestEnv(t)
+	cookies := loginAsAdmin(t, env)
+	author := storage.Author{Name: "Test", Email: "test@example.com"}
+	for i := 0; i < 3; i++ {
+		env.Store.Store(context.Background(), "home.md", fmt.Sprintf("# Home\n\nEdit %d\n", i), "edit", author)
+	}
+
+	maintain := func() *httptest.ResponseRecorder {
+		req := requestWithCookies("POST", "/-/admin/maintenance", strings.NewReader(""), cookies)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		env.Router.ServeHTTP(w, req)
+		return w
+	}
+	if w := maintain(); w.Code != http.StatusNotFound {
+		t.Errorf("maintenance without a maintainer: status = %d, want %d", w.Code, http.StatusNotFound)
+	}
+
+	env.Server.Maintainer = env.Store.(*storage.GitStorage)
+	if w := maintain(); w.Code != http.StatusFound {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusFound)
+	}
+	runs, err := env.DB.ListRepositoryMaintenance(context.Background(), 10)
+	if err != nil || len(runs) != 1 || runs[0].Packs != 1 || runs[0].LooseObjects != 0 {
+		t.Fatalf("recorded runs = %+v, %v; want one leaving a single pack", runs, err)
+	}
+
+	req := requestWithCookies("GET", "/-/admin", nil, cookies)
+	w := httptest.NewRecorder()
+	env.Router.ServeHTTP(w, req)
+	body := w.Body.String()
+	if !strings.Contains(body, "in 1 pack and 0 loose objects") || !strings.Contains(body, "Run Maintenance") {
+		t.Errorf("dashboard should report the repository's size, got:\n%s", body)
+	}
+	if content, _ := env.Store.Load(context.Background(), "home.md", ""); content != "# Home\n\nEdit 2\n" {
+		t.Errorf("home.md after maintenance = %q", content)
+	}
+}
+
 // --- Issue new form test ---
 
 func TestIssueNewForm(t *testing.T) {
@@ -1436,6 +2150,90 @@ func TestAdminSiteSettingsSave(t *testing.T) {
 	}
 }
 
+func TestAdminSettingsSave(t *testing.T) {
+	env := testutil.SetupTestEnv(t)
+	cookies := loginAsAdmin(t, env)
+	env.Store.Store(context.Background(), "conflict.md", "# Original", "init", storage.Author{Name: "test", Email: "test@test.com"})
+	meta, _ := env.Store.Metadata(context.Background(), "conflict.md", "")
+	env.Store.Store(context.Background(), "conflict.md", "# Modified by other", "other edit", storage.Author{Name: "other", Email: "other@test.com"})
+
+	postSettings := func(form url.Values) {
+		t.Helper()
+		req := requestWithCookies("POST", "/-/admin/settings", strings.NewReader(form.Encode()), cookies)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		env.Router.ServeHTTP(w, req)
+		if w.Code != http.StatusFound {
+			t.Fatalf("status = %d, want %d", w.Code, http.StatusFound)
+		}
+	}
+	anonymousStatus := func(path string) int {
+		w := httptest.NewRecorder()
+		env.Router.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		return w.Code
+	}
+
+	postSettings(url.Values{
+		"read_access":        {"REGISTERED"},
+		"write_access":       {"ADMIN"},
+		"attachment_access":  {"ADMIN"},
+		"home_page":          {"Start"},
+		"site_url":           {"https://wiki.example.com/"},
+		"edit_conflict_mode": {"overwrite"},
+		"feeds_enabled":      {"on"},
+		"sitemap_enabled":    {"on"},
+	})
+
+	// Applied to the next request without a restart.
+	if code := anonymousStatus("/conflict"); code != http.StatusFound {
+		t.Errorf("anonymous read with REGISTERED access: status = %d, want %d", code, http.StatusFound)
+	}
+	w := httptest.NewRecorder()
+	env.Router.ServeHTTP(w, requestWithCookies("GET", "/-/robots.txt", nil, cookies))
+	if !strings.Contains(w.Body.String(), "https://wiki.example.com/-/sitemap.xml") {
+		t.Errorf("robots.txt should use the saved site URL, got:\n%s", w.Body.String())
+	}
+	w = httptest.NewRecorder()
+	env.Router.ServeHTTP(w, httptest.NewRequest("GET", "/-/register", nil))
+	if w.Code != http.StatusFound || w.Header().Get("Location") != "/-/login" {
+		t.Errorf("register with registration disabled: status = %d, location = %q", w.Code, w.Header().Get("Location"))
+	}
+	body := fmt.Sprintf(`{"content":"# Last write wins","revision":"%s"}`, meta.Revision)
+	if w := apiRequest(t, env, "PUT", "/-/api/v1/pages/conflict", body, cookies); w.Code != http.StatusOK {
+		t.Errorf("stale save in overwrite mode: status = %d, want %d", w.Code, http.StatusOK)
+	}
+
+	// Settings equal to the configured value are not stored.
+	if _, err := env.DB.Queries.GetPreference(context.Background(), "disable_registration"); err != nil {
+		t.Errorf("changed setting should be stored: %v", err)
+	}
+	postSettings(url.Values{
+		"read_access":          {"ANONYMOUS"},
+		"write_access":         {"ADMIN"},
+		"attachment_access":    {"ANONYMOUS"},
+		"registration_enabled": {"on"},
+		"site_url":             {"http://localhost:8080"},
+		"edit_conflict_mode":   {"reject"},
+	})
+	if _, err := env.DB.Queries.GetPreference(context.Background(), "read_access"); err == nil {
+		t.Error("setting equal to its configured value should not be stored")
+	}
+	if code := anonymousStatus("/conflict"); code != http.StatusOK {
+		t.Errorf("anonymous read after restoring ANONYMOUS: status = %d, want %d", code, http.StatusOK)
+	}
+
+	// Invalid values are rejected and leave the settings unchanged.
+	postSettings(url.Values{"read_access": {"EVERYONE"}, "site_url": {"http://localhost:8080"}})
+	if got := env.Server.Settings.Get(context.Background()).WriteAccess; got != "ADMIN" {
+		t.Errorf("WriteAccess after invalid save = %q, want ADMIN", got)
+	}
+
+	postSettings(url.Values{"reset": {"1"}})
+	if got := env.Server.Settings.Get(context.Background()); got != env.Server.Settings.Configured() {
+		t.Errorf("settings after reset = %+v, want configured %+v", got, env.Server.Settings.Configured())
+	}
+}
+
 // --- Group B: User Settings ---
 
 func TestSettings_Get(t *testing.T) {
@@ -1580,7 +2378,7 @@ func TestCreatePage(t *testing.T) {
 func TestAttachmentsList(t *testing.T) {
 	env := testutil.SetupTestEnv(t)
 
-	env.Store.Store("attachpage.md", "# Attachment Page", "init", storage.Author{Name: "test", Email: "test@test.com"})
+	env.Store.Store(context.Background(), "attachpage.md", "# Attachment Page", "init", storage.Author{Name: "test", Email: "test@test.com"})
 
 	req := httptest.NewRequest("GET", "/attachpage/attachments", nil)
 	w := httptest.NewRecorder()
@@ -1595,7 +2393,7 @@ func TestUploadAttachment(t *testing.T) {
 	env := testutil.SetupTestEnv(t)
 
 	// Create a page first
-	env.Store.Store("uploadpage.md", "# Upload Page", "init", storage.Author{Name: "test", Email: "test@test.com"})
+	env.Store.Store(context.Background(), "uploadpage.md", "# Upload Page", "init", storage.Author{Name: "test", Email: "test@test.com"})
 
 	// Build multipart form with a file
 	var body bytes.Buffer
@@ -1617,7 +2415,7 @@ func TestUploadAttachment(t *testing.T) {
 	}
 
 	// Verify the file was stored (attachment dir is the page filename without .md)
-	if !env.Store.Exists("uploadpage/test.txt") {
+	if !env.Store.Exists(context.Background(), "uploadpage/test.txt") {
 		t.Error("uploaded file should exist in storage")
 	}
 }
@@ -1626,8 +2424,8 @@ func TestServeAttachment(t *testing.T) {
 	env := testutil.SetupTestEnv(t)
 
 	// Create a page and an attachment
-	env.Store.Store("mypage.md", "# My Page", "init", storage.Author{Name: "test", Email: "test@test.com"})
-	env.Store.StoreBytes("mypage/report.pdf", []byte("fake-pdf-content"), "add attachment", storage.Author{Name: "test", Email: "test@test.com"})
+	env.Store.Store(context.Background(), "mypage.md", "# My Page", "init", storage.Author{Name: "test", Email: "test@test.com"})
+	env.Store.StoreBytes(context.Background(), "mypage/report.pdf", []byte("fake-pdf-content"), "add attachment", storage.Author{Name: "test", Email: "test@test.com"})
 
 	// Test 1: Request the attachment URL
 	req := httptest.NewRequest("GET", "/mypage/report.pdf", nil)
@@ -1652,9 +2450,97 @@ func TestServeAttachment(t *testing.T) {
 	}
 }
 
+func TestServeAttachment_Range(t *testing.T) {
+	env := testutil.SetupTestEnv(t)
+	author := storage.Author{Name: "test", Email: "test@test.com"}
+	env.Store.Store(context.Background(), "media.md", "# Media", "init", author)
+	env.Store.StoreBytes(context.Background(), "media/clip.pdf", []byte("0123456789"), "add attachment", author)
+
+	get := func(header, value string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/media/clip.pdf", nil)
+		if header != "" {
+			req.Header.Set(header, value)
+		}
+		w := httptest.NewRecorder()
+		env.Router.ServeHTTP(w, req)
+		return w
+	}
+
+	// Read into memory or streamed from disk, either way ranges are served.
+	for _, limit := range []int64{1 << 20, 4} {
+		env.Server.Config.AttachmentMemoryLimit = limit
+		w := get("Range", "bytes=2-5")
+		if w.Code != http.StatusPartialContent || w.Body.String() != "2345" {
+			t.Errorf("limit %d: range status = %d, body %q; want 206 and %q", limit, w.Code, w.Body.String(), "2345")
+		}
+		if cr := w.Header().Get("Content-Range"); cr != "bytes 2-5/10" {
+			t.Errorf("limit %d: Content-Range = %q", limit, cr)
+		}
+
+		w = get("", "")
+		etag := w.Header().Get("ETag")
+		if w.Code != http.StatusOK || w.Body.String() != "0123456789" || etag == "" || w.Header().Get("Accept-Ranges") != "bytes" {
+			t.Fatalf("limit %d: status = %d, body %q, ETag %q, Accept-Ranges %q", limit, w.Code, w.Body.String(), etag, w.Header().Get("Accept-Ranges"))
+		}
+		if w := get("If-None-Match", etag); w.Code != http.StatusNotModified {
+			t.Errorf("limit %d: If-None-Match status = %d, want 304", limit, w.Code)
+		}
+		if w := get("If-Modified-Since", w.Header().Get("Last-Modified")); w.Code != http.StatusNotModified {
+			t.Errorf("limit %d: If-Modified-Since status = %d, want 304", limit, w.Code)
+		}
+	}
+}
+
+func TestObsidianCompatView(t *testing.T) {
+	env := testutil.SetupTestEnv(t)
+	env.Server.Config.ObsidianCompat = true
+	env.Server.Config.RetainPageNameCase = true
+	author := storage.Author{Name: "test", Email: "test@test.com"}
+
+	env.Store.Store(context.Background(), "Work/Meeting Notes.md", "---\naliases: [Standup]\n---\n# Meeting Notes\n\n> [!todo] Follow up\n> Send the minutes.\n", "init", author)
+	env.Store.Store(context.Background(), "Work/Today.md", "# Today\n\n![[diagram.png|200]]\n\n![[Meeting Notes]]\n", "init", author)
+	env.Store.StoreBytes(context.Background(), "diagram.png", []byte("png-content"), "add image", author)
+	env.Store.StoreBytes(context.Background(), ".obsidian/app.json", []byte("{}"), "add settings", author)
+
+	req := httptest.NewRequest("GET", "/Work/Today", nil)
+	w := httptest.NewRecorder()
+	env.Router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("view: status = %d, want %d", w.Code, http.StatusOK)
+	}
+	body := w.Body.String()
+	for _, want := range []string{`src="/diagram.png"`, `width="200"`, `class="embed-page"`, "Send the minutes."} {
+		if !strings.Contains(body, want) {
+			t.Errorf("page should contain %q", want)
+		}
+	}
+
+	// Files at the vault root are served, hidden ones are not.
+	req = httptest.NewRequest("GET", "/diagram.png", nil)
+	w = httptest.NewRecorder()
+	env.Router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK || w.Body.String() != "png-content" {
+		t.Errorf("root file: status = %d, body = %q", w.Code, w.Body.String())
+	}
+	req = httptest.NewRequest("GET", "/.obsidian/app.json", nil)
+	w = httptest.NewRecorder()
+	env.Router.ServeHTTP(w, req)
+	if w.Body.String() == "{}" {
+		t.Error("hidden vault settings should not be served")
+	}
+
+	// A frontmatter alias redirects to its page.
+	req = httptest.NewRequest("GET", "/standup", nil)
+	w = httptest.NewRecorder()
+	env.Router.ServeHTTP(w, req)
+	if w.Code != http.StatusFound || w.Header().Get("Location") != "/Work/Meeting%20Notes" {
+		t.Errorf("alias: status = %d, Location = %q", w.Code, w.Header().Get("Location"))
+	}
+}
+
 func TestUploadAttachmentRejectsBadFilename(t *testing.T) {
 	env := testutil.SetupTestEnv(t)
-	env.Store.Store("uploadpage.md", "# Upload Page", "init", storage.Author{Name: "test", Email: "test@test.com"})
+	env.Store.Store(context.Background(), "uploadpage.md", "# Upload Page", "init", storage.Author{Name: "test", Email: "test@test.com"})
 
 	var body bytes.Buffer
 	writer := multipart.NewWriter(&body)
@@ -1680,9 +2566,9 @@ func TestUploadAttachmentRejectsBadFilename(t *testing.T) {
 func TestServeAttachmentSVGForcesDownload(t *testing.T) {
 	env := testutil.SetupTestEnv(t)
 
-	env.Store.Store("svgpage.md", "# SVG Page", "init", storage.Author{Name: "test", Email: "test@test.com"})
+	env.Store.Store(context.Background(), "svgpage.md", "# SVG Page", "init", storage.Author{Name: "test", Email: "test@test.com"})
 	svg := []byte(`<svg xmlns="http://www.w3.org/2000/svg"><script>alert(1)</script></svg>`)
-	env.Store.StoreBytes("svgpage/evil.svg", svg, "add svg", storage.Author{Name: "test", Email: "test@test.com"})
+	env.Store.StoreBytes(context.Background(), "svgpage/evil.svg", svg, "add svg", storage.Author{Name: "test", Email: "test@test.com"})
 
 	req := httptest.NewRequest("GET", "/svgpage/evil.svg", nil)
 	w := httptest.NewRecorder()
@@ -1738,7 +2624,7 @@ func TestSecurityHeaders(t *testing.T) {
 func TestNestedPageRouting(t *testing.T) {
 	env := testutil.SetupTestEnv(t)
 
-	env.Store.Store("docs/getting-started.md", "# Getting Started", "init", storage.Author{Name: "test", Email: "test@test.com"})
+	env.Store.Store(context.Background(), "docs/getting-started.md", "# Getting Started", "init", storage.Author{Name: "test", Email: "test@test.com"})
 
 	req := httptest.NewRequest("GET", "/docs/getting-started", nil)
 	w := httptest.NewRecorder()
@@ -1755,7 +2641,7 @@ func TestXSS_ScriptTagStripped(t *testing.T) {
 	env := testutil.SetupTestEnv(t)
 
 	// Store a page with XSS payload in markdown
-	env.Store.Store("xsstest.md", "# Test\n\n<script>alert(1)</script>", "init", storage.Author{Name: "test", Email: "test@test.com"})
+	env.Store.Store(context.Background(), "xsstest.md", "# Test\n\n<script>alert(1)</script>", "init", storage.Author{Name: "test", Email: "test@test.com"})
 
 	req := httptest.NewRequest("GET", "/xsstest", nil)
 	w := httptest.NewRecorder()
@@ -1800,7 +2686,7 @@ func TestPathTraversal_SaveBlocked(t *testing.T) {
 
 	// The storage layer should reject the path traversal attempt.
 	// Either it returns an error page or redirects, but must not succeed.
-	if env.Store.Exists("../../evil.md") {
+	if env.Store.Exists(context.Background(), "../../evil.md") {
 		t.Error("path traversal save should be blocked, but file was created")
 	}
 }
@@ -1809,7 +2695,7 @@ func TestSearch_ReDoS_Safe(t *testing.T) {
 	env := testutil.SetupTestEnv(t)
 
 	// Create a page to search
-	env.Store.Store("redospage.md", "# ReDoS Test\n\naaaaaaaaaaaa", "init", storage.Author{Name: "test", Email: "test@test.com"})
+	env.Store.Store(context.Background(), "redospage.md", "# ReDoS Test\n\naaaaaaaaaaaa", "init", storage.Author{Name: "test", Email: "test@test.com"})
 
 	// Use a pattern known to cause ReDoS in naive regex engines
 	req := httptest.NewRequest("GET", "/-/search?query=(a%2B)%2B%24", nil)
@@ -1829,7 +2715,7 @@ func TestSearch_ReDoS_Safe(t *testing.T) {
 func TestETag_Present(t *testing.T) {
 	env := testutil.SetupTestEnv(t)
 
-	env.Store.Store("etagpage.md", "# ETag Test", "init", storage.Author{Name: "test", Email: "test@test.com"})
+	env.Store.Store(context.Background(), "etagpage.md", "# ETag Test", "init", storage.Author{Name: "test", Email: "test@test.com"})
 
 	req := httptest.NewRequest("GET", "/etagpage", nil)
 	w := httptest.NewRecorder()
@@ -1848,7 +2734,7 @@ func TestETag_Present(t *testing.T) {
 func TestETag_NotModified(t *testing.T) {
 	env := testutil.SetupTestEnv(t)
 
-	env.Store.Store("etagpage2.md", "# ETag 304 Test", "init", storage.Author{Name: "test", Email: "test@test.com"})
+	env.Store.Store(context.Background(), "etagpage2.md", "# ETag 304 Test", "init", storage.Author{Name: "test", Email: "test@test.com"})
 
 	// First request to get the ETag
 	req1 := httptest.NewRequest("GET", "/etagpage2", nil)
@@ -1874,6 +2760,201 @@ func TestETag_NotModified(t *testing.T) {
 	}
 }
 
+func TestETag_ListAndWeakMatch(t *testing.T) {
+	env := testutil.SetupTestEnv(t)
+
+	env.Store.Store(context.Background(), "etagpage3.md", "# ETag List", "init", storage.Author{Name: "test", Email: "test@test.com"})
+
+	w1 := httptest.NewRecorder()
+	env.Router.ServeHTTP(w1, httptest.NewRequest("GET", "/etagpage3", nil))
+	etag := w1.Header().Get("ETag")
+	if etag == "" || w1.Header().Get("Last-Modified") == "" {
+		t.Fatal("page view should set ETag and Last-Modified")
+	}
+
+	req := httptest.NewRequest("GET", "/etagpage3", nil)
+	req.Header.Set("If-None-Match", `"stale", W/`+etag)
+	w2 := httptest.NewRecorder()
+	env.Router.ServeHTTP(w2, req)
+	if w2.Code != http.StatusNotModified {
+		t.Errorf("status = %d, want %d for a matching tag in a list", w2.Code, http.StatusNotModified)
+	}
+}
+
+func TestETag_EmbeddedPageEdited(t *testing.T) {
+	env := testutil.SetupTestEnv(t)
+	env.Server.Config.ObsidianCompat = true
+	author := storage.Author{Name: "test", Email: "test@test.com"}
+
+	env.Store.Store(context.Background(), "inner.md", "# Inner\n\nFirst version.\n", "init", author)
+	env.Store.Store(context.Background(), "outer.md", "# Outer\n\n![[inner]]\n", "init", author)
+
+	get := func(etag string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/outer", nil)
+		if etag != "" {
+			req.Header.Set("If-None-Match", etag)
+		}
+		w := httptest.NewRecorder()
+		env.Router.ServeHTTP(w, req)
+		return w
+	}
+	w := get("")
+	etag := w.Header().Get("ETag")
+	if w.Code != http.StatusOK || etag == "" || !strings.Contains(w.Body.String(), "First version.") {
+		t.Fatalf("first view: status = %d, ETag %q", w.Code, etag)
+	}
+	if w := get(etag); w.Code != http.StatusNotModified {
+		t.Errorf("unchanged view: status = %d, want %d", w.Code, http.StatusNotModified)
+	}
+
+	// Editing only the embedded page changes the view.
+	env.Store.Store(context.Background(), "inner.md", "# Inner\n\nSecond version.\n", "edit", author)
+	w = get(etag)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "Second version.") {
+		t.Errorf("view after editing the embedded page: status = %d, want %d with the edit", w.Code, http.StatusOK)
+	}
+}
+
+func TestETag_IfModifiedSince(t *testing.T) {
+	env := testutil.SetupTestEnv(t)
+
+	env.Store.Store(context.Background(), "etagpage4.md", "# ETag Date", "init", storage.Author{Name: "test", Email: "test@test.com"})
+
+	w1 := httptest.NewRecorder()
+	env.Router.ServeHTTP(w1, httptest.NewRequest("GET", "/etagpage4", nil))
+	lastModified := w1.Header().Get("Last-Modified")
+
+	req := httptest.NewRequest("GET", "/etagpage4", nil)
+	req.Header.Set("If-Modified-Since", lastModified)
+	w2 := httptest.NewRecorder()
+	env.Router.ServeHTTP(w2, req)
+	if w2.Code != http.StatusNotModified {
+		t.Errorf("status = %d, want %d", w2.Code, http.StatusNotModified)
+	}
+
+	// An unmatched If-None-Match wins over a matching date.
+	req = httptest.NewRequest("GET", "/etagpage4", nil)
+	req.Header.Set("If-None-Match", `"stale"`)
+	req.Header.Set("If-Modified-Since", lastModified)
+	w3 := httptest.NewRecorder()
+	env.Router.ServeHTTP(w3, req)
+	if w3.Code != http.StatusOK {
+		t.Errorf("status = %d, want %d when the ETag does not match", w3.Code, http.StatusOK)
+	}
+}
+
+func TestETag_Attachment(t *testing.T) {
+	env := testutil.SetupTestEnv(t)
+
+	author := storage.Author{Name: "test", Email: "test@test.com"}
+	env.Store.Store(context.Background(), "etagattach.md", "# Attach", "init", author)
+	env.Store.StoreBytes(context.Background(), "etagattach/report.pdf", []byte("v1"), "add attachment", author)
+
+	w1 := httptest.NewRecorder()
+	env.Router.ServeHTTP(w1, httptest.NewRequest("GET", "/etagattach/report.pdf", nil))
+	etag := w1.Header().Get("ETag")
+	if etag == "" || w1.Header().Get("Last-Modified") == "" {
+		t.Fatal("attachment should set ETag and Last-Modified")
+	}
+
+	req := httptest.NewRequest("GET", "/etagattach/report.pdf", nil)
+	req.Header.Set("If-None-Match", etag)
+	w2 := httptest.NewRecorder()
+	env.Router.ServeHTTP(w2, req)
+	if w2.Code != http.StatusNotModified || w2.Body.Len() != 0 {
+		t.Errorf("status = %d, body %q; want an empty 304", w2.Code, w2.Body.String())
+	}
+
+	// New content means a new tag.
+	env.Store.StoreBytes(context.Background(), "etagattach/report.pdf", []byte("v2"), "update attachment", author)
+	req = httptest.NewRequest("GET", "/etagattach/report.pdf", nil)
+	req.Header.Set("If-None-Match", etag)
+	w3 := httptest.NewRecorder()
+	env.Router.ServeHTTP(w3, req)
+	if w3.Code != http.StatusOK || w3.Body.String() != "v2" {
+		t.Errorf("status = %d, body %q; want the updated attachment", w3.Code, w3.Body.String())
+	}
+}
+
+func TestETag_GeneratedForOtherPages(t *testing.T) {
+	env := testutil.SetupTestEnv(t)
+
+	env.Store.Store(context.Background(), "mappage.md", "# Map Page", "init", storage.Author{Name: "test", Email: "test@test.com"})
+
+	for _, path := range []string{"/-/sitemap.xml", "/-/robots.txt", "/-/changelog"} {
+		w1 := httptest.NewRecorder()
+		env.Router.ServeHTTP(w1, httptest.NewRequest("GET", path, nil))
+		etag := w1.Header().Get("ETag")
+		if w1.Code != http.StatusOK || etag == "" {
+			t.Errorf("%s: status = %d, ETag = %q; want 200 with an ETag", path, w1.Code, etag)
+			continue
+		}
+
+		// HTML pages embed the CSRF token, so revalidate as the same client.
+		req := httptest.NewRequest("GET", path, nil)
+		for _, c := range w1.Result().Cookies() {
+			req.AddCookie(c)
+		}
+		req.Header.Set("If-None-Match", etag)
+		w2 := httptest.NewRecorder()
+		env.Router.ServeHTTP(w2, req)
+		if w2.Code != http.StatusNotModified {
+			t.Errorf("%s: conditional status = %d, want %d", path, w2.Code, http.StatusNotModified)
+		}
+	}
+}
+
+func TestETag_SitemapLastModified(t *testing.T) {
+	env := testutil.SetupTestEnv(t)
+
+	env.Store.Store(context.Background(), "mappage.md", "# Map Page", "init", storage.Author{Name: "test", Email: "test@test.com"})
+
+	w := httptest.NewRecorder()
+	env.Router.ServeHTTP(w, httptest.NewRequest("GET", "/-/sitemap.xml", nil))
+	if w.Header().Get("Last-Modified") == "" {
+		t.Error("sitemap should set Last-Modified from the newest page")
+	}
+}
+
+func TestStaticAssets_HashedURLs(t *testing.T) {
+	env := testutil.SetupTestEnv(t)
+
+	env.Store.Store(context.Background(), "staticpage.md", "# Static", "init", storage.Author{Name: "test", Email: "test@test.com"})
+
+	w := httptest.NewRecorder()
+	env.Router.ServeHTTP(w, httptest.NewRequest("GET", "/staticpage", nil))
+	body := w.Body.String()
+	if strings.Contains(body, "/static/css/gopherwiki.css") {
+		t.Error("page should link the stylesheet by its versioned URL")
+	}
+	start := strings.Index(body, "/static/css/gopherwiki.")
+	if start < 0 {
+		t.Fatalf("versioned stylesheet link not found in %q", body)
+	}
+	url := body[start : start+strings.Index(body[start:], `"`)]
+
+	w = httptest.NewRecorder()
+	env.Router.ServeHTTP(w, httptest.NewRequest("GET", url, nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("%s: status = %d, want %d", url, w.Code, http.StatusOK)
+	}
+	if cc := w.Header().Get("Cache-Control"); !strings.Contains(cc, "immutable") {
+		t.Errorf("%s: Cache-Control = %q, want immutable", url, cc)
+	}
+
+	w = httptest.NewRecorder()
+	env.Router.ServeHTTP(w, httptest.NewRequest("GET", "/static/css/gopherwiki.css", nil))
+	if cc := w.Header().Get("Cache-Control"); w.Code != http.StatusOK || strings.Contains(cc, "immutable") {
+		t.Errorf("plain URL: status = %d, Cache-Control = %q; want 200 without immutable", w.Code, cc)
+	}
+
+	w = httptest.NewRecorder()
+	env.Router.ServeHTTP(w, httptest.NewRequest("GET", "/static/css/gopherwiki.0000000000.css", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("stale hash: status = %d, want %d", w.Code, http.StatusNotFound)
+	}
+}
+
 // --- Group F: Issue Filters ---
 
 func TestIssueList_StatusFilter(t *testing.T) {
@@ -1985,7 +3066,7 @@ func TestAdminIssueSettingsSave(t *testing.T) {
 func TestDeleteForm(t *testing.T) {
 	env := testutil.SetupTestEnv(t)
 
-	env.Store.Store("fordelete.md", "# For Delete", "init", storage.Author{Name: "test", Email: "test@test.com"})
+	env.Store.Store(context.Background(), "fordelete.md", "# For Delete", "init", storage.Author{Name: "test", Email: "test@test.com"})
 
 	req := httptest.NewRequest("GET", "/fordelete/delete", nil)
 	w := httptest.NewRecorder()
@@ -1999,7 +3080,7 @@ func TestDeleteForm(t *testing.T) {
 func TestRenameForm(t *testing.T) {
 	env := testutil.SetupTestEnv(t)
 
-	env.Store.Store("forrename.md", "# For Rename", "init", storage.Author{Name: "test", Email: "test@test.com"})
+	env.Store.Store(context.Background(), "forrename.md", "# For Rename", "init", storage.Author{Name: "test", Email: "test@test.com"})
 
 	req := httptest.NewRequest("GET", "/forrename/rename", nil)
 	w := httptest.NewRecorder()
@@ -2016,18 +3097,18 @@ func TestSavePage_ConflictDetected(t *testing.T) {
 	env := testutil.SetupTestEnv(t)
 
 	// Create a page and get its revision
-	_, err := env.Store.Store("conflictpage.md", "# Original", "initial", storage.Author{Name: "test", Email: "test@test.com"})
+	_, err := env.Store.Store(context.Background(), "conflictpage.md", "# Original", "initial", storage.Author{Name: "test", Email: "test@test.com"})
 	if err != nil {
 		t.Fatalf("failed to store page: %v", err)
 	}
-	meta, err := env.Store.Metadata("conflictpage.md", "")
+	meta, err := env.Store.Metadata(context.Background(), "conflictpage.md", "")
 	if err != nil {
 		t.Fatalf("failed to get metadata: %v", err)
 	}
 	staleRevision := meta.Revision
 
 	// Simulate another user saving (changing the HEAD revision)
-	_, err = env.Store.Store("conflictpage.md", "# Modified by other user", "other edit", storage.Author{Name: "other", Email: "other@test.com"})
+	_, err = env.Store.Store(context.Background(), "conflictpage.md", "# Modified by other user", "other edit", storage.Author{Name: "other", Email: "other@test.com"})
 	if err != nil {
 		t.Fatalf("failed to store second version: %v", err)
 	}
@@ -2057,7 +3138,7 @@ func TestSavePage_ConflictDetected(t *testing.T) {
 	}
 
 	// Verify the original (other user's) content is still in storage
-	content, err := env.Store.Load("conflictpage.md", "")
+	content, err := env.Store.Load(context.Background(), "conflictpage.md", "")
 	if err != nil {
 		t.Fatalf("failed to load page: %v", err)
 	}
@@ -2070,11 +3151,11 @@ func TestSavePage_NoConflict(t *testing.T) {
 	env := testutil.SetupTestEnv(t)
 
 	// Create a page and get its revision
-	_, err := env.Store.Store("noconflict.md", "# Original", "initial", storage.Author{Name: "test", Email: "test@test.com"})
+	_, err := env.Store.Store(context.Background(), "noconflict.md", "# Original", "initial", storage.Author{Name: "test", Email: "test@test.com"})
 	if err != nil {
 		t.Fatalf("failed to store page: %v", err)
 	}
-	meta, err := env.Store.Metadata("noconflict.md", "")
+	meta, err := env.Store.Metadata(context.Background(), "noconflict.md", "")
 	if err != nil {
 		t.Fatalf("failed to get metadata: %v", err)
 	}
@@ -2096,7 +3177,7 @@ func TestSavePage_NoConflict(t *testing.T) {
 	}
 
 	// Verify content was saved
-	content, err := env.Store.Load("noconflict.md", "")
+	content, err := env.Store.Load(context.Background(), "noconflict.md", "")
 	if err != nil {
 		t.Fatalf("failed to load page: %v", err)
 	}
@@ -2123,8 +3204,127 @@ func TestSavePage_EmptyRevisionBypass(t *testing.T) {
 	}
 
 	// Verify page was created
-	if !env.Store.Exists("emptyrevpage.md") {
+	if !env.Store.Exists(context.Background(), "emptyrevpage.md") {
 		t.Error("page should exist after save with empty revision")
 	}
 }
 
+
+func TestAdminBackup(t *testing.T) {
+	env := testutil.SetupTestEnv(t)
+	env.Store.Store(context.Background(), "home.md", "# Home", "create", storage.Author{Name: "test", Email: "test@test.com"})
+
+	req := httptest.NewRequest("GET", "/-/admin/backup", nil)
+	for _, c := range loginAsUser(t, env, "user@example.com") {
+		req.AddCookie(c)
+	}
+	w := httptest.NewRecorder()
+	env.Router.ServeHTTP(w, req)
+	if w.Code != http.StatusForbidden {
+		t.Errorf("non-admin status = %d, want %d", w.Code, http.StatusForbidden)
+	}
+
+	req = httptest.NewRequest("GET", "/-/admin/backup", nil)
+	for _, c := range loginAsAdmin(t, env) {
+		req.AddCookie(c)
+	}
+	w = httptest.NewRecorder()
+	env.Router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("admin status = %d, want %d", w.Code, http.StatusOK)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "application/gzip" {
+		t.Errorf("Content-Type = %q, want application/gzip", ct)
+	}
+	if cd := w.Header().Get("Content-Disposition"); !strings.Contains(cd, "gopherwiki-backup-") {
+		t.Errorf("Content-Disposition = %q", cd)
+	}
+	if w.Header().Get("ETag") != "" {
+		t.Error("backups are no-store and should not be buffered for an ETag")
+	}
+
+	dir := t.TempDir()
+	if _, err := backup.Restore(w.Body, filepath.Join(dir, "repo"), filepath.Join(dir, "wiki.db")); err != nil {
+		t.Errorf("downloaded backup does not restore: %v", err)
+	}
+}
+
+func TestStaticAssets_Integrity(t *testing.T) {
+	env := testutil.SetupTestEnv(t)
+
+	env.Store.Store(context.Background(), "diagram.md", "# Diagram\n\n```mermaid\ngraph TD; A-->B\n```\n\n```math\nx^2\n```\n", "init", storage.Author{Name: "test", Email: "test@test.com"})
+
+	w := httptest.NewRecorder()
+	env.Router.ServeHTTP(w, httptest.NewRequest("GET", "/diagram", nil))
+	body := w.Body.String()
+	for _, prefix := range []string{"/static/js/mermaid@11.6.0.min.", "/static/mathjax/tex-mml-chtml."} {
+		tag := regexp.MustCompile(`<script src="(` + regexp.QuoteMeta(prefix) + `[0-9a-f]+\.js)" integrity="(sha384-[^"]+)"></script>`).FindStringSubmatch(body)
+		if tag == nil {
+			t.Errorf("no versioned script with an integrity attribute for %s in %q", prefix, body)
+			continue
+		}
+		w := httptest.NewRecorder()
+		env.Router.ServeHTTP(w, httptest.NewRequest("GET", tag[1], nil))
+		sum := sha512.Sum384(w.Body.Bytes())
+		if want := "sha384-" + base64.StdEncoding.EncodeToString(sum[:]); html.UnescapeString(tag[2]) != want {
+			t.Errorf("%s: integrity = %q, want %q", tag[1], tag[2], want)
+		}
+	}
+}
+
+func TestOffline(t *testing.T) {
+	env := testutil.SetupTestEnv(t)
+	env.Server.Config.Offline = true
+	env.Server.Config.Gravatar = true
+	router := env.Server.Routes()
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/-/about", nil))
+	if csp := w.Header().Get("Content-Security-Policy"); strings.Contains(csp, "https:") || !strings.Contains(csp, "img-src 'self' data: blob:;") {
+		t.Errorf("offline Content-Security-Policy = %q, want images from the wiki only", csp)
+	}
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/-/avatar/"+strings.Repeat("ab", 32), nil))
+	if w.Code != http.StatusOK || w.Header().Get("Location") != "" {
+		t.Errorf("offline avatar: status = %d, Location = %q; want the placeholder", w.Code, w.Header().Get("Location"))
+	}
+}
+
+func TestRateLimitBehindProxy(t *testing.T) {
+	env := testutil.SetupTestEnv(t)
+	env.Server.Config.RateLimitSearch = 1
+	env.Server.Config.TrustedProxies = "10.0.0.0/8"
+	router := env.Server.Routes()
+
+	search := func(remote, forwarded string) int {
+		req := httptest.NewRequest("GET", "/-/api/v1/search?q=limited", nil)
+		req.RemoteAddr = remote + ":4000"
+		if forwarded != "" {
+			req.Header.Set("X-Forwarded-For", forwarded)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+	// Clients behind the proxy have an allowance each.
+	for _, client := range []string{"203.0.113.1", "203.0.113.2"} {
+		if code := search("10.0.0.1", client); code != http.StatusOK {
+			t.Errorf("first search of %s: status = %d, want %d", client, code, http.StatusOK)
+		}
+	}
+	if code := search("10.0.0.2", "203.0.113.1"); code != http.StatusTooManyRequests {
+		t.Errorf("second search of 203.0.113.1: status = %d, want %d", code, http.StatusTooManyRequests)
+	}
+	// Addresses left of the client's, which it may make up, are not believed.
+	if code := search("10.0.0.1", "198.51.100.7, 203.0.113.2"); code != http.StatusTooManyRequests {
+		t.Errorf("search with a made-up address: status = %d, want %d", code, http.StatusTooManyRequests)
+	}
+	// Nor is the header of a client that is not a proxy.
+	if code := search("198.51.100.1", "203.0.113.3"); code != http.StatusOK {
+		t.Errorf("first direct search: status = %d, want %d", code, http.StatusOK)
+	}
+	if code := search("198.51.100.1", "203.0.113.4"); code != http.StatusTooManyRequests {
+		t.Errorf("direct search claiming another address: status = %d, want %d", code, http.StatusTooManyRequests)
+	}
+}
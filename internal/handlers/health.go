@@ -0,0 +1,129 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/sa/gopherwiki/internal/storage"
+)
+
+// healthCheckTimeout bounds the whole deep health check, so that a hung disk
+// or locked database fails the probe instead of stalling it.
+const healthCheckTimeout = 5 * time.Second
+
+// ComponentHealth is the result of one deep health check.
+type ComponentHealth struct {
+	Status     string `json:"status"` // "ok" or "error"
+	Error      string `json:"error,omitempty"`
+	DurationMS int64  `json:"duration_ms"`
+}
+
+type healthCheck struct {
+	name string
+	fn   func(context.Context) error
+}
+
+// DeepHealth runs each component check and reports whether all passed.
+func (s *Server) DeepHealth(ctx context.Context) (map[string]ComponentHealth, bool) {
+	ctx, cancel := context.WithTimeout(ctx, healthCheckTimeout)
+	defer cancel()
+
+	checks := []healthCheck{
+		{"git", s.checkGit},
+		{"database", s.checkDatabase},
+		{"search_index", s.checkSearchIndex},
+		{"disk", s.checkDisk},
+	}
+	if s.Users != nil && s.Users != s.DB {
+		checks = append(checks, healthCheck{"users_database", s.checkUsersDatabase})
+	}
+	results := make(map[string]ComponentHealth, len(checks))
+	healthy := true
+	for _, c := range checks {
+		start := time.Now()
+		err := c.fn(ctx)
+		result := ComponentHealth{Status: "ok", DurationMS: time.Since(start).Milliseconds()}
+		if err != nil {
+			result.Status = "error"
+			result.Error = err.Error()
+			healthy = false
+		}
+		results[c.name] = result
+	}
+	return results, healthy
+}
+
+// checkGit verifies that the repository history is readable and that its git
+// directory accepts writes, which fails on a read-only mount or a full disk.
+func (s *Server) checkGit(ctx context.Context) error {
+	if _, err := s.Storage.Log(ctx, "", 1); err != nil && !errors.Is(err, storage.ErrNotFound) {
+		return fmt.Errorf("reading history: %w", err)
+	}
+	if s.Storage.Path() == "" {
+		return nil // Kept in memory
+	}
+	f, err := os.CreateTemp(filepath.Join(s.Storage.Path(), ".git"), "health-*")
+	if err != nil {
+		return fmt.Errorf("repository not writable: %w", err)
+	}
+	f.Close()
+	return os.Remove(f.Name())
+}
+
+func (s *Server) checkDatabase(ctx context.Context) error {
+	return s.DB.Conn().PingContext(ctx)
+}
+
+func (s *Server) checkUsersDatabase(ctx context.Context) error {
+	return s.Users.Conn().PingContext(ctx)
+}
+
+func (s *Server) checkSearchIndex(ctx context.Context) error {
+	_, err := s.DB.PageIndexCount(ctx)
+	return err
+}
+
+// checkDisk fails when the filesystem holding the repository has less free
+// space than HEALTH_MIN_FREE_MB.
+func (s *Server) checkDisk(ctx context.Context) error {
+	if s.Storage.Path() == "" {
+		return nil
+	}
+	free, err := diskFree(s.Storage.Path())
+	if errors.Is(err, errors.ErrUnsupported) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	minFree := uint64(s.Config.HealthMinFreeMB) << 20
+	if free < minFree {
+		return fmt.Errorf("%d MB free, below the %d MB minimum", free>>20, s.Config.HealthMinFreeMB)
+	}
+	return nil
+}
+
+// writeDeepHealth answers /-/health?deep=1 with per-component status, and a
+// 503 when any component is degraded so that readiness probes take the
+// instance out of rotation.
+func (s *Server) writeDeepHealth(w http.ResponseWriter, r *http.Request) {
+	checks, healthy := s.DeepHealth(r.Context())
+	status, code := "ok", http.StatusOK
+	if !healthy {
+		status, code = "degraded", http.StatusServiceUnavailable
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":  status,
+		"version": s.Version,
+		"checks":  checks,
+	})
+}
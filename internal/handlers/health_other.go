@@ -0,0 +1,10 @@
+//go:build !(linux || darwin || freebsd)
+
+package handlers
+
+import "errors"
+
+// diskFree is not implemented on this platform; the disk check is skipped.
+func diskFree(path string) (uint64, error) {
+	return 0, errors.ErrUnsupported
+}
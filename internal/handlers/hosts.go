@@ -0,0 +1,46 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// HostRouter serves each request with the handler of the wiki registered for
+// its host name, for a process hosting several wikis.
+type HostRouter struct {
+	hosts map[string]http.Handler
+}
+
+// NewHostRouter returns a HostRouter without wikis.
+func NewHostRouter() *HostRouter {
+	return &HostRouter{hosts: make(map[string]http.Handler)}
+}
+
+// Handle serves requests for host, a host name without port, with h.
+func (hr *HostRouter) Handle(host string, h http.Handler) {
+	hr.hosts[canonicalHost(host)] = h
+}
+
+func (hr *HostRouter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if h, ok := hr.hosts[canonicalHost(r.Host)]; ok {
+		h.ServeHTTP(w, r)
+		return
+	}
+	// Load balancers probe by address rather than by a wiki's name.
+	if r.URL.Path == "/-/health" {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+		return
+	}
+	http.Error(w, "No wiki is hosted at this address", http.StatusNotFound)
+}
+
+// canonicalHost lowercases host and strips its port and trailing dot.
+func canonicalHost(host string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return strings.TrimSuffix(strings.ToLower(host), ".")
+}
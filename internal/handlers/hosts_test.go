@@ -0,0 +1,44 @@
+package handlers_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/sa/gopherwiki/internal/handlers"
+)
+
+func TestHostRouter(t *testing.T) {
+	named := func(name string) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(name))
+		})
+	}
+	hr := handlers.NewHostRouter()
+	hr.Handle("docs.example.com", named("docs"))
+	hr.Handle("Team.Example.com", named("team"))
+
+	tests := []struct {
+		host, path string
+		wantCode   int
+		wantBody   string
+	}{
+		{"docs.example.com", "/", http.StatusOK, "docs"},
+		{"DOCS.example.com:8080", "/Home", http.StatusOK, "docs"},
+		{"team.example.com.", "/", http.StatusOK, "team"},
+		{"other.example.com", "/", http.StatusNotFound, ""},
+		{"10.0.0.1:8080", "/-/health", http.StatusOK, `{"status":"ok"}` + "\n"},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+		req.Host = tt.host
+		rec := httptest.NewRecorder()
+		hr.ServeHTTP(rec, req)
+		if rec.Code != tt.wantCode {
+			t.Errorf("%s%s: status = %d, want %d", tt.host, tt.path, rec.Code, tt.wantCode)
+		}
+		if tt.wantBody != "" && rec.Body.String() != tt.wantBody {
+			t.Errorf("%s%s: body = %q, want %q", tt.host, tt.path, rec.Body.String(), tt.wantBody)
+		}
+	}
+}
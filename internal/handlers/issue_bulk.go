@@ -0,0 +1,302 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sa/gopherwiki/internal/db"
+	"github.com/sa/gopherwiki/internal/middleware"
+	"github.com/sa/gopherwiki/internal/storage"
+)
+
+// maxBulkIssues caps the issues one bulk change may touch.
+const maxBulkIssues = 500
+
+// issueBulkActions are the bulk changes, with their confirmation wording.
+// Only admins may delete, as with a single issue.
+var issueBulkActions = map[string]string{
+	"close":        "Close",
+	"reopen":       "Reopen",
+	"retag":        "Retag",
+	"recategorize": "Recategorize",
+	"delete":       "Delete",
+}
+
+// issueBulkChange is one change made to several issues together.
+type issueBulkChange struct {
+	Action     string
+	IDs        []int64
+	AddTags    []string // For retag
+	RemoveTags []string // For retag
+	Category   string   // For recategorize; "" removes the category
+}
+
+// issueBulkChangeFromForm reads a change from the issue list's selection
+// form: repeated id fields, action, add_tags, remove_tags and category.
+func issueBulkChangeFromForm(form url.Values) (issueBulkChange, error) {
+	c := issueBulkChange{
+		Action:     form.Get("action"),
+		AddTags:    parseTags(form.Get("add_tags")),
+		RemoveTags: parseTags(form.Get("remove_tags")),
+		Category:   strings.TrimSpace(form.Get("category")),
+	}
+	for _, v := range form["id"] {
+		id, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return c, fmt.Errorf("invalid issue ID %q", v)
+		}
+		c.IDs = append(c.IDs, id)
+	}
+	return c, c.validate()
+}
+
+// validate checks the action and the selection, dropping repeated IDs.
+func (c *issueBulkChange) validate() error {
+	if _, ok := issueBulkActions[c.Action]; !ok {
+		return fmt.Errorf("unknown action %q", c.Action)
+	}
+	slices.Sort(c.IDs)
+	c.IDs = slices.Compact(c.IDs)
+	if len(c.IDs) == 0 {
+		return errors.New("no issues selected")
+	}
+	if len(c.IDs) > maxBulkIssues {
+		return fmt.Errorf("at most %d issues can be changed at once", maxBulkIssues)
+	}
+	if c.Action == "retag" && len(c.AddTags) == 0 && len(c.RemoveTags) == 0 {
+		return errors.New("no tags to add or remove")
+	}
+	return nil
+}
+
+// summary describes the change for the confirmation step and the audit
+// log, e.g. "Retag 2 issues: +bug -triage".
+func (c issueBulkChange) summary() string {
+	s := fmt.Sprintf("%s %d issue", issueBulkActions[c.Action], len(c.IDs))
+	if len(c.IDs) != 1 {
+		s += "s"
+	}
+	switch c.Action {
+	case "retag":
+		var tags []string
+		for _, t := range c.AddTags {
+			tags = append(tags, "+"+t)
+		}
+		for _, t := range c.RemoveTags {
+			tags = append(tags, "-"+t)
+		}
+		s += ": " + strings.Join(tags, " ")
+	case "recategorize":
+		if c.Category == "" {
+			s += ": no category"
+		} else {
+			s += ": " + c.Category
+		}
+	}
+	return s
+}
+
+// change returns issue's update under c.
+func (c issueBulkChange) change(issue db.Issue, now time.Time) db.UpdateIssueParams {
+	params := db.UpdateIssueParams{
+		Title:       issue.Title,
+		Description: issue.Description,
+		Status:      issue.Status,
+		Category:    issue.Category,
+		Tags:        issue.Tags,
+		UpdatedAt:   db.NullTime(now),
+		ID:          issue.ID,
+	}
+	switch c.Action {
+	case "close":
+		params.Status = "closed"
+	case "reopen":
+		params.Status = "open"
+	case "recategorize":
+		params.Category = db.NullString(c.Category)
+	case "retag":
+		var tags []string
+		for _, t := range parseTags(issue.Tags.String) {
+			if !slices.Contains(c.RemoveTags, t) {
+				tags = append(tags, t)
+			}
+		}
+		for _, t := range c.AddTags {
+			if !slices.Contains(tags, t) {
+				tags = append(tags, t)
+			}
+		}
+		params.Tags = db.NullString(strings.Join(tags, ","))
+	}
+	return params
+}
+
+// bulkIssues loads the issues a change selects. It fails with an error
+// wrapping sql.ErrNoRows when one does not exist.
+func (s *Server) bulkIssues(ctx context.Context, q *db.Queries, c issueBulkChange) ([]db.Issue, error) {
+	issues := make([]db.Issue, 0, len(c.IDs))
+	for _, id := range c.IDs {
+		issue, err := q.GetIssue(ctx, id)
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("issue #%d not found: %w", id, err)
+		} else if err != nil {
+			return nil, err
+		}
+		issues = append(issues, issue)
+	}
+	return issues, nil
+}
+
+// applyIssueBulkChange makes c in one transaction, with an audit log entry
+// naming actor, so that either every selected issue changes or none does.
+// It returns the changed issues as they were before.
+func (s *Server) applyIssueBulkChange(ctx context.Context, c issueBulkChange, actor storage.Author) ([]db.Issue, error) {
+	tx, err := s.DB.BeginTx(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	q := s.DB.WithTx(tx)
+
+	issues, err := s.bulkIssues(ctx, q, c)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	refs := make([]string, 0, len(issues))
+	for _, issue := range issues {
+		if c.Action == "delete" {
+			err = q.DeleteIssue(ctx, issue.ID)
+		} else {
+			err = q.UpdateIssue(ctx, c.change(issue, now))
+		}
+		if err != nil {
+			return nil, fmt.Errorf("issue #%d: %w", issue.ID, err)
+		}
+		refs = append(refs, fmt.Sprintf("#%d", issue.ID))
+	}
+
+	entry := db.AuditEntry{
+		Action:     "issues." + c.Action,
+		Detail:     c.summary() + " (" + strings.Join(refs, ", ") + ")",
+		ActorName:  actor.Name,
+		ActorEmail: actor.Email,
+		CreatedAt:  now,
+	}
+	if err := s.DB.AddAuditEntry(ctx, tx, entry); err != nil {
+		return nil, err
+	}
+	return issues, tx.Commit()
+}
+
+// handleIssueBulk handles the issue list's selection form. The first post
+// shows the selected issues for confirmation; the confirmed one makes the
+// change.
+func (s *Server) handleIssueBulk(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		s.renderError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+	back := "/-/issues"
+	if q, err := url.ParseQuery(r.PostForm.Get("back")); err == nil {
+		if query := issueFilterFromQuery(q).query(); query != "" {
+			back += "?" + query
+		}
+	}
+
+	c, err := issueBulkChangeFromForm(r.PostForm)
+	if err != nil {
+		s.SessionManager.AddFlashMessage(w, r, "danger", "Bulk change failed: "+err.Error())
+		http.Redirect(w, r, back, http.StatusFound)
+		return
+	}
+	if c.Action == "delete" && !s.requireAdmin(w, r) {
+		return
+	}
+
+	ctx := r.Context()
+	if r.PostForm.Get("confirm") == "" {
+		issues, err := s.bulkIssues(ctx, s.DB.Queries, c)
+		if err != nil {
+			s.SessionManager.AddFlashMessage(w, r, "danger", "Bulk change failed: "+err.Error())
+			http.Redirect(w, r, back, http.StatusFound)
+			return
+		}
+		data := NewGenericData("Confirm Bulk Change")
+		data["change"] = c
+		data["summary"] = c.summary()
+		data["selected"] = issues
+		data["back"] = r.PostForm.Get("back")
+		data["addTags"] = strings.Join(c.AddTags, ", ")
+		data["removeTags"] = strings.Join(c.RemoveTags, ", ")
+		s.renderTemplate(w, r, "issues_bulk.html", data)
+		return
+	}
+
+	if _, err := s.applyIssueBulkChange(ctx, c, s.getAuthor(r)); err != nil {
+		s.SessionManager.AddFlashMessage(w, r, "danger", "Bulk change failed, no issue was changed: "+err.Error())
+	} else {
+		s.SessionManager.AddFlashMessage(w, r, "success", c.summary()+": done")
+	}
+	http.Redirect(w, r, back, http.StatusFound)
+}
+
+// handleAPIIssueBulk handles POST /api/v1/issues/bulk -- change many issues
+// at once. Unless the request confirms, nothing is changed and the issues
+// that would be are returned.
+func (s *Server) handleAPIIssueBulk(w http.ResponseWriter, r *http.Request) {
+	var input APIIssueBulkInput
+	if err := decodeJSON(r, &input); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "invalid JSON body")
+		return
+	}
+	c := issueBulkChange{
+		Action:     input.Action,
+		IDs:        input.IDs,
+		AddTags:    trimTags(input.AddTags),
+		RemoveTags: trimTags(input.RemoveTags),
+		Category:   strings.TrimSpace(input.Category),
+	}
+	if err := c.validate(); err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if c.Action == "delete" && !middleware.GetUser(r).Admin() {
+		writeJSONError(w, http.StatusForbidden, "only admins can delete issues")
+		return
+	}
+
+	ctx := r.Context()
+	var issues []db.Issue
+	var err error
+	if input.Confirm {
+		issues, err = s.applyIssueBulkChange(ctx, c, s.getAuthor(r))
+	} else {
+		issues, err = s.bulkIssues(ctx, s.DB.Queries, c)
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		writeJSONError(w, http.StatusNotFound, err.Error())
+		return
+	} else if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, "failed to change issues")
+		return
+	}
+	writeJSON(w, http.StatusOK, APIIssueBulkResult{
+		Action:    c.Action,
+		Confirmed: input.Confirm,
+		Issues:    issuesToAPI(issues),
+	})
+}
+
+// trimTags trims tags, dropping empty ones.
+func trimTags(tags []string) []string {
+	return parseTags(strings.Join(tags, ","))
+}
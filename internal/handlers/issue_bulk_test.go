@@ -0,0 +1,110 @@
+package handlers_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/sa/gopherwiki/internal/handlers"
+	"github.com/sa/gopherwiki/internal/testutil"
+)
+
+func TestIssueBulk(t *testing.T) {
+	env := testutil.SetupTestEnv(t)
+	ctx := context.Background()
+	a := createAPITestIssue(t, env, "First", "", "open", "", []string{"bug", "triage"})
+	b := createAPITestIssue(t, env, "Second", "", "open", "", []string{"triage"})
+	c := createAPITestIssue(t, env, "Third", "", "open", "", nil)
+
+	post := func(form url.Values, cookies []*http.Cookie) *httptest.ResponseRecorder {
+		req := requestWithCookies("POST", "/-/issues/bulk", strings.NewReader(form.Encode()), cookies)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		env.Router.ServeHTTP(w, req)
+		return w
+	}
+	ids := []string{fmt.Sprint(a), fmt.Sprint(b)}
+
+	// The list offers the selection, and the first post only asks to confirm.
+	w := httptest.NewRecorder()
+	env.Router.ServeHTTP(w, requestWithCookies("GET", "/-/issues", nil, nil))
+	if body := w.Body.String(); !strings.Contains(body, `form="issue-bulk-form"`) || strings.Contains(body, `value="delete"`) {
+		t.Errorf("issue list lacks the selection, or offers deleting to a non-admin")
+	}
+	form := url.Values{"action": {"retag"}, "id": ids, "add_tags": {"ui"}, "remove_tags": {"triage"}, "back": {"status=open"}}
+	w = post(form, nil)
+	if body := w.Body.String(); w.Code != http.StatusOK || !strings.Contains(body, "Retag 2 issues: &#43;ui -triage?") || !strings.Contains(body, `name="confirm"`) {
+		t.Fatalf("confirmation: status = %d; body:\n%s", w.Code, body)
+	}
+	if issue, _ := env.DB.Queries.GetIssue(ctx, a); issue.Tags.String != "bug,triage" {
+		t.Errorf("tags changed before confirming: %q", issue.Tags.String)
+	}
+
+	form.Set("confirm", "1")
+	if w := post(form, nil); w.Code != http.StatusFound || w.Header().Get("Location") != "/-/issues?status=open" {
+		t.Fatalf("confirmed retag: status = %d, Location = %q", w.Code, w.Header().Get("Location"))
+	}
+	for id, want := range map[int64]string{a: "bug,ui", b: "ui", c: ""} {
+		if issue, _ := env.DB.Queries.GetIssue(ctx, id); issue.Tags.String != want {
+			t.Errorf("issue #%d tags = %q, want %q", id, issue.Tags.String, want)
+		}
+	}
+
+	// A missing issue fails the whole change.
+	body := fmt.Sprintf(`{"action": "close", "ids": [%d, 999], "confirm": true}`, a)
+	if w := apiRequest(t, env, "POST", "/-/api/v1/issues/bulk", body, nil); w.Code != http.StatusNotFound {
+		t.Errorf("bulk close with a missing issue: status = %d, want %d", w.Code, http.StatusNotFound)
+	}
+	if issue, _ := env.DB.Queries.GetIssue(ctx, a); issue.Status != "open" {
+		t.Errorf("issue closed by a failed bulk change")
+	}
+
+	// Without confirm, the API only previews.
+	body = fmt.Sprintf(`{"action": "close", "ids": [%d, %d]}`, a, c)
+	w = apiRequest(t, env, "POST", "/-/api/v1/issues/bulk", body, nil)
+	var resp struct {
+		Data handlers.APIIssueBulkResult `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || resp.Data.Confirmed || len(resp.Data.Issues) != 2 {
+		t.Fatalf("preview = %+v, %v; body: %s", resp.Data, err, w.Body.String())
+	}
+	if issue, _ := env.DB.Queries.GetIssue(ctx, c); issue.Status != "open" {
+		t.Errorf("issue closed by a preview")
+	}
+	body = fmt.Sprintf(`{"action": "close", "ids": [%d, %d], "confirm": true}`, a, c)
+	if w := apiRequest(t, env, "POST", "/-/api/v1/issues/bulk", body, nil); w.Code != http.StatusOK {
+		t.Fatalf("bulk close: status = %d, body = %s", w.Code, w.Body.String())
+	}
+	if n, _ := env.DB.Queries.CountIssuesByStatus(ctx, "closed"); n != 2 {
+		t.Errorf("closed issues = %d, want 2", n)
+	}
+
+	// Deleting is for admins.
+	body = fmt.Sprintf(`{"action": "delete", "ids": [%d], "confirm": true}`, b)
+	if w := apiRequest(t, env, "POST", "/-/api/v1/issues/bulk", body, nil); w.Code != http.StatusForbidden {
+		t.Errorf("anonymous bulk delete: status = %d, want %d", w.Code, http.StatusForbidden)
+	}
+	admin := loginAsAdmin(t, env)
+	if w := post(url.Values{"action": {"delete"}, "id": {fmt.Sprint(b)}, "confirm": {"1"}}, admin); w.Code != http.StatusFound {
+		t.Fatalf("admin bulk delete: status = %d", w.Code)
+	}
+	if _, err := env.DB.Queries.GetIssue(ctx, b); err == nil {
+		t.Errorf("issue #%d not deleted", b)
+	}
+
+	// Each change is in the audit log, with who made it.
+	entries, err := env.DB.ListAuditEntries(ctx, 10)
+	if err != nil || len(entries) != 3 || entries[0].Action != "issues.delete" || entries[2].Detail != fmt.Sprintf("Retag 2 issues: +ui -triage (#%d, #%d)", a, b) {
+		t.Fatalf("audit log = %+v, %v", entries, err)
+	}
+	w = httptest.NewRecorder()
+	env.Router.ServeHTTP(w, requestWithCookies("GET", "/-/admin/audit", nil, admin))
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "issues.close") {
+		t.Errorf("audit log page: status = %d", w.Code)
+	}
+}
@@ -0,0 +1,234 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"html/template"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/sa/gopherwiki/internal/db"
+	"github.com/sa/gopherwiki/internal/middleware"
+)
+
+// canEditComment reports whether the user of r may edit comment c: its
+// author, known by their email address, or an admin. Anonymous comments can
+// only be edited by admins.
+func (s *Server) canEditComment(r *http.Request, c db.IssueComment) bool {
+	user := middleware.GetUser(r)
+	if user.Admin() {
+		return true
+	}
+	return user.IsAuthenticated() && c.AuthorEmail.String != "" && strings.EqualFold(c.AuthorEmail.String, user.GetEmail())
+}
+
+// issueComment returns the comment with commentID on the issue with
+// issueID, or sql.ErrNoRows.
+func (s *Server) issueComment(ctx context.Context, issueID, commentID int64) (db.IssueComment, error) {
+	c, err := s.DB.Queries.GetIssueComment(ctx, commentID)
+	if err == nil && c.IssueID != issueID {
+		return db.IssueComment{}, sql.ErrNoRows
+	}
+	return c, err
+}
+
+// commentFromRequest loads the comment the id and commentId parameters of
+// r name, rendering an error page if it cannot.
+func (s *Server) commentFromRequest(w http.ResponseWriter, r *http.Request) (db.IssueComment, bool) {
+	id, err := parseInt64(chi.URLParam(r, "id"))
+	if err != nil {
+		s.renderError(w, r, http.StatusBadRequest, "Invalid issue ID")
+		return db.IssueComment{}, false
+	}
+	commentID, err := parseInt64(chi.URLParam(r, "commentId"))
+	if err != nil {
+		s.renderError(w, r, http.StatusBadRequest, "Invalid comment ID")
+		return db.IssueComment{}, false
+	}
+	c, err := s.issueComment(r.Context(), id, commentID)
+	if errors.Is(err, sql.ErrNoRows) {
+		s.renderError(w, r, http.StatusNotFound, "Comment not found")
+		return db.IssueComment{}, false
+	} else if err != nil {
+		s.renderError(w, r, http.StatusInternalServerError, "Failed to get comment")
+		return db.IssueComment{}, false
+	}
+	return c, true
+}
+
+// editComment replaces the content of comment c as the user of r, keeping
+// the earlier content as a revision. An unchanged content is not saved.
+func (s *Server) editComment(r *http.Request, c db.IssueComment, content string) (db.IssueComment, error) {
+	if content == c.Content {
+		return c, nil
+	}
+	editor := s.getAuthor(r)
+	return s.DB.EditIssueComment(r.Context(), c.ID, content, editor.Name, editor.Email, time.Now())
+}
+
+// handleIssueCommentEdit shows the form editing a comment.
+func (s *Server) handleIssueCommentEdit(w http.ResponseWriter, r *http.Request) {
+	c, ok := s.commentFromRequest(w, r)
+	if !ok {
+		return
+	}
+	if !s.canEditComment(r, c) {
+		s.renderError(w, r, http.StatusForbidden, "Only the author of a comment and admins can edit it")
+		return
+	}
+
+	data := NewGenericData(fmt.Sprintf("Edit Comment on #%d", c.IssueID))
+	data["comment"] = c
+	s.renderTemplate(w, r, "issues_comment_edit.html", data)
+}
+
+// handleIssueCommentUpdate saves an edited comment.
+func (s *Server) handleIssueCommentUpdate(w http.ResponseWriter, r *http.Request) {
+	c, ok := s.commentFromRequest(w, r)
+	if !ok {
+		return
+	}
+	if !s.canEditComment(r, c) {
+		s.renderError(w, r, http.StatusForbidden, "Only the author of a comment and admins can edit it")
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		s.renderError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	target := fmt.Sprintf("/-/issues/%d#comment-%d", c.IssueID, c.ID)
+	content := strings.TrimSpace(r.PostForm.Get("content"))
+	if content == "" {
+		s.SessionManager.AddFlashMessage(w, r, "danger", "Comment cannot be empty")
+		http.Redirect(w, r, fmt.Sprintf("/-/issues/%d/comment/%d/edit", c.IssueID, c.ID), http.StatusFound)
+		return
+	}
+	if _, err := s.editComment(r, c, content); err != nil {
+		s.SessionManager.AddFlashMessage(w, r, "danger", "Failed to save comment")
+	} else {
+		s.SessionManager.AddFlashMessage(w, r, "success", "Comment updated")
+	}
+	http.Redirect(w, r, target, http.StatusFound)
+}
+
+// commentRevisionView is an earlier version of a comment, rendered.
+type commentRevisionView struct {
+	Revision    db.IssueCommentRevision
+	HTMLContent template.HTML
+}
+
+// handleIssueCommentHistory shows the earlier versions of a comment.
+func (s *Server) handleIssueCommentHistory(w http.ResponseWriter, r *http.Request) {
+	c, ok := s.commentFromRequest(w, r)
+	if !ok {
+		return
+	}
+	revisions, err := s.DB.ListIssueCommentRevisions(r.Context(), c.ID)
+	if err != nil {
+		s.renderError(w, r, http.StatusInternalServerError, "Failed to load the comment's history")
+		return
+	}
+
+	views := make([]commentRevisionView, 0, len(revisions))
+	for _, rev := range revisions {
+		html, _, _ := s.Renderer.Render(rev.Content, "")
+		views = append(views, commentRevisionView{Revision: rev, HTMLContent: template.HTML(html)})
+	}
+	html, _, _ := s.Renderer.Render(c.Content, "")
+
+	data := NewGenericData(fmt.Sprintf("Comment History on #%d", c.IssueID))
+	data["comment"] = c
+	data["htmlcontent"] = template.HTML(html)
+	data["revisions"] = views
+	s.renderTemplate(w, r, "issues_comment_history.html", data)
+}
+
+// apiCommentFromRequest loads the comment the id and commentId parameters
+// of r name, writing a JSON error if it cannot.
+func (s *Server) apiCommentFromRequest(w http.ResponseWriter, r *http.Request) (db.IssueComment, bool) {
+	id, err := parseInt64(chi.URLParam(r, "id"))
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, "invalid issue ID")
+		return db.IssueComment{}, false
+	}
+	commentID, err := parseInt64(chi.URLParam(r, "commentId"))
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, "invalid comment ID")
+		return db.IssueComment{}, false
+	}
+	c, err := s.issueComment(r.Context(), id, commentID)
+	if errors.Is(err, sql.ErrNoRows) {
+		writeJSONError(w, http.StatusNotFound, "comment not found")
+		return db.IssueComment{}, false
+	} else if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, "failed to get comment")
+		return db.IssueComment{}, false
+	}
+	return c, true
+}
+
+// handleAPIIssueCommentUpdate handles PUT /api/v1/issues/{id}/comments/{commentId}
+// -- edit a comment, as its author or an admin.
+func (s *Server) handleAPIIssueCommentUpdate(w http.ResponseWriter, r *http.Request) {
+	c, ok := s.apiCommentFromRequest(w, r)
+	if !ok {
+		return
+	}
+	if !s.canEditComment(r, c) {
+		writeJSONError(w, http.StatusForbidden, "only the author of a comment and admins can edit it")
+		return
+	}
+	var input APIIssueCommentInput
+	if err := decodeJSON(r, &input); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "invalid JSON body")
+		return
+	}
+	content := strings.TrimSpace(input.Content)
+	if content == "" {
+		writeJSONError(w, http.StatusBadRequest, "content is required")
+		return
+	}
+
+	edited, err := s.editComment(r, c, content)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, "failed to update comment")
+		return
+	}
+	result := issueCommentToAPI(&edited)
+	if revisions, err := s.DB.ListIssueCommentRevisions(r.Context(), c.ID); err == nil {
+		result.Edited = len(revisions) > 0
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+// handleAPIIssueCommentRevisions handles GET
+// /api/v1/issues/{id}/comments/{commentId}/revisions -- list the earlier
+// versions of a comment, newest first.
+func (s *Server) handleAPIIssueCommentRevisions(w http.ResponseWriter, r *http.Request) {
+	c, ok := s.apiCommentFromRequest(w, r)
+	if !ok {
+		return
+	}
+	revisions, err := s.DB.ListIssueCommentRevisions(r.Context(), c.ID)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, "failed to list revisions")
+		return
+	}
+	result := make([]APIIssueCommentRevision, 0, len(revisions))
+	for _, rev := range revisions {
+		result = append(result, APIIssueCommentRevision{
+			ID:            rev.ID,
+			Content:       rev.Content,
+			EditedByName:  rev.EditedByName,
+			EditedByEmail: rev.EditedByEmail,
+			EditedAt:      rev.CreatedAt.Format(time.RFC3339),
+		})
+	}
+	writeJSON(w, http.StatusOK, result)
+}
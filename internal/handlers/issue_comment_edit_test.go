@@ -0,0 +1,95 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/sa/gopherwiki/internal/handlers"
+	"github.com/sa/gopherwiki/internal/testutil"
+)
+
+func TestIssueCommentEdit(t *testing.T) {
+	env := testutil.SetupTestEnv(t)
+	id := createAPITestIssue(t, env, "Issue", "", "open", "", nil)
+	comment := createTestComment(t, env, id, "Frist draft", "Bob", "bob@example.com")
+	bob := loginAsUser(t, env, "bob@example.com")
+	commentURL := fmt.Sprintf("/-/issues/%d/comment/%d", id, comment.ID)
+
+	get := func(path string, cookies []*http.Cookie) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		env.Router.ServeHTTP(w, requestWithCookies("GET", path, nil, cookies))
+		return w
+	}
+	post := func(path string, form url.Values, cookies []*http.Cookie) *httptest.ResponseRecorder {
+		req := requestWithCookies("POST", path, strings.NewReader(form.Encode()), cookies)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		env.Router.ServeHTTP(w, req)
+		return w
+	}
+
+	// Only the author and admins may edit.
+	if w := get(commentURL+"/edit", nil); w.Code != http.StatusForbidden {
+		t.Errorf("anonymous edit form: status = %d, want %d", w.Code, http.StatusForbidden)
+	}
+	carol := loginAsUser(t, env, "carol@example.com")
+	if w := post(commentURL+"/edit", url.Values{"content": {"Hijacked"}}, carol); w.Code != http.StatusForbidden {
+		t.Errorf("edit by another user: status = %d, want %d", w.Code, http.StatusForbidden)
+	}
+	if w := get(commentURL+"/edit", bob); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "Frist draft") {
+		t.Errorf("author's edit form: status = %d", w.Code)
+	}
+	if w := post(commentURL+"/edit", url.Values{"content": {"First draft"}}, bob); w.Code != http.StatusFound {
+		t.Fatalf("edit by the author: status = %d", w.Code)
+	}
+
+	w := get(fmt.Sprintf("/-/issues/%d", id), bob)
+	if body := w.Body.String(); !strings.Contains(body, "First draft") || !strings.Contains(body, `href="`+commentURL+`/history"`) {
+		t.Errorf("issue page lacks the edited comment or its edited marker")
+	}
+	if body := get(commentURL+"/history", nil).Body.String(); !strings.Contains(body, "Frist draft") || !strings.Contains(body, "First draft") {
+		t.Errorf("history page lacks a version; body:\n%s", body)
+	}
+
+	// The API edits the same way.
+	apiURL := fmt.Sprintf("/-/api/v1/issues/%d/comments/%d", id, comment.ID)
+	if w := apiRequest(t, env, "PUT", apiURL, `{"content": "Hijacked"}`, carol); w.Code != http.StatusForbidden {
+		t.Errorf("API edit by another user: status = %d, want %d", w.Code, http.StatusForbidden)
+	}
+	if w := apiRequest(t, env, "PUT", apiURL, `{"content": " "}`, bob); w.Code != http.StatusBadRequest {
+		t.Errorf("API edit to nothing: status = %d, want %d", w.Code, http.StatusBadRequest)
+	}
+	admin := loginAsAdmin(t, env)
+	w = apiRequest(t, env, "PUT", apiURL, `{"content": "Final draft"}`, admin)
+	var edited struct {
+		Data handlers.APIIssueComment `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &edited); err != nil || w.Code != http.StatusOK || edited.Data.Content != "Final draft" || !edited.Data.Edited {
+		t.Fatalf("API edit by an admin: status = %d, comment = %+v, %v", w.Code, edited.Data, err)
+	}
+	if w := apiRequest(t, env, "PUT", fmt.Sprintf("/-/api/v1/issues/%d/comments/%d", id+1, comment.ID), `{"content": "X"}`, admin); w.Code != http.StatusNotFound {
+		t.Errorf("API edit under another issue: status = %d, want %d", w.Code, http.StatusNotFound)
+	}
+
+	w = apiRequest(t, env, "GET", apiURL+"/revisions", "", nil)
+	var revisions struct {
+		Data []handlers.APIIssueCommentRevision `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &revisions); err != nil || len(revisions.Data) != 2 ||
+		revisions.Data[0].Content != "First draft" || revisions.Data[0].EditedByEmail != "admin@example.com" || revisions.Data[1].Content != "Frist draft" {
+		t.Errorf("revisions = %+v, %v", revisions.Data, err)
+	}
+
+	w = apiRequest(t, env, "GET", fmt.Sprintf("/-/api/v1/issues/%d/comments", id), "", nil)
+	var comments struct {
+		Data []handlers.APIIssueComment `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &comments); err != nil || len(comments.Data) != 1 || !comments.Data[0].Edited {
+		t.Errorf("comments = %+v, %v; want the comment marked edited", comments.Data, err)
+	}
+}
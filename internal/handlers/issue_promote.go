@@ -0,0 +1,181 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/sa/gopherwiki/internal/db"
+	"github.com/sa/gopherwiki/internal/spam"
+	"github.com/sa/gopherwiki/internal/wiki"
+)
+
+// errPromoteTargetExists is returned when promoting an issue to a page
+// that already exists.
+var errPromoteTargetExists = errors.New("page already exists")
+
+// maxIssueQuote caps the page selection quoted in a new issue filed from a
+// page.
+const maxIssueQuote = 2000
+
+// issuePageContent returns the page an issue is promoted to: its title and
+// description, its comments as sections, and a link back to it.
+func issuePageContent(issue db.Issue, comments []db.IssueComment) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# %s\n\n", issue.Title)
+	if desc := strings.TrimSpace(issue.Description.String); desc != "" {
+		b.WriteString(desc + "\n\n")
+	}
+	if len(comments) > 0 {
+		b.WriteString("## Discussion\n\n")
+		for _, c := range comments {
+			author := c.AuthorName.String
+			if author == "" {
+				author = "Anonymous"
+			}
+			fmt.Fprintf(&b, "### %s, %s\n\n%s\n\n", author, c.CreatedAt.Time.Format("2006-01-02"), strings.TrimSpace(c.Content))
+		}
+	}
+	fmt.Fprintf(&b, "---\n\n*Promoted from [issue #%d](/-/issues/%d).*\n", issue.ID, issue.ID)
+	return b.String()
+}
+
+// promoteIssue creates the page pagepath from the issue with id, and
+// comments on the issue with a link to it. The page may be held for
+// moderation instead, as any page save, reporting held; the issue is then
+// left as it is. It fails with errPromoteTargetExists for an existing page
+// and sql.ErrNoRows for a missing issue.
+func (s *Server) promoteIssue(r *http.Request, id int64, pagepath string) (page *wiki.Page, held bool, err error) {
+	ctx := r.Context()
+	issue, err := s.DB.Queries.GetIssue(ctx, id)
+	if err != nil {
+		return nil, false, err
+	}
+	comments, err := s.DB.Queries.ListIssueComments(ctx, id)
+	if err != nil {
+		return nil, false, err
+	}
+	if strings.TrimSpace(pagepath) == "" {
+		pagepath = issue.Title
+	}
+	page, err = wiki.NewPage(ctx, s.Storage, s.Config, pagepath, "")
+	if err != nil {
+		return nil, false, err
+	}
+	if page.Exists {
+		return page, false, errPromoteTargetExists
+	}
+
+	content := issuePageContent(issue, comments)
+	message := fmt.Sprintf("Promoted issue #%d to %s", issue.ID, page.Pagename)
+	sub := spam.Submission{Kind: spam.KindPage, Target: page.Pagepath, Content: content}
+	if _, held, err := s.holdForModeration(r, sub, moderationPayload{Message: message}); err != nil || held {
+		return page, held, err
+	}
+	author := s.getAuthor(r)
+	if _, err := s.Wiki.SavePage(ctx, page.Pagepath, content, message, "", author); err != nil {
+		return page, false, err
+	}
+
+	now := time.Now()
+	_, err = s.DB.Queries.CreateIssueComment(ctx, db.CreateIssueCommentParams{
+		IssueID:     issue.ID,
+		Content:     fmt.Sprintf("Promoted to the wiki page [[%s]].", page.Pagepath),
+		AuthorName:  db.NullString(author.Name),
+		AuthorEmail: db.NullString(author.Email),
+		CreatedAt:   db.NullTime(now),
+		UpdatedAt:   db.NullTime(now),
+	})
+	return page, false, err
+}
+
+// handleIssuePromote creates a wiki page from an issue, at the form's
+// pagepath or else named after the issue's title.
+func (s *Server) handleIssuePromote(w http.ResponseWriter, r *http.Request) {
+	id, err := parseInt64(chi.URLParam(r, "id"))
+	if err != nil {
+		s.renderError(w, r, http.StatusBadRequest, "Invalid issue ID")
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		s.renderError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	issueURL := fmt.Sprintf("/-/issues/%d", id)
+	page, held, err := s.promoteIssue(r, id, r.PostForm.Get("pagepath"))
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		s.renderError(w, r, http.StatusNotFound, "Issue not found")
+	case errors.Is(err, errPromoteTargetExists):
+		s.SessionManager.AddFlashMessage(w, r, "danger", fmt.Sprintf("The page %s already exists", page.Pagepath))
+		http.Redirect(w, r, issueURL, http.StatusFound)
+	case errors.Is(err, wiki.ErrSaveRejected):
+		s.SessionManager.AddFlashMessage(w, r, "danger", err.Error())
+		http.Redirect(w, r, issueURL, http.StatusFound)
+	case err != nil:
+		s.renderFailure(w, r, err)
+	case held:
+		s.SessionManager.AddFlashMessage(w, r, "info", "The page is awaiting review before it is published")
+		http.Redirect(w, r, issueURL, http.StatusFound)
+	default:
+		s.SessionManager.AddFlashMessage(w, r, "success", "Issue promoted to a wiki page")
+		http.Redirect(w, r, "/"+page.Pagepath, http.StatusFound)
+	}
+}
+
+// handleAPIIssuePromote handles POST /api/v1/issues/{id}/promote -- create
+// a wiki page from an issue.
+func (s *Server) handleAPIIssuePromote(w http.ResponseWriter, r *http.Request) {
+	id, err := parseInt64(chi.URLParam(r, "id"))
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, "invalid issue ID")
+		return
+	}
+	var input APIIssuePromoteInput
+	if err := decodeJSON(r, &input); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "invalid JSON body")
+		return
+	}
+
+	page, held, err := s.promoteIssue(r, id, input.Path)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		writeJSONError(w, http.StatusNotFound, "issue not found")
+	case errors.Is(err, errPromoteTargetExists):
+		writeJSONError(w, http.StatusConflict, "page already exists")
+	case errors.Is(err, wiki.ErrSaveRejected):
+		writeJSONError(w, http.StatusUnprocessableEntity, err.Error())
+	case err != nil:
+		writeJSONError(w, http.StatusInternalServerError, "failed to promote issue")
+	case held:
+		writeJSON(w, http.StatusAccepted, APIModerationHeld{Status: "awaiting moderation"})
+	default:
+		saved, err := wiki.NewPage(r.Context(), s.Storage, s.Config, page.Pagepath, "")
+		if err != nil {
+			writeJSONError(w, http.StatusInternalServerError, "page saved but failed to reload")
+			return
+		}
+		writeJSON(w, http.StatusCreated, pageToAPI(saved))
+	}
+}
+
+// issueFromPage returns the title and description a new issue filed from
+// a page starts with, quoting the selection quote.
+func issueFromPage(page *wiki.Page, quote string) (string, string) {
+	title := page.Pagename
+	description := fmt.Sprintf("From [[%s]]", page.Pagepath)
+	quote = strings.TrimSpace(strings.ReplaceAll(quote, "\r\n", "\n"))
+	if len(quote) > maxIssueQuote {
+		quote = strings.ToValidUTF8(quote[:maxIssueQuote], "") + "…"
+	}
+	if quote == "" {
+		return title, description + "\n"
+	}
+	return title, description + ":\n\n> " + strings.ReplaceAll(quote, "\n", "\n> ") + "\n"
+}
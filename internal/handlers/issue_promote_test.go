@@ -0,0 +1,70 @@
+package handlers_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/sa/gopherwiki/internal/storage"
+	"github.com/sa/gopherwiki/internal/testutil"
+)
+
+func TestIssuePromote(t *testing.T) {
+	env := testutil.SetupTestEnv(t)
+	ctx := context.Background()
+	id := createAPITestIssue(t, env, "Backup procedure", "Run the backup **nightly**.", "open", "", nil)
+	createTestComment(t, env, id, "Keep a week of backups.", "Bob", "bob@example.com")
+
+	post := func(path string, form url.Values) *httptest.ResponseRecorder {
+		req := requestWithCookies("POST", path, strings.NewReader(form.Encode()), nil)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		env.Router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := post(fmt.Sprintf("/-/issues/%d/promote", id), url.Values{"pagepath": {"Ops/Backups"}})
+	if w.Code != http.StatusFound || w.Header().Get("Location") != "/Ops/Backups" {
+		t.Fatalf("promote: status = %d, Location = %q", w.Code, w.Header().Get("Location"))
+	}
+	content, err := env.Store.Load(ctx, "ops/backups.md", "")
+	if err != nil {
+		t.Fatalf("promoted page not saved: %v", err)
+	}
+	for _, want := range []string{"# Backup procedure", "Run the backup **nightly**.", "## Discussion", "### Bob, ", "Keep a week of backups.", fmt.Sprintf("[issue #%d](/-/issues/%d)", id, id)} {
+		if !strings.Contains(content, want) {
+			t.Errorf("promoted page lacks %q:\n%s", want, content)
+		}
+	}
+	comments, _ := env.DB.Queries.ListIssueComments(ctx, id)
+	if len(comments) != 2 || comments[1].Content != "Promoted to the wiki page [[Ops/Backups]]." {
+		t.Errorf("issue comments = %+v, want a link to the page", comments)
+	}
+
+	// An existing page is not overwritten.
+	if w := apiRequest(t, env, "POST", fmt.Sprintf("/-/api/v1/issues/%d/promote", id), `{"path": "Ops/Backups"}`, nil); w.Code != http.StatusConflict {
+		t.Errorf("promote to an existing page: status = %d, want %d", w.Code, http.StatusConflict)
+	}
+	if w := apiRequest(t, env, "POST", "/-/api/v1/issues/999/promote", `{}`, nil); w.Code != http.StatusNotFound {
+		t.Errorf("promote a missing issue: status = %d, want %d", w.Code, http.StatusNotFound)
+	}
+
+	// A page, or a selection of it, is filed as a new issue.
+	if _, err := env.Store.Store(ctx, "setup.md", "# Setup\n", "Add setup", storage.Author{Name: "Admin"}); err != nil {
+		t.Fatal(err)
+	}
+	w = httptest.NewRecorder()
+	env.Router.ServeHTTP(w, requestWithCookies("GET", "/Setup", nil, nil))
+	if !strings.Contains(w.Body.String(), `href="/-/issues/new?page=Setup" data-action="file-issue"`) {
+		t.Errorf("page lacks the file as issue link")
+	}
+	w = httptest.NewRecorder()
+	env.Router.ServeHTTP(w, requestWithCookies("GET", "/-/issues/new?page=Setup&quote="+url.QueryEscape("Step one\nStep two"), nil, nil))
+	if body := w.Body.String(); !strings.Contains(body, `value="Setup"`) || !strings.Contains(body, "From [[Setup]]:\n\n&gt; Step one\n&gt; Step two") {
+		t.Errorf("new issue form from a page; body:\n%s", body)
+	}
+}
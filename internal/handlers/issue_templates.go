@@ -0,0 +1,243 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/sa/gopherwiki/internal/db"
+	"github.com/sa/gopherwiki/internal/frontmatter"
+	"github.com/sa/gopherwiki/internal/util"
+)
+
+// issueTemplatesDir is the repository directory of issue templates, one
+// Markdown file each: frontmatter with the name, title prefix, category and
+// tags, and the description skeleton as the body.
+const issueTemplatesDir = ".issues/templates"
+
+// issueTemplatesPreferenceKey holds the issue templates admins keep in the
+// settings, as JSON.
+const issueTemplatesPreferenceKey = "issue_templates"
+
+// issueTemplate pre-fills a new issue.
+type issueTemplate struct {
+	ID          string   `json:"id"`
+	Name        string   `json:"name"`
+	TitlePrefix string   `json:"title_prefix,omitempty"`
+	Description string   `json:"description,omitempty"`
+	Category    string   `json:"category,omitempty"`
+	Tags        []string `json:"tags,omitempty"`
+	// File is the template's file in the repository, or "" for one kept in
+	// the settings.
+	File string `json:"-"`
+}
+
+// apply fills in what the template gives that the issue does not have yet,
+// and starts the title with the template's prefix.
+func (t issueTemplate) apply(title, description, category string, tags []string) (string, string, string, []string) {
+	if t.TitlePrefix != "" && !strings.HasPrefix(title, t.TitlePrefix) {
+		title = t.TitlePrefix + title
+	}
+	if strings.TrimSpace(description) == "" {
+		description = t.Description
+	}
+	if category == "" {
+		category = t.Category
+	}
+	if len(tags) == 0 {
+		tags = t.Tags
+	}
+	return title, description, category, tags
+}
+
+// getIssueTemplates returns the issue templates of the repository and the
+// settings, sorted by name. A settings template replaces a repository one
+// with the same ID.
+func (s *Server) getIssueTemplates(ctx context.Context) []issueTemplate {
+	byID := make(map[string]issueTemplate)
+	for _, t := range s.repositoryIssueTemplates(ctx) {
+		byID[t.ID] = t
+	}
+	for _, t := range s.settingsIssueTemplates(ctx) {
+		byID[t.ID] = t
+	}
+
+	templates := make([]issueTemplate, 0, len(byID))
+	for _, t := range byID {
+		templates = append(templates, t)
+	}
+	sort.Slice(templates, func(i, j int) bool {
+		return strings.ToLower(templates[i].Name) < strings.ToLower(templates[j].Name)
+	})
+	return templates
+}
+
+// findIssueTemplate returns the issue template with id.
+func (s *Server) findIssueTemplate(ctx context.Context, id string) (issueTemplate, bool) {
+	for _, t := range s.getIssueTemplates(ctx) {
+		if t.ID == id {
+			return t, true
+		}
+	}
+	return issueTemplate{}, false
+}
+
+// repositoryIssueTemplates loads the templates in issueTemplatesDir,
+// skipping files that cannot be read.
+func (s *Server) repositoryIssueTemplates(ctx context.Context) []issueTemplate {
+	if !s.Storage.IsDir(ctx, issueTemplatesDir) {
+		return nil
+	}
+	files, _, err := s.Storage.List(ctx, issueTemplatesDir, nil, nil)
+	if err != nil {
+		slog.Warn("failed to list issue templates", "error", err)
+		return nil
+	}
+
+	var templates []issueTemplate
+	for _, f := range files {
+		if !util.IsMarkdownFile(f) || strings.Contains(f, "/") {
+			continue
+		}
+		filename := path.Join(issueTemplatesDir, f)
+		content, err := s.Storage.Load(ctx, filename, "")
+		if err != nil {
+			slog.Warn("failed to load issue template", "file", filename, "error", err)
+			continue
+		}
+		t := parseIssueTemplate(util.StripMarkdownExtension(f), content)
+		t.File = filename
+		templates = append(templates, t)
+	}
+	return templates
+}
+
+// parseIssueTemplate reads an issue template file, named id without its
+// extension.
+func parseIssueTemplate(id, content string) issueTemplate {
+	t := issueTemplate{ID: id, Name: id, Description: content}
+	fm, body := frontmatter.Parse(content)
+	if fm == nil {
+		return t
+	}
+	t.Description = strings.TrimLeft(body, "\n")
+	if name, ok := fm.Raw["name"].(string); ok && name != "" {
+		t.Name = name
+	}
+	t.TitlePrefix = fm.Title
+	if category, ok := fm.Raw["category"].(string); ok {
+		t.Category = category
+	}
+	switch tags := fm.Raw["tags"].(type) {
+	case string:
+		t.Tags = parseTags(tags)
+	case []any:
+		for _, tag := range tags {
+			if tag, ok := tag.(string); ok && strings.TrimSpace(tag) != "" {
+				t.Tags = append(t.Tags, strings.TrimSpace(tag))
+			}
+		}
+	}
+	return t
+}
+
+// settingsIssueTemplates returns the templates kept in the settings.
+func (s *Server) settingsIssueTemplates(ctx context.Context) []issueTemplate {
+	pref, err := s.DB.Queries.GetPreference(ctx, issueTemplatesPreferenceKey)
+	if err != nil || !pref.Value.Valid || pref.Value.String == "" {
+		return nil
+	}
+	var templates []issueTemplate
+	if err := json.Unmarshal([]byte(pref.Value.String), &templates); err != nil {
+		slog.Warn("failed to decode issue templates", "error", err)
+		return nil
+	}
+	return templates
+}
+
+// saveSettingsIssueTemplates stores the templates kept in the settings.
+func (s *Server) saveSettingsIssueTemplates(ctx context.Context, templates []issueTemplate) error {
+	value, err := json.Marshal(templates)
+	if err != nil {
+		return err
+	}
+	return s.DB.Queries.UpsertPreference(ctx, db.UpsertPreferenceParams{
+		Name:  issueTemplatesPreferenceKey,
+		Value: db.NullString(string(value)),
+	})
+}
+
+// handleAdminIssueTemplateSave adds a template to the settings, or replaces
+// the one with the same name.
+func (s *Server) handleAdminIssueTemplateSave(w http.ResponseWriter, r *http.Request) {
+	if !s.requireAdmin(w, r) {
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		s.renderError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	name := strings.TrimSpace(r.FormValue("name"))
+	t := issueTemplate{
+		ID:          util.Slugify(name, false),
+		Name:        name,
+		TitlePrefix: r.FormValue("title_prefix"),
+		Description: strings.ReplaceAll(r.FormValue("description"), "\r\n", "\n"),
+		Category:    strings.TrimSpace(r.FormValue("category")),
+		Tags:        parseTags(r.FormValue("tags")),
+	}
+	if t.ID == "" {
+		s.SessionManager.AddFlashMessage(w, r, "danger", "Template name is required")
+		http.Redirect(w, r, "/-/admin/settings#issue-templates", http.StatusFound)
+		return
+	}
+
+	ctx := r.Context()
+	templates := s.settingsIssueTemplates(ctx)
+	replaced := false
+	for i := range templates {
+		if templates[i].ID == t.ID {
+			templates[i] = t
+			replaced = true
+		}
+	}
+	if !replaced {
+		templates = append(templates, t)
+	}
+	if err := s.saveSettingsIssueTemplates(ctx, templates); err != nil {
+		s.SessionManager.AddFlashMessage(w, r, "danger", "Failed to save issue template")
+	} else {
+		s.SessionManager.AddFlashMessage(w, r, "success", fmt.Sprintf("Issue template %q saved", t.Name))
+	}
+	http.Redirect(w, r, "/-/admin/settings#issue-templates", http.StatusFound)
+}
+
+// handleAdminIssueTemplateDelete removes a template from the settings.
+func (s *Server) handleAdminIssueTemplateDelete(w http.ResponseWriter, r *http.Request) {
+	if !s.requireAdmin(w, r) {
+		return
+	}
+
+	ctx := r.Context()
+	id := chi.URLParam(r, "id")
+	var kept []issueTemplate
+	for _, t := range s.settingsIssueTemplates(ctx) {
+		if t.ID != id {
+			kept = append(kept, t)
+		}
+	}
+	if err := s.saveSettingsIssueTemplates(ctx, kept); err != nil {
+		s.SessionManager.AddFlashMessage(w, r, "danger", "Failed to delete issue template")
+	} else {
+		s.SessionManager.AddFlashMessage(w, r, "success", "Issue template deleted")
+	}
+	http.Redirect(w, r, "/-/admin/settings#issue-templates", http.StatusFound)
+}
@@ -0,0 +1,98 @@
+package handlers_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/sa/gopherwiki/internal/handlers"
+	"github.com/sa/gopherwiki/internal/storage"
+	"github.com/sa/gopherwiki/internal/testutil"
+)
+
+func TestIssueTemplates(t *testing.T) {
+	env := testutil.SetupTestEnv(t)
+	ctx := context.Background()
+	bug := "---\nname: Bug report\ntitle: \"[Bug] \"\ncategory: Bug\ntags: [bug, triage]\n---\n\n**Steps to reproduce**\n"
+	if _, err := env.Store.Store(ctx, ".issues/templates/bug.md", bug, "Add bug template", storage.Author{Name: "Admin"}); err != nil {
+		t.Fatal(err)
+	}
+
+	admin := loginAsAdmin(t, env)
+	post := func(path string, form url.Values, cookies []*http.Cookie) *httptest.ResponseRecorder {
+		req := requestWithCookies("POST", path, strings.NewReader(form.Encode()), cookies)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		env.Router.ServeHTTP(w, req)
+		return w
+	}
+	form := url.Values{"name": {"Feature request"}, "title_prefix": {"[Feature] "}, "description": {"**Motivation**"}, "tags": {"feature"}}
+	if w := post("/-/admin/issue-templates", form, admin); w.Code != http.StatusFound {
+		t.Fatalf("save template: status = %d, want %d", w.Code, http.StatusFound)
+	}
+
+	// The API lists both.
+	w := apiRequest(t, env, "GET", "/-/api/v1/issues/templates", "", nil)
+	var resp struct {
+		Data []handlers.APIIssueTemplate `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode templates: %v; body: %s", err, w.Body.String())
+	}
+	templates := resp.Data
+	if len(templates) != 2 || templates[0].ID != "bug" || templates[0].TitlePrefix != "[Bug] " || templates[1].ID != "feature-request" {
+		t.Fatalf("templates = %+v", templates)
+	}
+
+	// The form starts from the chosen template.
+	req := requestWithCookies("GET", "/-/issues/new?template=bug", nil, nil)
+	w = httptest.NewRecorder()
+	env.Router.ServeHTTP(w, req)
+	if body := w.Body.String(); !strings.Contains(body, `value="[Bug] "`) || !strings.Contains(body, "**Steps to reproduce**") || !strings.Contains(body, `name="template" value="bug"`) {
+		t.Errorf("new issue form lacks the template; body:\n%s", body)
+	}
+
+	// Creating with a template fills in what the issue leaves out.
+	if w := post("/-/issues/new", url.Values{"title": {"Crash on save"}, "template": {"bug"}}, nil); w.Code != http.StatusFound {
+		t.Fatalf("create issue: status = %d", w.Code)
+	}
+	body := `{"title": "Dark mode", "description": "Please", "template": "feature-request"}`
+	if w := apiRequest(t, env, "POST", "/-/api/v1/issues", body, nil); w.Code != http.StatusCreated {
+		t.Fatalf("API create issue: status = %d, body = %s", w.Code, w.Body.String())
+	}
+	issues, err := env.DB.Queries.ListIssues(ctx)
+	if err != nil || len(issues) != 2 {
+		t.Fatalf("ListIssues = %d issues, %v", len(issues), err)
+	}
+	for _, issue := range issues {
+		switch issue.Title {
+		case "[Bug] Crash on save":
+			if issue.Description.String != "**Steps to reproduce**\n" || issue.Category.String != "Bug" || issue.Tags.String != "bug,triage" {
+				t.Errorf("bug issue = %+v", issue)
+			}
+		case "[Feature] Dark mode":
+			if issue.Description.String != "Please" || issue.Tags.String != "feature" {
+				t.Errorf("feature issue = %+v", issue)
+			}
+		default:
+			t.Errorf("unexpected issue %q", issue.Title)
+		}
+	}
+	if w := apiRequest(t, env, "POST", "/-/api/v1/issues", `{"title": "X", "template": "missing"}`, nil); w.Code != http.StatusBadRequest {
+		t.Errorf("unknown template: status = %d, want %d", w.Code, http.StatusBadRequest)
+	}
+
+	// Settings templates can be deleted; repository ones stay.
+	if w := post("/-/admin/issue-templates/feature-request/delete", nil, admin); w.Code != http.StatusFound {
+		t.Fatalf("delete template: status = %d", w.Code)
+	}
+	w = apiRequest(t, env, "GET", "/-/api/v1/issues/templates", "", nil)
+	resp.Data = nil
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || len(resp.Data) != 1 || resp.Data[0].ID != "bug" {
+		t.Errorf("templates after delete = %+v, %v", resp.Data, err)
+	}
+}
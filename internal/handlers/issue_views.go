@@ -0,0 +1,183 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/sa/gopherwiki/internal/db"
+	"github.com/sa/gopherwiki/internal/middleware"
+)
+
+// errIssueViewNotFound is returned for a saved view the user does not have.
+var errIssueViewNotFound = errors.New("saved view not found")
+
+// issueFilter narrows the issue list. Its zero value lists every issue.
+type issueFilter struct {
+	Status   string // "open" or "closed"
+	Category string
+	Tag      string
+	Text     string // Found in the title or description, ignoring case
+}
+
+// issueFilterFromQuery reads a filter from the issue list's query
+// parameters status, category, tag and q.
+func issueFilterFromQuery(q url.Values) issueFilter {
+	return issueFilter{
+		Status:   q.Get("status"),
+		Category: q.Get("category"),
+		Tag:      q.Get("tag"),
+		Text:     strings.TrimSpace(q.Get("q")),
+	}
+}
+
+// query encodes f as the issue list's query string.
+func (f issueFilter) query() string {
+	q := url.Values{}
+	for name, value := range map[string]string{"status": f.Status, "category": f.Category, "tag": f.Tag, "q": f.Text} {
+		if value != "" {
+			q.Set(name, value)
+		}
+	}
+	return q.Encode()
+}
+
+// match reports whether issue passes f, but for its status, which
+// listIssues filters on in the database.
+func (f issueFilter) match(issue db.Issue) bool {
+	if f.Category != "" && (!issue.Category.Valid || issue.Category.String != f.Category) {
+		return false
+	}
+	if f.Tag != "" && (!issue.Tags.Valid || !containsTag(issue.Tags.String, f.Tag)) {
+		return false
+	}
+	if f.Text != "" {
+		text := strings.ToLower(f.Text)
+		if !strings.Contains(strings.ToLower(issue.Title), text) && !strings.Contains(strings.ToLower(issue.Description.String), text) {
+			return false
+		}
+	}
+	return true
+}
+
+// listIssues returns the issues f lets through.
+func (s *Server) listIssues(ctx context.Context, f issueFilter) ([]db.Issue, error) {
+	var issues []db.Issue
+	var err error
+	if f.Status == "open" || f.Status == "closed" {
+		issues, err = s.DB.Queries.ListIssuesByStatus(ctx, f.Status)
+	} else {
+		issues, err = s.DB.Queries.ListIssues(ctx)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var filtered []db.Issue
+	for _, issue := range issues {
+		if f.match(issue) {
+			filtered = append(filtered, issue)
+		}
+	}
+	return filtered, nil
+}
+
+// requestIssueFilter returns the filter the issue list request r asks
+// for: the saved view its view parameter names, or its filter parameters.
+// It returns errIssueViewNotFound for a view the user has not saved.
+func (s *Server) requestIssueFilter(r *http.Request) (issueFilter, string, error) {
+	name := r.URL.Query().Get("view")
+	if name == "" {
+		return issueFilterFromQuery(r.URL.Query()), "", nil
+	}
+	user := middleware.GetUser(r)
+	if !user.IsAuthenticated() {
+		return issueFilter{}, "", errIssueViewNotFound
+	}
+	view, err := s.DB.GetIssueView(r.Context(), user.ID, name)
+	if errors.Is(err, sql.ErrNoRows) {
+		return issueFilter{}, "", errIssueViewNotFound
+	} else if err != nil {
+		return issueFilter{}, "", err
+	}
+	q, err := url.ParseQuery(view.Query)
+	if err != nil {
+		return issueFilter{}, "", err
+	}
+	return issueFilterFromQuery(q), view.Name, nil
+}
+
+// handleIssueViewSave saves the filter of the form as a view of the
+// logged-in user, replacing the one with the same name.
+func (s *Server) handleIssueViewSave(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetUser(r)
+	if !user.IsAuthenticated() {
+		http.Redirect(w, r, "/-/login", http.StatusFound)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		s.renderError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	filter := issueFilterFromQuery(r.PostForm)
+	name := strings.TrimSpace(r.PostForm.Get("name"))
+	if name == "" {
+		s.SessionManager.AddFlashMessage(w, r, "danger", "View name is required")
+		http.Redirect(w, r, "/-/issues?"+filter.query(), http.StatusFound)
+		return
+	}
+
+	view := db.IssueView{UserID: user.ID, Name: name, Query: filter.query(), CreatedAt: time.Now()}
+	if err := s.DB.SaveIssueView(r.Context(), view); err != nil {
+		s.SessionManager.AddFlashMessage(w, r, "danger", "Failed to save view")
+		http.Redirect(w, r, "/-/issues?"+filter.query(), http.StatusFound)
+		return
+	}
+	s.SessionManager.AddFlashMessage(w, r, "success", "View saved")
+	http.Redirect(w, r, "/-/issues?view="+url.QueryEscape(name), http.StatusFound)
+}
+
+// handleIssueViewDelete deletes a view of the logged-in user.
+func (s *Server) handleIssueViewDelete(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetUser(r)
+	if !user.IsAuthenticated() {
+		http.Redirect(w, r, "/-/login", http.StatusFound)
+		return
+	}
+	id, err := parseInt64(chi.URLParam(r, "id"))
+	if err != nil {
+		s.renderError(w, r, http.StatusBadRequest, "Invalid view ID")
+		return
+	}
+	if err := s.DB.DeleteIssueView(r.Context(), user.ID, id); err != nil {
+		s.SessionManager.AddFlashMessage(w, r, "danger", "Failed to delete view")
+	} else {
+		s.SessionManager.AddFlashMessage(w, r, "success", "View deleted")
+	}
+	http.Redirect(w, r, "/-/issues", http.StatusFound)
+}
+
+// handleAPIIssueViews handles GET /api/v1/issues/views -- list the saved
+// views of the authenticated user.
+func (s *Server) handleAPIIssueViews(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetUser(r)
+	result := []APIIssueView{}
+	if user.IsAuthenticated() {
+		views, err := s.DB.ListIssueViews(r.Context(), user.ID)
+		if err != nil {
+			writeJSONError(w, http.StatusInternalServerError, "failed to list views")
+			return
+		}
+		for _, v := range views {
+			result = append(result, APIIssueView{ID: v.ID, Name: v.Name, Query: v.Query})
+		}
+	}
+	writeJSON(w, http.StatusOK, result)
+}
@@ -0,0 +1,95 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/sa/gopherwiki/internal/handlers"
+	"github.com/sa/gopherwiki/internal/testutil"
+)
+
+func TestIssueViews(t *testing.T) {
+	env := testutil.SetupTestEnv(t)
+	createAPITestIssue(t, env, "Login fails", "The login form rejects valid passwords", "open", "", []string{"bug"})
+	createAPITestIssue(t, env, "Slow search", "Search takes seconds after LOGIN", "open", "", []string{"performance"})
+	createAPITestIssue(t, env, "Old login bug", "", "closed", "", []string{"bug"})
+	user := loginAsUser(t, env, "viewer@example.com")
+
+	get := func(path string, cookies []*http.Cookie) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		env.Router.ServeHTTP(w, requestWithCookies("GET", path, nil, cookies))
+		return w
+	}
+	titles := func(w *httptest.ResponseRecorder) []string {
+		t.Helper()
+		var resp struct {
+			Data []handlers.APIIssue `json:"data"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("decode issues: %v; body: %s", err, w.Body.String())
+		}
+		var titles []string
+		for _, issue := range resp.Data {
+			titles = append(titles, issue.Title)
+		}
+		return titles
+	}
+
+	// The text filter searches titles and descriptions, ignoring case.
+	if got := titles(apiRequest(t, env, "GET", "/-/api/v1/issues?q=login&status=open", "", nil)); len(got) != 2 {
+		t.Errorf("open issues mentioning login = %v, want two", got)
+	}
+	w := get("/-/issues?q=login&tag=bug", user)
+	if body := w.Body.String(); !strings.Contains(body, "Old login bug") || strings.Contains(body, "Slow search") || !strings.Contains(body, "Save View") {
+		t.Errorf("filtered list: status = %d; body:\n%s", w.Code, body)
+	}
+
+	// A saved view is a shortcut for its filter, on the web and in the API.
+	form := url.Values{"name": {"Open bugs"}, "status": {"open"}, "tag": {"bug"}}
+	req := requestWithCookies("POST", "/-/issues/views", strings.NewReader(form.Encode()), user)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w = httptest.NewRecorder()
+	env.Router.ServeHTTP(w, req)
+	if w.Code != http.StatusFound || w.Header().Get("Location") != "/-/issues?view=Open+bugs" {
+		t.Fatalf("save view: status = %d, Location = %q", w.Code, w.Header().Get("Location"))
+	}
+	w = get("/-/issues?view=Open+bugs", user)
+	if body := w.Body.String(); !strings.Contains(body, "Login fails") || strings.Contains(body, "Old login bug") || !strings.Contains(body, "Saved views:") {
+		t.Errorf("saved view page: status = %d; body:\n%s", w.Code, body)
+	}
+	if got := titles(apiRequest(t, env, "GET", "/-/api/v1/issues?view=Open+bugs", "", user)); len(got) != 1 || got[0] != "Login fails" {
+		t.Errorf("API saved view = %v, want the open bug", got)
+	}
+
+	w = apiRequest(t, env, "GET", "/-/api/v1/issues/views", "", user)
+	var resp struct {
+		Data []handlers.APIIssueView `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || len(resp.Data) != 1 || resp.Data[0].Query != "status=open&tag=bug" {
+		t.Fatalf("API views = %+v, %v", resp.Data, err)
+	}
+
+	// Views are private to their owner.
+	other := loginAsUser(t, env, "other@example.com")
+	if w := apiRequest(t, env, "GET", "/-/api/v1/issues?view=Open+bugs", "", other); w.Code != http.StatusNotFound {
+		t.Errorf("another user's view: status = %d, want %d", w.Code, http.StatusNotFound)
+	}
+	if w := get("/-/issues?view=Open+bugs", nil); w.Code != http.StatusFound {
+		t.Errorf("anonymous view: status = %d, want a redirect", w.Code)
+	}
+
+	req = requestWithCookies("POST", fmt.Sprintf("/-/issues/views/%d/delete", resp.Data[0].ID), nil, user)
+	w = httptest.NewRecorder()
+	env.Router.ServeHTTP(w, req)
+	if w.Code != http.StatusFound {
+		t.Errorf("delete view: status = %d, want %d", w.Code, http.StatusFound)
+	}
+	if w := apiRequest(t, env, "GET", "/-/api/v1/issues?view=Open+bugs", "", user); w.Code != http.StatusNotFound {
+		t.Errorf("deleted view: status = %d, want %d", w.Code, http.StatusNotFound)
+	}
+}
@@ -3,6 +3,7 @@ package handlers
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"html/template"
 	"log/slog"
@@ -14,6 +15,9 @@ import (
 
 	"github.com/sa/gopherwiki/internal/db"
 	"github.com/sa/gopherwiki/internal/middleware"
+	"github.com/sa/gopherwiki/internal/spam"
+	"github.com/sa/gopherwiki/internal/storage"
+	"github.com/sa/gopherwiki/internal/wiki"
 )
 
 const issueTagsPreferenceKey = "issue_tags"
@@ -53,46 +57,25 @@ type issuesByCategory struct {
 func (s *Server) handleIssueList(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 
-	statusFilter := r.URL.Query().Get("status")
-	tagFilter := r.URL.Query().Get("tag")
-	categoryFilter := r.URL.Query().Get("category")
-
-	var issues []db.Issue
-	var err error
-
-	if statusFilter != "" && (statusFilter == "open" || statusFilter == "closed") {
-		issues, err = s.DB.Queries.ListIssuesByStatus(ctx, statusFilter)
-	} else {
-		issues, err = s.DB.Queries.ListIssues(ctx)
+	filter, viewName, err := s.requestIssueFilter(r)
+	if errors.Is(err, errIssueViewNotFound) {
+		s.SessionManager.AddFlashMessage(w, r, "danger", "Saved view not found")
+		http.Redirect(w, r, "/-/issues", http.StatusFound)
+		return
+	} else if err != nil {
+		s.renderError(w, r, http.StatusInternalServerError, "Failed to load saved view")
+		return
 	}
+	statusFilter := filter.Status
+	tagFilter := filter.Tag
+	categoryFilter := filter.Category
 
+	issues, err := s.listIssues(ctx, filter)
 	if err != nil {
 		s.renderError(w, r, http.StatusInternalServerError, "Failed to list issues")
 		return
 	}
 
-	// Filter by category if specified
-	if categoryFilter != "" {
-		var filtered []db.Issue
-		for _, issue := range issues {
-			if issue.Category.Valid && issue.Category.String == categoryFilter {
-				filtered = append(filtered, issue)
-			}
-		}
-		issues = filtered
-	}
-
-	// Filter by tag if specified
-	if tagFilter != "" {
-		var filtered []db.Issue
-		for _, issue := range issues {
-			if issue.Tags.Valid && containsTag(issue.Tags.String, tagFilter) {
-				filtered = append(filtered, issue)
-			}
-		}
-		issues = filtered
-	}
-
 	// Get counts
 	openCount, err := s.DB.Queries.CountIssuesByStatus(ctx, "open")
 	if err != nil {
@@ -152,6 +135,16 @@ func (s *Server) handleIssueList(w http.ResponseWriter, r *http.Request) {
 	data["statusFilter"] = statusFilter
 	data["tagFilter"] = tagFilter
 	data["categoryFilter"] = categoryFilter
+	data["textFilter"] = filter.Text
+	data["filterQuery"] = filter.query()
+	data["activeView"] = viewName
+	if user := middleware.GetUser(r); user.IsAuthenticated() {
+		views, err := s.DB.ListIssueViews(ctx, user.ID)
+		if err != nil {
+			slog.Warn("failed to list saved issue views", "error", err)
+		}
+		data["savedViews"] = views
+	}
 	data["openCount"] = openCount
 	data["closedCount"] = closedCount
 	data["availableTags"] = s.getAvailableTags(ctx)
@@ -187,9 +180,9 @@ func (s *Server) handleIssueView(w http.ResponseWriter, r *http.Request) {
 
 	tags := parseTags(issue.Tags.String)
 
-	user := middleware.GetUser(r)
-	canEdit := user.IsAuthenticated()
-	canDelete := user.Admin()
+	// Match the permissions the edit, close/reopen and delete routes require.
+	canEdit := s.PermissionChecker.HasPermission(r, middleware.PermissionWrite)
+	canDelete := s.PermissionChecker.HasPermission(r, middleware.PermissionAdmin)
 
 	// Load comments
 	comments, err := s.DB.Queries.ListIssueComments(ctx, issue.ID)
@@ -197,10 +190,17 @@ func (s *Server) handleIssueView(w http.ResponseWriter, r *http.Request) {
 		slog.Warn("failed to list issue comments", "error", err)
 	}
 
+	edited, err := s.DB.CountEditedIssueComments(ctx, issue.ID)
+	if err != nil {
+		slog.Warn("failed to count edited issue comments", "error", err)
+	}
+
 	// Render each comment's content as markdown
 	type renderedComment struct {
 		Comment     db.IssueComment
 		HTMLContent template.HTML
+		Revisions   int  // Earlier versions of an edited comment
+		CanEdit     bool // Whether the viewer wrote the comment or is an admin
 	}
 	var renderedComments []renderedComment
 	for _, c := range comments {
@@ -211,6 +211,8 @@ func (s *Server) handleIssueView(w http.ResponseWriter, r *http.Request) {
 		renderedComments = append(renderedComments, renderedComment{
 			Comment:     c,
 			HTMLContent: template.HTML(html),
+			Revisions:   edited[c.ID],
+			CanEdit:     canEdit && s.canEditComment(r, c),
 		})
 	}
 
@@ -234,6 +236,31 @@ func (s *Server) handleIssueNew(w http.ResponseWriter, r *http.Request) {
 	data["availableTags"] = s.getAvailableTags(ctx)
 	data["availableCategories"] = s.getAvailableCategories(ctx)
 	data["isEdit"] = false
+	data["issueTemplates"] = s.getIssueTemplates(ctx)
+	var draftTitle, draftDescription string
+	var t issueTemplate
+	if id := r.URL.Query().Get("template"); id != "" {
+		if found, ok := s.findIssueTemplate(ctx, id); ok {
+			t = found
+			data["issueTemplate"] = t
+			data["tags"] = t.Tags
+		}
+	}
+	if pagepath := r.URL.Query().Get("page"); pagepath != "" {
+		// Filed from a page: refer to it, quoting the selection.
+		if page, err := wiki.NewPage(ctx, s.Storage, s.Config, pagepath, ""); err == nil && page.Exists {
+			draftTitle, draftDescription = issueFromPage(page, r.URL.Query().Get("quote"))
+			data["fromPage"] = page.Pagepath
+		}
+	}
+	if t.ID != "" {
+		draftTitle = t.TitlePrefix + draftTitle
+		if t.Description != "" {
+			draftDescription = strings.TrimLeft(draftDescription+"\n"+t.Description, "\n")
+		}
+	}
+	data["draftTitle"] = draftTitle
+	data["draftDescription"] = draftDescription
 	s.renderTemplate(w, r, "issues_form.html", data)
 }
 
@@ -255,6 +282,15 @@ func (s *Server) handleIssueCreate(w http.ResponseWriter, r *http.Request) {
 		http.Redirect(w, r, "/-/issues/new", http.StatusFound)
 		return
 	}
+	if id := r.FormValue("template"); id != "" {
+		t, ok := s.findIssueTemplate(ctx, id)
+		if !ok {
+			s.SessionManager.AddFlashMessage(w, r, "danger", "Unknown issue template")
+			http.Redirect(w, r, "/-/issues/new", http.StatusFound)
+			return
+		}
+		title, description, category, tags = t.apply(title, description, category, tags)
+	}
 
 	// Validate category if categories are configured
 	availableCategories := s.getAvailableCategories(ctx)
@@ -264,11 +300,25 @@ func (s *Server) handleIssueCreate(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if s.honeypotTripped(w, r) {
+		return
+	}
+	sub := spam.Submission{Kind: spam.KindIssue, Title: title, Content: description}
+	if _, held, err := s.holdForModeration(r, sub, moderationPayload{Category: category, Tags: tags}); err != nil {
+		s.SessionManager.AddFlashMessage(w, r, "danger", "Failed to create issue")
+		http.Redirect(w, r, "/-/issues/new", http.StatusFound)
+		return
+	} else if held {
+		s.SessionManager.AddFlashMessage(w, r, "info", "Your issue is awaiting moderation")
+		http.Redirect(w, r, "/-/issues", http.StatusFound)
+		return
+	}
+
 	user := middleware.GetUser(r)
 	createdByName := user.GetName()
 	createdByEmail := user.GetEmail()
 	if createdByName == "" {
-		createdByName = "Anonymous"
+		createdByName = s.getAuthor(r).Name
 	}
 
 	now := time.Now()
@@ -290,6 +340,7 @@ func (s *Server) handleIssueCreate(w http.ResponseWriter, r *http.Request) {
 		http.Redirect(w, r, "/-/issues/new", http.StatusFound)
 		return
 	}
+	s.notifyMentions(ctx, issue, 0, description, storage.Author{Name: createdByName, Email: createdByEmail})
 
 	s.SessionManager.AddFlashMessage(w, r, "success", "Issue created successfully")
 	http.Redirect(w, r, fmt.Sprintf("/-/issues/%d", issue.ID), http.StatusFound)
@@ -484,7 +535,8 @@ func (s *Server) handleIssueCommentCreate(w http.ResponseWriter, r *http.Request
 	}
 
 	// Verify issue exists
-	if _, err := s.DB.Queries.GetIssue(ctx, id); err != nil {
+	issue, err := s.DB.Queries.GetIssue(ctx, id)
+	if err != nil {
 		if err == sql.ErrNoRows {
 			s.renderError(w, r, http.StatusNotFound, "Issue not found")
 			return
@@ -493,11 +545,25 @@ func (s *Server) handleIssueCommentCreate(w http.ResponseWriter, r *http.Request
 		return
 	}
 
+	if s.honeypotTripped(w, r) {
+		return
+	}
+	sub := spam.Submission{Kind: spam.KindComment, Target: idStr, Content: content}
+	if _, held, err := s.holdForModeration(r, sub, moderationPayload{}); err != nil {
+		s.SessionManager.AddFlashMessage(w, r, "danger", "Failed to add comment")
+		http.Redirect(w, r, fmt.Sprintf("/-/issues/%d", id), http.StatusFound)
+		return
+	} else if held {
+		s.SessionManager.AddFlashMessage(w, r, "info", "Your comment is awaiting moderation")
+		http.Redirect(w, r, fmt.Sprintf("/-/issues/%d", id), http.StatusFound)
+		return
+	}
+
 	user := middleware.GetUser(r)
 	authorName := user.GetName()
 	authorEmail := user.GetEmail()
 	if authorName == "" {
-		authorName = "Anonymous"
+		authorName = s.getAuthor(r).Name
 	}
 
 	now := time.Now()
@@ -514,6 +580,7 @@ func (s *Server) handleIssueCommentCreate(w http.ResponseWriter, r *http.Request
 		http.Redirect(w, r, fmt.Sprintf("/-/issues/%d", id), http.StatusFound)
 		return
 	}
+	s.notifyMentions(ctx, issue, comment.ID, content, storage.Author{Name: authorName, Email: authorEmail})
 
 	http.Redirect(w, r, fmt.Sprintf("/-/issues/%d#comment-%d", id, comment.ID), http.StatusFound)
 }
@@ -0,0 +1,247 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/sa/gopherwiki/internal/util"
+)
+
+const (
+	// graphHubLinks is the number of pages that must link to a page for
+	// the link graph to mark it as a hub.
+	graphHubLinks = 5
+	// graphMaxDepth is the deepest neighbourhood of a page the graph API
+	// returns.
+	graphMaxDepth = 10
+)
+
+// graphNode is a page of the link graph. A page that is linked to but does
+// not exist is a node too, so that wanted pages show.
+type graphNode struct {
+	ID       string `json:"id"`
+	Name     string `json:"name"`
+	Exists   bool   `json:"exists"`
+	LinksIn  int    `json:"links_in"`
+	LinksOut int    `json:"links_out"`
+	Orphan   bool   `json:"orphan"`
+	Hub      bool   `json:"hub"`
+}
+
+// graphLink is a wiki link from one page of the link graph to another.
+type graphLink struct {
+	Source string `json:"source"`
+	Target string `json:"target"`
+}
+
+// linkGraph is the graph of the wiki links between pages.
+type linkGraph struct {
+	Namespace string      `json:"namespace,omitempty"`
+	Nodes     []graphNode `json:"nodes"`
+	Links     []graphLink `json:"links"`
+}
+
+// APIGraph is the JSON representation of the link graph: its pages, and
+// for each the pages it links to.
+type APIGraph struct {
+	Nodes     []graphNode         `json:"nodes"`
+	Adjacency map[string][]string `json:"adjacency"`
+}
+
+// linkGraph returns the graph of the links between pages, keeping to the
+// pages under namespace unless it is empty. Orphans and hubs are found
+// over the whole wiki: a page linked to only from outside the namespace
+// is no orphan. The home page, which the navigation links to, is none
+// either.
+func (s *Server) linkGraph(ctx context.Context, namespace string) (linkGraph, error) {
+	pages, err := s.Wiki.PageInfos(ctx)
+	if err != nil {
+		return linkGraph{}, err
+	}
+	links, err := s.Wiki.PageLinks(ctx)
+	if err != nil {
+		return linkGraph{}, err
+	}
+
+	nodes := make(map[string]*graphNode, len(pages))
+	for _, p := range pages {
+		nodes[p.Path] = &graphNode{ID: p.Path, Name: p.Name, Exists: true}
+	}
+	var edges []graphLink
+	for _, l := range links {
+		source, ok := nodes[l.Source]
+		if !ok {
+			continue
+		}
+		for _, target := range l.Targets {
+			if target == l.Source {
+				continue
+			}
+			node, ok := nodes[target]
+			if !ok {
+				node = &graphNode{ID: target, Name: util.GetPagename(target, false)}
+				nodes[target] = node
+			}
+			source.LinksOut++
+			node.LinksIn++
+			edges = append(edges, graphLink{Source: l.Source, Target: target})
+		}
+	}
+
+	home := s.Settings.Get(ctx).HomePage
+	if home == "" {
+		home = "Home"
+	}
+	home = util.GetPagepath(home)
+	namespace = strings.Trim(namespace, "/")
+	inNamespace := func(path string) bool {
+		return namespace == "" || path == namespace || strings.HasPrefix(path, namespace+"/")
+	}
+
+	graph := linkGraph{Namespace: namespace, Nodes: []graphNode{}, Links: []graphLink{}}
+	for _, node := range nodes {
+		if !inNamespace(node.ID) {
+			continue
+		}
+		node.Orphan = node.Exists && node.LinksIn == 0 && !strings.EqualFold(node.ID, home)
+		node.Hub = node.LinksIn >= graphHubLinks
+		graph.Nodes = append(graph.Nodes, *node)
+	}
+	sort.Slice(graph.Nodes, func(i, j int) bool { return graph.Nodes[i].ID < graph.Nodes[j].ID })
+	for _, e := range edges {
+		if inNamespace(e.Source) && inNamespace(e.Target) {
+			graph.Links = append(graph.Links, e)
+		}
+	}
+	return graph, nil
+}
+
+// around returns the part of g within depth links of the page at pagepath,
+// following links either way.
+func (g linkGraph) around(pagepath string, depth int) linkGraph {
+	neighbours := make(map[string][]string)
+	for _, l := range g.Links {
+		neighbours[l.Source] = append(neighbours[l.Source], l.Target)
+		neighbours[l.Target] = append(neighbours[l.Target], l.Source)
+	}
+	within := map[string]bool{pagepath: true}
+	frontier := []string{pagepath}
+	for range depth {
+		var next []string
+		for _, p := range frontier {
+			for _, n := range neighbours[p] {
+				if !within[n] {
+					within[n] = true
+					next = append(next, n)
+				}
+			}
+		}
+		frontier = next
+	}
+
+	part := linkGraph{Namespace: g.Namespace, Nodes: []graphNode{}, Links: []graphLink{}}
+	for _, node := range g.Nodes {
+		if within[node.ID] {
+			part.Nodes = append(part.Nodes, node)
+		}
+	}
+	for _, l := range g.Links {
+		if within[l.Source] && within[l.Target] {
+			part.Links = append(part.Links, l)
+		}
+	}
+	return part
+}
+
+// handleAPIGraph handles GET /api/v1/graph -- the link graph as an
+// adjacency list, under the namespace query parameter when it is set, and
+// within depth links (1 by default) of page when that is set.
+func (s *Server) handleAPIGraph(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	pagepath := strings.Trim(q.Get("page"), "/")
+	depth := 1
+	if v := q.Get("depth"); v != "" {
+		d, err := strconv.Atoi(v)
+		if err != nil || d < 0 || d > graphMaxDepth {
+			writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("depth must be 0 to %d", graphMaxDepth))
+			return
+		}
+		if pagepath == "" {
+			writeJSONError(w, http.StatusBadRequest, "depth needs a page")
+			return
+		}
+		depth = d
+	}
+
+	graph, err := s.linkGraph(r.Context(), q.Get("namespace"))
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, "failed to load the link graph")
+		return
+	}
+	if pagepath != "" {
+		if !slices.ContainsFunc(graph.Nodes, func(n graphNode) bool { return n.ID == pagepath }) {
+			writeJSONError(w, http.StatusNotFound, "page not found in the graph")
+			return
+		}
+		graph = graph.around(pagepath, depth)
+	}
+
+	result := APIGraph{Nodes: graph.Nodes, Adjacency: make(map[string][]string, len(graph.Nodes))}
+	for _, node := range graph.Nodes {
+		result.Adjacency[node.ID] = []string{}
+	}
+	for _, l := range graph.Links {
+		result.Adjacency[l.Source] = append(result.Adjacency[l.Source], l.Target)
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+// handleLinkGraph shows the graph of the links between pages, under the
+// namespace query parameter when it is set: as JSON with format=json or
+// to a client that accepts JSON, otherwise as a page that draws it, with
+// lists of its orphans and hubs.
+func (s *Server) handleLinkGraph(w http.ResponseWriter, r *http.Request) {
+	namespace := r.URL.Query().Get("namespace")
+	graph, err := s.linkGraph(r.Context(), namespace)
+	asJSON := r.URL.Query().Get("format") == "json" || strings.Contains(r.Header.Get("Accept"), "application/json")
+	if err != nil {
+		if asJSON {
+			writeJSONError(w, http.StatusInternalServerError, "failed to load the link graph")
+		} else {
+			s.renderFailure(w, r, err)
+		}
+		return
+	}
+	if asJSON {
+		writeJSON(w, http.StatusOK, graph)
+		return
+	}
+
+	var orphans, hubs []graphNode
+	for _, node := range graph.Nodes {
+		if node.Orphan {
+			orphans = append(orphans, node)
+		}
+		if node.Hub {
+			hubs = append(hubs, node)
+		}
+	}
+	sort.SliceStable(hubs, func(i, j int) bool { return hubs[i].LinksIn > hubs[j].LinksIn })
+
+	q := r.URL.Query()
+	q.Set("format", "json")
+	data := NewGenericData("Link Graph")
+	data["namespace"] = graph.Namespace
+	data["graph_url"] = r.URL.Path + "?" + q.Encode()
+	data["node_count"] = len(graph.Nodes)
+	data["link_count"] = len(graph.Links)
+	data["orphans"] = orphans
+	data["hubs"] = hubs
+	data["hub_links"] = graphHubLinks
+	s.renderTemplate(w, r, "graph.html", data)
+}
@@ -0,0 +1,163 @@
+package handlers_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/sa/gopherwiki/internal/storage"
+	"github.com/sa/gopherwiki/internal/testutil"
+)
+
+func TestLinkGraph(t *testing.T) {
+	env := testutil.SetupTestEnv(t)
+	ctx := context.Background()
+	pages := map[string]string{
+		"home.md":       "# Home\n\n[[docs/guide]] [[missing]]",
+		"docs/guide.md": "# Guide\n\n[[docs/faq]] [[home]] [[docs/guide]]",
+		"docs/faq.md":   "# FAQ",
+		"lonely.md":     "# Lonely",
+	}
+	for i := range 5 {
+		name := "hub" + string(rune('a'+i))
+		pages[name+".md"] = "# " + name + "\n\n[[docs/faq]]"
+	}
+	for file, content := range pages {
+		if _, err := env.Store.Store(ctx, file, content, "Add "+file, storage.Author{Name: "Alice"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := env.Server.Wiki.RebuildSearchIndex(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	type node struct {
+		ID       string `json:"id"`
+		Exists   bool   `json:"exists"`
+		LinksIn  int    `json:"links_in"`
+		LinksOut int    `json:"links_out"`
+		Orphan   bool   `json:"orphan"`
+		Hub      bool   `json:"hub"`
+	}
+	graph := func(query string) (map[string]node, int) {
+		t.Helper()
+		w := httptest.NewRecorder()
+		env.Router.ServeHTTP(w, httptest.NewRequest("GET", "/-/graph?format=json"+query, nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("graph status = %d, want %d", w.Code, http.StatusOK)
+		}
+		var resp struct {
+			Data struct {
+				Nodes []node            `json:"nodes"`
+				Links []json.RawMessage `json:"links"`
+			} `json:"data"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatal(err)
+		}
+		nodes := make(map[string]node)
+		for _, n := range resp.Data.Nodes {
+			nodes[n.ID] = n
+		}
+		return nodes, len(resp.Data.Links)
+	}
+
+	nodes, links := graph("")
+	if links != 9 {
+		t.Errorf("links = %d, want 9 (self-links left out)", links)
+	}
+	if n := nodes["docs/faq"]; n.LinksIn != 6 || !n.Hub || n.Orphan {
+		t.Errorf("docs/faq = %+v, want a hub with 6 links in", n)
+	}
+	if n := nodes["docs/guide"]; n.LinksIn != 1 || n.LinksOut != 2 || n.Hub || n.Orphan {
+		t.Errorf("docs/guide = %+v, want 1 link in and 2 out", n)
+	}
+	if n := nodes["lonely"]; !n.Orphan {
+		t.Errorf("lonely = %+v, want an orphan", n)
+	}
+	if n := nodes["home"]; n.Orphan || n.LinksIn != 1 {
+		t.Errorf("home = %+v, want no orphan", n)
+	}
+	if n, ok := nodes["missing"]; !ok || n.Exists || n.Orphan {
+		t.Errorf("missing = %+v, %v; want a node for the wanted page", n, ok)
+	}
+
+	// A namespace keeps to its pages, counting links from elsewhere.
+	nodes, links = graph("&namespace=docs/")
+	if len(nodes) != 2 || links != 1 || nodes["docs/guide"].Orphan {
+		t.Errorf("docs graph = %+v with %d links, want docs/guide and docs/faq with 1 link", nodes, links)
+	}
+
+	w := httptest.NewRecorder()
+	env.Router.ServeHTTP(w, httptest.NewRequest("GET", "/-/graph", nil))
+	body := w.Body.String()
+	if w.Code != http.StatusOK || !strings.Contains(body, `data-graph-url="/-/graph?format=json"`) ||
+		!strings.Contains(body, `<li><a href="/lonely">lonely</a></li>`) || !strings.Contains(body, `<a href="/docs/faq">docs/faq</a>`) {
+		t.Errorf("graph page should draw the graph and list its orphans and hubs:\n%s", body)
+	}
+}
+
+func TestAPIGraph(t *testing.T) {
+	env := testutil.SetupTestEnv(t)
+	ctx := context.Background()
+	for file, content := range map[string]string{
+		"a.md":     "# A\n\n[[b]]",
+		"b.md":     "# B\n\n[[c]]",
+		"c.md":     "# C\n\n[[d]] [[ns/x]]",
+		"d.md":     "# D",
+		"ns/x.md":  "# X\n\n[[ns/y]]",
+		"ns/y.md":  "# Y",
+		"other.md": "# Other",
+	} {
+		if _, err := env.Store.Store(ctx, file, content, "Add "+file, storage.Author{Name: "Alice"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := env.Server.Wiki.RebuildSearchIndex(ctx); err != nil {
+		t.Fatal(err)
+	}
+	adjacency := func(query string) (int, map[string][]string) {
+		t.Helper()
+		w := httptest.NewRecorder()
+		env.Router.ServeHTTP(w, httptest.NewRequest("GET", "/-/api/v1/graph"+query, nil))
+		var resp struct {
+			Data struct {
+				Adjacency map[string][]string `json:"adjacency"`
+			} `json:"data"`
+		}
+		if w.Code == http.StatusOK {
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return w.Code, resp.Data.Adjacency
+	}
+
+	code, adj := adjacency("")
+	if code != http.StatusOK || len(adj) != 7 || len(adj["c"]) != 2 || adj["other"] == nil {
+		t.Errorf("graph = %d %v, want every page, c linking to two", code, adj)
+	}
+	if _, adj := adjacency("?namespace=ns"); len(adj) != 2 || len(adj["ns/x"]) != 1 {
+		t.Errorf("ns graph = %v, want ns/x and ns/y", adj)
+	}
+	// Depth follows links either way.
+	if _, adj := adjacency("?page=c"); len(adj) != 4 || adj["b"][0] != "c" || adj["a"] != nil {
+		t.Errorf("graph around c = %v, want b, c, d, and ns/x", adj)
+	}
+	if _, adj := adjacency("?page=a&depth=2"); len(adj) != 3 || len(adj["b"]) != 1 || len(adj["c"]) != 0 {
+		t.Errorf("graph within 2 of a = %v, want a, b, and c without its links beyond", adj)
+	}
+	for query, want := range map[string]int{
+		"?depth=2":         http.StatusBadRequest,
+		"?page=a&depth=-1": http.StatusBadRequest,
+		"?page=a&depth=99": http.StatusBadRequest,
+		"?page=nope":       http.StatusNotFound,
+	} {
+		if code, _ := adjacency(query); code != want {
+			t.Errorf("graph%s: status = %d, want %d", query, code, want)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/sa/gopherwiki/internal/db"
+	"github.com/sa/gopherwiki/internal/middleware"
+	"github.com/sa/gopherwiki/internal/storage"
+)
+
+// maintenanceHistory is the number of runs of the repository maintenance
+// the dashboard lists.
+const maintenanceHistory = 10
+
+// MaintainRepository repacks the repository and prunes its loose objects,
+// and records the outcome for the dashboard. It does nothing without a
+// Maintainer.
+func (s *Server) MaintainRepository(ctx context.Context) (storage.MaintenanceResult, error) {
+	if s.Maintainer == nil {
+		return storage.MaintenanceResult{}, nil
+	}
+	result, err := s.Maintainer.Maintain(ctx)
+	if err != nil {
+		return result, err
+	}
+	slog.Info("maintained repository",
+		"size_before", result.Before.Size(), "size_after", result.After.Size(), "duration", result.Duration)
+	err = s.DB.RecordRepositoryMaintenance(ctx, db.RepositoryMaintenance{
+		RanAt:        time.Now(),
+		SizeBefore:   result.Before.Size(),
+		SizeAfter:    result.After.Size(),
+		LooseObjects: result.After.LooseObjects,
+		Packs:        result.After.Packs,
+		Duration:     result.Duration,
+	})
+	return result, err
+}
+
+// maintenanceData adds the repository's size and the latest runs of its
+// maintenance to the dashboard's data.
+func (s *Server) maintenanceData(ctx context.Context, data map[string]interface{}) {
+	if s.Maintainer == nil {
+		return
+	}
+	stats, err := s.Maintainer.Stats()
+	if err != nil {
+		slog.Error("failed to measure repository", "error", err)
+	}
+	data["repository_stats"] = stats
+	runs, err := s.DB.ListRepositoryMaintenance(ctx, maintenanceHistory)
+	if err != nil {
+		slog.Error("failed to list repository maintenance", "error", err)
+	}
+	data["maintenance_runs"] = runs
+}
+
+// handleAdminMaintenance runs the repository maintenance now rather than
+// waiting for the periodic job.
+func (s *Server) handleAdminMaintenance(w http.ResponseWriter, r *http.Request) {
+	if !s.requireAdmin(w, r) {
+		return
+	}
+	if s.Maintainer == nil {
+		s.renderError(w, r, http.StatusNotFound, "Repository maintenance is not available")
+		return
+	}
+
+	result, err := s.MaintainRepository(r.Context())
+	if err != nil {
+		slog.Error("repository maintenance failed", "error", err)
+		s.SessionManager.AddFlashMessage(w, r, "danger", "Repository maintenance failed")
+	} else {
+		user := middleware.GetUser(r)
+		slog.Info("repository maintenance run", "user", user.GetEmail())
+		s.SessionManager.AddFlashMessage(w, r, "success", fmt.Sprintf("Repository maintained: %s before, %s after",
+			formatSize(result.Before.Size()), formatSize(result.After.Size())))
+	}
+	http.Redirect(w, r, "/-/admin", http.StatusFound)
+}
@@ -0,0 +1,73 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+
+	"github.com/sa/gopherwiki/internal/storage"
+)
+
+// storageStats is implemented by storage.TimedStorage.
+type storageStats interface {
+	Stats() map[string]storage.OpStats
+}
+
+// handleMetrics serves metrics in the Prometheus text exposition format. It
+// is only routed when METRICS_ENABLED is set, and requires METRICS_TOKEN as
+// a bearer token when one is configured.
+func (s *Server) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	if token := s.Config.MetricsToken; token != "" {
+		got := r.Header.Get("Authorization")
+		if subtle.ConstantTimeCompare([]byte(got), []byte("Bearer "+token)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="metrics"`)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+
+	fmt.Fprintln(w, "# HELP gopherwiki_build_info GopherWiki version.")
+	fmt.Fprintln(w, "# TYPE gopherwiki_build_info gauge")
+	fmt.Fprintf(w, "gopherwiki_build_info{version=%s} 1\n", strconv.Quote(s.Version))
+
+	if timed, ok := s.Storage.(storageStats); ok {
+		writeGitMetrics(w, timed.Stats())
+	}
+}
+
+// writeGitMetrics writes the per-operation storage timings.
+func writeGitMetrics(w io.Writer, stats map[string]storage.OpStats) {
+	ops := make([]string, 0, len(stats))
+	for op := range stats {
+		ops = append(ops, op)
+	}
+	sort.Strings(ops)
+
+	fmt.Fprintln(w, "# HELP gopherwiki_git_operation_duration_seconds Time spent in git storage operations.")
+	fmt.Fprintln(w, "# TYPE gopherwiki_git_operation_duration_seconds summary")
+	for _, op := range ops {
+		fmt.Fprintf(w, "gopherwiki_git_operation_duration_seconds_sum{op=%q} %g\n", op, stats[op].Total.Seconds())
+		fmt.Fprintf(w, "gopherwiki_git_operation_duration_seconds_count{op=%q} %d\n", op, stats[op].Count)
+	}
+	fmt.Fprintln(w, "# HELP gopherwiki_git_operation_duration_seconds_max Slowest git storage operation since startup.")
+	fmt.Fprintln(w, "# TYPE gopherwiki_git_operation_duration_seconds_max gauge")
+	for _, op := range ops {
+		fmt.Fprintf(w, "gopherwiki_git_operation_duration_seconds_max{op=%q} %g\n", op, stats[op].Max.Seconds())
+	}
+	fmt.Fprintln(w, "# HELP gopherwiki_git_slow_operations_total Git storage operations slower than GIT_SLOW_OP_MS.")
+	fmt.Fprintln(w, "# TYPE gopherwiki_git_slow_operations_total counter")
+	for _, op := range ops {
+		fmt.Fprintf(w, "gopherwiki_git_slow_operations_total{op=%q} %d\n", op, stats[op].Slow)
+	}
+	fmt.Fprintln(w, "# HELP gopherwiki_git_operation_errors_total Git storage operations that failed.")
+	fmt.Fprintln(w, "# TYPE gopherwiki_git_operation_errors_total counter")
+	for _, op := range ops {
+		fmt.Fprintf(w, "gopherwiki_git_operation_errors_total{op=%q} %d\n", op, stats[op].Errors)
+	}
+}
@@ -0,0 +1,394 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/sa/gopherwiki/internal/db"
+	"github.com/sa/gopherwiki/internal/middleware"
+	"github.com/sa/gopherwiki/internal/spam"
+	"github.com/sa/gopherwiki/internal/storage"
+	"github.com/sa/gopherwiki/internal/wiki"
+)
+
+// honeypotField is the form field hidden from people: a visitor filling it
+// in is a bot.
+const honeypotField = "website"
+
+// reviewReason is the reason recorded for the page saves REVIEW_EDITS
+// proposes for review.
+const reviewReason = "Proposed for review"
+
+// moderationPayload is the part of a held contribution without a column of
+// its own in moderation_queue.
+type moderationPayload struct {
+	Message  string   `json:"message,omitempty"`  // Commit message of a page save
+	Revision string   `json:"revision,omitempty"` // Revision a page save was made on; "" for a new page
+	Category string   `json:"category,omitempty"` // Category of an issue
+	Tags     []string `json:"tags,omitempty"`     // Tags of an issue
+}
+
+// honeypotTripped refuses a form from an anonymous visitor that filled in
+// the honeypot field, answering 400. Logged-in users are not checked.
+func (s *Server) honeypotTripped(w http.ResponseWriter, r *http.Request) bool {
+	if !s.Config.SpamHoneypot || !middleware.GetUser(r).IsAnonymous() || r.FormValue(honeypotField) == "" {
+		return false
+	}
+	slog.Warn("honeypot field filled in", "client", middleware.ClientIP(r), "path", r.URL.Path)
+	s.renderError(w, r, http.StatusBadRequest, "Submission refused")
+	return true
+}
+
+// needsReview reports whether the page saves of user are proposed for
+// review rather than committed, as REVIEW_EDITS sets.
+func (s *Server) needsReview(user *middleware.User) bool {
+	switch s.Config.ReviewEdits {
+	case "anonymous":
+		return user.IsAnonymous()
+	case "untrusted":
+		return user.IsAnonymous() || !(user.Approved() || user.Admin())
+	}
+	return false
+}
+
+// holdForModeration queues a contribution for a moderator instead of
+// applying it, reporting true with its queue ID, when it is a page save
+// REVIEW_EDITS proposes for review, or when it comes from an anonymous
+// visitor and the blocklist or a spam checker plugin flags it. Logged-in
+// users are not screened for spam.
+func (s *Server) holdForModeration(r *http.Request, sub spam.Submission, payload moderationPayload) (int64, bool, error) {
+	ctx := r.Context()
+	user := middleware.GetUser(r)
+	author := s.getAuthor(r)
+	sub.AuthorName = author.Name
+	sub.AuthorEmail = author.Email
+	sub.ClientIP = middleware.ClientIP(r)
+	sub.UserAgent = r.UserAgent()
+	sub.Referrer = r.Referer()
+
+	reason := ""
+	if sub.Kind == spam.KindPage && s.needsReview(user) {
+		reason = reviewReason
+	} else if user.IsAnonymous() {
+		verdict, _ := s.spamBlocklist.Check(ctx, sub)
+		if !verdict.Spam {
+			verdict = s.Plugins.CheckSpam(ctx, sub)
+		}
+		if verdict.Spam {
+			reason = verdict.Reason
+			if reason == "" {
+				reason = "Flagged as spam"
+			}
+		}
+	}
+	if reason == "" {
+		return 0, false, nil
+	}
+
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return 0, false, err
+	}
+	id, err := s.DB.QueueModeration(ctx, db.ModerationItem{
+		Kind:        sub.Kind,
+		Target:      sub.Target,
+		Title:       sub.Title,
+		Content:     sub.Content,
+		Payload:     string(data),
+		AuthorName:  sub.AuthorName,
+		AuthorEmail: sub.AuthorEmail,
+		ClientIP:    sub.ClientIP,
+		Reason:      reason,
+		CreatedAt:   time.Now(),
+	})
+	if err != nil {
+		return 0, false, err
+	}
+	slog.Info("contribution held for moderation", "id", id, "kind", sub.Kind, "target", sub.Target,
+		"client", sub.ClientIP, "reason", reason)
+	return id, true, nil
+}
+
+// unreviewableMessage is the error of a page change REVIEW_EDITS would
+// propose for review but that cannot be held, such as a rename.
+const unreviewableMessage = "Your changes are reviewed before they are published, and this change cannot be proposed for review"
+
+// refuseUnreviewable answers 403 to a page change that cannot be held for
+// review, when REVIEW_EDITS proposes the user's page saves for review,
+// reporting whether it did.
+func (s *Server) refuseUnreviewable(w http.ResponseWriter, r *http.Request) bool {
+	if !s.needsReview(middleware.GetUser(r)) {
+		return false
+	}
+	s.renderError(w, r, http.StatusForbidden, unreviewableMessage)
+	return true
+}
+
+// holdRestore holds restoring the page at pagepath to revision for
+// moderation, as a save of the content it had then on its current
+// revision. storage.ErrNotFound means the page did not exist at revision.
+func (s *Server) holdRestore(r *http.Request, pagepath, revision, message string) (int64, bool, error) {
+	old, err := wiki.NewPage(r.Context(), s.Storage, s.Config, pagepath, revision)
+	if err != nil {
+		return 0, false, err
+	}
+	if revision == "" || !old.Exists {
+		return 0, false, storage.ErrNotFound
+	}
+	if message == "" {
+		message = "Restored " + old.Pagename + " to revision " + revision
+	}
+	current := ""
+	if page, err := wiki.NewPage(r.Context(), s.Storage, s.Config, pagepath, ""); err != nil {
+		return 0, false, err
+	} else if page.Exists && page.Metadata != nil {
+		current = page.Metadata.Revision
+	}
+	sub := spam.Submission{Kind: spam.KindPage, Target: pagepath, Content: old.Content}
+	return s.holdForModeration(r, sub, moderationPayload{Message: message, Revision: current})
+}
+
+// errReviewConflict is the error of approving a page save made on a
+// revision the page has since moved on from.
+var errReviewConflict = errors.New("the page has changed since this edit was proposed")
+
+// requireReviewer lets through the users who may moderate contributions:
+// approved users and admins.
+func (s *Server) requireReviewer(w http.ResponseWriter, r *http.Request) bool {
+	user := middleware.GetUser(r)
+	if !user.IsAuthenticated() {
+		http.Redirect(w, r, "/-/login?next="+r.URL.Path, http.StatusFound)
+		return false
+	}
+	if !user.Approved() && !user.Admin() {
+		s.renderError(w, r, http.StatusForbidden, "Access denied")
+		return false
+	}
+	return true
+}
+
+// handleModeration lists the contributions awaiting moderation.
+func (s *Server) handleModeration(w http.ResponseWriter, r *http.Request) {
+	if !s.requireReviewer(w, r) {
+		return
+	}
+
+	items, err := s.DB.ListModeration(r.Context())
+	if err != nil {
+		s.renderError(w, r, http.StatusInternalServerError, "Failed to list the moderation queue")
+		return
+	}
+
+	data := NewGenericData("Moderation Queue")
+	data["items"] = items
+	s.renderTemplate(w, r, "moderation.html", data)
+}
+
+// handleModerationView shows a held contribution; a page save is shown as
+// a diff against the revision it was made on.
+func (s *Server) handleModerationView(w http.ResponseWriter, r *http.Request) {
+	if !s.requireReviewer(w, r) {
+		return
+	}
+	item, ok := s.moderationItem(w, r)
+	if !ok {
+		return
+	}
+	payload, err := decodeModerationPayload(item)
+	if err != nil {
+		s.renderFailure(w, r, err)
+		return
+	}
+
+	data := NewGenericData(fmt.Sprintf("Moderation #%d", item.ID))
+	data["item"] = item
+	data["payload"] = payload
+	if item.Kind == spam.KindPage {
+		page, err := wiki.NewPage(r.Context(), s.Storage, s.Config, item.Target, "")
+		if err != nil {
+			s.renderFailure(w, r, err)
+			return
+		}
+		// A save held without its revision is shown against the current
+		// version.
+		base := page.Content
+		if payload.Revision != "" {
+			base, err = s.Storage.Load(r.Context(), page.Filename, payload.Revision)
+			if errors.Is(err, storage.ErrNotFound) {
+				base = ""
+			} else if err != nil {
+				s.renderFailure(w, r, err)
+				return
+			}
+		}
+		current := ""
+		if page.Exists && page.Metadata != nil {
+			current = page.Metadata.Revision
+		}
+		data["is_new"] = !page.Exists && payload.Revision == ""
+		data["stale"] = payload.Revision != current && (payload.Revision != "" || page.Exists)
+		data["unchanged"] = base == item.Content
+		data["rows"] = diffRows(base, item.Content, false)
+	}
+	s.renderTemplate(w, r, "moderation_item.html", data)
+}
+
+// handleModerationApprove applies a held contribution as its author made it
+// and removes it from the queue. A page save made on a stale revision is
+// refused unless the form asks to overwrite the changes made since.
+func (s *Server) handleModerationApprove(w http.ResponseWriter, r *http.Request) {
+	if !s.requireReviewer(w, r) {
+		return
+	}
+	item, ok := s.moderationItem(w, r)
+	if !ok {
+		return
+	}
+
+	err := s.applyModeration(r, item, r.FormValue("overwrite") != "")
+	if errors.Is(err, errReviewConflict) {
+		s.SessionManager.AddFlashMessage(w, r, "danger", "The page has changed since this edit was proposed; review it again")
+		http.Redirect(w, r, fmt.Sprintf("/-/moderation/%d", item.ID), http.StatusFound)
+		return
+	}
+	if err != nil {
+		slog.Error("failed to apply moderated contribution", "id", item.ID, "error", err)
+		s.SessionManager.AddFlashMessage(w, r, "danger", "Failed to apply the contribution: "+err.Error())
+		http.Redirect(w, r, "/-/moderation", http.StatusFound)
+		return
+	}
+	if err := s.DB.DeleteModeration(r.Context(), item.ID); err != nil {
+		slog.Error("failed to remove moderated contribution", "id", item.ID, "error", err)
+	}
+
+	user := middleware.GetUser(r)
+	slog.Info("moderated contribution approved", "id", item.ID, "kind", item.Kind, "user", user.GetEmail())
+	s.SessionManager.AddFlashMessage(w, r, "success", "Contribution approved")
+	http.Redirect(w, r, "/-/moderation", http.StatusFound)
+}
+
+// handleModerationReject discards a held contribution.
+func (s *Server) handleModerationReject(w http.ResponseWriter, r *http.Request) {
+	if !s.requireReviewer(w, r) {
+		return
+	}
+	item, ok := s.moderationItem(w, r)
+	if !ok {
+		return
+	}
+
+	if err := s.DB.DeleteModeration(r.Context(), item.ID); err != nil {
+		s.SessionManager.AddFlashMessage(w, r, "danger", "Failed to reject the contribution")
+		http.Redirect(w, r, "/-/moderation", http.StatusFound)
+		return
+	}
+
+	user := middleware.GetUser(r)
+	slog.Info("moderated contribution rejected", "id", item.ID, "kind", item.Kind, "user", user.GetEmail())
+	s.SessionManager.AddFlashMessage(w, r, "success", "Contribution rejected")
+	http.Redirect(w, r, "/-/moderation", http.StatusFound)
+}
+
+// moderationItem loads the queued contribution named by the id URL
+// parameter, answering the request itself when there is none.
+func (s *Server) moderationItem(w http.ResponseWriter, r *http.Request) (db.ModerationItem, bool) {
+	id, err := parseInt64(chi.URLParam(r, "id"))
+	if err != nil {
+		s.renderError(w, r, http.StatusBadRequest, "Invalid ID")
+		return db.ModerationItem{}, false
+	}
+	item, err := s.DB.GetModeration(r.Context(), id)
+	if errors.Is(err, sql.ErrNoRows) {
+		s.renderError(w, r, http.StatusNotFound, "Contribution not found")
+		return db.ModerationItem{}, false
+	}
+	if err != nil {
+		s.renderError(w, r, http.StatusInternalServerError, "Failed to get the contribution")
+		return db.ModerationItem{}, false
+	}
+	return item, true
+}
+
+// decodeModerationPayload returns the payload of item.
+func decodeModerationPayload(item db.ModerationItem) (moderationPayload, error) {
+	var payload moderationPayload
+	if item.Payload == "" {
+		return payload, nil
+	}
+	err := json.Unmarshal([]byte(item.Payload), &payload)
+	return payload, err
+}
+
+// applyModeration makes the page save, issue, or comment item holds. A
+// page save is checked for edit conflicts against the revision it was made
+// on, unless overwrite is set or the wiki lets the last write win.
+func (s *Server) applyModeration(r *http.Request, item db.ModerationItem, overwrite bool) error {
+	ctx := r.Context()
+	payload, err := decodeModerationPayload(item)
+	if err != nil {
+		return err
+	}
+
+	switch item.Kind {
+	case spam.KindPage:
+		base := s.conflictBase(r, payload.Revision)
+		if overwrite {
+			base = ""
+		}
+		author := storage.Author{Name: item.AuthorName, Email: item.AuthorEmail}
+		result, err := s.Wiki.SavePage(ctx, item.Target, item.Content, payload.Message, base, author)
+		if err == nil && result.Conflict {
+			return errReviewConflict
+		}
+		return err
+	case spam.KindIssue:
+		issue, err := s.DB.Queries.CreateIssue(ctx, db.CreateIssueParams{
+			Title:          item.Title,
+			Description:    db.NullString(item.Content),
+			Status:         "open",
+			Category:       db.NullString(payload.Category),
+			Tags:           db.NullString(strings.Join(payload.Tags, ",")),
+			CreatedByName:  db.NullString(item.AuthorName),
+			CreatedByEmail: db.NullString(item.AuthorEmail),
+			CreatedAt:      db.NullTime(item.CreatedAt),
+			UpdatedAt:      db.NullTime(item.CreatedAt),
+		})
+		if err == nil {
+			s.notifyMentions(ctx, issue, 0, item.Content, storage.Author{Name: item.AuthorName, Email: item.AuthorEmail})
+		}
+		return err
+	case spam.KindComment:
+		issueID, err := parseInt64(item.Target)
+		if err != nil {
+			return err
+		}
+		issue, err := s.DB.Queries.GetIssue(ctx, issueID)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return fmt.Errorf("issue #%d no longer exists", issueID)
+			}
+			return err
+		}
+		comment, err := s.DB.Queries.CreateIssueComment(ctx, db.CreateIssueCommentParams{
+			IssueID:     issueID,
+			Content:     item.Content,
+			AuthorName:  db.NullString(item.AuthorName),
+			AuthorEmail: db.NullString(item.AuthorEmail),
+			CreatedAt:   db.NullTime(item.CreatedAt),
+			UpdatedAt:   db.NullTime(item.CreatedAt),
+		})
+		if err == nil {
+			s.notifyMentions(ctx, issue, comment.ID, item.Content, storage.Author{Name: item.AuthorName, Email: item.AuthorEmail})
+		}
+		return err
+	}
+	return fmt.Errorf("unknown contribution kind %q", item.Kind)
+}
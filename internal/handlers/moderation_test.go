@@ -0,0 +1,334 @@
+package handlers_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sa/gopherwiki/internal/handlers"
+	"github.com/sa/gopherwiki/internal/spam"
+	"github.com/sa/gopherwiki/internal/storage"
+	"github.com/sa/gopherwiki/internal/testutil"
+	"github.com/sa/gopherwiki/internal/wiki"
+)
+
+// casinoChecker flags contributions mentioning a casino.
+type casinoChecker struct{}
+
+func (casinoChecker) Name() string { return "casino" }
+
+func (casinoChecker) CheckSpam(ctx context.Context, sub spam.Submission) (spam.Verdict, error) {
+	text := strings.ToLower(sub.Title + " " + sub.Content)
+	return spam.Verdict{Spam: strings.Contains(text, "casino"), Reason: "mentions a casino"}, nil
+}
+
+func TestSpamModeration(t *testing.T) {
+	env := testutil.SetupTestEnv(t)
+	if err := env.Server.Plugins.Register(casinoChecker{}); err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	post := func(path string, form url.Values, cookies []*http.Cookie) *httptest.ResponseRecorder {
+		req := requestWithCookies("POST", path, strings.NewReader(form.Encode()), cookies)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		env.Router.ServeHTTP(w, req)
+		return w
+	}
+	exists := func(path string) bool {
+		page, err := wiki.NewPage(ctx, env.Store, env.Server.Config, path, "")
+		return err == nil && page.Exists
+	}
+
+	// A bot filling in the honeypot is refused outright.
+	w := post("/trapped/save", url.Values{"content": {"# Hi"}, "website": {"http://spam.example"}}, nil)
+	if w.Code != http.StatusBadRequest || exists("trapped") {
+		t.Errorf("honeypot save: status = %d, want %d and no page", w.Code, http.StatusBadRequest)
+	}
+
+	// Flagged anonymous contributions wait in the queue.
+	w = post("/held/save", url.Values{"content": {"# Best casino"}, "commit": {"Add held"}}, nil)
+	if w.Code != http.StatusFound || exists("held") {
+		t.Errorf("flagged save: status = %d, want %d and no page yet", w.Code, http.StatusFound)
+	}
+	w = post("/-/issues/new", url.Values{"title": {"Casino bonus"}, "description": {"Win big"}}, nil)
+	if w.Code != http.StatusFound || w.Header().Get("Location") != "/-/issues" {
+		t.Errorf("flagged issue: status = %d, Location = %q", w.Code, w.Header().Get("Location"))
+	}
+	body := `{"content": "casino", "message": "API"}`
+	if w := apiRequest(t, env, "PUT", "/-/api/v1/pages/held-api", body, nil); w.Code != http.StatusAccepted || exists("held-api") {
+		t.Errorf("flagged API save: status = %d, want %d", w.Code, http.StatusAccepted)
+	}
+
+	// Clean contributions and logged-in users are not held.
+	if w := post("/clean/save", url.Values{"content": {"# Clean"}}, nil); w.Code != http.StatusFound || !exists("clean") {
+		t.Errorf("clean save: status = %d, want the page saved", w.Code)
+	}
+	user := loginAsUser(t, env, "player@example.com")
+	if w := post("/trusted/save", url.Values{"content": {"# Casino night"}, "website": {"x"}}, user); w.Code != http.StatusFound || !exists("trusted") {
+		t.Errorf("logged-in save: status = %d, want the page saved", w.Code)
+	}
+
+	items, err := env.DB.ListModeration(ctx)
+	if err != nil || len(items) != 3 {
+		t.Fatalf("ListModeration = %d items, %v; want 3", len(items), err)
+	}
+	if items[0].Kind != spam.KindPage || items[0].Target != "held" || items[0].Reason != "mentions a casino" {
+		t.Errorf("held page = %+v", items[0])
+	}
+
+	admin := loginAsAdmin(t, env)
+	req := requestWithCookies("GET", "/-/moderation", nil, admin)
+	w = httptest.NewRecorder()
+	env.Router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "Casino bonus") {
+		t.Errorf("moderation queue: status = %d, want it listing the issue", w.Code)
+	}
+	w = post(fmt.Sprintf("/-/moderation/%d/approve", items[0].ID), nil, nil)
+	if w.Code != http.StatusFound || !strings.HasPrefix(w.Header().Get("Location"), "/-/login") || exists("held") {
+		t.Errorf("anonymous approve: status = %d, Location = %q; want a redirect to the login", w.Code, w.Header().Get("Location"))
+	}
+
+	// Approving applies the contribution as its author made it.
+	if w := post(fmt.Sprintf("/-/moderation/%d/approve", items[0].ID), nil, admin); w.Code != http.StatusFound {
+		t.Errorf("approve: status = %d, want %d", w.Code, http.StatusFound)
+	}
+	page, err := wiki.NewPage(ctx, env.Store, env.Server.Config, "held", "")
+	if err != nil || !page.Exists || page.Metadata.AuthorName != items[0].AuthorName || page.Metadata.Message != "Add held" {
+		t.Errorf("approved page = %+v, %v", page, err)
+	}
+	if w := post(fmt.Sprintf("/-/moderation/%d/approve", items[1].ID), nil, admin); w.Code != http.StatusFound {
+		t.Errorf("approve issue: status = %d, want %d", w.Code, http.StatusFound)
+	}
+	if issues, _ := env.DB.Queries.ListIssues(ctx); len(issues) != 1 || issues[0].Title != "Casino bonus" {
+		t.Errorf("issues after approval = %+v", issues)
+	}
+
+	// Rejecting discards it.
+	if w := post(fmt.Sprintf("/-/moderation/%d/reject", items[2].ID), nil, admin); w.Code != http.StatusFound {
+		t.Errorf("reject: status = %d, want %d", w.Code, http.StatusFound)
+	}
+	if n, _ := env.DB.CountModeration(ctx); n != 0 || exists("held-api") {
+		t.Errorf("queue holds %d after moderating all, want 0 and no rejected page", n)
+	}
+}
+
+func TestSpamBlocklistFile(t *testing.T) {
+	env := testutil.SetupTestEnv(t)
+	cfg := *env.Server.Config
+	cfg.SpamBlocklistFile = filepath.Join(t.TempDir(), "missing.txt")
+	if _, err := handlers.NewServer(&cfg, storage.NewMemoryStorage(), env.DB, "test"); err == nil {
+		t.Error("NewServer accepted a missing spam blocklist file")
+	}
+}
+
+func TestReviewEdits(t *testing.T) {
+	env := testutil.SetupTestEnv(t)
+	env.Server.Config.ReviewEdits = "anonymous"
+	ctx := context.Background()
+	author := storage.Author{Name: "Owner", Email: "owner@example.com"}
+	if _, err := env.Store.Store(ctx, "guide.md", "# Guide\n\nFirst line\n", "init", author); err != nil {
+		t.Fatal(err)
+	}
+	guide, err := wiki.NewPage(ctx, env.Store, env.Server.Config, "guide", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	post := func(path string, form url.Values, cookies []*http.Cookie) *httptest.ResponseRecorder {
+		req := requestWithCookies("POST", path, strings.NewReader(form.Encode()), cookies)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		env.Router.ServeHTTP(w, req)
+		return w
+	}
+	content := func(path string) string {
+		page, err := wiki.NewPage(ctx, env.Store, env.Server.Config, path, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return page.Content
+	}
+
+	// An anonymous save is proposed instead of committed.
+	edit := url.Values{"content": {"# Guide\n\nBetter line\n"}, "commit": {"Improve"}, "revision": {guide.Metadata.Revision}}
+	if w := post("/guide/save", edit, nil); w.Code != http.StatusFound || content("guide") != "# Guide\n\nFirst line\n" {
+		t.Fatalf("anonymous save: status = %d, content = %q; want it held", w.Code, content("guide"))
+	}
+	items, err := env.DB.ListModeration(ctx)
+	if err != nil || len(items) != 1 || items[0].Reason != "Proposed for review" {
+		t.Fatalf("ListModeration = %+v, %v; want the proposed edit", items, err)
+	}
+	id := items[0].ID
+
+	// Approved users review it as a diff.
+	reviewer := loginAsUser(t, env, "reviewer@example.com")
+	req := requestWithCookies("GET", fmt.Sprintf("/-/moderation/%d", id), nil, reviewer)
+	w := httptest.NewRecorder()
+	env.Router.ServeHTTP(w, req)
+	body := w.Body.String()
+	if w.Code != http.StatusOK || !strings.Contains(body, `<del>First</del> line`) || !strings.Contains(body, `<ins>Better</ins> line`) {
+		t.Errorf("review: status = %d, want the diff; body:\n%s", w.Code, body)
+	}
+
+	// A reviewer's own save is committed, making the proposal stale.
+	if w := post("/guide/save", url.Values{"content": {"# Guide\n\nOwn line\n"}}, reviewer); w.Code != http.StatusFound || content("guide") != "# Guide\n\nOwn line\n" {
+		t.Fatalf("reviewer save: status = %d, content = %q", w.Code, content("guide"))
+	}
+	w = post(fmt.Sprintf("/-/moderation/%d/approve", id), nil, reviewer)
+	if w.Code != http.StatusFound || w.Header().Get("Location") != fmt.Sprintf("/-/moderation/%d", id) || content("guide") != "# Guide\n\nOwn line\n" {
+		t.Errorf("stale approve: status = %d, Location = %q; want it refused", w.Code, w.Header().Get("Location"))
+	}
+	w = post(fmt.Sprintf("/-/moderation/%d/approve", id), url.Values{"overwrite": {"1"}}, reviewer)
+	if w.Code != http.StatusFound || content("guide") != "# Guide\n\nBetter line\n" {
+		t.Errorf("overwriting approve: status = %d, content = %q", w.Code, content("guide"))
+	}
+	if n, _ := env.DB.CountModeration(ctx); n != 0 {
+		t.Errorf("queue holds %d after approval, want 0", n)
+	}
+}
+
+func TestReviewEditsEveryWrite(t *testing.T) {
+	env := testutil.SetupTestEnv(t)
+	env.Server.Config.ReviewEdits = "anonymous"
+	env.Server.Config.WebDAVEnabled = true
+	router := env.Server.Routes()
+	ctx := context.Background()
+	author := storage.Author{Name: "Owner", Email: "owner@example.com"}
+	if _, err := env.Store.Store(ctx, "guide.md", "# Guide\n\nFirst\n", "init", author); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := env.Store.Store(ctx, "guide.md", "# Guide\n\n- [ ] Task\n", "tasks", author); err != nil {
+		t.Fatal(err)
+	}
+	log, err := env.Store.Log(ctx, "guide.md", 0)
+	if err != nil || len(log) != 2 {
+		t.Fatalf("Log = %+v, %v", log, err)
+	}
+	oldest := log[1].Revision
+	const current = "# Guide\n\n- [ ] Task\n"
+
+	do := func(method, path, contentType, body string, headers map[string]string) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		if contentType != "" {
+			req.Header.Set("Content-Type", contentType)
+		}
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+	form := "application/x-www-form-urlencoded"
+	queued := func() int {
+		n, err := env.DB.CountModeration(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return int(n)
+	}
+
+	// Writes that carry a page's new content are proposed for review.
+	for _, tc := range []struct {
+		name                string
+		method, path, ctype string
+		body                string
+		status              int
+	}{
+		{"WebDAV PUT", "PUT", "/-/dav/guide.md", "", "# Guide\n\nVia WebDAV\n", http.StatusAccepted},
+		{"restore", "POST", "/guide/restore", form, url.Values{"revision": {oldest}}.Encode(), http.StatusFound},
+		{"API restore", "POST", "/-/api/v1/pages/guide/restore", "application/json", `{"revision": "` + oldest + `"}`, http.StatusAccepted},
+	} {
+		before := queued()
+		if w := do(tc.method, tc.path, tc.ctype, tc.body, nil); w.Code != tc.status {
+			t.Errorf("%s: status = %d, want %d: %s", tc.name, w.Code, tc.status, w.Body.String())
+		}
+		if queued() != before+1 {
+			t.Errorf("%s was not held for review", tc.name)
+		}
+	}
+
+	// Those that cannot be proposed are refused.
+	for _, tc := range []struct {
+		name                string
+		method, path, ctype string
+		body                string
+		headers             map[string]string
+	}{
+		{"task toggle", "POST", "/guide/task", form, url.Values{"line": {"3"}, "done": {"true"}}.Encode(), nil},
+		{"rename", "POST", "/guide/rename", form, url.Values{"new_pagename": {"manual"}}.Encode(), nil},
+		{"delete", "POST", "/guide/delete", form, "", nil},
+		{"attachment upload", "POST", "/guide/attachments", "multipart/form-data; boundary=x", "--x--\r\n", nil},
+		{"API delete", "DELETE", "/-/api/v1/pages/guide", "", "", nil},
+		{"WebDAV DELETE", "DELETE", "/-/dav/guide.md", "", "", nil},
+		{"WebDAV MOVE", "MOVE", "/-/dav/guide.md", "", "", map[string]string{"Destination": "/-/dav/manual.md"}},
+		{"WebDAV attachment PUT", "PUT", "/-/dav/guide/file.txt", "", "data", nil},
+	} {
+		if w := do(tc.method, tc.path, tc.ctype, tc.body, tc.headers); w.Code != http.StatusForbidden {
+			t.Errorf("%s: status = %d, want %d", tc.name, w.Code, http.StatusForbidden)
+		}
+	}
+
+	page, err := wiki.NewPage(ctx, env.Store, env.Server.Config, "guide", "")
+	if err != nil || page.Content != current {
+		t.Errorf("guide after the refused writes = %q, %v; want it unchanged", page.Content, err)
+	}
+	if files, _, _ := env.Store.List(ctx, "", nil, nil); len(files) != 1 {
+		t.Errorf("repository holds %v, want only guide.md", files)
+	}
+
+	// Reverting a commit needs an account, so it is refused to users who are
+	// not approved when REVIEW_EDITS covers them.
+	env.Server.Config.ReviewEdits = "untrusted"
+	cookies := loginAsUser(t, env, "unapproved@example.com")
+	user, err := env.DB.Queries.GetUserByEmail(ctx, "unapproved@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := env.DB.Conn().ExecContext(ctx, `UPDATE "user" SET is_approved = 0 WHERE id = ?`, user.ID); err != nil {
+		t.Fatal(err)
+	}
+	req := requestWithCookies("POST", "/-/commit/"+log[0].Revision+"/revert", strings.NewReader(""), cookies)
+	req.Header.Set("Content-Type", form)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusForbidden {
+		t.Errorf("revert by an unapproved user: status = %d, want %d", w.Code, http.StatusForbidden)
+	}
+}
+
+func TestWebDAVSpamScreening(t *testing.T) {
+	env := testutil.SetupTestEnv(t)
+	if err := env.Server.Plugins.Register(casinoChecker{}); err != nil {
+		t.Fatal(err)
+	}
+	env.Server.Config.WebDAVEnabled = true
+	router := env.Server.Routes()
+
+	put := func(path, body string) int {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("PUT", path, strings.NewReader(body)))
+		return w.Code
+	}
+	if code := put("/-/dav/held.md", "# Best casino\n"); code != http.StatusAccepted {
+		t.Errorf("flagged anonymous PUT: status = %d, want %d", code, http.StatusAccepted)
+	}
+	if code := put("/-/dav/fine.md", "# Fine\n"); code != http.StatusCreated {
+		t.Errorf("anonymous PUT: status = %d, want %d", code, http.StatusCreated)
+	}
+	ctx := context.Background()
+	if page, _ := wiki.NewPage(ctx, env.Store, env.Server.Config, "held", ""); page == nil || page.Exists {
+		t.Error("a flagged WebDAV PUT was committed")
+	}
+	if page, _ := wiki.NewPage(ctx, env.Store, env.Server.Config, "fine", ""); page == nil || page.Content != "# Fine\n" {
+		t.Errorf("the screened WebDAV PUT lost its content: %+v", page)
+	}
+}
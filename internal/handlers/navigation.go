@@ -0,0 +1,169 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/sa/gopherwiki/internal/cluster"
+	"github.com/sa/gopherwiki/internal/db"
+	"github.com/sa/gopherwiki/internal/middleware"
+)
+
+// navigationPreferenceKey holds the sidebar menu admins set, as JSON.
+const navigationPreferenceKey = "navigation"
+
+// maxNavigationDepth is the number of levels a menu may nest.
+const maxNavigationDepth = 3
+
+// navItem is an entry of the sidebar menu, shown to those with permission,
+// or to everyone when it is empty. An entry with children may have no URL,
+// heading them.
+type navItem struct {
+	Label      string    `json:"label"`
+	URL        string    `json:"url,omitempty"`
+	Icon       string    `json:"icon,omitempty"`       // Font Awesome classes, e.g. "fas fa-home"
+	Permission string    `json:"permission,omitempty"` // "read", "write", "upload", or "admin"
+	Account    bool      `json:"account,omitempty"`    // Only for logged-in users
+	Children   []navItem `json:"children,omitempty"`
+	Badge      int64     `json:"-"` // Unread notifications of the Notifications entry
+}
+
+// defaultNavigation is the sidebar menu until admins set one.
+var defaultNavigation = []navItem{
+	{Label: "Home", URL: "/", Icon: "fas fa-home"},
+	{Label: "A - Z", URL: "/-/pageindex", Icon: "fas fa-list"},
+	{Label: "Changelog", URL: "/-/changelog", Icon: "fas fa-history"},
+	{Label: "Issues", URL: "/-/issues", Icon: "fas fa-tasks"},
+	{Label: "Tasks", URL: "/-/tasks", Icon: "far fa-check-square"},
+	{Label: "Notifications", URL: "/-/notifications", Icon: "far fa-bell", Account: true},
+	{Label: "Bookmarks", URL: "/-/bookmarks", Icon: "far fa-star", Account: true},
+	{Label: "Create page", URL: "/-/create", Icon: "far fa-file", Permission: middleware.PermissionWrite},
+	{Label: "Admin", URL: "/-/admin", Icon: "fas fa-cog", Permission: middleware.PermissionAdmin},
+}
+
+// errInvalidNavigation is wrapped by the errors of parseNavigation.
+var errInvalidNavigation = errors.New("invalid menu")
+
+// parseNavigation decodes and checks a menu given as JSON.
+func parseNavigation(value string) ([]navItem, error) {
+	var items []navItem
+	if err := json.Unmarshal([]byte(value), &items); err != nil {
+		return nil, fmt.Errorf("%w: %v", errInvalidNavigation, err)
+	}
+	if err := validateNavigation(items, 1); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+func validateNavigation(items []navItem, depth int) error {
+	if depth > maxNavigationDepth && len(items) > 0 {
+		return fmt.Errorf("%w: menus nest at most %d levels", errInvalidNavigation, maxNavigationDepth)
+	}
+	for _, item := range items {
+		if strings.TrimSpace(item.Label) == "" {
+			return fmt.Errorf("%w: every entry needs a label", errInvalidNavigation)
+		}
+		if item.URL == "" && len(item.Children) == 0 {
+			return fmt.Errorf("%w: %q needs a URL or entries under it", errInvalidNavigation, item.Label)
+		}
+		if item.URL != "" && !validNavigationURL(item.URL) {
+			return fmt.Errorf("%w: %q must link to a path of the wiki or an http or https URL, got %q", errInvalidNavigation, item.Label, item.URL)
+		}
+		switch item.Permission {
+		case "", middleware.PermissionRead, middleware.PermissionWrite, middleware.PermissionUpload, middleware.PermissionAdmin:
+		default:
+			return fmt.Errorf("%w: permission of %q must be read, write, upload, or admin, got %q", errInvalidNavigation, item.Label, item.Permission)
+		}
+		if err := validateNavigation(item.Children, depth+1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validNavigationURL reports whether a menu entry may link to u: a path of
+// the wiki, or an http or https URL.
+func validNavigationURL(u string) bool {
+	if strings.HasPrefix(u, "/") {
+		return !strings.HasPrefix(u, "//") && !strings.HasPrefix(u, "/\\")
+	}
+	parsed, err := url.Parse(u)
+	return err == nil && (parsed.Scheme == "http" || parsed.Scheme == "https") && parsed.Host != ""
+}
+
+// visibleNavigation returns the entries of items the request may see,
+// leaving out headings with no entry left under them.
+func (s *Server) visibleNavigation(r *http.Request, items []navItem, unread int64) []navItem {
+	user := middleware.GetUser(r)
+	var visible []navItem
+	for _, item := range items {
+		if (item.Account && !user.IsAuthenticated()) ||
+			(item.Permission != "" && !s.PermissionChecker.HasPermission(r, item.Permission)) {
+			continue
+		}
+		item.Children = s.visibleNavigation(r, item.Children, unread)
+		if item.URL == "" && len(item.Children) == 0 {
+			continue
+		}
+		if item.URL == "/-/notifications" {
+			item.Badge = unread
+		}
+		visible = append(visible, item)
+	}
+	return visible
+}
+
+// handleAdminNavigationSave saves the sidebar menu, given as JSON, or
+// restores the default one.
+func (s *Server) handleAdminNavigationSave(w http.ResponseWriter, r *http.Request) {
+	if !s.requireAdmin(w, r) {
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		s.renderError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	ctx := r.Context()
+	value := ""
+	if r.FormValue("reset") == "" {
+		items, err := parseNavigation(r.FormValue("navigation"))
+		if err != nil {
+			s.SessionManager.AddFlashMessage(w, r, "danger", "Failed to save the menu: "+err.Error())
+			http.Redirect(w, r, "/-/admin/settings#navigation", http.StatusFound)
+			return
+		}
+		encoded, _ := json.Marshal(items)
+		value = string(encoded)
+	}
+	var err error
+	if value == "" {
+		err = s.DB.Queries.DeletePreference(ctx, navigationPreferenceKey)
+	} else {
+		err = s.DB.Queries.UpsertPreference(ctx, db.UpsertPreferenceParams{
+			Name:  navigationPreferenceKey,
+			Value: db.NullString(value),
+		})
+	}
+	if err != nil {
+		slog.Error("failed to save the menu", "error", err)
+		s.SessionManager.AddFlashMessage(w, r, "danger", "Failed to save the menu")
+		http.Redirect(w, r, "/-/admin/settings#navigation", http.StatusFound)
+		return
+	}
+
+	s.InvalidateSiteSettingsCache()
+	s.publish(ctx, cluster.TopicSettings)
+	if value == "" {
+		s.SessionManager.AddFlashMessage(w, r, "success", "Menu reset to the default")
+	} else {
+		s.SessionManager.AddFlashMessage(w, r, "success", "Menu saved")
+	}
+	http.Redirect(w, r, "/-/admin/settings#navigation", http.StatusFound)
+}
@@ -0,0 +1,92 @@
+package handlers_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/sa/gopherwiki/internal/testutil"
+)
+
+func TestNavigation(t *testing.T) {
+	env := testutil.SetupTestEnv(t)
+	admin := loginAsAdmin(t, env)
+	// menu returns the sidebar menu of the page index.
+	menu := func(cookies []*http.Cookie) string {
+		t.Helper()
+		body := apiGet(t, env, "/-/pageindex", cookies).Body.String()
+		start := strings.Index(body, `class="sidebar-menu`)
+		if start < 0 {
+			t.Fatalf("no sidebar menu:\n%s", body)
+		}
+		body = body[start:]
+		return body[:strings.Index(body, "</aside>")]
+	}
+	save := func(form url.Values) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest("POST", "/-/admin/navigation", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		for _, c := range admin {
+			req.AddCookie(c)
+		}
+		w := httptest.NewRecorder()
+		env.Router.ServeHTTP(w, req)
+		if w.Code != http.StatusFound {
+			t.Fatalf("save menu: status = %d", w.Code)
+		}
+		return w
+	}
+
+	// The default menu shows each entry to those who may use it.
+	anonymous := menu(nil)
+	if !strings.Contains(anonymous, `href="/-/pageindex"`) || strings.Contains(anonymous, `href="/-/admin"`) ||
+		strings.Contains(anonymous, `href="/-/bookmarks"`) {
+		t.Errorf("anonymous default menu:\n%s", anonymous)
+	}
+	if m := menu(admin); !strings.Contains(m, `href="/-/admin"`) || !strings.Contains(m, `href="/-/bookmarks"`) {
+		t.Errorf("admin default menu:\n%s", m)
+	}
+
+	save(url.Values{"navigation": {`[
+		{"label": "Start", "url": "/", "icon": "fas fa-home"},
+		{"label": "Handbook", "children": [
+			{"label": "Onboarding", "url": "/handbook/onboarding"},
+			{"label": "Staff only", "url": "/handbook/staff", "permission": "admin"}
+		]},
+		{"label": "Secrets", "children": [{"label": "Vault", "url": "/vault", "account": true}]},
+		{"label": "Status", "url": "https://status.example.com"}
+	]`}})
+	anonymous = menu(nil)
+	for _, want := range []string{`href="/handbook/onboarding"`, "Handbook", `href="https://status.example.com"`, `<i class="fas fa-home">`} {
+		if !strings.Contains(anonymous, want) {
+			t.Errorf("anonymous menu lacks %s:\n%s", want, anonymous)
+		}
+	}
+	// Entries the visitor may not use are left out, with the headings
+	// left empty.
+	for _, unwanted := range []string{"Staff only", "Secrets", `href="/-/pageindex"`} {
+		if strings.Contains(anonymous, unwanted) {
+			t.Errorf("anonymous menu shows %s:\n%s", unwanted, anonymous)
+		}
+	}
+	if m := menu(admin); !strings.Contains(m, `href="/handbook/staff"`) || !strings.Contains(m, `href="/vault"`) {
+		t.Errorf("admin menu:\n%s", m)
+	}
+
+	// An invalid menu is not saved.
+	for _, invalid := range []string{`[{"label": "x"}]`, `[{"label": "x", "url": "javascript:alert(1)"}]`,
+		`[{"label": "x", "url": "/", "permission": "root"}]`, `{"label"`} {
+		save(url.Values{"navigation": {invalid}})
+	}
+	if m := menu(admin); !strings.Contains(m, `href="/handbook/staff"`) {
+		t.Errorf("menu after invalid saves:\n%s", m)
+	}
+
+	// Resetting restores the default menu.
+	save(url.Values{"reset": {"1"}})
+	if m := menu(admin); !strings.Contains(m, `href="/-/pageindex"`) || strings.Contains(m, "Handbook") {
+		t.Errorf("menu after reset:\n%s", m)
+	}
+}
@@ -0,0 +1,245 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/sa/gopherwiki/internal/db"
+	"github.com/sa/gopherwiki/internal/middleware"
+	"github.com/sa/gopherwiki/internal/storage"
+)
+
+// notificationListLimit is how many notifications the notifications page
+// shows.
+const notificationListLimit = 100
+
+// notificationExcerptLength is how many characters of the mentioning text
+// a notification keeps.
+const notificationExcerptLength = 200
+
+// mentionEmailTimeout bounds the delivery of a notification email, which
+// outlives the request or job that caused it.
+const mentionEmailTimeout = time.Minute
+
+var (
+	// mentionPattern matches @name and @user@example.com, but not the
+	// domain of an email address written in the text.
+	mentionPattern = regexp.MustCompile(`(?:^|[^\w.@])@([\w.+-]+(?:@[\w-]+(?:\.[\w-]+)+)?)`)
+	// mentionCodePattern matches code spans and fences, whose @s are not
+	// mentions.
+	mentionCodePattern = regexp.MustCompile("(?s)```.*?```|`[^`\n]*`")
+)
+
+// parseMentions returns the names and email addresses text mentions,
+// lowercased and without duplicates, in the order they appear.
+func parseMentions(text string) []string {
+	text = mentionCodePattern.ReplaceAllString(text, " ")
+	var mentions []string
+	seen := make(map[string]bool)
+	for _, m := range mentionPattern.FindAllStringSubmatch(text, -1) {
+		token := strings.ToLower(strings.TrimRight(m[1], ".-"))
+		if token == "" || seen[token] {
+			continue
+		}
+		seen[token] = true
+		mentions = append(mentions, token)
+	}
+	return mentions
+}
+
+// resolveMentions returns the users the mentions name. A mention is a
+// user's email address, their name without spaces, or the part of their
+// email address before the @; one that fits several users names none.
+func (s *Server) resolveMentions(ctx context.Context, mentions []string) ([]db.User, error) {
+	if len(mentions) == 0 {
+		return nil, nil
+	}
+	users, err := s.Users.Queries.ListUsers(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var resolved []db.User
+	seen := make(map[int64]bool)
+	for _, mention := range mentions {
+		var matches []db.User
+		for _, u := range users {
+			local, _, _ := strings.Cut(u.Email, "@")
+			switch {
+			case strings.Contains(mention, "@"):
+				if strings.EqualFold(u.Email, mention) {
+					matches = append(matches, u)
+				}
+			case strings.EqualFold(strings.ReplaceAll(u.Name, " ", ""), mention), strings.EqualFold(local, mention):
+				matches = append(matches, u)
+			}
+		}
+		if len(matches) == 1 && !seen[matches[0].ID] {
+			seen[matches[0].ID] = true
+			resolved = append(resolved, matches[0])
+		}
+	}
+	return resolved, nil
+}
+
+// notifyMentions notifies the users text mentions that actor mentioned
+// them in issue, in its description or, if commentID is set, a comment.
+// Failures are logged: the contribution has been made either way.
+func (s *Server) notifyMentions(ctx context.Context, issue db.Issue, commentID int64, text string, actor storage.Author) {
+	users, err := s.resolveMentions(ctx, parseMentions(text))
+	if err != nil {
+		slog.Warn("failed to resolve mentions", "issue", issue.ID, "error", err)
+		return
+	}
+
+	n := db.Notification{
+		Kind:      db.NotificationMention,
+		IssueID:   issue.ID,
+		CommentID: commentID,
+		Title:     issue.Title,
+		Excerpt:   notificationExcerpt(text),
+		ActorName: actor.Name,
+		CreatedAt: time.Now(),
+	}
+	for _, u := range users {
+		if actor.Email != "" && strings.EqualFold(u.Email, actor.Email) {
+			continue
+		}
+		n.UserID = u.ID
+		if _, err := s.DB.CreateNotification(ctx, n); err != nil {
+			slog.Warn("failed to record mention", "issue", issue.ID, "user", u.Email, "error", err)
+			continue
+		}
+		s.emailMention(ctx, u, n)
+	}
+}
+
+// emailMention emails u about the mention n in the background, unless the
+// wiki sends no mail or u turned notification emails off.
+func (s *Server) emailMention(ctx context.Context, u db.User, n db.Notification) {
+	siteURL := s.Settings.Get(ctx).SiteURL
+	subject := fmt.Sprintf("[%s] %s mentioned you in #%d: %s", s.getSiteSettings(ctx).Name, n.ActorName, n.IssueID, n.Title)
+	body := fmt.Sprintf("%s mentioned you in issue #%d: %s\n\n%s\n\n%s%s\n\nYou can turn these emails off in your settings: %s/-/settings\n",
+		n.ActorName, n.IssueID, n.Title, n.Excerpt, siteURL, notificationLink(n), siteURL)
+	s.emailNotification(ctx, u, subject, body)
+}
+
+// emailNotification sends u a notification email in the background,
+// unless the wiki sends no mail or u turned notification emails off.
+func (s *Server) emailNotification(ctx context.Context, u db.User, subject, body string) {
+	if s.Mailer == nil {
+		return
+	}
+	if pref, err := s.Users.GetUserPreference(ctx, u.ID, db.UserPrefEmailNotifications); err != nil {
+		slog.Warn("failed to load notification preference", "user", u.Email, "error", err)
+		return
+	} else if pref == "off" {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), mentionEmailTimeout)
+	go func() {
+		defer cancel()
+		if err := s.Mailer.Send(ctx, u.Email, subject, body); err != nil {
+			slog.Warn("failed to email notification", "user", u.Email, "subject", subject, "error", err)
+		}
+	}()
+}
+
+// notificationExcerpt returns the start of text on one line.
+func notificationExcerpt(text string) string {
+	text = strings.Join(strings.Fields(text), " ")
+	if utf8.RuneCountInString(text) <= notificationExcerptLength {
+		return text
+	}
+	runes := []rune(text)
+	return strings.TrimSpace(string(runes[:notificationExcerptLength])) + "…"
+}
+
+// notificationLink returns where a notification points.
+func notificationLink(n db.Notification) string {
+	if n.Kind == db.NotificationStalePage {
+		return "/" + n.Pagepath
+	}
+	if n.CommentID != 0 {
+		return fmt.Sprintf("/-/issues/%d#comment-%d", n.IssueID, n.CommentID)
+	}
+	return fmt.Sprintf("/-/issues/%d", n.IssueID)
+}
+
+// unreadNotifications returns how many notifications the logged-in user of
+// r has not opened.
+func (s *Server) unreadNotifications(r *http.Request) int64 {
+	user := middleware.GetUser(r)
+	n, err := s.DB.CountUnreadNotifications(r.Context(), user.ID)
+	if err != nil {
+		slog.Warn("failed to count notifications", "user", user.GetEmail(), "error", err)
+	}
+	return n
+}
+
+// handleNotifications lists the logged-in user's notifications.
+func (s *Server) handleNotifications(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetUser(r)
+	if !user.IsAuthenticated() {
+		http.Redirect(w, r, "/-/login", http.StatusFound)
+		return
+	}
+
+	list, err := s.DB.ListNotifications(r.Context(), user.ID, notificationListLimit)
+	if err != nil {
+		s.renderError(w, r, http.StatusInternalServerError, "Failed to load notifications")
+		return
+	}
+
+	data := NewGenericData("Notifications")
+	data["notifications"] = list
+	s.renderTemplate(w, r, "notifications.html", data)
+}
+
+// handleNotificationOpen marks a notification read and redirects to what
+// it points at.
+func (s *Server) handleNotificationOpen(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetUser(r)
+	if !user.IsAuthenticated() {
+		http.Redirect(w, r, "/-/login", http.StatusFound)
+		return
+	}
+	id, err := parseInt64(chi.URLParam(r, "id"))
+	if err != nil {
+		s.renderError(w, r, http.StatusBadRequest, "Invalid notification ID")
+		return
+	}
+
+	n, err := s.DB.GetNotification(r.Context(), user.ID, id)
+	if err != nil {
+		s.renderError(w, r, http.StatusNotFound, "Notification not found")
+		return
+	}
+	if err := s.DB.MarkNotificationRead(r.Context(), user.ID, id); err != nil {
+		slog.Warn("failed to mark notification read", "id", id, "error", err)
+	}
+	http.Redirect(w, r, notificationLink(n), http.StatusFound)
+}
+
+// handleNotificationsRead marks all of the logged-in user's notifications
+// read.
+func (s *Server) handleNotificationsRead(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetUser(r)
+	if !user.IsAuthenticated() {
+		http.Redirect(w, r, "/-/login", http.StatusFound)
+		return
+	}
+	if err := s.DB.MarkAllNotificationsRead(r.Context(), user.ID); err != nil {
+		s.SessionManager.AddFlashMessage(w, r, "danger", "Failed to mark notifications read")
+	}
+	http.Redirect(w, r, "/-/notifications", http.StatusFound)
+}
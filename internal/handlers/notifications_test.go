@@ -0,0 +1,133 @@
+package handlers_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sa/gopherwiki/internal/db"
+	"github.com/sa/gopherwiki/internal/testutil"
+)
+
+// sentMail is a message given to a fakeMailer.
+type sentMail struct {
+	to, subject, body string
+}
+
+// fakeMailer hands the messages it is given to a channel.
+type fakeMailer chan sentMail
+
+func (m fakeMailer) Send(ctx context.Context, to, subject, body string) error {
+	m <- sentMail{to, subject, body}
+	return nil
+}
+
+func TestMentionNotifications(t *testing.T) {
+	env := testutil.SetupTestEnv(t)
+	mailer := make(fakeMailer, 10)
+	env.Server.Mailer = mailer
+	ctx := context.Background()
+
+	alice := loginAsUser(t, env, "alice@example.com")
+	bob := loginAsUser(t, env, "bob@example.com")
+	carol := testutil.CreateTestUser(t, env.DB, testutil.UserOpts{Name: "Carol Jones", Email: "carol@example.org", Approved: true, AllowRead: true})
+
+	post := func(path string, form url.Values, cookies []*http.Cookie) *httptest.ResponseRecorder {
+		req := requestWithCookies("POST", path, strings.NewReader(form.Encode()), cookies)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		env.Router.ServeHTTP(w, req)
+		return w
+	}
+	get := func(path string, cookies []*http.Cookie) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		env.Router.ServeHTTP(w, requestWithCookies("GET", path, nil, cookies))
+		return w
+	}
+
+	// Mentions by email local part and by name are notified; one of the
+	// author, an address in the text, and one in code are not.
+	description := "Hey @alice and @CarolJones, see `@bob` and mail bob@example.com. Thanks, @bob"
+	w := post("/-/issues/new", url.Values{"title": {"Broken links"}, "description": {description}}, bob)
+	if w.Code != http.StatusFound {
+		t.Fatalf("create issue: status = %d, want %d", w.Code, http.StatusFound)
+	}
+	var issueID int64
+	fmt.Sscanf(w.Header().Get("Location"), "/-/issues/%d", &issueID)
+
+	list, err := env.DB.ListNotifications(ctx, carol.ID, 10)
+	if err != nil || len(list) != 1 || list[0].IssueID != issueID || list[0].Title != "Broken links" || list[0].ActorName != "Test User" {
+		t.Errorf("Carol's notifications = %+v, %v", list, err)
+	}
+	bobUser, _ := env.DB.Queries.GetUserByEmail(ctx, "bob@example.com")
+	if n, _ := env.DB.CountUnreadNotifications(ctx, bobUser.ID); n != 0 {
+		t.Errorf("the author has %d notifications, want none", n)
+	}
+
+	// Both mentioned users are emailed.
+	got := map[string]sentMail{}
+	for range 2 {
+		select {
+		case m := <-mailer:
+			got[m.to] = m
+		case <-time.After(5 * time.Second):
+			t.Fatalf("emails sent = %v, want two", got)
+		}
+	}
+	if m := got["alice@example.com"]; !strings.Contains(m.subject, "mentioned you in #") || !strings.Contains(m.body, fmt.Sprintf("/-/issues/%d", issueID)) {
+		t.Errorf("email to Alice = %+v", m)
+	}
+
+	// A comment mention links to the comment, and a user who turned
+	// emails off is not emailed.
+	if w := post("/-/settings", url.Values{"action": {"update_notifications"}}, alice); w.Code != http.StatusFound {
+		t.Fatalf("update notifications: status = %d", w.Code)
+	}
+	if w := post(fmt.Sprintf("/-/issues/%d/comment", issueID), url.Values{"content": {"@alice@example.com fixed?"}}, bob); w.Code != http.StatusFound {
+		t.Fatalf("comment: status = %d", w.Code)
+	}
+	select {
+	case m := <-mailer:
+		t.Errorf("emailed %s after they turned emails off", m.to)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	// The layout shows the unread count, and the page lists them.
+	w = get("/-/notifications", alice)
+	body := w.Body.String()
+	if w.Code != http.StatusOK || !strings.Contains(body, `<span class="badge badge-primary">2</span>`) || !strings.Contains(body, "a comment on issue #") {
+		t.Errorf("notifications page: status = %d; body:\n%s", w.Code, body)
+	}
+
+	aliceUser, _ := env.DB.Queries.GetUserByEmail(ctx, "alice@example.com")
+	list, _ = env.DB.ListNotifications(ctx, aliceUser.ID, 10)
+	if len(list) != 2 || list[0].CommentID == 0 {
+		t.Fatalf("Alice's notifications = %+v, want the comment mention first", list)
+	}
+	if w := get(fmt.Sprintf("/-/notifications/%d", list[0].ID), bob); w.Code != http.StatusNotFound {
+		t.Errorf("opening another user's notification: status = %d, want %d", w.Code, http.StatusNotFound)
+	}
+	w = get(fmt.Sprintf("/-/notifications/%d", list[0].ID), alice)
+	if want := fmt.Sprintf("/-/issues/%d#comment-%d", issueID, list[0].CommentID); w.Code != http.StatusFound || w.Header().Get("Location") != want {
+		t.Errorf("open notification: status = %d, Location = %q; want %q", w.Code, w.Header().Get("Location"), want)
+	}
+	if n, _ := env.DB.CountUnreadNotifications(ctx, aliceUser.ID); n != 1 {
+		t.Errorf("unread after opening one = %d, want 1", n)
+	}
+	post("/-/notifications/read", nil, alice)
+	if n, _ := env.DB.CountUnreadNotifications(ctx, aliceUser.ID); n != 0 {
+		t.Errorf("unread after marking all read = %d, want 0", n)
+	}
+
+	if w := get("/-/notifications", nil); w.Code != http.StatusFound {
+		t.Errorf("anonymous notifications page: status = %d, want a redirect", w.Code)
+	}
+	if list, _ := env.DB.ListNotifications(ctx, aliceUser.ID, 10); len(list) == 0 || list[0].Kind != db.NotificationMention {
+		t.Errorf("notification kind = %+v", list)
+	}
+}
@@ -0,0 +1,140 @@
+package handlers
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/sa/gopherwiki/internal/checks"
+	"github.com/sa/gopherwiki/internal/db"
+	"github.com/sa/gopherwiki/internal/plugin"
+	"github.com/sa/gopherwiki/internal/wiki"
+)
+
+// checkingHooks are the save hooks of the server: the plugins', and the
+// page checks run on each save that made a commit.
+type checkingHooks struct {
+	*plugin.Registry
+	s *Server
+}
+
+// AfterSave runs the plugins' AfterSave hooks, then checks the page.
+func (h checkingHooks) AfterSave(ctx context.Context, ev wiki.SaveEvent) {
+	h.Registry.AfterSave(ctx, ev)
+	if ev.Changed {
+		h.s.checkPage(ctx, ev.Pagepath)
+	}
+}
+
+// pageCheckers returns the checks run on saved pages: the built-in ones,
+// the spellcheck when SPELLCHECK_COMMAND is set, and the plugins'.
+func (s *Server) pageCheckers(ctx context.Context) []checks.Checker {
+	pages := make(map[string]bool)
+	if infos, err := s.Wiki.PageInfos(ctx); err != nil {
+		slog.Warn("failed to list pages for the link check", "error", err)
+	} else {
+		for _, p := range infos {
+			pages[s.pageCheckKey(p.Path)] = true
+		}
+	}
+	exists := func(pagepath, from string) bool {
+		if pages[s.pageCheckKey(pagepath)] {
+			return true
+		}
+		if s.Config.ObsidianCompat {
+			_, ok := s.Wiki.ResolvePage(pagepath, from)
+			return ok
+		}
+		return false
+	}
+
+	checkers := []checks.Checker{
+		checks.Links{Exists: exists, RetainCase: s.Config.RetainPageNameCase},
+		checks.AltText{},
+		checks.Headings{},
+	}
+	if s.Config.SpellcheckCommand != "" {
+		checkers = append(checkers, checks.Spelling{Command: s.Config.SpellcheckCommand})
+	}
+	return append(checkers, s.Plugins.Checkers()...)
+}
+
+// pageCheckKey returns the key that page paths are compared by in the
+// link check: the path, lowercased unless page names keep their case.
+func (s *Server) pageCheckKey(pagepath string) string {
+	if s.Config.RetainPageNameCase {
+		return pagepath
+	}
+	return strings.ToLower(pagepath)
+}
+
+// checkPage runs the page checks on the current revision of the page at
+// pagepath and records their findings. Failures are logged, leaving the
+// revision unchecked.
+func (s *Server) checkPage(ctx context.Context, pagepath string) {
+	page, err := wiki.NewPage(ctx, s.Storage, s.Config, pagepath, "")
+	if err != nil || !page.Exists || page.Metadata == nil {
+		slog.Warn("failed to load page to check", "path", pagepath, "error", err)
+		return
+	}
+	now := time.Now()
+	var found []db.PageCheck
+	for _, f := range checks.Run(ctx, checks.Page{Path: page.Pagepath, Content: page.Content}, s.pageCheckers(ctx)) {
+		found = append(found, db.PageCheck{
+			Pagepath:  page.Pagepath,
+			Revision:  page.Metadata.RevisionFull,
+			Check:     f.Check,
+			Line:      f.Line,
+			Message:   f.Message,
+			CheckedAt: now,
+		})
+	}
+	if err := s.DB.SetPageChecks(ctx, page.Pagepath, page.Metadata.RevisionFull, found); err != nil {
+		slog.Warn("failed to record page checks", "path", page.Pagepath, "error", err)
+	}
+}
+
+// pageChecks returns the findings of the checks run on the revision of the
+// page shown.
+func (s *Server) pageChecks(ctx context.Context, page *wiki.Page) []db.PageCheck {
+	if page.Metadata == nil {
+		return nil
+	}
+	found, err := s.DB.ListPageChecks(ctx, page.Pagepath, page.Metadata.RevisionFull)
+	if err != nil {
+		slog.Warn("failed to list page checks", "path", page.Pagepath, "error", err)
+	}
+	return found
+}
+
+// pageCheckReport is a page with findings in the checks report.
+type pageCheckReport struct {
+	Pagepath  string
+	CheckedAt time.Time
+	Findings  []db.PageCheck
+}
+
+// handleChecksReport lists the pages whose current revision failed any of
+// the page checks, with their findings.
+func (s *Server) handleChecksReport(w http.ResponseWriter, r *http.Request) {
+	found, err := s.DB.ListCurrentPageChecks(r.Context())
+	if err != nil {
+		s.renderFailure(w, r, err)
+		return
+	}
+	var pages []*pageCheckReport
+	for _, f := range found {
+		if len(pages) == 0 || pages[len(pages)-1].Pagepath != f.Pagepath {
+			pages = append(pages, &pageCheckReport{Pagepath: f.Pagepath, CheckedAt: f.CheckedAt})
+		}
+		p := pages[len(pages)-1]
+		p.Findings = append(p.Findings, f)
+	}
+
+	data := NewGenericData("Page Checks")
+	data["pages"] = pages
+	data["findings"] = len(found)
+	s.renderTemplate(w, r, "reports_checks.html", data)
+}
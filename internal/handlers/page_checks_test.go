@@ -0,0 +1,68 @@
+package handlers_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/sa/gopherwiki/internal/storage"
+	"github.com/sa/gopherwiki/internal/testutil"
+)
+
+func TestPageChecks(t *testing.T) {
+	env := testutil.SetupTestEnv(t)
+	env.Server.Config.SpellcheckCommand = "grep -o teh"
+	ctx := context.Background()
+	author := storage.Author{Name: "Alice", Email: "alice@example.com"}
+	save := func(pagepath, content string) {
+		t.Helper()
+		if _, err := env.Server.Wiki.SavePage(ctx, pagepath, content, "", "", author); err != nil {
+			t.Fatal(err)
+		}
+	}
+	get := func(path string) string {
+		t.Helper()
+		w := httptest.NewRecorder()
+		env.Router.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("GET %s: status = %d, want %d", path, w.Code, http.StatusOK)
+		}
+		return w.Body.String()
+	}
+
+	save("home", "# Home\n")
+	save("guide", "# Guide\n\nSee [[Home]] and [[Nowhere]].\n\n#### Deep\n\n![](map.png)\n\nteh end\n")
+
+	// The page shows the findings of its revision.
+	body := get("/guide")
+	for _, want := range []string{
+		"4 checks failed on this revision",
+		"Line 3: Link to a missing page: nowhere",
+		"Line 5: Heading skips from level 1 to 4: Deep",
+		"Line 7: Image without alt text: map.png",
+		"Possible misspelling: teh",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("page view lacks %q:\n%s", want, body)
+		}
+	}
+	if body := get("/home"); strings.Contains(body, "page-checks-notice") {
+		t.Errorf("a page that passed shows failed checks:\n%s", body)
+	}
+
+	body = get("/-/reports/checks")
+	if !strings.Contains(body, `<a href="/guide">guide</a>`) || !strings.Contains(body, "4 findings on 1 page") || strings.Contains(body, `<a href="/home">`) {
+		t.Errorf("checks report:\n%s", body)
+	}
+
+	// Fixing the page clears it from the report.
+	save("guide", "# Guide\n\nSee [[Home]].\n")
+	if body := get("/guide"); strings.Contains(body, "page-checks-notice") {
+		t.Errorf("fixed page shows failed checks:\n%s", body)
+	}
+	if body := get("/-/reports/checks"); !strings.Contains(body, "Every page passed its checks.") {
+		t.Errorf("checks report after the fix:\n%s", body)
+	}
+}
@@ -1,12 +1,18 @@
 package handlers
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
 	"net/http"
+	"net/url"
 	"path/filepath"
+	"slices"
+	"strconv"
 	"strings"
 	"time"
 
@@ -14,6 +20,9 @@ import (
 
 	"github.com/sa/gopherwiki/internal/db"
 	"github.com/sa/gopherwiki/internal/middleware"
+	"github.com/sa/gopherwiki/internal/renderer"
+	"github.com/sa/gopherwiki/internal/settings"
+	"github.com/sa/gopherwiki/internal/spam"
 	"github.com/sa/gopherwiki/internal/storage"
 	"github.com/sa/gopherwiki/internal/util"
 	"github.com/sa/gopherwiki/internal/wiki"
@@ -22,10 +31,14 @@ import (
 // handleIndex handles the home page.
 func (s *Server) handleIndex(w http.ResponseWriter, r *http.Request) {
 	// Determine the home page path
-	homePage := s.Config.HomePage
+	homePage := s.Settings.Get(r.Context()).HomePage
 	if homePage == "" {
 		homePage = "Home"
 	}
+	// A logged-in user may land elsewhere
+	if landing := s.userPreferences(r).LandingPage; landing != "" {
+		homePage = landing
+	}
 
 	// If home page is a special route, redirect
 	if strings.HasPrefix(homePage, "/-/") {
@@ -34,9 +47,9 @@ func (s *Server) handleIndex(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Load the home page
-	page, err := wiki.NewPage(s.Storage, s.Config, homePage, "")
+	page, err := wiki.NewPage(r.Context(), s.Storage, s.Config, homePage, "")
 	if err != nil {
-		s.renderError(w, r, http.StatusInternalServerError, err.Error())
+		s.renderFailure(w, r, err)
 		return
 	}
 
@@ -47,6 +60,8 @@ func (s *Server) handleIndex(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Render the page
+	s.countPageView(r, page)
+	s.recordRecentPage(r, page)
 	s.renderPage(w, r, page)
 }
 
@@ -63,53 +78,131 @@ func (s *Server) handleView(w http.ResponseWriter, r *http.Request) {
 
 	revision := r.URL.Query().Get("revision")
 
+	// A vault's .obsidian and .trash directories are the editor's, not pages.
+	if s.Config.ObsidianCompat && isHiddenPath(path) {
+		s.renderError(w, r, http.StatusNotFound, "Page not found")
+		return
+	}
+
 	// Check if this is an attachment file request
-	// Pattern: pagepath/filename.ext where pagepath/ directory exists
-	if idx := strings.LastIndex(path, "/"); idx > 0 {
-		parentPath := path[:idx]
-		filename := path[idx+1:]
-
-		// Check if there's a .md page for the parent and the file exists in attachment dir
-		parentFilename := util.GetFilename(parentPath)
-		if !s.Config.RetainPageNameCase {
-			parentFilename = strings.ToLower(parentFilename)
-		}
-		attachmentDir := util.GetAttachmentDirectoryname(parentFilename)
-		attachmentPath := attachmentDir + "/" + filename
+	if attachmentPath, _, ok := s.attachmentFile(r.Context(), path); ok {
+		s.serveAttachment(w, r, attachmentPath, filepath.Base(attachmentPath))
+		return
+	}
 
-		if s.Storage.Exists(attachmentPath) {
-			s.serveAttachment(w, r, attachmentPath, filename)
-			return
-		}
+	// Obsidian vaults keep attachments anywhere, the vault root included.
+	if s.Config.ObsidianCompat && !util.IsMarkdownFile(path) && s.Storage.Exists(r.Context(), path) && !s.Storage.IsDir(r.Context(), path) {
+		s.serveAttachment(w, r, path, filepath.Base(path))
+		return
 	}
 
-	page, err := wiki.NewPage(s.Storage, s.Config, path, revision)
+	page, err := wiki.NewPage(r.Context(), s.Storage, s.Config, path, revision)
 	if err != nil {
-		s.renderError(w, r, http.StatusInternalServerError, err.Error())
+		s.renderFailure(w, r, err)
 		return
 	}
 
 	if !page.Exists {
+		if target, ok := s.aliasRedirect(r.Context(), path, revision); ok {
+			http.Redirect(w, r, target, http.StatusFound)
+			return
+		}
+		if revision == "" && s.renderDirectory(w, r, page) {
+			return
+		}
 		s.renderNotFound(w, r, page)
 		return
 	}
 
+	s.countPageView(r, page)
+	s.recordRecentPage(r, page)
 	s.renderPage(w, r, page)
 }
 
+// attachmentFile returns the file in the repository of the attachment that
+// the URL path names, as pagepath/filename, and the path of its page. It
+// reports false when path names no attachment.
+func (s *Server) attachmentFile(ctx context.Context, path string) (string, string, bool) {
+	idx := strings.LastIndex(path, "/")
+	if idx <= 0 {
+		return "", "", false
+	}
+	parentPath := path[:idx]
+	filename := path[idx+1:]
+
+	// The file must be in the attachment directory of the parent page.
+	parentFilename := util.GetFilename(parentPath)
+	if !s.Config.RetainPageNameCase {
+		parentFilename = strings.ToLower(parentFilename)
+	}
+	attachmentPath := util.GetAttachmentDirectoryname(parentFilename) + "/" + filename
+	if !s.Storage.Exists(ctx, attachmentPath) || s.Storage.IsDir(ctx, attachmentPath) {
+		return "", "", false
+	}
+	return attachmentPath, parentPath, true
+}
+
+// isHiddenPath reports whether any segment of path begins with a dot.
+func isHiddenPath(path string) bool {
+	return strings.HasPrefix(path, ".") || strings.Contains(path, "/.")
+}
+
+// aliasRedirect returns the URL of the page that a missing page path refers
+// to in Obsidian compatibility mode: a page declaring it as a frontmatter
+// alias, or of that name elsewhere in the vault.
+func (s *Server) aliasRedirect(ctx context.Context, path, revision string) (string, bool) {
+	if !s.Config.ObsidianCompat || revision != "" {
+		return "", false
+	}
+	target, ok := s.Wiki.AliasTarget(path)
+	if !ok {
+		return "", false
+	}
+	if page, err := wiki.NewPage(ctx, s.Storage, s.Config, target, ""); err != nil || !page.Exists {
+		return "", false
+	}
+	return (&url.URL{Path: "/" + target}).String(), true
+}
+
 // serveAttachment serves an attachment file from storage.
 func (s *Server) serveAttachment(w http.ResponseWriter, r *http.Request, filepath, filename string) {
-	content, err := s.Storage.LoadBytes(filepath, "")
+	size, err := s.Storage.Size(r.Context(), filepath)
 	if err != nil {
 		http.Error(w, "File not found", http.StatusNotFound)
 		return
 	}
+	mtime, _ := s.Storage.Mtime(r.Context(), filepath)
+
+	// Small attachments are read whole and tagged by content hash; larger
+	// ones are streamed from disk, tagged by size and modification time.
+	var content io.ReadSeeker
+	var etag string
+	if size <= s.Config.AttachmentMemoryLimit {
+		data, err := s.Storage.LoadBytes(r.Context(), filepath, "")
+		if err != nil {
+			http.Error(w, "File not found", http.StatusNotFound)
+			return
+		}
+		content, etag = bytes.NewReader(data), contentETag(data)
+	} else {
+		f, err := s.Storage.Open(r.Context(), filepath)
+		if err != nil {
+			http.Error(w, "File not found", http.StatusNotFound)
+			return
+		}
+		defer f.Close()
+		content = f
+		etag = fmt.Sprintf(`"%x-%x"`, size, mtime.UnixNano())
+	}
 
-	// Set content type and cache headers
+	// Attachments are revalidated by ETag once the hour of freshness runs
+	// out. ServeContent answers conditional and range requests.
+	w.Header().Set("Cache-Control", "public, max-age=3600")
+	w.Header().Set("ETag", etag)
+
+	// Set content type headers
 	contentType := util.GuessMimetype(filename)
 	w.Header().Set("Content-Type", contentType)
-	w.Header().Set("Content-Length", fmt.Sprintf("%d", len(content)))
-	w.Header().Set("Cache-Control", "public, max-age=3600")
 	// Never let the browser MIME-sniff an attachment into something executable.
 	w.Header().Set("X-Content-Type-Options", "nosniff")
 
@@ -122,7 +215,7 @@ func (s *Server) serveAttachment(w http.ResponseWriter, r *http.Request, filepat
 		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
 	}
 
-	w.Write(content)
+	http.ServeContent(w, r, filename, mtime, content)
 }
 
 // handleEdit handles the page editor.
@@ -133,9 +226,9 @@ func (s *Server) handleEdit(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	page, err := wiki.NewPage(s.Storage, s.Config, path, "")
+	page, err := wiki.NewPage(r.Context(), s.Storage, s.Config, path, "")
 	if err != nil {
-		s.renderError(w, r, http.StatusInternalServerError, err.Error())
+		s.renderFailure(w, r, err)
 		return
 	}
 
@@ -143,24 +236,24 @@ func (s *Server) handleEdit(w http.ResponseWriter, r *http.Request) {
 	cursorLine := 0
 	cursorCh := 0
 
+	templatePath := r.URL.Query().Get("template")
 	if !page.Exists {
 		// New page template
 		content = "# " + page.Pagename + "\n\n"
 		cursorLine = 2
 		cursorCh = 0
-	}
-
-	// Get attachments for file browser
-	files, err := page.Attachments(100, ".md")
-	if err != nil {
-		slog.Warn("failed to load attachments", "error", err)
-	}
-	fileData := make([]map[string]interface{}, 0, len(files))
-	for _, f := range files {
-		fileData = append(fileData, map[string]interface{}{
-			"filename": f.Filename,
-			"url":      "/" + f.Fullpath,
-		})
+		if templatePath != "" {
+			content, err = s.Wiki.ApplyTemplate(r.Context(), templatePath, s.templateVars(r, page))
+			if errors.Is(err, wiki.ErrTemplateNotFound) {
+				s.renderError(w, r, http.StatusNotFound, "Page template not found: "+templatePath)
+				return
+			}
+			if err != nil {
+				s.renderFailure(w, r, err)
+				return
+			}
+			cursorLine = 0
+		}
 	}
 
 	revision := ""
@@ -168,10 +261,51 @@ func (s *Server) handleEdit(w http.ResponseWriter, r *http.Request) {
 		revision = page.Metadata.Revision
 	}
 
-	data := NewEditorData(page, content, cursorLine, cursorCh, revision, fileData)
+	data := NewEditorData(page, content, cursorLine, cursorCh, revision)
+	data["pages"] = s.editorPages(r)
+	if !page.Exists {
+		data["templates"] = s.pageTemplates(r)
+		data["template"] = templatePath
+	}
 	s.renderTemplate(w, r, "editor.html", data)
 }
 
+// maxEditorPages is the number of pages listed with the editor for
+// linking to; others are found through the link completion API.
+const maxEditorPages = 200
+
+// editorPages lists the pages the editor offers to link to before any is
+// searched for: the most recently updated ones. A listing failure only
+// costs the list, so it is logged and not returned.
+func (s *Server) editorPages(r *http.Request) []wiki.PageCompletion {
+	pages, err := s.Wiki.CompletePages(r.Context(), "", maxEditorPages)
+	if err != nil {
+		slog.Warn("failed to list pages for the editor", "error", err)
+	}
+	return pages
+}
+
+// pageTemplates lists the page templates offered when creating a page. A
+// listing failure only costs the picker, so it is logged and not returned.
+func (s *Server) pageTemplates(r *http.Request) []wiki.PageTemplate {
+	templates, err := s.Wiki.PageTemplates(r.Context())
+	if err != nil {
+		slog.Warn("failed to list page templates", "error", err)
+	}
+	return templates
+}
+
+// templateVars returns the values substituted into a page template when
+// the request's author creates page.
+func (s *Server) templateVars(r *http.Request, page *wiki.Page) wiki.TemplateVars {
+	return wiki.TemplateVars{
+		Title:    page.Pagename,
+		Pagepath: page.Pagepath,
+		Author:   s.getAuthor(r).Name,
+		Now:      time.Now(),
+	}
+}
+
 // handleSave handles saving a wiki page.
 func (s *Server) handleSave(w http.ResponseWriter, r *http.Request) {
 	if err := r.ParseForm(); err != nil {
@@ -185,15 +319,31 @@ func (s *Server) handleSave(w http.ResponseWriter, r *http.Request) {
 	formRevision := r.FormValue("revision")
 	author := s.getAuthor(r)
 
-	result, err := s.Wiki.SavePage(r.Context(), path, content, message, formRevision, author)
+	if s.honeypotTripped(w, r) {
+		return
+	}
+	if _, held, err := s.holdForModeration(r, spam.Submission{Kind: spam.KindPage, Target: path, Content: content}, moderationPayload{Message: message, Revision: formRevision}); err != nil {
+		s.renderFailure(w, r, err)
+		return
+	} else if held {
+		s.SessionManager.AddFlashMessage(w, r, "info", "Your changes are awaiting moderation")
+		http.Redirect(w, r, "/"+path, http.StatusFound)
+		return
+	}
+
+	result, err := s.Wiki.SavePage(r.Context(), path, content, message, s.conflictBase(r, formRevision), author)
+	if errors.Is(err, wiki.ErrSaveRejected) {
+		s.renderError(w, r, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
 	if err != nil {
-		s.renderError(w, r, http.StatusInternalServerError, err.Error())
+		s.renderFailure(w, r, err)
 		return
 	}
 
 	if result.Conflict {
 		currentRevision := result.Page.Metadata.Revision
-		data := NewEditorData(result.Page, content, 0, 0, currentRevision, nil)
+		data := NewEditorData(result.Page, content, 0, 0, currentRevision)
 		data["conflict_message"] = "Edit conflict: this page was modified by another user since you started editing. Your changes are preserved below. Please review and save again."
 		w.WriteHeader(http.StatusConflict)
 		s.renderTemplate(w, r, "editor.html", data)
@@ -203,13 +353,22 @@ func (s *Server) handleSave(w http.ResponseWriter, r *http.Request) {
 	http.Redirect(w, r, "/"+result.Page.Pagepath, http.StatusFound)
 }
 
+// conflictBase returns the revision a save is checked against for edit
+// conflicts, or none when the wiki lets the last write win.
+func (s *Server) conflictBase(r *http.Request, revision string) string {
+	if s.Settings.Get(r.Context()).EditConflictMode == settings.ConflictOverwrite {
+		return ""
+	}
+	return revision
+}
+
 // handleHistory handles viewing page history.
 func (s *Server) handleHistory(w http.ResponseWriter, r *http.Request) {
 	path := chi.URLParam(r, "path")
 
-	page, err := wiki.NewPage(s.Storage, s.Config, path, "")
+	page, err := wiki.NewPage(r.Context(), s.Storage, s.Config, path, "")
 	if err != nil {
-		s.renderError(w, r, http.StatusInternalServerError, err.Error())
+		s.renderFailure(w, r, err)
 		return
 	}
 
@@ -218,11 +377,29 @@ func (s *Server) handleHistory(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	log, err := page.History(0)
+	query, err := parseLogFilters(r)
+	if err != nil {
+		s.renderError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+	pageNum := 1
+	if p, err := strconv.Atoi(r.URL.Query().Get("page")); err == nil && p > 1 {
+		pageNum = p
+	}
+
+	// Fetch one extra entry to learn whether a next page exists.
+	pageSize := s.listPageSize(r, historyPageSize)
+	query.Offset = (pageNum - 1) * pageSize
+	query.Limit = pageSize + 1
+	log, err := page.QueryHistory(r.Context(), query)
 	if err != nil {
-		s.renderError(w, r, http.StatusInternalServerError, err.Error())
+		s.renderFailure(w, r, err)
 		return
 	}
+	hasNext := len(log) > pageSize
+	if hasNext {
+		log = log[:pageSize]
+	}
 
 	// Add URLs to log entries
 	logData := make([]map[string]interface{}, 0, len(log))
@@ -234,6 +411,8 @@ func (s *Server) handleHistory(w http.ResponseWriter, r *http.Request) {
 			"author_email": entry.AuthorEmail,
 			"message":      entry.Message,
 			"url":          "/" + page.Pagepath + "?revision=" + entry.Revision,
+			"permalink":    permalinkURL(entry.RevisionFull, page.Pagepath),
+			"current":      entry.RevisionFull == page.Metadata.RevisionFull,
 		})
 	}
 
@@ -248,17 +427,62 @@ func (s *Server) handleHistory(w http.ResponseWriter, r *http.Request) {
 	data["log"] = logData
 	data["rev_a"] = revA
 	data["rev_b"] = revB
+	q := r.URL.Query()
+	data["filter_author"] = q.Get("author")
+	data["filter_since"] = q.Get("since")
+	data["filter_until"] = q.Get("until")
+	data["page"] = pageNum
+	if pageNum > 1 {
+		data["prev_url"] = changelogPageURL(r, pageNum-1)
+	}
+	if hasNext {
+		data["next_url"] = changelogPageURL(r, pageNum+1)
+	}
 	s.renderTemplate(w, r, "history.html", data)
 }
 
+// historyPageSize is the number of commits per page of a page's history,
+// unless the user chose another.
+const historyPageSize = 50
+
+// handleHistoryExport serves the page's full revision history as an mbox
+// patch series (git format-patch limited to the page file), which can be
+// replayed into another repository with `git am`.
+func (s *Server) handleHistoryExport(w http.ResponseWriter, r *http.Request) {
+	path := chi.URLParam(r, "path")
+
+	page, err := wiki.NewPage(r.Context(), s.Storage, s.Config, path, "")
+	if err != nil {
+		s.renderFailure(w, r, err)
+		return
+	}
+
+	if !page.Exists || page.Metadata == nil {
+		s.renderNotFound(w, r, page)
+		return
+	}
+
+	if notModified(w, r, `"`+page.Metadata.RevisionFull+`"`, page.Metadata.Datetime) {
+		return
+	}
+
+	series, err := s.Storage.FormatPatch(r.Context(), page.Filename)
+	if err != nil {
+		s.renderFailure(w, r, err)
+		return
+	}
+
+	serveDownload(w, []byte(series), "application/mbox", exportFilename(page, "patch"))
+}
+
 // handleSource handles viewing page source.
 func (s *Server) handleSource(w http.ResponseWriter, r *http.Request) {
 	path := chi.URLParam(r, "path")
 	raw := r.URL.Query().Get("raw") != ""
 
-	page, err := wiki.NewPage(s.Storage, s.Config, path, "")
+	page, err := wiki.NewPage(r.Context(), s.Storage, s.Config, path, "")
 	if err != nil {
-		s.renderError(w, r, http.StatusInternalServerError, err.Error())
+		s.renderFailure(w, r, err)
 		return
 	}
 
@@ -275,9 +499,28 @@ func (s *Server) handleSource(w http.ResponseWriter, r *http.Request) {
 
 	data := NewPageViewData(page.Pagename+" - Source", page)
 	data["source"] = page.Content
+	data["source_lines"] = sourceLines(page.Content)
 	s.renderTemplate(w, r, "source.html", data)
 }
 
+// sourceLine is a numbered line of the source view, which links to each
+// line as #L<number>.
+type sourceLine struct {
+	Number int
+	Text   string
+}
+
+// sourceLines splits content into numbered lines.
+func sourceLines(content string) []sourceLine {
+	content = strings.TrimSuffix(content, "\n")
+	lines := strings.Split(content, "\n")
+	result := make([]sourceLine, len(lines))
+	for i, line := range lines {
+		result[i] = sourceLine{Number: i + 1, Text: strings.TrimSuffix(line, "\r")}
+	}
+	return result
+}
+
 // handleCreate handles creating a new page.
 func (s *Server) handleCreate(w http.ResponseWriter, r *http.Request) {
 	path := chi.URLParam(r, "path")
@@ -290,13 +533,18 @@ func (s *Server) handleCreate(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Redirect to edit page
-	http.Redirect(w, r, "/"+path+"/edit", http.StatusFound)
+	// Redirect to edit page, starting from the chosen template if any
+	target := "/" + path + "/edit"
+	if templatePath := r.FormValue("template"); templatePath != "" {
+		target += "?template=" + url.QueryEscape(templatePath)
+	}
+	http.Redirect(w, r, target, http.StatusFound)
 }
 
 // handleCreateForm handles the create page form.
 func (s *Server) handleCreateForm(w http.ResponseWriter, r *http.Request) {
 	data := NewGenericData("Create a new page")
+	data["templates"] = s.pageTemplates(r)
 	s.renderTemplate(w, r, "create.html", data)
 }
 
@@ -304,9 +552,9 @@ func (s *Server) handleCreateForm(w http.ResponseWriter, r *http.Request) {
 func (s *Server) handleDeleteForm(w http.ResponseWriter, r *http.Request) {
 	path := chi.URLParam(r, "path")
 
-	page, err := wiki.NewPage(s.Storage, s.Config, path, "")
+	page, err := wiki.NewPage(r.Context(), s.Storage, s.Config, path, "")
 	if err != nil {
-		s.renderError(w, r, http.StatusInternalServerError, err.Error())
+		s.renderFailure(w, r, err)
 		return
 	}
 
@@ -318,14 +566,23 @@ func (s *Server) handleDeleteForm(w http.ResponseWriter, r *http.Request) {
 
 // handleDelete handles deleting a page.
 func (s *Server) handleDelete(w http.ResponseWriter, r *http.Request) {
+	if s.refuseUnreviewable(w, r) {
+		return
+	}
 	path := chi.URLParam(r, "path")
 	message := r.FormValue("message")
 	author := s.getAuthor(r)
 
 	if err := s.Wiki.DeletePage(r.Context(), path, message, author); err != nil {
-		s.renderError(w, r, http.StatusInternalServerError, err.Error())
+		s.renderFailure(w, r, err)
 		return
 	}
+	if err := s.DB.SetPageStatus(r.Context(), nil, db.PageStatus{Pagepath: util.SanitizePagename(path, true)}); err != nil {
+		slog.Warn("failed to remove the status of a deleted page", "path", path, "error", err)
+	}
+	if err := s.DB.SetPageVisibility(r.Context(), nil, db.PageVisibility{Pagepath: util.SanitizePagename(path, true)}); err != nil {
+		slog.Warn("failed to remove the visibility of a deleted page", "path", path, "error", err)
+	}
 
 	http.Redirect(w, r, "/-/changelog", http.StatusFound)
 }
@@ -334,9 +591,9 @@ func (s *Server) handleDelete(w http.ResponseWriter, r *http.Request) {
 func (s *Server) handleRenameForm(w http.ResponseWriter, r *http.Request) {
 	path := chi.URLParam(r, "path")
 
-	page, err := wiki.NewPage(s.Storage, s.Config, path, "")
+	page, err := wiki.NewPage(r.Context(), s.Storage, s.Config, path, "")
 	if err != nil {
-		s.renderError(w, r, http.StatusInternalServerError, err.Error())
+		s.renderFailure(w, r, err)
 		return
 	}
 
@@ -349,13 +606,16 @@ func (s *Server) handleRenameForm(w http.ResponseWriter, r *http.Request) {
 
 // handleRename handles renaming a page.
 func (s *Server) handleRename(w http.ResponseWriter, r *http.Request) {
+	if s.refuseUnreviewable(w, r) {
+		return
+	}
 	path := chi.URLParam(r, "path")
 	newPagename := r.FormValue("new_pagename")
 	message := r.FormValue("message")
 
-	page, err := wiki.NewPage(s.Storage, s.Config, path, "")
+	page, err := wiki.NewPage(r.Context(), s.Storage, s.Config, path, "")
 	if err != nil {
-		s.renderError(w, r, http.StatusInternalServerError, err.Error())
+		s.renderFailure(w, r, err)
 		return
 	}
 
@@ -365,15 +625,25 @@ func (s *Server) handleRename(w http.ResponseWriter, r *http.Request) {
 		message = "Renamed " + page.Pagename + " to " + newPagename
 	}
 
-	if err := page.Rename(newPagename, message, author); err != nil {
-		s.renderError(w, r, http.StatusInternalServerError, err.Error())
+	if err := page.Rename(r.Context(), newPagename, message, author); err != nil {
+		s.renderFailure(w, r, err)
 		return
 	}
+	s.Wiki.InvalidatePageTreeCache()
 
 	if err := s.Wiki.RemovePageFromIndex(r.Context(), path); err != nil {
 		slog.Warn("failed to remove old page from index", "path", path, "error", err)
 	}
-	if content, err := s.Storage.Load(util.GetFilename(newPagename), ""); err == nil {
+	if err := s.DB.MovePageStatus(r.Context(), page.Pagepath, util.SanitizePagename(newPagename, true)); err != nil {
+		slog.Warn("failed to move the status of a renamed page", "path", path, "error", err)
+	}
+	if err := s.DB.MovePageVisibility(r.Context(), page.Pagepath, util.SanitizePagename(newPagename, true)); err != nil {
+		slog.Warn("failed to move the visibility of a renamed page", "path", path, "error", err)
+	}
+	if err := s.DB.MoveBookmarks(r.Context(), page.Pagepath, util.SanitizePagename(newPagename, true)); err != nil {
+		slog.Warn("failed to move the bookmarks of a renamed page", "path", path, "error", err)
+	}
+	if content, err := s.Storage.Load(r.Context(), util.GetFilename(newPagename), ""); err == nil {
 		if err := s.Wiki.IndexPage(r.Context(), newPagename, content); err != nil {
 			slog.Warn("failed to index renamed page", "path", newPagename, "error", err)
 		}
@@ -386,13 +656,13 @@ func (s *Server) handleRename(w http.ResponseWriter, r *http.Request) {
 func (s *Server) handleAttachments(w http.ResponseWriter, r *http.Request) {
 	path := chi.URLParam(r, "path")
 
-	page, err := wiki.NewPage(s.Storage, s.Config, path, "")
+	page, err := wiki.NewPage(r.Context(), s.Storage, s.Config, path, "")
 	if err != nil {
-		s.renderError(w, r, http.StatusInternalServerError, err.Error())
+		s.renderFailure(w, r, err)
 		return
 	}
 
-	files, err := page.Attachments(0, ".md")
+	files, err := page.Attachments(r.Context(), 0, ".md")
 	if err != nil {
 		slog.Warn("failed to load attachments", "error", err)
 	}
@@ -412,6 +682,9 @@ func (s *Server) handleAttachments(w http.ResponseWriter, r *http.Request) {
 
 // handleUploadAttachment handles file uploads.
 func (s *Server) handleUploadAttachment(w http.ResponseWriter, r *http.Request) {
+	if s.refuseUnreviewable(w, r) {
+		return
+	}
 	path := chi.URLParam(r, "path")
 
 	// Parse multipart form (max 32MB)
@@ -445,9 +718,9 @@ func (s *Server) handleUploadAttachment(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	page, err := wiki.NewPage(s.Storage, s.Config, path, "")
+	page, err := wiki.NewPage(r.Context(), s.Storage, s.Config, path, "")
 	if err != nil {
-		s.renderError(w, r, http.StatusInternalServerError, err.Error())
+		s.renderFailure(w, r, err)
 		return
 	}
 
@@ -460,7 +733,7 @@ func (s *Server) handleUploadAttachment(w http.ResponseWriter, r *http.Request)
 
 	// Save attachment
 	attachmentPath := page.AttachmentDirectoryname + "/" + filename
-	_, err = s.Storage.StoreBytes(attachmentPath, content, message, author)
+	_, err = s.Storage.StoreBytes(r.Context(), attachmentPath, content, message, author)
 	if err != nil {
 		s.renderError(w, r, http.StatusInternalServerError, "Failed to save file: "+err.Error())
 		return
@@ -470,14 +743,47 @@ func (s *Server) handleUploadAttachment(w http.ResponseWriter, r *http.Request)
 	http.Redirect(w, r, "/"+page.Pagepath+"/attachments", http.StatusFound)
 }
 
+// blameCacheLimit caps the blames kept in memory.
+const blameCacheLimit = 64
+
+// blameKey names the blame of a file as of a commit, which never changes.
+type blameKey struct {
+	filename, revision string
+}
+
+// pageBlame returns the blame of page, computing it the first time it is
+// asked for at the commit the page was last changed in.
+func (s *Server) pageBlame(ctx context.Context, page *wiki.Page) ([]storage.BlameLine, error) {
+	key := blameKey{page.Filename, page.Metadata.RevisionFull}
+	s.blMu.Lock()
+	blame, ok := s.blCache[key]
+	s.blMu.Unlock()
+	if ok {
+		return blame, nil
+	}
+
+	blame, err := page.Blame(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	s.blMu.Lock()
+	defer s.blMu.Unlock()
+	if s.blCache == nil || len(s.blCache) >= blameCacheLimit {
+		s.blCache = make(map[blameKey][]storage.BlameLine)
+	}
+	s.blCache[key] = blame
+	return blame, nil
+}
+
 // handleBlame handles viewing blame information.
 func (s *Server) handleBlame(w http.ResponseWriter, r *http.Request) {
 	path := chi.URLParam(r, "path")
 	revision := r.URL.Query().Get("revision")
 
-	page, err := wiki.NewPage(s.Storage, s.Config, path, revision)
+	page, err := wiki.NewPage(r.Context(), s.Storage, s.Config, path, revision)
 	if err != nil {
-		s.renderError(w, r, http.StatusInternalServerError, err.Error())
+		s.renderFailure(w, r, err)
 		return
 	}
 
@@ -486,9 +792,9 @@ func (s *Server) handleBlame(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	blame, err := page.Blame()
+	blame, err := s.pageBlame(r.Context(), page)
 	if err != nil {
-		s.renderError(w, r, http.StatusInternalServerError, err.Error())
+		s.renderFailure(w, r, err)
 		return
 	}
 
@@ -497,15 +803,25 @@ func (s *Server) handleBlame(w http.ResponseWriter, r *http.Request) {
 	s.renderTemplate(w, r, "blame.html", data)
 }
 
-// handleDiff handles viewing diffs between revisions.
+// handleDiff shows the changes to a page between two revisions, picked
+// from its history: rev_a defaults to the revision before the last, and an
+// empty rev_b means the current version. The view parameter chooses a
+// unified diff, a side-by-side one, or a word diff of the whole text for
+// prose; the line diffs highlight the changes within each changed line.
 func (s *Server) handleDiff(w http.ResponseWriter, r *http.Request) {
 	path := chi.URLParam(r, "path")
 	revA := r.URL.Query().Get("rev_a")
 	revB := r.URL.Query().Get("rev_b")
+	view := r.URL.Query().Get("view")
+	switch view {
+	case "split", "words":
+	default:
+		view = "unified"
+	}
 
-	page, err := wiki.NewPage(s.Storage, s.Config, path, "")
+	page, err := wiki.NewPage(r.Context(), s.Storage, s.Config, path, "")
 	if err != nil {
-		s.renderError(w, r, http.StatusInternalServerError, err.Error())
+		s.renderFailure(w, r, err)
 		return
 	}
 
@@ -514,23 +830,136 @@ func (s *Server) handleDiff(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	diff, err := s.Wiki.Diff(r.Context(), revA, revB)
+	log, err := page.History(r.Context(), 0)
 	if err != nil {
-		s.renderError(w, r, http.StatusInternalServerError, err.Error())
+		s.renderFailure(w, r, err)
 		return
 	}
+	if revA == "" && len(log) > 1 {
+		revA = log[1].Revision
+	}
 
-	// Parse diff for display
-	diffLines := parseDiff(diff)
+	// A revision the page is missing from diffs as empty, so that its
+	// creation or deletion shows as every line added or removed.
+	var texts [2]string
+	found := false
+	for i, rev := range []string{revA, revB} {
+		if i == 0 && rev == "" {
+			continue
+		}
+		text, err := s.Storage.Load(r.Context(), page.Filename, rev)
+		switch {
+		case err == nil:
+			texts[i] = text
+			found = true
+		case !errors.Is(err, storage.ErrNotFound):
+			s.renderFailure(w, r, err)
+			return
+		}
+	}
+	if !found {
+		s.renderError(w, r, http.StatusNotFound, "Neither revision of this page was found")
+		return
+	}
+
+	revisions := make([]map[string]interface{}, 0, len(log))
+	for _, entry := range log {
+		revisions = append(revisions, map[string]interface{}{
+			"revision":    entry.Revision,
+			"datetime":    entry.Datetime,
+			"author_name": entry.AuthorName,
+			"message":     entry.Message,
+		})
+	}
 
 	data := NewPageViewData(page.Pagename+" - Diff", page)
-	data["diff"] = diff
-	data["diff_lines"] = diffLines
 	data["rev_a"] = revA
 	data["rev_b"] = revB
+	data["view"] = view
+	data["revisions"] = revisions
+	data["unchanged"] = texts[0] == texts[1]
+	if view == "words" {
+		data["word_diff"] = wordDiff(texts[0], texts[1])
+	} else {
+		data["rows"] = diffRows(texts[0], texts[1], false)
+	}
 	s.renderTemplate(w, r, "diff.html", data)
 }
 
+// handleCompare renders two revisions of a page side by side as HTML, with
+// the top-level blocks that differ highlighted, so the visual effect of an
+// edit can be reviewed rather than just its source diff. Either revision may
+// be anything git resolves (a commit, a tag, a branch); an empty rev_b means
+// the current version. With view=inline the revisions are merged into one
+// rendered page instead, the removed and added words marked in place.
+func (s *Server) handleCompare(w http.ResponseWriter, r *http.Request) {
+	path := chi.URLParam(r, "path")
+	revA := r.URL.Query().Get("rev_a")
+	revB := r.URL.Query().Get("rev_b")
+
+	current, err := wiki.NewPage(r.Context(), s.Storage, s.Config, path, "")
+	if err != nil {
+		s.renderFailure(w, r, err)
+		return
+	}
+	if !current.Exists {
+		s.renderNotFound(w, r, current)
+		return
+	}
+	if revA == "" {
+		s.renderError(w, r, http.StatusBadRequest, "Select a revision to compare")
+		return
+	}
+
+	pageA, err := wiki.NewPage(r.Context(), s.Storage, s.Config, path, revA)
+	if err != nil {
+		s.renderFailure(w, r, err)
+		return
+	}
+	pageB := current
+	if revB != "" {
+		if pageB, err = wiki.NewPage(r.Context(), s.Storage, s.Config, path, revB); err != nil {
+			s.renderFailure(w, r, err)
+			return
+		}
+	}
+	for _, p := range []*wiki.Page{pageA, pageB} {
+		if !p.Exists {
+			s.renderError(w, r, http.StatusNotFound, "Revision "+p.Revision+" of this page not found")
+			return
+		}
+	}
+
+	canRead := s.PermissionChecker.PageFilter(r)
+	htmlA, _, libsA := pageA.RenderFor(s.Renderer, canRead)
+	htmlB, _, libsB := pageB.RenderFor(s.Renderer, canRead)
+	rows, ok := compareBlocks(htmlA, htmlB)
+	if !ok {
+		s.renderError(w, r, http.StatusUnprocessableEntity, "These revisions are too long to compare; view the changes in the page history instead")
+		return
+	}
+	changes := 0
+	for _, row := range rows {
+		if row.Status != "same" {
+			changes++
+		}
+	}
+
+	data := NewPageViewData(current.Pagename+" - Compare", current)
+	data["rev_a"] = revA
+	data["rev_b"] = revB
+	data["rows"] = rows
+	data["changes"] = changes
+	if r.URL.Query().Get("view") == "inline" {
+		data["inline"] = inlineCompare(rows)
+	}
+	data["library_requirements"] = renderer.LibraryRequirements{
+		RequiresMermaid: libsA.RequiresMermaid || libsB.RequiresMermaid,
+		RequiresMathJax: libsA.RequiresMathJax || libsB.RequiresMathJax,
+	}
+	s.renderTemplate(w, r, "compare.html", data)
+}
+
 // handlePreview handles live preview rendering.
 func (s *Server) handlePreview(w http.ResponseWriter, r *http.Request) {
 	if err := r.ParseForm(); err != nil {
@@ -541,13 +970,13 @@ func (s *Server) handlePreview(w http.ResponseWriter, r *http.Request) {
 	content := r.FormValue("content")
 	path := chi.URLParam(r, "path")
 
-	page, err := wiki.NewPage(s.Storage, s.Config, path, "")
+	page, err := wiki.NewPage(r.Context(), s.Storage, s.Config, path, "")
 	if err != nil {
 		http.Error(w, "Invalid page path", http.StatusBadRequest)
 		return
 	}
 
-	htmlContent, _, libRequirements := s.Renderer.Render(content, page.PageViewURL)
+	htmlContent, _, libRequirements := s.Renderer.RenderFor(content, page.PageViewURL, s.PermissionChecker.PageFilter(r))
 
 	type previewResponse struct {
 		PreviewContent      string `json:"preview_content"`
@@ -581,40 +1010,53 @@ func (s *Server) handleSearch(w http.ResponseWriter, r *http.Request) {
 		query = r.URL.Query().Get("q")
 	}
 
-	var results []wiki.SearchResult
-	if query != "" {
-		var err error
-		results, err = s.Wiki.Search(r.Context(), query)
-		if err != nil {
-			slog.Warn("search failed", "query", query, "error", err)
-		}
-	}
+	results := s.searchPages(r, query)
 
 	data := NewGenericData("Search")
 	data["query"] = query
 	data["results"] = results
+	data["status"] = r.FormValue("status")
+	data["status_options"] = pageStatusFilterOptions()
 	s.renderTemplate(w, r, "search.html", data)
 }
 
+// searchPages returns the pages matching query that the user of r may
+// read, only those with the review status the status parameter of r
+// selects.
+func (s *Server) searchPages(r *http.Request, query string) []wiki.SearchResult {
+	if query == "" {
+		return nil
+	}
+	results, err := s.Wiki.Search(r.Context(), query)
+	if err != nil {
+		slog.Warn("search failed", "query", query, "error", err)
+	}
+	readable := s.PermissionChecker.PageFilter(r)
+	results = slices.DeleteFunc(results, func(res wiki.SearchResult) bool { return !readable(res.Pagepath) })
+	filter, statuses, err := s.pageStatusFilter(r)
+	if err != nil {
+		slog.Warn("failed to list page statuses", "error", err)
+	}
+	if filter == "" || err != nil {
+		return results
+	}
+	return slices.DeleteFunc(results, func(res wiki.SearchResult) bool {
+		return !matchesPageStatus(statuses, res.Pagepath, filter)
+	})
+}
+
 // handleSearchPartial returns only the search results fragment for HTMX requests.
 func (s *Server) handleSearchPartial(w http.ResponseWriter, r *http.Request) {
 	query := r.URL.Query().Get("q")
 
-	var results []wiki.SearchResult
-	if query != "" {
-		var err error
-		results, err = s.Wiki.Search(r.Context(), query)
-		if err != nil {
-			slog.Warn("search failed", "query", query, "error", err)
-		}
-	}
+	results := s.searchPages(r, query)
 
 	data := map[string]interface{}{
 		"query":   query,
 		"results": results,
 	}
 
-	tmpl, ok := s.TemplateMap["search.html"]
+	tmpl, ok := s.theme(r).templates["search.html"]
 	if !ok {
 		http.Error(w, "template not found", http.StatusInternalServerError)
 		return
@@ -637,6 +1079,8 @@ func (s *Server) handleSearchDropdown(w http.ResponseWriter, r *http.Request) {
 		if err != nil {
 			slog.Warn("search dropdown failed", "query", query, "error", err)
 		}
+		readable := s.PermissionChecker.PageFilter(r)
+		results = slices.DeleteFunc(results, func(res wiki.SearchResult) bool { return !readable(res.Pagepath) })
 		if len(results) > 8 {
 			results = results[:8]
 		}
@@ -647,7 +1091,7 @@ func (s *Server) handleSearchDropdown(w http.ResponseWriter, r *http.Request) {
 		"results": results,
 	}
 
-	tmpl, ok := s.TemplateMap["search.html"]
+	tmpl, ok := s.theme(r).templates["search.html"]
 	if !ok {
 		http.Error(w, "template not found", http.StatusInternalServerError)
 		return
@@ -661,16 +1105,94 @@ func (s *Server) handleSearchDropdown(w http.ResponseWriter, r *http.Request) {
 
 // handleChangelog handles the changelog.
 func (s *Server) handleChangelog(w http.ResponseWriter, r *http.Request) {
-	changelog, err := s.Wiki.Changelog(r.Context(), 100)
+	query, err := parseLogFilters(r)
+	if err != nil {
+		s.renderError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	page := 1
+	if p, err := strconv.Atoi(r.URL.Query().Get("page")); err == nil && p > 1 {
+		page = p
+	}
+
+	// Fetch one extra entry to learn whether a next page exists.
+	pageSize := s.listPageSize(r, changelogPageSize)
+	query.Offset = (page - 1) * pageSize
+	query.Limit = pageSize + 1
+	changelog, err := s.Wiki.QueryChangelog(r.Context(), query)
 	if err != nil {
 		changelog = []storage.CommitMetadata{}
 	}
+	hasNext := len(changelog) > pageSize
+	if hasNext {
+		changelog = changelog[:pageSize]
+	}
 
+	q := r.URL.Query()
 	data := NewGenericData("Changelog")
 	data["log"] = changelog
+	data["filter_author"] = q.Get("author")
+	data["filter_path"] = q.Get("path")
+	data["filter_since"] = q.Get("since")
+	data["filter_until"] = q.Get("until")
+	data["page"] = page
+	if page > 1 {
+		data["prev_url"] = changelogPageURL(r, page-1)
+	}
+	if hasNext {
+		data["next_url"] = changelogPageURL(r, page+1)
+	}
 	s.renderTemplate(w, r, "changelog.html", data)
 }
 
+// changelogPageSize is the number of commits per changelog page, unless
+// the user chose another.
+const changelogPageSize = 50
+
+// changelogDateFormat is the accepted format of the since/until filters.
+const changelogDateFormat = "2006-01-02"
+
+// parseLogFilters reads the author, path, since, and until query parameters
+// shared by the changelog page and API. Dates are YYYY-MM-DD; until is
+// inclusive of the whole day. A path ending in a slash keeps to that
+// directory: docs/ leaves out docsearch.md.
+func parseLogFilters(r *http.Request) (storage.LogQuery, error) {
+	q := r.URL.Query()
+	query := storage.LogQuery{
+		Author:     strings.TrimSpace(q.Get("author")),
+		PathPrefix: strings.TrimLeft(strings.TrimSpace(q.Get("path")), "/"),
+	}
+	if v := q.Get("since"); v != "" {
+		t, err := time.Parse(changelogDateFormat, v)
+		if err != nil {
+			return query, fmt.Errorf("invalid since date %q (want YYYY-MM-DD)", v)
+		}
+		query.Since = t
+	}
+	if v := q.Get("until"); v != "" {
+		t, err := time.Parse(changelogDateFormat, v)
+		if err != nil {
+			return query, fmt.Errorf("invalid until date %q (want YYYY-MM-DD)", v)
+		}
+		query.Until = t.Add(24*time.Hour - time.Nanosecond)
+	}
+	return query, nil
+}
+
+// changelogPageURL returns the current changelog URL with its filters kept and
+// the page number replaced. The links of a partial route lead to the whole
+// page.
+func changelogPageURL(r *http.Request, page int) string {
+	q := r.URL.Query()
+	q.Set("page", strconv.Itoa(page))
+	path := r.URL.Path
+	if partialBlock(r) != "" {
+		path = strings.TrimSuffix(path, "/partial")
+	}
+	return path + "?" + q.Encode()
+}
+
 // handleCommit handles viewing a specific commit.
 func (s *Server) handleCommit(w http.ResponseWriter, r *http.Request) {
 	revision := chi.URLParam(r, "revision")
@@ -688,6 +1210,7 @@ func (s *Server) handleCommit(w http.ResponseWriter, r *http.Request) {
 	data["commit"] = meta
 	data["diff"] = diff
 	data["diff_lines"] = diffLines
+	data["permalinks"] = s.commitPermalinks(r, meta.RevisionFull, meta.Files)
 	s.renderTemplate(w, r, "commit.html", data)
 }
 
@@ -720,6 +1243,10 @@ func (s *Server) handleRevert(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if s.refuseUnreviewable(w, r) {
+		return
+	}
+
 	revision := chi.URLParam(r, "revision")
 	message := r.FormValue("message")
 
@@ -735,29 +1262,75 @@ func (s *Server) handleRevert(w http.ResponseWriter, r *http.Request) {
 	http.Redirect(w, r, "/-/changelog", http.StatusFound)
 }
 
-// handlePageIndex handles the page index.
-func (s *Server) handlePageIndex(w http.ResponseWriter, r *http.Request) {
-	entries, err := s.Wiki.PageIndex(r.Context())
+// handleRestoreForm asks to confirm restoring a page to the revision in
+// the query.
+func (s *Server) handleRestoreForm(w http.ResponseWriter, r *http.Request) {
+	path := chi.URLParam(r, "path")
+	revision := r.URL.Query().Get("revision")
+
+	page, err := wiki.NewPage(r.Context(), s.Storage, s.Config, path, revision)
 	if err != nil {
-		s.renderError(w, r, http.StatusInternalServerError, err.Error())
+		s.renderFailure(w, r, err)
+		return
+	}
+	if revision == "" || !page.Exists || page.Metadata == nil {
+		s.renderError(w, r, http.StatusNotFound, "Revision "+revision+" of this page not found")
 		return
 	}
 
-	var pages []map[string]string
-	for _, entry := range entries {
-		pages = append(pages, map[string]string{
-			"name": entry.Name,
-			"path": entry.Path,
-		})
+	data := NewPageViewData("Restore "+page.Pagename, page)
+	data["revision"] = revision
+	data["commit"] = page.Metadata
+	s.renderTemplate(w, r, "restore.html", data)
+}
+
+// handleRestore restores a page to a revision, committing its content then
+// as a new version.
+func (s *Server) handleRestore(w http.ResponseWriter, r *http.Request) {
+	path := chi.URLParam(r, "path")
+	revision := r.FormValue("revision")
+
+	if _, held, err := s.holdRestore(r, path, revision, r.FormValue("message")); errors.Is(err, storage.ErrNotFound) {
+		s.renderError(w, r, http.StatusNotFound, "Revision "+revision+" of this page not found")
+		return
+	} else if err != nil {
+		s.renderFailure(w, r, err)
+		return
+	} else if held {
+		s.SessionManager.AddFlashMessage(w, r, "info", "Your changes are awaiting moderation")
+		http.Redirect(w, r, "/"+path, http.StatusFound)
+		return
 	}
 
-	data := NewGenericData("Page Index")
-	data["pages"] = pages
-	s.renderTemplate(w, r, "pageindex.html", data)
+	result, err := s.Wiki.RestorePage(r.Context(), path, revision, r.FormValue("message"), s.getAuthor(r))
+	switch {
+	case errors.Is(err, storage.ErrNotFound):
+		s.renderError(w, r, http.StatusNotFound, "Revision "+revision+" of this page not found")
+		return
+	case errors.Is(err, wiki.ErrSaveRejected):
+		s.SessionManager.AddFlashMessage(w, r, "danger", err.Error())
+		http.Redirect(w, r, "/"+path+"/history", http.StatusFound)
+		return
+	case err != nil:
+		s.renderFailure(w, r, err)
+		return
+	}
+
+	if result.Changed {
+		s.SessionManager.AddFlashMessage(w, r, "success", "Page restored to revision "+revision)
+	} else {
+		s.SessionManager.AddFlashMessage(w, r, "info", "The page already matches revision "+revision)
+	}
+	http.Redirect(w, r, "/"+result.Page.Pagepath, http.StatusFound)
 }
 
-// handleHealthCheck handles the health check endpoint.
+// handleHealthCheck handles the health check endpoint. The plain form only
+// shows the process is serving; ?deep=1 also checks its dependencies.
 func (s *Server) handleHealthCheck(w http.ResponseWriter, r *http.Request) {
+	if deep, _ := strconv.ParseBool(r.URL.Query().Get("deep")); deep {
+		s.writeDeepHealth(w, r)
+		return
+	}
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]string{
 		"status":  "ok",
@@ -786,7 +1359,7 @@ func (s *Server) handleDraftSave(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Get current revision
-	page, err := wiki.NewPage(s.Storage, s.Config, path, "")
+	page, err := wiki.NewPage(r.Context(), s.Storage, s.Config, path, "")
 	if err != nil {
 		slog.Warn("failed to create page for draft", "path", path, "error", err)
 	}
@@ -0,0 +1,186 @@
+package handlers
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/sa/gopherwiki/internal/wiki"
+)
+
+const (
+	// pageIndexPageSize is the number of pages per page of the page index.
+	pageIndexPageSize = 200
+	// pageIndexGroupMin is the size from which the alphabetical page index
+	// is grouped by initial letter.
+	pageIndexGroupMin = 50
+)
+
+// pageIndexSorts are the orders of the page index: the first is the
+// default.
+var pageIndexSorts = []struct {
+	Value, Label string
+	less         func(a, b wiki.PageInfo) bool
+}{
+	{"name", "Alphabetical", func(a, b wiki.PageInfo) bool { return strings.ToLower(a.Name) < strings.ToLower(b.Name) }},
+	{"updated", "Recently updated", func(a, b wiki.PageInfo) bool { return a.Updated.After(b.Updated) }},
+	{"created", "Recently created", func(a, b wiki.PageInfo) bool { return a.Created.After(b.Created) }},
+	{"size", "Largest", func(a, b wiki.PageInfo) bool { return a.Size > b.Size }},
+}
+
+// pageIndexGroup is a run of the page index under one heading: an initial
+// letter, or none when the index is not grouped.
+type pageIndexGroup struct {
+	Letter string
+	Pages  []wiki.PageInfo
+}
+
+// handlePageIndex handles the page index, sorted by the sort query
+// parameter, filtered by the status one, and paginated.
+func (s *Server) handlePageIndex(w http.ResponseWriter, r *http.Request) {
+	pages, err := s.Wiki.PageInfos(r.Context())
+	if err != nil {
+		s.renderFailure(w, r, err)
+		return
+	}
+
+	mode := pageIndexSorts[0]
+	for _, m := range pageIndexSorts {
+		if m.Value == r.URL.Query().Get("sort") {
+			mode = m
+		}
+	}
+	filter, statuses, err := s.pageStatusFilter(r)
+	if err != nil {
+		s.renderFailure(w, r, err)
+		return
+	}
+	if filter != "" {
+		pages = slices.DeleteFunc(pages, func(p wiki.PageInfo) bool { return !matchesPageStatus(statuses, p.Path, filter) })
+	}
+	sort.SliceStable(pages, func(i, j int) bool { return mode.less(pages[i], pages[j]) })
+
+	page := 1
+	if p, err := strconv.Atoi(r.URL.Query().Get("page")); err == nil && p > 1 {
+		page = p
+	}
+	pageCount := (len(pages) + pageIndexPageSize - 1) / pageIndexPageSize
+	if page > pageCount && pageCount > 0 {
+		page = pageCount
+	}
+	start := (page - 1) * pageIndexPageSize
+	shown := pages[start:min(start+pageIndexPageSize, len(pages))]
+
+	var groups []pageIndexGroup
+	var letters []map[string]string
+	if mode.Value == "name" && len(pages) >= pageIndexGroupMin {
+		for i, p := range pages {
+			letter := initialLetter(p.Name)
+			if len(letters) > 0 && letters[len(letters)-1]["letter"] == letter {
+				continue
+			}
+			letters = append(letters, map[string]string{
+				"letter": letter,
+				"url":    changelogPageURL(r, i/pageIndexPageSize+1) + "#letter-" + letter,
+			})
+		}
+		for _, p := range shown {
+			letter := initialLetter(p.Name)
+			if len(groups) == 0 || groups[len(groups)-1].Letter != letter {
+				groups = append(groups, pageIndexGroup{Letter: letter})
+			}
+			groups[len(groups)-1].Pages = append(groups[len(groups)-1].Pages, p)
+		}
+	} else if len(shown) > 0 {
+		groups = []pageIndexGroup{{Pages: shown}}
+	}
+
+	var sorts []map[string]interface{}
+	for _, m := range pageIndexSorts {
+		q := r.URL.Query()
+		q.Set("sort", m.Value)
+		q.Del("page")
+		sorts = append(sorts, map[string]interface{}{
+			"label":  m.Label,
+			"url":    r.URL.Path + "?" + q.Encode(),
+			"active": m.Value == mode.Value,
+		})
+	}
+
+	var statusFilters []map[string]interface{}
+	for _, o := range pageStatusFilterOptions() {
+		q := r.URL.Query()
+		if o.Value == "" {
+			q.Del("status")
+		} else {
+			q.Set("status", o.Value)
+		}
+		q.Del("page")
+		u := url.URL{Path: r.URL.Path, RawQuery: q.Encode()}
+		statusFilters = append(statusFilters, map[string]interface{}{
+			"label":  o.Label,
+			"url":    u.String(),
+			"active": o.Value == filter,
+		})
+	}
+	if statuses == nil {
+		if statuses, err = s.DB.ListPageStatuses(r.Context()); err != nil {
+			slog.Warn("failed to list page statuses", "error", err)
+		}
+	}
+	labels := make(map[string]string, len(statuses))
+	for path, p := range statuses {
+		labels[path] = pageStatusLabels[p.Status]
+	}
+
+	data := NewGenericData("Page Index")
+	data["groups"] = groups
+	data["letters"] = letters
+	data["sorts"] = sorts
+	data["sort"] = mode.Value
+	data["status_filters"] = statusFilters
+	data["statuses"] = labels
+	data["total"] = len(pages)
+	if page == 1 && filter == "" {
+		data["popular"] = s.popularPages(r.Context(), pages)
+	}
+	data["page"] = page
+	if page > 1 {
+		data["prev_url"] = changelogPageURL(r, page-1)
+	}
+	if page < pageCount {
+		data["next_url"] = changelogPageURL(r, page+1)
+	}
+	s.renderTemplate(w, r, "pageindex.html", data)
+}
+
+// initialLetter returns the heading a page named name is grouped under in
+// the alphabetical page index: its first letter, or "#" when that is not a
+// letter.
+func initialLetter(name string) string {
+	for _, c := range name {
+		if unicode.IsLetter(c) {
+			return string(unicode.ToUpper(c))
+		}
+		break
+	}
+	return "#"
+}
+
+// formatSize formats a size in bytes for display.
+func formatSize(size int64) string {
+	switch {
+	case size < 1024:
+		return fmt.Sprintf("%d B", size)
+	case size < 1024*1024:
+		return fmt.Sprintf("%.1f KB", float64(size)/1024)
+	default:
+		return fmt.Sprintf("%.1f MB", float64(size)/(1024*1024))
+	}
+}
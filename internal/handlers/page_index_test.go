@@ -0,0 +1,104 @@
+package handlers_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/sa/gopherwiki/internal/storage"
+	"github.com/sa/gopherwiki/internal/testutil"
+)
+
+func getPageIndex(t *testing.T, env *testutil.TestEnv, query string) string {
+	t.Helper()
+	w := httptest.NewRecorder()
+	env.Router.ServeHTTP(w, httptest.NewRequest("GET", "/-/pageindex"+query, nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("GET /-/pageindex%s = %d, want 200", query, w.Code)
+	}
+	// The sidebar lists the pages too.
+	body := w.Body.String()
+	if i := strings.Index(body, "<h1>Page Index</h1>"); i >= 0 {
+		body = body[i:]
+	}
+	return body
+}
+
+func TestPageIndex_Sort(t *testing.T) {
+	env := testutil.SetupTestEnv(t)
+	author := storage.Author{Name: "test", Email: "test@test.com"}
+	env.Store.Store(context.Background(), "big.md", "# Big\n\n"+strings.Repeat("text ", 100), "Add big", author)
+	env.Store.Store(context.Background(), "small.md", "# Small", "Add small", author)
+	env.Store.Store(context.Background(), "aardvark.md", "# Aardvark\n\nSome text.", "Add aardvark", author)
+
+	order := func(body string, names ...string) bool {
+		last := -1
+		for _, name := range names {
+			i := strings.Index(body, `href="/`+name+`"`)
+			if i < last {
+				return false
+			}
+			last = i
+		}
+		return true
+	}
+
+	if body := getPageIndex(t, env, ""); !order(body, "aardvark", "big", "small") {
+		t.Error("default order should be alphabetical")
+	}
+	if body := getPageIndex(t, env, "?sort=size"); !order(body, "big", "aardvark", "small") {
+		t.Error("sort=size should list the largest page first")
+	}
+	if body := getPageIndex(t, env, "?sort=updated"); !strings.Contains(body, "<strong>Recently updated</strong>") {
+		t.Error("sort=updated should mark its sort link active")
+	}
+	if body := getPageIndex(t, env, "?sort=bogus"); !strings.Contains(body, "<strong>Alphabetical</strong>") {
+		t.Error("an unknown sort should fall back to alphabetical")
+	}
+}
+
+func TestPageIndex_GroupsAndPages(t *testing.T) {
+	env := testutil.SetupTestEnv(t)
+	files := make(map[string][]byte)
+	// One numbered page, 99 A pages, and 100 B pages fill the first page
+	// of the index; the C pages are on the second.
+	files["1-numbered.md"] = []byte("# Numbered")
+	for letter, count := range map[rune]int{'a': 99, 'b': 100, 'c': 50} {
+		for i := 0; i < count; i++ {
+			files[fmt.Sprintf("%c-page-%03d.md", letter, i)] = []byte("# Page")
+		}
+	}
+	if _, err := env.Store.StoreFiles(context.Background(), files, "Add pages", storage.Author{Name: "test", Email: "test@test.com"}); err != nil {
+		t.Fatal(err)
+	}
+
+	body := getPageIndex(t, env, "")
+	for _, want := range []string{`id="letter-#"`, `id="letter-A"`, `id="letter-B"`, "?page=2"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("first page of the index lacks %q", want)
+		}
+	}
+	if strings.Contains(body, `href="/c-page-`) {
+		t.Error("first page of the index lists pages of the second")
+	}
+	// The letter links point at the page each letter starts on.
+	if !strings.Contains(body, `href="/-/pageindex?page=2#letter-C"`) {
+		t.Error("letter C should link to the second page")
+	}
+
+	body = getPageIndex(t, env, "?page=2")
+	if !strings.Contains(body, `id="letter-C"`) || strings.Contains(body, `href="/1-numbered"`) {
+		t.Error("second page of the index should hold the C pages only")
+	}
+	if !strings.Contains(body, "Previous") {
+		t.Error("second page of the index lacks a link back")
+	}
+
+	// Other orders are not grouped.
+	if body := getPageIndex(t, env, "?sort=updated"); strings.Contains(body, `id="letter-`) {
+		t.Error("the index is grouped by letter when not sorted by name")
+	}
+}
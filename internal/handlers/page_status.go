@@ -0,0 +1,229 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/sa/gopherwiki/internal/db"
+	"github.com/sa/gopherwiki/internal/middleware"
+	"github.com/sa/gopherwiki/internal/wiki"
+)
+
+// pageStatusLabels are the names the review statuses are shown by.
+var pageStatusLabels = map[string]string{
+	db.PageStatusDraft:      "Draft",
+	db.PageStatusInReview:   "In review",
+	db.PageStatusApproved:   "Approved",
+	db.PageStatusDeprecated: "Deprecated",
+}
+
+// pageStatusOption is a review status offered by the status form and the
+// filters of the page index and search.
+type pageStatusOption struct {
+	Value, Label string
+	Allowed      bool // Whether the user may set it
+}
+
+// isReviewer reports whether user may approve and deprecate pages, as they
+// may moderate contributions: approved users and admins.
+func isReviewer(user *middleware.User) bool {
+	return user.IsAuthenticated() && (user.Approved() || user.Admin())
+}
+
+// mayChangePageStatus reports whether user may move a page from status
+// from to status to. Any writer may mark a page a draft or propose it for
+// review; approving or deprecating one, or changing the status of one that
+// is, takes a reviewer.
+func mayChangePageStatus(user *middleware.User, from, to string) bool {
+	if isReviewer(user) {
+		return true
+	}
+	reviewed := func(status string) bool {
+		return status == db.PageStatusApproved || status == db.PageStatusDeprecated
+	}
+	return !reviewed(from) && !reviewed(to)
+}
+
+// pageStatus returns the review status of the page at pagepath, "" when it
+// has none.
+func (s *Server) pageStatus(ctx context.Context, pagepath string) string {
+	p, err := s.DB.GetPageStatus(ctx, pagepath)
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			slog.Warn("failed to get page status", "path", pagepath, "error", err)
+		}
+		return ""
+	}
+	return p.Status
+}
+
+// pageStatusETagSuffix identifies the review status of a page, so that a
+// cached view of it is revalidated when the status changes. It is empty
+// when the page has none.
+func pageStatusETagSuffix(status string) string {
+	if status == "" {
+		return ""
+	}
+	return "-" + status
+}
+
+// pageStatusFilter returns the review status the status query parameter
+// of r filters a list of pages by, "" for all pages, with the statuses of
+// the pages that have one. "none" selects the pages without one.
+func (s *Server) pageStatusFilter(r *http.Request) (string, map[string]db.PageStatus, error) {
+	filter := r.FormValue("status")
+	if filter != "none" && !slices.Contains(db.PageStatuses, filter) {
+		return "", nil, nil
+	}
+	statuses, err := s.DB.ListPageStatuses(r.Context())
+	return filter, statuses, err
+}
+
+// pageStatusFilterOptions returns the choices of the status filter.
+func pageStatusFilterOptions() []pageStatusOption {
+	options := []pageStatusOption{{Value: "", Label: "Any status"}}
+	for _, status := range db.PageStatuses {
+		options = append(options, pageStatusOption{Value: status, Label: pageStatusLabels[status]})
+	}
+	return append(options, pageStatusOption{Value: "none", Label: "No status"})
+}
+
+// matchesPageStatus reports whether the page at pagepath has the status
+// filter selects.
+func matchesPageStatus(statuses map[string]db.PageStatus, pagepath, filter string) bool {
+	status := statuses[pagepath].Status
+	if filter == "none" {
+		return status == ""
+	}
+	return status == filter
+}
+
+// handlePageStatusForm shows the review status of a page, with a form to
+// change it.
+func (s *Server) handlePageStatusForm(w http.ResponseWriter, r *http.Request) {
+	page, err := wiki.NewPage(r.Context(), s.Storage, s.Config, chi.URLParam(r, "path"), "")
+	if err != nil {
+		s.renderFailure(w, r, err)
+		return
+	}
+	if !page.Exists {
+		s.renderError(w, r, http.StatusNotFound, "Page not found")
+		return
+	}
+	current, err := s.DB.GetPageStatus(r.Context(), page.Pagepath)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		s.renderFailure(w, r, err)
+		return
+	}
+
+	user := middleware.GetUser(r)
+	options := []pageStatusOption{{Value: "", Label: "No status", Allowed: mayChangePageStatus(user, current.Status, "")}}
+	for _, status := range db.PageStatuses {
+		options = append(options, pageStatusOption{
+			Value:   status,
+			Label:   pageStatusLabels[status],
+			Allowed: mayChangePageStatus(user, current.Status, status),
+		})
+	}
+
+	data := NewGenericData("Status of " + page.Pagename)
+	data["pagename"] = page.Pagename
+	data["pagepath"] = page.Pagepath
+	data["current"] = current
+	data["current_label"] = pageStatusLabels[current.Status]
+	data["options"] = options
+	data["reviewer"] = isReviewer(user)
+	s.renderTemplate(w, r, "page_status.html", data)
+}
+
+// handlePageStatus changes the review status of a page to the form's
+// status, recording the change in the audit log.
+func (s *Server) handlePageStatus(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	page, err := wiki.NewPage(ctx, s.Storage, s.Config, chi.URLParam(r, "path"), "")
+	if err != nil {
+		s.renderFailure(w, r, err)
+		return
+	}
+	if !page.Exists {
+		s.renderError(w, r, http.StatusNotFound, "Page not found")
+		return
+	}
+	status := r.FormValue("status")
+	if status != "" && !slices.Contains(db.PageStatuses, status) {
+		s.renderError(w, r, http.StatusBadRequest, fmt.Sprintf("Unknown status %q", status))
+		return
+	}
+	from := s.pageStatus(ctx, page.Pagepath)
+	if !mayChangePageStatus(middleware.GetUser(r), from, status) {
+		s.renderError(w, r, http.StatusForbidden, "Only reviewers may approve or deprecate pages")
+		return
+	}
+	statusURL := "/" + page.Pagepath + "/status"
+	if status == from {
+		http.Redirect(w, r, statusURL, http.StatusFound)
+		return
+	}
+
+	if err := s.setPageStatus(r, page.Pagepath, from, status); err != nil {
+		slog.Error("failed to set page status", "path", page.Pagepath, "error", err)
+		s.SessionManager.AddFlashMessage(w, r, "danger", "Failed to change the status")
+		http.Redirect(w, r, statusURL, http.StatusFound)
+		return
+	}
+	label := pageStatusLabels[status]
+	if label == "" {
+		label = "No status"
+	}
+	s.SessionManager.AddFlashMessage(w, r, "success", fmt.Sprintf("Status of %s set to %s", page.Pagepath, label))
+	http.Redirect(w, r, "/"+page.Pagepath, http.StatusFound)
+}
+
+// setPageStatus stores the review status of the page at pagepath, moving
+// it from status from, and records the change in the audit log.
+func (s *Server) setPageStatus(r *http.Request, pagepath, from, to string) error {
+	ctx := r.Context()
+	actor := s.getAuthor(r)
+	now := time.Now()
+	tx, err := s.DB.BeginTx(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = s.DB.SetPageStatus(ctx, tx, db.PageStatus{
+		Pagepath:       pagepath,
+		Status:         to,
+		ChangedByName:  actor.Name,
+		ChangedByEmail: actor.Email,
+		ChangedAt:      now,
+	})
+	if err != nil {
+		return err
+	}
+	none := func(status string) string {
+		if status == "" {
+			return "none"
+		}
+		return status
+	}
+	entry := db.AuditEntry{
+		Action:     "page.status",
+		Detail:     fmt.Sprintf("%s: %s -> %s", pagepath, none(from), none(to)),
+		ActorName:  actor.Name,
+		ActorEmail: actor.Email,
+		CreatedAt:  now,
+	}
+	if err := s.DB.AddAuditEntry(ctx, tx, entry); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
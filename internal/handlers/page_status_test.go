@@ -0,0 +1,99 @@
+package handlers_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/sa/gopherwiki/internal/db"
+	"github.com/sa/gopherwiki/internal/storage"
+	"github.com/sa/gopherwiki/internal/testutil"
+)
+
+func TestPageStatus(t *testing.T) {
+	env := testutil.SetupTestEnv(t)
+	ctx := context.Background()
+	for _, name := range []string{"guide", "notes"} {
+		if _, err := env.Store.Store(ctx, name+".md", "# "+name+"\n\nsearchable\n", "Add "+name, storage.Author{Name: "Alice"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := env.Server.Wiki.RebuildSearchIndex(ctx); err != nil {
+		t.Fatal(err)
+	}
+	reviewer := loginAsUser(t, env, "reviewer@example.com")
+	do := func(method, path string, form url.Values, cookies []*http.Cookie) *httptest.ResponseRecorder {
+		var body *strings.Reader
+		if form != nil {
+			body = strings.NewReader(form.Encode())
+		}
+		req := requestWithCookies(method, path, body, cookies)
+		if form != nil {
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		}
+		w := httptest.NewRecorder()
+		env.Router.ServeHTTP(w, req)
+		return w
+	}
+	status := func(pagepath string) string {
+		p, _ := env.DB.GetPageStatus(ctx, pagepath)
+		return p.Status
+	}
+
+	// Any writer may propose a page for review, which is then flagged on it.
+	if w := do("POST", "/guide/status", url.Values{"status": {"in-review"}}, nil); w.Code != http.StatusFound || status("guide") != db.PageStatusInReview {
+		t.Fatalf("propose for review: status = %d, page status = %q", w.Code, status("guide"))
+	}
+	if body := do("GET", "/guide", nil, nil).Body.String(); !strings.Contains(body, "This page is awaiting review.") {
+		t.Errorf("page in review lacks the banner:\n%s", body)
+	}
+
+	// Only reviewers approve it, which removes the banner.
+	if w := do("POST", "/guide/status", url.Values{"status": {"approved"}}, nil); w.Code != http.StatusForbidden || status("guide") != db.PageStatusInReview {
+		t.Errorf("approve anonymously: status = %d, page status = %q; want it refused", w.Code, status("guide"))
+	}
+	if body := do("GET", "/guide/status", nil, nil).Body.String(); !strings.Contains(body, `<option value="approved" disabled>`) {
+		t.Errorf("status form offers approval to a non-reviewer:\n%s", body)
+	}
+	if w := do("POST", "/guide/status", url.Values{"status": {"approved"}}, reviewer); w.Code != http.StatusFound || status("guide") != db.PageStatusApproved {
+		t.Fatalf("approve: status = %d, page status = %q", w.Code, status("guide"))
+	}
+	if body := do("GET", "/guide", nil, nil).Body.String(); strings.Contains(body, "page-status-notice") {
+		t.Errorf("approved page has a banner:\n%s", body)
+	}
+	if w := do("POST", "/guide/status", url.Values{"status": {"draft"}}, nil); w.Code != http.StatusForbidden {
+		t.Errorf("demote an approved page anonymously: status = %d, want %d", w.Code, http.StatusForbidden)
+	}
+	if w := do("POST", "/guide/status", url.Values{"status": {"bogus"}}, reviewer); w.Code != http.StatusBadRequest {
+		t.Errorf("unknown status: status = %d, want %d", w.Code, http.StatusBadRequest)
+	}
+
+	// The changes are audited.
+	entries, err := env.DB.ListAuditEntries(ctx, 10)
+	if err != nil || len(entries) != 2 || entries[0].Detail != "guide: in-review -> approved" || entries[0].ActorEmail != "reviewer@example.com" || entries[1].Action != "page.status" {
+		t.Errorf("audit entries = %+v, %v; want both status changes", entries, err)
+	}
+
+	// The page index and search filter by status.
+	body := do("GET", "/-/pageindex?status=approved", nil, nil).Body.String()
+	if !strings.Contains(body, `<td><a href="/guide">guide</a> <span class="badge">Approved</span>`) || strings.Contains(body, `<td><a href="/notes">`) {
+		t.Errorf("page index of approved pages:\n%s", body)
+	}
+	body = do("GET", "/-/pageindex?status=none", nil, nil).Body.String()
+	if strings.Contains(body, `<td><a href="/guide">`) || !strings.Contains(body, `<td><a href="/notes">`) {
+		t.Errorf("page index of pages without a status:\n%s", body)
+	}
+	body = do("GET", "/-/search/partial?q=searchable&status=approved", nil, nil).Body.String()
+	if !strings.Contains(body, `href="/guide"`) || strings.Contains(body, `href="/notes"`) {
+		t.Errorf("search of approved pages:\n%s", body)
+	}
+
+	// The status follows a renamed page.
+	do("POST", "/guide/rename", url.Values{"new_pagename": {"manual"}}, reviewer)
+	if status("guide") != "" || status("manual") != db.PageStatusApproved {
+		t.Errorf("after renaming: guide = %q, manual = %q; want the status moved", status("guide"), status("manual"))
+	}
+}
@@ -0,0 +1,72 @@
+package handlers
+
+import (
+	"fmt"
+	"html/template"
+	"strconv"
+	"strings"
+
+	"github.com/sa/gopherwiki/internal/wiki"
+)
+
+// renderPageTree renders the sidebar page tree. Only the top level and the
+// branches leading to and below the current page start expanded, so that the tree of
+// a large wiki stays short; SIDEBAR_MENUTREE_MAXDEPTH, when set, leaves out
+// the levels below it.
+func (s *Server) renderPageTree(nodes []*wiki.PageTreeNode, current string) template.HTML {
+	if len(nodes) == 0 {
+		return ""
+	}
+	maxDepth, err := strconv.Atoi(s.Config.SidebarMenutreeMaxdepth)
+	if err != nil || maxDepth < 1 {
+		maxDepth = 0
+	}
+	current = strings.Trim(current, "/")
+
+	var b strings.Builder
+	link := func(n *wiki.PageTreeNode, style string) {
+		b.WriteString(`<a href="/`)
+		b.WriteString(template.HTMLEscapeString(n.Path))
+		b.WriteString(`" class="sidebar-link"`)
+		if style != "" {
+			b.WriteString(` style="`)
+			b.WriteString(style)
+			b.WriteString(`"`)
+		}
+		if strings.EqualFold(n.Path, current) {
+			b.WriteString(` aria-current="page"`)
+		}
+		if n.Title != n.Name {
+			b.WriteString(` title="`)
+			b.WriteString(template.HTMLEscapeString(n.Name))
+			b.WriteString(`"`)
+		}
+		b.WriteString(">")
+		b.WriteString(template.HTMLEscapeString(n.Title))
+		b.WriteString("</a>")
+	}
+	var render func([]*wiki.PageTreeNode, int)
+	render = func(nodes []*wiki.PageTreeNode, depth int) {
+		for _, n := range nodes {
+			if len(n.Children) > 0 && (maxDepth == 0 || depth+1 < maxDepth) {
+				b.WriteString("<details")
+				if depth == 0 || strings.EqualFold(n.Path, current) || strings.HasPrefix(strings.ToLower(current), strings.ToLower(n.Path)+"/") {
+					b.WriteString(" open")
+				}
+				b.WriteString("><summary>")
+				if n.IsPage {
+					link(n, "")
+				} else {
+					b.WriteString(template.HTMLEscapeString(n.Title))
+				}
+				b.WriteString("</summary>")
+				render(n.Children, depth+1)
+				b.WriteString("</details>")
+			} else if n.IsPage {
+				link(n, fmt.Sprintf("padding-left: %dpx;", (depth+1)*12))
+			}
+		}
+	}
+	render(nodes, 0)
+	return template.HTML(b.String())
+}
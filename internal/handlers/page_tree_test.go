@@ -0,0 +1,57 @@
+package handlers_test
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/sa/gopherwiki/internal/storage"
+	"github.com/sa/gopherwiki/internal/testutil"
+)
+
+func TestSidebarPageTree(t *testing.T) {
+	env := testutil.SetupTestEnv(t)
+	author := storage.Author{Name: "test", Email: "test@test.com"}
+	for name, content := range map[string]string{
+		"home.md":                 "# Home",
+		"docs/intro.md":           "# Introduction",
+		"docs/deep/nested.md":     "# Nested",
+		"other/deep/elsewhere.md": "# Elsewhere",
+	} {
+		if _, err := env.Store.Store(context.Background(), name, content, "init", author); err != nil {
+			t.Fatalf("store %s: %v", name, err)
+		}
+	}
+	if _, err := env.Server.Wiki.RebuildSearchIndex(context.Background()); err != nil {
+		t.Fatalf("RebuildSearchIndex: %v", err)
+	}
+	env.Server.Wiki.InvalidatePageTreeCache()
+
+	sidebar := func(path string) string {
+		t.Helper()
+		w := viewPage(t, env, path, "")
+		if w.Code != http.StatusOK {
+			t.Fatalf("GET %s: status = %d", path, w.Code)
+		}
+		_, tree, _ := strings.Cut(w.Body.String(), `class="sidebar-tree"`)
+		tree, _, _ = strings.Cut(tree, `<div class="sidebar-divider">`)
+		return tree
+	}
+
+	tree := sidebar("/docs/deep")
+	if !strings.Contains(tree, `<details open><summary>deep</summary><a href="/docs/deep/nested"`) {
+		t.Errorf("the branch of the current page should be open:\n%s", tree)
+	}
+	if tree := sidebar("/docs/intro"); !strings.Contains(tree, `<a href="/docs/intro" class="sidebar-link" style="padding-left: 24px;" aria-current="page" title="intro">Introduction</a>`) {
+		t.Errorf("the current page should be marked, and shown by title:\n%s", tree)
+	}
+	if !strings.Contains(tree, `<details><summary>deep</summary><a href="/other/deep/elsewhere"`) {
+		t.Errorf("other branches should be closed:\n%s", tree)
+	}
+
+	env.Server.Config.SidebarMenutreeMaxdepth = "2"
+	if tree := sidebar("/home"); strings.Contains(tree, "nested") || !strings.Contains(tree, "Introduction") {
+		t.Errorf("SIDEBAR_MENUTREE_MAXDEPTH=2 should leave out the third level:\n%s", tree)
+	}
+}
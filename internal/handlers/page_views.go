@@ -0,0 +1,144 @@
+package handlers
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/sa/gopherwiki/internal/db"
+	"github.com/sa/gopherwiki/internal/wiki"
+)
+
+const (
+	// pageViewDays is the number of days, today included, that popular
+	// pages and view trends are counted over.
+	pageViewDays = 30
+	// popularPagesLimit is the number of popular pages the page index
+	// lists.
+	popularPagesLimit = 10
+	// pageViewTrendLimit is the number of pages the view trends show.
+	pageViewTrendLimit = 50
+)
+
+// popularPage is a page of the popular pages, with its recent views.
+type popularPage struct {
+	Path, Name string
+	Views      int
+}
+
+// pageViewTrend is the views of a page over the last pageViewDays days.
+type pageViewTrend struct {
+	Pagepath string
+	Total    int
+	Week     int // Views in the last seven days
+	Days     []pageViewBar
+}
+
+// pageViewBar is a day of a view trend, with its height relative to the
+// busiest day of the page.
+type pageViewBar struct {
+	Day     string
+	Views   int
+	Percent int
+}
+
+// pageViewsSince returns the first day views are counted from, as of now.
+func pageViewsSince(now time.Time) time.Time {
+	return now.UTC().AddDate(0, 0, 1-pageViewDays)
+}
+
+// countPageView counts a view of the current version of page when view
+// counts are on. Only the page and the day are stored, nothing about who
+// viewed it.
+func (s *Server) countPageView(r *http.Request, page *wiki.Page) {
+	if !s.Config.ViewCounts || r.Method != http.MethodGet || page.Revision != "" {
+		return
+	}
+	if err := s.DB.CountPageView(r.Context(), page.Pagepath, time.Now()); err != nil {
+		slog.Warn("failed to count page view", "pagepath", page.Pagepath, "error", err)
+	}
+}
+
+// popularPages returns the pages of pages viewed most over the last
+// pageViewDays days, or nothing when view counts are off.
+func (s *Server) popularPages(ctx context.Context, pages []wiki.PageInfo) []popularPage {
+	if !s.Config.ViewCounts {
+		return nil
+	}
+	// Some of the most viewed may have been renamed or deleted since.
+	views, err := s.DB.PopularPages(ctx, pageViewsSince(time.Now()), 3*popularPagesLimit)
+	if err != nil {
+		slog.Warn("failed to list popular pages", "error", err)
+		return nil
+	}
+	names := make(map[string]string, len(pages))
+	for _, p := range pages {
+		names[p.Path] = p.Name
+	}
+	var popular []popularPage
+	for _, v := range views {
+		if name, ok := names[v.Pagepath]; ok && len(popular) < popularPagesLimit {
+			popular = append(popular, popularPage{Path: v.Pagepath, Name: name, Views: v.Views})
+		}
+	}
+	return popular
+}
+
+// handleAdminPageViews shows the views of the most viewed pages per day
+// over the last pageViewDays days.
+func (s *Server) handleAdminPageViews(w http.ResponseWriter, r *http.Request) {
+	if !s.requireAdmin(w, r) {
+		return
+	}
+
+	now := time.Now().UTC()
+	since := pageViewsSince(now)
+	popular, err := s.DB.PopularPages(r.Context(), since, pageViewTrendLimit)
+	if err != nil {
+		s.renderError(w, r, http.StatusInternalServerError, "Failed to load the page views")
+		return
+	}
+	days, err := s.DB.ListPageViewDays(r.Context(), since)
+	if err != nil {
+		s.renderError(w, r, http.StatusInternalServerError, "Failed to load the page views")
+		return
+	}
+
+	views := make(map[string]map[string]int, len(popular))
+	for _, p := range popular {
+		views[p.Pagepath] = make(map[string]int)
+	}
+	for _, d := range days {
+		if byDay, ok := views[d.Pagepath]; ok {
+			byDay[d.Day] = d.Views
+		}
+	}
+	weekStart := now.AddDate(0, 0, -6).Format(db.PageViewDayFormat)
+	var trends []pageViewTrend
+	for _, p := range popular {
+		trend := pageViewTrend{Pagepath: p.Pagepath, Total: p.Views}
+		busiest := 0
+		for i := range pageViewDays {
+			day := since.AddDate(0, 0, i).Format(db.PageViewDayFormat)
+			n := views[p.Pagepath][day]
+			busiest = max(busiest, n)
+			if day >= weekStart {
+				trend.Week += n
+			}
+			trend.Days = append(trend.Days, pageViewBar{Day: day, Views: n})
+		}
+		for i := range trend.Days {
+			if busiest > 0 {
+				trend.Days[i].Percent = trend.Days[i].Views * 100 / busiest
+			}
+		}
+		trends = append(trends, trend)
+	}
+
+	data := NewGenericData("Page Views")
+	data["trends"] = trends
+	data["days"] = pageViewDays
+	data["counting"] = s.Config.ViewCounts
+	s.renderTemplate(w, r, "admin_page_views.html", data)
+}
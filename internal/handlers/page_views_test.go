@@ -0,0 +1,62 @@
+package handlers_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sa/gopherwiki/internal/storage"
+	"github.com/sa/gopherwiki/internal/testutil"
+)
+
+func TestPageViews(t *testing.T) {
+	env := testutil.SetupTestEnv(t)
+	ctx := context.Background()
+	for _, file := range []string{"guide.md", "notes.md", "quiet.md"} {
+		if _, err := env.Store.Store(ctx, file, "# "+file, "Add "+file, storage.Author{Name: "Alice"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	get := func(path string, cookies []*http.Cookie) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		env.Router.ServeHTTP(w, requestWithCookies("GET", path, nil, cookies))
+		return w
+	}
+
+	// Views are not counted until view counts are turned on.
+	get("/guide", nil)
+	if popular, _ := env.DB.PopularPages(ctx, time.Now().AddDate(0, 0, -1), 10); len(popular) != 0 {
+		t.Errorf("views counted with view counts off: %+v", popular)
+	}
+	if body := get("/-/pageindex", nil).Body.String(); strings.Contains(body, "Popular Pages") {
+		t.Error("page index lists popular pages with view counts off")
+	}
+
+	env.Server.Config.ViewCounts = true
+	for _, path := range []string{"/guide", "/guide", "/notes", "/guide?revision=0000000", "/missing"} {
+		get(path, nil)
+	}
+	env.Router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("HEAD", "/notes", nil))
+	popular, err := env.DB.PopularPages(ctx, time.Now().AddDate(0, 0, -1), 10)
+	if err != nil || len(popular) != 2 || popular[0].Pagepath != "guide" || popular[0].Views != 2 ||
+		popular[1].Pagepath != "notes" || popular[1].Views != 1 {
+		t.Errorf("PopularPages = %+v, %v; want guide 2 and notes 1", popular, err)
+	}
+
+	body := get("/-/pageindex", nil).Body.String()
+	guide, notes := strings.Index(body, `<li><a href="/guide">`), strings.Index(body, `<li><a href="/notes">`)
+	if !strings.Contains(body, "Popular Pages") || guide < 0 || notes < guide || strings.Contains(body, `<li><a href="/quiet">`) {
+		t.Errorf("page index should list guide, then notes, as popular:\n%s", body)
+	}
+
+	if w := get("/-/admin/page-views", nil); w.Code == http.StatusOK {
+		t.Errorf("page views without logging in: status = %d", w.Code)
+	}
+	body = get("/-/admin/page-views", loginAsAdmin(t, env)).Body.String()
+	if !strings.Contains(body, `<a href="/guide">guide</a>`) || !strings.Contains(body, `title="`+time.Now().UTC().Format("2006-01-02")+`: 2 views"`) {
+		t.Errorf("page views should show today's views of guide:\n%s", body)
+	}
+}
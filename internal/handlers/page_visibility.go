@@ -0,0 +1,126 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/sa/gopherwiki/internal/db"
+	"github.com/sa/gopherwiki/internal/wiki"
+)
+
+// pagePublic reports whether the page at pagepath is public.
+func (s *Server) pagePublic(ctx context.Context, pagepath string) bool {
+	public, err := s.DB.ListPublicPages(ctx)
+	if err != nil {
+		slog.Warn("failed to list public pages", "error", err)
+		return false
+	}
+	return public[pagepath]
+}
+
+// pageVisibilityETagSuffix marks the view of a public page, so that a
+// cached view is revalidated when the page is made public or private.
+func pageVisibilityETagSuffix(public bool) string {
+	if !public {
+		return ""
+	}
+	return "-" + db.PageVisibilityPublic
+}
+
+// handlePageVisibilityForm shows whether a page is public, with a form to
+// change it.
+func (s *Server) handlePageVisibilityForm(w http.ResponseWriter, r *http.Request) {
+	page, err := wiki.NewPage(r.Context(), s.Storage, s.Config, chi.URLParam(r, "path"), "")
+	if err != nil {
+		s.renderFailure(w, r, err)
+		return
+	}
+	if !page.Exists {
+		s.renderError(w, r, http.StatusNotFound, "Page not found")
+		return
+	}
+	public, err := s.DB.ListPublicPages(r.Context())
+	if err != nil {
+		s.renderFailure(w, r, err)
+		return
+	}
+
+	data := NewGenericData("Visibility of " + page.Pagename)
+	data["pagename"] = page.Pagename
+	data["pagepath"] = page.Pagepath
+	data["public"] = public[page.Pagepath]
+	data["read_access"] = s.Settings.Get(r.Context()).ReadAccess
+	s.renderTemplate(w, r, "page_visibility.html", data)
+}
+
+// handlePageVisibility makes a page public, or has it follow the site's
+// read access again, recording the change in the audit log.
+func (s *Server) handlePageVisibility(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	page, err := wiki.NewPage(ctx, s.Storage, s.Config, chi.URLParam(r, "path"), "")
+	if err != nil {
+		s.renderFailure(w, r, err)
+		return
+	}
+	if !page.Exists {
+		s.renderError(w, r, http.StatusNotFound, "Page not found")
+		return
+	}
+	visibility := r.FormValue("visibility")
+	if visibility != "" && visibility != db.PageVisibilityPublic {
+		s.renderError(w, r, http.StatusBadRequest, fmt.Sprintf("Unknown visibility %q", visibility))
+		return
+	}
+
+	actor := s.getAuthor(r)
+	now := time.Now()
+	err = func() error {
+		tx, err := s.DB.BeginTx(ctx)
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+		err = s.DB.SetPageVisibility(ctx, tx, db.PageVisibility{
+			Pagepath:       page.Pagepath,
+			Visibility:     visibility,
+			ChangedByName:  actor.Name,
+			ChangedByEmail: actor.Email,
+			ChangedAt:      now,
+		})
+		if err != nil {
+			return err
+		}
+		detail := page.Pagepath + ": site"
+		if visibility != "" {
+			detail = page.Pagepath + ": " + visibility
+		}
+		entry := db.AuditEntry{
+			Action:     "page.visibility",
+			Detail:     detail,
+			ActorName:  actor.Name,
+			ActorEmail: actor.Email,
+			CreatedAt:  now,
+		}
+		if err := s.DB.AddAuditEntry(ctx, tx, entry); err != nil {
+			return err
+		}
+		return tx.Commit()
+	}()
+	if err != nil {
+		slog.Error("failed to set page visibility", "path", page.Pagepath, "error", err)
+		s.SessionManager.AddFlashMessage(w, r, "danger", "Failed to change the visibility")
+		http.Redirect(w, r, "/"+page.Pagepath+"/visibility", http.StatusFound)
+		return
+	}
+	if visibility == db.PageVisibilityPublic {
+		s.SessionManager.AddFlashMessage(w, r, "success", page.Pagepath+" is public")
+	} else {
+		s.SessionManager.AddFlashMessage(w, r, "success", page.Pagepath+" follows the site's read access")
+	}
+	http.Redirect(w, r, "/"+page.Pagepath, http.StatusFound)
+}
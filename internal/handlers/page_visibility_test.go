@@ -0,0 +1,103 @@
+package handlers_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/sa/gopherwiki/internal/storage"
+	"github.com/sa/gopherwiki/internal/testutil"
+)
+
+func TestPageVisibility(t *testing.T) {
+	env := testutil.SetupTestEnv(t)
+	env.Server.Config.ReadAccess = "REGISTERED"
+	ctx := context.Background()
+	for file, content := range map[string]string{
+		"welcome.md":        "# Welcome\n\nfindable public text\n",
+		"welcome/logo.txt":  "logo",
+		"internal.md":       "# Internal\n\nfindable private text\n",
+		"internal/plan.txt": "plan",
+	} {
+		if _, err := env.Store.Store(ctx, file, content, "Add "+file, storage.Author{Name: "Alice"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := env.Server.Wiki.RebuildSearchIndex(ctx); err != nil {
+		t.Fatal(err)
+	}
+	admin := loginAsAdmin(t, env)
+	do := func(method, path string, form url.Values, cookies []*http.Cookie) *httptest.ResponseRecorder {
+		var body *strings.Reader
+		if form != nil {
+			body = strings.NewReader(form.Encode())
+		}
+		req := requestWithCookies(method, path, body, cookies)
+		if form != nil {
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		}
+		w := httptest.NewRecorder()
+		env.Router.ServeHTTP(w, req)
+		return w
+	}
+
+	// Without public pages, lists of pages need read access too.
+	if w := do("GET", "/-/sitemap.xml", nil, nil); w.Code != http.StatusFound {
+		t.Errorf("sitemap without public pages: status = %d, want a redirect to log in", w.Code)
+	}
+
+	// Only admins make a page public, which is audited.
+	writer := loginAsUser(t, env, "bob@example.com")
+	if w := do("POST", "/welcome/visibility", url.Values{"visibility": {"public"}}, writer); w.Code != http.StatusForbidden {
+		t.Errorf("make public as a writer: status = %d, want %d", w.Code, http.StatusForbidden)
+	}
+	if w := do("POST", "/welcome/visibility", url.Values{"visibility": {"public"}}, admin); w.Code != http.StatusFound {
+		t.Fatalf("make public: status = %d, want %d", w.Code, http.StatusFound)
+	}
+	if entries, _ := env.DB.ListAuditEntries(ctx, 1); len(entries) != 1 || entries[0].Detail != "welcome: public" {
+		t.Errorf("audit entries = %+v, want the visibility change", entries)
+	}
+	if body := do("GET", "/welcome", nil, admin).Body.String(); !strings.Contains(body, "This page is public") {
+		t.Errorf("public page lacks the notice for readers:\n%s", body)
+	}
+
+	// Anonymous visitors read the public page and its attachments, and find
+	// only it in search, the feed, and the sitemap.
+	if w := do("GET", "/welcome", nil, nil); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "findable public text") {
+		t.Errorf("public page: status = %d", w.Code)
+	}
+	if w := do("GET", "/welcome/logo.txt", nil, nil); w.Code != http.StatusOK {
+		t.Errorf("public page's attachment: status = %d", w.Code)
+	}
+	for _, path := range []string{"/internal", "/internal/plan.txt", "/welcome/history", "/-/changelog"} {
+		if w := do("GET", path, nil, nil); w.Code != http.StatusFound {
+			t.Errorf("GET %s anonymously: status = %d, want a redirect to log in", path, w.Code)
+		}
+	}
+	for _, path := range []string{"/-/search?q=findable", "/-/search/dropdown?q=findable", "/-/sitemap.xml", "/-/feed.atom"} {
+		w := do("GET", path, nil, nil)
+		if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "/welcome") || strings.Contains(w.Body.String(), "/internal") {
+			t.Errorf("GET %s anonymously: status = %d\n%s", path, w.Code, w.Body.String())
+		}
+	}
+	if body := do("GET", "/-/search?q=findable", nil, admin).Body.String(); !strings.Contains(body, `href="/internal"`) {
+		t.Errorf("search as an admin lacks the private page:\n%s", body)
+	}
+
+	// The flag follows a renamed page, and goes with a deleted one.
+	if _, err := env.Store.Store(ctx, "faq.md", "# FAQ\n", "Add faq", storage.Author{Name: "Alice"}); err != nil {
+		t.Fatal(err)
+	}
+	do("POST", "/faq/visibility", url.Values{"visibility": {"public"}}, admin)
+	do("POST", "/faq/rename", url.Values{"new_pagename": {"help"}}, admin)
+	if w := do("GET", "/help", nil, nil); w.Code != http.StatusOK {
+		t.Errorf("renamed public page: status = %d", w.Code)
+	}
+	do("POST", "/help/delete", url.Values{}, admin)
+	if public, _ := env.DB.ListPublicPages(ctx); len(public) != 1 || !public["welcome"] {
+		t.Errorf("public pages after deleting = %v, want only welcome", public)
+	}
+}
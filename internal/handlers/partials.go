@@ -0,0 +1,26 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+)
+
+// partialKey is the context key of the template block a partial route
+// renders.
+type partialKey struct{}
+
+// partial serves next as a partial route: the template it renders is
+// executed from block, one of its define blocks, instead of the whole page,
+// for htmx to swap into the page already shown.
+func partial(block string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		next(w, r.WithContext(context.WithValue(r.Context(), partialKey{}, block)))
+	}
+}
+
+// partialBlock returns the template block the request renders, or "" for
+// a whole page.
+func partialBlock(r *http.Request) string {
+	block, _ := r.Context().Value(partialKey{}).(string)
+	return block
+}
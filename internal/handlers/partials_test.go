@@ -0,0 +1,57 @@
+package handlers_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/sa/gopherwiki/internal/db"
+	"github.com/sa/gopherwiki/internal/storage"
+	"github.com/sa/gopherwiki/internal/testutil"
+)
+
+func TestPartials(t *testing.T) {
+	env := testutil.SetupTestEnv(t)
+	ctx := context.Background()
+	author := storage.Author{Name: "Alice", Email: "alice@example.com"}
+	for i, content := range []string{"# Guide\n\nFirst draft.\n", "# Guide\n\nSecond draft.\n"} {
+		if _, err := env.Store.Store(ctx, "guide.md", content, "Edit guide "+string(rune('1'+i)), author); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := env.Store.Store(ctx, "guide/diagram.png", "png", "Add diagram", author); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := env.DB.Queries.CreateIssue(ctx, db.CreateIssueParams{Title: "Broken link", Status: "open"}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		path, want string
+	}{
+		{"/guide/partial", "Second draft."},
+		{"/guide/history/partial", "Edit guide 2"},
+		{"/guide/attachments/partial", "diagram.png"},
+		{"/-/changelog/partial", "Edit guide 1"},
+		{"/-/issues/partial", "Broken link"},
+	} {
+		w := httptest.NewRecorder()
+		env.Router.ServeHTTP(w, httptest.NewRequest("GET", tc.path, nil))
+		body := w.Body.String()
+		if w.Code != http.StatusOK || !strings.Contains(body, tc.want) {
+			t.Errorf("GET %s: status = %d, want %d with %q:\n%s", tc.path, w.Code, http.StatusOK, tc.want, body)
+		}
+		if strings.Contains(body, "<html") || strings.Contains(body, "wiki-navbar") {
+			t.Errorf("GET %s: rendered the whole page, not a fragment", tc.path)
+		}
+	}
+
+	// Links lead to the whole page.
+	w := httptest.NewRecorder()
+	env.Router.ServeHTTP(w, httptest.NewRequest("GET", "/-/changelog/partial?page=2", nil))
+	if body := w.Body.String(); !strings.Contains(body, `href="/-/changelog?`) || strings.Contains(body, "/partial") {
+		t.Errorf("changelog fragment should link the whole changelog:\n%s", body)
+	}
+}
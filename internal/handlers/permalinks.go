@@ -0,0 +1,59 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/sa/gopherwiki/internal/util"
+	"github.com/sa/gopherwiki/internal/wiki"
+)
+
+// permalinkURL returns the permanent link to the page at pagepath as of
+// the commit revision, which should be a full hash: a short one may
+// become ambiguous as the history grows.
+func permalinkURL(revision, pagepath string) string {
+	return "/-/p/" + revision + "/" + pagepath
+}
+
+// handlePermalink renders a page as of a revision. Any revision the
+// repository resolves redirects to the permalink of the full hash of that
+// commit, which keeps showing the same version of the page.
+func (s *Server) handlePermalink(w http.ResponseWriter, r *http.Request) {
+	revision := chi.URLParam(r, "revision")
+	path := chi.URLParam(r, "*")
+
+	page, err := wiki.NewPage(r.Context(), s.Storage, s.Config, path, revision)
+	if err != nil {
+		s.renderFailure(w, r, err)
+		return
+	}
+	if !page.Exists || page.Metadata == nil {
+		s.renderError(w, r, http.StatusNotFound, "Revision "+revision+" of this page not found")
+		return
+	}
+	if revision != page.Metadata.RevisionFull || path != page.Pagepath {
+		http.Redirect(w, r, permalinkURL(page.Metadata.RevisionFull, page.Pagepath), http.StatusMovedPermanently)
+		return
+	}
+
+	// Titles and links name the revision by its short hash, as in history.
+	page.Revision = page.Metadata.Revision
+	s.renderPage(w, r, page)
+}
+
+// commitPermalinks returns the permalinks to the pages a commit changed
+// that exist as of it, keyed by file.
+func (s *Server) commitPermalinks(r *http.Request, revision string, files []string) map[string]string {
+	links := make(map[string]string)
+	for _, f := range files {
+		if !util.IsMarkdownFile(f) {
+			continue
+		}
+		if _, err := s.Storage.Load(r.Context(), f, revision); err != nil {
+			continue
+		}
+		links[f] = permalinkURL(revision, util.StripMarkdownExtension(f))
+	}
+	return links
+}
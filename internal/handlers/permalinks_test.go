@@ -0,0 +1,69 @@
+package handlers_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/sa/gopherwiki/internal/storage"
+	"github.com/sa/gopherwiki/internal/testutil"
+)
+
+func TestPermalinks(t *testing.T) {
+	env := testutil.SetupTestEnv(t)
+	ctx := context.Background()
+	author := storage.Author{Name: "Alice", Email: "alice@example.com"}
+	if _, err := env.Store.Store(ctx, "guide.md", "# Guide\n\nFirst version.\n", "Add guide", author); err != nil {
+		t.Fatal(err)
+	}
+	first, err := env.Store.Metadata(ctx, "guide.md", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := env.Store.Store(ctx, "guide.md", "# Guide\n\nSecond version.\n", "Update guide", author); err != nil {
+		t.Fatal(err)
+	}
+	get := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		env.Router.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		return w
+	}
+	permalink := "/-/p/" + first.RevisionFull + "/guide"
+
+	// The permalink keeps showing the first version, with the archival
+	// banner, after the page changed.
+	w := get(permalink)
+	if w.Code != http.StatusOK {
+		t.Fatalf("permalink: status = %d, want %d", w.Code, http.StatusOK)
+	}
+	body := w.Body.String()
+	if !strings.Contains(body, "First version.") || strings.Contains(body, "Second version.") {
+		t.Errorf("permalink should show the first version:\n%s", body)
+	}
+	if !strings.Contains(body, "revision <strong>"+first.Revision+"</strong> of this page, saved") || !strings.Contains(body, "by Alice") {
+		t.Errorf("permalink lacks the archival banner:\n%s", body)
+	}
+	if !strings.Contains(body, `href="`+permalink+`" data-action="copy-link"`) {
+		t.Errorf("permalink banner lacks the copy link:\n%s", body)
+	}
+
+	// A short revision redirects to the full hash.
+	if w := get("/-/p/" + first.Revision + "/guide"); w.Code != http.StatusMovedPermanently || w.Header().Get("Location") != permalink {
+		t.Errorf("short permalink: status = %d, location = %q; want a redirect to %s", w.Code, w.Header().Get("Location"), permalink)
+	}
+	for _, path := range []string{"/-/p/0000000/guide", "/-/p/" + first.RevisionFull + "/missing"} {
+		if w := get(path); w.Code != http.StatusNotFound {
+			t.Errorf("GET %s: status = %d, want %d", path, w.Code, http.StatusNotFound)
+		}
+	}
+
+	// History and the commit view offer to copy it.
+	if body := get("/guide/history").Body.String(); !strings.Contains(body, `href="`+permalink+`" data-action="copy-link"`) {
+		t.Errorf("history lacks the permalink:\n%s", body)
+	}
+	if body := get("/-/commit/" + first.Revision).Body.String(); !strings.Contains(body, `href="`+permalink+`" data-action="copy-link"`) {
+		t.Errorf("commit view lacks the permalink:\n%s", body)
+	}
+}
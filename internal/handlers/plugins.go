@@ -0,0 +1,21 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/sa/gopherwiki/internal/models"
+)
+
+// pluginUser returns the user an auth plugin names for r, provisioning the
+// account, or nil when no plugin authenticates r.
+func (s *Server) pluginUser(r *http.Request) (*models.User, error) {
+	id, ok := s.Plugins.Authenticate(r)
+	if !ok {
+		return nil, nil
+	}
+	if id.Email == "" {
+		return nil, fmt.Errorf("identity %q has no email", id.Name)
+	}
+	return s.Auth.ProvisionUser(r.Context(), id)
+}
@@ -0,0 +1,104 @@
+package handlers_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/sa/gopherwiki/internal/auth"
+	"github.com/sa/gopherwiki/internal/testutil"
+	"github.com/sa/gopherwiki/internal/wiki"
+)
+
+// testPlugin refuses saves mentioning spam, marks rendered pages, serves a
+// route, and logs in requests carrying X-Plugin-User.
+type testPlugin struct {
+	saved []string
+}
+
+func (p *testPlugin) Name() string { return "test" }
+
+func (p *testPlugin) BeforeSave(ctx context.Context, ev *wiki.SaveEvent) error {
+	if strings.Contains(ev.Content, "spam") {
+		return errors.New("spam is not allowed")
+	}
+	return nil
+}
+
+func (p *testPlugin) AfterSave(ctx context.Context, ev wiki.SaveEvent) {
+	p.saved = append(p.saved, ev.Pagepath)
+}
+
+func (p *testPlugin) FilterHTML(pageURL, html string) string {
+	return html + `<p class="plugin-mark">` + pageURL + `</p>`
+}
+
+func (p *testPlugin) Routes(r chi.Router) {
+	r.Get("/hello", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("hello from the plugin"))
+	})
+}
+
+func (p *testPlugin) Authenticate(r *http.Request) (auth.Identity, bool) {
+	email := r.Header.Get("X-Plugin-User")
+	return auth.Identity{Name: "Plugin User", Email: email}, email != ""
+}
+
+func TestPlugins(t *testing.T) {
+	env := testutil.SetupTestEnv(t)
+	p := &testPlugin{}
+	if err := env.Server.Plugins.Register(p); err != nil {
+		t.Fatal(err)
+	}
+	router := env.Server.Routes()
+
+	save := func(content string) *httptest.ResponseRecorder {
+		form := url.Values{"content": {content}}
+		req := httptest.NewRequest("POST", "/plugged/save", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+	if w := save("buy spam now"); w.Code != http.StatusUnprocessableEntity || !strings.Contains(w.Body.String(), "spam is not allowed") {
+		t.Errorf("refused save = %d, want %d with the plugin's reason", w.Code, http.StatusUnprocessableEntity)
+	}
+	if env.Store.Exists(context.Background(), "plugged.md") {
+		t.Error("refused save was stored")
+	}
+	if w := save("# Plugged\n\nFine content."); w.Code != http.StatusFound {
+		t.Fatalf("save = %d, want %d", w.Code, http.StatusFound)
+	}
+	if len(p.saved) != 1 || p.saved[0] != "plugged" {
+		t.Errorf("AfterSave saw %v, want [plugged]", p.saved)
+	}
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/plugged", nil))
+	if !strings.Contains(w.Body.String(), `<p class="plugin-mark">/plugged</p>`) {
+		t.Error("page view did not pass through the render filter")
+	}
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/-/plugins/test/hello", nil))
+	if w.Code != http.StatusOK || w.Body.String() != "hello from the plugin" {
+		t.Errorf("plugin route = %d %q", w.Code, w.Body.String())
+	}
+
+	req := httptest.NewRequest("GET", "/-/settings", nil)
+	req.Header.Set("X-Plugin-User", "plugged@example.com")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Errorf("settings as the plugin's user = %d, want %d", w.Code, http.StatusOK)
+	}
+	if _, err := env.Server.Auth.GetUserByEmail(context.Background(), "plugged@example.com"); err != nil {
+		t.Errorf("plugin user not provisioned: %v", err)
+	}
+}
@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"net/http"
+)
+
+// offlineURL is the page the service worker shows for a page it has not
+// kept for offline reading.
+const offlineURL = "/-/offline"
+
+// webManifestIcon is an icon of the web app manifest.
+type webManifestIcon struct {
+	Src   string `json:"src"`
+	Sizes string `json:"sizes"`
+	Type  string `json:"type"`
+}
+
+// webManifest is the web app manifest that makes the wiki installable.
+type webManifest struct {
+	Name        string            `json:"name"`
+	ShortName   string            `json:"short_name"`
+	Description string            `json:"description,omitempty"`
+	StartURL    string            `json:"start_url"`
+	Scope       string            `json:"scope"`
+	Display     string            `json:"display"`
+	Icons       []webManifestIcon `json:"icons"`
+}
+
+// handleWebManifest serves the web app manifest, named after the site.
+func (s *Server) handleWebManifest(w http.ResponseWriter, r *http.Request) {
+	name := s.getSiteSettings(r.Context()).Name
+	manifest := webManifest{
+		Name:        name,
+		ShortName:   name,
+		Description: s.Config.SiteDescription,
+		StartURL:    "/",
+		Scope:       "/",
+		Display:     "standalone",
+		Icons: []webManifestIcon{
+			{Src: s.staticURL("img/otter-favicon2.png"), Sizes: "32x32", Type: "image/png"},
+			{Src: s.staticURL("img/otter.png"), Sizes: "600x600", Type: "image/png"},
+		},
+	}
+	w.Header().Set("Content-Type", "application/manifest+json")
+	w.Header().Set("Cache-Control", "no-cache")
+	json.NewEncoder(w).Encode(manifest)
+}
+
+// handleServiceWorker serves js/service-worker.js of the active theme,
+// after the version its caches are named after, which the wiki scopes to
+// the whole site.
+func (s *Server) handleServiceWorker(w http.ResponseWriter, r *http.Request) {
+	static := s.theme(r).static
+	if static == nil {
+		http.NotFound(w, r)
+		return
+	}
+	script, err := fs.ReadFile(static, "js/service-worker.js")
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	version, _ := json.Marshal(s.Version)
+	w.Header().Set("Content-Type", "text/javascript; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Service-Worker-Allowed", "/")
+	fmt.Fprintf(w, "var CACHE_VERSION = %s;\nvar OFFLINE_URL = %q;\n\n", version, offlineURL)
+	w.Write(script)
+}
+
+// handleOffline renders the page the service worker shows offline for a
+// page it has not kept.
+func (s *Server) handleOffline(w http.ResponseWriter, r *http.Request) {
+	s.renderTemplate(w, r, "offline.html", NewGenericData("Offline"))
+}
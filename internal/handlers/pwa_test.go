@@ -0,0 +1,66 @@
+package handlers_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/sa/gopherwiki/internal/storage"
+	"github.com/sa/gopherwiki/internal/testutil"
+)
+
+func TestProgressiveWebApp(t *testing.T) {
+	env := testutil.SetupTestEnv(t)
+	author := storage.Author{Name: "Alice", Email: "alice@example.com"}
+	if _, err := env.Store.Store(context.Background(), "home.md", "# Home\n", "Add home", author); err != nil {
+		t.Fatal(err)
+	}
+	get := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		env.Router.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("GET %s: status = %d, want %d", path, w.Code, http.StatusOK)
+		}
+		return w
+	}
+
+	var manifest struct {
+		Name     string `json:"name"`
+		StartURL string `json:"start_url"`
+		Scope    string `json:"scope"`
+		Icons    []struct {
+			Src string `json:"src"`
+		} `json:"icons"`
+	}
+	w := get("/-/manifest.webmanifest")
+	if err := json.Unmarshal(w.Body.Bytes(), &manifest); err != nil {
+		t.Fatal(err)
+	}
+	if manifest.Name != "GopherWiki" || manifest.StartURL != "/" || manifest.Scope != "/" || len(manifest.Icons) == 0 {
+		t.Errorf("manifest = %+v", manifest)
+	}
+	get(manifest.Icons[0].Src)
+
+	w = get("/-/sw.js")
+	if body := w.Body.String(); !strings.HasPrefix(body, "var CACHE_VERSION = \"test\";\nvar OFFLINE_URL = \"/-/offline\";\n") ||
+		!strings.Contains(body, `addEventListener("fetch"`) {
+		t.Errorf("service worker:\n%.200s", body)
+	}
+	if scope := w.Header().Get("Service-Worker-Allowed"); scope != "/" {
+		t.Errorf("Service-Worker-Allowed = %q, want /", scope)
+	}
+	get("/-/offline")
+
+	if w := get("/home"); w.Header().Get("X-Offline-Page") == "" {
+		t.Error("page view should be marked for offline reading")
+	}
+	if w := get("/home/history"); w.Header().Get("X-Offline-Page") != "" {
+		t.Error("history should not be kept for offline reading")
+	}
+	if body := get("/home").Body.String(); !strings.Contains(body, `<link rel="manifest" href="/-/manifest.webmanifest">`) {
+		t.Error("pages should link the manifest")
+	}
+}
@@ -0,0 +1,142 @@
+package handlers
+
+import (
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/sa/gopherwiki/internal/middleware"
+	"github.com/sa/gopherwiki/internal/util"
+)
+
+const (
+	// defaultQuickSwitchItems and maxQuickSwitchItems bound the items of a
+	// quick switcher answer.
+	defaultQuickSwitchItems = 20
+	maxQuickSwitchItems     = 50
+	// quickSwitchRecent is the number of recent pages offered before any
+	// is typed.
+	quickSwitchRecent = 10
+)
+
+// APIQuickSwitchItem is an entry of the quick switcher: a page the user
+// viewed recently, a page whose path or title matches, or a command.
+type APIQuickSwitchItem struct {
+	Kind     string `json:"kind"` // "recent", "page", or "command"
+	Title    string `json:"title"`
+	URL      string `json:"url"`
+	Path     string `json:"path,omitempty"`     // Path of the page of a recent or page item
+	Shortcut string `json:"shortcut,omitempty"` // Key that runs a command outside the quick switcher
+}
+
+// quickSwitchCommand is a command of the quick switcher, offered to those
+// with permission.
+type quickSwitchCommand struct {
+	title      string
+	url        string // With %s for the page path of a page command
+	permission string
+	account    bool // Only for logged-in users
+	page       bool // Acts on the page the switcher was opened on
+	shortcut   string
+}
+
+// quickSwitchCommands are the commands of the quick switcher, in the order
+// they are offered.
+var quickSwitchCommands = []quickSwitchCommand{
+	{title: "Edit page", url: "/%s/edit", permission: middleware.PermissionWrite, page: true, shortcut: "e"},
+	{title: "Page history", url: "/%s/history", permission: middleware.PermissionRead, page: true},
+	{title: "Page attachments", url: "/%s/attachments", permission: middleware.PermissionRead, page: true},
+	{title: "Create page", url: "/-/create", permission: middleware.PermissionWrite, shortcut: "c"},
+	{title: "Search", url: "/-/search", permission: middleware.PermissionRead, shortcut: "/"},
+	{title: "Page index", url: "/-/pageindex", permission: middleware.PermissionRead},
+	{title: "Changelog", url: "/-/changelog", permission: middleware.PermissionRead},
+	{title: "Issues", url: "/-/issues", permission: middleware.PermissionRead},
+	{title: "New issue", url: "/-/issues/new", permission: middleware.PermissionWrite},
+	{title: "Notifications", url: "/-/notifications", permission: middleware.PermissionRead, account: true},
+	{title: "Bookmarks", url: "/-/bookmarks", permission: middleware.PermissionRead, account: true},
+	{title: "Settings", url: "/-/settings", permission: middleware.PermissionRead, account: true},
+	{title: "Admin", url: "/-/admin", permission: middleware.PermissionAdmin},
+}
+
+// handleAPIQuickSwitch handles GET /api/v1/quickswitch -- what a Ctrl-K
+// quick switcher offers for q: the pages the user viewed recently, then
+// the other pages whose path or title matches, best first, then the
+// commands whose title contains it. The page parameter names the page
+// the switcher was opened on, adding the commands acting on it.
+func (s *Server) handleAPIQuickSwitch(w http.ResponseWriter, r *http.Request) {
+	limit, _, err := parseAPIPagination(r, defaultQuickSwitchItems, maxQuickSwitchItems)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	q := strings.TrimSpace(r.URL.Query().Get("q"))
+	pagepath := strings.Trim(r.URL.Query().Get("page"), "/")
+
+	completions, err := s.Wiki.CompletePages(r.Context(), q, 0)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, "failed to list pages")
+		return
+	}
+	titles := make(map[string]string, len(completions))
+	for _, c := range completions {
+		titles[c.Path] = c.Title
+	}
+
+	items := make([]APIQuickSwitchItem, 0, limit)
+	recent := make(map[string]bool)
+	if user := middleware.GetUser(r); user.IsAuthenticated() {
+		pages, err := s.DB.ListRecentPages(r.Context(), user.ID)
+		if err != nil {
+			slog.Warn("failed to list recent pages", "error", err)
+		}
+		for _, p := range pages {
+			// Pages deleted or renamed since, and those not matching q,
+			// are missing from the completions.
+			title, ok := titles[p.Pagepath]
+			if !ok || (q == "" && len(recent) == quickSwitchRecent) {
+				continue
+			}
+			recent[p.Pagepath] = true
+			items = append(items, APIQuickSwitchItem{Kind: "recent", Title: title, URL: "/" + util.URLQuote(p.Pagepath), Path: p.Pagepath})
+		}
+	}
+	if q != "" {
+		for _, c := range completions {
+			if !recent[c.Path] {
+				items = append(items, APIQuickSwitchItem{Kind: "page", Title: c.Title, URL: "/" + util.URLQuote(c.Path), Path: c.Path})
+			}
+		}
+	}
+	items = append(items, s.quickSwitchCommands(r, q, pagepath)...)
+
+	if len(items) > limit {
+		items = items[:limit]
+	}
+	writeJSON(w, http.StatusOK, items)
+}
+
+// quickSwitchCommands returns the commands whose title contains q that
+// the user may run, with those acting on the page at pagepath unless it
+// is empty.
+func (s *Server) quickSwitchCommands(r *http.Request, q, pagepath string) []APIQuickSwitchItem {
+	user := middleware.GetUser(r)
+	q = strings.ToLower(q)
+	var items []APIQuickSwitchItem
+	for _, c := range quickSwitchCommands {
+		if (c.page && pagepath == "") || (c.account && !user.IsAuthenticated()) ||
+			!s.PermissionChecker.HasPermission(r, c.permission) ||
+			!strings.Contains(strings.ToLower(c.title), q) {
+			continue
+		}
+		target := c.url
+		switch {
+		case c.page:
+			target = strings.Replace(target, "%s", util.URLQuote(pagepath), 1)
+		case target == "/-/search" && q != "":
+			target += "?q=" + url.QueryEscape(q)
+		}
+		items = append(items, APIQuickSwitchItem{Kind: "command", Title: c.title, URL: target, Shortcut: c.shortcut})
+	}
+	return items
+}
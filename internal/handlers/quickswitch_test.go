@@ -0,0 +1,82 @@
+package handlers_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/sa/gopherwiki/internal/handlers"
+	"github.com/sa/gopherwiki/internal/storage"
+	"github.com/sa/gopherwiki/internal/testutil"
+)
+
+func TestAPIQuickSwitch(t *testing.T) {
+	env := testutil.SetupTestEnv(t)
+	author := storage.Author{Name: "Alice", Email: "alice@example.com"}
+	for name, content := range map[string]string{
+		"guide.md":         "# User Guide\n",
+		"guidelines.md":    "# Guidelines\n",
+		"reference.md":     "# Reference\n",
+		"team/meetings.md": "# Meetings\n",
+	} {
+		if _, err := env.Store.Store(context.Background(), name, content, "Add "+name, author); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cookies := loginAsUser(t, env, "bob@example.com")
+	for _, path := range []string{"/guidelines", "/reference"} {
+		if w := apiGet(t, env, path, cookies); w.Code != http.StatusOK {
+			t.Fatalf("GET %s: status = %d", path, w.Code)
+		}
+	}
+	quickSwitch := func(query string) []handlers.APIQuickSwitchItem {
+		t.Helper()
+		w := apiGet(t, env, "/-/api/v1/quickswitch"+query, cookies)
+		if w.Code != http.StatusOK {
+			t.Fatalf("quickswitch%s: status = %d: %s", query, w.Code, w.Body.String())
+		}
+		var resp struct {
+			Data []handlers.APIQuickSwitchItem `json:"data"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatal(err)
+		}
+		return resp.Data
+	}
+
+	// The recent pages matching come first, then the other pages, then
+	// the commands.
+	items := quickSwitch("?q=guide")
+	if len(items) < 2 || items[0] != (handlers.APIQuickSwitchItem{Kind: "recent", Title: "Guidelines", URL: "/guidelines", Path: "guidelines"}) ||
+		items[1].Kind != "page" || items[1].Path != "guide" || items[1].Title != "User Guide" {
+		t.Errorf("quickswitch?q=guide = %+v", items)
+	}
+	for _, it := range items[2:] {
+		if it.Kind != "command" {
+			t.Errorf("item after the pages: %+v, want only commands", it)
+		}
+	}
+
+	// Without a query, the recent pages, and every command.
+	items = quickSwitch("?page=team/meetings")
+	if len(items) < 2 || items[0].Kind != "recent" || items[1].Kind != "recent" || items[0].Path == items[1].Path {
+		t.Errorf("quickswitch = %+v, want the recent pages first", items)
+	}
+	commands := make(map[string]handlers.APIQuickSwitchItem)
+	for _, it := range items {
+		if it.Kind == "page" {
+			t.Errorf("quickswitch without a query offered page %+v", it)
+		}
+		commands[it.Title] = it
+	}
+	if c := commands["Edit page"]; c.URL != "/team/meetings/edit" || c.Shortcut != "e" {
+		t.Errorf("Edit page command = %+v", c)
+	}
+	if _, ok := commands["Admin"]; ok {
+		t.Error("the admin command is offered to a user who is not an admin")
+	}
+	if c := quickSwitch("?q=sea"); len(c) != 1 || c[0].URL != "/-/search?q=sea" {
+		t.Errorf("quickswitch?q=sea = %+v, want the search command for sea", c)
+	}
+}
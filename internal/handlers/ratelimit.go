@@ -0,0 +1,157 @@
+package handlers
+
+import (
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sa/gopherwiki/internal/middleware"
+)
+
+// Route classes with a rate limit of their own.
+const (
+	rateClassWrite  = "write"  // Saving, creating, moving, and deleting pages and attachments
+	rateClassIssue  = "issue"  // Opening issues and commenting on them
+	rateClassSearch = "search" // Full-text search
+)
+
+// tokenBucket holds a client's remaining allowance in one route class.
+type tokenBucket struct {
+	tokens  float64
+	last    time.Time
+	limited bool // Refused since it was last allowed, so already logged
+}
+
+// rateLimiter is a token bucket per client: each holds up to perMinute
+// requests and refills at perMinute a minute, so a client may burst a
+// minute's worth and then keep to the rate.
+type rateLimiter struct {
+	perMinute int
+
+	mu        sync.Mutex
+	buckets   map[string]*tokenBucket
+	lastSweep time.Time
+}
+
+func newRateLimiter(perMinute int) *rateLimiter {
+	return &rateLimiter{perMinute: perMinute, buckets: make(map[string]*tokenBucket)}
+}
+
+// rateDecision is the outcome of a request against a client's bucket.
+type rateDecision struct {
+	ok         bool
+	remaining  int           // Whole requests left in the bucket
+	reset      time.Duration // Until the bucket is full again
+	retryAfter time.Duration // Until a refused request would be allowed
+	first      bool          // Refused for the first time since last allowed
+}
+
+// allow takes a token from key's bucket at now, if there is one.
+func (l *rateLimiter) allow(key string, now time.Time) rateDecision {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	capacity := float64(l.perMinute)
+	perSecond := capacity / 60
+	// A bucket idle for a minute is full again, as good as none.
+	if now.Sub(l.lastSweep) >= time.Minute {
+		for k, b := range l.buckets {
+			if now.Sub(b.last) >= time.Minute {
+				delete(l.buckets, k)
+			}
+		}
+		l.lastSweep = now
+	}
+
+	b := l.buckets[key]
+	if b == nil {
+		b = &tokenBucket{tokens: capacity, last: now}
+		l.buckets[key] = b
+	}
+	b.tokens = math.Min(capacity, b.tokens+now.Sub(b.last).Seconds()*perSecond)
+	b.last = now
+	var d rateDecision
+	if b.tokens >= 1 {
+		b.tokens--
+		b.limited = false
+		d.ok = true
+	} else {
+		d.first = !b.limited
+		b.limited = true
+		d.retryAfter = time.Duration((1 - b.tokens) / perSecond * float64(time.Second))
+	}
+	d.remaining = int(b.tokens)
+	d.reset = time.Duration((capacity - b.tokens) / perSecond * float64(time.Second))
+	return d
+}
+
+// rateLimitKey identifies the client a request counts against: the user
+// when logged in, since many users may share an address, otherwise the
+// address.
+func rateLimitKey(r *http.Request) string {
+	if user := middleware.GetUser(r); !user.IsAnonymous() {
+		return "user:" + user.GetEmail()
+	}
+	return "ip:" + middleware.ClientIP(r)
+}
+
+// rateLimit returns middleware limiting each client to the configured
+// number of requests a minute in class; requests over it are answered 429
+// with a Retry-After. Only the methods that change something count, except
+// for search, where every request does. API responses to the requests that
+// count tell the client its allowance in X-RateLimit-Limit, what is left of
+// it in X-RateLimit-Remaining, and in X-RateLimit-Reset the Unix time when
+// it is whole again. A zero limit turns it off.
+func (s *Server) rateLimit(class string) func(http.Handler) http.Handler {
+	var perMinute int
+	switch class {
+	case rateClassWrite:
+		perMinute = s.Config.RateLimitWrites
+	case rateClassIssue:
+		perMinute = s.Config.RateLimitIssues
+	case rateClassSearch:
+		perMinute = s.Config.RateLimitSearch
+	}
+	if perMinute <= 0 {
+		return func(next http.Handler) http.Handler { return next }
+	}
+	limiter := newRateLimiter(perMinute)
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if class != rateClassSearch && (r.Method == http.MethodGet || r.Method == http.MethodHead) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			key := rateLimitKey(r)
+			now := time.Now()
+			d := limiter.allow(key, now)
+			api := strings.HasPrefix(r.URL.Path, "/-/api/")
+			if api {
+				h := w.Header()
+				h.Set("X-RateLimit-Limit", strconv.Itoa(perMinute))
+				h.Set("X-RateLimit-Remaining", strconv.Itoa(d.remaining))
+				h.Set("X-RateLimit-Reset", strconv.FormatInt(now.Add(d.reset).Add(time.Second-1).Unix(), 10))
+			}
+			if d.ok {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if d.first {
+				slog.Warn("rate limit exceeded", "class", class, "client", key, "method", r.Method, "path", r.URL.Path)
+			}
+			seconds := int(math.Ceil(d.retryAfter.Seconds()))
+			w.Header().Set("Retry-After", strconv.Itoa(seconds))
+			message := fmt.Sprintf("Too many requests; try again in %d seconds", seconds)
+			if api {
+				writeJSONError(w, http.StatusTooManyRequests, message)
+				return
+			}
+			s.renderError(w, r, http.StatusTooManyRequests, message)
+		})
+	}
+}
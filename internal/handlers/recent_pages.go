@@ -0,0 +1,131 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/sa/gopherwiki/internal/db"
+	"github.com/sa/gopherwiki/internal/middleware"
+	"github.com/sa/gopherwiki/internal/util"
+	"github.com/sa/gopherwiki/internal/wiki"
+)
+
+// defaultAPIRecentPages is the number of recent pages the API returns
+// unless asked for more, up to db.RecentPagesKept.
+const defaultAPIRecentPages = 10
+
+// APIRecentPage is a page the user viewed recently.
+type APIRecentPage struct {
+	Path     string `json:"path"`
+	Title    string `json:"title"`
+	URL      string `json:"url"`
+	ViewedAt string `json:"viewed_at"`
+}
+
+// recordRecentPage notes that the logged-in user viewed the current
+// version of page, for their recent pages.
+func (s *Server) recordRecentPage(r *http.Request, page *wiki.Page) {
+	user := middleware.GetUser(r)
+	if !user.IsAuthenticated() || r.Method != http.MethodGet || page.Revision != "" || partialBlock(r) != "" {
+		return
+	}
+	if err := s.DB.RecordRecentPage(r.Context(), user.ID, page.Pagepath, time.Now()); err != nil {
+		slog.Warn("failed to record recent page", "pagepath", page.Pagepath, "error", err)
+	}
+}
+
+// recentPages returns up to limit pages the logged-in user viewed last,
+// the latest first, leaving out the page at skip and those deleted or
+// renamed since. Anonymous users have none.
+func (s *Server) recentPages(r *http.Request, limit int, skip string) ([]APIRecentPage, error) {
+	user := middleware.GetUser(r)
+	if !user.IsAuthenticated() {
+		return nil, nil
+	}
+	viewed, err := s.DB.ListRecentPages(r.Context(), user.ID)
+	if err != nil || len(viewed) == 0 {
+		return nil, err
+	}
+	pages, err := s.Wiki.PageMetadata(r.Context())
+	if err != nil {
+		return nil, err
+	}
+	titles := make(map[string]string, len(pages))
+	for _, m := range pages {
+		titles[m.Pagepath] = m.Title
+	}
+
+	var recent []APIRecentPage
+	for _, v := range viewed {
+		title, ok := titles[v.Pagepath]
+		if !ok || v.Pagepath == skip {
+			continue
+		}
+		if len(recent) == limit {
+			break
+		}
+		recent = append(recent, recentPageToAPI(v, title))
+	}
+	return recent, nil
+}
+
+// recentPagesETagSuffix returns an ETag suffix that changes with the
+// recent pages the sidebar lists beside the page at pagepath, so that a
+// browser does not reuse a page view with a stale list.
+func (s *Server) recentPagesETagSuffix(r *http.Request, pagepath string) string {
+	user := middleware.GetUser(r)
+	if s.Config.SidebarRecentPages <= 0 || !user.IsAuthenticated() {
+		return ""
+	}
+	viewed, err := s.DB.ListRecentPages(r.Context(), user.ID)
+	if err != nil || len(viewed) == 0 {
+		return ""
+	}
+	h := sha256.New()
+	n := 0
+	for _, v := range viewed {
+		if v.Pagepath == pagepath {
+			continue
+		}
+		if n == s.Config.SidebarRecentPages {
+			break
+		}
+		h.Write([]byte(v.Pagepath + "\n"))
+		n++
+	}
+	return "-" + hex.EncodeToString(h.Sum(nil))[:12]
+}
+
+func recentPageToAPI(v db.RecentPage, title string) APIRecentPage {
+	if title == "" {
+		title = util.GetPagename(v.Pagepath, false)
+	}
+	return APIRecentPage{
+		Path:     v.Pagepath,
+		Title:    title,
+		URL:      "/" + util.URLQuote(v.Pagepath),
+		ViewedAt: v.ViewedAt.Format(time.RFC3339),
+	}
+}
+
+// handleAPIRecentPages handles GET /api/v1/recent-pages -- the pages the
+// logged-in user viewed last, the latest first.
+func (s *Server) handleAPIRecentPages(w http.ResponseWriter, r *http.Request) {
+	limit, _, err := parseAPIPagination(r, defaultAPIRecentPages, db.RecentPagesKept)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	recent, err := s.recentPages(r, limit, "")
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, "failed to list recent pages")
+		return
+	}
+	if recent == nil {
+		recent = []APIRecentPage{}
+	}
+	writeJSON(w, http.StatusOK, recent)
+}
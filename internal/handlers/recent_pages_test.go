@@ -0,0 +1,87 @@
+package handlers_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sa/gopherwiki/internal/handlers"
+	"github.com/sa/gopherwiki/internal/storage"
+	"github.com/sa/gopherwiki/internal/testutil"
+)
+
+func TestRecentPages(t *testing.T) {
+	env := testutil.SetupTestEnv(t)
+	ctx := context.Background()
+	author := storage.Author{Name: "Alice", Email: "alice@example.com"}
+	for name, content := range map[string]string{
+		"guide.md":     "# User Guide\n",
+		"reference.md": "# Reference\n",
+		"gone.md":      "# Gone\n",
+	} {
+		if _, err := env.Store.Store(ctx, name, content, "Add "+name, author); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cookies := loginAsUser(t, env, "bob@example.com")
+	user, err := env.DB.Queries.GetUserByEmail(ctx, "bob@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	for i, path := range []string{"gone", "reference", "guide"} {
+		if err := env.DB.RecordRecentPage(ctx, user.ID, path, now.Add(time.Duration(i-3)*time.Minute)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := env.Store.Delete(ctx, "gone.md", "Delete gone", author); err != nil {
+		t.Fatal(err)
+	}
+
+	w := apiGet(t, env, "/-/api/v1/recent-pages", cookies)
+	if w.Code != http.StatusOK {
+		t.Fatalf("recent-pages: status = %d: %s", w.Code, w.Body.String())
+	}
+	var resp struct {
+		Data []handlers.APIRecentPage `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Data) != 2 || resp.Data[0].Path != "guide" || resp.Data[0].Title != "User Guide" ||
+		resp.Data[0].URL != "/guide" || resp.Data[1].Path != "reference" || resp.Data[0].ViewedAt == "" {
+		t.Errorf("recent-pages = %+v, want guide then reference, without the deleted page", resp.Data)
+	}
+
+	// The sidebar lists them, but for the page being viewed.
+	body := apiGet(t, env, "/reference", cookies).Body.String()
+	start := strings.Index(body, `class="sidebar-recent"`)
+	if start < 0 {
+		t.Fatalf("no recent pages in the sidebar:\n%s", body)
+	}
+	recent := body[start:]
+	recent = recent[:strings.Index(recent, "sidebar-divider")]
+	if !strings.Contains(recent, `href="/guide"`) || strings.Contains(recent, `href="/reference"`) {
+		t.Errorf("sidebar recent pages:\n%s", recent)
+	}
+
+	// Viewing another page changes the page's ETag, so the list is fresh.
+	etag := apiGet(t, env, "/reference", cookies).Header().Get("ETag")
+	if err := env.DB.RecordRecentPage(ctx, user.ID, "other", now.Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if again := apiGet(t, env, "/reference", cookies).Header().Get("ETag"); etag == "" || again == etag {
+		t.Errorf("ETag after viewing another page = %q, was %q", again, etag)
+	}
+
+	// Anonymous visitors have none.
+	if body := apiGet(t, env, "/-/api/v1/recent-pages", nil).Body.String(); !strings.Contains(body, `"data":[]`) {
+		t.Errorf("anonymous recent-pages = %s", body)
+	}
+	if body := apiGet(t, env, "/guide", nil).Body.String(); strings.Contains(body, "sidebar-recent") {
+		t.Error("anonymous sidebar lists recent pages")
+	}
+}
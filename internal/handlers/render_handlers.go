@@ -5,6 +5,7 @@ import (
 	"html"
 	"log/slog"
 	"net/http"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 
@@ -44,9 +45,10 @@ var (
 )
 
 // renderedContentSecurityPolicy returns the CSP for rendered output, allowing the
-// Observable CDNs only when OJS libraries are not mirrored locally.
+// Observable CDNs only when OJS libraries are not mirrored locally and the wiki
+// is not offline.
 func (s *Server) renderedContentSecurityPolicy() string {
-	if s.Config.OJSLibsDir != "" {
+	if s.Config.OJSLibsDir != "" || s.Config.Offline {
 		return renderedCSPLocal
 	}
 	return renderedCSPWithCDN
@@ -64,9 +66,9 @@ func (s *Server) handleRender(w http.ResponseWriter, r *http.Request) {
 	}
 
 	path := chi.URLParam(r, "path")
-	page, err := wiki.NewPage(s.Storage, s.Config, path, "")
+	page, err := wiki.NewPage(r.Context(), s.Storage, s.Config, path, "")
 	if err != nil {
-		s.renderError(w, r, http.StatusInternalServerError, err.Error())
+		s.renderFailure(w, r, err)
 		return
 	}
 	if !page.Exists {
@@ -101,7 +103,7 @@ func (s *Server) handleRender(w http.ResponseWriter, r *http.Request) {
 // This endpoint never triggers a render.
 func (s *Server) handleRendered(w http.ResponseWriter, r *http.Request) {
 	path := chi.URLParam(r, "path")
-	page, err := wiki.NewPage(s.Storage, s.Config, path, "")
+	page, err := wiki.NewPage(r.Context(), s.Storage, s.Config, path, "")
 	if err != nil {
 		http.Error(w, "Not found", http.StatusNotFound)
 		return
@@ -123,15 +125,12 @@ func (s *Server) handleRendered(w http.ResponseWriter, r *http.Request) {
 
 	// The output is content-addressed by the cache key, so it can be cached
 	// strongly and revalidated cheaply with an ETag.
-	etag := `"` + entry.Key + `"`
-	if match := r.Header.Get("If-None-Match"); match == etag {
-		w.WriteHeader(http.StatusNotModified)
+	w.Header().Set("Cache-Control", "private, no-cache")
+	if notModified(w, r, `"`+entry.Key+`"`, time.Time{}) {
 		return
 	}
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
 	w.Header().Set("Content-Security-Policy", s.renderedContentSecurityPolicy())
-	w.Header().Set("ETag", etag)
-	w.Header().Set("Cache-Control", "private, no-cache")
 	w.Header().Set("Content-Length", fmt.Sprintf("%d", len(entry.HTML)))
 	w.Write(entry.HTML)
 }
@@ -63,7 +63,7 @@ var author = storage.Author{Name: "test", Email: "test@test.com"}
 
 func TestRenderEndpointDisabledWhenNoService(t *testing.T) {
 	env := testutil.SetupTestEnv(t)
-	env.Store.StoreBytes("analysis.qmd", []byte("---\nengine: jupyter\n---\n# A\n"), "init", author)
+	env.Store.StoreBytes(context.Background(), "analysis.qmd", []byte("---\nengine: jupyter\n---\n# A\n"), "init", author)
 	// No RenderService set on the server.
 
 	req := httptest.NewRequest("POST", "/analysis/render", nil)
@@ -77,7 +77,7 @@ func TestRenderEndpointDisabledWhenNoService(t *testing.T) {
 
 func TestRenderEndpointDisabledWhenUnavailable(t *testing.T) {
 	env := testutil.SetupTestEnv(t)
-	env.Store.StoreBytes("analysis.qmd", []byte("---\nengine: jupyter\n---\n# A\n"), "init", author)
+	env.Store.StoreBytes(context.Background(), "analysis.qmd", []byte("---\nengine: jupyter\n---\n# A\n"), "init", author)
 	env.Server.RenderService = &fakeRenderService{available: false}
 
 	req := httptest.NewRequest("POST", "/analysis/render", nil)
@@ -91,7 +91,7 @@ func TestRenderEndpointDisabledWhenUnavailable(t *testing.T) {
 
 func TestRenderEndpointRendersComputationalPage(t *testing.T) {
 	env := testutil.SetupTestEnv(t)
-	env.Store.StoreBytes("analysis.qmd", []byte("---\nengine: jupyter\n---\n# A\n"), "init", author)
+	env.Store.StoreBytes(context.Background(), "analysis.qmd", []byte("---\nengine: jupyter\n---\n# A\n"), "init", author)
 	fake := &fakeRenderService{available: true}
 	env.Server.RenderService = fake
 
@@ -118,7 +118,7 @@ func TestRenderEndpointRendersComputationalPage(t *testing.T) {
 
 func TestComputationalPageETagIncludesRenderKey(t *testing.T) {
 	env := testutil.SetupTestEnv(t)
-	env.Store.StoreBytes("analysis.qmd", []byte("---\nengine: jupyter\n---\n# A\n"), "init", author)
+	env.Store.StoreBytes(context.Background(), "analysis.qmd", []byte("---\nengine: jupyter\n---\n# A\n"), "init", author)
 	env.Server.RenderService = &fakeRenderService{
 		available:   true,
 		cachedOK:    true,
@@ -157,7 +157,7 @@ func TestComputationalPageETagIncludesRenderKey(t *testing.T) {
 
 func TestRenderEndpointRejectsPlainPage(t *testing.T) {
 	env := testutil.SetupTestEnv(t)
-	env.Store.Store("plain.md", "# Plain\n", "init", author)
+	env.Store.Store(context.Background(), "plain.md", "# Plain\n", "init", author)
 	fake := &fakeRenderService{available: true}
 	env.Server.RenderService = fake
 
@@ -175,7 +175,7 @@ func TestRenderEndpointRejectsPlainPage(t *testing.T) {
 
 func TestRenderEndpointRenderFailure(t *testing.T) {
 	env := testutil.SetupTestEnv(t)
-	env.Store.StoreBytes("analysis.qmd", []byte("---\nengine: jupyter\n---\n# A\n"), "init", author)
+	env.Store.StoreBytes(context.Background(), "analysis.qmd", []byte("---\nengine: jupyter\n---\n# A\n"), "init", author)
 	env.Server.RenderService = &fakeRenderService{available: true, err: context.DeadlineExceeded}
 
 	req := httptest.NewRequest("POST", "/analysis/render", nil)
@@ -189,7 +189,7 @@ func TestRenderEndpointRenderFailure(t *testing.T) {
 
 func TestRenderedServesCachedBlob(t *testing.T) {
 	env := testutil.SetupTestEnv(t)
-	env.Store.StoreBytes("analysis.qmd", []byte("---\nengine: jupyter\n---\n# A\n"), "init", author)
+	env.Store.StoreBytes(context.Background(), "analysis.qmd", []byte("---\nengine: jupyter\n---\n# A\n"), "init", author)
 	env.Server.RenderService = &fakeRenderService{
 		available:   true,
 		cachedOK:    true,
@@ -221,7 +221,7 @@ func TestRenderedServesCachedBlob(t *testing.T) {
 
 func TestRenderedETag304(t *testing.T) {
 	env := testutil.SetupTestEnv(t)
-	env.Store.StoreBytes("analysis.qmd", []byte("---\nengine: jupyter\n---\n# A\n"), "init", author)
+	env.Store.StoreBytes(context.Background(), "analysis.qmd", []byte("---\nengine: jupyter\n---\n# A\n"), "init", author)
 	env.Server.RenderService = &fakeRenderService{
 		available:   true,
 		cachedOK:    true,
@@ -240,7 +240,7 @@ func TestRenderedETag304(t *testing.T) {
 
 func TestRenderedMissReturns404(t *testing.T) {
 	env := testutil.SetupTestEnv(t)
-	env.Store.StoreBytes("analysis.qmd", []byte("---\nengine: jupyter\n---\n# A\n"), "init", author)
+	env.Store.StoreBytes(context.Background(), "analysis.qmd", []byte("---\nengine: jupyter\n---\n# A\n"), "init", author)
 	env.Server.RenderService = &fakeRenderService{available: true, cachedOK: false}
 
 	req := httptest.NewRequest("GET", "/analysis/rendered", nil)
@@ -254,7 +254,7 @@ func TestRenderedMissReturns404(t *testing.T) {
 
 func TestRenderedRejectsPlainPage(t *testing.T) {
 	env := testutil.SetupTestEnv(t)
-	env.Store.Store("plain.md", "# Plain\n", "init", author)
+	env.Store.Store(context.Background(), "plain.md", "# Plain\n", "init", author)
 	env.Server.RenderService = &fakeRenderService{
 		available: true, cachedOK: true,
 		cachedEntry: rendercache.Entry{Key: "x", HTML: []byte("<html>x</html>")},
@@ -271,7 +271,7 @@ func TestRenderedRejectsPlainPage(t *testing.T) {
 
 func TestViewComputationalCacheHitShowsIframe(t *testing.T) {
 	env := testutil.SetupTestEnv(t)
-	env.Store.StoreBytes("analysis.qmd", []byte("---\nengine: jupyter\n---\n# A\n"), "init", author)
+	env.Store.StoreBytes(context.Background(), "analysis.qmd", []byte("---\nengine: jupyter\n---\n# A\n"), "init", author)
 	env.Server.RenderService = &fakeRenderService{
 		available: true, cachedOK: true,
 		cachedEntry: rendercache.Entry{Key: "abc", HTML: []byte("<html>out</html>")},
@@ -295,7 +295,7 @@ func TestViewComputationalCacheHitShowsIframe(t *testing.T) {
 
 func TestViewComputationalCacheMissShowsPlaceholder(t *testing.T) {
 	env := testutil.SetupTestEnv(t)
-	env.Store.StoreBytes("analysis.qmd", []byte("---\nengine: jupyter\n---\n# A\n"), "init", author)
+	env.Store.StoreBytes(context.Background(), "analysis.qmd", []byte("---\nengine: jupyter\n---\n# A\n"), "init", author)
 	env.Server.RenderService = &fakeRenderService{available: true, cachedOK: false}
 
 	req := httptest.NewRequest("GET", "/analysis", nil)
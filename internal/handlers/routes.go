@@ -2,7 +2,10 @@ package handlers
 
 import (
 	"fmt"
+	"net"
 	"net/http"
+	"net/netip"
+	"strings"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
@@ -38,6 +41,7 @@ var RouteMap = map[string]RouteInfo{
 	"history":      {ParamName: "path", Pattern: "/%s/history", Fallback: "/history"},
 	"blame":        {ParamName: "path", Pattern: "/%s/blame", Fallback: "/blame"},
 	"diff":         {ParamName: "path", Pattern: "/%s/diff", Fallback: "/diff"},
+	"compare":      {ParamName: "path", Pattern: "/%s/compare", Fallback: "/compare"},
 	"source":       {ParamName: "path", Pattern: "/%s/source", Fallback: "/source"},
 	"export":       {ParamName: "path", Pattern: "/%s/export", Fallback: "/export"},
 	"create":       {ParamName: "path", Pattern: "/%s/create", Fallback: "/-/create"},
@@ -50,6 +54,10 @@ var RouteMap = map[string]RouteInfo{
 	"issue_close":  {ParamName: "id", Pattern: "/-/issues/%s/close", Fallback: "/-/issues"},
 	"issue_reopen": {ParamName: "id", Pattern: "/-/issues/%s/reopen", Fallback: "/-/issues"},
 	"issue_delete": {ParamName: "id", Pattern: "/-/issues/%s/delete", Fallback: "/-/issues"},
+
+	// User routes
+	"user":          {ParamName: "email", Pattern: "/-/user/%s", Fallback: "/"},
+	"user_activity": {ParamName: "email", Pattern: "/-/user/%s/activity", Fallback: "/-/changelog"},
 }
 
 // URLFor generates a URL for the named route with optional parameters.
@@ -75,22 +83,39 @@ func (s *Server) Routes() chi.Router {
 	// the connection (or the process). Outermost so it wraps everything.
 	r.Use(middleware.Recoverer)
 
+	// Behind trusted reverse proxies, the client is the one they forward for.
+	if proxies, _ := s.Config.TrustedProxyPrefixes(); len(proxies) > 0 {
+		r.Use(forwardedClient(proxies))
+	}
+
 	// Baseline security headers on every response.
-	r.Use(securityHeaders)
+	csp := contentSecurityPolicy
+	if s.Config.Offline {
+		csp = offlineContentSecurityPolicy
+	}
+	r.Use(securityHeaders(csp))
 
 	// Session middleware (adds user to context)
 	r.Use(s.SessionManager.Middleware)
 
+	// ETag/Last-Modified validators and 304 handling on every GET.
+	r.Use(conditionalGET)
+
 	// CSRF protection on state-changing requests. Disabled under Testing so the
 	// existing handler tests need not perform the token dance; covered directly
-	// by middleware-level tests.
+	// by middleware-level tests. WebDAV is exempt: it ignores the session
+	// cookie and authenticates each request itself.
 	if !s.Config.Testing {
-		r.Use(s.SessionManager.CSRFProtect)
+		r.Use(exceptDAV(s.SessionManager.CSRFProtect))
 	}
 
-	// Static files (with long-lived cache headers)
-	staticHandler := http.StripPrefix("/static/", http.FileServer(http.FS(s.StaticFS)))
-	r.Handle("/static/*", staticCacheHandler(staticHandler))
+	// Per-client limits on the requests that commit, open issues, or search.
+	limitWrites := s.rateLimit(rateClassWrite)
+	limitIssues := s.rateLimit(rateClassIssue)
+	limitSearch := s.rateLimit(rateClassSearch)
+
+	// Static files (content-hashed URLs are cached as immutable)
+	r.Handle("/static/*", s.staticHandler())
 
 	// Local Observable JS library mirror (offline OJS). Served from the operator-
 	// provided directory when configured; the rendered OJS pages point here
@@ -108,61 +133,148 @@ func (s *Server) Routes() chi.Router {
 		r.Post("/logout", s.handleLogout)
 		r.Get("/register", s.handleRegister)
 		r.Post("/register", s.handleRegisterPost)
+		r.Get("/reset-password", s.handleResetPassword)
+		r.Post("/reset-password", s.handleResetPasswordPost)
 		r.Get("/health", s.handleHealthCheck)
+		if s.Config.MetricsEnabled {
+			r.Get("/metrics", s.handleMetrics)
+		}
+		if s.Config.WebDAVEnabled {
+			dav := s.davHandler()
+			r.Handle("/dav", dav)
+			r.Handle("/dav/*", dav)
+		}
 		r.Get("/robots.txt", s.handleRobotsTxt)
 		r.Get("/about", s.handleAbout)
+		r.Get("/manifest.webmanifest", s.handleWebManifest)
+		r.Get("/sw.js", s.handleServiceWorker)
+		r.Get("/offline", s.handleOffline)
 
-		// Read-protected routes
+		// Lists of pages, which show visitors without read access the
+		// public pages
 		r.Group(func(r chi.Router) {
-			r.Use(s.PermissionChecker.RequireRead)
-			r.Get("/", s.handleIndex)
-			r.Get("/search", s.handleSearch)
-			r.Post("/search", s.handleSearch)
+			r.Use(s.PermissionChecker.RequireReadOrPublic)
+			r.With(limitSearch).Get("/search", s.handleSearch)
+			r.With(limitSearch).Post("/search", s.handleSearch)
 			r.Get("/search/partial", s.handleSearchPartial)
 			r.Get("/search/dropdown", s.handleSearchDropdown)
-			r.Get("/changelog", s.handleChangelog)
-			r.Get("/commit/{revision}", s.handleCommit)
-			r.Get("/pageindex", s.handlePageIndex)
 			r.Get("/feed", s.handleFeed)
 			r.Get("/feed.rss", s.handleFeed)
 			r.Get("/feed.atom", s.handleAtomFeed)
 			r.Get("/sitemap.xml", s.handleSitemap)
+		})
+
+		// Read-protected routes
+		r.Group(func(r chi.Router) {
+			r.Use(s.PermissionChecker.RequireRead)
+			r.Get("/", s.handleIndex)
+			r.Get("/changelog", s.handleChangelog)
+			r.Get("/changelog/partial", partial("changelog_table", s.handleChangelog))
+			r.Get("/commit/{revision}", s.handleCommit)
+			r.Get("/p/{revision}/*", s.handlePermalink)
+			r.Get("/pageindex", s.handlePageIndex)
+			r.Get("/graph", s.handleLinkGraph)
+			r.Get("/reports/stale", s.handleStalePagesReport)
+			r.Get("/reports/checks", s.handleChecksReport)
+			r.Get("/reports/external-links", s.handleExternalLinksReport)
+			r.Get("/tasks", s.handleTasks)
+			r.Get("/export", s.handleWikiExport)
 			r.Get("/settings", s.handleSettings)
 			r.Post("/settings", s.handleSettingsPost)
+			r.Post("/settings/color-scheme", s.handleColorScheme)
+			r.With(limitWrites).Post("/settings/avatar", s.handleAvatarUpload)
+			r.Post("/settings/avatar/delete", s.handleAvatarDelete)
+			r.Get("/settings/sessions", s.handleSessions)
+			r.Post("/settings/sessions/revoke-others", s.handleSessionRevokeOthers)
+			r.Post("/settings/sessions/{id}/revoke", s.handleSessionRevoke)
+			r.Get("/bookmarks", s.handleBookmarks)
+			r.Post("/announcements/{id}/dismiss", s.handleAnnouncementDismiss)
+			r.Post("/announcements/{id}/dismiss/partial", partial("announcement", s.handleAnnouncementDismiss))
+			r.Get("/drafts", s.handleDrafts)
+			r.Get("/drafts/{id}", s.handleDraftView)
+			r.Post("/drafts/{id}/delete", s.handleDraftDiscard)
+			r.Post("/drafts/scheduled/{id}/cancel", s.handleScheduledPageCancel)
+			r.Get("/notifications", s.handleNotifications)
+			r.Post("/notifications/read", s.handleNotificationsRead)
+			r.Get("/notifications/{id}", s.handleNotificationOpen)
+			r.Get("/user/{email}", s.handleUserProfile)
+			r.Get("/user/{email}/activity", s.handleUserActivity)
+			r.Get("/avatar/{hash}", s.handleAvatar)
 			// Issue reading
 			r.Get("/issues", s.handleIssueList)
+			r.Get("/issues/partial", partial("issue_list", s.handleIssueList))
+			r.Get("/issues/feed.atom", s.handleIssuesFeed)
 			r.Get("/issues/{id}", s.handleIssueView)
+			r.Get("/issues/{id}/comment/{commentId}/history", s.handleIssueCommentHistory)
+			r.Post("/issues/views", s.handleIssueViewSave)
+			r.Post("/issues/views/{id}/delete", s.handleIssueViewDelete)
+			// Plugin routes, under /-/plugins/<name>
+			s.Plugins.Mount(r)
 		})
 
 		// Write-protected routes
 		r.Group(func(r chi.Router) {
 			r.Use(s.PermissionChecker.RequireWrite)
 			r.Get("/create", s.handleCreateForm)
-			r.Post("/create", s.handleCreate)
+			r.With(limitWrites).Post("/create", s.handleCreate)
 			r.Get("/commit/{revision}/revert", s.handleRevertForm)
-			r.Post("/commit/{revision}/revert", s.handleRevert)
+			r.With(limitWrites).Post("/commit/{revision}/revert", s.handleRevert)
+			r.Post("/drafts/{id}/schedule", s.handleDraftSchedule)
 			// Issue writing
 			r.Get("/issues/new", s.handleIssueNew)
-			r.Post("/issues/new", s.handleIssueCreate)
+			r.With(limitIssues).Post("/issues/new", s.handleIssueCreate)
 			r.Get("/issues/{id}/edit", s.handleIssueEdit)
 			r.Post("/issues/{id}/edit", s.handleIssueUpdate)
 			r.Post("/issues/{id}/close", s.handleIssueClose)
 			r.Post("/issues/{id}/reopen", s.handleIssueReopen)
-			r.Post("/issues/{id}/comment", s.handleIssueCommentCreate)
+			r.Post("/issues/bulk", s.handleIssueBulk)
+			r.Post("/issues/{id}/promote", s.handleIssuePromote)
+			r.With(limitIssues).Post("/issues/{id}/comment", s.handleIssueCommentCreate)
+			r.Get("/issues/{id}/comment/{commentId}/edit", s.handleIssueCommentEdit)
+			r.Post("/issues/{id}/comment/{commentId}/edit", s.handleIssueCommentUpdate)
+			// Moderation, by approved users
+			r.Get("/moderation", s.handleModeration)
+			r.Get("/moderation/{id}", s.handleModerationView)
+			r.Post("/moderation/{id}/approve", s.handleModerationApprove)
+			r.Post("/moderation/{id}/reject", s.handleModerationReject)
 		})
 
 		// Admin-protected routes
 		r.Group(func(r chi.Router) {
 			r.Use(s.PermissionChecker.RequireAdmin)
 			r.Get("/admin", s.handleAdmin)
+			r.Get("/admin/backup", s.handleAdminBackup)
+			r.Get("/admin/audit", s.handleAdminAudit)
+			r.Get("/admin/page-views", s.handleAdminPageViews)
+			r.Post("/admin/reindex", s.handleAdminReindex)
+			r.Post("/admin/maintenance", s.handleAdminMaintenance)
+			r.Get("/admin/import", s.handleAdminImport)
+			r.Post("/admin/import", s.handleAdminImportPost)
+			r.Post("/admin/import/mediawiki", s.handleAdminImportMediaWiki)
 			r.Get("/admin/users", s.handleAdminUsers)
+			r.Get("/admin/users/new", s.handleAdminUserNew)
+			r.Post("/admin/users/new", s.handleAdminUserCreate)
 			r.Get("/admin/users/{id}", s.handleAdminUserEdit)
 			r.Post("/admin/users/{id}", s.handleAdminUserSave)
+			r.Post("/admin/users/{id}/password", s.handleAdminUserPassword)
+			r.Post("/admin/users/{id}/reset-link", s.handleAdminUserResetLink)
+			r.Post("/admin/users/{id}/logout", s.handleAdminUserLogout)
 			r.Post("/admin/users/{id}/delete", s.handleAdminUserDelete)
+			r.Get("/admin/user-fields", s.handleAdminUserFields)
+			r.Post("/admin/user-fields", s.handleAdminUserFieldCreate)
+			r.Post("/admin/user-fields/{id}/delete", s.handleAdminUserFieldDelete)
+			r.Get("/admin/announcements", s.handleAdminAnnouncements)
+			r.Post("/admin/announcements", s.handleAdminAnnouncementSave)
+			r.Get("/admin/announcements/{id}", s.handleAdminAnnouncements)
+			r.Post("/admin/announcements/{id}", s.handleAdminAnnouncementSave)
+			r.Post("/admin/announcements/{id}/delete", s.handleAdminAnnouncementDelete)
 			r.Get("/admin/settings", s.handleAdminSettings)
 			r.Post("/admin/settings", s.handleAdminSettingsSave)
 			r.Post("/admin/site-settings", s.handleAdminSiteSettingsSave)
+			r.Post("/admin/navigation", s.handleAdminNavigationSave)
 			r.Post("/admin/issue-settings", s.handleAdminIssueSettingsSave)
+			r.Post("/admin/issue-templates", s.handleAdminIssueTemplateSave)
+			r.Post("/admin/issue-templates/{id}/delete", s.handleAdminIssueTemplateDelete)
 			r.Post("/issues/{id}/delete", s.handleIssueDelete)
 			r.Post("/issues/{id}/comment/{commentId}/delete", s.handleIssueCommentDelete)
 		})
@@ -174,30 +286,77 @@ func (s *Server) Routes() chi.Router {
 				r.Use(s.PermissionChecker.RequireRead)
 				r.Get("/pages", s.handleAPIPageList)
 				r.Get("/pages/*", s.handleAPIPage)
-				r.Get("/search", s.handleAPISearch)
+				r.Get("/tree", s.handleAPIPageTree)
+				r.Get("/graph", s.handleAPIGraph)
+				r.Post("/render", s.handleAPIRender)
+				r.Get("/autocomplete/pages", s.handleAPIPageCompletions)
+				r.Get("/quickswitch", s.handleAPIQuickSwitch)
+				r.Get("/recent-pages", s.handleAPIRecentPages)
+				r.Get("/bookmarks", s.handleAPIBookmarks)
+				r.Put("/bookmarks/*", s.handleAPIBookmark)
+				r.Delete("/bookmarks/*", s.handleAPIBookmark)
+				r.Get("/announcements", s.handleAPIAnnouncements)
+				r.Post("/announcements/{id}/dismiss", s.handleAPIAnnouncementDismiss)
+				r.With(limitSearch).Get("/search", s.handleAPISearch)
 				r.Get("/changelog", s.handleAPIChangelog)
+				r.Get("/commits/{revision}", s.handleAPICommit)
+				r.Get("/attachments/recent", s.handleAPIRecentAttachments)
+				r.Get("/export", s.handleAPIExport)
+				r.Get("/users/{email}/activity", s.handleAPIUserActivity)
+				r.Get("/user/preferences", s.handleAPIPreferences)
+				r.Put("/user/preferences", s.handleAPIPreferencesUpdate)
 				r.Get("/issues", s.handleAPIIssueList)
+				r.Get("/issues/templates", s.handleAPIIssueTemplates)
+				r.Get("/issues/views", s.handleAPIIssueViews)
+				r.Get("/issues/export", s.handleAPIIssueExport)
 				r.Get("/issues/{id}", s.handleAPIIssueGet)
 				r.Get("/issues/{id}/comments", s.handleAPIIssueComments)
+				r.Get("/issues/{id}/comments/{commentId}/revisions", s.handleAPIIssueCommentRevisions)
 			})
 
 			// Write-protected API routes
 			r.Group(func(r chi.Router) {
 				r.Use(s.PermissionChecker.RequireWrite)
-				r.Put("/pages/*", s.handleAPIPage)
-				r.Delete("/pages/*", s.handleAPIPage)
-				r.Post("/issues", s.handleAPIIssueCreate)
+				r.With(limitWrites).Put("/pages/*", s.handleAPIPage)
+				r.With(limitWrites).Post("/pages/*", s.handleAPIPage)
+				r.With(limitWrites).Delete("/pages/*", s.handleAPIPage)
+				r.With(limitIssues).Post("/issues", s.handleAPIIssueCreate)
 				r.Put("/issues/{id}", s.handleAPIIssueUpdate)
 				r.Post("/issues/{id}/close", s.handleAPIIssueClose)
 				r.Post("/issues/{id}/reopen", s.handleAPIIssueReopen)
-				r.Post("/issues/{id}/comments", s.handleAPIIssueCommentCreate)
+				r.Post("/issues/bulk", s.handleAPIIssueBulk)
+				r.Post("/issues/{id}/promote", s.handleAPIIssuePromote)
+				r.With(limitIssues).Post("/issues/{id}/comments", s.handleAPIIssueCommentCreate)
+				r.Put("/issues/{id}/comments/{commentId}", s.handleAPIIssueCommentUpdate)
 			})
 
 			// Admin-protected API routes
 			r.Group(func(r chi.Router) {
 				r.Use(s.PermissionChecker.RequireAdmin)
+				r.Post("/issues/import", s.handleAPIIssueImport)
 				r.Delete("/issues/{id}", s.handleAPIIssueDelete)
 				r.Delete("/issues/{id}/comments/{commentId}", s.handleAPIIssueCommentDelete)
+				r.Post("/import", s.handleAPIImport)
+				r.Post("/import/mediawiki", s.handleAPIImportMediaWiki)
+				r.Get("/user-fields", s.handleAPIUserFieldList)
+				r.Post("/user-fields", s.handleAPIUserFieldCreate)
+				r.Delete("/user-fields/{id}", s.handleAPIUserFieldDelete)
+				r.Post("/users", s.handleAPIUserCreate)
+				r.Get("/admin/preferences", s.handleAPIPreferencesAdmin)
+				r.Put("/admin/preferences", s.handleAPIPreferencesAdminUpdate)
+				r.Get("/admin/users", s.handleAPIUserList)
+				r.Post("/admin/users", s.handleAPIUserCreate)
+				r.Get("/admin/users/{id}", s.handleAPIUserGet)
+				r.Put("/admin/users/{id}", s.handleAPIUserUpdate)
+				r.Delete("/admin/users/{id}", s.handleAPIUserDelete)
+				r.Get("/admin/announcements", s.handleAPIAdminAnnouncements)
+				r.Post("/admin/announcements", s.handleAPIAdminAnnouncementCreate)
+				r.Put("/admin/announcements/{id}", s.handleAPIAdminAnnouncement)
+				r.Delete("/admin/announcements/{id}", s.handleAPIAdminAnnouncement)
+				r.Put("/users/{id}/password", s.handleAPIUserPassword)
+				r.Post("/users/{id}/password-reset", s.handleAPIUserPasswordReset)
+				r.Get("/users/{id}/fields", s.handleAPIUserFieldValues)
+				r.Put("/users/{id}/fields", s.handleAPIUserFieldValuesUpdate)
 			})
 		})
 	})
@@ -213,17 +372,32 @@ func (s *Server) Routes() chi.Router {
 		// Read-protected page routes
 		r.Group(func(r chi.Router) {
 			r.Use(s.PermissionChecker.RequireRead)
-			r.Get("/", s.handleView)
 			r.Get("/rendered", s.handleRendered)
 			r.Get("/export", s.handleExport)
 			r.Get("/history", s.handleHistory)
+			r.Get("/history/partial", partial("history_table", s.handleHistory))
+			r.Get("/history/export", s.handleHistoryExport)
 			r.Get("/source", s.handleSource)
 			r.Get("/blame", s.handleBlame)
 			r.Get("/diff", s.handleDiff)
+			r.Get("/compare", s.handleCompare)
 			r.Get("/attachments", s.handleAttachments)
+			r.Get("/attachments/partial", partial("attachment_list", s.handleAttachments))
+			r.Get("/feed.rss", s.handlePageFeed)
 			r.Get("/draft", s.handleDraftLoad)
+			r.Get("/share", s.handleShareForm)
+			r.Post("/share", s.handleShare)
+			r.Post("/bookmark", s.handleBookmark)
+			r.Post("/bookmark/partial", partial("bookmark_button", s.handleBookmark))
+		})
+
+		// Page views and attachments, which share links open too
+		r.Group(func(r chi.Router) {
+			r.Use(s.requireReadOrShare)
+			r.Get("/", s.handleView)
+			r.Get("/partial", partial("page_content", s.handleView))
 			// Catch-all for attachment files and nested page paths.
-			// Chi static routes above take priority over this parameterized route.
+			// Chi static routes take priority over this parameterized route.
 			r.Get("/{subpath}", s.handleView)
 		})
 
@@ -231,29 +405,43 @@ func (s *Server) Routes() chi.Router {
 		r.Group(func(r chi.Router) {
 			r.Use(s.PermissionChecker.RequireWrite)
 			r.Get("/edit", s.handleEdit)
-			r.Post("/save", s.handleSave)
+			r.With(limitWrites).Post("/save", s.handleSave)
 			r.Get("/create", s.handleCreate)
 			r.Get("/delete", s.handleDeleteForm)
-			r.Post("/delete", s.handleDelete)
+			r.With(limitWrites).Post("/delete", s.handleDelete)
 			r.Get("/rename", s.handleRenameForm)
-			r.Post("/rename", s.handleRename)
+			r.With(limitWrites).Post("/rename", s.handleRename)
+			r.Get("/status", s.handlePageStatusForm)
+			r.Post("/status", s.handlePageStatus)
+			r.Get("/restore", s.handleRestoreForm)
+			r.With(limitWrites).Post("/restore", s.handleRestore)
 			r.Post("/preview", s.handlePreview)
 			r.Post("/draft", s.handleDraftSave)
 			r.Delete("/draft", s.handleDraftDelete)
 			r.Post("/render", s.handleRender)
+			r.With(limitWrites).Post("/task", s.handleTaskToggle)
 		})
 
 		// Upload-protected page routes
 		r.Group(func(r chi.Router) {
 			r.Use(s.PermissionChecker.RequireUpload)
-			r.Post("/attachments", s.handleUploadAttachment)
+			r.With(limitWrites).Post("/attachments", s.handleUploadAttachment)
+		})
+
+		// Admin-protected page routes
+		r.Group(func(r chi.Router) {
+			r.Use(s.PermissionChecker.RequireAdmin)
+			r.Get("/visibility", s.handlePageVisibilityForm)
+			r.Post("/visibility", s.handlePageVisibility)
 		})
 	})
 
 	return r
 }
 
-// contentSecurityPolicy restricts where resources may be loaded from.
+// buildContentSecurityPolicy returns the policy restricting where resources may
+// be loaded from, with imgAllow the sources images may come from besides the
+// wiki.
 //
 // All first-party assets (including the self-hosted MathJax and Mermaid bundles)
 // are same-origin, and every script lives in an external file -- inline on*
@@ -265,31 +453,81 @@ func (s *Server) Routes() chi.Router {
 //   - style-src keeps 'unsafe-inline' because MathJax/Mermaid inject <style>
 //     elements at runtime and several templates use inline style attributes;
 //     CSP cannot nonce runtime-injected styles, so this one is unavoidable.
-//   - img-src is permissive so wiki pages may embed external images; data:/blob:
-//     cover MathJax/Mermaid and editor previews.
+//   - img-src is permissive so wiki pages may embed external images, except
+//     offline, where they must not; data:/blob: cover MathJax/Mermaid and
+//     editor previews.
 //   - default-src 'self' also constrains connect-src, so an injected script
 //     (were one to slip past script-src) could not exfiltrate to a foreign
 //     origin via fetch/XHR/beacon.
-const contentSecurityPolicy = "default-src 'self'; " +
-	"script-src 'self'; " +
-	"style-src 'self' 'unsafe-inline'; " +
-	"img-src 'self' data: blob: https: http:; " +
-	"font-src 'self'; " +
-	"object-src 'none'; " +
-	"base-uri 'self'; " +
-	"form-action 'self'; " +
-	"frame-ancestors 'self'"
-
-// securityHeaders sets baseline security response headers on every request.
-func securityHeaders(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		h := w.Header()
-		h.Set("X-Content-Type-Options", "nosniff")
-		h.Set("X-Frame-Options", "SAMEORIGIN")
-		h.Set("Referrer-Policy", "strict-origin-when-cross-origin")
-		h.Set("Content-Security-Policy", contentSecurityPolicy)
-		next.ServeHTTP(w, r)
-	})
+func buildContentSecurityPolicy(imgAllow string) string {
+	return "default-src 'self'; " +
+		"script-src 'self'; " +
+		"style-src 'self' 'unsafe-inline'; " +
+		"img-src 'self' data: blob:" + imgAllow + "; " +
+		"font-src 'self'; " +
+		"object-src 'none'; " +
+		"base-uri 'self'; " +
+		"form-action 'self'; " +
+		"frame-ancestors 'self'"
+}
+
+var (
+	contentSecurityPolicy = buildContentSecurityPolicy(" https: http:")
+	// offlineContentSecurityPolicy keeps images same-origin (OFFLINE).
+	offlineContentSecurityPolicy = buildContentSecurityPolicy("")
+)
+
+// forwardedClient sets the remote address of requests relayed by proxies to
+// the client's from X-Forwarded-For, so that rate limits, anonymous
+// attribution and sessions see the client rather than the proxy. The header
+// is read from the right, where the nearest proxy appended its peer, to the
+// first address that is not a proxy: those further left came from the
+// client, which may make them up.
+func forwardedClient(proxies []netip.Prefix) func(http.Handler) http.Handler {
+	trusted := func(s string) bool {
+		addr, err := netip.ParseAddr(s)
+		if err != nil {
+			return false
+		}
+		for _, p := range proxies {
+			if p.Contains(addr.Unmap()) {
+				return true
+			}
+		}
+		return false
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			host, port, err := net.SplitHostPort(r.RemoteAddr)
+			if err == nil && trusted(host) {
+				hops := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+				for i := len(hops) - 1; i >= 0 && trusted(host); i-- {
+					hop := strings.TrimSpace(hops[i])
+					if _, err := netip.ParseAddr(hop); err != nil {
+						break
+					}
+					host = hop
+				}
+				r.RemoteAddr = net.JoinHostPort(host, port)
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// securityHeaders sets baseline security response headers on every request,
+// with csp as the Content-Security-Policy.
+func securityHeaders(csp string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			h := w.Header()
+			h.Set("X-Content-Type-Options", "nosniff")
+			h.Set("X-Frame-Options", "SAMEORIGIN")
+			h.Set("Referrer-Policy", "strict-origin-when-cross-origin")
+			h.Set("Content-Security-Policy", csp)
+			next.ServeHTTP(w, r)
+		})
+	}
 }
 
 // staticCacheHandler wraps a handler to add Cache-Control headers for static assets.
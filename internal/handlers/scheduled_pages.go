@@ -0,0 +1,182 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/sa/gopherwiki/internal/db"
+	"github.com/sa/gopherwiki/internal/middleware"
+	"github.com/sa/gopherwiki/internal/settings"
+	"github.com/sa/gopherwiki/internal/storage"
+	"github.com/sa/gopherwiki/internal/wiki"
+)
+
+// scheduleTimeLayout is the layout of the publish time a schedule form
+// sends, that of a datetime-local input, read in the server's time zone.
+const scheduleTimeLayout = "2006-01-02T15:04"
+
+// PublishScheduledPages saves the scheduled drafts that are due as their
+// pages, as their authors. A draft whose page changed since it was made,
+// unless the wiki lets the last write win, or whose save a hook rejects is
+// marked failed and left for its author; other errors are retried on the
+// next run.
+func (s *Server) PublishScheduledPages(ctx context.Context) error {
+	due, err := s.DB.DueScheduledPages(ctx, time.Now())
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for _, p := range due {
+		if err := s.publishScheduledPage(ctx, p); err != nil {
+			slog.Error("failed to publish scheduled page", "path", p.Pagepath, "id", p.ID, "error", err)
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// publishScheduledPage saves the scheduled draft p as its page, or marks it
+// failed.
+func (s *Server) publishScheduledPage(ctx context.Context, p db.ScheduledPage) error {
+	base := p.Revision
+	overwrite := s.Settings.Get(ctx).EditConflictMode == settings.ConflictOverwrite
+	if overwrite {
+		base = ""
+	} else if base == "" {
+		page, err := wiki.NewPage(ctx, s.Storage, s.Config, p.Pagepath, "")
+		if err != nil {
+			return err
+		}
+		if page.Exists {
+			return s.DB.FailScheduledPage(ctx, p.ID, "The page was created since the draft was scheduled")
+		}
+	}
+
+	message := p.Message
+	if message == "" {
+		message = "Scheduled update of " + p.Pagepath
+	}
+	result, err := s.Wiki.SavePage(ctx, p.Pagepath, p.Content, message, base, storage.Author{Name: p.AuthorName, Email: p.AuthorEmail})
+	if errors.Is(err, wiki.ErrSaveRejected) {
+		return s.DB.FailScheduledPage(ctx, p.ID, capitalizeError(err))
+	} else if err != nil {
+		return err
+	}
+	if result.Conflict {
+		return s.DB.FailScheduledPage(ctx, p.ID, "The page changed since the draft was made")
+	}
+	slog.Info("published scheduled page", "path", p.Pagepath, "author", p.AuthorEmail)
+	return s.DB.DeleteScheduledPage(ctx, p.ID)
+}
+
+// handleDraftSchedule schedules a draft of the current user to be saved as
+// its page at the form's publish_at, with the form's commit message. The
+// draft is moved to the scheduled publications.
+func (s *Server) handleDraftSchedule(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetUser(r)
+	if !user.IsAuthenticated() {
+		http.Redirect(w, r, "/-/login?next=/-/drafts", http.StatusFound)
+		return
+	}
+	d, ok := s.userDraft(w, r)
+	if !ok {
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		s.renderError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+	draftURL := fmt.Sprintf("/-/drafts/%d", d.ID)
+	if s.needsReview(user) {
+		s.SessionManager.AddFlashMessage(w, r, "danger", "Your edits are reviewed before they are published, so they cannot be scheduled")
+		http.Redirect(w, r, draftURL, http.StatusFound)
+		return
+	}
+	publishAt, err := time.ParseInLocation(scheduleTimeLayout, r.PostForm.Get("publish_at"), time.Local)
+	if err != nil || !publishAt.After(time.Now()) {
+		s.SessionManager.AddFlashMessage(w, r, "danger", "Choose a time in the future to publish the draft at")
+		http.Redirect(w, r, draftURL, http.StatusFound)
+		return
+	}
+
+	page, err := wiki.NewPage(r.Context(), s.Storage, s.Config, d.Pagepath.String, "")
+	if err != nil {
+		s.renderFailure(w, r, err)
+		return
+	}
+	author := s.getAuthor(r)
+	_, err = s.DB.SchedulePage(r.Context(), db.ScheduledPage{
+		Pagepath:    page.Pagepath,
+		Revision:    d.Revision.String,
+		Content:     d.Content.String,
+		Message:     strings.TrimSpace(r.PostForm.Get("commit")),
+		AuthorName:  author.Name,
+		AuthorEmail: author.Email,
+		PublishAt:   publishAt,
+		CreatedAt:   time.Now(),
+	})
+	if err != nil {
+		s.SessionManager.AddFlashMessage(w, r, "danger", "Failed to schedule the draft")
+		http.Redirect(w, r, draftURL, http.StatusFound)
+		return
+	}
+	if err := s.DB.Queries.DeleteDraftByID(r.Context(), d.ID); err != nil {
+		slog.Warn("failed to delete a scheduled draft", "id", d.ID, "error", err)
+	}
+	s.SessionManager.AddFlashMessage(w, r, "success", fmt.Sprintf("%s will be published on %s", page.Pagepath, publishAt.Format("2006-01-02 15:04 MST")))
+	http.Redirect(w, r, "/-/drafts", http.StatusFound)
+}
+
+// handleScheduledPageCancel cancels a scheduled publication of the current
+// user, putting its content back in their drafts.
+func (s *Server) handleScheduledPageCancel(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetUser(r)
+	if !user.IsAuthenticated() {
+		http.Redirect(w, r, "/-/login?next=/-/drafts", http.StatusFound)
+		return
+	}
+	id, err := parseInt64(chi.URLParam(r, "id"))
+	if err != nil {
+		s.renderError(w, r, http.StatusBadRequest, "Invalid scheduled publication ID")
+		return
+	}
+	p, err := s.DB.GetScheduledPage(r.Context(), id)
+	if err == nil && p.AuthorEmail != user.GetEmail() {
+		err = sql.ErrNoRows
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		s.renderError(w, r, http.StatusNotFound, "Scheduled publication not found")
+		return
+	} else if err != nil {
+		s.renderError(w, r, http.StatusInternalServerError, "Failed to get scheduled publication")
+		return
+	}
+
+	err = s.DB.Queries.UpsertDraft(r.Context(), db.UpsertDraftParams{
+		Pagepath:    db.NullString(p.Pagepath),
+		Revision:    db.NullString(p.Revision),
+		AuthorEmail: db.NullString(p.AuthorEmail),
+		Content:     db.NullString(p.Content),
+		CursorLine:  db.NullInt64(0),
+		CursorCh:    db.NullInt64(0),
+		Datetime:    db.NullTime(time.Now()),
+	})
+	if err == nil {
+		err = s.DB.DeleteScheduledPage(r.Context(), p.ID)
+	}
+	if err != nil {
+		slog.Error("failed to cancel scheduled publication", "id", p.ID, "error", err)
+		s.SessionManager.AddFlashMessage(w, r, "danger", "Failed to cancel the publication")
+	} else {
+		s.SessionManager.AddFlashMessage(w, r, "success", fmt.Sprintf("Publication of %s cancelled; it is back in your drafts", p.Pagepath))
+	}
+	http.Redirect(w, r, "/-/drafts", http.StatusFound)
+}
@@ -0,0 +1,134 @@
+package handlers_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sa/gopherwiki/internal/db"
+	"github.com/sa/gopherwiki/internal/storage"
+	"github.com/sa/gopherwiki/internal/testutil"
+)
+
+func TestScheduledPages(t *testing.T) {
+	env := testutil.SetupTestEnv(t)
+	ctx := context.Background()
+	cookies := loginAsUser(t, env, "bob@example.com")
+	if _, err := env.Store.Store(ctx, "notes.md", "# Notes\n", "Add notes", storage.Author{Name: "Alice"}); err != nil {
+		t.Fatal(err)
+	}
+	do := func(method, path string, form url.Values, cookies []*http.Cookie) *httptest.ResponseRecorder {
+		var body *strings.Reader
+		if form != nil {
+			body = strings.NewReader(form.Encode())
+		}
+		req := requestWithCookies(method, path, body, cookies)
+		if form != nil {
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		}
+		w := httptest.NewRecorder()
+		env.Router.ServeHTTP(w, req)
+		return w
+	}
+	draftOf := func(pagepath string) db.Draft {
+		t.Helper()
+		drafts, err := env.DB.Queries.ListDraftsByAuthor(ctx, db.NullString("bob@example.com"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, d := range drafts {
+			if d.Pagepath.String == pagepath {
+				return d
+			}
+		}
+		t.Fatalf("no draft of %s in %v", pagepath, drafts)
+		return db.Draft{}
+	}
+
+	// A draft can only be scheduled for later.
+	do("POST", "/notes/draft", url.Values{"content": {"# Notes\n\nScheduled\n"}}, cookies)
+	draft := draftOf("notes")
+	if w := do("GET", fmt.Sprintf("/-/drafts/%d", draft.ID), nil, cookies); !strings.Contains(w.Body.String(), `name="publish_at"`) {
+		t.Fatalf("draft view lacks the schedule form:\n%s", w.Body.String())
+	}
+	past := time.Now().Add(-time.Hour).Format("2006-01-02T15:04")
+	do("POST", fmt.Sprintf("/-/drafts/%d/schedule", draft.ID), url.Values{"publish_at": {past}}, cookies)
+	if scheduled, _ := env.DB.ListScheduledPages(ctx, "bob@example.com"); len(scheduled) != 0 {
+		t.Fatalf("scheduled in the past: %v", scheduled)
+	}
+
+	// Scheduling moves the draft to the scheduled publications, which its
+	// author can cancel to get the draft back.
+	future := time.Now().Add(time.Hour).Format("2006-01-02T15:04")
+	w := do("POST", fmt.Sprintf("/-/drafts/%d/schedule", draft.ID), url.Values{"publish_at": {future}, "commit": {"Publish notes"}}, cookies)
+	if w.Code != http.StatusFound {
+		t.Fatalf("schedule: status = %d, want %d", w.Code, http.StatusFound)
+	}
+	scheduled, err := env.DB.ListScheduledPages(ctx, "bob@example.com")
+	if err != nil || len(scheduled) != 1 || scheduled[0].Message != "Publish notes" || scheduled[0].Revision != draft.Revision.String {
+		t.Fatalf("scheduled = %v, %v; want the draft", scheduled, err)
+	}
+	if drafts, _ := env.DB.Queries.ListDraftsByAuthor(ctx, db.NullString("bob@example.com")); len(drafts) != 0 {
+		t.Errorf("drafts after scheduling = %v, want none", drafts)
+	}
+	if body := do("GET", "/-/drafts", nil, cookies).Body.String(); !strings.Contains(body, "Scheduled") || !strings.Contains(body, "Pending") {
+		t.Errorf("drafts page lacks the scheduled publication:\n%s", body)
+	}
+	other := loginAsUser(t, env, "eve@example.com")
+	cancel := fmt.Sprintf("/-/drafts/scheduled/%d/cancel", scheduled[0].ID)
+	if w := do("POST", cancel, url.Values{}, other); w.Code != http.StatusNotFound {
+		t.Errorf("cancel another user's publication: status = %d, want %d", w.Code, http.StatusNotFound)
+	}
+	do("POST", cancel, url.Values{}, cookies)
+	if scheduled, _ := env.DB.ListScheduledPages(ctx, "bob@example.com"); len(scheduled) != 0 {
+		t.Errorf("scheduled after cancelling = %v, want none", scheduled)
+	}
+	if d := draftOf("notes"); d.Content.String != "# Notes\n\nScheduled\n" || d.Revision != draft.Revision {
+		t.Errorf("draft after cancelling = %v, want the scheduled content", d)
+	}
+
+	// Due publications are saved as their author; one whose page changed
+	// since is marked failed instead.
+	schedule := func(pagepath, revision, content string) {
+		t.Helper()
+		_, err := env.DB.SchedulePage(ctx, db.ScheduledPage{
+			Pagepath:    pagepath,
+			Revision:    revision,
+			Content:     content,
+			AuthorName:  "Bob",
+			AuthorEmail: "bob@example.com",
+			PublishAt:   time.Now().Add(-time.Minute),
+			CreatedAt:   time.Now(),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	schedule("notes", draft.Revision.String, "# Notes\n\nPublished\n")
+	schedule("ideas", "", "# Ideas\n")
+	schedule("notes", "0000000", "# Notes\n\nStale\n")
+	if err := env.Server.PublishScheduledPages(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if content, _ := env.Store.Load(ctx, "notes.md", ""); content != "# Notes\n\nPublished\n" {
+		t.Errorf("notes = %q, want the scheduled content", content)
+	}
+	if meta, err := env.Store.Metadata(ctx, "notes.md", ""); err != nil || meta.AuthorEmail != "bob@example.com" || meta.Message != "Scheduled update of notes" {
+		t.Errorf("notes commit = %+v, %v; want the scheduled one by bob", meta, err)
+	}
+	if !env.Store.Exists(ctx, "ideas.md") {
+		t.Errorf("scheduled new page was not created")
+	}
+	scheduled, _ = env.DB.ListScheduledPages(ctx, "bob@example.com")
+	if len(scheduled) != 1 || scheduled[0].Error == "" || scheduled[0].Content != "# Notes\n\nStale\n" {
+		t.Fatalf("scheduled after publishing = %v, want the stale one failed", scheduled)
+	}
+	if body := do("GET", "/-/drafts", nil, cookies).Body.String(); !strings.Contains(body, "Failed: ") {
+		t.Errorf("drafts page lacks the failure:\n%s", body)
+	}
+}
@@ -0,0 +1,213 @@
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/sa/gopherwiki/internal/db"
+	"github.com/sa/gopherwiki/internal/middleware"
+	"github.com/sa/gopherwiki/internal/util"
+)
+
+// sessionView is a tracked session as shown on the sessions page.
+type sessionView struct {
+	ID        int64
+	Device    string
+	IP        string
+	CreatedAt time.Time
+	LastSeen  time.Time
+	Current   bool
+}
+
+// userAgentBrowsers and userAgentSystems map User-Agent substrings to names,
+// checked in order: Edge and Chrome both claim to be Chrome and Safari, and
+// Android claims to be Linux.
+var (
+	userAgentBrowsers = [][2]string{
+		{"Edg/", "Edge"}, {"OPR/", "Opera"}, {"Firefox/", "Firefox"},
+		{"Chrome/", "Chrome"}, {"Safari/", "Safari"}, {"curl/", "curl"},
+	}
+	userAgentSystems = [][2]string{
+		{"Android", "Android"}, {"iPhone", "iOS"}, {"iPad", "iPadOS"},
+		{"Windows", "Windows"}, {"Mac OS X", "macOS"}, {"CrOS", "ChromeOS"},
+		{"Linux", "Linux"},
+	}
+)
+
+// describeUserAgent turns a User-Agent header into a short description such
+// as "Firefox on Linux".
+func describeUserAgent(ua string) string {
+	match := func(table [][2]string) string {
+		for _, entry := range table {
+			if strings.Contains(ua, entry[0]) {
+				return entry[1]
+			}
+		}
+		return ""
+	}
+	browser, system := match(userAgentBrowsers), match(userAgentSystems)
+	switch {
+	case browser != "" && system != "":
+		return browser + " on " + system
+	case browser != "":
+		return browser
+	case system != "":
+		return system
+	case ua != "":
+		return "Unknown browser"
+	}
+	return "Unknown device"
+}
+
+func sessionsToView(sessions []db.UserSession, currentID int64) []sessionView {
+	views := make([]sessionView, 0, len(sessions))
+	for _, sess := range sessions {
+		views = append(views, sessionView{
+			ID:        sess.ID,
+			Device:    describeUserAgent(sess.UserAgent),
+			IP:        sess.IP,
+			CreatedAt: sess.CreatedAt,
+			LastSeen:  sess.LastSeen,
+			Current:   sess.ID == currentID,
+		})
+	}
+	return views
+}
+
+// handleSessions lists the current user's logged-in sessions.
+func (s *Server) handleSessions(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetUser(r)
+	if !user.IsAuthenticated() {
+		http.Redirect(w, r, "/-/login?next=/-/settings/sessions", http.StatusFound)
+		return
+	}
+
+	sessions, err := s.Users.ListUserSessions(r.Context(), user.ID)
+	if err != nil {
+		s.renderError(w, r, http.StatusInternalServerError, "Failed to list sessions")
+		return
+	}
+
+	data := NewGenericData("Sessions")
+	data["sessions"] = sessionsToView(sessions, middleware.GetSessionID(r))
+	s.renderTemplate(w, r, "sessions.html", data)
+}
+
+// handleSessionRevoke logs out one of the current user's sessions.
+func (s *Server) handleSessionRevoke(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetUser(r)
+	if !user.IsAuthenticated() {
+		http.Redirect(w, r, "/-/login", http.StatusFound)
+		return
+	}
+
+	id, err := parseInt64(chi.URLParam(r, "id"))
+	if err != nil {
+		s.renderError(w, r, http.StatusBadRequest, "Invalid session ID")
+		return
+	}
+
+	switch err := s.Users.DeleteUserSession(r.Context(), user.ID, id); err {
+	case nil:
+		if id == middleware.GetSessionID(r) {
+			// Revoking this very session is logging out.
+			if err := s.SessionManager.Logout(w, r); err != nil {
+				slog.Warn("session logout error", "error", err)
+			}
+			http.Redirect(w, r, "/-/login", http.StatusFound)
+			return
+		}
+		s.SessionManager.AddFlashMessage(w, r, "success", "Session logged out")
+	case sql.ErrNoRows:
+		s.SessionManager.AddFlashMessage(w, r, "danger", "Session not found")
+	default:
+		slog.Error("failed to revoke session", "error", err)
+		s.SessionManager.AddFlashMessage(w, r, "danger", "Failed to log out session")
+	}
+	http.Redirect(w, r, "/-/settings/sessions", http.StatusFound)
+}
+
+// handleSessionRevokeOthers logs out every session of the current user
+// except the one making the request.
+func (s *Server) handleSessionRevokeOthers(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetUser(r)
+	if !user.IsAuthenticated() {
+		http.Redirect(w, r, "/-/login", http.StatusFound)
+		return
+	}
+
+	sessions, err := s.Users.ListUserSessions(r.Context(), user.ID)
+	if err != nil {
+		s.renderError(w, r, http.StatusInternalServerError, "Failed to list sessions")
+		return
+	}
+	current := middleware.GetSessionID(r)
+	revoked := 0
+	for _, sess := range sessions {
+		if sess.ID == current {
+			continue
+		}
+		if err := s.Users.DeleteUserSession(r.Context(), user.ID, sess.ID); err != nil && err != sql.ErrNoRows {
+			slog.Error("failed to revoke session", "error", err)
+			s.SessionManager.AddFlashMessage(w, r, "danger", "Failed to log out other sessions")
+			http.Redirect(w, r, "/-/settings/sessions", http.StatusFound)
+			return
+		}
+		revoked++
+	}
+
+	s.SessionManager.AddFlashMessage(w, r, "success",
+		fmt.Sprintf("Logged out %d other %s", revoked, util.Pluralize(revoked, "sessions", "session")))
+	http.Redirect(w, r, "/-/settings/sessions", http.StatusFound)
+}
+
+// endSessionsOnPasswordChange logs the user with userID out of every
+// session once their password changed, but for the session of r when it is
+// the user's own, as on a change made in their settings.
+func (s *Server) endSessionsOnPasswordChange(r *http.Request, userID int64) {
+	var keep int64
+	if user := middleware.GetUser(r); user.IsAuthenticated() && user.ID == userID {
+		keep = middleware.GetSessionID(r)
+	}
+	n, err := s.Users.DeleteUserSessionsExcept(r.Context(), userID, keep)
+	if err != nil {
+		slog.Error("failed to revoke sessions", "user_id", userID, "error", err)
+	} else if n > 0 {
+		slog.Info("password changed, user logged out elsewhere", "user_id", userID, "sessions", n)
+	}
+}
+
+// handleAdminUserLogout logs a user out of every session.
+func (s *Server) handleAdminUserLogout(w http.ResponseWriter, r *http.Request) {
+	if !s.requireAdmin(w, r) {
+		return
+	}
+
+	id, err := parseInt64(chi.URLParam(r, "id"))
+	if err != nil {
+		s.renderError(w, r, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+	if _, err := s.Auth.GetUserByID(r.Context(), id); err != nil {
+		s.renderError(w, r, http.StatusNotFound, "User not found")
+		return
+	}
+
+	n, err := s.Users.DeleteUserSessions(r.Context(), id)
+	if err != nil {
+		slog.Error("failed to revoke sessions", "user_id", id, "error", err)
+		s.SessionManager.AddFlashMessage(w, r, "danger", "Failed to log out user")
+	} else {
+		admin := middleware.GetUser(r)
+		slog.Info("user logged out everywhere", "user", admin.GetEmail(), "user_id", id, "sessions", n)
+		s.SessionManager.AddFlashMessage(w, r, "success",
+			fmt.Sprintf("Logged out %d %s", n, util.Pluralize(int(n), "sessions", "session")))
+	}
+	http.Redirect(w, r, fmt.Sprintf("/-/admin/users/%d", id), http.StatusFound)
+}
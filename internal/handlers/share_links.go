@@ -0,0 +1,217 @@
+package handlers
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/sa/gopherwiki/internal/db"
+	"github.com/sa/gopherwiki/internal/middleware"
+	"github.com/sa/gopherwiki/internal/util"
+	"github.com/sa/gopherwiki/internal/wiki"
+)
+
+// shareCookieName is the cookie a share link leaves, scoped to the path of
+// its page, so that the page's attachments load without the link's query.
+const shareCookieName = "share"
+
+// shareLinkDays are the lifetimes a share link can be given, in days.
+var shareLinkDays = []int{1, 7, 30}
+
+// shareToken returns the token of a share link to the page at pagepath
+// expiring at expires: the expiry time and an HMAC of it and the path,
+// keyed with the secret key. Changing the secret key revokes every link.
+func shareToken(secretKey, pagepath string, expires time.Time) string {
+	exp := strconv.FormatInt(expires.Unix(), 10)
+	return exp + "." + shareSignature(secretKey, pagepath, exp)
+}
+
+func shareSignature(secretKey, pagepath, exp string) string {
+	mac := hmac.New(sha256.New, []byte(secretKey))
+	mac.Write([]byte("share\x00" + pagepath + "\x00" + exp))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// validShareToken reports whether token is a share link to the page at
+// pagepath that has not expired at now, returning when it expires.
+func validShareToken(secretKey, token, pagepath string, now time.Time) (time.Time, bool) {
+	exp, sig, ok := strings.Cut(token, ".")
+	if !ok {
+		return time.Time{}, false
+	}
+	unix, err := strconv.ParseInt(exp, 10, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+	expires := time.Unix(unix, 0)
+	if !now.Before(expires) || !hmac.Equal([]byte(sig), []byte(shareSignature(secretKey, pagepath, exp))) {
+		return time.Time{}, false
+	}
+	return expires, true
+}
+
+// readRestricted reports whether pages need an account to be read, which
+// is when share links are of use.
+func (s *Server) readRestricted(r *http.Request) bool {
+	switch s.Settings.Get(r.Context()).ReadAccess {
+	case "REGISTERED", "APPROVED", "ADMIN":
+		return true
+	}
+	return false
+}
+
+// mayShare reports whether the user of r may make share links to page:
+// admins, and the user who created it.
+func (s *Server) mayShare(r *http.Request, page *wiki.Page) bool {
+	user := middleware.GetUser(r)
+	if !user.IsAuthenticated() {
+		return false
+	}
+	if user.Admin() {
+		return true
+	}
+	log, err := s.Storage.Log(r.Context(), page.Filename, 0)
+	if err != nil || len(log) == 0 {
+		return false
+	}
+	return strings.EqualFold(log[len(log)-1].AuthorEmail, user.GetEmail())
+}
+
+// requireReadOrShare is RequireRead for page views and attachments, which
+// a visitor without read access may also open when the page is public, or
+// with a share link to it. A valid link leaves a cookie that opens the
+// page and its attachments until the link expires; old revisions stay
+// closed.
+func (s *Server) requireReadOrShare(next http.Handler) http.Handler {
+	requireRead := s.PermissionChecker.RequireRead(next)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.PermissionChecker.HasPermission(r, middleware.PermissionRead) || r.URL.Query().Has("revision") {
+			requireRead.ServeHTTP(w, r)
+			return
+		}
+		path := chi.URLParam(r, "path")
+		if subpath := chi.URLParam(r, "subpath"); subpath != "" {
+			path = path + "/" + subpath
+		}
+		_, parent, isAttachment := s.attachmentFile(r.Context(), path)
+		if s.PermissionChecker.CanReadPage(r, util.SanitizePagename(path, true)) ||
+			(isAttachment && s.PermissionChecker.CanReadPage(r, parent)) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		now := time.Now()
+
+		if token := r.URL.Query().Get("share"); token != "" {
+			if expires, ok := validShareToken(s.Config.SecretKey, token, path, now); ok {
+				http.SetCookie(w, &http.Cookie{
+					Name:     shareCookieName,
+					Value:    token,
+					Path:     strings.TrimSuffix(s.Config.CookiePath, "/") + (&url.URL{Path: "/" + path}).EscapedPath(),
+					Expires:  expires,
+					HttpOnly: true,
+					Secure:   s.Config.SecureCookie,
+					SameSite: http.SameSiteLaxMode,
+				})
+				next.ServeHTTP(w, r)
+				return
+			}
+		}
+		for _, c := range r.Cookies() {
+			if c.Name != shareCookieName {
+				continue
+			}
+			if _, ok := validShareToken(s.Config.SecretKey, c.Value, path, now); ok {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if _, ok := validShareToken(s.Config.SecretKey, c.Value, parent, now); ok && isAttachment {
+				next.ServeHTTP(w, r)
+				return
+			}
+		}
+		requireRead.ServeHTTP(w, r)
+	})
+}
+
+// handleShareForm offers the creator of a page and admins a form to make
+// a share link to it.
+func (s *Server) handleShareForm(w http.ResponseWriter, r *http.Request) {
+	page, ok := s.sharedPage(w, r)
+	if !ok {
+		return
+	}
+	data := NewGenericData("Share " + page.Pagename)
+	data["pagename"] = page.Pagename
+	data["pagepath"] = page.Pagepath
+	data["days"] = shareLinkDays
+	s.renderTemplate(w, r, "share.html", data)
+}
+
+// handleShare makes a share link to a page, valid for the form's number of
+// days, records it in the audit log, and shows it to its maker.
+func (s *Server) handleShare(w http.ResponseWriter, r *http.Request) {
+	page, ok := s.sharedPage(w, r)
+	if !ok {
+		return
+	}
+	days, err := strconv.Atoi(r.FormValue("days"))
+	if err != nil || !slices.Contains(shareLinkDays, days) {
+		s.renderError(w, r, http.StatusBadRequest, "Invalid link lifetime")
+		return
+	}
+	shareURL := "/" + page.Pagepath + "/share"
+	now := time.Now()
+	expires := now.AddDate(0, 0, days)
+
+	actor := s.getAuthor(r)
+	entry := db.AuditEntry{
+		Action:     "page.share",
+		Detail:     fmt.Sprintf("%s until %s", page.Pagepath, expires.UTC().Format(time.RFC3339)),
+		ActorName:  actor.Name,
+		ActorEmail: actor.Email,
+		CreatedAt:  now,
+	}
+	if err := s.DB.AddAuditEntry(r.Context(), nil, entry); err != nil {
+		slog.Error("failed to record share link", "path", page.Pagepath, "error", err)
+		s.SessionManager.AddFlashMessage(w, r, "danger", "Failed to create the share link")
+		http.Redirect(w, r, shareURL, http.StatusFound)
+		return
+	}
+	link := s.siteURL(r) + (&url.URL{Path: "/" + page.Pagepath}).EscapedPath() + "?share=" + shareToken(s.Config.SecretKey, page.Pagepath, expires)
+	s.SessionManager.AddFlashMessage(w, r, "info",
+		fmt.Sprintf("Anyone with this link can read %s until %s: %s", page.Pagepath, expires.Format("2006-01-02 15:04 MST"), link))
+	http.Redirect(w, r, shareURL, http.StatusFound)
+}
+
+// sharedPage returns the page a share request is for, or renders why it
+// cannot be shared.
+func (s *Server) sharedPage(w http.ResponseWriter, r *http.Request) (*wiki.Page, bool) {
+	page, err := wiki.NewPage(r.Context(), s.Storage, s.Config, chi.URLParam(r, "path"), "")
+	if err != nil {
+		s.renderFailure(w, r, err)
+		return nil, false
+	}
+	if !page.Exists {
+		s.renderError(w, r, http.StatusNotFound, "Page not found")
+		return nil, false
+	}
+	if !s.readRestricted(r) {
+		s.renderError(w, r, http.StatusBadRequest, "Pages can be read without an account, so they need no share links")
+		return nil, false
+	}
+	if !s.mayShare(r, page) {
+		s.renderError(w, r, http.StatusForbidden, "Only the creator of a page and admins may share it")
+		return nil, false
+	}
+	return page, true
+}
@@ -0,0 +1,145 @@
+package handlers_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/sa/gopherwiki/internal/storage"
+	"github.com/sa/gopherwiki/internal/testutil"
+)
+
+func TestShareLinks(t *testing.T) {
+	env := testutil.SetupTestEnv(t)
+	env.Server.Config.ReadAccess = "REGISTERED"
+	ctx := context.Background()
+	creator := storage.Author{Name: "Alice", Email: "alice@example.com"}
+	for file, content := range map[string]string{
+		"guide.md":         "# Guide\n\nPrivate guide.\n",
+		"guide/notes.txt":  "attached notes",
+		"guide/sub.md":     "# Subpage\n",
+		"other.md":         "# Other\n",
+		"other/secret.txt": "other attachment",
+	} {
+		if _, err := env.Store.Store(ctx, file, content, "Add "+file, creator); err != nil {
+			t.Fatal(err)
+		}
+	}
+	alice := loginAsUser(t, env, "alice@example.com")
+	bob := loginAsUser(t, env, "bob@example.com")
+	do := func(method, path string, form url.Values, cookies []*http.Cookie) *httptest.ResponseRecorder {
+		var body *strings.Reader
+		if form != nil {
+			body = strings.NewReader(form.Encode())
+		}
+		req := requestWithCookies(method, path, body, cookies)
+		if form != nil {
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		}
+		w := httptest.NewRecorder()
+		env.Router.ServeHTTP(w, req)
+		return w
+	}
+
+	// Only the page's creator and admins make links.
+	if w := do("POST", "/guide/share", url.Values{"days": {"7"}}, bob); w.Code != http.StatusForbidden {
+		t.Errorf("share another user's page: status = %d, want %d", w.Code, http.StatusForbidden)
+	}
+	if body := do("GET", "/guide", nil, alice).Body.String(); !strings.Contains(body, `href="/guide/share"`) {
+		t.Errorf("page menu lacks the share link:\n%s", body)
+	}
+	w := do("POST", "/guide/share", url.Values{"days": {"7"}}, alice)
+	if w.Code != http.StatusFound {
+		t.Fatalf("share: status = %d, want %d", w.Code, http.StatusFound)
+	}
+	body := do("GET", "/guide/share", nil, w.Result().Cookies()).Body.String()
+	m := regexp.MustCompile(`/guide\?share=([\w.-]+)`).FindStringSubmatch(body)
+	if m == nil {
+		t.Fatalf("share page lacks the link:\n%s", body)
+	}
+	token := m[1]
+	if entries, _ := env.DB.ListAuditEntries(ctx, 1); len(entries) != 1 || entries[0].Action != "page.share" {
+		t.Errorf("audit entries = %+v, want the share link", entries)
+	}
+
+	// The link opens the page without an account, and leaves a cookie
+	// that opens its attachments, but nothing else.
+	w = do("GET", "/guide?share="+token, nil, nil)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "Private guide.") {
+		t.Fatalf("shared page: status = %d\n%s", w.Code, w.Body.String())
+	}
+	if strings.Contains(w.Body.String(), `href="/other"`) {
+		t.Errorf("shared page links to other pages:\n%s", w.Body.String())
+	}
+	shared := w.Result().Cookies()
+	if len(shared) == 0 || shared[len(shared)-1].Path != "/guide" {
+		t.Fatalf("cookies = %v, want one scoped to the page", shared)
+	}
+	if w := do("GET", "/guide/notes.txt", nil, shared); w.Code != http.StatusOK || w.Body.String() != "attached notes" {
+		t.Errorf("shared attachment: status = %d, body = %q", w.Code, w.Body.String())
+	}
+	for _, path := range []string{"/guide/sub", "/guide/history", "/other", "/other/secret.txt"} {
+		if w := do("GET", path, nil, shared); w.Code != http.StatusFound {
+			t.Errorf("GET %s with the share cookie: status = %d, want a redirect to log in", path, w.Code)
+		}
+	}
+	for _, path := range []string{"/other?share=" + token, "/guide?share=1.forged", "/guide?share=" + token + "&revision=HEAD"} {
+		if w := do("GET", path, nil, nil); w.Code != http.StatusFound {
+			t.Errorf("GET %s: status = %d, want a redirect to log in", path, w.Code)
+		}
+	}
+
+	// Where pages are public there is nothing to share.
+	env.Server.Config.ReadAccess = "ANONYMOUS"
+	if w := do("GET", "/guide/share", nil, alice); w.Code != http.StatusBadRequest {
+		t.Errorf("share form on a public wiki: status = %d, want %d", w.Code, http.StatusBadRequest)
+	}
+}
+
+func TestShareLinkEmbeds(t *testing.T) {
+	env := testutil.SetupTestEnv(t)
+	env.Server.Config.ReadAccess = "REGISTERED"
+	env.Server.Config.ObsidianCompat = true
+	ctx := context.Background()
+	creator := storage.Author{Name: "Alice", Email: "alice@example.com"}
+	for file, content := range map[string]string{
+		"guide.md":  "# Guide\n\nShared guide.\n\n![[secret]]\n",
+		"secret.md": "# Secret\n\nPrivate plans.\n",
+	} {
+		if _, err := env.Store.Store(ctx, file, content, "Add "+file, creator); err != nil {
+			t.Fatal(err)
+		}
+	}
+	alice := loginAsUser(t, env, "alice@example.com")
+
+	// Readers of the wiki see the embedded page in place.
+	if body := apiGet(t, env, "/guide", alice).Body.String(); !strings.Contains(body, "Private plans.") {
+		t.Fatalf("page lacks the page it embeds:\n%s", body)
+	}
+
+	// A share link opens the page, but links the page it embeds.
+	req := requestWithCookies("POST", "/guide/share", strings.NewReader(url.Values{"days": {"1"}}.Encode()), alice)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	env.Router.ServeHTTP(w, req)
+	body := apiGet(t, env, "/guide/share", w.Result().Cookies()).Body.String()
+	m := regexp.MustCompile(`/guide\?share=([\w.-]+)`).FindStringSubmatch(body)
+	if m == nil {
+		t.Fatalf("share page lacks the link:\n%s", body)
+	}
+	w = apiGet(t, env, "/guide?share="+m[1], nil)
+	body = w.Body.String()
+	if w.Code != http.StatusOK || !strings.Contains(body, "Shared guide.") {
+		t.Fatalf("shared page: status = %d\n%s", w.Code, body)
+	}
+	if strings.Contains(body, "Private plans.") || strings.Contains(body, `class="embed-page"`) {
+		t.Errorf("shared page shows the private page it embeds:\n%s", body)
+	}
+	if !strings.Contains(body, `<a href="/secret">secret</a>`) {
+		t.Errorf("shared page lacks the link to the page it embeds:\n%s", body)
+	}
+}
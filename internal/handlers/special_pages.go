@@ -0,0 +1,138 @@
+package handlers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"html/template"
+	"log/slog"
+	"path"
+	"strconv"
+	"time"
+
+	"github.com/sa/gopherwiki/internal/frontmatter"
+	"github.com/sa/gopherwiki/internal/wiki"
+)
+
+// Special page names. A _sidebar or _footer page decorates every page in its
+// directory and below, unless a deeper directory has its own; the ones at the
+// wiki root apply everywhere else. A _404 page is shown, the same way, in
+// place of missing pages.
+const (
+	sidebarPageName  = "_sidebar"
+	footerPageName   = "_footer"
+	notFoundPageName = "_404"
+)
+
+// specialPage is a rendered _sidebar, _footer, or _404 page.
+type specialPage struct {
+	Pagepath string // e.g. "docs/_sidebar"
+	HTML     template.HTML
+
+	filename string
+	mtime    time.Time
+}
+
+// pageDecorations are the special pages shown around a page view, and the
+// paths the view links to for editing them: the special page in effect, or a
+// new one in the page's directory.
+type pageDecorations struct {
+	Sidebar     *specialPage
+	Footer      *specialPage
+	SidebarPath string
+	FooterPath  string
+}
+
+// pageDecorations returns the sidebar and footer that apply to page.
+func (s *Server) pageDecorations(ctx context.Context, page *wiki.Page) pageDecorations {
+	dir := path.Dir(page.Pagepath)
+	inDir := func(name string) string {
+		if dir == "." {
+			return name
+		}
+		return dir + "/" + name
+	}
+	d := pageDecorations{
+		Sidebar:     s.findSpecialPage(ctx, sidebarPageName, page.Filename),
+		Footer:      s.findSpecialPage(ctx, footerPageName, page.Filename),
+		SidebarPath: inDir(sidebarPageName),
+		FooterPath:  inDir(footerPageName),
+	}
+	if d.Sidebar != nil {
+		d.SidebarPath = d.Sidebar.Pagepath
+	}
+	if d.Footer != nil {
+		d.FooterPath = d.Footer.Pagepath
+	}
+	return d
+}
+
+// etagSuffix identifies the special pages in use, so that a cached page view
+// is revalidated when one of them changes. It is empty when there are none.
+func (d pageDecorations) etagSuffix() string {
+	if d.Sidebar == nil && d.Footer == nil {
+		return ""
+	}
+	h := sha256.New()
+	for _, sp := range []*specialPage{d.Sidebar, d.Footer} {
+		if sp != nil {
+			h.Write([]byte(sp.filename + "@" + strconv.FormatInt(sp.mtime.UnixNano(), 10) + "\n"))
+		}
+	}
+	return "-" + hex.EncodeToString(h.Sum(nil))[:12]
+}
+
+// findSpecialPage returns the special page called name nearest to the page
+// stored in filename, searching the page's directory and then each parent up
+// to the root. It returns nil when there is none.
+func (s *Server) findSpecialPage(ctx context.Context, name, filename string) *specialPage {
+	dir := path.Dir(filename)
+	for {
+		candidate := name + ".md"
+		if dir != "." {
+			candidate = dir + "/" + candidate
+		}
+		if mtime, err := s.Storage.Mtime(ctx, candidate); err == nil {
+			return s.loadSpecialPage(ctx, candidate, mtime)
+		}
+		if dir == "." {
+			return nil
+		}
+		dir = path.Dir(dir)
+	}
+}
+
+// loadSpecialPage returns the rendered special page stored in filename. The
+// rendering is cached until the file's modification time changes, so a page
+// view normally costs a stat per directory level rather than a render.
+func (s *Server) loadSpecialPage(ctx context.Context, filename string, mtime time.Time) *specialPage {
+	s.spMu.RLock()
+	cached, ok := s.spCache[filename]
+	s.spMu.RUnlock()
+	if ok && cached.mtime.Equal(mtime) {
+		return cached
+	}
+
+	content, err := s.Storage.Load(ctx, filename, "")
+	if err != nil {
+		slog.Warn("failed to load special page", "file", filename, "error", err)
+		return nil
+	}
+	pagepath := filename[:len(filename)-len(path.Ext(filename))]
+	_, body := frontmatter.Parse(content)
+	htmlContent, _, _ := s.Renderer.Render(body, "/"+pagepath)
+	sp := &specialPage{
+		Pagepath: pagepath,
+		HTML:     template.HTML(htmlContent),
+		filename: filename,
+		mtime:    mtime,
+	}
+
+	s.spMu.Lock()
+	if s.spCache == nil {
+		s.spCache = make(map[string]*specialPage)
+	}
+	s.spCache[filename] = sp
+	s.spMu.Unlock()
+	return sp
+}
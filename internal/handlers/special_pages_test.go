@@ -0,0 +1,215 @@
+package handlers_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sa/gopherwiki/internal/storage"
+	"github.com/sa/gopherwiki/internal/testutil"
+)
+
+func viewPage(t *testing.T, env *testutil.TestEnv, path, etag string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest("GET", path, nil)
+	if etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+	w := httptest.NewRecorder()
+	env.Router.ServeHTTP(w, req)
+	return w
+}
+
+func TestSpecialPages(t *testing.T) {
+	env := testutil.SetupTestEnv(t)
+	author := storage.Author{Name: "test", Email: "test@test.com"}
+
+	files := map[string]string{
+		"home.md":          "# Home",
+		"docs/intro.md":    "# Intro",
+		"guide/start.md":   "# Start",
+		"_sidebar.md":      "Global **sidebar**",
+		"_footer.md":       "Global footer",
+		"docs/_sidebar.md": "---\ntitle: Docs Sidebar\n---\nDocs sidebar",
+	}
+	for name, content := range files {
+		if _, err := env.Store.Store(context.Background(), name, content, "init", author); err != nil {
+			t.Fatalf("store %s: %v", name, err)
+		}
+	}
+
+	tests := []struct {
+		path, want, notWant string
+	}{
+		{"/home", "Global <strong>sidebar</strong>", "Docs sidebar"},
+		{"/docs/intro", "Docs sidebar", "Global <strong>sidebar</strong>"},
+		{"/guide/start", "Global <strong>sidebar</strong>", "Docs sidebar"},
+	}
+	for _, tt := range tests {
+		w := viewPage(t, env, tt.path, "")
+		if w.Code != http.StatusOK {
+			t.Fatalf("GET %s: status = %d, want %d", tt.path, w.Code, http.StatusOK)
+		}
+		body := w.Body.String()
+		if !strings.Contains(body, tt.want) {
+			t.Errorf("GET %s: body should contain %q", tt.path, tt.want)
+		}
+		if strings.Contains(body, tt.notWant) {
+			t.Errorf("GET %s: body should not contain %q", tt.path, tt.notWant)
+		}
+		if !strings.Contains(body, "Global footer") {
+			t.Errorf("GET %s: body should contain the global footer", tt.path)
+		}
+		if strings.Contains(body, "Docs Sidebar") {
+			t.Errorf("GET %s: sidebar frontmatter should not be rendered", tt.path)
+		}
+	}
+
+	// The page view links to the special pages in effect, or offers to add
+	// one in the page's directory.
+	body := viewPage(t, env, "/docs/intro", "").Body.String()
+	if !strings.Contains(body, `href="/docs/_sidebar/edit"`) {
+		t.Error("page view should link to the docs sidebar for editing")
+	}
+	if !strings.Contains(body, `href="/_footer/edit"`) {
+		t.Error("page view should link to the global footer for editing")
+	}
+	body = viewPage(t, env, "/guide/start", "").Body.String()
+	if !strings.Contains(body, `href="/_sidebar/edit"`) || strings.Contains(body, `href="/guide/_sidebar/edit"`) {
+		t.Error("page view should not offer a new sidebar when one applies")
+	}
+
+	// Changing a special page changes the ETag of the pages it decorates,
+	// and the new content is rendered.
+	first := viewPage(t, env, "/docs/intro", "")
+	etag := first.Header().Get("ETag")
+	if etag == "" {
+		t.Fatal("page view should set an ETag")
+	}
+	if w := viewPage(t, env, "/docs/intro", etag); w.Code != http.StatusNotModified {
+		t.Fatalf("unchanged page: status = %d, want %d", w.Code, http.StatusNotModified)
+	}
+	if _, err := env.Store.Store(context.Background(), "docs/_sidebar.md", "Updated docs sidebar", "update", author); err != nil {
+		t.Fatalf("update sidebar: %v", err)
+	}
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(filepath.Join(env.TmpDir, "docs", "_sidebar.md"), later, later); err != nil {
+		t.Fatalf("chtimes: %v", err)
+	}
+	w := viewPage(t, env, "/docs/intro", etag)
+	if w.Code != http.StatusOK {
+		t.Fatalf("after sidebar change: status = %d, want %d", w.Code, http.StatusOK)
+	}
+	if !strings.Contains(w.Body.String(), "Updated docs sidebar") {
+		t.Error("page view should render the updated sidebar")
+	}
+}
+
+func TestSpecialPages_None(t *testing.T) {
+	env := testutil.SetupTestEnv(t)
+	env.Store.Store(context.Background(), "docs/intro.md", "# Intro", "init", storage.Author{Name: "test", Email: "test@test.com"})
+
+	body := viewPage(t, env, "/docs/intro", "").Body.String()
+	if strings.Contains(body, "sidebar-custom") || strings.Contains(body, "page-footer") {
+		t.Error("no sidebar or footer should be rendered without special pages")
+	}
+	if !strings.Contains(body, `href="/docs/_sidebar/edit"`) || !strings.Contains(body, "Add Sidebar") {
+		t.Error("page view should offer to add a sidebar in the page's directory")
+	}
+}
+
+func TestNotFoundPage(t *testing.T) {
+	env := testutil.SetupTestEnv(t)
+	author := storage.Author{Name: "test", Email: "test@test.com"}
+	for name, content := range map[string]string{
+		"installation.md": "# Installation\n\nHow to install.",
+		"docs/_404.md":    "No such **docs** page.",
+		"unrelated.md":    "# Unrelated",
+	} {
+		if _, err := env.Store.Store(context.Background(), name, content, "init", author); err != nil {
+			t.Fatalf("store %s: %v", name, err)
+		}
+	}
+	if _, err := env.Server.Wiki.RebuildSearchIndex(context.Background()); err != nil {
+		t.Fatalf("RebuildSearchIndex: %v", err)
+	}
+
+	w := viewPage(t, env, "/instalation", "")
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("missing page: status = %d, want %d", w.Code, http.StatusNotFound)
+	}
+	body := w.Body.String()
+	_, suggestions, _ := strings.Cut(body, `class="page404-suggestions"`)
+	suggestions, _, _ = strings.Cut(suggestions, "</ul>")
+	if !strings.Contains(suggestions, `href="/installation"`) {
+		t.Error("misspelled page should suggest installation")
+	}
+	if strings.Contains(suggestions, `href="/unrelated"`) {
+		t.Error("unrelated page should not be suggested")
+	}
+	if !strings.Contains(body, "Page not found") {
+		t.Error("without a _404 page the default message should be shown")
+	}
+
+	body = viewPage(t, env, "/docs/missing", "").Body.String()
+	if !strings.Contains(body, "No such <strong>docs</strong> page.") || strings.Contains(body, "Page not found") {
+		t.Error("missing page under docs should show docs/_404")
+	}
+}
+
+func TestDirectoryIndex(t *testing.T) {
+	env := testutil.SetupTestEnv(t)
+	author := storage.Author{Name: "test", Email: "test@test.com"}
+	for name, content := range map[string]string{
+		"docs/intro.md":         "# Intro",
+		"docs/intro/diagram.md": "# Diagram",
+		"docs/guides/setup.md":  "# Setup",
+		"docs/_sidebar.md":      "Docs sidebar",
+		"manual/index.md":       "# Manual",
+		"manual/chapter.md":     "# Chapter",
+	} {
+		if _, err := env.Store.Store(context.Background(), name, content, "init", author); err != nil {
+			t.Fatalf("store %s: %v", name, err)
+		}
+	}
+	if _, err := env.Store.StoreBytes(context.Background(), "docs/logo.png", []byte("png"), "upload", author); err != nil {
+		t.Fatalf("store logo: %v", err)
+	}
+
+	for _, p := range []string{"/docs", "/docs/"} {
+		w := viewPage(t, env, p, "")
+		if w.Code != http.StatusOK {
+			t.Fatalf("GET %s: status = %d, want %d", p, w.Code, http.StatusOK)
+		}
+		body := w.Body.String()
+		_, listing, _ := strings.Cut(body, `class="table table-striped directory-index"`)
+		for _, want := range []string{`href="/docs/intro"`, `href="/docs/guides"`, "and subpages"} {
+			if !strings.Contains(listing, want) {
+				t.Errorf("GET %s: listing should contain %s", p, want)
+			}
+		}
+		for _, notWant := range []string{"logo.png", `href="/docs/_sidebar"`} {
+			if strings.Contains(listing, notWant) {
+				t.Errorf("GET %s: listing should not contain %s", p, notWant)
+			}
+		}
+	}
+
+	if w := viewPage(t, env, "/docs/guides", ""); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `href="/docs/guides/setup"`) {
+		t.Errorf("nested directory: status = %d, want a listing of its pages", w.Code)
+	}
+
+	w := viewPage(t, env, "/manual", "")
+	if w.Code != http.StatusFound || w.Header().Get("Location") != "/manual/index" {
+		t.Errorf("directory with an index page: status = %d, Location = %q; want a redirect to /manual/index", w.Code, w.Header().Get("Location"))
+	}
+
+	if w := viewPage(t, env, "/nowhere", ""); w.Code != http.StatusNotFound {
+		t.Errorf("missing directory: status = %d, want %d", w.Code, http.StatusNotFound)
+	}
+}
@@ -0,0 +1,97 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/sa/gopherwiki/internal/db"
+	"github.com/sa/gopherwiki/internal/util"
+)
+
+// RemindStalePages notifies the last author of each page due for review
+// that it is, and emails them unless they turned that off. Each revision
+// of a page is reminded about once; the author of a page who is not a user
+// of the wiki is not reminded.
+func (s *Server) RemindStalePages(ctx context.Context) error {
+	now := time.Now()
+	stale, err := s.Wiki.StalePages(ctx, now, s.Config.StalePageMonths)
+	if err != nil {
+		return err
+	}
+	for _, p := range stale {
+		reminded, err := s.DB.PageReminderRevision(ctx, p.Path)
+		if err != nil {
+			return err
+		}
+		if reminded == p.Revision {
+			continue
+		}
+		if p.AuthorEmail != "" {
+			s.remindStalePage(ctx, p.Path, p.Title, p.AuthorEmail, p.Overdue)
+		}
+		if err := s.DB.SetPageReminder(ctx, p.Path, p.Revision, now); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// remindStalePage notifies the user with email that the page at pagepath
+// is due for review. Failures are logged, so the reminder is not retried.
+func (s *Server) remindStalePage(ctx context.Context, pagepath, title, email string, overdue bool) {
+	u, err := s.Users.Queries.GetUserByEmail(ctx, email)
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			slog.Warn("failed to look up page author", "path", pagepath, "email", email, "error", err)
+		}
+		return
+	}
+	reason := fmt.Sprintf("It has not been updated for %d %s.", s.Config.StalePageMonths, util.Pluralize(s.Config.StalePageMonths, "months", "month"))
+	if overdue {
+		reason = "Its review date has passed."
+	}
+	n := db.Notification{
+		UserID:    u.ID,
+		Kind:      db.NotificationStalePage,
+		Pagepath:  pagepath,
+		Title:     title,
+		Excerpt:   reason,
+		CreatedAt: time.Now(),
+	}
+	if _, err := s.DB.CreateNotification(ctx, n); err != nil {
+		slog.Warn("failed to record stale page reminder", "path", pagepath, "user", email, "error", err)
+		return
+	}
+
+	siteURL := s.Settings.Get(ctx).SiteURL
+	subject := fmt.Sprintf("[%s] %s is due for review", s.getSiteSettings(ctx).Name, title)
+	body := fmt.Sprintf("You last edited %s, which is due for review. %s\n\n%s%s\n\nYou can turn these emails off in your settings: %s/-/settings\n",
+		title, reason, siteURL, notificationLink(n), siteURL)
+	s.emailNotification(ctx, u, subject, body)
+}
+
+// handleStalePagesReport lists the pages due for review: those past their
+// review date, and those not updated for the configured number of months,
+// or the months query parameter's.
+func (s *Server) handleStalePagesReport(w http.ResponseWriter, r *http.Request) {
+	months := s.Config.StalePageMonths
+	if m, err := strconv.Atoi(r.URL.Query().Get("months")); err == nil && m >= 0 {
+		months = m
+	}
+	stale, err := s.Wiki.StalePages(r.Context(), time.Now(), months)
+	if err != nil {
+		s.renderFailure(w, r, err)
+		return
+	}
+
+	data := NewGenericData("Stale Pages")
+	data["pages"] = stale
+	data["months"] = months
+	s.renderTemplate(w, r, "reports_stale.html", data)
+}
@@ -0,0 +1,82 @@
+package handlers_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sa/gopherwiki/internal/db"
+	"github.com/sa/gopherwiki/internal/storage"
+	"github.com/sa/gopherwiki/internal/testutil"
+)
+
+func TestStalePages(t *testing.T) {
+	env := testutil.SetupTestEnv(t)
+	mailer := make(fakeMailer, 10)
+	env.Server.Mailer = mailer
+	ctx := context.Background()
+	cookies := loginAsUser(t, env, "alice@example.com")
+	alice, _ := env.DB.Queries.GetUserByEmail(ctx, "alice@example.com")
+	author := storage.Author{Name: "Alice", Email: "alice@example.com"}
+
+	if _, err := env.Store.Store(ctx, "overdue.md", "---\nreview_by: 2020-01-01\n---\n# Overdue\n", "Add overdue", author); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := env.Store.Store(ctx, "fresh.md", "# Fresh\n", "Add fresh", author); err != nil {
+		t.Fatal(err)
+	}
+	get := func(path string) string {
+		w := httptest.NewRecorder()
+		env.Router.ServeHTTP(w, requestWithCookies("GET", path, nil, cookies))
+		if w.Code != http.StatusOK {
+			t.Fatalf("GET %s: status = %d, want %d", path, w.Code, http.StatusOK)
+		}
+		return w.Body.String()
+	}
+
+	// The report lists the page past its review date, but not the fresh one.
+	body := get("/-/reports/stale")
+	if !strings.Contains(body, `<td><a href="/overdue">Overdue</a></td>`) || !strings.Contains(body, "2020-01-01") || strings.Contains(body, `<td><a href="/fresh">`) {
+		t.Errorf("stale pages report:\n%s", body)
+	}
+	// Without an age limit, it is the only one.
+	if body := get("/-/reports/stale?months=0"); strings.Count(body, "<td><a href=") != 1 {
+		t.Errorf("stale pages report without an age limit:\n%s", body)
+	}
+
+	// Its last author is notified and emailed once, until it changes.
+	if err := env.Server.RemindStalePages(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := env.Server.RemindStalePages(ctx); err != nil {
+		t.Fatal(err)
+	}
+	list, err := env.DB.ListNotifications(ctx, alice.ID, 10)
+	if err != nil || len(list) != 1 || list[0].Kind != db.NotificationStalePage || list[0].Pagepath != "overdue" || list[0].Title != "Overdue" {
+		t.Fatalf("notifications = %+v, %v; want one about the overdue page", list, err)
+	}
+	select {
+	case m := <-mailer:
+		if m.to != "alice@example.com" || !strings.Contains(m.subject, "Overdue is due for review") || !strings.Contains(m.body, "/overdue") {
+			t.Errorf("reminder email = %+v", m)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no reminder email sent")
+	}
+	if body := get("/-/notifications"); strings.Contains(body, "mentioned you") {
+		t.Errorf("stale page notification shown as a mention:\n%s", body)
+	}
+
+	if _, err := env.Store.Store(ctx, "overdue.md", "---\nreview_by: 2021-01-01\n---\n# Overdue\n", "Postpone", author); err != nil {
+		t.Fatal(err)
+	}
+	if err := env.Server.RemindStalePages(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if list, _ := env.DB.ListNotifications(ctx, alice.ID, 10); len(list) != 2 {
+		t.Errorf("notifications after a new revision = %+v, want two", list)
+	}
+}
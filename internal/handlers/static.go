@@ -0,0 +1,150 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"io/fs"
+	"net/http"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// staticHashLen is the number of hex digits of the content hash embedded in
+// versioned static filenames.
+const staticHashLen = 10
+
+// staticManifest maps static asset paths (relative to the static root, e.g.
+// "css/gopherwiki.css") to content-hashed filenames in the same directory
+// ("css/gopherwiki.3f2a9c1d0b.css"), and back. Keeping the directory means
+// relative references inside CSS (fonts, images) still resolve. It also
+// holds the subresource integrity value of each asset.
+type staticManifest struct {
+	versioned map[string]string
+	original  map[string]string
+	integrity map[string]string
+}
+
+// staticRefPattern finds the assets templates link through staticURL.
+var staticRefPattern = regexp.MustCompile(`staticURL "([^"]+)"`)
+
+// buildStaticManifest hashes the static files referenced by the templates in
+// templatesFS. Only those need versioned URLs, and hashing the whole static
+// tree (vendored MathJax, fonts) would cost every startup for nothing. A
+// referenced file that does not exist is skipped and keeps its plain URL.
+func buildStaticManifest(staticFS, templatesFS fs.FS) (*staticManifest, error) {
+	m := &staticManifest{
+		versioned: make(map[string]string),
+		original:  make(map[string]string),
+		integrity: make(map[string]string),
+	}
+	templates, err := fs.Glob(templatesFS, "*.html")
+	if err != nil {
+		return nil, err
+	}
+	for _, t := range templates {
+		content, err := fs.ReadFile(templatesFS, t)
+		if err != nil {
+			return nil, err
+		}
+		for _, ref := range staticRefPattern.FindAllStringSubmatch(string(content), -1) {
+			name := strings.TrimPrefix(ref[1], "/")
+			if _, done := m.versioned[name]; done {
+				continue
+			}
+			asset, err := fs.ReadFile(staticFS, name)
+			if err != nil {
+				continue
+			}
+			sum := sha256.Sum256(asset)
+			hashed := versionedName(name, hex.EncodeToString(sum[:])[:staticHashLen])
+			m.versioned[name] = hashed
+			m.original[hashed] = name
+			sri := sha512.Sum384(asset)
+			m.integrity[name] = "sha384-" + base64.StdEncoding.EncodeToString(sri[:])
+		}
+	}
+	return m, nil
+}
+
+// versionedName inserts hash before the file extension.
+func versionedName(name, hash string) string {
+	ext := path.Ext(name)
+	return strings.TrimSuffix(name, ext) + "." + hash + ext
+}
+
+// staticURL returns the URL for a static asset. When the asset is in the
+// manifest the URL carries its content hash, so it can be cached forever and
+// still change whenever the file does. Unknown assets, and every asset in
+// debug or dev mode, get the plain URL.
+func (s *Server) staticURL(name string) string {
+	return s.manifestURL(s.staticManifest, name)
+}
+
+// manifestURL returns the URL for a static asset of the theme whose
+// manifest is m.
+func (s *Server) manifestURL(m *staticManifest, name string) string {
+	name = strings.TrimPrefix(name, "/")
+	if m != nil && !s.Config.Debug && !s.Config.DevMode {
+		if hashed, ok := m.versioned[name]; ok {
+			return "/static/" + hashed
+		}
+	}
+	return "/static/" + name
+}
+
+// staticIntegrity returns the subresource integrity value of a static asset,
+// for the integrity attribute of the script or stylesheet loading it, so a
+// browser refuses the file if it is not the one the wiki hashed. It is empty
+// for assets not in the manifest, and in debug or dev mode where files are
+// edited live.
+func (s *Server) staticIntegrity(name string) string {
+	return s.manifestIntegrity(s.staticManifest, name)
+}
+
+// manifestIntegrity returns the subresource integrity value of a static
+// asset of the theme whose manifest is m.
+func (s *Server) manifestIntegrity(m *staticManifest, name string) string {
+	if m == nil || s.Config.Debug || s.Config.DevMode {
+		return ""
+	}
+	return m.integrity[strings.TrimPrefix(name, "/")]
+}
+
+// staticHandler serves the static files of the active theme under /static/.
+// Content-hashed URLs are mapped back to the underlying file of whichever
+// theme hashed it, so pages rendered before a theme change still load, and
+// marked immutable; plain URLs get a day of caching, or none in debug and
+// dev mode where files are edited live.
+func (s *Server) staticHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := strings.TrimPrefix(r.URL.Path, "/static/")
+		active := s.theme(r)
+		for _, t := range append([]*theme{active}, s.themeList()...) {
+			if t.manifest == nil {
+				continue
+			}
+			if original, ok := t.manifest.original[name]; ok {
+				w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+				r2 := r.Clone(r.Context())
+				r2.URL.Path = "/static/" + original
+				r2.URL.RawPath = ""
+				serveStatic(w, r2, t.static)
+				return
+			}
+		}
+		if s.Config.Debug || s.Config.DevMode {
+			w.Header().Set("Cache-Control", "no-cache")
+		} else {
+			w.Header().Set("Cache-Control", "public, max-age=86400")
+		}
+		serveStatic(w, r, active.static)
+	})
+}
+
+// serveStatic serves the file of fsys that r names under /static/.
+func serveStatic(w http.ResponseWriter, r *http.Request, fsys fs.FS) {
+	http.StripPrefix("/static/", http.FileServer(http.FS(fsys))).ServeHTTP(w, r)
+}
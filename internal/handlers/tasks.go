@@ -0,0 +1,107 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/sa/gopherwiki/internal/middleware"
+	"github.com/sa/gopherwiki/internal/renderer"
+	"github.com/sa/gopherwiki/internal/storage"
+	"github.com/sa/gopherwiki/internal/wiki"
+)
+
+// taskPage groups the open tasks of one page for the tasks report.
+type taskPage struct {
+	Pagepath string
+	Pagename string
+	Tasks    []wiki.OpenTask
+}
+
+// handleTasks lists the open task list items across the wiki, each linking
+// to its line in the page source.
+func (s *Server) handleTasks(w http.ResponseWriter, r *http.Request) {
+	tasks, err := s.Wiki.OpenTasks(r.Context(), s.Renderer)
+	if err != nil {
+		s.renderFailure(w, r, err)
+		return
+	}
+
+	var pages []*taskPage
+	for _, task := range tasks {
+		if len(pages) == 0 || pages[len(pages)-1].Pagepath != task.Pagepath {
+			pages = append(pages, &taskPage{Pagepath: task.Pagepath, Pagename: task.Pagename})
+		}
+		last := pages[len(pages)-1]
+		last.Tasks = append(last.Tasks, task)
+	}
+
+	data := NewGenericData("Open Tasks")
+	data["task_pages"] = pages
+	data["task_count"] = len(tasks)
+	s.renderTemplate(w, r, "tasks.html", data)
+}
+
+// handleTaskToggle checks or unchecks a task list item from the page view.
+// The form carries the item's line (as rendered in data-task-line), the new
+// state, and the revision the view was rendered from. It responds with JSON
+// holding the page's new revision, for the next toggle to be based on.
+func (s *Server) handleTaskToggle(w http.ResponseWriter, r *http.Request) {
+	path := chi.URLParam(r, "path")
+
+	writeResult := func(status int, body map[string]interface{}) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(body)
+	}
+
+	if s.needsReview(middleware.GetUser(r)) {
+		writeResult(http.StatusForbidden, map[string]interface{}{"success": false, "error": unreviewableMessage})
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		writeResult(http.StatusBadRequest, map[string]interface{}{"success": false, "error": err.Error()})
+		return
+	}
+	line, err := strconv.Atoi(r.FormValue("line"))
+	if err != nil || line < 1 {
+		writeResult(http.StatusBadRequest, map[string]interface{}{"success": false, "error": "Invalid task line"})
+		return
+	}
+	done, _ := strconv.ParseBool(r.FormValue("done"))
+
+	result, err := s.Wiki.SetTask(r.Context(), s.Renderer, path, line, done,
+		s.conflictBase(r, r.FormValue("revision")), s.getAuthor(r))
+	switch {
+	case errors.Is(err, storage.ErrNotFound):
+		writeResult(http.StatusNotFound, map[string]interface{}{"success": false, "error": "Page not found"})
+		return
+	case errors.Is(err, renderer.ErrNotATask):
+		writeResult(http.StatusBadRequest, map[string]interface{}{"success": false, "error": "No task on that line"})
+		return
+	case errors.Is(err, wiki.ErrSaveRejected):
+		writeResult(http.StatusUnprocessableEntity, map[string]interface{}{"success": false, "error": err.Error()})
+		return
+	case err != nil:
+		slog.Error("failed to toggle task", "path", path, "line", line, "error", err)
+		writeResult(http.StatusInternalServerError, map[string]interface{}{"success": false, "error": "Failed to save page"})
+		return
+	}
+	if result.Conflict {
+		writeResult(http.StatusConflict, map[string]interface{}{
+			"success": false,
+			"error":   "This page was modified since you loaded it. Reload the page and try again.",
+		})
+		return
+	}
+
+	revision := ""
+	if page, err := wiki.NewPage(r.Context(), s.Storage, s.Config, result.Page.Pagepath, ""); err == nil && page.Metadata != nil {
+		revision = page.Metadata.Revision
+	}
+	writeResult(http.StatusOK, map[string]interface{}{"success": true, "revision": revision})
+}
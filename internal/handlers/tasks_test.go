@@ -0,0 +1,118 @@
+package handlers_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/sa/gopherwiki/internal/storage"
+	"github.com/sa/gopherwiki/internal/testutil"
+)
+
+func postTaskToggle(t *testing.T, env *testutil.TestEnv, path string, form url.Values) (*httptest.ResponseRecorder, map[string]interface{}) {
+	t.Helper()
+	req := httptest.NewRequest("POST", path, strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	env.Router.ServeHTTP(w, req)
+	var body map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("response is not JSON: %v: %s", err, w.Body.String())
+	}
+	return w, body
+}
+
+func TestTaskToggle(t *testing.T) {
+	env := testutil.SetupTestEnv(t)
+	author := storage.Author{Name: "test", Email: "test@test.com"}
+	content := "---\ntitle: Todo\n---\n# Todo\n\n- [ ] Write docs\n- [x] Ship it\n"
+	env.Store.Store(context.Background(), "todo.md", content, "init", author)
+	meta, err := env.Store.Metadata(context.Background(), "todo.md", "")
+	if err != nil {
+		t.Fatalf("metadata: %v", err)
+	}
+
+	// The view renders toggleable checkboxes, numbered by body line.
+	body := viewPage(t, env, "/todo", "").Body.String()
+	if !strings.Contains(body, `data-task-toggle="/todo/task"`) || !strings.Contains(body, `data-revision="`+meta.Revision+`"`) {
+		t.Error("page view should enable task toggling for a writer")
+	}
+	if !strings.Contains(body, `data-task-line="3"`) {
+		t.Errorf("first task should be on body line 3, got:\n%s", body)
+	}
+
+	w, resp := postTaskToggle(t, env, "/todo/task", url.Values{
+		"line": {"3"}, "done": {"true"}, "revision": {meta.Revision},
+	})
+	if w.Code != http.StatusOK || resp["success"] != true {
+		t.Fatalf("toggle: status = %d, body = %v", w.Code, resp)
+	}
+	saved, _ := env.Store.Load(context.Background(), "todo.md", "")
+	if want := "---\ntitle: Todo\n---\n# Todo\n\n- [x] Write docs\n- [x] Ship it\n"; saved != want {
+		t.Errorf("content after toggle = %q, want %q", saved, want)
+	}
+	newMeta, _ := env.Store.Metadata(context.Background(), "todo.md", "")
+	if resp["revision"] != newMeta.Revision {
+		t.Errorf("revision = %v, want %q", resp["revision"], newMeta.Revision)
+	}
+	if !strings.Contains(newMeta.Message, "Checked task") {
+		t.Errorf("commit message = %q, want it to describe the task", newMeta.Message)
+	}
+
+	// A toggle based on the old revision conflicts.
+	w, _ = postTaskToggle(t, env, "/todo/task", url.Values{
+		"line": {"4"}, "done": {"false"}, "revision": {meta.Revision},
+	})
+	if w.Code != http.StatusConflict {
+		t.Errorf("stale toggle: status = %d, want %d", w.Code, http.StatusConflict)
+	}
+
+	// Lines without a task, and missing pages, are rejected.
+	if w, _ := postTaskToggle(t, env, "/todo/task", url.Values{"line": {"1"}, "done": {"true"}}); w.Code != http.StatusBadRequest {
+		t.Errorf("non-task line: status = %d, want %d", w.Code, http.StatusBadRequest)
+	}
+	if w, _ := postTaskToggle(t, env, "/missing/task", url.Values{"line": {"1"}, "done": {"true"}}); w.Code != http.StatusNotFound {
+		t.Errorf("missing page: status = %d, want %d", w.Code, http.StatusNotFound)
+	}
+}
+
+func TestTaskToggle_ReadOnly(t *testing.T) {
+	env := testutil.SetupTestEnv(t)
+	env.Server.Config.WriteAccess = "REGISTERED"
+	env.Store.Store(context.Background(), "todo.md", "- [ ] Write docs\n", "init", storage.Author{Name: "test", Email: "test@test.com"})
+
+	if body := viewPage(t, env, "/todo", "").Body.String(); strings.Contains(body, "data-task-toggle") {
+		t.Error("page view should not enable task toggling for a reader")
+	}
+}
+
+func TestTasksReport(t *testing.T) {
+	env := testutil.SetupTestEnv(t)
+	author := storage.Author{Name: "test", Email: "test@test.com"}
+	env.Store.Store(context.Background(), "alpha.md", "---\ntags: [x]\n---\n- [ ] Alpha task\n- [x] Done task\n", "init", author)
+	env.Store.Store(context.Background(), "beta.md", "```\n- [ ] Not a task\n```\n", "init", author)
+
+	w := viewPage(t, env, "/-/tasks", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusOK)
+	}
+	body := w.Body.String()
+	if !strings.Contains(body, `href="/alpha/source#L4"`) || !strings.Contains(body, "Alpha task") {
+		t.Errorf("report should link the open task to its source line, got:\n%s", body)
+	}
+	for _, notWant := range []string{"Done task", "Not a task"} {
+		if strings.Contains(body, notWant) {
+			t.Errorf("report should not list %q", notWant)
+		}
+	}
+
+	// The source view has the line anchors the report links to.
+	body = viewPage(t, env, "/alpha/source", "").Body.String()
+	if !strings.Contains(body, `<span class="source-line" id="L4">- [ ] Alpha task</span>`) {
+		t.Errorf("source view should anchor each line, got:\n%s", body)
+	}
+}
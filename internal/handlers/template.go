@@ -10,39 +10,60 @@ import (
 	"time"
 
 	"github.com/sa/gopherwiki/internal/util"
-	"github.com/sa/gopherwiki/internal/wiki"
 )
 
-// LoadTemplates loads templates from the given filesystem.
-// Each page template is parsed separately with base.html to avoid conflicts.
+// LoadTemplates loads templates from the given filesystem, making them and
+// StaticFS the default theme. It drops the themes LoadThemes loaded.
 func (s *Server) LoadTemplates(fsys fs.FS) error {
+	t, err := s.loadTheme(DefaultTheme, fsys, s.StaticFS)
+	if err != nil {
+		return err
+	}
+	s.TemplateMap = t.templates
+	s.staticManifest = t.manifest
+	s.templatesFS = fsys
+	s.themes = map[string]*theme{DefaultTheme: t}
+	return nil
+}
+
+// loadTheme parses the templates of fsys into the theme called themeName,
+// whose static files are staticFS. Each page template is parsed separately
+// with base.html to avoid conflicts.
+func (s *Server) loadTheme(themeName string, fsys, staticFS fs.FS) (*theme, error) {
+	t := &theme{name: themeName, static: staticFS, templates: make(map[string]*template.Template)}
+	if staticFS != nil {
+		manifest, err := buildStaticManifest(staticFS, fsys)
+		if err != nil {
+			return nil, fmt.Errorf("failed to hash static files: %w", err)
+		}
+		t.manifest = manifest
+	}
 	funcMap := s.templateFuncs()
+	funcMap["staticURL"] = func(name string) string { return s.manifestURL(t.manifest, name) }
+	funcMap["staticIntegrity"] = func(name string) string { return s.manifestIntegrity(t.manifest, name) }
 
-	slog.Info("loading templates")
+	slog.Info("loading templates", "theme", themeName)
 
 	// Read shared template files
 	baseContent, err := fs.ReadFile(fsys, "base.html")
 	if err != nil {
-		return fmt.Errorf("failed to read base.html: %w", err)
+		return nil, fmt.Errorf("failed to read base.html: %w", err)
 	}
 	editorContent, err := fs.ReadFile(fsys, "editor.html")
 	if err != nil {
-		return fmt.Errorf("failed to read editor.html: %w", err)
+		return nil, fmt.Errorf("failed to read editor.html: %w", err)
 	}
 	pageContent, err := fs.ReadFile(fsys, "page.html")
 	if err != nil {
-		return fmt.Errorf("failed to read page.html: %w", err)
+		return nil, fmt.Errorf("failed to read page.html: %w", err)
 	}
 
 	// Find all template files
 	entries, err := fs.Glob(fsys, "*.html")
 	if err != nil {
-		return fmt.Errorf("failed to glob templates: %w", err)
+		return nil, fmt.Errorf("failed to glob templates: %w", err)
 	}
 
-	// Create a map to store each page's template set
-	s.TemplateMap = make(map[string]*template.Template)
-
 	slog.Debug("loaded templates")
 	for _, entry := range entries {
 		name := path.Base(entry)
@@ -57,32 +78,32 @@ func (s *Server) LoadTemplates(fsys fs.FS) error {
 		// Parse base.html
 		tmpl, err = tmpl.Parse(string(baseContent))
 		if err != nil {
-			return fmt.Errorf("failed to parse base.html for %s: %w", name, err)
+			return nil, fmt.Errorf("failed to parse base.html for %s: %w", name, err)
 		}
 
 		// Parse editor.html (for editor_* defines)
 		tmpl, err = tmpl.Parse(string(editorContent))
 		if err != nil {
-			return fmt.Errorf("failed to parse editor.html for %s: %w", name, err)
+			return nil, fmt.Errorf("failed to parse editor.html for %s: %w", name, err)
 		}
 
 		// Parse page.html (for page_* defines)
 		tmpl, err = tmpl.Parse(string(pageContent))
 		if err != nil {
-			return fmt.Errorf("failed to parse page.html for %s: %w", name, err)
+			return nil, fmt.Errorf("failed to parse page.html for %s: %w", name, err)
 		}
 
 		// Parse the specific page template (will override generic_content if defined)
 		specificContent, err := fs.ReadFile(fsys, entry)
 		if err != nil {
-			return fmt.Errorf("failed to read %s: %w", name, err)
+			return nil, fmt.Errorf("failed to read %s: %w", name, err)
 		}
 		tmpl, err = tmpl.Parse(string(specificContent))
 		if err != nil {
-			return fmt.Errorf("failed to parse %s: %w", name, err)
+			return nil, fmt.Errorf("failed to parse %s: %w", name, err)
 		}
 
-		s.TemplateMap[name] = tmpl
+		t.templates[name] = tmpl
 		slog.Debug("loaded template", "name", name)
 	}
 
@@ -101,14 +122,14 @@ func (s *Server) LoadTemplates(fsys fs.FS) error {
 			var err error
 			tmpl, err = tmpl.Parse(content)
 			if err != nil {
-				return fmt.Errorf("failed to parse shared template %s: %w", shared.name, err)
+				return nil, fmt.Errorf("failed to parse shared template %s: %w", shared.name, err)
 			}
 		}
-		s.TemplateMap[shared.name] = tmpl
+		t.templates[shared.name] = tmpl
 		slog.Debug("loaded template", "name", shared.name)
 	}
 
-	return nil
+	return t, nil
 }
 
 // TemplateFuncsForTest exposes templateFuncs for external test packages.
@@ -116,20 +137,14 @@ func (s *Server) TemplateFuncsForTest() template.FuncMap {
 	return s.templateFuncs()
 }
 
-// templateFuncs returns the template function map.
+// templateFuncs returns the template function map, with the plugins' functions.
 func (s *Server) templateFuncs() template.FuncMap {
-	return template.FuncMap{
-		"debugUnixtime": func(p string) string {
-			if s.Config.Debug || s.Config.DevMode {
-				return p + "?" + time.Now().Format("20060102150405")
-			}
-			if s.Version != "" {
-				return p + "?" + s.Version
-			}
-			return p
-		},
+	funcs := template.FuncMap{
+		"staticURL": s.staticURL,
+		"staticIntegrity": s.staticIntegrity,
 		"pluralize": util.Pluralize,
 		"urlquote":  util.URLQuote,
+		"formatSize": formatSize,
 		"formatDatetime": func(t time.Time, format string) string {
 			return util.FormatDatetime(t, format)
 		},
@@ -143,6 +158,7 @@ func (s *Server) templateFuncs() template.FuncMap {
 			return template.HTML(s)
 		},
 		"trimPrefix": strings.TrimPrefix,
+		"join": strings.Join,
 		"urlFor": URLFor,
 		"hasPermission": func(perm string, perms map[string]bool) bool {
 			if perms == nil {
@@ -150,45 +166,9 @@ func (s *Server) templateFuncs() template.FuncMap {
 			}
 			return perms[perm]
 		},
-		"renderPageTree": func(nodes []*wiki.PageTreeNode) template.HTML {
-			if len(nodes) == 0 {
-				return ""
-			}
-			var renderNodes func([]*wiki.PageTreeNode, int) string
-			renderNodes = func(nodes []*wiki.PageTreeNode, depth int) string {
-				var b strings.Builder
-				for _, n := range nodes {
-					if len(n.Children) > 0 {
-						b.WriteString("<details")
-						if depth == 0 {
-							b.WriteString(" open")
-						}
-						b.WriteString("><summary>")
-						if n.IsPage {
-							b.WriteString(`<a href="/`)
-							b.WriteString(template.HTMLEscapeString(n.Path))
-							b.WriteString(`" class="sidebar-link">`)
-							b.WriteString(template.HTMLEscapeString(n.Name))
-							b.WriteString("</a>")
-						} else {
-							b.WriteString(template.HTMLEscapeString(n.Name))
-						}
-						b.WriteString("</summary>")
-						b.WriteString(renderNodes(n.Children, depth+1))
-						b.WriteString("</details>")
-					} else if n.IsPage {
-						b.WriteString(`<a href="/`)
-						b.WriteString(template.HTMLEscapeString(n.Path))
-						b.WriteString(`" class="sidebar-link" style="padding-left: `)
-						b.WriteString(fmt.Sprintf("%d", (depth+1)*12))
-						b.WriteString(`px;">`)
-						b.WriteString(template.HTMLEscapeString(n.Name))
-						b.WriteString("</a>")
-					}
-				}
-				return b.String()
-			}
-			return template.HTML(renderNodes(nodes, 0))
-		},
+		"renderPageTree": s.renderPageTree,
+		"avatar": avatarTag,
 	}
+	s.Plugins.AddTemplateFuncs(funcs)
+	return funcs
 }
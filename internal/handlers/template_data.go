@@ -35,7 +35,7 @@ func NewPageData(page *wiki.Page, htmlContent template.HTML,
 
 // NewEditorData creates template data for the editor.
 func NewEditorData(page *wiki.Page, content string, cursorLine, cursorCh int,
-	revision string, files []map[string]interface{}) map[string]interface{} {
+	revision string) map[string]interface{} {
 
 	return map[string]interface{}{
 		"templateType":   "editor",
@@ -45,8 +45,7 @@ func NewEditorData(page *wiki.Page, content string, cursorLine, cursorCh int,
 		"cursor_line":    cursorLine,
 		"cursor_ch":      cursorCh,
 		"revision":       revision,
-		"files":          files,
-		"pages":          []string{},
+		"pages":          []wiki.PageCompletion{},
 	}
 }
 
@@ -1,11 +1,15 @@
 package handlers_test
 
 import (
+	"context"
 	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
 
 	"github.com/go-chi/chi/v5"
 
+	"github.com/sa/gopherwiki/internal/storage"
 	"github.com/sa/gopherwiki/internal/testutil"
 )
 
@@ -107,3 +111,50 @@ func TestURLForRouteSync(t *testing.T) {
 		})
 	}
 }
+
+// TestTemplatePermissions verifies that actions the viewer may not perform
+// are left out of the page rather than shown and refused on use.
+func TestTemplatePermissions(t *testing.T) {
+	env := testutil.SetupTestEnv(t)
+	env.Server.Config.WriteAccess = "APPROVED"
+	env.Server.Config.AttachmentAccess = "APPROVED"
+	env.Store.Store(context.Background(), "home.md", "# Home", "init", storage.Author{Name: "Test", Email: "test@example.com"})
+
+	get := func(path string, cookies []*http.Cookie) string {
+		t.Helper()
+		req := requestWithCookies("GET", path, nil, cookies)
+		w := httptest.NewRecorder()
+		env.Router.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("GET %s: status = %d, want %d", path, w.Code, http.StatusOK)
+		}
+		return w.Body.String()
+	}
+
+	actions := map[string]string{
+		"/Home":             `id="edit-page-btn"`,
+		"/Home/attachments": "Upload New Attachment",
+		"/-/issues":         `href="/-/issues/new"`,
+	}
+
+	for path, action := range actions {
+		body := get(path, nil)
+		if strings.Contains(body, action) {
+			t.Errorf("anonymous %s should not offer %s", path, action)
+		}
+		if strings.Contains(body, `href="/-/admin"`) {
+			t.Errorf("anonymous %s should not link to the admin pages", path)
+		}
+	}
+
+	cookies := loginAsUser(t, env, "writer@example.com")
+	for path, action := range actions {
+		if body := get(path, cookies); !strings.Contains(body, action) {
+			t.Errorf("approved user on %s should be offered %s", path, action)
+		}
+	}
+
+	if body := get("/Home", loginAsAdmin(t, env)); !strings.Contains(body, `href="/-/admin"`) {
+		t.Error("admin should see the admin link")
+	}
+}
@@ -0,0 +1,248 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/sa/gopherwiki/internal/config"
+	"github.com/sa/gopherwiki/internal/db"
+	"github.com/sa/gopherwiki/internal/middleware"
+)
+
+// DefaultTheme names the theme made of the templates and static files
+// given to LoadTemplates. Every other theme falls back to it.
+const DefaultTheme = "default"
+
+// theme is a set of parsed templates and the static files they link to.
+type theme struct {
+	name      string
+	templates map[string]*template.Template
+	static    fs.FS
+	manifest  *staticManifest
+}
+
+// themeMeta is the optional theme.yaml of a theme pack.
+type themeMeta struct {
+	// Extends names the theme whose files this one falls back to; the
+	// default theme if empty.
+	Extends string `yaml:"extends"`
+}
+
+// themePack is a theme directory found by LoadThemes, before it is parsed.
+type themePack struct {
+	fsys    fs.FS
+	extends string
+}
+
+// LoadThemes loads the theme packs in sources, each holding one directory
+// per theme named after it. A theme directory has a templates directory,
+// a static directory, or both, and holds only the files it changes: the
+// rest come from the theme it extends, as set in its theme.yaml, and
+// finally from the default theme. A theme in a later source replaces one
+// of the same name in an earlier source. It must be called after
+// LoadTemplates, and before the server serves requests.
+func (s *Server) LoadThemes(sources ...fs.FS) error {
+	base := s.themes[DefaultTheme]
+	if base == nil {
+		return errors.New("LoadThemes needs the templates loaded first")
+	}
+
+	packs := make(map[string]themePack)
+	for _, src := range sources {
+		entries, err := fs.ReadDir(src, ".")
+		if err != nil {
+			return fmt.Errorf("failed to read themes: %w", err)
+		}
+		for _, e := range entries {
+			if !e.IsDir() || strings.HasPrefix(e.Name(), ".") {
+				continue
+			}
+			name := e.Name()
+			if !config.ValidThemeName(name) || name == DefaultTheme {
+				return fmt.Errorf("theme directory %q: themes are named with lowercase letters, digits, hyphens, and underscores, and not %q", name, DefaultTheme)
+			}
+			sub, err := fs.Sub(src, name)
+			if err != nil {
+				return err
+			}
+			pack := themePack{fsys: sub, extends: DefaultTheme}
+			data, err := fs.ReadFile(sub, "theme.yaml")
+			switch {
+			case err == nil:
+				var meta themeMeta
+				if err := yaml.Unmarshal(data, &meta); err != nil {
+					return fmt.Errorf("theme %s: theme.yaml: %w", name, err)
+				}
+				if meta.Extends != "" {
+					pack.extends = meta.Extends
+				}
+			case !errors.Is(err, fs.ErrNotExist):
+				return fmt.Errorf("theme %s: %w", name, err)
+			}
+			packs[name] = pack
+		}
+	}
+
+	names := make([]string, 0, len(packs))
+	for name := range packs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	themes := map[string]*theme{DefaultTheme: base}
+	for _, name := range names {
+		chain, err := themeChain(packs, name)
+		if err != nil {
+			return err
+		}
+		var templates, static layeredFS
+		for _, n := range chain {
+			t, _ := fs.Sub(packs[n].fsys, "templates")
+			st, _ := fs.Sub(packs[n].fsys, "static")
+			templates = append(templates, t)
+			static = append(static, st)
+		}
+		templates = append(templates, s.templatesFS)
+		if base.static != nil {
+			static = append(static, base.static)
+		}
+		t, err := s.loadTheme(name, templates, static)
+		if err != nil {
+			return fmt.Errorf("theme %s: %w", name, err)
+		}
+		themes[name] = t
+	}
+	s.themes = themes
+
+	if active := s.Settings.Get(context.Background()).Theme; themes[active] == nil {
+		slog.Warn("the active theme is not installed; using the default theme", "theme", active)
+	}
+	return nil
+}
+
+// themeChain returns the theme called name followed by the themes it
+// extends, up to but not including the default theme.
+func themeChain(packs map[string]themePack, name string) ([]string, error) {
+	var chain []string
+	for n := name; n != DefaultTheme; n = packs[n].extends {
+		if _, ok := packs[n]; !ok {
+			return nil, fmt.Errorf("theme %s extends %s, which is not installed", chain[len(chain)-1], n)
+		}
+		for _, seen := range chain {
+			if seen == n {
+				return nil, fmt.Errorf("theme %s extends itself through %s", name, strings.Join(chain, ", "))
+			}
+		}
+		chain = append(chain, n)
+	}
+	return chain, nil
+}
+
+// ThemeNames returns the names of the loaded themes, the default first.
+func (s *Server) ThemeNames() []string {
+	names := []string{DefaultTheme}
+	for name := range s.themes {
+		if name != DefaultTheme {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names[1:])
+	return names
+}
+
+// theme returns the active theme: the one the settings name, or the
+// default if it is not loaded.
+func (s *Server) theme(r *http.Request) *theme {
+	if t := s.themes[s.Settings.Get(r.Context()).Theme]; t != nil {
+		return t
+	}
+	if t := s.themes[DefaultTheme]; t != nil {
+		return t
+	}
+	// Templates set up without LoadTemplates
+	return &theme{name: DefaultTheme, templates: s.TemplateMap, static: s.StaticFS, manifest: s.staticManifest}
+}
+
+// themeList returns the loaded themes.
+func (s *Server) themeList() []*theme {
+	list := make([]*theme, 0, len(s.themes))
+	for _, name := range s.ThemeNames() {
+		if t := s.themes[name]; t != nil {
+			list = append(list, t)
+		}
+	}
+	return list
+}
+
+// layeredFS serves each file from the first layer that has it, so a theme
+// need only hold the files it changes. A directory lists the entries of
+// every layer.
+type layeredFS []fs.FS
+
+func (l layeredFS) Open(name string) (fs.File, error) {
+	for _, layer := range l {
+		f, err := layer.Open(name)
+		if err == nil {
+			return f, nil
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			return nil, err
+		}
+	}
+	return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+}
+
+func (l layeredFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	var entries []fs.DirEntry
+	seen := make(map[string]bool)
+	found := false
+	for _, layer := range l {
+		list, err := fs.ReadDir(layer, name)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		found = true
+		for _, e := range list {
+			if !seen[e.Name()] {
+				seen[e.Name()] = true
+				entries = append(entries, e)
+			}
+		}
+	}
+	if !found {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrNotExist}
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+	return entries, nil
+}
+
+// setColorScheme stores the color scheme the user of r chose; "" or
+// "system" follows the browser.
+func (s *Server) setColorScheme(r *http.Request, scheme string) error {
+	return s.setUserPreferences(r, map[string]string{db.UserPrefColorScheme: scheme})
+}
+
+// handleColorScheme stores the color scheme the dark mode toggle chose.
+func (s *Server) handleColorScheme(w http.ResponseWriter, r *http.Request) {
+	if !middleware.GetUser(r).IsAuthenticated() {
+		http.Error(w, "Not logged in", http.StatusUnauthorized)
+		return
+	}
+	if err := s.setColorScheme(r, r.FormValue("scheme")); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,179 @@
+package handlers_test
+
+import (
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/sa/gopherwiki/internal/testutil"
+	"github.com/sa/gopherwiki/web"
+)
+
+// testThemes holds a theme overriding the about page and its stylesheet,
+// and one extending it that overrides nothing but its stylesheet.
+var testThemes = fstest.MapFS{
+	"paper/templates/about.html":      {Data: []byte(`{{define "generic_content"}}<p class="paper-about">paper</p>{{end}}`)},
+	"paper/static/css/theme.css":      {Data: []byte(".paper {}")},
+	"paper-dark/theme.yaml":           {Data: []byte("extends: paper\n")},
+	"paper-dark/static/css/theme.css": {Data: []byte(".paper-dark {}")},
+}
+
+func TestThemes(t *testing.T) {
+	env := testutil.SetupTestEnv(t)
+	if err := env.Server.LoadThemes(testThemes); err != nil {
+		t.Fatalf("LoadThemes: %v", err)
+	}
+	if got := env.Server.ThemeNames(); strings.Join(got, ",") != "default,paper,paper-dark" {
+		t.Errorf("ThemeNames = %v", got)
+	}
+	cookies := loginAsAdmin(t, env)
+
+	get := func(path string) string {
+		t.Helper()
+		w := httptest.NewRecorder()
+		env.Router.ServeHTTP(w, requestWithCookies("GET", path, nil, cookies))
+		if w.Code != http.StatusOK {
+			t.Fatalf("GET %s = %d, want 200", path, w.Code)
+		}
+		return w.Body.String()
+	}
+	useTheme := func(name string) {
+		t.Helper()
+		form := url.Values{
+			"read_access":          {"ANONYMOUS"},
+			"write_access":         {"ANONYMOUS"},
+			"attachment_access":    {"ANONYMOUS"},
+			"registration_enabled": {"on"},
+			"site_url":             {"http://localhost:8080"},
+			"edit_conflict_mode":   {"reject"},
+			"theme":                {name},
+		}
+		req := requestWithCookies("POST", "/-/admin/settings", strings.NewReader(form.Encode()), cookies)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		env.Router.ServeHTTP(httptest.NewRecorder(), req)
+	}
+	stylesheet := func(page string) string {
+		t.Helper()
+		i := strings.Index(page, "/static/css/theme.")
+		if i < 0 {
+			t.Fatal("page does not link the theme stylesheet")
+		}
+		return get(page[i : i+strings.IndexByte(page[i:], '"')])
+	}
+
+	if page := get("/-/about"); strings.Contains(page, "paper-about") {
+		t.Error("the default theme uses the paper about page")
+	}
+
+	useTheme("paper")
+	page := get("/-/about")
+	if !strings.Contains(page, "paper-about") {
+		t.Error("the paper theme's about page is not used")
+	}
+	if !strings.Contains(page, `data-theme="light"`) {
+		t.Error("templates the theme does not override are missing")
+	}
+	if css := stylesheet(page); css != ".paper {}" {
+		t.Errorf("paper theme.css = %q", css)
+	}
+
+	useTheme("paper-dark")
+	page = get("/-/about")
+	if !strings.Contains(page, "paper-about") {
+		t.Error("paper-dark does not fall back to the paper about page")
+	}
+	if css := stylesheet(page); css != ".paper-dark {}" {
+		t.Errorf("paper-dark theme.css = %q", css)
+	}
+	if css := get("/static/css/gopherwiki.css"); !strings.Contains(css, "wiki-layout") {
+		t.Error("paper-dark does not fall back to the default stylesheet")
+	}
+
+	useTheme("missing")
+	if !strings.Contains(get("/-/about"), "paper-about") {
+		t.Error("saving an uninstalled theme changed the active theme")
+	}
+}
+
+func TestThemes_Invalid(t *testing.T) {
+	env := testutil.SetupTestEnv(t)
+	for name, themes := range map[string]fstest.MapFS{
+		"cycle": {
+			"a/theme.yaml": {Data: []byte("extends: b\n")},
+			"b/theme.yaml": {Data: []byte("extends: a\n")},
+		},
+		"missing parent": {"a/theme.yaml": {Data: []byte("extends: nowhere\n")}},
+		"bad name":       {"Bad Name/static/css/theme.css": {Data: nil}},
+		"default":        {"default/static/css/theme.css": {Data: nil}},
+	} {
+		if err := env.Server.LoadThemes(themes); err == nil {
+			t.Errorf("%s: LoadThemes succeeded", name)
+		}
+	}
+}
+
+func TestThemes_Embedded(t *testing.T) {
+	env := testutil.SetupTestEnv(t)
+	embedded, err := fs.Sub(web.ThemesFS, "themes")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := env.Server.LoadThemes(embedded); err != nil {
+		t.Fatalf("LoadThemes: %v", err)
+	}
+	if got := env.Server.ThemeNames(); len(got) < 2 || got[0] != "default" {
+		t.Errorf("ThemeNames = %v, want default and the embedded themes", got)
+	}
+}
+
+func TestColorScheme(t *testing.T) {
+	env := testutil.SetupTestEnv(t)
+
+	post := func(cookies []*http.Cookie, scheme string) int {
+		t.Helper()
+		req := requestWithCookies("POST", "/-/settings/color-scheme", strings.NewReader(url.Values{"scheme": {scheme}}.Encode()), cookies)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		env.Router.ServeHTTP(w, req)
+		return w.Code
+	}
+	htmlTag := func(cookies []*http.Cookie) string {
+		t.Helper()
+		w := httptest.NewRecorder()
+		env.Router.ServeHTTP(w, requestWithCookies("GET", "/-/about", nil, cookies))
+		body := w.Body.String()
+		i := strings.Index(body, "<html")
+		return body[i : i+strings.IndexByte(body[i:], '>')]
+	}
+
+	if code := post(nil, "dark"); code != http.StatusUnauthorized {
+		t.Errorf("anonymous POST = %d, want %d", code, http.StatusUnauthorized)
+	}
+	if tag := htmlTag(nil); strings.Contains(tag, "data-color-scheme") {
+		t.Errorf("anonymous page carries an account color scheme: %s", tag)
+	}
+
+	cookies := loginAsUser(t, env, "dark@example.com")
+	if tag := htmlTag(cookies); !strings.Contains(tag, `data-color-scheme=""`) {
+		t.Errorf("unset color scheme: %s", tag)
+	}
+	if code := post(cookies, "purple"); code != http.StatusBadRequest {
+		t.Errorf("POST purple = %d, want %d", code, http.StatusBadRequest)
+	}
+	if code := post(cookies, "dark"); code != http.StatusNoContent {
+		t.Fatalf("POST dark = %d, want %d", code, http.StatusNoContent)
+	}
+	if tag := htmlTag(cookies); !strings.Contains(tag, `data-theme="dark"`) || !strings.Contains(tag, `data-color-scheme="dark"`) {
+		t.Errorf("after choosing dark: %s", tag)
+	}
+	if code := post(cookies, "system"); code != http.StatusNoContent {
+		t.Fatalf("POST system = %d, want %d", code, http.StatusNoContent)
+	}
+	if tag := htmlTag(cookies); !strings.Contains(tag, `data-color-scheme=""`) {
+		t.Errorf("after choosing system: %s", tag)
+	}
+}
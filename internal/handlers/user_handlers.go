@@ -0,0 +1,140 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/sa/gopherwiki/internal/db"
+	"github.com/sa/gopherwiki/internal/storage"
+)
+
+// userFieldNameRegex restricts custom profile field names to identifiers that
+// are safe as form field suffixes and JSON keys.
+var userFieldNameRegex = regexp.MustCompile(`^[a-z][a-z0-9_]{0,63}$`)
+
+// validateUserField checks a custom profile field definition.
+func validateUserField(name, label string) error {
+	if !userFieldNameRegex.MatchString(name) {
+		return errors.New("field name must start with a letter and contain only lowercase letters, digits, and underscores")
+	}
+	if label == "" {
+		return errors.New("field label is required")
+	}
+	return nil
+}
+
+// saveUserFieldsFromForm stores the "field_<name>" form values for every
+// defined profile field. The form must already be parsed.
+func (s *Server) saveUserFieldsFromForm(r *http.Request, userID int64) error {
+	fields, err := s.Users.ListUserFields(r.Context())
+	if err != nil {
+		return err
+	}
+	if len(fields) == 0 {
+		return nil
+	}
+
+	values := make(map[string]string, len(fields))
+	for _, f := range fields {
+		values[f.Name] = strings.TrimSpace(r.FormValue("field_" + f.Name))
+	}
+	return s.Users.SetUserFieldValues(r.Context(), userID, values)
+}
+
+// handleUserProfile shows a user's public profile, including custom fields.
+func (s *Server) handleUserProfile(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	email := chi.URLParam(r, "email")
+
+	user, err := s.Auth.GetUserByEmail(ctx, email)
+	if err != nil {
+		s.renderError(w, r, http.StatusNotFound, "User not found")
+		return
+	}
+
+	fields, err := s.Users.ListUserFields(ctx)
+	if err != nil {
+		slog.Error("failed to list user fields", "error", err)
+	}
+	fieldValues, err := s.Users.GetUserFieldValues(ctx, user.ID)
+	if err != nil {
+		slog.Error("failed to get user field values", "error", err)
+	}
+
+	data := NewGenericData(user.GetName())
+	data["profile_user"] = user
+	data["user_fields"] = fields
+	data["user_field_values"] = fieldValues
+	s.renderTemplate(w, r, "user_profile.html", data)
+}
+
+// userActivityLimit caps each section (commits, issues, comments) of a user's
+// activity listing.
+const userActivityLimit = 50
+
+// userActivity collects a user's recent contributions.
+type userActivity struct {
+	Email    string
+	Name     string
+	Commits  []storage.CommitMetadata
+	Issues   []db.Issue
+	Comments []db.IssueComment
+}
+
+// loadUserActivity gathers the commits, issues, and comments authored by
+// email. The email need not belong to a registered account, so activity of
+// git-only authors is still listed.
+func (s *Server) loadUserActivity(ctx context.Context, email string) (*userActivity, error) {
+	activity := &userActivity{Email: email, Name: email}
+	if user, err := s.Auth.GetUserByEmail(ctx, email); err == nil {
+		activity.Name = user.GetName()
+	}
+
+	commits, err := s.Wiki.QueryChangelog(ctx, storage.LogQuery{
+		AuthorEmail: email,
+		Limit:       userActivityLimit,
+	})
+	if err != nil {
+		return nil, err
+	}
+	activity.Commits = commits
+
+	activity.Issues, err = s.DB.Queries.ListIssuesByCreator(ctx, db.ListIssuesByCreatorParams{
+		CreatedByEmail: db.NullString(email),
+		Limit:          userActivityLimit,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	activity.Comments, err = s.DB.Queries.ListIssueCommentsByAuthor(ctx, db.ListIssueCommentsByAuthorParams{
+		AuthorEmail: db.NullString(email),
+		Limit:       userActivityLimit,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return activity, nil
+}
+
+// handleUserActivity lists a user's recent commits, issues, and comments.
+func (s *Server) handleUserActivity(w http.ResponseWriter, r *http.Request) {
+	email := chi.URLParam(r, "email")
+
+	activity, err := s.loadUserActivity(r.Context(), email)
+	if err != nil {
+		s.renderError(w, r, http.StatusInternalServerError, "Failed to load user activity")
+		return
+	}
+
+	data := NewGenericData("Activity: " + activity.Name)
+	data["activity"] = activity
+	s.renderTemplate(w, r, "user_activity.html", data)
+}
@@ -0,0 +1,733 @@
+package handlers_test
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sa/gopherwiki/internal/db"
+	"github.com/sa/gopherwiki/internal/storage"
+	"github.com/sa/gopherwiki/internal/testutil"
+)
+
+func TestAdminUserFieldCreate(t *testing.T) {
+	env := testutil.SetupTestEnv(t)
+	cookies := loginAsAdmin(t, env)
+
+	form := url.Values{"name": {"department"}, "label": {"Department"}}
+	req := requestWithCookies("POST", "/-/admin/user-fields", strings.NewReader(form.Encode()), cookies)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	env.Router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusFound {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusFound)
+	}
+
+	fields, err := env.DB.ListUserFields(context.Background())
+	if err != nil {
+		t.Fatalf("ListUserFields failed: %v", err)
+	}
+	if len(fields) != 1 || fields[0].Name != "department" {
+		t.Errorf("fields = %+v, want one 'department' field", fields)
+	}
+}
+
+func TestAdminUserFieldCreate_InvalidName(t *testing.T) {
+	env := testutil.SetupTestEnv(t)
+	cookies := loginAsAdmin(t, env)
+
+	form := url.Values{"name": {"Bad Name!"}, "label": {"Bad"}}
+	req := requestWithCookies("POST", "/-/admin/user-fields", strings.NewReader(form.Encode()), cookies)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	env.Router.ServeHTTP(w, req)
+
+	fields, _ := env.DB.ListUserFields(context.Background())
+	if len(fields) != 0 {
+		t.Errorf("invalid field name should be rejected, got %+v", fields)
+	}
+}
+
+func TestSettings_UpdateFields(t *testing.T) {
+	env := testutil.SetupTestEnv(t)
+	ctx := context.Background()
+	if _, err := env.DB.CreateUserField(ctx, "location", "Location"); err != nil {
+		t.Fatalf("CreateUserField failed: %v", err)
+	}
+	cookies := loginAsUser(t, env, "fields@example.com")
+
+	form := url.Values{
+		"action":         {"update_fields"},
+		"field_location": {"  Lisbon  "},
+	}
+	req := requestWithCookies("POST", "/-/settings", strings.NewReader(form.Encode()), cookies)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	env.Router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusFound {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusFound)
+	}
+
+	user, err := env.Server.Auth.GetUserByEmail(ctx, "fields@example.com")
+	if err != nil {
+		t.Fatalf("GetUserByEmail failed: %v", err)
+	}
+	values, _ := env.DB.GetUserFieldValues(ctx, user.ID)
+	if values["location"] != "Lisbon" {
+		t.Errorf("location = %q, want %q", values["location"], "Lisbon")
+	}
+
+	// The settings page shows the stored value
+	req = requestWithCookies("GET", "/-/settings", nil, cookies)
+	w = httptest.NewRecorder()
+	env.Router.ServeHTTP(w, req)
+	if !strings.Contains(w.Body.String(), `value="Lisbon"`) {
+		t.Error("settings page should show the stored field value")
+	}
+}
+
+func TestUserProfileShowsFields(t *testing.T) {
+	env := testutil.SetupTestEnv(t)
+	ctx := context.Background()
+	if _, err := env.DB.CreateUserField(ctx, "chat", "Chat Handle"); err != nil {
+		t.Fatalf("CreateUserField failed: %v", err)
+	}
+	user := testutil.CreateTestUser(t, env.DB, testutil.UserOpts{
+		Email: "profile@example.com",
+		Name:  "Profile User",
+	})
+	if err := env.DB.SetUserFieldValues(ctx, user.ID, map[string]string{"chat": "@profile"}); err != nil {
+		t.Fatalf("SetUserFieldValues failed: %v", err)
+	}
+
+	req := httptest.NewRequest("GET", "/-/user/profile@example.com", nil)
+	w := httptest.NewRecorder()
+	env.Router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusOK)
+	}
+	body := w.Body.String()
+	if !strings.Contains(body, "Chat Handle") || !strings.Contains(body, "@profile") {
+		t.Error("profile page should show custom field label and value")
+	}
+
+	// The admin user list shows the field as a column
+	cookies := loginAsAdmin(t, env)
+	req = requestWithCookies("GET", "/-/admin/users", nil, cookies)
+	w = httptest.NewRecorder()
+	env.Router.ServeHTTP(w, req)
+	if !strings.Contains(w.Body.String(), "@profile") {
+		t.Error("admin user list should show custom field values")
+	}
+}
+
+func TestUserProfile_NotFound(t *testing.T) {
+	env := testutil.SetupTestEnv(t)
+
+	req := httptest.NewRequest("GET", "/-/user/nobody@example.com", nil)
+	w := httptest.NewRecorder()
+	env.Router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusNotFound {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusNotFound)
+	}
+}
+
+func TestAPIUserFields(t *testing.T) {
+	env := testutil.SetupTestEnv(t)
+	cookies := loginAsAdmin(t, env)
+	user := testutil.CreateTestUser(t, env.DB, testutil.UserOpts{Email: "sync@example.com"})
+
+	w := apiRequest(t, env, "POST", "/-/api/v1/user-fields", `{"name":"department","label":"Department"}`, cookies)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create status = %d, want %d\nbody: %s", w.Code, http.StatusCreated, w.Body.String())
+	}
+
+	path := fmt.Sprintf("/-/api/v1/users/%d/fields", user.ID)
+	w = apiRequest(t, env, "PUT", path, `{"department":"Sales"}`, cookies)
+	if w.Code != http.StatusOK {
+		t.Fatalf("update status = %d, want %d\nbody: %s", w.Code, http.StatusOK, w.Body.String())
+	}
+
+	w = apiGet(t, env, path, cookies)
+	resp := parseAPIResponse(t, w)
+	data, ok := resp["data"].(map[string]interface{})
+	if !ok {
+		t.Fatalf("data should be an object, got %T", resp["data"])
+	}
+	if data["department"] != "Sales" {
+		t.Errorf("department = %v, want Sales", data["department"])
+	}
+
+	// Unknown fields are rejected
+	w = apiRequest(t, env, "PUT", path, `{"nope":"x"}`, cookies)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("unknown field status = %d, want %d", w.Code, http.StatusBadRequest)
+	}
+}
+
+func TestAPIUserFields_NonAdmin(t *testing.T) {
+	env := testutil.SetupTestEnv(t)
+	cookies := loginAsUser(t, env, "regular@example.com")
+
+	w := apiGet(t, env, "/-/api/v1/user-fields", cookies)
+	if w.Code != http.StatusForbidden {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusForbidden)
+	}
+}
+
+func TestAdminUserCreate(t *testing.T) {
+	env := testutil.SetupTestEnv(t)
+	cookies := loginAsAdmin(t, env)
+
+	form := url.Values{
+		"name":        {"New Person"},
+		"email":       {"New@Example.com"},
+		"password":    {"newpassword123"},
+		"is_approved": {"on"},
+		"allow_read":  {"on"},
+	}
+	req := requestWithCookies("POST", "/-/admin/users/new", strings.NewReader(form.Encode()), cookies)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	env.Router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusFound {
+		t.Fatalf("status = %d, want %d\nbody: %s", w.Code, http.StatusFound, w.Body.String())
+	}
+
+	user, err := env.Server.Auth.Authenticate(context.Background(), "new@example.com", "newpassword123")
+	if err != nil {
+		t.Fatalf("created user cannot log in: %v", err)
+	}
+	if !user.CanRead() || user.CanWrite() || user.Admin() {
+		t.Errorf("permissions = read %v write %v admin %v, want read only",
+			user.CanRead(), user.CanWrite(), user.Admin())
+	}
+
+	// A second account with the same email is refused
+	req = requestWithCookies("POST", "/-/admin/users/new", strings.NewReader(form.Encode()), cookies)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w = httptest.NewRecorder()
+	env.Router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "Email already registered") {
+		t.Errorf("duplicate create: status = %d, want the form again with an error", w.Code)
+	}
+}
+
+func TestAdminUserPassword(t *testing.T) {
+	env := testutil.SetupTestEnv(t)
+	cookies := loginAsAdmin(t, env)
+	user := testutil.CreateTestUser(t, env.DB, testutil.UserOpts{Email: "forgetful@example.com", Approved: true})
+
+	path := fmt.Sprintf("/-/admin/users/%d/password", user.ID)
+	post := func(password, password2 string) {
+		form := url.Values{"password": {password}, "password2": {password2}}
+		req := requestWithCookies("POST", path, strings.NewReader(form.Encode()), cookies)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		env.Router.ServeHTTP(w, req)
+		if w.Code != http.StatusFound {
+			t.Fatalf("status = %d, want %d", w.Code, http.StatusFound)
+		}
+	}
+
+	post("short", "short")
+	post("mismatched123", "mismatched456")
+	if _, err := env.Server.Auth.Authenticate(context.Background(), "forgetful@example.com", "short"); err == nil {
+		t.Error("too short a password should not have been set")
+	}
+
+	post("brandnew12345", "brandnew12345")
+	if _, err := env.Server.Auth.Authenticate(context.Background(), "forgetful@example.com", "brandnew12345"); err != nil {
+		t.Errorf("password was not set: %v", err)
+	}
+}
+
+// resetToken extracts the token from a password reset link.
+func resetToken(t *testing.T, link string) string {
+	t.Helper()
+	u, err := url.Parse(link)
+	if err != nil || u.Path != "/-/reset-password" || u.Query().Get("token") == "" {
+		t.Fatalf("unexpected reset link %q", link)
+	}
+	return u.Query().Get("token")
+}
+
+func TestAPIUserCreateAndPasswordReset(t *testing.T) {
+	env := testutil.SetupTestEnv(t)
+	ctx := context.Background()
+	cookies := loginAsAdmin(t, env)
+
+	w := apiRequest(t, env, "POST", "/-/api/v1/users", `{"name":"Provisioned","email":"prov@example.com"}`, cookies)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create status = %d, want %d\nbody: %s", w.Code, http.StatusCreated, w.Body.String())
+	}
+	data := parseAPIResponse(t, w)["data"].(map[string]interface{})
+	if data["has_password"] != false || data["allow_write"] != true || data["is_admin"] != false {
+		t.Errorf("created user = %v, want defaults without a password", data)
+	}
+	id := int64(data["id"].(float64))
+
+	w = apiRequest(t, env, "POST", "/-/api/v1/users", `{"email":"prov@example.com"}`, cookies)
+	if w.Code != http.StatusConflict {
+		t.Errorf("duplicate status = %d, want %d", w.Code, http.StatusConflict)
+	}
+	w = apiRequest(t, env, "POST", "/-/api/v1/users", `{"email":"other@example.com","password":"short"}`, cookies)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("short password status = %d, want %d", w.Code, http.StatusBadRequest)
+	}
+
+	w = apiRequest(t, env, "POST", fmt.Sprintf("/-/api/v1/users/%d/password-reset", id), "", cookies)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("reset status = %d, want %d\nbody: %s", w.Code, http.StatusCreated, w.Body.String())
+	}
+	reset := parseAPIResponse(t, w)["data"].(map[string]interface{})
+	token := resetToken(t, reset["url"].(string))
+
+	req := httptest.NewRequest("GET", "/-/reset-password?token="+url.QueryEscape(token), nil)
+	w = httptest.NewRecorder()
+	env.Router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("reset form status = %d, want %d", w.Code, http.StatusOK)
+	}
+
+	setPassword := func(password string) *httptest.ResponseRecorder {
+		form := url.Values{"token": {token}, "password": {password}, "password2": {password}}
+		req := httptest.NewRequest("POST", "/-/reset-password", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		env.Router.ServeHTTP(w, req)
+		return w
+	}
+
+	// A rejected password leaves the link usable
+	if w := setPassword("short"); w.Code != http.StatusOK {
+		t.Errorf("short password status = %d, want the form again", w.Code)
+	}
+	if w := setPassword("chosenpass123"); w.Code != http.StatusFound {
+		t.Fatalf("reset status = %d, want %d", w.Code, http.StatusFound)
+	}
+	if _, err := env.Server.Auth.Authenticate(ctx, "prov@example.com", "chosenpass123"); err != nil {
+		t.Errorf("password from reset link does not work: %v", err)
+	}
+	if w := setPassword("another12345"); w.Code != http.StatusBadRequest {
+		t.Errorf("reused link status = %d, want %d", w.Code, http.StatusBadRequest)
+	}
+
+	// Setting the password directly invalidates outstanding links
+	w = apiRequest(t, env, "POST", fmt.Sprintf("/-/api/v1/users/%d/password-reset", id), "", cookies)
+	token = resetToken(t, parseAPIResponse(t, w)["data"].(map[string]interface{})["url"].(string))
+	w = apiRequest(t, env, "PUT", fmt.Sprintf("/-/api/v1/users/%d/password", id), `{"password":"adminchosen123"}`, cookies)
+	if w.Code != http.StatusOK {
+		t.Fatalf("set password status = %d, want %d\nbody: %s", w.Code, http.StatusOK, w.Body.String())
+	}
+	if _, err := env.Server.Auth.Authenticate(ctx, "prov@example.com", "adminchosen123"); err != nil {
+		t.Errorf("password set through the API does not work: %v", err)
+	}
+	if w := setPassword("another12345"); w.Code != http.StatusBadRequest {
+		t.Errorf("link issued before the password was set: status = %d, want %d", w.Code, http.StatusBadRequest)
+	}
+}
+
+func TestAPIUserCreate_NonAdmin(t *testing.T) {
+	env := testutil.SetupTestEnv(t)
+	cookies := loginAsUser(t, env, "regular@example.com")
+
+	w := apiRequest(t, env, "POST", "/-/api/v1/users", `{"email":"sneaky@example.com"}`, cookies)
+	if w.Code != http.StatusForbidden {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusForbidden)
+	}
+}
+
+func TestAPIAdminUsers(t *testing.T) {
+	env := testutil.SetupTestEnv(t)
+	ctx := context.Background()
+	cookies := loginAsAdmin(t, env)
+	admin, _ := env.Server.Auth.GetUserByEmail(ctx, "admin@example.com")
+
+	w := apiRequest(t, env, "POST", "/-/api/v1/admin/users", `{"name":"Temp","email":"temp@example.com","password":"temppassword1"}`, cookies)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create status = %d, want %d\nbody: %s", w.Code, http.StatusCreated, w.Body.String())
+	}
+	id := int64(parseAPIResponse(t, w)["data"].(map[string]interface{})["id"].(float64))
+	path := fmt.Sprintf("/-/api/v1/admin/users/%d", id)
+
+	w = apiGet(t, env, "/-/api/v1/admin/users", cookies)
+	if w.Code != http.StatusOK {
+		t.Fatalf("list status = %d, want %d", w.Code, http.StatusOK)
+	}
+	var emails []string
+	for _, u := range parseAPIResponse(t, w)["data"].([]interface{}) {
+		emails = append(emails, u.(map[string]interface{})["email"].(string))
+	}
+	if !slices.Contains(emails, "temp@example.com") || !slices.Contains(emails, "admin@example.com") {
+		t.Errorf("listed users = %v", emails)
+	}
+
+	// Omitted fields are kept.
+	w = apiRequest(t, env, "PUT", path, `{"allow_write":false,"is_admin":true}`, cookies)
+	if w.Code != http.StatusOK {
+		t.Fatalf("update status = %d, want %d\nbody: %s", w.Code, http.StatusOK, w.Body.String())
+	}
+	data := parseAPIResponse(t, apiGet(t, env, path, cookies))["data"].(map[string]interface{})
+	if data["name"] != "Temp" || data["allow_write"] != false || data["is_admin"] != true || data["allow_read"] != true || data["has_password"] != true {
+		t.Errorf("updated user = %v", data)
+	}
+
+	// Withdrawing approval logs the user out.
+	loginAsUser(t, env, "roaming@example.com")
+	roaming, _ := env.Server.Auth.GetUserByEmail(ctx, "roaming@example.com")
+	if w := apiRequest(t, env, "PUT", fmt.Sprintf("/-/api/v1/admin/users/%d", roaming.ID), `{"is_approved":false}`, cookies); w.Code != http.StatusOK {
+		t.Fatalf("unapprove status = %d, want %d", w.Code, http.StatusOK)
+	}
+	if sessions, err := env.Server.Users.ListUserSessions(ctx, roaming.ID); err != nil || len(sessions) != 0 {
+		t.Errorf("sessions after unapproval = %d (%v), want 0", len(sessions), err)
+	}
+
+	if w := apiRequest(t, env, "DELETE", fmt.Sprintf("/-/api/v1/admin/users/%d", admin.ID), "", cookies); w.Code != http.StatusBadRequest {
+		t.Errorf("delete self: status = %d, want %d", w.Code, http.StatusBadRequest)
+	}
+	if w := apiRequest(t, env, "DELETE", path, "", cookies); w.Code != http.StatusOK {
+		t.Errorf("delete status = %d, want %d", w.Code, http.StatusOK)
+	}
+	for _, method := range []string{"GET", "PUT", "DELETE"} {
+		if w := apiRequest(t, env, method, path, `{}`, cookies); w.Code != http.StatusNotFound {
+			t.Errorf("%s deleted user: status = %d, want %d", method, w.Code, http.StatusNotFound)
+		}
+	}
+	if w := apiGet(t, env, "/-/api/v1/admin/users/abc", cookies); w.Code != http.StatusBadRequest {
+		t.Errorf("invalid ID: status = %d, want %d", w.Code, http.StatusBadRequest)
+	}
+}
+
+func TestAPIAdminUsers_Unauthorized(t *testing.T) {
+	env := testutil.SetupTestEnv(t)
+
+	w := apiGet(t, env, "/-/api/v1/admin/users", nil)
+	if w.Code != http.StatusUnauthorized || !strings.Contains(w.Body.String(), `"error"`) {
+		t.Errorf("anonymous: status = %d, body = %s; want a JSON 401", w.Code, w.Body.String())
+	}
+	cookies := loginAsUser(t, env, "regular@example.com")
+	w = apiRequest(t, env, "DELETE", "/-/api/v1/admin/users/1", "", cookies)
+	if w.Code != http.StatusForbidden || !strings.Contains(w.Body.String(), `"error"`) {
+		t.Errorf("non-admin: status = %d, body = %s; want a JSON 403", w.Code, w.Body.String())
+	}
+}
+
+func TestSessions_ListAndRevoke(t *testing.T) {
+	env := testutil.SetupTestEnv(t)
+	ctx := context.Background()
+	cookies := loginAsUser(t, env, "roaming@example.com")
+	user, _ := env.Server.Auth.GetUserByEmail(ctx, "roaming@example.com")
+
+	// A second login from another browser
+	form := url.Values{"email": {"roaming@example.com"}, "password": {"userpassword123"}}
+	req := httptest.NewRequest("POST", "/-/login", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("User-Agent", "Mozilla/5.0 (X11; Linux x86_64; rv:130.0) Gecko/20100101 Firefox/130.0")
+	w := httptest.NewRecorder()
+	env.Router.ServeHTTP(w, req)
+	otherCookies := w.Result().Cookies()
+
+	req = requestWithCookies("GET", "/-/settings/sessions", nil, cookies)
+	w = httptest.NewRecorder()
+	env.Router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusOK)
+	}
+	body := w.Body.String()
+	if !strings.Contains(body, "Firefox on Linux") || !strings.Contains(body, "This session") {
+		t.Errorf("sessions page should list the other browser and mark this session")
+	}
+
+	sessions, err := env.DB.ListUserSessions(ctx, user.ID)
+	if err != nil || len(sessions) != 2 {
+		t.Fatalf("sessions = %+v, %v; want 2", sessions, err)
+	}
+	var other int64
+	for _, sess := range sessions {
+		if strings.Contains(sess.UserAgent, "Firefox") {
+			other = sess.ID
+		}
+	}
+
+	req = requestWithCookies("POST", fmt.Sprintf("/-/settings/sessions/%d/revoke", other), strings.NewReader(""), cookies)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w = httptest.NewRecorder()
+	env.Router.ServeHTTP(w, req)
+	if w.Code != http.StatusFound {
+		t.Fatalf("revoke status = %d, want %d", w.Code, http.StatusFound)
+	}
+
+	// The revoked browser is logged out; this one is not
+	req = requestWithCookies("GET", "/-/settings", nil, otherCookies)
+	w = httptest.NewRecorder()
+	env.Router.ServeHTTP(w, req)
+	if w.Code != http.StatusFound || !strings.HasPrefix(w.Header().Get("Location"), "/-/login") {
+		t.Errorf("revoked session: status = %d, location %q; want a redirect to login", w.Code, w.Header().Get("Location"))
+	}
+	req = requestWithCookies("GET", "/-/settings", nil, cookies)
+	w = httptest.NewRecorder()
+	env.Router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Errorf("current session: status = %d, want %d", w.Code, http.StatusOK)
+	}
+}
+
+func TestAdminUserLogout(t *testing.T) {
+	env := testutil.SetupTestEnv(t)
+	ctx := context.Background()
+	userCookies := loginAsUser(t, env, "disable-me@example.com")
+	adminCookies := loginAsAdmin(t, env)
+	user, _ := env.Server.Auth.GetUserByEmail(ctx, "disable-me@example.com")
+
+	req := requestWithCookies("POST", fmt.Sprintf("/-/admin/users/%d/logout", user.ID), strings.NewReader(""), adminCookies)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	env.Router.ServeHTTP(w, req)
+	if w.Code != http.StatusFound {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusFound)
+	}
+
+	req = requestWithCookies("GET", "/-/settings", nil, userCookies)
+	w = httptest.NewRecorder()
+	env.Router.ServeHTTP(w, req)
+	if w.Code != http.StatusFound {
+		t.Errorf("logged-out user: status = %d, want a redirect to login", w.Code)
+	}
+}
+
+func TestAdminUserSave_UnapproveLogsOut(t *testing.T) {
+	env := testutil.SetupTestEnv(t)
+	ctx := context.Background()
+	loginAsUser(t, env, "demoted@example.com")
+	adminCookies := loginAsAdmin(t, env)
+	user, _ := env.Server.Auth.GetUserByEmail(ctx, "demoted@example.com")
+
+	form := url.Values{"name": {"Demoted"}, "allow_read": {"on"}}
+	req := requestWithCookies("POST", fmt.Sprintf("/-/admin/users/%d", user.ID), strings.NewReader(form.Encode()), adminCookies)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	env.Router.ServeHTTP(w, req)
+	if w.Code != http.StatusFound {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusFound)
+	}
+
+	sessions, _ := env.DB.ListUserSessions(ctx, user.ID)
+	if len(sessions) != 0 {
+		t.Errorf("sessions after withdrawing approval = %d, want 0", len(sessions))
+	}
+}
+
+func TestChangelog_Filters(t *testing.T) {
+	env := testutil.SetupTestEnv(t)
+
+	env.Store.Store(context.Background(), "docs/guide.md", "# Guide", "guide commit", storage.Author{Name: "Alice", Email: "alice@example.com"})
+	env.Store.Store(context.Background(), "notes.md", "# Notes", "notes commit", storage.Author{Name: "Bob", Email: "bob@example.com"})
+
+	req := httptest.NewRequest("GET", "/-/changelog?author=alice", nil)
+	w := httptest.NewRecorder()
+	env.Router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusOK)
+	}
+	body := w.Body.String()
+	if !strings.Contains(body, "guide commit") || strings.Contains(body, "notes commit") {
+		t.Error("author filter should only show alice's commit")
+	}
+
+	req = httptest.NewRequest("GET", "/-/changelog?path=docs", nil)
+	w = httptest.NewRecorder()
+	env.Router.ServeHTTP(w, req)
+	body = w.Body.String()
+	if !strings.Contains(body, "guide commit") || strings.Contains(body, "notes commit") {
+		t.Error("path filter should only show commits under docs")
+	}
+
+	env.Store.Store(context.Background(), "docsearch.md", "# Docsearch", "docsearch commit", storage.Author{Name: "Bob", Email: "bob@example.com"})
+	req = httptest.NewRequest("GET", "/-/changelog?path=docs/", nil)
+	w = httptest.NewRecorder()
+	env.Router.ServeHTTP(w, req)
+	body = w.Body.String()
+	if !strings.Contains(body, "guide commit") || strings.Contains(body, "docsearch commit") {
+		t.Error("path filter with a trailing slash should keep to the docs directory")
+	}
+
+	req = httptest.NewRequest("GET", "/-/changelog?since=not-a-date", nil)
+	w = httptest.NewRecorder()
+	env.Router.ServeHTTP(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("invalid date status = %d, want %d", w.Code, http.StatusBadRequest)
+	}
+}
+
+func TestAPIChangelog_Pagination(t *testing.T) {
+	env := testutil.SetupTestEnv(t)
+
+	author := storage.Author{Name: "test", Email: "test@test.com"}
+	for i := 0; i < 3; i++ {
+		env.Store.Store(context.Background(), fmt.Sprintf("p%d.md", i), "x", fmt.Sprintf("commit %d", i), author)
+	}
+
+	w := apiGet(t, env, "/-/api/v1/changelog?limit=1&offset=1", nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusOK)
+	}
+	data := parseAPIResponse(t, w)["data"].([]interface{})
+	if len(data) != 1 {
+		t.Fatalf("got %d entries, want 1", len(data))
+	}
+	if msg := data[0].(map[string]interface{})["message"]; msg != "commit 1" {
+		t.Errorf("message = %v, want 'commit 1'", msg)
+	}
+
+	w = apiGet(t, env, "/-/api/v1/changelog?limit=abc", nil)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("invalid limit status = %d, want %d", w.Code, http.StatusBadRequest)
+	}
+}
+
+func TestUserActivity(t *testing.T) {
+	env := testutil.SetupTestEnv(t)
+
+	env.Store.Store(context.Background(), "act.md", "# Act", "activity commit", storage.Author{Name: "Carol", Email: "carol@example.com"})
+	now := sql.NullTime{Time: time.Now(), Valid: true}
+	issue, err := env.DB.Queries.CreateIssue(context.Background(), db.CreateIssueParams{
+		Title:          "Carol's issue",
+		Status:         "open",
+		CreatedByName:  db.NullString("Carol"),
+		CreatedByEmail: db.NullString("carol@example.com"),
+		CreatedAt:      now,
+		UpdatedAt:      now,
+	})
+	if err != nil {
+		t.Fatalf("CreateIssue failed: %v", err)
+	}
+	createTestComment(t, env, issue.ID, "a comment", "Carol", "carol@example.com")
+
+	req := httptest.NewRequest("GET", "/-/user/carol@example.com/activity", nil)
+	w := httptest.NewRecorder()
+	env.Router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusOK)
+	}
+	body := w.Body.String()
+	if !strings.Contains(body, "activity commit") || !strings.Contains(body, "Carol&#39;s issue") {
+		t.Error("activity page should list the user's commits and issues")
+	}
+
+	w = apiGet(t, env, "/-/api/v1/users/carol@example.com/activity", nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("API status = %d, want %d", w.Code, http.StatusOK)
+	}
+	data := parseAPIResponse(t, w)["data"].(map[string]interface{})
+	for _, key := range []string{"commits", "issues", "comments"} {
+		if items, ok := data[key].([]interface{}); !ok || len(items) != 1 {
+			t.Errorf("%s = %v, want one entry", key, data[key])
+		}
+	}
+}
+
+func TestPasswordChangeEndsOtherSessions(t *testing.T) {
+	env := testutil.SetupTestEnv(t)
+	ctx := context.Background()
+	admin := loginAsAdmin(t, env)
+	cookies := loginAsUser(t, env, "roaming@example.com")
+	user, _ := env.Server.Auth.GetUserByEmail(ctx, "roaming@example.com")
+	password := "userpassword123"
+	login := func() []*http.Cookie {
+		t.Helper()
+		form := url.Values{"email": {"roaming@example.com"}, "password": {password}}
+		req := httptest.NewRequest("POST", "/-/login", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		env.Router.ServeHTTP(w, req)
+		if w.Code != http.StatusFound {
+			t.Fatalf("login: status = %d", w.Code)
+		}
+		return w.Result().Cookies()
+	}
+	post := func(path string, form url.Values, cookies []*http.Cookie) *httptest.ResponseRecorder {
+		req := requestWithCookies("POST", path, strings.NewReader(form.Encode()), cookies)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		env.Router.ServeHTTP(w, req)
+		return w
+	}
+	sessions := func() int {
+		t.Helper()
+		list, err := env.DB.ListUserSessions(ctx, user.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return len(list)
+	}
+
+	// Changing one's own password keeps the session it was changed in.
+	other := login()
+	w := post("/-/settings", url.Values{"action": {"change_password"}, "current_password": {password},
+		"new_password": {"changedpassword1"}, "confirm_password": {"changedpassword1"}}, cookies)
+	if w.Code != http.StatusFound {
+		t.Fatalf("change password: status = %d", w.Code)
+	}
+	password = "changedpassword1"
+	if n := sessions(); n != 1 {
+		t.Errorf("sessions after changing the password = %d, want 1", n)
+	}
+	for _, tc := range []struct {
+		cookies []*http.Cookie
+		status  int
+	}{{cookies, http.StatusOK}, {other, http.StatusFound}} {
+		w := httptest.NewRecorder()
+		env.Router.ServeHTTP(w, requestWithCookies("GET", "/-/settings", nil, tc.cookies))
+		if w.Code != tc.status {
+			t.Errorf("settings after changing the password: status = %d, want %d", w.Code, tc.status)
+		}
+	}
+
+	// A password set by an admin or through a reset link ends them all.
+	login()
+	path := fmt.Sprintf("/-/admin/users/%d/password", user.ID)
+	if w := post(path, url.Values{"password": {"adminpassword12"}, "password2": {"adminpassword12"}}, admin); w.Code != http.StatusFound {
+		t.Fatalf("admin password: status = %d", w.Code)
+	}
+	password = "adminpassword12"
+	if n := sessions(); n != 0 {
+		t.Errorf("sessions after an admin set the password = %d, want 0", n)
+	}
+
+	login()
+	w = apiRequest(t, env, "PUT", fmt.Sprintf("/-/api/v1/users/%d/password", user.ID), `{"password": "apipassword123"}`, admin)
+	if w.Code != http.StatusOK {
+		t.Fatalf("API password: status = %d: %s", w.Code, w.Body.String())
+	}
+	password = "apipassword123"
+	if n := sessions(); n != 0 {
+		t.Errorf("sessions after the API set the password = %d, want 0", n)
+	}
+
+	login()
+	w = apiRequest(t, env, "POST", fmt.Sprintf("/-/api/v1/users/%d/password-reset", user.ID), "", admin)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("reset link: status = %d: %s", w.Code, w.Body.String())
+	}
+	token := resetToken(t, parseAPIResponse(t, w)["data"].(map[string]interface{})["url"].(string))
+	if w := post("/-/reset-password", url.Values{"token": {token}, "password": {"resetpassword1"}, "password2": {"resetpassword1"}}, nil); w.Code != http.StatusFound {
+		t.Fatalf("reset password: status = %d", w.Code)
+	}
+	if n := sessions(); n != 0 {
+		t.Errorf("sessions after a password reset = %d, want 0", n)
+	}
+}
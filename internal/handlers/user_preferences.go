@@ -0,0 +1,199 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/sa/gopherwiki/internal/db"
+	"github.com/sa/gopherwiki/internal/middleware"
+)
+
+// Editor font sizes a user may choose, in pixels.
+const (
+	minEditorFontSize = 10
+	maxEditorFontSize = 32
+)
+
+// listPageSizes are the entries per page a user may choose for the
+// paginated lists.
+var listPageSizes = []int{10, 25, 50, 100, 200}
+
+// errInvalidPreference marks a preference value that cannot be stored.
+var errInvalidPreference = errors.New("invalid preference")
+
+// userPreferences are the interface preferences of a user, as the
+// templates see them. Zero values keep the defaults.
+type userPreferences struct {
+	ColorScheme    string // "light" or "dark"; "" follows the browser
+	EditorFontSize int    // Editor font size in pixels
+	LandingPage    string // Page or /-/ route the wiki's root leads to, instead of the site's home page
+	PageSize       int    // Entries per page of the changelog and page histories
+}
+
+// parseUserPreferences reads the stored preferences of a user, skipping
+// values that are no longer valid.
+func parseUserPreferences(values map[string]string) userPreferences {
+	var p userPreferences
+	if v, err := validateUserPreference(db.UserPrefColorScheme, values[db.UserPrefColorScheme]); err == nil {
+		p.ColorScheme = v
+	}
+	if v, err := validateUserPreference(db.UserPrefEditorFontSize, values[db.UserPrefEditorFontSize]); err == nil {
+		p.EditorFontSize, _ = strconv.Atoi(v)
+	}
+	if v, err := validateUserPreference(db.UserPrefLandingPage, values[db.UserPrefLandingPage]); err == nil {
+		p.LandingPage = v
+	}
+	if v, err := validateUserPreference(db.UserPrefPageSize, values[db.UserPrefPageSize]); err == nil {
+		p.PageSize, _ = strconv.Atoi(v)
+	}
+	return p
+}
+
+// validateUserPreference checks a value of the named interface preference
+// and returns it as it is stored, "" to unset it.
+func validateUserPreference(name, value string) (string, error) {
+	value = strings.TrimSpace(value)
+	switch name {
+	case db.UserPrefColorScheme:
+		switch value {
+		case "system":
+			return "", nil
+		case "", "light", "dark":
+			return value, nil
+		}
+		return "", fmt.Errorf("color scheme must be light, dark, or system, got %q", value)
+	case db.UserPrefEditorFontSize:
+		if value == "" || value == "0" {
+			return "", nil
+		}
+		if n, err := strconv.Atoi(value); err != nil || n < minEditorFontSize || n > maxEditorFontSize {
+			return "", fmt.Errorf("editor font size must be %d to %d pixels, got %q", minEditorFontSize, maxEditorFontSize, value)
+		}
+		return value, nil
+	case db.UserPrefLandingPage:
+		if strings.HasPrefix(value, "/-/") {
+			if strings.ContainsAny(value, "\\") {
+				return "", fmt.Errorf("landing page must be a page name or a /-/ route, got %q", value)
+			}
+			return value, nil
+		}
+		if strings.HasPrefix(value, "//") || strings.Contains(value, "://") {
+			return "", fmt.Errorf("landing page must be a page name or a /-/ route, got %q", value)
+		}
+		return strings.Trim(value, "/"), nil
+	case db.UserPrefPageSize:
+		if value == "" || value == "0" {
+			return "", nil
+		}
+		if n, err := strconv.Atoi(value); err != nil || !slices.Contains(listPageSizes, n) {
+			return "", fmt.Errorf("results per page must be one of %v, got %q", listPageSizes, value)
+		}
+		return value, nil
+	}
+	return "", fmt.Errorf("unknown preference %q", name)
+}
+
+// userPreferences returns the interface preferences of the user of r; an
+// anonymous user has the defaults.
+func (s *Server) userPreferences(r *http.Request) userPreferences {
+	user := middleware.GetUser(r)
+	if !user.IsAuthenticated() {
+		return userPreferences{}
+	}
+	values, err := s.Users.ListUserPreferences(r.Context(), user.ID)
+	if err != nil {
+		slog.Warn("failed to load preferences", "user", user.GetEmail(), "error", err)
+	}
+	return parseUserPreferences(values)
+}
+
+// setUserPreferences stores interface preferences of the user of r, by
+// name. Nothing is stored unless every value is valid; an invalid one
+// fails with an error wrapping errInvalidPreference.
+func (s *Server) setUserPreferences(r *http.Request, values map[string]string) error {
+	valid := make(map[string]string, len(values))
+	for name, value := range values {
+		v, err := validateUserPreference(name, value)
+		if err != nil {
+			return fmt.Errorf("%w: %w", errInvalidPreference, err)
+		}
+		valid[name] = v
+	}
+	userID := middleware.GetUser(r).ID
+	for name, value := range valid {
+		if err := s.Users.SetUserPreference(r.Context(), userID, name, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// listPageSize returns the entries per page of a paginated list for the
+// user of r: their PageSize preference, else def.
+func (s *Server) listPageSize(r *http.Request, def int) int {
+	if size := s.userPreferences(r).PageSize; size > 0 {
+		return size
+	}
+	return def
+}
+
+// preferencesToAPI converts interface preferences to their JSON form.
+func preferencesToAPI(p userPreferences) APIUserPreferences {
+	return APIUserPreferences{
+		ColorScheme:    p.ColorScheme,
+		EditorFontSize: p.EditorFontSize,
+		LandingPage:    p.LandingPage,
+		PageSize:       p.PageSize,
+	}
+}
+
+// handleAPIPreferences handles GET /api/v1/user/preferences -- the
+// interface preferences of the logged-in user.
+func (s *Server) handleAPIPreferences(w http.ResponseWriter, r *http.Request) {
+	if !middleware.GetUser(r).IsAuthenticated() {
+		writeJSONError(w, http.StatusUnauthorized, "not logged in")
+		return
+	}
+	writeJSON(w, http.StatusOK, preferencesToAPI(s.userPreferences(r)))
+}
+
+// handleAPIPreferencesUpdate handles PUT /api/v1/user/preferences -- change
+// the interface preferences of the logged-in user. Fields left out are
+// kept; an empty or zero one is reset to the default.
+func (s *Server) handleAPIPreferencesUpdate(w http.ResponseWriter, r *http.Request) {
+	if !middleware.GetUser(r).IsAuthenticated() {
+		writeJSONError(w, http.StatusUnauthorized, "not logged in")
+		return
+	}
+	var input APIUserPreferencesInput
+	if err := decodeJSON(r, &input); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "invalid JSON body")
+		return
+	}
+	values := make(map[string]string)
+	if input.ColorScheme != nil {
+		values[db.UserPrefColorScheme] = *input.ColorScheme
+	}
+	if input.EditorFontSize != nil {
+		values[db.UserPrefEditorFontSize] = strconv.Itoa(*input.EditorFontSize)
+	}
+	if input.LandingPage != nil {
+		values[db.UserPrefLandingPage] = *input.LandingPage
+	}
+	if input.PageSize != nil {
+		values[db.UserPrefPageSize] = strconv.Itoa(*input.PageSize)
+	}
+	if err := s.setUserPreferences(r, values); errors.Is(err, errInvalidPreference) {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	} else if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, "failed to save preferences")
+		return
+	}
+	writeJSON(w, http.StatusOK, preferencesToAPI(s.userPreferences(r)))
+}
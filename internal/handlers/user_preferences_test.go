@@ -0,0 +1,81 @@
+package handlers_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/sa/gopherwiki/internal/handlers"
+	"github.com/sa/gopherwiki/internal/storage"
+	"github.com/sa/gopherwiki/internal/testutil"
+)
+
+func TestUserPreferences(t *testing.T) {
+	env := testutil.SetupTestEnv(t)
+	ctx := context.Background()
+	cookies := loginAsUser(t, env, "bob@example.com")
+	for i := 1; i <= 12; i++ {
+		if _, err := env.Store.Store(ctx, "notes.md", fmt.Sprintf("# Notes\n\nVersion %d\n", i), fmt.Sprintf("Edit %d", i), storage.Author{Name: "Bob"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	get := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		env.Router.ServeHTTP(w, requestWithCookies("GET", path, nil, cookies))
+		return w
+	}
+
+	// The settings form stores the preferences together.
+	form := url.Values{"action": {"update_preferences"}, "color_scheme": {"dark"}, "editor_font_size": {"18"}, "landing_page": {"/Notes"}, "page_size": {"10"}}
+	req := requestWithCookies("POST", "/-/settings", strings.NewReader(form.Encode()), cookies)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	env.Router.ServeHTTP(httptest.NewRecorder(), req)
+
+	if w := get("/"); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "Version 12") {
+		t.Errorf("front page: status = %d, want the landing page", w.Code)
+	}
+	if body := get("/-/changelog").Body.String(); strings.Count(body, `href="/-/commit/`) != 10 || !strings.Contains(body, "page=2") {
+		t.Errorf("changelog does not list 10 commits a page")
+	}
+	if body := get("/Notes/history").Body.String(); !strings.Contains(body, "page=2") {
+		t.Errorf("history does not list 10 commits a page")
+	}
+	if body := get("/Notes/edit").Body.String(); !strings.Contains(body, "font-size: 18px") {
+		t.Errorf("editor ignores the font size")
+	}
+	if body := get("/-/settings").Body.String(); !strings.Contains(body, `value="Notes"`) || !strings.Contains(body, `<option value="10" selected>`) {
+		t.Errorf("settings do not show the preferences")
+	}
+
+	// The API reads and changes them.
+	w := apiRequest(t, env, "GET", "/-/api/v1/user/preferences", "", cookies)
+	var resp struct {
+		Data handlers.APIUserPreferences `json:"data"`
+	}
+	want := handlers.APIUserPreferences{ColorScheme: "dark", EditorFontSize: 18, LandingPage: "Notes", PageSize: 10}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || resp.Data != want {
+		t.Errorf("GET preferences = %+v, %v; want %+v", resp.Data, err, want)
+	}
+	w = apiRequest(t, env, "PUT", "/-/api/v1/user/preferences", `{"landing_page": "/-/changelog", "page_size": 0}`, cookies)
+	want = handlers.APIUserPreferences{ColorScheme: "dark", EditorFontSize: 18, LandingPage: "/-/changelog"}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || resp.Data != want {
+		t.Errorf("PUT preferences = %+v, %v; want %+v", resp.Data, err, want)
+	}
+	if w := get("/"); w.Code != http.StatusFound || w.Header().Get("Location") != "/-/changelog" {
+		t.Errorf("front page: status = %d, Location = %q", w.Code, w.Header().Get("Location"))
+	}
+
+	for _, body := range []string{`{"editor_font_size": 100}`, `{"page_size": 7}`, `{"color_scheme": "blue"}`, `{"landing_page": "https://example.com/"}`} {
+		if w := apiRequest(t, env, "PUT", "/-/api/v1/user/preferences", body, cookies); w.Code != http.StatusBadRequest {
+			t.Errorf("PUT %s: status = %d, want %d", body, w.Code, http.StatusBadRequest)
+		}
+	}
+	if w := apiRequest(t, env, "GET", "/-/api/v1/user/preferences", "", nil); w.Code != http.StatusUnauthorized {
+		t.Errorf("anonymous GET: status = %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+}
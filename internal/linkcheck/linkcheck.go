@@ -0,0 +1,307 @@
+// Package linkcheck checks that links to other sites still lead somewhere.
+// A Checker fetches each URL as a well-behaved crawler would: it keeps to
+// what the site's robots.txt allows, waits between requests to the same
+// host, and stops asking a host that answers 429 Too Many Requests.
+package linkcheck
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const (
+	// DefaultHostDelay is the least time between two requests to a host.
+	DefaultHostDelay = time.Second
+	// maxCrawlDelay caps the Crawl-delay of a robots.txt.
+	maxCrawlDelay = time.Minute
+	// requestTimeout is how long a URL is given to answer.
+	requestTimeout = 15 * time.Second
+	// maxRobotsSize is the most of a robots.txt that is read.
+	maxRobotsSize = 512 << 10
+)
+
+// ErrPrivateAddress is the error of a URL whose host is on a loopback,
+// private, or link-local address, which the checker does not request.
+var ErrPrivateAddress = errors.New("private address")
+
+// Result is the outcome of checking a URL.
+type Result struct {
+	Status  int    // HTTP status of the final response; 0 when there was none
+	Error   string // Why there was no response
+	Blocked bool   // The site's robots.txt disallows the URL, so it was not requested
+	Limited bool   // The host asked for fewer requests, so the URL was not requested
+}
+
+// Broken reports whether the URL of r leads nowhere: it could not be
+// fetched, or the site answered an error other than 429.
+func (r Result) Broken() bool {
+	if r.Blocked || r.Limited {
+		return false
+	}
+	return r.Error != "" || (r.Status >= 400 && r.Status != http.StatusTooManyRequests)
+}
+
+// Checker checks URLs, remembering the robots.txt of each host and when it
+// last requested it. It is not safe for concurrent use.
+type Checker struct {
+	client    *http.Client
+	userAgent string
+	hostDelay time.Duration
+
+	hosts map[string]*host
+}
+
+// host is what a Checker knows of a host.
+type host struct {
+	robots  *robots
+	last    time.Time // Time of the last request
+	limited bool      // The host answered 429
+}
+
+// New returns a Checker identifying itself as userAgent. Its requests
+// refuse to connect to loopback, private, and link-local addresses, so
+// that links cannot probe the network the wiki runs in.
+func New(userAgent string) *Checker {
+	dialer := &net.Dialer{Timeout: requestTimeout, Control: refusePrivate}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = dialer.DialContext
+	transport.Proxy = nil
+	return NewWithClient(&http.Client{Transport: transport, Timeout: requestTimeout}, userAgent, DefaultHostDelay)
+}
+
+// NewWithClient returns a Checker making its requests with client, waiting
+// at least hostDelay between two requests to a host.
+func NewWithClient(client *http.Client, userAgent string, hostDelay time.Duration) *Checker {
+	return &Checker{client: client, userAgent: userAgent, hostDelay: hostDelay, hosts: make(map[string]*host)}
+}
+
+// refusePrivate is a net.Dialer Control refusing connections to the
+// addresses of the local network.
+func refusePrivate(network, address string, c syscall.RawConn) error {
+	h, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(h)
+	if ip == nil || ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() ||
+		ip.IsLinkLocalMulticast() || ip.IsUnspecified() || ip.IsMulticast() {
+		return fmt.Errorf("%w: %s", ErrPrivateAddress, h)
+	}
+	return nil
+}
+
+// Check fetches rawURL, with a HEAD request, or a GET when the site does
+// not answer HEAD, and reports how it answered.
+func (c *Checker) Check(ctx context.Context, rawURL string) Result {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return Result{Error: "not an http or https URL"}
+	}
+	h := c.host(ctx, u)
+	if h.limited {
+		return Result{Limited: true}
+	}
+	if !h.robots.allowed(u) {
+		return Result{Blocked: true}
+	}
+
+	resp, err := c.request(ctx, h, http.MethodHead, u.String(), nil)
+	if err == nil && (resp.StatusCode == http.StatusMethodNotAllowed || resp.StatusCode == http.StatusNotImplemented) {
+		resp, err = c.request(ctx, h, http.MethodGet, u.String(), nil)
+	}
+	if err != nil {
+		return Result{Error: describeError(err)}
+	}
+	if resp.StatusCode == http.StatusTooManyRequests {
+		h.limited = true
+	}
+	return Result{Status: resp.StatusCode}
+}
+
+// host returns what is known of the host of u, fetching its robots.txt on
+// first sight.
+func (c *Checker) host(ctx context.Context, u *url.URL) *host {
+	key := u.Scheme + "://" + u.Host
+	if h, ok := c.hosts[key]; ok {
+		return h
+	}
+	h := &host{robots: &robots{}}
+	c.hosts[key] = h
+	resp, err := c.request(ctx, h, http.MethodGet, key+"/robots.txt", func(body io.Reader) {
+		h.robots = parseRobots(io.LimitReader(body, maxRobotsSize), c.userAgent)
+	})
+	// A site without a robots.txt allows everything; one whose robots.txt
+	// fails to load is tried anyway, and its links fail if it is down.
+	if err == nil && resp.StatusCode != http.StatusOK {
+		h.robots = &robots{}
+	}
+	return h
+}
+
+// request makes a request to h, after waiting out its delay, passing the
+// body of a 200 response to read unless it is nil.
+func (c *Checker) request(ctx context.Context, h *host, method, target string, read func(io.Reader)) (*http.Response, error) {
+	delay := c.hostDelay
+	if h.robots.crawlDelay > delay {
+		delay = h.robots.crawlDelay
+	}
+	if wait := time.Until(h.last.Add(delay)); wait > 0 {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(wait):
+		}
+	}
+	defer func() { h.last = time.Now() }()
+
+	req, err := http.NewRequestWithContext(ctx, method, target, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", c.userAgent)
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if read != nil && resp.StatusCode == http.StatusOK {
+		read(resp.Body)
+	}
+	return resp, nil
+}
+
+// describeError returns a short description of why a request failed.
+func describeError(err error) string {
+	var dnsErr *net.DNSError
+	switch {
+	case errors.Is(err, ErrPrivateAddress):
+		return "private address"
+	case errors.As(err, &dnsErr):
+		return "host not found"
+	case errors.Is(err, context.DeadlineExceeded) || isTimeout(err):
+		return "timed out"
+	}
+	return err.Error()
+}
+
+// isTimeout reports whether err is a network timeout.
+func isTimeout(err error) bool {
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// robots is the group of a robots.txt that applies to the checker.
+type robots struct {
+	rules      []robotsRule
+	crawlDelay time.Duration
+}
+
+// robotsRule is an Allow or Disallow line.
+type robotsRule struct {
+	allow   bool
+	pattern *regexp.Regexp
+	length  int // Length of the path pattern; the longest match wins
+}
+
+// allowed reports whether the rules let u be fetched. The longest
+// matching rule decides, Allow winning a tie, as RFC 9309 has it.
+func (r *robots) allowed(u *url.URL) bool {
+	target := u.EscapedPath()
+	if target == "" {
+		target = "/"
+	}
+	if u.RawQuery != "" {
+		target += "?" + u.RawQuery
+	}
+	allow, longest := true, -1
+	for _, rule := range r.rules {
+		if !rule.pattern.MatchString(target) {
+			continue
+		}
+		if rule.length > longest || (rule.length == longest && rule.allow) {
+			allow, longest = rule.allow, rule.length
+		}
+	}
+	return allow
+}
+
+// parseRobots reads the group of a robots.txt for the product token of
+// userAgent, or the * group when there is none for it.
+func parseRobots(body io.Reader, userAgent string) *robots {
+	token := strings.ToLower(userAgent)
+	if i := strings.IndexAny(token, "/ "); i >= 0 {
+		token = token[:i]
+	}
+
+	groups := make(map[string]*robots)
+	var current []*robots // The groups the lines being read belong to
+	inAgents := false
+	scanner := bufio.NewScanner(body)
+	for scanner.Scan() {
+		line, _, _ := strings.Cut(scanner.Text(), "#")
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		key, value = strings.ToLower(strings.TrimSpace(key)), strings.TrimSpace(value)
+		switch key {
+		case "user-agent":
+			if !inAgents {
+				current = nil
+			}
+			inAgents = true
+			agent := strings.ToLower(value)
+			if groups[agent] == nil {
+				groups[agent] = &robots{}
+			}
+			current = append(current, groups[agent])
+			continue
+		case "allow", "disallow":
+			if value == "" {
+				break // An empty Disallow allows everything
+			}
+			rule := robotsRule{allow: key == "allow", pattern: robotsPattern(value), length: len(value)}
+			for _, g := range current {
+				g.rules = append(g.rules, rule)
+			}
+		case "crawl-delay":
+			if secs, err := strconv.ParseFloat(value, 64); err == nil && secs > 0 {
+				delay := min(time.Duration(secs*float64(time.Second)), maxCrawlDelay)
+				for _, g := range current {
+					g.crawlDelay = delay
+				}
+			}
+		}
+		inAgents = false
+	}
+	if g := groups[token]; g != nil {
+		return g
+	}
+	if g := groups["*"]; g != nil {
+		return g
+	}
+	return &robots{}
+}
+
+// robotsPattern compiles the path pattern of an Allow or Disallow line, in
+// which * matches any characters and a final $ the end of the path.
+func robotsPattern(p string) *regexp.Regexp {
+	end := strings.HasSuffix(p, "$")
+	p = strings.TrimSuffix(p, "$")
+	expr := "^" + strings.ReplaceAll(regexp.QuoteMeta(p), `\*`, ".*")
+	if end {
+		expr += "$"
+	}
+	return regexp.MustCompile(expr)
+}
@@ -0,0 +1,130 @@
+package linkcheck
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestCheck(t *testing.T) {
+	var mu sync.Mutex
+	var requests []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests = append(requests, r.Method+" "+r.URL.Path)
+		mu.Unlock()
+		if ua := r.Header.Get("User-Agent"); ua != "GopherWiki/1.0" {
+			t.Errorf("User-Agent = %q", ua)
+		}
+		switch r.URL.Path {
+		case "/robots.txt":
+			w.Write([]byte("User-agent: *\nDisallow: /private\nAllow: /private/ok\n"))
+		case "/ok", "/private/ok":
+		case "/no-head":
+			if r.Method == http.MethodHead {
+				w.WriteHeader(http.StatusMethodNotAllowed)
+			}
+		case "/slow-down":
+			w.WriteHeader(http.StatusTooManyRequests)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	c := NewWithClient(srv.Client(), "GopherWiki/1.0", 0)
+	ctx := context.Background()
+	for _, tc := range []struct {
+		path string
+		want Result
+	}{
+		{"/ok", Result{Status: 200}},
+		{"/gone", Result{Status: 404}},
+		{"/no-head", Result{Status: 200}},
+		{"/private/page", Result{Blocked: true}},
+		{"/private/ok", Result{Status: 200}},
+		{"/slow-down", Result{Status: 429}},
+		{"/ok", Result{Limited: true}}, // The host asked for fewer requests
+	} {
+		if got := c.Check(ctx, srv.URL+tc.path); got != tc.want {
+			t.Errorf("Check(%s) = %+v, want %+v", tc.path, got, tc.want)
+		}
+	}
+	want := []string{"GET /robots.txt", "HEAD /ok", "HEAD /gone", "HEAD /no-head", "GET /no-head", "HEAD /private/ok", "HEAD /slow-down"}
+	if strings.Join(requests, ", ") != strings.Join(want, ", ") {
+		t.Errorf("requests = %q, want %q", requests, want)
+	}
+
+	if got := c.Check(ctx, "ftp://example.com/file"); got.Error == "" || !got.Broken() {
+		t.Errorf("Check(ftp) = %+v, want broken", got)
+	}
+}
+
+func TestHostDelay(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/robots.txt" {
+			w.Write([]byte("User-agent: gopherwiki\nCrawl-delay: 0.2\n\nUser-agent: *\nDisallow: /\n"))
+		}
+	}))
+	defer srv.Close()
+
+	c := NewWithClient(srv.Client(), "GopherWiki/1.0", 0)
+	start := time.Now()
+	for _, path := range []string{"/a", "/b"} {
+		if got := c.Check(context.Background(), srv.URL+path); got.Status != 200 {
+			t.Fatalf("Check(%s) = %+v; the gopherwiki group allows everything", path, got)
+		}
+	}
+	// robots.txt, /a, and /b, each 200ms after the one before.
+	if elapsed := time.Since(start); elapsed < 400*time.Millisecond {
+		t.Errorf("three requests took %v, want at least 400ms with Crawl-delay 0.2", elapsed)
+	}
+}
+
+func TestPrivateAddresses(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+
+	got := New("GopherWiki/1.0").Check(context.Background(), srv.URL+"/")
+	if got.Error != "private address" || !got.Broken() {
+		t.Errorf("Check(loopback) = %+v, want refused as a private address", got)
+	}
+	if err := refusePrivate("tcp", "10.1.2.3:80", nil); !errors.Is(err, ErrPrivateAddress) {
+		t.Errorf("refusePrivate(10.1.2.3) = %v", err)
+	}
+	if err := refusePrivate("tcp", "93.184.216.34:443", nil); err != nil {
+		t.Errorf("refusePrivate(public) = %v", err)
+	}
+}
+
+func TestRobots(t *testing.T) {
+	r := parseRobots(strings.NewReader(`# comment
+User-agent: other
+Disallow: /
+
+User-agent: *
+Disallow: /*.pdf$
+Disallow: /search
+Allow: /search/help
+`), "GopherWiki/1.0 (+https://wiki.example.com)")
+	for path, want := range map[string]bool{
+		"/":            true,
+		"/doc.pdf":     false,
+		"/doc.pdf?x=1": true,
+		"/search?q=a":  false,
+		"/search/help": true,
+		"/searching":   false,
+		"/docs/a%20b":  true,
+	} {
+		u, _ := url.Parse("https://example.com" + path)
+		if got := r.allowed(u); got != want {
+			t.Errorf("allowed(%s) = %v, want %v", path, got, want)
+		}
+	}
+}
@@ -0,0 +1,149 @@
+// Package mail sends plain-text email through the SMTP server the MAIL_*
+// settings name.
+package mail
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"mime"
+	"net"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sa/gopherwiki/internal/config"
+)
+
+// sendTimeout bounds a delivery whose context has no deadline.
+const sendTimeout = 30 * time.Second
+
+// Mailer delivers messages to an SMTP server.
+type Mailer struct {
+	host     string
+	port     int
+	from     string
+	username string
+	password string
+	// useSSL connects over TLS from the start; useTLS upgrades a plain
+	// connection with STARTTLS.
+	useSSL bool
+	useTLS bool
+}
+
+// New returns a Mailer for the mail server cfg names. The port defaults to
+// 465 with MAIL_USE_SSL, 587 with MAIL_USE_TLS and 25 otherwise.
+func New(cfg *config.Config) *Mailer {
+	port := cfg.MailPort
+	if port == 0 {
+		switch {
+		case cfg.MailUseSSL:
+			port = 465
+		case cfg.MailUseTLS:
+			port = 587
+		default:
+			port = 25
+		}
+	}
+	return &Mailer{
+		host:     cfg.MailServer,
+		port:     port,
+		from:     cfg.MailDefaultSender,
+		username: cfg.MailUsername,
+		password: cfg.MailPassword,
+		useSSL:   cfg.MailUseSSL,
+		useTLS:   cfg.MailUseTLS,
+	}
+}
+
+// Send delivers a plain-text message to the address to.
+func (m *Mailer) Send(ctx context.Context, to, subject, body string) error {
+	msg, err := Message(m.from, to, subject, body, time.Now())
+	if err != nil {
+		return err
+	}
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, sendTimeout)
+		defer cancel()
+	}
+
+	addr := net.JoinHostPort(m.host, strconv.Itoa(m.port))
+	var conn net.Conn
+	if m.useSSL {
+		d := &tls.Dialer{Config: &tls.Config{ServerName: m.host}}
+		conn, err = d.DialContext(ctx, "tcp", addr)
+	} else {
+		var d net.Dialer
+		conn, err = d.DialContext(ctx, "tcp", addr)
+	}
+	if err != nil {
+		return fmt.Errorf("connect to mail server: %w", err)
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	c, err := smtp.NewClient(conn, m.host)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	if m.useTLS {
+		if err := c.StartTLS(&tls.Config{ServerName: m.host}); err != nil {
+			return fmt.Errorf("starttls: %w", err)
+		}
+	}
+	if m.username != "" {
+		if err := c.Auth(smtp.PlainAuth("", m.username, m.password, m.host)); err != nil {
+			return fmt.Errorf("authenticate: %w", err)
+		}
+	}
+	if err := c.Mail(m.from); err != nil {
+		return err
+	}
+	if err := c.Rcpt(to); err != nil {
+		return err
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(msg); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
+
+// Message formats a plain-text message with its headers, refusing header
+// values that would break out of their line.
+func Message(from, to, subject, body string, date time.Time) ([]byte, error) {
+	for _, v := range []string{from, to, subject} {
+		if strings.ContainsAny(v, "\r\n") {
+			return nil, errors.New("mail header contains a line break")
+		}
+	}
+
+	var b strings.Builder
+	b.WriteString("From: " + from + "\r\n")
+	b.WriteString("To: " + to + "\r\n")
+	b.WriteString("Subject: " + mime.QEncoding.Encode("utf-8", subject) + "\r\n")
+	b.WriteString("Date: " + date.Format(time.RFC1123Z) + "\r\n")
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	b.WriteString("Content-Transfer-Encoding: 8bit\r\n")
+	b.WriteString("\r\n")
+	body = strings.ReplaceAll(body, "\r\n", "\n")
+	for _, line := range strings.Split(body, "\n") {
+		// A lone dot ends the DATA section; the smtp package escapes it, so
+		// only the line endings need normalising here.
+		b.WriteString(line + "\r\n")
+	}
+	return []byte(b.String()), nil
+}
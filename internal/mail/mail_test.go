@@ -0,0 +1,127 @@
+package mail
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sa/gopherwiki/internal/config"
+)
+
+func TestMessage(t *testing.T) {
+	date := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	msg, err := Message("wiki@example.com", "alice@example.com", "Bob mentioned you in #3: Über", "Hello\nWorld", date)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := string(msg)
+	for _, want := range []string{
+		"From: wiki@example.com\r\n",
+		"To: alice@example.com\r\n",
+		"Subject: =?utf-8?q?Bob_mentioned_you_in_#3:_=C3=9Cber?=\r\n",
+		"Date: Wed, 01 May 2024 12:00:00 +0000\r\n",
+		"\r\n\r\nHello\r\nWorld\r\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("message lacks %q:\n%s", want, got)
+		}
+	}
+
+	if _, err := Message("wiki@example.com", "alice@example.com\r\nBcc: eve@example.com", "Hi", "", date); err == nil {
+		t.Error("Message accepted a header with a line break")
+	}
+}
+
+func TestSend(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	received := make(chan string, 1)
+	go serveSMTP(ln, received)
+
+	host, port, _ := net.SplitHostPort(ln.Addr().String())
+	cfg := config.Default()
+	cfg.MailServer = host
+	cfg.MailPort, _ = strconv.Atoi(port)
+	cfg.MailDefaultSender = "wiki@example.com"
+
+	if err := New(cfg).Send(context.Background(), "alice@example.com", "Hi", "Hello\n.\nBye"); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	select {
+	case data := <-received:
+		if !strings.Contains(data, "Subject: Hi\r\n") || !strings.HasSuffix(data, "\r\nHello\r\n..\r\nBye\r\n") {
+			t.Errorf("server received:\n%s", data)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the server received no message")
+	}
+}
+
+func TestNewDefaultPorts(t *testing.T) {
+	cfg := config.Default()
+	for _, tc := range []struct {
+		ssl, tls bool
+		port     int
+	}{
+		{false, false, 25},
+		{false, true, 587},
+		{true, false, 465},
+	} {
+		cfg.MailUseSSL, cfg.MailUseTLS = tc.ssl, tc.tls
+		if got := New(cfg).port; got != tc.port {
+			t.Errorf("ssl=%v tls=%v: port = %d, want %d", tc.ssl, tc.tls, got, tc.port)
+		}
+	}
+}
+
+// serveSMTP accepts one connection on ln, speaks just enough SMTP to take
+// a message, and sends its data to received.
+func serveSMTP(ln net.Listener, received chan<- string) {
+	conn, err := ln.Accept()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	reply := func(s string) { conn.Write([]byte(s + "\r\n")) }
+
+	reply("220 localhost ESMTP")
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		cmd := strings.ToUpper(strings.TrimSpace(line))
+		switch {
+		case strings.HasPrefix(cmd, "EHLO"), strings.HasPrefix(cmd, "HELO"):
+			reply("250 localhost")
+		case strings.HasPrefix(cmd, "DATA"):
+			reply("354 go ahead")
+			var data strings.Builder
+			for {
+				l, err := r.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if l == ".\r\n" {
+					break
+				}
+				data.WriteString(l)
+			}
+			received <- data.String()
+			reply("250 queued")
+		case strings.HasPrefix(cmd, "QUIT"):
+			reply("221 bye")
+			return
+		default:
+			reply("250 ok")
+		}
+	}
+}
@@ -0,0 +1,272 @@
+// Package mediawiki reads MediaWiki XML dumps, as written by Special:Export
+// and dumpBackup.php, and converts wikitext to Markdown.
+//
+// The conversion is best effort: headings, text formatting, links, lists,
+// tables, references, and code blocks are translated; templates, parser
+// functions, and other constructs without a Markdown equivalent are kept as
+// written so that nothing is silently lost.
+package mediawiki
+
+import (
+	"bufio"
+	"compress/bzip2"
+	"compress/gzip"
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// ErrInvalidDump is returned when the input is not a MediaWiki XML dump.
+var ErrInvalidDump = errors.New("mediawiki: invalid dump")
+
+// Well-known namespace keys. Dumps name them in the wiki's language; the keys
+// are fixed.
+const (
+	NamespaceMedia     = -2
+	NamespaceMain      = 0
+	NamespaceFile      = 6
+	NamespaceMediaWiki = 8
+	NamespaceCategory  = 14
+)
+
+// Dump is a parsed MediaWiki dump.
+type Dump struct {
+	SiteName string
+	// FirstLetterCase is true when the wiki capitalizes the first letter of
+	// titles, as MediaWiki does by default.
+	FirstLetterCase bool
+	// Namespaces maps namespace keys to their local names ("" for the main
+	// namespace).
+	Namespaces map[int]string
+	Pages      []Page
+}
+
+// Page is one page of the dump with the revisions and uploads it carries.
+type Page struct {
+	Title     string
+	Namespace int
+	// Redirect is the target title when the page is a redirect.
+	Redirect  string
+	Revisions []Revision
+	// Uploads are the versions of the file behind a File: page. Dumps made
+	// with --uploads --include-files carry the file contents.
+	Uploads []Upload
+}
+
+// Contributor identifies who made a revision or upload. Anonymous edits have
+// only an IP address; suppressed contributors have neither.
+type Contributor struct {
+	Username string `xml:"username"`
+	IP       string `xml:"ip"`
+}
+
+// Revision is one version of a page.
+type Revision struct {
+	ID          int64
+	Timestamp   time.Time
+	Contributor Contributor
+	Comment     string
+	Text        string
+}
+
+// Upload is one version of an uploaded file.
+type Upload struct {
+	Timestamp   time.Time
+	Contributor Contributor
+	Comment     string
+	Filename    string
+	// Contents is nil when the dump does not include the file itself.
+	Contents []byte
+}
+
+// Namespace returns the local name of a namespace key.
+func (d *Dump) Namespace(key int) string {
+	return d.Namespaces[key]
+}
+
+// SplitTitle splits a full title ("Help:Contents") into its namespace key and
+// the title within the namespace, normalized as MediaWiki does: underscores
+// are spaces and, on first-letter wikis, the first letter is uppercase.
+// Namespace names are matched without regard to case, and "Image" is
+// accepted for the file namespace.
+func (d *Dump) SplitTitle(title string) (int, string) {
+	title = strings.TrimSpace(strings.ReplaceAll(title, "_", " "))
+	ns := NamespaceMain
+	if prefix, rest, ok := strings.Cut(title, ":"); ok {
+		if key, found := d.namespaceKey(strings.TrimSpace(prefix)); found {
+			ns, title = key, strings.TrimSpace(rest)
+		}
+	}
+	if d.FirstLetterCase {
+		title = upperFirst(title)
+	}
+	return ns, title
+}
+
+func (d *Dump) namespaceKey(name string) (int, bool) {
+	if name == "" {
+		return 0, false
+	}
+	if strings.EqualFold(name, "Image") {
+		return NamespaceFile, true
+	}
+	for key, local := range d.Namespaces {
+		if local != "" && strings.EqualFold(local, name) {
+			return key, true
+		}
+	}
+	return 0, false
+}
+
+func upperFirst(s string) string {
+	r, size := utf8.DecodeRuneInString(s)
+	if r == utf8.RuneError {
+		return s
+	}
+	return string(unicode.ToUpper(r)) + s[size:]
+}
+
+// XML shapes of the export format.
+type xmlSiteInfo struct {
+	SiteName   string `xml:"sitename"`
+	Case       string `xml:"case"`
+	Namespaces []struct {
+		Key  int    `xml:"key,attr"`
+		Name string `xml:",chardata"`
+	} `xml:"namespaces>namespace"`
+}
+
+type xmlPage struct {
+	Title    string `xml:"title"`
+	NS       int    `xml:"ns"`
+	Redirect struct {
+		Title string `xml:"title,attr"`
+	} `xml:"redirect"`
+	Revisions []struct {
+		ID          int64       `xml:"id"`
+		Timestamp   string      `xml:"timestamp"`
+		Contributor Contributor `xml:"contributor"`
+		Comment     string      `xml:"comment"`
+		Text        string      `xml:"text"`
+	} `xml:"revision"`
+	Uploads []struct {
+		Timestamp   string      `xml:"timestamp"`
+		Contributor Contributor `xml:"contributor"`
+		Comment     string      `xml:"comment"`
+		Filename    string      `xml:"filename"`
+		Contents    struct {
+			Encoding string `xml:"encoding,attr"`
+			Data     string `xml:",chardata"`
+		} `xml:"contents"`
+	} `xml:"upload"`
+}
+
+// Parse reads a MediaWiki XML dump. Dumps compressed with gzip or bzip2, as
+// they are usually distributed, are decompressed on the fly.
+func Parse(r io.Reader) (*Dump, error) {
+	br := bufio.NewReader(r)
+	if magic, _ := br.Peek(3); len(magic) >= 2 && magic[0] == 0x1f && magic[1] == 0x8b {
+		zr, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidDump, err)
+		}
+		defer zr.Close()
+		r = zr
+	} else if string(magic) == "BZh" {
+		r = bzip2.NewReader(br)
+	} else {
+		r = br
+	}
+
+	dump := &Dump{FirstLetterCase: true, Namespaces: map[int]string{NamespaceMain: ""}}
+	dec := xml.NewDecoder(r)
+	sawRoot := false
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidDump, err)
+		}
+		start, ok := tok.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		switch start.Name.Local {
+		case "mediawiki":
+			sawRoot = true
+		case "siteinfo":
+			var info xmlSiteInfo
+			if err := dec.DecodeElement(&info, &start); err != nil {
+				return nil, fmt.Errorf("%w: %v", ErrInvalidDump, err)
+			}
+			dump.SiteName = info.SiteName
+			dump.FirstLetterCase = info.Case != "case-sensitive"
+			for _, ns := range info.Namespaces {
+				dump.Namespaces[ns.Key] = strings.TrimSpace(ns.Name)
+			}
+		case "page":
+			var xp xmlPage
+			if err := dec.DecodeElement(&xp, &start); err != nil {
+				return nil, fmt.Errorf("%w: %v", ErrInvalidDump, err)
+			}
+			page, err := convertPage(xp)
+			if err != nil {
+				return nil, err
+			}
+			dump.Pages = append(dump.Pages, page)
+		}
+	}
+	if !sawRoot {
+		return nil, fmt.Errorf("%w: no <mediawiki> element", ErrInvalidDump)
+	}
+	return dump, nil
+}
+
+func convertPage(xp xmlPage) (Page, error) {
+	page := Page{Title: strings.TrimSpace(xp.Title), Namespace: xp.NS, Redirect: xp.Redirect.Title}
+	for _, xr := range xp.Revisions {
+		when, err := parseTimestamp(xr.Timestamp)
+		if err != nil {
+			return Page{}, fmt.Errorf("%w: page %q: %v", ErrInvalidDump, page.Title, err)
+		}
+		page.Revisions = append(page.Revisions, Revision{
+			ID:          xr.ID,
+			Timestamp:   when,
+			Contributor: xr.Contributor,
+			Comment:     xr.Comment,
+			Text:        xr.Text,
+		})
+	}
+	for _, xu := range xp.Uploads {
+		when, err := parseTimestamp(xu.Timestamp)
+		if err != nil {
+			return Page{}, fmt.Errorf("%w: upload %q: %v", ErrInvalidDump, xu.Filename, err)
+		}
+		upload := Upload{Timestamp: when, Contributor: xu.Contributor, Comment: xu.Comment, Filename: strings.TrimSpace(xu.Filename)}
+		if xu.Contents.Encoding == "base64" {
+			data, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(xu.Contents.Data), ""))
+			if err != nil {
+				return Page{}, fmt.Errorf("%w: upload %q: %v", ErrInvalidDump, upload.Filename, err)
+			}
+			upload.Contents = data
+		}
+		page.Uploads = append(page.Uploads, upload)
+	}
+	return page, nil
+}
+
+func parseTimestamp(s string) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return time.Time{}, nil
+	}
+	return time.Parse(time.RFC3339, s)
+}
@@ -0,0 +1,160 @@
+package mediawiki
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testDump = `<mediawiki xmlns="http://www.mediawiki.org/xml/export-0.11/" version="0.11" xml:lang="en">
+  <siteinfo>
+    <sitename>Test Wiki</sitename>
+    <case>first-letter</case>
+    <namespaces>
+      <namespace key="-2" case="first-letter">Media</namespace>
+      <namespace key="0" case="first-letter" />
+      <namespace key="1" case="first-letter">Talk</namespace>
+      <namespace key="6" case="first-letter">File</namespace>
+      <namespace key="12" case="first-letter">Help</namespace>
+      <namespace key="14" case="first-letter">Category</namespace>
+    </namespaces>
+  </siteinfo>
+  <page>
+    <title>Main Page</title>
+    <ns>0</ns>
+    <id>1</id>
+    <revision>
+      <id>10</id>
+      <timestamp>2020-01-02T03:04:05Z</timestamp>
+      <contributor><username>Alice</username><id>1</id></contributor>
+      <comment>Created page</comment>
+      <text xml:space="preserve">Hello '''world'''.</text>
+    </revision>
+    <revision>
+      <id>11</id>
+      <timestamp>2020-02-03T04:05:06Z</timestamp>
+      <contributor><ip>192.0.2.1</ip></contributor>
+      <text xml:space="preserve">Hello [[File:Logo.png]].</text>
+    </revision>
+  </page>
+  <page>
+    <title>Old Name</title>
+    <ns>0</ns>
+    <redirect title="Main Page" />
+    <revision>
+      <timestamp>2020-01-05T00:00:00Z</timestamp>
+      <text>#REDIRECT [[Main Page]]</text>
+    </revision>
+  </page>
+  <page>
+    <title>File:Logo.png</title>
+    <ns>6</ns>
+    <revision>
+      <timestamp>2020-01-03T00:00:00Z</timestamp>
+      <text>The logo.</text>
+    </revision>
+    <upload>
+      <timestamp>2020-01-03T00:00:00Z</timestamp>
+      <contributor><username>Bob</username></contributor>
+      <comment>Logo upload</comment>
+      <filename>Logo.png</filename>
+      <contents encoding="base64">UE5H</contents>
+    </upload>
+  </page>
+</mediawiki>`
+
+func TestParse(t *testing.T) {
+	d, err := Parse(strings.NewReader(testDump))
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if d.SiteName != "Test Wiki" || !d.FirstLetterCase {
+		t.Errorf("site info = %q, first letter %v", d.SiteName, d.FirstLetterCase)
+	}
+	if d.Namespace(12) != "Help" {
+		t.Errorf("Namespace(12) = %q, want Help", d.Namespace(12))
+	}
+	if len(d.Pages) != 3 {
+		t.Fatalf("got %d pages, want 3", len(d.Pages))
+	}
+
+	main := d.Pages[0]
+	if main.Title != "Main Page" || len(main.Revisions) != 2 {
+		t.Fatalf("first page = %q with %d revisions", main.Title, len(main.Revisions))
+	}
+	rev := main.Revisions[0]
+	if rev.ID != 10 || rev.Contributor.Username != "Alice" || rev.Comment != "Created page" || rev.Text != "Hello '''world'''." {
+		t.Errorf("first revision = %+v", rev)
+	}
+	if want := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC); !rev.Timestamp.Equal(want) {
+		t.Errorf("timestamp = %v, want %v", rev.Timestamp, want)
+	}
+	if main.Revisions[1].Contributor.IP != "192.0.2.1" {
+		t.Errorf("anonymous contributor = %+v", main.Revisions[1].Contributor)
+	}
+
+	if d.Pages[1].Redirect != "Main Page" {
+		t.Errorf("Redirect = %q, want Main Page", d.Pages[1].Redirect)
+	}
+
+	file := d.Pages[2]
+	if file.Namespace != NamespaceFile || len(file.Uploads) != 1 {
+		t.Fatalf("file page = ns %d with %d uploads", file.Namespace, len(file.Uploads))
+	}
+	if up := file.Uploads[0]; up.Filename != "Logo.png" || string(up.Contents) != "PNG" || up.Contributor.Username != "Bob" {
+		t.Errorf("upload = %+v", up)
+	}
+}
+
+func TestParseGzip(t *testing.T) {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	zw.Write([]byte(testDump))
+	zw.Close()
+
+	d, err := Parse(&buf)
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if len(d.Pages) != 3 {
+		t.Errorf("got %d pages, want 3", len(d.Pages))
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	for _, input := range []string{"", "not xml at all", "<html><body>hi</body></html>", "<mediawiki><page><title>x"} {
+		if _, err := Parse(strings.NewReader(input)); !errors.Is(err, ErrInvalidDump) {
+			t.Errorf("Parse(%q) error = %v, want ErrInvalidDump", input, err)
+		}
+	}
+}
+
+func TestSplitTitle(t *testing.T) {
+	d := &Dump{FirstLetterCase: true, Namespaces: map[int]string{NamespaceMain: "", NamespaceFile: "File", 12: "Help"}}
+	tests := []struct {
+		title string
+		ns    int
+		name  string
+	}{
+		{"Main Page", NamespaceMain, "Main Page"},
+		{"main_page", NamespaceMain, "Main page"},
+		{"Help:Contents", 12, "Contents"},
+		{"help: contents", 12, "Contents"},
+		{"Image:Logo.png", NamespaceFile, "Logo.png"},
+		{"Unknown:Thing", NamespaceMain, "Unknown:Thing"},
+	}
+	for _, tt := range tests {
+		ns, name := d.SplitTitle(tt.title)
+		if ns != tt.ns || name != tt.name {
+			t.Errorf("SplitTitle(%q) = %d, %q; want %d, %q", tt.title, ns, name, tt.ns, tt.name)
+		}
+	}
+
+	d.FirstLetterCase = false
+	if _, name := d.SplitTitle("iPhone"); name != "iPhone" {
+		t.Errorf("case-sensitive SplitTitle = %q, want iPhone", name)
+	}
+}
@@ -0,0 +1,703 @@
+package mediawiki
+
+import (
+	"fmt"
+	"html"
+	"net/url"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/sa/gopherwiki/internal/renderer"
+)
+
+// Converter translates wikitext to Markdown. Links are rewritten through the
+// callbacks, which map titles and files to where the import puts them.
+type Converter struct {
+	dump *Dump
+	// pagePath returns the wiki page path for a full page title.
+	pagePath func(title string) string
+	// fileURL returns the URL of an imported file, or "" when the file is
+	// not part of the import.
+	fileURL func(name string) string
+}
+
+// NewConverter returns a converter for the pages of d. pagePath maps a full
+// title ("Help:Contents") to its page path; fileURL maps a file name, as
+// normalized by Dump.SplitTitle, to the URL of the imported file, or "" if
+// there is none.
+func NewConverter(d *Dump, pagePath, fileURL func(string) string) *Converter {
+	return &Converter{dump: d, pagePath: pagePath, fileURL: fileURL}
+}
+
+var (
+	commentRegex       = regexp.MustCompile(`(?s)<!--.*?-->`)
+	galleryRegex       = regexp.MustCompile(`(?is)<gallery[^>]*>(.*?)</gallery>`)
+	nowikiRegex        = regexp.MustCompile(`(?is)<nowiki>(.*?)</nowiki>|<nowiki\s*/>`)
+	preRegex           = regexp.MustCompile(`(?is)<pre[^>]*>(.*?)</pre>`)
+	highlightRegex     = regexp.MustCompile(`(?is)<(?:syntaxhighlight|source)([^>]*)>(.*?)</(?:syntaxhighlight|source)>`)
+	codeRegex          = regexp.MustCompile(`(?is)<(?:code|tt)>(.*?)</(?:code|tt)>`)
+	mathRegex          = regexp.MustCompile(`(?is)<math([^>]*)>(.*?)</math>`)
+	refRegex           = regexp.MustCompile(`(?is)<ref(\s[^>]*?)?(?:/>|>(.*?)</ref>)`)
+	referencesRegex    = regexp.MustCompile(`(?is)<references[^>]*/>|<references[^>]*>.*?</references>|\{\{\s*[Rr]eflist[^}]*\}\}`)
+	attrNameRegex      = regexp.MustCompile(`(?i)name\s*=\s*(?:"([^"]*)"|'([^']*)'|([^\s/>]+))`)
+	attrLangRegex      = regexp.MustCompile(`(?i)lang\s*=\s*(?:"([^"]*)"|'([^']*)'|([^\s/>]+))`)
+	tocRegex           = regexp.MustCompile(`__TOC__`)
+	magicWordRegex     = regexp.MustCompile(`__[A-Z]+__`)
+	redirectRegex      = regexp.MustCompile(`(?is)^\s*#REDIRECT\s*:?\s*\[\[([^\]|]+)(?:\|[^\]]*)?\]\]`)
+	headingRegex       = regexp.MustCompile(`^(={1,6})\s*(.*?)\s*(={1,6})\s*$`)
+	ruleRegex          = regexp.MustCompile(`^-{4,}\s*$`)
+	listRegex          = regexp.MustCompile(`^([*#:;]+)\s*(.*)$`)
+	externalLinkRegex  = regexp.MustCompile(`\[((?:https?|ftp)://[^\s\]]+|mailto:[^\s\]]+)(?:\s+([^\]]*))?\]`)
+	boldItalicRegex    = regexp.MustCompile(`'''''(.+?)'''''`)
+	boldRegex          = regexp.MustCompile(`'''(.+?)'''`)
+	italicRegex        = regexp.MustCompile(`''(.+?)''`)
+	brRegex            = regexp.MustCompile(`(?i)<br\s*/?>`)
+	strongTagRegex     = regexp.MustCompile(`(?is)<(?:b|strong)>(.*?)</(?:b|strong)>`)
+	emTagRegex         = regexp.MustCompile(`(?is)<(?:i|em)>(.*?)</(?:i|em)>`)
+	strikeTagRegex     = regexp.MustCompile(`(?is)<(?:s|del|strike)>(.*?)</(?:s|del|strike)>`)
+	layoutTagRegex     = regexp.MustCompile(`(?i)</?(?:u|ins|sup|sub|span|div|center|font|small|big|p|blockquote|abbr)(?:\s[^>]*)?>`)
+	imageSizeRegex     = regexp.MustCompile(`^\d*(?:x\d+)?px$`)
+	cellLinkRegex      = regexp.MustCompile(`\[\[([^|\]]+)\|([^\]]*)\]\]`)
+	plainLinkRegex     = regexp.MustCompile(`\[\[(?:[^|\]]*\|)?([^\]]*)\]\]`)
+	placeholderRegex   = regexp.MustCompile("\x00(\\d+)\x00")
+	blankLinesRegex    = regexp.MustCompile(`\n{3,}`)
+	fileReferenceRegex = regexp.MustCompile(`\[\[\s*:?\s*([^|\]\[]+)`)
+)
+
+// imageOptions are the file link parameters that style an image rather than
+// caption it.
+var imageOptions = map[string]bool{
+	"thumb": true, "thumbnail": true, "frame": true, "framed": true, "frameless": true,
+	"border": true, "left": true, "right": true, "center": true, "centre": true, "none": true,
+	"baseline": true, "middle": true, "sub": true, "super": true, "top": true,
+	"text-top": true, "bottom": true, "text-bottom": true, "upright": true,
+}
+
+// conversion holds the state of converting one page.
+type conversion struct {
+	c            *Converter
+	placeholders []string
+	notes        []string
+	noteNames    map[string]int
+	categories   []string
+}
+
+// Markdown converts the wikitext of a page. Redirect pages become a link to
+// their target.
+func (c *Converter) Markdown(wikitext string) string {
+	if m := redirectRegex.FindStringSubmatch(wikitext); m != nil {
+		wikitext = "This page redirects to [[" + m[1] + "]]."
+	}
+	cv := &conversion{c: c, noteNames: make(map[string]int)}
+	text := cv.protect(expandGalleries(strings.ReplaceAll(wikitext, "\r\n", "\n")))
+	out := cv.blocks(strings.Split(text, "\n"))
+
+	if len(cv.notes) > 0 {
+		var notes []string
+		for i, note := range cv.notes {
+			notes = append(notes, fmt.Sprintf("[^%d]: %s", i+1, cv.inline(strings.Join(strings.Fields(note), " "))))
+		}
+		out += "\n\n" + strings.Join(notes, "\n")
+	}
+	if len(cv.categories) > 0 {
+		seen := make(map[string]bool)
+		var links []string
+		for _, name := range cv.categories {
+			if !seen[name] {
+				seen[name] = true
+				links = append(links, "[["+c.pagePath(c.dump.Namespace(NamespaceCategory)+":"+name)+"|"+name+"]]")
+			}
+		}
+		out += "\n\nCategories: " + strings.Join(links, ", ")
+	}
+
+	out = cv.restore(out)
+	out = blankLinesRegex.ReplaceAllString(strings.TrimSpace(out), "\n\n")
+	if out == "" {
+		return ""
+	}
+	return out + "\n"
+}
+
+// Files lists the files that wikitext embeds or links to, as normalized
+// names within the file namespace.
+func (c *Converter) Files(wikitext string) []string {
+	var names []string
+	for _, m := range fileReferenceRegex.FindAllStringSubmatch(expandGalleries(wikitext), -1) {
+		target, _, _ := strings.Cut(m[1], "#")
+		if ns, name := c.dump.SplitTitle(target); (ns == NamespaceFile || ns == NamespaceMedia) && name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// expandGalleries turns the "File:a.png|Caption" lines of a <gallery> into
+// file links.
+func expandGalleries(text string) string {
+	return galleryRegex.ReplaceAllStringFunc(text, func(m string) string {
+		var lines []string
+		for _, line := range strings.Split(galleryRegex.FindStringSubmatch(m)[1], "\n") {
+			if line = strings.TrimSpace(line); line != "" {
+				lines = append(lines, "[["+line+"]]")
+			}
+		}
+		return "\n" + strings.Join(lines, "\n\n") + "\n"
+	})
+}
+
+// hold stores converted Markdown that later passes must not touch and
+// returns the placeholder standing in for it.
+func (cv *conversion) hold(markdown string) string {
+	cv.placeholders = append(cv.placeholders, markdown)
+	return "\x00" + strconv.Itoa(len(cv.placeholders)-1) + "\x00"
+}
+
+// holdBlock is hold for block content, which is kept on lines of its own.
+func (cv *conversion) holdBlock(markdown string) string {
+	return "\n" + cv.hold(markdown) + "\n"
+}
+
+// restore replaces placeholders with their content, including placeholders
+// within held content.
+func (cv *conversion) restore(s string) string {
+	for i := 0; i < 5 && strings.Contains(s, "\x00"); i++ {
+		s = placeholderRegex.ReplaceAllStringFunc(s, func(m string) string {
+			n, _ := strconv.Atoi(m[1 : len(m)-1])
+			return cv.placeholders[n]
+		})
+	}
+	return s
+}
+
+// protect removes comments and takes out the constructs whose content is not
+// wikitext (nowiki, code, math) before the structural passes, and collects
+// references as footnotes.
+func (cv *conversion) protect(text string) string {
+	text = commentRegex.ReplaceAllString(text, "")
+	text = nowikiRegex.ReplaceAllStringFunc(text, func(m string) string {
+		sub := nowikiRegex.FindStringSubmatch(m)
+		return cv.hold(html.UnescapeString(sub[1]))
+	})
+	text = preRegex.ReplaceAllStringFunc(text, func(m string) string {
+		return cv.holdBlock(fence("", html.UnescapeString(preRegex.FindStringSubmatch(m)[1])))
+	})
+	text = highlightRegex.ReplaceAllStringFunc(text, func(m string) string {
+		sub := highlightRegex.FindStringSubmatch(m)
+		if strings.Contains(strings.ToLower(sub[1]), "inline") {
+			return cv.hold(codeSpan(sub[2]))
+		}
+		return cv.holdBlock(fence(attrValue(attrLangRegex, sub[1]), sub[2]))
+	})
+	text = codeRegex.ReplaceAllStringFunc(text, func(m string) string {
+		return cv.hold(codeSpan(html.UnescapeString(codeRegex.FindStringSubmatch(m)[1])))
+	})
+	text = mathRegex.ReplaceAllStringFunc(text, func(m string) string {
+		sub := mathRegex.FindStringSubmatch(m)
+		if strings.Contains(sub[1], "block") {
+			return cv.holdBlock(fence("math", strings.TrimSpace(sub[2])))
+		}
+		return cv.hold(`\(` + strings.TrimSpace(sub[2]) + `\)`)
+	})
+	text = refRegex.ReplaceAllStringFunc(text, func(m string) string {
+		sub := refRegex.FindStringSubmatch(m)
+		return cv.hold(cv.footnote(attrValue(attrNameRegex, sub[1]), sub[2]))
+	})
+	text = referencesRegex.ReplaceAllString(text, "")
+	text = tocRegex.ReplaceAllString(text, cv.holdBlock("{{toc}}"))
+	return magicWordRegex.ReplaceAllString(text, "")
+}
+
+// footnote returns the marker for a reference, numbering references in order
+// of appearance and reusing the number of a named one.
+func (cv *conversion) footnote(name, text string) string {
+	if name != "" {
+		if n, ok := cv.noteNames[name]; ok {
+			if cv.notes[n-1] == "" {
+				cv.notes[n-1] = text
+			}
+			return fmt.Sprintf("[^%d]", n)
+		}
+	}
+	cv.notes = append(cv.notes, text)
+	n := len(cv.notes)
+	if name != "" {
+		cv.noteNames[name] = n
+	}
+	return fmt.Sprintf("[^%d]", n)
+}
+
+func attrValue(re *regexp.Regexp, attrs string) string {
+	m := re.FindStringSubmatch(attrs)
+	if m == nil {
+		return ""
+	}
+	return m[1] + m[2] + m[3]
+}
+
+func fence(lang, code string) string {
+	marker := "```"
+	for strings.Contains(code, marker) {
+		marker += "`"
+	}
+	return marker + lang + "\n" + strings.Trim(code, "\n") + "\n" + marker
+}
+
+func codeSpan(code string) string {
+	if strings.Contains(code, "`") {
+		return "`` " + code + " ``"
+	}
+	return "`" + code + "`"
+}
+
+// blocks converts the block structure line by line: headings, rules, lists,
+// indented preformatted text, tables, and paragraphs. Paragraph lines are
+// joined, since MediaWiki ignores single line breaks.
+func (cv *conversion) blocks(lines []string) string {
+	var out, para []string
+	lastKind := ""
+	emit := func(kind string, lines ...string) {
+		if lastKind != "" && kind != lastKind && len(out) > 0 && out[len(out)-1] != "" {
+			out = append(out, "")
+		}
+		out = append(out, lines...)
+		lastKind = kind
+	}
+	flush := func() {
+		if len(para) > 0 {
+			if text := strings.TrimSpace(cv.inline(strings.Join(para, " "))); text != "" {
+				emit("paragraph", text)
+			}
+			para = nil
+		}
+	}
+
+	for i := 0; i < len(lines); i++ {
+		raw := strings.TrimRight(lines[i], " \t\r")
+		line := strings.TrimSpace(raw)
+		switch {
+		case line == "":
+			flush()
+			out = append(out, "")
+			lastKind = ""
+		case strings.HasPrefix(line, "{|"):
+			flush()
+			end := tableEnd(lines, i)
+			emit("table", cv.table(lines[i:end+1])...)
+			i = end
+		case headingRegex.MatchString(line):
+			flush()
+			m := headingRegex.FindStringSubmatch(line)
+			level := min(len(m[1]), len(m[3]))
+			emit("heading", strings.Repeat("#", level)+" "+cv.inline(m[2]))
+		case ruleRegex.MatchString(line):
+			flush()
+			emit("rule", "", "---")
+			lastKind = ""
+		case listRegex.MatchString(raw) && !strings.HasPrefix(raw, " "):
+			flush()
+			m := listRegex.FindStringSubmatch(raw)
+			kind := "list"
+			switch {
+			case strings.Trim(m[1], ":") == "":
+				kind = "quote"
+			case strings.HasPrefix(m[1], ";"):
+				kind = "definition"
+			}
+			emit(kind, cv.listItem(m[1], m[2]))
+		case strings.HasPrefix(raw, " ") && !placeholderRegex.MatchString(line):
+			flush()
+			var code []string
+			for ; i < len(lines) && strings.HasPrefix(lines[i], " ") && strings.TrimSpace(lines[i]) != ""; i++ {
+				code = append(code, strings.TrimRight(lines[i][1:], "\r"))
+			}
+			i--
+			emit("code", fence("", html.UnescapeString(strings.Join(code, "\n"))))
+		case placeholderRegex.MatchString(line) && placeholderRegex.ReplaceAllString(line, "") == "" && isBlock(cv.restore(line)):
+			flush()
+			emit("block", line)
+		default:
+			para = append(para, line)
+		}
+	}
+	flush()
+	return strings.Join(out, "\n")
+}
+
+// isBlock reports whether held content is a block, such as a code fence.
+func isBlock(s string) bool {
+	return strings.HasPrefix(s, "```") || s == "{{toc}}"
+}
+
+// listItem converts one line of a list. Bullets ("*") and numbers ("#")
+// nest by their prefix; definition terms (";") become bold, and indented
+// lines (":") block quotes.
+func (cv *conversion) listItem(prefix, content string) string {
+	indent := ""
+	for _, ch := range prefix[:len(prefix)-1] {
+		switch ch {
+		case '#':
+			indent += "   "
+		case '*':
+			indent += "  "
+		}
+	}
+	switch prefix[len(prefix)-1] {
+	case '*':
+		return indent + "- " + cv.inline(content)
+	case '#':
+		return indent + "1. " + cv.inline(content)
+	case ';':
+		term, definition, ok := strings.Cut(content, " : ")
+		if !ok {
+			return indent + "**" + cv.inline(strings.TrimSpace(content)) + "**"
+		}
+		return indent + "**" + cv.inline(strings.TrimSpace(term)) + "**: " + cv.inline(strings.TrimSpace(definition))
+	}
+	if strings.Trim(prefix, ":") == "" {
+		return strings.Repeat("> ", len(prefix)) + cv.inline(content)
+	}
+	return indent + "  " + cv.inline(content)
+}
+
+// tableEnd returns the index of the line closing the table opened at start,
+// or the last line when it is never closed.
+func tableEnd(lines []string, start int) int {
+	depth := 0
+	for i := start; i < len(lines); i++ {
+		line := strings.TrimSpace(lines[i])
+		if strings.HasPrefix(line, "{|") {
+			depth++
+		} else if strings.HasPrefix(line, "|}") {
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return len(lines) - 1
+}
+
+// table converts a wikitext table into a GFM table. Cell attributes, spans,
+// and styling are dropped. A nested table cannot be expressed in Markdown,
+// so such a table is kept as wikitext in a code block.
+func (cv *conversion) table(lines []string) []string {
+	for _, line := range lines[1:] {
+		if strings.HasPrefix(strings.TrimSpace(line), "{|") {
+			return []string{fence("mediawiki", strings.Join(lines, "\n"))}
+		}
+	}
+
+	var caption string
+	var rows [][]string
+	var row []string
+	headerRow := false
+	endRow := func() {
+		if len(row) > 0 {
+			if len(rows) == 0 && !headerRow {
+				rows = append(rows, nil)
+			}
+			rows = append(rows, row)
+		}
+		row, headerRow = nil, false
+	}
+	for _, line := range lines[1:] {
+		line = strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(line, "|}"):
+		case strings.HasPrefix(line, "|+"):
+			caption = cellContent(line[2:])
+		case strings.HasPrefix(line, "|-"):
+			endRow()
+		case strings.HasPrefix(line, "!"):
+			if len(row) == 0 && len(rows) == 0 {
+				headerRow = true
+			}
+			for _, cell := range splitCells(line[1:], "!!", "||") {
+				row = append(row, cellContent(cell))
+			}
+		case strings.HasPrefix(line, "|"):
+			if len(row) == 0 {
+				headerRow = false
+			}
+			for _, cell := range splitCells(line[1:], "||") {
+				row = append(row, cellContent(cell))
+			}
+		case len(row) > 0:
+			row[len(row)-1] += " " + line
+		}
+	}
+	endRow()
+	if len(rows) == 0 {
+		return nil
+	}
+
+	columns := 0
+	for _, r := range rows {
+		columns = max(columns, len(r))
+	}
+	format := func(cells []string) string {
+		out := make([]string, columns)
+		for i := range out {
+			if i < len(cells) {
+				// Wiki links are written as Markdown links, whose text may
+				// hold an escaped pipe; the pipe of a wiki link may not.
+				text := cv.restore(cv.inline(cells[i]))
+				text = cellLinkRegex.ReplaceAllStringFunc(text, func(m string) string {
+					sub := cellLinkRegex.FindStringSubmatch(m)
+					return "[" + sub[2] + "](" + PageURL(sub[1]) + ")"
+				})
+				text = strings.ReplaceAll(text, "\n", " ")
+				out[i] = strings.ReplaceAll(text, "|", `\|`)
+			}
+		}
+		return "| " + strings.Join(out, " | ") + " |"
+	}
+
+	var out []string
+	if caption != "" {
+		out = append(out, "**"+cv.inline(caption)+"**", "")
+	}
+	out = append(out, format(rows[0]))
+	out = append(out, "|"+strings.Repeat(" --- |", columns))
+	for _, r := range rows[1:] {
+		out = append(out, format(r))
+	}
+	return out
+}
+
+// splitCells splits a table line into cells at any of the separators,
+// ignoring separators inside links and templates.
+func splitCells(line string, seps ...string) []string {
+	var cells []string
+	depth, start := 0, 0
+	for i := 0; i < len(line); i++ {
+		switch {
+		case strings.HasPrefix(line[i:], "[[") || strings.HasPrefix(line[i:], "{{"):
+			depth++
+			i++
+		case strings.HasPrefix(line[i:], "]]") || strings.HasPrefix(line[i:], "}}"):
+			if depth > 0 {
+				depth--
+			}
+			i++
+		case depth == 0:
+			for _, sep := range seps {
+				if strings.HasPrefix(line[i:], sep) {
+					cells = append(cells, line[start:i])
+					start = i + len(sep)
+					i += len(sep) - 1
+					break
+				}
+			}
+		}
+	}
+	return append(cells, line[start:])
+}
+
+// cellContent strips the attributes from a cell ("style=... | text").
+func cellContent(cell string) string {
+	if attrs, content, ok := strings.Cut(cell, "|"); ok && strings.Contains(attrs, "=") &&
+		!strings.Contains(attrs, "[[") && !strings.Contains(attrs, "{{") {
+		return strings.TrimSpace(content)
+	}
+	return strings.TrimSpace(cell)
+}
+
+// inline converts the inline markup of a line or paragraph.
+func (cv *conversion) inline(s string) string {
+	s = cv.links(s)
+	s = externalLinkRegex.ReplaceAllStringFunc(s, func(m string) string {
+		sub := externalLinkRegex.FindStringSubmatch(m)
+		if strings.TrimSpace(sub[2]) == "" {
+			return cv.hold("<" + sub[1] + ">")
+		}
+		return cv.hold("[" + format(strings.TrimSpace(sub[2])) + "](" + sub[1] + ")")
+	})
+	return format(s)
+}
+
+// format converts text formatting: bold and italic apostrophes, and the HTML
+// formatting tags. Layout-only tags are dropped, keeping their content.
+func format(s string) string {
+	s = boldItalicRegex.ReplaceAllString(s, "***$1***")
+	s = boldRegex.ReplaceAllString(s, "**$1**")
+	s = italicRegex.ReplaceAllString(s, "*$1*")
+	s = brRegex.ReplaceAllString(s, "\n")
+	s = strongTagRegex.ReplaceAllString(s, "**$1**")
+	s = emTagRegex.ReplaceAllString(s, "*$1*")
+	s = strikeTagRegex.ReplaceAllString(s, "~~$1~~")
+	return layoutTagRegex.ReplaceAllString(s, "")
+}
+
+// links converts the [[...]] links of s. The brackets may nest, as in the
+// caption of an image.
+func (cv *conversion) links(s string) string {
+	var b strings.Builder
+	for {
+		i := strings.Index(s, "[[")
+		if i < 0 {
+			break
+		}
+		end := closingBrackets(s, i+2)
+		if end < 0 {
+			break
+		}
+		inner, rest := s[i+2:end], s[end+2:]
+		trail := 0
+		for trail < len(rest) {
+			r, size := utf8.DecodeRuneInString(rest[trail:])
+			if !unicode.IsLetter(r) {
+				break
+			}
+			trail += size
+		}
+		link, usedTrail := cv.link(inner, rest[:trail])
+		b.WriteString(s[:i])
+		b.WriteString(link)
+		if usedTrail {
+			rest = rest[trail:]
+		}
+		s = rest
+	}
+	b.WriteString(s)
+	return b.String()
+}
+
+// closingBrackets returns the index of the "]]" closing a link whose content
+// starts at from, or -1.
+func closingBrackets(s string, from int) int {
+	depth := 0
+	for i := from; i < len(s)-1; i++ {
+		switch {
+		case s[i] == '[' && s[i+1] == '[':
+			depth++
+			i++
+		case s[i] == ']' && s[i+1] == ']':
+			if depth == 0 {
+				return i
+			}
+			depth--
+			i++
+		}
+	}
+	return -1
+}
+
+// link converts the inside of one [[...]] link. trail is the run of letters
+// following it, which MediaWiki makes part of the link text ("[[Cat]]s").
+// It reports whether the trail was used.
+func (cv *conversion) link(inner, trail string) (string, bool) {
+	forced := strings.HasPrefix(strings.TrimSpace(inner), ":")
+	inner = strings.TrimPrefix(strings.TrimSpace(inner), ":")
+	target, text, hasText := strings.Cut(inner, "|")
+	title, section, _ := strings.Cut(target, "#")
+	ns, name := cv.c.dump.SplitTitle(title)
+
+	switch {
+	case ns == NamespaceCategory && !forced:
+		cv.categories = append(cv.categories, name)
+		return "", false
+	case ns == NamespaceFile && !forced:
+		return cv.file(name, text), false
+	case ns == NamespaceMedia || ns == NamespaceFile:
+		label := name
+		if hasText && text != "" {
+			label = text
+		}
+		if u := cv.c.fileURL(name); u != "" {
+			return cv.hold("[" + format(label) + "](" + u + ")"), false
+		}
+		return format(label), false
+	}
+
+	display := strings.TrimSpace(target)
+	if hasText {
+		display = strings.TrimSpace(text)
+		if display == "" {
+			// The pipe trick: [[Help:Contents (manual)|]] shows "Contents".
+			display = strings.TrimSpace(parentheticalRegex.ReplaceAllString(name, ""))
+		}
+	}
+	display = format(display + trail)
+
+	anchor := ""
+	if section = strings.TrimSpace(section); section != "" {
+		anchor = "#" + renderer.Slugify(section)
+	}
+	if strings.TrimSpace(title) == "" {
+		return cv.hold("[" + display + "](" + anchor + ")"), true
+	}
+	pagepath := cv.c.pagePath(title)
+	if anchor != "" {
+		return cv.hold("[" + display + "](" + PageURL(pagepath) + anchor + ")"), true
+	}
+	return cv.hold("[[" + pagepath + "|" + display + "]]"), true
+}
+
+var parentheticalRegex = regexp.MustCompile(`\s*\([^)]*\)$`)
+
+// file converts a file link: an image where the file is an image, and a link
+// to the file otherwise. A file the import does not include leaves its
+// caption.
+func (cv *conversion) file(name, params string) string {
+	caption, alt := "", ""
+	for _, p := range splitCells(params, "|") {
+		p = strings.TrimSpace(p)
+		key, value, _ := strings.Cut(p, "=")
+		switch {
+		case p == "":
+		case imageOptions[strings.ToLower(p)] || imageSizeRegex.MatchString(p):
+		case strings.EqualFold(key, "alt"):
+			alt = value
+		case strings.Contains("link page class lang upright", strings.ToLower(key)) && value != "":
+		default:
+			caption = p
+		}
+	}
+	u := cv.c.fileURL(name)
+	if u == "" {
+		if caption != "" {
+			return cv.inline(caption)
+		}
+		return ""
+	}
+	if !isImage(name) {
+		label := name
+		if caption != "" {
+			label = plainText(caption)
+		}
+		return cv.hold("[" + label + "](" + u + ")")
+	}
+	if alt == "" {
+		alt = plainText(caption)
+	}
+	return cv.hold("![" + strings.NewReplacer("[", "", "]", "").Replace(alt) + "](" + u + ")")
+}
+
+// plainText reduces wikitext to its text, for alt text and labels.
+func plainText(s string) string {
+	s = plainLinkRegex.ReplaceAllString(s, "$1")
+	return strings.TrimSpace(strings.ReplaceAll(s, "''", ""))
+}
+
+func isImage(name string) bool {
+	switch strings.ToLower(path.Ext(name)) {
+	case ".png", ".jpg", ".jpeg", ".gif", ".svg", ".webp", ".bmp", ".tif", ".tiff":
+		return true
+	}
+	return false
+}
+
+// PageURL is the URL of a wiki page or file at a repository path.
+func PageURL(p string) string {
+	parts := strings.Split(p, "/")
+	for i, part := range parts {
+		parts[i] = url.PathEscape(part)
+	}
+	return "/" + strings.Join(parts, "/")
+}
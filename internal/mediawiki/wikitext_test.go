@@ -0,0 +1,122 @@
+package mediawiki
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func testConverter() *Converter {
+	d := &Dump{FirstLetterCase: true, Namespaces: map[int]string{
+		NamespaceMedia: "Media", NamespaceMain: "", NamespaceFile: "File", 12: "Help", NamespaceCategory: "Category",
+	}}
+	pagePath := func(title string) string {
+		ns, name := d.SplitTitle(title)
+		p := strings.ReplaceAll(name, " ", "-")
+		if ns != NamespaceMain {
+			p = d.Namespace(ns) + "/" + p
+		}
+		return strings.ToLower(p)
+	}
+	fileURL := func(name string) string {
+		switch name {
+		case "Logo.png":
+			return "/main-page/Logo.png"
+		case "Manual.pdf":
+			return "/main-page/Manual.pdf"
+		}
+		return ""
+	}
+	return NewConverter(d, pagePath, fileURL)
+}
+
+func TestMarkdown(t *testing.T) {
+	c := testConverter()
+	tests := []struct {
+		name     string
+		wikitext string
+		want     string
+	}{
+		{"heading", "== Intro ==\ntext", "## Intro\n\ntext\n"},
+		{"formatting", "'''bold''', ''italic'' and '''''both'''''", "**bold**, *italic* and ***both***\n"},
+		{"joined lines", "one\ntwo\n\nthree", "one two\n\nthree\n"},
+		{"link", "see [[Main Page]]", "see [[main-page|Main Page]]\n"},
+		{"link text", "see [[Main Page|home]]", "see [[main-page|home]]\n"},
+		{"link trail", "[[cat]]s", "[[cat|cats]]\n"},
+		{"pipe trick", "[[Help:Editing (advanced)|]]", "[[help/editing-(advanced)|Editing]]\n"},
+		{"section link", "[[Help:Contents#Getting started|start]]", "[start](/help/contents#getting-started)\n"},
+		{"local section", "[[#Usage]]", "[#Usage](#usage)\n"},
+		{"external", "[https://example.com Example] and [https://example.org]", "[Example](https://example.com) and <https://example.org>\n"},
+		{"image", "[[File:Logo.png|thumb|200px|The [[logo]]]]", "![The logo](/main-page/Logo.png)\n"},
+		{"image alt", "[[Image:Logo.png|alt=Our logo|caption]]", "![Our logo](/main-page/Logo.png)\n"},
+		{"missing image", "[[File:Gone.png|thumb|Caption]]", "Caption\n"},
+		{"media link", "[[Media:Manual.pdf|the manual]]", "[the manual](/main-page/Manual.pdf)\n"},
+		{"category", "Text\n[[Category:Tools]]", "Text\n\nCategories: [[category/tools|Tools]]\n"},
+		{"list", "* one\n** two\n# first\n## second", "- one\n  - two\n1. first\n   1. second\n"},
+		{"definition", ";Term : Meaning", "**Term**: Meaning\n"},
+		{"indent", ": quoted", "> quoted\n"},
+		{"rule", "above\n----\nbelow", "above\n\n---\nbelow\n"},
+		{"preformatted", " line one\n line two", "```\nline one\nline two\n```\n"},
+		{"pre", "<pre>\n''raw''\n</pre>", "```\n''raw''\n```\n"},
+		{"syntaxhighlight", "<syntaxhighlight lang=\"go\">\nfunc main() {}\n</syntaxhighlight>", "```go\nfunc main() {}\n```\n"},
+		{"code", "run <code>make</code> and <nowiki>''this''</nowiki>", "run `make` and ''this''\n"},
+		{"math", "<math>x^2</math>", "\\(x^2\\)\n"},
+		{"references", "Fact.<ref name=\"a\">Source.</ref> Again.<ref name=\"a\" />\n<references />", "Fact.[^1] Again.[^1]\n\n[^1]: Source.\n"},
+		{"html formatting", "<b>bold</b><br>next <span style=\"x\">plain</span> <s>gone</s>", "**bold**\nnext plain ~~gone~~\n"},
+		{"comment and magic words", "<!-- hidden -->__NOTOC__text", "text\n"},
+		{"toc", "__TOC__\n== A ==", "{{toc}}\n\n## A\n"},
+		{"template kept", "{{Infobox|name=x}}", "{{Infobox|name=x}}\n"},
+		{"redirect", "#REDIRECT [[Main Page]]", "This page redirects to [[main-page|Main Page]].\n"},
+		{"gallery", "<gallery>\nFile:Logo.png|Logo\n</gallery>", "![Logo](/main-page/Logo.png)\n"},
+		{"empty", "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := c.Markdown(tt.wikitext); got != tt.want {
+				t.Errorf("Markdown(%q) =\n%q\nwant\n%q", tt.wikitext, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMarkdownTable(t *testing.T) {
+	c := testConverter()
+	wikitext := `{| class="wikitable"
+|+ Versions
+! Name !! Link
+|-
+| One || [[Main Page|home]]
+|-
+| style="color: red" | Two
+| plain
+|}`
+	want := "**Versions**\n\n" +
+		"| Name | Link |\n" +
+		"| --- | --- |\n" +
+		"| One | [home](/main-page) |\n" +
+		"| Two | plain |\n"
+	if got := c.Markdown(wikitext); got != want {
+		t.Errorf("table =\n%s\nwant\n%s", got, want)
+	}
+
+	// Without a header row the table gets an empty one.
+	got := c.Markdown("{|\n| a || b\n|}")
+	if want := "|  |  |\n| --- | --- |\n| a | b |\n"; got != want {
+		t.Errorf("headerless table = %q, want %q", got, want)
+	}
+
+	// A nested table is kept as wikitext.
+	nested := "{|\n|\n{|\n| inner\n|}\n|}"
+	if got := c.Markdown(nested); got != "```mediawiki\n"+nested+"\n```\n" {
+		t.Errorf("nested table = %q", got)
+	}
+}
+
+func TestFiles(t *testing.T) {
+	c := testConverter()
+	got := c.Files("[[File:Logo.png|thumb]] [[image:other_file.jpg]] [[Media:Manual.pdf]] [[Main Page]]\n<gallery>\nFile:Shot.png\n</gallery>")
+	want := []string{"Logo.png", "Other file.jpg", "Manual.pdf", "Shot.png"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Files = %q, want %q", got, want)
+	}
+}
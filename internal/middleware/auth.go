@@ -1,12 +1,14 @@
 package middleware
 
 import (
+	"context"
 	"encoding/json"
+	"log/slog"
 	"net/http"
 	"strings"
 
-	"github.com/sa/gopherwiki/internal/config"
 	"github.com/sa/gopherwiki/internal/models"
+	"github.com/sa/gopherwiki/internal/settings"
 )
 
 // Permission levels
@@ -17,20 +19,33 @@ const (
 	PermissionAdmin  = "admin"
 )
 
-// PermissionChecker provides permission checking middleware.
+// PermissionChecker provides permission checking middleware. Access levels
+// are read from the settings service on every check, so changes saved by an
+// admin apply to the next request.
 type PermissionChecker struct {
-	config         *config.Config
+	settings       *settings.Service
 	sessionManager *SessionManager
+	publicPages    PublicPages
 }
 
+// PublicPages returns the paths of the pages anyone may read, whatever the
+// read access.
+type PublicPages func(ctx context.Context) (map[string]bool, error)
+
 // NewPermissionChecker creates a new PermissionChecker.
-func NewPermissionChecker(cfg *config.Config, sm *SessionManager) *PermissionChecker {
+func NewPermissionChecker(ss *settings.Service, sm *SessionManager) *PermissionChecker {
 	return &PermissionChecker{
-		config:         cfg,
+		settings:       ss,
 		sessionManager: sm,
 	}
 }
 
+// SetPublicPages sets where the checker finds the public pages. Without it
+// no page is public.
+func (pc *PermissionChecker) SetPublicPages(pages PublicPages) {
+	pc.publicPages = pages
+}
+
 // RequireRead returns middleware that requires read permission.
 func (pc *PermissionChecker) RequireRead(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -87,17 +102,61 @@ func (pc *PermissionChecker) RequireAuth(next http.Handler) http.Handler {
 	})
 }
 
+// RequireReadOrPublic returns middleware that requires read permission,
+// unless some pages are public: it guards the lists of pages, such as
+// search results and feeds, that show visitors without read permission
+// only the public pages, filtering them with PageFilter.
+func (pc *PermissionChecker) RequireReadOrPublic(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !pc.HasPermission(r, PermissionRead) && len(pc.publicPageSet(r.Context())) == 0 {
+			pc.handleUnauthorized(w, r, PermissionRead)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// CanReadPage reports whether the current user may read the page at
+// pagepath: with read permission, or when the page is public.
+func (pc *PermissionChecker) CanReadPage(r *http.Request, pagepath string) bool {
+	return pc.HasPermission(r, PermissionRead) || pc.publicPageSet(r.Context())[pagepath]
+}
+
+// PageFilter returns which pages the current user may read, looking the
+// public pages up once.
+func (pc *PermissionChecker) PageFilter(r *http.Request) func(pagepath string) bool {
+	if pc.HasPermission(r, PermissionRead) {
+		return func(string) bool { return true }
+	}
+	public := pc.publicPageSet(r.Context())
+	return func(pagepath string) bool { return public[pagepath] }
+}
+
+// publicPageSet returns the public pages, none when they cannot be looked
+// up.
+func (pc *PermissionChecker) publicPageSet(ctx context.Context) map[string]bool {
+	if pc.publicPages == nil {
+		return nil
+	}
+	public, err := pc.publicPages(ctx)
+	if err != nil {
+		slog.Warn("failed to list public pages", "error", err)
+		return nil
+	}
+	return public
+}
+
 // HasPermission checks if the current user has the specified permission.
 func (pc *PermissionChecker) HasPermission(r *http.Request, permission string) bool {
 	user := GetUser(r)
 
 	switch permission {
 	case PermissionRead:
-		return pc.canRead(user)
+		return pc.canRead(pc.settings.Get(r.Context()).ReadAccess, user)
 	case PermissionWrite:
-		return pc.canWrite(user)
+		return pc.canWrite(pc.settings.Get(r.Context()).WriteAccess, user)
 	case PermissionUpload:
-		return pc.canUpload(user)
+		return pc.canUpload(pc.settings.Get(r.Context()).AttachmentAccess, user)
 	case PermissionAdmin:
 		return pc.canAdmin(user)
 	default:
@@ -105,10 +164,9 @@ func (pc *PermissionChecker) HasPermission(r *http.Request, permission string) b
 	}
 }
 
-// canRead checks if the user can read.
-func (pc *PermissionChecker) canRead(user *User) bool {
-	// Check config access level
-	switch pc.config.ReadAccess {
+// canRead checks if the user can read at the given access level.
+func (pc *PermissionChecker) canRead(level string, user *User) bool {
+	switch level {
 	case "ANONYMOUS":
 		return true
 	case "REGISTERED":
@@ -132,10 +190,9 @@ func (pc *PermissionChecker) canRead(user *User) bool {
 	}
 }
 
-// canWrite checks if the user can write.
-func (pc *PermissionChecker) canWrite(user *User) bool {
-	// Check config access level
-	switch pc.config.WriteAccess {
+// canWrite checks if the user can write at the given access level.
+func (pc *PermissionChecker) canWrite(level string, user *User) bool {
+	switch level {
 	case "ANONYMOUS":
 		return true
 	case "REGISTERED":
@@ -159,10 +216,9 @@ func (pc *PermissionChecker) canWrite(user *User) bool {
 	}
 }
 
-// canUpload checks if the user can upload.
-func (pc *PermissionChecker) canUpload(user *User) bool {
-	// Check config access level
-	switch pc.config.AttachmentAccess {
+// canUpload checks if the user can upload at the given access level.
+func (pc *PermissionChecker) canUpload(level string, user *User) bool {
+	switch level {
 	case "ANONYMOUS":
 		return true
 	case "REGISTERED":
@@ -9,6 +9,7 @@ import (
 	"github.com/sa/gopherwiki/internal/config"
 	"github.com/sa/gopherwiki/internal/db"
 	"github.com/sa/gopherwiki/internal/models"
+	"github.com/sa/gopherwiki/internal/settings"
 )
 
 // makeUser creates a models.User with given properties for testing.
@@ -46,7 +47,7 @@ func newChecker(readAccess, writeAccess, attachmentAccess string) *PermissionChe
 	cfg.ReadAccess = readAccess
 	cfg.WriteAccess = writeAccess
 	cfg.AttachmentAccess = attachmentAccess
-	return NewPermissionChecker(cfg, nil)
+	return NewPermissionChecker(settings.New(cfg, nil), nil)
 }
 
 // --- canRead tests ---
@@ -505,3 +506,56 @@ func TestHasPermission_UnknownPermission(t *testing.T) {
 		t.Error("unknown permission should return false")
 	}
 }
+
+// --- public page tests ---
+
+func TestCanReadPage_PublicPages(t *testing.T) {
+	pc := newChecker("REGISTERED", "ANONYMOUS", "ANONYMOUS")
+	pc.SetPublicPages(func(ctx context.Context) (map[string]bool, error) {
+		return map[string]bool{"welcome": true}, nil
+	})
+	r := requestWithUser(models.AnonymousUser())
+
+	if !pc.CanReadPage(r, "welcome") {
+		t.Error("a public page should be readable anonymously")
+	}
+	if pc.CanReadPage(r, "internal") {
+		t.Error("other pages should need read permission")
+	}
+	readable := pc.PageFilter(r)
+	if !readable("welcome") || readable("internal") {
+		t.Error("PageFilter should pass only the public page")
+	}
+
+	reader := requestWithUser(makeUser(struct {
+		ID          int64
+		Approved    bool
+		Admin       bool
+		AllowRead   bool
+		AllowWrite  bool
+		AllowUpload bool
+	}{1, true, false, true, false, false}))
+	if !pc.PageFilter(reader)("internal") {
+		t.Error("PageFilter should pass every page for a reader")
+	}
+}
+
+func TestRequireReadOrPublic(t *testing.T) {
+	pc := newChecker("REGISTERED", "ANONYMOUS", "ANONYMOUS")
+	var public map[string]bool
+	pc.SetPublicPages(func(ctx context.Context) (map[string]bool, error) { return public, nil })
+	handler := pc.RequireReadOrPublic(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, requestWithUser(models.AnonymousUser()))
+	if w.Code != http.StatusFound {
+		t.Errorf("without public pages: status = %d, want %d", w.Code, http.StatusFound)
+	}
+
+	public = map[string]bool{"welcome": true}
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, requestWithUser(models.AnonymousUser()))
+	if w.Code != http.StatusOK {
+		t.Errorf("with a public page: status = %d, want %d", w.Code, http.StatusOK)
+	}
+}
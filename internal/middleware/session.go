@@ -4,11 +4,18 @@ package middleware
 import (
 	"context"
 	"crypto/rand"
+	"crypto/sha256"
 	"crypto/subtle"
+	"database/sql"
 	"encoding/base64"
 	"encoding/gob"
+	"encoding/hex"
+	"errors"
 	"log/slog"
+	"net"
 	"net/http"
+	"strings"
+	"time"
 
 	"github.com/gorilla/sessions"
 
@@ -34,13 +41,18 @@ const (
 	FlashKey contextKey = "flash"
 	// CSRFContextKey is the context key for the current CSRF token.
 	CSRFContextKey contextKey = "csrf"
+	// SessionIDKey is the context key for the ID of the current tracked session.
+	SessionIDKey contextKey = "session_id"
 )
 
 const (
-	// SessionName is the name of the session cookie.
+	// SessionName is the name of the session cookie, before any __Host- prefix.
 	SessionName = "gopherwiki_session"
 	// UserIDKey is the session key for the user ID.
 	UserIDKey = "user_id"
+	// SessionTokenKey is the session key for the token identifying the
+	// session in the user_sessions table.
+	SessionTokenKey = "session_token"
 	// CSRFCookieName is the cookie holding the CSRF token (double-submit pattern).
 	CSRFCookieName = "gopherwiki_csrf"
 	// CSRFFieldName is the form field carrying the CSRF token.
@@ -67,52 +79,164 @@ func generateCSRFToken() string {
 	return base64.RawURLEncoding.EncodeToString(b)
 }
 
+// SessionMaxAge is how long a session cookie lives, and how long a tracked
+// session may go unused before it is pruned.
+const SessionMaxAge = 30 * 24 * time.Hour
+
+// sessionTouchInterval limits how often a session's last activity is
+// written, so that busy sessions do not cost a database write per request.
+const sessionTouchInterval = time.Minute
+
+// maxUserAgentLength caps the User-Agent stored for a session.
+const maxUserAgentLength = 512
+
+// newSessionToken returns a random token identifying a logged-in session.
+func newSessionToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// hashSessionToken returns the form in which a session token is stored, so
+// that the database alone is not enough to hijack a session.
+func hashSessionToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// ClientIP returns the IP address the request came from.
+func ClientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// hostPrefix is the cookie name prefix that makes browsers require Secure,
+// Path=/ and no Domain, so the cookie cannot be set or shadowed by a sibling
+// subdomain or a plain-HTTP response.
+const hostPrefix = "__Host-"
+
+// CookieOptions holds the attributes applied to the session and CSRF cookies.
+type CookieOptions struct {
+	Secure     bool          // Only send over HTTPS
+	SameSite   http.SameSite // Cross-site sending policy
+	Domain     string        // Empty for a host-only cookie
+	Path       string        // Defaults to "/"
+	HostPrefix bool          // Prefix cookie names with "__Host-"
+}
+
+// ParseSameSite maps a configured SameSite mode ("lax", "strict", "none") to
+// its http.SameSite value. Anything else yields Lax.
+func ParseSameSite(mode string) http.SameSite {
+	switch strings.ToLower(mode) {
+	case "strict":
+		return http.SameSiteStrictMode
+	case "none":
+		return http.SameSiteNoneMode
+	default:
+		return http.SameSiteLaxMode
+	}
+}
+
 // SessionManager handles session operations.
 type SessionManager struct {
-	store   sessions.Store
-	queries *db.Queries
-	secure  bool
+	store       sessions.Store
+	db          *db.Database
+	queries     *db.Queries
+	cookies     CookieOptions
+	sessionName string
+	csrfName    string
+
+	// external names the users of requests authenticated outside the
+	// wiki; see SetExternalAuth.
+	external func(r *http.Request) (*models.User, error)
 }
 
-// NewSessionManager creates a new SessionManager. When secure is true the
-// session and CSRF cookies are marked Secure (only sent over HTTPS).
-func NewSessionManager(secretKey string, secure bool, queries *db.Queries) *SessionManager {
+// NewSessionManager creates a new SessionManager whose session and CSRF
+// cookies carry the given attributes. Logged-in sessions are tracked in
+// the database, so that they can be listed and revoked.
+func NewSessionManager(secretKey string, cookies CookieOptions, database *db.Database) *SessionManager {
+	if cookies.Path == "" {
+		cookies.Path = "/"
+	}
+
 	// Create cookie store with the secret key
 	store := sessions.NewCookieStore([]byte(secretKey))
 	store.Options = &sessions.Options{
-		Path:     "/",
-		MaxAge:   86400 * 30, // 30 days
+		Path:     cookies.Path,
+		Domain:   cookies.Domain,
+		MaxAge:   int(SessionMaxAge / time.Second),
 		HttpOnly: true,
-		Secure:   secure,
-		SameSite: http.SameSiteLaxMode,
+		Secure:   cookies.Secure,
+		SameSite: cookies.SameSite,
 	}
 
-	return &SessionManager{
-		store:   store,
-		queries: queries,
-		secure:  secure,
+	sm := &SessionManager{
+		store:       store,
+		db:          database,
+		queries:     database.Queries,
+		cookies:     cookies,
+		sessionName: SessionName,
+		csrfName:    CSRFCookieName,
 	}
+	if cookies.HostPrefix {
+		sm.sessionName = hostPrefix + SessionName
+		sm.csrfName = hostPrefix + CSRFCookieName
+	}
+	return sm
+}
+
+// SetExternalAuth makes fn name the user of each request, for programs
+// that embed the wiki and authenticate users themselves. A nil user leaves
+// the request to the session cookie, as does an error, which is logged. It
+// must be set before the middleware serves requests.
+func (sm *SessionManager) SetExternalAuth(fn func(r *http.Request) (*models.User, error)) {
+	sm.external = fn
 }
 
 // Middleware returns the session middleware handler.
 func (sm *SessionManager) Middleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		session, err := sm.store.Get(r, SessionName)
+		session, err := sm.store.Get(r, sm.sessionName)
 		if err != nil {
 			// Invalid session, create a new one
 			slog.Warn("session error, creating new", "error", err)
-			session, err = sm.store.New(r, SessionName)
+			session, err = sm.store.New(r, sm.sessionName)
 			if err != nil {
 				slog.Warn("failed to create new session", "error", err)
 			}
 		}
 
-		// Get user from session
 		var user *models.User
-		if userID, ok := session.Values[UserIDKey].(int64); ok && userID > 0 {
-			dbUser, err := sm.queries.GetUserByID(r.Context(), userID)
-			if err == nil {
-				user = models.NewUser(&dbUser)
+		if sm.external != nil {
+			var err error
+			if user, err = sm.external(r); err != nil {
+				slog.Warn("external authentication failed", "error", err)
+				user = nil
+			}
+		}
+
+		// Get user from session
+		var sessionID int64
+		if user == nil {
+			if userID, ok := session.Values[UserIDKey].(int64); ok && userID > 0 {
+				dbUser, err := sm.queries.GetUserByID(r.Context(), userID)
+				if err == nil {
+					user = models.NewUser(&dbUser)
+				}
+			}
+
+			// A logged-in session must still be tracked: one that was
+			// revoked is logged out.
+			if user != nil {
+				var ok bool
+				if sessionID, ok = sm.checkSession(w, r, session, user.ID); !ok {
+					user = nil
+				}
 			}
 		}
 
@@ -124,24 +248,28 @@ func (sm *SessionManager) Middleware(next http.Handler) http.Handler {
 		// Add session and user to context
 		ctx := context.WithValue(r.Context(), SessionKey, session)
 		ctx = context.WithValue(ctx, UserKey, user)
+		if sessionID != 0 {
+			ctx = context.WithValue(ctx, SessionIDKey, sessionID)
+		}
 
 		// Ensure a CSRF token exists in its own cookie (double-submit pattern).
 		// Keeping it separate from the gorilla session avoids a competing
 		// Set-Cookie when a handler also saves the session in the same request.
 		csrfToken := ""
-		if c, err := r.Cookie(CSRFCookieName); err == nil {
+		if c, err := r.Cookie(sm.csrfName); err == nil {
 			csrfToken = c.Value
 		}
 		if csrfToken == "" {
 			csrfToken = generateCSRFToken()
 			http.SetCookie(w, &http.Cookie{
-				Name:     CSRFCookieName,
+				Name:     sm.csrfName,
 				Value:    csrfToken,
-				Path:     "/",
+				Path:     sm.cookies.Path,
+				Domain:   sm.cookies.Domain,
 				MaxAge:   86400 * 30, // 30 days
 				HttpOnly: true,
-				Secure:   sm.secure,
-				SameSite: http.SameSiteLaxMode,
+				Secure:   sm.cookies.Secure,
+				SameSite: sm.cookies.SameSite,
 			})
 		}
 		ctx = context.WithValue(ctx, CSRFContextKey, csrfToken)
@@ -158,6 +286,95 @@ func (sm *SessionManager) Middleware(next http.Handler) http.Handler {
 	})
 }
 
+// checkSession looks up the tracked session behind a logged-in cookie and
+// records activity on it. It returns the session's ID, or false if the
+// session was revoked, in which case the cookie is logged out. Sessions from
+// before tracking began are tracked from their next request.
+func (sm *SessionManager) checkSession(w http.ResponseWriter, r *http.Request, session *sessions.Session, userID int64) (int64, bool) {
+	ctx := r.Context()
+	token, _ := session.Values[SessionTokenKey].(string)
+	if token == "" {
+		id, err := sm.startSession(r, session, userID)
+		if err != nil {
+			slog.Warn("failed to track session", "error", err)
+			return 0, false
+		}
+		if err := session.Save(r, w); err != nil {
+			slog.Warn("failed to save session", "error", err)
+		}
+		return id, true
+	}
+
+	hash := hashSessionToken(token)
+	tracked, err := sm.db.GetUserSession(ctx, hash)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && tracked.UserID != userID) {
+		delete(session.Values, UserIDKey)
+		delete(session.Values, SessionTokenKey)
+		if err := session.Save(r, w); err != nil {
+			slog.Warn("failed to save session", "error", err)
+		}
+		return 0, false
+	}
+	if err != nil {
+		slog.Warn("failed to look up session", "error", err)
+		return 0, false
+	}
+
+	ip := ClientIP(r)
+	if time.Since(tracked.LastSeen) >= sessionTouchInterval || tracked.IP != ip {
+		if err := sm.db.TouchUserSession(ctx, hash, ip); err != nil {
+			slog.Warn("failed to update session activity", "error", err)
+		}
+	}
+	return tracked.ID, true
+}
+
+// startSession records a new tracked session for userID and stores its
+// token in session. Stale sessions of any user are pruned on the way.
+func (sm *SessionManager) startSession(r *http.Request, session *sessions.Session, userID int64) (int64, error) {
+	ctx := r.Context()
+	if err := sm.db.PruneUserSessions(ctx, time.Now().Add(-SessionMaxAge)); err != nil {
+		slog.Warn("failed to prune stale sessions", "error", err)
+	}
+
+	token, err := newSessionToken()
+	if err != nil {
+		return 0, err
+	}
+	userAgent := r.UserAgent()
+	if len(userAgent) > maxUserAgentLength {
+		userAgent = userAgent[:maxUserAgentLength]
+	}
+	id, err := sm.db.CreateUserSession(ctx, hashSessionToken(token), userID, userAgent, ClientIP(r))
+	if err != nil {
+		return 0, err
+	}
+	session.Values[UserIDKey] = userID
+	session.Values[SessionTokenKey] = token
+	return id, nil
+}
+
+// endSession removes the tracked session whose token session holds.
+func (sm *SessionManager) endSession(r *http.Request, session *sessions.Session) {
+	token, _ := session.Values[SessionTokenKey].(string)
+	if token == "" {
+		return
+	}
+	if err := sm.db.DeleteUserSessionByToken(r.Context(), hashSessionToken(token)); err != nil {
+		slog.Warn("failed to delete session", "error", err)
+	}
+	delete(session.Values, SessionTokenKey)
+}
+
+// GetSessionID returns the ID of the current request's tracked session, or 0
+// for an anonymous request.
+func GetSessionID(r *http.Request) int64 {
+	if id, ok := r.Context().Value(SessionIDKey).(int64); ok {
+		return id
+	}
+	return 0
+}
+
 // GetCSRFToken returns the CSRF token for the current request, or "".
 func GetCSRFToken(r *http.Request) string {
 	if t, ok := r.Context().Value(CSRFContextKey).(string); ok {
@@ -223,27 +440,32 @@ func (sm *SessionManager) Login(w http.ResponseWriter, r *http.Request, userID i
 	session := GetSession(r)
 	if session == nil {
 		var err error
-		session, err = sm.store.Get(r, SessionName)
+		session, err = sm.store.Get(r, sm.sessionName)
 		if err != nil {
 			return err
 		}
 	}
 
-	session.Values[UserIDKey] = userID
+	// A fresh login replaces any session this cookie held before.
+	sm.endSession(r, session)
+	if _, err := sm.startSession(r, session, userID); err != nil {
+		return err
+	}
 	return session.Save(r, w)
 }
 
-// Logout removes the user ID from the session.
+// Logout removes the user ID from the session and stops tracking it.
 func (sm *SessionManager) Logout(w http.ResponseWriter, r *http.Request) error {
 	session := GetSession(r)
 	if session == nil {
 		var err error
-		session, err = sm.store.Get(r, SessionName)
+		session, err = sm.store.Get(r, sm.sessionName)
 		if err != nil {
 			return err
 		}
 	}
 
+	sm.endSession(r, session)
 	delete(session.Values, UserIDKey)
 	return session.Save(r, w)
 }
@@ -253,7 +475,7 @@ func (sm *SessionManager) AddFlash(w http.ResponseWriter, r *http.Request, messa
 	session := GetSession(r)
 	if session == nil {
 		var err error
-		session, err = sm.store.Get(r, SessionName)
+		session, err = sm.store.Get(r, sm.sessionName)
 		if err != nil {
 			return err
 		}
@@ -274,7 +496,7 @@ func (sm *SessionManager) AddFlashMessage(w http.ResponseWriter, r *http.Request
 	session := GetSession(r)
 	if session == nil {
 		var err error
-		session, err = sm.store.Get(r, SessionName)
+		session, err = sm.store.Get(r, sm.sessionName)
 		if err != nil {
 			return err
 		}
@@ -54,7 +54,7 @@ func createTestUser(t *testing.T, database *db.Database, name, email string) int
 
 func newTestSessionManager(t *testing.T, database *db.Database) *SessionManager {
 	t.Helper()
-	return NewSessionManager("test-secret-key-for-tests", false, database.Queries)
+	return NewSessionManager("test-secret-key-for-tests", CookieOptions{SameSite: http.SameSiteLaxMode}, database)
 }
 
 // --- CSRF tests ---
@@ -150,6 +150,64 @@ func TestNewSessionManager(t *testing.T) {
 	}
 }
 
+func TestNewSessionManager_CookieOptions(t *testing.T) {
+	database := openTestDB(t)
+	sm := NewSessionManager("test-secret-key-for-tests", CookieOptions{
+		Secure:     true,
+		SameSite:   http.SameSiteNoneMode,
+		HostPrefix: true,
+	}, database)
+	userID := createTestUser(t, database, "Alice", "alice@example.com")
+
+	handler := sm.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := sm.Login(w, r, userID); err != nil {
+			t.Fatalf("login failed: %v", err)
+		}
+	}))
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/login", nil))
+
+	cookies := w.Result().Cookies()
+	names := map[string]bool{}
+	for _, c := range cookies {
+		names[c.Name] = true
+		if !c.Secure || c.SameSite != http.SameSiteNoneMode || c.Path != "/" || c.Domain != "" {
+			t.Errorf("cookie %s: Secure=%v SameSite=%v Path=%q Domain=%q", c.Name, c.Secure, c.SameSite, c.Path, c.Domain)
+		}
+	}
+	if !names["__Host-"+SessionName] || !names["__Host-"+CSRFCookieName] {
+		t.Errorf("cookies = %v, want __Host- prefixed session and CSRF cookies", names)
+	}
+
+	// The prefixed session cookie is read back on the next request.
+	var gotUser *models.User
+	handler = sm.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotUser = GetUser(r)
+	}))
+	r := httptest.NewRequest("GET", "/", nil)
+	for _, c := range cookies {
+		r.AddCookie(c)
+	}
+	handler.ServeHTTP(httptest.NewRecorder(), r)
+	if gotUser.IsAnonymous() {
+		t.Error("user should be authenticated via the prefixed session cookie")
+	}
+}
+
+func TestParseSameSite(t *testing.T) {
+	tests := map[string]http.SameSite{
+		"lax":    http.SameSiteLaxMode,
+		"Strict": http.SameSiteStrictMode,
+		"none":   http.SameSiteNoneMode,
+		"":       http.SameSiteLaxMode,
+	}
+	for mode, want := range tests {
+		if got := ParseSameSite(mode); got != want {
+			t.Errorf("ParseSameSite(%q) = %v, want %v", mode, got, want)
+		}
+	}
+}
+
 // --- Middleware tests ---
 
 func TestMiddleware_AnonymousUser(t *testing.T) {
@@ -174,6 +232,40 @@ func TestMiddleware_AnonymousUser(t *testing.T) {
 	}
 }
 
+func TestMiddleware_ExternalAuth(t *testing.T) {
+	database := openTestDB(t)
+	sm := newTestSessionManager(t, database)
+	userID := createTestUser(t, database, "Embedded", "embedded@example.com")
+	sm.SetExternalAuth(func(r *http.Request) (*models.User, error) {
+		if r.Header.Get("X-Test-User") == "" {
+			return nil, nil
+		}
+		dbUser, err := database.Queries.GetUserByID(r.Context(), userID)
+		if err != nil {
+			return nil, err
+		}
+		return models.NewUser(&dbUser), nil
+	})
+
+	var gotUser *models.User
+	handler := sm.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotUser = GetUser(r)
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("X-Test-User", "yes")
+	handler.ServeHTTP(httptest.NewRecorder(), r)
+	if gotUser == nil || gotUser.ID != userID {
+		t.Fatalf("user = %v, want the externally authenticated user %d", gotUser, userID)
+	}
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	if gotUser == nil || !gotUser.IsAnonymous() {
+		t.Error("user should be anonymous when the external hook names nobody")
+	}
+}
+
 func TestMiddleware_AuthenticatedUser(t *testing.T) {
 	database := openTestDB(t)
 	sm := newTestSessionManager(t, database)
@@ -520,6 +612,88 @@ func TestAddFlashMessage(t *testing.T) {
 	}
 }
 
+func TestMiddleware_RevokedSessionIsLoggedOut(t *testing.T) {
+	database := openTestDB(t)
+	sm := newTestSessionManager(t, database)
+	userID := createTestUser(t, database, "Erin", "erin@example.com")
+
+	loginHandler := sm.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := sm.Login(w, r, userID); err != nil {
+			t.Fatalf("login failed: %v", err)
+		}
+	}))
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/login", nil)
+	r.Header.Set("User-Agent", "TestAgent/1.0")
+	loginHandler.ServeHTTP(w, r)
+	cookies := w.Result().Cookies()
+
+	sessions, err := database.ListUserSessions(context.Background(), userID)
+	if err != nil || len(sessions) != 1 || sessions[0].UserAgent != "TestAgent/1.0" {
+		t.Fatalf("tracked sessions = %+v, %v; want one with the login's user agent", sessions, err)
+	}
+
+	var gotUser *models.User
+	var gotSessionID int64
+	handler := sm.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotUser = GetUser(r)
+		gotSessionID = GetSessionID(r)
+	}))
+	request := func() {
+		r := httptest.NewRequest("GET", "/", nil)
+		for _, c := range cookies {
+			r.AddCookie(c)
+		}
+		handler.ServeHTTP(httptest.NewRecorder(), r)
+	}
+
+	request()
+	if gotUser.IsAnonymous() || gotSessionID != sessions[0].ID {
+		t.Fatalf("before revoking: anonymous = %v, session ID = %d; want logged in to session %d",
+			gotUser.IsAnonymous(), gotSessionID, sessions[0].ID)
+	}
+
+	if _, err := database.DeleteUserSessions(context.Background(), userID); err != nil {
+		t.Fatalf("DeleteUserSessions failed: %v", err)
+	}
+	request()
+	if !gotUser.IsAnonymous() || gotSessionID != 0 {
+		t.Error("a revoked session should be anonymous")
+	}
+}
+
+func TestLogout_EndsTrackedSession(t *testing.T) {
+	database := openTestDB(t)
+	sm := newTestSessionManager(t, database)
+	userID := createTestUser(t, database, "Frank", "frank@example.com")
+
+	handler := sm.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var err error
+		if r.URL.Path == "/login" {
+			err = sm.Login(w, r, userID)
+		} else {
+			err = sm.Logout(w, r)
+		}
+		if err != nil {
+			t.Fatalf("%s failed: %v", r.URL.Path, err)
+		}
+	}))
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("POST", "/login", nil))
+	cookies := w.Result().Cookies()
+
+	r := httptest.NewRequest("POST", "/logout", nil)
+	for _, c := range cookies {
+		r.AddCookie(c)
+	}
+	handler.ServeHTTP(httptest.NewRecorder(), r)
+
+	sessions, _ := database.ListUserSessions(context.Background(), userID)
+	if len(sessions) != 0 {
+		t.Errorf("sessions after logout = %+v, want none", sessions)
+	}
+}
+
 // --- Login without middleware (fallback to store.Get) ---
 
 func TestLogin_WithoutMiddleware(t *testing.T) {
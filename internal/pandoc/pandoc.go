@@ -0,0 +1,408 @@
+// Package pandoc integrates the Pandoc CLI to export wiki pages as documents
+// (Word, OpenDocument, EPUB, and PDF through a configured PDF engine).
+//
+// Like the Quarto integration it is optional and feature-detected: without a
+// pandoc binary the converter is simply absent and the formats it provides
+// are not offered. Pandoc runs with --sandbox, so it reads no file but the
+// page source, and raw HTML and TeX are not accepted. Images are resolved
+// against the document Pandoc parses: the page's attachments are embedded as
+// data URIs, and every other image is turned into a link, so an export never
+// reads the server's files or makes it fetch from the network.
+package pandoc
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrUnavailable is returned when a conversion is requested but no usable
+// pandoc binary was found.
+var ErrUnavailable = errors.New("pandoc: conversion unavailable")
+
+// Default conversion tuning.
+const (
+	defaultTimeout     = 120 * time.Second
+	defaultConcurrency = 2
+	detectTimeout      = 10 * time.Second
+)
+
+// minVersion is the oldest Pandoc with --sandbox. Without it a page could
+// have an export read any file the server can, so older versions are treated
+// as unavailable.
+var minVersion = [2]int{2, 19}
+
+// inputFormat is the Markdown dialect pages are read as. The wiki renders
+// single newlines as line breaks; raw HTML and TeX are turned off so that a
+// page cannot reach the output format's own ways of including files.
+const inputFormat = "markdown-raw_html-raw_tex-raw_attribute+hard_line_breaks"
+
+// Capabilities describes the Pandoc binary on this host. It is determined
+// once at startup via Detect.
+type Capabilities struct {
+	// Available is true when a usable pandoc binary was found, one recent
+	// enough to convert in a sandbox.
+	Available bool
+	// Version is the first line of `pandoc --version` (empty when unavailable).
+	Version string
+	// Path is the resolved absolute path to the pandoc binary.
+	Path string
+}
+
+// Detect probes for a usable Pandoc binary. path may be a bare name resolved
+// via PATH or an absolute path; an empty path defaults to "pandoc". A missing
+// or non-functioning binary, or one older than minVersion, yields
+// Capabilities{Available: false}.
+func Detect(ctx context.Context, path string) Capabilities {
+	if path == "" {
+		path = "pandoc"
+	}
+	resolved, err := exec.LookPath(path)
+	if err != nil {
+		return Capabilities{}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, detectTimeout)
+	defer cancel()
+	out, err := exec.CommandContext(ctx, resolved, "--version").Output()
+	if err != nil {
+		return Capabilities{Path: resolved}
+	}
+	version, _, _ := strings.Cut(string(out), "\n")
+	version = strings.TrimSpace(version)
+	return Capabilities{Available: supportsSandbox(version), Version: version, Path: resolved}
+}
+
+// supportsSandbox reports whether a `pandoc --version` line such as
+// "pandoc 3.1.11" names minVersion or later.
+func supportsSandbox(version string) bool {
+	fields := strings.Fields(version)
+	if len(fields) < 2 {
+		return false
+	}
+	parts := strings.Split(fields[1], ".")
+	for i, want := range minVersion {
+		if i >= len(parts) {
+			return false
+		}
+		n, err := strconv.Atoi(parts[i])
+		if err != nil {
+			return false
+		}
+		if n != want {
+			return n > want
+		}
+	}
+	return true
+}
+
+// Format describes one document format Pandoc produces for a page. To is the
+// `pandoc --to` token; Ext is the output file extension (without a leading
+// dot); MediaType is the HTTP Content-Type to serve it with.
+type Format struct {
+	Name      string // stable identifier used in URLs (e.g. "odt")
+	Label     string // human label for menus (e.g. "OpenDocument (ODT)")
+	To        string
+	Ext       string
+	MediaType string
+}
+
+// documentFormats is the ordered registry of Pandoc document formats. PDF is
+// listed separately because it also needs a PDF engine.
+var documentFormats = []Format{
+	{Name: "docx", Label: "Word (DOCX)", To: "docx", Ext: "docx", MediaType: "application/vnd.openxmlformats-officedocument.wordprocessingml.document"},
+	{Name: "odt", Label: "OpenDocument (ODT)", To: "odt", Ext: "odt", MediaType: "application/vnd.oasis.opendocument.text"},
+	{Name: "epub", Label: "EPUB", To: "epub", Ext: "epub", MediaType: "application/epub+zip"},
+}
+
+var pdfFormat = Format{Name: "pdf", Label: "PDF", To: "pdf", Ext: "pdf", MediaType: "application/pdf"}
+
+// Input is one page to convert.
+type Input struct {
+	// AttachmentDir is the repository directory holding the page's
+	// attachments, e.g. "docs/report".
+	AttachmentDir string
+	// Source is the page source prepared for export, including frontmatter.
+	// Pandoc takes the document title and metadata from the frontmatter.
+	Source string
+	// Resources are the files the page may show as images, such as its
+	// attachments, keyed by their path in the repository
+	// ("docs/report/chart.png").
+	Resources map[string][]byte
+}
+
+// Runner executes an external command in a working directory. It is the
+// seam that lets tests substitute the real pandoc invocation.
+type Runner interface {
+	Run(ctx context.Context, dir, name string, args ...string) (stdout, stderr []byte, err error)
+}
+
+// execRunner runs commands via os/exec with a minimal environment, keeping
+// application secrets out of the converter's process.
+type execRunner struct{}
+
+func (execRunner) Run(ctx context.Context, dir, name string, args ...string) ([]byte, []byte, error) {
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Dir = dir
+	var env []string
+	for _, key := range []string{"PATH", "HOME", "TMPDIR", "LANG", "LC_ALL"} {
+		if value, ok := os.LookupEnv(key); ok {
+			env = append(env, key+"="+value)
+		}
+	}
+	cmd.Env = env
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	err := cmd.Run()
+	return stdout.Bytes(), stderr.Bytes(), err
+}
+
+// Converter produces document exports with Pandoc. It is safe for
+// concurrent use; conversions beyond the concurrency limit wait their turn.
+type Converter struct {
+	caps      Capabilities
+	pdfEngine string
+	timeout   time.Duration
+	runner    Runner
+	sem       chan struct{}
+	workRoot  string
+}
+
+// NewConverter returns a converter for the detected pandoc binary. pdfEngine
+// names the program Pandoc produces PDF with (e.g. "typst" or "weasyprint");
+// PDF is offered only when it is set. A non-positive timeout uses the
+// default.
+func NewConverter(caps Capabilities, pdfEngine string, timeout time.Duration) *Converter {
+	if timeout <= 0 {
+		timeout = defaultTimeout
+	}
+	return &Converter{
+		caps:      caps,
+		pdfEngine: pdfEngine,
+		timeout:   timeout,
+		runner:    execRunner{},
+		sem:       make(chan struct{}, defaultConcurrency),
+	}
+}
+
+// Formats returns the formats this converter can produce, or nil when pandoc
+// is unavailable.
+func (c *Converter) Formats() []Format {
+	if !c.caps.Available {
+		return nil
+	}
+	formats := make([]Format, len(documentFormats), len(documentFormats)+1)
+	copy(formats, documentFormats)
+	if c.pdfEngine != "" {
+		formats = append([]Format{pdfFormat}, formats...)
+	}
+	return formats
+}
+
+// lookupFormat finds one of the converter's formats by its Name.
+func (c *Converter) lookupFormat(name string) (Format, bool) {
+	for _, f := range c.Formats() {
+		if f.Name == name {
+			return f, true
+		}
+	}
+	return Format{}, false
+}
+
+// Convert renders a page to the named format and returns the output bytes
+// along with the resolved format descriptor.
+//
+// Pandoc first parses the source, written to a fresh temporary directory that
+// is always removed afterwards, into its document tree. Images in the tree
+// resolve as they do in the browser: site-absolute ones
+// ("/docs/report/chart.png") against the repository root, relative ones
+// against the page's attachment directory and then its parent. One found
+// among the resources is embedded; any other becomes a link. Pandoc then
+// writes the document from that tree.
+func (c *Converter) Convert(ctx context.Context, in Input, name string) ([]byte, Format, error) {
+	if !c.caps.Available {
+		return nil, Format{}, ErrUnavailable
+	}
+	f, ok := c.lookupFormat(name)
+	if !ok {
+		return nil, Format{}, fmt.Errorf("pandoc: unknown export format %q", name)
+	}
+
+	select {
+	case c.sem <- struct{}{}:
+		defer func() { <-c.sem }()
+	case <-ctx.Done():
+		return nil, Format{}, ctx.Err()
+	}
+
+	dir, err := os.MkdirTemp(c.workRoot, "gopherwiki-pandoc-*")
+	if err != nil {
+		return nil, Format{}, fmt.Errorf("pandoc: create work dir: %w", err)
+	}
+	defer os.RemoveAll(dir)
+
+	const srcName, treeName = "page.md", "page.json"
+	if err := os.WriteFile(filepath.Join(dir, srcName), []byte(in.Source), 0o600); err != nil {
+		return nil, Format{}, fmt.Errorf("pandoc: write source: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+	tree, err := c.run(ctx, dir, srcName, "--from", inputFormat, "--to", "json")
+	if err != nil {
+		return nil, Format{}, err
+	}
+	if tree, err = resolveImages(tree, in); err != nil {
+		return nil, Format{}, err
+	}
+	if err := os.WriteFile(filepath.Join(dir, treeName), tree, 0o600); err != nil {
+		return nil, Format{}, fmt.Errorf("pandoc: write document: %w", err)
+	}
+
+	outName := "page." + f.Ext
+	args := []string{
+		treeName,
+		"--from", "json",
+		"--to", f.To,
+		"--standalone",
+		"--output", outName,
+	}
+	if f.Name == pdfFormat.Name {
+		args = append(args, "--pdf-engine", c.pdfEngine)
+	}
+	if _, err := c.run(ctx, dir, args...); err != nil {
+		return nil, Format{}, err
+	}
+
+	out, err := os.ReadFile(filepath.Join(dir, outName))
+	if err != nil {
+		return nil, Format{}, fmt.Errorf("pandoc: read output: %w", err)
+	}
+	return out, f, nil
+}
+
+// run runs pandoc in its sandbox in dir, returning what it wrote to stdout.
+func (c *Converter) run(ctx context.Context, dir string, args ...string) ([]byte, error) {
+	stdout, stderr, err := c.runner.Run(ctx, dir, c.caps.Path, append([]string{"--sandbox"}, args...)...)
+	if err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			return nil, fmt.Errorf("pandoc: conversion timed out after %s", c.timeout)
+		}
+		return nil, fmt.Errorf("pandoc: conversion failed: %w: %s", err, string(stderr))
+	}
+	return stdout, nil
+}
+
+// resolveImages rewrites the images of a Pandoc JSON document tree for
+// export: those found among in.Resources are embedded as data URIs, data URIs
+// are kept, and every other image becomes a link to its source. Raw content,
+// which the input format should not have produced, is turned into code.
+func resolveImages(tree []byte, in Input) ([]byte, error) {
+	dec := json.NewDecoder(bytes.NewReader(tree))
+	dec.UseNumber()
+	var doc any
+	if err := dec.Decode(&doc); err != nil {
+		return nil, fmt.Errorf("pandoc: read document: %w", err)
+	}
+	walkElements(doc, func(el map[string]any) {
+		c, _ := el["c"].([]any)
+		switch el["t"] {
+		case "Image":
+			// Image and Link share their contents: attributes, text, and
+			// the target as [url, title].
+			var src string
+			if len(c) == 3 {
+				if target, ok := c[2].([]any); ok && len(target) == 2 {
+					src, _ = target[0].(string)
+				}
+			}
+			if strings.HasPrefix(src, "data:") {
+				return
+			}
+			if embedded, ok := embedImage(src, in); ok {
+				c[2].([]any)[0] = embedded
+				return
+			}
+			el["t"] = "Link"
+			if text, ok := c[1].([]any); len(c) == 3 && ok && len(text) == 0 {
+				c[1] = []any{map[string]any{"t": "Str", "c": src}}
+			}
+		case "RawInline", "RawBlock":
+			// [format, text] becomes [attributes, text].
+			if len(c) == 2 {
+				c[0] = []any{"", []any{}, []any{}}
+			}
+			if el["t"] == "RawInline" {
+				el["t"] = "Code"
+			} else {
+				el["t"] = "CodeBlock"
+			}
+		}
+	})
+	out, err := json.Marshal(doc)
+	if err != nil {
+		return nil, fmt.Errorf("pandoc: write document: %w", err)
+	}
+	return out, nil
+}
+
+// walkElements calls fn for every element of a Pandoc JSON value, outermost
+// first.
+func walkElements(v any, fn func(map[string]any)) {
+	switch v := v.(type) {
+	case []any:
+		for _, item := range v {
+			walkElements(item, fn)
+		}
+	case map[string]any:
+		if _, ok := v["t"].(string); ok {
+			fn(v)
+		}
+		for _, item := range v {
+			walkElements(item, fn)
+		}
+	}
+}
+
+// embedImage returns the resource an image's source names as a data URI.
+// Only sources without a scheme or host are looked up.
+func embedImage(src string, in Input) (string, bool) {
+	u, err := url.Parse(src)
+	if err != nil || u.Scheme != "" || u.Host != "" || u.Path == "" {
+		return "", false
+	}
+	var candidates []string
+	if strings.HasPrefix(u.Path, "/") {
+		candidates = []string{path.Clean(u.Path)[1:]}
+	} else {
+		candidates = []string{path.Join(in.AttachmentDir, u.Path), path.Join(path.Dir(in.AttachmentDir), u.Path)}
+	}
+	for _, name := range candidates {
+		content, ok := in.Resources[name]
+		if !ok {
+			continue
+		}
+		mediaType := mime.TypeByExtension(path.Ext(name))
+		if mediaType == "" {
+			mediaType = http.DetectContentType(content)
+		}
+		mediaType, _, _ = strings.Cut(mediaType, ";")
+		return "data:" + mediaType + ";base64," + base64.StdEncoding.EncodeToString(content), true
+	}
+	return "", false
+}
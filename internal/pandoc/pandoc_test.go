@@ -0,0 +1,264 @@
+package pandoc
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeRunner records the invocations and the files of the work directory,
+// answers the parse with tree, and writes the output file named by --output.
+type fakeRunner struct {
+	calls    [][]string
+	gotArgs  []string
+	gotFiles map[string]string
+	tree     string
+	err      error
+}
+
+func (f *fakeRunner) Run(_ context.Context, dir, _ string, args ...string) ([]byte, []byte, error) {
+	f.calls = append(f.calls, args)
+	f.gotArgs = args
+	f.gotFiles = make(map[string]string)
+	filepath.WalkDir(dir, func(p string, d os.DirEntry, err error) error {
+		if err == nil && !d.IsDir() {
+			content, _ := os.ReadFile(p)
+			rel, _ := filepath.Rel(dir, p)
+			f.gotFiles[filepath.ToSlash(rel)] = string(content)
+		}
+		return nil
+	})
+	if f.err != nil {
+		return nil, []byte("boom"), f.err
+	}
+	if strings.Contains(strings.Join(args, " "), "--to json") {
+		if f.tree == "" {
+			return []byte(`{"pandoc-api-version":[1,23,1],"meta":{},"blocks":[]}`), nil, nil
+		}
+		return []byte(f.tree), nil, nil
+	}
+	for i, arg := range args {
+		if arg == "--output" && i+1 < len(args) {
+			os.WriteFile(filepath.Join(dir, args[i+1]), []byte("DOC"), 0o600)
+		}
+	}
+	return nil, nil, nil
+}
+
+func testConverter(pdfEngine string, runner Runner) *Converter {
+	c := NewConverter(Capabilities{Available: true, Path: "/usr/bin/pandoc"}, pdfEngine, time.Second)
+	c.runner = runner
+	return c
+}
+
+func TestConvertParsesThenWritesInSandbox(t *testing.T) {
+	fr := &fakeRunner{}
+	c := testConverter("", fr)
+
+	in := Input{
+		AttachmentDir: "docs/report",
+		Source:        "# Report\n\n![chart](chart.png)\n",
+		Resources:     map[string][]byte{"docs/report/chart.png": []byte("PNG")},
+	}
+	out, f, err := c.Convert(context.Background(), in, "odt")
+	if err != nil {
+		t.Fatalf("Convert: %v", err)
+	}
+	if string(out) != "DOC" || f.Ext != "odt" {
+		t.Errorf("Convert = %q, %+v", out, f)
+	}
+	if len(fr.calls) != 2 {
+		t.Fatalf("pandoc ran %d times, want 2: %q", len(fr.calls), fr.calls)
+	}
+
+	parse := strings.Join(fr.calls[0], " ")
+	if want := "--sandbox page.md --from markdown-raw_html-raw_tex-raw_attribute+hard_line_breaks --to json"; parse != want {
+		t.Errorf("parse args = %q, want %q", parse, want)
+	}
+	write := strings.Join(fr.calls[1], " ")
+	if want := "--sandbox page.json --from json --to odt --standalone --output page.odt"; write != want {
+		t.Errorf("write args = %q, want %q", write, want)
+	}
+	if fr.gotFiles["page.md"] != in.Source {
+		t.Errorf("page.md = %q, want the source", fr.gotFiles["page.md"])
+	}
+	if len(fr.gotFiles) != 2 {
+		// Resources reach pandoc only inside the document.
+		t.Errorf("work dir files = %v, want just the source and its document", fr.gotFiles)
+	}
+}
+
+func TestResolveImages(t *testing.T) {
+	image := func(alt, src string) string {
+		text := "[]"
+		if alt != "" {
+			text = `[{"t":"Str","c":"` + alt + `"}]`
+		}
+		return `{"t":"Image","c":[["",[],[]],` + text + `,["` + src + `",""]]}`
+	}
+	// The images Pandoc parses from ![a](chart.png), ![b](/docs/chart.png),
+	// ![c](../../../../etc/passwd), ![d][r] with [r]: /var/lib/gopherwiki/wiki.db,
+	// ![e](file:///etc/passwd), ![](https://example.com/logo.png), and
+	// ![f](data:image/gif;base64,R0lG), with raw content the input format
+	// keeps out.
+	tree := `{"pandoc-api-version":[1,23,1],"meta":{},"blocks":[{"t":"Para","c":[` +
+		strings.Join([]string{
+			image("a", "chart.png"),
+			image("b", "/docs/chart.png"),
+			image("c", "../../../../etc/passwd"),
+			image("d", "/var/lib/gopherwiki/wiki.db"),
+			image("e", "file:///etc/passwd"),
+			image("", "https://example.com/logo.png"),
+			image("f", "data:image/gif;base64,R0lG"),
+			`{"t":"RawInline","c":["html","<img src=\"/etc/passwd\">"]}`,
+		}, ",") +
+		`]},{"t":"RawBlock","c":["latex","\\input{/etc/passwd}"]}]}`
+	in := Input{
+		AttachmentDir: "docs/report",
+		Resources: map[string][]byte{
+			"docs/report/chart.png": []byte("PNG"),
+			"docs/chart.png":        []byte("GIF"),
+		},
+	}
+	out, err := resolveImages([]byte(tree), in)
+	if err != nil {
+		t.Fatalf("resolveImages: %v", err)
+	}
+
+	var doc struct {
+		Blocks []struct {
+			T string          `json:"t"`
+			C json.RawMessage `json:"c"`
+		} `json:"blocks"`
+	}
+	if err := json.Unmarshal(out, &doc); err != nil {
+		t.Fatal(err)
+	}
+	var inlines []struct {
+		T string `json:"t"`
+		C []any  `json:"c"`
+	}
+	if err := json.Unmarshal(doc.Blocks[0].C, &inlines); err != nil {
+		t.Fatal(err)
+	}
+	target := func(i int) string { return inlines[i].C[2].([]any)[0].(string) }
+	for i, want := range []string{
+		"Image data:image/png;base64,UE5H",
+		"Image data:image/png;base64,R0lG",
+		"Link ../../../../etc/passwd",
+		"Link /var/lib/gopherwiki/wiki.db",
+		"Link file:///etc/passwd",
+		"Link https://example.com/logo.png",
+		"Image data:image/gif;base64,R0lG",
+	} {
+		if got := inlines[i].T + " " + target(i); got != want {
+			t.Errorf("inline %d = %q, want %q", i, got, want)
+		}
+	}
+	if text := inlines[5].C[1].([]any); len(text) != 1 {
+		t.Errorf("link without alt text has text %v, want its URL", text)
+	}
+	if inlines[7].T != "Code" || doc.Blocks[1].T != "CodeBlock" {
+		t.Errorf("raw content = %s, %s; want code", inlines[7].T, doc.Blocks[1].T)
+	}
+}
+
+func TestSupportsSandbox(t *testing.T) {
+	for version, want := range map[string]bool{
+		"pandoc 3.1.11":      true,
+		"pandoc 2.19":        true,
+		"pandoc.exe 2.19.2":  true,
+		"pandoc 2.18":        false,
+		"pandoc 1.19.2.4":    false,
+		"pandoc":             false,
+		"pandoc development": false,
+	} {
+		if got := supportsSandbox(version); got != want {
+			t.Errorf("supportsSandbox(%q) = %v, want %v", version, got, want)
+		}
+	}
+}
+
+// TestConvertWithPandoc exports a page that tries to embed files from the
+// server with the pandoc on this host, if any.
+func TestConvertWithPandoc(t *testing.T) {
+	caps := Detect(context.Background(), "")
+	if !caps.Available {
+		t.Skip("no pandoc with --sandbox on this host")
+	}
+	secret := filepath.Join(t.TempDir(), "secret.png")
+	if err := os.WriteFile(secret, []byte("TOP-SECRET-CONTENT"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	up := strings.Repeat("../", 32)
+	in := Input{
+		AttachmentDir: "docs/report",
+		Source: "# Report\n\n![chart](chart.png)\n\n![a](" + up + filepath.ToSlash(secret) + ")\n\n" +
+			"![b][r]\n\n[r]: " + filepath.ToSlash(secret) + "\n\n<img src=\"" + filepath.ToSlash(secret) + "\">\n",
+		Resources: map[string][]byte{"docs/report/chart.png": []byte("ATTACHED-IMAGE")},
+	}
+	out, _, err := NewConverter(caps, "", 0).Convert(context.Background(), in, "epub")
+	if err != nil {
+		t.Fatalf("Convert: %v", err)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(out), int64(len(out)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var all bytes.Buffer
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		io.Copy(&all, rc)
+		rc.Close()
+	}
+	if bytes.Contains(all.Bytes(), []byte("TOP-SECRET-CONTENT")) {
+		t.Error("the export embedded a file from the server")
+	}
+	if !bytes.Contains(all.Bytes(), []byte("ATTACHED-IMAGE")) {
+		t.Error("the export lacks the page's attachment")
+	}
+}
+
+func TestConvertPDFNeedsEngine(t *testing.T) {
+	if _, _, err := testConverter("", &fakeRunner{}).Convert(context.Background(), Input{Source: "x"}, "pdf"); err == nil {
+		t.Error("pdf without an engine should be an unknown format")
+	}
+
+	fr := &fakeRunner{}
+	c := testConverter("typst", fr)
+	if formats := c.Formats(); len(formats) == 0 || formats[0].Name != "pdf" {
+		t.Errorf("Formats() = %+v, want pdf first", formats)
+	}
+	if _, _, err := c.Convert(context.Background(), Input{Source: "x"}, "pdf"); err != nil {
+		t.Fatalf("Convert: %v", err)
+	}
+	if joined := strings.Join(fr.gotArgs, " "); !strings.Contains(joined, "--pdf-engine typst") {
+		t.Errorf("args %q missing the PDF engine", joined)
+	}
+}
+
+func TestConvertFailureAndUnavailable(t *testing.T) {
+	c := testConverter("", &fakeRunner{err: errors.New("exit status 1")})
+	if _, _, err := c.Convert(context.Background(), Input{Source: "x"}, "docx"); err == nil || !strings.Contains(err.Error(), "boom") {
+		t.Errorf("err = %v, want the converter's stderr", err)
+	}
+
+	unavailable := NewConverter(Capabilities{}, "typst", 0)
+	if unavailable.Formats() != nil {
+		t.Error("unavailable converter should offer no formats")
+	}
+	if _, _, err := unavailable.Convert(context.Background(), Input{}, "docx"); !errors.Is(err, ErrUnavailable) {
+		t.Errorf("err = %v, want ErrUnavailable", err)
+	}
+}
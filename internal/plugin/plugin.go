@@ -0,0 +1,223 @@
+// Package plugin lets programs built on GopherWiki extend the server
+// without patching its handlers. A plugin is a named value implementing any
+// of the hook interfaces below; a Registry runs the hooks of the plugins
+// registered with it, in the order they were registered.
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"html/template"
+	"log/slog"
+	"net/http"
+	"regexp"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/sa/gopherwiki/internal/auth"
+	"github.com/sa/gopherwiki/internal/checks"
+	"github.com/sa/gopherwiki/internal/spam"
+	"github.com/sa/gopherwiki/internal/wiki"
+)
+
+// Plugin is an extension of the server. Its name must be unique, and is
+// the path segment of the routes it serves.
+type Plugin interface {
+	Name() string
+}
+
+// BeforeSaver is a plugin told of page saves before they happen. It may
+// change the content and message; an error refuses the save, and its
+// message is shown to the user.
+type BeforeSaver interface {
+	BeforeSave(ctx context.Context, ev *wiki.SaveEvent) error
+}
+
+// AfterSaver is a plugin told of each successful page save.
+type AfterSaver interface {
+	AfterSave(ctx context.Context, ev wiki.SaveEvent)
+}
+
+// RenderFilter is a plugin that rewrites rendered HTML: pages, previews,
+// sidebars, issues, and comments. pageURL is empty for documents that are
+// not pages.
+type RenderFilter interface {
+	FilterHTML(pageURL, html string) string
+}
+
+// RouteProvider is a plugin serving routes of its own, under
+// /-/plugins/<name>. They need read access to the wiki, like its pages.
+type RouteProvider interface {
+	Routes(r chi.Router)
+}
+
+// TemplateFuncProvider is a plugin adding functions to the HTML templates.
+// It cannot replace the built-in functions.
+type TemplateFuncProvider interface {
+	TemplateFuncs() template.FuncMap
+}
+
+// AuthProvider is a plugin authenticating requests before the wiki's
+// session cookie does. It reports false for requests it does not
+// authenticate. The first provider to authenticate a request names its
+// user; the account is created on first sight of the email.
+type AuthProvider interface {
+	Authenticate(r *http.Request) (auth.Identity, bool)
+}
+
+// SpamChecker is a plugin judging the contributions of anonymous
+// visitors, such as a client of Akismet. Flagged ones wait for a moderator
+// to approve them; an error lets the contribution through.
+type SpamChecker interface {
+	CheckSpam(ctx context.Context, sub spam.Submission) (spam.Verdict, error)
+}
+
+// PageChecker is a plugin checking pages as they are saved, beside the
+// built-in checks. Its findings are recorded under the plugin's name.
+type PageChecker interface {
+	CheckPage(ctx context.Context, p checks.Page) ([]checks.Finding, error)
+}
+
+var nameRegex = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+// Registry holds the plugins of a server. The zero value is empty and
+// ready to use. Plugins must be registered before the server loads its
+// templates and builds its routes.
+type Registry struct {
+	plugins []Plugin
+}
+
+// Register adds p to the registry. Names are lowercase letters, digits,
+// hyphens, and underscores.
+func (reg *Registry) Register(p Plugin) error {
+	name := p.Name()
+	if !nameRegex.MatchString(name) {
+		return fmt.Errorf("plugin name %q must be lowercase letters, digits, hyphens, and underscores", name)
+	}
+	for _, q := range reg.plugins {
+		if q.Name() == name {
+			return fmt.Errorf("plugin %q is already registered", name)
+		}
+	}
+	reg.plugins = append(reg.plugins, p)
+	return nil
+}
+
+// Plugins returns the registered plugins.
+func (reg *Registry) Plugins() []Plugin {
+	return append([]Plugin(nil), reg.plugins...)
+}
+
+// BeforeSave runs the BeforeSave hooks, stopping at the first that refuses
+// the save.
+func (reg *Registry) BeforeSave(ctx context.Context, ev *wiki.SaveEvent) error {
+	for _, p := range reg.plugins {
+		if h, ok := p.(BeforeSaver); ok {
+			if err := h.BeforeSave(ctx, ev); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// AfterSave runs the AfterSave hooks.
+func (reg *Registry) AfterSave(ctx context.Context, ev wiki.SaveEvent) {
+	for _, p := range reg.plugins {
+		if h, ok := p.(AfterSaver); ok {
+			h.AfterSave(ctx, ev)
+		}
+	}
+}
+
+// FilterHTML passes html through the render filters.
+func (reg *Registry) FilterHTML(pageURL, html string) string {
+	for _, p := range reg.plugins {
+		if f, ok := p.(RenderFilter); ok {
+			html = f.FilterHTML(pageURL, html)
+		}
+	}
+	return html
+}
+
+// Mount adds the routes of the route providers to r, each under
+// /plugins/<name>.
+func (reg *Registry) Mount(r chi.Router) {
+	for _, p := range reg.plugins {
+		if rp, ok := p.(RouteProvider); ok {
+			r.Route("/plugins/"+p.Name(), rp.Routes)
+		}
+	}
+}
+
+// AddTemplateFuncs adds the plugins' template functions to funcs. A
+// function whose name is taken is left out and logged.
+func (reg *Registry) AddTemplateFuncs(funcs template.FuncMap) {
+	for _, p := range reg.plugins {
+		tp, ok := p.(TemplateFuncProvider)
+		if !ok {
+			continue
+		}
+		for name, fn := range tp.TemplateFuncs() {
+			if _, taken := funcs[name]; taken {
+				slog.Warn("plugin template function name is taken", "plugin", p.Name(), "function", name)
+				continue
+			}
+			funcs[name] = fn
+		}
+	}
+}
+
+// Authenticate asks the auth providers who made r.
+func (reg *Registry) Authenticate(r *http.Request) (auth.Identity, bool) {
+	for _, p := range reg.plugins {
+		if ap, ok := p.(AuthProvider); ok {
+			if id, ok := ap.Authenticate(r); ok {
+				return id, true
+			}
+		}
+	}
+	return auth.Identity{}, false
+}
+
+// CheckSpam asks the spam checkers about sub, stopping at the first that
+// flags it. A checker that fails is logged and passed over.
+func (reg *Registry) CheckSpam(ctx context.Context, sub spam.Submission) spam.Verdict {
+	for _, p := range reg.plugins {
+		sc, ok := p.(SpamChecker)
+		if !ok {
+			continue
+		}
+		v, err := sc.CheckSpam(ctx, sub)
+		if err != nil {
+			slog.Warn("spam check failed", "plugin", p.Name(), "error", err)
+			continue
+		}
+		if v.Spam {
+			return v
+		}
+	}
+	return spam.Verdict{}
+}
+
+// pageChecker is a page checker plugin as a checks.Checker.
+type pageChecker struct {
+	Plugin
+	checker PageChecker
+}
+
+func (pc pageChecker) Check(ctx context.Context, p checks.Page) ([]checks.Finding, error) {
+	return pc.checker.CheckPage(ctx, p)
+}
+
+// Checkers returns the page checkers, as checks run with the built-in
+// ones.
+func (reg *Registry) Checkers() []checks.Checker {
+	var checkers []checks.Checker
+	for _, p := range reg.plugins {
+		if pc, ok := p.(PageChecker); ok {
+			checkers = append(checkers, pageChecker{p, pc})
+		}
+	}
+	return checkers
+}
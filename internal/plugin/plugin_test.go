@@ -0,0 +1,133 @@
+package plugin
+
+import (
+	"context"
+	"errors"
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/sa/gopherwiki/internal/auth"
+	"github.com/sa/gopherwiki/internal/checks"
+	"github.com/sa/gopherwiki/internal/spam"
+	"github.com/sa/gopherwiki/internal/wiki"
+)
+
+type named string
+
+func (n named) Name() string { return string(n) }
+
+type upper struct{ named }
+
+func (upper) BeforeSave(ctx context.Context, ev *wiki.SaveEvent) error {
+	ev.Content = strings.ToUpper(ev.Content)
+	return nil
+}
+
+func (upper) FilterHTML(pageURL, html string) string { return html + "<!-- upper -->" }
+
+type veto struct{ named }
+
+func (veto) BeforeSave(ctx context.Context, ev *wiki.SaveEvent) error {
+	if strings.Contains(ev.Content, "SPAM") {
+		return errors.New("no spam")
+	}
+	return nil
+}
+
+func (veto) TemplateFuncs() template.FuncMap {
+	return template.FuncMap{"shout": strings.ToUpper, "urlquote": strings.ToLower}
+}
+
+func (upper) CheckSpam(ctx context.Context, sub spam.Submission) (spam.Verdict, error) {
+	return spam.Verdict{}, errors.New("service unavailable")
+}
+
+func (veto) CheckSpam(ctx context.Context, sub spam.Submission) (spam.Verdict, error) {
+	return spam.Verdict{Spam: strings.Contains(sub.Content, "SPAM"), Reason: "veto"}, nil
+}
+
+func (veto) Authenticate(r *http.Request) (auth.Identity, bool) {
+	email := r.Header.Get("X-User")
+	return auth.Identity{Email: email}, email != ""
+}
+
+func (veto) CheckPage(ctx context.Context, p checks.Page) ([]checks.Finding, error) {
+	return []checks.Finding{{Line: 1, Message: "vetoed " + p.Path}}, nil
+}
+
+func TestRegister(t *testing.T) {
+	var reg Registry
+	if err := reg.Register(named("ok-name_1")); err != nil {
+		t.Fatalf("Register: %v", err)
+	}
+	if err := reg.Register(named("ok-name_1")); err == nil {
+		t.Error("registered the same name twice")
+	}
+	for _, bad := range []string{"", "Upper", "a/b", "-dash"} {
+		if err := reg.Register(named(bad)); err == nil {
+			t.Errorf("registered invalid name %q", bad)
+		}
+	}
+	if got := len(reg.Plugins()); got != 1 {
+		t.Errorf("Plugins() has %d entries, want 1", got)
+	}
+}
+
+func TestRegistryHooks(t *testing.T) {
+	var reg Registry
+	reg.Register(upper{"upper"})
+	reg.Register(veto{"veto"})
+
+	// Hooks run in registration order, so the veto sees upper's content.
+	ev := &wiki.SaveEvent{Content: "spam"}
+	if err := reg.BeforeSave(context.Background(), ev); err == nil {
+		t.Error("BeforeSave accepted content the veto refuses")
+	}
+	ev = &wiki.SaveEvent{Content: "hello"}
+	if err := reg.BeforeSave(context.Background(), ev); err != nil || ev.Content != "HELLO" {
+		t.Errorf("BeforeSave = %q, %v; want HELLO, nil", ev.Content, err)
+	}
+
+	if got := reg.FilterHTML("/home", "<p>x</p>"); got != "<p>x</p><!-- upper -->" {
+		t.Errorf("FilterHTML = %q", got)
+	}
+
+	funcs := template.FuncMap{"urlquote": strings.TrimSpace}
+	reg.AddTemplateFuncs(funcs)
+	if _, ok := funcs["shout"]; !ok {
+		t.Error("plugin template function not added")
+	}
+	if got := funcs["urlquote"].(func(string) string)(" A "); got != "A" {
+		t.Error("plugin replaced a built-in template function")
+	}
+
+	r := httptest.NewRequest("GET", "/", nil)
+	if _, ok := reg.Authenticate(r); ok {
+		t.Error("authenticated a request without the header")
+	}
+	r.Header.Set("X-User", "a@example.com")
+	if id, ok := reg.Authenticate(r); !ok || id.Email != "a@example.com" {
+		t.Errorf("Authenticate = %v, %v", id, ok)
+	}
+
+	// The failing checker is passed over.
+	if v := reg.CheckSpam(context.Background(), spam.Submission{Content: "SPAM"}); !v.Spam || v.Reason != "veto" {
+		t.Errorf("CheckSpam = %+v, want flagged by veto", v)
+	}
+	if v := reg.CheckSpam(context.Background(), spam.Submission{Content: "hello"}); v.Spam {
+		t.Errorf("CheckSpam flagged clean content: %+v", v)
+	}
+
+	// Page checkers are named by their plugin.
+	checkers := reg.Checkers()
+	if len(checkers) != 1 {
+		t.Fatalf("Checkers = %v, want the veto plugin", checkers)
+	}
+	found := checks.Run(context.Background(), checks.Page{Path: "home"}, checkers)
+	if len(found) != 1 || found[0].Check != checkers[0].Name() || found[0].Message != "vetoed home" {
+		t.Errorf("findings = %+v", found)
+	}
+}
@@ -0,0 +1,235 @@
+package renderer
+
+import (
+	"html"
+	"regexp"
+	"strings"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+)
+
+// calloutMarkerRegex matches the first line of a callout blockquote:
+// "[!type]", an optional fold marker, and an optional title.
+var calloutMarkerRegex = regexp.MustCompile(`^\[!([A-Za-z][A-Za-z0-9-]*)\]([+-]?)[ \t]*`)
+
+// calloutStyles maps callout types to the five alert styles. The GitHub alert
+// types style themselves; the Obsidian types borrow the closest one.
+var calloutStyles = map[string]string{
+	"note":      "note",
+	"info":      "note",
+	"todo":      "note",
+	"abstract":  "note",
+	"summary":   "note",
+	"tldr":      "note",
+	"quote":     "note",
+	"cite":      "note",
+	"tip":       "tip",
+	"hint":      "tip",
+	"success":   "tip",
+	"check":     "tip",
+	"done":      "tip",
+	"important": "important",
+	"example":   "important",
+	"warning":   "warning",
+	"attention": "warning",
+	"question":  "warning",
+	"help":      "warning",
+	"faq":       "warning",
+	"caution":   "caution",
+	"failure":   "caution",
+	"fail":      "caution",
+	"missing":   "caution",
+	"danger":    "caution",
+	"error":     "caution",
+	"bug":       "caution",
+}
+
+var calloutIcons = map[string]string{
+	"note":      "fa-info-circle",
+	"tip":       "fa-lightbulb",
+	"important": "fa-comment-alt",
+	"warning":   "fa-exclamation-triangle",
+	"caution":   "fa-exclamation-circle",
+}
+
+// CalloutExtension renders blockquotes that open with a "[!type]" marker as
+// alert boxes. It covers GitHub alerts ("> [!NOTE]") and Obsidian callouts,
+// which add a title after the marker and make the box foldable with "+"
+// (open) or "-" (closed): "> [!tip]- Spoiler". Unknown types are styled as
+// notes.
+type CalloutExtension struct{}
+
+func (e *CalloutExtension) Extend(m goldmark.Markdown) {
+	m.Parser().AddOptions(
+		parser.WithASTTransformers(
+			util.Prioritized(&calloutTransformer{}, 100),
+		),
+	)
+	m.Renderer().AddOptions(
+		renderer.WithNodeRenderers(
+			util.Prioritized(&calloutRenderer{}, 100),
+		),
+	)
+}
+
+// Callout AST node. Its first child is the CalloutTitle, followed by the
+// blocks of the quote.
+var KindCallout = ast.NewNodeKind("Callout")
+
+type Callout struct {
+	ast.BaseBlock
+	CalloutType string // as written, lowercased
+	Style       string // one of the calloutIcons keys
+	Fold        string // "", "+", or "-"
+}
+
+func (n *Callout) Kind() ast.NodeKind {
+	return KindCallout
+}
+
+func (n *Callout) Dump(source []byte, level int) {
+	ast.DumpHelper(n, source, level, map[string]string{"Type": n.CalloutType, "Fold": n.Fold}, nil)
+}
+
+// CalloutTitle AST node. Without children the title defaults to the type.
+var KindCalloutTitle = ast.NewNodeKind("CalloutTitle")
+
+type CalloutTitle struct {
+	ast.BaseBlock
+}
+
+func (n *CalloutTitle) Kind() ast.NodeKind {
+	return KindCalloutTitle
+}
+
+func (n *CalloutTitle) Dump(source []byte, level int) {
+	ast.DumpHelper(n, source, level, nil, nil)
+}
+
+type calloutTransformer struct{}
+
+func (t *calloutTransformer) Transform(doc *ast.Document, reader text.Reader, pc parser.Context) {
+	var quotes []*ast.Blockquote
+	_ = ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if bq, ok := n.(*ast.Blockquote); ok && entering {
+			quotes = append(quotes, bq)
+		}
+		return ast.WalkContinue, nil
+	})
+	for _, bq := range quotes {
+		transformCallout(bq, reader.Source())
+	}
+}
+
+// transformCallout replaces bq with a Callout when its first paragraph opens
+// with a callout marker. The rest of the marker line becomes the title.
+func transformCallout(bq *ast.Blockquote, source []byte) {
+	para, ok := bq.FirstChild().(*ast.Paragraph)
+	if !ok || para.Lines().Len() == 0 {
+		return
+	}
+	first := para.Lines().At(0)
+	m := calloutMarkerRegex.FindSubmatchIndex(first.Value(source))
+	if m == nil {
+		return
+	}
+	calloutType := strings.ToLower(string(first.Value(source)[m[2]:m[3]]))
+	style, ok := calloutStyles[calloutType]
+	if !ok {
+		style = "note"
+	}
+	callout := &Callout{CalloutType: calloutType, Style: style, Fold: string(first.Value(source)[m[4]:m[5]])}
+	title := &CalloutTitle{}
+	callout.AppendChild(callout, title)
+
+	// Move the inline nodes of the first line, less the marker, into the
+	// title. The first line ends with the node carrying the line break.
+	markerEnd := first.Start + m[1]
+	for child := para.FirstChild(); child != nil; {
+		next := child.NextSibling()
+		endOfLine := false
+		if t, ok := child.(*ast.Text); ok {
+			endOfLine = t.SoftLineBreak() || t.HardLineBreak()
+			if t.Segment.Start < markerEnd {
+				if t.Segment.Stop <= markerEnd {
+					para.RemoveChild(para, child)
+					child = next
+					if endOfLine {
+						break
+					}
+					continue
+				}
+				t.Segment = t.Segment.WithStart(markerEnd)
+			}
+			t.SetSoftLineBreak(false)
+			t.SetHardLineBreak(false)
+		}
+		title.AppendChild(title, child)
+		child = next
+		if endOfLine {
+			break
+		}
+	}
+	if title.HasChildren() {
+		if t, ok := title.LastChild().(*ast.Text); ok {
+			t.Segment = t.Segment.TrimRightSpace(source)
+		}
+	}
+
+	if !para.HasChildren() {
+		bq.RemoveChild(bq, para)
+	}
+	for child := bq.FirstChild(); child != nil; {
+		next := child.NextSibling()
+		callout.AppendChild(callout, child)
+		child = next
+	}
+	bq.Parent().ReplaceChild(bq.Parent(), bq, callout)
+}
+
+type calloutRenderer struct{}
+
+func (r *calloutRenderer) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
+	reg.Register(KindCallout, r.renderCallout)
+	reg.Register(KindCalloutTitle, r.renderCalloutTitle)
+}
+
+func (r *calloutRenderer) renderCallout(w util.BufWriter, source []byte, n ast.Node, entering bool) (ast.WalkStatus, error) {
+	c := n.(*Callout)
+	tag := "div"
+	if c.Fold != "" {
+		tag = "details"
+	}
+	if !entering {
+		_, _ = w.WriteString("</" + tag + ">\n")
+		return ast.WalkContinue, nil
+	}
+	_, _ = w.WriteString("<" + tag + ` class="quote-alert quote-alert-` + c.Style + `" data-callout="` + html.EscapeString(c.CalloutType) + `"`)
+	if c.Fold == "+" {
+		_, _ = w.WriteString(" open")
+	}
+	_, _ = w.WriteString(">\n")
+	return ast.WalkContinue, nil
+}
+
+func (r *calloutRenderer) renderCalloutTitle(w util.BufWriter, source []byte, n ast.Node, entering bool) (ast.WalkStatus, error) {
+	c := n.Parent().(*Callout)
+	tag := "p"
+	if c.Fold != "" {
+		tag = "summary"
+	}
+	if !entering {
+		_, _ = w.WriteString("</" + tag + ">\n")
+		return ast.WalkContinue, nil
+	}
+	_, _ = w.WriteString("<" + tag + ` class="quote-alert-header"><i class="fa ` + calloutIcons[c.Style] + `" aria-hidden="true"></i>`)
+	if !n.HasChildren() {
+		_, _ = w.WriteString(html.EscapeString(strings.ToUpper(c.CalloutType[:1]) + c.CalloutType[1:]))
+	}
+	return ast.WalkContinue, nil
+}
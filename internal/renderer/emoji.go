@@ -0,0 +1,123 @@
+package renderer
+
+import (
+	_ "embed"
+	"encoding/json"
+	"sync"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+
+	"github.com/sa/gopherwiki/internal/config"
+)
+
+// emojiJSON maps shortcode names, as used on GitHub, to their emoji.
+//
+//go:embed emoji.json
+var emojiJSON []byte
+
+var (
+	emojiOnce sync.Once
+	emojiMap  map[string]string
+)
+
+// lookupEmoji returns the emoji for a shortcode name such as "smile".
+func lookupEmoji(name string) (string, bool) {
+	emojiOnce.Do(func() {
+		if err := json.Unmarshal(emojiJSON, &emojiMap); err != nil {
+			panic("renderer: invalid emoji.json: " + err.Error())
+		}
+	})
+	value, ok := emojiMap[name]
+	return value, ok
+}
+
+// EmojiExtension replaces :shortcode: names with their emoji. Code spans and
+// code blocks are not parsed for inline syntax, so shortcodes in code are
+// left alone. Unknown names are kept as written.
+type EmojiExtension struct {
+	config *config.Config
+}
+
+func (e *EmojiExtension) Extend(m goldmark.Markdown) {
+	m.Parser().AddOptions(
+		parser.WithInlineParsers(
+			util.Prioritized(&emojiParser{config: e.config}, 210),
+		),
+	)
+	m.Renderer().AddOptions(
+		renderer.WithNodeRenderers(
+			util.Prioritized(&emojiRenderer{}, 210),
+		),
+	)
+}
+
+// Emoji AST node
+var KindEmoji = ast.NewNodeKind("Emoji")
+
+type Emoji struct {
+	ast.BaseInline
+	Name  string
+	Value string
+}
+
+func (n *Emoji) Kind() ast.NodeKind {
+	return KindEmoji
+}
+
+func (n *Emoji) Dump(source []byte, level int) {
+	ast.DumpHelper(n, source, level, map[string]string{"Name": n.Name, "Value": n.Value}, nil)
+}
+
+type emojiParser struct {
+	config *config.Config
+}
+
+func (p *emojiParser) Trigger() []byte {
+	return []byte{':'}
+}
+
+func (p *emojiParser) Parse(parent ast.Node, block text.Reader, pc parser.Context) ast.Node {
+	// Read at parse time, like the other render settings.
+	if p.config != nil && !p.config.EmojiShortcodes {
+		return nil
+	}
+	line, _ := block.PeekLine()
+	end := 1
+	for end < len(line) && isEmojiNameChar(line[end]) {
+		end++
+	}
+	if end == 1 || end >= len(line) || line[end] != ':' {
+		return nil
+	}
+	name := string(line[1:end])
+	value, ok := lookupEmoji(name)
+	if !ok {
+		return nil
+	}
+	block.Advance(end + 1)
+	return &Emoji{Name: name, Value: value}
+}
+
+func isEmojiNameChar(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '_' || c == '+' || c == '-'
+}
+
+type emojiRenderer struct{}
+
+func (r *emojiRenderer) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
+	reg.Register(KindEmoji, r.render)
+}
+
+func (r *emojiRenderer) render(w util.BufWriter, source []byte, n ast.Node, entering bool) (ast.WalkStatus, error) {
+	if !entering {
+		return ast.WalkContinue, nil
+	}
+	e := n.(*Emoji)
+	w.WriteString(`<span class="emoji" role="img" aria-label="` + e.Name + `">` + e.Value + `</span>`)
+	return ast.WalkContinue, nil
+}
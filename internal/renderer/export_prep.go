@@ -115,13 +115,21 @@ func rewriteMermaidFence(line, marker string) string {
 }
 
 // rewriteInlineOutsideCode applies the inline export rewrites (wikilinks and
-// highlights) to a single line, skipping inline code spans. A code span opened
-// by a run of n backticks is closed only by a run of exactly n backticks
-// (CommonMark), so a longer backtick run inside the span does not end it early.
+// highlights) to a single line, skipping inline code spans.
 func rewriteInlineOutsideCode(line, baseURL string) string {
 	if !strings.Contains(line, "[[") && !strings.Contains(line, "==") {
 		return line
 	}
+	return mapOutsideCode(line, func(chunk string) string {
+		return applyInlineRewrites(chunk, baseURL)
+	})
+}
+
+// mapOutsideCode applies fn to the parts of line outside inline code spans. A
+// code span opened by a run of n backticks is closed only by a run of exactly n
+// backticks (CommonMark), so a longer backtick run inside the span does not end
+// it early.
+func mapOutsideCode(line string, fn func(string) string) string {
 	var b strings.Builder
 	i := 0
 	for i < len(line) {
@@ -147,7 +155,7 @@ func rewriteInlineOutsideCode(line, baseURL string) string {
 		if k := strings.IndexByte(chunk, '`'); k >= 0 {
 			chunk = chunk[:k]
 		}
-		b.WriteString(applyInlineRewrites(chunk, baseURL))
+		b.WriteString(fn(chunk))
 		i += len(chunk)
 	}
 	return b.String()
@@ -0,0 +1,339 @@
+package renderer
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"strings"
+
+	"github.com/yuin/goldmark/ast"
+	east "github.com/yuin/goldmark/extension/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/text"
+)
+
+// Gemtext converts markdown to gemtext, the line-based format of the Gemini
+// protocol. Gemtext has no inline markup, so emphasis is dropped and the
+// links of each block are listed as link lines after it. Tables and code are
+// preformatted, nested lists are flattened, and raw HTML is left out.
+// Wikilinks resolve as they do in Render, to page paths starting with "/".
+func (r *Renderer) Gemtext(source string, pageURL string) string {
+	sourceBytes := []byte(source)
+	ctx := parser.NewContext()
+	ctx.Set(currentPageKey, strings.TrimPrefix(pageURL, "/"))
+	doc := r.markdown.Parser().Parse(text.NewReader(sourceBytes), parser.WithContext(ctx))
+
+	g := &gemtextWriter{source: sourceBytes}
+	g.blocks(doc)
+	return strings.TrimLeft(g.buf.String(), "\n")
+}
+
+type gemtextLink struct {
+	url   string
+	label string
+}
+
+type gemtextWriter struct {
+	source []byte
+	buf    bytes.Buffer
+	links  []gemtextLink
+}
+
+// line writes one line of gemtext.
+func (g *gemtextWriter) line(s string) {
+	g.buf.WriteString(s)
+	g.buf.WriteByte('\n')
+}
+
+// gap separates blocks with an empty line.
+func (g *gemtextWriter) gap() {
+	if b := g.buf.Bytes(); len(b) > 0 && !bytes.HasSuffix(b, []byte("\n\n")) {
+		g.buf.WriteByte('\n')
+	}
+}
+
+// flushLinks writes the link lines collected since the last flush.
+func (g *gemtextWriter) flushLinks() {
+	if len(g.links) == 0 {
+		return
+	}
+	for _, l := range g.links {
+		if l.label == "" || l.label == l.url {
+			g.line("=> " + l.url)
+		} else {
+			g.line("=> " + l.url + " " + l.label)
+		}
+	}
+	g.links = nil
+}
+
+func (g *gemtextWriter) blocks(parent ast.Node) {
+	for n := parent.FirstChild(); n != nil; n = n.NextSibling() {
+		g.block(n)
+	}
+}
+
+func (g *gemtextWriter) block(n ast.Node) {
+	switch n := n.(type) {
+	case *ast.Heading:
+		g.gap()
+		level := min(n.Level, 3)
+		g.line(strings.Repeat("#", level) + " " + g.inline(n))
+		g.flushLinks()
+	case *ast.Paragraph, *ast.TextBlock:
+		if label, url, ok := g.soleLink(n); ok {
+			g.gap()
+			g.links = append(g.links, gemtextLink{url: url, label: label})
+			g.flushLinks()
+			return
+		}
+		if s := g.inline(n); s != "" {
+			g.gap()
+			g.line(s)
+		}
+		g.flushLinks()
+	case *ast.List:
+		g.gap()
+		g.list(n, 0)
+		g.flushLinks()
+	case *ast.Blockquote, *Callout:
+		g.gap()
+		g.quote(n)
+		g.flushLinks()
+	case *ast.FencedCodeBlock:
+		g.gap()
+		g.line("```" + string(n.Language(g.source)))
+		g.code(n)
+		g.line("```")
+	case *ast.CodeBlock:
+		g.gap()
+		g.line("```")
+		g.code(n)
+		g.line("```")
+	case *east.Table:
+		g.gap()
+		g.table(n)
+		g.flushLinks()
+	case *east.FootnoteList:
+		g.gap()
+		for item := n.FirstChild(); item != nil; item = item.NextSibling() {
+			if fn, ok := item.(*east.Footnote); ok {
+				g.line(fmt.Sprintf("[%d] %s", fn.Index, g.inlineBlocks(fn)))
+			}
+		}
+		g.flushLinks()
+	case *ast.HTMLBlock, *ast.ThematicBreak:
+	default:
+		g.blocks(n)
+	}
+}
+
+// list writes the items of a list. Gemtext lists do not nest, so items of a
+// nested list follow their parent item, indented by the depth.
+func (g *gemtextWriter) list(l *ast.List, depth int) {
+	number := l.Start
+	for item := l.FirstChild(); item != nil; item = item.NextSibling() {
+		var text []string
+		var nested []*ast.List
+		for c := item.FirstChild(); c != nil; c = c.NextSibling() {
+			if sub, ok := c.(*ast.List); ok {
+				nested = append(nested, sub)
+			} else if s := g.inlineBlocks(c); s != "" {
+				text = append(text, s)
+			}
+		}
+		prefix := strings.Repeat("  ", depth)
+		if l.IsOrdered() {
+			prefix += fmt.Sprintf("%d. ", number)
+			number++
+		}
+		g.line("* " + prefix + strings.Join(text, " "))
+		for _, sub := range nested {
+			g.list(sub, depth+1)
+		}
+	}
+}
+
+// quote writes a blockquote or callout as quote lines.
+func (g *gemtextWriter) quote(n ast.Node) {
+	for c := n.FirstChild(); c != nil; c = c.NextSibling() {
+		if s := g.inlineBlocks(c); s != "" {
+			for _, line := range strings.Split(s, "\n") {
+				g.line("> " + line)
+			}
+		}
+	}
+}
+
+func (g *gemtextWriter) code(n ast.Node) {
+	lines := n.Lines()
+	for i := 0; i < lines.Len(); i++ {
+		seg := lines.At(i)
+		g.line(strings.TrimRight(string(seg.Value(g.source)), "\n"))
+	}
+}
+
+// table writes a table as preformatted text with aligned columns.
+func (g *gemtextWriter) table(t *east.Table) {
+	var rows [][]string
+	for row := t.FirstChild(); row != nil; row = row.NextSibling() {
+		var cells []string
+		for cell := row.FirstChild(); cell != nil; cell = cell.NextSibling() {
+			cells = append(cells, g.inline(cell))
+		}
+		rows = append(rows, cells)
+	}
+	var widths []int
+	for _, row := range rows {
+		for i, cell := range row {
+			if i >= len(widths) {
+				widths = append(widths, 0)
+			}
+			widths[i] = max(widths[i], len([]rune(cell)))
+		}
+	}
+	g.line("```")
+	for r, row := range rows {
+		var b strings.Builder
+		for i, cell := range row {
+			if i > 0 {
+				b.WriteString(" | ")
+			}
+			b.WriteString(cell + strings.Repeat(" ", widths[i]-len([]rune(cell))))
+		}
+		g.line(strings.TrimRight(b.String(), " "))
+		if r == 0 {
+			var sep []string
+			for _, w := range widths {
+				sep = append(sep, strings.Repeat("-", w))
+			}
+			g.line(strings.Join(sep, "-|-"))
+		}
+	}
+	g.line("```")
+}
+
+// inlineBlocks returns the text of a block that may contain other blocks,
+// such as a list item or footnote, one line per paragraph.
+func (g *gemtextWriter) inlineBlocks(n ast.Node) string {
+	switch n.(type) {
+	case *ast.Paragraph, *ast.TextBlock, *ast.Heading, *CalloutTitle:
+		return g.inline(n)
+	case *ast.FencedCodeBlock, *ast.CodeBlock:
+		var lines []string
+		for i := 0; i < n.Lines().Len(); i++ {
+			seg := n.Lines().At(i)
+			lines = append(lines, strings.TrimRight(string(seg.Value(g.source)), "\n"))
+		}
+		return strings.Join(lines, "\n")
+	}
+	var parts []string
+	for c := n.FirstChild(); c != nil; c = c.NextSibling() {
+		if s := g.inlineBlocks(c); s != "" {
+			parts = append(parts, s)
+		}
+	}
+	return strings.Join(parts, "\n")
+}
+
+// soleLink reports whether a paragraph holds nothing but one link or image,
+// which becomes a link line without a text line repeating it.
+func (g *gemtextWriter) soleLink(n ast.Node) (label, url string, ok bool) {
+	c := n.FirstChild()
+	if c == nil || c.NextSibling() != nil {
+		return "", "", false
+	}
+	switch c := c.(type) {
+	case *ast.Link:
+		return plainText(c, g.source), string(c.Destination), true
+	case *ast.Image:
+		return plainText(c, g.source), string(c.Destination), true
+	case *WikiLink:
+		return c.LinkText, g.wikiLinkURL(c), true
+	case *Embed:
+		if c.URL != "" {
+			return embedLabel(c), c.URL, true
+		}
+	}
+	return "", "", false
+}
+
+// inline returns the text of an inline container on one line, collecting
+// its links.
+func (g *gemtextWriter) inline(n ast.Node) string {
+	var buf bytes.Buffer
+	ast.Walk(n, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+		switch n := n.(type) {
+		case *ast.Text:
+			buf.Write(n.Segment.Value(g.source))
+			if n.SoftLineBreak() || n.HardLineBreak() {
+				buf.WriteByte(' ')
+			}
+		case *ast.String:
+			// The typographer's curly quotes and dashes are HTML entities.
+			buf.WriteString(html.UnescapeString(string(n.Value)))
+		case *ast.CodeSpan:
+			buf.WriteString("`" + plainText(n, g.source) + "`")
+			return ast.WalkSkipChildren, nil
+		case *ast.Link:
+			g.links = append(g.links, gemtextLink{url: string(n.Destination), label: plainText(n, g.source)})
+		case *ast.AutoLink:
+			url := string(n.URL(g.source))
+			if n.AutoLinkType == ast.AutoLinkEmail && !strings.HasPrefix(url, "mailto:") {
+				url = "mailto:" + url
+			}
+			buf.Write(n.Label(g.source))
+			g.links = append(g.links, gemtextLink{url: url})
+			return ast.WalkSkipChildren, nil
+		case *ast.Image:
+			label := plainText(n, g.source)
+			buf.WriteString("[" + label + "]")
+			g.links = append(g.links, gemtextLink{url: string(n.Destination), label: label})
+			return ast.WalkSkipChildren, nil
+		case *WikiLink:
+			buf.WriteString(n.LinkText)
+			g.links = append(g.links, gemtextLink{url: g.wikiLinkURL(n), label: n.LinkText})
+		case *IssueRef:
+			buf.WriteString(n.LinkText)
+		case *Embed:
+			label := embedLabel(n)
+			buf.WriteString(label)
+			if n.URL != "" {
+				g.links = append(g.links, gemtextLink{url: n.URL, label: label})
+			}
+		case *Emoji:
+			buf.WriteString(n.Value)
+		case *MathInline:
+			buf.Write(n.Content)
+		case *east.TaskCheckBox:
+			if n.IsChecked {
+				buf.WriteString("[x] ")
+			} else {
+				buf.WriteString("[ ] ")
+			}
+		case *east.FootnoteLink:
+			fmt.Fprintf(&buf, "[%d]", n.Index)
+		case *ast.RawHTML, *east.FootnoteBacklink:
+			return ast.WalkSkipChildren, nil
+		}
+		return ast.WalkContinue, nil
+	})
+	return strings.TrimSpace(buf.String())
+}
+
+func (g *gemtextWriter) wikiLinkURL(wl *WikiLink) string {
+	if wl.URL != "" {
+		return wl.URL
+	}
+	return wikiLinkURL(wl.Target)
+}
+
+func embedLabel(e *Embed) string {
+	if e.Label != "" {
+		return e.Label
+	}
+	return e.Target
+}
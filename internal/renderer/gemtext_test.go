@@ -0,0 +1,38 @@
+package renderer
+
+import (
+	"testing"
+
+	"github.com/sa/gopherwiki/internal/config"
+)
+
+func TestGemtext(t *testing.T) {
+	r := New(config.Default())
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"headings", "# Title\n\n#### Deep\n", "# Title\n\n### Deep\n"},
+		{"paragraph", "Some **bold**\nand `code`.\n", "Some bold and `code`.\n"},
+		{"links", "See [[Other Page|the other page]] and [docs](https://example.com/docs).\n",
+			"See the other page and docs.\n=> /Other-Page the other page\n=> https://example.com/docs docs\n"},
+		{"sole link", "[[Setup]]\n", "=> /Setup Setup\n"},
+		{"image", "![Logo](/home/logo.png)\n", "=> /home/logo.png Logo\n"},
+		{"lists", "- one\n  - two\n- [x] done\n\n3. three\n4. four\n",
+			"* one\n*   two\n* [x] done\n\n* 3. three\n* 4. four\n"},
+		{"quote", "> quoted\n> text\n", "> quoted text\n"},
+		{"code", "```go\nfunc main() {}\n```\n", "```go\nfunc main() {}\n```\n"},
+		{"table", "| A | Long |\n|---|---|\n| x | y |\n", "```\nA | Long\n--|-----\nx | y\n```\n"},
+		{"html and rule", "<div>raw</div>\n\n---\n\nafter\n", "after\n"},
+		{"typographer", "It's \"quoted\"\n", "It’s “quoted”\n"},
+		{"footnote", "Fact.[^1]\n\n[^1]: Source.\n", "Fact.[1]\n\n[1] Source.\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := r.Gemtext(tt.in, "/test"); got != tt.want {
+				t.Errorf("Gemtext(%q) =\n%q\nwant\n%q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
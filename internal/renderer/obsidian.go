@@ -0,0 +1,460 @@
+package renderer
+
+import (
+	"bytes"
+	"html"
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+
+	wikiutil "github.com/sa/gopherwiki/internal/util"
+)
+
+// Resolver looks up what Obsidian-style links and embeds refer to. Obsidian
+// links by name rather than path, so "[[Meeting Notes]]" may point anywhere in
+// the vault. The wiki service implements it over the repository.
+type Resolver interface {
+	// ResolvePage returns the path of the page that a link target names, as
+	// seen from the page at from. Targets match page names and frontmatter
+	// aliases as well as paths.
+	ResolvePage(target, from string) (string, bool)
+	// ResolveFile returns the repository path of the attachment that a name
+	// or path refers to, as seen from the page at from.
+	ResolveFile(name, from string) (string, bool)
+	// PageSource returns the body of a page, without its frontmatter.
+	PageSource(pagepath string) (string, bool)
+}
+
+// SetResolver sets the resolver used for Obsidian links and embeds. It must be
+// called before rendering starts. Without one, or with ObsidianCompat off,
+// links render as plain wikilinks and embeds are not recognized.
+func (r *Renderer) SetResolver(res Resolver) {
+	r.resolver = res
+}
+
+// obsidianResolver returns the resolver when Obsidian compatibility is on.
+// Like the other render settings, it is read at parse time.
+func (r *Renderer) obsidianResolver() Resolver {
+	if r.resolver == nil || r.config == nil || !r.config.ObsidianCompat {
+		return nil
+	}
+	return r.resolver
+}
+
+// Parser context keys for the page being rendered, the pages embedding it,
+// which pages its viewer may read and where the pages it embeds are listed.
+var (
+	currentPageKey = parser.NewContextKey()
+	embedChainKey  = parser.NewContextKey()
+	canReadKey     = parser.NewContextKey()
+	embeddedKey    = parser.NewContextKey()
+)
+
+// maxEmbedDepth limits how deeply embedded pages may embed further pages.
+const maxEmbedDepth = 3
+
+// Embed types.
+const (
+	embedImage   = "image"
+	embedAudio   = "audio"
+	embedVideo   = "video"
+	embedPDF     = "pdf"
+	embedFile    = "file"    // any other attachment, linked
+	embedPage    = "page"    // a page or section rendered in place
+	embedLink    = "link"    // a page that cannot be rendered in place, linked
+	embedMissing = "missing" // nothing by that name exists
+)
+
+var embedSizeRegex = regexp.MustCompile(`^(\d+)(?:x(\d+))?$`)
+
+// ObsidianExtension implements the Obsidian conventions enabled by
+// ObsidianCompat: "![[...]]" embeds of attachments and pages, and wikilinks
+// resolved by page name or alias anywhere in the vault, with "#Heading"
+// anchors.
+type ObsidianExtension struct {
+	renderer *Renderer
+}
+
+func (e *ObsidianExtension) Extend(m goldmark.Markdown) {
+	m.Parser().AddOptions(
+		parser.WithInlineParsers(
+			util.Prioritized(&embedParser{renderer: e.renderer}, 198),
+		),
+		parser.WithASTTransformers(
+			util.Prioritized(&vaultLinkTransformer{renderer: e.renderer}, 110),
+		),
+	)
+	m.Renderer().AddOptions(
+		renderer.WithNodeRenderers(
+			util.Prioritized(&embedRenderer{}, 198),
+		),
+	)
+}
+
+// Embed AST node for ![[target]]. Page embeds carry their rendered HTML.
+var KindEmbed = ast.NewNodeKind("Embed")
+
+type Embed struct {
+	ast.BaseInline
+	EmbedType string
+	Target    string
+	URL       string
+	Label     string
+	Width     string
+	Height    string
+	HTML      string
+}
+
+func (n *Embed) Kind() ast.NodeKind {
+	return KindEmbed
+}
+
+func (n *Embed) Dump(source []byte, level int) {
+	ast.DumpHelper(n, source, level, map[string]string{"Type": n.EmbedType, "Target": n.Target, "URL": n.URL}, nil)
+}
+
+type embedParser struct {
+	renderer *Renderer
+}
+
+func (p *embedParser) Trigger() []byte {
+	return []byte{'!'}
+}
+
+func (p *embedParser) Parse(parent ast.Node, block text.Reader, pc parser.Context) ast.Node {
+	res := p.renderer.obsidianResolver()
+	if res == nil {
+		return nil
+	}
+	line, _ := block.PeekLine()
+	if len(line) < 6 || line[1] != '[' || line[2] != '[' {
+		return nil
+	}
+	end := bytes.Index(line[3:], []byte("]]"))
+	if end <= 0 {
+		return nil
+	}
+	inner := string(line[3 : 3+end])
+	block.Advance(5 + end) // ![[ + inner + ]]
+
+	from, _ := pc.Get(currentPageKey).(string)
+	chain, _ := pc.Get(embedChainKey).([]string)
+	canRead, _ := pc.Get(canReadKey).(func(string) bool)
+	embedded, _ := pc.Get(embeddedKey).(*[]string)
+	return p.renderer.embed(res, inner, from, chain, canRead, embedded)
+}
+
+// embed resolves the inside of ![[...]]: an attachment, optionally with a
+// "|300" or "|300x200" size or "|alt text", or a page, optionally narrowed to
+// a "#Heading" section or "#^block" paragraph. chain lists the pages whose
+// embeds led to from, so that pages embedding each other stop. Pages that
+// canRead, unless nil, refuses are linked rather than rendered in place.
+// Pages rendered in place are appended to embedded, unless it is nil.
+func (r *Renderer) embed(res Resolver, inner, from string, chain []string, canRead func(string) bool, embedded *[]string) *Embed {
+	target, option, _ := strings.Cut(inner, "|")
+	target, option = strings.TrimSpace(target), strings.TrimSpace(option)
+	name, fragment, _ := strings.Cut(target, "#")
+	e := &Embed{Target: target, Label: option}
+
+	if ext := strings.ToLower(path.Ext(name)); ext != "" && !wikiutil.IsMarkdownFile(name) {
+		file, ok := res.ResolveFile(name, from)
+		if !ok {
+			e.EmbedType, e.URL = embedMissing, wikiLinkURL(name)
+			if e.Label == "" {
+				e.Label = path.Base(name)
+			}
+			return e
+		}
+		e.EmbedType, e.URL = embedMediaType(ext), vaultURL(file)
+		if m := embedSizeRegex.FindStringSubmatch(option); m != nil && e.EmbedType != embedFile {
+			e.Width, e.Height, e.Label = m[1], m[2], ""
+		}
+		if e.Label == "" && e.EmbedType != embedImage {
+			e.Label = path.Base(file)
+		}
+		return e
+	}
+
+	pagepath, ok := res.ResolvePage(name, from)
+	if !ok {
+		e.EmbedType, e.URL = embedMissing, wikiLinkURL(name)
+		if e.Label == "" {
+			e.Label = name
+		}
+		return e
+	}
+	e.URL = vaultURL(pagepath) + headingAnchor(fragment)
+	if e.Label == "" {
+		e.Label = path.Base(pagepath)
+	}
+
+	e.EmbedType = embedLink
+	chain = append(chain[:len(chain):len(chain)], from)
+	if len(chain) > maxEmbedDepth || containsString(chain, pagepath) || (canRead != nil && !canRead(pagepath)) {
+		return e
+	}
+	source, ok := res.PageSource(pagepath)
+	if ok && fragment != "" {
+		source, ok = pageSection(source, fragment)
+	}
+	if !ok {
+		return e
+	}
+	e.EmbedType = embedPage
+	if embedded != nil {
+		*embedded = append(*embedded, pagepath)
+	}
+	e.HTML = r.renderEmbedded(source, pagepath, chain, canRead, embedded)
+	return e
+}
+
+// renderEmbedded renders the source of an embedded page.
+func (r *Renderer) renderEmbedded(source, pagepath string, chain []string, canRead func(string) bool, embedded *[]string) string {
+	if len(source) == 0 || source[len(source)-1] != '\n' {
+		source += "\n"
+	}
+	sourceBytes := []byte(source)
+	ctx := parser.NewContext()
+	ctx.Set(currentPageKey, pagepath)
+	ctx.Set(embedChainKey, chain)
+	ctx.Set(canReadKey, canRead)
+	ctx.Set(embeddedKey, embedded)
+	doc := r.markdown.Parser().Parse(text.NewReader(sourceBytes), parser.WithContext(ctx))
+	var buf bytes.Buffer
+	if err := r.markdown.Renderer().Render(&buf, sourceBytes, doc); err != nil {
+		return html.EscapeString(source)
+	}
+	return buf.String()
+}
+
+// embedMediaType classifies an attachment by its extension.
+func embedMediaType(ext string) string {
+	switch ext {
+	case ".png", ".jpg", ".jpeg", ".gif", ".svg", ".webp", ".bmp", ".avif":
+		return embedImage
+	case ".mp3", ".wav", ".ogg", ".m4a", ".flac":
+		return embedAudio
+	case ".mp4", ".webm", ".ogv", ".mov", ".mkv":
+		return embedVideo
+	case ".pdf":
+		return embedPDF
+	}
+	return embedFile
+}
+
+// vaultURL is the URL of a page or file at a repository path.
+func vaultURL(p string) string {
+	parts := strings.Split(p, "/")
+	for i, part := range parts {
+		parts[i] = url.PathEscape(part)
+	}
+	return "/" + strings.Join(parts, "/")
+}
+
+// wikiLinkURL is the URL a plain wikilink to target points at.
+func wikiLinkURL(target string) string {
+	return "/" + strings.ReplaceAll(target, " ", "-")
+}
+
+// headingAnchor turns the fragment of an Obsidian link into a heading anchor.
+// Nested headings ("Setup#Linux") name the last one; block references
+// ("^abc123") have no anchor.
+func headingAnchor(fragment string) string {
+	if i := strings.LastIndex(fragment, "#"); i >= 0 {
+		fragment = fragment[i+1:]
+	}
+	if fragment == "" || strings.HasPrefix(fragment, "^") {
+		return ""
+	}
+	return "#" + slugify(fragment)
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+var sectionHeadingRegex = regexp.MustCompile(`^(#{1,6})[ \t]+(.*?)[ \t#]*$`)
+
+// pageSection extracts the part of a page's source that an embed fragment
+// names: a heading and everything up to the next heading of the same or a
+// higher level, or, for "^id", the paragraph ending in that block ID.
+func pageSection(source, fragment string) (string, bool) {
+	lines := strings.Split(source, "\n")
+	if id, ok := strings.CutPrefix(fragment, "^"); ok {
+		return blockSection(lines, id)
+	}
+	if i := strings.LastIndex(fragment, "#"); i >= 0 {
+		fragment = fragment[i+1:]
+	}
+
+	start, level := -1, 0
+	inFence := false
+	for i, line := range lines {
+		if trimmed := strings.TrimSpace(line); strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~") {
+			inFence = !inFence
+			continue
+		}
+		if inFence {
+			continue
+		}
+		m := sectionHeadingRegex.FindStringSubmatch(line)
+		if m == nil {
+			continue
+		}
+		if start >= 0 && len(m[1]) <= level {
+			return strings.Join(lines[start:i], "\n"), true
+		}
+		if start < 0 && strings.EqualFold(strings.TrimSpace(m[2]), strings.TrimSpace(fragment)) {
+			start, level = i, len(m[1])
+		}
+	}
+	if start < 0 {
+		return "", false
+	}
+	return strings.Join(lines[start:], "\n"), true
+}
+
+// blockSection returns the paragraph whose last line ends in " ^id", with the
+// block ID removed.
+func blockSection(lines []string, id string) (string, bool) {
+	marker := "^" + id
+	for i, line := range lines {
+		trimmed := strings.TrimRight(line, " \t\r")
+		if trimmed != marker && !strings.HasSuffix(trimmed, " "+marker) {
+			continue
+		}
+		start := i
+		for start > 0 && strings.TrimSpace(lines[start-1]) != "" {
+			start--
+		}
+		paragraph := append([]string{}, lines[start:i+1]...)
+		last := len(paragraph) - 1
+		paragraph[last] = strings.TrimRight(strings.TrimSuffix(trimmed, marker), " ")
+		return strings.Join(paragraph, "\n"), true
+	}
+	return "", false
+}
+
+// vaultLinkTransformer resolves wikilinks by page name and alias, and lifts
+// page embeds that stand alone in a paragraph out of it, so the embedded
+// blocks are not nested in a <p>. Page embeds within running text become
+// links.
+type vaultLinkTransformer struct {
+	renderer *Renderer
+}
+
+func (t *vaultLinkTransformer) Transform(doc *ast.Document, reader text.Reader, pc parser.Context) {
+	res := t.renderer.obsidianResolver()
+	if res == nil {
+		return
+	}
+	from, _ := pc.Get(currentPageKey).(string)
+
+	var lifted []*Embed
+	_ = ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+		switch n := n.(type) {
+		case *WikiLink:
+			resolveWikiLink(res, n, from)
+		case *Embed:
+			if n.EmbedType != embedPage {
+				break
+			}
+			if para, ok := n.Parent().(*ast.Paragraph); ok && para.ChildCount() == 1 {
+				lifted = append(lifted, n)
+			} else {
+				n.EmbedType = embedLink
+			}
+		}
+		return ast.WalkContinue, nil
+	})
+
+	for _, e := range lifted {
+		para := e.Parent()
+		para.Parent().ReplaceChild(para.Parent(), para, e)
+	}
+}
+
+// resolveWikiLink points a wikilink at the page its target names. A link
+// without its own text shows "Page > Heading" for a heading link, as
+// Obsidian does.
+func resolveWikiLink(res Resolver, wl *WikiLink, from string) {
+	name, fragment, hasFragment := strings.Cut(wl.Target, "#")
+	name = strings.TrimSpace(name)
+	switch {
+	case name == "":
+		wl.URL = headingAnchor(fragment)
+	default:
+		if pagepath, ok := res.ResolvePage(name, from); ok {
+			wl.URL = vaultURL(pagepath) + headingAnchor(fragment)
+		} else {
+			wl.URL = wikiLinkURL(name) + headingAnchor(fragment)
+		}
+	}
+	if hasFragment && wl.LinkText == wl.Target {
+		parts := []string{}
+		for _, part := range append([]string{name}, strings.Split(fragment, "#")...) {
+			if part = strings.TrimSpace(part); part != "" {
+				parts = append(parts, part)
+			}
+		}
+		wl.LinkText = strings.Join(parts, " > ")
+	}
+}
+
+type embedRenderer struct{}
+
+func (r *embedRenderer) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
+	reg.Register(KindEmbed, r.render)
+}
+
+func (r *embedRenderer) render(w util.BufWriter, source []byte, n ast.Node, entering bool) (ast.WalkStatus, error) {
+	if !entering {
+		return ast.WalkContinue, nil
+	}
+	e := n.(*Embed)
+	src := html.EscapeString(e.URL)
+	label := html.EscapeString(e.Label)
+	size := ""
+	if e.Width != "" {
+		size += ` width="` + e.Width + `"`
+	}
+	if e.Height != "" {
+		size += ` height="` + e.Height + `"`
+	}
+
+	switch e.EmbedType {
+	case embedImage:
+		_, _ = w.WriteString(`<img src="` + src + `" alt="` + label + `"` + size + ` />`)
+	case embedAudio:
+		_, _ = w.WriteString(`<audio controls src="` + src + `"></audio>`)
+	case embedVideo:
+		_, _ = w.WriteString(`<video controls src="` + src + `"` + size + `></video>`)
+	case embedPDF:
+		_, _ = w.WriteString(`<iframe class="embed-pdf" src="` + src + `" title="` + label + `"` + size + `></iframe>`)
+	case embedPage:
+		_, _ = w.WriteString(`<div class="embed-page"><p class="embed-page-title"><a href="` + src + `">` + label + "</a></p>\n")
+		_, _ = w.WriteString(e.HTML)
+		_, _ = w.WriteString("</div>\n")
+	case embedMissing:
+		_, _ = w.WriteString(`<a class="embed-missing" href="` + src + `">` + label + `</a>`)
+	default:
+		_, _ = w.WriteString(`<a href="` + src + `">` + label + `</a>`)
+	}
+	return ast.WalkContinue, nil
+}
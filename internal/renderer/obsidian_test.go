@@ -0,0 +1,186 @@
+package renderer
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/sa/gopherwiki/internal/config"
+)
+
+// fakeResolver resolves names from fixed tables.
+type fakeResolver struct {
+	pages   map[string]string // target -> page path
+	files   map[string]string // name -> file path
+	sources map[string]string // page path -> body
+}
+
+func (f *fakeResolver) ResolvePage(target, from string) (string, bool) {
+	p, ok := f.pages[target]
+	return p, ok
+}
+
+func (f *fakeResolver) ResolveFile(name, from string) (string, bool) {
+	p, ok := f.files[name]
+	return p, ok
+}
+
+func (f *fakeResolver) PageSource(pagepath string) (string, bool) {
+	s, ok := f.sources[pagepath]
+	return s, ok
+}
+
+func newObsidianRenderer(compat bool) *Renderer {
+	cfg := config.Default()
+	cfg.ObsidianCompat = compat
+	r := New(cfg)
+	r.SetResolver(&fakeResolver{
+		pages: map[string]string{
+			"Meeting Notes": "Work/Meeting Notes",
+			"Standup":       "Work/Meeting Notes", // an alias
+			"Recipes":       "Recipes",
+			"Loop":          "Loop",
+		},
+		files: map[string]string{
+			"diagram.png": "Work/attachments/diagram.png",
+			"talk.mp3":    "audio/talk.mp3",
+			"report.pdf":  "report.pdf",
+			"data.csv":    "data.csv",
+		},
+		sources: map[string]string{
+			"Recipes": "Intro\n\n## Pancakes\n\nMix **flour**.\n\n### Toppings\n\nSyrup\n\n## Waffles\n\nIron.\n\nA quote ^q1\n",
+			"Loop":    "Before ![[Loop]]\n\n![[Loop]]\n",
+		},
+	})
+	return r
+}
+
+func TestRenderObsidianEmbeds(t *testing.T) {
+	r := newObsidianRenderer(true)
+
+	tests := []struct {
+		name        string
+		input       string
+		contains    []string
+		notContains []string
+	}{
+		{
+			name:     "image with size",
+			input:    "![[diagram.png|300]]",
+			contains: []string{`<img src="/Work/attachments/diagram.png" alt="" width="300" />`},
+		},
+		{
+			name:     "image with alt text",
+			input:    "![[diagram.png|A diagram]]",
+			contains: []string{`<img src="/Work/attachments/diagram.png" alt="A diagram" />`},
+		},
+		{
+			name:     "audio, pdf, and other files",
+			input:    "![[talk.mp3]] ![[report.pdf]] ![[data.csv]]",
+			contains: []string{`<audio controls src="/audio/talk.mp3"></audio>`, `<iframe class="embed-pdf" src="/report.pdf" title="report.pdf"></iframe>`, `<a href="/data.csv">data.csv</a>`},
+		},
+		{
+			name:     "missing file",
+			input:    "![[gone.png]]",
+			contains: []string{`<a class="embed-missing" href="/gone.png">gone.png</a>`},
+		},
+		{
+			name:        "page section",
+			input:       "![[Recipes#Pancakes]]",
+			contains:    []string{`<div class="embed-page"><p class="embed-page-title"><a href="/Recipes#pancakes">Recipes</a></p>`, "<strong>flour</strong>", "Syrup"},
+			notContains: []string{"Intro", "Iron", "<p><div"},
+		},
+		{
+			name:        "block reference",
+			input:       "![[Recipes#^q1]]",
+			contains:    []string{"<p>A quote</p>"},
+			notContains: []string{"^q1", "Iron"},
+		},
+		{
+			name:        "page embed in running text is a link",
+			input:       "See ![[Recipes]] for more",
+			contains:    []string{`See <a href="/Recipes">Recipes</a> for more`},
+			notContains: []string{"embed-page"},
+		},
+		{
+			name:     "pages embedding themselves stop",
+			input:    "![[Loop]]",
+			contains: []string{`<a href="/Loop">Loop</a>`},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			html, _, _ := r.Render(tt.input, "/Work/Today")
+			for _, want := range tt.contains {
+				if !strings.Contains(html, want) {
+					t.Errorf("Render should contain %q, got:\n%s", want, html)
+				}
+			}
+			for _, unwanted := range tt.notContains {
+				if strings.Contains(html, unwanted) {
+					t.Errorf("Render should not contain %q, got:\n%s", unwanted, html)
+				}
+			}
+		})
+	}
+}
+
+func TestRenderObsidianEmbedsUnreadable(t *testing.T) {
+	r := newObsidianRenderer(true)
+	canRead := func(pagepath string) bool { return pagepath != "Recipes" }
+
+	html, _, _ := r.RenderFor("![[Recipes#Pancakes]]\n\n![[diagram.png]]", "/Work/Today", canRead)
+	if strings.Contains(html, "flour") || strings.Contains(html, "embed-page") {
+		t.Errorf("RenderFor rendered a page the viewer may not read:\n%s", html)
+	}
+	for _, want := range []string{`<a href="/Recipes#pancakes">Recipes</a>`, `src="/Work/attachments/diagram.png"`} {
+		if !strings.Contains(html, want) {
+			t.Errorf("RenderFor should contain %q, got:\n%s", want, html)
+		}
+	}
+}
+
+func TestRenderObsidianEmbedsListed(t *testing.T) {
+	r := newObsidianRenderer(true)
+	source := "![[Recipes#Pancakes]]\n\n![[Loop]]\n\n![[Meeting Notes]]\n\n![[diagram.png]]"
+
+	// Loop embeds itself, which is linked rather than rendered again; Meeting
+	// Notes has no source to render.
+	_, _, _, embedded := r.RenderEmbeds(source, "/Work/Today", nil)
+	if got := strings.Join(embedded, ","); got != "Recipes,Loop" {
+		t.Errorf("embedded pages = %q, want Recipes,Loop", got)
+	}
+	_, _, _, embedded = r.RenderEmbeds(source, "/Work/Today", func(pagepath string) bool { return pagepath != "Recipes" })
+	if got := strings.Join(embedded, ","); got != "Loop" {
+		t.Errorf("embedded pages the viewer may read = %q, want Loop", got)
+	}
+}
+
+func TestRenderObsidianWikiLinks(t *testing.T) {
+	r := newObsidianRenderer(true)
+
+	html, _, _ := r.Render("[[Meeting Notes]] [[Standup|daily]] [[Recipes#Waffles]] [[#Local Heading]] [[Nowhere]]", "/Work/Today")
+	for _, want := range []string{
+		`<a href="/Work/Meeting%20Notes">Meeting Notes</a>`,
+		`<a href="/Work/Meeting%20Notes">daily</a>`,
+		`<a href="/Recipes#waffles">Recipes &gt; Waffles</a>`,
+		`<a href="#local-heading">Local Heading</a>`,
+		`<a href="/Nowhere">Nowhere</a>`,
+	} {
+		if !strings.Contains(html, want) {
+			t.Errorf("Render should contain %q, got:\n%s", want, html)
+		}
+	}
+}
+
+func TestRenderObsidianDisabled(t *testing.T) {
+	r := newObsidianRenderer(false)
+
+	html, _, _ := r.Render("![[diagram.png]] [[Meeting Notes]]", "/Work/Today")
+	if strings.Contains(html, "<img") {
+		t.Errorf("embeds should not be recognized without ObsidianCompat, got:\n%s", html)
+	}
+	if !strings.Contains(html, `<a href="/Meeting-Notes">Meeting Notes</a>`) {
+		t.Errorf("wikilinks should keep their plain form without ObsidianCompat, got:\n%s", html)
+	}
+}
@@ -22,6 +22,7 @@ import (
 	highlighting "github.com/yuin/goldmark-highlighting/v2"
 
 	"github.com/sa/gopherwiki/internal/config"
+	wikiutil "github.com/sa/gopherwiki/internal/util"
 )
 
 // TOCEntry represents an entry in the table of contents.
@@ -31,6 +32,7 @@ type TOCEntry struct {
 	Level  int
 	Raw    string
 	Anchor string
+	Number string // Section number ("2.1") when headings are numbered
 }
 
 // LibraryRequirements tracks which JS libraries are needed.
@@ -43,6 +45,22 @@ type LibraryRequirements struct {
 type Renderer struct {
 	config   *config.Config
 	markdown goldmark.Markdown
+	resolver Resolver
+	filter   Filter
+}
+
+// Filter rewrites the HTML of every rendered document, after the built-in
+// post-processing. Plugins implement it through the plugin registry.
+type Filter interface {
+	// FilterHTML returns the HTML rendered for the page at pageURL, which is
+	// empty for documents that are not pages, such as issues.
+	FilterHTML(pageURL, html string) string
+}
+
+// SetFilter sets the filter the rendered HTML passes through. It must be
+// called before rendering starts.
+func (r *Renderer) SetFilter(f Filter) {
+	r.filter = f
 }
 
 // New creates a new Renderer with the given configuration.
@@ -86,19 +104,21 @@ func New(cfg *config.Config) *Renderer {
 		}),
 	}
 
-	md := goldmark.New(
+	r := &Renderer{config: cfg}
+	r.markdown = goldmark.New(
 		goldmark.WithExtensions(
 			extension.GFM,
-			extension.Typographer,
+			&TypographyExtension{config: cfg},
 			extension.Footnote,
 			highlighting.NewHighlighting(highlightOpts...),
 			&IssueRefExtension{},
 			&WikiLinkExtension{},
 			&MarkExtension{},
 			&MathInlineExtension{},
-		),
-		goldmark.WithParserOptions(
-			parser.WithAutoHeadingID(),
+			&TaskListExtension{},
+			&EmojiExtension{config: cfg},
+			&CalloutExtension{},
+			&ObsidianExtension{renderer: r},
 		),
 		goldmark.WithRendererOptions(
 			goldmarkhtml.WithHardWraps(),
@@ -106,10 +126,7 @@ func New(cfg *config.Config) *Renderer {
 		),
 	)
 
-	return &Renderer{
-		config:   cfg,
-		markdown: md,
-	}
+	return r
 }
 
 // Ensure chroma and styles are used (for CSS generation)
@@ -126,7 +143,22 @@ var (
 
 // Render converts markdown to HTML with TOC extraction.
 func (r *Renderer) Render(source string, pageURL string) (string, []TOCEntry, LibraryRequirements) {
+	return r.RenderFor(source, pageURL, nil)
+}
+
+// RenderFor is Render for a viewer who may read only the pages canRead
+// accepts: embeds of other pages render as links to them. A nil canRead
+// accepts every page.
+func (r *Renderer) RenderFor(source string, pageURL string, canRead func(pagepath string) bool) (string, []TOCEntry, LibraryRequirements) {
+	htmlContent, toc, requirements, _ := r.RenderEmbeds(source, pageURL, canRead)
+	return htmlContent, toc, requirements
+}
+
+// RenderEmbeds is RenderFor that also returns the paths of the pages its
+// embeds rendered in place, those embedded by embedded pages included.
+func (r *Renderer) RenderEmbeds(source string, pageURL string, canRead func(pagepath string) bool) (string, []TOCEntry, LibraryRequirements, []string) {
 	requirements := LibraryRequirements{}
+	var embedded []string
 
 	// Ensure trailing newline
 	if len(source) == 0 || source[len(source)-1] != '\n' {
@@ -137,10 +169,13 @@ func (r *Renderer) Render(source string, pageURL string) (string, []TOCEntry, Li
 
 	// Parse the document
 	ctx := parser.NewContext()
+	ctx.Set(currentPageKey, strings.TrimPrefix(pageURL, "/"))
+	ctx.Set(canReadKey, canRead)
+	ctx.Set(embeddedKey, &embedded)
 	doc := r.markdown.Parser().Parse(text.NewReader(sourceBytes), parser.WithContext(ctx))
 
-	// Extract TOC from headings
-	toc := extractTOC(doc, sourceBytes)
+	// Assign heading IDs and extract the TOC
+	toc := r.buildTOC(doc, sourceBytes)
 
 	// Check for mermaid and math blocks
 	ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
@@ -165,7 +200,7 @@ func (r *Renderer) Render(source string, pageURL string) (string, []TOCEntry, Li
 	// Render to HTML
 	var buf bytes.Buffer
 	if err := r.markdown.Renderer().Render(&buf, sourceBytes, doc); err != nil {
-		return html.EscapeString(source), nil, requirements
+		return html.EscapeString(source), nil, requirements, embedded
 	}
 
 	htmlContent := buf.String()
@@ -173,8 +208,12 @@ func (r *Renderer) Render(source string, pageURL string) (string, []TOCEntry, Li
 	// Post-process for mermaid and math blocks
 	htmlContent = processMermaidBlocks(htmlContent)
 	htmlContent = processMathBlocks(htmlContent)
+	htmlContent = placeTOC(htmlContent, toc)
+	if r.filter != nil {
+		htmlContent = r.filter.FilterHTML(pageURL, htmlContent)
+	}
 
-	return htmlContent, toc, requirements
+	return htmlContent, toc, requirements, embedded
 }
 
 // processMathBlocks converts ```math fenced code blocks into MathJax display
@@ -184,57 +223,10 @@ func processMathBlocks(htmlContent string) string {
 	return mathBlockRegex.ReplaceAllString(htmlContent, `<div class="math-display">\[$1\]</div>`)
 }
 
-// extractTOC extracts the table of contents from headings.
-func extractTOC(doc ast.Node, source []byte) []TOCEntry {
-	var toc []TOCEntry
-	anchors := make(map[string]int)
-	index := 0
-
-	ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
-		if !entering {
-			return ast.WalkContinue, nil
-		}
-
-		if heading, ok := n.(*ast.Heading); ok {
-			// Extract text content
-			var textBuf bytes.Buffer
-			for c := heading.FirstChild(); c != nil; c = c.NextSibling() {
-				if t, ok := c.(*ast.Text); ok {
-					textBuf.Write(t.Segment.Value(source))
-				}
-			}
-			text := textBuf.String()
-			raw := text
-
-			// Generate anchor
-			anchor := slugify(text)
-			if count, exists := anchors[anchor]; exists {
-				anchors[anchor] = count + 1
-				anchor = fmt.Sprintf("%s-%d", anchor, count+1)
-			} else {
-				anchors[anchor] = 0
-			}
-
-			toc = append(toc, TOCEntry{
-				Index:  index,
-				Text:   text,
-				Level:  heading.Level,
-				Raw:    raw,
-				Anchor: anchor,
-			})
-			index++
-		}
-
-		return ast.WalkContinue, nil
-	})
-
-	return toc
-}
-
 // slugify converts text to a URL-friendly anchor.
 func slugify(s string) string {
-	// Convert to lowercase
-	s = strings.ToLower(s)
+	// Fold accented letters and convert to lowercase
+	s = strings.ToLower(wikiutil.FoldSearchText(s, ""))
 
 	// Replace spaces with hyphens
 	s = strings.ReplaceAll(s, " ", "-")
@@ -330,6 +322,7 @@ type WikiLink struct {
 	ast.BaseInline
 	Target    string
 	LinkText  string
+	URL       string // resolved link, when set (see ObsidianExtension)
 }
 
 func (n *WikiLink) Kind() ast.NodeKind {
@@ -394,8 +387,10 @@ func (r *wikiLinkRenderer) renderWikiLink(w util.BufWriter, source []byte, n ast
 	wl := n.(*WikiLink)
 
 	// Convert target to URL path
-	target := strings.ReplaceAll(wl.Target, " ", "-")
-	target = "/" + target
+	target := wl.URL
+	if target == "" {
+		target = wikiLinkURL(wl.Target)
+	}
 
 	_, _ = w.WriteString(fmt.Sprintf(`<a href="%s">%s</a>`, html.EscapeString(target), html.EscapeString(wl.LinkText)))
 
@@ -204,6 +204,93 @@ func TestRenderTOC(t *testing.T) {
 	}
 }
 
+func TestRenderHeadingIDsMatchTOC(t *testing.T) {
+	r := New(config.Default())
+
+	input := "# Über *uns*\n## Using `go test`\n## Using `go test`\n## [[Setup|Set up]] \"quickly\"\n## 日本語"
+	html, toc, _ := r.Render(input, "/test")
+
+	want := []struct{ text, anchor string }{
+		{"Über uns", "uber-uns"},
+		{"Using go test", "using-go-test"},
+		{"Using go test", "using-go-test-1"},
+		{"Set up \u201cquickly\u201d", "set-up-quickly"},
+		{"日本語", "heading"},
+	}
+	if len(toc) != len(want) {
+		t.Fatalf("TOC has %d entries, want %d: %+v", len(toc), len(want), toc)
+	}
+	for i, w := range want {
+		if toc[i].Text != w.text || toc[i].Anchor != w.anchor {
+			t.Errorf("toc[%d] = %q #%s, want %q #%s", i, toc[i].Text, toc[i].Anchor, w.text, w.anchor)
+		}
+		if !strings.Contains(html, `id="`+w.anchor+`"`) {
+			t.Errorf("heading id %q missing from HTML", w.anchor)
+		}
+		if !strings.Contains(html, `<a class="anchor" href="#`+w.anchor+`"`) {
+			t.Errorf("anchor link to #%s missing from HTML", w.anchor)
+		}
+	}
+}
+
+func TestRenderTOCMaxDepth(t *testing.T) {
+	cfg := config.Default()
+	cfg.TOCMaxDepth = 2
+	r := New(cfg)
+
+	html, toc, _ := r.Render("# Title\n## Section\n### Detail", "/test")
+	if len(toc) != 2 || toc[1].Text != "Section" {
+		t.Errorf("TOC = %+v, want Title and Section only", toc)
+	}
+	if !strings.Contains(html, `<h3 id="detail">`) {
+		t.Errorf("headings below the TOC depth should keep their id, got: %s", html)
+	}
+}
+
+func TestRenderNumberedHeadings(t *testing.T) {
+	cfg := config.Default()
+	cfg.NumberedHeadings = true
+	cfg.TOCMaxDepth = 3
+	r := New(cfg)
+
+	html, toc, _ := r.Render("# Title\n## One\n### One A\n### One B\n## Two\n### Two A\n#### Deep", "/test")
+	want := map[string]string{"Title": "", "One": "1", "One A": "1.1", "One B": "1.2", "Two": "2", "Two A": "2.1"}
+	if len(toc) != len(want) {
+		t.Fatalf("TOC has %d entries, want %d: %+v", len(toc), len(want), toc)
+	}
+	for _, entry := range toc {
+		if entry.Number != want[entry.Text] {
+			t.Errorf("%q numbered %q, want %q", entry.Text, entry.Number, want[entry.Text])
+		}
+	}
+	if !strings.Contains(html, `<h3 id="two-a"><span class="heading-number">2.1</span> Two A`) {
+		t.Errorf("numbered heading missing from HTML: %s", html)
+	}
+	if strings.Contains(html, `<span class="heading-number"></span>`) || strings.Contains(html, `<h4 id="deep"><span`) {
+		t.Errorf("the title and headings below the TOC depth should not be numbered: %s", html)
+	}
+}
+
+func TestRenderTOCPlaceholder(t *testing.T) {
+	r := New(config.Default())
+
+	html, _, _ := r.Render("# Title\n\n{{toc}}\n\n## First\n\n```\n{{toc}}\n```\n", "/test")
+	if !strings.Contains(html, `<nav class="toc toc-inline">`) || !strings.Contains(html, `<a href="#first">First</a>`) {
+		t.Errorf("{{toc}} should be replaced with the table of contents, got: %s", html)
+	}
+	if strings.Contains(html, "<p>{{toc}}</p>") {
+		t.Error("the {{toc}} paragraph should be replaced")
+	}
+	if !strings.Contains(html, "{{toc}}") {
+		t.Error("{{toc}} inside a code block should be kept")
+	}
+
+	html, _, _ = r.Render("{{toc}}\n\nNo headings.", "/test")
+	if strings.Contains(html, "{{toc}}") || strings.Contains(html, "toc-inline") {
+		t.Errorf("{{toc}} without headings should render nothing, got: %s", html)
+	}
+}
+
 func TestRenderTable(t *testing.T) {
 	cfg := config.Default()
 	r := New(cfg)
@@ -440,3 +527,143 @@ func TestRenderIssueRefs(t *testing.T) {
 		})
 	}
 }
+
+func TestRenderEmoji(t *testing.T) {
+	r := New(config.Default())
+
+	tests := []struct {
+		name        string
+		input       string
+		contains    []string
+		notContains []string
+	}{
+		{
+			name:     "shortcode",
+			input:    "Shipped :tada: :+1:",
+			contains: []string{`<span class="emoji" role="img" aria-label="tada">🎉</span>`, `aria-label="+1">👍</span>`},
+		},
+		{
+			name:        "unknown shortcode is kept",
+			input:       "Meet at 10:30:45 :notanemoji:",
+			contains:    []string{"10:30:45", ":notanemoji:"},
+			notContains: []string{`class="emoji"`},
+		},
+		{
+			name:        "code span",
+			input:       "Use `:smile:` for a smile",
+			contains:    []string{"<code>:smile:</code>"},
+			notContains: []string{"😄"},
+		},
+		{
+			name:        "code block",
+			input:       "```\n:smile:\n```",
+			contains:    []string{":smile:"},
+			notContains: []string{"😄"},
+		},
+		{
+			name:     "link target",
+			input:    "See http://example.com:8080/",
+			contains: []string{"http://example.com:8080/"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			html, _, _ := r.Render(tt.input, "/test")
+			for _, want := range tt.contains {
+				if !strings.Contains(html, want) {
+					t.Errorf("Render(%q) should contain %q, got:\n%s", tt.input, want, html)
+				}
+			}
+			for _, notWant := range tt.notContains {
+				if strings.Contains(html, notWant) {
+					t.Errorf("Render(%q) should NOT contain %q, got:\n%s", tt.input, notWant, html)
+				}
+			}
+		})
+	}
+}
+
+func TestRenderEmojiDisabled(t *testing.T) {
+	cfg := config.Default()
+	cfg.EmojiShortcodes = false
+	r := New(cfg)
+
+	html, _, _ := r.Render("Shipped :tada:", "/test")
+	if !strings.Contains(html, ":tada:") || strings.Contains(html, "🎉") {
+		t.Errorf("shortcodes should be kept when disabled, got:\n%s", html)
+	}
+}
+
+func TestRenderTypographer(t *testing.T) {
+	r := New(config.Default())
+
+	html, _, _ := r.Render("\"Quoted\" -- it's a dash --- and more...\n\n`\"code\" -- ...`", "/test")
+	for _, want := range []string{"&ldquo;Quoted&rdquo;", "&ndash;", "it&rsquo;s", "&mdash;", "&hellip;", "<code>&quot;code&quot; -- ...</code>"} {
+		if !strings.Contains(html, want) {
+			t.Errorf("Render should contain %q, got:\n%s", want, html)
+		}
+	}
+
+	cfg := config.Default()
+	cfg.Typographer = false
+	html, _, _ = New(cfg).Render("\"Quoted\" -- and more...", "/test")
+	if strings.Contains(html, "&ldquo;") || strings.Contains(html, "&ndash;") || strings.Contains(html, "&hellip;") {
+		t.Errorf("punctuation should be kept when the typographer is off, got:\n%s", html)
+	}
+}
+
+func TestRenderCallouts(t *testing.T) {
+	r := New(config.Default())
+
+	tests := []struct {
+		name        string
+		input       string
+		contains    []string
+		notContains []string
+	}{
+		{
+			name:     "github alert",
+			input:    "> [!NOTE]\n> Read *this*.",
+			contains: []string{`<div class="quote-alert quote-alert-note" data-callout="note">`, `fa-info-circle" aria-hidden="true"></i>Note</p>`, "<p>Read <em>this</em>.</p>"},
+		},
+		{
+			name:        "obsidian title and fold",
+			input:       "> [!tip]- Spoiler **here**\n> Hidden text",
+			contains:    []string{`<details class="quote-alert quote-alert-tip" data-callout="tip">`, `</i>Spoiler <strong>here</strong></summary>`, "<p>Hidden text</p>", "</details>"},
+			notContains: []string{"[!tip]", " open"},
+		},
+		{
+			name:     "open fold and aliased type",
+			input:    "> [!bug]+\n> Crashes",
+			contains: []string{`<details class="quote-alert quote-alert-caution" data-callout="bug" open>`, "</i>Bug</summary>"},
+		},
+		{
+			name:     "unknown type styled as note",
+			input:    "> [!recipe] Pancakes",
+			contains: []string{`quote-alert-note" data-callout="recipe"`, "</i>Pancakes</p>"},
+		},
+		{
+			name:        "plain blockquote",
+			input:       "> Just a quote",
+			contains:    []string{"<blockquote>"},
+			notContains: []string{"quote-alert"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			html, _, _ := r.Render(tt.input, "/test")
+			for _, want := range tt.contains {
+				if !strings.Contains(html, want) {
+					t.Errorf("Render should contain %q, got:\n%s", want, html)
+				}
+			}
+			for _, unwanted := range tt.notContains {
+				if strings.Contains(html, unwanted) {
+					t.Errorf("Render should not contain %q, got:\n%s", unwanted, html)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,130 @@
+package renderer
+
+import (
+	"bytes"
+	"errors"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	east "github.com/yuin/goldmark/extension/ast"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+)
+
+// ErrNotATask is returned by SetTaskState when the given line is not a task
+// list item.
+var ErrNotATask = errors.New("line is not a task list item")
+
+// Task is an item of a GitHub-style task list ("- [ ] do something").
+type Task struct {
+	Line    int // 1-based line of the item in the rendered source
+	Checked bool
+	Text    string
+}
+
+// taskLineRegex matches the marker of a task list item, capturing everything
+// up to the state character, the state itself, and the closing bracket.
+var taskLineRegex = regexp.MustCompile(`^(\s*(?:>\s*)*(?:[-*+]|\d+[.)])\s+\[)([ xX])(\])`)
+
+// TaskListExtension renders task list checkboxes with the source line of
+// their item, so the page view can toggle them.
+type TaskListExtension struct{}
+
+func (e *TaskListExtension) Extend(m goldmark.Markdown) {
+	// GFM registers its own checkbox renderer at priority 500; this one
+	// must take precedence.
+	m.Renderer().AddOptions(
+		renderer.WithNodeRenderers(
+			util.Prioritized(&taskCheckBoxRenderer{}, 100),
+		),
+	)
+}
+
+type taskCheckBoxRenderer struct{}
+
+func (r *taskCheckBoxRenderer) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
+	reg.Register(east.KindTaskCheckBox, r.render)
+}
+
+func (r *taskCheckBoxRenderer) render(w util.BufWriter, source []byte, n ast.Node, entering bool) (ast.WalkStatus, error) {
+	if !entering {
+		return ast.WalkContinue, nil
+	}
+	box := n.(*east.TaskCheckBox)
+	w.WriteString(`<input class="task-checkbox"`)
+	if box.IsChecked {
+		w.WriteString(` checked=""`)
+	}
+	w.WriteString(` disabled="" type="checkbox"`)
+	if line := taskLine(box, source); line > 0 {
+		w.WriteString(` data-task-line="` + strconv.Itoa(line) + `"`)
+	}
+	w.WriteString(" /> ")
+	return ast.WalkContinue, nil
+}
+
+// taskLine returns the 1-based source line of the task item holding box, or
+// 0 if it cannot be determined.
+func taskLine(box ast.Node, source []byte) int {
+	parent := box.Parent()
+	if parent == nil || parent.Lines().Len() == 0 {
+		return 0
+	}
+	start := parent.Lines().At(0).Start
+	return bytes.Count(source[:start], []byte("\n")) + 1
+}
+
+// Tasks returns the task list items in source, in document order. Items
+// inside code blocks are not tasks and are not returned.
+func (r *Renderer) Tasks(source string) []Task {
+	if !strings.Contains(source, "[") {
+		return nil
+	}
+	sourceBytes := []byte(source)
+	doc := r.markdown.Parser().Parse(text.NewReader(sourceBytes))
+
+	var tasks []Task
+	ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+		box, ok := n.(*east.TaskCheckBox)
+		if !ok {
+			return ast.WalkContinue, nil
+		}
+		tasks = append(tasks, Task{
+			Line:    taskLine(box, sourceBytes),
+			Checked: box.IsChecked,
+			Text:    plainText(box.Parent(), sourceBytes),
+		})
+		return ast.WalkSkipChildren, nil
+	})
+	return tasks
+}
+
+// SetTaskState checks or unchecks the task list item on the given 1-based
+// line of source. It returns ErrNotATask if that line holds no task item.
+func SetTaskState(source string, line int, done bool) (string, error) {
+	lines := strings.SplitAfter(source, "\n")
+	if line < 1 || line > len(lines) {
+		return "", ErrNotATask
+	}
+	m := taskLineRegex.FindStringSubmatchIndex(lines[line-1])
+	if m == nil {
+		return "", ErrNotATask
+	}
+	l := lines[line-1]
+	if checked := l[m[4]] != ' '; checked == done {
+		return source, nil
+	}
+	state := " "
+	if done {
+		state = "x"
+	}
+	lines[line-1] = l[:m[4]] + state + l[m[5]:]
+	return strings.Join(lines, ""), nil
+}
@@ -0,0 +1,81 @@
+package renderer
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/sa/gopherwiki/internal/config"
+)
+
+func TestRenderTaskListLines(t *testing.T) {
+	r := New(config.Default())
+
+	input := "# Todo\n\n- [ ] First\n- [x] Second\n\n1. [ ] Numbered\n"
+	html, _, _ := r.Render(input, "/test")
+
+	for _, want := range []string{
+		`<input class="task-checkbox" disabled="" type="checkbox" data-task-line="3" />`,
+		`<input class="task-checkbox" checked="" disabled="" type="checkbox" data-task-line="4" />`,
+		`data-task-line="6"`,
+	} {
+		if !strings.Contains(html, want) {
+			t.Errorf("Render should contain %q, got:\n%s", want, html)
+		}
+	}
+}
+
+func TestTasks(t *testing.T) {
+	r := New(config.Default())
+
+	input := "- [ ] Write **docs**\n- [X] Ship it\n  - [ ] Nested [[Release]]\n\n" +
+		"```\n- [ ] not a task\n```\n\n- plain item\n"
+	got := r.Tasks(input)
+	want := []Task{
+		{Line: 1, Checked: false, Text: "Write docs"},
+		{Line: 2, Checked: true, Text: "Ship it"},
+		{Line: 3, Checked: false, Text: "Nested Release"},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("Tasks() = %+v, want %+v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("Tasks()[%d] = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+
+	if tasks := r.Tasks("No tasks here.\n"); len(tasks) != 0 {
+		t.Errorf("Tasks() = %+v, want none", tasks)
+	}
+}
+
+func TestSetTaskState(t *testing.T) {
+	source := "# Todo\n- [ ] one\n  * [X] two\n> 1. [ ] three\nplain [ ] text\n"
+
+	tests := []struct {
+		line int
+		done bool
+		want string
+	}{
+		{2, true, "# Todo\n- [x] one\n  * [X] two\n> 1. [ ] three\nplain [ ] text\n"},
+		{3, false, "# Todo\n- [ ] one\n  * [ ] two\n> 1. [ ] three\nplain [ ] text\n"},
+		{3, true, source},
+		{4, true, "# Todo\n- [ ] one\n  * [X] two\n> 1. [x] three\nplain [ ] text\n"},
+	}
+	for _, tt := range tests {
+		got, err := SetTaskState(source, tt.line, tt.done)
+		if err != nil {
+			t.Fatalf("SetTaskState(line %d): %v", tt.line, err)
+		}
+		if got != tt.want {
+			t.Errorf("SetTaskState(line %d, %v) = %q, want %q", tt.line, tt.done, got, tt.want)
+		}
+	}
+
+	for _, line := range []int{0, 1, 5, 7} {
+		if _, err := SetTaskState(source, line, true); !errors.Is(err, ErrNotATask) {
+			t.Errorf("SetTaskState(line %d) error = %v, want ErrNotATask", line, err)
+		}
+	}
+}
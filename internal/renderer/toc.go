@@ -0,0 +1,163 @@
+package renderer
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"strconv"
+	"strings"
+
+	"github.com/yuin/goldmark/ast"
+)
+
+// tocPlaceholder is what a paragraph consisting only of {{toc}} renders to.
+// Render replaces it with the page's table of contents.
+const tocPlaceholder = "<p>{{toc}}</p>"
+
+// buildTOC walks the headings of doc, giving each a stable id derived from
+// its text, and returns the table of contents. Headings are also decorated
+// for display: an anchor link to the heading itself and, when numbered
+// headings are enabled, a section number.
+//
+// Headings deeper than the configured TOC depth keep their ids and anchors
+// but are neither listed nor numbered. The page title (level 1) is never
+// numbered, so numbering starts at "1" for the first level 2 heading.
+func (r *Renderer) buildTOC(doc ast.Node, source []byte) []TOCEntry {
+	maxDepth := r.config.TOCMaxDepth
+	if maxDepth < 1 || maxDepth > 6 {
+		maxDepth = 6
+	}
+
+	var toc []TOCEntry
+	var headings []*ast.Heading
+	ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if heading, ok := n.(*ast.Heading); ok && entering {
+			headings = append(headings, heading)
+		}
+		return ast.WalkContinue, nil
+	})
+
+	ids := make(map[string]int)
+	var counters [7]int
+	for _, heading := range headings {
+		text := plainText(heading, source)
+		anchor := uniqueAnchor(ids, slugify(text))
+		heading.SetAttributeString("id", []byte(anchor))
+
+		number := ""
+		if r.config.NumberedHeadings && heading.Level >= 2 && heading.Level <= maxDepth {
+			counters[heading.Level]++
+			for l := heading.Level + 1; l < len(counters); l++ {
+				counters[l] = 0
+			}
+			parts := make([]string, 0, heading.Level-1)
+			for l := 2; l <= heading.Level; l++ {
+				parts = append(parts, strconv.Itoa(counters[l]))
+			}
+			number = strings.Join(parts, ".")
+			label := rawString(`<span class="heading-number">` + number + `</span> `)
+			if first := heading.FirstChild(); first != nil {
+				heading.InsertBefore(heading, first, label)
+			} else {
+				heading.AppendChild(heading, label)
+			}
+		}
+		heading.AppendChild(heading,
+			rawString(`<a class="anchor" href="#`+anchor+`" aria-label="Link to this section">#</a>`))
+
+		if heading.Level <= maxDepth {
+			toc = append(toc, TOCEntry{
+				Index:  len(toc),
+				Text:   text,
+				Level:  heading.Level,
+				Raw:    text,
+				Anchor: anchor,
+				Number: number,
+			})
+		}
+	}
+	return toc
+}
+
+// plainText returns the plain text of a heading or other inline container,
+// including text inside emphasis, links, and code spans.
+func plainText(node ast.Node, source []byte) string {
+	var buf bytes.Buffer
+	ast.Walk(node, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+		switch n := n.(type) {
+		case *ast.Text:
+			buf.Write(n.Segment.Value(source))
+			if n.SoftLineBreak() {
+				buf.WriteByte(' ')
+			}
+		case *ast.String:
+			// The typographer's curly quotes and dashes are HTML entities.
+			if n.IsCode() {
+				buf.WriteString(html.UnescapeString(string(n.Value)))
+			} else {
+				buf.Write(n.Value)
+			}
+		case *WikiLink:
+			buf.WriteString(n.LinkText)
+		case *Emoji:
+			buf.WriteString(n.Value)
+		}
+		return ast.WalkContinue, nil
+	})
+	return strings.TrimSpace(buf.String())
+}
+
+// uniqueAnchor returns slug, or slug with a numeric suffix if an earlier
+// heading already uses it. Headings without any slug characters are called
+// "heading", as goldmark's own generator does.
+func uniqueAnchor(seen map[string]int, slug string) string {
+	if slug == "" {
+		slug = "heading"
+	}
+	count, exists := seen[slug]
+	if !exists {
+		seen[slug] = 0
+		return slug
+	}
+	for {
+		count++
+		candidate := fmt.Sprintf("%s-%d", slug, count)
+		if _, taken := seen[candidate]; !taken {
+			seen[slug] = count
+			seen[candidate] = 0
+			return candidate
+		}
+	}
+}
+
+// rawString returns an inline node that renders s verbatim.
+func rawString(s string) *ast.String {
+	n := ast.NewString([]byte(s))
+	n.SetCode(true)
+	return n
+}
+
+// placeTOC replaces each {{toc}} paragraph in htmlContent with the table of
+// contents, or removes it when the page has no headings to list.
+func placeTOC(htmlContent string, toc []TOCEntry) string {
+	if !strings.Contains(htmlContent, tocPlaceholder+"\n") {
+		return htmlContent
+	}
+	var b strings.Builder
+	if len(toc) > 0 {
+		b.WriteString(`<nav class="toc toc-inline"><ul class="toc-list">`)
+		for _, entry := range toc {
+			fmt.Fprintf(&b, `<li class="toc-item toc-item-h%d"><a href="#%s">`, entry.Level, entry.Anchor)
+			if entry.Number != "" {
+				b.WriteString(`<span class="toc-number">` + entry.Number + `</span> `)
+			}
+			b.WriteString(html.EscapeString(entry.Raw))
+			b.WriteString("</a></li>")
+		}
+		b.WriteString("</ul></nav>\n")
+	}
+	return strings.ReplaceAll(htmlContent, tocPlaceholder+"\n", b.String())
+}
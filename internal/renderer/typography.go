@@ -0,0 +1,49 @@
+package renderer
+
+import (
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/extension"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+
+	"github.com/sa/gopherwiki/internal/config"
+)
+
+// TypographyExtension is a smartypants-style pass turning straight quotes
+// into curly ones, "--" and "---" into en and em dashes, and "..." into an
+// ellipsis. It wraps goldmark's typographer so it can be switched off with
+// the Typographer setting, which is read on every render. Code spans and
+// code blocks are not parsed for inline syntax and keep their punctuation.
+type TypographyExtension struct {
+	config *config.Config
+}
+
+func (e *TypographyExtension) Extend(m goldmark.Markdown) {
+	m.Parser().AddOptions(
+		parser.WithInlineParsers(
+			// The priority goldmark's own extension registers it with.
+			util.Prioritized(&typographyParser{
+				config: e.config,
+				inner:  extension.NewTypographerParser(),
+			}, 9999),
+		),
+	)
+}
+
+type typographyParser struct {
+	config *config.Config
+	inner  parser.InlineParser
+}
+
+func (p *typographyParser) Trigger() []byte {
+	return p.inner.Trigger()
+}
+
+func (p *typographyParser) Parse(parent ast.Node, block text.Reader, pc parser.Context) ast.Node {
+	if p.config != nil && !p.config.Typographer {
+		return nil
+	}
+	return p.inner.Parse(parent, block, pc)
+}
@@ -0,0 +1,324 @@
+// Package settings holds the wiki settings that administrators can change at
+// runtime. Each setting starts from the configured value (environment or
+// config file); values saved from the admin settings page are stored in the
+// preferences table and take precedence until they are reset.
+package settings
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/sa/gopherwiki/internal/config"
+	"github.com/sa/gopherwiki/internal/db"
+)
+
+// AccessLevels lists the valid access levels, from most to least permissive.
+var AccessLevels = []string{"ANONYMOUS", "REGISTERED", "APPROVED", "ADMIN"}
+
+// Edit conflict modes.
+const (
+	// ConflictReject refuses a save based on a revision that is no longer
+	// current and hands the edit back to the author.
+	ConflictReject = "reject"
+	// ConflictOverwrite saves regardless: the last write wins.
+	ConflictOverwrite = "overwrite"
+)
+
+// Preference names under which saved settings are stored.
+const (
+	prefReadAccess          = "read_access"
+	prefWriteAccess         = "write_access"
+	prefAttachmentAccess    = "attachment_access"
+	prefDisableRegistration = "disable_registration"
+	prefHomePage            = "home_page"
+	prefSiteURL             = "site_url"
+	prefEditConflictMode    = "edit_conflict_mode"
+	prefTheme               = "theme"
+	prefDisableFeeds        = "disable_feeds"
+	prefDisableSitemap      = "disable_sitemap"
+)
+
+// Settings are the runtime-editable settings.
+type Settings struct {
+	ReadAccess          string
+	WriteAccess         string
+	AttachmentAccess    string
+	DisableRegistration bool
+	HomePage            string // "" means "Home"
+	SiteURL             string // Public base URL
+	EditConflictMode    string
+	Theme               string // Name of the active theme
+	DisableFeeds        bool   // Serve no RSS or Atom feeds
+	DisableSitemap      bool   // Serve no sitemap.xml
+}
+
+// fromConfig returns the settings as configured.
+func fromConfig(cfg *config.Config) Settings {
+	return Settings{
+		ReadAccess:          cfg.ReadAccess,
+		WriteAccess:         cfg.WriteAccess,
+		AttachmentAccess:    cfg.AttachmentAccess,
+		DisableRegistration: cfg.DisableRegistration,
+		HomePage:            cfg.HomePage,
+		SiteURL:             cfg.SiteURL,
+		EditConflictMode:    cfg.EditConflictMode,
+		Theme:               cfg.Theme,
+		DisableFeeds:        cfg.DisableFeeds,
+		DisableSitemap:      cfg.DisableSitemap,
+	}
+}
+
+// values returns the settings as preference values, keyed by preference name.
+func (s Settings) values() map[string]string {
+	return map[string]string{
+		prefReadAccess:          s.ReadAccess,
+		prefWriteAccess:         s.WriteAccess,
+		prefAttachmentAccess:    s.AttachmentAccess,
+		prefDisableRegistration: strconv.FormatBool(s.DisableRegistration),
+		prefHomePage:            s.HomePage,
+		prefSiteURL:             s.SiteURL,
+		prefEditConflictMode:    s.EditConflictMode,
+		prefTheme:               s.Theme,
+		prefDisableFeeds:        strconv.FormatBool(s.DisableFeeds),
+		prefDisableSitemap:      strconv.FormatBool(s.DisableSitemap),
+	}
+}
+
+// set applies one stored preference, leaving s unchanged when the value is
+// invalid. Unknown names are ignored.
+func (s *Settings) set(name, value string) error {
+	var err error
+	switch name {
+	case prefReadAccess:
+		if err = validateAccess("read access", value); err == nil {
+			s.ReadAccess = value
+		}
+	case prefWriteAccess:
+		if err = validateAccess("write access", value); err == nil {
+			s.WriteAccess = value
+		}
+	case prefAttachmentAccess:
+		if err = validateAccess("attachment access", value); err == nil {
+			s.AttachmentAccess = value
+		}
+	case prefDisableRegistration:
+		var b bool
+		if b, err = strconv.ParseBool(value); err == nil {
+			s.DisableRegistration = b
+		}
+	case prefHomePage:
+		if err = validateHomePage(value); err == nil {
+			s.HomePage = value
+		}
+	case prefSiteURL:
+		if err = validateSiteURL(value); err == nil {
+			s.SiteURL = value
+		}
+	case prefEditConflictMode:
+		if err = validateConflictMode(value); err == nil {
+			s.EditConflictMode = value
+		}
+	case prefTheme:
+		if err = validateTheme(value); err == nil {
+			s.Theme = value
+		}
+	case prefDisableFeeds:
+		var b bool
+		if b, err = strconv.ParseBool(value); err == nil {
+			s.DisableFeeds = b
+		}
+	case prefDisableSitemap:
+		var b bool
+		if b, err = strconv.ParseBool(value); err == nil {
+			s.DisableSitemap = b
+		}
+	}
+	return err
+}
+
+// Validate reports the first invalid setting.
+func (s Settings) Validate() error {
+	checks := []error{
+		validateAccess("read access", s.ReadAccess),
+		validateAccess("write access", s.WriteAccess),
+		validateAccess("attachment access", s.AttachmentAccess),
+		validateHomePage(s.HomePage),
+		validateSiteURL(s.SiteURL),
+		validateConflictMode(s.EditConflictMode),
+		validateTheme(s.Theme),
+	}
+	for _, err := range checks {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func validateAccess(name, level string) error {
+	for _, l := range AccessLevels {
+		if level == l {
+			return nil
+		}
+	}
+	return fmt.Errorf("%s must be one of %s, got %q", name, strings.Join(AccessLevels, ", "), level)
+}
+
+func validateHomePage(page string) error {
+	if strings.HasPrefix(page, "/") && !strings.HasPrefix(page, "/-/") {
+		return fmt.Errorf("home page must be a page name or a /-/ route, got %q", page)
+	}
+	return nil
+}
+
+func validateSiteURL(siteURL string) error {
+	u, err := url.Parse(siteURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("site URL must be an absolute http or https URL, got %q", siteURL)
+	}
+	return nil
+}
+
+func validateConflictMode(mode string) error {
+	if mode != ConflictReject && mode != ConflictOverwrite {
+		return fmt.Errorf("edit conflict mode must be %s or %s, got %q", ConflictReject, ConflictOverwrite, mode)
+	}
+	return nil
+}
+
+// validateTheme checks the form of a theme name. Whether the theme exists
+// is for the server, which loads the themes, to check.
+func validateTheme(name string) error {
+	if !config.ValidThemeName(name) {
+		return fmt.Errorf("theme must be lowercase letters, digits, hyphens, and underscores, got %q", name)
+	}
+	return nil
+}
+
+// Service serves the current settings and saves changes to them. Saved
+// settings apply to the next call of Get, so middleware and handlers that
+// consult the service on each request pick them up immediately.
+type Service struct {
+	config  *config.Config
+	queries *db.Queries
+
+	mu    sync.RWMutex
+	saved map[string]string // Stored preferences by name; nil until loaded
+	gen   uint64            // Bumped on every change, so a load racing one is not cached
+}
+
+// New creates a Service whose defaults come from cfg, read on every call.
+// With nil queries nothing is persisted and Get returns the configured
+// values.
+func New(cfg *config.Config, queries *db.Queries) *Service {
+	return &Service{config: cfg, queries: queries}
+}
+
+// Configured returns the settings as configured, ignoring saved changes.
+func (s *Service) Configured() Settings {
+	return fromConfig(s.config)
+}
+
+// Get returns the current settings: the configured values, overridden by
+// any saved ones. Saved values are loaded from the database once and kept
+// until the next Save or Reset; if loading fails the configured values are
+// returned and loading is retried on the next call.
+func (s *Service) Get(ctx context.Context) Settings {
+	current := s.Configured()
+	if s.queries == nil {
+		return current
+	}
+
+	s.mu.RLock()
+	saved, gen := s.saved, s.gen
+	s.mu.RUnlock()
+	if saved == nil {
+		prefs, err := s.queries.ListPreferences(ctx)
+		if err != nil {
+			slog.Warn("failed to load saved settings, using configured values", "error", err)
+			return current
+		}
+		saved = make(map[string]string)
+		for _, pref := range prefs {
+			if !pref.Value.Valid {
+				continue
+			}
+			var probe Settings
+			if err := probe.set(pref.Name, pref.Value.String); err != nil {
+				slog.Warn("ignoring invalid saved setting", "name", pref.Name, "error", err)
+				continue
+			}
+			saved[pref.Name] = pref.Value.String
+		}
+		s.mu.Lock()
+		if s.gen == gen {
+			s.saved = saved
+		}
+		s.mu.Unlock()
+	}
+
+	for name, value := range saved {
+		current.set(name, value) // Validated when loaded
+	}
+	return current
+}
+
+// Save validates and stores next. Only settings that differ from the
+// configured value are stored, so the others keep following the
+// configuration when it changes.
+func (s *Service) Save(ctx context.Context, next Settings) error {
+	if err := next.Validate(); err != nil {
+		return err
+	}
+	if s.queries == nil {
+		return fmt.Errorf("settings cannot be saved without a database")
+	}
+
+	// Whatever happens below, the next Get reloads from the database.
+	defer s.Invalidate()
+
+	configured := s.Configured().values()
+	for name, value := range next.values() {
+		var err error
+		if value == configured[name] {
+			err = s.queries.DeletePreference(ctx, name)
+		} else {
+			err = s.queries.UpsertPreference(ctx, db.UpsertPreferenceParams{
+				Name:  name,
+				Value: db.NullString(value),
+			})
+		}
+		if err != nil {
+			return fmt.Errorf("saving %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// Reset removes every saved setting, restoring the configured values.
+func (s *Service) Reset(ctx context.Context) error {
+	if s.queries == nil {
+		return nil
+	}
+	defer s.Invalidate()
+	for name := range s.Configured().values() {
+		if err := s.queries.DeletePreference(ctx, name); err != nil {
+			return fmt.Errorf("resetting %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// Invalidate makes the next Get reload the saved settings from the
+// database, for when another process has changed them.
+func (s *Service) Invalidate() {
+	s.mu.Lock()
+	s.saved = nil
+	s.gen++
+	s.mu.Unlock()
+}
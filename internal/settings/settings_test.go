@@ -0,0 +1,120 @@
+package settings
+
+import (
+	"context"
+	"testing"
+
+	"github.com/sa/gopherwiki/internal/config"
+	"github.com/sa/gopherwiki/internal/db"
+)
+
+func newTestService(t *testing.T) (*Service, *db.Database) {
+	t.Helper()
+	database, err := db.Open("sqlite:///:memory:")
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	t.Cleanup(func() { database.Close() })
+	if err := database.Migrate(context.Background()); err != nil {
+		t.Fatalf("failed to migrate: %v", err)
+	}
+	return New(config.Default(), database.Queries), database
+}
+
+func TestService_SaveAndReset(t *testing.T) {
+	svc, database := newTestService(t)
+	ctx := context.Background()
+
+	if got := svc.Get(ctx); got != svc.Configured() {
+		t.Fatalf("Get() before any save = %+v, want configured %+v", got, svc.Configured())
+	}
+
+	next := svc.Get(ctx)
+	next.WriteAccess = "APPROVED"
+	next.DisableRegistration = true
+	next.EditConflictMode = ConflictOverwrite
+	if err := svc.Save(ctx, next); err != nil {
+		t.Fatalf("Save() error: %v", err)
+	}
+	if got := svc.Get(ctx); got != next {
+		t.Errorf("Get() after save = %+v, want %+v", got, next)
+	}
+
+	// A fresh service, as after a restart, sees the saved values.
+	if got := New(config.Default(), database.Queries).Get(ctx); got != next {
+		t.Errorf("Get() from new service = %+v, want %+v", got, next)
+	}
+
+	prefs, err := database.Queries.ListPreferences(ctx)
+	if err != nil {
+		t.Fatalf("ListPreferences() error: %v", err)
+	}
+	if len(prefs) != 3 {
+		t.Errorf("stored %d preferences, want only the 3 changed settings", len(prefs))
+	}
+
+	if err := svc.Reset(ctx); err != nil {
+		t.Fatalf("Reset() error: %v", err)
+	}
+	if got := svc.Get(ctx); got != svc.Configured() {
+		t.Errorf("Get() after reset = %+v, want configured %+v", got, svc.Configured())
+	}
+}
+
+func TestService_SaveRejectsInvalid(t *testing.T) {
+	svc, _ := newTestService(t)
+	ctx := context.Background()
+
+	cases := map[string]func(*Settings){
+		"access level":  func(s *Settings) { s.ReadAccess = "EVERYONE" },
+		"conflict mode": func(s *Settings) { s.EditConflictMode = "merge" },
+		"site URL":      func(s *Settings) { s.SiteURL = "wiki.example.com" },
+		"home page":     func(s *Settings) { s.HomePage = "/admin" },
+	}
+	for name, mutate := range cases {
+		t.Run(name, func(t *testing.T) {
+			next := svc.Get(ctx)
+			mutate(&next)
+			if err := svc.Save(ctx, next); err == nil {
+				t.Error("Save() should reject the invalid value")
+			}
+			if got := svc.Get(ctx); got != svc.Configured() {
+				t.Errorf("Get() after rejected save = %+v, want configured", got)
+			}
+		})
+	}
+}
+
+func TestService_IgnoresInvalidStoredValues(t *testing.T) {
+	svc, database := newTestService(t)
+	ctx := context.Background()
+
+	for name, value := range map[string]string{
+		prefReadAccess:          "EVERYONE",
+		prefDisableRegistration: "maybe",
+		prefWriteAccess:         "ADMIN",
+	} {
+		if err := database.Queries.UpsertPreference(ctx, db.UpsertPreferenceParams{Name: name, Value: db.NullString(value)}); err != nil {
+			t.Fatalf("UpsertPreference(%s) error: %v", name, err)
+		}
+	}
+
+	want := svc.Configured()
+	want.WriteAccess = "ADMIN"
+	if got := svc.Get(ctx); got != want {
+		t.Errorf("Get() = %+v, want %+v", got, want)
+	}
+}
+
+func TestService_WithoutDatabase(t *testing.T) {
+	cfg := config.Default()
+	cfg.ReadAccess = "ADMIN"
+	svc := New(cfg, nil)
+
+	if got := svc.Get(context.Background()).ReadAccess; got != "ADMIN" {
+		t.Errorf("ReadAccess = %q, want ADMIN", got)
+	}
+	if err := svc.Save(context.Background(), svc.Configured()); err == nil {
+		t.Error("Save() without a database should fail")
+	}
+}
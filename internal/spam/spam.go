@@ -0,0 +1,106 @@
+// Package spam screens the contributions of anonymous visitors: page
+// saves, issues, and comments. A Blocklist flags content matching any of
+// its patterns; a Checker asks an outside service, such as Akismet.
+package spam
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// Kinds of Submission.
+const (
+	KindPage    = "page"
+	KindIssue   = "issue"
+	KindComment = "comment"
+)
+
+// Submission is a contribution to screen.
+type Submission struct {
+	Kind        string // KindPage, KindIssue, or KindComment
+	Target      string // The page path, or the issue ID for a comment; "" for an issue
+	Title       string // The issue title; "" otherwise
+	Content     string
+	AuthorName  string
+	AuthorEmail string
+	ClientIP    string
+	UserAgent   string
+	Referrer    string
+}
+
+// Verdict is the outcome of a check.
+type Verdict struct {
+	Spam   bool
+	Reason string // Why it is spam, shown to the moderators
+}
+
+// Checker judges submissions, typically by asking an outside service. An
+// error means it could not tell.
+type Checker interface {
+	Check(ctx context.Context, sub Submission) (Verdict, error)
+}
+
+// Blocklist is a list of regular expressions content must not match. The
+// zero value and nil block nothing.
+type Blocklist struct {
+	patterns []*regexp.Regexp
+}
+
+// ParseBlocklist reads a blocklist of one regular expression per line,
+// matched case-insensitively. Blank lines and lines starting with # are
+// skipped.
+func ParseBlocklist(text string) (*Blocklist, error) {
+	b := &Blocklist{}
+	scanner := bufio.NewScanner(strings.NewReader(text))
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		re, err := regexp.Compile("(?i)" + line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", n, err)
+		}
+		b.patterns = append(b.patterns, re)
+	}
+	return b, scanner.Err()
+}
+
+// LoadBlocklist reads the blocklist in the file at path.
+func LoadBlocklist(path string) (*Blocklist, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	b, err := ParseBlocklist(string(data))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return b, nil
+}
+
+// Len returns the number of patterns.
+func (b *Blocklist) Len() int {
+	if b == nil {
+		return 0
+	}
+	return len(b.patterns)
+}
+
+// Check flags sub when its title or content matches a pattern, naming the
+// first that does. It never fails.
+func (b *Blocklist) Check(ctx context.Context, sub Submission) (Verdict, error) {
+	if b == nil {
+		return Verdict{}, nil
+	}
+	for _, re := range b.patterns {
+		if re.MatchString(sub.Title) || re.MatchString(sub.Content) {
+			return Verdict{Spam: true, Reason: "matches blocklist pattern " + strings.TrimPrefix(re.String(), "(?i)")}, nil
+		}
+	}
+	return Verdict{}, nil
+}
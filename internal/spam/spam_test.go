@@ -0,0 +1,59 @@
+package spam
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestBlocklist(t *testing.T) {
+	b, err := ParseBlocklist("# Pharmacy spam\n\ncheap\\s+pills\n  casino  \n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b.Len() != 2 {
+		t.Fatalf("Len = %d, want 2", b.Len())
+	}
+
+	ctx := context.Background()
+	for _, tc := range []struct {
+		sub  Submission
+		spam bool
+	}{
+		{Submission{Content: "Buy CHEAP   pills now"}, true},
+		{Submission{Title: "Online Casino", Content: "hello"}, true},
+		{Submission{Content: "A page about pillows"}, false},
+	} {
+		v, err := b.Check(ctx, tc.sub)
+		if err != nil || v.Spam != tc.spam {
+			t.Errorf("Check(%+v) = %+v, %v; want spam %v", tc.sub, v, err, tc.spam)
+		}
+		if v.Spam && v.Reason == "" {
+			t.Errorf("Check(%+v) gave no reason", tc.sub)
+		}
+	}
+
+	var none *Blocklist
+	if v, _ := none.Check(ctx, Submission{Content: "casino"}); v.Spam || none.Len() != 0 {
+		t.Error("a nil blocklist should block nothing")
+	}
+
+	if _, err := ParseBlocklist("ok\n(unclosed\n"); err == nil {
+		t.Error("ParseBlocklist accepted an invalid pattern")
+	}
+}
+
+func TestLoadBlocklist(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "blocklist.txt")
+	if err := os.WriteFile(path, []byte("viagra\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	b, err := LoadBlocklist(path)
+	if err != nil || b.Len() != 1 {
+		t.Fatalf("LoadBlocklist = %v, %v", b, err)
+	}
+	if _, err := LoadBlocklist(filepath.Join(t.TempDir(), "missing.txt")); err == nil {
+		t.Error("LoadBlocklist of a missing file succeeded")
+	}
+}
@@ -0,0 +1,162 @@
+package storage
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/format/packfile"
+	"github.com/go-git/go-git/v5/plumbing/revlist"
+)
+
+// bundleSignature opens every git bundle in version 2 of the format.
+const bundleSignature = "# v2 git bundle"
+
+// bundlePackWindow is the delta-compression window used for bundle packs.
+const bundlePackWindow = 10
+
+// ErrEmptyRepository is returned by Bundle for a repository without commits.
+var ErrEmptyRepository = errors.New("storage: repository has no commits")
+
+// Bundle writes the whole repository (all branches and tags, plus HEAD) as
+// a git bundle, the same format `git bundle create - --all` produces. The
+// result can be restored with RestoreBundle or cloned with `git clone`.
+func (g *GitStorage) Bundle(ctx context.Context, w io.Writer) error {
+	if err := g.rLockWithReload(ctx); err != nil {
+		return err
+	}
+	defer g.mu.RUnlock()
+	return writeBundle(g.repo, w)
+}
+
+// writeBundle writes every branch and tag of repo, plus HEAD, as a git
+// bundle.
+func writeBundle(repo *git.Repository, w io.Writer) error {
+	head, err := repo.Head()
+	if err != nil {
+		return ErrEmptyRepository
+	}
+
+	var refs []*plumbing.Reference
+	iter, err := repo.References()
+	if err != nil {
+		return err
+	}
+	err = iter.ForEach(func(ref *plumbing.Reference) error {
+		if ref.Type() == plumbing.HashReference && (ref.Name().IsBranch() || ref.Name().IsTag()) {
+			refs = append(refs, ref)
+		}
+		return nil
+	})
+	iter.Close()
+	if err != nil {
+		return err
+	}
+
+	tips := []plumbing.Hash{head.Hash()}
+	var header strings.Builder
+	header.WriteString(bundleSignature + "\n")
+	for _, ref := range refs {
+		fmt.Fprintf(&header, "%s %s\n", ref.Hash(), ref.Name())
+		tips = append(tips, ref.Hash())
+	}
+	fmt.Fprintf(&header, "%s %s\n\n", head.Hash(), plumbing.HEAD)
+
+	objects, err := revlist.Objects(repo.Storer, tips, nil)
+	if err != nil {
+		return err
+	}
+	if _, err := io.WriteString(w, header.String()); err != nil {
+		return err
+	}
+	_, err = packfile.NewEncoder(w, repo.Storer, false).Encode(objects, bundlePackWindow)
+	return err
+}
+
+// RestoreBundle creates a new repository at path from a bundle written by
+// Bundle and checks out HEAD. path must not already contain a repository.
+func RestoreBundle(r io.Reader, path string) (*GitStorage, error) {
+	br := bufio.NewReader(r)
+	line, err := br.ReadString('\n')
+	if err != nil || strings.TrimSuffix(line, "\n") != bundleSignature {
+		return nil, fmt.Errorf("not a v2 git bundle")
+	}
+
+	var refs []*plumbing.Reference
+	var head plumbing.Hash
+	for {
+		line, err := br.ReadString('\n')
+		if err != nil {
+			return nil, fmt.Errorf("truncated bundle header: %w", err)
+		}
+		line = strings.TrimSuffix(line, "\n")
+		if line == "" {
+			break
+		}
+		if strings.HasPrefix(line, "-") {
+			return nil, fmt.Errorf("incremental bundles are not supported")
+		}
+		hash, name, ok := strings.Cut(line, " ")
+		if !ok || !plumbing.IsHash(hash) {
+			return nil, fmt.Errorf("malformed bundle reference %q", line)
+		}
+		if name == string(plumbing.HEAD) {
+			head = plumbing.NewHash(hash)
+			continue
+		}
+		refs = append(refs, plumbing.NewHashReference(plumbing.ReferenceName(name), plumbing.NewHash(hash)))
+	}
+
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get absolute path: %w", err)
+	}
+	repo, err := git.PlainInit(absPath, false)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize repository: %w", err)
+	}
+	if err := packfile.UpdateObjectStorage(repo.Storer, br); err != nil {
+		return nil, fmt.Errorf("failed to unpack bundle: %w", err)
+	}
+
+	// Point HEAD at the branch the bundle's HEAD was on; prefer master/main
+	// when several branches share the commit.
+	var headBranch plumbing.ReferenceName
+	for _, ref := range refs {
+		if err := repo.Storer.SetReference(ref); err != nil {
+			return nil, err
+		}
+		if ref.Name().IsBranch() && ref.Hash() == head {
+			if headBranch == "" || ref.Name() == plumbing.Master || ref.Name() == plumbing.Main {
+				headBranch = ref.Name()
+			}
+		}
+	}
+	if head.IsZero() {
+		return nil, fmt.Errorf("bundle has no HEAD")
+	}
+	if headBranch != "" {
+		err = repo.Storer.SetReference(plumbing.NewSymbolicReference(plumbing.HEAD, headBranch))
+	} else {
+		err = repo.Storer.SetReference(plumbing.NewHashReference(plumbing.HEAD, head))
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	wt, err := repo.Worktree()
+	if err != nil {
+		return nil, err
+	}
+	if err := wt.Reset(&git.ResetOptions{Commit: head, Mode: git.HardReset}); err != nil {
+		return nil, fmt.Errorf("failed to check out restored repository: %w", err)
+	}
+
+	return &GitStorage{path: absPath, repo: repo}, nil
+}
@@ -0,0 +1,129 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"io"
+
+	"github.com/sa/gopherwiki/internal/util"
+)
+
+// BlobCipher encrypts and decrypts file contents. Open must accept data that
+// was never sealed and return it unchanged, so enabling encryption does not
+// break files stored earlier. *encryption.Cipher implements it.
+type BlobCipher interface {
+	Seal(plaintext []byte) ([]byte, error)
+	Open(data []byte) ([]byte, error)
+}
+
+// EncryptedStorage wraps a Storage and encrypts attachments at rest. Pages
+// (markdown and Quarto sources) stay plaintext so that history, diffs, blame,
+// and the search index keep working; everything else is sealed before it is
+// committed and opened again on load. Listing, renaming, and deleting work on
+// filenames and pass straight through.
+type EncryptedStorage struct {
+	Storage
+	cipher BlobCipher
+}
+
+// NewEncryptedStorage wraps inner so attachments are encrypted with c.
+func NewEncryptedStorage(inner Storage, c BlobCipher) *EncryptedStorage {
+	return &EncryptedStorage{Storage: inner, cipher: c}
+}
+
+func encryptsFile(filename string) bool {
+	return !util.IsMarkdownFile(filename)
+}
+
+// Load reads a file, decrypting it when it is an attachment.
+func (e *EncryptedStorage) Load(ctx context.Context, filename, revision string) (string, error) {
+	if !encryptsFile(filename) {
+		return e.Storage.Load(ctx, filename, revision)
+	}
+	data, err := e.LoadBytes(ctx, filename, revision)
+	return string(data), err
+}
+
+// LoadBytes reads a file, decrypting it when it is an attachment.
+func (e *EncryptedStorage) LoadBytes(ctx context.Context, filename, revision string) ([]byte, error) {
+	data, err := e.Storage.LoadBytes(ctx, filename, revision)
+	if err != nil || !encryptsFile(filename) {
+		return data, err
+	}
+	return e.cipher.Open(data)
+}
+
+// Open opens a file for reading. An attachment is decrypted, and so read
+// into memory whole.
+func (e *EncryptedStorage) Open(ctx context.Context, filename string) (io.ReadSeekCloser, error) {
+	if !encryptsFile(filename) {
+		return e.Storage.Open(ctx, filename)
+	}
+	data, err := e.LoadBytes(ctx, filename, "")
+	if err != nil {
+		return nil, err
+	}
+	return nopCloser{bytes.NewReader(data)}, nil
+}
+
+// Store writes a file, encrypting it when it is an attachment.
+func (e *EncryptedStorage) Store(ctx context.Context, filename, content, message string, author Author) (bool, error) {
+	if !encryptsFile(filename) {
+		return e.Storage.Store(ctx, filename, content, message, author)
+	}
+	return e.StoreBytes(ctx, filename, []byte(content), message, author)
+}
+
+// StoreBytes writes a file, encrypting it when it is an attachment. Sealing
+// uses a fresh nonce, so storing identical content again is always recorded
+// as a change unless the stored plaintext is compared first.
+func (e *EncryptedStorage) StoreBytes(ctx context.Context, filename string, content []byte, message string, author Author) (bool, error) {
+	if !encryptsFile(filename) {
+		return e.Storage.StoreBytes(ctx, filename, content, message, author)
+	}
+	if current, err := e.LoadBytes(ctx, filename, ""); err == nil && string(current) == string(content) {
+		return false, nil
+	}
+	sealed, err := e.cipher.Seal(content)
+	if err != nil {
+		return false, err
+	}
+	return e.Storage.StoreBytes(ctx, filename, sealed, message, author)
+}
+
+// StoreFiles writes several files in one commit, encrypting the attachments
+// among them. Attachments whose stored plaintext is unchanged are left out,
+// as in StoreBytes.
+func (e *EncryptedStorage) StoreFiles(ctx context.Context, files map[string][]byte, message string, author Author) (bool, error) {
+	sealed := make(map[string][]byte, len(files))
+	for filename, content := range files {
+		if !encryptsFile(filename) {
+			sealed[filename] = content
+			continue
+		}
+		if current, err := e.LoadBytes(ctx, filename, ""); err == nil && string(current) == string(content) {
+			continue
+		}
+		data, err := e.cipher.Seal(content)
+		if err != nil {
+			return false, err
+		}
+		sealed[filename] = data
+	}
+	if len(sealed) == 0 {
+		return false, nil
+	}
+	return e.Storage.StoreFiles(ctx, sealed, message, author)
+}
+
+// Size returns the plaintext size of a file.
+func (e *EncryptedStorage) Size(ctx context.Context, filename string) (int64, error) {
+	if !encryptsFile(filename) {
+		return e.Storage.Size(ctx, filename)
+	}
+	data, err := e.LoadBytes(ctx, filename, "")
+	if err != nil {
+		return 0, err
+	}
+	return int64(len(data)), nil
+}
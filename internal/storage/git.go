@@ -1,9 +1,13 @@
 package storage
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"io"
 	"log/slog"
+	"mime"
+	"net/mail"
 	"os"
 	"path/filepath"
 	"sort"
@@ -18,12 +22,17 @@ import (
 
 var errIterDone = errors.New("iteration done")
 
-// makeSignature creates a git commit signature from an Author.
+// makeSignature creates a git commit signature from an Author. The commit is
+// dated now unless the author carries a date.
 func makeSignature(author Author) *object.Signature {
+	when := author.When
+	if when.IsZero() {
+		when = time.Now()
+	}
 	return &object.Signature{
 		Name:  author.Name,
 		Email: author.Email,
-		When:  time.Now(),
+		When:  when,
 	}
 }
 
@@ -32,6 +41,14 @@ type GitStorage struct {
 	path string
 	repo *git.Repository
 	mu   sync.RWMutex
+
+	// sharedLock and onReload coordinate with other processes using the
+	// repository; see SetSharedLock and OnReload.
+	sharedLock func(ctx context.Context) (release func(), err error)
+	onReload   func()
+
+	// gitBin is the git executable run for history; see UseGitBinary.
+	gitBin string
 }
 
 // NewGitStorage creates a new GitStorage for the given path.
@@ -85,7 +102,7 @@ func (g *GitStorage) validatePath(filename string) error {
 }
 
 // Exists checks if a file exists.
-func (g *GitStorage) Exists(filename string) bool {
+func (g *GitStorage) Exists(ctx context.Context, filename string) bool {
 	if g.validatePath(filename) != nil {
 		return false
 	}
@@ -94,7 +111,7 @@ func (g *GitStorage) Exists(filename string) bool {
 }
 
 // IsDir checks if a path is a directory.
-func (g *GitStorage) IsDir(dirname string) bool {
+func (g *GitStorage) IsDir(ctx context.Context, dirname string) bool {
 	if g.validatePath(dirname) != nil {
 		return false
 	}
@@ -103,7 +120,7 @@ func (g *GitStorage) IsDir(dirname string) bool {
 }
 
 // IsEmptyDir checks if a directory is empty.
-func (g *GitStorage) IsEmptyDir(dirname string) bool {
+func (g *GitStorage) IsEmptyDir(ctx context.Context, dirname string) bool {
 	if g.validatePath(dirname) != nil {
 		return false
 	}
@@ -112,7 +129,7 @@ func (g *GitStorage) IsEmptyDir(dirname string) bool {
 }
 
 // Mtime returns the modification time of a file.
-func (g *GitStorage) Mtime(filename string) (time.Time, error) {
+func (g *GitStorage) Mtime(ctx context.Context, filename string) (time.Time, error) {
 	if err := g.validatePath(filename); err != nil {
 		return time.Time{}, err
 	}
@@ -124,7 +141,7 @@ func (g *GitStorage) Mtime(filename string) (time.Time, error) {
 }
 
 // Size returns the size of a file in bytes.
-func (g *GitStorage) Size(filename string) (int64, error) {
+func (g *GitStorage) Size(ctx context.Context, filename string) (int64, error) {
 	if err := g.validatePath(filename); err != nil {
 		return 0, err
 	}
@@ -135,6 +152,57 @@ func (g *GitStorage) Size(filename string) (int64, error) {
 	return info.Size(), nil
 }
 
+// SetSharedLock makes every write take lock as well as the in-process lock,
+// for repositories that several processes write to. The lock is released
+// once the commit is done. It must be set before the storage is used.
+func (g *GitStorage) SetSharedLock(lock func(ctx context.Context) (release func(), err error)) {
+	g.sharedLock = lock
+}
+
+// OnReload sets fn to be called after a reload marker made the repository
+// reload, for telling the other processes that use it. It must be set
+// before the storage is used.
+func (g *GitStorage) OnReload(fn func()) {
+	g.onReload = fn
+}
+
+// Reopen reopens the repository, picking up changes made to it from
+// outside, as a reload marker does.
+func (g *GitStorage) Reopen() error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	repo, err := git.PlainOpen(g.path)
+	if err != nil {
+		return err
+	}
+	g.repo = repo
+	return nil
+}
+
+// lockWrite takes g.mu for writing, then the lock set with SetSharedLock,
+// if any, and returns the function releasing both. It fails, holding
+// neither, if ctx is done by the time it has g.mu: a write that has begun
+// runs to the end regardless.
+func (g *GitStorage) lockWrite(ctx context.Context) (release func(), err error) {
+	g.mu.Lock()
+	if err := ctx.Err(); err != nil {
+		g.mu.Unlock()
+		return nil, err
+	}
+	if g.sharedLock == nil {
+		return g.mu.Unlock, nil
+	}
+	releaseShared, err := g.sharedLock(ctx)
+	if err != nil {
+		g.mu.Unlock()
+		return nil, err
+	}
+	return func() {
+		releaseShared()
+		g.mu.Unlock()
+	}, nil
+}
+
 // checkReload checks if the repository needs to be reloaded.
 // Caller must hold g.mu (write lock).
 func (g *GitStorage) checkReload() {
@@ -147,12 +215,16 @@ func (g *GitStorage) checkReload() {
 		if err == nil {
 			g.repo = repo
 		}
+		if g.onReload != nil {
+			g.onReload()
+		}
 	}
 }
 
 // rLockWithReload acquires a read lock, performing a reload first if the
-// sentinel file exists. Caller must call g.mu.RUnlock() when done.
-func (g *GitStorage) rLockWithReload() {
+// sentinel file exists. It fails, without the lock, if ctx is done by the
+// time it has it; otherwise the caller must call g.mu.RUnlock() when done.
+func (g *GitStorage) rLockWithReload(ctx context.Context) error {
 	reloadPath := filepath.Join(g.path, ".git", "RELOAD_GIT")
 	if _, err := os.Stat(reloadPath); err == nil {
 		g.mu.Lock()
@@ -160,11 +232,16 @@ func (g *GitStorage) rLockWithReload() {
 		g.mu.Unlock()
 	}
 	g.mu.RLock()
+	if err := ctx.Err(); err != nil {
+		g.mu.RUnlock()
+		return err
+	}
+	return nil
 }
 
 // Load reads a file's content.
-func (g *GitStorage) Load(filename string, revision string) (string, error) {
-	data, err := g.LoadBytes(filename, revision)
+func (g *GitStorage) Load(ctx context.Context, filename string, revision string) (string, error) {
+	data, err := g.LoadBytes(ctx, filename, revision)
 	if err != nil {
 		return "", err
 	}
@@ -172,11 +249,13 @@ func (g *GitStorage) Load(filename string, revision string) (string, error) {
 }
 
 // LoadBytes reads a file's content as bytes.
-func (g *GitStorage) LoadBytes(filename string, revision string) ([]byte, error) {
+func (g *GitStorage) LoadBytes(ctx context.Context, filename string, revision string) ([]byte, error) {
 	if err := g.validatePath(filename); err != nil {
 		return nil, err
 	}
-	g.rLockWithReload()
+	if err := g.rLockWithReload(ctx); err != nil {
+		return nil, err
+	}
 	defer g.mu.RUnlock()
 
 	if revision != "" {
@@ -214,18 +293,40 @@ func (g *GitStorage) LoadBytes(filename string, revision string) ([]byte, error)
 	return data, nil
 }
 
+// Open opens a file of the working directory for reading.
+func (g *GitStorage) Open(ctx context.Context, filename string) (io.ReadSeekCloser, error) {
+	if err := g.validatePath(filename); err != nil {
+		return nil, err
+	}
+	f, err := os.Open(filepath.Join(g.path, filename))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	if info, err := f.Stat(); err != nil || info.IsDir() {
+		f.Close()
+		return nil, ErrNotFound
+	}
+	return f, nil
+}
+
 // Store writes content to a file and commits it.
-func (g *GitStorage) Store(filename, content, message string, author Author) (bool, error) {
-	return g.StoreBytes(filename, []byte(content), message, author)
+func (g *GitStorage) Store(ctx context.Context, filename, content, message string, author Author) (bool, error) {
+	return g.StoreBytes(ctx, filename, []byte(content), message, author)
 }
 
 // StoreBytes writes binary content to a file and commits it.
-func (g *GitStorage) StoreBytes(filename string, content []byte, message string, author Author) (bool, error) {
+func (g *GitStorage) StoreBytes(ctx context.Context, filename string, content []byte, message string, author Author) (bool, error) {
 	if err := g.validatePath(filename); err != nil {
 		return false, err
 	}
-	g.mu.Lock()
-	defer g.mu.Unlock()
+	release, err := g.lockWrite(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer release()
 	if message == "" {
 		message = "Update " + filename
 	}
@@ -277,13 +378,80 @@ func (g *GitStorage) StoreBytes(filename string, content []byte, message string,
 	return true, nil
 }
 
+// StoreFiles writes several files and commits them together. It reports
+// whether anything changed; files whose content is already stored are not
+// part of the commit, and no commit is made if none changed.
+func (g *GitStorage) StoreFiles(ctx context.Context, files map[string][]byte, message string, author Author) (bool, error) {
+	for filename := range files {
+		if err := g.validatePath(filename); err != nil {
+			return false, err
+		}
+	}
+	release, err := g.lockWrite(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer release()
+	if message == "" {
+		message = fmt.Sprintf("Update %d files", len(files))
+	}
+
+	for filename, content := range files {
+		fullPath := filepath.Join(g.path, filename)
+		if err := os.MkdirAll(filepath.Dir(fullPath), 0o775); err != nil {
+			return false, err
+		}
+		if err := os.WriteFile(fullPath, content, 0o644); err != nil {
+			return false, err
+		}
+	}
+
+	worktree, err := g.repo.Worktree()
+	if err != nil {
+		return false, err
+	}
+	status, err := worktree.Status()
+	if err != nil {
+		return false, err
+	}
+
+	changed := false
+	for filename := range files {
+		// Unchanged files are absent from the status (status.File would
+		// report them as untracked).
+		fileStatus, ok := status[filename]
+		if !ok || fileStatus.Staging == git.Unmodified && fileStatus.Worktree == git.Unmodified {
+			continue
+		}
+		if _, err := worktree.Add(filename); err != nil {
+			return false, fmt.Errorf("failed to add %s: %w", filename, err)
+		}
+		changed = true
+	}
+	if !changed {
+		return false, nil
+	}
+
+	_, err = worktree.Commit(message, &git.CommitOptions{
+		Author: makeSignature(author),
+	})
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
 // Delete removes a file or directory.
-func (g *GitStorage) Delete(filename string, message string, author Author) error {
+func (g *GitStorage) Delete(ctx context.Context, filename string, message string, author Author) error {
 	if err := g.validatePath(filename); err != nil {
 		return err
 	}
-	g.mu.Lock()
-	defer g.mu.Unlock()
+	release, err := g.lockWrite(ctx)
+	if err != nil {
+		return err
+	}
+	defer release()
 	worktree, err := g.repo.Worktree()
 	if err != nil {
 		return err
@@ -330,16 +498,19 @@ func (g *GitStorage) Delete(filename string, message string, author Author) erro
 }
 
 // Rename renames a file.
-func (g *GitStorage) Rename(oldFilename, newFilename, message string, author Author) error {
+func (g *GitStorage) Rename(ctx context.Context, oldFilename, newFilename, message string, author Author) error {
 	if err := g.validatePath(oldFilename); err != nil {
 		return err
 	}
 	if err := g.validatePath(newFilename); err != nil {
 		return err
 	}
-	g.mu.Lock()
-	defer g.mu.Unlock()
-	if g.Exists(newFilename) {
+	release, err := g.lockWrite(ctx)
+	if err != nil {
+		return err
+	}
+	defer release()
+	if g.Exists(ctx, newFilename) {
 		return fmt.Errorf("the filename %q already exists", newFilename)
 	}
 
@@ -382,15 +553,24 @@ func (g *GitStorage) Rename(oldFilename, newFilename, message string, author Aut
 }
 
 // Metadata returns commit metadata for a file.
-func (g *GitStorage) Metadata(filename string, revision string) (*CommitMetadata, error) {
+func (g *GitStorage) Metadata(ctx context.Context, filename string, revision string) (*CommitMetadata, error) {
 	if err := g.validatePath(filename); err != nil {
 		return nil, err
 	}
-	g.rLockWithReload()
+	if err := g.rLockWithReload(ctx); err != nil {
+		return nil, err
+	}
 	defer g.mu.RUnlock()
 
 	var commit *object.Commit
 
+	if revision == "" && g.gitBin != "" {
+		meta, err := g.cliMetadata(ctx, filename)
+		if err == nil || errors.Is(err, ErrNotFound) {
+			return meta, err
+		}
+		cliFallback("metadata", err)
+	}
 	if revision == "" {
 		// Get latest commit for file
 		iter, err := g.repo.Log(&git.LogOptions{
@@ -420,10 +600,10 @@ func (g *GitStorage) Metadata(filename string, revision string) (*CommitMetadata
 		}
 	}
 
-	return g.commitToMetadata(commit, false)
+	return g.commitToMetadata(ctx, commit, false)
 }
 
-func (g *GitStorage) commitToMetadata(commit *object.Commit, includeFiles bool) (*CommitMetadata, error) {
+func (g *GitStorage) commitToMetadata(ctx context.Context, commit *object.Commit, includeFiles bool) (*CommitMetadata, error) {
 	var files []string
 
 	if includeFiles {
@@ -445,7 +625,7 @@ func (g *GitStorage) commitToMetadata(commit *object.Commit, includeFiles bool)
 				commitTree = nil
 			}
 			if parentTree != nil && commitTree != nil {
-				changes, err := parentTree.Diff(commitTree)
+				changes, err := parentTree.DiffContext(ctx, commitTree)
 				if err == nil {
 					for _, change := range changes {
 						if change.From.Name != "" {
@@ -483,19 +663,28 @@ func (g *GitStorage) commitToMetadata(commit *object.Commit, includeFiles bool)
 }
 
 // Log returns the commit history.
-func (g *GitStorage) Log(filename string, maxCount int) ([]CommitMetadata, error) {
+func (g *GitStorage) Log(ctx context.Context, filename string, maxCount int) ([]CommitMetadata, error) {
 	if filename != "" {
 		if err := g.validatePath(filename); err != nil {
 			return nil, err
 		}
 	}
-	g.rLockWithReload()
+	if err := g.rLockWithReload(ctx); err != nil {
+		return nil, err
+	}
 	defer g.mu.RUnlock()
-	return g.logLocked(filename, maxCount)
+	if g.gitBin != "" {
+		log, err := g.cliLogFile(ctx, filename, maxCount)
+		if err == nil {
+			return log, nil
+		}
+		cliFallback("log", err)
+	}
+	return g.logLocked(ctx, filename, maxCount)
 }
 
 // logLocked performs the log operation. Caller must hold g.mu (read or write).
-func (g *GitStorage) logLocked(filename string, maxCount int) ([]CommitMetadata, error) {
+func (g *GitStorage) logLocked(ctx context.Context, filename string, maxCount int) ([]CommitMetadata, error) {
 	opts := &git.LogOptions{
 		Order: git.LogOrderCommitterTime,
 	}
@@ -519,8 +708,11 @@ func (g *GitStorage) logLocked(filename string, maxCount int) ([]CommitMetadata,
 		if maxCount > 0 && count >= maxCount {
 			return errIterDone
 		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
 
-		meta, err := g.commitToMetadata(commit, false)
+		meta, err := g.commitToMetadata(ctx, commit, false)
 		if err != nil {
 			return err
 		}
@@ -529,6 +721,9 @@ func (g *GitStorage) logLocked(filename string, maxCount int) ([]CommitMetadata,
 		return nil
 	})
 
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
 	if err != nil && !errors.Is(err, errIterDone) && len(result) == 0 {
 		return nil, ErrNotFound
 	}
@@ -536,13 +731,102 @@ func (g *GitStorage) logLocked(filename string, maxCount int) ([]CommitMetadata,
 	return result, nil
 }
 
+// QueryLog returns repository history matching the query, newest first.
+func (g *GitStorage) QueryLog(ctx context.Context, query LogQuery) ([]CommitMetadata, error) {
+	if err := g.rLockWithReload(ctx); err != nil {
+		return nil, err
+	}
+	defer g.mu.RUnlock()
+	if g.gitBin != "" {
+		log, err := g.cliQueryLog(ctx, query)
+		if err == nil {
+			return log, nil
+		}
+		cliFallback("query_log", err)
+	}
+
+	opts := &git.LogOptions{
+		Order: git.LogOrderCommitterTime,
+	}
+	if query.PathPrefix != "" || query.Path != "" {
+		prefix, file := query.PathPrefix, query.Path
+		opts.PathFilter = func(path string) bool {
+			return strings.HasPrefix(path, prefix) && (file == "" || path == file)
+		}
+	}
+	if !query.Since.IsZero() {
+		since := query.Since
+		opts.Since = &since
+	}
+	if !query.Until.IsZero() {
+		until := query.Until
+		opts.Until = &until
+	}
+
+	iter, err := g.repo.Log(opts)
+	if err != nil {
+		// An empty repository has no HEAD, hence no history.
+		return []CommitMetadata{}, nil
+	}
+	defer iter.Close()
+
+	author := strings.ToLower(query.Author)
+	result := []CommitMetadata{}
+	skipped := 0
+
+	err = iter.ForEach(func(commit *object.Commit) error {
+		if query.Limit > 0 && len(result) >= query.Limit {
+			return errIterDone
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if query.AuthorEmail != "" && !strings.EqualFold(commit.Author.Email, query.AuthorEmail) {
+			return nil
+		}
+		if author != "" &&
+			!strings.Contains(strings.ToLower(commit.Author.Name), author) &&
+			!strings.Contains(strings.ToLower(commit.Author.Email), author) {
+			return nil
+		}
+		if skipped < query.Offset {
+			skipped++
+			return nil
+		}
+
+		meta, err := g.commitToMetadata(ctx, commit, true)
+		if err != nil {
+			return err
+		}
+		result = append(result, *meta)
+		return nil
+	})
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	if err != nil && !errors.Is(err, errIterDone) {
+		return nil, fmt.Errorf("%w: %v", ErrStorage, err)
+	}
+
+	return result, nil
+}
+
 // Blame returns blame information for a file.
-func (g *GitStorage) Blame(filename string, revision string) ([]BlameLine, error) {
+func (g *GitStorage) Blame(ctx context.Context, filename string, revision string) ([]BlameLine, error) {
 	if err := g.validatePath(filename); err != nil {
 		return nil, err
 	}
-	g.rLockWithReload()
+	if err := g.rLockWithReload(ctx); err != nil {
+		return nil, err
+	}
 	defer g.mu.RUnlock()
+	if g.gitBin != "" {
+		lines, err := g.cliBlame(ctx, filename, revision)
+		if err == nil {
+			return lines, nil
+		}
+		cliFallback("blame", err)
+	}
 
 	var commitHash plumbing.Hash
 	if revision == "" {
@@ -569,15 +853,24 @@ func (g *GitStorage) Blame(filename string, revision string) ([]BlameLine, error
 		return nil, ErrNotFound
 	}
 
+	subjects := make(map[plumbing.Hash]string)
 	var lines []BlameLine
 	for i, line := range result.Lines {
+		subject, ok := subjects[line.Hash]
+		if !ok {
+			if c, err := g.repo.CommitObject(line.Hash); err == nil {
+				subject, _, _ = strings.Cut(strings.TrimSpace(c.Message), "\n")
+			}
+			subjects[line.Hash] = subject
+		}
 		lines = append(lines, BlameLine{
-			Revision:   line.Hash.String()[:6],
-			AuthorName: line.Author,
-			Datetime:   line.Date,
-			LineNumber: i + 1,
-			Line:       line.Text,
-			Message:    "",
+			Revision:    line.Hash.String()[:6],
+			AuthorName:  line.AuthorName,
+			AuthorEmail: line.Author,
+			Datetime:    line.Date,
+			LineNumber:  i + 1,
+			Line:        line.Text,
+			Message:     subject,
 		})
 	}
 
@@ -585,9 +878,18 @@ func (g *GitStorage) Blame(filename string, revision string) ([]BlameLine, error
 }
 
 // Diff returns the diff between two revisions.
-func (g *GitStorage) Diff(revA, revB string) (string, error) {
-	g.rLockWithReload()
+func (g *GitStorage) Diff(ctx context.Context, revA, revB string) (string, error) {
+	if err := g.rLockWithReload(ctx); err != nil {
+		return "", err
+	}
 	defer g.mu.RUnlock()
+	if g.gitBin != "" {
+		diff, err := g.cliDiff(ctx, revA, revB)
+		if err == nil {
+			return diff, nil
+		}
+		cliFallback("diff", err)
+	}
 	hashA, err := g.repo.ResolveRevision(plumbing.Revision(revA))
 	if err != nil {
 		return "", ErrNotFound
@@ -618,12 +920,12 @@ func (g *GitStorage) Diff(revA, revB string) (string, error) {
 		return "", err
 	}
 
-	changes, err := treeA.Diff(treeB)
+	changes, err := treeA.DiffContext(ctx, treeB)
 	if err != nil {
 		return "", err
 	}
 
-	patch, err := changes.Patch()
+	patch, err := changes.PatchContext(ctx)
 	if err != nil {
 		return "", err
 	}
@@ -632,8 +934,10 @@ func (g *GitStorage) Diff(revA, revB string) (string, error) {
 }
 
 // ShowCommit returns metadata and diff for a specific commit.
-func (g *GitStorage) ShowCommit(revision string) (*CommitMetadata, string, error) {
-	g.rLockWithReload()
+func (g *GitStorage) ShowCommit(ctx context.Context, revision string) (*CommitMetadata, string, error) {
+	if err := g.rLockWithReload(ctx); err != nil {
+		return nil, "", err
+	}
 	defer g.mu.RUnlock()
 	hash, err := g.repo.ResolveRevision(plumbing.Revision(revision))
 	if err != nil {
@@ -645,7 +949,7 @@ func (g *GitStorage) ShowCommit(revision string) (*CommitMetadata, string, error
 		return nil, "", err
 	}
 
-	meta, err := g.commitToMetadata(commit, true)
+	meta, err := g.commitToMetadata(ctx, commit, true)
 	if err != nil {
 		return nil, "", err
 	}
@@ -667,17 +971,20 @@ func (g *GitStorage) ShowCommit(revision string) (*CommitMetadata, string, error
 			slog.Warn("failed to load commit tree", "commit", commit.Hash.String()[:6], "error", err)
 			return meta, "", nil
 		}
-		changes, err := parentTree.Diff(commitTree)
-		if err != nil {
-			slog.Warn("failed to diff trees", "commit", commit.Hash.String()[:6], "error", err)
-			return meta, "", nil
+		changes, err := parentTree.DiffContext(ctx, commitTree)
+		if err == nil {
+			var patch *object.Patch
+			if patch, err = changes.PatchContext(ctx); err == nil {
+				diff = patch.String()
+			}
+		}
+		if ctx.Err() != nil {
+			return nil, "", ctx.Err()
 		}
-		patch, err := changes.Patch()
 		if err != nil {
-			slog.Warn("failed to generate patch", "commit", commit.Hash.String()[:6], "error", err)
+			slog.Warn("failed to diff with parent", "commit", commit.Hash.String()[:6], "error", err)
 			return meta, "", nil
 		}
-		diff = patch.String()
 	} else {
 		// Initial commit - show all files as added
 		tree, err := commit.Tree()
@@ -701,10 +1008,118 @@ func (g *GitStorage) ShowCommit(revision string) (*CommitMetadata, string, error
 	return meta, diff, nil
 }
 
+// FormatPatch returns the history of filename as an mbox patch series in the
+// layout of `git format-patch --stdout -- filename`, oldest commit first, so
+// it can be replayed elsewhere with `git am`. Changes to other files in the
+// same commits are left out.
+func (g *GitStorage) FormatPatch(ctx context.Context, filename string) (string, error) {
+	if err := g.validatePath(filename); err != nil {
+		return "", err
+	}
+	if err := g.rLockWithReload(ctx); err != nil {
+		return "", err
+	}
+	defer g.mu.RUnlock()
+
+	iter, err := g.repo.Log(&git.LogOptions{
+		Order:      git.LogOrderCommitterTime,
+		PathFilter: func(path string) bool { return path == filename },
+	})
+	if err != nil {
+		return "", ErrNotFound
+	}
+	var commits []*object.Commit
+	err = iter.ForEach(func(commit *object.Commit) error {
+		commits = append(commits, commit)
+		return ctx.Err()
+	})
+	iter.Close()
+	if err != nil {
+		return "", err
+	}
+	if len(commits) == 0 {
+		return "", ErrNotFound
+	}
+
+	var b strings.Builder
+	for i := len(commits) - 1; i >= 0; i-- {
+		commit := commits[i]
+		changes, err := g.fileChanges(commit, filename)
+		if err != nil {
+			return "", err
+		}
+		patch, err := changes.PatchContext(ctx)
+		if err != nil {
+			return "", err
+		}
+		writeMboxPatch(&b, commit, len(commits)-i, len(commits), patch.String())
+	}
+	return b.String(), nil
+}
+
+// fileChanges returns the changes commit made to filename relative to its
+// first parent (or to an empty tree for the initial commit).
+func (g *GitStorage) fileChanges(commit *object.Commit, filename string) (object.Changes, error) {
+	var parentTree *object.Tree
+	if commit.NumParents() > 0 {
+		parent, err := commit.Parent(0)
+		if err != nil {
+			return nil, err
+		}
+		if parentTree, err = parent.Tree(); err != nil {
+			return nil, err
+		}
+	}
+	tree, err := commit.Tree()
+	if err != nil {
+		return nil, err
+	}
+	changes, err := object.DiffTree(parentTree, tree)
+	if err != nil {
+		return nil, err
+	}
+
+	var result object.Changes
+	for _, change := range changes {
+		if change.From.Name == filename || change.To.Name == filename {
+			result = append(result, change)
+		}
+	}
+	return result, nil
+}
+
+// writeMboxPatch writes one message of a patch series in git's mbox layout.
+func writeMboxPatch(b *strings.Builder, commit *object.Commit, n, total int, diff string) {
+	subject, body, _ := strings.Cut(strings.TrimSpace(commit.Message), "\n")
+	prefix := "[PATCH]"
+	if total > 1 {
+		prefix = fmt.Sprintf("[PATCH %d/%d]", n, total)
+	}
+
+	// The fixed date marks the line as an mbox separator, as git does.
+	fmt.Fprintf(b, "From %s Mon Sep 17 00:00:00 2001\n", commit.Hash)
+	fmt.Fprintf(b, "From: %s\n", (&mail.Address{Name: commit.Author.Name, Address: commit.Author.Email}).String())
+	fmt.Fprintf(b, "Date: %s\n", commit.Author.When.Format(time.RFC1123Z))
+	fmt.Fprintf(b, "Subject: %s\n", mime.QEncoding.Encode("utf-8", prefix+" "+subject))
+	b.WriteString("MIME-Version: 1.0\nContent-Type: text/plain; charset=UTF-8\nContent-Transfer-Encoding: 8bit\n\n")
+	if body = strings.TrimSpace(body); body != "" {
+		b.WriteString(body + "\n\n")
+	}
+	b.WriteString("---\n")
+	b.WriteString(diff)
+	if diff != "" && !strings.HasSuffix(diff, "\n") {
+		b.WriteString("\n")
+	}
+	b.WriteString("-- \ngopherwiki\n\n")
+}
+
 // Revert reverts a commit.
-func (g *GitStorage) Revert(revision, message string, author Author) error {
-	g.mu.Lock()
-	defer g.mu.Unlock()
+func (g *GitStorage) Revert(ctx context.Context, revision, message string, author Author) error {
+	release, err := g.lockWrite(ctx)
+	if err != nil {
+		return err
+	}
+	defer release()
 
 	hash, err := g.repo.ResolveRevision(plumbing.Revision(revision))
 	if err != nil {
@@ -735,7 +1150,7 @@ func (g *GitStorage) Revert(revision, message string, author Author) error {
 		return err
 	}
 
-	changes, err := parentTree.Diff(commitTree)
+	changes, err := parentTree.DiffContext(ctx, commitTree)
 	if err != nil {
 		return err
 	}
@@ -787,7 +1202,7 @@ func (g *GitStorage) Revert(revision, message string, author Author) error {
 }
 
 // List returns files and directories in a path.
-func (g *GitStorage) List(p string, depth *int, exclude []string) (files, directories []string, err error) {
+func (g *GitStorage) List(ctx context.Context, p string, depth *int, exclude []string) (files, directories []string, err error) {
 	if p != "" {
 		if err := g.validatePath(p); err != nil {
 			return nil, nil, err
@@ -810,6 +1225,9 @@ func (g *GitStorage) List(p string, depth *int, exclude []string) (files, direct
 	}
 
 	err = filepath.Walk(fullPath, func(path string, info os.FileInfo, err error) error {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
 		if err != nil {
 			return nil // Skip errors
 		}
@@ -859,14 +1277,17 @@ func (g *GitStorage) List(p string, depth *int, exclude []string) (files, direct
 }
 
 // Commit commits staged files.
-func (g *GitStorage) Commit(filenames []string, message string, author Author) error {
+func (g *GitStorage) Commit(ctx context.Context, filenames []string, message string, author Author) error {
 	for _, filename := range filenames {
 		if err := g.validatePath(filename); err != nil {
 			return err
 		}
 	}
-	g.mu.Lock()
-	defer g.mu.Unlock()
+	release, err := g.lockWrite(ctx)
+	if err != nil {
+		return err
+	}
+	defer release()
 	worktree, err := g.repo.Worktree()
 	if err != nil {
 		return err
@@ -885,13 +1306,15 @@ func (g *GitStorage) Commit(filenames []string, message string, author Author) e
 }
 
 // GetParentRevision returns the parent revision for a file.
-func (g *GitStorage) GetParentRevision(filename, revision string) (string, error) {
+func (g *GitStorage) GetParentRevision(ctx context.Context, filename, revision string) (string, error) {
 	if err := g.validatePath(filename); err != nil {
 		return "", err
 	}
-	g.rLockWithReload()
+	if err := g.rLockWithReload(ctx); err != nil {
+		return "", err
+	}
 	defer g.mu.RUnlock()
-	history, err := g.logLocked(filename, 0)
+	history, err := g.logLocked(ctx, filename, 0)
 	if err != nil {
 		return "", err
 	}
@@ -908,11 +1331,13 @@ func (g *GitStorage) GetParentRevision(filename, revision string) (string, error
 }
 
 // GetFilenameAtRevision returns the filename used at a specific revision.
-func (g *GitStorage) GetFilenameAtRevision(currentFilename, revision string) (string, error) {
+func (g *GitStorage) GetFilenameAtRevision(ctx context.Context, currentFilename, revision string) (string, error) {
 	if err := g.validatePath(currentFilename); err != nil {
 		return "", err
 	}
-	g.rLockWithReload()
+	if err := g.rLockWithReload(ctx); err != nil {
+		return "", err
+	}
 	defer g.mu.RUnlock()
 	hash, err := g.repo.ResolveRevision(plumbing.Revision(revision))
 	if err != nil {
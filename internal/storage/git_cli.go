@@ -0,0 +1,395 @@
+package storage
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// UseGitBinary makes the storage run the git executable at bin, a path or
+// a name looked up in PATH, for its history hot paths: Log, QueryLog, the
+// latest Metadata of a file, Blame, and Diff. On large repositories git
+// walks history far faster than go-git, especially with the commit-graph
+// it is asked to write here. Writes still go through go-git, and any
+// command that fails falls back to it.
+func (g *GitStorage) UseGitBinary(bin string) error {
+	path, err := exec.LookPath(bin)
+	if err != nil {
+		return fmt.Errorf("git binary: %w", err)
+	}
+	out, err := exec.Command(path, "--version").Output()
+	if err != nil {
+		return fmt.Errorf("git binary %s: %w", path, err)
+	}
+	g.mu.Lock()
+	g.gitBin = path
+	g.mu.Unlock()
+	slog.Info("using the git binary for history", "git", strings.TrimSpace(string(out)))
+
+	// The commit-graph speeds up every walk; an empty repository has none.
+	if _, err := g.runGit(context.Background(), "commit-graph", "write", "--reachable"); err != nil {
+		slog.Debug("failed to write the commit-graph", "error", err)
+	}
+	return nil
+}
+
+// runGit runs the git binary in the repository and returns its output,
+// killing it if ctx is done first. Settings a user may have that change the
+// output are overridden.
+func (g *GitStorage) runGit(ctx context.Context, args ...string) ([]byte, error) {
+	cmd, stderr := g.gitCommand(ctx, args...)
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, gitError(ctx, args[0], err, stderr)
+	}
+	return out, nil
+}
+
+// gitCommand returns the command running the git binary in the repository
+// with args, as runGit runs it, and the buffer collecting its stderr.
+func (g *GitStorage) gitCommand(ctx context.Context, args ...string) (*exec.Cmd, *bytes.Buffer) {
+	args = append([]string{
+		"-C", g.path,
+		"-c", "core.quotePath=false",
+		"-c", "diff.noprefix=false",
+		"-c", "diff.mnemonicPrefix=false",
+		"-c", "log.showSignature=false",
+	}, args...)
+	cmd := exec.CommandContext(ctx, g.gitBin, args...)
+	cmd.Env = append(os.Environ(), "LC_ALL=C", "GIT_TERMINAL_PROMPT=0")
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	return cmd, &stderr
+}
+
+// gitError describes the failure err of the git subcommand sub, with what
+// it wrote to stderr, or returns ctx's error if it was killed for it.
+func gitError(ctx context.Context, sub string, err error, stderr *bytes.Buffer) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if msg := strings.TrimSpace(stderr.String()); msg != "" {
+		return fmt.Errorf("git %s: %w: %s", sub, err, msg)
+	}
+	return fmt.Errorf("git %s: %w", sub, err)
+}
+
+// cliRevision reports whether revision can be handed to git as one: it
+// must not read as an option.
+func cliRevision(revision string) bool {
+	return revision != "" && !strings.HasPrefix(revision, "-")
+}
+
+// cliFallback logs why a git command was not used; the caller then does
+// the work with go-git.
+func cliFallback(op string, err error) {
+	slog.Debug("git binary failed, falling back to go-git", "op", op, "error", err)
+}
+
+// logFormat separates the commits of git log with a record separator and
+// their fields with NULs, the file names following the last one.
+const logFormat = "--format=%x1e%H%x00%an%x00%ae%x00%aI%x00%B%x00"
+
+// cliLog runs git log with args and parses its commits. Caller must hold
+// g.mu (read or write).
+func (g *GitStorage) cliLog(ctx context.Context, withFiles bool, args ...string) ([]CommitMetadata, error) {
+	full := []string{"log", "--date-order", logFormat}
+	if withFiles {
+		// Named as go-git names them: the old name of a renamed file.
+		full = append(full, "--name-status", "--find-renames=60%", "--full-diff", "--diff-merges=first-parent")
+	}
+	out, err := g.runGit(ctx, append(full, args...)...)
+	if err != nil {
+		return nil, err
+	}
+	result := []CommitMetadata{}
+	for _, record := range strings.Split(string(out), "\x1e")[1:] {
+		meta, err := parseLogRecord(record, withFiles)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, meta)
+	}
+	return result, nil
+}
+
+// cliLogEach runs git log with args, with the files of each commit, and
+// calls fn with its commits as git writes them, newest first. Once fn
+// returns false git is stopped, so a walk that needs only the first few
+// matches of a long history does not wait for the rest. Caller must hold
+// g.mu (read or write).
+func (g *GitStorage) cliLogEach(ctx context.Context, fn func(CommitMetadata) bool, args ...string) error {
+	full := []string{"log", "--date-order", logFormat,
+		"--name-status", "--find-renames=60%", "--full-diff", "--diff-merges=first-parent"}
+	walk, stop := context.WithCancel(ctx)
+	defer stop()
+	cmd, stderr := g.gitCommand(walk, append(full, args...)...)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return fmt.Errorf("git log: %w", err)
+	}
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("git log: %w", err)
+	}
+
+	out := bufio.NewReader(stdout)
+	// The output starts with a separator; nothing precedes it.
+	_, err = out.ReadString('\x1e')
+	for err == nil {
+		var record string
+		record, err = out.ReadString('\x1e')
+		if record == "" {
+			break
+		}
+		meta, perr := parseLogRecord(strings.TrimSuffix(record, "\x1e"), true)
+		if perr != nil {
+			stop()
+			cmd.Wait()
+			return perr
+		}
+		if !fn(meta) {
+			stop()
+			cmd.Wait()
+			return nil
+		}
+	}
+	if err := cmd.Wait(); err != nil {
+		return gitError(ctx, "log", err, stderr)
+	}
+	return nil
+}
+
+// parseLogRecord parses a commit git log wrote in logFormat, after its
+// separator.
+func parseLogRecord(record string, withFiles bool) (CommitMetadata, error) {
+	fields := strings.SplitN(record, "\x00", 6)
+	if len(fields) != 6 {
+		return CommitMetadata{}, fmt.Errorf("git log: unexpected output %q", record)
+	}
+	when, err := time.Parse(time.RFC3339, fields[3])
+	if err != nil {
+		return CommitMetadata{}, fmt.Errorf("git log: %w", err)
+	}
+	meta := CommitMetadata{
+		Revision:     fields[0][:6],
+		RevisionFull: fields[0],
+		Datetime:     when,
+		AuthorName:   fields[1],
+		AuthorEmail:  fields[2],
+		Message:      strings.TrimSpace(fields[4]),
+	}
+	if withFiles {
+		for _, line := range strings.Split(fields[5], "\n") {
+			if _, name, ok := strings.Cut(line, "\t"); ok {
+				name, _, _ = strings.Cut(name, "\t")
+				meta.Files = append(meta.Files, name)
+			}
+		}
+	}
+	return meta, nil
+}
+
+// cliLogFile is Log run by the git binary. Caller must hold g.mu (read or
+// write).
+func (g *GitStorage) cliLogFile(ctx context.Context, filename string, maxCount int) ([]CommitMetadata, error) {
+	var args []string
+	if maxCount > 0 {
+		args = append(args, "--max-count="+strconv.Itoa(maxCount))
+	}
+	if filename != "" {
+		args = append(args, "--", ":(literal)"+filename)
+	}
+	log, err := g.cliLog(ctx, false, args...)
+	if len(log) == 0 {
+		// As go-git reports a file without history
+		return nil, err
+	}
+	return log, err
+}
+
+// cliMetadata is Metadata of the latest commit touching filename, run by
+// the git binary. Caller must hold g.mu (read or write).
+func (g *GitStorage) cliMetadata(ctx context.Context, filename string) (*CommitMetadata, error) {
+	log, err := g.cliLog(ctx, false, "--max-count=1", "--", ":(literal)"+filename)
+	if err != nil {
+		return nil, err
+	}
+	if len(log) == 0 {
+		return nil, ErrNotFound
+	}
+	return &log[0], nil
+}
+
+// cliQueryLog is QueryLog run by the git binary. Caller must hold g.mu
+// (read or write).
+func (g *GitStorage) cliQueryLog(ctx context.Context, query LogQuery) ([]CommitMetadata, error) {
+	var args []string
+	if !query.Since.IsZero() {
+		args = append(args, "--since="+query.Since.Format(time.RFC3339))
+	}
+	if !query.Until.IsZero() {
+		args = append(args, "--until="+query.Until.Format(time.RFC3339))
+	}
+	// git matches authors against "Name <email>", so narrow by it and
+	// check the fields themselves below; the paging then has to be ours,
+	// reading git's output only until the page is full.
+	filtered := query.Author != "" || query.AuthorEmail != ""
+	switch {
+	case query.Author != "":
+		args = append(args, "--regexp-ignore-case", "--fixed-strings", "--author="+query.Author)
+	case query.AuthorEmail != "":
+		args = append(args, "--regexp-ignore-case", "--fixed-strings", "--author=<"+query.AuthorEmail+">")
+	}
+	if !filtered {
+		if query.Offset > 0 {
+			args = append(args, "--skip="+strconv.Itoa(query.Offset))
+		}
+		if query.Limit > 0 {
+			args = append(args, "--max-count="+strconv.Itoa(query.Limit))
+		}
+	}
+	switch {
+	case query.Path != "":
+		if !strings.HasPrefix(query.Path, query.PathPrefix) {
+			return []CommitMetadata{}, nil
+		}
+		args = append(args, "--", ":(literal)"+query.Path)
+	case query.PathPrefix != "":
+		args = append(args, "--", ":(glob)"+globEscape(query.PathPrefix)+"**")
+	}
+
+	if !g.hasHead() {
+		return []CommitMetadata{}, nil
+	}
+	if !filtered {
+		return g.cliLog(ctx, true, args...)
+	}
+
+	author := strings.ToLower(query.Author)
+	result := []CommitMetadata{}
+	skipped := 0
+	err := g.cliLogEach(ctx, func(meta CommitMetadata) bool {
+		if query.AuthorEmail != "" && !strings.EqualFold(meta.AuthorEmail, query.AuthorEmail) {
+			return true
+		}
+		if author != "" &&
+			!strings.Contains(strings.ToLower(meta.AuthorName), author) &&
+			!strings.Contains(strings.ToLower(meta.AuthorEmail), author) {
+			return true
+		}
+		if skipped < query.Offset {
+			skipped++
+			return true
+		}
+		result = append(result, meta)
+		return query.Limit <= 0 || len(result) < query.Limit
+	}, args...)
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// globEscape escapes the characters a git glob pathspec gives meaning to.
+func globEscape(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if strings.ContainsRune(`*?[]\`, r) {
+			b.WriteByte('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// hasHead reports whether the repository has a commit. Caller must hold
+// g.mu (read or write).
+func (g *GitStorage) hasHead() bool {
+	_, err := g.repo.Head()
+	return err == nil
+}
+
+// cliBlame is Blame run by the git binary. Caller must hold g.mu (read or
+// write).
+func (g *GitStorage) cliBlame(ctx context.Context, filename, revision string) ([]BlameLine, error) {
+	if revision == "" {
+		revision = "HEAD"
+	}
+	if !cliRevision(revision) {
+		return nil, fmt.Errorf("revision %q", revision)
+	}
+	out, err := g.runGit(ctx, "blame", "--line-porcelain", "--end-of-options", revision, "--", filename)
+	if err != nil {
+		return nil, err
+	}
+
+	var lines []BlameLine
+	var line BlameLine
+	var authorTime int64
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	header := true
+	for scanner.Scan() {
+		text := scanner.Text()
+		if header {
+			hash, _, _ := strings.Cut(text, " ")
+			if len(hash) < 6 {
+				return nil, fmt.Errorf("git blame: unexpected output %q", text)
+			}
+			line = BlameLine{Revision: hash[:6], LineNumber: len(lines) + 1}
+			header = false
+			continue
+		}
+		key, value, _ := strings.Cut(text, " ")
+		switch {
+		case strings.HasPrefix(text, "\t"):
+			line.Line = text[1:]
+			lines = append(lines, line)
+			header = true
+		case key == "author":
+			line.AuthorName = value
+		case key == "author-mail":
+			line.AuthorEmail = strings.TrimSuffix(strings.TrimPrefix(value, "<"), ">")
+		case key == "summary":
+			line.Message = value
+		case key == "author-time":
+			authorTime, _ = strconv.ParseInt(value, 10, 64)
+		case key == "author-tz":
+			line.Datetime = time.Unix(authorTime, 0).In(parseTZ(value))
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return lines, nil
+}
+
+// parseTZ returns the zone of a git timezone offset such as "+0130".
+func parseTZ(tz string) *time.Location {
+	n, err := strconv.Atoi(tz)
+	if err != nil || len(tz) != 5 {
+		return time.UTC
+	}
+	offset := (n/100*60 + n%100) * 60
+	return time.FixedZone("", offset)
+}
+
+// cliDiff is Diff run by the git binary. Caller must hold g.mu (read or
+// write).
+func (g *GitStorage) cliDiff(ctx context.Context, revA, revB string) (string, error) {
+	if !cliRevision(revA) || !cliRevision(revB) {
+		return "", fmt.Errorf("revisions %q and %q", revA, revB)
+	}
+	out, err := g.runGit(ctx, "diff", "--no-color", "--no-ext-diff", "--no-textconv", "--no-renames", "--full-index", "--end-of-options", revA, revB)
+	if err != nil {
+		return "", err
+	}
+	return string(out), nil
+}
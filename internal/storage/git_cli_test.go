@@ -0,0 +1,184 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// cliFixture returns two storages of one repository, the second running
+// the git binary, after a few edits by two authors.
+func cliFixture(t testing.TB, commits int) (*GitStorage, *GitStorage) {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	dir := t.TempDir()
+	gs, err := NewGitStorage(dir, true)
+	if err != nil {
+		t.Fatalf("NewGitStorage: %v", err)
+	}
+	alice := Author{Name: "Alice", Email: "alice@example.com"}
+	bob := Author{Name: "Bob", Email: "bob@example.com"}
+	start := time.Date(2024, 3, 1, 12, 0, 0, 0, time.FixedZone("", 3600))
+
+	for i := 0; i < commits; i++ {
+		author := alice
+		if i%3 == 1 {
+			author = bob
+		}
+		author.When = start.Add(time.Duration(i) * time.Hour)
+		files := map[string][]byte{
+			"home.md": []byte(fmt.Sprintf("# Home\n\nline %d\nsame\n", i)),
+		}
+		if i%2 == 0 {
+			files[fmt.Sprintf("docs/page-%d.md", i%5)] = []byte(fmt.Sprintf("edit %d\n", i))
+		}
+		if _, err := gs.StoreFiles(context.Background(), files, fmt.Sprintf("Edit %d\n\nThe body.", i), author); err != nil {
+			t.Fatalf("StoreFiles: %v", err)
+		}
+	}
+	if err := gs.Rename(context.Background(), "docs/page-0.md", "docs/moved.md", "", alice); err != nil {
+		t.Fatalf("Rename: %v", err)
+	}
+
+	cli, err := NewGitStorage(dir, false)
+	if err != nil {
+		t.Fatalf("NewGitStorage: %v", err)
+	}
+	if err := cli.UseGitBinary("git"); err != nil {
+		t.Fatalf("UseGitBinary: %v", err)
+	}
+	return gs, cli
+}
+
+// sameTimes makes equal instants compare equal whatever their zone.
+func sameTimes[T any](items []T, at func(*T) *time.Time) {
+	for i := range items {
+		if t := at(&items[i]); !t.IsZero() {
+			*t = t.UTC()
+		}
+	}
+}
+
+func TestGitBinaryMatchesGoGit(t *testing.T) {
+	gs, cli := cliFixture(t, 12)
+	metaTime := func(m *CommitMetadata) *time.Time { return &m.Datetime }
+
+	for _, filename := range []string{"", "home.md", "docs/moved.md", "missing.md"} {
+		for _, max := range []int{0, 3} {
+			want, wantErr := gs.Log(context.Background(), filename, max)
+			got, gotErr := cli.Log(context.Background(), filename, max)
+			sameTimes(want, metaTime)
+			sameTimes(got, metaTime)
+			if !reflect.DeepEqual(got, want) || (gotErr == nil) != (wantErr == nil) {
+				t.Errorf("Log(%q, %d):\ngit:    %v, %v\ngo-git: %v, %v", filename, max, got, gotErr, want, wantErr)
+			}
+		}
+	}
+
+	since := time.Date(2024, 3, 1, 14, 0, 0, 0, time.UTC)
+	for _, query := range []LogQuery{
+		{},
+		{Limit: 4, Offset: 2},
+		{PathPrefix: "docs/"},
+		{Path: "home.md", Offset: 10},
+		{Author: "BOB", Limit: 2, Offset: 1},
+		{Author: "alice", Limit: 1},
+		{AuthorEmail: "alice@example.com"},
+		{Since: since, Until: since.Add(3 * time.Hour)},
+	} {
+		want, err := gs.QueryLog(context.Background(), query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := cli.QueryLog(context.Background(), query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sameTimes(want, metaTime)
+		sameTimes(got, metaTime)
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("QueryLog(%+v):\ngit:    %v\ngo-git: %v", query, got, want)
+		}
+	}
+
+	for _, filename := range []string{"home.md", "docs/page-2.md"} {
+		want, _ := gs.Metadata(context.Background(), filename, "")
+		got, err := cli.Metadata(context.Background(), filename, "")
+		if err != nil || got.RevisionFull != want.RevisionFull || !got.Datetime.Equal(want.Datetime) {
+			t.Errorf("Metadata(%q) = %v, %v; want %v", filename, got, err, want)
+		}
+	}
+	if _, err := cli.Metadata(context.Background(), "missing.md", ""); err != ErrNotFound {
+		t.Errorf("Metadata of a missing file = %v, want ErrNotFound", err)
+	}
+
+	log, _ := gs.Log(context.Background(), "", 0)
+	blameTime := func(l *BlameLine) *time.Time { return &l.Datetime }
+	for _, revision := range []string{"", log[4].Revision} {
+		want, _ := gs.Blame(context.Background(), "home.md", revision)
+		got, err := cli.Blame(context.Background(), "home.md", revision)
+		sameTimes(want, blameTime)
+		sameTimes(got, blameTime)
+		if err != nil || !reflect.DeepEqual(got, want) {
+			t.Errorf("Blame at %q:\ngit:    %v, %v\ngo-git: %v", revision, got, err, want)
+		}
+	}
+
+	want, _ := gs.Diff(context.Background(), log[5].Revision, log[0].Revision)
+	got, err := cli.Diff(context.Background(), log[5].Revision, log[0].Revision)
+	if err != nil || got != want {
+		t.Errorf("Diff:\ngit:\n%s\ngo-git:\n%s", got, want)
+	}
+	if _, err := cli.Diff(context.Background(), "--output=/tmp/x", log[0].Revision); err != ErrNotFound {
+		t.Errorf("Diff of an option = %v, want ErrNotFound from the go-git fallback", err)
+	}
+}
+
+func benchmarkHistory(b *testing.B, run func(s *GitStorage) error) {
+	gs, cli := cliFixture(b, 300)
+	for _, bench := range []struct {
+		name string
+		s    *GitStorage
+	}{{"go-git", gs}, {"git", cli}} {
+		b.Run(bench.name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if err := run(bench.s); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkLog(b *testing.B) {
+	benchmarkHistory(b, func(s *GitStorage) error {
+		_, err := s.Log(context.Background(), "docs/page-2.md", 0)
+		return err
+	})
+}
+
+func BenchmarkQueryLog(b *testing.B) {
+	benchmarkHistory(b, func(s *GitStorage) error {
+		_, err := s.QueryLog(context.Background(), LogQuery{PathPrefix: "docs/", Limit: 50})
+		return err
+	})
+}
+
+func BenchmarkBlame(b *testing.B) {
+	benchmarkHistory(b, func(s *GitStorage) error {
+		_, err := s.Blame(context.Background(), "home.md", "")
+		return err
+	})
+}
+
+func BenchmarkDiff(b *testing.B) {
+	benchmarkHistory(b, func(s *GitStorage) error {
+		_, err := s.Diff(context.Background(), "HEAD~200", "HEAD")
+		return err
+	})
+}
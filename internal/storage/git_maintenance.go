@@ -0,0 +1,160 @@
+package storage
+
+import (
+	"context"
+	"io/fs"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/storer"
+)
+
+// RepositoryStats describes the size of a repository's object store.
+type RepositoryStats struct {
+	LooseObjects int
+	LooseSize    int64 // Bytes
+	Packs        int
+	PackSize     int64 // Bytes, indexes included
+}
+
+// Size returns the bytes the object store takes.
+func (s RepositoryStats) Size() int64 {
+	return s.LooseSize + s.PackSize
+}
+
+// MaintenanceResult reports what Maintain did.
+type MaintenanceResult struct {
+	Before   RepositoryStats
+	After    RepositoryStats
+	Duration time.Duration
+}
+
+// pruneAge is how long a loose object must have been unreachable for
+// Maintain to delete it, as git's default gc.pruneExpire: a younger one may
+// belong to a write in progress elsewhere.
+const pruneAge = 14 * 24 * time.Hour
+
+// Stats measures the repository's object store.
+func (g *GitStorage) Stats() (RepositoryStats, error) {
+	var stats RepositoryStats
+	objects := filepath.Join(g.path, ".git", "objects")
+	err := filepath.WalkDir(objects, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(objects, path)
+		dir, name := filepath.Split(filepath.ToSlash(rel))
+		switch {
+		case dir == "pack/":
+			if strings.HasSuffix(name, ".pack") {
+				stats.Packs++
+			}
+			stats.PackSize += info.Size()
+		case len(dir) == 3 && len(name) == 38:
+			stats.LooseObjects++
+			stats.LooseSize += info.Size()
+		}
+		return nil
+	})
+	return stats, err
+}
+
+// Maintain compacts the repository: it packs every reachable object into
+// one pack, replacing the others, and deletes the loose objects that are
+// packed or long unreachable. With the git binary it runs git gc, which
+// does the same and more. The other processes using the repository are
+// told to reopen it, since the packs they had open are gone. Git gc is
+// killed if ctx is done; the go-git repack only checks it before starting.
+func (g *GitStorage) Maintain(ctx context.Context) (MaintenanceResult, error) {
+	start := time.Now()
+	release, err := g.lockWrite(ctx)
+	if err != nil {
+		return MaintenanceResult{}, err
+	}
+	defer release()
+
+	var result MaintenanceResult
+	if result.Before, err = g.Stats(); err != nil {
+		return result, err
+	}
+	if !g.hasHead() {
+		result.After = result.Before
+		return result, nil
+	}
+
+	expire := start.Add(-pruneAge)
+	collected := false
+	if g.gitBin != "" {
+		if _, err := g.runGit(ctx, "gc", "--quiet", "--prune="+expire.Format("2006-01-02 15:04:05 -0700")); err != nil {
+			cliFallback("gc", err)
+		} else {
+			collected = true
+		}
+	}
+	if !collected {
+		if err := g.repack(expire); err != nil {
+			return result, err
+		}
+	}
+
+	repo, err := git.PlainOpen(g.path)
+	if err != nil {
+		return result, err
+	}
+	g.repo = repo
+	if g.onReload != nil {
+		g.onReload()
+	}
+	result.After, err = g.Stats()
+	result.Duration = time.Since(start)
+	return result, err
+}
+
+// repack is Maintain done with go-git, deleting unreachable loose objects
+// older than expire. Nothing is written meanwhile, so every loose object
+// reachable before the repack is in the new pack after it. Caller must hold
+// g.mu (write lock).
+func (g *GitStorage) repack(expire time.Time) error {
+	los, ok := g.repo.Storer.(storer.LooseObjectStorer)
+	if !ok {
+		return git.ErrLooseObjectsNotSupported
+	}
+	unreachable := make(map[plumbing.Hash]bool)
+	err := g.repo.Prune(git.PruneOptions{Handler: func(hash plumbing.Hash) error {
+		unreachable[hash] = true
+		return nil
+	}})
+	if err != nil {
+		return err
+	}
+	if err := g.repo.RepackObjects(&git.RepackConfig{}); err != nil {
+		return err
+	}
+
+	var stale []plumbing.Hash
+	err = los.ForEachObjectHash(func(hash plumbing.Hash) error {
+		if unreachable[hash] {
+			if t, err := los.LooseObjectTime(hash); err != nil || !t.Before(expire) {
+				return nil
+			}
+		}
+		stale = append(stale, hash)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, hash := range stale {
+		if err := los.DeleteLooseObject(hash); err != nil {
+			return err
+		}
+	}
+	return nil
+}
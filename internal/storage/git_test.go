@@ -1,12 +1,20 @@
 package storage
 
 import (
+	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 	"sync"
 	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v5/plumbing"
+
+	"github.com/sa/gopherwiki/internal/encryption"
 )
 
 func TestNewGitStorage(t *testing.T) {
@@ -48,7 +56,7 @@ func TestGitStorageStore(t *testing.T) {
 
 	// Store a file
 	author := Author{Name: "Test User", Email: "test@example.com"}
-	changed, err := gs.Store("test.md", "# Hello World\n", "Initial commit", author)
+	changed, err := gs.Store(context.Background(), "test.md", "# Hello World\n", "Initial commit", author)
 	if err != nil {
 		t.Fatalf("Store failed: %v", err)
 	}
@@ -57,12 +65,12 @@ func TestGitStorageStore(t *testing.T) {
 	}
 
 	// Verify file exists
-	if !gs.Exists("test.md") {
+	if !gs.Exists(context.Background(), "test.md") {
 		t.Error("File should exist after store")
 	}
 
 	// Load and verify content
-	content, err := gs.Load("test.md", "")
+	content, err := gs.Load(context.Background(), "test.md", "")
 	if err != nil {
 		t.Fatalf("Load failed: %v", err)
 	}
@@ -86,13 +94,13 @@ func TestGitStorageHistory(t *testing.T) {
 	author := Author{Name: "Test User", Email: "test@example.com"}
 
 	// Create initial file
-	gs.Store("test.md", "# Version 1\n", "Version 1", author)
+	gs.Store(context.Background(), "test.md", "# Version 1\n", "Version 1", author)
 
 	// Update file
-	gs.Store("test.md", "# Version 2\n", "Version 2", author)
+	gs.Store(context.Background(), "test.md", "# Version 2\n", "Version 2", author)
 
 	// Get history
-	log, err := gs.Log("test.md", 10)
+	log, err := gs.Log(context.Background(), "test.md", 10)
 	if err != nil {
 		t.Fatalf("Log failed: %v", err)
 	}
@@ -121,19 +129,19 @@ func TestGitStorageDelete(t *testing.T) {
 	author := Author{Name: "Test User", Email: "test@example.com"}
 
 	// Create file
-	gs.Store("test.md", "# Test\n", "Create", author)
+	gs.Store(context.Background(), "test.md", "# Test\n", "Create", author)
 
-	if !gs.Exists("test.md") {
+	if !gs.Exists(context.Background(), "test.md") {
 		t.Fatal("File should exist after store")
 	}
 
 	// Delete file
-	err = gs.Delete("test.md", "Delete test", author)
+	err = gs.Delete(context.Background(), "test.md", "Delete test", author)
 	if err != nil {
 		t.Fatalf("Delete failed: %v", err)
 	}
 
-	if gs.Exists("test.md") {
+	if gs.Exists(context.Background(), "test.md") {
 		t.Error("File should not exist after delete")
 	}
 }
@@ -153,24 +161,24 @@ func TestGitStorageRename(t *testing.T) {
 	author := Author{Name: "Test User", Email: "test@example.com"}
 
 	// Create file
-	gs.Store("old.md", "# Test\n", "Create", author)
+	gs.Store(context.Background(), "old.md", "# Test\n", "Create", author)
 
 	// Rename file
-	err = gs.Rename("old.md", "new.md", "Rename test", author)
+	err = gs.Rename(context.Background(), "old.md", "new.md", "Rename test", author)
 	if err != nil {
 		t.Fatalf("Rename failed: %v", err)
 	}
 
-	if gs.Exists("old.md") {
+	if gs.Exists(context.Background(), "old.md") {
 		t.Error("Old file should not exist after rename")
 	}
 
-	if !gs.Exists("new.md") {
+	if !gs.Exists(context.Background(), "new.md") {
 		t.Error("New file should exist after rename")
 	}
 
 	// Verify content
-	content, _ := gs.Load("new.md", "")
+	content, _ := gs.Load(context.Background(), "new.md", "")
 	if content != "# Test\n" {
 		t.Errorf("Content after rename = %q, want %q", content, "# Test\n")
 	}
@@ -191,10 +199,10 @@ func TestGitStorageBlame(t *testing.T) {
 	author := Author{Name: "Test User", Email: "test@example.com"}
 
 	// Create file with multiple lines
-	gs.Store("test.md", "Line 1\nLine 2\nLine 3\n", "Create", author)
+	gs.Store(context.Background(), "test.md", "Line 1\nLine 2\nLine 3\n", "Create", author)
 
 	// Get blame
-	blame, err := gs.Blame("test.md", "")
+	blame, err := gs.Blame(context.Background(), "test.md", "")
 	if err != nil {
 		t.Fatalf("Blame failed: %v", err)
 	}
@@ -207,6 +215,9 @@ func TestGitStorageBlame(t *testing.T) {
 		if line.LineNumber != i+1 {
 			t.Errorf("Line %d number = %d, want %d", i, line.LineNumber, i+1)
 		}
+		if line.AuthorName != author.Name || line.AuthorEmail != author.Email || line.Message != "Create" {
+			t.Errorf("Line %d by %q <%s>, %q; want %q <%s>, %q", i, line.AuthorName, line.AuthorEmail, line.Message, author.Name, author.Email, "Create")
+		}
 	}
 }
 
@@ -225,7 +236,7 @@ func TestPathTraversalProtection(t *testing.T) {
 	author := Author{Name: "Test User", Email: "test@example.com"}
 
 	// Store a legitimate file first
-	gs.Store("test.md", "# Test\n", "Create", author)
+	gs.Store(context.Background(), "test.md", "# Test\n", "Create", author)
 
 	traversalPaths := []string{
 		"../etc/passwd",
@@ -237,41 +248,41 @@ func TestPathTraversalProtection(t *testing.T) {
 
 	for _, p := range traversalPaths {
 		t.Run("Exists_"+p, func(t *testing.T) {
-			if gs.Exists(p) {
+			if gs.Exists(context.Background(), p) {
 				t.Errorf("Exists(%q) should return false for traversal path", p)
 			}
 		})
 
 		t.Run("Load_"+p, func(t *testing.T) {
-			_, err := gs.Load(p, "")
+			_, err := gs.Load(context.Background(), p, "")
 			if !errors.Is(err, ErrPathTraversal) {
 				t.Errorf("Load(%q) should return ErrPathTraversal, got: %v", p, err)
 			}
 		})
 
 		t.Run("Store_"+p, func(t *testing.T) {
-			_, err := gs.Store(p, "malicious", "bad", author)
+			_, err := gs.Store(context.Background(), p, "malicious", "bad", author)
 			if !errors.Is(err, ErrPathTraversal) {
 				t.Errorf("Store(%q) should return ErrPathTraversal, got: %v", p, err)
 			}
 		})
 
 		t.Run("Delete_"+p, func(t *testing.T) {
-			err := gs.Delete(p, "bad", author)
+			err := gs.Delete(context.Background(), p, "bad", author)
 			if !errors.Is(err, ErrPathTraversal) {
 				t.Errorf("Delete(%q) should return ErrPathTraversal, got: %v", p, err)
 			}
 		})
 
 		t.Run("Mtime_"+p, func(t *testing.T) {
-			_, err := gs.Mtime(p)
+			_, err := gs.Mtime(context.Background(), p)
 			if !errors.Is(err, ErrPathTraversal) {
 				t.Errorf("Mtime(%q) should return ErrPathTraversal, got: %v", p, err)
 			}
 		})
 
 		t.Run("Size_"+p, func(t *testing.T) {
-			_, err := gs.Size(p)
+			_, err := gs.Size(context.Background(), p)
 			if !errors.Is(err, ErrPathTraversal) {
 				t.Errorf("Size(%q) should return ErrPathTraversal, got: %v", p, err)
 			}
@@ -280,10 +291,10 @@ func TestPathTraversalProtection(t *testing.T) {
 
 	// Legitimate paths should still work
 	t.Run("legitimate_path", func(t *testing.T) {
-		if !gs.Exists("test.md") {
+		if !gs.Exists(context.Background(), "test.md") {
 			t.Error("Exists(test.md) should return true")
 		}
-		content, err := gs.Load("test.md", "")
+		content, err := gs.Load(context.Background(), "test.md", "")
 		if err != nil {
 			t.Errorf("Load(test.md) should succeed, got: %v", err)
 		}
@@ -293,11 +304,11 @@ func TestPathTraversalProtection(t *testing.T) {
 	})
 
 	t.Run("legitimate_subdirectory", func(t *testing.T) {
-		_, err := gs.Store("sub/page.md", "# Sub\n", "Create sub", author)
+		_, err := gs.Store(context.Background(), "sub/page.md", "# Sub\n", "Create sub", author)
 		if err != nil {
 			t.Errorf("Store(sub/page.md) should succeed, got: %v", err)
 		}
-		if !gs.Exists("sub/page.md") {
+		if !gs.Exists(context.Background(), "sub/page.md") {
 			t.Error("Exists(sub/page.md) should return true")
 		}
 	})
@@ -328,7 +339,7 @@ func TestGitStorageConcurrentWrites(t *testing.T) {
 			filename := fmt.Sprintf("concurrent-%d.md", n)
 			content := fmt.Sprintf("# Page %d\n", n)
 			message := fmt.Sprintf("Create page %d", n)
-			_, err := gs.Store(filename, content, message, author)
+			_, err := gs.Store(context.Background(), filename, content, message, author)
 			if err != nil {
 				errs <- fmt.Errorf("goroutine %d Store failed: %w", n, err)
 			}
@@ -347,12 +358,12 @@ func TestGitStorageConcurrentWrites(t *testing.T) {
 		filename := fmt.Sprintf("concurrent-%d.md", i)
 		expected := fmt.Sprintf("# Page %d\n", i)
 
-		if !gs.Exists(filename) {
+		if !gs.Exists(context.Background(), filename) {
 			t.Errorf("File %s should exist", filename)
 			continue
 		}
 
-		content, err := gs.Load(filename, "")
+		content, err := gs.Load(context.Background(), filename, "")
 		if err != nil {
 			t.Errorf("Load(%s) failed: %v", filename, err)
 			continue
@@ -377,9 +388,9 @@ func TestMetadataDoesNotComputeFiles(t *testing.T) {
 	}
 
 	author := Author{Name: "Test User", Email: "test@example.com"}
-	gs.Store("page.md", "# Hello\n", "Create page", author)
+	gs.Store(context.Background(), "page.md", "# Hello\n", "Create page", author)
 
-	meta, err := gs.Metadata("page.md", "")
+	meta, err := gs.Metadata(context.Background(), "page.md", "")
 	if err != nil {
 		t.Fatalf("Metadata failed: %v", err)
 	}
@@ -388,7 +399,7 @@ func TestMetadataDoesNotComputeFiles(t *testing.T) {
 	}
 
 	// ShowCommit should still populate Files
-	commitMeta, _, err := gs.ShowCommit(meta.Revision)
+	commitMeta, _, err := gs.ShowCommit(context.Background(), meta.Revision)
 	if err != nil {
 		t.Fatalf("ShowCommit failed: %v", err)
 	}
@@ -396,3 +407,405 @@ func TestMetadataDoesNotComputeFiles(t *testing.T) {
 		t.Error("ShowCommit().Files should be populated")
 	}
 }
+
+func TestGitStorageQueryLog(t *testing.T) {
+	gs, err := NewGitStorage(t.TempDir(), true)
+	if err != nil {
+		t.Fatalf("Failed to create GitStorage: %v", err)
+	}
+
+	// Empty repository has no history
+	log, err := gs.QueryLog(context.Background(), LogQuery{})
+	if err != nil || len(log) != 0 {
+		t.Fatalf("QueryLog on empty repo = %v, %v; want empty, nil", log, err)
+	}
+
+	alice := Author{Name: "Alice", Email: "alice@example.com"}
+	bob := Author{Name: "Bob", Email: "bob@example.com"}
+	gs.Store(context.Background(), "docs/a.md", "a", "alice docs", alice)
+	gs.Store(context.Background(), "notes.md", "n", "bob notes", bob)
+	gs.Store(context.Background(), "docs/b.md", "b", "bob docs", bob)
+
+	log, err = gs.QueryLog(context.Background(), LogQuery{Author: "BOB"})
+	if err != nil {
+		t.Fatalf("QueryLog failed: %v", err)
+	}
+	if len(log) != 2 {
+		t.Errorf("author filter returned %d commits, want 2", len(log))
+	}
+
+	log, _ = gs.QueryLog(context.Background(), LogQuery{AuthorEmail: "alice@example.com"})
+	if len(log) != 1 || log[0].Message != "alice docs" {
+		t.Errorf("author email filter = %+v, want the alice commit", log)
+	}
+
+	log, _ = gs.QueryLog(context.Background(), LogQuery{PathPrefix: "docs/"})
+	if len(log) != 2 {
+		t.Errorf("path prefix filter returned %d commits, want 2", len(log))
+	}
+	if len(log) > 0 && (len(log[0].Files) != 1 || log[0].Files[0] != "docs/b.md") {
+		t.Errorf("Files = %v, want [docs/b.md]", log[0].Files)
+	}
+
+	log, _ = gs.QueryLog(context.Background(), LogQuery{Offset: 1, Limit: 1})
+	if len(log) != 1 || log[0].Message != "bob notes" {
+		t.Errorf("offset/limit = %+v, want the second-newest commit", log)
+	}
+
+	log, _ = gs.QueryLog(context.Background(), LogQuery{Since: time.Now().Add(time.Hour)})
+	if len(log) != 0 {
+		t.Errorf("future since returned %d commits, want 0", len(log))
+	}
+}
+
+func TestGitStorageFormatPatch(t *testing.T) {
+	gs, err := NewGitStorage(t.TempDir(), true)
+	if err != nil {
+		t.Fatalf("Failed to create GitStorage: %v", err)
+	}
+
+	alice := Author{Name: "Alice", Email: "alice@example.com"}
+	gs.Store(context.Background(), "page.md", "one\n", "Create page\n\nWith a body.", alice)
+	gs.Store(context.Background(), "other.md", "x\n", "Unrelated", alice)
+	gs.Store(context.Background(), "page.md", "one\ntwo\n", "Add line", alice)
+
+	if _, err := gs.FormatPatch(context.Background(), "missing.md"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("FormatPatch(missing) error = %v, want ErrNotFound", err)
+	}
+
+	series, err := gs.FormatPatch(context.Background(), "page.md")
+	if err != nil {
+		t.Fatalf("FormatPatch failed: %v", err)
+	}
+	first := strings.Index(series, "Subject: [PATCH 1/2] Create page")
+	second := strings.Index(series, "Subject: [PATCH 2/2] Add line")
+	if first < 0 || second < first {
+		t.Errorf("series should hold both commits oldest first, got:\n%s", series)
+	}
+	for _, want := range []string{"<alice@example.com>", "With a body.", "+++ b/page.md", "+two"} {
+		if !strings.Contains(series, want) {
+			t.Errorf("series missing %q", want)
+		}
+	}
+	if strings.Contains(series, "other.md") || strings.Contains(series, "Unrelated") {
+		t.Error("series should only contain changes to page.md")
+	}
+}
+
+func TestEncryptedStorage(t *testing.T) {
+	gs, err := NewGitStorage(t.TempDir(), true)
+	if err != nil {
+		t.Fatalf("Failed to create GitStorage: %v", err)
+	}
+	c, err := encryption.NewCipher(make([]byte, encryption.KeySize))
+	if err != nil {
+		t.Fatalf("NewCipher: %v", err)
+	}
+	es := NewEncryptedStorage(gs, c)
+	author := Author{Name: "Test", Email: "test@example.com"}
+
+	// Attachments are sealed in the repository and opened on load.
+	if _, err := es.StoreBytes(context.Background(), "page/report.pdf", []byte("secret report"), "add", author); err != nil {
+		t.Fatalf("StoreBytes: %v", err)
+	}
+	raw, _ := gs.LoadBytes(context.Background(), "page/report.pdf", "")
+	if !encryption.IsSealed(raw) {
+		t.Errorf("attachment should be encrypted on disk, got %q", raw)
+	}
+	data, err := es.LoadBytes(context.Background(), "page/report.pdf", "")
+	if err != nil || string(data) != "secret report" {
+		t.Errorf("LoadBytes = %q, %v; want the plaintext", data, err)
+	}
+	if size, _ := es.Size(context.Background(), "page/report.pdf"); size != int64(len("secret report")) {
+		t.Errorf("Size = %d, want the plaintext size", size)
+	}
+
+	// Re-storing identical content is not a change despite the fresh nonce.
+	if changed, _ := es.StoreBytes(context.Background(), "page/report.pdf", []byte("secret report"), "again", author); changed {
+		t.Error("storing identical content should report no change")
+	}
+
+	// Pages stay plaintext.
+	es.Store(context.Background(), "page.md", "# Page", "add page", author)
+	if raw, _ := gs.Load(context.Background(), "page.md", ""); raw != "# Page" {
+		t.Errorf("page should be stored as plaintext, got %q", raw)
+	}
+
+	// Attachments stored before encryption was enabled still load.
+	gs.StoreBytes(context.Background(), "page/old.txt", []byte("legacy"), "legacy", author)
+	if data, err := es.Load(context.Background(), "page/old.txt", ""); err != nil || data != "legacy" {
+		t.Errorf("legacy attachment = %q, %v", data, err)
+	}
+}
+
+func TestGitStorageStoreFiles(t *testing.T) {
+	gs, err := NewGitStorage(t.TempDir(), true)
+	if err != nil {
+		t.Fatalf("Failed to create GitStorage: %v", err)
+	}
+	author := Author{Name: "Test", Email: "test@example.com"}
+	gs.Store(context.Background(), "kept.md", "# Kept", "init", author)
+
+	changed, err := gs.StoreFiles(context.Background(), map[string][]byte{
+		"kept.md":      []byte("# Kept"),
+		"docs/a.md":    []byte("# A"),
+		"docs/a/b.png": []byte("PNG"),
+	}, "Import", author)
+	if err != nil || !changed {
+		t.Fatalf("StoreFiles = %v, %v; want a change", changed, err)
+	}
+	log, _ := gs.Log(context.Background(), "", 0)
+	if len(log) != 2 || log[0].Message != "Import" {
+		t.Fatalf("log = %+v, want the files in one commit after init", log)
+	}
+	if content, _ := gs.Load(context.Background(), "docs/a.md", ""); content != "# A" {
+		t.Errorf("docs/a.md = %q", content)
+	}
+
+	// Storing the same files again commits nothing.
+	if changed, err := gs.StoreFiles(context.Background(), map[string][]byte{"docs/a.md": []byte("# A")}, "again", author); err != nil || changed {
+		t.Errorf("StoreFiles unchanged = %v, %v; want no change", changed, err)
+	}
+	if _, err := gs.StoreFiles(context.Background(), map[string][]byte{"../x.md": []byte("x")}, "bad", author); !errors.Is(err, ErrPathTraversal) {
+		t.Errorf("traversal error = %v, want ErrPathTraversal", err)
+	}
+}
+
+func TestGitStorageSharedLock(t *testing.T) {
+	gs, err := NewGitStorage(t.TempDir(), true)
+	if err != nil {
+		t.Fatalf("Failed to create GitStorage: %v", err)
+	}
+	var taken, released int
+	gs.SetSharedLock(func(ctx context.Context) (func(), error) {
+		taken++
+		return func() { released++ }, nil
+	})
+	author := Author{Name: "Test", Email: "test@example.com"}
+	if _, err := gs.Store(context.Background(), "a.md", "# A", "add", author); err != nil {
+		t.Fatal(err)
+	}
+	if err := gs.Rename(context.Background(), "a.md", "b.md", "rename", author); err != nil {
+		t.Fatal(err)
+	}
+	if err := gs.Delete(context.Background(), "b.md", "delete", author); err != nil {
+		t.Fatal(err)
+	}
+	if taken != 3 || released != 3 {
+		t.Errorf("lock taken %d and released %d times, want 3 each", taken, released)
+	}
+
+	gs.SetSharedLock(func(ctx context.Context) (func(), error) { return nil, errors.New("locked elsewhere") })
+	if _, err := gs.Store(context.Background(), "c.md", "# C", "add", author); err == nil {
+		t.Error("Store() should fail when the shared lock cannot be taken")
+	}
+	if gs.Exists(context.Background(), "c.md") {
+		t.Error("c.md was written without the shared lock")
+	}
+}
+
+func TestGitStorageContext(t *testing.T) {
+	gs, err := NewGitStorage(t.TempDir(), true)
+	if err != nil {
+		t.Fatalf("Failed to create GitStorage: %v", err)
+	}
+	ctx := context.Background()
+	author := Author{Name: "Test", Email: "test@example.com"}
+	if _, err := gs.Store(ctx, "a.md", "# A", "add", author); err != nil {
+		t.Fatal(err)
+	}
+
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	var locked bool
+	gs.SetSharedLock(func(ctx context.Context) (func(), error) {
+		locked = true
+		return func() {}, nil
+	})
+	if _, err := gs.Store(canceled, "b.md", "# B", "add", author); !errors.Is(err, context.Canceled) {
+		t.Errorf("Store(canceled) error = %v, want context.Canceled", err)
+	}
+	if locked || gs.Exists(ctx, "b.md") {
+		t.Error("a canceled Store should neither lock nor write")
+	}
+	if _, err := gs.Load(canceled, "a.md", ""); !errors.Is(err, context.Canceled) {
+		t.Errorf("Load(canceled) error = %v, want context.Canceled", err)
+	}
+	if _, err := gs.Log(canceled, "", 0); !errors.Is(err, context.Canceled) {
+		t.Errorf("Log(canceled) error = %v, want context.Canceled", err)
+	}
+
+	// Reads and history time out; writes are not bounded.
+	timed := NewTimedStorage(gs, 0)
+	timed.SetTimeouts(time.Nanosecond, time.Nanosecond)
+	if _, err := timed.Load(ctx, "a.md", ""); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Load with a timeout error = %v, want context.DeadlineExceeded", err)
+	}
+	if _, err := timed.Blame(ctx, "a.md", ""); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Blame with a timeout error = %v, want context.DeadlineExceeded", err)
+	}
+	if _, err := timed.Store(ctx, "c.md", "# C", "add", author); err != nil {
+		t.Errorf("Store with a timeout: %v", err)
+	}
+	if timed.Stats()["load"].Errors != 1 {
+		t.Errorf("timed-out load not counted as an error: %+v", timed.Stats()["load"])
+	}
+	timed.SetTimeouts(0, 0)
+	if content, err := timed.Load(ctx, "c.md", ""); err != nil || content != "# C" {
+		t.Errorf("Load without timeouts = %q, %v", content, err)
+	}
+}
+
+func TestGitStorageBundleRestore(t *testing.T) {
+	gs, err := NewGitStorage(t.TempDir(), true)
+	if err != nil {
+		t.Fatalf("Failed to create GitStorage: %v", err)
+	}
+
+	var empty bytes.Buffer
+	if err := gs.Bundle(context.Background(), &empty); !errors.Is(err, ErrEmptyRepository) {
+		t.Errorf("Bundle(empty) error = %v, want ErrEmptyRepository", err)
+	}
+
+	author := Author{Name: "Test", Email: "test@example.com"}
+	gs.Store(context.Background(), "home.md", "# Home", "create home", author)
+	gs.StoreBytes(context.Background(), "home/logo.png", []byte{0x89, 'P', 'N', 'G'}, "add logo", author)
+	gs.Store(context.Background(), "home.md", "# Home\n\nEdited", "edit home", author)
+
+	var bundle bytes.Buffer
+	if err := gs.Bundle(context.Background(), &bundle); err != nil {
+		t.Fatalf("Bundle failed: %v", err)
+	}
+	if !strings.HasPrefix(bundle.String(), "# v2 git bundle\n") {
+		t.Errorf("bundle should start with the v2 signature, got %q", bundle.String()[:20])
+	}
+
+	restored, err := RestoreBundle(&bundle, t.TempDir())
+	if err != nil {
+		t.Fatalf("RestoreBundle failed: %v", err)
+	}
+	if content, _ := restored.Load(context.Background(), "home.md", ""); content != "# Home\n\nEdited" {
+		t.Errorf("restored home.md = %q", content)
+	}
+	if data, _ := restored.LoadBytes(context.Background(), "home/logo.png", ""); !bytes.Equal(data, []byte{0x89, 'P', 'N', 'G'}) {
+		t.Errorf("restored logo = %v", data)
+	}
+	history, err := restored.Log(context.Background(), "home.md", 0)
+	if err != nil || len(history) != 2 {
+		t.Errorf("restored history has %d commits (%v), want 2", len(history), err)
+	}
+
+	if _, err := RestoreBundle(strings.NewReader("not a bundle"), t.TempDir()); err == nil {
+		t.Error("RestoreBundle should reject input without a bundle signature")
+	}
+}
+
+func TestGitStorageMaintain(t *testing.T) {
+	for _, binary := range []bool{false, true} {
+		t.Run(fmt.Sprintf("binary=%v", binary), func(t *testing.T) {
+			gs, err := NewGitStorage(t.TempDir(), true)
+			if err != nil {
+				t.Fatalf("Failed to create GitStorage: %v", err)
+			}
+			if binary {
+				if err := gs.UseGitBinary("git"); err != nil {
+					t.Skipf("git binary: %v", err)
+				}
+			}
+			if _, err := gs.Maintain(context.Background()); err != nil {
+				t.Fatalf("Maintain of an empty repository: %v", err)
+			}
+
+			author := Author{Name: "Test", Email: "test@example.com"}
+			for i := 0; i < 5; i++ {
+				gs.Store(context.Background(), "home.md", fmt.Sprintf("# Home\n\nEdit %d", i), "", author)
+			}
+			// Two unreachable blobs, one written long ago.
+			dangling := func(content string, age time.Duration) string {
+				obj := gs.repo.Storer.NewEncodedObject()
+				obj.SetType(plumbing.BlobObject)
+				w, _ := obj.Writer()
+				w.Write([]byte(content))
+				w.Close()
+				hash, err := gs.repo.Storer.SetEncodedObject(obj)
+				if err != nil {
+					t.Fatal(err)
+				}
+				path := filepath.Join(gs.path, ".git", "objects", hash.String()[:2], hash.String()[2:])
+				when := time.Now().Add(-age)
+				os.Chtimes(path, when, when)
+				return path
+			}
+			recent := dangling("recent", time.Hour)
+			old := dangling("old", 30*24*time.Hour)
+
+			reloaded := false
+			gs.OnReload(func() { reloaded = true })
+			result, err := gs.Maintain(context.Background())
+			if err != nil {
+				t.Fatalf("Maintain: %v", err)
+			}
+			if result.Before.LooseObjects < 15 || result.After.Packs != 1 || result.After.LooseObjects != 1 {
+				t.Errorf("Maintain went from %+v to %+v; want one pack and the recent dangling blob", result.Before, result.After)
+			}
+			if _, err := os.Stat(recent); err != nil {
+				t.Errorf("recently unreachable blob was deleted: %v", err)
+			}
+			if _, err := os.Stat(old); !os.IsNotExist(err) {
+				t.Errorf("long unreachable blob was kept: %v", err)
+			}
+			if !reloaded {
+				t.Error("Maintain should tell the other processes to reopen the repository")
+			}
+			if _, err := os.Stat(filepath.Join(gs.path, ".git", "packed-refs")); binary && err != nil {
+				t.Errorf("git gc should have packed the refs: %v", err)
+			}
+			if content, err := gs.Load(context.Background(), "home.md", ""); err != nil || content != "# Home\n\nEdit 4" {
+				t.Errorf("home.md after Maintain = %q, %v", content, err)
+			}
+			if log, err := gs.Log(context.Background(), "home.md", 0); err != nil || len(log) != 5 {
+				t.Errorf("history after Maintain has %d commits (%v), want 5", len(log), err)
+			}
+			if _, err := gs.Store(context.Background(), "home.md", "# Home\n\nAfter", "", author); err != nil {
+				t.Errorf("Store after Maintain: %v", err)
+			}
+		})
+	}
+}
+
+func TestTimedStorage(t *testing.T) {
+	gs, err := NewGitStorage(t.TempDir(), true)
+	if err != nil {
+		t.Fatalf("Failed to create GitStorage: %v", err)
+	}
+	ts := NewTimedStorage(gs, time.Nanosecond)
+	author := Author{Name: "Test", Email: "test@example.com"}
+
+	if _, err := ts.Store(context.Background(), "page.md", "# Page", "add", author); err != nil {
+		t.Fatalf("Store: %v", err)
+	}
+	if content, err := ts.Load(context.Background(), "page.md", ""); err != nil || content != "# Page" {
+		t.Errorf("Load = %q, %v", content, err)
+	}
+	ts.LoadBytes(context.Background(), "missing.md", "")
+	ts.Load(context.Background(), "../escape.md", "")
+
+	stats := ts.Stats()
+	if got := stats["store"]; got.Count != 1 || got.Errors != 0 || got.Total <= 0 {
+		t.Errorf("store stats = %+v", got)
+	}
+	load := stats["load"]
+	if load.Count != 3 {
+		t.Errorf("load count = %d, want 3", load.Count)
+	}
+	// Not found is a normal answer; only the rejected traversal is an error.
+	if load.Errors != 1 {
+		t.Errorf("load errors = %d, want 1", load.Errors)
+	}
+	if load.Slow != load.Count {
+		t.Errorf("with a 1ns threshold every load is slow, got %d of %d", load.Slow, load.Count)
+	}
+	if load.Max <= 0 || load.Max > load.Total {
+		t.Errorf("load max = %v, total = %v", load.Max, load.Total)
+	}
+}
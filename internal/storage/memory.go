@@ -0,0 +1,1033 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-git/go-billy/v5/memfs"
+	"github.com/go-git/go-billy/v5/util"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	fdiff "github.com/go-git/go-git/v5/plumbing/format/diff"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	gitmemory "github.com/go-git/go-git/v5/storage/memory"
+	"github.com/go-git/go-git/v5/utils/binary"
+	"github.com/go-git/go-git/v5/utils/diff"
+	"github.com/sergi/go-diff/diffmatchpatch"
+)
+
+// MemoryStorage implements Storage in memory. It keeps a linear history of
+// commits that answers the history operations the way a git repository
+// would, revision hashes and patches included, without being one. It suits
+// tests and programs embedding the wiki that need no repository on disk;
+// everything is lost when it is dropped. Nothing it does can block, so it
+// ignores the contexts it is given.
+type MemoryStorage struct {
+	mu      sync.RWMutex
+	files   map[string][]byte // Working tree, by slash-separated path
+	mtimes  map[string]time.Time
+	commits []*memoryCommit // Oldest first
+}
+
+// memoryCommit is one commit of a MemoryStorage.
+type memoryCommit struct {
+	hash    string
+	author  Author // When is always set
+	message string
+	tree    map[string][]byte // Every file as of the commit
+	changed []string          // Paths added, modified, or deleted, sorted
+	files   []string          // changed, less the new names of renamed files
+}
+
+// NewMemoryStorage returns an empty MemoryStorage.
+func NewMemoryStorage() *MemoryStorage {
+	return &MemoryStorage{
+		files:  make(map[string][]byte),
+		mtimes: make(map[string]time.Time),
+	}
+}
+
+// Path returns "": a MemoryStorage has no directory.
+func (m *MemoryStorage) Path() string {
+	return ""
+}
+
+// memoryPath cleans filename into the key of the file, rejecting the paths
+// GitStorage rejects. The root is "".
+func memoryPath(filename string) (string, error) {
+	if filename == "" {
+		return "", nil
+	}
+	cleaned := filepath.Clean(filename)
+	if filepath.IsAbs(cleaned) || strings.HasPrefix(cleaned, "..") {
+		return "", ErrPathTraversal
+	}
+	if cleaned == "." {
+		return "", nil
+	}
+	return filepath.ToSlash(cleaned), nil
+}
+
+// isDirLocked reports whether any file lies under p. Caller must hold m.mu.
+func (m *MemoryStorage) isDirLocked(p string) bool {
+	if p == "" {
+		return true
+	}
+	prefix := p + "/"
+	for name := range m.files {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// Exists checks if a file or directory exists.
+func (m *MemoryStorage) Exists(ctx context.Context, filename string) bool {
+	p, err := memoryPath(filename)
+	if err != nil {
+		return false
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	_, ok := m.files[p]
+	return ok || m.isDirLocked(p)
+}
+
+// IsDir checks if a path is a directory.
+func (m *MemoryStorage) IsDir(ctx context.Context, dirname string) bool {
+	p, err := memoryPath(dirname)
+	if err != nil {
+		return false
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.isDirLocked(p)
+}
+
+// IsEmptyDir reports false: directories only exist while they hold files.
+func (m *MemoryStorage) IsEmptyDir(ctx context.Context, dirname string) bool {
+	return false
+}
+
+// Mtime returns the time a file was last written.
+func (m *MemoryStorage) Mtime(ctx context.Context, filename string) (time.Time, error) {
+	p, err := memoryPath(filename)
+	if err != nil {
+		return time.Time{}, err
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	mtime, ok := m.mtimes[p]
+	if !ok {
+		return time.Time{}, &fs.PathError{Op: "stat", Path: filename, Err: fs.ErrNotExist}
+	}
+	return mtime, nil
+}
+
+// Size returns the size of a file in bytes.
+func (m *MemoryStorage) Size(ctx context.Context, filename string) (int64, error) {
+	p, err := memoryPath(filename)
+	if err != nil {
+		return 0, err
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	content, ok := m.files[p]
+	if !ok {
+		return 0, &fs.PathError{Op: "stat", Path: filename, Err: fs.ErrNotExist}
+	}
+	return int64(len(content)), nil
+}
+
+// Load reads a file's content.
+func (m *MemoryStorage) Load(ctx context.Context, filename string, revision string) (string, error) {
+	data, err := m.LoadBytes(ctx, filename, revision)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// LoadBytes reads a file's content as bytes.
+func (m *MemoryStorage) LoadBytes(ctx context.Context, filename string, revision string) ([]byte, error) {
+	p, err := memoryPath(filename)
+	if err != nil {
+		return nil, err
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	files := m.files
+	if revision != "" {
+		commit := m.resolveLocked(revision)
+		if commit == nil {
+			return nil, ErrNotFound
+		}
+		files = commit.tree
+	}
+	content, ok := files[p]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return bytes.Clone(content), nil
+}
+
+// Open returns a reader of a file's content, which is in memory already.
+func (m *MemoryStorage) Open(ctx context.Context, filename string) (io.ReadSeekCloser, error) {
+	content, err := m.LoadBytes(ctx, filename, "")
+	if err != nil {
+		return nil, err
+	}
+	return nopCloser{bytes.NewReader(content)}, nil
+}
+
+// nopCloser is a ReadSeeker with nothing to close.
+type nopCloser struct {
+	io.ReadSeeker
+}
+
+func (nopCloser) Close() error { return nil }
+
+// Store writes content to a file and commits it.
+func (m *MemoryStorage) Store(ctx context.Context, filename, content, message string, author Author) (bool, error) {
+	return m.StoreBytes(ctx, filename, []byte(content), message, author)
+}
+
+// StoreBytes writes binary content to a file and commits it.
+func (m *MemoryStorage) StoreBytes(ctx context.Context, filename string, content []byte, message string, author Author) (bool, error) {
+	p, err := memoryPath(filename)
+	if err != nil {
+		return false, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if message == "" {
+		message = "Update " + filename
+	}
+	m.writeLocked(p, content)
+	return m.commitLocked(message, author), nil
+}
+
+// StoreFiles writes several files and commits them together. It reports
+// whether anything changed; no commit is made if nothing did.
+func (m *MemoryStorage) StoreFiles(ctx context.Context, files map[string][]byte, message string, author Author) (bool, error) {
+	paths := make(map[string][]byte, len(files))
+	for filename, content := range files {
+		p, err := memoryPath(filename)
+		if err != nil {
+			return false, err
+		}
+		paths[p] = content
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if message == "" {
+		message = fmt.Sprintf("Update %d files", len(files))
+	}
+	for p, content := range paths {
+		m.writeLocked(p, content)
+	}
+	return m.commitLocked(message, author), nil
+}
+
+// Delete removes a file or directory.
+func (m *MemoryStorage) Delete(ctx context.Context, filename string, message string, author Author) error {
+	p, err := memoryPath(filename)
+	if err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.files[p]; ok {
+		m.removeLocked(p)
+	} else if p != "" && m.isDirLocked(p) {
+		for _, name := range m.underLocked(p) {
+			m.removeLocked(name)
+		}
+	} else {
+		return nil
+	}
+
+	if message == "" {
+		message = fmt.Sprintf("Deleted %s.", filename)
+	}
+	m.commitLocked(message, author)
+	return nil
+}
+
+// Rename renames a file or directory.
+func (m *MemoryStorage) Rename(ctx context.Context, oldFilename, newFilename, message string, author Author) error {
+	oldPath, err := memoryPath(oldFilename)
+	if err != nil {
+		return err
+	}
+	newPath, err := memoryPath(newFilename)
+	if err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.files[newPath]; ok || m.isDirLocked(newPath) {
+		return fmt.Errorf("the filename %q already exists", newFilename)
+	}
+
+	if content, ok := m.files[oldPath]; ok {
+		m.removeLocked(oldPath)
+		m.writeLocked(newPath, content)
+	} else if oldPath != "" && m.isDirLocked(oldPath) {
+		for _, name := range m.underLocked(oldPath) {
+			content := m.files[name]
+			m.removeLocked(name)
+			m.writeLocked(newPath+strings.TrimPrefix(name, oldPath), content)
+		}
+	} else {
+		return fmt.Errorf("renaming %s to %s failed: %w", oldFilename, newFilename, fs.ErrNotExist)
+	}
+
+	if message == "" {
+		message = fmt.Sprintf("%s renamed to %s.", oldFilename, newFilename)
+	}
+	m.commitLocked(message, author)
+	return nil
+}
+
+// writeLocked puts content in the working tree. Caller must hold m.mu
+// (write lock).
+func (m *MemoryStorage) writeLocked(p string, content []byte) {
+	m.files[p] = bytes.Clone(content)
+	m.mtimes[p] = time.Now()
+}
+
+// removeLocked drops a file from the working tree. Caller must hold m.mu
+// (write lock).
+func (m *MemoryStorage) removeLocked(p string) {
+	delete(m.files, p)
+	delete(m.mtimes, p)
+}
+
+// underLocked returns the files under the directory p. Caller must hold
+// m.mu.
+func (m *MemoryStorage) underLocked(p string) []string {
+	prefix := p + "/"
+	var names []string
+	for name := range m.files {
+		if strings.HasPrefix(name, prefix) {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// headLocked returns the latest commit, or nil before the first. Caller
+// must hold m.mu.
+func (m *MemoryStorage) headLocked() *memoryCommit {
+	if len(m.commits) == 0 {
+		return nil
+	}
+	return m.commits[len(m.commits)-1]
+}
+
+// commitLocked commits the working tree, reporting whether it differed from
+// the latest commit; nothing is committed if it did not. Caller must hold
+// m.mu (write lock).
+func (m *MemoryStorage) commitLocked(message string, author Author) bool {
+	var parent map[string][]byte
+	parentHash := ""
+	if head := m.headLocked(); head != nil {
+		parent = head.tree
+		parentHash = head.hash
+	}
+	changed := changedPaths(parent, m.files)
+	if len(changed) == 0 {
+		return false
+	}
+
+	tree := make(map[string][]byte, len(m.files))
+	for name, content := range m.files {
+		tree[name] = content
+	}
+	if author.When.IsZero() {
+		author.When = time.Now()
+	}
+	commit := &memoryCommit{author: author, message: message, tree: tree, changed: changed}
+	renamed := renames(parent, tree, changed)
+	for _, name := range changed {
+		if _, ok := renamed[name]; !ok {
+			commit.files = append(commit.files, name)
+		}
+	}
+
+	// Hash what the commit is made of, the parent included, so that equal
+	// commits at different points of the history get different revisions.
+	h := sha1.New()
+	fmt.Fprintf(h, "parent %s\nauthor %s <%s> %d\n\n%s\n", parentHash, author.Name, author.Email, author.When.UnixNano(), message)
+	for _, name := range changed {
+		if content, ok := tree[name]; ok {
+			fmt.Fprintf(h, "%s %x\n", name, sha1.Sum(content))
+		} else {
+			fmt.Fprintf(h, "%s -\n", name)
+		}
+	}
+	commit.hash = hex.EncodeToString(h.Sum(nil))
+
+	m.commits = append(m.commits, commit)
+	return true
+}
+
+// changedPaths returns the paths whose content differs between two trees,
+// sorted.
+func changedPaths(from, to map[string][]byte) []string {
+	var changed []string
+	for name, content := range to {
+		if old, ok := from[name]; !ok || !bytes.Equal(old, content) {
+			changed = append(changed, name)
+		}
+	}
+	for name := range from {
+		if _, ok := to[name]; !ok {
+			changed = append(changed, name)
+		}
+	}
+	sort.Strings(changed)
+	return changed
+}
+
+// renames pairs the paths among paths that one tree has and the other
+// lacks, when their content is the same, the way git detects an exact
+// rename. It maps each new name to the old one.
+func renames(from, to map[string][]byte, paths []string) map[string]string {
+	var deleted []string
+	for _, name := range paths {
+		if _, ok := to[name]; !ok {
+			deleted = append(deleted, name)
+		}
+	}
+	result := make(map[string]string)
+	for _, name := range paths {
+		if _, ok := from[name]; ok {
+			continue
+		}
+		for i, old := range deleted {
+			if old != "" && bytes.Equal(from[old], to[name]) {
+				result[name] = old
+				deleted[i] = ""
+				break
+			}
+		}
+	}
+	return result
+}
+
+// resolveLocked finds the commit a revision names: a unique prefix of at
+// least four characters of its hash, or HEAD, optionally followed by the
+// ancestry suffixes ~n and ^. It returns nil if there is none. Caller must
+// hold m.mu.
+func (m *MemoryStorage) resolveLocked(revision string) *memoryCommit {
+	base, rest := revision, ""
+	if i := strings.IndexAny(revision, "~^"); i >= 0 {
+		base, rest = revision[:i], revision[i:]
+	}
+
+	index := -1
+	if base == "HEAD" {
+		index = len(m.commits) - 1
+	} else if len(base) >= 4 {
+		for i, commit := range m.commits {
+			if strings.HasPrefix(commit.hash, base) {
+				if index >= 0 {
+					return nil // Ambiguous
+				}
+				index = i
+			}
+		}
+	}
+
+	for rest != "" && index >= 0 {
+		op := rest[0]
+		rest = rest[1:]
+		digits := len(rest) - len(strings.TrimLeft(rest, "0123456789"))
+		n := 1
+		if digits > 0 {
+			n, _ = strconv.Atoi(rest[:digits])
+			rest = rest[digits:]
+		}
+		if op == '^' && n > 1 {
+			return nil // The history has no merges
+		}
+		index -= n
+	}
+	if index < 0 {
+		return nil
+	}
+	return m.commits[index]
+}
+
+// parentOf returns the tree before commit: empty for the first one.
+// Caller must hold m.mu.
+func (m *MemoryStorage) parentOf(commit *memoryCommit) map[string][]byte {
+	for i, c := range m.commits {
+		if c == commit && i > 0 {
+			return m.commits[i-1].tree
+		}
+	}
+	return nil
+}
+
+func (c *memoryCommit) metadata(includeFiles bool) CommitMetadata {
+	var files []string
+	if includeFiles {
+		files = append(files, c.files...)
+	}
+	return CommitMetadata{
+		Revision:     c.hash[:6],
+		RevisionFull: c.hash,
+		Datetime:     c.author.When,
+		AuthorName:   c.author.Name,
+		AuthorEmail:  c.author.Email,
+		Message:      strings.TrimSpace(c.message),
+		Files:        files,
+	}
+}
+
+func (c *memoryCommit) touches(p string) bool {
+	i := sort.SearchStrings(c.changed, p)
+	return i < len(c.changed) && c.changed[i] == p
+}
+
+// Metadata returns commit metadata for a file.
+func (m *MemoryStorage) Metadata(ctx context.Context, filename string, revision string) (*CommitMetadata, error) {
+	p, err := memoryPath(filename)
+	if err != nil {
+		return nil, err
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if revision != "" {
+		commit := m.resolveLocked(revision)
+		if commit == nil {
+			return nil, ErrNotFound
+		}
+		meta := commit.metadata(false)
+		return &meta, nil
+	}
+	for i := len(m.commits) - 1; i >= 0; i-- {
+		if m.commits[i].touches(p) {
+			meta := m.commits[i].metadata(false)
+			return &meta, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+// Log returns the commit history.
+func (m *MemoryStorage) Log(ctx context.Context, filename string, maxCount int) ([]CommitMetadata, error) {
+	p, err := memoryPath(filename)
+	if err != nil {
+		return nil, err
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.logLocked(p, maxCount)
+}
+
+// logLocked lists the commits touching p, or all of them for "", newest
+// first. Caller must hold m.mu.
+func (m *MemoryStorage) logLocked(p string, maxCount int) ([]CommitMetadata, error) {
+	if len(m.commits) == 0 {
+		return nil, ErrNotFound
+	}
+	var result []CommitMetadata
+	for i := len(m.commits) - 1; i >= 0; i-- {
+		if maxCount > 0 && len(result) >= maxCount {
+			break
+		}
+		if p == "" || m.commits[i].touches(p) {
+			result = append(result, m.commits[i].metadata(false))
+		}
+	}
+	return result, nil
+}
+
+// QueryLog returns repository history matching the query, newest first.
+func (m *MemoryStorage) QueryLog(ctx context.Context, query LogQuery) ([]CommitMetadata, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	author := strings.ToLower(query.Author)
+	prefix := filepath.ToSlash(query.PathPrefix)
+	result := []CommitMetadata{}
+	skipped := 0
+	for i := len(m.commits) - 1; i >= 0; i-- {
+		if query.Limit > 0 && len(result) >= query.Limit {
+			break
+		}
+		commit := m.commits[i]
+		when := commit.author.When
+		if !query.Since.IsZero() && when.Before(query.Since) ||
+			!query.Until.IsZero() && when.After(query.Until) {
+			continue
+		}
+		if prefix != "" && !commit.touchesPrefix(prefix) {
+			continue
+		}
+		if query.Path != "" && !commit.touches(filepath.ToSlash(query.Path)) {
+			continue
+		}
+		if query.AuthorEmail != "" && !strings.EqualFold(commit.author.Email, query.AuthorEmail) {
+			continue
+		}
+		if author != "" &&
+			!strings.Contains(strings.ToLower(commit.author.Name), author) &&
+			!strings.Contains(strings.ToLower(commit.author.Email), author) {
+			continue
+		}
+		if skipped < query.Offset {
+			skipped++
+			continue
+		}
+		result = append(result, commit.metadata(true))
+	}
+	return result, nil
+}
+
+func (c *memoryCommit) touchesPrefix(prefix string) bool {
+	for _, name := range c.changed {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// Blame returns blame information for a file, attributing each line to the
+// commit that last changed it.
+func (m *MemoryStorage) Blame(ctx context.Context, filename string, revision string) ([]BlameLine, error) {
+	p, err := memoryPath(filename)
+	if err != nil {
+		return nil, err
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	commit := m.headLocked()
+	if revision != "" {
+		commit = m.resolveLocked(revision)
+	}
+	if commit == nil {
+		return nil, ErrNotFound
+	}
+	if _, ok := commit.tree[p]; !ok {
+		return nil, ErrNotFound
+	}
+
+	// Replay the history of the file, carrying each line's commit over the
+	// lines every change kept.
+	var owners []*memoryCommit
+	var content string
+	for _, c := range m.commits {
+		if c.touches(p) {
+			next, ok := c.tree[p]
+			if !ok {
+				owners, content = nil, ""
+			} else {
+				var kept []*memoryCommit
+				line := 0
+				for _, d := range diff.Do(content, string(next)) {
+					n := len(splitLines(d.Text))
+					switch d.Type {
+					case diffmatchpatch.DiffEqual:
+						kept = append(kept, owners[line:line+n]...)
+						line += n
+					case diffmatchpatch.DiffDelete:
+						line += n
+					case diffmatchpatch.DiffInsert:
+						for range n {
+							kept = append(kept, c)
+						}
+					}
+				}
+				owners, content = kept, string(next)
+			}
+		}
+		if c == commit {
+			break
+		}
+	}
+
+	var lines []BlameLine
+	for i, text := range splitLines(content) {
+		subject, _, _ := strings.Cut(strings.TrimSpace(owners[i].message), "\n")
+		lines = append(lines, BlameLine{
+			Revision:    owners[i].hash[:6],
+			AuthorName:  owners[i].author.Name,
+			AuthorEmail: owners[i].author.Email,
+			Datetime:    owners[i].author.When,
+			LineNumber:  i + 1,
+			Line:        text,
+			Message:     subject,
+		})
+	}
+	return lines, nil
+}
+
+// splitLines splits text into lines without their newlines; a final
+// newline does not start another line.
+func splitLines(text string) []string {
+	if text == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+}
+
+// Diff returns the diff between two revisions.
+func (m *MemoryStorage) Diff(ctx context.Context, revA, revB string) (string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	commitA := m.resolveLocked(revA)
+	commitB := m.resolveLocked(revB)
+	if commitA == nil || commitB == nil {
+		return "", ErrNotFound
+	}
+	return treePatch(commitA.tree, commitB.tree, changedPaths(commitA.tree, commitB.tree)), nil
+}
+
+// ShowCommit returns metadata and diff for a specific commit.
+func (m *MemoryStorage) ShowCommit(ctx context.Context, revision string) (*CommitMetadata, string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	commit := m.resolveLocked(revision)
+	if commit == nil {
+		return nil, "", fmt.Errorf("no commit found for ref %s", revision)
+	}
+	meta := commit.metadata(true)
+	return &meta, treePatch(m.parentOf(commit), commit.tree, commit.changed), nil
+}
+
+// FormatPatch returns the history of filename as an mbox patch series,
+// oldest commit first, in the layout GitStorage.FormatPatch uses.
+func (m *MemoryStorage) FormatPatch(ctx context.Context, filename string) (string, error) {
+	p, err := memoryPath(filename)
+	if err != nil {
+		return "", err
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var commits []*memoryCommit
+	for _, commit := range m.commits {
+		if commit.touches(p) {
+			commits = append(commits, commit)
+		}
+	}
+	if len(commits) == 0 {
+		return "", ErrNotFound
+	}
+
+	var b strings.Builder
+	for i, commit := range commits {
+		patch := treePatch(m.parentOf(commit), commit.tree, []string{p})
+		writeMboxPatch(&b, &object.Commit{
+			Hash:    plumbing.NewHash(commit.hash),
+			Author:  *makeSignature(commit.author),
+			Message: commit.message,
+		}, i+1, len(commits), patch)
+	}
+	return b.String(), nil
+}
+
+// Bundle writes the history as a git bundle, replaying it into a git
+// repository in memory. The bundled commits have the same files, authors,
+// dates, and messages, but their own revisions.
+func (m *MemoryStorage) Bundle(ctx context.Context, w io.Writer) error {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if len(m.commits) == 0 {
+		return ErrEmptyRepository
+	}
+
+	repo, err := git.Init(gitmemory.NewStorage(), memfs.New())
+	if err != nil {
+		return err
+	}
+	worktree, err := repo.Worktree()
+	if err != nil {
+		return err
+	}
+	for _, commit := range m.commits {
+		for _, name := range commit.changed {
+			if content, ok := commit.tree[name]; ok {
+				if err := util.WriteFile(worktree.Filesystem, name, content, 0o644); err != nil {
+					return err
+				}
+				if _, err := worktree.Add(name); err != nil {
+					return err
+				}
+			} else if _, err := worktree.Remove(name); err != nil {
+				return err
+			}
+		}
+		if _, err := worktree.Commit(commit.message, &git.CommitOptions{
+			Author:            makeSignature(commit.author),
+			AllowEmptyCommits: true,
+		}); err != nil {
+			return err
+		}
+	}
+	return writeBundle(repo, w)
+}
+
+// Revert reverts a commit.
+func (m *MemoryStorage) Revert(ctx context.Context, revision, message string, author Author) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	commit := m.resolveLocked(revision)
+	if commit == nil {
+		return fmt.Errorf("commit not found: %w", ErrNotFound)
+	}
+	if commit == m.commits[0] {
+		return fmt.Errorf("cannot revert initial commit")
+	}
+
+	parent := m.parentOf(commit)
+	for _, name := range commit.changed {
+		if content, ok := parent[name]; ok {
+			m.writeLocked(name, content)
+		} else {
+			m.removeLocked(name)
+		}
+	}
+
+	if message == "" {
+		message = fmt.Sprintf("Revert %q", commit.message)
+	}
+	m.commitLocked(message, author)
+	return nil
+}
+
+// List returns files and directories in a path.
+func (m *MemoryStorage) List(ctx context.Context, dir string, depth *int, exclude []string) (files, directories []string, err error) {
+	p, err := memoryPath(dir)
+	if err != nil {
+		return nil, nil, err
+	}
+	excludeSet := make(map[string]bool)
+	for _, e := range exclude {
+		excludeSet[e] = true
+	}
+	prefix := ""
+	if p != "" {
+		prefix = p + "/"
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	dirSet := make(map[string]bool)
+	for name := range m.files {
+		if !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		parts := strings.Split(strings.TrimPrefix(name, prefix), "/")
+		for i, part := range parts {
+			if excludeSet[part] || depth != nil && i > *depth {
+				break
+			}
+			rel := filepath.FromSlash(strings.Join(parts[:i+1], "/"))
+			if i == len(parts)-1 {
+				files = append(files, rel)
+			} else {
+				dirSet[rel] = true
+			}
+		}
+	}
+	for d := range dirSet {
+		directories = append(directories, d)
+	}
+
+	sort.Strings(files)
+	sort.Strings(directories)
+	return files, directories, nil
+}
+
+// Commit commits the named files, which the storage already holds: every
+// write is committed as it is made, so this only records a commit when
+// something was left uncommitted.
+func (m *MemoryStorage) Commit(ctx context.Context, filenames []string, message string, author Author) error {
+	paths := make([]string, 0, len(filenames))
+	for _, filename := range filenames {
+		p, err := memoryPath(filename)
+		if err != nil {
+			return err
+		}
+		paths = append(paths, p)
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i, p := range paths {
+		_, inTree := m.files[p]
+		inHead := false
+		if head := m.headLocked(); head != nil {
+			_, inHead = head.tree[p]
+		}
+		if !inTree && !inHead {
+			return fmt.Errorf("failed to add %s: %w", filenames[i], ErrNotFound)
+		}
+	}
+	m.commitLocked(message, author)
+	return nil
+}
+
+// GetParentRevision returns the parent revision for a file.
+func (m *MemoryStorage) GetParentRevision(ctx context.Context, filename, revision string) (string, error) {
+	p, err := memoryPath(filename)
+	if err != nil {
+		return "", err
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	history, err := m.logLocked(p, 0)
+	if err != nil {
+		return "", err
+	}
+
+	for i, entry := range history {
+		if entry.Revision == revision || strings.HasPrefix(entry.RevisionFull, revision) {
+			if i+1 < len(history) {
+				return history[i+1].Revision, nil
+			}
+			return "", ErrNotFound
+		}
+	}
+	return "", ErrNotFound
+}
+
+// GetFilenameAtRevision returns the filename used at a specific revision.
+// Like GitStorage, it does not follow renames.
+func (m *MemoryStorage) GetFilenameAtRevision(ctx context.Context, currentFilename, revision string) (string, error) {
+	if _, err := memoryPath(currentFilename); err != nil {
+		return "", err
+	}
+	return currentFilename, nil
+}
+
+// treePatch renders the changes to paths between two trees as a unified
+// diff, with the encoder go-git uses, so that it reads like the patches of
+// GitStorage.
+func treePatch(from, to map[string][]byte, paths []string) string {
+	renamed := renames(from, to, paths)
+	renamedTo := make(map[string]string, len(renamed))
+	for newName, oldName := range renamed {
+		renamedTo[oldName] = newName
+	}
+
+	var patches []fdiff.FilePatch
+	for _, name := range paths {
+		if _, ok := renamed[name]; ok {
+			continue // Part of the patch of the old name
+		}
+		a, inFrom := from[name]
+		b, inTo := to[name]
+		toName := name
+		if newName, ok := renamedTo[name]; ok {
+			toName = newName
+			b, inTo = to[newName]
+		}
+		if inFrom == inTo && toName == name && bytes.Equal(a, b) {
+			continue
+		}
+		fp := &memoryFilePatch{}
+		if inFrom {
+			fp.from = memoryFile{name, a}
+		}
+		if inTo {
+			fp.to = memoryFile{toName, b}
+		}
+		if !isBinary(a) && !isBinary(b) {
+			for _, d := range diff.Do(string(a), string(b)) {
+				op := fdiff.Equal
+				switch d.Type {
+				case diffmatchpatch.DiffDelete:
+					op = fdiff.Delete
+				case diffmatchpatch.DiffInsert:
+					op = fdiff.Add
+				}
+				fp.chunks = append(fp.chunks, memoryChunk{d.Text, op})
+			}
+		}
+		patches = append(patches, fp)
+	}
+
+	var buf bytes.Buffer
+	if err := fdiff.NewUnifiedEncoder(&buf, fdiff.DefaultContextLines).Encode(memoryPatch(patches)); err != nil {
+		return fmt.Sprintf("malformed patch: %s", err)
+	}
+	return buf.String()
+}
+
+// FilePatch renders the change of filename from a to b as a unified diff
+// in the format of ShowCommit. A nil side is a missing file, whose
+// creation or deletion shows as every line added or removed.
+func FilePatch(filename string, a, b []byte) string {
+	from, to := make(map[string][]byte), make(map[string][]byte)
+	if a != nil {
+		from[filename] = a
+	}
+	if b != nil {
+		to[filename] = b
+	}
+	return treePatch(from, to, []string{filename})
+}
+
+func isBinary(content []byte) bool {
+	ok, err := binary.IsBinary(bytes.NewReader(content))
+	return err == nil && ok
+}
+
+// memoryPatch and the types below implement go-git's patch interfaces.
+type memoryPatch []fdiff.FilePatch
+
+func (p memoryPatch) FilePatches() []fdiff.FilePatch { return p }
+func (p memoryPatch) Message() string                { return "" }
+
+type memoryFilePatch struct {
+	from, to fdiff.File // nil when the file is added or deleted
+	chunks   []fdiff.Chunk
+}
+
+// IsBinary reports a patch without chunks as binary, as go-git does.
+func (fp *memoryFilePatch) IsBinary() bool               { return len(fp.chunks) == 0 }
+func (fp *memoryFilePatch) Files() (from, to fdiff.File) { return fp.from, fp.to }
+func (fp *memoryFilePatch) Chunks() []fdiff.Chunk        { return fp.chunks }
+
+type memoryFile struct {
+	path    string
+	content []byte
+}
+
+func (f memoryFile) Hash() plumbing.Hash     { return plumbing.ComputeHash(plumbing.BlobObject, f.content) }
+func (f memoryFile) Mode() filemode.FileMode { return filemode.Regular }
+func (f memoryFile) Path() string            { return f.path }
+
+type memoryChunk struct {
+	content string
+	op      fdiff.Operation
+}
+
+func (c memoryChunk) Content() string       { return c.content }
+func (c memoryChunk) Type() fdiff.Operation { return c.op }
+
+var _ Storage = (*MemoryStorage)(nil)
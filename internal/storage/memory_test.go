@@ -0,0 +1,231 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"reflect"
+	"regexp"
+	"testing"
+)
+
+// TestMemoryStorageMatchesGit runs the same edits against both storages and
+// compares what they report, revision hashes aside.
+func TestMemoryStorageMatchesGit(t *testing.T) {
+	gs, err := NewGitStorage(t.TempDir(), true)
+	if err != nil {
+		t.Fatalf("NewGitStorage: %v", err)
+	}
+	ms := NewMemoryStorage()
+	alice := Author{Name: "Alice", Email: "alice@example.com"}
+	bob := Author{Name: "Bob", Email: "bob@example.com"}
+
+	edits := []func(s Storage) error{
+		func(s Storage) error {
+			_, err := s.Store(context.Background(), "home.md", "# Home\n\nfirst\nsecond\n", "Create home", alice)
+			return err
+		},
+		func(s Storage) error {
+			_, err := s.StoreFiles(context.Background(), map[string][]byte{
+				"docs/a.md":     []byte("alpha\n"),
+				"docs/sub/b.md": []byte("beta\n"),
+			}, "Add docs", bob)
+			return err
+		},
+		func(s Storage) error {
+			_, err := s.Store(context.Background(), "home.md", "# Home\n\nfirst\nchanged\nthird\n", "Edit home", bob)
+			return err
+		},
+		func(s Storage) error { return s.Rename(context.Background(), "docs/a.md", "docs/c.md", "", alice) },
+		func(s Storage) error { return s.Delete(context.Background(), "docs/sub", "", alice) },
+	}
+	for i, edit := range edits {
+		if err := edit(gs); err != nil {
+			t.Fatalf("edit %d on git: %v", i, err)
+		}
+		if err := edit(ms); err != nil {
+			t.Fatalf("edit %d on memory: %v", i, err)
+		}
+	}
+
+	hashes := regexp.MustCompile(`[0-9a-f]{40}|index [0-9a-f]+\.\.[0-9a-f]+`)
+	stable := func(s string) string { return hashes.ReplaceAllString(s, "HASH") }
+
+	if changed, err := ms.Store(context.Background(), "home.md", "# Home\n\nfirst\nchanged\nthird\n", "", alice); err != nil || changed {
+		t.Errorf("storing unchanged content = %v, %v; want false, nil", changed, err)
+	}
+
+	gitLog, err := gs.Log(context.Background(), "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	memLog, err := ms.Log(context.Background(), "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(gitLog) != len(memLog) {
+		t.Fatalf("log lengths: git %d, memory %d", len(gitLog), len(memLog))
+	}
+	for i := range gitLog {
+		if gitLog[i].Message != memLog[i].Message || gitLog[i].AuthorName != memLog[i].AuthorName {
+			t.Errorf("log[%d]: git %q by %s, memory %q by %s", i, gitLog[i].Message, gitLog[i].AuthorName, memLog[i].Message, memLog[i].AuthorName)
+		}
+	}
+
+	gitFiles, gitDirs, _ := gs.List(context.Background(), "", nil, nil)
+	memFiles, memDirs, _ := ms.List(context.Background(), "", nil, nil)
+	if !reflect.DeepEqual(gitFiles, memFiles) || !reflect.DeepEqual(gitDirs, memDirs) {
+		t.Errorf("List: git %v %v, memory %v %v", gitFiles, gitDirs, memFiles, memDirs)
+	}
+
+	gitQuery, _ := gs.QueryLog(context.Background(), LogQuery{PathPrefix: "docs/"})
+	memQuery, _ := ms.QueryLog(context.Background(), LogQuery{PathPrefix: "docs/"})
+	if len(gitQuery) != len(memQuery) {
+		t.Fatalf("QueryLog lengths: git %d, memory %d", len(gitQuery), len(memQuery))
+	}
+	for i := range gitQuery {
+		if !reflect.DeepEqual(gitQuery[i].Files, memQuery[i].Files) {
+			t.Errorf("QueryLog[%d].Files: git %v, memory %v", i, gitQuery[i].Files, memQuery[i].Files)
+		}
+	}
+
+	gitFile, _ := gs.QueryLog(context.Background(), LogQuery{Path: "home.md", Offset: 1})
+	memFile, _ := ms.QueryLog(context.Background(), LogQuery{Path: "home.md", Offset: 1})
+	if len(gitFile) != 1 || len(memFile) != 1 || gitFile[0].Message != "Create home" || memFile[0].Message != "Create home" {
+		t.Errorf("QueryLog of home.md after the first: git %v, memory %v; want the creation", gitFile, memFile)
+	}
+
+	for i := range gitLog {
+		_, gitDiff, err := gs.ShowCommit(context.Background(), gitLog[i].Revision)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, memDiff, err := ms.ShowCommit(context.Background(), memLog[i].Revision)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if stable(gitDiff) != stable(memDiff) {
+			t.Errorf("ShowCommit(%q):\ngit:\n%s\nmemory:\n%s", gitLog[i].Message, gitDiff, memDiff)
+		}
+	}
+
+	gitDiff, _ := gs.Diff(context.Background(), gitLog[4].Revision, gitLog[0].Revision)
+	memDiff, _ := ms.Diff(context.Background(), memLog[4].Revision, memLog[0].Revision)
+	if stable(gitDiff) != stable(memDiff) {
+		t.Errorf("Diff:\ngit:\n%s\nmemory:\n%s", gitDiff, memDiff)
+	}
+
+	gitPatch, _ := gs.FormatPatch(context.Background(), "home.md")
+	memPatch, _ := ms.FormatPatch(context.Background(), "home.md")
+	dates := regexp.MustCompile(`(?m)^Date: .*$`)
+	if dates.ReplaceAllString(stable(gitPatch), "") != dates.ReplaceAllString(stable(memPatch), "") {
+		t.Errorf("FormatPatch:\ngit:\n%s\nmemory:\n%s", gitPatch, memPatch)
+	}
+
+	for _, s := range []Storage{gs, ms} {
+		f, err := s.Open(context.Background(), "home.md")
+		if err != nil {
+			t.Fatalf("%T.Open: %v", s, err)
+		}
+		data, _ := io.ReadAll(f)
+		f.Close()
+		if want, _ := s.LoadBytes(context.Background(), "home.md", ""); !bytes.Equal(data, want) {
+			t.Errorf("%T.Open read %q, want %q", s, data, want)
+		}
+		if _, err := s.Open(context.Background(), "docs/sub/b.md"); !errors.Is(err, ErrNotFound) {
+			t.Errorf("%T.Open of a deleted file = %v, want ErrNotFound", s, err)
+		}
+	}
+
+	gitBlame, _ := gs.Blame(context.Background(), "home.md", "")
+	memBlame, _ := ms.Blame(context.Background(), "home.md", "")
+	if len(gitBlame) != len(memBlame) {
+		t.Fatalf("Blame lengths: git %d, memory %d", len(gitBlame), len(memBlame))
+	}
+	for i := range gitBlame {
+		g, m := gitBlame[i], memBlame[i]
+		if g.Line != m.Line || g.AuthorName != m.AuthorName || g.AuthorEmail != m.AuthorEmail ||
+			g.Message != m.Message || g.LineNumber != m.LineNumber {
+			t.Errorf("Blame[%d]: git %d %q by %s, memory %d %q by %s", i, g.LineNumber, g.Line, g.AuthorName, m.LineNumber, m.Line, m.AuthorName)
+		}
+	}
+}
+
+func TestMemoryStorageRevisions(t *testing.T) {
+	ms := NewMemoryStorage()
+	author := Author{Name: "Test", Email: "test@example.com"}
+	for _, content := range []string{"one\n", "two\n", "three\n"} {
+		if _, err := ms.Store(context.Background(), "page.md", content, "", author); err != nil {
+			t.Fatal(err)
+		}
+	}
+	log, err := ms.Log(context.Background(), "page.md", 0)
+	if err != nil || len(log) != 3 {
+		t.Fatalf("Log = %d entries, %v; want 3", len(log), err)
+	}
+
+	for rev, want := range map[string]string{
+		"HEAD":                 "three\n",
+		"HEAD~1":               "two\n",
+		"HEAD^^":               "one\n",
+		log[1].Revision:        "two\n",
+		log[0].RevisionFull:    "three\n",
+		log[0].Revision + "~2": "one\n",
+	} {
+		if got, err := ms.Load(context.Background(), "page.md", rev); err != nil || got != want {
+			t.Errorf("Load at %q = %q, %v; want %q", rev, got, err, want)
+		}
+	}
+	if _, err := ms.Load(context.Background(), "page.md", "HEAD~3"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Load before the first commit = %v, want ErrNotFound", err)
+	}
+
+	parent, err := ms.GetParentRevision(context.Background(), "page.md", log[0].Revision)
+	if err != nil || parent != log[1].Revision {
+		t.Errorf("GetParentRevision = %q, %v; want %q", parent, err, log[1].Revision)
+	}
+
+	if err := ms.Revert(context.Background(), log[0].Revision, "", author); err != nil {
+		t.Fatalf("Revert: %v", err)
+	}
+	if got, _ := ms.Load(context.Background(), "page.md", ""); got != "two\n" {
+		t.Errorf("after revert = %q, want %q", got, "two\n")
+	}
+	if err := ms.Revert(context.Background(), log[2].Revision, "", author); err == nil {
+		t.Error("reverting the initial commit should fail")
+	}
+
+	if _, err := ms.Load(context.Background(), "../etc/passwd", ""); !errors.Is(err, ErrPathTraversal) {
+		t.Errorf("Load outside the storage = %v, want ErrPathTraversal", err)
+	}
+}
+
+func TestMemoryStorageBundleRestore(t *testing.T) {
+	ms := NewMemoryStorage()
+	author := Author{Name: "Test", Email: "test@example.com"}
+	if err := ms.Bundle(context.Background(), &bytes.Buffer{}); !errors.Is(err, ErrEmptyRepository) {
+		t.Errorf("Bundle of an empty storage = %v, want ErrEmptyRepository", err)
+	}
+	ms.Store(context.Background(), "a.md", "first\n", "Add a", author)
+	ms.Store(context.Background(), "dir/b.md", "second\n", "Add b", author)
+	ms.Delete(context.Background(), "a.md", "", author)
+
+	var buf bytes.Buffer
+	if err := ms.Bundle(context.Background(), &buf); err != nil {
+		t.Fatalf("Bundle: %v", err)
+	}
+	restored, err := RestoreBundle(&buf, t.TempDir())
+	if err != nil {
+		t.Fatalf("RestoreBundle: %v", err)
+	}
+	if got, _ := restored.Load(context.Background(), "dir/b.md", ""); got != "second\n" {
+		t.Errorf("restored dir/b.md = %q", got)
+	}
+	if restored.Exists(context.Background(), "a.md") {
+		t.Error("restored a.md, which was deleted")
+	}
+	if log, _ := restored.Log(context.Background(), "", 0); len(log) != 3 || log[2].Message != "Add a" {
+		t.Errorf("restored history = %v, want the three commits", log)
+	}
+}
@@ -2,7 +2,9 @@
 package storage
 
 import (
+	"context"
 	"errors"
+	"io"
 	"time"
 )
 
@@ -17,6 +19,9 @@ var (
 type Author struct {
 	Name  string
 	Email string
+	// When dates the commit; the zero time means now. Imports set it to
+	// preserve the original edit times.
+	When time.Time
 }
 
 // CommitMetadata holds information about a commit.
@@ -30,81 +35,121 @@ type CommitMetadata struct {
 	Files        []string
 }
 
-// BlameLine represents a single line in a blame output.
+// BlameLine represents a single line in a blame output, attributed to the
+// commit that last changed it.
 type BlameLine struct {
-	Revision   string
-	AuthorName string
-	Datetime   time.Time
-	LineNumber int
-	Line       string
-	Message    string
+	Revision    string
+	AuthorName  string
+	AuthorEmail string
+	Datetime    time.Time
+	LineNumber  int
+	Line        string
+	Message     string // The first line of the commit's message
 }
 
-// Storage defines the interface for wiki content storage.
+// LogQuery filters and paginates repository history. Zero-valued fields do
+// not filter.
+type LogQuery struct {
+	// Author matches a case-insensitive substring of the author name or email.
+	Author string
+	// AuthorEmail matches the author email exactly (case-insensitive).
+	AuthorEmail string
+	// PathPrefix restricts results to commits touching a file under the prefix.
+	PathPrefix string
+	// Path restricts results to commits touching exactly that file.
+	Path string
+	// Since and Until bound the commit time (inclusive).
+	Since time.Time
+	Until time.Time
+	// Offset skips that many matching commits; Limit caps the result count.
+	Offset int
+	Limit  int
+}
+
+// Storage defines the interface for wiki content storage. Methods given a
+// context stop, with its error, once it is done.
 type Storage interface {
 	// Path returns the repository path.
 	Path() string
 
 	// Exists checks if a file exists.
-	Exists(filename string) bool
+	Exists(ctx context.Context, filename string) bool
 
 	// IsDir checks if a path is a directory.
-	IsDir(dirname string) bool
+	IsDir(ctx context.Context, dirname string) bool
 
 	// IsEmptyDir checks if a directory is empty.
-	IsEmptyDir(dirname string) bool
+	IsEmptyDir(ctx context.Context, dirname string) bool
 
 	// Mtime returns the modification time of a file.
-	Mtime(filename string) (time.Time, error)
+	Mtime(ctx context.Context, filename string) (time.Time, error)
 
 	// Size returns the size of a file in bytes.
-	Size(filename string) (int64, error)
+	Size(ctx context.Context, filename string) (int64, error)
 
 	// Load reads a file's content, optionally at a specific revision.
-	Load(filename string, revision string) (string, error)
+	Load(ctx context.Context, filename string, revision string) (string, error)
 
 	// LoadBytes reads a file's content as bytes, optionally at a specific revision.
-	LoadBytes(filename string, revision string) ([]byte, error)
+	LoadBytes(ctx context.Context, filename string, revision string) ([]byte, error)
+
+	// Open opens a file for reading as it is now, without loading it all
+	// into memory where the storage can avoid it.
+	Open(ctx context.Context, filename string) (io.ReadSeekCloser, error)
 
 	// Store writes content to a file and commits it.
-	Store(filename, content, message string, author Author) (bool, error)
+	Store(ctx context.Context, filename, content, message string, author Author) (bool, error)
 
 	// StoreBytes writes binary content to a file and commits it.
-	StoreBytes(filename string, content []byte, message string, author Author) (bool, error)
+	StoreBytes(ctx context.Context, filename string, content []byte, message string, author Author) (bool, error)
+
+	// StoreFiles writes several files and commits them in a single commit.
+	StoreFiles(ctx context.Context, files map[string][]byte, message string, author Author) (bool, error)
 
 	// Delete removes a file or directory.
-	Delete(filename string, message string, author Author) error
+	Delete(ctx context.Context, filename string, message string, author Author) error
 
 	// Rename renames a file.
-	Rename(oldFilename, newFilename, message string, author Author) error
+	Rename(ctx context.Context, oldFilename, newFilename, message string, author Author) error
 
 	// Metadata returns commit metadata for a file.
-	Metadata(filename string, revision string) (*CommitMetadata, error)
+	Metadata(ctx context.Context, filename string, revision string) (*CommitMetadata, error)
 
 	// Log returns the commit history for a file or the entire repository.
-	Log(filename string, maxCount int) ([]CommitMetadata, error)
+	Log(ctx context.Context, filename string, maxCount int) ([]CommitMetadata, error)
+
+	// QueryLog returns repository history matching the query, newest first,
+	// with the changed files of each commit populated.
+	QueryLog(ctx context.Context, query LogQuery) ([]CommitMetadata, error)
 
 	// Blame returns blame information for a file.
-	Blame(filename string, revision string) ([]BlameLine, error)
+	Blame(ctx context.Context, filename string, revision string) ([]BlameLine, error)
 
 	// Diff returns the diff between two revisions.
-	Diff(revA, revB string) (string, error)
+	Diff(ctx context.Context, revA, revB string) (string, error)
 
 	// ShowCommit returns metadata and diff for a specific commit.
-	ShowCommit(revision string) (*CommitMetadata, string, error)
+	ShowCommit(ctx context.Context, revision string) (*CommitMetadata, string, error)
+
+	// FormatPatch returns the history of a file as an mbox patch series,
+	// oldest commit first, with each patch limited to that file.
+	FormatPatch(ctx context.Context, filename string) (string, error)
+
+	// Bundle writes the whole repository as a git bundle.
+	Bundle(ctx context.Context, w io.Writer) error
 
 	// Revert reverts a commit.
-	Revert(revision, message string, author Author) error
+	Revert(ctx context.Context, revision, message string, author Author) error
 
 	// List returns files and directories in a path.
-	List(path string, depth *int, exclude []string) (files, directories []string, err error)
+	List(ctx context.Context, path string, depth *int, exclude []string) (files, directories []string, err error)
 
 	// Commit commits staged files.
-	Commit(filenames []string, message string, author Author) error
+	Commit(ctx context.Context, filenames []string, message string, author Author) error
 
 	// GetParentRevision returns the parent revision for a file.
-	GetParentRevision(filename, revision string) (string, error)
+	GetParentRevision(ctx context.Context, filename, revision string) (string, error)
 
 	// GetFilenameAtRevision returns the filename used at a specific revision.
-	GetFilenameAtRevision(currentFilename, revision string) (string, error)
+	GetFilenameAtRevision(ctx context.Context, currentFilename, revision string) (string, error)
 }
@@ -0,0 +1,295 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// OpStats aggregates the timings of one kind of storage operation.
+type OpStats struct {
+	Count  int64
+	Errors int64
+	Slow   int64 // Operations that took longer than the slow threshold
+	Total  time.Duration
+	Max    time.Duration
+}
+
+// TimedStorage wraps a Storage, timing every operation. Each call is logged
+// at debug level with its operation name, path, revision, and duration, and
+// calls slower than the configured threshold are logged as warnings, which
+// usually means the repository needs a git gc or the disk is slow. Per-
+// operation totals are kept for the metrics endpoint.
+type TimedStorage struct {
+	inner          Storage
+	threshold      time.Duration
+	readTimeout    time.Duration
+	historyTimeout time.Duration
+
+	mu    sync.Mutex
+	stats map[string]*OpStats
+}
+
+// NewTimedStorage wraps inner. Operations taking longer than slow are logged
+// as warnings; a zero threshold disables the warnings.
+func NewTimedStorage(inner Storage, slow time.Duration) *TimedStorage {
+	return &TimedStorage{inner: inner, threshold: slow, stats: make(map[string]*OpStats)}
+}
+
+// SetTimeouts bounds the operations that only read: reading and listing
+// files is given up after read, and walking history (log, blame, diff) after
+// history. A zero duration leaves those operations unbounded. Writes and
+// bundles are never bounded, since giving up on them halfway helps nobody.
+func (t *TimedStorage) SetTimeouts(read, history time.Duration) {
+	t.readTimeout = read
+	t.historyTimeout = history
+}
+
+// bound derives a context from ctx that expires after d, unless d is zero.
+func bound(ctx context.Context, d time.Duration) (context.Context, context.CancelFunc) {
+	if d <= 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, d)
+}
+
+// Stats returns a snapshot of the per-operation timings, keyed by operation.
+func (t *TimedStorage) Stats() map[string]OpStats {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	out := make(map[string]OpStats, len(t.stats))
+	for op, s := range t.stats {
+		out[op] = *s
+	}
+	return out
+}
+
+// observe records the outcome of an operation started at start. attrs are
+// extra slog key/value pairs identifying what it worked on.
+func (t *TimedStorage) observe(op string, start time.Time, err error, attrs ...any) {
+	d := time.Since(start)
+	slow := t.threshold > 0 && d > t.threshold
+
+	t.mu.Lock()
+	s := t.stats[op]
+	if s == nil {
+		s = &OpStats{}
+		t.stats[op] = s
+	}
+	s.Count++
+	s.Total += d
+	if d > s.Max {
+		s.Max = d
+	}
+	if slow {
+		s.Slow++
+	}
+	// A missing file is an answer, not a failure.
+	failed := err != nil && !errors.Is(err, ErrNotFound)
+	if failed {
+		s.Errors++
+	}
+	t.mu.Unlock()
+
+	args := append([]any{"op", op, "duration_ms", d.Milliseconds()}, attrs...)
+	if failed {
+		args = append(args, "error", err)
+	}
+	if slow {
+		slog.Warn("slow git operation", args...)
+	} else {
+		slog.Debug("git operation", args...)
+	}
+}
+
+// Path returns the repository path.
+func (t *TimedStorage) Path() string {
+	return t.inner.Path()
+}
+
+func (t *TimedStorage) Exists(ctx context.Context, filename string) bool {
+	defer t.observe("exists", time.Now(), nil, "path", filename)
+	ctx, cancel := bound(ctx, t.readTimeout)
+	defer cancel()
+	return t.inner.Exists(ctx, filename)
+}
+
+func (t *TimedStorage) IsDir(ctx context.Context, dirname string) bool {
+	defer t.observe("is_dir", time.Now(), nil, "path", dirname)
+	ctx, cancel := bound(ctx, t.readTimeout)
+	defer cancel()
+	return t.inner.IsDir(ctx, dirname)
+}
+
+func (t *TimedStorage) IsEmptyDir(ctx context.Context, dirname string) bool {
+	defer t.observe("is_empty_dir", time.Now(), nil, "path", dirname)
+	ctx, cancel := bound(ctx, t.readTimeout)
+	defer cancel()
+	return t.inner.IsEmptyDir(ctx, dirname)
+}
+
+func (t *TimedStorage) Mtime(ctx context.Context, filename string) (mtime time.Time, err error) {
+	defer func(start time.Time) { t.observe("mtime", start, err, "path", filename) }(time.Now())
+	ctx, cancel := bound(ctx, t.readTimeout)
+	defer cancel()
+	return t.inner.Mtime(ctx, filename)
+}
+
+func (t *TimedStorage) Size(ctx context.Context, filename string) (size int64, err error) {
+	defer func(start time.Time) { t.observe("size", start, err, "path", filename) }(time.Now())
+	ctx, cancel := bound(ctx, t.readTimeout)
+	defer cancel()
+	return t.inner.Size(ctx, filename)
+}
+
+func (t *TimedStorage) Load(ctx context.Context, filename, revision string) (content string, err error) {
+	defer func(start time.Time) {
+		t.observe("load", start, err, "path", filename, "revision", revision)
+	}(time.Now())
+	ctx, cancel := bound(ctx, t.readTimeout)
+	defer cancel()
+	return t.inner.Load(ctx, filename, revision)
+}
+
+func (t *TimedStorage) LoadBytes(ctx context.Context, filename, revision string) (content []byte, err error) {
+	defer func(start time.Time) {
+		t.observe("load", start, err, "path", filename, "revision", revision)
+	}(time.Now())
+	ctx, cancel := bound(ctx, t.readTimeout)
+	defer cancel()
+	return t.inner.LoadBytes(ctx, filename, revision)
+}
+
+func (t *TimedStorage) Open(ctx context.Context, filename string) (f io.ReadSeekCloser, err error) {
+	defer func(start time.Time) { t.observe("open", start, err, "path", filename) }(time.Now())
+	ctx, cancel := bound(ctx, t.readTimeout)
+	defer cancel()
+	return t.inner.Open(ctx, filename)
+}
+
+func (t *TimedStorage) Store(ctx context.Context, filename, content, message string, author Author) (changed bool, err error) {
+	defer func(start time.Time) { t.observe("store", start, err, "path", filename) }(time.Now())
+	return t.inner.Store(ctx, filename, content, message, author)
+}
+
+func (t *TimedStorage) StoreBytes(ctx context.Context, filename string, content []byte, message string, author Author) (changed bool, err error) {
+	defer func(start time.Time) { t.observe("store", start, err, "path", filename) }(time.Now())
+	return t.inner.StoreBytes(ctx, filename, content, message, author)
+}
+
+func (t *TimedStorage) StoreFiles(ctx context.Context, files map[string][]byte, message string, author Author) (changed bool, err error) {
+	defer func(start time.Time) { t.observe("store", start, err, "files", len(files)) }(time.Now())
+	return t.inner.StoreFiles(ctx, files, message, author)
+}
+
+func (t *TimedStorage) Delete(ctx context.Context, filename, message string, author Author) (err error) {
+	defer func(start time.Time) { t.observe("delete", start, err, "path", filename) }(time.Now())
+	return t.inner.Delete(ctx, filename, message, author)
+}
+
+func (t *TimedStorage) Rename(ctx context.Context, oldFilename, newFilename, message string, author Author) (err error) {
+	defer func(start time.Time) {
+		t.observe("rename", start, err, "path", oldFilename, "new_path", newFilename)
+	}(time.Now())
+	return t.inner.Rename(ctx, oldFilename, newFilename, message, author)
+}
+
+func (t *TimedStorage) Metadata(ctx context.Context, filename, revision string) (meta *CommitMetadata, err error) {
+	defer func(start time.Time) {
+		t.observe("metadata", start, err, "path", filename, "revision", revision)
+	}(time.Now())
+	ctx, cancel := bound(ctx, t.readTimeout)
+	defer cancel()
+	return t.inner.Metadata(ctx, filename, revision)
+}
+
+func (t *TimedStorage) Log(ctx context.Context, filename string, maxCount int) (log []CommitMetadata, err error) {
+	defer func(start time.Time) { t.observe("log", start, err, "path", filename) }(time.Now())
+	ctx, cancel := bound(ctx, t.historyTimeout)
+	defer cancel()
+	return t.inner.Log(ctx, filename, maxCount)
+}
+
+func (t *TimedStorage) QueryLog(ctx context.Context, query LogQuery) (log []CommitMetadata, err error) {
+	defer func(start time.Time) { t.observe("query_log", start, err, "path", query.PathPrefix) }(time.Now())
+	ctx, cancel := bound(ctx, t.historyTimeout)
+	defer cancel()
+	return t.inner.QueryLog(ctx, query)
+}
+
+func (t *TimedStorage) Blame(ctx context.Context, filename, revision string) (blame []BlameLine, err error) {
+	defer func(start time.Time) {
+		t.observe("blame", start, err, "path", filename, "revision", revision)
+	}(time.Now())
+	ctx, cancel := bound(ctx, t.historyTimeout)
+	defer cancel()
+	return t.inner.Blame(ctx, filename, revision)
+}
+
+func (t *TimedStorage) Diff(ctx context.Context, revA, revB string) (diff string, err error) {
+	defer func(start time.Time) {
+		t.observe("diff", start, err, "revision", revA, "revision_b", revB)
+	}(time.Now())
+	ctx, cancel := bound(ctx, t.historyTimeout)
+	defer cancel()
+	return t.inner.Diff(ctx, revA, revB)
+}
+
+func (t *TimedStorage) ShowCommit(ctx context.Context, revision string) (meta *CommitMetadata, diff string, err error) {
+	defer func(start time.Time) { t.observe("show_commit", start, err, "revision", revision) }(time.Now())
+	ctx, cancel := bound(ctx, t.historyTimeout)
+	defer cancel()
+	return t.inner.ShowCommit(ctx, revision)
+}
+
+func (t *TimedStorage) FormatPatch(ctx context.Context, filename string) (series string, err error) {
+	defer func(start time.Time) { t.observe("format_patch", start, err, "path", filename) }(time.Now())
+	ctx, cancel := bound(ctx, t.historyTimeout)
+	defer cancel()
+	return t.inner.FormatPatch(ctx, filename)
+}
+
+func (t *TimedStorage) Bundle(ctx context.Context, w io.Writer) (err error) {
+	defer func(start time.Time) { t.observe("bundle", start, err) }(time.Now())
+	return t.inner.Bundle(ctx, w)
+}
+
+func (t *TimedStorage) Revert(ctx context.Context, revision, message string, author Author) (err error) {
+	defer func(start time.Time) { t.observe("revert", start, err, "revision", revision) }(time.Now())
+	return t.inner.Revert(ctx, revision, message, author)
+}
+
+func (t *TimedStorage) List(ctx context.Context, path string, depth *int, exclude []string) (files, directories []string, err error) {
+	defer func(start time.Time) { t.observe("list", start, err, "path", path) }(time.Now())
+	ctx, cancel := bound(ctx, t.readTimeout)
+	defer cancel()
+	return t.inner.List(ctx, path, depth, exclude)
+}
+
+func (t *TimedStorage) Commit(ctx context.Context, filenames []string, message string, author Author) (err error) {
+	defer func(start time.Time) { t.observe("commit", start, err, "files", len(filenames)) }(time.Now())
+	return t.inner.Commit(ctx, filenames, message, author)
+}
+
+func (t *TimedStorage) GetParentRevision(ctx context.Context, filename, revision string) (parent string, err error) {
+	defer func(start time.Time) {
+		t.observe("parent_revision", start, err, "path", filename, "revision", revision)
+	}(time.Now())
+	ctx, cancel := bound(ctx, t.readTimeout)
+	defer cancel()
+	return t.inner.GetParentRevision(ctx, filename, revision)
+}
+
+func (t *TimedStorage) GetFilenameAtRevision(ctx context.Context, currentFilename, revision string) (filename string, err error) {
+	defer func(start time.Time) {
+		t.observe("filename_at_revision", start, err, "path", currentFilename, "revision", revision)
+	}(time.Now())
+	ctx, cancel := bound(ctx, t.readTimeout)
+	defer cancel()
+	return t.inner.GetFilenameAtRevision(ctx, currentFilename, revision)
+}
+
+var _ Storage = (*TimedStorage)(nil)
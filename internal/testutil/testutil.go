@@ -46,6 +46,18 @@ func SetupTestEnv(t *testing.T) *TestEnv {
 	if err != nil {
 		t.Fatalf("failed to create git storage: %v", err)
 	}
+	return setupTestEnv(t, store, tmpDir)
+}
+
+// SetupMemoryTestEnv is SetupTestEnv with a MemoryStorage in place of the
+// git repository, for tests that need nothing on disk. TmpDir is empty.
+func SetupMemoryTestEnv(t *testing.T) *TestEnv {
+	t.Helper()
+	return setupTestEnv(t, storage.NewMemoryStorage(), "")
+}
+
+func setupTestEnv(t *testing.T, store storage.Storage, tmpDir string) *TestEnv {
+	t.Helper()
 
 	// Open in-memory SQLite
 	database, err := db.Open("sqlite:///:memory:")
@@ -63,6 +75,9 @@ func SetupTestEnv(t *testing.T) *TestEnv {
 	cfg := config.Default()
 	cfg.SecretKey = "test-secret-key-1234567890"
 	cfg.Repository = tmpDir
+	if tmpDir == "" {
+		cfg.StorageBackend = "memory"
+	}
 	cfg.ReadAccess = "ANONYMOUS"
 	cfg.WriteAccess = "ANONYMOUS"
 	cfg.AttachmentAccess = "ANONYMOUS"
@@ -75,16 +90,16 @@ func SetupTestEnv(t *testing.T) *TestEnv {
 		t.Fatalf("failed to create server: %v", err)
 	}
 
-	// Load templates from the project's web/templates directory
+	// Set static FS for routes; LoadTemplates hashes it for versioned URLs
 	templatesDir := findTemplatesDir(t)
+	staticDir := filepath.Join(filepath.Dir(templatesDir), "static")
+	srv.StaticFS = os.DirFS(staticDir)
+
+	// Load templates from the project's web/templates directory
 	if err := srv.LoadTemplates(os.DirFS(templatesDir)); err != nil {
 		t.Fatalf("failed to load templates: %v", err)
 	}
 
-	// Set static FS for routes
-	staticDir := filepath.Join(filepath.Dir(templatesDir), "static")
-	srv.StaticFS = os.DirFS(staticDir)
-
 	router := srv.Routes()
 
 	return &TestEnv{
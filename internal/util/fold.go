@@ -0,0 +1,103 @@
+package util
+
+import "strings"
+
+// foldGeneric maps accented Latin letters to their unaccented base letters.
+// Letters that are conventionally written as two letters (ß, æ, œ, þ) expand.
+var foldGeneric = buildFoldTable(map[string]string{
+	"ÀÁÂÃÄÅĀĂĄ": "A", "àáâãäåāăą": "a",
+	"ÇĆĈĊČ": "C", "çćĉċč": "c",
+	"ÐĎĐ": "D", "ðďđ": "d",
+	"ÈÉÊËĒĔĖĘĚ": "E", "èéêëēĕėęě": "e",
+	"ĜĞĠĢ": "G", "ĝğġģ": "g",
+	"ĤĦ": "H", "ĥħ": "h",
+	"ÌÍÎÏĨĪĬĮİ": "I", "ìíîïĩīĭįı": "i",
+	"Ĵ": "J", "ĵ": "j",
+	"Ķ": "K", "ķĸ": "k",
+	"ĹĻĽĿŁ": "L", "ĺļľŀł": "l",
+	"ÑŃŅŇŊ": "N", "ñńņňŉŋ": "n",
+	"ÒÓÔÕÖØŌŎŐ": "O", "òóôõöøōŏő": "o",
+	"ŔŖŘ": "R", "ŕŗř": "r",
+	"ŚŜŞŠ": "S", "śŝşšſ": "s",
+	"ŢŤŦ": "T", "ţťŧ": "t",
+	"ÙÚÛÜŨŪŬŮŰŲ": "U", "ùúûüũūŭůűų": "u",
+	"Ŵ": "W", "ŵ": "w",
+	"ÝŶŸ": "Y", "ýÿŷ": "y",
+	"ŹŻŽ": "Z", "źżž": "z",
+	"Æ": "AE", "æ": "ae",
+	"Œ": "OE", "œ": "oe",
+	"Þ": "TH", "þ": "th",
+	"ß": "ss",
+	"Ĳ": "IJ", "ĳ": "ij",
+})
+
+// foldLocales holds per-language transliterations that take precedence over
+// foldGeneric, e.g. German writes "ü" as "ue" when umlauts are unavailable.
+var foldLocales = map[string]map[rune]string{
+	"de": buildFoldTable(map[string]string{
+		"Ä": "Ae", "Ö": "Oe", "Ü": "Ue", "ä": "ae", "ö": "oe", "ü": "ue",
+	}),
+	"da": foldNordic,
+	"nb": foldNordic,
+	"nn": foldNordic,
+	"no": foldNordic,
+	"sv": buildFoldTable(map[string]string{
+		"Å": "Aa", "Ä": "Ae", "Ö": "Oe", "å": "aa", "ä": "ae", "ö": "oe",
+	}),
+}
+
+var foldNordic = buildFoldTable(map[string]string{
+	"Å": "Aa", "Ø": "Oe", "å": "aa", "ø": "oe",
+})
+
+func buildFoldTable(groups map[string]string) map[rune]string {
+	table := make(map[rune]string)
+	for from, to := range groups {
+		for _, r := range from {
+			table[r] = to
+		}
+	}
+	return table
+}
+
+// FoldSearchText removes diacritics from s so that accented and plain
+// spellings compare equal ("Über" -> "Uber", "Straße" -> "Strasse").
+// Languages with a conventional transliteration expand letters instead:
+// with locale "de", "Über" folds to "Ueber". Region subtags ("de-AT",
+// "de_CH") are ignored and unknown locales get the generic folding.
+// Case is preserved so FTS query operators (AND, OR, NOT) survive.
+func FoldSearchText(s, locale string) string {
+	ascii := true
+	for i := 0; i < len(s); i++ {
+		if s[i] >= 0x80 {
+			ascii = false
+			break
+		}
+	}
+	if ascii {
+		return s
+	}
+
+	lang := strings.ToLower(locale)
+	if i := strings.IndexAny(lang, "-_"); i >= 0 {
+		lang = lang[:i]
+	}
+	localeTable := foldLocales[lang]
+
+	var b strings.Builder
+	b.Grow(len(s))
+	for _, r := range s {
+		// Combining diacritical marks (decomposed input) are dropped.
+		if r >= 0x0300 && r <= 0x036F {
+			continue
+		}
+		if to, ok := localeTable[r]; ok {
+			b.WriteString(to)
+		} else if to, ok := foldGeneric[r]; ok {
+			b.WriteString(to)
+		} else {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
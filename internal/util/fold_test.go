@@ -0,0 +1,37 @@
+package util
+
+import "testing"
+
+func TestFoldSearchText(t *testing.T) {
+	tests := []struct {
+		input  string
+		locale string
+		want   string
+	}{
+		{"plain ascii", "", "plain ascii"},
+		{"Über uns", "", "Uber uns"},
+		{"Über uns", "en", "Uber uns"},
+		{"Über uns", "de", "Ueber uns"},
+		{"Grüße aus Köln", "de-AT", "Gruesse aus Koeln"},
+		{"Straße", "", "Strasse"},
+		{"café crème brûlée", "fr", "cafe creme brulee"},
+		{"Œuvre", "fr", "OEuvre"},
+		{"mañana señor", "es", "manana senor"},
+		{"Ærø Ålborg", "da", "AEroe Aalborg"},
+		{"Ærø Ålborg", "", "AEro Alborg"},
+		{"Göteborg Malmö", "sv_SE", "Goeteborg Malmoe"},
+		{"Łódź Gdańsk", "pl", "Lodz Gdansk"},
+		{"Şişli Iğdır", "tr", "Sisli Igdir"},
+		{"Dvořák", "cs", "Dvorak"},
+		{"cafe\u0301", "", "cafe"}, // decomposed accent
+		{"Über AND Köln", "de", "Ueber AND Koeln"},
+		{"日本語", "ja", "日本語"},
+	}
+
+	for _, tt := range tests {
+		got := FoldSearchText(tt.input, tt.locale)
+		if got != tt.want {
+			t.Errorf("FoldSearchText(%q, %q) = %q, want %q", tt.input, tt.locale, got, tt.want)
+		}
+	}
+}
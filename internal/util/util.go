@@ -87,8 +87,8 @@ func Empty(s string) bool {
 
 // Slugify converts a string to a URL-friendly slug.
 func Slugify(s string, keepSlashes bool) string {
-	// Convert to lowercase
-	s = strings.ToLower(s)
+	// Fold accented letters and convert to lowercase
+	s = strings.ToLower(FoldSearchText(s, ""))
 
 	// Replace spaces with hyphens
 	s = strings.ReplaceAll(s, " ", "-")
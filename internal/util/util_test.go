@@ -39,6 +39,8 @@ func TestSlugify(t *testing.T) {
 		{"path/to/page", true, "path/to/page"},
 		{"path/to/page", false, "pathtopage"},
 		{"UPPERCASE", false, "uppercase"},
+		{"Über uns", false, "uber-uns"},
+		{"Café/Crème", true, "cafe/creme"},
 	}
 
 	for _, tt := range tests {
@@ -0,0 +1,110 @@
+package wiki
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	"github.com/sa/gopherwiki/internal/util"
+)
+
+// PageCompletion is a page offered while typing a link to it.
+type PageCompletion struct {
+	Path  string
+	Title string // First heading of the page, else its name
+}
+
+// Ranks of the ways a page can match a completion query, best first.
+const (
+	rankNamePrefix = iota
+	rankPathPrefix
+	rankTitlePrefix
+	rankWordPrefix
+	rankSubstring
+	rankNone
+)
+
+// completionRank returns how well a page with pagepath and title matches
+// the lowercase query q.
+func completionRank(pagepath, title, q string) int {
+	path := strings.ToLower(pagepath)
+	title = strings.ToLower(title)
+	switch {
+	case strings.HasPrefix(strings.ToLower(util.GetPagename(pagepath, false)), q):
+		return rankNamePrefix
+	case strings.HasPrefix(path, q):
+		return rankPathPrefix
+	case strings.HasPrefix(title, q):
+		return rankTitlePrefix
+	}
+	for _, s := range []string{path, title} {
+		words := strings.FieldsFunc(s, func(r rune) bool { return r == '/' || r == ' ' || r == '-' || r == '_' })
+		for _, w := range words {
+			if strings.HasPrefix(w, q) {
+				return rankWordPrefix
+			}
+		}
+	}
+	if strings.Contains(path, q) || strings.Contains(title, q) {
+		return rankSubstring
+	}
+	return rankNone
+}
+
+// CompletePages returns up to limit pages whose path or title matches
+// query, ignoring case, for completing a link being typed: those whose
+// name starts with it first, then those matching at the start of the path,
+// the title, or a word of either, then anywhere. Pages that match alike
+// are sorted by path length, then path. An empty query returns the most
+// recently updated pages. It reads the page metadata cache, not the
+// repository, so that it is fast enough to call on every keystroke.
+func (ws *WikiService) CompletePages(ctx context.Context, query string, limit int) ([]PageCompletion, error) {
+	pages, err := ws.PageMetadata(ctx)
+	if err != nil {
+		return nil, err
+	}
+	q := strings.ToLower(strings.TrimSpace(query))
+	if q == "" {
+		sort.SliceStable(pages, func(i, j int) bool { return pages[i].Updated.After(pages[j].Updated) })
+	}
+
+	type match struct {
+		completion PageCompletion
+		rank       int
+	}
+	var matches []match
+	for _, m := range pages {
+		rank := rankNamePrefix
+		if q != "" {
+			if rank = completionRank(m.Pagepath, m.Title, q); rank == rankNone {
+				continue
+			}
+		}
+		title := m.Title
+		if title == "" {
+			title = util.GetPagename(m.Pagepath, false)
+		}
+		matches = append(matches, match{PageCompletion{Path: m.Pagepath, Title: title}, rank})
+	}
+	if q != "" {
+		sort.SliceStable(matches, func(i, j int) bool {
+			a, b := matches[i], matches[j]
+			if a.rank != b.rank {
+				return a.rank < b.rank
+			}
+			if len(a.completion.Path) != len(b.completion.Path) {
+				return len(a.completion.Path) < len(b.completion.Path)
+			}
+			return a.completion.Path < b.completion.Path
+		})
+	}
+
+	if limit > 0 && len(matches) > limit {
+		matches = matches[:limit]
+	}
+	result := make([]PageCompletion, len(matches))
+	for i, m := range matches {
+		result[i] = m.completion
+	}
+	return result, nil
+}
@@ -0,0 +1,68 @@
+package wiki
+
+import (
+	"context"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sa/gopherwiki/internal/util"
+)
+
+// DirectoryEntry is a page or subdirectory directly inside a directory.
+// A page with subpages of its own is one entry with both flags set.
+type DirectoryEntry struct {
+	Name        string
+	Path        string    // Page path, e.g. "docs/intro"
+	IsPage      bool      // A page exists at Path
+	IsDirectory bool      // A directory of subpages or attachments exists at Path
+	Modified    time.Time // When the page was last written; zero for a bare directory
+}
+
+// Directory lists the pages and subdirectories directly inside dir, a
+// directory of the repository, sorted by name. Attachments and hidden
+// entries are left out.
+func (ws *WikiService) Directory(ctx context.Context, dir string) ([]DirectoryEntry, error) {
+	depth := 0
+	files, dirs, err := ws.store.List(ctx, dir, &depth, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	byPath := make(map[string]*DirectoryEntry)
+	entry := func(name string) *DirectoryEntry {
+		pagepath := path.Join(dir, name)
+		e, ok := byPath[pagepath]
+		if !ok {
+			e = &DirectoryEntry{Name: util.GetPagename(pagepath, false), Path: pagepath}
+			byPath[pagepath] = e
+		}
+		return e
+	}
+	for _, f := range files {
+		if !util.IsMarkdownFile(f) || strings.HasPrefix(f, ".") {
+			continue
+		}
+		e := entry(util.StripMarkdownExtension(f))
+		e.IsPage = true
+		if mtime, err := ws.store.Mtime(ctx, path.Join(dir, f)); err == nil {
+			e.Modified = mtime
+		}
+	}
+	for _, d := range dirs {
+		if strings.HasPrefix(d, ".") {
+			continue
+		}
+		entry(d).IsDirectory = true
+	}
+
+	entries := make([]DirectoryEntry, 0, len(byPath))
+	for _, e := range byPath {
+		entries = append(entries, *e)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return strings.ToLower(entries[i].Name) < strings.ToLower(entries[j].Name)
+	})
+	return entries, nil
+}
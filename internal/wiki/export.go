@@ -0,0 +1,97 @@
+package wiki
+
+import (
+	"archive/zip"
+	"context"
+	"io"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/sa/gopherwiki/internal/storage"
+	"github.com/sa/gopherwiki/internal/util"
+)
+
+// ExportFiles lists the repository files exported for the subtree at dir: the
+// page at dir itself, if there is one, and every page source and attachment
+// below it. An empty dir exports the whole wiki. Files and directories whose
+// names begin with a dot (.git, .github, .gitignore, ...) are repository
+// plumbing rather than wiki content and are left out. It returns
+// storage.ErrNotFound when the subtree holds no files.
+func (ws *WikiService) ExportFiles(ctx context.Context, dir string) ([]string, error) {
+	dir = strings.Trim(path.Clean("/"+strings.TrimSpace(dir)), "/")
+	if !ws.config.RetainPageNameCase {
+		dir = strings.ToLower(dir)
+	}
+	if hasDotSegment(dir) {
+		return nil, storage.ErrNotFound
+	}
+
+	var files []string
+	if dir != "" {
+		for _, candidate := range util.CandidateFilenames(dir) {
+			if !ws.config.RetainPageNameCase {
+				candidate = strings.ToLower(candidate)
+			}
+			if ws.store.Exists(ctx, candidate) && !ws.store.IsDir(ctx, candidate) {
+				files = append(files, candidate)
+				break
+			}
+		}
+	}
+
+	if dir == "" || ws.store.IsDir(ctx, dir) {
+		below, _, err := ws.store.List(ctx, dir, nil, nil)
+		if err != nil {
+			return nil, err
+		}
+		for _, f := range below {
+			f = path.Join(dir, filepath.ToSlash(f))
+			if !hasDotSegment(f) {
+				files = append(files, f)
+			}
+		}
+	}
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, storage.ErrNotFound
+	}
+	return files, nil
+}
+
+// WriteExportArchive writes the given repository files, as listed by
+// ExportFiles, to w as a ZIP archive laid out like the repository.
+func (ws *WikiService) WriteExportArchive(ctx context.Context, w io.Writer, files []string) error {
+	zw := zip.NewWriter(w)
+	for _, f := range files {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		content, err := ws.store.LoadBytes(ctx, f, "")
+		if err != nil {
+			return err
+		}
+		fw, err := zw.Create(f)
+		if err != nil {
+			return err
+		}
+		if _, err := fw.Write(content); err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
+
+// hasDotSegment reports whether any segment of a slash-separated path begins
+// with a dot.
+func hasDotSegment(p string) bool {
+	for _, part := range util.SplitPath(p) {
+		if strings.HasPrefix(part, ".") {
+			return true
+		}
+	}
+	return false
+}
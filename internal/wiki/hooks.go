@@ -0,0 +1,39 @@
+package wiki
+
+import (
+	"context"
+	"errors"
+
+	"github.com/sa/gopherwiki/internal/storage"
+)
+
+// ErrSaveRejected wraps the error of a save hook that refused a save.
+var ErrSaveRejected = errors.New("save rejected")
+
+// SaveEvent describes a page save to the save hooks.
+type SaveEvent struct {
+	Pagepath string
+	Content  string
+	Message  string
+	Author   storage.Author
+	IsNew    bool
+	// Changed reports whether the save made a commit. It is set for
+	// AfterSave only.
+	Changed bool
+}
+
+// SaveHooks run around every page save. The plugin registry implements
+// them.
+type SaveHooks interface {
+	// BeforeSave may change the event's content and message. An error
+	// refuses the save; SavePage returns it wrapped in ErrSaveRejected.
+	BeforeSave(ctx context.Context, ev *SaveEvent) error
+	// AfterSave is told of each successful save.
+	AfterSave(ctx context.Context, ev SaveEvent)
+}
+
+// SetSaveHooks sets the hooks run around page saves. It must be called
+// before the service saves pages.
+func (ws *WikiService) SetSaveHooks(h SaveHooks) {
+	ws.hooks = h
+}
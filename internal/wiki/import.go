@@ -0,0 +1,262 @@
+package wiki
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"path"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/sa/gopherwiki/internal/storage"
+	"github.com/sa/gopherwiki/internal/util"
+)
+
+// Import limits. An archive is read entirely into memory before anything is
+// committed, so these bound what one import may cost.
+const (
+	MaxImportFiles    = 5000
+	MaxImportFileSize = 32 << 20
+	MaxImportSize     = 256 << 20
+)
+
+// ErrInvalidArchive is returned when an import upload is not a readable ZIP
+// archive or exceeds the import limits.
+var ErrInvalidArchive = errors.New("wiki: invalid import archive")
+
+// Import actions reported for each archive entry.
+const (
+	ImportCreate    = "create"    // new file
+	ImportUpdate    = "update"    // replaces a file with different content
+	ImportUnchanged = "unchanged" // identical to the stored file
+	ImportConflict  = "conflict"  // differs from the stored file, which is kept
+	ImportSkip      = "skip"      // rejected by validation
+)
+
+// ImportOptions control how an archive is imported.
+type ImportOptions struct {
+	// Prefix is the directory the archive is imported into; empty imports
+	// into the root of the wiki.
+	Prefix string
+	// Overwrite replaces existing files whose content differs. Without it
+	// they are reported as conflicts and left alone.
+	Overwrite bool
+	// PerFileCommits commits each file on its own instead of the whole
+	// import in a single commit.
+	PerFileCommits bool
+	// DryRun validates the archive and reports what would happen without
+	// committing anything.
+	DryRun bool
+	// Message is the commit message of a single-commit import.
+	Message string
+}
+
+// ImportEntry is the outcome for one file of an import archive.
+type ImportEntry struct {
+	Name   string `json:"name"`             // name in the archive
+	Path   string `json:"path,omitempty"`   // repository path it maps to
+	Size   int64  `json:"size"`             // uncompressed size
+	Action string `json:"action"`           // one of the Import* actions
+	Reason string `json:"reason,omitempty"` // why an entry was skipped
+	// Revisions is the number of commits a MediaWiki page or file imports.
+	Revisions int `json:"revisions,omitempty"`
+}
+
+// ImportReport summarizes an import, or what a dry run would do.
+type ImportReport struct {
+	DryRun    bool          `json:"dry_run"`
+	Entries   []ImportEntry `json:"entries"`
+	Created   int           `json:"created"`
+	Updated   int           `json:"updated"`
+	Unchanged int           `json:"unchanged"`
+	Conflicts int           `json:"conflicts"`
+	Skipped   int           `json:"skipped"`
+}
+
+// Import adds the Markdown pages and assets of a ZIP archive to the wiki. The
+// archive is laid out like the repository (as produced by the subtree export):
+// "docs/guide.md" becomes the page docs/guide and "docs/guide/chart.png" one
+// of its attachments. Every entry is validated first; entries that are not
+// safe to store are skipped with a reason. Unless opts.DryRun is set, the
+// accepted files are committed, together or one by one, and the imported
+// pages are indexed for search.
+func (ws *WikiService) Import(ctx context.Context, r io.ReaderAt, size int64, opts ImportOptions, author storage.Author) (*ImportReport, error) {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidArchive, err)
+	}
+	if len(zr.File) > MaxImportFiles {
+		return nil, fmt.Errorf("%w: more than %d files", ErrInvalidArchive, MaxImportFiles)
+	}
+
+	prefix, ok := ws.importPath(opts.Prefix, true)
+	if !ok && strings.Trim(opts.Prefix, "/ ") != "" {
+		return nil, fmt.Errorf("%w: invalid target directory %q", ErrInvalidArchive, opts.Prefix)
+	}
+
+	report := &ImportReport{DryRun: opts.DryRun}
+	files := make(map[string][]byte)
+	seen := make(map[string]bool)
+	var order []string
+	var total int64
+	for _, f := range zr.File {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if f.FileInfo().IsDir() {
+			continue
+		}
+		entry := ImportEntry{Name: f.Name, Size: int64(f.UncompressedSize64)}
+		content, reason := ws.readImportEntry(f, prefix, &entry, seen)
+		if reason == "" {
+			total += int64(len(content))
+			if total > MaxImportSize {
+				return nil, fmt.Errorf("%w: more than %d MB uncompressed", ErrInvalidArchive, MaxImportSize>>20)
+			}
+			entry.Action, reason = ws.importAction(ctx, entry.Path, content, opts.Overwrite)
+		}
+		if reason != "" {
+			entry.Action, entry.Reason = ImportSkip, reason
+		}
+
+		if entry.Action == ImportCreate || entry.Action == ImportUpdate {
+			files[entry.Path] = content
+			order = append(order, entry.Path)
+		}
+		report.count(entry)
+	}
+
+	if opts.DryRun || len(files) == 0 {
+		return report, nil
+	}
+
+	if opts.PerFileCommits {
+		for _, p := range order {
+			if _, err := ws.store.StoreBytes(ctx, p, files[p], "Imported "+p, author); err != nil {
+				return nil, fmt.Errorf("import %s: %w", p, err)
+			}
+		}
+	} else {
+		message := opts.Message
+		if message == "" {
+			message = fmt.Sprintf("Imported %d %s", len(files), util.Pluralize(len(files), "files", "file"))
+		}
+		if _, err := ws.store.StoreFiles(ctx, files, message, author); err != nil {
+			return nil, fmt.Errorf("import: %w", err)
+		}
+	}
+
+	for _, p := range order {
+		if !util.IsMarkdownFile(p) {
+			continue
+		}
+		pagepath := util.StripMarkdownExtension(p)
+		if err := ws.IndexPage(ctx, pagepath, string(files[p])); err != nil {
+			slog.Warn("failed to index imported page", "path", pagepath, "error", err)
+		}
+	}
+	ws.InvalidatePageTreeCache()
+
+	return report, nil
+}
+
+// readImportEntry validates one archive file and reads its content, filling
+// in the entry's repository path. It returns the reason the file is skipped,
+// or "" when it is accepted. seen holds the paths of the files accepted so
+// far.
+func (ws *WikiService) readImportEntry(f *zip.File, prefix string, entry *ImportEntry, seen map[string]bool) ([]byte, string) {
+	name, ok := ws.importPath(f.Name, util.IsMarkdownFile(f.Name))
+	if !ok {
+		return nil, "invalid or hidden path"
+	}
+	entry.Path = path.Join(prefix, name)
+	if seen[entry.Path] {
+		return nil, "duplicate of an earlier file"
+	}
+	if f.UncompressedSize64 > MaxImportFileSize {
+		return nil, fmt.Sprintf("larger than %d MB", MaxImportFileSize>>20)
+	}
+
+	rc, err := f.Open()
+	if err != nil {
+		return nil, "unreadable: " + err.Error()
+	}
+	defer rc.Close()
+	content, err := io.ReadAll(io.LimitReader(rc, MaxImportFileSize+1))
+	if err != nil {
+		return nil, "unreadable: " + err.Error()
+	}
+	if len(content) > MaxImportFileSize {
+		return nil, fmt.Sprintf("larger than %d MB", MaxImportFileSize>>20)
+	}
+	if util.IsMarkdownFile(name) && !utf8.Valid(content) {
+		return nil, "page is not valid UTF-8 text"
+	}
+	seen[entry.Path] = true
+	return content, ""
+}
+
+// importAction decides what importing content at p does, given what is
+// stored there now. A non-empty reason means the file cannot be imported.
+func (ws *WikiService) importAction(ctx context.Context, p string, content []byte, overwrite bool) (action, reason string) {
+	if ws.store.IsDir(ctx, p) {
+		return "", "a directory exists at this path"
+	}
+	if !ws.store.Exists(ctx, p) {
+		return ImportCreate, ""
+	}
+	current, err := ws.store.LoadBytes(ctx, p, "")
+	if err != nil {
+		return "", "existing file is unreadable"
+	}
+	switch {
+	case bytes.Equal(current, content):
+		return ImportUnchanged, ""
+	case overwrite:
+		return ImportUpdate, ""
+	default:
+		return ImportConflict, ""
+	}
+}
+
+// importPath normalizes a slash-separated archive path into a repository
+// path. Directory names are lowercased like page paths unless
+// RetainPageNameCase is set, and so are page filenames (isPage); attachment
+// filenames keep their case, as they do on upload (pass isPage for a
+// directory path to lowercase it whole). Paths that are empty,
+// absolute, escape the root, or contain a segment beginning with a dot are
+// rejected.
+func (ws *WikiService) importPath(name string, isPage bool) (string, bool) {
+	name = strings.ReplaceAll(strings.TrimSpace(name), `\`, "/")
+	if name == "" || strings.HasPrefix(name, "/") || strings.ContainsRune(name, 0) {
+		return "", false
+	}
+	parts := strings.Split(name, "/")
+	var clean []string
+	for _, part := range parts {
+		switch {
+		case part == "":
+			continue
+		case strings.HasPrefix(part, "."):
+			// Covers "..", ".git", and other hidden files.
+			return "", false
+		}
+		clean = append(clean, part)
+	}
+	if len(clean) == 0 {
+		return "", false
+	}
+	if !ws.config.RetainPageNameCase {
+		last := len(clean) - 1
+		for i := range clean {
+			if i < last || isPage {
+				clean[i] = strings.ToLower(clean[i])
+			}
+		}
+	}
+	return strings.Join(clean, "/"), true
+}
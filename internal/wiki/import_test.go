@@ -0,0 +1,146 @@
+package wiki
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/sa/gopherwiki/internal/storage"
+)
+
+// buildZip returns a ZIP archive holding the given files, in order.
+func buildZip(t *testing.T, files [][2]string) *bytes.Reader {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, f := range files {
+		w, err := zw.Create(f[0])
+		if err != nil {
+			t.Fatalf("zip create %s: %v", f[0], err)
+		}
+		w.Write([]byte(f[1]))
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("zip close: %v", err)
+	}
+	return bytes.NewReader(buf.Bytes())
+}
+
+func TestImport(t *testing.T) {
+	ws, cleanup := setupTestService(t)
+	defer cleanup()
+	ctx := context.Background()
+	author := storage.Author{Name: "Importer", Email: "import@example.com"}
+
+	archive := buildZip(t, [][2]string{
+		{"Docs/Guide.md", "# Guide\n\nImported guide.\n"},
+		{"Docs/Guide/Chart.png", "PNG"},
+		{"home.md", "# Home\nWelcome to the wiki.\n"},
+		{"about.md", "# About\nChanged.\n"},
+		{"../escape.md", "x"},
+		{".git/config", "x"},
+		{"bad.md", "\xff\xfe"},
+		{"docs/guide.md", "# Duplicate\n"},
+	})
+
+	dry, err := ws.Import(ctx, archive, archive.Size(), ImportOptions{DryRun: true}, author)
+	if err != nil {
+		t.Fatalf("dry run: %v", err)
+	}
+	want := map[string]string{
+		"Docs/Guide.md":        ImportCreate,
+		"Docs/Guide/Chart.png": ImportCreate,
+		"home.md":              ImportUnchanged,
+		"about.md":             ImportConflict,
+		"../escape.md":         ImportSkip,
+		".git/config":          ImportSkip,
+		"bad.md":               ImportSkip,
+		"docs/guide.md":        ImportSkip,
+	}
+	for _, e := range dry.Entries {
+		if want[e.Name] != e.Action {
+			t.Errorf("%s: action = %q (%s), want %q", e.Name, e.Action, e.Reason, want[e.Name])
+		}
+	}
+	if dry.Created != 2 || dry.Unchanged != 1 || dry.Conflicts != 1 || dry.Skipped != 4 {
+		t.Errorf("dry run report = %+v", dry)
+	}
+	if ws.store.Exists(ctx, "docs/guide.md") {
+		t.Fatal("dry run should not store anything")
+	}
+
+	before, _ := ws.store.Log(ctx, "", 0)
+	report, err := ws.Import(ctx, archive, archive.Size(), ImportOptions{Message: "Bulk import"}, author)
+	if err != nil {
+		t.Fatalf("import: %v", err)
+	}
+	if report.Created != 2 {
+		t.Errorf("report = %+v", report)
+	}
+	after, _ := ws.store.Log(ctx, "", 0)
+	if len(after) != len(before)+1 || after[0].Message != "Bulk import" {
+		t.Errorf("import should be one commit, log = %+v", after[:len(after)-len(before)])
+	}
+	// Directories and page names are lowercased; attachment names keep case.
+	if content, _ := ws.store.Load(ctx, "docs/guide.md", ""); content != "# Guide\n\nImported guide.\n" {
+		t.Errorf("docs/guide.md = %q", content)
+	}
+	if !ws.store.Exists(ctx, "docs/guide/Chart.png") {
+		t.Error("attachment should be stored at docs/guide/Chart.png")
+	}
+	if about, _ := ws.store.Load(ctx, "about.md", ""); about != "# About\nThis is the about page.\n" {
+		t.Errorf("conflicting file should be kept, got %q", about)
+	}
+	if results, _ := ws.Search(ctx, "Imported"); len(results) == 0 {
+		t.Error("imported page should be indexed for search")
+	}
+}
+
+func TestImportOverwritePerFile(t *testing.T) {
+	ws, cleanup := setupTestService(t)
+	defer cleanup()
+	ctx := context.Background()
+	author := storage.Author{Name: "Importer", Email: "import@example.com"}
+
+	archive := buildZip(t, [][2]string{
+		{"about.md", "# About\nChanged.\n"},
+		{"new.md", "# New\n"},
+	})
+	before, _ := ws.store.Log(ctx, "", 0)
+	report, err := ws.Import(ctx, archive, archive.Size(), ImportOptions{Prefix: "Imported", Overwrite: true, PerFileCommits: true}, author)
+	if err != nil {
+		t.Fatalf("import: %v", err)
+	}
+	if report.Created != 2 {
+		t.Errorf("report = %+v, want both created under the prefix", report)
+	}
+	after, _ := ws.store.Log(ctx, "", 0)
+	if len(after) != len(before)+2 {
+		t.Errorf("per-file import made %d commits, want 2", len(after)-len(before))
+	}
+
+	archive = buildZip(t, [][2]string{{"about.md", "# About\nChanged.\n"}})
+	report, err = ws.Import(ctx, archive, archive.Size(), ImportOptions{Overwrite: true}, author)
+	if err != nil || report.Updated != 1 {
+		t.Fatalf("overwrite import = %+v, %v", report, err)
+	}
+	if about, _ := ws.store.Load(ctx, "about.md", ""); about != "# About\nChanged.\n" {
+		t.Errorf("about.md = %q, want it overwritten", about)
+	}
+}
+
+func TestImportInvalidArchive(t *testing.T) {
+	ws, cleanup := setupTestService(t)
+	defer cleanup()
+
+	notZip := bytes.NewReader([]byte("not a zip"))
+	if _, err := ws.Import(context.Background(), notZip, notZip.Size(), ImportOptions{}, storage.Author{}); !errors.Is(err, ErrInvalidArchive) {
+		t.Errorf("err = %v, want ErrInvalidArchive", err)
+	}
+	archive := buildZip(t, [][2]string{{"a.md", "# A"}})
+	if _, err := ws.Import(context.Background(), archive, archive.Size(), ImportOptions{Prefix: "../up"}, storage.Author{}); !errors.Is(err, ErrInvalidArchive) {
+		t.Errorf("err = %v, want ErrInvalidArchive for a bad prefix", err)
+	}
+}
@@ -0,0 +1,331 @@
+package wiki
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sa/gopherwiki/internal/mediawiki"
+	"github.com/sa/gopherwiki/internal/storage"
+	"github.com/sa/gopherwiki/internal/util"
+)
+
+// MediaWikiOptions control how a MediaWiki dump is imported.
+type MediaWikiOptions struct {
+	// Prefix is the directory the wiki is imported into; empty imports into
+	// the root of the wiki.
+	Prefix string
+	// Overwrite replaces existing files whose content differs. Without it
+	// they are reported as conflicts and left alone.
+	Overwrite bool
+	// LatestOnly imports the current revision of each page in a single
+	// commit instead of replaying the page histories.
+	LatestOnly bool
+	// DryRun converts the dump and reports what would happen without
+	// committing anything.
+	DryRun bool
+}
+
+// mediaWikiEdit is one revision or upload to be committed.
+type mediaWikiEdit struct {
+	path    string
+	content []byte
+	when    time.Time
+	author  storage.Author
+	message string
+}
+
+// mediaWikiFile is an upload together with the page whose attachments it
+// joins.
+type mediaWikiFile struct {
+	page   *mediawiki.Page
+	upload *mediawiki.Upload
+	path   string
+}
+
+// ImportMediaWiki imports a MediaWiki XML dump, as written by Special:Export
+// or dumpBackup.php. Content pages become Markdown pages, converted from
+// wikitext on a best-effort basis; pages outside the main namespace go into
+// a directory named after their namespace ("Help:Contents" becomes
+// Help/Contents). Talk, MediaWiki and file description pages are skipped.
+// Uploaded files, when the dump includes them, become attachments of the
+// first page that uses them, or of the File directory otherwise.
+//
+// Each revision is committed as it was made, under its original author and
+// timestamp, so the history of the import mirrors the history of the source
+// wiki; with opts.LatestOnly only the current text is imported, in a single
+// commit by author. The report has one entry per page and file.
+func (ws *WikiService) ImportMediaWiki(ctx context.Context, r io.Reader, opts MediaWikiOptions, author storage.Author) (*ImportReport, error) {
+	dump, err := mediawiki.Parse(r)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidArchive, err)
+	}
+	if len(dump.Pages) > MaxImportFiles {
+		return nil, fmt.Errorf("%w: more than %d pages", ErrInvalidArchive, MaxImportFiles)
+	}
+	prefix, ok := ws.importPath(opts.Prefix, true)
+	if !ok && strings.Trim(opts.Prefix, "/ ") != "" {
+		return nil, fmt.Errorf("%w: invalid target directory %q", ErrInvalidArchive, opts.Prefix)
+	}
+
+	pagePath := func(title string) string {
+		return path.Join(prefix, ws.mediaWikiPath(dump, title))
+	}
+
+	// Place each uploaded file with the first page that uses it.
+	files := make(map[string]*mediaWikiFile)
+	var fileOrder []string
+	for i := range dump.Pages {
+		page := &dump.Pages[i]
+		if page.Namespace != mediawiki.NamespaceFile || len(page.Uploads) == 0 {
+			continue
+		}
+		_, name := dump.SplitTitle(page.Title)
+		files[name] = &mediaWikiFile{page: page, upload: &page.Uploads[len(page.Uploads)-1]}
+		fileOrder = append(fileOrder, name)
+	}
+	owners := make(map[string]string)
+	conv := mediawiki.NewConverter(dump, pagePath, nil)
+	for i := range dump.Pages {
+		page := &dump.Pages[i]
+		if mediaWikiSkip(page) != "" || len(page.Revisions) == 0 {
+			continue
+		}
+		for _, name := range conv.Files(page.Revisions[len(page.Revisions)-1].Text) {
+			if _, ok := owners[name]; !ok {
+				owners[name] = pagePath(page.Title)
+			}
+		}
+	}
+	for _, name := range fileOrder {
+		dir, ok := owners[name]
+		if !ok {
+			dir = path.Join(prefix, "file")
+			if ws.config.RetainPageNameCase {
+				dir = path.Join(prefix, "File")
+			}
+		}
+		if p, ok := ws.importPath(path.Join(dir, strings.ReplaceAll(name, " ", "_")), false); ok {
+			files[name].path = p
+		}
+	}
+	conv = mediawiki.NewConverter(dump, pagePath, func(name string) string {
+		if f, ok := files[name]; ok && f.path != "" && f.upload.Contents != nil {
+			return mediawiki.PageURL(f.path)
+		}
+		return ""
+	})
+
+	report := &ImportReport{DryRun: opts.DryRun}
+	seen := make(map[string]bool)
+	var edits []mediaWikiEdit
+	var imported []string
+	final := make(map[string][]byte)
+	record := func(entry ImportEntry, versions []mediaWikiEdit) {
+		if entry.Reason == "" && seen[entry.Path] {
+			entry.Reason = "duplicate of an earlier page"
+		}
+		if entry.Reason == "" {
+			seen[entry.Path] = true
+			content := versions[len(versions)-1].content
+			entry.Size = int64(len(content))
+			entry.Action, entry.Reason = ws.importAction(ctx, entry.Path, content, opts.Overwrite)
+			if entry.Action == ImportCreate || entry.Action == ImportUpdate {
+				if opts.LatestOnly {
+					versions = versions[len(versions)-1:]
+				}
+				entry.Revisions = len(versions)
+				edits = append(edits, versions...)
+				final[entry.Path] = content
+				imported = append(imported, entry.Path)
+			}
+		}
+		if entry.Reason != "" {
+			entry.Action, entry.Path = ImportSkip, ""
+		}
+		report.count(entry)
+	}
+
+	for i := range dump.Pages {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		page := &dump.Pages[i]
+		entry := ImportEntry{Name: page.Title}
+		if reason := mediaWikiSkip(page); reason != "" {
+			entry.Reason = reason
+			record(entry, nil)
+			continue
+		}
+		if len(page.Revisions) == 0 {
+			entry.Reason = "no revisions"
+			record(entry, nil)
+			continue
+		}
+		p, ok := ws.importPath(pagePath(page.Title)+".md", true)
+		if !ok {
+			entry.Reason = "invalid or hidden path"
+			record(entry, nil)
+			continue
+		}
+		entry.Path = p
+
+		var versions []mediaWikiEdit
+		revisions := page.Revisions
+		if opts.LatestOnly {
+			revisions = revisions[len(revisions)-1:]
+		}
+		for n, rev := range revisions {
+			message := rev.Comment
+			if message == "" {
+				message = fmt.Sprintf("Imported revision %d of %s", n+1, page.Title)
+			}
+			versions = append(versions, mediaWikiEdit{
+				path:    p,
+				content: []byte(conv.Markdown(rev.Text)),
+				when:    rev.Timestamp,
+				author:  mediaWikiAuthor(rev.Contributor, author),
+				message: message,
+			})
+		}
+		record(entry, versions)
+	}
+
+	for _, name := range fileOrder {
+		f := files[name]
+		entry := ImportEntry{Name: f.page.Title, Path: f.path}
+		if f.path == "" {
+			entry.Reason = "invalid or hidden path"
+			record(entry, nil)
+			continue
+		}
+		var versions []mediaWikiEdit
+		for _, up := range f.page.Uploads {
+			if up.Contents == nil {
+				continue
+			}
+			if len(up.Contents) > MaxImportFileSize {
+				entry.Reason = fmt.Sprintf("larger than %d MB", MaxImportFileSize>>20)
+				break
+			}
+			message := up.Comment
+			if message == "" {
+				message = "Imported " + f.page.Title
+			}
+			versions = append(versions, mediaWikiEdit{
+				path:    f.path,
+				content: up.Contents,
+				when:    up.Timestamp,
+				author:  mediaWikiAuthor(up.Contributor, author),
+				message: message,
+			})
+		}
+		if entry.Reason == "" && len(versions) == 0 {
+			entry.Reason = "the dump does not include the file"
+		}
+		record(entry, versions)
+	}
+
+	if opts.DryRun || len(edits) == 0 {
+		return report, nil
+	}
+
+	if opts.LatestOnly {
+		message := fmt.Sprintf("Imported %d %s from MediaWiki", len(final), util.Pluralize(len(final), "files", "file"))
+		if _, err := ws.store.StoreFiles(ctx, final, message, author); err != nil {
+			return nil, fmt.Errorf("import: %w", err)
+		}
+	} else {
+		sort.SliceStable(edits, func(i, j int) bool { return edits[i].when.Before(edits[j].when) })
+		for _, e := range edits {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+			a := e.author
+			a.When = e.when
+			if _, err := ws.store.StoreFiles(ctx, map[string][]byte{e.path: e.content}, e.message, a); err != nil {
+				return nil, fmt.Errorf("import %s: %w", e.path, err)
+			}
+		}
+	}
+
+	for _, p := range imported {
+		if !util.IsMarkdownFile(p) {
+			continue
+		}
+		pagepath := util.StripMarkdownExtension(p)
+		if err := ws.IndexPage(ctx, pagepath, string(final[p])); err != nil {
+			slog.Warn("failed to index imported page", "path", pagepath, "error", err)
+		}
+	}
+	ws.InvalidatePageTreeCache()
+
+	return report, nil
+}
+
+// count adds an entry to the report.
+func (report *ImportReport) count(entry ImportEntry) {
+	switch entry.Action {
+	case ImportCreate:
+		report.Created++
+	case ImportUpdate:
+		report.Updated++
+	case ImportUnchanged:
+		report.Unchanged++
+	case ImportConflict:
+		report.Conflicts++
+	case ImportSkip:
+		report.Skipped++
+	}
+	report.Entries = append(report.Entries, entry)
+}
+
+// mediaWikiSkip returns why a page of the dump is not imported as a page, or
+// "" when it is.
+func mediaWikiSkip(page *mediawiki.Page) string {
+	switch ns := page.Namespace; {
+	case ns < 0:
+		return "special page"
+	case ns%2 == 1:
+		return "talk page"
+	case ns == mediawiki.NamespaceMediaWiki:
+		return "interface message"
+	case ns == mediawiki.NamespaceFile:
+		return "file description page"
+	}
+	return ""
+}
+
+// mediaWikiPath maps a MediaWiki title to a page path, before the import
+// prefix and case rules: the namespace becomes a directory, subpages stay
+// subpages, and spaces become hyphens.
+func (ws *WikiService) mediaWikiPath(dump *mediawiki.Dump, title string) string {
+	ns, name := dump.SplitTitle(title)
+	name = strings.NewReplacer(" ", "-", "?", "-", "#", "-", "%", "-", `\`, "-").Replace(name)
+	p := strings.Trim(name, "/")
+	if local := dump.Namespace(ns); ns != mediawiki.NamespaceMain && local != "" {
+		p = strings.ReplaceAll(local, " ", "-") + "/" + p
+	}
+	if !ws.config.RetainPageNameCase {
+		p = strings.ToLower(p)
+	}
+	return p
+}
+
+// mediaWikiAuthor turns a contributor into a commit author. Anonymous edits
+// are credited to their IP address; contributors the dump suppresses are
+// credited to the importing user.
+func mediaWikiAuthor(c mediawiki.Contributor, fallback storage.Author) storage.Author {
+	switch {
+	case c.Username != "":
+		return storage.Author{Name: c.Username, Email: strings.ReplaceAll(c.Username, " ", "_") + "@mediawiki.invalid"}
+	case c.IP != "":
+		return storage.Author{Name: "Anonymous (" + c.IP + ")", Email: "anonymous@mediawiki.invalid"}
+	}
+	return fallback
+}
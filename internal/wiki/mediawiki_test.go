@@ -0,0 +1,177 @@
+package wiki
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sa/gopherwiki/internal/storage"
+)
+
+const testMediaWikiDump = `<mediawiki xmlns="http://www.mediawiki.org/xml/export-0.11/" version="0.11">
+  <siteinfo>
+    <sitename>Test Wiki</sitename>
+    <case>first-letter</case>
+    <namespaces>
+      <namespace key="0" />
+      <namespace key="1">Talk</namespace>
+      <namespace key="6">File</namespace>
+      <namespace key="12">Help</namespace>
+    </namespaces>
+  </siteinfo>
+  <page>
+    <title>Main Page</title>
+    <ns>0</ns>
+    <revision>
+      <timestamp>2020-01-02T03:04:05Z</timestamp>
+      <contributor><username>Alice</username></contributor>
+      <comment>Created page</comment>
+      <text>Hello '''world'''.</text>
+    </revision>
+    <revision>
+      <timestamp>2020-02-03T04:05:06Z</timestamp>
+      <contributor><ip>192.0.2.1</ip></contributor>
+      <text>Hello [[File:Logo.png|Logo]], see [[Help:Contents]].</text>
+    </revision>
+  </page>
+  <page>
+    <title>Help:Contents</title>
+    <ns>12</ns>
+    <revision>
+      <timestamp>2020-01-04T00:00:00Z</timestamp>
+      <contributor><username>Bob</username></contributor>
+      <text>== Help ==</text>
+    </revision>
+  </page>
+  <page>
+    <title>Talk:Main Page</title>
+    <ns>1</ns>
+    <revision>
+      <timestamp>2020-01-05T00:00:00Z</timestamp>
+      <text>Discussion.</text>
+    </revision>
+  </page>
+  <page>
+    <title>File:Logo.png</title>
+    <ns>6</ns>
+    <revision>
+      <timestamp>2020-01-03T00:00:00Z</timestamp>
+      <text>The logo.</text>
+    </revision>
+    <upload>
+      <timestamp>2020-01-03T00:00:00Z</timestamp>
+      <contributor><username>Bob</username></contributor>
+      <comment>Logo upload</comment>
+      <filename>Logo.png</filename>
+      <contents encoding="base64">UE5H</contents>
+    </upload>
+  </page>
+</mediawiki>`
+
+func TestImportMediaWiki(t *testing.T) {
+	ws, cleanup := setupTestService(t)
+	defer cleanup()
+	ctx := context.Background()
+	author := storage.Author{Name: "Importer", Email: "import@example.com"}
+
+	dry, err := ws.ImportMediaWiki(ctx, strings.NewReader(testMediaWikiDump), MediaWikiOptions{DryRun: true}, author)
+	if err != nil {
+		t.Fatalf("dry run: %v", err)
+	}
+	if dry.Created != 3 || dry.Skipped != 2 {
+		t.Errorf("dry run created %d, skipped %d; want 3 and 2", dry.Created, dry.Skipped)
+	}
+	if ws.store.Exists(ctx, "main-page.md") {
+		t.Fatal("dry run committed files")
+	}
+
+	report, err := ws.ImportMediaWiki(ctx, strings.NewReader(testMediaWikiDump), MediaWikiOptions{}, author)
+	if err != nil {
+		t.Fatalf("ImportMediaWiki: %v", err)
+	}
+	entries := make(map[string]ImportEntry)
+	for _, e := range report.Entries {
+		entries[e.Name] = e
+	}
+	if e := entries["Main Page"]; e.Path != "main-page.md" || e.Action != ImportCreate || e.Revisions != 2 {
+		t.Errorf("Main Page entry = %+v", e)
+	}
+	if e := entries["Help:Contents"]; e.Path != "help/contents.md" {
+		t.Errorf("Help:Contents entry = %+v", e)
+	}
+	if e := entries["Talk:Main Page"]; e.Action != ImportSkip || e.Reason != "talk page" {
+		t.Errorf("talk page entry = %+v", e)
+	}
+	if e := entries["File:Logo.png"]; e.Path != "main-page/Logo.png" || e.Action != ImportCreate {
+		t.Errorf("file entry = %+v", e)
+	}
+
+	content, err := ws.store.Load(ctx, "main-page.md", "")
+	if err != nil {
+		t.Fatalf("load page: %v", err)
+	}
+	if want := "Hello ![Logo](/main-page/Logo.png), see [[help/contents|Help:Contents]].\n"; content != want {
+		t.Errorf("page content = %q, want %q", content, want)
+	}
+	if data, _ := ws.store.LoadBytes(ctx, "main-page/Logo.png", ""); string(data) != "PNG" {
+		t.Errorf("attachment = %q, want PNG", data)
+	}
+
+	// The page history replays the original revisions.
+	log, err := ws.store.Log(ctx, "main-page.md", 0)
+	if err != nil {
+		t.Fatalf("log: %v", err)
+	}
+	if len(log) != 2 {
+		t.Fatalf("got %d commits, want 2", len(log))
+	}
+	first, second := log[1], log[0]
+	if first.AuthorName != "Alice" || first.Message != "Created page" || !first.Datetime.Equal(time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)) {
+		t.Errorf("first commit = %+v", first)
+	}
+	if second.AuthorName != "Anonymous (192.0.2.1)" || second.Message != "Imported revision 2 of Main Page" {
+		t.Errorf("second commit = %+v", second)
+	}
+
+	// Importing again changes nothing.
+	again, err := ws.ImportMediaWiki(ctx, strings.NewReader(testMediaWikiDump), MediaWikiOptions{}, author)
+	if err != nil {
+		t.Fatalf("reimport: %v", err)
+	}
+	if again.Unchanged != 3 || again.Created != 0 {
+		t.Errorf("reimport unchanged %d, created %d; want 3 and 0", again.Unchanged, again.Created)
+	}
+}
+
+func TestImportMediaWikiLatestOnly(t *testing.T) {
+	ws, cleanup := setupTestService(t)
+	defer cleanup()
+	author := storage.Author{Name: "Importer", Email: "import@example.com"}
+
+	report, err := ws.ImportMediaWiki(context.Background(), strings.NewReader(testMediaWikiDump), MediaWikiOptions{Prefix: "Old Wiki", LatestOnly: true}, author)
+	if err != nil {
+		t.Fatalf("ImportMediaWiki: %v", err)
+	}
+	if report.Created != 3 {
+		t.Errorf("created %d, want 3", report.Created)
+	}
+	log, err := ws.store.Log(context.Background(), "old wiki/main-page.md", 0)
+	if err != nil {
+		t.Fatalf("log: %v", err)
+	}
+	if len(log) != 1 || log[0].AuthorName != "Importer" {
+		t.Errorf("log = %+v, want one commit by the importer", log)
+	}
+}
+
+func TestImportMediaWikiInvalid(t *testing.T) {
+	ws, cleanup := setupTestService(t)
+	defer cleanup()
+
+	_, err := ws.ImportMediaWiki(context.Background(), strings.NewReader("<html></html>"), MediaWikiOptions{}, storage.Author{Name: "Importer"})
+	if !errors.Is(err, ErrInvalidArchive) {
+		t.Errorf("error = %v, want ErrInvalidArchive", err)
+	}
+}
@@ -2,6 +2,7 @@
 package wiki
 
 import (
+	"context"
 	"html"
 	"log/slog"
 	"strings"
@@ -44,7 +45,7 @@ type Page struct {
 // an existing file, checking the recognized extensions (.md then .qmd) in
 // priority order, and falls back to the default extension for a page that does
 // not yet exist. Case is normalized unless RetainPageNameCase is set.
-func resolveFilename(store storage.Storage, cfg *config.Config, pagepath string) string {
+func resolveFilename(ctx context.Context, store storage.Storage, cfg *config.Config, pagepath string) string {
 	normalize := func(name string) string {
 		if !cfg.RetainPageNameCase {
 			return strings.ToLower(name)
@@ -54,7 +55,7 @@ func resolveFilename(store storage.Storage, cfg *config.Config, pagepath string)
 
 	for _, candidate := range util.CandidateFilenames(pagepath) {
 		candidate = normalize(candidate)
-		if store.Exists(candidate) {
+		if store.Exists(ctx, candidate) {
 			return candidate
 		}
 	}
@@ -63,14 +64,14 @@ func resolveFilename(store storage.Storage, cfg *config.Config, pagepath string)
 }
 
 // NewPage creates a new Page object.
-func NewPage(store storage.Storage, cfg *config.Config, pagepath string, revision string) (*Page, error) {
+func NewPage(ctx context.Context, store storage.Storage, cfg *config.Config, pagepath string, revision string) (*Page, error) {
 	pagepath = util.SanitizePagename(pagepath, true)
 	pagename := util.GetPagename(pagepath, false)
 	pagenameFull := util.GetPagename(pagepath, true)
 
 	// Resolve the backing file, which may be plain markdown (.md) or a Quarto
 	// computational page (.qmd).
-	filename := resolveFilename(store, cfg, pagepath)
+	filename := resolveFilename(ctx, store, cfg, pagepath)
 
 	p := &Page{
 		Pagepath:              pagepath,
@@ -86,7 +87,7 @@ func NewPage(store storage.Storage, cfg *config.Config, pagepath string, revisio
 	}
 
 	// Load content and metadata
-	if err := p.load(); err != nil {
+	if err := p.load(ctx); err != nil {
 		if err == storage.ErrNotFound {
 			p.Exists = false
 		} else {
@@ -118,14 +119,14 @@ func NewPage(store storage.Storage, cfg *config.Config, pagepath string, revisio
 }
 
 // load loads the page content and metadata from storage.
-func (p *Page) load() error {
-	content, err := p.store.Load(p.Filename, p.Revision)
+func (p *Page) load(ctx context.Context) error {
+	content, err := p.store.Load(ctx, p.Filename, p.Revision)
 	if err != nil {
 		return err
 	}
 	p.Content = content
 
-	metadata, err := p.store.Metadata(p.Filename, p.Revision)
+	metadata, err := p.store.Metadata(ctx, p.Filename, p.Revision)
 	if err != nil {
 		// Page exists but not in git (e.g., untracked file)
 		return nil
@@ -148,13 +149,26 @@ func (p *Page) Breadcrumbs() []util.Breadcrumb {
 // "render pending" placeholder rather than executing code on a page view. See
 // docs/computational-pages.md.
 func (p *Page) Render(r *renderer.Renderer) (string, []renderer.TOCEntry, renderer.LibraryRequirements) {
+	return p.RenderFor(r, nil)
+}
+
+// RenderFor is Render for a viewer who may read only the pages canRead
+// accepts; see renderer.RenderFor.
+func (p *Page) RenderFor(r *renderer.Renderer, canRead func(pagepath string) bool) (string, []renderer.TOCEntry, renderer.LibraryRequirements) {
+	content, toc, requirements, _ := p.RenderEmbeds(r, canRead)
+	return content, toc, requirements
+}
+
+// RenderEmbeds is RenderFor that also returns the paths of the pages
+// rendered in place by the page's embeds.
+func (p *Page) RenderEmbeds(r *renderer.Renderer, canRead func(pagepath string) bool) (string, []renderer.TOCEntry, renderer.LibraryRequirements, []string) {
 	if p.IsComputational {
-		return renderPendingPlaceholder(p.Pagename), nil, renderer.LibraryRequirements{}
+		return renderPendingPlaceholder(p.Pagename), nil, renderer.LibraryRequirements{}, nil
 	}
 	if p.Body == "" {
-		return "", nil, renderer.LibraryRequirements{}
+		return "", nil, renderer.LibraryRequirements{}, nil
 	}
-	return r.Render(p.Body, p.PageViewURL)
+	return r.RenderEmbeds(p.Body, p.PageViewURL, canRead)
 }
 
 // renderPendingPlaceholder is the HTML shown for a computational page that has
@@ -168,8 +182,8 @@ func renderPendingPlaceholder(pagename string) string {
 }
 
 // Save saves the page content.
-func (p *Page) Save(content, message string, author storage.Author) (bool, error) {
-	changed, err := p.store.Store(p.Filename, content, message, author)
+func (p *Page) Save(ctx context.Context, content, message string, author storage.Author) (bool, error) {
+	changed, err := p.store.Store(ctx, p.Filename, content, message, author)
 	if err != nil {
 		return false, err
 	}
@@ -181,7 +195,7 @@ func (p *Page) Save(content, message string, author storage.Author) (bool, error
 }
 
 // Delete deletes the page and optionally its attachments.
-func (p *Page) Delete(message string, author storage.Author, recursive bool) error {
+func (p *Page) Delete(ctx context.Context, message string, author storage.Author, recursive bool) error {
 	var files []string
 
 	if p.Exists {
@@ -190,7 +204,7 @@ func (p *Page) Delete(message string, author storage.Author, recursive bool) err
 
 	if recursive {
 		// Delete attachment directory
-		if p.store.IsDir(p.AttachmentDirectoryname) && !p.store.IsEmptyDir(p.AttachmentDirectoryname) {
+		if p.store.IsDir(ctx, p.AttachmentDirectoryname) && !p.store.IsEmptyDir(ctx, p.AttachmentDirectoryname) {
 			files = append(files, p.AttachmentDirectoryname)
 		}
 	}
@@ -201,7 +215,7 @@ func (p *Page) Delete(message string, author storage.Author, recursive bool) err
 
 	// Delete each file
 	for _, f := range files {
-		if err := p.store.Delete(f, message, author); err != nil {
+		if err := p.store.Delete(ctx, f, message, author); err != nil {
 			return err
 		}
 	}
@@ -211,7 +225,7 @@ func (p *Page) Delete(message string, author storage.Author, recursive bool) err
 
 // Rename renames the page. The source extension is preserved so a computational
 // (.qmd) page does not silently become a plain markdown page on rename.
-func (p *Page) Rename(newPagename, message string, author storage.Author) error {
+func (p *Page) Rename(ctx context.Context, newPagename, message string, author storage.Author) error {
 	ext := util.DefaultMarkdownExtension
 	if util.IsMarkdownFile(p.Filename) {
 		ext = strings.ToLower(p.Filename[len(util.StripMarkdownExtension(p.Filename)):])
@@ -222,7 +236,7 @@ func (p *Page) Rename(newPagename, message string, author storage.Author) error
 	}
 
 	// Check for attachments
-	files, dirs, err := p.store.List(p.AttachmentDirectoryname, nil, nil)
+	files, dirs, err := p.store.List(ctx, p.AttachmentDirectoryname, nil, nil)
 	if err != nil {
 		slog.Warn("failed to list attachments", "directory", p.AttachmentDirectoryname, "error", err)
 	}
@@ -230,13 +244,13 @@ func (p *Page) Rename(newPagename, message string, author storage.Author) error
 
 	if hasAttachments {
 		newAttachmentDir := util.GetAttachmentDirectoryname(newFilename)
-		if err := p.store.Rename(p.AttachmentDirectoryname, newAttachmentDir, message, author); err != nil {
+		if err := p.store.Rename(ctx, p.AttachmentDirectoryname, newAttachmentDir, message, author); err != nil {
 			return err
 		}
 	}
 
 	if p.Exists {
-		if err := p.store.Rename(p.Filename, newFilename, message, author); err != nil {
+		if err := p.store.Rename(ctx, p.Filename, newFilename, message, author); err != nil {
 			return err
 		}
 	}
@@ -245,19 +259,28 @@ func (p *Page) Rename(newPagename, message string, author storage.Author) error
 }
 
 // History returns the commit history for this page.
-func (p *Page) History(maxCount int) ([]storage.CommitMetadata, error) {
-	return p.store.Log(p.Filename, maxCount)
+func (p *Page) History(ctx context.Context, maxCount int) ([]storage.CommitMetadata, error) {
+	return p.store.Log(ctx, p.Filename, maxCount)
+}
+
+// QueryHistory returns the commits of this page matching query, newest
+// first, reading only as much of the history as the query's offset and
+// limit need.
+func (p *Page) QueryHistory(ctx context.Context, query storage.LogQuery) ([]storage.CommitMetadata, error) {
+	query.Path = p.Filename
+	query.PathPrefix = ""
+	return p.store.QueryLog(ctx, query)
 }
 
 // Blame returns blame information for this page.
-func (p *Page) Blame() ([]storage.BlameLine, error) {
-	return p.store.Blame(p.Filename, p.Revision)
+func (p *Page) Blame(ctx context.Context) ([]storage.BlameLine, error) {
+	return p.store.Blame(ctx, p.Filename, p.Revision)
 }
 
 // Attachments returns the attachments for this page.
-func (p *Page) Attachments(maxCount int, excludeExtensions string) ([]Attachment, error) {
+func (p *Page) Attachments(ctx context.Context, maxCount int, excludeExtensions string) ([]Attachment, error) {
 	depth := 0
-	files, _, err := p.store.List(p.AttachmentDirectoryname, &depth, nil)
+	files, _, err := p.store.List(ctx, p.AttachmentDirectoryname, &depth, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -278,6 +301,34 @@ func (p *Page) Attachments(maxCount int, excludeExtensions string) ([]Attachment
 	return attachments, nil
 }
 
+// SearchAttachments returns up to limit of the page's non-markdown
+// attachments whose filename contains query (case-insensitive), starting at
+// offset, along with the total number of matches. An empty query matches
+// every attachment; limit <= 0 means no limit.
+func (p *Page) SearchAttachments(ctx context.Context, query string, offset, limit int) ([]Attachment, int, error) {
+	depth := 0
+	files, _, err := p.store.List(ctx, p.AttachmentDirectoryname, &depth, nil)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	query = strings.ToLower(query)
+	attachments := []Attachment{}
+	total := 0
+	for _, f := range files {
+		if util.IsMarkdownFile(f) || !strings.Contains(strings.ToLower(f), query) {
+			continue
+		}
+		total++
+		if total <= offset || (limit > 0 && len(attachments) >= limit) {
+			continue
+		}
+		attachments = append(attachments, *NewAttachment(p.store, p.Pagepath, f, ""))
+	}
+
+	return attachments, total, nil
+}
+
 // Attachment represents a file attached to a page.
 type Attachment struct {
 	Pagepath   string
@@ -312,8 +363,8 @@ func NewAttachment(store storage.Storage, pagepath, filename, revision string) *
 }
 
 // LoadMetadata explicitly loads commit metadata for this attachment.
-func (a *Attachment) LoadMetadata() error {
-	meta, err := a.store.Metadata(a.Filepath, a.Revision)
+func (a *Attachment) LoadMetadata(ctx context.Context) error {
+	meta, err := a.store.Metadata(ctx, a.Filepath, a.Revision)
 	if err != nil {
 		return err
 	}
@@ -322,11 +373,11 @@ func (a *Attachment) LoadMetadata() error {
 }
 
 // Exists checks if the attachment exists.
-func (a *Attachment) Exists() bool {
-	return a.store.Exists(a.Filepath)
+func (a *Attachment) Exists(ctx context.Context) bool {
+	return a.store.Exists(ctx, a.Filepath)
 }
 
 // Load loads the attachment content.
-func (a *Attachment) Load() ([]byte, error) {
-	return a.store.LoadBytes(a.Filepath, a.Revision)
+func (a *Attachment) Load(ctx context.Context) ([]byte, error) {
+	return a.store.LoadBytes(ctx, a.Filepath, a.Revision)
 }
@@ -0,0 +1,292 @@
+package wiki
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/sa/gopherwiki/internal/db"
+	"github.com/sa/gopherwiki/internal/frontmatter"
+	"github.com/sa/gopherwiki/internal/storage"
+	"github.com/sa/gopherwiki/internal/util"
+)
+
+// PageInfo is a page with the facts the page index sorts it by.
+type PageInfo struct {
+	Name    string
+	Path    string
+	Created time.Time // Time of the first commit of the page's file
+	Updated time.Time // Time of the last commit of the page's file
+	Size    int64     // Size of the page's file in bytes
+}
+
+// pageMetadataHead records the commit the page_metadata cache is up to date
+// with, so that commits made outside the wiki, by a push or another
+// process, are caught up with on the next read.
+const pageMetadataHead = "page_metadata_head"
+
+// pageInfoBatch is the number of commits the metadata cache reads at a
+// time when catching up with the history.
+const pageInfoBatch = 100
+
+// PageInfos returns every page with its creation and update times and its
+// size, sorted by path.
+func (ws *WikiService) PageInfos(ctx context.Context) ([]PageInfo, error) {
+	pages, err := ws.PageMetadata(ctx)
+	if err != nil {
+		return nil, err
+	}
+	infos := make([]PageInfo, 0, len(pages))
+	for _, m := range pages {
+		infos = append(infos, PageInfo{
+			Name:    util.GetPagename(m.Pagepath, false),
+			Path:    m.Pagepath,
+			Created: m.Created,
+			Updated: m.Updated,
+			Size:    m.Size,
+		})
+	}
+	return infos, nil
+}
+
+// PageMetadata returns the metadata of every page, sorted by path. It is
+// read from the page_metadata cache, which is kept up to date as pages are
+// saved; commits made otherwise are caught up with first. The whole
+// history is read only to build the cache.
+func (ws *WikiService) PageMetadata(ctx context.Context) ([]db.PageMetadata, error) {
+	if ws.db == nil {
+		commits, err := ws.store.QueryLog(ctx, storage.LogQuery{})
+		if err != nil {
+			return nil, err
+		}
+		return ws.buildPageMetadata(ctx, commits)
+	}
+	if err := ws.syncPageMetadata(ctx); err != nil {
+		return nil, err
+	}
+	pages, err := ws.db.ListPageMetadata(ctx)
+	if err != nil {
+		return nil, err
+	}
+	// The database's collation need not sort as Go does.
+	sort.Slice(pages, func(i, j int) bool { return pages[i].Pagepath < pages[j].Pagepath })
+	return pages, nil
+}
+
+// PageMeta returns the metadata of the page at pagepath, or nil if there is
+// no such page.
+func (ws *WikiService) PageMeta(ctx context.Context, pagepath string) (*db.PageMetadata, error) {
+	if ws.db == nil {
+		pages, err := ws.PageMetadata(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for i := range pages {
+			if pages[i].Pagepath == pagepath {
+				return &pages[i], nil
+			}
+		}
+		return nil, nil
+	}
+	if err := ws.syncPageMetadata(ctx); err != nil {
+		return nil, err
+	}
+	return ws.db.GetPageMetadata(ctx, pagepath)
+}
+
+// syncPageMetadata brings the metadata cache up to date with the
+// repository's latest commit: it reads the commits made since the one the
+// cache was last brought up to date with, or the whole history when the
+// cache is new or that commit is gone.
+func (ws *WikiService) syncPageMetadata(ctx context.Context) error {
+	latest, err := ws.store.Log(ctx, "", 1)
+	if err != nil && !errors.Is(err, storage.ErrNotFound) {
+		return err
+	}
+	head := ""
+	if len(latest) > 0 {
+		head = latest[0].RevisionFull
+	}
+
+	ws.pmMu.Lock()
+	defer ws.pmMu.Unlock()
+	built := ""
+	if pref, err := ws.db.Queries.GetPreference(ctx, pageMetadataHead); err == nil {
+		built = pref.Value.String
+	}
+	if built == head {
+		return nil
+	}
+
+	commits, found, err := ws.commitsSince(ctx, built)
+	if err != nil {
+		return err
+	}
+	if found {
+		err = ws.updatePageMetadata(ctx, commits)
+	} else {
+		var pages []db.PageMetadata
+		if pages, err = ws.buildPageMetadata(ctx, commits); err == nil {
+			err = ws.db.RebuildPageMetadata(ctx, pages)
+		}
+	}
+	if err != nil {
+		return err
+	}
+	return ws.db.Queries.UpsertPreference(ctx, db.UpsertPreferenceParams{
+		Name:  pageMetadataHead,
+		Value: db.NullString(head),
+	})
+}
+
+// commitsSince returns the commits made after revision, newest first, and
+// whether revision was found among them. When it is not, the whole history
+// is returned.
+func (ws *WikiService) commitsSince(ctx context.Context, revision string) ([]storage.CommitMetadata, bool, error) {
+	if revision == "" {
+		all, err := ws.store.QueryLog(ctx, storage.LogQuery{})
+		return all, false, err
+	}
+	var commits []storage.CommitMetadata
+	for offset := 0; ; offset += pageInfoBatch {
+		batch, err := ws.store.QueryLog(ctx, storage.LogQuery{Offset: offset, Limit: pageInfoBatch})
+		if err != nil {
+			return nil, false, err
+		}
+		for i, c := range batch {
+			if c.RevisionFull == revision {
+				return append(commits, batch[:i]...), true, nil
+			}
+		}
+		commits = append(commits, batch...)
+		if len(batch) < pageInfoBatch {
+			return commits, false, nil
+		}
+	}
+}
+
+// buildPageMetadata returns the metadata of every page, given the whole
+// history newest first.
+func (ws *WikiService) buildPageMetadata(ctx context.Context, commits []storage.CommitMetadata) ([]db.PageMetadata, error) {
+	last := make(map[string]*storage.CommitMetadata)
+	first := make(map[string]time.Time)
+	for i := range commits {
+		for _, f := range commits[i].Files {
+			if last[f] == nil {
+				last[f] = &commits[i]
+			}
+			first[f] = commits[i].Datetime
+		}
+	}
+
+	files, _, err := ws.store.List(ctx, "", nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	var pages []db.PageMetadata
+	seen := make(map[string]bool)
+	for _, f := range files {
+		pagepath := util.StripMarkdownExtension(f)
+		if !util.IsMarkdownFile(f) || seen[pagepath] {
+			continue
+		}
+		seen[pagepath] = true
+		m := ws.filePageMetadata(ctx, f, last[f])
+		m.Created = first[f]
+		pages = append(pages, m)
+	}
+	return pages, nil
+}
+
+// updatePageMetadata updates the cache with commits, given newest first,
+// made since it was last brought up to date.
+func (ws *WikiService) updatePageMetadata(ctx context.Context, commits []storage.CommitMetadata) error {
+	last := make(map[string]*storage.CommitMetadata)
+	first := make(map[string]time.Time)
+	var touched []string
+	for i := range commits {
+		for _, f := range commits[i].Files {
+			if !util.IsMarkdownFile(f) {
+				continue
+			}
+			if last[f] == nil {
+				last[f] = &commits[i]
+				touched = append(touched, f)
+			}
+			first[f] = commits[i].Datetime
+		}
+	}
+	for _, f := range touched {
+		if err := ws.refreshPageMetadata(ctx, f, last[f], first[f]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// refreshPageMetadata updates the cached metadata of the page stored in
+// filename, last committed in commit, or removes it when the file is gone.
+// A page not cached yet was created at created, or when it was last
+// committed if that is zero.
+func (ws *WikiService) refreshPageMetadata(ctx context.Context, filename string, commit *storage.CommitMetadata, created time.Time) error {
+	pagepath := util.StripMarkdownExtension(filename)
+	cached, err := ws.db.GetPageMetadata(ctx, pagepath)
+	if err != nil {
+		return err
+	}
+	if !ws.store.Exists(ctx, filename) {
+		if cached == nil || cached.Filename != filename {
+			return nil
+		}
+		return ws.db.DeletePageMetadata(ctx, pagepath)
+	}
+	m := ws.filePageMetadata(ctx, filename, commit)
+	m.Created = created
+	if m.Created.IsZero() {
+		m.Created = m.Updated
+	}
+	if cached != nil && cached.Filename == filename && !cached.Created.IsZero() {
+		m.Created = cached.Created
+	}
+	return ws.db.UpsertPageMetadata(ctx, m)
+}
+
+// filePageMetadata returns the metadata of the page stored in filename,
+// last committed in commit, if known, all but its creation time.
+func (ws *WikiService) filePageMetadata(ctx context.Context, filename string, commit *storage.CommitMetadata) db.PageMetadata {
+	pagepath := util.StripMarkdownExtension(filename)
+	m := db.PageMetadata{Pagepath: pagepath, Filename: filename}
+	if content, err := ws.store.Load(ctx, filename, ""); err == nil {
+		m.Title, _ = indexTitleAndBody(pagepath, content)
+		if fm, _ := frontmatter.Parse(content); fm != nil {
+			m.ReviewBy = fm.ReviewBy.Time
+			m.NoIndex = bool(fm.NoIndex)
+		}
+	}
+	if size, err := ws.store.Size(ctx, filename); err == nil {
+		m.Size = size
+	}
+	if commit != nil {
+		m.Revision = commit.RevisionFull
+		m.AuthorName = commit.AuthorName
+		m.AuthorEmail = commit.AuthorEmail
+		m.Updated = commit.Datetime
+	}
+	return m
+}
+
+// indexPageMetadata updates the cached metadata of a page just saved,
+// renamed, or deleted, so that it is current before the next read catches
+// up with the history.
+func (ws *WikiService) indexPageMetadata(ctx context.Context, pagepath string) error {
+	ws.pmMu.Lock()
+	defer ws.pmMu.Unlock()
+	for _, f := range util.CandidateFilenames(pagepath) {
+		if ws.store.Exists(ctx, f) {
+			commit, _ := ws.store.Metadata(ctx, f, "")
+			return ws.refreshPageMetadata(ctx, f, commit, time.Time{})
+		}
+	}
+	return ws.db.DeletePageMetadata(ctx, pagepath)
+}
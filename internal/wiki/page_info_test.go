@@ -0,0 +1,167 @@
+package wiki
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/sa/gopherwiki/internal/db"
+	"github.com/sa/gopherwiki/internal/storage"
+)
+
+func TestPageInfos(t *testing.T) {
+	ws, cleanup := setupTestService(t)
+	defer cleanup()
+	ctx := context.Background()
+	author := storage.Author{Name: "Test User", Email: "test@example.com"}
+
+	find := func(infos []PageInfo, path string) *PageInfo {
+		for i := range infos {
+			if infos[i].Path == path {
+				return &infos[i]
+			}
+		}
+		return nil
+	}
+
+	infos, err := ws.PageInfos(ctx)
+	if err != nil {
+		t.Fatalf("PageInfos: %v", err)
+	}
+	if len(infos) == 0 {
+		t.Fatal("PageInfos returned no pages")
+	}
+	for _, info := range infos {
+		if info.Created.IsZero() || info.Updated.Before(info.Created) || info.Size == 0 {
+			t.Errorf("PageInfo %+v: want a creation time, an update time after it, and a size", info)
+		}
+	}
+
+	// Commits made since are read on the next call.
+	if _, err := ws.store.Store(ctx, "later.md", "# Later\n\nAdded afterwards.\n", "Add later", author); err != nil {
+		t.Fatal(err)
+	}
+	infos, err = ws.PageInfos(ctx)
+	if err != nil {
+		t.Fatalf("PageInfos: %v", err)
+	}
+	later := find(infos, "later")
+	if later == nil {
+		t.Fatal("PageInfos misses a page added after the first call")
+	}
+	if later.Size != int64(len("# Later\n\nAdded afterwards.\n")) {
+		t.Errorf("later size = %d", later.Size)
+	}
+	created := later.Created
+
+	if _, err := ws.store.Store(ctx, "later.md", "# Later\n\nEdited.\n", "Edit later", author); err != nil {
+		t.Fatal(err)
+	}
+	infos, _ = ws.PageInfos(ctx)
+	later = find(infos, "later")
+	if later == nil || !later.Created.Equal(created) || later.Updated.Before(created) {
+		t.Errorf("after an edit, later = %+v; want it created at %v", later, created)
+	}
+	if later != nil && later.Size != int64(len("# Later\n\nEdited.\n")) {
+		t.Errorf("after an edit, later size = %d", later.Size)
+	}
+
+	// The cache returns copies.
+	infos[0].Name = "changed"
+	if again, _ := ws.PageInfos(ctx); again[0].Name == "changed" {
+		t.Error("PageInfos returned the cached slice itself")
+	}
+}
+
+func TestPageMetadata(t *testing.T) {
+	ws, cleanup := setupTestService(t)
+	defer cleanup()
+	ctx := context.Background()
+	alice := storage.Author{Name: "Alice", Email: "alice@example.com"}
+	bob := storage.Author{Name: "Bob", Email: "bob@example.com"}
+
+	if _, err := ws.SavePage(ctx, "guide", "# The Guide\n\nFirst.\n", "Add guide", "", alice); err != nil {
+		t.Fatal(err)
+	}
+	pages, err := ws.PageMetadata(ctx)
+	if err != nil {
+		t.Fatalf("PageMetadata: %v", err)
+	}
+	var guide *db.PageMetadata
+	for i := range pages {
+		if pages[i].Pagepath == "guide" {
+			guide = &pages[i]
+		}
+	}
+	if guide == nil || guide.Title != "The Guide" || guide.AuthorName != "Alice" || len(guide.Revision) != 40 {
+		t.Fatalf("guide = %+v; want its title, author, and revision", guide)
+	}
+	created := guide.Created
+
+	// Saving updates the cache itself.
+	if _, err := ws.SavePage(ctx, "guide", "# The Guide\n\nSecond.\n", "Edit guide", "", bob); err != nil {
+		t.Fatal(err)
+	}
+	latest, _ := ws.store.Log(ctx, "guide.md", 1)
+	cached, _ := ws.db.GetPageMetadata(ctx, "guide")
+	if cached == nil || cached.AuthorName != "Bob" || cached.Revision != latest[0].RevisionFull || !cached.Created.Equal(created) {
+		t.Errorf("after a save, cached guide = %+v; want Bob's revision %s, created at %v", cached, latest[0].RevisionFull, created)
+	}
+
+	// Commits made behind the wiki's back are caught up with on the next read.
+	if _, err := ws.store.Store(ctx, "pushed.md", "# Pushed\n", "Push a page", bob); err != nil {
+		t.Fatal(err)
+	}
+	if err := ws.store.Delete(ctx, "guide.md", "Remove guide", alice); err != nil {
+		t.Fatal(err)
+	}
+	if meta, err := ws.PageMeta(ctx, "pushed"); err != nil || meta == nil || meta.Title != "Pushed" || meta.Size != int64(len("# Pushed\n")) {
+		t.Errorf("PageMeta(pushed) = %+v, %v; want the pushed page", meta, err)
+	}
+	if meta, err := ws.PageMeta(ctx, "guide"); err != nil || meta != nil {
+		t.Errorf("PageMeta(guide) after its deletion = %+v, %v; want nil", meta, err)
+	}
+
+	// A service opened on the same database reuses the cache.
+	other := NewWikiService(ws.store, ws.config, ws.db)
+	if again, err := other.PageMetadata(ctx); err != nil || len(again) != len(pages) {
+		t.Errorf("PageMetadata from another service = %d pages, %v; want %d", len(again), err, len(pages))
+	}
+}
+
+func TestStalePages(t *testing.T) {
+	ws, cleanup := setupTestService(t)
+	defer cleanup()
+	ctx := context.Background()
+	alice := storage.Author{Name: "Alice", Email: "alice@example.com"}
+
+	pages := map[string]string{
+		"overdue": "---\nreview_by: 2020-01-01\n---\n# Overdue\n",
+		"later":   "---\nreview_by: 2999-01-01\n---\n# Later\n",
+		"fresh":   "# Fresh\n",
+	}
+	for name, content := range pages {
+		if _, err := ws.SavePage(ctx, name, content, "Add "+name, "", alice); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	stale, err := ws.StalePages(ctx, time.Now(), 12)
+	if err != nil || len(stale) != 1 || stale[0].Path != "overdue" || !stale[0].Overdue || stale[0].Title != "Overdue" || stale[0].AuthorEmail != "alice@example.com" {
+		t.Fatalf("StalePages now = %+v, %v; want the overdue page", stale, err)
+	}
+
+	// Two years on, the pages without a review date are old too, but the
+	// overdue one was due first.
+	stale, err = ws.StalePages(ctx, time.Now().AddDate(2, 0, 0), 12)
+	paths := make(map[string]bool)
+	for _, p := range stale {
+		paths[p.Path] = true
+	}
+	if err != nil || len(stale) < 2 || stale[0].Path != "overdue" || stale[1].Overdue || !paths["fresh"] || paths["later"] {
+		t.Errorf("StalePages in two years = %+v, %v; want the overdue page first, then the old ones but later", stale, err)
+	}
+	if stale, _ := ws.StalePages(ctx, time.Now().AddDate(2, 0, 0), 0); len(stale) != 1 {
+		t.Errorf("StalePages without an age = %+v; want only the overdue page", stale)
+	}
+}
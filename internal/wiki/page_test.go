@@ -1,6 +1,7 @@
 package wiki
 
 import (
+	"context"
 	"os"
 	"strings"
 	"testing"
@@ -35,9 +36,9 @@ var testAuthor = storage.Author{Name: "Test", Email: "test@example.com"}
 
 func TestNewPageResolvesMarkdown(t *testing.T) {
 	store, cfg := setupPageStore(t)
-	store.Store("notes.md", "# Notes\nplain page\n", "create", testAuthor)
+	store.Store(context.Background(), "notes.md", "# Notes\nplain page\n", "create", testAuthor)
 
-	page, err := NewPage(store, cfg, "notes", "")
+	page, err := NewPage(context.Background(), store, cfg, "notes", "")
 	if err != nil {
 		t.Fatalf("NewPage: %v", err)
 	}
@@ -54,9 +55,9 @@ func TestNewPageResolvesMarkdown(t *testing.T) {
 
 func TestNewPageResolvesQuarto(t *testing.T) {
 	store, cfg := setupPageStore(t)
-	store.StoreBytes("analysis.qmd", []byte("---\ntitle: Analysis\n---\n# A\n"), "create", testAuthor)
+	store.StoreBytes(context.Background(), "analysis.qmd", []byte("---\ntitle: Analysis\n---\n# A\n"), "create", testAuthor)
 
-	page, err := NewPage(store, cfg, "analysis", "")
+	page, err := NewPage(context.Background(), store, cfg, "analysis", "")
 	if err != nil {
 		t.Fatalf("NewPage: %v", err)
 	}
@@ -78,10 +79,10 @@ func TestNewPageResolvesQuarto(t *testing.T) {
 func TestNewPagePrefersMarkdownOnTie(t *testing.T) {
 	store, cfg := setupPageStore(t)
 	// Both extensions present: .md wins per resolution priority.
-	store.Store("dup.md", "# Md\n", "create md", testAuthor)
-	store.StoreBytes("dup.qmd", []byte("# Qmd\n"), "create qmd", testAuthor)
+	store.Store(context.Background(), "dup.md", "# Md\n", "create md", testAuthor)
+	store.StoreBytes(context.Background(), "dup.qmd", []byte("# Qmd\n"), "create qmd", testAuthor)
 
-	page, err := NewPage(store, cfg, "dup", "")
+	page, err := NewPage(context.Background(), store, cfg, "dup", "")
 	if err != nil {
 		t.Fatalf("NewPage: %v", err)
 	}
@@ -96,7 +97,7 @@ func TestNewPagePrefersMarkdownOnTie(t *testing.T) {
 func TestNewPageMissingDefaultsToMarkdown(t *testing.T) {
 	store, cfg := setupPageStore(t)
 
-	page, err := NewPage(store, cfg, "ghost", "")
+	page, err := NewPage(context.Background(), store, cfg, "ghost", "")
 	if err != nil {
 		t.Fatalf("NewPage: %v", err)
 	}
@@ -113,10 +114,10 @@ func TestNewPageMissingDefaultsToMarkdown(t *testing.T) {
 
 func TestRenderDispatchesQuartoToPlaceholder(t *testing.T) {
 	store, cfg := setupPageStore(t)
-	store.StoreBytes("report.qmd", []byte("---\ntitle: R\n---\n```{python}\nprint(1)\n```\n"), "create", testAuthor)
+	store.StoreBytes(context.Background(), "report.qmd", []byte("---\ntitle: R\n---\n```{python}\nprint(1)\n```\n"), "create", testAuthor)
 	rnd := renderer.New(cfg)
 
-	page, err := NewPage(store, cfg, "report", "")
+	page, err := NewPage(context.Background(), store, cfg, "report", "")
 	if err != nil {
 		t.Fatalf("NewPage: %v", err)
 	}
@@ -136,10 +137,10 @@ func TestRenderDispatchesQuartoToPlaceholder(t *testing.T) {
 
 func TestRenderMarkdownUsesGoldmark(t *testing.T) {
 	store, cfg := setupPageStore(t)
-	store.Store("plain.md", "# Plain\n\nSome **bold** text.\n", "create", testAuthor)
+	store.Store(context.Background(), "plain.md", "# Plain\n\nSome **bold** text.\n", "create", testAuthor)
 	rnd := renderer.New(cfg)
 
-	page, err := NewPage(store, cfg, "plain", "")
+	page, err := NewPage(context.Background(), store, cfg, "plain", "")
 	if err != nil {
 		t.Fatalf("NewPage: %v", err)
 	}
@@ -155,24 +156,24 @@ func TestRenderMarkdownUsesGoldmark(t *testing.T) {
 
 func TestRenamePreservesQuartoExtension(t *testing.T) {
 	store, cfg := setupPageStore(t)
-	store.StoreBytes("draft.qmd", []byte("# Draft\n"), "create", testAuthor)
+	store.StoreBytes(context.Background(), "draft.qmd", []byte("# Draft\n"), "create", testAuthor)
 
-	page, err := NewPage(store, cfg, "draft", "")
+	page, err := NewPage(context.Background(), store, cfg, "draft", "")
 	if err != nil {
 		t.Fatalf("NewPage: %v", err)
 	}
-	if err := page.Rename("final", "rename", testAuthor); err != nil {
+	if err := page.Rename(context.Background(), "final", "rename", testAuthor); err != nil {
 		t.Fatalf("Rename: %v", err)
 	}
 
-	if !store.Exists("final.qmd") {
+	if !store.Exists(context.Background(), "final.qmd") {
 		t.Error("renamed computational page should keep its .qmd extension")
 	}
-	if store.Exists("final.md") {
+	if store.Exists(context.Background(), "final.md") {
 		t.Error("rename must not convert a .qmd page into .md")
 	}
 
-	moved, err := NewPage(store, cfg, "final", "")
+	moved, err := NewPage(context.Background(), store, cfg, "final", "")
 	if err != nil {
 		t.Fatalf("NewPage after rename: %v", err)
 	}
@@ -183,9 +184,9 @@ func TestRenamePreservesQuartoExtension(t *testing.T) {
 
 func TestPageFrontmatterTitleOverridesHeading(t *testing.T) {
 	store, cfg := setupPageStore(t)
-	store.Store("doc.md", "---\ntitle: Fancy Title\n---\n# Plain Heading\n\nBody.\n", "create", testAuthor)
+	store.Store(context.Background(), "doc.md", "---\ntitle: Fancy Title\n---\n# Plain Heading\n\nBody.\n", "create", testAuthor)
 
-	page, err := NewPage(store, cfg, "doc", "")
+	page, err := NewPage(context.Background(), store, cfg, "doc", "")
 	if err != nil {
 		t.Fatalf("NewPage: %v", err)
 	}
@@ -202,10 +203,10 @@ func TestPageFrontmatterTitleOverridesHeading(t *testing.T) {
 
 func TestPageFrontmatterStrippedFromRender(t *testing.T) {
 	store, cfg := setupPageStore(t)
-	store.Store("doc.md", "---\ntitle: T\n---\n# Heading\n\nText.\n", "create", testAuthor)
+	store.Store(context.Background(), "doc.md", "---\ntitle: T\n---\n# Heading\n\nText.\n", "create", testAuthor)
 	rnd := renderer.New(cfg)
 
-	page, err := NewPage(store, cfg, "doc", "")
+	page, err := NewPage(context.Background(), store, cfg, "doc", "")
 	if err != nil {
 		t.Fatalf("NewPage: %v", err)
 	}
@@ -220,9 +221,9 @@ func TestPageFrontmatterStrippedFromRender(t *testing.T) {
 
 func TestPageHeadingTitleWhenNoFrontmatter(t *testing.T) {
 	store, cfg := setupPageStore(t)
-	store.Store("doc.md", "# Just Heading\n\nBody.\n", "create", testAuthor)
+	store.Store(context.Background(), "doc.md", "# Just Heading\n\nBody.\n", "create", testAuthor)
 
-	page, err := NewPage(store, cfg, "doc", "")
+	page, err := NewPage(context.Background(), store, cfg, "doc", "")
 	if err != nil {
 		t.Fatalf("NewPage: %v", err)
 	}
@@ -240,9 +241,9 @@ func TestPageHeadingTitleWhenNoFrontmatter(t *testing.T) {
 func TestPageComputationalFrontmatterExposed(t *testing.T) {
 	store, cfg := setupPageStore(t)
 	content := "---\ntitle: Analysis\nengine: jupyter\nexecute:\n  freeze: auto\n---\n```{python}\nprint(1)\n```\n"
-	store.StoreBytes("analysis.qmd", []byte(content), "create", testAuthor)
+	store.StoreBytes(context.Background(), "analysis.qmd", []byte(content), "create", testAuthor)
 
-	page, err := NewPage(store, cfg, "analysis", "")
+	page, err := NewPage(context.Background(), store, cfg, "analysis", "")
 	if err != nil {
 		t.Fatalf("NewPage: %v", err)
 	}
@@ -262,3 +263,36 @@ func TestPageComputationalFrontmatterExposed(t *testing.T) {
 		t.Errorf("Pagename = %q, want %q", page.Pagename, "Analysis")
 	}
 }
+
+func TestSearchAttachmentsFiltersAndPaginates(t *testing.T) {
+	store, cfg := setupPageStore(t)
+	store.StoreBytes(context.Background(), "docs.md", []byte("# Docs\n"), "create", testAuthor)
+	store.StoreBytes(context.Background(), "docs/child.qmd", []byte("# Child\n"), "create", testAuthor)
+	for _, name := range []string{"Diagram.png", "diagram-old.png", "notes.txt"} {
+		store.StoreBytes(context.Background(), "docs/"+name, []byte("x"), "upload", testAuthor)
+	}
+
+	page, err := NewPage(context.Background(), store, cfg, "docs", "")
+	if err != nil {
+		t.Fatalf("NewPage: %v", err)
+	}
+
+	all, total, err := page.SearchAttachments(context.Background(), "", 0, 0)
+	if err != nil {
+		t.Fatalf("SearchAttachments: %v", err)
+	}
+	if total != 3 || len(all) != 3 {
+		t.Errorf("got %d of %d attachments, want 3 of 3 (pages excluded)", len(all), total)
+	}
+
+	matches, total, err := page.SearchAttachments(context.Background(), "DIAGRAM", 1, 5)
+	if err != nil {
+		t.Fatalf("SearchAttachments: %v", err)
+	}
+	if total != 2 {
+		t.Errorf("total = %d, want 2 case-insensitive matches", total)
+	}
+	if len(matches) != 1 {
+		t.Errorf("got %d matches after offset 1, want 1", len(matches))
+	}
+}
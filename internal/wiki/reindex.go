@@ -0,0 +1,168 @@
+package wiki
+
+import (
+	"context"
+	"log/slog"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/sa/gopherwiki/internal/db"
+	"github.com/sa/gopherwiki/internal/renderer"
+	"github.com/sa/gopherwiki/internal/util"
+)
+
+// ReindexStatus reports the progress of the latest search index rebuild.
+type ReindexStatus struct {
+	Running  bool
+	Done     int // Pages loaded so far
+	Total    int // Pages to load
+	Started  time.Time
+	Finished time.Time // Zero while running
+	Err      error     // Why the rebuild failed, if it did
+}
+
+// maxReindexWorkers bounds the goroutines loading pages during a rebuild.
+const maxReindexWorkers = 8
+
+// ReindexStatus returns the progress of the running search index rebuild,
+// or the outcome of the latest one.
+func (ws *WikiService) ReindexStatus() ReindexStatus {
+	ws.statusMu.Lock()
+	defer ws.statusMu.Unlock()
+	return ws.reindexStatus
+}
+
+// StartSearchIndexRebuild rebuilds the search index in the background and
+// reports whether it did start, which it does not while another rebuild is
+// running. Its progress is read with ReindexStatus.
+func (ws *WikiService) StartSearchIndexRebuild() bool {
+	if ws.db == nil || !ws.reindexMu.TryLock() {
+		return false
+	}
+	ws.beginReindex()
+	go func() {
+		defer ws.reindexMu.Unlock()
+		n, err := ws.rebuildSearchIndex(context.Background())
+		if err != nil {
+			slog.Error("failed to rebuild search index", "error", err)
+			return
+		}
+		slog.Info("rebuilt search index", "pages", n)
+	}()
+	return true
+}
+
+// RebuildSearchIndex rebuilds the search index and the backlinks from git
+// storage, and returns the number of pages indexed.
+func (ws *WikiService) RebuildSearchIndex(ctx context.Context) (int, error) {
+	if ws.db == nil {
+		return 0, nil
+	}
+	ws.reindexMu.Lock()
+	defer ws.reindexMu.Unlock()
+	ws.beginReindex()
+	return ws.rebuildSearchIndex(ctx)
+}
+
+func (ws *WikiService) beginReindex() {
+	ws.statusMu.Lock()
+	ws.reindexStatus = ReindexStatus{Running: true, Started: time.Now()}
+	ws.statusMu.Unlock()
+}
+
+// rebuildSearchIndex does the work of RebuildSearchIndex, loading pages and
+// extracting their titles and links with a pool of workers. Caller must
+// hold ws.reindexMu.
+func (ws *WikiService) rebuildSearchIndex(ctx context.Context) (n int, err error) {
+	defer func() {
+		ws.statusMu.Lock()
+		ws.reindexStatus.Running = false
+		ws.reindexStatus.Finished = time.Now()
+		ws.reindexStatus.Err = err
+		ws.statusMu.Unlock()
+	}()
+
+	files, _, err := ws.store.List(ctx, "", nil, nil)
+	if err != nil {
+		return 0, err
+	}
+	var markdown []string
+	for _, f := range files {
+		if util.IsMarkdownFile(f) {
+			markdown = append(markdown, f)
+		}
+	}
+	ws.statusMu.Lock()
+	ws.reindexStatus.Total = len(markdown)
+	ws.statusMu.Unlock()
+
+	// Results are kept in the order of the files; a page that fails to load
+	// leaves its slot empty.
+	pages := make([]db.PageIndexData, len(markdown))
+	targets := make([][]string, len(markdown))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < min(runtime.GOMAXPROCS(0), maxReindexWorkers); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				if content, err := ws.store.Load(ctx, markdown[i], ""); err == nil {
+					pagepath := util.StripMarkdownExtension(markdown[i])
+					title, body := indexTitleAndBody(pagepath, content)
+					pages[i] = db.PageIndexData{
+						Pagepath: pagepath,
+						Title:    title,
+						Content:  body,
+						Folded:   ws.foldedIndexText(pagepath, title, body),
+					}
+					targets[i] = renderer.ExtractWikiLinks(body, ws.config.RetainPageNameCase)
+				}
+				ws.statusMu.Lock()
+				ws.reindexStatus.Done++
+				ws.statusMu.Unlock()
+			}
+		}()
+	}
+feed:
+	for i := range markdown {
+		select {
+		case jobs <- i:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(jobs)
+	wg.Wait()
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	indexed := pages[:0]
+	var links []db.PageLinkData
+	for i, p := range pages {
+		if p.Pagepath == "" {
+			continue
+		}
+		indexed = append(indexed, p)
+		if len(targets[i]) > 0 {
+			links = append(links, db.PageLinkData{Source: p.Pagepath, Targets: targets[i]})
+		}
+	}
+
+	if err := ws.db.RebuildPageIndex(ctx, indexed); err != nil {
+		return 0, err
+	}
+	if err := ws.db.RebuildPageLinks(ctx, links); err != nil {
+		return 0, err
+	}
+	err = ws.db.Queries.UpsertPreference(ctx, db.UpsertPreferenceParams{
+		Name:  searchLocalePreference,
+		Value: db.NullString(ws.searchLocale()),
+	})
+	if err != nil {
+		return 0, err
+	}
+	return len(indexed), nil
+}
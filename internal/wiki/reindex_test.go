@@ -0,0 +1,66 @@
+package wiki
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/sa/gopherwiki/internal/storage"
+)
+
+func TestRebuildSearchIndex(t *testing.T) {
+	ws, cleanup := setupTestService(t)
+	defer cleanup()
+	ctx := context.Background()
+	base, err := ws.RebuildSearchIndex(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// More pages than the index takes per insert.
+	files := map[string][]byte{"notes.txt": []byte("not a page")}
+	for i := 0; i < 250; i++ {
+		files[fmt.Sprintf("page-%03d.md", i)] = []byte(fmt.Sprintf("# Page %d\n\nSee [[Home]].\n", i))
+	}
+	if _, err := ws.store.StoreFiles(ctx, files, "Add pages", storage.Author{Name: "Test", Email: "test@example.com"}); err != nil {
+		t.Fatal(err)
+	}
+
+	n, err := ws.RebuildSearchIndex(ctx)
+	if err != nil || n != base+250 {
+		t.Fatalf("RebuildSearchIndex = %d, %v; want %d", n, err, base+250)
+	}
+	titles, err := ws.db.PageTitles(ctx)
+	if err != nil || len(titles) != n || titles["page-042"] != "Page 42" {
+		t.Errorf("indexed %d titles, page-042 = %q, %v", len(titles), titles["page-042"], err)
+	}
+	if backlinks, _ := ws.db.GetBacklinks(ctx, "home"); len(backlinks) != 250 {
+		t.Errorf("home has %d backlinks, want 250", len(backlinks))
+	}
+	status := ws.ReindexStatus()
+	if status.Running || status.Done != n || status.Total != n || status.Err != nil || status.Finished.IsZero() {
+		t.Errorf("status after a rebuild = %+v", status)
+	}
+
+	ws.store.Delete(ctx, "page-000.md", "", storage.Author{Name: "Test", Email: "test@example.com"})
+	if !ws.StartSearchIndexRebuild() {
+		t.Fatal("StartSearchIndexRebuild did not start")
+	}
+	deadline := time.Now().Add(10 * time.Second)
+	for ws.ReindexStatus().Running {
+		if time.Now().After(deadline) {
+			t.Fatal("background rebuild did not finish")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if count, _ := ws.db.PageIndexCount(ctx); int(count) != n-1 {
+		t.Errorf("background rebuild indexed %d pages, want %d", count, n-1)
+	}
+
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, err := ws.RebuildSearchIndex(canceled); err == nil || ws.ReindexStatus().Err == nil {
+		t.Error("a canceled rebuild should fail and report it")
+	}
+}
@@ -2,6 +2,7 @@ package wiki
 
 import (
 	"context"
+	"fmt"
 	"log/slog"
 	"regexp"
 	"sort"
@@ -38,6 +39,25 @@ func indexTitleAndBody(pagepath, content string) (string, string) {
 	return title, body
 }
 
+// searchLocale returns the locale used to fold diacritics in the search
+// index and in queries.
+func (ws *WikiService) searchLocale() string {
+	if ws.config.SearchLocale != "" {
+		return ws.config.SearchLocale
+	}
+	return ws.config.SiteLang
+}
+
+// foldedIndexText returns the locale-folded text stored alongside a page in
+// the search index, covering its path, title, and body.
+func (ws *WikiService) foldedIndexText(pagepath, title, body string) string {
+	return util.FoldSearchText(pagepath+"\n"+title+"\n"+body, ws.searchLocale())
+}
+
+// searchLocalePreference records the locale the search index was built with,
+// so a SEARCH_LOCALE change triggers a rebuild.
+const searchLocalePreference = "search_index_locale"
+
 // SearchResult represents a single search result.
 type SearchResult struct {
 	Pagename   string
@@ -55,6 +75,7 @@ type PageIndexEntry struct {
 // PageTreeNode represents a node in the sidebar page tree.
 type PageTreeNode struct {
 	Name     string
+	Title    string // The page's title as indexed for search; Name if unknown
 	Path     string
 	Children []*PageTreeNode
 	IsPage   bool
@@ -73,6 +94,22 @@ type WikiService struct {
 	ptMu      sync.RWMutex
 	ptCache   []*PageTreeNode
 	ptCachedAt time.Time
+
+	// vaultCache caches the name index Obsidian links resolve against.
+	vaultMu      sync.Mutex
+	vaultCache   *vaultIndex
+	vaultBuiltAt time.Time
+
+	hooks SaveHooks // Run around SavePage; nil for none
+
+	// pmMu serializes updates of the page_metadata cache.
+	pmMu sync.Mutex
+
+	// reindexMu serializes search index rebuilds; reindexStatus, guarded
+	// by statusMu, reports the latest.
+	reindexMu     sync.Mutex
+	statusMu      sync.Mutex
+	reindexStatus ReindexStatus
 }
 
 // NewWikiService creates a new WikiService.
@@ -80,22 +117,27 @@ func NewWikiService(store storage.Storage, cfg *config.Config, database *db.Data
 	return &WikiService{store: store, config: cfg, db: database}
 }
 
-// InvalidatePageTreeCache clears the cached page tree, forcing a rebuild on next access.
+// InvalidatePageTreeCache clears the cached page tree and link index, forcing a rebuild on next access.
 func (ws *WikiService) InvalidatePageTreeCache() {
 	ws.ptMu.Lock()
 	ws.ptCachedAt = time.Time{}
 	ws.ptMu.Unlock()
+	ws.vaultMu.Lock()
+	ws.vaultBuiltAt = time.Time{}
+	ws.vaultMu.Unlock()
 }
 
 // Search searches all markdown pages for the given query string.
 // It tries FTS5 first, falling back to brute-force regex on error.
+// Matching ignores case and diacritics, following the search locale.
 func (ws *WikiService) Search(ctx context.Context, query string) ([]SearchResult, error) {
 	if query == "" {
 		return nil, nil
 	}
 
 	if ws.db != nil {
-		ftsResults, err := ws.db.SearchPages(ctx, query, 100)
+		ftsQuery := util.FoldSearchText(query, ws.searchLocale())
+		ftsResults, err := ws.db.SearchPages(ctx, ftsQuery, 100)
 		if err == nil && len(ftsResults) > 0 {
 			var results []SearchResult
 			for _, r := range ftsResults {
@@ -118,20 +160,24 @@ func (ws *WikiService) Search(ctx context.Context, query string) ([]SearchResult
 		}
 	}
 
-	return ws.searchBruteForce(query)
+	return ws.searchBruteForce(ctx, query)
 }
 
 // maxSearchResults is the maximum number of search results returned.
 const maxSearchResults = 100
 
 // searchBruteForce performs an O(n) scan of all pages for the query.
-func (ws *WikiService) searchBruteForce(query string) ([]SearchResult, error) {
-	files, _, err := ws.store.List("", nil, nil)
+func (ws *WikiService) searchBruteForce(ctx context.Context, query string) ([]SearchResult, error) {
+	files, _, err := ws.store.List(ctx, "", nil, nil)
 	if err != nil {
 		return nil, err
 	}
 
-	re := regexp.MustCompile("(?i)" + regexp.QuoteMeta(query))
+	// Match the query against both the generically folded page and the
+	// locale-folded page, so "uber" and (for German) "ueber" both find "Über".
+	locale := ws.searchLocale()
+	genericRe := regexp.MustCompile("(?i)" + regexp.QuoteMeta(util.FoldSearchText(query, "")))
+	localeRe := regexp.MustCompile("(?i)" + regexp.QuoteMeta(util.FoldSearchText(query, locale)))
 
 	var results []SearchResult
 	for _, f := range files {
@@ -139,7 +185,7 @@ func (ws *WikiService) searchBruteForce(query string) ([]SearchResult, error) {
 			continue
 		}
 
-		content, err := ws.store.Load(f, "")
+		content, err := ws.store.Load(ctx, f, "")
 		if err != nil {
 			continue
 		}
@@ -147,15 +193,18 @@ func (ws *WikiService) searchBruteForce(query string) ([]SearchResult, error) {
 		pagepath := util.StripMarkdownExtension(f)
 		pagename, body := indexTitleAndBody(pagepath, content)
 
-		matches := re.FindAllStringIndex(body, -1)
-		if len(matches) == 0 {
+		matches := len(genericRe.FindAllStringIndex(util.FoldSearchText(body, ""), -1))
+		if n := len(localeRe.FindAllStringIndex(util.FoldSearchText(body, locale), -1)); n > matches {
+			matches = n
+		}
+		if matches == 0 {
 			continue
 		}
 
 		results = append(results, SearchResult{
 			Pagename:   pagename,
 			Pagepath:   pagepath,
-			MatchCount: len(matches),
+			MatchCount: matches,
 		})
 
 		if len(results) >= maxSearchResults {
@@ -174,17 +223,37 @@ func (ws *WikiService) Backlinks(ctx context.Context, pagepath string) ([]string
 	return ws.db.GetBacklinks(ctx, pagepath)
 }
 
+// Links returns all pages the given page links to.
+func (ws *WikiService) Links(ctx context.Context, pagepath string) ([]string, error) {
+	if ws.db == nil {
+		return nil, nil
+	}
+	return ws.db.GetLinks(ctx, pagepath)
+}
+
+// PageLinks returns the wiki links of every page that has any.
+func (ws *WikiService) PageLinks(ctx context.Context) ([]db.PageLinkData, error) {
+	if ws.db == nil {
+		return nil, nil
+	}
+	return ws.db.ListPageLinks(ctx)
+}
+
 // IndexPage adds or updates a page in the FTS5 search index and page links.
 func (ws *WikiService) IndexPage(ctx context.Context, pagepath, content string) error {
 	if ws.db == nil {
 		return nil
 	}
 	title, body := indexTitleAndBody(pagepath, content)
-	if err := ws.db.UpsertPageIndex(ctx, pagepath, title, body); err != nil {
+	folded := ws.foldedIndexText(pagepath, title, body)
+	if err := ws.db.UpsertPageIndex(ctx, pagepath, title, body, folded); err != nil {
 		return err
 	}
 	targets := renderer.ExtractWikiLinks(body, ws.config.RetainPageNameCase)
-	return ws.db.UpsertPageLinks(ctx, pagepath, targets)
+	if err := ws.db.UpsertPageLinks(ctx, pagepath, targets); err != nil {
+		return err
+	}
+	return ws.indexPageMetadata(ctx, pagepath)
 }
 
 // RemovePageFromIndex removes a page from the FTS5 search index and page links.
@@ -195,10 +264,14 @@ func (ws *WikiService) RemovePageFromIndex(ctx context.Context, pagepath string)
 	if err := ws.db.DeletePageIndex(ctx, pagepath); err != nil {
 		return err
 	}
-	return ws.db.DeletePageLinks(ctx, pagepath)
+	if err := ws.db.DeletePageLinks(ctx, pagepath); err != nil {
+		return err
+	}
+	return ws.indexPageMetadata(ctx, pagepath)
 }
 
-// EnsureSearchIndex rebuilds the FTS5 index from git storage if it is empty.
+// EnsureSearchIndex rebuilds the FTS5 index from git storage if it is empty
+// or was built with a different search locale.
 func (ws *WikiService) EnsureSearchIndex(ctx context.Context) error {
 	if ws.db == nil {
 		return nil
@@ -208,59 +281,71 @@ func (ws *WikiService) EnsureSearchIndex(ctx context.Context) error {
 	if err != nil {
 		return err
 	}
-	if count > 0 {
+	locale := ws.searchLocale()
+	builtWith := ""
+	if pref, err := ws.db.Queries.GetPreference(ctx, searchLocalePreference); err == nil {
+		builtWith = pref.Value.String
+	}
+	if count > 0 && builtWith == locale {
 		return nil
 	}
+	_, err = ws.RebuildSearchIndex(ctx)
+	return err
+}
 
-	files, _, err := ws.store.List("", nil, nil)
-	if err != nil {
-		return err
-	}
+// Changelog returns recent commit history for the entire repository.
+func (ws *WikiService) Changelog(ctx context.Context, maxCount int) ([]storage.CommitMetadata, error) {
+	return ws.store.Log(ctx, "", maxCount)
+}
 
-	var pages []db.PageIndexData
-	var links []db.PageLinkData
-	for _, f := range files {
-		if !util.IsMarkdownFile(f) {
-			continue
-		}
-		content, err := ws.store.Load(f, "")
-		if err != nil {
-			continue
-		}
-		pagepath := util.StripMarkdownExtension(f)
-		title, body := indexTitleAndBody(pagepath, content)
-		pages = append(pages, db.PageIndexData{
-			Pagepath: pagepath,
-			Title:    title,
-			Content:  body,
-		})
-		targets := renderer.ExtractWikiLinks(body, ws.config.RetainPageNameCase)
-		if len(targets) > 0 {
-			links = append(links, db.PageLinkData{
-				Source:  pagepath,
-				Targets: targets,
-			})
-		}
-	}
+// QueryChangelog returns repository history filtered and paginated by query.
+func (ws *WikiService) QueryChangelog(ctx context.Context, query storage.LogQuery) ([]storage.CommitMetadata, error) {
+	return ws.store.QueryLog(ctx, query)
+}
 
-	if len(pages) == 0 {
-		return nil
-	}
+// recentAttachmentCommits bounds how far back RecentAttachments looks.
+const recentAttachmentCommits = 200
 
-	if err := ws.db.RebuildPageIndex(ctx, pages); err != nil {
-		return err
+// RecentAttachments returns up to limit of the most recently committed
+// attachments across the wiki, newest first, optionally filtered by a
+// case-insensitive filename substring. Files that have since been deleted
+// and files at the repository root (which belong to no page) are skipped.
+func (ws *WikiService) RecentAttachments(ctx context.Context, query string, limit int) ([]Attachment, error) {
+	commits, err := ws.store.QueryLog(ctx, storage.LogQuery{Limit: recentAttachmentCommits})
+	if err != nil {
+		return nil, err
 	}
-	return ws.db.RebuildPageLinks(ctx, links)
-}
 
-// Changelog returns recent commit history for the entire repository.
-func (ws *WikiService) Changelog(ctx context.Context, maxCount int) ([]storage.CommitMetadata, error) {
-	return ws.store.Log("", maxCount)
+	query = strings.ToLower(query)
+	seen := make(map[string]bool)
+	attachments := []Attachment{}
+	for _, c := range commits {
+		for _, f := range c.Files {
+			if seen[f] {
+				continue
+			}
+			seen[f] = true
+
+			dir := util.GetPageDirectoryname(f)
+			name := strings.TrimPrefix(f, dir+"/")
+			if dir == "" || util.IsMarkdownFile(f) || !strings.Contains(strings.ToLower(name), query) {
+				continue
+			}
+			if !ws.store.Exists(ctx, f) {
+				continue
+			}
+			attachments = append(attachments, *NewAttachment(ws.store, dir, name, ""))
+			if limit > 0 && len(attachments) >= limit {
+				return attachments, nil
+			}
+		}
+	}
+	return attachments, nil
 }
 
 // PageIndex lists all markdown pages in the repository.
 func (ws *WikiService) PageIndex(ctx context.Context) ([]PageIndexEntry, error) {
-	files, _, err := ws.store.List("", nil, nil)
+	files, _, err := ws.store.List(ctx, "", nil, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -335,11 +420,29 @@ func (ws *WikiService) buildPageTree(ctx context.Context) ([]*PageTreeNode, erro
 		return current
 	}
 
+	var titles map[string]string
+	if ws.db != nil {
+		if titles, err = ws.db.PageTitles(ctx); err != nil {
+			slog.Warn("failed to load page titles", "error", err)
+		}
+	}
 	for _, e := range entries {
 		node := ensureNode(e.Path)
 		node.Name = e.Name
 		node.IsPage = true
+		node.Title = titles[e.Path]
+	}
+	// Directories without a page are titled by name.
+	var titleTree func(nodes []*PageTreeNode)
+	titleTree = func(nodes []*PageTreeNode) {
+		for _, n := range nodes {
+			if n.Title == "" {
+				n.Title = n.Name
+			}
+			titleTree(n.Children)
+		}
 	}
+	titleTree(root.Children)
 
 	// Sort children alphabetically at every level.
 	var sortTree func(nodes []*PageTreeNode)
@@ -360,12 +463,30 @@ func (ws *WikiService) buildPageTree(ctx context.Context) ([]*PageTreeNode, erro
 
 // ShowCommit returns metadata and diff for a specific commit.
 func (ws *WikiService) ShowCommit(ctx context.Context, revision string) (*storage.CommitMetadata, string, error) {
-	return ws.store.ShowCommit(revision)
+	return ws.store.ShowCommit(ctx, revision)
 }
 
 // Revert reverts a commit.
 func (ws *WikiService) Revert(ctx context.Context, revision, message string, author storage.Author) error {
-	return ws.store.Revert(revision, message, author)
+	return ws.store.Revert(ctx, revision, message, author)
+}
+
+// RestorePage saves the content a page had at revision as its new version,
+// keeping the history in between. It recreates a page deleted since. The
+// message defaults to one naming the revision; storage.ErrNotFound means the
+// page did not exist at revision.
+func (ws *WikiService) RestorePage(ctx context.Context, pagepath, revision, message string, author storage.Author) (*SavePageResult, error) {
+	old, err := NewPage(ctx, ws.store, ws.config, pagepath, revision)
+	if err != nil {
+		return nil, err
+	}
+	if revision == "" || !old.Exists {
+		return nil, storage.ErrNotFound
+	}
+	if message == "" {
+		message = "Restored " + old.Pagename + " to revision " + revision
+	}
+	return ws.SavePage(ctx, pagepath, old.Content, message, "", author)
 }
 
 // SavePageResult holds the outcome of a SavePage operation.
@@ -380,7 +501,7 @@ type SavePageResult struct {
 // If baseRevision is non-empty and doesn't match the current HEAD revision,
 // a conflict is returned without saving.
 func (ws *WikiService) SavePage(ctx context.Context, pagepath, content, message, baseRevision string, author storage.Author) (*SavePageResult, error) {
-	page, err := NewPage(ws.store, ws.config, pagepath, "")
+	page, err := NewPage(ctx, ws.store, ws.config, pagepath, "")
 	if err != nil {
 		return nil, err
 	}
@@ -400,7 +521,15 @@ func (ws *WikiService) SavePage(ctx context.Context, pagepath, content, message,
 		}
 	}
 
-	changed, err := page.Save(content, message, author)
+	ev := SaveEvent{Pagepath: page.Pagepath, Content: content, Message: message, Author: author, IsNew: isNew}
+	if ws.hooks != nil {
+		if err := ws.hooks.BeforeSave(ctx, &ev); err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrSaveRejected, err)
+		}
+		content, message = ev.Content, ev.Message
+	}
+
+	changed, err := page.Save(ctx, content, message, author)
 	if err != nil {
 		return nil, err
 	}
@@ -413,12 +542,17 @@ func (ws *WikiService) SavePage(ctx context.Context, pagepath, content, message,
 		ws.InvalidatePageTreeCache()
 	}
 
+	if ws.hooks != nil {
+		ev.Changed = changed
+		ws.hooks.AfterSave(ctx, ev)
+	}
+
 	return &SavePageResult{Page: page, Changed: changed, IsNew: isNew}, nil
 }
 
 // DeletePage deletes a wiki page (and its attachments) and removes it from the search index.
 func (ws *WikiService) DeletePage(ctx context.Context, pagepath, message string, author storage.Author) error {
-	page, err := NewPage(ws.store, ws.config, pagepath, "")
+	page, err := NewPage(ctx, ws.store, ws.config, pagepath, "")
 	if err != nil {
 		return err
 	}
@@ -431,7 +565,7 @@ func (ws *WikiService) DeletePage(ctx context.Context, pagepath, message string,
 		message = page.Pagename + " deleted."
 	}
 
-	if err := page.Delete(message, author, true); err != nil {
+	if err := page.Delete(ctx, message, author, true); err != nil {
 		return err
 	}
 
@@ -446,5 +580,5 @@ func (ws *WikiService) DeletePage(ctx context.Context, pagepath, message string,
 
 // Diff returns the diff between two revisions.
 func (ws *WikiService) Diff(ctx context.Context, revA, revB string) (string, error) {
-	return ws.store.Diff(revA, revB)
+	return ws.store.Diff(ctx, revA, revB)
 }
@@ -2,8 +2,10 @@ package wiki
 
 import (
 	"context"
+	"errors"
 	"os"
 	"testing"
+	"time"
 
 	"github.com/sa/gopherwiki/internal/config"
 	"github.com/sa/gopherwiki/internal/db"
@@ -41,10 +43,10 @@ func setupTestService(t *testing.T) (*WikiService, func()) {
 	author := storage.Author{Name: "Test User", Email: "test@example.com"}
 
 	// Create some test pages
-	store.Store("home.md", "# Home\nWelcome to the wiki.\n", "Create home", author)
-	store.Store("about.md", "# About\nThis is the about page.\n", "Create about", author)
-	store.Store("guide.md", "# User Guide\nHow to use the wiki.\n", "Create guide", author)
-	store.Store(".hidden.md", "# Hidden\nShould still be indexed.\n", "Create hidden", author)
+	store.Store(context.Background(), "home.md", "# Home\nWelcome to the wiki.\n", "Create home", author)
+	store.Store(context.Background(), "about.md", "# About\nThis is the about page.\n", "Create about", author)
+	store.Store(context.Background(), "guide.md", "# User Guide\nHow to use the wiki.\n", "Create guide", author)
+	store.Store(context.Background(), ".hidden.md", "# Hidden\nShould still be indexed.\n", "Create hidden", author)
 
 	ws := NewWikiService(store, cfg, database)
 	cleanup := func() {
@@ -61,7 +63,7 @@ func TestWikiServiceSearch(t *testing.T) {
 	ctx := context.Background()
 
 	t.Run("empty query returns nil", func(t *testing.T) {
-		results, err := ws.Search(context.Background(), "")
+		results, err := ws.Search(ctx, "")
 		if err != nil {
 			t.Fatalf("Search returned error: %v", err)
 		}
@@ -71,7 +73,7 @@ func TestWikiServiceSearch(t *testing.T) {
 	})
 
 	t.Run("query matching multiple pages", func(t *testing.T) {
-		results, err := ws.Search(context.Background(), "the")
+		results, err := ws.Search(ctx, "the")
 		if err != nil {
 			t.Fatalf("Search returned error: %v", err)
 		}
@@ -97,7 +99,7 @@ func TestWikiServiceSearch(t *testing.T) {
 	})
 
 	t.Run("case insensitive search", func(t *testing.T) {
-		results, err := ws.Search(context.Background(), "welcome")
+		results, err := ws.Search(ctx, "welcome")
 		if err != nil {
 			t.Fatalf("Search returned error: %v", err)
 		}
@@ -107,7 +109,7 @@ func TestWikiServiceSearch(t *testing.T) {
 	})
 
 	t.Run("no matches returns empty slice", func(t *testing.T) {
-		results, err := ws.Search(context.Background(), "nonexistentterm12345")
+		results, err := ws.Search(ctx, "nonexistentterm12345")
 		if err != nil {
 			t.Fatalf("Search returned error: %v", err)
 		}
@@ -227,6 +229,40 @@ func TestWikiServiceDiff(t *testing.T) {
 
 // --- FTS5 search index tests ---
 
+func TestWikiServiceRestorePage(t *testing.T) {
+	ws, cleanup := setupTestService(t)
+	defer cleanup()
+	ctx := context.Background()
+	author := storage.Author{Name: "Test User", Email: "test@example.com"}
+
+	if _, err := ws.SavePage(ctx, "restored", "# Kept\n", "", "", author); err != nil {
+		t.Fatal(err)
+	}
+	log, _ := ws.store.Log(ctx, "restored.md", 1)
+	if err := ws.DeletePage(ctx, "restored", "", author); err != nil {
+		t.Fatal(err)
+	}
+
+	// A deleted page is recreated, and found by search again.
+	result, err := ws.RestorePage(ctx, "restored", log[0].Revision, "", author)
+	if err != nil {
+		t.Fatalf("RestorePage: %v", err)
+	}
+	if !result.Changed || !result.IsNew {
+		t.Errorf("RestorePage result = %+v, want a new page", result)
+	}
+	if content, _ := ws.store.Load(ctx, "restored.md", ""); content != "# Kept\n" {
+		t.Errorf("restored content = %q", content)
+	}
+	if results, _ := ws.Search(ctx, "Kept"); len(results) == 0 {
+		t.Error("restored page is not in the search index")
+	}
+
+	if _, err := ws.RestorePage(ctx, "restored", "nosuchrev", "", author); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("RestorePage of an unknown revision = %v, want ErrNotFound", err)
+	}
+}
+
 func TestFTS5Search_Basic(t *testing.T) {
 	ws, cleanup := setupTestService(t)
 	defer cleanup()
@@ -296,6 +332,78 @@ func TestFTS5Search_FallbackOnEmpty(t *testing.T) {
 	}
 }
 
+func TestSearch_FoldsDiacritics(t *testing.T) {
+	cases := []struct {
+		locale  string
+		content string
+		query   string
+	}{
+		{"en", "# Über uns\nAbout the team.\n", "uber"},
+		{"de", "# Über uns\nAbout the team.\n", "uber"},
+		{"de", "# Über uns\nAbout the team.\n", "ueber"},
+		{"de", "# Team\nHerr Mueller leads it.\n", "Müller"},
+		{"en", "# Straße\nStreet names.\n", "strasse"},
+		{"fr", "# Équipe\nNotre café.\n", "equipe"},
+		{"fr", "# Team\nNotre cafe.\n", "café"},
+		{"es", "# Mañana\nPlanes.\n", "manana"},
+		{"da", "# Lærer\nPå Ærø.\n", "aeroe"},
+		{"pl", "# Łódź\nMiasto.\n", "lodz"},
+	}
+
+	for _, tc := range cases {
+		for _, useFTS := range []bool{true, false} {
+			ws, cleanup := setupTestService(t)
+			ws.config.SearchLocale = tc.locale
+			ctx := context.Background()
+
+			// Only one backend sees the page, so a hit proves that backend folds.
+			if useFTS {
+				if err := ws.IndexPage(ctx, "folded", tc.content); err != nil {
+					t.Fatalf("IndexPage failed: %v", err)
+				}
+			} else {
+				ws.store.Store(context.Background(), "folded.md", tc.content, "add", storage.Author{Name: "Test", Email: "test@example.com"})
+			}
+
+			results, err := ws.Search(ctx, tc.query)
+			cleanup()
+			if err != nil {
+				t.Fatalf("Search returned error: %v", err)
+			}
+			if len(results) != 1 || results[0].Pagepath != "folded" {
+				t.Errorf("locale %q, fts=%v: Search(%q) over %q = %+v, want the folded page",
+					tc.locale, useFTS, tc.query, tc.content, results)
+			}
+		}
+	}
+}
+
+func TestEnsureSearchIndex_RebuildsOnLocaleChange(t *testing.T) {
+	ws, cleanup := setupTestService(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	ws.store.Store(ctx, "about-us.md", "# Über uns\n", "add", storage.Author{Name: "Test", Email: "test@example.com"})
+	if err := ws.EnsureSearchIndex(ctx); err != nil {
+		t.Fatalf("EnsureSearchIndex failed: %v", err)
+	}
+	if results, _ := ws.db.SearchPages(ctx, "ueber", 10); len(results) != 0 {
+		t.Fatalf("English index should not transliterate umlauts, got %+v", results)
+	}
+
+	ws.config.SearchLocale = "de"
+	if err := ws.EnsureSearchIndex(ctx); err != nil {
+		t.Fatalf("EnsureSearchIndex failed: %v", err)
+	}
+	results, err := ws.db.SearchPages(ctx, "ueber", 10)
+	if err != nil {
+		t.Fatalf("SearchPages failed: %v", err)
+	}
+	if len(results) != 1 {
+		t.Errorf("index should be rebuilt for the new locale, got %d results", len(results))
+	}
+}
+
 func TestIndexTitleAndBody(t *testing.T) {
 	cases := []struct {
 		name      string
@@ -536,7 +644,7 @@ func TestBacklinks_EnsureSearchIndex(t *testing.T) {
 	author := storage.Author{Name: "Test", Email: "test@example.com"}
 
 	// Create pages with wikilinks in git storage
-	ws.store.Store("links.md", "# Links\nSee [[home]] and [[about]].\n", "Create links", author)
+	ws.store.Store(ctx, "links.md", "# Links\nSee [[home]] and [[about]].\n", "Create links", author)
 
 	// EnsureSearchIndex should also populate page_links
 	if err := ws.EnsureSearchIndex(ctx); err != nil {
@@ -551,3 +659,55 @@ func TestBacklinks_EnsureSearchIndex(t *testing.T) {
 		t.Errorf("Expected [links] backlink for home, got %v", backlinks)
 	}
 }
+
+func TestPageTemplates(t *testing.T) {
+	ws, cleanup := setupTestService(t)
+	defer cleanup()
+	ctx := context.Background()
+	author := storage.Author{Name: "Test User", Email: "test@example.com"}
+
+	ws.store.Store(ctx, "templates/meeting-notes.md", "# {{title}}\n\nDate: {{date}}\nBy: {{author}}\n{{unknown}}\n", "Add template", author)
+	ws.store.Store(ctx, "templates/adr.md", "# ADR: {{title}} ({{pagepath}})\n", "Add template", author)
+
+	templates, err := ws.PageTemplates(ctx)
+	if err != nil {
+		t.Fatalf("PageTemplates error: %v", err)
+	}
+	if len(templates) != 2 || templates[0].Path != "templates/adr" || templates[1].Path != "templates/meeting-notes" {
+		t.Fatalf("PageTemplates = %+v, want adr and meeting-notes, sorted by name", templates)
+	}
+
+	vars := TemplateVars{
+		Title:    "Standup",
+		Pagepath: "meetings/standup",
+		Author:   "Alice",
+		Now:      time.Date(2026, 1, 15, 14, 30, 0, 0, time.UTC),
+	}
+	content, err := ws.ApplyTemplate(ctx, "templates/meeting-notes", vars)
+	if err != nil {
+		t.Fatalf("ApplyTemplate error: %v", err)
+	}
+	want := "# Standup\n\nDate: 2026-01-15\nBy: Alice\n{{unknown}}\n"
+	if content != want {
+		t.Errorf("ApplyTemplate = %q, want %q", content, want)
+	}
+
+	for _, path := range []string{"templates/missing", "home", "templates/../home"} {
+		if _, err := ws.ApplyTemplate(ctx, path, vars); !errors.Is(err, ErrTemplateNotFound) {
+			t.Errorf("ApplyTemplate(%q) error = %v, want ErrTemplateNotFound", path, err)
+		}
+	}
+}
+
+func TestPageTemplates_None(t *testing.T) {
+	ws, cleanup := setupTestService(t)
+	defer cleanup()
+
+	templates, err := ws.PageTemplates(context.Background())
+	if err != nil {
+		t.Fatalf("PageTemplates error: %v", err)
+	}
+	if len(templates) != 0 {
+		t.Errorf("PageTemplates = %+v, want none", templates)
+	}
+}
@@ -0,0 +1,63 @@
+package wiki
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/sa/gopherwiki/internal/util"
+)
+
+// StalePage is a page due for review: past the review date its frontmatter
+// sets, or not updated for a while.
+type StalePage struct {
+	Path        string
+	Title       string
+	Revision    string // Full hash of the page's last commit
+	AuthorName  string // Author of the page's last commit
+	AuthorEmail string
+	Updated     time.Time
+	ReviewBy    time.Time // Zero when the page sets no review date
+	Due         time.Time // When the page became stale
+	Overdue     bool      // Whether it is past its review date, rather than just old
+}
+
+// StalePages returns the pages due for review at now, longest due first:
+// those whose review_by date has passed, and, unless months is 0, those
+// without one not updated for that many months. It reads the page metadata
+// cache.
+func (ws *WikiService) StalePages(ctx context.Context, now time.Time, months int) ([]StalePage, error) {
+	pages, err := ws.PageMetadata(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var stale []StalePage
+	for _, m := range pages {
+		p := StalePage{
+			Path:        m.Pagepath,
+			Title:       m.Title,
+			Revision:    m.Revision,
+			AuthorName:  m.AuthorName,
+			AuthorEmail: m.AuthorEmail,
+			Updated:     m.Updated,
+			ReviewBy:    m.ReviewBy,
+		}
+		if p.Title == "" {
+			p.Title = util.GetPagename(m.Pagepath, false)
+		}
+		switch {
+		case !m.ReviewBy.IsZero():
+			if !m.ReviewBy.Before(now) {
+				continue
+			}
+			p.Due, p.Overdue = m.ReviewBy, true
+		case months > 0 && !m.Updated.IsZero() && m.Updated.AddDate(0, months, 0).Before(now):
+			p.Due = m.Updated.AddDate(0, months, 0)
+		default:
+			continue
+		}
+		stale = append(stale, p)
+	}
+	sort.SliceStable(stale, func(i, j int) bool { return stale[i].Due.Before(stale[j].Due) })
+	return stale, nil
+}
@@ -0,0 +1,62 @@
+package wiki
+
+import (
+	"context"
+	"strings"
+	"unicode"
+
+	"github.com/sa/gopherwiki/internal/util"
+)
+
+// maxSuggestions is the number of pages Suggest returns at most.
+const maxSuggestions = 5
+
+// suggestPrefixLen is the number of leading runes of each word of a missing
+// page's path that Suggest matches, so that misspellings past them, and
+// other endings of the same word, still match.
+const suggestPrefixLen = 5
+
+// Suggest returns the pages nearest to the missing page at pagepath, best
+// first, for "did you mean" links. It searches the search index for the
+// words of the path, each as a prefix, and returns nothing without one.
+func (ws *WikiService) Suggest(ctx context.Context, pagepath string) ([]SearchResult, error) {
+	if ws.db == nil {
+		return nil, nil
+	}
+	words := strings.FieldsFunc(util.FoldSearchText(pagepath, ws.searchLocale()), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	var terms []string
+	seen := make(map[string]bool)
+	for _, w := range words {
+		if r := []rune(strings.ToLower(w)); len(r) >= 2 {
+			if len(r) > suggestPrefixLen {
+				r = r[:suggestPrefixLen]
+			}
+			if term := `"` + string(r) + `"*`; !seen[term] {
+				seen[term] = true
+				terms = append(terms, term)
+			}
+		}
+	}
+	if len(terms) == 0 {
+		return nil, nil
+	}
+
+	found, err := ws.db.SearchPages(ctx, strings.Join(terms, " OR "), maxSuggestions+1)
+	if err != nil {
+		return nil, err
+	}
+	var results []SearchResult
+	for _, r := range found {
+		if strings.EqualFold(r.Pagepath, pagepath) || len(results) == maxSuggestions {
+			continue
+		}
+		pagename := r.Title
+		if pagename == "" {
+			pagename = util.GetPagename(r.Pagepath, false)
+		}
+		results = append(results, SearchResult{Pagename: pagename, Pagepath: r.Pagepath, Snippet: r.Snippet, MatchCount: 1})
+	}
+	return results, nil
+}
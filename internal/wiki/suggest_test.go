@@ -0,0 +1,86 @@
+package wiki
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestSuggest(t *testing.T) {
+	ws, cleanup := setupTestService(t)
+	defer cleanup()
+	ctx := context.Background()
+	if _, err := ws.RebuildSearchIndex(ctx); err != nil {
+		t.Fatalf("RebuildSearchIndex: %v", err)
+	}
+
+	tests := []struct {
+		pagepath string
+		want     string
+	}{
+		{"guides", "guide"},
+		{"user-gude", "guide"},
+		{"abuot", ""},
+		{"--", ""},
+	}
+	for _, tt := range tests {
+		results, err := ws.Suggest(ctx, tt.pagepath)
+		if err != nil {
+			t.Fatalf("Suggest(%q): %v", tt.pagepath, err)
+		}
+		if tt.want == "" {
+			if len(results) != 0 {
+				t.Errorf("Suggest(%q) = %v, want none", tt.pagepath, results)
+			}
+			continue
+		}
+		if len(results) == 0 || results[0].Pagepath != tt.want {
+			t.Errorf("Suggest(%q) = %v, want %s first", tt.pagepath, results, tt.want)
+		}
+	}
+
+	if results, _ := ws.Suggest(ctx, "guide"); len(results) != 0 {
+		t.Errorf("Suggest of an existing page = %v, want the page itself left out", results)
+	}
+}
+
+func TestCompletePages(t *testing.T) {
+	ws, cleanup := setupTestService(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{"gu", []string{"guide"}},
+		{"USER", []string{"guide"}},
+		{"o", []string{"home", "about"}},
+		{"bou", []string{"about"}},
+		{"nothing", nil},
+	}
+	for _, tt := range tests {
+		got, err := ws.CompletePages(ctx, tt.query, 10)
+		if err != nil {
+			t.Fatalf("CompletePages(%q): %v", tt.query, err)
+		}
+		var paths []string
+		for _, c := range got {
+			paths = append(paths, c.Path)
+		}
+		if strings.Join(paths, ",") != strings.Join(tt.want, ",") {
+			t.Errorf("CompletePages(%q) = %v, want %v", tt.query, paths, tt.want)
+		}
+	}
+
+	got, err := ws.CompletePages(ctx, "", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 {
+		t.Errorf("CompletePages with no query = %v, want the 2 latest pages", got)
+	}
+	if got, _ := ws.CompletePages(ctx, "guide", 1); len(got) != 1 || got[0].Title != "User Guide" {
+		t.Errorf("CompletePages(guide) = %v, want the page's title", got)
+	}
+}
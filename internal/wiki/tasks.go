@@ -0,0 +1,108 @@
+package wiki
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/sa/gopherwiki/internal/frontmatter"
+	"github.com/sa/gopherwiki/internal/renderer"
+	"github.com/sa/gopherwiki/internal/storage"
+	"github.com/sa/gopherwiki/internal/util"
+)
+
+// OpenTask is an unchecked task list item on a wiki page.
+type OpenTask struct {
+	Pagepath string
+	Pagename string
+	Line     int // 1-based line in the page source, frontmatter included
+	Text     string
+}
+
+// OpenTasks lists the unchecked task list items across all pages, grouped by
+// page in page index order.
+func (ws *WikiService) OpenTasks(ctx context.Context, r *renderer.Renderer) ([]OpenTask, error) {
+	files, _, err := ws.store.List(ctx, "", nil, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var tasks []OpenTask
+	for _, f := range files {
+		if !util.IsMarkdownFile(f) {
+			continue
+		}
+		content, err := ws.store.Load(ctx, f, "")
+		if err != nil {
+			slog.Warn("failed to load page for tasks", "file", f, "error", err)
+			continue
+		}
+		// Cheap pre-filter: a page without an unchecked box has no open task.
+		if !strings.Contains(content, "[ ]") {
+			continue
+		}
+		pagepath := util.StripMarkdownExtension(f)
+		_, body := frontmatter.Parse(content)
+		offset := bodyLineOffset(content, body)
+		for _, task := range r.Tasks(body) {
+			if task.Checked {
+				continue
+			}
+			tasks = append(tasks, OpenTask{
+				Pagepath: pagepath,
+				Pagename: util.GetPagename(pagepath, false),
+				Line:     task.Line + offset,
+				Text:     task.Text,
+			})
+		}
+	}
+	return tasks, nil
+}
+
+// SetTask checks or unchecks the task list item on the given 1-based line of
+// the page body (the line a rendered checkbox carries) and commits the change.
+// As with SavePage, a non-empty baseRevision that is not the page's current
+// revision yields a conflict. It returns renderer.ErrNotATask if the line holds
+// no task item, and storage.ErrNotFound if the page does not exist.
+func (ws *WikiService) SetTask(ctx context.Context, r *renderer.Renderer, pagepath string, line int, done bool, baseRevision string, author storage.Author) (*SavePageResult, error) {
+	page, err := NewPage(ctx, ws.store, ws.config, pagepath, "")
+	if err != nil {
+		return nil, err
+	}
+	if !page.Exists {
+		return nil, storage.ErrNotFound
+	}
+
+	// Only a line the renderer shows as a task may be toggled; a matching
+	// line inside a code block is just text.
+	var task *renderer.Task
+	for _, t := range r.Tasks(page.Body) {
+		if t.Line == line {
+			task = &t
+			break
+		}
+	}
+	if task == nil {
+		return nil, renderer.ErrNotATask
+	}
+
+	content, err := renderer.SetTaskState(page.Content, line+bodyLineOffset(page.Content, page.Body), done)
+	if err != nil {
+		return nil, err
+	}
+
+	verb := "Unchecked"
+	if done {
+		verb = "Checked"
+	}
+	message := fmt.Sprintf("%s task on %s: %s", verb, page.Pagename, task.Text)
+	return ws.SavePage(ctx, page.Pagepath, content, message, baseRevision, author)
+}
+
+// bodyLineOffset returns the number of lines the frontmatter block takes up
+// in content. frontmatter.Parse returns the body as a suffix of content, so a
+// body line plus the offset is the same line in content.
+func bodyLineOffset(content, body string) int {
+	return strings.Count(content[:len(content)-len(body)], "\n")
+}
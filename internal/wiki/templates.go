@@ -0,0 +1,93 @@
+package wiki
+
+import (
+	"context"
+	"errors"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sa/gopherwiki/internal/util"
+)
+
+// TemplatesNamespace is the directory holding page templates. Every page in
+// it can be picked as the starting content of a new page.
+const TemplatesNamespace = "templates"
+
+// ErrTemplateNotFound is returned when a page template does not exist.
+var ErrTemplateNotFound = errors.New("page template not found")
+
+// PageTemplate is a page in the templates namespace.
+type PageTemplate struct {
+	Name string // Display name, e.g. "Meeting Notes"
+	Path string // Page path, e.g. "templates/meeting-notes"
+}
+
+// TemplateVars are the values substituted into a page template.
+type TemplateVars struct {
+	Title    string // Name of the page being created
+	Pagepath string
+	Author   string
+	Now      time.Time
+}
+
+// PageTemplates lists the page templates, sorted by name.
+func (ws *WikiService) PageTemplates(ctx context.Context) ([]PageTemplate, error) {
+	files, _, err := ws.store.List(ctx, TemplatesNamespace, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var templates []PageTemplate
+	for _, f := range files {
+		if !util.IsMarkdownFile(f) {
+			continue
+		}
+		pagepath := TemplatesNamespace + "/" + util.StripMarkdownExtension(f)
+		templates = append(templates, PageTemplate{
+			Name: util.GetPagename(pagepath, false),
+			Path: pagepath,
+		})
+	}
+	sort.Slice(templates, func(i, j int) bool {
+		return strings.ToLower(templates[i].Name) < strings.ToLower(templates[j].Name)
+	})
+	return templates, nil
+}
+
+// ApplyTemplate returns the content of the page template at templatePath
+// with its variables substituted:
+//
+//	{{title}}     name of the new page
+//	{{pagepath}}  path of the new page
+//	{{author}}    name of the author creating it
+//	{{date}}      current date, e.g. 2026-01-15
+//	{{time}}      current time, e.g. 14:30
+//	{{datetime}}  both, e.g. 2026-01-15 14:30
+//
+// Anything else in double braces is left as is. It returns
+// ErrTemplateNotFound unless templatePath names an existing page in the
+// templates namespace.
+func (ws *WikiService) ApplyTemplate(ctx context.Context, templatePath string, vars TemplateVars) (string, error) {
+	templatePath = path.Clean(util.SanitizePagename(templatePath, true))
+	if !strings.HasPrefix(strings.ToLower(templatePath), TemplatesNamespace+"/") {
+		return "", ErrTemplateNotFound
+	}
+	page, err := NewPage(ctx, ws.store, ws.config, templatePath, "")
+	if err != nil {
+		return "", err
+	}
+	if !page.Exists {
+		return "", ErrTemplateNotFound
+	}
+
+	return strings.NewReplacer(
+		"{{title}}", vars.Title,
+		"{{pagepath}}", vars.Pagepath,
+		"{{author}}", vars.Author,
+		"{{date}}", vars.Now.Format("2006-01-02"),
+		"{{time}}", vars.Now.Format("15:04"),
+		"{{datetime}}", vars.Now.Format("2006-01-02 15:04"),
+	).Replace(page.Content), nil
+}
@@ -0,0 +1,228 @@
+package wiki
+
+import (
+	"context"
+	"log/slog"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/sa/gopherwiki/internal/frontmatter"
+	"github.com/sa/gopherwiki/internal/util"
+)
+
+// vaultIndex maps the names that Obsidian links use onto repository paths.
+// Obsidian links pages by name and finds attachments anywhere in the vault,
+// so resolving a link needs a view of the whole repository. The index is
+// cached like the page tree.
+type vaultIndex struct {
+	pages     map[string][]string // name key -> page paths with that name
+	pagePaths map[string]string   // path key -> page path
+	sources   map[string]string   // page path -> source file
+	aliases   map[string]string   // name key -> page path
+	files     map[string][]string // lowercased file name -> attachment paths
+	filePaths map[string]string   // lowercased path -> attachment path
+}
+
+// vaultKey normalizes a page name or path for lookup. Obsidian names keep
+// their spaces where wiki links use hyphens, and neither is case-sensitive.
+func vaultKey(name string) string {
+	return strings.ToLower(strings.ReplaceAll(strings.TrimSpace(name), "-", " "))
+}
+
+// vault returns the cached vault index, rebuilding it when it is stale. The
+// index is shared, so it is built to the end even if ctx is canceled.
+func (ws *WikiService) vault(ctx context.Context) *vaultIndex {
+	ws.vaultMu.Lock()
+	defer ws.vaultMu.Unlock()
+	if ws.vaultCache != nil && time.Since(ws.vaultBuiltAt) < pageTreeCacheTTL {
+		return ws.vaultCache
+	}
+	ws.vaultCache = ws.buildVaultIndex(context.WithoutCancel(ctx))
+	ws.vaultBuiltAt = time.Now()
+	return ws.vaultCache
+}
+
+// buildVaultIndex indexes every page and attachment, and the aliases in the
+// pages' frontmatter. Hidden directories such as .obsidian and .trash are
+// left out.
+func (ws *WikiService) buildVaultIndex(ctx context.Context) *vaultIndex {
+	idx := &vaultIndex{
+		pages:     make(map[string][]string),
+		pagePaths: make(map[string]string),
+		sources:   make(map[string]string),
+		aliases:   make(map[string]string),
+		files:     make(map[string][]string),
+		filePaths: make(map[string]string),
+	}
+	files, _, err := ws.store.List(ctx, "", nil, nil)
+	if err != nil {
+		slog.Warn("failed to list repository for link resolution", "error", err)
+		return idx
+	}
+
+	var pages []string
+	for _, f := range files {
+		f = filepath.ToSlash(f)
+		if hasDotSegment(f) {
+			continue
+		}
+		if util.IsMarkdownFile(f) {
+			pagepath := util.StripMarkdownExtension(f)
+			key := vaultKey(path.Base(pagepath))
+			idx.pages[key] = append(idx.pages[key], pagepath)
+			idx.pagePaths[vaultKey(pagepath)] = pagepath
+			idx.sources[pagepath] = f
+			pages = append(pages, pagepath)
+			continue
+		}
+		name := strings.ToLower(path.Base(f))
+		idx.files[name] = append(idx.files[name], f)
+		idx.filePaths[strings.ToLower(f)] = f
+	}
+
+	for _, pagepath := range pages {
+		content, err := ws.store.Load(ctx, idx.sources[pagepath], "")
+		if err != nil {
+			continue
+		}
+		fm, _ := frontmatter.Parse(content)
+		if fm == nil {
+			continue
+		}
+		for _, alias := range fm.Aliases {
+			if key := vaultKey(alias); idx.aliases[key] == "" {
+				idx.aliases[key] = pagepath
+			}
+		}
+	}
+	return idx
+}
+
+// ResolvePage returns the page that an Obsidian link target names, as seen
+// from the page at from. A target with a slash is a path, relative to from's
+// folder or to the root; otherwise it is a page name, and when several pages
+// share it the nearest wins. Frontmatter aliases are tried last. It
+// implements renderer.Resolver.
+func (ws *WikiService) ResolvePage(target, from string) (string, bool) {
+	target = util.StripMarkdownExtension(strings.Trim(strings.TrimSpace(target), "/"))
+	if target == "" {
+		return "", false
+	}
+	idx := ws.vault(context.Background())
+	isPath := strings.Contains(target, "/")
+	if isPath {
+		for _, candidate := range []string{path.Join(path.Dir(from), target), target} {
+			if p, ok := idx.pagePaths[vaultKey(candidate)]; ok {
+				return p, true
+			}
+		}
+	}
+
+	var candidates []string
+	for _, p := range idx.pages[vaultKey(path.Base(target))] {
+		if !isPath || strings.HasSuffix(vaultKey(p), "/"+vaultKey(target)) {
+			candidates = append(candidates, p)
+		}
+	}
+	if p, ok := nearestPath(candidates, from); ok {
+		return p, true
+	}
+	p, ok := idx.aliases[vaultKey(target)]
+	return p, ok
+}
+
+// ResolveFile returns the attachment that an Obsidian embed names, as seen
+// from the page at from. Vaults keep attachments next to the note, in an
+// attachment folder, or anywhere else, so a bare file name is looked up
+// across the repository, preferring the file nearest the page. It implements
+// renderer.Resolver.
+func (ws *WikiService) ResolveFile(name, from string) (string, bool) {
+	name = strings.Trim(strings.TrimSpace(name), "/")
+	if name == "" {
+		return "", false
+	}
+	idx := ws.vault(context.Background())
+	isPath := strings.Contains(name, "/")
+	if isPath {
+		for _, candidate := range []string{path.Join(from, name), path.Join(path.Dir(from), name), name} {
+			if f, ok := idx.filePaths[strings.ToLower(candidate)]; ok {
+				return f, true
+			}
+		}
+	}
+
+	var candidates []string
+	for _, f := range idx.files[strings.ToLower(path.Base(name))] {
+		if !isPath || strings.HasSuffix(strings.ToLower(f), "/"+strings.ToLower(name)) {
+			candidates = append(candidates, f)
+		}
+	}
+	return nearestPath(candidates, from)
+}
+
+// PageSource returns the body of a page without its frontmatter, for
+// embedding. Computational pages are not embedded. It implements
+// renderer.Resolver.
+func (ws *WikiService) PageSource(pagepath string) (string, bool) {
+	source, ok := ws.vault(context.Background()).sources[pagepath]
+	if !ok || util.IsQuartoFile(source) {
+		return "", false
+	}
+	content, err := ws.store.Load(context.Background(), source, "")
+	if err != nil {
+		return "", false
+	}
+	_, body := frontmatter.Parse(content)
+	return body, true
+}
+
+// PageFile returns the file holding the page at pagepath.
+func (ws *WikiService) PageFile(pagepath string) (string, bool) {
+	file, ok := ws.vault(context.Background()).sources[pagepath]
+	return file, ok
+}
+
+// AliasTarget returns the page that declares name as one of its frontmatter
+// aliases, or that is named name somewhere in the repository. It lets a
+// link to a page that does not exist at its path land on the page meant.
+func (ws *WikiService) AliasTarget(name string) (string, bool) {
+	p, ok := ws.ResolvePage(name, "")
+	if !ok || strings.EqualFold(p, strings.Trim(name, "/")) {
+		return "", false
+	}
+	return p, true
+}
+
+// nearestPath picks the candidate closest to the page at from, the way
+// Obsidian resolves a name that several files share: the page's own
+// attachment directory first, then its folder, then folders below it, and
+// otherwise the shortest path.
+func nearestPath(candidates []string, from string) (string, bool) {
+	if len(candidates) == 0 {
+		return "", false
+	}
+	dir := path.Dir(from)
+	rank := func(p string) (int, int) {
+		d := path.Dir(p)
+		switch {
+		case from != "" && d == from:
+			return 0, 0
+		case d == dir:
+			return 1, 0
+		case dir == "." || strings.HasPrefix(d, dir+"/"):
+			return 2, strings.Count(p, "/")
+		}
+		return 3, strings.Count(p, "/")
+	}
+	best := candidates[0]
+	bestTier, bestDepth := rank(best)
+	for _, c := range candidates[1:] {
+		tier, depth := rank(c)
+		if tier < bestTier || tier == bestTier && (depth < bestDepth || depth == bestDepth && c < best) {
+			best, bestTier, bestDepth = c, tier, depth
+		}
+	}
+	return best, true
+}
@@ -0,0 +1,77 @@
+package wiki
+
+import (
+	"context"
+	"testing"
+
+	"github.com/sa/gopherwiki/internal/storage"
+)
+
+func TestVaultResolution(t *testing.T) {
+	ws, cleanup := setupTestService(t)
+	defer cleanup()
+	author := storage.Author{Name: "Test User", Email: "test@example.com"}
+
+	for name, content := range map[string]string{
+		"Work/Meeting Notes.md":        "---\naliases: [Standup]\n---\n# Meetings\nNotes.\n",
+		"Archive/Meeting Notes.md":     "# Old meetings\n",
+		"Work/Today.md":                "# Today\n",
+		"Work/attachments/diagram.png": "PNG",
+		"diagram.png":                  "PNG",
+		"Work/Today/photo.jpg":         "JPG",
+		".obsidian/workspace.json":     "{}",
+		".trash/Deleted.md":            "# Deleted\n",
+	} {
+		if _, err := ws.store.StoreBytes(context.Background(), name, []byte(content), "Create "+name, author); err != nil {
+			t.Fatalf("store %s: %v", name, err)
+		}
+	}
+	ws.InvalidatePageTreeCache()
+
+	pages := []struct {
+		target, from, want string
+	}{
+		{"Meeting Notes", "Work/Today", "Work/Meeting Notes"},
+		{"meeting-notes", "Archive/Index", "Archive/Meeting Notes"},
+		{"Meeting Notes", "", "Archive/Meeting Notes"},
+		{"Archive/Meeting Notes.md", "Work/Today", "Archive/Meeting Notes"},
+		{"Standup", "", "Work/Meeting Notes"},
+		{"about", "Work/Today", "about"},
+		{"Deleted", "", ""},
+		{"Nowhere", "", ""},
+	}
+	for _, tt := range pages {
+		got, ok := ws.ResolvePage(tt.target, tt.from)
+		if got != tt.want || ok != (tt.want != "") {
+			t.Errorf("ResolvePage(%q, %q) = %q, %v; want %q", tt.target, tt.from, got, ok, tt.want)
+		}
+	}
+
+	files := []struct {
+		name, from, want string
+	}{
+		{"diagram.png", "Work/Today", "Work/attachments/diagram.png"},
+		{"diagram.png", "home", "diagram.png"},
+		{"photo.jpg", "Work/Today", "Work/Today/photo.jpg"},
+		{"attachments/diagram.png", "Work/Today", "Work/attachments/diagram.png"},
+		{"workspace.json", "", ""},
+	}
+	for _, tt := range files {
+		got, ok := ws.ResolveFile(tt.name, tt.from)
+		if got != tt.want || ok != (tt.want != "") {
+			t.Errorf("ResolveFile(%q, %q) = %q, %v; want %q", tt.name, tt.from, got, ok, tt.want)
+		}
+	}
+
+	body, ok := ws.PageSource("Work/Meeting Notes")
+	if !ok || body != "# Meetings\nNotes.\n" {
+		t.Errorf("PageSource = %q, %v; want the body without frontmatter", body, ok)
+	}
+
+	if got, ok := ws.AliasTarget("standup"); !ok || got != "Work/Meeting Notes" {
+		t.Errorf("AliasTarget(standup) = %q, %v", got, ok)
+	}
+	if _, ok := ws.AliasTarget("about"); ok {
+		t.Error("AliasTarget should not redirect a page to itself")
+	}
+}
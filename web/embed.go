@@ -8,3 +8,6 @@ var TemplatesFS embed.FS
 
 //go:embed static
 var StaticFS embed.FS
+
+//go:embed themes
+var ThemesFS embed.FS
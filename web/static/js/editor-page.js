@@ -10,7 +10,7 @@
 // attributes on #editor_block rather than interpolated into inline script.
 const _editorConfig = document.getElementById("editor_block").dataset;
 const pagepath = _editorConfig.pagepath;
-const currentRevision = _editorConfig.revision;
+let currentRevision = _editorConfig.revision;
 const _cursorLine = parseInt(_editorConfig.cursorLine, 10) || 0;
 const _cursorCh = parseInt(_editorConfig.cursorCh, 10) || 0;
 
@@ -68,11 +68,24 @@ function deleteDraft() {
     }).catch(err => console.log("Draft delete error:", err));
 }
 
+// resumeDraft is set when the editor was opened to resume a draft.
+const resumeDraft = new URLSearchParams(window.location.search).get("draft") === "resume";
+
 function loadDraft() {
     fetch("/" + pagepath + "/draft")
     .then(response => response.json())
     .then(data => {
-        if (data.found && data.content) {
+        if (data.found && data.content && resumeDraft) {
+            // Resumed from the drafts page: restore the draft even if the
+            // page changed since, saving it against the revision it was
+            // started on so that the save reports the conflict.
+            cm_editor.setValue(data.content);
+            cm_editor.setCursor({ line: data.cursor_line, ch: data.cursor_ch });
+            lastSavedContent = data.content;
+            if (data.revision) {
+                currentRevision = data.revision;
+            }
+        } else if (data.found && data.content) {
             if (data.revision === currentRevision || currentRevision === "") {
                 if (data.content !== cm_editor.getValue()) {
                     if (confirm("A draft was found. Do you want to restore it?")) {
@@ -156,3 +169,189 @@ window.addEventListener('beforeunload', function(e) {
         saveDraft();
     }
 });
+
+/* Attachment picker: queried lazily from the attachments API */
+const attachmentPageSize = 20;
+const attachmentSearch = document.getElementById("attachment-search");
+const attachmentScope = document.getElementById("attachment-scope");
+const attachmentSelect = document.getElementById("attachment-filename");
+const attachmentMore = document.getElementById("attachment-more");
+const attachmentEmpty = document.getElementById("attachment-empty");
+let attachmentOffset = 0;
+let attachmentSearchTimer = null;
+
+function loadAttachments(append) {
+    if (!append) {
+        attachmentOffset = 0;
+        attachmentSelect.length = 1;
+        attachmentSelect.selectedIndex = 0;
+    }
+    const params = new URLSearchParams({
+        q: attachmentSearch.value.trim(),
+        limit: attachmentPageSize,
+        offset: attachmentOffset,
+    });
+    const url = attachmentScope.value === "recent"
+        ? "/-/api/v1/attachments/recent?" + params
+        : "/-/api/v1/pages/" + pagepath + "/attachments?" + params;
+
+    fetch(url)
+        .then(response => response.json())
+        .then(function (resp) {
+            const result = resp.data;
+            result.attachments.forEach(function (a) {
+                const option = document.createElement("option");
+                option.value = a.filename + "/--/" + a.url + "/--/" + a.url;
+                option.textContent = attachmentScope.value === "recent" ? a.pagepath + "/" + a.filename : a.filename;
+                attachmentSelect.appendChild(option);
+            });
+            attachmentOffset += result.attachments.length;
+            const hasMore = attachmentScope.value === "page" && attachmentOffset < result.total;
+            attachmentMore.style.display = hasMore ? '' : 'none';
+            attachmentEmpty.style.display = attachmentOffset === 0 ? '' : 'none';
+        })
+        .catch(function () {
+            console.log('Error loading attachments ...');
+        });
+}
+
+attachmentSearch.addEventListener('input', function() {
+    clearTimeout(attachmentSearchTimer);
+    attachmentSearchTimer = setTimeout(function() { loadAttachments(false); }, 300);
+});
+attachmentScope.addEventListener('change', function() { loadAttachments(false); });
+attachmentMore.addEventListener('click', function() { loadAttachments(true); });
+attachmentSearch.addEventListener('focus', function() {
+    if (attachmentSelect.length === 1) {
+        loadAttachments(false);
+    }
+}, { once: true });
+attachmentSelect.addEventListener('focus', function() {
+    if (attachmentSelect.length === 1) {
+        loadAttachments(false);
+    }
+}, { once: true });
+
+/* [[wikilink]] completion: typing "[[" offers matching pages at the cursor */
+const wikilinkLimit = 10;
+const wikilinkMenu = document.createElement("div");
+wikilinkMenu.className = "search-dropdown wikilink-completions";
+wikilinkMenu.style.display = "none";
+document.body.appendChild(wikilinkMenu);
+let wikilinkQuery = null;
+let wikilinkItems = [];
+let wikilinkActive = 0;
+let wikilinkTimer = null;
+
+// wikilinkPrefix returns the text typed after an unclosed "[[" before the
+// cursor, or null outside one.
+function wikilinkPrefix() {
+    const cursor = cm_editor.getCursor();
+    const before = cm_editor.getLine(cursor.line).slice(0, cursor.ch);
+    const open = before.lastIndexOf("[[");
+    if (open < 0) return null;
+    const typed = before.slice(open + 2);
+    if (typed.includes("]") || typed.includes("|")) return null;
+    return typed;
+}
+
+function closeWikilinkMenu() {
+    wikilinkMenu.style.display = "none";
+    wikilinkQuery = null;
+    wikilinkItems = [];
+}
+
+function renderWikilinkMenu() {
+    wikilinkMenu.textContent = "";
+    wikilinkItems.forEach(function (page, i) {
+        const item = document.createElement("a");
+        item.href = "/" + page.path;
+        item.className = "search-dropdown-item" + (i === wikilinkActive ? " active" : "");
+        const title = document.createElement("span");
+        title.className = "search-dropdown-title";
+        title.textContent = page.title;
+        const path = document.createElement("span");
+        path.className = "search-dropdown-path";
+        path.textContent = page.path;
+        item.append(title, path);
+        item.addEventListener("mousedown", function (e) {
+            e.preventDefault();
+            insertWikilinkCompletion(page);
+        });
+        wikilinkMenu.appendChild(item);
+    });
+    const view = cm_editor.view;
+    const coords = view.coordsAtPos(view.state.selection.main.head);
+    if (wikilinkItems.length === 0 || !coords) {
+        wikilinkMenu.style.display = "none";
+        return;
+    }
+    wikilinkMenu.style.left = coords.left + "px";
+    wikilinkMenu.style.top = coords.bottom + "px";
+    wikilinkMenu.style.display = "";
+}
+
+// insertWikilinkCompletion replaces what was typed after "[[" with the
+// page's path and closes the link.
+function insertWikilinkCompletion(page) {
+    const typed = wikilinkPrefix();
+    if (typed === null) return closeWikilinkMenu();
+    const cursor = cm_editor.getCursor();
+    const from = { line: cursor.line, ch: cursor.ch - typed.length };
+    const rest = cm_editor.getLine(cursor.line).slice(cursor.ch);
+    const close = rest.startsWith("]]") ? "" : "]]";
+    cm_editor.replaceRange(page.path + close, from, cursor);
+    cm_editor.setCursor({ line: cursor.line, ch: from.ch + page.path.length + 2 });
+    closeWikilinkMenu();
+    cm_editor.focus();
+}
+
+function loadWikilinkCompletions() {
+    const typed = wikilinkPrefix();
+    if (typed === null) return closeWikilinkMenu();
+    if (typed === wikilinkQuery) return;
+    wikilinkQuery = typed;
+    const params = new URLSearchParams({ q: typed, limit: wikilinkLimit });
+    fetch("/-/api/v1/autocomplete/pages?" + params)
+        .then(response => response.json())
+        .then(function (resp) {
+            if (typed !== wikilinkQuery) return;
+            wikilinkItems = resp.data || [];
+            wikilinkActive = 0;
+            renderWikilinkMenu();
+        })
+        .catch(function () {
+            console.log('Error loading page completions ...');
+        });
+}
+
+cm_editor.on("change", function() {
+    clearTimeout(wikilinkTimer);
+    wikilinkTimer = setTimeout(loadWikilinkCompletions, 150);
+});
+
+// Keys are caught before the editor sees them while completions are shown.
+editor_block.addEventListener("keydown", function (e) {
+    if (wikilinkMenu.style.display === "none" || wikilinkItems.length === 0) return;
+    switch (e.key) {
+    case "ArrowDown":
+        wikilinkActive = (wikilinkActive + 1) % wikilinkItems.length;
+        break;
+    case "ArrowUp":
+        wikilinkActive = (wikilinkActive + wikilinkItems.length - 1) % wikilinkItems.length;
+        break;
+    case "Enter":
+    case "Tab":
+        insertWikilinkCompletion(wikilinkItems[wikilinkActive]);
+        break;
+    case "Escape":
+        closeWikilinkMenu();
+        break;
+    default:
+        return;
+    }
+    e.preventDefault();
+    e.stopPropagation();
+    if (wikilinkMenu.style.display !== "none") renderWikilinkMenu();
+}, true);
+editor_block.addEventListener("focusout", closeWikilinkMenu);
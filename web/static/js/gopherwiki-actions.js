@@ -6,11 +6,28 @@
 //   [data-action="toggle-sidebar"]    -> window.toggleSidebar()
 //   [data-action="toggle-dark-mode"]  -> window.toggleDarkMode()
 //   [data-action="toggle-modal"]      -> window.gopherwiki.toggleModal(data-target)
+//   [data-action="file-issue"]        -> follow the link, quoting the selected text
+//   [data-action="copy-link"]         -> copy the link's URL to the clipboard
 //   [data-editor-action="<method>"]   -> window.gopherwiki_editor.<method>()
 //   form[data-confirm="<message>"]    -> confirm(message) before submit
 (function () {
     "use strict";
 
+    // The text last selected on the page, kept while a menu is opened, which
+    // may collapse the selection, and forgotten on a click elsewhere.
+    var lastSelection = "";
+    document.addEventListener("selectionchange", function () {
+        var text = String(window.getSelection()).trim();
+        if (text) {
+            lastSelection = text;
+        }
+    });
+    document.addEventListener("mousedown", function (event) {
+        if (!event.target.closest(".dropdown, .dropdown-menu, [data-action]")) {
+            lastSelection = "";
+        }
+    });
+
     document.addEventListener("click", function (event) {
         var trigger = event.target.closest("[data-action]");
         if (trigger) {
@@ -26,6 +43,23 @@
                         window.toggleDarkMode();
                     }
                     break;
+                case "file-issue":
+                    if (lastSelection) {
+                        event.preventDefault();
+                        window.location.href = trigger.href + "&quote=" + encodeURIComponent(lastSelection.slice(0, 2000));
+                    }
+                    break;
+                case "copy-link":
+                    // Without the clipboard (e.g. over plain http) the link
+                    // is followed, so its URL can be copied from the address bar.
+                    if (navigator.clipboard) {
+                        event.preventDefault();
+                        navigator.clipboard.writeText(trigger.href).then(function () {
+                            trigger.classList.add("copied");
+                            trigger.setAttribute("title", "Copied to the clipboard");
+                        });
+                    }
+                    break;
                 case "toggle-modal":
                     if (window.gopherwiki && typeof window.gopherwiki.toggleModal === "function") {
                         window.gopherwiki.toggleModal(trigger.getAttribute("data-target"));
@@ -19,8 +19,12 @@
         try { localStorage.setItem(key, value); } catch (_) { /* noop */ }
     }
 
+    // The color scheme saved to the account of a logged-in user, if any:
+    // "light", "dark", or "" to follow the browser.
+    var account = document.documentElement.getAttribute("data-color-scheme");
+
     // Restore theme on load (runs synchronously in <head> or before paint)
-    var stored = getStored(THEME_KEY);
+    var stored = account !== null ? account : getStored(THEME_KEY);
     if (stored === "dark" || stored === "light") {
         applyTheme(stored);
     } else if (window.matchMedia && window.matchMedia("(prefers-color-scheme: dark)").matches) {
@@ -34,8 +38,27 @@
         var next = current === "dark" ? "light" : "dark";
         applyTheme(next);
         store(THEME_KEY, next);
+        if (account !== null) {
+            account = next;
+            var csrf = document.querySelector('meta[name="csrf-token"]');
+            fetch("/-/settings/color-scheme", {
+                method: "POST",
+                headers: {
+                    "Content-Type": "application/x-www-form-urlencoded",
+                    "X-CSRF-Token": csrf ? csrf.content : ""
+                },
+                body: "scheme=" + encodeURIComponent(next)
+            });
+        }
     };
 
+    // Keep recently viewed pages readable offline and the wiki installable.
+    if ("serviceWorker" in navigator) {
+        window.addEventListener("load", function () {
+            navigator.serviceWorker.register("/-/sw.js", { scope: "/" }).catch(function () { /* noop */ });
+        });
+    }
+
     // Restore sidebar state on DOM ready
     document.addEventListener("DOMContentLoaded", function () {
         if (getStored(SIDEBAR_KEY) === "collapsed") {
@@ -0,0 +1,200 @@
+// The link graph at /-/graph, drawn on a canvas.
+//
+// The canvas carries data-graph-url, the graph as JSON: its nodes are the
+// pages, with their links in and out and whether they are orphans or hubs,
+// and its links the wiki links between them. The layout is a simple force
+// simulation: nodes push each other apart, links pull theirs together, and
+// everything drifts towards the middle. Clicking a node opens its page.
+(function () {
+    "use strict";
+
+    var canvas = document.getElementById("link-graph");
+    if (!canvas || !canvas.getContext) {
+        return;
+    }
+    var orphansBox = document.getElementById("link-graph-orphans");
+    var hubsBox = document.getElementById("link-graph-hubs");
+    var ctx = canvas.getContext("2d");
+    var nodes = [];
+    var links = [];
+    var hovered = null;
+    var width = 0;
+    var height = 0;
+
+    function radius(node) {
+        return 4 + Math.sqrt(node.links_in) * 2;
+    }
+
+    function resize() {
+        var ratio = window.devicePixelRatio || 1;
+        width = canvas.clientWidth;
+        height = Math.max(320, Math.round(width * 0.6));
+        canvas.style.height = height + "px";
+        canvas.width = width * ratio;
+        canvas.height = height * ratio;
+        ctx.setTransform(ratio, 0, 0, ratio, 0, 0);
+    }
+
+    function tick(alpha) {
+        var i, j, a, b, dx, dy, d2, d, f;
+        for (i = 0; i < nodes.length; i++) {
+            a = nodes[i];
+            for (j = i + 1; j < nodes.length; j++) {
+                b = nodes[j];
+                dx = b.x - a.x;
+                dy = b.y - a.y;
+                d2 = dx * dx + dy * dy || 0.01;
+                f = (900 / d2) * alpha;
+                a.vx -= dx * f;
+                a.vy -= dy * f;
+                b.vx += dx * f;
+                b.vy += dy * f;
+            }
+        }
+        links.forEach(function (l) {
+            dx = l.target.x - l.source.x;
+            dy = l.target.y - l.source.y;
+            d = Math.sqrt(dx * dx + dy * dy) || 0.01;
+            f = ((d - 60) / d) * 0.05 * alpha;
+            l.source.vx += dx * f;
+            l.source.vy += dy * f;
+            l.target.vx -= dx * f;
+            l.target.vy -= dy * f;
+        });
+        nodes.forEach(function (n) {
+            n.vx += (width / 2 - n.x) * 0.01 * alpha;
+            n.vy += (height / 2 - n.y) * 0.01 * alpha;
+            n.vx *= 0.6;
+            n.vy *= 0.6;
+            n.x = Math.min(width - 8, Math.max(8, n.x + n.vx));
+            n.y = Math.min(height - 8, Math.max(8, n.y + n.vy));
+        });
+    }
+
+    function draw() {
+        var style = window.getComputedStyle(canvas);
+        var color = style.color;
+        ctx.clearRect(0, 0, width, height);
+
+        ctx.strokeStyle = color;
+        ctx.globalAlpha = 0.25;
+        ctx.lineWidth = 1;
+        ctx.beginPath();
+        links.forEach(function (l) {
+            ctx.moveTo(l.source.x, l.source.y);
+            ctx.lineTo(l.target.x, l.target.y);
+        });
+        ctx.stroke();
+        ctx.globalAlpha = 1;
+
+        nodes.forEach(function (n) {
+            var fill = color;
+            if (orphansBox && orphansBox.checked && n.orphan) {
+                fill = "#d9534f";
+            } else if (hubsBox && hubsBox.checked && n.hub) {
+                fill = "#f0ad4e";
+            }
+            ctx.beginPath();
+            ctx.arc(n.x, n.y, radius(n), 0, 2 * Math.PI);
+            if (n.exists) {
+                ctx.fillStyle = fill;
+                ctx.fill();
+            } else {
+                ctx.strokeStyle = fill;
+                ctx.lineWidth = 1.5;
+                ctx.stroke();
+            }
+        });
+
+        ctx.fillStyle = color;
+        ctx.font = style.fontSize + " " + style.fontFamily;
+        nodes.forEach(function (n) {
+            if (n === hovered || (hubsBox && hubsBox.checked && n.hub)) {
+                ctx.fillText(n.name, n.x + radius(n) + 3, n.y + 4);
+            }
+        });
+    }
+
+    function nodeAt(event) {
+        var rect = canvas.getBoundingClientRect();
+        var x = event.clientX - rect.left;
+        var y = event.clientY - rect.top;
+        for (var i = nodes.length - 1; i >= 0; i--) {
+            var n = nodes[i];
+            var r = radius(n) + 2;
+            if ((n.x - x) * (n.x - x) + (n.y - y) * (n.y - y) <= r * r) {
+                return n;
+            }
+        }
+        return null;
+    }
+
+    function start(graph) {
+        var byID = {};
+        resize();
+        nodes = graph.nodes.map(function (n, i) {
+            var angle = i * 2.39996;
+            var spread = Math.sqrt(i + 1) * 12;
+            n.x = width / 2 + Math.cos(angle) * spread;
+            n.y = height / 2 + Math.sin(angle) * spread;
+            n.vx = 0;
+            n.vy = 0;
+            byID[n.id] = n;
+            return n;
+        });
+        links = graph.links.map(function (l) {
+            return { source: byID[l.source], target: byID[l.target] };
+        }).filter(function (l) {
+            return l.source && l.target;
+        });
+
+        // Large graphs settle in fewer, costlier steps.
+        var steps = nodes.length > 1000 ? 60 : 300;
+        var step = 0;
+        (function frame() {
+            tick(1 - step / steps);
+            draw();
+            step++;
+            if (step < steps) {
+                window.requestAnimationFrame(frame);
+            }
+        })();
+    }
+
+    canvas.addEventListener("mousemove", function (event) {
+        var n = nodeAt(event);
+        if (n !== hovered) {
+            hovered = n;
+            canvas.style.cursor = n ? "pointer" : "";
+            canvas.title = n ? n.id : "";
+            draw();
+        }
+    });
+    canvas.addEventListener("click", function (event) {
+        var n = nodeAt(event);
+        if (n) {
+            window.location.href = "/" + n.id;
+        }
+    });
+    [orphansBox, hubsBox].forEach(function (box) {
+        if (box) {
+            box.addEventListener("change", draw);
+        }
+    });
+    window.addEventListener("resize", function () {
+        resize();
+        draw();
+    });
+
+    fetch(canvas.dataset.graphUrl, { headers: { Accept: "application/json" } })
+        .then(function (response) { return response.json(); })
+        .then(function (body) {
+            if (body.error) {
+                throw new Error(body.error);
+            }
+            start(body.data);
+        })
+        .catch(function (err) {
+            canvas.replaceWith(document.createTextNode("The link graph could not be drawn: " + err.message));
+        });
+})();
@@ -0,0 +1,12 @@
+// Print view of a page (?format=print on the export route).
+//
+// The print stylesheet is applied on screen as well, so the view shows what
+// will be printed; the print dialog opens once images and fonts have loaded,
+// and saving as PDF from it gives a copy of the page.
+(function () {
+    "use strict";
+
+    window.addEventListener("load", function () {
+        window.print();
+    });
+})();
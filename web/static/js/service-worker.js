@@ -0,0 +1,113 @@
+/* vim: set et sts=4 ts=4 sw=4 ai: */
+/* GopherWiki service worker: keeps recently viewed pages readable offline.
+ *
+ * The wiki serves this file at /-/sw.js, after defining CACHE_VERSION, its
+ * version, and OFFLINE_URL, the page shown for a page never viewed. Caches
+ * are named after the version, so a new release starts them afresh. */
+
+"use strict";
+
+var PAGES = "gopherwiki-pages-" + CACHE_VERSION;
+var ASSETS = "gopherwiki-assets-" + CACHE_VERSION;
+
+// Pages kept for offline reading; the least recently viewed go first.
+var MAX_PAGES = 50;
+
+// Versioned static URLs carry a content hash ("gopherwiki.3f2a9c1d0b.css"),
+// so what is cached under one never changes.
+var VERSIONED = /^\/static\/.+\.[0-9a-f]{10}\.[^\/.]+$/;
+
+self.addEventListener("install", function (event) {
+    event.waitUntil(caches.open(ASSETS).then(function (cache) {
+        return cache.add(OFFLINE_URL);
+    }).then(function () {
+        return self.skipWaiting();
+    }));
+});
+
+self.addEventListener("activate", function (event) {
+    event.waitUntil(caches.keys().then(function (names) {
+        return Promise.all(names.filter(function (name) {
+            return name.indexOf("gopherwiki-") === 0 && name !== PAGES && name !== ASSETS;
+        }).map(function (name) {
+            return caches.delete(name);
+        }));
+    }).then(function () {
+        return self.clients.claim();
+    }));
+});
+
+self.addEventListener("fetch", function (event) {
+    var request = event.request;
+    var url = new URL(request.url);
+    if (url.origin !== self.location.origin) {
+        return;
+    }
+    if (request.method !== "GET") {
+        // Whoever logs in next must not read the pages of the last user.
+        if (url.pathname === "/-/login" || url.pathname === "/-/logout") {
+            event.waitUntil(caches.delete(PAGES));
+        }
+        return;
+    }
+    if (VERSIONED.test(url.pathname)) {
+        event.respondWith(fromCache(request));
+    } else if (url.pathname.indexOf("/static/") === 0) {
+        event.respondWith(fromNetwork(request, ASSETS));
+    } else if (request.mode === "navigate") {
+        event.respondWith(fromNetwork(request, PAGES).catch(function () {
+            return caches.match(OFFLINE_URL, { cacheName: ASSETS });
+        }));
+    }
+});
+
+// fromCache answers a versioned asset from the cache, fetching and keeping
+// it the first time.
+function fromCache(request) {
+    return caches.open(ASSETS).then(function (cache) {
+        return cache.match(request).then(function (cached) {
+            return cached || fetch(request).then(function (response) {
+                if (response.ok) {
+                    cache.put(request, response.clone());
+                }
+                return response;
+            });
+        });
+    });
+}
+
+// fromNetwork fetches request, keeping a copy in the cache called name, and
+// answers the copy when the network fails. Of pages, only the views the wiki
+// marks with X-Offline-Page are kept.
+function fromNetwork(request, name) {
+    return fetch(request).then(function (response) {
+        if (response.ok && (name !== PAGES || response.headers.get("X-Offline-Page"))) {
+            var copy = response.clone();
+            caches.open(name).then(function (cache) {
+                // Deleting first moves the page to the end of the keys.
+                return cache.delete(request).then(function () {
+                    return cache.put(request, copy);
+                }).then(function () {
+                    return name === PAGES ? trim(cache) : null;
+                });
+            });
+        }
+        return response;
+    }, function (err) {
+        return caches.match(request, { cacheName: name }).then(function (cached) {
+            if (!cached) {
+                throw err;
+            }
+            return cached;
+        });
+    });
+}
+
+// trim keeps the MAX_PAGES pages of cache viewed last.
+function trim(cache) {
+    return cache.keys().then(function (keys) {
+        return Promise.all(keys.slice(0, Math.max(keys.length - MAX_PAGES, 0)).map(function (key) {
+            return cache.delete(key);
+        }));
+    });
+}
@@ -0,0 +1,54 @@
+// Toggleable task list checkboxes on the page view.
+//
+// The page container carries data-task-toggle (the toggle endpoint) and
+// data-revision (the revision the view was rendered from) only when the viewer
+// may edit the current revision of the page. Each checkbox carries the source
+// line of its item in data-task-line. Toggling commits the change; the
+// returned revision becomes the base for the next toggle, so toggles that race
+// an edit by someone else fail with a conflict instead of overwriting it.
+(function () {
+    "use strict";
+
+    var page = document.querySelector(".page[data-task-toggle]");
+    if (!page) {
+        return;
+    }
+    var csrfMeta = document.querySelector('meta[name="csrf-token"]');
+    var csrfToken = csrfMeta ? csrfMeta.content : "";
+
+    page.querySelectorAll("input.task-checkbox[data-task-line]").forEach(function (box) {
+        box.disabled = false;
+    });
+
+    page.addEventListener("change", function (event) {
+        var box = event.target;
+        if (!box.matches("input.task-checkbox[data-task-line]")) {
+            return;
+        }
+        var formData = new FormData();
+        formData.append("line", box.dataset.taskLine);
+        formData.append("done", box.checked ? "true" : "false");
+        formData.append("revision", page.dataset.revision);
+
+        box.disabled = true;
+        fetch(page.dataset.taskToggle, {
+            method: "POST",
+            headers: { "X-CSRF-Token": csrfToken },
+            body: formData,
+        })
+        .then(function (response) { return response.json(); })
+        .then(function (data) {
+            if (!data.success) {
+                throw new Error(data.error || "Failed to update task");
+            }
+            page.dataset.revision = data.revision;
+        })
+        .catch(function (err) {
+            box.checked = !box.checked;
+            alert(err.message);
+        })
+        .finally(function () {
+            box.disabled = false;
+        });
+    });
+})();